@@ -0,0 +1,244 @@
+/*
+ * Public Domain Software
+ *
+ * I (Matthias Ladkau) am the author of the source code in this file.
+ * I have placed the source code in this file in the public domain.
+ *
+ * For further information see: http://creativecommons.org/publicdomain/zero/1.0/
+ */
+
+package cryptutil
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+/*
+Cost limits of bcrypt hashes. The number of key expansion rounds is 2^cost.
+*/
+const (
+	BcryptMinCost     = 4
+	BcryptMaxCost     = 31
+	BcryptDefaultCost = 10
+)
+
+/*
+Bcrypt related errors
+*/
+var (
+	ErrBcryptMismatch    = errors.New("Password does not match bcrypt hash")
+	ErrBcryptInvalidHash = errors.New("Invalid bcrypt hash")
+)
+
+/*
+bcryptEncoding is the base64 encoding of bcrypt hashes.
+*/
+var bcryptEncoding = base64.NewEncoding("./ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789").WithPadding(base64.NoPadding)
+
+/*
+bcryptMagic is the text which is encrypted to produce a bcrypt hash.
+*/
+var bcryptMagic = []byte("OrpheanBeholderScryDoubt")
+
+/*
+GenerateBcryptHash produces a bcrypt hash ($2a$ format) of a password with a
+random salt. Only the first 72 bytes of the password are used.
+*/
+func GenerateBcryptHash(password []byte, cost int) (string, error) {
+
+	if cost < BcryptMinCost || cost > BcryptMaxCost {
+		return "", fmt.Errorf("Invalid bcrypt cost: %v", cost)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	return bcryptHash(password, cost, salt), nil
+}
+
+/*
+CompareBcryptHash checks if a password matches a bcrypt hash ($2a$, $2b$ or
+$2y$ format). Returns ErrBcryptMismatch if the password does not match.
+*/
+func CompareBcryptHash(hash string, password []byte) error {
+
+	if len(hash) != 60 || hash[0] != '$' || hash[1] != '2' || hash[3] != '$' || hash[6] != '$' ||
+		(hash[2] != 'a' && hash[2] != 'b' && hash[2] != 'y') {
+		return ErrBcryptInvalidHash
+	}
+
+	cost, err := strconv.Atoi(hash[4:6])
+	if err != nil || cost < BcryptMinCost || cost > BcryptMaxCost {
+		return ErrBcryptInvalidHash
+	}
+
+	salt, err := bcryptEncoding.DecodeString(hash[7:29])
+	if err != nil {
+		return ErrBcryptInvalidHash
+	}
+
+	// The version of the given hash is kept - all versions produce the same
+	// result for passwords of up to 72 bytes
+
+	res := hash[:3] + bcryptHash(password, cost, salt)[3:]
+
+	if subtle.ConstantTimeCompare([]byte(res), []byte(hash)) != 1 {
+		return ErrBcryptMismatch
+	}
+
+	return nil
+}
+
+/*
+bcryptHash produces a bcrypt hash of a password with a given cost and salt.
+*/
+func bcryptHash(password []byte, cost int, salt []byte) string {
+
+	// The key is the zero terminated password (at most 72 bytes)
+
+	key := make([]byte, 0, len(password)+1)
+	key = append(append(key, password...), 0)
+
+	if len(key) > 72 {
+		key = key[:72]
+	}
+
+	// Expensive key setup
+
+	c := newBlowfish()
+
+	c.expandKeyWithSalt(key, salt)
+
+	for i := uint64(0); i < 1<<uint(cost); i++ {
+		c.expandKey(key)
+		c.expandKey(salt)
+	}
+
+	// Encrypt the magic text 64 times
+
+	text := make([]uint32, len(bcryptMagic)/4)
+	pos := 0
+	for i := range text {
+		text[i] = streamWord(bcryptMagic, &pos)
+	}
+
+	for i := 0; i < 64; i++ {
+		for j := 0; j < len(text); j += 2 {
+			text[j], text[j+1] = c.encrypt(text[j], text[j+1])
+		}
+	}
+
+	out := make([]byte, 0, len(bcryptMagic))
+	for _, w := range text {
+		out = append(out, byte(w>>24), byte(w>>16), byte(w>>8), byte(w))
+	}
+
+	// Only 23 bytes of the result are used
+
+	return fmt.Sprintf("$2a$%02d$%v%v", cost, bcryptEncoding.EncodeToString(salt),
+		bcryptEncoding.EncodeToString(out[:23]))
+}
+
+/*
+blowfish is the state of a Blowfish cipher.
+*/
+type blowfish struct {
+	p [18]uint32     // P-array
+	s [4][256]uint32 // S-boxes
+}
+
+/*
+newBlowfish creates a new Blowfish cipher in its initial state.
+*/
+func newBlowfish() *blowfish {
+	return &blowfish{blowfishP, blowfishS}
+}
+
+/*
+f is the round function of the cipher.
+*/
+func (c *blowfish) f(x uint32) uint32 {
+	return ((c.s[0][x>>24] + c.s[1][x>>16&0xff]) ^ c.s[2][x>>8&0xff]) + c.s[3][x&0xff]
+}
+
+/*
+encrypt encrypts a single block given as two words.
+*/
+func (c *blowfish) encrypt(l uint32, r uint32) (uint32, uint32) {
+
+	for i := 0; i < 16; i += 2 {
+		l ^= c.p[i]
+		r ^= c.f(l)
+		r ^= c.p[i+1]
+		l ^= c.f(r)
+	}
+
+	l ^= c.p[16]
+	r ^= c.p[17]
+
+	return r, l
+}
+
+/*
+expandKey mixes a key into the state of the cipher.
+*/
+func (c *blowfish) expandKey(key []byte) {
+	c.expandKeyWithSalt(key, nil)
+}
+
+/*
+expandKeyWithSalt mixes a key into the state of the cipher. The salt (if
+given) is mixed into the blocks which are encrypted to produce the new state.
+*/
+func (c *blowfish) expandKeyWithSalt(key []byte, salt []byte) {
+
+	pos := 0
+	for i := range c.p {
+		c.p[i] ^= streamWord(key, &pos)
+	}
+
+	var l, r uint32
+
+	pos = 0
+	next := func() (uint32, uint32) {
+		if salt != nil {
+			l ^= streamWord(salt, &pos)
+			r ^= streamWord(salt, &pos)
+		}
+		return c.encrypt(l, r)
+	}
+
+	for i := 0; i < len(c.p); i += 2 {
+		l, r = next()
+		c.p[i], c.p[i+1] = l, r
+	}
+
+	for i := range c.s {
+		for j := 0; j < len(c.s[i]); j += 2 {
+			l, r = next()
+			c.s[i][j], c.s[i][j+1] = l, r
+		}
+	}
+}
+
+/*
+streamWord reads the next word from a given data cycle. The position is
+advanced by four bytes.
+*/
+func streamWord(data []byte, pos *int) uint32 {
+	var w uint32
+
+	for i := 0; i < 4; i++ {
+		w = w<<8 | uint32(data[*pos])
+		*pos = (*pos + 1) % len(data)
+	}
+
+	return w
+}
@@ -0,0 +1,86 @@
+/*
+ * Public Domain Software
+ *
+ * I (Matthias Ladkau) am the author of the source code in this file.
+ * I have placed the source code in this file in the public domain.
+ *
+ * For further information see: http://creativecommons.org/publicdomain/zero/1.0/
+ */
+
+package cryptutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBcrypt(t *testing.T) {
+
+	// Hashes produced by other bcrypt implementations
+
+	for pw, hash := range map[string]string{
+		"":                           "$2a$05$j9VwipyZ3/cZnBXVC8w6S.9IKSNKBbkY.h5/ZY47UYwiZYdq2VVaC",
+		"a":                          "$2a$05$t2tw317GaiEp.0zAeCp3c.2Lda9W8ho0QuoMfoZ2Ga25XkSqJKs4m",
+		"abc":                        "$2a$05$o3Whq3WzNy/K6Q4vd9QEbu6x2SRUGYg1nXYfM55eFenRsQsT8DR1q",
+		"allmine":                    "$2b$05$obZYK/Ox.GD/Hjs6gXuWFOTNIcEhG7gRln5TLvM9yJ4wlEtMmC3Ni",
+		"abcdefghijklmnopqrstuvwxyz": "$2y$05$heG2iE4Eroy8H5kqbK2MguRNSKWOFzogp0WM2rcx7Wq.7g1pshxoC",
+	} {
+		if err := CompareBcryptHash(hash, []byte(pw)); err != nil {
+			t.Error("Unexpected result:", pw, err)
+			return
+		}
+
+		if err := CompareBcryptHash(hash, []byte(pw+"x")); err != ErrBcryptMismatch {
+			t.Error("Unexpected result:", pw, err)
+			return
+		}
+	}
+
+	// Generated hashes have a random salt
+
+	hash1, err := GenerateBcryptHash([]byte("secret"), BcryptMinCost)
+	if err != nil || !strings.HasPrefix(hash1, "$2a$04$") || len(hash1) != 60 {
+		t.Error("Unexpected result:", hash1, err)
+		return
+	}
+
+	hash2, _ := GenerateBcryptHash([]byte("secret"), BcryptMinCost)
+
+	if hash1 == hash2 || CompareBcryptHash(hash1, []byte("secret")) != nil ||
+		CompareBcryptHash(hash2, []byte("secret")) != nil {
+		t.Error("Unexpected result:", hash1, hash2)
+		return
+	}
+
+	// Only the first 72 bytes of a password are used
+
+	long := strings.Repeat("0123456789", 8)
+
+	hash, _ := GenerateBcryptHash([]byte(long), BcryptMinCost)
+
+	if err := CompareBcryptHash(hash, []byte(long[:72]+"x")); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Test error cases
+
+	if _, err := GenerateBcryptHash([]byte("secret"), 3); err == nil || err.Error() != "Invalid bcrypt cost: 3" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	for _, hash := range []string{
+		"",
+		"$2a$05$j9VwipyZ3/cZnBXVC8w6S.9IKSNKBbkY.h5/ZY47UYwiZYdq2VVa",
+		"$2x$05$j9VwipyZ3/cZnBXVC8w6S.9IKSNKBbkY.h5/ZY47UYwiZYdq2VVaC",
+		"$2a$03$j9VwipyZ3/cZnBXVC8w6S.9IKSNKBbkY.h5/ZY47UYwiZYdq2VVaC",
+		"$2a$0x$j9VwipyZ3/cZnBXVC8w6S.9IKSNKBbkY.h5/ZY47UYwiZYdq2VVaC",
+		"$2a$05$j9VwipyZ3/cZnBXVC8w6S*9IKSNKBbkY.h5/ZY47UYwiZYdq2VVaC",
+	} {
+		if err := CompareBcryptHash(hash, []byte("")); err != ErrBcryptInvalidHash {
+			t.Error("Unexpected result:", hash, err)
+			return
+		}
+	}
+}
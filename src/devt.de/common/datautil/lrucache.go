@@ -0,0 +1,129 @@
+/*
+ * Public Domain Software
+ *
+ * I (Matthias Ladkau) am the author of the source code in this file.
+ * I have placed the source code in this file in the public domain.
+ *
+ * For further information see: http://creativecommons.org/publicdomain/zero/1.0/
+ */
+
+package datautil
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+/*
+LRUCache is a map based cache object storing string->interface{} which holds
+a maximum number of entries. If the cache is full then the least recently used
+entry is removed when a new entry is added.
+*/
+type LRUCache struct {
+	data    map[string]*list.Element // Data for the cache
+	order   *list.List               // Entries ordered by their last use (most recent first)
+	maxsize uint64                   // Max size of the cache
+	mutex   *sync.Mutex              // Mutex to protect atomic map operations
+}
+
+/*
+lruEntry is a single entry of a LRUCache.
+*/
+type lruEntry struct {
+	key   string
+	value interface{}
+}
+
+/*
+NewLRUCache creates a new LRUCache object which holds up to a given number of
+entries. A value of 0 means no size constraint.
+*/
+func NewLRUCache(maxsize uint64) *LRUCache {
+	return &LRUCache{make(map[string]*list.Element), list.New(), maxsize, &sync.Mutex{}}
+}
+
+/*
+Put stores an item in the LRUCache.
+*/
+func (lc *LRUCache) Put(k string, v interface{}) {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+
+	if e, ok := lc.data[k]; ok {
+		e.Value.(*lruEntry).value = v
+		lc.order.MoveToFront(e)
+		return
+	}
+
+	// If the cache is full remove the least recently used item
+
+	if lc.maxsize != 0 && uint64(lc.order.Len()) >= lc.maxsize {
+		oldest := lc.order.Back()
+		lc.order.Remove(oldest)
+		delete(lc.data, oldest.Value.(*lruEntry).key)
+	}
+
+	lc.data[k] = lc.order.PushFront(&lruEntry{k, v})
+}
+
+/*
+Get retrieves an item from the LRUCache.
+*/
+func (lc *LRUCache) Get(k string) (interface{}, bool) {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+
+	e, ok := lc.data[k]
+	if !ok {
+		return nil, false
+	}
+
+	lc.order.MoveToFront(e)
+
+	return e.Value.(*lruEntry).value, true
+}
+
+/*
+Remove removes an item in the LRUCache.
+*/
+func (lc *LRUCache) Remove(k string) bool {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+
+	e, ok := lc.data[k]
+	if ok {
+		lc.order.Remove(e)
+		delete(lc.data, k)
+	}
+
+	return ok
+}
+
+/*
+Size returns the number of items in the LRUCache.
+*/
+func (lc *LRUCache) Size() int {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+
+	return lc.order.Len()
+}
+
+/*
+String returns a string representation of this LRUCache. Items are listed
+from the most recently used to the least recently used item.
+*/
+func (lc *LRUCache) String() string {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+
+	buf := &bytes.Buffer{}
+	for e := lc.order.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(*lruEntry)
+		buf.WriteString(fmt.Sprint(entry.key, ":", entry.value, "\n"))
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,102 @@
+/*
+ * Public Domain Software
+ *
+ * I (Matthias Ladkau) am the author of the source code in this file.
+ * I have placed the source code in this file in the public domain.
+ *
+ * For further information see: http://creativecommons.org/publicdomain/zero/1.0/
+ */
+
+package datautil
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestLRUCache(t *testing.T) {
+
+	// Create a cache which can hold a maximum of 3 items
+
+	lc := NewLRUCache(3)
+
+	lc.Put("k1", "aaa")
+	lc.Put("k2", "bbb")
+	lc.Put("k3", "ccc")
+
+	if lc.String() != `
+k3:ccc
+k2:bbb
+k1:aaa
+`[1:] {
+		t.Error("Unexpected cache content:", lc)
+		return
+	}
+
+	// Reading an entry makes it the most recently used entry
+
+	if e, ok := lc.Get("k1"); e != "aaa" || !ok {
+		t.Error("Entry should be returned", ok, e)
+		return
+	}
+
+	// Adding a new entry removes the least recently used entry
+
+	lc.Put("k4", "ddd")
+
+	if lc.String() != `
+k4:ddd
+k1:aaa
+k3:ccc
+`[1:] {
+		t.Error("Unexpected cache content:", lc)
+		return
+	}
+
+	if e, ok := lc.Get("k2"); e != nil || ok {
+		t.Error("Removed entry should not be returned", ok, e)
+		return
+	}
+
+	// Updating an entry does not change the size
+
+	lc.Put("k3", "eee")
+
+	if lc.Size() != 3 || lc.String() != `
+k3:eee
+k4:ddd
+k1:aaa
+`[1:] {
+		t.Error("Unexpected cache content:", lc)
+		return
+	}
+
+	if !lc.Remove("k4") || lc.Remove("k4") || lc.Size() != 2 {
+		t.Error("Unexpected remove result:", lc)
+		return
+	}
+
+	// A cache without size constraint keeps all entries
+
+	lc = NewLRUCache(0)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			lc.Put(fmt.Sprint("k", i), i)
+			lc.Get(fmt.Sprint("k", i))
+		}(i)
+	}
+
+	wg.Wait()
+
+	if lc.Size() != 10 {
+		t.Error("Unexpected cache content:", lc)
+		return
+	}
+}
@@ -0,0 +1,29 @@
+//go:build linux || darwin || freebsd
+
+/*
+ * Public Domain Software
+ *
+ * I (Matthias Ladkau) am the author of the source code in this file.
+ * I have placed the source code in this file in the public domain.
+ *
+ * For further information see: http://creativecommons.org/publicdomain/zero/1.0/
+ */
+
+package fileutil
+
+import "syscall"
+
+/*
+DiskSpace returns the available and the total number of bytes of the file
+system which contains the given path. The available bytes are the bytes which
+can be used by unprivileged users.
+*/
+func DiskSpace(path string) (uint64, uint64, error) {
+	var st syscall.Statfs_t
+
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+
+	return uint64(st.Bavail) * uint64(st.Bsize), uint64(st.Blocks) * uint64(st.Bsize), nil
+}
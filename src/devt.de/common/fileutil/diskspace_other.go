@@ -0,0 +1,22 @@
+//go:build !linux && !darwin && !freebsd
+
+/*
+ * Public Domain Software
+ *
+ * I (Matthias Ladkau) am the author of the source code in this file.
+ * I have placed the source code in this file in the public domain.
+ *
+ * For further information see: http://creativecommons.org/publicdomain/zero/1.0/
+ */
+
+package fileutil
+
+import "errors"
+
+/*
+DiskSpace returns the available and the total number of bytes of the file
+system which contains the given path. Not supported on this platform.
+*/
+func DiskSpace(path string) (uint64, uint64, error) {
+	return 0, 0, errors.New("Disk space is not supported on this platform")
+}
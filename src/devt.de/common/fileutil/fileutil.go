@@ -9,7 +9,10 @@
 
 package fileutil
 
-import "os"
+import (
+	"io"
+	"os"
+)
 
 /*
 PathExists returns whether the given file or directory exists.
@@ -36,3 +39,32 @@ func IsDir(path string) (bool, error) {
 
 	return stat.IsDir(), nil
 }
+
+/*
+CopyFile copies a given file. An existing destination file is overwritten.
+Returns the number of copied bytes.
+*/
+func CopyFile(src string, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0660)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(out, in)
+
+	if err == nil {
+		err = out.Sync()
+	}
+
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+
+	return n, err
+}
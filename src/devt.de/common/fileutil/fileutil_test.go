@@ -10,6 +10,7 @@
 package fileutil
 
 import (
+	"io/ioutil"
 	"os"
 	"testing"
 )
@@ -81,3 +82,50 @@ func TestIsDir(t *testing.T) {
 
 	os.Remove(TESTPATH)
 }
+
+func TestCopyFile(t *testing.T) {
+	defer os.Remove(TESTPATH)
+	defer os.Remove(TESTPATH + "_copy")
+
+	ioutil.WriteFile(TESTPATH, []byte("test"), 0660)
+	ioutil.WriteFile(TESTPATH+"_copy", []byte("old content"), 0660)
+
+	if n, err := CopyFile(TESTPATH, TESTPATH+"_copy"); n != 4 || err != nil {
+		t.Error("Unexpected result:", n, err)
+		return
+	}
+
+	if res, _ := ioutil.ReadFile(TESTPATH + "_copy"); string(res) != "test" {
+		t.Error("Unexpected result:", string(res))
+		return
+	}
+
+	if _, err := CopyFile(TESTPATH+"_missing", TESTPATH+"_copy"); err == nil {
+		t.Error("Copying a missing file should fail")
+		return
+	}
+
+	if _, err := CopyFile(TESTPATH, "**"+string(rune(0x0))); err == nil {
+		t.Error("Copying to an invalid path should fail")
+		return
+	}
+}
+
+func TestDiskSpace(t *testing.T) {
+
+	free, total, err := DiskSpace(".")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if total == 0 || free > total {
+		t.Error("Unexpected result:", free, total)
+		return
+	}
+
+	if _, _, err := DiskSpace("fileutilnonexisting"); err == nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
@@ -9,11 +9,12 @@
 
 /*
 Package httputil contains a HTTP/HTTPS Server which can be stopped via signals
-or a Shutdown() call.
+or a Shutdown() call and a minimal WebSocket implementation (RFC 6455).
 */
 package httputil
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -31,10 +32,15 @@ import (
 HTTPServer data structure
 */
 type HTTPServer struct {
-	signalling chan os.Signal    // Channel for receiving signals
-	LastError  error             // Last recorded error
-	Running    bool              // Flag if the server is running
-	listener   signalTCPListener // TCP listener of the server
+	signalling  chan os.Signal    // Channel for receiving signals
+	LastError   error             // Last recorded error
+	Running     bool              // Flag if the server is running
+	GracePeriod time.Duration     // Time in-flight requests get to finish on shutdown
+	listener    signalTCPListener // TCP listener of the server
+	onShutdown  []func()          // Functions which are called on shutdown
+	shutdownCtx context.Context   // Context of a requested shutdown
+	stopped     chan error        // Channel which is closed once the server stopped
+	lock        sync.Mutex        // Lock for shutdown related fields
 }
 
 /*
@@ -46,6 +52,41 @@ func (hs *HTTPServer) Shutdown() {
 	}
 }
 
+/*
+ShutdownContext stops the server gracefully. The server stops accepting new
+connections and waits for in-flight requests until the given context is done
+- remaining connections are closed afterwards. This call returns once the
+server has stopped. Returns the error of the context if requests had to be
+interrupted.
+*/
+func (hs *HTTPServer) ShutdownContext(ctx context.Context) error {
+
+	hs.lock.Lock()
+	hs.shutdownCtx = ctx
+	stopped := hs.stopped
+	hs.lock.Unlock()
+
+	if stopped == nil {
+		return nil
+	}
+
+	hs.Shutdown()
+
+	return <-stopped
+}
+
+/*
+RegisterOnShutdown registers a function which is called once a shutdown was
+requested - before the server waits for in-flight requests. This can be used
+to close long-lived connections (e.g. WebSockets or event streams).
+*/
+func (hs *HTTPServer) RegisterOnShutdown(f func()) {
+	hs.lock.Lock()
+	defer hs.lock.Unlock()
+
+	hs.onShutdown = append(hs.onShutdown, f)
+}
+
 /*
 RunHTTPServer starts a HTTP Server which can be stopped via ^C (Control-C).
 It is assumed that all routes have been added prior to this call.
@@ -152,11 +193,19 @@ func (hs *HTTPServer) runServer(sl *signalTCPListener, wgStatus *sync.WaitGroup)
 
 	server := http.Server{}
 
-	// Attach SIGINT handler - on unix and windows this is send
-	// when the user presses ^C (Control-C).
+	// Attach SIGINT and SIGTERM handler - on unix and windows SIGINT is send
+	// when the user presses ^C (Control-C). SIGTERM is send by service
+	// managers and container runtimes.
+
+	stopped := make(chan error, 1)
 
+	hs.lock.Lock()
 	hs.signalling = make(chan os.Signal)
-	signal.Notify(hs.signalling, syscall.SIGINT)
+	hs.stopped = stopped
+	hs.lock.Unlock()
+
+	signal.Notify(hs.signalling, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(hs.signalling)
 
 	// Put the serve call into a wait group so we can wait until shutdown
 	// completed
@@ -171,14 +220,16 @@ func (hs *HTTPServer) runServer(sl *signalTCPListener, wgStatus *sync.WaitGroup)
 		server.Serve(sl)
 	}()
 
+	var err error
+
 	for true {
 		signal := <-hs.signalling
 
-		if signal == syscall.SIGINT {
+		if signal == syscall.SIGINT || signal == syscall.SIGTERM {
 
 			// Shutdown the server
 
-			sl.Shutdown()
+			err = hs.shutdownServer(&server)
 
 			// Wait until the server has shut down
 
@@ -190,6 +241,14 @@ func (hs *HTTPServer) runServer(sl *signalTCPListener, wgStatus *sync.WaitGroup)
 		}
 	}
 
+	hs.lock.Lock()
+	hs.stopped = nil
+	hs.shutdownCtx = nil
+	hs.lock.Unlock()
+
+	stopped <- err
+	close(stopped)
+
 	if wgStatus != nil {
 		wgStatus.Done()
 	}
@@ -197,6 +256,38 @@ func (hs *HTTPServer) runServer(sl *signalTCPListener, wgStatus *sync.WaitGroup)
 	return nil
 }
 
+/*
+shutdownServer stops accepting new connections, calls all registered shutdown
+functions and waits for in-flight requests until the shutdown context is done
+or the grace period has passed. Remaining connections are closed.
+*/
+func (hs *HTTPServer) shutdownServer(server *http.Server) error {
+
+	hs.lock.Lock()
+	ctx := hs.shutdownCtx
+	onShutdown := hs.onShutdown
+	hs.lock.Unlock()
+
+	if ctx == nil {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(context.Background(), hs.GracePeriod)
+		defer cancel()
+	}
+
+	for _, f := range onShutdown {
+		f()
+	}
+
+	err := server.Shutdown(ctx)
+
+	if err != nil {
+		server.Close()
+	}
+
+	return err
+}
+
 /*
 signalTCPListener models a TCPListener which can receive signals.
 */
@@ -11,6 +11,7 @@ package httputil
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"flag"
@@ -33,6 +34,7 @@ const certdir = "certs"
 
 const testporthttp = ":9050"
 const testporthttps = ":9051"
+const testportgraceful = ":9052"
 
 const invalidFileName = "**" + string(0x0)
 
@@ -225,6 +227,129 @@ func TestSignalling(t *testing.T) {
 	sl.Signals <- -1
 }
 
+func TestGracefulShutdown(t *testing.T) {
+
+	// Add a handler which blocks until it is released
+
+	started := make(chan bool)
+	release := make(chan bool)
+
+	http.HandleFunc("/httpserver_graceful_test", func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-release
+		fmt.Fprint(w, "Done")
+	})
+
+	runServer := func() (*HTTPServer, *sync.WaitGroup) {
+		hs := &HTTPServer{}
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+
+		go hs.RunHTTPServer(testportgraceful, &wg)
+
+		wg.Wait()
+		wg.Add(1)
+
+		return hs, &wg
+	}
+
+	sendRequest := func(res chan string) {
+		resp, err := http.Get("http://localhost" + testportgraceful + "/httpserver_graceful_test")
+		if err != nil {
+			res <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		res <- string(body)
+	}
+
+	hs, wg := runServer()
+
+	if hs.LastError != nil {
+		t.Error(hs.LastError)
+		return
+	}
+
+	shutdownCalled := false
+	hs.RegisterOnShutdown(func() {
+		shutdownCalled = true
+	})
+
+	// A request which is in progress during shutdown completes
+
+	res := make(chan string)
+	go sendRequest(res)
+	<-started
+
+	shutdownErr := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownErr <- hs.ShutdownContext(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	if !shutdownCalled {
+		t.Error("Shutdown function was not called")
+		return
+	}
+
+	// New connections are not accepted
+
+	if _, err := net.Dial("tcp", "localhost"+testportgraceful); err == nil {
+		t.Error("Server should not accept new connections")
+		return
+	}
+
+	release <- true
+
+	if r := <-res; r != "Done" {
+		t.Error("Unexpected response:", r)
+		return
+	}
+
+	if err := <-shutdownErr; err != nil || hs.Running {
+		t.Error("Unexpected result:", err, hs.Running)
+		return
+	}
+
+	wg.Wait()
+
+	// Requests are interrupted once the deadline is reached
+
+	hs, wg = runServer()
+
+	go sendRequest(res)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := hs.ShutdownContext(ctx); err != context.DeadlineExceeded {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if r := <-res; r == "Done" {
+		t.Error("Unexpected response:", r)
+		return
+	}
+
+	release <- true
+	wg.Wait()
+
+	// A shutdown of a stopped server returns immediately
+
+	if err := hs.ShutdownContext(context.Background()); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
 func testUnknownSignalPanic(t *testing.T, sl *signalTCPListener) {
 	defer func() {
 		if r := recover(); r == nil {
@@ -0,0 +1,506 @@
+/*
+ * Public Domain Software
+ *
+ * I (Matthias Ladkau) am the author of the source code in this file.
+ * I have placed the source code in this file in the public domain.
+ *
+ * For further information see: http://creativecommons.org/publicdomain/zero/1.0/
+ */
+
+package httputil
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Message types of WebSocket messages
+*/
+const (
+	WebSocketText   = 0x1
+	WebSocketBinary = 0x2
+	WebSocketClose  = 0x8
+	WebSocketPing   = 0x9
+	WebSocketPong   = 0xA
+)
+
+/*
+Status codes of WebSocket close messages
+*/
+const (
+	WebSocketCloseNormal       = 1000
+	WebSocketCloseGoingAway    = 1001
+	WebSocketCloseProtocol     = 1002
+	WebSocketClosePolicy       = 1008
+	WebSocketCloseTooBig       = 1009
+	WebSocketCloseServerError  = 1011
+	webSocketCloseNoStatusRcvd = 1005
+)
+
+/*
+webSocketGUID is used to compute the accept key of a WebSocket handshake.
+*/
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+/*
+WebSocketMaxMessageSize is the default maximum size of a received message.
+*/
+var WebSocketMaxMessageSize int64 = 1024 * 1024
+
+/*
+WebSocketCloseError is returned by ReadMessage once the other side has closed
+the connection.
+*/
+type WebSocketCloseError struct {
+	Code   int    // Status code of the close message
+	Reason string // Reason of the close message
+}
+
+/*
+Error returns a string representation of the error.
+*/
+func (e *WebSocketCloseError) Error() string {
+	return fmt.Sprintf("WebSocket closed: %v %v", e.Code, e.Reason)
+}
+
+/*
+WebSocketConn is a WebSocket connection (RFC 6455). Messages can be written
+concurrently to reading but only one goroutine should read at a time.
+*/
+type WebSocketConn struct {
+	MaxMessageSize int64             // Maximum size of a received message
+	PongHandler    func(data []byte) // Handler which is called for every received pong (optional)
+
+	conn      net.Conn      // Underlying network connection
+	br        *bufio.Reader // Buffered reader of the connection
+	client    bool          // Flag if this is the client side (client frames are masked)
+	writeLock *sync.Mutex   // Lock for writing frames
+	closed    bool          // Flag if a close message was sent
+}
+
+/*
+newWebSocketConn creates a new WebSocketConn instance.
+*/
+func newWebSocketConn(conn net.Conn, br *bufio.Reader, client bool) *WebSocketConn {
+	return &WebSocketConn{WebSocketMaxMessageSize, nil, conn, br, client, &sync.Mutex{}, false}
+}
+
+/*
+webSocketAccept computes the accept key for a given handshake key.
+*/
+func webSocketAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+/*
+headerContains checks if a comma separated header contains a given token.
+*/
+func headerContains(h http.Header, name string, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+IsWebSocketUpgrade checks if a given request asks for a WebSocket connection.
+*/
+func IsWebSocketUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") &&
+		headerContains(r.Header, "Upgrade", "websocket")
+}
+
+/*
+UpgradeWebSocket upgrades a HTTP request to a WebSocket connection. An error
+response is written if the request is not a valid WebSocket handshake.
+*/
+func UpgradeWebSocket(w http.ResponseWriter, r *http.Request) (*WebSocketConn, error) {
+
+	fail := func(msg string, code int) (*WebSocketConn, error) {
+		http.Error(w, msg, code)
+		return nil, errors.New(msg)
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+
+	if r.Method != "GET" {
+		return fail("WebSocket handshake needs a GET request", http.StatusMethodNotAllowed)
+	} else if !IsWebSocketUpgrade(r) {
+		return fail("Request is not a WebSocket handshake", http.StatusBadRequest)
+	} else if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return fail("Unsupported WebSocket version", http.StatusBadRequest)
+	} else if key == "" {
+		return fail("WebSocket handshake needs a key", http.StatusBadRequest)
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return fail("Connection cannot be upgraded", http.StatusInternalServerError)
+	}
+
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return fail("Connection cannot be upgraded: "+err.Error(), http.StatusInternalServerError)
+	}
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + webSocketAccept(key) + "\r\n"
+
+	// Keep headers which were already set (e.g. request IDs or CORS headers)
+
+	for k, vs := range w.Header() {
+		if k != "Content-Type" && k != "Content-Length" {
+			for _, v := range vs {
+				resp += k + ": " + v + "\r\n"
+			}
+		}
+	}
+
+	if _, err = conn.Write([]byte(resp + "\r\n")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return newWebSocketConn(conn, brw.Reader, false), nil
+}
+
+/*
+DialWebSocket opens a WebSocket connection to a given ws:// or wss:// URL with
+optional request headers and TLS configuration. The handshake response is
+returned if the server did not accept the connection.
+*/
+func DialWebSocket(wsURL string, header http.Header, tlsConfig *tls.Config) (*WebSocketConn, *http.Response, error) {
+	var conn net.Conn
+
+	u, err := url.Parse(wsURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	host := u.Host
+
+	switch u.Scheme {
+	case "ws":
+		if u.Port() == "" {
+			host += ":80"
+		}
+		conn, err = net.Dial("tcp", host)
+
+	case "wss":
+		if u.Port() == "" {
+			host += ":443"
+		}
+		conn, err = tls.Dial("tcp", host, tlsConfig)
+
+	default:
+		return nil, nil, fmt.Errorf("Unsupported WebSocket scheme: %v", u.Scheme)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyBytes := make([]byte, 16)
+	rand.Read(keyBytes)
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+
+	req := &http.Request{
+		Method:     "GET",
+		URL:        &url.URL{Path: u.Path, RawQuery: u.RawQuery},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Host:       u.Host,
+	}
+
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	if err = req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(conn)
+
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		resp.Header.Get("Sec-WebSocket-Accept") != webSocketAccept(key) {
+
+		conn.Close()
+		return nil, resp, fmt.Errorf("WebSocket handshake failed: %v", resp.Status)
+	}
+
+	return newWebSocketConn(conn, br, true), resp, nil
+}
+
+/*
+SetReadDeadline sets the deadline for reading messages.
+*/
+func (wc *WebSocketConn) SetReadDeadline(t time.Time) error {
+	return wc.conn.SetReadDeadline(t)
+}
+
+/*
+SetWriteDeadline sets the deadline for writing messages.
+*/
+func (wc *WebSocketConn) SetWriteDeadline(t time.Time) error {
+	return wc.conn.SetWriteDeadline(t)
+}
+
+/*
+WriteMessage writes a message of a given type.
+*/
+func (wc *WebSocketConn) WriteMessage(msgType int, data []byte) error {
+	wc.writeLock.Lock()
+	defer wc.writeLock.Unlock()
+
+	if wc.closed {
+		return errors.New("WebSocket is closed")
+	}
+
+	if msgType == WebSocketClose {
+		wc.closed = true
+	}
+
+	header := make([]byte, 2, 14)
+	header[0] = 0x80 | byte(msgType)
+
+	switch l := len(data); {
+	case l < 126:
+		header[1] = byte(l)
+	case l < 65536:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(l))
+	default:
+		header[1] = 127
+		header = append(header, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(l))
+	}
+
+	// Frames which are sent by a client must be masked
+
+	if wc.client {
+		mask := make([]byte, 4)
+		rand.Read(mask)
+
+		header[1] |= 0x80
+		header = append(header, mask...)
+
+		masked := make([]byte, len(data))
+		for i, b := range data {
+			masked[i] = b ^ mask[i%4]
+		}
+		data = masked
+	}
+
+	if _, err := wc.conn.Write(header); err != nil {
+		return err
+	}
+
+	_, err := wc.conn.Write(data)
+
+	return err
+}
+
+/*
+CloseWithStatus sends a close message with a given status code and reason and
+closes the connection.
+*/
+func (wc *WebSocketConn) CloseWithStatus(code int, reason string) error {
+	data := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(data, uint16(code))
+	data = append(data, reason...)
+
+	wc.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	wc.WriteMessage(WebSocketClose, data)
+
+	return wc.conn.Close()
+}
+
+/*
+Close sends a normal close message and closes the connection.
+*/
+func (wc *WebSocketConn) Close() error {
+	return wc.CloseWithStatus(WebSocketCloseNormal, "")
+}
+
+/*
+ReadMessage reads the next text or binary message. Pings are answered
+automatically. Returns a WebSocketCloseError once the other side has closed
+the connection.
+*/
+func (wc *WebSocketConn) ReadMessage() (int, []byte, error) {
+	var msgType int
+	var msg []byte
+
+	for {
+		fin, opcode, data, err := wc.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case WebSocketPing:
+			wc.WriteMessage(WebSocketPong, data)
+			continue
+
+		case WebSocketPong:
+			if wc.PongHandler != nil {
+				wc.PongHandler(data)
+			}
+			continue
+
+		case WebSocketClose:
+			cerr := &WebSocketCloseError{webSocketCloseNoStatusRcvd, ""}
+			if len(data) >= 2 {
+				cerr.Code = int(binary.BigEndian.Uint16(data))
+				cerr.Reason = string(data[2:])
+			}
+
+			// Echo the close message if it was not sent by this side
+
+			wc.writeLock.Lock()
+			closed := wc.closed
+			wc.writeLock.Unlock()
+
+			if !closed {
+				wc.CloseWithStatus(cerr.Code, "")
+			}
+
+			return 0, nil, cerr
+
+		case 0:
+			if msg == nil {
+				return 0, nil, wc.protocolError("Unexpected continuation frame")
+			}
+
+		default:
+			if msg != nil {
+				return 0, nil, wc.protocolError("Expected continuation frame")
+			}
+			msgType = opcode
+			msg = []byte{}
+		}
+
+		if int64(len(msg)+len(data)) > wc.MaxMessageSize {
+			wc.CloseWithStatus(WebSocketCloseTooBig, "Message too big")
+			return 0, nil, errors.New("WebSocket message too big")
+		}
+
+		msg = append(msg, data...)
+
+		if fin {
+			return msgType, msg, nil
+		}
+	}
+}
+
+/*
+protocolError closes the connection because of a protocol error.
+*/
+func (wc *WebSocketConn) protocolError(msg string) error {
+	wc.CloseWithStatus(WebSocketCloseProtocol, msg)
+	return errors.New("WebSocket protocol error: " + msg)
+}
+
+/*
+readFrame reads a single frame.
+*/
+func (wc *WebSocketConn) readFrame() (bool, int, []byte, error) {
+	var header [2]byte
+
+	if _, err := io.ReadFull(wc.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := int(header[0] & 0x0F)
+	masked := header[1]&0x80 != 0
+	length := int64(header[1] & 0x7F)
+
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, wc.protocolError("Unsupported extension")
+	} else if masked == wc.client {
+		return false, 0, nil, wc.protocolError("Invalid masking")
+	} else if opcode >= WebSocketClose && (!fin || length > 125) {
+		return false, 0, nil, wc.protocolError("Invalid control frame")
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(wc.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(wc.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	if length < 0 || length > wc.MaxMessageSize {
+		wc.CloseWithStatus(WebSocketCloseTooBig, "Message too big")
+		return false, 0, nil, errors.New("WebSocket message too big")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(wc.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(wc.br, data); err != nil {
+		return false, 0, nil, err
+	}
+
+	if masked {
+		for i := range data {
+			data[i] ^= mask[i%4]
+		}
+	}
+
+	return fin, opcode, data, nil
+}
@@ -0,0 +1,136 @@
+/*
+ * Public Domain Software
+ *
+ * I (Matthias Ladkau) am the author of the source code in this file.
+ * I have placed the source code in this file in the public domain.
+ *
+ * For further information see: http://creativecommons.org/publicdomain/zero/1.0/
+ */
+
+package httputil
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebSocket(t *testing.T) {
+
+	// Server which echoes all messages
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "foo")
+
+		conn, err := UpgradeWebSocket(w, r)
+		if err != nil {
+			return
+		}
+
+		conn.MaxMessageSize = 100000
+
+		for {
+			msgType, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if string(msg) == "close" {
+				conn.CloseWithStatus(WebSocketClosePolicy, "bye")
+				return
+			}
+
+			conn.WriteMessage(msgType, msg)
+		}
+	}))
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	// Normal HTTP requests are rejected
+
+	resp, _ := http.Get(srv.URL)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Error("Unexpected result:", resp.Status)
+		return
+	}
+
+	if _, _, err := DialWebSocket("http://localhost", nil, nil); err == nil || err.Error() != "Unsupported WebSocket scheme: http" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	conn, resp, err := DialWebSocket(wsURL, nil, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := resp.Header.Get("X-Test"); res != "foo" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Messages of all sizes are echoed
+
+	for _, size := range []int{0, 10, 125, 126, 1000, 70000} {
+		msg := strings.Repeat("a", size)
+
+		if err := conn.WriteMessage(WebSocketText, []byte(msg)); err != nil {
+			t.Error(err)
+			return
+		}
+
+		msgType, res, err := conn.ReadMessage()
+		if err != nil || msgType != WebSocketText || string(res) != msg {
+			t.Error("Unexpected result:", size, msgType, len(res), err)
+			return
+		}
+	}
+
+	// Pings are answered
+
+	pongs := 0
+	conn.PongHandler = func(data []byte) {
+		if string(data) == "ping" {
+			pongs++
+		}
+	}
+
+	conn.WriteMessage(WebSocketPing, []byte("ping"))
+	conn.WriteMessage(WebSocketBinary, []byte{1, 2, 3})
+
+	if msgType, res, err := conn.ReadMessage(); err != nil || msgType != WebSocketBinary ||
+		fmt.Sprint(res) != "[1 2 3]" || pongs != 1 {
+
+		t.Error("Unexpected result:", msgType, res, err, pongs)
+		return
+	}
+
+	// Close messages are reported as errors
+
+	conn.WriteMessage(WebSocketText, []byte("close"))
+
+	if _, _, err := conn.ReadMessage(); err == nil || err.Error() != "WebSocket closed: 1008 bye" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := conn.WriteMessage(WebSocketText, []byte("foo")); err == nil {
+		t.Error("Writing to a closed connection should fail")
+		return
+	}
+
+	// Messages which are too big are rejected
+
+	conn, _, _ = DialWebSocket(wsURL, nil, nil)
+
+	conn.WriteMessage(WebSocketText, []byte(strings.Repeat("a", 100001)))
+
+	if _, _, err := conn.ReadMessage(); err == nil || err.Error() != "WebSocket closed: 1009 Message too big" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
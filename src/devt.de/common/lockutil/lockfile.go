@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -32,13 +33,14 @@ type LockFile struct {
 	interval  time.Duration // Interval with which the file should be watched
 	errorChan chan error    // Error communication channel with watcher goroutine
 	running   bool          // Flag to indicate that a lockfile is being watched
+	mutex     *sync.Mutex   // Mutex to protect the running flag
 }
 
 /*
 NewLockFile creates a new LockFile which and watch it in given intervals.
 */
 func NewLockFile(filename string, interval time.Duration) *LockFile {
-	return &LockFile{filename, time.Now().UnixNano(), interval, nil, false}
+	return &LockFile{filename, time.Now().UnixNano(), interval, nil, false, &sync.Mutex{}}
 }
 
 /*
@@ -74,10 +76,10 @@ func (lf *LockFile) watch() {
 
 	// Signal that all is well
 
-	lf.running = true
+	lf.setRunning(true)
 	lf.errorChan <- nil
 
-	for lf.running {
+	for lf.WatcherRunning() {
 
 		// Wakeup every interval and read the file
 
@@ -88,7 +90,7 @@ func (lf *LockFile) watch() {
 
 			// Shut down if we get an error back
 
-			lf.running = false
+			lf.setRunning(false)
 			lf.errorChan <- err
 
 			return
@@ -172,7 +174,7 @@ func (lf *LockFile) Start() error {
 
 	// Do nothing if the lockfile is already being watched
 
-	if lf.running {
+	if lf.WatcherRunning() {
 		return nil
 	}
 
@@ -189,9 +191,22 @@ func (lf *LockFile) Start() error {
 WatcherRunning returns if the watcher goroutine is running.
 */
 func (lf *LockFile) WatcherRunning() bool {
+	lf.mutex.Lock()
+	defer lf.mutex.Unlock()
+
 	return lf.running
 }
 
+/*
+setRunning sets the running flag.
+*/
+func (lf *LockFile) setRunning(running bool) {
+	lf.mutex.Lock()
+	defer lf.mutex.Unlock()
+
+	lf.running = running
+}
+
 /*
 Finish watching a lockfile and return once the watcher goroutine has finished.
 */
@@ -200,7 +215,7 @@ func (lf *LockFile) Finish() error {
 
 	// Do nothing if the lockfile is not being watched
 
-	if !lf.running {
+	if !lf.WatcherRunning() {
 
 		// Clean up if there is a channel still open
 
@@ -214,7 +229,7 @@ func (lf *LockFile) Finish() error {
 
 	// Signale the watcher goroutine to stop
 
-	lf.running = false
+	lf.setRunning(false)
 
 	// Wait for the goroutine to finish
 
@@ -170,13 +170,15 @@ func GlobStartingLiterals(glob string) string {
 
 /*
 LevenshteinDistance computes the Levenshtein distance between two strings.
+The distance is computed on runes and not on bytes.
 */
 func LevenshteinDistance(str1, str2 string) int {
 	if str1 == str2 {
 		return 0
 	}
 
-	n, m := len(str1), len(str2)
+	rstr1, rstr2 := []rune(str1), []rune(str2)
+	n, m := len(rstr1), len(rstr2)
 
 	if n == 0 {
 		return m
@@ -198,7 +200,7 @@ func LevenshteinDistance(str1, str2 string) int {
 		v1[0] = i + 1
 
 		for j := 0; j < m; j++ {
-			if str1[i] == str2[j] {
+			if rstr1[i] == rstr2[j] {
 				cost = 0
 			} else {
 				cost = 1
@@ -127,11 +127,13 @@ func globMatch(t *testing.T, expectedResult bool, glob string, testStrings ...st
 
 func TestLevenshteinDistance(t *testing.T) {
 	testdata1 := []string{"", "a", "", "abc", "", "a", "abc", "a", "b", "ac",
-		"abcdefg", "a", "ab", "example", "sturgeon", "levenshtein", "distance"}
+		"abcdefg", "a", "ab", "example", "sturgeon", "levenshtein", "distance",
+		"café", "über"}
 	testdata2 := []string{"", "", "a", "", "abc", "a", "abc", "ab", "ab", "abc",
-		"xabxcdxxefxgx", "b", "ac", "samples", "urgently", "frankenstein", "difference"}
+		"xabxcdxxefxgx", "b", "ac", "samples", "urgently", "frankenstein", "difference",
+		"cafe", "uber"}
 	expected := []int{0, 1, 1, 3, 3, 0, 0, 1, 1, 1, 6, 1, 1,
-		3, 6, 6, 5}
+		3, 6, 6, 5, 1, 1}
 
 	for i, str1 := range testdata1 {
 		res := LevenshteinDistance(str1, testdata2[i])
@@ -12,8 +12,65 @@
 Package api contains general REST API definitions.
 
 The REST API provides an interface to EliasDB. It allows querying and modifying
-of the datastore. The API responds to GET, POST, PUT and DELETE requests in JSON
-if the request was successful (Return code 200 OK) and plain text in all other cases.
+of the datastore. The API responds to GET, POST, PUT, PATCH and DELETE requests in
+JSON if the request was successful (Return code 200 OK) and plain text in all other
+cases.
+
+Every endpoint which answers GET requests also answers HEAD requests with the
+same headers (including Content-Length) but no body. OPTIONS requests are
+answered with an Allow header which lists the methods an endpoint supports -
+requests with other methods are answered with 405 and the same Allow header.
+
+Requests can be authenticated before they are dispatched to an endpoint by
+setting an Authenticator (see Auth). The APIKeyAuthenticator accepts keys in the
+Authorization header (Bearer <key>) or the X-Api-Key header - keys are either
+read-only or read-write. Unauthenticated requests are answered with 401 and
+requests of read-only clients which would change data with 403 (both with a JSON
+error object). Endpoints can be exempted from authentication (see AuthExempt).
+The BasicAuthenticator checks HTTP basic authentication against the bcrypt
+password hashes of a UserStore (e.g. a FileUserStore) and blocks sources with
+too many failed attempts for some time (429). The JWTAuthenticator verifies
+JSON Web Tokens with a static HMAC or RSA key or with the keys of a JWKS - tokens
+without the configured write scope are read-only. The authenticated Principal
+including the roles of a user is available from the request context (see
+PrincipalFromContext).
+
+After authentication endpoints check if a client may access the partition of a
+request with an Authorizer (see Authz and Authorize). The RulesAuthorizer
+allows clients or roles to read or write partitions which match given
+patterns. All other requests are denied with 403.
+
+Cross-origin requests from browsers are allowed for the origins of a
+CORSConfig (see CORS). Preflight requests (OPTIONS) are answered before they
+reach endpoints and need no credentials.
+
+Responses of compressible content types are compressed with gzip if the client
+accepts it and the response is larger than GzipMinSize (streamed responses are
+compressed as they are flushed). Request bodies with gzip content encoding are
+decompressed before they reach endpoints.
+
+The rate of requests of each client can be limited per rate class (reads,
+writes and queries) with a RateLimiter (see Limiter). Clients which exceed
+their rate get 429 with a Retry-After header.
+
+Request bodies are limited to MaxRequestBodySize bytes after decompression
+(endpoints such as streamed imports can be exempted, see BodyLimitExempt).
+Requests with larger bodies are answered with 413.
+
+Error responses are plain text unless the request accepts application/json or
+JSONErrors is set. JSON error responses are objects of the form:
+
+	{
+	    code    : HTTP status code
+	    message : Error message
+	    details : Optional details e.g. [ { field, message }, ... ] for
+	              invalid fields of the request
+	}
+
+Each request gets an ID which is returned in the X-Request-Id header (valid IDs
+sent by clients are kept). Endpoints can get the ID from the request context
+(see RequestIDFromContext). Handled requests are logged with a RequestLogger
+(see RequestLog) which logs a single line with the standard logger by default.
 
 Common API definitions
 
@@ -21,20 +78,106 @@ Common API definitions
 
 Endpoint which returns an object with version information.
 
-	api_versions : List of available API versions e.g. [ "v1" ]
-	product      : Name of the API provider (EliasDB)
-	version:     : Version of the API provider
-	revision:    : Revision of the API provider
+	api_versions   : List of available API versions e.g. [ "v1" ]
+	product        : Name of the API provider (EliasDB)
+	version:       : Version of the API provider
+	revision:      : Revision of the API provider
+	features       : List of enabled features e.g. [ "auth", "websocket" ]
+	start_time     : Start time of the server (RFC 3339)
+	uptime_seconds : Seconds since the start of the server
+	data_location  : Location of the datastore (empty if not shown)
+	go_version     : Version of the Go runtime
+
+The API versions are the versions of all registered endpoints. Features are
+either enabled by configuration (auth, authz, cors, gzip, ratelimit and
+requestlog) or provided by registered endpoints (see EndpointFeatures). New
+fields may be added in the future.
 
 /swagger.json
 
 Dynamically generated swagger definition file. See: http://swagger.io
+
+An OpenAPI 3 description of all registered endpoints is assembled by
+OpenAPISpec. Endpoint handlers can describe their operations by implementing
+EndpointDescriber - handlers which do not are described by their URL and the
+methods they support.
+
+/health
+
+Endpoint which checks the graph storage (liveness probe). The checks are cheap
+and their results are cached for HealthCacheDuration. The response status is
+503 if a critical check fails - i.e. the storage is not usable or the disk of
+the datastore has less than HealthMinFreeDisk bytes available. Storage errors
+are reported as warning.
+
+	{
+	    status     : ok or fail
+	    components : {
+	        storage         : { status, error }
+	        transaction_log : { status, pending_transactions }
+	        flush           : { status, last_flush }
+	        storage_errors  : { status, error, last_error_time }
+	        disk            : { status, error, free_bytes, total_bytes }
+	    }
+	}
+
+/health/ready
+
+Endpoint which additionally checks if the server can serve requests (readiness
+probe). The check fails during startup and shutdown (see SetReady).
+
+Admin API definitions
+
+Admin endpoints (see AdminEndpointMap) can only be used by authenticated
+clients with the admin role.
+
+/admin/ratelimits
+
+Endpoint which returns (GET) or changes (PUT) the rates of the rate limiter by
+rate class. A rate of 0 removes the limit of a class.
+
+	{
+	    read  : { per_second : <requests per second>, burst : <requests at once> }
+	    write : { per_second : <requests per second>, burst : <requests at once> }
+	    query : { per_second : <requests per second>, burst : <requests at once> }
+	}
+
+/admin/storage/<action>
+
+Endpoint which runs a storage action (POST). The flush action writes the main
+database, all pending changes and the transaction logs to the storage files.
+The rotate-log action writes only the transaction logs to the storage files and
+starts new empty logs. The rollback action discards all changes which have not
+yet been written to a transaction log - it must be confirmed with the parameter
+confirm=true. All actions wait for running transactions to finish. The result
+is reported for each storage file (or storage manager for rollback):
+
+	{
+	    action        : <action>
+	    success       : <true if the action succeeded for all files>
+	    bytes_written : <number of bytes written to the storage files>
+	    files : [
+	        {
+	            name          : <name of the storage file>
+	            success       : <true if the action succeeded for the file>
+	            bytes_written : <number of bytes written to the file>
+	            log_bytes     : <size of the transaction log before the action>
+	            error         : <error message (only if the action failed)>
+	        }
+	        ...
+	    ]
+	}
 */
 package api
 
 import (
 	"encoding/json"
 	"net/http"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
 
 	"devt.de/eliasdb/version"
 )
@@ -44,6 +187,26 @@ EndpointAbout is the about endpoint URL (rooted). Handles about/
 */
 const EndpointAbout = APIRoot + "/about/"
 
+/*
+StartTime is the time when the server was started.
+*/
+var StartTime = time.Now()
+
+/*
+DataLocation is the location of the datastore which is returned by the about
+endpoint (empty if it should not be shown).
+*/
+var DataLocation string
+
+/*
+EndpointFeatures contains the names of API features which are provided by
+endpoint URLs. The about endpoint lists a feature if its endpoint is
+registered.
+*/
+var EndpointFeatures = map[string]string{
+	EndpointHealth: "health",
+}
+
 /*
 AboutEndpointInst creates a new endpoint handler.
 */
@@ -64,10 +227,15 @@ HandleGET returns about data for the REST API.
 func (a *aboutEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
 
 	data := map[string]interface{}{
-		"api_versions": []string{"v1"},
-		"product":      "EliasDB",
-		"version":      version.VERSION,
-		"revision":     version.REV,
+		"api_versions":   apiVersions(),
+		"product":        "EliasDB",
+		"version":        version.VERSION,
+		"revision":       version.REV,
+		"features":       apiFeatures(),
+		"start_time":     StartTime.UTC().Format(time.RFC3339),
+		"uptime_seconds": int64(time.Since(StartTime).Seconds()),
+		"data_location":  DataLocation,
+		"go_version":     runtime.Version(),
 	}
 
 	// Write data
@@ -77,3 +245,81 @@ func (a *aboutEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resour
 	ret := json.NewEncoder(w)
 	ret.Encode(data)
 }
+
+/*
+Describe describes the endpoint in the API description.
+*/
+func (a *aboutEndpoint) Describe() []*EndpointDescription {
+	return []*EndpointDescription{{
+		Path:    strings.TrimSuffix(EndpointAbout, "/"),
+		Summary: "Return information about the REST API provider.",
+		Responses: []*ResponseDescription{{200, "About info object", "application/json",
+			map[string]interface{}{"type": "object"}}},
+	}}
+}
+
+/*
+apiVersionPattern matches the version part of registered endpoint URLs.
+*/
+var apiVersionPattern = regexp.MustCompile("^" + APIRoot + "/(v[0-9]+)/")
+
+/*
+apiVersions returns the sorted versions of all registered API endpoints.
+*/
+func apiVersions() []string {
+	versions := make(map[string]bool)
+
+	for url := range registered {
+		if m := apiVersionPattern.FindStringSubmatch(url); m != nil {
+			versions[m[1]] = true
+		}
+	}
+
+	return sortedKeys(versions)
+}
+
+/*
+apiFeatures returns the sorted features of the API which are enabled or which
+are provided by registered endpoints.
+*/
+func apiFeatures() []string {
+	features := make(map[string]bool)
+
+	for url, feature := range EndpointFeatures {
+		if _, ok := registered[url]; ok {
+			features[feature] = true
+		}
+	}
+
+	for url := range registered {
+		if strings.HasPrefix(url, APIRoot+"/admin/") {
+			features["admin"] = true
+		}
+	}
+
+	features["auth"] = Auth != nil
+	features["authz"] = Authz != nil
+	features["cors"] = CORS != nil
+	features["gzip"] = GzipMinSize >= 0
+	features["ratelimit"] = Limiter != nil
+	features["requestlog"] = RequestLog != nil
+
+	return sortedKeys(features)
+}
+
+/*
+sortedKeys returns the sorted keys of a map which have a true value.
+*/
+func sortedKeys(m map[string]bool) []string {
+	ret := make([]string, 0, len(m))
+
+	for k, v := range m {
+		if v {
+			ret = append(ret, k)
+		}
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
@@ -0,0 +1,285 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+/*
+Auth is the authenticator which checks all requests before they are
+dispatched to a registered endpoint handler (nil if requests are not
+authenticated).
+*/
+var Auth Authenticator
+
+/*
+AuthExempt contains the endpoint URLs (e.g. EndpointAbout) which can be
+requested without authentication. Embedders can add the URLs of their own
+endpoints to opt out of authentication.
+*/
+var AuthExempt = map[string]bool{}
+
+/*
+Authentication related errors
+*/
+var (
+	ErrMissingCredentials = errors.New("Missing credentials")
+	ErrInvalidCredentials = errors.New("Invalid credentials")
+)
+
+/*
+RoleAdmin is the role of clients which may use admin endpoints.
+*/
+const RoleAdmin = "admin"
+
+/*
+Principal is an authenticated client of the REST API.
+*/
+type Principal struct {
+	Name     string   // Name of the client (e.g. the name of an API key or a user name)
+	Roles    []string // Roles of the client (e.g. from a user store)
+	ReadOnly bool     // Flag if the client is only allowed to read
+}
+
+/*
+Authenticator checks the credentials of REST requests.
+*/
+type Authenticator interface {
+
+	/*
+		Authenticate checks the credentials of a request and returns the
+		authenticated principal. Returns an error if the request has no valid
+		credentials.
+	*/
+	Authenticate(r *http.Request) (*Principal, error)
+
+	/*
+		Challenge returns the value of the WWW-Authenticate header which is sent
+		with unauthenticated responses.
+	*/
+	Challenge() string
+}
+
+/*
+principalKey is the context key of the authenticated principal of a request.
+*/
+type principalKey struct{}
+
+/*
+PrincipalFromContext returns the authenticated principal of a request from
+its context. Returns nil if the request was not authenticated.
+*/
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+/*
+authenticate checks a request for a given endpoint URL with the configured
+authenticator. The principal is added to the context of the returned request.
+Writes an error response and returns false if the request is not allowed.
+*/
+func authenticate(w http.ResponseWriter, r *http.Request, url string) (*http.Request, bool) {
+
+	auth := Auth
+
+	if auth == nil || AuthExempt[url] {
+		return r, true
+	}
+
+	p, err := auth.Authenticate(r)
+	if err == ErrTooManyAttempts {
+		writeAuthError(w, r, err.Error(), http.StatusTooManyRequests)
+		return r, false
+	} else if err != nil {
+		w.Header().Set("WWW-Authenticate", auth.Challenge())
+		writeAuthError(w, r, err.Error(), http.StatusUnauthorized)
+		return r, false
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), principalKey{}, p))
+
+	// Read-only clients may only use methods which do not change any data
+
+	if p.ReadOnly && isWriteRequest(r) {
+		writeAuthError(w, r, fmt.Sprintf("Client %v is only allowed to read", p.Name), http.StatusForbidden)
+		return r, false
+	}
+
+	return r, true
+}
+
+/*
+CheckAdmin checks if the client of a request has the admin role. Admin
+endpoints cannot be used if requests are not authenticated. Writes an error
+response and returns false if the client is not an admin.
+*/
+func CheckAdmin(w http.ResponseWriter, r *http.Request) bool {
+
+	p := PrincipalFromContext(r.Context())
+
+	if p == nil {
+		writeAuthError(w, r, "Admin endpoints need authentication", http.StatusForbidden)
+		return false
+	}
+
+	for _, role := range p.Roles {
+		if role == RoleAdmin {
+			return true
+		}
+	}
+
+	writeAuthError(w, r, fmt.Sprintf("Client %v is not an admin", p.Name), http.StatusForbidden)
+
+	return false
+}
+
+/*
+writeAuthError writes an authentication error as a JSON object. The object
+has the form of other JSON error responses if the request wants JSON errors.
+*/
+func writeAuthError(w http.ResponseWriter, r *http.Request, msg string, code int) {
+
+	if WantsJSONErrors(r) {
+		WriteError(w, r, msg, code)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": msg,
+	})
+}
+
+// API key authentication
+// ======================
+
+/*
+Scopes of API keys
+*/
+const (
+	ScopeRead      = "read"
+	ScopeReadWrite = "readwrite"
+)
+
+/*
+APIKey is the definition of an API key.
+*/
+type APIKey struct {
+	Name  string   `json:"name"`  // Name of the key
+	Key   string   `json:"key"`   // Secret key which is sent by clients
+	Scope string   `json:"scope"` // Scope of the key (ScopeRead or ScopeReadWrite)
+	Roles []string `json:"roles"` // Roles of the key (e.g. RoleAdmin)
+}
+
+/*
+APIKeyAuthenticator authenticates requests with API keys. Clients send their
+key in the Authorization header (Bearer <key>) or in the X-Api-Key header.
+Only hashes of the keys are kept.
+*/
+type APIKeyAuthenticator struct {
+	hashes     [][sha256.Size]byte // Hashes of all keys
+	principals []*Principal        // Principals of all keys
+}
+
+/*
+NewAPIKeyAuthenticator creates a new authenticator for a given set of keys.
+*/
+func NewAPIKeyAuthenticator(keys []*APIKey) (*APIKeyAuthenticator, error) {
+	ret := &APIKeyAuthenticator{}
+
+	for _, k := range keys {
+
+		if k.Key == "" {
+			return nil, fmt.Errorf("API key %v has no key", k.Name)
+		} else if k.Scope != ScopeRead && k.Scope != ScopeReadWrite {
+			return nil, fmt.Errorf("API key %v has an invalid scope: %v", k.Name, k.Scope)
+		}
+
+		ret.hashes = append(ret.hashes, sha256.Sum256([]byte(k.Key)))
+		ret.principals = append(ret.principals, &Principal{k.Name, k.Roles, k.Scope == ScopeRead})
+	}
+
+	return ret, nil
+}
+
+/*
+LoadAPIKeyAuthenticator creates a new authenticator for the keys of a given
+JSON file. The file contains a list of key definitions (see APIKey).
+*/
+func LoadAPIKeyAuthenticator(filename string) (*APIKeyAuthenticator, error) {
+	var keys []*APIKey
+
+	content, err := ioutil.ReadFile(filename)
+	if err == nil {
+		if err = json.Unmarshal(content, &keys); err != nil {
+			err = fmt.Errorf("Could not read API keys from %v: %v", filename, err)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAPIKeyAuthenticator(keys)
+}
+
+/*
+Authenticate checks the API key of a request.
+*/
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+
+	key := r.Header.Get("X-Api-Key")
+
+	if auth := r.Header.Get("Authorization"); key == "" && strings.HasPrefix(auth, "Bearer ") {
+		key = strings.TrimSpace(auth[7:])
+	}
+
+	if key == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Compare the hash of the given key with all known hashes in constant time
+
+	hash := sha256.Sum256([]byte(key))
+
+	var ret *Principal
+
+	for i, h := range a.hashes {
+		if subtle.ConstantTimeCompare(hash[:], h[:]) == 1 {
+			ret = a.principals[i]
+		}
+	}
+
+	if ret == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return ret, nil
+}
+
+/*
+Challenge returns the value of the WWW-Authenticate header.
+*/
+func (a *APIKeyAuthenticator) Challenge() string {
+	return "Bearer"
+}
@@ -0,0 +1,188 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+type authTestEndpoint struct {
+	*DefaultEndpointHandler
+}
+
+func (te *authTestEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
+	fmt.Fprint(w, "get ", principalName(r))
+}
+
+func (te *authTestEndpoint) HandlePOST(w http.ResponseWriter, r *http.Request, resources []string) {
+	fmt.Fprint(w, "post ", principalName(r))
+}
+
+func principalName(r *http.Request) string {
+	if p := PrincipalFromContext(r.Context()); p != nil {
+		return p.Name
+	}
+	return "-"
+}
+
+func (te *authTestEndpoint) SwaggerDefs(s map[string]interface{}) {
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+
+	// Capture the registered handlers
+
+	handlers := make(map[string]func(http.ResponseWriter, *http.Request))
+
+	oldHandleFunc := HandleFunc
+	HandleFunc = func(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+		handlers[pattern] = handler
+	}
+	defer func() {
+		HandleFunc = oldHandleFunc
+	}()
+
+	RegisterRestEndpoints(map[string]RestEndpointInst{
+		"/authtest/": func() RestEndpointHandler {
+			return &authTestEndpoint{}
+		},
+		"/authexempt/": func() RestEndpointHandler {
+			return &authTestEndpoint{}
+		},
+	})
+
+	send := func(url string, method string, header ...string) string {
+		r := httptest.NewRequest(method, url, nil)
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+
+		w := httptest.NewRecorder()
+		handlers[url](w, r)
+
+		return fmt.Sprint(w.Code, " ", w.Header().Get("WWW-Authenticate"), " ", strings.TrimSpace(w.Body.String()))
+	}
+
+	// Requests are not authenticated without an authenticator
+
+	if res := send("/authtest/", "GET"); res != "200  get -" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	a, err := NewAPIKeyAuthenticator([]*APIKey{
+		{"reader", "key1", ScopeRead, nil},
+		{"writer", "key2", ScopeReadWrite, nil},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	Auth = a
+	AuthExempt["/authexempt/"] = true
+	defer func() {
+		Auth = nil
+		delete(AuthExempt, "/authexempt/")
+	}()
+
+	if res := send("/authtest/", "GET"); res != `401 Bearer {"error":"Missing credentials"}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send("/authtest/", "GET", "X-Api-Key", "key3"); res != `401 Bearer {"error":"Invalid credentials"}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send("/authtest/", "GET", "Authorization", "Basic key1"); res != `401 Bearer {"error":"Missing credentials"}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Keys are accepted in both headers
+
+	if res := send("/authtest/", "GET", "X-Api-Key", "key1"); res != "200  get reader" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send("/authtest/", "POST", "Authorization", "Bearer key2"); res != "200  post writer" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Read-only keys cannot change data
+
+	if res := send("/authtest/", "POST", "Authorization", "Bearer key1"); res != `403  {"error":"Client reader is only allowed to read"}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Exempted endpoints need no credentials
+
+	if res := send("/authexempt/", "POST"); res != "200  post -" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestLoadAPIKeyAuthenticator(t *testing.T) {
+	keyFile := "apikeys_test.json"
+
+	defer os.Remove(keyFile)
+
+	ioutil.WriteFile(keyFile, []byte(`[{"name": "reader", "key": "key1", "scope": "read"}]`), 0600)
+
+	a, err := LoadAPIKeyAuthenticator(keyFile)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Api-Key", "key1")
+
+	if p, err := a.Authenticate(r); err != nil || fmt.Sprint(*p) != "{reader [] true}" {
+		t.Error("Unexpected result:", p, err)
+		return
+	}
+
+	// Test error cases
+
+	ioutil.WriteFile(keyFile, []byte(`[{"name": "reader", "key": "key1", "scope": "all"}]`), 0600)
+
+	if _, err := LoadAPIKeyAuthenticator(keyFile); err == nil || err.Error() != "API key reader has an invalid scope: all" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	ioutil.WriteFile(keyFile, []byte(`[{"name": "reader"}]`), 0600)
+
+	if _, err := LoadAPIKeyAuthenticator(keyFile); err == nil || err.Error() != "API key reader has no key" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	ioutil.WriteFile(keyFile, []byte(`{`), 0600)
+
+	if _, err := LoadAPIKeyAuthenticator(keyFile); err == nil || err.Error() != "Could not read API keys from apikeys_test.json: unexpected end of JSON input" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
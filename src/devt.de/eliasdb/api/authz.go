@@ -0,0 +1,238 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+)
+
+/*
+Authz is the authorizer which checks if an authenticated client may access a
+partition (nil if all clients may access all partitions).
+*/
+var Authz Authorizer
+
+/*
+Authorizer decides if a client may access a partition.
+*/
+type Authorizer interface {
+
+	/*
+		Authorize checks if a principal may use a given HTTP method on a
+		partition. The kind is empty if the request is not about a single kind
+		(e.g. queries or storing a graph). The principal is nil if the request
+		was not authenticated.
+	*/
+	Authorize(p *Principal, method string, part string, kind string) bool
+}
+
+/*
+Authorize checks if the client of a request may access a given partition and
+kind. Writes an error response and returns false if the access is denied.
+*/
+func Authorize(w http.ResponseWriter, r *http.Request, part string, kind string) bool {
+
+	authz := Authz
+
+	if authz == nil {
+		return true
+	}
+
+	p := PrincipalFromContext(r.Context())
+
+	method := r.Method
+	if !isWriteRequest(r) && isWriteMethod(method) {
+		method = "GET"
+	} else if isWriteRequest(r) && !isWriteMethod(method) {
+		method = "POST"
+	}
+
+	if !authz.Authorize(p, method, part, kind) {
+		name, access := "-", "read"
+
+		if p != nil {
+			name = p.Name
+		}
+		if isWriteRequest(r) {
+			access = "write"
+		}
+
+		writeAuthError(w, r, fmt.Sprintf("Client %v is not allowed to %v partition %v",
+			name, access, part), http.StatusForbidden)
+
+		return false
+	}
+
+	return true
+}
+
+/*
+ReadRequests contains for endpoint URLs the HTTP methods which only read data
+even though the method might usually change data (e.g. POST requests which
+submit queries). These requests are authorized and rate limited as reads.
+*/
+var ReadRequests = make(map[string]map[string]bool)
+
+/*
+WriteRequests contains for endpoint URLs the HTTP methods which need write
+access even though the method usually only reads data (e.g. GET requests
+which copy the whole datastore). These requests are authorized and rate
+limited as writes.
+*/
+var WriteRequests = make(map[string]map[string]bool)
+
+/*
+Key of the access marker in a request context.
+*/
+type requestAccessKey struct{}
+
+/*
+markRequest marks a request as read or write request if its method only
+reads data or needs write access on the given endpoint.
+*/
+func markRequest(r *http.Request, url string) *http.Request {
+	if ReadRequests[url][r.Method] {
+		r = r.WithContext(context.WithValue(r.Context(), requestAccessKey{}, false))
+	} else if WriteRequests[url][r.Method] {
+		r = r.WithContext(context.WithValue(r.Context(), requestAccessKey{}, true))
+	}
+	return r
+}
+
+/*
+isWriteRequest checks if a given request might change data.
+*/
+func isWriteRequest(r *http.Request) bool {
+	if write, ok := r.Context().Value(requestAccessKey{}).(bool); ok {
+		return write
+	}
+	return isWriteMethod(r.Method)
+}
+
+/*
+isWriteMethod checks if a given HTTP method might change data.
+*/
+func isWriteMethod(method string) bool {
+	return method != "GET" && method != "HEAD" && method != "OPTIONS"
+}
+
+/*
+AuthzRule is a rule which allows a client or all clients with a certain role
+to access partitions.
+*/
+type AuthzRule struct {
+	Principal  string   `json:"principal"`  // Name of a client (* for all authenticated clients)
+	Role       string   `json:"role"`       // Role of clients (used if no name is given)
+	Partitions []string `json:"partitions"` // Partition patterns (e.g. team1_*)
+	Access     string   `json:"access"`     // Allowed access (ScopeRead or ScopeReadWrite)
+}
+
+/*
+RulesAuthorizer authorizes requests with a table of rules. A request is
+allowed if any rule allows it - all other requests are denied.
+*/
+type RulesAuthorizer struct {
+	rules []*AuthzRule // Rules of the authorizer
+}
+
+/*
+NewRulesAuthorizer creates a new authorizer for a given set of rules.
+*/
+func NewRulesAuthorizer(rules []*AuthzRule) (*RulesAuthorizer, error) {
+
+	for i, r := range rules {
+
+		if r.Principal == "" && r.Role == "" {
+			return nil, fmt.Errorf("Rule %v has no principal or role", i)
+		} else if r.Access != ScopeRead && r.Access != ScopeReadWrite {
+			return nil, fmt.Errorf("Rule %v has an invalid access: %v", i, r.Access)
+		}
+
+		for _, pattern := range r.Partitions {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("Rule %v has an invalid partition pattern: %v", i, pattern)
+			}
+		}
+	}
+
+	return &RulesAuthorizer{rules}, nil
+}
+
+/*
+LoadRulesAuthorizer creates a new authorizer for the rules of a given JSON
+file. The file contains a list of rule definitions (see AuthzRule).
+*/
+func LoadRulesAuthorizer(filename string) (*RulesAuthorizer, error) {
+	var rules []*AuthzRule
+
+	content, err := ioutil.ReadFile(filename)
+	if err == nil {
+		if err = json.Unmarshal(content, &rules); err != nil {
+			err = fmt.Errorf("Could not read authorization rules from %v: %v", filename, err)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRulesAuthorizer(rules)
+}
+
+/*
+Authorize checks if any rule allows a principal to access a partition.
+*/
+func (a *RulesAuthorizer) Authorize(p *Principal, method string, part string, kind string) bool {
+
+	if p == nil {
+		return false
+	}
+
+	write := isWriteMethod(method)
+
+	for _, r := range a.rules {
+
+		if write && r.Access != ScopeReadWrite || !a.matchPrincipal(r, p) {
+			continue
+		}
+
+		for _, pattern := range r.Partitions {
+			if ok, _ := path.Match(pattern, part); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+/*
+matchPrincipal checks if a rule applies to a principal.
+*/
+func (a *RulesAuthorizer) matchPrincipal(r *AuthzRule, p *Principal) bool {
+
+	if r.Principal != "" {
+		return r.Principal == "*" || r.Principal == p.Name
+	}
+
+	for _, role := range p.Roles {
+		if role == r.Role {
+			return true
+		}
+	}
+
+	return false
+}
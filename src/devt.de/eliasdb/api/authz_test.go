@@ -0,0 +1,136 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRulesAuthorizer(t *testing.T) {
+	rulesFile := "authz_test.json"
+
+	defer os.Remove(rulesFile)
+
+	ioutil.WriteFile(rulesFile, []byte(`[
+  {"principal": "john", "partitions": ["team1_*"], "access": "readwrite"},
+  {"role": "auditor", "partitions": ["*"], "access": "read"},
+  {"principal": "*", "partitions": ["public"], "access": "read"}
+]`), 0600)
+
+	a, err := LoadRulesAuthorizer(rulesFile)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	john := &Principal{"john", nil, false}
+	mike := &Principal{"mike", []string{"auditor"}, false}
+	bob := &Principal{"bob", []string{"team2"}, false}
+
+	for _, test := range []struct {
+		p      *Principal
+		method string
+		part   string
+		res    bool
+	}{
+		{john, "GET", "team1_main", true},
+		{john, "POST", "team1_main", true},
+		{john, "GET", "team2_main", false},
+		{john, "GET", "public", true},
+		{john, "DELETE", "public", false},
+		{mike, "GET", "team2_main", true},
+		{mike, "PUT", "team2_main", false},
+		{bob, "GET", "public", true},
+		{bob, "GET", "team1_main", false},
+		{nil, "GET", "public", false},
+	} {
+		if res := a.Authorize(test.p, test.method, test.part, ""); res != test.res {
+			t.Error("Unexpected result:", test.p, test.method, test.part, res)
+			return
+		}
+	}
+
+	// Denied requests are answered with 403
+
+	Authz = a
+	defer func() {
+		Authz = nil
+	}()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), principalKey{}, mike))
+
+	if Authorize(w, r, "team1_main", "Song") || w.Code != 403 ||
+		strings.TrimSpace(w.Body.String()) != `{"error":"Client mike is not allowed to write partition team1_main"}` {
+		t.Error("Unexpected result:", w.Code, w.Body.String())
+		return
+	}
+
+	// Requests which only read data need read access
+
+	ReadRequests["/readtest/"] = map[string]bool{"POST": true}
+	defer delete(ReadRequests, "/readtest/")
+
+	w = httptest.NewRecorder()
+	r = markRequest(r, "/readtest/")
+
+	if !Authorize(w, r, "team1_main", "") || isWriteRequest(r) ||
+		!isWriteRequest(markRequest(httptest.NewRequest("POST", "/", nil), "/")) {
+		t.Error("Unexpected result:", w.Code, w.Body.String())
+		return
+	}
+
+	// Requests which need write access are authorized as writes
+
+	WriteRequests["/writetest/"] = map[string]bool{"GET": true}
+	defer delete(WriteRequests, "/writetest/")
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/writetest/", nil)
+	r = markRequest(r.WithContext(context.WithValue(r.Context(), principalKey{}, mike)), "/writetest/")
+
+	if Authorize(w, r, "team2_main", "") || !isWriteRequest(r) ||
+		strings.TrimSpace(w.Body.String()) != `{"error":"Client mike is not allowed to write partition team2_main"}` {
+		t.Error("Unexpected result:", w.Code, w.Body.String())
+		return
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/", nil)
+
+	if Authorize(w, r, "public", "") || w.Code != 403 ||
+		strings.TrimSpace(w.Body.String()) != `{"error":"Client - is not allowed to read partition public"}` {
+		t.Error("Unexpected result:", w.Code, w.Body.String())
+		return
+	}
+
+	// Test error cases
+
+	for rules, msg := range map[string]string{
+		`[{"partitions": ["a"], "access": "read"}]`:               "Rule 0 has no principal or role",
+		`[{"role": "a", "partitions": ["a"], "access": "write"}]`: "Rule 0 has an invalid access: write",
+		`[{"role": "a", "partitions": ["[a"], "access": "read"}]`: "Rule 0 has an invalid partition pattern: [a",
+		`[`: "Could not read authorization rules from authz_test.json: unexpected end of JSON input",
+	} {
+		ioutil.WriteFile(rulesFile, []byte(rules), 0600)
+
+		if _, err := LoadRulesAuthorizer(rulesFile); err == nil || err.Error() != msg {
+			t.Error("Unexpected result:", err)
+			return
+		}
+	}
+}
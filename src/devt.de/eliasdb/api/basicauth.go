@@ -0,0 +1,246 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"devt.de/common/cryptutil"
+)
+
+/*
+RoleReadOnly is the role of users which are only allowed to read.
+*/
+const RoleReadOnly = "readonly"
+
+/*
+BasicAuthMaxFailures is the number of failed attempts after which a source
+address is blocked.
+*/
+var BasicAuthMaxFailures = 5
+
+/*
+BasicAuthBlockTime is the time a source address is blocked after too many
+failed attempts. Failed attempts are forgotten after the same time.
+*/
+var BasicAuthBlockTime = 30 * time.Second
+
+/*
+ErrTooManyAttempts is returned if a source had too many failed attempts.
+*/
+var ErrTooManyAttempts = errors.New("Too many failed attempts")
+
+/*
+UserStore looks up the users of HTTP basic authentication.
+*/
+type UserStore interface {
+
+	/*
+		Lookup returns the bcrypt hash of the password and the roles of a
+		given user. Returns false if the user does not exist.
+	*/
+	Lookup(user string) (string, []string, bool)
+}
+
+/*
+User is the definition of a user of a file based user store.
+*/
+type User struct {
+	Name     string   `json:"name"`     // Name of the user
+	Password string   `json:"password"` // Bcrypt hash of the password of the user
+	Roles    []string `json:"roles"`    // Roles of the user
+}
+
+/*
+FileUserStore is a user store which reads its users from a JSON file. The file
+contains a list of user definitions (see User).
+*/
+type FileUserStore struct {
+	users map[string]*User // Known users
+}
+
+/*
+LoadFileUserStore creates a new user store from a given file.
+*/
+func LoadFileUserStore(filename string) (*FileUserStore, error) {
+	var users []*User
+
+	content, err := ioutil.ReadFile(filename)
+	if err == nil {
+		if err = json.Unmarshal(content, &users); err != nil {
+			err = fmt.Errorf("Could not read users from %v: %v", filename, err)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &FileUserStore{make(map[string]*User)}
+
+	for _, u := range users {
+
+		// Check the hash by comparing it with an empty password
+
+		if err := cryptutil.CompareBcryptHash(u.Password, nil); err == cryptutil.ErrBcryptInvalidHash {
+			return nil, fmt.Errorf("User %v has an invalid password hash", u.Name)
+		}
+
+		ret.users[u.Name] = u
+	}
+
+	return ret, nil
+}
+
+/*
+Lookup returns the password hash and the roles of a given user.
+*/
+func (us *FileUserStore) Lookup(user string) (string, []string, bool) {
+	if u, ok := us.users[user]; ok {
+		return u.Password, u.Roles, true
+	}
+	return "", nil, false
+}
+
+/*
+BasicAuthenticator authenticates requests with HTTP basic authentication.
+Passwords are checked against bcrypt hashes of a user store. Sources which
+had too many failed attempts are blocked for some time.
+*/
+type BasicAuthenticator struct {
+	store    UserStore              // Store of all users
+	realm    string                 // Realm which is sent to clients
+	failures map[string]*authFailed // Failed attempts per source address
+	lock     *sync.Mutex            // Lock for failed attempts
+}
+
+/*
+authFailed records the failed attempts of a source address.
+*/
+type authFailed struct {
+	count int       // Number of failed attempts
+	last  time.Time // Time of the last failed attempt
+}
+
+/*
+dummyHash is compared with the password of unknown users so they need the
+same time as known users (see dummyHashOnce).
+*/
+var dummyHash string
+var dummyHashOnce sync.Once
+
+/*
+NewBasicAuthenticator creates a new authenticator for a given user store and
+realm.
+*/
+func NewBasicAuthenticator(store UserStore, realm string) *BasicAuthenticator {
+	return &BasicAuthenticator{store, realm, make(map[string]*authFailed), &sync.Mutex{}}
+}
+
+/*
+Authenticate checks the user name and password of a request.
+*/
+func (a *BasicAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrMissingCredentials
+	}
+
+	source, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		source = r.RemoteAddr
+	}
+
+	if a.blocked(source) {
+		return nil, ErrTooManyAttempts
+	}
+
+	hash, roles, ok := a.store.Lookup(user)
+	if !ok {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = cryptutil.GenerateBcryptHash([]byte("dummy"), cryptutil.BcryptDefaultCost)
+		})
+		hash = dummyHash
+	}
+
+	if err := cryptutil.CompareBcryptHash(hash, []byte(password)); err != nil || !ok {
+		a.fail(source)
+		return nil, ErrInvalidCredentials
+	}
+
+	readOnly := false
+	for _, role := range roles {
+		readOnly = readOnly || role == RoleReadOnly
+	}
+
+	return &Principal{user, roles, readOnly}, nil
+}
+
+/*
+Challenge returns the value of the WWW-Authenticate header.
+*/
+func (a *BasicAuthenticator) Challenge() string {
+	return "Basic realm=" + strconv.Quote(a.realm)
+}
+
+/*
+blocked checks if a source address is blocked because of too many failed
+attempts.
+*/
+func (a *BasicAuthenticator) blocked(source string) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	f, ok := a.failures[source]
+
+	if ok && time.Since(f.last) > BasicAuthBlockTime {
+		delete(a.failures, source)
+		return false
+	}
+
+	return ok && f.count >= BasicAuthMaxFailures
+}
+
+/*
+fail records a failed attempt of a source address.
+*/
+func (a *BasicAuthenticator) fail(source string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	now := time.Now()
+
+	// Forget old failed attempts of other sources
+
+	for s, f := range a.failures {
+		if now.Sub(f.last) > BasicAuthBlockTime {
+			delete(a.failures, s)
+		}
+	}
+
+	f, ok := a.failures[source]
+	if !ok {
+		f = &authFailed{}
+		a.failures[source] = f
+	}
+
+	f.count++
+	f.last = now
+}
@@ -0,0 +1,136 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"devt.de/common/cryptutil"
+)
+
+func TestBasicAuthentication(t *testing.T) {
+	userFile := "users_test.json"
+
+	defer os.Remove(userFile)
+
+	hash1, _ := cryptutil.GenerateBcryptHash([]byte("pass1"), cryptutil.BcryptMinCost)
+	hash2, _ := cryptutil.GenerateBcryptHash([]byte("pass2"), cryptutil.BcryptMinCost)
+
+	ioutil.WriteFile(userFile, []byte(fmt.Sprintf(`[
+  {"name": "john", "password": "%v", "roles": ["readonly", "team1"]},
+  {"name": "mike", "password": "%v", "roles": ["admin"]}
+]`, hash1, hash2)), 0600)
+
+	store, err := LoadFileUserStore(userFile)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	a := NewBasicAuthenticator(store, "EliasDB")
+
+	if c := a.Challenge(); c != `Basic realm="EliasDB"` {
+		t.Error("Unexpected result:", c)
+		return
+	}
+
+	auth := func(source string, user string, password string) string {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = source
+		if user != "" {
+			r.SetBasicAuth(user, password)
+		}
+
+		p, err := a.Authenticate(r)
+		if err != nil {
+			return err.Error()
+		}
+
+		return fmt.Sprint(*p)
+	}
+
+	// Roles of the user store are part of the principal
+
+	if res := auth("1.2.3.4:1000", "john", "pass1"); res != "{john [readonly team1] true}" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := auth("1.2.3.4:1000", "mike", "pass2"); res != "{mike [admin] false}" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := auth("1.2.3.4:1000", "", ""); res != "Missing credentials" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Sources are blocked after too many failed attempts
+
+	BasicAuthMaxFailures = 2
+	defer func() {
+		BasicAuthMaxFailures = 5
+	}()
+
+	if res := auth("1.2.3.4:1000", "john", "pass2"); res != "Invalid credentials" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := auth("1.2.3.4:1001", "bob", "pass2"); res != "Invalid credentials" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := auth("1.2.3.4:1002", "john", "pass1"); res != "Too many failed attempts" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := auth("1.2.3.5:1000", "john", "pass1"); res != "{john [readonly team1] true}" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Failed attempts are forgotten after the block time
+
+	BasicAuthBlockTime = 0
+	defer func() {
+		BasicAuthBlockTime = 30 * time.Second
+	}()
+
+	if res := auth("1.2.3.4:1000", "john", "pass1"); res != "{john [readonly team1] true}" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Test error cases
+
+	ioutil.WriteFile(userFile, []byte(`[{"name": "john", "password": "pass1"}]`), 0600)
+
+	if _, err := LoadFileUserStore(userFile); err == nil || err.Error() != "User john has an invalid password hash" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	ioutil.WriteFile(userFile, []byte(`[`), 0600)
+
+	if _, err := LoadFileUserStore(userFile); err == nil || err.Error() != "Could not read users from users_test.json: unexpected end of JSON input" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
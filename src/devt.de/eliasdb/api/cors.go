@@ -0,0 +1,154 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+/*
+CORS is the configuration of cross-origin requests to registered endpoints
+(nil if cross-origin requests are not allowed). It can be set by embedders
+before or after registering endpoints.
+*/
+var CORS *CORSConfig
+
+/*
+Default methods and headers of cross-origin requests
+*/
+var (
+	DefaultCORSMethods = []string{"GET", "POST", "PUT", "DELETE", "PATCH"}
+	DefaultCORSHeaders = []string{"Accept", "Authorization", "Content-Type", "X-Api-Key"}
+)
+
+/*
+CORSConfig is the configuration of cross-origin requests.
+*/
+type CORSConfig struct {
+	AllowedOrigins   []string // Allowed origins - either exact (https://example.com) or with wildcards (https://*.example.com or *)
+	AllowedMethods   []string // Allowed methods (DefaultCORSMethods if empty)
+	AllowedHeaders   []string // Allowed request headers (DefaultCORSHeaders if empty)
+	ExposedHeaders   []string // Response headers which can be read by clients (e.g. X-Total-Count)
+	AllowCredentials bool     // Flag if requests may contain credentials (cookies or Authorization headers)
+	MaxAge           int      // Time in seconds a client may cache the result of a preflight request (not sent if 0)
+}
+
+/*
+handleCORS adds the CORS headers for allowed origins to a response. Preflight
+requests are answered directly - returns true if the request was answered.
+*/
+func handleCORS(w http.ResponseWriter, r *http.Request) bool {
+
+	cors := CORS
+	origin := r.Header.Get("Origin")
+
+	if cors == nil || origin == "" {
+		return false
+	}
+
+	w.Header().Add("Vary", "Origin")
+
+	allowed := cors.allowOrigin(origin)
+	preflight := r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+
+	if preflight {
+		methods := cors.AllowedMethods
+		if len(methods) == 0 {
+			methods = DefaultCORSMethods
+		}
+
+		headers := cors.AllowedHeaders
+		if len(headers) == 0 {
+			headers = DefaultCORSHeaders
+		}
+
+		if !allowed || !containsFold(methods, r.Header.Get("Access-Control-Request-Method")) {
+			WriteError(w, r, "Cross-origin request not allowed", http.StatusForbidden)
+			return true
+		}
+
+		for _, h := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+			if h = strings.TrimSpace(h); h != "" && !containsFold(headers, h) {
+				WriteError(w, r, "Cross-origin request header not allowed: "+h, http.StatusForbidden)
+				return true
+			}
+		}
+
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+
+		if cors.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(cors.MaxAge))
+		}
+
+	} else if !allowed {
+		return false
+	}
+
+	// The origin is always sent back so responses to requests with
+	// credentials are accepted by clients
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+
+	if cors.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if preflight {
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+
+	if len(cors.ExposedHeaders) > 0 {
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(cors.ExposedHeaders, ", "))
+	}
+
+	return false
+}
+
+/*
+allowOrigin checks if a given origin is allowed.
+*/
+func (c *CORSConfig) allowOrigin(origin string) bool {
+
+	origin = strings.ToLower(origin)
+
+	for _, o := range c.AllowedOrigins {
+		o = strings.ToLower(o)
+
+		if o == "*" || o == origin {
+			return true
+		}
+
+		// Wildcards only match within the host name of an origin
+
+		if ok, _ := path.Match(o, origin); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+containsFold checks if a list contains a given string (ignoring case).
+*/
+func containsFold(list []string, s string) bool {
+	for _, l := range list {
+		if strings.EqualFold(l, s) {
+			return true
+		}
+	}
+	return false
+}
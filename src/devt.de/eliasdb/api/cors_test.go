@@ -0,0 +1,151 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+
+	// Capture the registered handlers
+
+	handlers := make(map[string]func(http.ResponseWriter, *http.Request))
+
+	oldHandleFunc := HandleFunc
+	HandleFunc = func(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+		handlers[pattern] = handler
+	}
+	defer func() {
+		HandleFunc = oldHandleFunc
+	}()
+
+	RegisterRestEndpoints(map[string]RestEndpointInst{
+		"/corstest/": func() RestEndpointHandler {
+			return &authTestEndpoint{}
+		},
+	})
+
+	send := func(method string, header ...string) string {
+		r := httptest.NewRequest(method, "/corstest/", nil)
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+
+		w := httptest.NewRecorder()
+		handlers["/corstest/"](w, r)
+
+		var ret []string
+		for _, h := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Methods",
+			"Access-Control-Allow-Headers", "Access-Control-Allow-Credentials",
+			"Access-Control-Max-Age", "Access-Control-Expose-Headers"} {
+			if v := w.Header().Get(h); v != "" {
+				ret = append(ret, strings.TrimPrefix(strings.TrimPrefix(h, "Access-Control-"), "Allow-")+"="+v)
+			}
+		}
+
+		return fmt.Sprint(w.Code, " ", ret, " ", strings.TrimSpace(w.Body.String()))
+	}
+
+	// No CORS headers are sent without a configuration
+
+	if res := send("GET", "Origin", "https://app.example.com"); res != "200 [] get -" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	CORS = &CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		ExposedHeaders:   []string{"X-Total-Count"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	}
+	defer func() {
+		CORS = nil
+	}()
+
+	// Preflight requests are answered before they reach the endpoint
+
+	if res := send("OPTIONS", "Origin", "https://app.example.com", "Access-Control-Request-Method", "POST",
+		"Access-Control-Request-Headers", "content-type, x-api-key"); res != "204 [Origin=https://app.example.com "+
+		"Methods=GET, POST, PUT, DELETE, PATCH Headers=Accept, Authorization, Content-Type, X-Api-Key Credentials=true Max-Age=600] " {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send("OPTIONS", "Origin", "https://test.example.org", "Access-Control-Request-Method", "GET"); res != "204 [Origin=https://test.example.org "+
+		"Methods=GET, POST, PUT, DELETE, PATCH Headers=Accept, Authorization, Content-Type, X-Api-Key Credentials=true Max-Age=600] " {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Actual requests get the CORS headers
+
+	if res := send("GET", "Origin", "https://app.example.com"); res != "200 [Origin=https://app.example.com Credentials=true Expose-Headers=X-Total-Count] get -" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Origins which are not allowed never get CORS headers
+
+	if res := send("GET", "Origin", "https://evil.com"); res != "200 [] get -" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send("GET", "Origin", "https://example.org.evil.com"); res != "200 [] get -" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send("OPTIONS", "Origin", "https://evil.com", "Access-Control-Request-Method", "GET"); res != "403 [] Cross-origin request not allowed" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Methods and headers of preflight requests are checked
+
+	CORS.AllowedMethods = []string{"GET"}
+	CORS.AllowedHeaders = []string{"Authorization"}
+
+	if res := send("OPTIONS", "Origin", "https://app.example.com", "Access-Control-Request-Method", "DELETE"); res != "403 [] Cross-origin request not allowed" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send("OPTIONS", "Origin", "https://app.example.com", "Access-Control-Request-Method", "GET",
+		"Access-Control-Request-Headers", "X-Api-Key"); res != "403 [] Cross-origin request header not allowed: X-Api-Key" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Preflight requests do not need credentials
+
+	Auth, _ = NewAPIKeyAuthenticator([]*APIKey{{"test", "123", ScopeRead, nil}})
+	defer func() {
+		Auth = nil
+	}()
+
+	if res := send("OPTIONS", "Origin", "https://app.example.com", "Access-Control-Request-Method", "GET"); res != "204 [Origin=https://app.example.com "+
+		"Methods=GET Headers=Authorization Credentials=true Max-Age=600] " {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send("GET", "Origin", "https://app.example.com", "X-Api-Key", "123"); res != "200 [Origin=https://app.example.com Credentials=true Expose-Headers=X-Total-Count] get test" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
@@ -0,0 +1,136 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+/*
+JSONErrors is a flag if all error responses are written as JSON objects. If
+not set only requests which accept application/json get JSON error responses
+and all other requests get plain text error responses.
+*/
+var JSONErrors = false
+
+/*
+MaxRequestBodySize is the maximum size in bytes of a (decompressed) request
+body (0 means no limit).
+*/
+var MaxRequestBodySize int64 = 32 * 1024 * 1024
+
+/*
+BodyLimitExempt contains the endpoint URLs whose request bodies are not
+limited (e.g. streamed imports).
+*/
+var BodyLimitExempt = map[string]bool{}
+
+/*
+ErrorResponse is the JSON object of an error response.
+*/
+type ErrorResponse struct {
+	Code    int         `json:"code"`              // HTTP status code
+	Message string      `json:"message"`           // Error message
+	Details interface{} `json:"details,omitempty"` // Details of the error (e.g. invalid fields)
+}
+
+/*
+ErrorDetail is the detail of an error which relates to a single field of the
+request.
+*/
+type ErrorDetail struct {
+	Field   string `json:"field"`   // Name of the field (e.g. nodes[0].key)
+	Message string `json:"message"` // Problem with the field
+}
+
+/*
+WantsJSONErrors checks if the error responses of a request should be written
+as JSON objects.
+*/
+func WantsJSONErrors(r *http.Request) bool {
+	return JSONErrors || (r != nil && strings.Contains(r.Header.Get("Accept"), "application/json"))
+}
+
+/*
+WriteError writes an error response. The response is a JSON object if the
+request wants JSON errors and plain text otherwise.
+*/
+func WriteError(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	WriteErrorDetails(w, r, msg, code, nil)
+}
+
+/*
+WriteErrorDetails writes an error response with details. Details are only
+written if the response is a JSON object.
+*/
+func WriteErrorDetails(w http.ResponseWriter, r *http.Request, msg string, code int, details interface{}) {
+
+	if !WantsJSONErrors(r) {
+		http.Error(w, msg, code)
+		return
+	}
+
+	w.Header().Del("Content-Length")
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+
+	json.NewEncoder(w).Encode(&ErrorResponse{code, msg, details})
+}
+
+/*
+WriteBodyError writes an error response for a request body which could not be
+read. The status is 413 if the body exceeded the maximum size.
+*/
+func WriteBodyError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	var mbe *http.MaxBytesError
+
+	if errors.As(err, &mbe) {
+		writeBodyTooLarge(w, r, mbe.Limit)
+		return
+	}
+
+	WriteError(w, r, msg+": "+err.Error(), http.StatusBadRequest)
+}
+
+/*
+limitRequestBody limits the size of the body of a request to an endpoint.
+Writes an error response and returns false if the declared size of the body
+exceeds the limit.
+*/
+func limitRequestBody(w http.ResponseWriter, r *http.Request, url string) bool {
+
+	if MaxRequestBodySize <= 0 || BodyLimitExempt[url] || r.Body == nil || r.Body == http.NoBody {
+		return true
+	}
+
+	if r.ContentLength > MaxRequestBodySize {
+		writeBodyTooLarge(w, r, MaxRequestBodySize)
+		return false
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+
+	return true
+}
+
+/*
+writeBodyTooLarge writes the error response for a request body which exceeds
+the maximum size.
+*/
+func writeBodyTooLarge(w http.ResponseWriter, r *http.Request, limit int64) {
+	WriteError(w, r, fmt.Sprintf("Request body is larger than the maximum of %v bytes", limit),
+		http.StatusRequestEntityTooLarge)
+}
@@ -0,0 +1,164 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type errorTestEndpoint struct {
+	*DefaultEndpointHandler
+}
+
+/*
+HandlePOST writes the size of the request body.
+*/
+func (te *errorTestEndpoint) HandlePOST(w http.ResponseWriter, r *http.Request, resources []string) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		WriteBodyError(w, r, "Could not read request body", err)
+		return
+	}
+
+	if len(resources) > 0 {
+		WriteErrorDetails(w, r, "Invalid data", http.StatusBadRequest,
+			[]*ErrorDetail{{"nodes[0].key", "Missing key value"}})
+		return
+	}
+
+	fmt.Fprint(w, len(body))
+}
+
+func (te *errorTestEndpoint) SwaggerDefs(s map[string]interface{}) {
+}
+
+func TestErrorResponses(t *testing.T) {
+
+	// Capture the registered handlers
+
+	handlers := make(map[string]func(http.ResponseWriter, *http.Request))
+
+	oldHandleFunc := HandleFunc
+	HandleFunc = func(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+		handlers[pattern] = handler
+	}
+	oldMaxRequestBodySize := MaxRequestBodySize
+	MaxRequestBodySize = 10
+	defer func() {
+		HandleFunc = oldHandleFunc
+		MaxRequestBodySize = oldMaxRequestBodySize
+		JSONErrors = false
+		delete(BodyLimitExempt, "/errortest/")
+	}()
+
+	RegisterRestEndpoints(map[string]RestEndpointInst{
+		"/errortest/": func() RestEndpointHandler {
+			return &errorTestEndpoint{}
+		},
+	})
+
+	send := func(method string, url string, body []byte, chunked bool, header ...string) string {
+		r := httptest.NewRequest(method, url, bytes.NewReader(body))
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+
+		if chunked {
+			r.ContentLength = -1
+		}
+
+		w := httptest.NewRecorder()
+		handlers["/errortest/"](w, r)
+
+		return fmt.Sprint(w.Code, " ", w.Header().Get("Content-Type"), " ", strings.TrimSpace(w.Body.String()))
+	}
+
+	if res := send("POST", "/errortest/", []byte("0123456789"), false); res != "200 text/plain; charset=utf-8 10" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Bodies which are larger than the limit are rejected - either because
+	// of their declared size or while they are read
+
+	if res := send("POST", "/errortest/", []byte("0123456789a"), false); res != "413 text/plain; charset=utf-8 Request body is larger than the maximum of 10 bytes" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send("POST", "/errortest/", []byte("0123456789a"), true); res != "413 text/plain; charset=utf-8 Request body is larger than the maximum of 10 bytes" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// The limit applies to decompressed bodies
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(strings.Repeat("a", 100)))
+	gz.Close()
+
+	if res := send("POST", "/errortest/", buf.Bytes(), false, "Content-Encoding", "gzip"); res != "413 text/plain; charset=utf-8 Request body is larger than the maximum of 10 bytes" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Requests which accept JSON get JSON errors
+
+	if res := send("POST", "/errortest/", []byte("0123456789a"), false, "Accept", "application/json"); res != `413 application/json; charset=utf-8 {"code":413,"message":"Request body is larger than the maximum of 10 bytes"}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send("POST", "/errortest/foo", nil, false, "Accept", "application/json"); res != `400 application/json; charset=utf-8 {"code":400,"message":"Invalid data","details":[{"field":"nodes[0].key","message":"Missing key value"}]}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send("GET", "/errortest/", nil, false, "Accept", "application/json"); res != `405 application/json; charset=utf-8 {"code":405,"message":"Method Not Allowed"}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Details are only written in JSON errors
+
+	if res := send("POST", "/errortest/foo", nil, false); res != "400 text/plain; charset=utf-8 Invalid data" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// All errors are JSON errors if the server option is set
+
+	JSONErrors = true
+
+	if res := send("GET", "/errortest/", nil, false); res != `405 application/json; charset=utf-8 {"code":405,"message":"Method Not Allowed"}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	JSONErrors = false
+
+	// Exempt endpoints are not limited
+
+	BodyLimitExempt["/errortest/"] = true
+
+	if res := send("POST", "/errortest/", []byte("0123456789a"), false); res != "200 text/plain; charset=utf-8 11" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
@@ -0,0 +1,253 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+/*
+GzipMinSize is the minimum size in bytes of a response which is compressed
+(compression is disabled if negative). Responses which are flushed before they
+reach the minimum size are always compressed.
+*/
+var GzipMinSize = 1024
+
+/*
+GzipContentTypes are the content types of responses which are compressed.
+*/
+var GzipContentTypes = []string{"application/json", "application/x-ndjson", "text/"}
+
+/*
+gzipResponseWriter compresses a response if the client accepts gzip encoding.
+Writes are buffered until it is decided if the response is compressed.
+*/
+type gzipResponseWriter struct {
+	http.ResponseWriter              // Wrapped response writer
+	code                int          // Status code of the response (0 if not set)
+	buf                 []byte       // Buffered data while undecided
+	decided             bool         // Flag if it was decided if the response is compressed
+	gz                  *gzip.Writer // Gzip writer (nil if the response is not compressed)
+}
+
+/*
+compressResponse wraps the response writer of a request if the client accepts
+gzip encoding. The returned function must be called once the request was
+handled.
+*/
+func compressResponse(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+
+	if GzipMinSize < 0 || r.Method == "HEAD" || r.Header.Get("Upgrade") != "" ||
+		!acceptsGzip(r.Header.Get("Accept-Encoding")) {
+		return w, func() {}
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	gw := &gzipResponseWriter{ResponseWriter: w}
+
+	return gw, gw.close
+}
+
+/*
+acceptsGzip checks if an Accept-Encoding header contains gzip.
+*/
+func acceptsGzip(accept string) bool {
+
+	for _, enc := range strings.Split(accept, ",") {
+		enc = strings.TrimSpace(enc)
+
+		if i := strings.Index(enc, ";"); i != -1 {
+			param := strings.Replace(enc[i+1:], " ", "", -1)
+
+			if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil && q == 0 {
+				continue
+			}
+			enc = strings.TrimSpace(enc[:i])
+		}
+
+		if strings.EqualFold(enc, "gzip") {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+WriteHeader stores the status code of the response. It is sent once it was
+decided if the response is compressed.
+*/
+func (gw *gzipResponseWriter) WriteHeader(code int) {
+	if gw.code == 0 {
+		gw.code = code
+	}
+	if gw.decided && gw.gz == nil {
+		gw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+/*
+Write writes data to the response.
+*/
+func (gw *gzipResponseWriter) Write(data []byte) (int, error) {
+
+	if gw.decided {
+		if gw.gz != nil {
+			return gw.gz.Write(data)
+		}
+		return gw.ResponseWriter.Write(data)
+	}
+
+	gw.buf = append(gw.buf, data...)
+
+	if len(gw.buf) >= GzipMinSize {
+		if err := gw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(data), nil
+}
+
+/*
+Flush sends all buffered data to the client.
+*/
+func (gw *gzipResponseWriter) Flush() {
+
+	if !gw.decided {
+		gw.decide(true)
+	}
+
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+
+	if f, ok := gw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+/*
+decide decides if the response is compressed and writes the buffered data.
+*/
+func (gw *gzipResponseWriter) decide(compress bool) error {
+	var err error
+
+	gw.decided = true
+
+	h := gw.Header()
+
+	if len(gw.buf) > 0 && h.Get("Content-Type") == "" {
+		h.Set("Content-Type", http.DetectContentType(gw.buf))
+	}
+
+	compress = compress && h.Get("Content-Encoding") == "" &&
+		gw.code != http.StatusNoContent && gw.code != http.StatusNotModified
+
+	if compress {
+		compress = false
+
+		for _, ct := range GzipContentTypes {
+			compress = compress || strings.HasPrefix(strings.ToLower(h.Get("Content-Type")), ct)
+		}
+	}
+
+	if compress {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+
+		gw.gz = gzip.NewWriter(gw.ResponseWriter)
+	}
+
+	if gw.code != 0 {
+		gw.ResponseWriter.WriteHeader(gw.code)
+	}
+
+	if len(gw.buf) > 0 {
+		if gw.gz != nil {
+			_, err = gw.gz.Write(gw.buf)
+		} else {
+			_, err = gw.ResponseWriter.Write(gw.buf)
+		}
+	}
+
+	gw.buf = nil
+
+	return err
+}
+
+/*
+close writes all remaining data of the response. Responses which are smaller
+than the minimum size are not compressed.
+*/
+func (gw *gzipResponseWriter) close() {
+
+	if !gw.decided {
+		gw.decide(false)
+	}
+
+	if gw.gz != nil {
+		gw.gz.Close()
+	}
+}
+
+/*
+decompressRequest decompresses the body of a request with gzip content
+encoding. Writes an error response and returns false if the body cannot be
+decompressed.
+*/
+func decompressRequest(w http.ResponseWriter, r *http.Request) bool {
+
+	enc := strings.TrimSpace(r.Header.Get("Content-Encoding"))
+
+	if enc == "" || strings.EqualFold(enc, "identity") {
+		return true
+	}
+
+	if !strings.EqualFold(enc, "gzip") {
+		WriteError(w, r, "Unsupported content encoding: "+enc, http.StatusUnsupportedMediaType)
+		return false
+	}
+
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		WriteError(w, r, "Could not decompress request body: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	r.Body = &gzipRequestBody{gz, r.Body}
+	r.ContentLength = -1
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+
+	return true
+}
+
+/*
+gzipRequestBody is a decompressed request body.
+*/
+type gzipRequestBody struct {
+	*gzip.Reader               // Reader for decompressed data
+	body         io.ReadCloser // Compressed request body
+}
+
+/*
+Close closes the request body.
+*/
+func (b *gzipRequestBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
@@ -0,0 +1,170 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type gzipTestEndpoint struct {
+	*DefaultEndpointHandler
+}
+
+/*
+HandleGET writes a response of a given content type and size - the response
+is flushed after its first half if requested.
+*/
+func (te *gzipTestEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
+	size, _ := strconv.Atoi(resources[1])
+
+	w.Header().Set("content-type", strings.Replace(resources[0], "_", "/", 1))
+
+	data := []byte(strings.Repeat("a", size))
+
+	if len(resources) > 2 {
+		w.Write(data[:size/2])
+		w.(http.Flusher).Flush()
+		data = data[size/2:]
+	}
+
+	w.Write(data)
+}
+
+/*
+HandlePOST writes the request body.
+*/
+func (te *gzipTestEndpoint) HandlePOST(w http.ResponseWriter, r *http.Request, resources []string) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Write(body)
+}
+
+func (te *gzipTestEndpoint) SwaggerDefs(s map[string]interface{}) {
+}
+
+func TestGzipCompression(t *testing.T) {
+
+	// Capture the registered handlers
+
+	handlers := make(map[string]func(http.ResponseWriter, *http.Request))
+
+	oldHandleFunc := HandleFunc
+	HandleFunc = func(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+		handlers[pattern] = handler
+	}
+	defer func() {
+		HandleFunc = oldHandleFunc
+	}()
+
+	RegisterRestEndpoints(map[string]RestEndpointInst{
+		"/gziptest/": func() RestEndpointHandler {
+			return &gzipTestEndpoint{}
+		},
+	})
+
+	send := func(method string, url string, body []byte, header ...string) string {
+		r := httptest.NewRequest(method, url, bytes.NewReader(body))
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+
+		w := httptest.NewRecorder()
+		handlers["/gziptest/"](w, r)
+
+		res := w.Body.Bytes()
+
+		if w.Header().Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(w.Body)
+			if err != nil {
+				return err.Error()
+			}
+			res, _ = ioutil.ReadAll(gz)
+		}
+
+		size := len(res)
+		if len(res) > 40 {
+			res = res[:40]
+		}
+
+		return fmt.Sprint(w.Code, " ", w.Header().Get("Content-Encoding"), " ", w.Flushed, " ",
+			size, " ", strings.TrimSpace(string(res)))
+	}
+
+	// Large responses of compressible types are compressed
+
+	if res := send("GET", "/gziptest/application_json/2000", nil, "Accept-Encoding", "deflate, gzip"); res != "200 gzip false 2000 "+strings.Repeat("a", 40) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Small responses, clients which do not accept gzip and other content
+	// types are not compressed
+
+	if res := send("GET", "/gziptest/application_json/100", nil, "Accept-Encoding", "gzip"); res != "200  false 100 "+strings.Repeat("a", 40) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send("GET", "/gziptest/application_json/2000", nil); res != "200  false 2000 "+strings.Repeat("a", 40) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send("GET", "/gziptest/application_json/2000", nil, "Accept-Encoding", "gzip;q=0"); res != "200  false 2000 "+strings.Repeat("a", 40) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send("GET", "/gziptest/image_png/2000", nil, "Accept-Encoding", "gzip"); res != "200  false 2000 "+strings.Repeat("a", 40) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Flushed responses are compressed and flushed
+
+	if res := send("GET", "/gziptest/text_csv/100/flush", nil, "Accept-Encoding", "gzip"); res != "200 gzip true 100 "+strings.Repeat("a", 40) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Compressed request bodies are decompressed
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(`{"foo":"bar"}`))
+	gz.Close()
+
+	if res := send("POST", "/gziptest/", buf.Bytes(), "Content-Encoding", "gzip"); res != `200  false 13 {"foo":"bar"}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send("POST", "/gziptest/", []byte(`{"foo":"bar"}`), "Content-Encoding", "gzip"); res != `400  false 56 Could not decompress request body: gzip:` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send("POST", "/gziptest/", []byte(`{"foo":"bar"}`), "Content-Encoding", "br"); res != `415  false 33 Unsupported content encoding: br` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
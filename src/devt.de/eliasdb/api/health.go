@@ -0,0 +1,338 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"devt.de/common/fileutil"
+	"devt.de/eliasdb/graph"
+)
+
+/*
+EndpointHealth is the health endpoint URL (rooted). Handles health/
+*/
+const EndpointHealth = APIRoot + "/health/"
+
+/*
+Status values of health checks
+*/
+const (
+	HealthOK      = "ok"      // Check passed
+	HealthWarning = "warning" // Check found a problem which does not affect availability
+	HealthFail    = "fail"    // Check failed - the server is not healthy
+)
+
+/*
+HealthCacheDuration is the duration for which the result of the storage checks
+is reused so frequent probes cannot cause load.
+*/
+var HealthCacheDuration = 2 * time.Second
+
+/*
+HealthMinFreeDisk is the minimum number of available bytes on the disk of the
+data directory - less available space fails the health check (0 disables the
+check).
+*/
+var HealthMinFreeDisk uint64 = 64 * 1024 * 1024
+
+/*
+ready is 1 if the server finished starting and can serve requests.
+*/
+var ready int32
+
+/*
+SetReady sets if the server can serve requests. The readiness check fails
+until the server was set to ready (e.g. during startup and recovery) and after
+it was set to not ready (e.g. during shutdown).
+*/
+func SetReady(r bool) {
+	var val int32
+
+	if r {
+		val = 1
+	}
+
+	atomic.StoreInt32(&ready, val)
+}
+
+/*
+IsReady returns if the server can serve requests.
+*/
+func IsReady() bool {
+	return atomic.LoadInt32(&ready) == 1
+}
+
+/*
+shutdownChan is closed once the server begins to shut down.
+*/
+var shutdownChan = make(chan bool)
+
+/*
+shutdownLock protects shutdownChan.
+*/
+var shutdownLock = &sync.Mutex{}
+
+/*
+ShutdownNotify returns a channel which is closed once the server begins to
+shut down. Long-lived requests (e.g. WebSockets or event streams) should end
+once the channel is closed so the server can finish its shutdown.
+*/
+func ShutdownNotify() <-chan bool {
+	shutdownLock.Lock()
+	defer shutdownLock.Unlock()
+
+	return shutdownChan
+}
+
+/*
+BeginShutdown notifies all long-lived requests that the server shuts down.
+Requests which start afterwards get a new notification channel.
+*/
+func BeginShutdown() {
+	shutdownLock.Lock()
+	defer shutdownLock.Unlock()
+
+	close(shutdownChan)
+	shutdownChan = make(chan bool)
+}
+
+/*
+HealthComponent is the result of the health check of a single component.
+*/
+type HealthComponent struct {
+	Status              string     `json:"status"`                         // Status of the component
+	Error               string     `json:"error,omitempty"`                // Error of a failed check
+	PendingTransactions *int       `json:"pending_transactions,omitempty"` // Pending transactions in transaction logs
+	LastFlush           *time.Time `json:"last_flush,omitempty"`           // Time of the last flush
+	LastErrorTime       *time.Time `json:"last_error_time,omitempty"`      // Time of the last storage error
+	FreeBytes           *uint64    `json:"free_bytes,omitempty"`           // Available bytes on disk
+	TotalBytes          *uint64    `json:"total_bytes,omitempty"`          // Total bytes on disk
+}
+
+/*
+Health is the result of a health check.
+*/
+type Health struct {
+	Status     string                      `json:"status"`     // Overall status
+	Components map[string]*HealthComponent `json:"components"` // Status of all checked components
+}
+
+/*
+healthCache holds the result of the last storage checks.
+*/
+var healthCache = struct {
+	gm     *graph.Manager              // Checked graph manager
+	time   time.Time                   // Time of the checks
+	result map[string]*HealthComponent // Results of the checks
+	lock   *sync.Mutex                 // Lock for the cache
+}{lock: &sync.Mutex{}}
+
+/*
+CheckHealth checks the graph storage of the API and optionally the readiness
+of the server. The results of the storage checks are cached for
+HealthCacheDuration.
+*/
+func CheckHealth(readiness bool) *Health {
+	gm := GM
+
+	healthCache.lock.Lock()
+
+	if healthCache.gm != gm || time.Since(healthCache.time) > HealthCacheDuration {
+		healthCache.gm = gm
+		healthCache.time = time.Now()
+		healthCache.result = checkStorage(gm)
+	}
+
+	h := &Health{HealthOK, make(map[string]*HealthComponent)}
+
+	for name, c := range healthCache.result {
+		h.Components[name] = c
+	}
+
+	healthCache.lock.Unlock()
+
+	if readiness {
+		c := &HealthComponent{Status: HealthOK}
+
+		if !IsReady() {
+			c = &HealthComponent{Status: HealthFail, Error: "Server is not ready"}
+		}
+
+		h.Components["server"] = c
+	}
+
+	for _, c := range h.Components {
+		if c.Status == HealthFail {
+			h.Status = HealthFail
+		}
+	}
+
+	return h
+}
+
+/*
+checkStorage runs the checks of a graph storage.
+*/
+func checkStorage(gm *graph.Manager) map[string]*HealthComponent {
+
+	if gm == nil {
+		return map[string]*HealthComponent{
+			"storage": {Status: HealthFail, Error: "No graph manager"},
+		}
+	}
+
+	diag, err := gm.CheckStorage()
+
+	ret := map[string]*HealthComponent{
+		"storage": {Status: HealthOK},
+	}
+
+	if err != nil {
+		ret["storage"] = &HealthComponent{Status: HealthFail, Error: err.Error()}
+	}
+
+	if diag == nil {
+		return ret
+	}
+
+	ret["transaction_log"] = &HealthComponent{Status: HealthOK, PendingTransactions: &diag.PendingTransactions}
+
+	flush := &HealthComponent{Status: HealthOK}
+	if !diag.LastFlush.IsZero() {
+		flush.LastFlush = &diag.LastFlush
+	}
+	ret["flush"] = flush
+
+	// Storage errors are reported but do not fail the check - an unusable
+	// storage fails the storage check
+
+	errors := &HealthComponent{Status: HealthOK}
+	if diag.LastError != nil {
+		errors = &HealthComponent{Status: HealthWarning, Error: diag.LastError.Error(),
+			LastErrorTime: &diag.LastErrorTime}
+	}
+	ret["storage_errors"] = errors
+
+	if diag.Location != "" {
+		disk := &HealthComponent{Status: HealthOK}
+
+		if free, total, err := fileutil.DiskSpace(diag.Location); err != nil {
+			disk = &HealthComponent{Status: HealthWarning, Error: err.Error()}
+		} else {
+			disk.FreeBytes, disk.TotalBytes = &free, &total
+
+			if free < HealthMinFreeDisk {
+				disk.Status = HealthFail
+				disk.Error = fmt.Sprintf("Less than %v bytes available", HealthMinFreeDisk)
+			}
+		}
+
+		ret["disk"] = disk
+	}
+
+	return ret
+}
+
+/*
+HealthEndpointInst creates a new endpoint handler.
+*/
+func HealthEndpointInst() RestEndpointHandler {
+	return &healthEndpoint{}
+}
+
+/*
+Handler object for health checks.
+*/
+type healthEndpoint struct {
+	*DefaultEndpointHandler
+}
+
+/*
+HandleGET returns the health of the server. The status is 503 if a critical
+check fails.
+*/
+func (he *healthEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
+
+	if len(resources) > 1 || (len(resources) == 1 && resources[0] != "ready") {
+		WriteError(w, r, "Invalid resource specification", http.StatusBadRequest)
+		return
+	}
+
+	h := CheckHealth(len(resources) == 1)
+
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+	w.Header().Set("cache-control", "no-store")
+
+	if h.Status == HealthFail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(h)
+}
+
+/*
+Describe describes the endpoint in the API description.
+*/
+func (he *healthEndpoint) Describe() []*EndpointDescription {
+	var ret []*EndpointDescription
+
+	for _, path := range []string{"", "/ready"} {
+		ret = append(ret, &EndpointDescription{
+			Path:    strings.TrimSuffix(EndpointHealth, "/") + path,
+			Summary: "Return the health of the server.",
+			Responses: []*ResponseDescription{
+				{200, "Status of the server and its components.", "application/json", nil},
+				{503, "Status of the server and its components if a critical check failed.", "application/json", nil},
+			},
+		})
+	}
+
+	return ret
+}
+
+/*
+SwaggerDefs is used to describe the endpoint in swagger.
+*/
+func (he *healthEndpoint) SwaggerDefs(s map[string]interface{}) {
+
+	for path, desc := range map[string]string{
+		"/health": "Returns the status of the graph storage. The status is 503 if a " +
+			"critical check fails.",
+		"/health/ready": "Returns the status of the graph storage and if the server " +
+			"finished starting. The status is 503 if a critical check fails or if the server " +
+			"is starting or shutting down.",
+	} {
+		s["paths"].(map[string]interface{})[path] = map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":     "Return the health of the server.",
+				"description": desc,
+				"produces": []string{
+					"application/json",
+				},
+				"responses": map[string]interface{}{
+					"200": map[string]interface{}{
+						"description": "Status of the server and its components.",
+					},
+					"503": map[string]interface{}{
+						"description": "Status of the server and its components if a critical check failed.",
+					},
+				},
+			},
+		}
+	}
+}
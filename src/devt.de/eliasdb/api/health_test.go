@@ -0,0 +1,146 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+func TestHealth(t *testing.T) {
+	oldGM := GM
+	oldCacheDuration := HealthCacheDuration
+	defer func() {
+		GM = oldGM
+		HealthCacheDuration = oldCacheDuration
+		SetReady(false)
+	}()
+
+	get := func(resources ...string) (int, *Health) {
+		var h *Health
+
+		w := httptest.NewRecorder()
+		HealthEndpointInst().HandleGET(w, httptest.NewRequest("GET", EndpointHealth, nil), resources)
+
+		if w.Code != http.StatusBadRequest {
+			h = &Health{}
+			if err := json.Unmarshal(w.Body.Bytes(), h); err != nil {
+				t.Error(err)
+			}
+		}
+
+		return w.Code, h
+	}
+
+	// Without a graph manager the storage is not usable
+
+	GM = nil
+
+	if code, h := get(); code != http.StatusServiceUnavailable || h.Status != HealthFail ||
+		h.Components["storage"].Error != "No graph manager" {
+		t.Error("Unexpected result:", code, h)
+		return
+	}
+
+	GM = graph.NewGraphManager(graphstorage.NewMemoryGraphStorage("mystorage"))
+
+	code, h := get()
+
+	if code != http.StatusOK || h.Status != HealthOK || len(h.Components) != 4 ||
+		h.Components["storage"].Status != HealthOK || *h.Components["transaction_log"].PendingTransactions != 0 ||
+		h.Components["storage_errors"].Status != HealthOK {
+		t.Error("Unexpected result:", code, h)
+		return
+	}
+
+	// The readiness check fails until the server is ready
+
+	if code, h := get("ready"); code != http.StatusServiceUnavailable ||
+		h.Components["server"].Error != "Server is not ready" {
+		t.Error("Unexpected result:", code, h)
+		return
+	}
+
+	SetReady(true)
+
+	if code, h := get("ready"); code != http.StatusOK || h.Components["server"].Status != HealthOK {
+		t.Error("Unexpected result:", code, h)
+		return
+	}
+
+	// Results of the storage checks are cached
+
+	HealthCacheDuration = time.Hour
+
+	GM.Close()
+
+	if code, _ := get(); code != http.StatusOK {
+		t.Error("Unexpected result:", code)
+		return
+	}
+
+	HealthCacheDuration = 0
+
+	if code, h := get("ready"); code != http.StatusServiceUnavailable ||
+		h.Components["storage"].Error != "GraphError: Graph manager was closed (Graph mystorage)" ||
+		h.Components["server"].Status != HealthOK {
+		t.Error("Unexpected result:", code, h)
+		return
+	}
+
+	// Check disk storage
+
+	defer os.RemoveAll("healthtest")
+
+	dgs, err := graphstorage.NewDiskGraphStorage("healthtest", false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	GM = graph.NewGraphManager(dgs)
+	defer GM.Close()
+
+	code, h = get()
+
+	if disk := h.Components["disk"]; code != http.StatusOK || disk.Status != HealthOK ||
+		*disk.FreeBytes == 0 || *disk.TotalBytes < *disk.FreeBytes || h.Components["flush"].LastFlush == nil {
+		t.Error("Unexpected result:", code, h)
+		return
+	}
+
+	oldMinFreeDisk := HealthMinFreeDisk
+	HealthMinFreeDisk = *h.Components["disk"].TotalBytes + 1
+	defer func() {
+		HealthMinFreeDisk = oldMinFreeDisk
+	}()
+
+	if code, h := get(); code != http.StatusServiceUnavailable || h.Components["disk"].Status != HealthFail ||
+		!strings.HasPrefix(h.Components["disk"].Error, "Less than") {
+		t.Error("Unexpected result:", code, h)
+		return
+	}
+
+	// Test error cases
+
+	if code, _ := get("foo"); code != http.StatusBadRequest {
+		t.Error("Unexpected result:", code)
+		return
+	}
+}
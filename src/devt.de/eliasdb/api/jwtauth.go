@@ -0,0 +1,424 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+JWKSMinRefetchTime is the minimum time between two fetches of the JWKS. Keys
+are fetched again if a token has an unknown key id.
+*/
+var JWKSMinRefetchTime = time.Minute
+
+/*
+JWTConfig is the configuration of a JWT authenticator. Tokens are verified with
+a static HMAC key, a static RSA key or the keys of a JSON Web Key Set.
+*/
+type JWTConfig struct {
+	HMACKey   []byte                 // Static key of HS256, HS384 and HS512 tokens
+	RSAKey    *rsa.PublicKey         // Static key of RS256, RS384 and RS512 tokens
+	FetchJWKS func() ([]byte, error) // Function which fetches a JSON Web Key Set with RSA keys
+	Issuer    string                 // Required issuer of tokens (not checked if empty)
+	Audience  string                 // Required audience of tokens (not checked if empty)
+	ClockSkew time.Duration          // Tolerance when checking the expiry and not before times
+	Subject   string                 // Claim which contains the name of the client (default is sub)
+	Roles     []string               // Claims which contain the roles or scopes of the client (default is roles and scope)
+	Write     string                 // Role or scope which is required for methods which change data (not checked if empty)
+}
+
+/*
+JWTAuthenticator authenticates requests with JSON Web Tokens which are sent
+in the Authorization header (Bearer <token>). Clients whose token lacks the
+write role or scope are only allowed to read.
+*/
+type JWTAuthenticator struct {
+	config   *JWTConfig                // Configuration of the authenticator
+	now      func() time.Time          // Function which returns the current time
+	keys     map[string]*rsa.PublicKey // Keys of the JWKS by key id
+	fetched  time.Time                 // Time of the last fetch of the JWKS
+	keysLock *sync.Mutex               // Lock for the keys of the JWKS
+}
+
+/*
+NewJWTAuthenticator creates a new JWT authenticator.
+*/
+func NewJWTAuthenticator(config JWTConfig) (*JWTAuthenticator, error) {
+
+	if config.HMACKey == nil && config.RSAKey == nil && config.FetchJWKS == nil {
+		return nil, errors.New("JWT authentication needs a HMAC key, a RSA key or a JWKS")
+	}
+
+	if config.Subject == "" {
+		config.Subject = "sub"
+	}
+	if config.Roles == nil {
+		config.Roles = []string{"roles", "scope"}
+	}
+
+	return &JWTAuthenticator{&config, time.Now, nil, time.Time{}, &sync.Mutex{}}, nil
+}
+
+/*
+LoadJWTKey loads a static key from a given file. The file either contains a
+PEM encoded RSA public key or the secret of HMAC tokens.
+*/
+func LoadJWTKey(filename string) ([]byte, *rsa.PublicKey, error) {
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		secret := []byte(strings.TrimSpace(string(content)))
+
+		if len(secret) == 0 {
+			return nil, nil, fmt.Errorf("Could not read JWT key from %v: Empty key", filename)
+		}
+
+		return secret, nil, nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		if key, err = x509.ParsePKCS1PublicKey(block.Bytes); err != nil {
+			return nil, nil, fmt.Errorf("Could not read JWT key from %v: %v", filename, err)
+		}
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("Could not read JWT key from %v: Not a RSA public key", filename)
+	}
+
+	return nil, rsaKey, nil
+}
+
+/*
+HTTPJWKSFetcher returns a function which fetches a JSON Web Key Set from a
+given URL.
+*/
+func HTTPJWKSFetcher(url string) func() ([]byte, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	return func() ([]byte, error) {
+		resp, err := client.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Could not fetch JWKS from %v: %v", url, resp.Status)
+		}
+
+		return ioutil.ReadAll(resp.Body)
+	}
+}
+
+/*
+Authenticate verifies the token of a request.
+*/
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil, ErrMissingCredentials
+	}
+
+	claims, err := a.verify(strings.TrimSpace(auth[7:]))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", ErrInvalidCredentials, err)
+	}
+
+	// Extract the client and its roles
+
+	name, _ := claims[a.config.Subject].(string)
+
+	var roles []string
+
+	for _, claim := range a.config.Roles {
+		switch v := claims[claim].(type) {
+		case string:
+			roles = append(roles, strings.Fields(v)...)
+		case []interface{}:
+			for _, r := range v {
+				if s, ok := r.(string); ok {
+					roles = append(roles, s)
+				}
+			}
+		}
+	}
+
+	readOnly := a.config.Write != ""
+	for _, role := range roles {
+		readOnly = readOnly && role != a.config.Write
+	}
+
+	return &Principal{name, roles, readOnly}, nil
+}
+
+/*
+Challenge returns the value of the WWW-Authenticate header.
+*/
+func (a *JWTAuthenticator) Challenge() string {
+	return "Bearer"
+}
+
+/*
+verify checks the signature and the claims of a token and returns its claims.
+*/
+func (a *JWTAuthenticator) verify(token string) (map[string]interface{}, error) {
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	var claims map[string]interface{}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("Malformed token")
+	}
+
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("Malformed token signature")
+	}
+
+	if err := a.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	return claims, a.verifyClaims(claims)
+}
+
+/*
+decodeJWTPart decodes the header or the claims of a token.
+*/
+func decodeJWTPart(part string, v interface{}) error {
+
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err == nil {
+		err = json.Unmarshal(data, v)
+	}
+
+	if err != nil {
+		return errors.New("Malformed token")
+	}
+
+	return nil
+}
+
+/*
+verifySignature checks the signature of a token. The key type must match the
+algorithm of the token.
+*/
+func (a *JWTAuthenticator) verifySignature(alg string, kid string, signed string, sig []byte) error {
+	var hash crypto.Hash
+
+	if len(alg) == 5 {
+		switch alg[2:] {
+		case "256":
+			hash = crypto.SHA256
+		case "384":
+			hash = crypto.SHA384
+		case "512":
+			hash = crypto.SHA512
+		}
+	}
+
+	if hash == 0 {
+		return fmt.Errorf("Unsupported algorithm: %v", alg)
+	}
+
+	if strings.HasPrefix(alg, "HS") && a.config.HMACKey != nil {
+		var mac = hmac.New(sha256.New, a.config.HMACKey)
+
+		if hash == crypto.SHA384 {
+			mac = hmac.New(sha512.New384, a.config.HMACKey)
+		} else if hash == crypto.SHA512 {
+			mac = hmac.New(sha512.New, a.config.HMACKey)
+		}
+
+		mac.Write([]byte(signed))
+
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return errors.New("Invalid signature")
+		}
+
+		return nil
+
+	} else if strings.HasPrefix(alg, "RS") {
+
+		key := a.config.RSAKey
+
+		if a.config.FetchJWKS != nil {
+			var err error
+
+			if key, err = a.jwksKey(kid); err != nil {
+				return err
+			}
+		}
+
+		if key != nil {
+			h := hash.New()
+			h.Write([]byte(signed))
+
+			if rsa.VerifyPKCS1v15(key, hash, h.Sum(nil), sig) != nil {
+				return errors.New("Invalid signature")
+			}
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("No key for algorithm: %v", alg)
+}
+
+/*
+jwksKey returns the key of the JWKS with a given key id. The keys are fetched
+again if the key id is unknown.
+*/
+func (a *JWTAuthenticator) jwksKey(kid string) (*rsa.PublicKey, error) {
+	a.keysLock.Lock()
+	defer a.keysLock.Unlock()
+
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+
+	// Keys might have been rotated - fetch them again (but not too often)
+
+	if now := a.now(); a.keys == nil || now.Sub(a.fetched) >= JWKSMinRefetchTime {
+
+		data, err := a.config.FetchJWKS()
+		if err != nil {
+			return nil, err
+		}
+
+		keys, err := parseJWKS(data)
+		if err != nil {
+			return nil, err
+		}
+
+		a.keys = keys
+		a.fetched = now
+	}
+
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("Unknown key id: %v", kid)
+}
+
+/*
+parseJWKS parses the RSA keys of a JSON Web Key Set. Other keys are ignored.
+*/
+func parseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("Could not parse JWKS: %v", err)
+	}
+
+	ret := make(map[string]*rsa.PublicKey)
+
+	for _, k := range jwks.Keys {
+
+		if k.Kty != "RSA" {
+			continue
+		}
+
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+
+		if err1 != nil || err2 != nil || len(e) > 4 {
+			return nil, fmt.Errorf("Could not parse JWKS: Invalid key %v", k.Kid)
+		}
+
+		ret[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	return ret, nil
+}
+
+/*
+verifyClaims checks the expiry, not before, issuer and audience claims of a
+token.
+*/
+func (a *JWTAuthenticator) verifyClaims(claims map[string]interface{}) error {
+
+	now := a.now()
+	skew := a.config.ClockSkew
+
+	if exp, ok := claims["exp"].(float64); ok && now.Add(-skew).After(time.Unix(int64(exp), 0)) {
+		return errors.New("Token has expired")
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(skew).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("Token is not yet valid")
+	}
+
+	if iss := a.config.Issuer; iss != "" && claims["iss"] != iss {
+		return fmt.Errorf("Unexpected issuer: %v", claims["iss"])
+	}
+
+	if aud := a.config.Audience; aud != "" {
+		found := claims["aud"] == aud
+
+		if auds, ok := claims["aud"].([]interface{}); ok {
+			for _, a := range auds {
+				found = found || a == aud
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("Unexpected audience: %v", claims["aud"])
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,280 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+/*
+signTestToken creates a signed token with a given header and claims.
+*/
+func signTestToken(header map[string]interface{}, claims map[string]interface{}, key interface{}) string {
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+
+	var sig []byte
+
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		hash := sha256.Sum256([]byte(signed))
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hash[:])
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+/*
+testJWKS creates a JSON Web Key Set for given keys.
+*/
+func testJWKS(keys map[string]*rsa.PrivateKey) []byte {
+	var jwks []map[string]interface{}
+
+	for kid, k := range keys {
+		jwks = append(jwks, map[string]interface{}{
+			"kty": "RSA",
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		})
+	}
+
+	ret, _ := json.Marshal(map[string]interface{}{"keys": jwks})
+
+	return ret
+}
+
+func TestJWTAuthentication(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Unix(1500000000, 0)
+
+	if _, err := NewJWTAuthenticator(JWTConfig{}); err == nil ||
+		err.Error() != "JWT authentication needs a HMAC key, a RSA key or a JWKS" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	a, _ := NewJWTAuthenticator(JWTConfig{
+		HMACKey:   secret,
+		Issuer:    "idp",
+		Audience:  "eliasdb",
+		ClockSkew: 10 * time.Second,
+		Write:     "write",
+	})
+	a.now = func() time.Time { return now }
+
+	if c := a.Challenge(); c != "Bearer" {
+		t.Error("Unexpected result:", c)
+		return
+	}
+
+	auth := func(token string) string {
+		r := httptest.NewRequest("GET", "/", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		p, err := a.Authenticate(r)
+		if err != nil {
+			return err.Error()
+		}
+
+		return fmt.Sprint(*p)
+	}
+
+	hs256 := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		ret := map[string]interface{}{
+			"sub": "john",
+			"iss": "idp",
+			"aud": []string{"other", "eliasdb"},
+			"exp": now.Unix() + 60,
+			"nbf": now.Unix() - 60,
+		}
+		for k, v := range extra {
+			ret[k] = v
+		}
+		return ret
+	}
+
+	// Roles and scopes are part of the principal - tokens without the
+	// write scope are only allowed to read
+
+	if res := auth(signTestToken(hs256, claims(map[string]interface{}{
+		"roles": []string{"admin"}, "scope": "read write"}), secret)); res != "{john [admin read write] false}" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := auth(signTestToken(hs256, claims(map[string]interface{}{
+		"scope": "read"}), secret)); res != "{john [read] true}" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Expiry and not before times are checked with the clock skew tolerance
+
+	if res := auth(signTestToken(hs256, claims(map[string]interface{}{
+		"exp": now.Unix() - 5}), secret)); res != "{john [] true}" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := auth(signTestToken(hs256, claims(map[string]interface{}{
+		"exp": now.Unix() - 20}), secret)); res != "Invalid credentials: Token has expired" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := auth(signTestToken(hs256, claims(map[string]interface{}{
+		"nbf": now.Unix() + 20}), secret)); res != "Invalid credentials: Token is not yet valid" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Test error cases
+
+	if res := auth(""); res != "Missing credentials" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := auth("a.b"); res != "Invalid credentials: Malformed token" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := auth(signTestToken(hs256, claims(nil), []byte("foo"))); res != "Invalid credentials: Invalid signature" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := auth(signTestToken(map[string]interface{}{"alg": "none"}, claims(nil), nil)); res != "Invalid credentials: Unsupported algorithm: none" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := auth(signTestToken(hs256, claims(map[string]interface{}{
+		"iss": "foo"}), secret)); res != "Invalid credentials: Unexpected issuer: foo" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := auth(signTestToken(hs256, claims(map[string]interface{}{
+		"aud": "foo"}), secret)); res != "Invalid credentials: Unexpected audience: foo" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// RSA tokens cannot be verified with a HMAC key
+
+	key1, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	if res := auth(signTestToken(map[string]interface{}{"alg": "RS256"}, claims(nil), key1)); res != "Invalid credentials: No key for algorithm: RS256" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestJWTAuthenticationJWKS(t *testing.T) {
+	key1, _ := rsa.GenerateKey(rand.Reader, 1024)
+	key2, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	keys := map[string]*rsa.PrivateKey{"key1": key1}
+	fetches := 0
+
+	a, _ := NewJWTAuthenticator(JWTConfig{
+		FetchJWKS: func() ([]byte, error) {
+			fetches++
+			return testJWKS(keys), nil
+		},
+		Subject: "client",
+	})
+
+	now := time.Now()
+	a.now = func() time.Time { return now }
+
+	auth := func(kid string, key *rsa.PrivateKey) string {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+signTestToken(
+			map[string]interface{}{"alg": "RS256", "kid": kid},
+			map[string]interface{}{"client": "app", "roles": []string{"a", "b"}}, key))
+
+		p, err := a.Authenticate(r)
+		if err != nil {
+			return err.Error()
+		}
+
+		return fmt.Sprint(*p)
+	}
+
+	if res := auth("key1", key1); res != "{app [a b] false}" || fetches != 1 {
+		t.Error("Unexpected result:", res, fetches)
+		return
+	}
+
+	if res := auth("key1", key2); res != "Invalid credentials: Invalid signature" || fetches != 1 {
+		t.Error("Unexpected result:", res, fetches)
+		return
+	}
+
+	// Rotated keys are only fetched again after some time
+
+	keys = map[string]*rsa.PrivateKey{"key1": key1, "key2": key2}
+
+	if res := auth("key2", key2); res != "Invalid credentials: Unknown key id: key2" || fetches != 1 {
+		t.Error("Unexpected result:", res, fetches)
+		return
+	}
+
+	now = now.Add(JWKSMinRefetchTime)
+
+	if res := auth("key2", key2); res != "{app [a b] false}" || fetches != 2 {
+		t.Error("Unexpected result:", res, fetches)
+		return
+	}
+
+	if res := auth("key1", key1); res != "{app [a b] false}" || fetches != 2 {
+		t.Error("Unexpected result:", res, fetches)
+		return
+	}
+
+	// Test error cases
+
+	a, _ = NewJWTAuthenticator(JWTConfig{
+		FetchJWKS: func() ([]byte, error) {
+			return []byte("{"), nil
+		},
+	})
+
+	if res := auth("key1", key1); res != "Invalid credentials: Could not parse JWKS: unexpected end of JSON input" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
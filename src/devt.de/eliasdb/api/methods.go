@@ -0,0 +1,173 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+/*
+handlerMethods maps HTTP methods to the Handle methods of endpoint handlers.
+*/
+var handlerMethods = []struct {
+	method  string // HTTP method
+	handler string // Name of the handler method
+}{
+	{"GET", "HandleGET"},
+	{"POST", "HandlePOST"},
+	{"PUT", "HandlePUT"},
+	{"DELETE", "HandleDELETE"},
+}
+
+/*
+endpointMethodCache holds the supported methods of endpoint handler types.
+*/
+var endpointMethodCache = &sync.Map{}
+
+/*
+endpointMethods returns the HTTP methods which are supported by an endpoint
+handler. A method is supported if the handler declares its own Handle method.
+Methods which are promoted from an embedded DefaultEndpointHandler are
+compiler generated wrappers without a source file and are not supported - a
+method is supported if its source cannot be determined. PATCH is supported if
+the handler implements PatchEndpointHandler. HEAD is supported if GET is
+supported and OPTIONS is always supported.
+*/
+func endpointMethods(handler RestEndpointHandler) map[string]bool {
+	t := reflect.TypeOf(handler)
+
+	if methods, ok := endpointMethodCache.Load(t); ok {
+		return methods.(map[string]bool)
+	}
+
+	methods := map[string]bool{"OPTIONS": true}
+
+	for _, hm := range handlerMethods {
+		if m, ok := t.MethodByName(hm.handler); ok {
+			f := runtime.FuncForPC(m.Func.Pointer())
+
+			if f == nil {
+				methods[hm.method] = true
+			} else if file, _ := f.FileLine(f.Entry()); file != "<autogenerated>" {
+				methods[hm.method] = true
+			}
+		}
+	}
+
+	if _, ok := handler.(PatchEndpointHandler); ok {
+		methods["PATCH"] = true
+	}
+
+	if methods["GET"] {
+		methods["HEAD"] = true
+	}
+
+	endpointMethodCache.Store(t, methods)
+
+	return methods
+}
+
+/*
+allowHeader returns the value of an Allow header for a set of methods.
+*/
+func allowHeader(methods map[string]bool) string {
+	var ret string
+
+	for _, m := range []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"} {
+		if methods[m] {
+			if ret != "" {
+				ret += ", "
+			}
+			ret += m
+		}
+	}
+
+	return ret
+}
+
+/*
+headResponseWriter discards the body of a response to a HEAD request. The
+status and headers are sent once the handler returns - the Content-Length
+header is set to the length of the discarded body. A flush sends the status
+and headers immediately (e.g. for streamed responses).
+*/
+type headResponseWriter struct {
+	http.ResponseWriter
+	code   int  // Status code of the response
+	length int  // Length of the discarded body
+	sent   bool // Flag if the status and headers were sent
+}
+
+/*
+WriteHeader stores the status code of the response.
+*/
+func (hw *headResponseWriter) WriteHeader(code int) {
+	if hw.code == 0 {
+		hw.code = code
+	}
+}
+
+/*
+Write discards data of the response body. The content type is detected from
+the data if it was not set (as it would be for the response to a GET request).
+*/
+func (hw *headResponseWriter) Write(data []byte) (int, error) {
+	hw.WriteHeader(http.StatusOK)
+
+	if _, ok := hw.Header()["Content-Type"]; !ok && !hw.sent && len(data) > 0 {
+		hw.Header().Set("Content-Type", http.DetectContentType(data))
+	}
+
+	hw.length += len(data)
+	return len(data), nil
+}
+
+/*
+Flush sends the status and headers of the response.
+*/
+func (hw *headResponseWriter) Flush() {
+	hw.send(false)
+
+	if f, ok := hw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+/*
+close sends the status and headers of the response if they were not sent yet.
+*/
+func (hw *headResponseWriter) close() {
+	hw.send(true)
+}
+
+/*
+send sends the status and headers of the response.
+*/
+func (hw *headResponseWriter) send(complete bool) {
+
+	if hw.sent {
+		return
+	}
+
+	hw.sent = true
+	hw.WriteHeader(http.StatusOK)
+
+	if complete && hw.code != http.StatusNoContent && hw.code != http.StatusNotModified &&
+		hw.code >= http.StatusOK && hw.Header().Get("Content-Length") == "" {
+		hw.Header().Set("Content-Length", strconv.Itoa(hw.length))
+	}
+
+	hw.ResponseWriter.WriteHeader(hw.code)
+}
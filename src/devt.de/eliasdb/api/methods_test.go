@@ -0,0 +1,145 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type methodsTestEndpoint struct {
+	*DefaultEndpointHandler
+}
+
+/*
+HandleGET writes a response with a given body - the response is flushed
+before the body is written if requested.
+*/
+func (te *methodsTestEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
+
+	w.Header().Set("ETag", `"123"`)
+
+	if len(resources) > 1 {
+		w.(http.Flusher).Flush()
+	}
+
+	w.Write([]byte(strings.Repeat("a", 5000) + resources[0]))
+}
+
+/*
+HandleDELETE does nothing.
+*/
+func (te *methodsTestEndpoint) HandleDELETE(w http.ResponseWriter, r *http.Request, resources []string) {
+}
+
+func (te *methodsTestEndpoint) SwaggerDefs(s map[string]interface{}) {
+}
+
+type patchTestEndpoint struct {
+	*DefaultEndpointHandler
+}
+
+/*
+HandlePATCH does nothing.
+*/
+func (te *patchTestEndpoint) HandlePATCH(w http.ResponseWriter, r *http.Request, resources []string) {
+}
+
+func (te *patchTestEndpoint) SwaggerDefs(s map[string]interface{}) {
+}
+
+func TestEndpointMethods(t *testing.T) {
+
+	// Capture the registered handlers
+
+	handlers := make(map[string]func(http.ResponseWriter, *http.Request))
+
+	oldHandleFunc := HandleFunc
+	HandleFunc = func(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+		handlers[pattern] = handler
+	}
+	defer func() {
+		HandleFunc = oldHandleFunc
+	}()
+
+	RegisterRestEndpoints(map[string]RestEndpointInst{
+		"/methodstest/": func() RestEndpointHandler {
+			return &methodsTestEndpoint{}
+		},
+	})
+
+	send := func(method string, url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers["/methodstest/"](w, httptest.NewRequest(method, url, nil))
+		return w
+	}
+
+	// Only overridden handler methods are supported
+
+	if res := allowHeader(endpointMethods(&methodsTestEndpoint{})); res != "GET, HEAD, DELETE, OPTIONS" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := allowHeader(endpointMethods(AboutEndpointInst())); res != "GET, HEAD, OPTIONS" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := allowHeader(endpointMethods(RateLimitsEndpointInst())); res != "GET, HEAD, PUT, OPTIONS" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// PATCH is supported by handlers which implement PatchEndpointHandler
+
+	if res := allowHeader(endpointMethods(&patchTestEndpoint{})); res != "PATCH, OPTIONS" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	w := send("OPTIONS", "/methodstest/foo")
+
+	if res := fmt.Sprint(w.Code, " ", w.Header().Get("Allow"), " ", w.Body.Len()); res != "204 GET, HEAD, DELETE, OPTIONS 0" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	w = send("POST", "/methodstest/foo")
+
+	if res := fmt.Sprint(w.Code, " ", w.Header().Get("Allow"), " ", strings.TrimSpace(w.Body.String())); res != "405 GET, HEAD, DELETE, OPTIONS Method Not Allowed" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// HEAD requests get the headers of GET requests without a body
+
+	get := send("GET", "/methodstest/foo")
+	head := send("HEAD", "/methodstest/foo")
+
+	if res := fmt.Sprint(head.Code, " ", head.Header().Get("ETag"), " ", head.Header().Get("Content-Length"), " ",
+		head.Header().Get("Content-Type"), " ", head.Body.Len()); res != "200 \"123\" 5003 "+get.Header().Get("Content-Type")+" 0" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Flushed responses have no Content-Length
+
+	head = send("HEAD", "/methodstest/foo/flush")
+
+	if res := fmt.Sprint(head.Code, " ", head.Flushed, " ", head.Header().Get("Content-Length"), " ", head.Body.Len()); res != "200 true  0" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
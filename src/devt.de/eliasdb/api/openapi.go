@@ -0,0 +1,284 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/*
+OpenAPIVersion is the version of the OpenAPI specification of the API
+description.
+*/
+const OpenAPIVersion = "3.0.3"
+
+/*
+EndpointDescriber is implemented by endpoint handlers which describe their
+operations in the API description (see OpenAPISpec).
+*/
+type EndpointDescriber interface {
+
+	/*
+		Describe returns the descriptions of the paths which are handled by
+		the endpoint.
+	*/
+	Describe() []*EndpointDescription
+}
+
+/*
+EndpointDescription describes the operations of an endpoint on a path.
+*/
+type EndpointDescription struct {
+	Path        string                  // Path pattern e.g. /db/v1/graph/{partition}
+	Methods     []string                // Described methods (all supported methods if empty)
+	Summary     string                  // Short summary of the operations
+	Description string                  // Description of the operations
+	Parameters  []*ParameterDescription // Parameters of the operations
+	Responses   []*ResponseDescription  // Responses of the operations
+}
+
+/*
+ParameterDescription describes a parameter of an operation.
+*/
+type ParameterDescription struct {
+	Name        string // Name of the parameter
+	In          string // Location of the parameter (path, query or header)
+	Description string // Description of the parameter
+	Required    bool   // Flag if the parameter is required (path parameters always are)
+	Type        string // Type of the parameter (string, integer, number or boolean)
+}
+
+/*
+ResponseDescription describes a response of an operation.
+*/
+type ResponseDescription struct {
+	Status      int                    // Status code of the response
+	Description string                 // Description of the response
+	ContentType string                 // Content type of the response (no content if empty)
+	Schema      map[string]interface{} // Schema of the response (optional)
+}
+
+/*
+pathParamPattern matches the parameters of a path pattern.
+*/
+var pathParamPattern = regexp.MustCompile(`{([^}/]+)}`)
+
+/*
+OpenAPISpec assembles an OpenAPI description of all registered endpoints.
+Endpoints which do not describe themselves (see EndpointDescriber) are
+described by their URL and the methods they support.
+*/
+func OpenAPISpec() map[string]interface{} {
+	var urls []string
+
+	for url := range registered {
+		urls = append(urls, url)
+	}
+
+	sort.Strings(urls)
+
+	paths := make(map[string]interface{})
+
+	for _, url := range urls {
+		handler := registered[url]()
+		methods := endpointMethods(handler)
+
+		var descs []*EndpointDescription
+
+		if d, ok := handler.(EndpointDescriber); ok {
+			descs = d.Describe()
+		}
+
+		if len(descs) == 0 {
+			descs = []*EndpointDescription{{Path: strings.TrimSuffix(url, "/")}}
+		}
+
+		for _, desc := range descs {
+			path, ok := paths[desc.Path].(map[string]interface{})
+			if !ok {
+				path = make(map[string]interface{})
+				paths[desc.Path] = path
+			}
+
+			for _, m := range describedMethods(desc, methods) {
+				path[strings.ToLower(m)] = openAPIOperation(desc)
+			}
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": OpenAPIVersion,
+		"info": map[string]interface{}{
+			"title":       "EliasDB API",
+			"description": "Query and modify the EliasDB datastore.",
+			"version":     APIVersion,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"code", "message"},
+					"properties": map[string]interface{}{
+						"code": map[string]interface{}{
+							"type": "integer",
+						},
+						"message": map[string]interface{}{
+							"type": "string",
+						},
+						"details": map[string]interface{}{},
+					},
+				},
+			},
+		},
+	}
+}
+
+/*
+describedMethods returns the methods of a description which are supported by
+an endpoint handler.
+*/
+func describedMethods(desc *EndpointDescription, supported map[string]bool) []string {
+	var ret []string
+
+	for _, hm := range []string{"GET", "POST", "PUT", "PATCH", "DELETE"} {
+		if !supported[hm] {
+			continue
+		}
+
+		if desc.Methods == nil {
+			ret = append(ret, hm)
+			continue
+		}
+
+		for _, m := range desc.Methods {
+			if strings.EqualFold(m, hm) {
+				ret = append(ret, hm)
+				break
+			}
+		}
+	}
+
+	return ret
+}
+
+/*
+openAPIOperation returns the OpenAPI operation object of a description.
+Parameters of the path pattern which are not described are added. A success
+response and the error response are added if they are not described.
+*/
+func openAPIOperation(desc *EndpointDescription) map[string]interface{} {
+	op := make(map[string]interface{})
+
+	if desc.Summary != "" {
+		op["summary"] = desc.Summary
+	}
+
+	if desc.Description != "" {
+		op["description"] = desc.Description
+	}
+
+	params := []interface{}{}
+	described := make(map[string]bool)
+
+	for _, p := range desc.Parameters {
+		typ := p.Type
+		if typ == "" {
+			typ = "string"
+		}
+
+		param := map[string]interface{}{
+			"name":     p.Name,
+			"in":       p.In,
+			"required": p.Required || p.In == "path",
+			"schema": map[string]interface{}{
+				"type": typ,
+			},
+		}
+
+		if p.Description != "" {
+			param["description"] = p.Description
+		}
+
+		params = append(params, param)
+		described[p.In+":"+p.Name] = true
+	}
+
+	for _, m := range pathParamPattern.FindAllStringSubmatch(desc.Path, -1) {
+		if !described["path:"+m[1]] {
+			params = append(params, map[string]interface{}{
+				"name":     m[1],
+				"in":       "path",
+				"required": true,
+				"schema": map[string]interface{}{
+					"type": "string",
+				},
+			})
+			described["path:"+m[1]] = true
+		}
+	}
+
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	responses := make(map[string]interface{})
+
+	for _, r := range desc.Responses {
+		resp := map[string]interface{}{
+			"description": r.Description,
+		}
+
+		if r.ContentType != "" {
+			schema := r.Schema
+			if schema == nil {
+				schema = map[string]interface{}{}
+			}
+
+			resp["content"] = map[string]interface{}{
+				r.ContentType: map[string]interface{}{
+					"schema": schema,
+				},
+			}
+		}
+
+		responses[fmt.Sprint(r.Status)] = resp
+	}
+
+	if len(responses) == 0 {
+		responses["200"] = map[string]interface{}{
+			"description": "Successful response",
+		}
+	}
+
+	responses["default"] = map[string]interface{}{
+		"description": "Error response (a JSON object if the request accepts application/json)",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": map[string]interface{}{
+					"$ref": "#/components/schemas/Error",
+				},
+			},
+			"text/plain": map[string]interface{}{
+				"schema": map[string]interface{}{
+					"type": "string",
+				},
+			},
+		},
+	}
+
+	op["responses"] = responses
+
+	return op
+}
@@ -0,0 +1,82 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+type describedTestEndpoint struct {
+	*DefaultEndpointHandler
+}
+
+func (te *describedTestEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
+}
+
+func (te *describedTestEndpoint) HandleDELETE(w http.ResponseWriter, r *http.Request, resources []string) {
+}
+
+func (te *describedTestEndpoint) SwaggerDefs(s map[string]interface{}) {
+}
+
+func (te *describedTestEndpoint) Describe() []*EndpointDescription {
+	return []*EndpointDescription{{
+		Path:    "/describedtest/{part}/{key}",
+		Methods: []string{"get", "POST"},
+		Summary: "Test",
+		Parameters: []*ParameterDescription{
+			{"key", "path", "Key", false, ""},
+			{"limit", "query", "", false, "integer"},
+		},
+		Responses: []*ResponseDescription{{404, "Not found", "", nil}},
+	}}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+
+	oldHandleFunc := HandleFunc
+	HandleFunc = func(pattern string, handler func(http.ResponseWriter, *http.Request)) {}
+	defer func() {
+		HandleFunc = oldHandleFunc
+		delete(registered, "/describedtest/")
+	}()
+
+	RegisterRestEndpoints(map[string]RestEndpointInst{
+		"/describedtest/": func() RestEndpointHandler {
+			return &describedTestEndpoint{}
+		},
+	})
+
+	spec := OpenAPISpec()
+
+	if spec["openapi"] != OpenAPIVersion {
+		t.Error("Unexpected result:", spec)
+		return
+	}
+
+	// Only described methods which are supported are included - undescribed
+	// path parameters are added and path parameters are always required
+
+	res, _ := json.Marshal(spec["paths"].(map[string]interface{})["/describedtest/{part}/{key}"])
+
+	if string(res) != `{"get":{"parameters":[`+
+		`{"description":"Key","in":"path","name":"key","required":true,"schema":{"type":"string"}},`+
+		`{"in":"query","name":"limit","required":false,"schema":{"type":"integer"}},`+
+		`{"in":"path","name":"part","required":true,"schema":{"type":"string"}}],`+
+		`"responses":{"404":{"description":"Not found"},"default":{"content":{"application/json":`+
+		`{"schema":{"$ref":"#/components/schemas/Error"}},"text/plain":{"schema":{"type":"string"}}},`+
+		`"description":"Error response (a JSON object if the request accepts application/json)"}},"summary":"Test"}}` {
+		t.Error("Unexpected result:", string(res))
+		return
+	}
+}
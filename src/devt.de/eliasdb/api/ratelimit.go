@@ -0,0 +1,388 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Limiter is the rate limiter which checks all requests after they were
+authenticated (nil if requests are not rate limited).
+*/
+var Limiter *RateLimiter
+
+/*
+Rate classes of requests
+*/
+const (
+	RateClassRead  = "read"
+	RateClassWrite = "write"
+	RateClassQuery = "query"
+)
+
+/*
+RateClassEndpoints contains the rate class of endpoint URLs which do not use
+the default classes (RateClassRead for GET and HEAD requests and
+RateClassWrite for all other requests).
+*/
+var RateClassEndpoints = map[string]string{}
+
+/*
+Rate is the allowed rate of requests of a single client.
+*/
+type Rate struct {
+	PerSecond float64 `json:"per_second"` // Number of requests per second in the long run
+	Burst     int     `json:"burst"`      // Number of requests which can be sent at once
+}
+
+/*
+rateLimitShards is the number of shards of the buckets of a rate limiter.
+*/
+const rateLimitShards = 32
+
+/*
+rateLimitSweepTime is the time after which idle buckets of a shard are
+removed.
+*/
+const rateLimitSweepTime = time.Minute
+
+/*
+RateLimiter limits the rate of requests per client and rate class with token
+buckets. Buckets are kept in a sharded map so concurrent requests of different
+clients do not contend for the same lock.
+*/
+type RateLimiter struct {
+	rates  atomic.Value                     // Rates by rate class (map[string]Rate)
+	shards [rateLimitShards]*rateLimitShard // Shards of all buckets
+	now    func() time.Time                 // Function which returns the current time
+}
+
+/*
+rateLimitShard is a shard of the buckets of a rate limiter.
+*/
+type rateLimitShard struct {
+	buckets map[string]*tokenBucket // Buckets by rate class and client
+	swept   time.Time               // Time of the last removal of idle buckets
+	lock    *sync.Mutex             // Lock for the buckets
+}
+
+/*
+tokenBucket is the token bucket of a client. Each request takes a token and
+tokens are added at a constant rate up to the burst size.
+*/
+type tokenBucket struct {
+	tokens float64   // Available tokens
+	last   time.Time // Time when the tokens were last updated
+}
+
+/*
+NewRateLimiter creates a new rate limiter for given rates by rate class.
+Requests of classes without a rate are not limited.
+*/
+func NewRateLimiter(rates map[string]Rate) *RateLimiter {
+	ret := &RateLimiter{now: time.Now}
+
+	for i := range ret.shards {
+		ret.shards[i] = &rateLimitShard{make(map[string]*tokenBucket), time.Time{}, &sync.Mutex{}}
+	}
+
+	ret.SetRates(rates)
+
+	return ret
+}
+
+/*
+Rates returns the current rates by rate class.
+*/
+func (rl *RateLimiter) Rates() map[string]Rate {
+	ret := make(map[string]Rate)
+
+	for class, rate := range rl.rates.Load().(map[string]Rate) {
+		ret[class] = rate
+	}
+
+	return ret
+}
+
+/*
+SetRates replaces the rates of given rate classes. A rate of 0 removes the
+limit of a class. Rates can be changed while requests are checked.
+*/
+func (rl *RateLimiter) SetRates(rates map[string]Rate) error {
+	newRates := make(map[string]Rate)
+
+	if old, ok := rl.rates.Load().(map[string]Rate); ok {
+		for class, rate := range old {
+			newRates[class] = rate
+		}
+	}
+
+	for class, rate := range rates {
+		if rate.PerSecond < 0 || rate.Burst < 0 || rate.PerSecond > 0 && rate.Burst == 0 {
+			return fmt.Errorf("Invalid rate for class %v: Rate and burst must be positive", class)
+		}
+	}
+
+	for class, rate := range rates {
+		if rate.PerSecond == 0 {
+			delete(newRates, class)
+		} else {
+			newRates[class] = rate
+		}
+	}
+
+	rl.rates.Store(newRates)
+
+	return nil
+}
+
+/*
+Allow checks if a client may send a request of a given rate class. Returns
+the time after which the client may try again if the request is not allowed.
+*/
+func (rl *RateLimiter) Allow(class string, client string) (bool, time.Duration) {
+
+	rate, ok := rl.rates.Load().(map[string]Rate)[class]
+	if !ok {
+		return true, 0
+	}
+
+	key := class + "\x00" + client
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	shard := rl.shards[h.Sum32()%rateLimitShards]
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	now := rl.now()
+
+	// Remove idle buckets from time to time - an idle bucket is the same
+	// as a full bucket
+
+	if now.Sub(shard.swept) > rateLimitSweepTime {
+		for k, b := range shard.buckets {
+			if now.Sub(b.last) > rateLimitSweepTime {
+				delete(shard.buckets, k)
+			}
+		}
+		shard.swept = now
+	}
+
+	b, ok := shard.buckets[key]
+	if !ok {
+		b = &tokenBucket{float64(rate.Burst), now}
+		shard.buckets[key] = b
+	}
+
+	// Add the tokens since the last request
+
+	b.tokens = math.Min(float64(rate.Burst), b.tokens+now.Sub(b.last).Seconds()*rate.PerSecond)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := (1 - b.tokens) / rate.PerSecond
+		return false, time.Duration(wait * float64(time.Second))
+	}
+
+	b.tokens--
+
+	return true, 0
+}
+
+/*
+limitRate checks the rate of a request for a given endpoint URL with the
+configured rate limiter. Clients are identified by their principal or their
+address. Writes an error response and returns false if the request is not
+allowed.
+*/
+func limitRate(w http.ResponseWriter, r *http.Request, url string) bool {
+
+	limiter := Limiter
+
+	if limiter == nil {
+		return true
+	}
+
+	class, ok := RateClassEndpoints[url]
+	if !ok {
+		class = RateClassWrite
+		if !isWriteRequest(r) {
+			class = RateClassRead
+		}
+	}
+
+	client := "p:"
+
+	if p := PrincipalFromContext(r.Context()); p != nil {
+		client += p.Name
+	} else {
+		client = "a:"
+
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			client += host
+		} else {
+			client += r.RemoteAddr
+		}
+	}
+
+	if ok, wait := limiter.Allow(class, client); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeAuthError(w, r, "Rate limit exceeded", http.StatusTooManyRequests)
+		return false
+	}
+
+	return true
+}
+
+/*
+EndpointRateLimits is the rate limits endpoint URL (rooted). Handles admin/ratelimits/
+*/
+const EndpointRateLimits = APIRoot + "/admin/ratelimits/"
+
+/*
+RateLimitsEndpointInst creates a new endpoint handler.
+*/
+func RateLimitsEndpointInst() RestEndpointHandler {
+	return &rateLimitsEndpoint{}
+}
+
+/*
+Handler object for rate limit operations.
+*/
+type rateLimitsEndpoint struct {
+	*DefaultEndpointHandler
+}
+
+/*
+HandleGET returns the current rates by rate class.
+*/
+func (re *rateLimitsEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
+
+	if !CheckAdmin(w, r) {
+		return
+	} else if Limiter == nil {
+		WriteError(w, r, "Rate limiting is not enabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+
+	json.NewEncoder(w).Encode(Limiter.Rates())
+}
+
+/*
+HandlePUT changes the rates of the rate classes in the request body.
+*/
+func (re *rateLimitsEndpoint) HandlePUT(w http.ResponseWriter, r *http.Request, resources []string) {
+	var rates map[string]Rate
+
+	if !CheckAdmin(w, r) {
+		return
+	} else if Limiter == nil {
+		WriteError(w, r, "Rate limiting is not enabled", http.StatusNotFound)
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&rates); err != nil {
+		WriteBodyError(w, r, "Could not decode request body as object with rates", err)
+		return
+	}
+
+	if err := Limiter.SetRates(rates); err != nil {
+		WriteError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	re.HandleGET(w, r, resources)
+}
+
+/*
+SwaggerDefs is used to describe the endpoint in swagger.
+*/
+func (re *rateLimitsEndpoint) SwaggerDefs(s map[string]interface{}) {
+
+	rates := map[string]interface{}{
+		"description": "Rates by rate class (read, write or query).",
+		"type":        "object",
+		"additionalProperties": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"per_second": map[string]interface{}{
+					"description": "Number of requests per second in the long run (0 removes the limit).",
+					"type":        "number",
+				},
+				"burst": map[string]interface{}{
+					"description": "Number of requests which can be sent at once.",
+					"type":        "integer",
+				},
+			},
+		},
+	}
+
+	responses := map[string]interface{}{
+		"200": map[string]interface{}{
+			"description": "Current rates by rate class.",
+			"schema":      rates,
+		},
+		"default": map[string]interface{}{
+			"description": "Error response",
+			"schema": map[string]interface{}{
+				"$ref": "#/definitions/Error",
+			},
+		},
+	}
+
+	s["paths"].(map[string]interface{})["/admin/ratelimits"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary":     "Return the rate limits of the REST API.",
+			"description": "Returns the allowed rates of requests per client by rate class. Needs a client with the admin role.",
+			"produces": []string{
+				"text/plain",
+				"application/json",
+			},
+			"responses": responses,
+		},
+		"put": map[string]interface{}{
+			"summary":     "Change the rate limits of the REST API.",
+			"description": "Changes the allowed rates of the given rate classes. Needs a client with the admin role.",
+			"consumes": []string{
+				"application/json",
+			},
+			"produces": []string{
+				"text/plain",
+				"application/json",
+			},
+			"parameters": []map[string]interface{}{
+				{
+					"name":        "rates",
+					"in":          "body",
+					"description": "Rates by rate class.",
+					"required":    true,
+					"schema":      rates,
+				},
+			},
+			"responses": responses,
+		},
+	}
+}
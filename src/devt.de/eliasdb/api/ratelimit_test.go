@@ -0,0 +1,332 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+
+	rl := NewRateLimiter(map[string]Rate{
+		RateClassRead:  {2, 3},
+		RateClassQuery: {1, 1},
+	})
+	rl.now = func() time.Time { return now }
+
+	allow := func(class string, client string) string {
+		ok, wait := rl.Allow(class, client)
+		return fmt.Sprint(ok, " ", wait)
+	}
+
+	// The burst is allowed at once
+
+	for i := 0; i < 3; i++ {
+		if res := allow(RateClassRead, "john"); res != "true 0s" {
+			t.Error("Unexpected result:", i, res)
+			return
+		}
+	}
+
+	if res := allow(RateClassRead, "john"); res != "false 500ms" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Other clients, other classes and classes without rate are not affected
+
+	if res := allow(RateClassRead, "mike"); res != "true 0s" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := allow(RateClassQuery, "john"); res != "true 0s" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := allow(RateClassWrite, "john"); res != "true 0s" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Tokens are added at the given rate
+
+	now = now.Add(250 * time.Millisecond)
+
+	if res := allow(RateClassRead, "john"); res != "false 250ms" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	now = now.Add(250 * time.Millisecond)
+
+	if res := allow(RateClassRead, "john"); res != "true 0s" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// In the steady state only the rate is allowed
+
+	allowed := 0
+
+	for i := 0; i < 100; i++ {
+		now = now.Add(100 * time.Millisecond)
+
+		if ok, _ := rl.Allow(RateClassRead, "john"); ok {
+			allowed++
+		}
+	}
+
+	if allowed != 20 {
+		t.Error("Unexpected result:", allowed)
+		return
+	}
+
+	// Idle clients get their full burst again
+
+	now = now.Add(time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if res := allow(RateClassRead, "john"); res != "true 0s" {
+			t.Error("Unexpected result:", i, res)
+			return
+		}
+	}
+
+	// Idle buckets are removed from a shard when it is used
+
+	for _, shard := range rl.shards {
+		if _, ok := shard.buckets[RateClassRead+"\x00john"]; ok && len(shard.buckets) != 1 {
+			t.Error("Unexpected result:", shard.buckets)
+			return
+		}
+	}
+
+	// Rates can be changed at runtime
+
+	if err := rl.SetRates(map[string]Rate{RateClassRead: {0, 0}, RateClassWrite: {10, 20}}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := fmt.Sprint(rl.Rates()); res != "map[query:{1 1} write:{10 20}]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if err := rl.SetRates(map[string]Rate{RateClassRead: {1, 0}}); err == nil ||
+		err.Error() != "Invalid rate for class read: Rate and burst must be positive" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Concurrent requests of a client never exceed its burst
+
+	rl.SetRates(map[string]Rate{RateClassRead: {1, 500}})
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+
+	allowed = 0
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(client string) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if ok, _ := rl.Allow(RateClassRead, client); ok {
+					lock.Lock()
+					allowed++
+					lock.Unlock()
+				}
+			}
+		}(fmt.Sprint("client", i%2))
+	}
+
+	wg.Wait()
+
+	if allowed != 1000 {
+		t.Error("Unexpected result:", allowed)
+		return
+	}
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if ok, _ := rl.Allow(RateClassRead, "client3"); ok {
+					lock.Lock()
+					allowed++
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if allowed != 1500 {
+		t.Error("Unexpected result:", allowed)
+		return
+	}
+}
+
+func TestRateLimiting(t *testing.T) {
+
+	// Capture the registered handlers
+
+	handlers := make(map[string]func(http.ResponseWriter, *http.Request))
+
+	oldHandleFunc := HandleFunc
+	HandleFunc = func(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+		handlers[pattern] = handler
+	}
+	defer func() {
+		HandleFunc = oldHandleFunc
+	}()
+
+	RegisterRestEndpoints(map[string]RestEndpointInst{
+		"/ratetest/": func() RestEndpointHandler {
+			return &authTestEndpoint{}
+		},
+		"/ratequery/": func() RestEndpointHandler {
+			return &authTestEndpoint{}
+		},
+	})
+	RegisterRestEndpoints(AdminEndpointMap)
+	defer delete(registered, EndpointRateLimits)
+	defer delete(registered, EndpointStorage)
+
+	RateClassEndpoints["/ratequery/"] = RateClassQuery
+	defer delete(RateClassEndpoints, "/ratequery/")
+
+	send := func(url string, method string, source string, body string, header ...string) string {
+		r := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		r.RemoteAddr = source
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+
+		w := httptest.NewRecorder()
+		handlers[url](w, r)
+
+		return fmt.Sprint(w.Code, " ", w.Header().Get("Retry-After"), " ", strings.TrimSpace(w.Body.String()))
+	}
+
+	Limiter = NewRateLimiter(map[string]Rate{
+		RateClassRead:  {0.1, 2},
+		RateClassWrite: {0.1, 1},
+		RateClassQuery: {0.1, 1},
+	})
+	defer func() {
+		Limiter = nil
+	}()
+
+	// Clients without authentication are identified by their address
+
+	for _, res := range []string{"200  get -", "200  get -", `429 10 {"error":"Rate limit exceeded"}`} {
+		if r := send("/ratetest/", "GET", "1.2.3.4:1000", ""); r != res {
+			t.Error("Unexpected result:", r)
+			return
+		}
+	}
+
+	if res := send("/ratetest/", "GET", "1.2.3.5:1000", ""); res != "200  get -" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Writes and queries have their own classes
+
+	for _, res := range []string{"200  post -", `429 10 {"error":"Rate limit exceeded"}`} {
+		if r := send("/ratetest/", "POST", "1.2.3.4:1000", ""); r != res {
+			t.Error("Unexpected result:", r)
+			return
+		}
+	}
+
+	for _, res := range []string{"200  get -", `429 10 {"error":"Rate limit exceeded"}`} {
+		if r := send("/ratequery/", "GET", "1.2.3.4:1000", ""); r != res {
+			t.Error("Unexpected result:", r)
+			return
+		}
+	}
+
+	// Authenticated clients are identified by their name
+
+	Auth, _ = NewAPIKeyAuthenticator([]*APIKey{
+		{"admin", "key1", ScopeReadWrite, []string{RoleAdmin}},
+		{"user", "key2", ScopeReadWrite, nil},
+	})
+	defer func() {
+		Auth = nil
+	}()
+
+	for _, res := range []string{"200  get admin", "200  get admin", `429 10 {"error":"Rate limit exceeded"}`} {
+		if r := send("/ratetest/", "GET", "1.2.3.4:1000", "", "X-Api-Key", "key1"); r != res {
+			t.Error("Unexpected result:", r)
+			return
+		}
+	}
+
+	if res := send("/ratetest/", "GET", "1.2.3.4:1000", "", "X-Api-Key", "key2"); res != "200  get user" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Rates can be changed by admins
+
+	Limiter.SetRates(map[string]Rate{RateClassWrite: {0, 0}})
+
+	if res := send(EndpointRateLimits, "PUT", "1.2.3.4:1000", `{"read": {"per_second": 0}}`, "X-Api-Key", "key2"); res != `403  {"error":"Client user is not an admin"}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send(EndpointRateLimits, "PUT", "1.2.3.4:1000", `{"read": {"per_second": 0}}`, "X-Api-Key", "key1"); res != `200  {"query":{"per_second":0.1,"burst":1}}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send("/ratetest/", "GET", "1.2.3.4:1000", "", "X-Api-Key", "key1"); res != "200  get admin" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send(EndpointRateLimits, "PUT", "1.2.3.4:1000", `{"read": {"per_second": -1}}`, "X-Api-Key", "key1"); res != `400  Invalid rate for class read: Rate and burst must be positive` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := send(EndpointRateLimits, "GET", "1.2.3.4:1000", "", "X-Api-Key", "key1"); res != `200  {"query":{"per_second":0.1,"burst":1}}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Admin endpoints need authentication
+
+	Auth = nil
+
+	if res := send(EndpointRateLimits, "GET", "1.2.3.4:1000", ""); res != `403  {"error":"Admin endpoints need authentication"}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
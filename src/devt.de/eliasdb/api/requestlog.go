@@ -0,0 +1,221 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"devt.de/eliasdb/graph/util"
+)
+
+/*
+HTTPHeaderRequestID is the header which contains the ID of a request. IDs of
+incoming requests are kept if they are valid.
+*/
+const HTTPHeaderRequestID = "X-Request-Id"
+
+/*
+RequestLog is the logger of all handled requests (nil if requests are not
+logged). By default requests are logged with the standard logger.
+*/
+var RequestLog RequestLogger = &StdRequestLogger{}
+
+/*
+RequestLogEntry is the log entry of a handled request.
+*/
+type RequestLogEntry struct {
+	ID       string        // ID of the request
+	Method   string        // HTTP method of the request
+	Path     string        // URL path of the request
+	Status   int           // Status code of the response
+	Duration time.Duration // Time it took to handle the request
+	Bytes    int64         // Number of bytes of the response body
+	Client   string        // Name of the authenticated client (empty if not authenticated)
+	Remote   string        // Remote address of the client
+}
+
+/*
+RequestLogger logs handled requests.
+*/
+type RequestLogger interface {
+
+	/*
+		LogRequest logs a handled request.
+	*/
+	LogRequest(e *RequestLogEntry)
+}
+
+/*
+StdRequestLogger logs requests with a logger of the standard library.
+*/
+type StdRequestLogger struct {
+	Logger *log.Logger // Logger which is used (the standard logger if nil)
+}
+
+/*
+LogRequest logs a handled request as a single line.
+*/
+func (l *StdRequestLogger) LogRequest(e *RequestLogEntry) {
+
+	client := e.Client
+	if client == "" {
+		client = "-"
+	}
+
+	msg := fmt.Sprintf("request id=%v method=%v path=%q status=%v duration=%v bytes=%v client=%q remote=%v",
+		e.ID, e.Method, e.Path, e.Status, e.Duration, e.Bytes, client, e.Remote)
+
+	if l.Logger != nil {
+		l.Logger.Print(msg)
+	} else {
+		log.Print(msg)
+	}
+}
+
+/*
+RequestIDFromContext returns the ID of a request from its context.
+*/
+func RequestIDFromContext(ctx context.Context) string {
+	return util.RequestIDFromContext(ctx)
+}
+
+/*
+loggingResponseWriter records the status code and the size of a response.
+*/
+type loggingResponseWriter struct {
+	http.ResponseWriter       // Wrapped response writer
+	status              int   // Status code of the response
+	bytes               int64 // Number of written bytes
+}
+
+/*
+WriteHeader records the status code of the response.
+*/
+func (lw *loggingResponseWriter) WriteHeader(code int) {
+	if lw.status == 0 {
+		lw.status = code
+	}
+	lw.ResponseWriter.WriteHeader(code)
+}
+
+/*
+Write records the number of written bytes.
+*/
+func (lw *loggingResponseWriter) Write(data []byte) (int, error) {
+	if lw.status == 0 {
+		lw.status = http.StatusOK
+	}
+
+	n, err := lw.ResponseWriter.Write(data)
+	lw.bytes += int64(n)
+
+	return n, err
+}
+
+/*
+Flush sends all buffered data to the client.
+*/
+func (lw *loggingResponseWriter) Flush() {
+	if f, ok := lw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+/*
+Hijack lets the caller take over the connection (e.g. for WebSockets).
+*/
+func (lw *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := lw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("Response writer does not support hijacking")
+	}
+
+	conn, brw, err := hj.Hijack()
+	if err == nil && lw.status == 0 {
+		lw.status = http.StatusSwitchingProtocols
+	}
+
+	return conn, brw, err
+}
+
+/*
+logRequest assigns an ID to a request and returns a function which logs the
+request once it was handled. The function gets the request which was finally
+handled (e.g. with the authenticated principal).
+*/
+func logRequest(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request, func(*http.Request)) {
+
+	id := r.Header.Get(HTTPHeaderRequestID)
+
+	if !validRequestID(id) {
+		b := make([]byte, 12)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+
+	w.Header().Set(HTTPHeaderRequestID, id)
+
+	r = r.WithContext(util.WithRequestID(r.Context(), id))
+
+	logger := RequestLog
+	if logger == nil {
+		return w, r, func(*http.Request) {}
+	}
+
+	lw := &loggingResponseWriter{ResponseWriter: w}
+	start := time.Now()
+
+	return lw, r, func(r *http.Request) {
+		var client string
+
+		if p := PrincipalFromContext(r.Context()); p != nil {
+			client = p.Name
+		}
+
+		status := lw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		logger.LogRequest(&RequestLogEntry{id, r.Method, r.URL.Path, status,
+			time.Since(start), lw.bytes, client, r.RemoteAddr})
+	}
+}
+
+/*
+validRequestID checks if a given request ID can be used. IDs must not be
+empty, must not be too long and may only contain letters, digits and the
+characters - _ . and : (they are written to logs).
+*/
+func validRequestID(id string) bool {
+
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+
+	return true
+}
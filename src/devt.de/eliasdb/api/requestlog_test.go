@@ -0,0 +1,148 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type requestLogTestEndpoint struct {
+	*DefaultEndpointHandler
+}
+
+/*
+HandleGET writes the request ID from the request context.
+*/
+func (te *requestLogTestEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
+	w.Write([]byte("id " + RequestIDFromContext(r.Context())))
+}
+
+func (te *requestLogTestEndpoint) SwaggerDefs(s map[string]interface{}) {
+}
+
+type testRequestLogger struct {
+	entries []*RequestLogEntry
+}
+
+func (l *testRequestLogger) LogRequest(e *RequestLogEntry) {
+	l.entries = append(l.entries, e)
+}
+
+func TestRequestLogging(t *testing.T) {
+
+	// Capture the registered handlers
+
+	handlers := make(map[string]func(http.ResponseWriter, *http.Request))
+
+	oldHandleFunc := HandleFunc
+	HandleFunc = func(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+		handlers[pattern] = handler
+	}
+	defer func() {
+		HandleFunc = oldHandleFunc
+	}()
+
+	RegisterRestEndpoints(map[string]RestEndpointInst{
+		"/logtest/": func() RestEndpointHandler {
+			return &requestLogTestEndpoint{}
+		},
+	})
+
+	logger := &testRequestLogger{}
+
+	oldRequestLog := RequestLog
+	RequestLog = logger
+	defer func() {
+		RequestLog = oldRequestLog
+	}()
+
+	send := func(method string, header ...string) (string, string) {
+		r := httptest.NewRequest(method, "/logtest/foo", nil)
+		r.RemoteAddr = "1.2.3.4:1000"
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+
+		w := httptest.NewRecorder()
+		handlers["/logtest/"](w, r)
+
+		return w.Header().Get(HTTPHeaderRequestID), fmt.Sprint(w.Code, " ", strings.TrimSpace(w.Body.String()))
+	}
+
+	// Valid request IDs of clients are kept
+
+	id, res := send("GET", "X-Request-ID", "abc-123")
+	if id != "abc-123" || res != "200 id abc-123" {
+		t.Error("Unexpected result:", id, res)
+		return
+	}
+
+	e := logger.entries[0]
+	if res := fmt.Sprint(e.ID, " ", e.Method, " ", e.Path, " ", e.Status, " ", e.Bytes, " ", e.Client, " ", e.Remote); res != "abc-123 GET /logtest/foo 200 10  1.2.3.4:1000" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Other requests get a new ID
+
+	id, res = send("GET", "X-Request-ID", "abc 123\n")
+	if len(id) != 24 || res != "200 id "+id || logger.entries[1].ID != id {
+		t.Error("Unexpected result:", id, res)
+		return
+	}
+
+	id2, _ := send("GET")
+	if len(id2) != 24 || id2 == id {
+		t.Error("Unexpected result:", id, id2)
+		return
+	}
+
+	// Errors and authenticated clients are logged
+
+	Auth, _ = NewAPIKeyAuthenticator([]*APIKey{
+		{"john", "key1", ScopeRead, nil},
+	})
+	defer func() {
+		Auth = nil
+	}()
+
+	send("POST", "X-Api-Key", "key1")
+	send("GET", "X-Api-Key", "key1")
+
+	if e := logger.entries[3]; e.Status != http.StatusForbidden || e.Client != "john" {
+		t.Error("Unexpected result:", e)
+		return
+	}
+
+	if e := logger.entries[4]; e.Status != http.StatusOK || e.Client != "john" {
+		t.Error("Unexpected result:", e)
+		return
+	}
+
+	// Requests are logged as a single line by default
+
+	var buf bytes.Buffer
+
+	(&StdRequestLogger{log.New(&buf, "", 0)}).LogRequest(&RequestLogEntry{"abc", "GET",
+		"/db/v1/graph/main", 404, 1500 * time.Microsecond, 20, "", "1.2.3.4:1000"})
+
+	if res := buf.String(); res != `request id=abc method=GET path="/db/v1/graph/main" status=404 duration=1.5ms bytes=20 client="-" remote=1.2.3.4:1000`+"\n" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
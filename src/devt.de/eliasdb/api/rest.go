@@ -43,6 +43,16 @@ GeneralEndpointMap contains general endpoints which should always be available
 var GeneralEndpointMap = map[string]RestEndpointInst{
 	EndpointAbout:   AboutEndpointInst,
 	EndpointSwagger: SwaggerEndpointInst,
+	EndpointHealth:  HealthEndpointInst,
+}
+
+/*
+AdminEndpointMap contains admin endpoints which can only be used by clients with
+the admin role (see RoleAdmin).
+*/
+var AdminEndpointMap = map[string]RestEndpointInst{
+	EndpointRateLimits: RateLimitsEndpointInst,
+	EndpointStorage:    StorageEndpointInst,
 }
 
 /*
@@ -81,6 +91,18 @@ type RestEndpointHandler interface {
 	SwaggerDefs(s map[string]interface{})
 }
 
+/*
+PatchEndpointHandler is implemented by REST endpoint handlers which handle
+PATCH requests.
+*/
+type PatchEndpointHandler interface {
+
+	/*
+		HandlePATCH handles a PATCH request.
+	*/
+	HandlePATCH(w http.ResponseWriter, r *http.Request, resources []string)
+}
+
 /*
 GM is the GraphManager instance which should be used by the REST API.
 */
@@ -113,9 +135,64 @@ func RegisterRestEndpoints(endpointInsts map[string]RestEndpointInst) {
 
 			return func(w http.ResponseWriter, r *http.Request) {
 
-				// Create a new handler instance
+				// Assign an ID to the request and log it once it was handled
+
+				w, r, logged := logRequest(w, r)
+				defer func() {
+					logged(r)
+				}()
+
+				// Compress the response if the client accepts it
+
+				w, done := compressResponse(w, r)
+				defer done()
+
+				// Add CORS headers and answer preflight requests (these
+				// never carry credentials)
+
+				if handleCORS(w, r) {
+					return
+				}
+
+				// Create a new handler instance and answer OPTIONS requests
+				// with the methods which are supported by the endpoint
 
 				handler := handlerInst()
+				methods := endpointMethods(handler)
+
+				if r.Method == "OPTIONS" {
+					w.Header().Set("Allow", allowHeader(methods))
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+
+				// Authenticate the request before it is dispatched (requests
+				// which only read data or need write access are marked first)
+
+				r = markRequest(r, handlerURL)
+
+				r, ok := authenticate(w, r, handlerURL)
+				if !ok {
+					return
+				}
+
+				// Limit the rate of requests per client
+
+				if !limitRate(w, r, handlerURL) {
+					return
+				}
+
+				// Decompress compressed request bodies
+
+				if !decompressRequest(w, r) {
+					return
+				}
+
+				// Limit the size of request bodies
+
+				if !limitRequestBody(w, r, handlerURL) {
+					return
+				}
 
 				// Handle request in appropriate method
 
@@ -131,10 +208,25 @@ func RegisterRestEndpoints(endpointInsts map[string]RestEndpointInst) {
 					resources = strings.Split(res, "/")
 				}
 
+				if !methods[r.Method] {
+					w.Header().Set("Allow", allowHeader(methods))
+					WriteError(w, r, "Method Not Allowed", http.StatusMethodNotAllowed)
+					return
+				}
+
 				switch r.Method {
 				case "GET":
 					handler.HandleGET(w, r, resources)
 
+				case "HEAD":
+
+					// Responses to HEAD requests have the same headers as
+					// responses to GET requests but no body
+
+					hw := &headResponseWriter{ResponseWriter: w}
+					handler.HandleGET(hw, r, resources)
+					hw.close()
+
 				case "POST":
 					handler.HandlePOST(w, r, resources)
 
@@ -144,8 +236,8 @@ func RegisterRestEndpoints(endpointInsts map[string]RestEndpointInst) {
 				case "DELETE":
 					handler.HandleDELETE(w, r, resources)
 
-				default:
-					http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+				case "PATCH":
+					handler.(PatchEndpointHandler).HandlePATCH(w, r, resources)
 				}
 			}
 		}())
@@ -162,26 +254,26 @@ type DefaultEndpointHandler struct {
 HandleGET is a method stub returning an error.
 */
 func (de *DefaultEndpointHandler) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
-	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	WriteError(w, r, "Method Not Allowed", http.StatusMethodNotAllowed)
 }
 
 /*
 HandlePOST is a method stub returning an error.
 */
 func (de *DefaultEndpointHandler) HandlePOST(w http.ResponseWriter, r *http.Request, resources []string) {
-	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	WriteError(w, r, "Method Not Allowed", http.StatusMethodNotAllowed)
 }
 
 /*
 HandlePUT is a method stub returning an error.
 */
 func (de *DefaultEndpointHandler) HandlePUT(w http.ResponseWriter, r *http.Request, resources []string) {
-	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	WriteError(w, r, "Method Not Allowed", http.StatusMethodNotAllowed)
 }
 
 /*
 HandleDELETE is a method stub returning an error.
 */
 func (de *DefaultEndpointHandler) HandleDELETE(w http.ResponseWriter, r *http.Request, resources []string) {
-	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	WriteError(w, r, "Method Not Allowed", http.StatusMethodNotAllowed)
 }
@@ -16,9 +16,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"runtime"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"devt.de/common/httputil"
 	"devt.de/eliasdb/version"
@@ -116,19 +118,51 @@ func TestEndpointHandling(t *testing.T) {
 
 	// Test about endpoints
 
-	if res := sendTestRequest(queryURL+"/db/about", "GET", nil); res != fmt.Sprintf(`
-{
-  "api_versions": [
-    "v1"
-  ],
-  "product": "EliasDB",
-  "revision": "%v",
-  "version": "%v"
-}`[1:], version.REV, version.VERSION) {
+	RegisterRestEndpoints(map[string]RestEndpointInst{
+		APIRoot + "/v1/abouttest/": func() RestEndpointHandler {
+			return &testEndpoint{}
+		},
+	})
+
+	var about map[string]interface{}
+
+	res := sendTestRequest(queryURL+"/db/about", "GET", nil)
+
+	if err := json.Unmarshal([]byte(res), &about); err != nil {
+		t.Error(err)
+		return
+	}
+
+	startTime, _ := time.Parse(time.RFC3339, fmt.Sprint(about["start_time"]))
+
+	if fmt.Sprint(about["api_versions"]) != "[v1]" || about["product"] != "EliasDB" ||
+		about["revision"] != version.REV || about["version"] != version.VERSION ||
+		fmt.Sprint(about["features"]) != "[gzip health requestlog]" ||
+		about["go_version"] != runtime.Version() || about["data_location"] != "" ||
+		startTime.Unix() != StartTime.Unix() || about["uptime_seconds"].(float64) < 0 {
 		t.Error("Unexpected response:", res)
 		return
 	}
 
+	Auth = &APIKeyAuthenticator{}
+	AuthExempt[EndpointAbout] = true
+	DataLocation = "db"
+	defer func() {
+		Auth = nil
+		delete(AuthExempt, EndpointAbout)
+		DataLocation = ""
+	}()
+
+	res = sendTestRequest(queryURL+"/db/about", "GET", nil)
+
+	if err := json.Unmarshal([]byte(res), &about); err != nil || about["data_location"] != "db" ||
+		fmt.Sprint(about["features"]) != "[auth gzip health requestlog]" {
+		t.Error("Unexpected response:", err, res)
+		return
+	}
+
+	Auth = nil
+
 	if res := sendTestRequest(queryURL+"/db/swagger.json", "GET", nil); res != `
 {
   "basePath": "/db",
@@ -147,7 +181,7 @@ func TestEndpointHandling(t *testing.T) {
   "paths": {
     "/about": {
       "get": {
-        "description": "Returns available API versions, product name and product version.",
+        "description": "Returns available API versions, product name, product version, enabled features and runtime information.",
         "produces": [
           "text/plain",
           "application/json"
@@ -165,10 +199,39 @@ func TestEndpointHandling(t *testing.T) {
                   },
                   "type": "array"
                 },
+                "data_location": {
+                  "description": "Location of the datastore (empty if not shown).",
+                  "type": "string"
+                },
+                "features": {
+                  "description": "List of enabled features.",
+                  "items": {
+                    "description": "Enabled feature.",
+                    "type": "string"
+                  },
+                  "type": "array"
+                },
+                "go_version": {
+                  "description": "Version of the Go runtime.",
+                  "type": "string"
+                },
                 "product": {
                   "description": "Product name of the REST API provider.",
                   "type": "string"
                 },
+                "revision": {
+                  "description": "Revision of the REST API provider.",
+                  "type": "string"
+                },
+                "start_time": {
+                  "description": "Start time of the REST API provider.",
+                  "format": "date-time",
+                  "type": "string"
+                },
+                "uptime_seconds": {
+                  "description": "Seconds since the start of the REST API provider.",
+                  "type": "integer"
+                },
                 "version": {
                   "description": "Version of the REST API provider.",
                   "type": "string"
@@ -186,6 +249,40 @@ func TestEndpointHandling(t *testing.T) {
         },
         "summary": "Return information about the REST API provider."
       }
+    },
+    "/health": {
+      "get": {
+        "description": "Returns the status of the graph storage. The status is 503 if a critical check fails.",
+        "produces": [
+          "application/json"
+        ],
+        "responses": {
+          "200": {
+            "description": "Status of the server and its components."
+          },
+          "503": {
+            "description": "Status of the server and its components if a critical check failed."
+          }
+        },
+        "summary": "Return the health of the server."
+      }
+    },
+    "/health/ready": {
+      "get": {
+        "description": "Returns the status of the graph storage and if the server finished starting. The status is 503 if a critical check fails or if the server is starting or shutting down.",
+        "produces": [
+          "application/json"
+        ],
+        "responses": {
+          "200": {
+            "description": "Status of the server and its components."
+          },
+          "503": {
+            "description": "Status of the server and its components if a critical check failed."
+          }
+        },
+        "summary": "Return the health of the server."
+      }
     }
   },
   "produces": [
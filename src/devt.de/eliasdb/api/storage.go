@@ -0,0 +1,200 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"devt.de/eliasdb/storage"
+)
+
+/*
+EndpointStorage is the storage endpoint URL (rooted). Handles admin/storage/
+*/
+const EndpointStorage = APIRoot + "/admin/storage/"
+
+/*
+Storage actions
+*/
+const (
+	StorageActionFlush     = "flush"
+	StorageActionRotateLog = "rotate-log"
+	StorageActionRollback  = "rollback"
+)
+
+/*
+StorageEndpointInst creates a new endpoint handler.
+*/
+func StorageEndpointInst() RestEndpointHandler {
+	return &storageEndpoint{}
+}
+
+/*
+Handler object for storage operations.
+*/
+type storageEndpoint struct {
+	*DefaultEndpointHandler
+}
+
+/*
+HandlePOST runs a storage action. The flush action writes all pending changes
+and the transaction logs to the storage files, the rotate-log action writes
+only the transaction logs and the rollback action discards all changes which
+have not yet been written to a transaction log.
+*/
+func (se *storageEndpoint) HandlePOST(w http.ResponseWriter, r *http.Request, resources []string) {
+	var res []*storage.SyncResult
+	var err error
+
+	if !CheckAdmin(w, r) {
+		return
+	}
+
+	if len(resources) != 1 {
+		WriteError(w, r, "Need an action (flush, rotate-log or rollback)", http.StatusBadRequest)
+		return
+	} else if GM == nil {
+		WriteError(w, r, "No graph manager", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch resources[0] {
+
+	case StorageActionFlush:
+		res, err = GM.SyncLogs(true)
+
+	case StorageActionRotateLog:
+		res, err = GM.SyncLogs(false)
+
+	case StorageActionRollback:
+
+		// Rollback discards changes so it needs to be confirmed explicitly
+
+		if r.URL.Query().Get("confirm") != "true" {
+			WriteError(w, r, "Rollback discards all pending changes - "+
+				"it needs to be confirmed with the parameter confirm=true", http.StatusBadRequest)
+			return
+		}
+
+		res, err = GM.Rollback()
+
+	default:
+		WriteError(w, r, "Unknown action: "+resources[0], http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		WriteError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var written int64
+
+	success := true
+	files := make([]map[string]interface{}, 0, len(res))
+
+	for _, fr := range res {
+		file := map[string]interface{}{
+			"name":          fr.File,
+			"success":       fr.Error == nil,
+			"bytes_written": fr.BytesWritten,
+			"log_bytes":     fr.LogBytes,
+		}
+
+		if fr.Error != nil {
+			file["error"] = fr.Error.Error()
+			success = false
+		}
+
+		written += fr.BytesWritten
+		files = append(files, file)
+	}
+
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"action":        resources[0],
+		"success":       success,
+		"bytes_written": written,
+		"files":         files,
+	})
+}
+
+/*
+Describe describes the endpoint in the API description.
+*/
+func (se *storageEndpoint) Describe() []*EndpointDescription {
+	return []*EndpointDescription{{
+		Path:    strings.TrimSuffix(EndpointStorage, "/") + "/{action}",
+		Summary: "Run a storage action.",
+		Description: "Writes pending changes and transaction logs to the storage files (flush), " +
+			"writes only the transaction logs (rotate-log) or discards pending changes (rollback). " +
+			"Needs a client with the admin role.",
+		Parameters: []*ParameterDescription{
+			{"action", "path", "Storage action (flush, rotate-log or rollback).", true, "string"},
+			{"confirm", "query", "Must be true for the rollback action.", false, "boolean"},
+		},
+		Responses: []*ResponseDescription{
+			{200, "Result of the action for each storage file.", "application/json", nil},
+			{400, "Unknown action or unconfirmed rollback.", "text/plain", nil},
+		},
+	}}
+}
+
+/*
+SwaggerDefs is used to describe the endpoint in swagger.
+*/
+func (se *storageEndpoint) SwaggerDefs(s map[string]interface{}) {
+
+	s["paths"].(map[string]interface{})["/admin/storage/{action}"] = map[string]interface{}{
+		"post": map[string]interface{}{
+			"summary": "Run a storage action.",
+			"description": "The flush action writes the main database, all pending changes and " +
+				"the transaction logs to the storage files. The rotate-log action writes only " +
+				"the transaction logs to the storage files and starts new logs. The rollback " +
+				"action discards all changes which have not yet been written to a transaction " +
+				"log and needs the confirm parameter. Needs a client with the admin role.",
+			"produces": []string{
+				"text/plain",
+				"application/json",
+			},
+			"parameters": []map[string]interface{}{
+				{
+					"name":        "action",
+					"in":          "path",
+					"description": "Storage action (flush, rotate-log or rollback).",
+					"required":    true,
+					"type":        "string",
+				},
+				{
+					"name":        "confirm",
+					"in":          "query",
+					"description": "Must be true for the rollback action.",
+					"required":    false,
+					"type":        "boolean",
+				},
+			},
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "Result of the action for each storage file.",
+				},
+				"default": map[string]interface{}{
+					"description": "Error response",
+					"schema": map[string]interface{}{
+						"$ref": "#/definitions/Error",
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+func TestStorage(t *testing.T) {
+	oldGM := GM
+	defer func() {
+		GM = oldGM
+	}()
+
+	admin := &Principal{"admin", []string{RoleAdmin}, false}
+
+	post := func(p *Principal, url string, resources ...string) (int, string) {
+		r := httptest.NewRequest("POST", url, nil)
+		if p != nil {
+			r = r.WithContext(context.WithValue(r.Context(), principalKey{}, p))
+		}
+
+		w := httptest.NewRecorder()
+		StorageEndpointInst().HandlePOST(w, r, resources)
+
+		return w.Code, strings.TrimSpace(w.Body.String())
+	}
+
+	if code, res := post(nil, EndpointStorage+"flush", "flush"); code != 403 ||
+		res != `{"error":"Admin endpoints need authentication"}` {
+		t.Error("Unexpected response:", code, res)
+		return
+	}
+
+	if code, res := post(&Principal{"john", nil, false}, EndpointStorage+"flush", "flush"); code != 403 ||
+		res != `{"error":"Client john is not an admin"}` {
+		t.Error("Unexpected response:", code, res)
+		return
+	}
+
+	GM = nil
+
+	if code, res := post(admin, EndpointStorage+"flush", "flush"); code != 503 || res != "No graph manager" {
+		t.Error("Unexpected response:", code, res)
+		return
+	}
+
+	// Memory storages have no storage files
+
+	GM = graph.NewGraphManager(graphstorage.NewMemoryGraphStorage("mystorage"))
+
+	if code, res := post(admin, EndpointStorage+"flush", "flush"); code != 200 ||
+		res != `{"action":"flush","bytes_written":0,"files":[],"success":true}` {
+		t.Error("Unexpected response:", code, res)
+		return
+	}
+
+	if code, res := post(admin, EndpointStorage); code != 400 || res != "Need an action (flush, rotate-log or rollback)" {
+		t.Error("Unexpected response:", code, res)
+		return
+	}
+
+	if code, res := post(admin, EndpointStorage+"compact", "compact"); code != 400 || res != "Unknown action: compact" {
+		t.Error("Unexpected response:", code, res)
+		return
+	}
+
+	// Check disk storage
+
+	defer os.RemoveAll("storagetest")
+
+	dgs, err := graphstorage.NewDiskGraphStorage("storagetest", false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	GM = graph.NewGraphManager(dgs)
+	defer GM.Close()
+
+	node := data.NewGraphNode()
+	node.SetAttr("key", "a")
+	node.SetAttr("kind", "mynode")
+
+	if err := GM.StoreNode("main", node); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var res map[string]interface{}
+
+	code, out := post(admin, EndpointStorage+"rotate-log", "rotate-log")
+	json.Unmarshal([]byte(out), &res)
+
+	files, _ := res["files"].([]interface{})
+
+	if code != 200 || res["action"] != "rotate-log" || res["success"] != true ||
+		fmt.Sprint(res["bytes_written"]) == "0" || len(files) == 0 {
+		t.Error("Unexpected response:", code, out)
+		return
+	}
+
+	if file := files[0].(map[string]interface{}); !strings.HasPrefix(file["name"].(string), "storagetest/") ||
+		file["success"] != true || file["error"] != nil {
+		t.Error("Unexpected response:", file)
+		return
+	}
+
+	// Rollback needs to be confirmed
+
+	if code, out := post(admin, EndpointStorage+"rollback", "rollback"); code != 400 ||
+		out != "Rollback discards all pending changes - it needs to be confirmed with the parameter confirm=true" {
+		t.Error("Unexpected response:", code, out)
+		return
+	}
+
+	dgs.MainDB()["test"] = "value"
+
+	res = nil
+	code, out = post(admin, EndpointStorage+"rollback?confirm=true", "rollback")
+	json.Unmarshal([]byte(out), &res)
+
+	if code != 200 || res["action"] != "rollback" || res["success"] != true || dgs.MainDB()["test"] != "" {
+		t.Error("Unexpected response:", code, out)
+		return
+	}
+
+	if n, err := GM.FetchNode("main", "a", "mynode"); err != nil || n == nil {
+		t.Error("Unexpected result:", n, err)
+		return
+	}
+
+	GM.Close()
+
+	if code, out := post(admin, EndpointStorage+"flush", "flush"); code != 500 ||
+		out != "GraphError: Graph manager was closed (Graph storagetest)" {
+		t.Error("Unexpected response:", code, out)
+		return
+	}
+}
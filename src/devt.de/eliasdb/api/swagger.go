@@ -25,7 +25,7 @@ func (a *aboutEndpoint) SwaggerDefs(s map[string]interface{}) {
 	s["paths"].(map[string]interface{})["/about"] = map[string]interface{}{
 		"get": map[string]interface{}{
 			"summary":     "Return information about the REST API provider.",
-			"description": "Returns available API versions, product name and product version.",
+			"description": "Returns available API versions, product name, product version, enabled features and runtime information.",
 			"produces": []string{
 				"text/plain",
 				"application/json",
@@ -52,6 +52,35 @@ func (a *aboutEndpoint) SwaggerDefs(s map[string]interface{}) {
 								"description": "Version of the REST API provider.",
 								"type":        "string",
 							},
+							"revision": map[string]interface{}{
+								"description": "Revision of the REST API provider.",
+								"type":        "string",
+							},
+							"features": map[string]interface{}{
+								"description": "List of enabled features.",
+								"type":        "array",
+								"items": map[string]interface{}{
+									"description": "Enabled feature.",
+									"type":        "string",
+								},
+							},
+							"start_time": map[string]interface{}{
+								"description": "Start time of the REST API provider.",
+								"type":        "string",
+								"format":      "date-time",
+							},
+							"uptime_seconds": map[string]interface{}{
+								"description": "Seconds since the start of the REST API provider.",
+								"type":        "integer",
+							},
+							"data_location": map[string]interface{}{
+								"description": "Location of the datastore (empty if not shown).",
+								"type":        "string",
+							},
+							"go_version": map[string]interface{}{
+								"description": "Version of the Go runtime.",
+								"type":        "string",
+							},
 						},
 					},
 				},
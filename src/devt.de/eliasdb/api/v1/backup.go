@@ -0,0 +1,511 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"devt.de/eliasdb/api"
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/graphstorage"
+	"devt.de/eliasdb/storage"
+	"devt.de/eliasdb/version"
+)
+
+/*
+EndpointBackup is the backup endpoint URL (rooted). Handles backup/
+*/
+const EndpointBackup = api.APIRoot + APIv1 + "/backup/"
+
+/*
+EndpointRestore is the restore endpoint URL (rooted). Handles restore/
+*/
+const EndpointRestore = api.APIRoot + APIv1 + "/restore/"
+
+/*
+BackupFormatVersion is the version of the backup archive format.
+*/
+const BackupFormatVersion = 1
+
+/*
+BackupManifestName is the name of the manifest which is the first file of
+a backup archive.
+*/
+const BackupManifestName = "manifest.json"
+
+/*
+BackupTempDir is the directory for the temporary copies of the datastore
+which are made for backups and restores (empty means the default directory
+for temporary files). The directory needs enough space for a copy of the
+datastore.
+*/
+var BackupTempDir = ""
+
+/*
+backupManifest describes the content of a backup archive.
+*/
+type backupManifest struct {
+	FormatVersion  int           `json:"format_version"`  // Version of the archive format
+	StorageVersion int           `json:"storage_version"` // Version of the storage files
+	GraphVersion   int           `json:"graph_version"`   // Version of the graph data
+	Version        string        `json:"version"`         // Version of EliasDB which made the backup
+	Created        string        `json:"created"`         // Time when the backup was made
+	Files          []*backupFile `json:"files"`           // Files of the backup
+}
+
+/*
+backupFile describes a file of a backup archive.
+*/
+type backupFile struct {
+	Name   string `json:"name"`   // Name of the file
+	Size   int64  `json:"size"`   // Size of the file in bytes
+	SHA256 string `json:"sha256"` // SHA-256 checksum of the file (hex encoded)
+}
+
+/*
+BackupEndpointInst creates a new endpoint handler.
+*/
+func BackupEndpointInst() api.RestEndpointHandler {
+	return &backupEndpoint{}
+}
+
+/*
+Handler object for backups.
+*/
+type backupEndpoint struct {
+	*api.DefaultEndpointHandler
+}
+
+/*
+HandleGET streams a consistent copy of the datastore as tar archive. The
+datastore is copied to a temporary directory first so writes only wait
+until the copy is made and not until the archive was sent.
+*/
+func (be *backupEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
+
+	if !api.CheckAdmin(w, r) || !checkResources(w, r, resources, 0, 0, "") {
+		return
+	}
+
+	dir, err := ioutil.TempDir(BackupTempDir, "eliasdb-backup-")
+	if err != nil {
+		api.WriteError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	files, err := api.GM.Backup(dir)
+	if err != nil {
+		api.WriteError(w, r, err.Error(), graphErrorStatus(err))
+		return
+	}
+
+	manifest := &backupManifest{BackupFormatVersion, storage.VERSION, graph.VERSION,
+		version.VERSION, time.Now().UTC().Format(time.RFC3339), nil}
+
+	for _, name := range files {
+		bf, err := checksumFile(filepath.Join(dir, name))
+		if err != nil {
+			api.WriteError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		bf.Name = name
+		manifest.Files = append(manifest.Files, bf)
+	}
+
+	filename := fmt.Sprintf("eliasdb-%v.tar", time.Now().UTC().Format("20060102T150405Z"))
+
+	w.Header().Set("content-type", "application/x-tar")
+	w.Header().Set("content-disposition", fmt.Sprintf(`attachment; filename="%v"`, filename))
+	w.Header().Set("Trailer", HTTPHeaderQueryError)
+
+	if err := writeBackup(w, dir, manifest); err != nil {
+		w.Header().Set(HTTPHeaderQueryError, err.Error())
+	}
+}
+
+/*
+writeBackup writes the manifest and all files of a backup as tar archive.
+*/
+func writeBackup(w io.Writer, dir string, manifest *backupManifest) error {
+	tw := tar.NewWriter(w)
+
+	data, _ := json.MarshalIndent(manifest, "", "  ")
+
+	if err := tw.WriteHeader(&tar.Header{Name: BackupManifestName, Mode: 0660,
+		Size: int64(len(data)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	for _, bf := range manifest.Files {
+		f, err := os.Open(filepath.Join(dir, bf.Name))
+		if err != nil {
+			return err
+		}
+
+		if err = tw.WriteHeader(&tar.Header{Name: bf.Name, Mode: 0660,
+			Size: bf.Size, ModTime: time.Now()}); err == nil {
+
+			_, err = io.Copy(tw, f)
+		}
+
+		f.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+/*
+checksumFile returns the size and the checksum of a given file.
+*/
+func checksumFile(name string) (*backupFile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return &backupFile{"", size, hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+/*
+Describe describes the endpoint in the API description.
+*/
+func (be *backupEndpoint) Describe() []*api.EndpointDescription {
+	return []*api.EndpointDescription{{
+		Path:    strings.TrimSuffix(EndpointBackup, "/"),
+		Summary: "Return a backup of the datastore.",
+		Description: "Returns a consistent copy of all storage files as tar archive which " +
+			"starts with a manifest of versions and checksums. Needs a client with the admin role.",
+		Responses: []*api.ResponseDescription{
+			{Status: 200, Description: "Tar archive of the datastore.", ContentType: "application/x-tar"},
+		},
+	}}
+}
+
+/*
+SwaggerDefs is used to describe the endpoint in swagger.
+*/
+func (be *backupEndpoint) SwaggerDefs(s map[string]interface{}) {
+
+	s["paths"].(map[string]interface{})["/v1/backup"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary": "Return a backup of the datastore.",
+			"description": "Returns a consistent copy of all storage files as tar archive. The " +
+				"first file of the archive is a manifest with the format and storage versions and " +
+				"the size and SHA-256 checksum of every file. The archive can be restored with " +
+				"the restore endpoint. Needs a client with the admin role.",
+			"produces": []string{
+				"text/plain",
+				"application/x-tar",
+			},
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "Tar archive of the datastore.",
+				},
+				"default": map[string]interface{}{
+					"description": "Error response",
+					"schema": map[string]interface{}{
+						"$ref": "#/definitions/Error",
+					},
+				},
+			},
+		},
+	}
+}
+
+/*
+RestoreEndpointInst creates a new endpoint handler.
+*/
+func RestoreEndpointInst() api.RestEndpointHandler {
+	return &restoreEndpoint{}
+}
+
+/*
+Handler object for restores.
+*/
+type restoreEndpoint struct {
+	*api.DefaultEndpointHandler
+}
+
+/*
+HandlePOST replaces the datastore with a backup archive from the request
+body. The archive is written to a temporary directory while it streams in.
+The datastore is only replaced once the versions and checksums of all files
+were verified.
+*/
+func (re *restoreEndpoint) HandlePOST(w http.ResponseWriter, r *http.Request, resources []string) {
+
+	if !api.CheckAdmin(w, r) || !checkResources(w, r, resources, 0, 0, "") {
+		return
+	}
+
+	force, ok := queryParamBool(w, r, "force")
+	if !ok {
+		return
+	}
+
+	if !force && (len(api.GM.Partitions()) > 0 || len(api.GM.NodeKinds()) > 0 || len(api.GM.EdgeKinds()) > 0) {
+		api.WriteError(w, r, "Datastore is not empty - use the force parameter to replace its content",
+			http.StatusConflict)
+		return
+	}
+
+	dir, err := ioutil.TempDir(BackupTempDir, "eliasdb-restore-")
+	if err != nil {
+		api.WriteError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	manifest, err := readBackup(r.Body, dir)
+	if err != nil {
+		api.WriteError(w, r, "Invalid backup archive: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := api.GM.Restore(dir); err != nil {
+		api.WriteError(w, r, err.Error(), graphErrorStatus(err))
+		return
+	}
+
+	var size int64
+
+	for _, bf := range manifest.Files {
+		size += bf.Size
+	}
+
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"files":   len(manifest.Files),
+		"bytes":   size,
+		"version": manifest.Version,
+		"created": manifest.Created,
+	})
+}
+
+/*
+readBackup reads a backup archive and writes its files to a given directory.
+Returns the manifest of the archive once all files were verified.
+*/
+func readBackup(r io.Reader, dir string) (*backupManifest, error) {
+	var manifest *backupManifest
+
+	tr := tar.NewReader(r)
+
+	hdr, err := tr.Next()
+	if err == nil && hdr.Name != BackupManifestName {
+		err = fmt.Errorf("First file must be %v", BackupManifestName)
+	} else if err == nil {
+		err = json.NewDecoder(tr).Decode(&manifest)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := checkManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		bf, ok := files[hdr.Name]
+		if !ok || hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("Unexpected file: %v", hdr.Name)
+		}
+
+		delete(files, hdr.Name)
+
+		if err := readBackupFile(tr, filepath.Join(dir, bf.Name), bf); err != nil {
+			return nil, err
+		}
+	}
+
+	for name := range files {
+		return nil, fmt.Errorf("Missing file: %v", name)
+	}
+
+	return manifest, nil
+}
+
+/*
+checkManifest checks the versions of a backup manifest. Returns the files of
+the manifest by name.
+*/
+func checkManifest(manifest *backupManifest) (map[string]*backupFile, error) {
+
+	if manifest == nil {
+		return nil, errors.New("Empty manifest")
+	} else if manifest.FormatVersion != BackupFormatVersion {
+		return nil, fmt.Errorf("Unsupported format version: %v", manifest.FormatVersion)
+	} else if manifest.StorageVersion > storage.VERSION {
+		return nil, fmt.Errorf("Unsupported storage version: %v", manifest.StorageVersion)
+	} else if manifest.GraphVersion > graph.VERSION {
+		return nil, fmt.Errorf("Unsupported graph version: %v", manifest.GraphVersion)
+	}
+
+	files := make(map[string]*backupFile)
+
+	for _, bf := range manifest.Files {
+		if bf == nil {
+			return nil, errors.New("Invalid file entry")
+		} else if bf.Name == "" || bf.Name != filepath.Base(bf.Name) || strings.HasPrefix(bf.Name, ".") ||
+			bf.Name == BackupManifestName || files[bf.Name] != nil {
+			return nil, fmt.Errorf("Invalid file name: %v", bf.Name)
+		}
+		files[bf.Name] = bf
+	}
+
+	if _, ok := files[graphstorage.FilenameNameDB]; !ok {
+		return nil, fmt.Errorf("Missing file: %v", graphstorage.FilenameNameDB)
+	}
+
+	return files, nil
+}
+
+/*
+readBackupFile writes a file of a backup archive and verifies its size and
+checksum.
+*/
+func readBackupFile(r io.Reader, name string, bf *backupFile) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0660)
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(f, h), r)
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return err
+	} else if size != bf.Size || hex.EncodeToString(h.Sum(nil)) != bf.SHA256 {
+		return fmt.Errorf("Checksum mismatch: %v", bf.Name)
+	}
+
+	return nil
+}
+
+/*
+Describe describes the endpoint in the API description.
+*/
+func (re *restoreEndpoint) Describe() []*api.EndpointDescription {
+	return []*api.EndpointDescription{{
+		Path:    strings.TrimSuffix(EndpointRestore, "/"),
+		Summary: "Restore a backup of the datastore.",
+		Description: "Replaces the datastore with a tar archive from the backup endpoint. " +
+			"Needs a client with the admin role.",
+		Parameters: []*api.ParameterDescription{
+			{Name: "force", In: "query", Description: "Replace the datastore even if it is not empty.",
+				Type: "boolean"},
+		},
+		Responses: []*api.ResponseDescription{
+			{Status: 200, Description: "Number of restored files and bytes.", ContentType: "application/json",
+				Schema: map[string]interface{}{"type": "object"}},
+			{Status: 400, Description: "Invalid backup archive.", ContentType: "text/plain"},
+			{Status: 409, Description: "Datastore is not empty.", ContentType: "text/plain"},
+		},
+	}}
+}
+
+/*
+SwaggerDefs is used to describe the endpoint in swagger.
+*/
+func (re *restoreEndpoint) SwaggerDefs(s map[string]interface{}) {
+
+	s["paths"].(map[string]interface{})["/v1/restore"] = map[string]interface{}{
+		"post": map[string]interface{}{
+			"summary": "Restore a backup of the datastore.",
+			"description": "Replaces the datastore with a tar archive from the backup endpoint. " +
+				"The versions and checksums of all files are verified before the datastore " +
+				"is changed. A datastore which is not empty is only replaced if the force " +
+				"parameter is given. Needs a client with the admin role.",
+			"consumes": []string{
+				"application/x-tar",
+			},
+			"produces": []string{
+				"text/plain",
+				"application/json",
+			},
+			"parameters": []map[string]interface{}{
+				{
+					"name":        "archive",
+					"in":          "body",
+					"description": "Tar archive from the backup endpoint.",
+					"required":    true,
+					"schema": map[string]interface{}{
+						"type":   "string",
+						"format": "binary",
+					},
+				},
+				{
+					"name":        "force",
+					"in":          "query",
+					"description": "Replace the datastore even if it is not empty.",
+					"required":    false,
+					"type":        "boolean",
+				},
+			},
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "Number of restored files and bytes.",
+				},
+				"default": map[string]interface{}{
+					"description": "Error response",
+					"schema": map[string]interface{}{
+						"$ref": "#/definitions/Error",
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,304 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"devt.de/eliasdb/api"
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+	"devt.de/eliasdb/storage"
+)
+
+/*
+backupTestAuth authenticates all requests as a given principal.
+*/
+type backupTestAuth struct {
+	p *api.Principal
+}
+
+func (ba *backupTestAuth) Authenticate(r *http.Request) (*api.Principal, error) {
+	return ba.p, nil
+}
+
+func (ba *backupTestAuth) Challenge() string {
+	return "test"
+}
+
+func TestBackupRestore(t *testing.T) {
+	backupURL := "http://localhost" + TESTPORT + EndpointBackup
+	restoreURL := "http://localhost" + TESTPORT + EndpointRestore
+
+	defer func() {
+		api.Auth = nil
+	}()
+
+	// Backups and restores need an admin - also if the datastore is empty
+
+	st, _, res := sendTestRequest(backupURL, "GET", nil)
+
+	if st != "403 Forbidden" || !strings.Contains(res, `"error": "Admin endpoints need authentication"`) {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	api.Auth = &backupTestAuth{&api.Principal{Name: "john"}}
+
+	for _, url := range []string{backupURL, restoreURL} {
+		method := "GET"
+		if url == restoreURL {
+			method = "POST"
+		}
+
+		st, _, res = sendTestRequest(url, method, []byte("foo"))
+
+		if st != "403 Forbidden" || !strings.Contains(res, `"error": "Client john is not an admin"`) {
+			t.Error("Unexpected response:", st, res)
+			return
+		}
+	}
+
+	api.Auth = &backupTestAuth{&api.Principal{Name: "admin", Roles: []string{api.RoleAdmin}}}
+
+	st, _, res = sendTestRequest(backupURL, "GET", nil)
+
+	if st != "500 Internal Server Error" ||
+		res != "GraphError: Failed to access graph storage component (Graph storage does not support backups)" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(restoreURL, "POST", []byte("foo"))
+
+	if st != "409 Conflict" || res != "Datastore is not empty - use the force parameter to replace its content" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Use disk storages for the test
+
+	oldGM := api.GM
+	defer func() {
+		api.GM = oldGM
+	}()
+
+	defer os.RemoveAll("backuptest1")
+	defer os.RemoveAll("backuptest2")
+
+	dgs, _ := graphstorage.NewDiskGraphStorage("backuptest1", false)
+	api.GM = graph.NewGraphManager(dgs)
+
+	for _, key := range []string{"a", "b", "c"} {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "mynode")
+
+		if err := api.GM.StoreNode("main", node); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	resp, err := http.Get(backupURL)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	archive, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != 200 || resp.Header.Get("content-type") != "application/x-tar" ||
+		!strings.HasPrefix(resp.Header.Get("content-disposition"), `attachment; filename="eliasdb-`) {
+		t.Error("Unexpected response:", resp.Status, resp.Header)
+		return
+	}
+
+	api.GM.Close()
+
+	// Check the content of the archive
+
+	dir, _ := ioutil.TempDir("", "eliasdb-backuptest-")
+	defer os.RemoveAll(dir)
+
+	manifest, err := readBackup(bytes.NewReader(archive), dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if manifest.FormatVersion != BackupFormatVersion || manifest.GraphVersion != graph.VERSION ||
+		len(manifest.Files) < 2 {
+		t.Error("Unexpected manifest:", manifest)
+		return
+	}
+
+	// Restore the archive into an empty datastore
+
+	dgs, _ = graphstorage.NewDiskGraphStorage("backuptest2", false)
+	api.GM = graph.NewGraphManager(dgs)
+	defer api.GM.Close()
+
+	// Corrupted archives are rejected before the datastore is changed
+
+	var corrupted string
+
+	for _, f := range manifest.Files {
+		if f.Size > 0 {
+			corrupted = f.Name
+			break
+		}
+	}
+
+	content, _ := ioutil.ReadFile(filepath.Join(dir, corrupted))
+	content[0]++
+	ioutil.WriteFile(filepath.Join(dir, corrupted), content, 0660)
+
+	var buf bytes.Buffer
+	writeBackup(&buf, dir, manifest)
+
+	st, _, res = sendTestRequest(restoreURL, "POST", buf.Bytes())
+
+	if st != "400 Bad Request" || res != "Invalid backup archive: Checksum mismatch: "+corrupted {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	if res := api.GM.NodeCount("mynode"); res != 0 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	st, _, res = sendTestRequest(restoreURL, "POST", archive)
+
+	if st != "200 OK" || !strings.Contains(res, `"bytes": `) || !strings.Contains(res, `"version": `) {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	if res := api.GM.NodeCount("mynode"); res != 3 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if n, err := api.GM.FetchNode("main", "b", "mynode"); err != nil || n == nil {
+		t.Error("Unexpected result:", n, err)
+		return
+	}
+
+	// The datastore is not empty anymore
+
+	st, _, res = sendTestRequest(restoreURL, "POST", archive)
+
+	if st != "409 Conflict" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	if st, _, res = sendTestRequest(restoreURL+"?force=true", "POST", archive); st != "200 OK" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Test invalid archives
+
+	sum := sha256.Sum256([]byte("test"))
+	checksum := hex.EncodeToString(sum[:])
+
+	writeArchive := func(m *backupManifest, files ...string) []byte {
+		var buf bytes.Buffer
+
+		tw := tar.NewWriter(&buf)
+
+		if m != nil {
+			mdata, _ := json.Marshal(m)
+			tw.WriteHeader(&tar.Header{Name: BackupManifestName, Mode: 0660, Size: int64(len(mdata))})
+			tw.Write(mdata)
+		}
+
+		for _, f := range files {
+			tw.WriteHeader(&tar.Header{Name: f, Mode: 0660, Size: 4})
+			tw.Write([]byte("test"))
+		}
+
+		tw.Close()
+
+		return buf.Bytes()
+	}
+
+	newManifest := func(files ...string) *backupManifest {
+		m := &backupManifest{BackupFormatVersion, storage.VERSION, graph.VERSION, "", "", nil}
+		for _, f := range files {
+			m.Files = append(m.Files, &backupFile{f, 4, checksum})
+		}
+		return m
+	}
+
+	unsupported := newManifest(graphstorage.FilenameNameDB)
+	unsupported.FormatVersion = 2
+
+	for archive, msg := range map[string]string{
+		string(writeArchive(newManifest(graphstorage.FilenameNameDB), graphstorage.FilenameNameDB, "x")): "Unexpected file: x",
+		string(writeArchive(newManifest(graphstorage.FilenameNameDB, "x"), graphstorage.FilenameNameDB)): "Missing file: x",
+		string(writeArchive(nil, graphstorage.FilenameNameDB)):                                           "First file must be manifest.json",
+		string(writeArchive(unsupported, graphstorage.FilenameNameDB)):                                   "Unsupported format version: 2",
+		"foo": "unexpected EOF",
+	} {
+		st, _, res = sendTestRequest(restoreURL+"?force=true", "POST", []byte(archive))
+
+		if st != "400 Bad Request" || res != "Invalid backup archive: "+msg {
+			t.Error("Unexpected response:", st, res)
+			return
+		}
+	}
+
+	if res := api.GM.NodeCount("mynode"); res != 3 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Check manifests
+
+	for _, test := range []struct {
+		m   *backupManifest
+		msg string
+	}{
+		{nil, "Empty manifest"},
+		{&backupManifest{BackupFormatVersion, storage.VERSION + 1, graph.VERSION, "", "", nil},
+			"Unsupported storage version: 2"},
+		{&backupManifest{BackupFormatVersion, storage.VERSION, graph.VERSION + 1, "", "", nil},
+			"Unsupported graph version: 2"},
+		{newManifest("../x"), "Invalid file name: ../x"},
+		{newManifest(".x"), "Invalid file name: .x"},
+		{newManifest("x", "x"), "Invalid file name: x"},
+		{newManifest(BackupManifestName), "Invalid file name: manifest.json"},
+		{&backupManifest{BackupFormatVersion, storage.VERSION, graph.VERSION, "", "", []*backupFile{nil}},
+			"Invalid file entry"},
+		{newManifest("x"), "Missing file: " + graphstorage.FilenameNameDB},
+	} {
+		if _, err := checkManifest(test.m); err == nil || err.Error() != test.msg {
+			t.Error("Unexpected result:", err)
+			return
+		}
+	}
+}
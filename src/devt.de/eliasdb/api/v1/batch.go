@@ -0,0 +1,294 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"devt.de/eliasdb/api"
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
+)
+
+/*
+EndpointBatch is the batch endpoint URL (rooted). Handles batch/
+*/
+const EndpointBatch = api.APIRoot + APIv1 + "/batch/"
+
+/*
+Operations of a batch
+*/
+const (
+	BatchOpStoreNode  = "storeNode"
+	BatchOpUpdateNode = "updateNode"
+	BatchOpRemoveNode = "removeNode"
+	BatchOpStoreEdge  = "storeEdge"
+	BatchOpRemoveEdge = "removeEdge"
+)
+
+/*
+Status values of batch operations
+*/
+const (
+	BatchStatusOK      = "ok"      // Operation was applied
+	BatchStatusError   = "error"   // Operation failed
+	BatchStatusSkipped = "skipped" // Operation was not applied because another operation failed
+)
+
+/*
+errUnknownBatchOp is returned for operations with an unknown op attribute.
+*/
+var errUnknownBatchOp = errors.New("Operation must be one of " + BatchOpStoreNode + ", " +
+	BatchOpUpdateNode + ", " + BatchOpRemoveNode + ", " + BatchOpStoreEdge + ", " + BatchOpRemoveEdge)
+
+/*
+BatchEndpointInst creates a new endpoint handler.
+*/
+func BatchEndpointInst() api.RestEndpointHandler {
+	return &batchEndpoint{}
+}
+
+/*
+Handler object for batch operations.
+*/
+type batchEndpoint struct {
+	*api.DefaultEndpointHandler
+}
+
+/*
+batchOpResult is the result of a single operation of a batch.
+*/
+type batchOpResult struct {
+	Index  int    `json:"index"`           // Index of the operation in the batch
+	Op     string `json:"op"`              // Operation
+	Key    string `json:"key"`             // Key of the node or edge
+	Kind   string `json:"kind"`            // Kind of the node or edge
+	Status string `json:"status"`          // Status of the operation
+	Error  string `json:"error,omitempty"` // Error of a failed operation
+}
+
+/*
+batchResult is the result of a batch.
+*/
+type batchResult struct {
+	Atomic     bool             `json:"atomic"`          // Flag if the batch was applied atomically
+	ErrorCount int              `json:"error_count"`     // Number of failed operations
+	Error      string           `json:"error,omitempty"` // Error if an atomic batch failed
+	Results    []*batchOpResult `json:"results"`         // Results of all operations in order
+}
+
+/*
+HandlePOST applies a list of store and remove operations to a partition. By
+default all operations are applied in a single transaction - either all
+operations succeed or none is applied. If atomic is false each operation is
+applied on its own and failed operations are skipped.
+*/
+func (be *batchEndpoint) HandlePOST(w http.ResponseWriter, r *http.Request, resources []string) {
+	var ops []map[string]interface{}
+	var ok bool
+
+	if !checkResources(w, r, resources, 1, 1, "Need a partition") {
+		return
+	}
+
+	part := resources[0]
+
+	if !api.Authorize(w, r, part, "") {
+		return
+	}
+
+	atomic := true
+
+	if r.URL.Query().Get("atomic") != "" {
+		if atomic, ok = queryParamBool(w, r, "atomic"); !ok {
+			return
+		}
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		api.WriteBodyError(w, r, "Could not decode request body as list of operations", err)
+		return
+	}
+
+	// Parse all operations
+
+	res := &batchResult{Atomic: atomic, Results: make([]*batchOpResult, len(ops))}
+	nodes := make([]data.Node, len(ops))
+
+	for i, op := range ops {
+		opName, _ := op["op"].(string)
+		delete(op, "op")
+
+		nodes[i] = data.NewGraphNodeFromJSONMap(op)
+		res.Results[i] = &batchOpResult{i, opName, nodes[i].Key(), nodes[i].Kind(), BatchStatusSkipped, ""}
+	}
+
+	status := http.StatusOK
+
+	if atomic {
+		trans := graph.NewGraphTrans(api.GM)
+
+		for i, opRes := range res.Results {
+			if err := applyBatchOp(trans, part, opRes.Op, nodes[i]); err != nil {
+				opRes.Status, opRes.Error = BatchStatusError, err.Error()
+				res.ErrorCount, res.Error = 1, fmt.Sprintf("Operation %v failed: %v", i, err)
+				status = http.StatusBadRequest
+				break
+			}
+		}
+
+		if status == http.StatusOK {
+			if err := trans.Commit(); err != nil {
+				res.Error = err.Error()
+				status = graphErrorStatus(err)
+			} else {
+				for _, opRes := range res.Results {
+					opRes.Status = BatchStatusOK
+				}
+			}
+		}
+
+	} else {
+
+		for i, opRes := range res.Results {
+			trans := graph.NewGraphTrans(api.GM)
+
+			err := applyBatchOp(trans, part, opRes.Op, nodes[i])
+			if err == nil {
+				err = trans.Commit()
+			}
+
+			if err != nil {
+				opRes.Status, opRes.Error = BatchStatusError, err.Error()
+				res.ErrorCount++
+			} else {
+				opRes.Status = BatchStatusOK
+			}
+		}
+	}
+
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(res)
+}
+
+/*
+applyBatchOp adds a single operation of a batch to a transaction.
+*/
+func applyBatchOp(trans *graph.Trans, part string, op string, node data.Node) error {
+
+	switch op {
+	case BatchOpStoreNode:
+		return trans.StoreNode(part, node)
+
+	case BatchOpUpdateNode:
+		return trans.UpdateNode(part, node)
+
+	case BatchOpStoreEdge:
+		return trans.StoreEdge(part, data.NewGraphEdgeFromNode(node))
+
+	case BatchOpRemoveNode, BatchOpRemoveEdge:
+
+		if node.Key() == "" || node.Kind() == "" {
+			return errors.New("Need a key and a kind")
+		} else if op == BatchOpRemoveNode {
+			return trans.RemoveNode(part, node.Key(), node.Kind())
+		}
+
+		return trans.RemoveEdge(part, node.Key(), node.Kind())
+	}
+
+	return errUnknownBatchOp
+}
+
+/*
+Describe describes the endpoint in the API description.
+*/
+func (be *batchEndpoint) Describe() []*api.EndpointDescription {
+	return []*api.EndpointDescription{{
+		Path:        EndpointBatch + "{partition}",
+		Summary:     "Apply a list of operations.",
+		Description: "The request body is a list of operations on nodes and edges.",
+		Parameters: []*api.ParameterDescription{
+			{Name: "atomic", In: "query", Description: "Apply all operations in a single transaction.", Type: "boolean"},
+		},
+		Responses: []*api.ResponseDescription{
+			{Status: 200, Description: "The results of all operations.", ContentType: "application/json",
+				Schema: map[string]interface{}{"type": "object"}},
+		},
+	}}
+}
+
+/*
+SwaggerDefs is used to describe the endpoint in swagger.
+*/
+func (be *batchEndpoint) SwaggerDefs(s map[string]interface{}) {
+
+	s["paths"].(map[string]interface{})["/v1/batch/{partition}"] = map[string]interface{}{
+		"post": map[string]interface{}{
+			"summary": "Apply a list of operations.",
+			"description": "Applies a list of store and remove operations of nodes and edges. By default " +
+				"all operations are applied in a single transaction.",
+			"consumes": []string{
+				"application/json",
+			},
+			"produces": []string{
+				"text/plain",
+				"application/json",
+			},
+			"parameters": []map[string]interface{}{
+				{
+					"name":        "partition",
+					"in":          "path",
+					"description": "Partition to change.",
+					"required":    true,
+					"type":        "string",
+				},
+				{
+					"name": "atomic",
+					"in":   "query",
+					"description": "Flag if all operations are applied in a single transaction (default) - if " +
+						"false each operation is applied on its own.",
+					"required": false,
+					"type":     "boolean",
+				},
+				{
+					"name": "operations",
+					"in":   "body",
+					"description": "Operations in the order they should be applied. Each operation is a node " +
+						"or edge with an op attribute (storeNode, updateNode, removeNode, storeEdge or removeEdge).",
+					"required": true,
+					"schema": map[string]interface{}{
+						"type": "array",
+						"items": map[string]interface{}{
+							"type": "object",
+						},
+					},
+				},
+			},
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "Results of all operations in order.",
+				},
+				"default": map[string]interface{}{
+					"description": "Error response",
+					"schema": map[string]interface{}{
+						"$ref": "#/definitions/Error",
+					},
+				},
+			},
+		},
+	}
+}
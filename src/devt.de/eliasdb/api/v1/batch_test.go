@@ -0,0 +1,227 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"testing"
+
+	"devt.de/eliasdb/api"
+)
+
+func TestBatch(t *testing.T) {
+	batchURL := "http://localhost" + TESTPORT + EndpointBatch
+
+	st, _, res := sendTestRequest(batchURL+"batchtest", "POST", []byte(`[
+  {"op":"storeNode","key":"a","kind":"Doc","name":"A"},
+  {"op":"storeNode","key":"b","kind":"Doc","name":"B"},
+  {"op":"updateNode","key":"a","kind":"Doc","size":1},
+  {"op":"storeEdge","key":"ab","kind":"Link","end1key":"a","end1kind":"Doc","end1role":"from","end1cascading":false,
+   "end2key":"b","end2kind":"Doc","end2role":"to","end2cascading":false}
+]`))
+
+	if st != "200 OK" || res != `{
+  "atomic": true,
+  "error_count": 0,
+  "results": [
+    {
+      "index": 0,
+      "op": "storeNode",
+      "key": "a",
+      "kind": "Doc",
+      "status": "ok"
+    },
+    {
+      "index": 1,
+      "op": "storeNode",
+      "key": "b",
+      "kind": "Doc",
+      "status": "ok"
+    },
+    {
+      "index": 2,
+      "op": "updateNode",
+      "key": "a",
+      "kind": "Doc",
+      "status": "ok"
+    },
+    {
+      "index": 3,
+      "op": "storeEdge",
+      "key": "ab",
+      "kind": "Link",
+      "status": "ok"
+    }
+  ]
+}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	if n, err := api.GM.FetchNode("batchtest", "a", "Doc"); err != nil || n.Attr("name") != "A" || n.Attr("size") != 1.0 {
+		t.Error("Unexpected result:", n, err)
+		return
+	}
+
+	// An invalid operation in an atomic batch prevents all operations
+
+	st, _, res = sendTestRequest(batchURL+"batchtest", "POST", []byte(`[
+  {"op":"removeEdge","key":"ab","kind":"Link"},
+  {"op":"removeNode","key":"b"},
+  {"op":"removeNode","key":"a","kind":"Doc"}
+]`))
+
+	if st != "400 Bad Request" || res != `{
+  "atomic": true,
+  "error_count": 1,
+  "error": "Operation 1 failed: Need a key and a kind",
+  "results": [
+    {
+      "index": 0,
+      "op": "removeEdge",
+      "key": "ab",
+      "kind": "Link",
+      "status": "skipped"
+    },
+    {
+      "index": 1,
+      "op": "removeNode",
+      "key": "b",
+      "kind": "",
+      "status": "error",
+      "error": "Need a key and a kind"
+    },
+    {
+      "index": 2,
+      "op": "removeNode",
+      "key": "a",
+      "kind": "Doc",
+      "status": "skipped"
+    }
+  ]
+}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	if e, err := api.GM.FetchEdge("batchtest", "ab", "Link"); err != nil || e == nil {
+		t.Error("Unexpected result:", e, err)
+		return
+	}
+
+	// Errors during the commit fail the whole batch
+
+	st, _, res = sendTestRequest(batchURL+"batchtest", "POST", []byte(`[
+  {"op":"storeNode","key":"c","kind":"Doc"},
+  {"op":"storeEdge","key":"ac","kind":"Link","end1key":"a","end1kind":"Doc","end1role":"from","end1cascading":false,
+   "end2key":"x","end2kind":"Doc","end2role":"to","end2cascading":false}
+]`))
+
+	if st != "404 Not Found" || res != `{
+  "atomic": true,
+  "error_count": 0,
+  "error": "GraphError: Invalid data (Can't find edge endpoint: x (Doc))",
+  "results": [
+    {
+      "index": 0,
+      "op": "storeNode",
+      "key": "c",
+      "kind": "Doc",
+      "status": "skipped"
+    },
+    {
+      "index": 1,
+      "op": "storeEdge",
+      "key": "ac",
+      "kind": "Link",
+      "status": "skipped"
+    }
+  ]
+}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Non-atomic batches skip failed operations
+
+	st, _, res = sendTestRequest(batchURL+"batchtest?atomic=false", "POST", []byte(`[
+  {"op":"storeNode","key":"c","kind":"Doc"},
+  {"op":"foo","key":"d","kind":"Doc"},
+  {"op":"removeNode","key":"b","kind":"Doc"}
+]`))
+
+	if st != "200 OK" || res != `{
+  "atomic": false,
+  "error_count": 1,
+  "results": [
+    {
+      "index": 0,
+      "op": "storeNode",
+      "key": "c",
+      "kind": "Doc",
+      "status": "ok"
+    },
+    {
+      "index": 1,
+      "op": "foo",
+      "key": "d",
+      "kind": "Doc",
+      "status": "error",
+      "error": "Operation must be one of storeNode, updateNode, removeNode, storeEdge, removeEdge"
+    },
+    {
+      "index": 2,
+      "op": "removeNode",
+      "key": "b",
+      "kind": "Doc",
+      "status": "ok"
+    }
+  ]
+}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	if n, err := api.GM.FetchNode("batchtest", "c", "Doc"); err != nil || n == nil {
+		t.Error("Unexpected result:", n, err)
+		return
+	}
+
+	// Removing a node removes its edges
+
+	if e, err := api.GM.FetchEdge("batchtest", "ab", "Link"); err != nil || e != nil {
+		t.Error("Unexpected result:", e, err)
+		return
+	}
+
+	// Test error cases
+
+	st, _, res = sendTestRequest(batchURL, "POST", []byte(`[]`))
+
+	if st != "400 Bad Request" || res != "Need a partition" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(batchURL+"batchtest?atomic=foo", "POST", []byte(`[]`))
+
+	if st != "400 Bad Request" || res != "Invalid parameter value: atomic should be a boolean" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(batchURL+"batchtest", "POST", []byte(`{}`))
+
+	if st != "400 Bad Request" || res != "Could not decode request body as list of operations: "+
+		"json: cannot unmarshal object into Go value of type []map[string]interface {}" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+}
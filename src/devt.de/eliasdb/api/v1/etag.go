@@ -0,0 +1,139 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"devt.de/eliasdb/api"
+	"devt.de/eliasdb/graph/data"
+)
+
+/*
+writeJSONWithETag writes an object as JSON together with an entity tag (see
+jsonETag). If the tag matches the If-None-Match header of the request then
+only the status 304 (Not Modified) is sent. Weak tags should be used for data
+which is assembled from several objects.
+*/
+func writeJSONWithETag(w http.ResponseWriter, r *http.Request, obj interface{}, weak bool, extra ...string) {
+
+	res, etag, err := jsonETag(obj, weak, extra...)
+	if err != nil {
+		api.WriteError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag, false) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+
+	w.Write(res)
+}
+
+/*
+jsonETag returns the JSON representation of an object and an entity tag which
+is computed from the JSON representation (and optional extra values which are
+sent with the data - e.g. the total count of a list). Nodes and edges are
+always marshalled with sorted attributes so equal data produces equal tags.
+*/
+func jsonETag(obj interface{}, weak bool, extra ...string) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	if err := json.NewEncoder(&buf).Encode(obj); err != nil {
+		return nil, "", err
+	}
+
+	h := sha256.New()
+	h.Write(buf.Bytes())
+
+	for _, e := range extra {
+		h.Write([]byte{0})
+		h.Write([]byte(e))
+	}
+
+	etag := `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+
+	if weak {
+		etag = "W/" + etag
+	}
+
+	return buf.Bytes(), etag, nil
+}
+
+/*
+checkWritePrecondition checks the If-Match and If-None-Match headers of a
+write request against the current state of a node or edge (nil if it does
+not exist). If-Match: * only allows writing existing items and If-None-Match: *
+only allows creating new items.
+*/
+func checkWritePrecondition(r *http.Request, current data.Node) (bool, error) {
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+
+		if current == nil {
+			return false, nil
+		}
+
+		_, etag, err := jsonETag(current, false)
+		if err != nil || !etagMatches(ifMatch, etag, true) {
+			return false, err
+		}
+	}
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && current != nil {
+
+		_, etag, err := jsonETag(current, false)
+		if err != nil || etagMatches(ifNoneMatch, etag, false) {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+/*
+etagMatches checks if an entity tag matches a list of entity tags as given in
+an If-Match or If-None-Match header. The strong comparison function does not
+match weak tags - the weak comparison function matches weak and strong tags
+with the same value.
+*/
+func etagMatches(header string, etag string, strong bool) bool {
+
+	if strong && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+
+		if t == "*" {
+			return true
+		} else if strong && strings.HasPrefix(t, "W/") {
+			continue
+		} else if t != "" && strings.TrimPrefix(t, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,267 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestGraphETag(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointGraph
+
+	get := func(url string, ifNoneMatch string) (int, string, string) {
+		req, _ := http.NewRequest("GET", url, nil)
+
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			return 0, "", ""
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		return resp.StatusCode, resp.Header.Get("ETag"), string(body)
+	}
+
+	st, _, res := sendTestRequest(queryURL+"etagtest/n", "POST", []byte(`[{"key":"1","kind":"Poll","a":1,"b":2},{"key":"2","kind":"Poll","a":2}]`))
+	if st != "200 OK" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Single nodes get a strong tag
+
+	code, etag, body := get(queryURL+"etagtest/n/Poll/1", "")
+
+	if code != http.StatusOK || !strings.HasPrefix(etag, `"`) || body == "" {
+		t.Error("Unexpected response:", code, etag, body)
+		return
+	}
+
+	if code, etag2, body := get(queryURL+"etagtest/n/Poll/1", etag); code != http.StatusNotModified ||
+		etag2 != etag || body != "" {
+		t.Error("Unexpected response:", code, etag2, body)
+		return
+	}
+
+	if code, _, _ := get(queryURL+"etagtest/n/Poll/1", `"foo", W/`+etag); code != http.StatusNotModified {
+		t.Error("Unexpected response:", code)
+		return
+	}
+
+	if code, _, _ := get(queryURL+"etagtest/n/Poll/1", "*"); code != http.StatusNotModified {
+		t.Error("Unexpected response:", code)
+		return
+	}
+
+	if code, _, _ := get(queryURL+"etagtest/n/Poll/1", `"foo"`); code != http.StatusOK {
+		t.Error("Unexpected response:", code)
+		return
+	}
+
+	// Lists get a weak tag
+
+	code, listETag, _ := get(queryURL+"etagtest/n/Poll?sorted=true", "")
+
+	if code != http.StatusOK || !strings.HasPrefix(listETag, `W/"`) {
+		t.Error("Unexpected response:", code, listETag)
+		return
+	}
+
+	if code, _, _ := get(queryURL+"etagtest/n/Poll?sorted=true", listETag); code != http.StatusNotModified {
+		t.Error("Unexpected response:", code)
+		return
+	}
+
+	// Storing the same data again does not change the tag
+
+	st, _, res = sendTestRequest(queryURL+"etagtest/n", "POST", []byte(`[{"key":"1","kind":"Poll","b":2,"a":1}]`))
+	if st != "200 OK" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	if _, etag2, _ := get(queryURL+"etagtest/n/Poll/1", ""); etag2 != etag {
+		t.Error("Unexpected result:", etag, etag2)
+		return
+	}
+
+	// Changing data changes the tags
+
+	st, _, res = sendTestRequest(queryURL+"etagtest/n", "PUT", []byte(`[{"key":"1","kind":"Poll","a":3}]`))
+	if st != "200 OK" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	if code, etag2, _ := get(queryURL+"etagtest/n/Poll/1", etag); code != http.StatusOK || etag2 == etag {
+		t.Error("Unexpected response:", code, etag, etag2)
+		return
+	}
+
+	if code, _, _ := get(queryURL+"etagtest/n/Poll?sorted=true", listETag); code != http.StatusOK {
+		t.Error("Unexpected response:", code)
+		return
+	}
+}
+
+func TestGraphConditionalWrite(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointGraph
+
+	send := func(method string, url string, body string, header string, value string) (int, string) {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set(header, value)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			return 0, ""
+		}
+		defer resp.Body.Close()
+
+		res, _ := ioutil.ReadAll(resp.Body)
+
+		return resp.StatusCode, strings.TrimSpace(string(res))
+	}
+
+	getETag := func(url string) string {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Error(err)
+			return ""
+		}
+		resp.Body.Close()
+
+		return resp.Header.Get("ETag")
+	}
+
+	// Only create a node if it does not exist
+
+	if code, res := send("POST", queryURL+"condtest/n", `[{"key":"1","kind":"Doc","rev":1}]`,
+		"If-None-Match", "*"); code != http.StatusOK {
+		t.Error("Unexpected response:", code, res)
+		return
+	}
+
+	if code, res := send("POST", queryURL+"condtest/n", `[{"key":"1","kind":"Doc","rev":1}]`,
+		"If-None-Match", "*"); code != http.StatusPreconditionFailed || res != "Precondition failed for node 1 (Doc)" {
+		t.Error("Unexpected response:", code, res)
+		return
+	}
+
+	// Only update a node if it exists
+
+	if code, res := send("PUT", queryURL+"condtest/n", `[{"key":"2","kind":"Doc","rev":1}]`,
+		"If-Match", "*"); code != http.StatusPreconditionFailed || res != "Precondition failed for node 2 (Doc)" {
+		t.Error("Unexpected response:", code, res)
+		return
+	}
+
+	if code, res := send("PUT", queryURL+"condtest/n", `[{"key":"1","kind":"Doc","name":"foo"}]`,
+		"If-Match", "*"); code != http.StatusOK {
+		t.Error("Unexpected response:", code, res)
+		return
+	}
+
+	// Update with an entity tag
+
+	etag := getETag(queryURL + "condtest/n/Doc/1")
+
+	if code, res := send("PUT", queryURL+"condtest/n", `[{"key":"1","kind":"Doc","rev":2}]`,
+		"If-Match", etag); code != http.StatusOK {
+		t.Error("Unexpected response:", code, res)
+		return
+	}
+
+	// The old tag does not match anymore - nothing is written
+
+	if code, res := send("POST", queryURL+"condtest/n", `[{"key":"1","kind":"Doc","rev":3}]`,
+		"If-Match", etag); code != http.StatusPreconditionFailed {
+		t.Error("Unexpected response:", code, res)
+		return
+	}
+
+	if _, _, res := sendTestRequest(queryURL+"condtest/n/Doc/1", "GET", nil); res != `{
+  "key": "1",
+  "kind": "Doc",
+  "name": "foo",
+  "rev": 2
+}` {
+		t.Error("Unexpected response:", res)
+		return
+	}
+
+	// Weak tags never match If-Match
+
+	etag = getETag(queryURL + "condtest/n/Doc/1")
+
+	if code, res := send("PUT", queryURL+"condtest/n", `[{"key":"1","kind":"Doc","rev":3}]`,
+		"If-Match", "W/"+etag); code != http.StatusPreconditionFailed {
+		t.Error("Unexpected response:", code, res)
+		return
+	}
+
+	// Edges can be written conditionally as well
+
+	if code, res := send("POST", queryURL+"condtest/e", `[{"key":"1","kind":"Link","end1key":"1","end1kind":"Doc",`+
+		`"end1role":"a","end1cascading":false,"end2key":"1","end2kind":"Doc","end2role":"b","end2cascading":false}]`,
+		"If-Match", "*"); code != http.StatusPreconditionFailed || res != "Precondition failed for edge 1 (Link)" {
+		t.Error("Unexpected response:", code, res)
+		return
+	}
+
+	// Concurrent writers with the same tag - exactly one wins
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+
+	codes := make(map[int]int)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			code, _ := send("PUT", queryURL+"condtest/n", `[{"key":"1","kind":"Doc","rev":4}]`, "If-Match", etag)
+
+			mutex.Lock()
+			codes[code]++
+			mutex.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	if len(codes) != 2 || codes[http.StatusOK] != 1 || codes[http.StatusPreconditionFailed] != 9 {
+		t.Error("Unexpected result:", codes)
+		return
+	}
+
+	// Test error cases
+
+	if code, res := send("PUT", queryURL+"condtest/n", `[{"key":"1","kind":"Doc"},{"key":"2","kind":"Doc"}]`,
+		"If-Match", etag); code != http.StatusBadRequest ||
+		res != "Entity tags in If-Match or If-None-Match require a single node or edge" {
+		t.Error("Unexpected response:", code, res)
+		return
+	}
+}
@@ -0,0 +1,341 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"devt.de/eliasdb/api"
+	"devt.de/eliasdb/graph"
+)
+
+/*
+EndpointEvents is the change event stream endpoint URL (rooted). Handles events/
+*/
+const EndpointEvents = api.APIRoot + APIv1 + "/events/"
+
+/*
+EventsBufferSize is the number of recent change events which are kept for
+clients which reconnect with a Last-Event-ID header.
+*/
+var EventsBufferSize = 1000
+
+/*
+EventsHeartbeatInterval is the interval in which heartbeat comments are sent
+to keep idle connections open.
+*/
+var EventsHeartbeatInterval = 15 * time.Second
+
+/*
+changeLog is the log of recent change events of the graph manager of the API.
+*/
+var changeLog = &eventLog{lock: &sync.Mutex{}, gmLock: &sync.Mutex{}}
+
+/*
+eventLog data structure which keeps recent change events in a ring buffer and
+notifies waiting listeners about new events.
+*/
+type eventLog struct {
+	gm        *graph.Manager     // Graph manager which provides the events
+	subID     int                // Change subscription ID of the graph manager
+	events    []*loggedEvent     // Ring buffer of recent events
+	lastID    uint64             // ID of the last event
+	listeners map[chan bool]bool // Channels which are notified about new events
+	lock      *sync.Mutex        // Lock for the events and listeners
+	gmLock    *sync.Mutex        // Lock for changing the graph manager
+}
+
+/*
+loggedEvent is a change event in the log.
+*/
+type loggedEvent struct {
+	id   uint64 // ID of the event
+	part string // Partition of the changed item
+	kind string // Kind of the changed item
+	data []byte // JSON data of the event
+}
+
+/*
+listen registers a listener which is notified about new events. The log
+subscribes to the changes of the current graph manager if necessary. Returns
+the ID of the last event.
+*/
+func (el *eventLog) listen(c chan bool) uint64 {
+	el.gmLock.Lock()
+	defer el.gmLock.Unlock()
+
+	// The log lock must not be held while subscribing since the graph
+	// manager holds its own lock while it calls handleChange
+
+	if gm := api.GM; el.gm != gm {
+
+		if el.gm != nil {
+			el.gm.UnsubscribeChanges(el.subID)
+		}
+
+		el.lock.Lock()
+		el.events = make([]*loggedEvent, EventsBufferSize)
+		el.listeners = make(map[chan bool]bool)
+		el.lock.Unlock()
+
+		el.gm = gm
+		el.subID = gm.SubscribeChanges(el.handleChange)
+	}
+
+	el.lock.Lock()
+	defer el.lock.Unlock()
+
+	el.listeners[c] = true
+
+	return el.lastID
+}
+
+/*
+unlisten removes a listener.
+*/
+func (el *eventLog) unlisten(c chan bool) {
+	el.lock.Lock()
+	defer el.lock.Unlock()
+
+	delete(el.listeners, c)
+}
+
+/*
+handleChange adds a change event to the log.
+*/
+func (el *eventLog) handleChange(e *graph.ChangeEvent) {
+	el.lock.Lock()
+	defer el.lock.Unlock()
+
+	data, _ := json.Marshal(newChangeMessage(e))
+
+	el.lastID++
+	el.events[el.lastID%uint64(len(el.events))] = &loggedEvent{el.lastID, e.Part, e.Node.Kind(), data}
+
+	for c := range el.listeners {
+		select {
+		case c <- true:
+		default:
+		}
+	}
+}
+
+/*
+since returns all events after a given event ID. Returns false if some of the
+requested events are no longer in the log.
+*/
+func (el *eventLog) since(id uint64) ([]*loggedEvent, bool) {
+	var ret []*loggedEvent
+
+	el.lock.Lock()
+	defer el.lock.Unlock()
+
+	size := uint64(len(el.events))
+	complete := true
+
+	if el.lastID > size && id < el.lastID-size {
+		id = el.lastID - size
+		complete = false
+	}
+
+	for i := id + 1; i <= el.lastID; i++ {
+		if e := el.events[i%size]; e != nil {
+			ret = append(ret, e)
+		}
+	}
+
+	return ret, complete
+}
+
+/*
+EventsEndpointInst creates a new endpoint handler.
+*/
+func EventsEndpointInst() api.RestEndpointHandler {
+	return &eventsEndpoint{}
+}
+
+/*
+Handler object for change event streams.
+*/
+type eventsEndpoint struct {
+	*api.DefaultEndpointHandler
+}
+
+/*
+HandleGET streams change events as server-sent events until the client
+disconnects or the server shuts down.
+*/
+func (ee *eventsEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
+
+	if !checkResources(w, r, resources, 0, 0, "") {
+		return
+	}
+
+	query := r.URL.Query()
+	parts, kinds := query["part"], query["kind"]
+
+	for _, part := range parts {
+		if !api.Authorize(w, r, part, "") {
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		api.WriteError(w, r, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Clients which reconnect get the events they missed
+
+	var lastID uint64
+
+	if leid := r.Header.Get("Last-Event-ID"); leid != "" {
+		var err error
+
+		if lastID, err = strconv.ParseUint(leid, 10, 64); err != nil {
+			api.WriteError(w, r, "Invalid Last-Event-ID: "+leid, http.StatusBadRequest)
+			return
+		}
+	}
+
+	notify := make(chan bool, 1)
+
+	currentID := changeLog.listen(notify)
+	defer changeLog.unlisten(notify)
+
+	// Events after an unknown ID (e.g. from before a restart) are lost
+
+	reset := lastID > currentID
+
+	if lastID == 0 || reset {
+		lastID = currentID
+	}
+
+	w.Header().Set("content-type", "text/event-stream")
+	w.Header().Set("cache-control", "no-cache")
+	w.Header().Set("x-accel-buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	p := api.PrincipalFromContext(r.Context())
+
+	heartbeat := time.NewTicker(EventsHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	shutdown := api.ShutdownNotify()
+
+	for {
+		events, complete := changeLog.since(lastID)
+
+		if !complete || reset {
+			reset = false
+
+			// Tell the client that events were lost
+
+			fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+		}
+
+		for _, e := range events {
+			lastID = e.id
+
+			if !matchFilter(parts, e.part) || !matchFilter(kinds, e.kind) {
+				continue
+			}
+
+			if authz := api.Authz; authz != nil && !authz.Authorize(p, "GET", e.part, e.kind) {
+				continue
+			}
+
+			fmt.Fprintf(w, "id: %v\ndata: %s\n\n", e.id, e.data)
+		}
+
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-shutdown:
+
+			// Tell the client that the server goes away - clients should
+			// reconnect with the ID of the last event
+
+			fmt.Fprint(w, "event: shutdown\ndata: {}\n\n")
+			flusher.Flush()
+			return
+
+		case <-notify:
+
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+	}
+}
+
+/*
+SwaggerDefs is used to describe the endpoint in swagger.
+*/
+func (ee *eventsEndpoint) SwaggerDefs(s map[string]interface{}) {
+
+	s["paths"].(map[string]interface{})["/v1/events"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary": "Stream changes of nodes and edges.",
+			"description": "Returns a stream of server-sent events with one event for every committed change. " +
+				"Clients which reconnect with a Last-Event-ID header get recent events which they missed.",
+			"produces": []string{
+				"text/plain",
+				"text/event-stream",
+			},
+			"parameters": []map[string]interface{}{
+				{
+					"name":        "part",
+					"in":          "query",
+					"description": "Partition of changed items (can be repeated).",
+					"required":    false,
+					"type":        "string",
+				},
+				{
+					"name":        "kind",
+					"in":          "query",
+					"description": "Kind of changed items (can be repeated).",
+					"required":    false,
+					"type":        "string",
+				},
+				{
+					"name":        "Last-Event-ID",
+					"in":          "header",
+					"description": "ID of the last received event.",
+					"required":    false,
+					"type":        "integer",
+				},
+			},
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "Stream of change events.",
+				},
+				"default": map[string]interface{}{
+					"description": "Error response",
+					"schema": map[string]interface{}{
+						"$ref": "#/definitions/Error",
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,277 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"devt.de/eliasdb/api"
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
+)
+
+func TestEventLog(t *testing.T) {
+	el := &eventLog{events: make([]*loggedEvent, 3), listeners: make(map[chan bool]bool),
+		lock: &sync.Mutex{}, gmLock: &sync.Mutex{}}
+
+	for i := 0; i < 5; i++ {
+		node := data.NewGraphNode()
+		node.SetAttr("key", fmt.Sprint(i))
+		node.SetAttr("kind", "User")
+		el.handleChange(&graph.ChangeEvent{Event: graph.EventNodeCreated, Part: "main", Node: node})
+	}
+
+	since := func(id uint64) string {
+		var ids []uint64
+		events, complete := el.since(id)
+		for _, e := range events {
+			ids = append(ids, e.id)
+		}
+		return fmt.Sprint(ids, " ", complete)
+	}
+
+	if res := since(3); res != "[4 5] true" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := since(2); res != "[3 4 5] true" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := since(1); res != "[3 4 5] false" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := since(5); res != "[] true" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestEvents(t *testing.T) {
+	eventsURL := "http://localhost" + TESTPORT + EndpointEvents
+
+	storeNode := func(part string, kind string, key string) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", kind)
+
+		if err := api.GM.StoreNode(part, node); err != nil {
+			t.Error(err)
+		}
+	}
+
+	type stream struct {
+		resp   *http.Response
+		br     *bufio.Reader
+		cancel func()
+	}
+
+	open := func(query string, header ...string) *stream {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		req, _ := http.NewRequest("GET", eventsURL+query, nil)
+		req = req.WithContext(ctx)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			panic(err)
+		}
+
+		return &stream{resp, bufio.NewReader(resp.Body), cancel}
+	}
+
+	// Read the next event or comment
+
+	next := func(s *stream) string {
+		var lines []string
+
+		for {
+			line, err := s.br.ReadString('\n')
+			if err != nil {
+				return err.Error()
+			}
+
+			line = strings.TrimSpace(line)
+			if line == "" {
+				return strings.Join(lines, " ")
+			}
+
+			lines = append(lines, line)
+		}
+	}
+
+	// Events are filtered by partition and kind
+
+	s := open("?part=events&kind=User")
+
+	if ct := s.resp.Header.Get("content-type"); ct != "text/event-stream" {
+		t.Error("Unexpected result:", ct)
+		return
+	}
+
+	if res := next(s); res != ": connected" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	storeNode("events", "Group", "1")
+	storeNode("events2", "User", "1")
+	storeNode("events", "User", "1")
+
+	res := next(s)
+
+	var id uint64
+	fmt.Sscanf(res, "id: %d", &id)
+
+	if res != fmt.Sprintf(`id: %v data: {"type":"event","operation":"create","partition":"events","kind":"User","key":"1","data":{"key":"1","kind":"User"}}`, id) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	s.cancel()
+
+	// Disconnected clients stop listening
+
+	listeners := -1
+
+	for i := 0; i < 100 && listeners != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+
+		changeLog.lock.Lock()
+		listeners = len(changeLog.listeners)
+		changeLog.lock.Unlock()
+	}
+
+	if listeners != 0 {
+		t.Error("Unexpected result:", listeners)
+		return
+	}
+
+	// Reconnecting clients get the events they missed
+
+	storeNode("events", "User", "2")
+	storeNode("events", "Group", "2")
+	storeNode("events", "User", "3")
+
+	s = open("?part=events&kind=User", "Last-Event-ID", fmt.Sprint(id))
+	next(s)
+
+	for i, key := range []string{"2", "3"} {
+		if res := next(s); res != fmt.Sprintf(`id: %v data: {"type":"event","operation":"create","partition":"events","kind":"User","key":"%v","data":{"key":"%v","kind":"User"}}`, id+uint64(2*i+1), key, key) {
+			t.Error("Unexpected result:", res)
+			return
+		}
+	}
+
+	s.cancel()
+
+	// Unknown event IDs cause a reset
+
+	s = open("?part=events&kind=User", "Last-Event-ID", fmt.Sprint(id+1000))
+	next(s)
+
+	if res := next(s); res != "event: reset data: {}" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	s.cancel()
+
+	req, _ := http.NewRequest("GET", eventsURL, nil)
+	req.Header.Set("Last-Event-ID", "foo")
+
+	if resp, _ := http.DefaultClient.Do(req); resp.StatusCode != http.StatusBadRequest {
+		t.Error("Unexpected result:", resp.Status)
+		return
+	}
+
+	// Streams end when the server shuts down
+
+	s = open("")
+	next(s)
+
+	api.BeginShutdown()
+
+	if res := next(s); res != "event: shutdown data: {}" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := next(s); res != "EOF" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Idle connections get heartbeats
+
+	oldHeartbeatInterval := EventsHeartbeatInterval
+	EventsHeartbeatInterval = 50 * time.Millisecond
+	defer func() {
+		EventsHeartbeatInterval = oldHeartbeatInterval
+	}()
+
+	s = open("")
+	next(s)
+
+	if res := next(s); res != ": heartbeat" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	s.cancel()
+
+	// Partitions are checked
+
+	api.Auth, _ = api.NewAPIKeyAuthenticator([]*api.APIKey{
+		{Name: "team1", Key: "key1", Scope: api.ScopeRead},
+	})
+	api.Authz, _ = api.NewRulesAuthorizer([]*api.AuthzRule{
+		{Principal: "team1", Partitions: []string{"events"}, Access: api.ScopeRead},
+	})
+	defer func() {
+		api.Auth = nil
+		api.Authz = nil
+	}()
+
+	s = open("?part=main", "X-Api-Key", "key1")
+	s.cancel()
+
+	if s.resp.StatusCode != http.StatusForbidden {
+		t.Error("Unexpected result:", s.resp.Status)
+		return
+	}
+
+	s = open("", "X-Api-Key", "key1")
+	defer s.cancel()
+	next(s)
+
+	storeNode("events2", "User", "4")
+	storeNode("events", "User", "4")
+
+	if res := next(s); !strings.HasSuffix(res, `data: {"type":"event","operation":"create","partition":"events","kind":"User","key":"4","data":{"key":"4","kind":"User"}}`) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
@@ -0,0 +1,165 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"devt.de/eliasdb/api"
+)
+
+/*
+EndpointExport is the export endpoint URL (rooted). Handles export/
+*/
+const EndpointExport = api.APIRoot + APIv1 + "/export/"
+
+/*
+ExportEndpointInst creates a new endpoint handler.
+*/
+func ExportEndpointInst() api.RestEndpointHandler {
+	return &exportEndpoint{}
+}
+
+/*
+Handler object for exports.
+*/
+type exportEndpoint struct {
+	*api.DefaultEndpointHandler
+}
+
+/*
+HandleGET streams all nodes and edges of a partition as newline-delimited JSON.
+The data is written while the partition is iterated - an error which occurs
+after the first line was written is sent as trailer.
+*/
+func (ee *exportEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
+
+	if !checkResources(w, r, resources, 1, 1, "Need a partition") {
+		return
+	}
+
+	part := resources[0]
+	kinds := r.URL.Query()["kind"]
+
+	if !api.Authorize(w, r, part, "") {
+		return
+	}
+
+	for _, kind := range kinds {
+		if !api.Authorize(w, r, part, kind) {
+			return
+		}
+	}
+
+	filename := fmt.Sprintf("%v-%v.ndjson", part, time.Now().UTC().Format("20060102T150405Z"))
+
+	w.Header().Set("content-type", "application/x-ndjson")
+	w.Header().Set("content-disposition", fmt.Sprintf(`attachment; filename="%v"`, filename))
+	w.Header().Set("Trailer", HTTPHeaderQueryError)
+
+	ew := &exportWriter{w, false}
+
+	if err := api.GM.Export(part, kinds, ew); err != nil {
+
+		if !ew.written {
+
+			// Nothing was sent yet - report the error with the response status
+
+			w.Header().Del("content-disposition")
+			w.Header().Del("Trailer")
+
+			api.WriteError(w, r, err.Error(), graphErrorStatus(err))
+			return
+		}
+
+		w.Header().Set(HTTPHeaderQueryError, err.Error())
+	}
+}
+
+/*
+exportWriter records if anything was written to a response.
+*/
+type exportWriter struct {
+	w       http.ResponseWriter // Response writer
+	written bool                // Flag if data was written
+}
+
+/*
+Write writes data to the response.
+*/
+func (ew *exportWriter) Write(p []byte) (int, error) {
+	ew.written = true
+	return ew.w.Write(p)
+}
+
+/*
+Describe describes the endpoint in the API description.
+*/
+func (ee *exportEndpoint) Describe() []*api.EndpointDescription {
+	return []*api.EndpointDescription{{
+		Path:    EndpointExport + "{partition}",
+		Summary: "Export nodes and edges.",
+		Parameters: []*api.ParameterDescription{
+			{Name: "kind", In: "query", Description: "Kind of the exported nodes and edges (can be repeated)."},
+		},
+		Responses: []*api.ResponseDescription{
+			{Status: 200, Description: "A stream of JSON objects (one node or edge per line).",
+				ContentType: "application/x-ndjson"},
+		},
+	}}
+}
+
+/*
+SwaggerDefs is used to describe the endpoint in swagger.
+*/
+func (ee *exportEndpoint) SwaggerDefs(s map[string]interface{}) {
+
+	s["paths"].(map[string]interface{})["/v1/export/{partition}"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary": "Export nodes and edges.",
+			"description": "Returns all nodes and edges of a partition as newline-delimited JSON which " +
+				"can be imported with the import endpoint.",
+			"produces": []string{
+				"text/plain",
+				"application/x-ndjson",
+			},
+			"parameters": []map[string]interface{}{
+				{
+					"name":        "partition",
+					"in":          "path",
+					"description": "Partition to export.",
+					"required":    true,
+					"type":        "string",
+				},
+				{
+					"name":        "kind",
+					"in":          "query",
+					"description": "Kind of exported nodes and edges (can be repeated).",
+					"required":    false,
+					"type":        "string",
+				},
+			},
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "One node or edge per line - all nodes are written before all edges.",
+				},
+				"default": map[string]interface{}{
+					"description": "Error response",
+					"schema": map[string]interface{}{
+						"$ref": "#/definitions/Error",
+					},
+				},
+			},
+		},
+	}
+}
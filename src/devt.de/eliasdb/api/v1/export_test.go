@@ -0,0 +1,158 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"devt.de/eliasdb/api"
+	"devt.de/eliasdb/graph"
+)
+
+func TestExport(t *testing.T) {
+	exportURL := "http://localhost" + TESTPORT + EndpointExport
+	importURL := "http://localhost" + TESTPORT + EndpointImport
+
+	var lines bytes.Buffer
+
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&lines, "{\"type\":\"node\",\"key\":\"%v\",\"kind\":\"Track\",\"name\":\"Track %v\",\"end2key\":\"x\"}\n", i, i)
+		fmt.Fprintf(&lines, "{\"key\":\"%v\",\"kind\":\"Album\",\"tracks\":[%v]}\n", i, i)
+	}
+
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&lines, "{\"key\":\"%v\",\"kind\":\"Contains\",\"end1key\":\"%v\",\"end1kind\":\"Album\",\"end1role\":\"album\",\"end1cascading\":true,"+
+			"\"end2key\":\"%v\",\"end2kind\":\"Track\",\"end2role\":\"track\",\"end2cascading\":false}\n", i, i, i)
+	}
+
+	if st, _, res := sendTestRequest(importURL+"exportsrc", "POST", lines.Bytes()); st != "200 OK" ||
+		!bytes.Contains([]byte(res), []byte(`"error_count": 0`)) {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Export a partition with compression
+
+	req, _ := http.NewRequest("GET", exportURL+"exportsrc", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "gzip" ||
+		resp.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Error("Unexpected response:", resp.Status, resp.Header)
+		return
+	}
+
+	if cd := resp.Header.Get("Content-Disposition"); !regexp.MustCompile(
+		`^attachment; filename="exportsrc-\d{8}T\d{6}Z\.ndjson"$`).MatchString(cd) {
+		t.Error("Unexpected result:", cd)
+		return
+	}
+
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	export, _ := ioutil.ReadAll(gz)
+	resp.Body.Close()
+
+	if qe := resp.Trailer.Get(HTTPHeaderQueryError); qe != "" {
+		t.Error("Unexpected result:", qe)
+		return
+	}
+
+	if n := bytes.Count(export, []byte("\n")); n != 150 {
+		t.Error("Unexpected result:", n)
+		return
+	}
+
+	// Import the export into another partition
+
+	st, _, res := sendTestRequest(importURL+"exportdst", "POST", export)
+
+	if st != "200 OK" || res != `{
+  "nodes": 100,
+  "edges": 50,
+  "error_count": 0,
+  "errors": [],
+  "aborted": false
+}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	var diffs []*graph.DiffEntry
+
+	if err := api.GM.Diff("exportsrc", "exportdst", nil, func(entry *graph.DiffEntry) error {
+		diffs = append(diffs, entry)
+		return nil
+	}); err != nil || len(diffs) != 0 {
+		t.Error("Unexpected result:", err, diffs)
+		return
+	}
+
+	// Export only certain kinds
+
+	st, _, res = sendTestRequest(exportURL+"exportsrc?kind=Album", "GET", nil)
+
+	if n := bytes.Count([]byte(res), []byte("\n")); st != "200 OK" || n != 49 {
+		t.Error("Unexpected response:", st, n)
+		return
+	}
+
+	// Test error cases
+
+	st, _, res = sendTestRequest(exportURL, "GET", nil)
+
+	if st != "400 Bad Request" || res != "Need a partition" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(exportURL+"export%20src", "GET", nil)
+
+	if st != "500 Internal Server Error" || res != "GraphError: Invalid data (Partition name export src is not alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	api.Auth, _ = api.NewAPIKeyAuthenticator([]*api.APIKey{
+		{Name: "team1", Key: "key1", Scope: api.ScopeRead},
+	})
+	api.Authz, _ = api.NewRulesAuthorizer([]*api.AuthzRule{
+		{Principal: "team1", Partitions: []string{"exportdst"}, Access: api.ScopeRead},
+	})
+	defer func() {
+		api.Auth = nil
+		api.Authz = nil
+	}()
+
+	req, _ = http.NewRequest("GET", exportURL+"exportsrc", nil)
+	req.Header.Set("X-Api-Key", "key1")
+
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Error("Unexpected response:", err, resp.Status)
+		return
+	}
+}
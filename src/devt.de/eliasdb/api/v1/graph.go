@@ -22,6 +22,30 @@ data in the datastore and always overwrite any existing data. PUT requests on
 nodes will only update the given attributes. PUT requests on edges are handled
 equally to POST requests. Data can be deleted using DELETE requests. The data
 structure for DELETE requests requires only the key and kind attributes.
+Reserved attributes (key, kind and edge ends) can also be nested in an
+object under the attribute _reserved.
+
+Single nodes can be changed with a PATCH request which contains a JSON merge
+patch (RFC 7386). Attributes with a null value are removed, all other given
+attributes are set and nested objects are patched recursively. Reserved
+attributes cannot be patched. The response contains the patched node:
+
+/graph/<partition>/n/<node kind>/<node key>
+
+	{ <attr> : <value or null>, ... }
+
+Writes can be made conditional with the If-Match and If-None-Match headers.
+If-Match should contain the ETag which was returned by a GET request of a
+node or edge - the request fails with 412 (Precondition Failed) and nothing
+is written if the item was changed in the meantime. If-Match: * only writes
+existing items and If-None-Match: * only creates new items. Entity tags
+(other than *) can only be used in requests which contain a single node or
+edge.
+
+Requests with invalid nodes or edges fail with 400 and nothing is written.
+JSON error responses (see package api) list the invalid fields of the failing
+item as details e.g. { field : "edges[0].end1role", message : "Missing role
+value" }. Request bodies which are larger than the maximum size fail with 413.
 
 A PUT, POST or DELETE request should be send to one of the following
 endpoints:
@@ -54,7 +78,12 @@ support the limit and offset parameters for lists:
 	offset - Offset in the dataset (0 to <total count>-1)
 
 The total number of entries is returned in the X-Total-Count header when
-a list is returned.
+a list is returned. Lists of nodes are returned in storage order which can
+change whenever data is written. The optional sorted parameter returns nodes
+in lexicographic key order instead - this is considerably slower but gives
+stable pages between requests:
+
+	sorted - Return nodes in key order (true or false)
 
 /graph/<partition>/n/<node kind>/[node key]/[traversal spec]
 
@@ -62,6 +91,8 @@ a list is returned.
 
 The return data is a list of objects unless a specific node / edge or a traversal
 from a specific node is requested. Each object in the list models a node or edge.
+Attributes are always written in sorted order and time values are written as
+RFC3339 timestamps in UTC.
 
 	[{
 	    key : <value>
@@ -83,6 +114,11 @@ header is not set.
 	    [ <traversed nodes> ], [ <traversed edges> ]
 	]
 
+All GET responses carry an ETag header which is computed from the returned
+JSON. Specific nodes and edges get a strong tag, lists and traversal results
+get a weak tag. If the tag matches the If-None-Match header of a request then
+the response has the status 304 (Not Modified) and no body.
+
 
 Index query endpoint
 
@@ -104,6 +140,12 @@ The return data is a list of node keys:
 
 	[ <node key1>, <node key2>, ... ]
 
+A phrase query can search multiple attributes with repeated attr parameters.
+With the optional matches parameter the return data is a list of matches
+which contain the attribute in which the phrase occurred:
+
+	[ { key : <node key>, attr : <attribute>, phrase : <phrase> }, ... ]
+
 A word query finds all nodes/edges where an attribute contains a certain word.
 A request url which runs a new word search should be of the following form:
 
@@ -129,6 +171,29 @@ The return data is a list of node keys:
 
 	[ <node key1>, <node key2>, ... ]
 
+Instead of the phrase, word or value parameter a query mode (phrase, word,
+value or fuzzy) and a query string can be given:
+
+/index/<partition>/n/<node kind>?mode=<mode>&query=<query>&attr=<attribute>
+
+A fuzzy query finds all words of an attribute which are within a Levenshtein
+distance (optional distance parameter; default 1) of the query string.
+Multiple attributes can be searched with repeated attr parameters. The return
+data is a list of matches sorted by distance and word:
+
+	[
+	    {
+	        word     : <matched word>,
+	        distance : <distance>,
+	        attr     : <attribute>,
+	        keys     : { key : [ <pos1>, <pos2>, ... ], ... }
+	    },
+	    ...
+	]
+
+Parameters which do not apply to the query mode (e.g. distance for a phrase
+query) result in a 400 (Bad Request) response.
+
 General database information endpoint
 
 /info
@@ -143,6 +208,67 @@ The return data is a key-value map:
 	    ...
 	}
 
+Statistics about the data in a partition can be requested with a request url of
+the following form:
+
+/info/statistics/<partition>
+
+The return data contains node and edge counts for each kind. The number of
+distinct values of node attributes is an approximation:
+
+	{
+	    partition  : <partition>,
+	    node_kinds : {
+	        <node kind> : {
+	            count : <number of nodes>,
+	            attrs : {
+	                <attr> : { distinct : <distinct values>, null : <nodes without value> },
+	                ...
+	            }
+	        },
+	        ...
+	    },
+	    edge_kinds : {
+	        <edge kind> : {
+	            count     : <number of edges>,
+	            end_kinds : { <end1 kind>:<end2 kind> : <number of edges>, ... }
+	        },
+	        ...
+	    }
+	}
+
+Computing statistics reads all data of a partition. An overview of all
+partitions which the client may read is returned by a request url of the
+following form (a single partition is returned by /info/partitions/<partition>):
+
+/info/partitions
+
+The kinds of a partition are listed with their counts, known attributes and if
+their full text index is enabled. Counts are read from counters which are
+maintained for each kind in a partition - a count is null if the kind was stored
+before these counters were maintained (totals are then also null). Kinds
+without data in the partition are not listed:
+
+	{
+	    partitions : [
+	        {
+	            name       : <partition>,
+	            node_count : <number of nodes or null>,
+	            edge_count : <number of edges or null>,
+	            node_kinds : {
+	                <node kind> : {
+	                    count    : <number of nodes or null>,
+	                    attrs    : [ <known attributes of the kind> ],
+	                    indexing : <true or false>
+	                },
+	                ...
+	            },
+	            edge_kinds : { <edge kind> : { ... }, ... }
+	        },
+	        ...
+	    ]
+	}
+
 Query endpoint
 
 /query
@@ -160,12 +286,76 @@ The endpoint supports the optional limit and offset parameter:
 	offset - Offset in the dataset
 
 The total number of entries in the result is returned in the X-Total-Count header.
+A new query run can visit the start nodes of GET queries in lexicographic key
+order with the optional sorted parameter. Rows of queries without explicit
+ordering are then returned in the same order every time the query runs:
+
+	sorted - Visit start nodes in key order (true or false)
+
+Large results can be streamed with the optional stream parameter. Rows are
+written as soon as they are produced without keeping the whole result in
+memory (queries with ordering, notnull, unique or aggregation functions still
+need to see all rows first). Streamed results are not stored in the cache and
+contain no sources. The X-Total-Count and X-Has-More values are sent as HTTP
+trailers. An error which occurs after the first row was written is returned
+in an error field of the result object:
+
+	stream - Stream the result rows (true or false)
+
+Results can be returned as RFC 4180 CSV (or TSV) with the optional format
+parameter or an Accept header of text/csv (text/tab-separated-values). JSON is
+returned if no format is requested. New query runs are always streamed - the
+X-Total-Count, X-Has-More and X-Cursor values as well as a late error
+(X-Query-Error) are sent as HTTP trailers. The first row contains the column
+labels and the file name of the result is derived from the partition:
+
+	format - Format of the result (json, csv or tsv)
+	header - Write a header row with the column labels (true or false)
+	raw    - Write raw values instead of display strings (true or false)
+
 A request url which runs a new query should be of the following form:
 
 /query/<partition>?q=<query>
 
 /query/<partition>?rid=<result id>
 
+Cached results and server-side cursors can only be requested for the partition
+they were queried on.
+
+A DELETE request runs a query and deletes all start nodes of its result. The
+result must show an attribute of its start nodes. Nodes are deleted in
+batches - their edges are removed and cascading deletions are applied. The
+request requires write access to the partition:
+
+/query/<partition>?q=<query>
+
+	dryRun  - Only count the nodes which would be deleted (true or false)
+	confirm - Number of nodes which should be deleted (must match the result)
+
+Requests which would delete more than QueryDeleteMaxNodes nodes must confirm
+the number of nodes. The return data contains the number of matched and
+deleted nodes:
+
+	{
+	    matched : <number of start nodes>,
+	    deleted : <number of deleted nodes>,
+	    dry_run : <true or false>
+	}
+
+A POST request submits a query which runs in the background and returns
+immediately with status 202 (Accepted). The query is given as q parameter or
+as request body and only requires read access to the partition:
+
+/query/<partition>?async=true
+
+	sorted - Visit start nodes in key order (true or false)
+	sample - Number of start nodes to sample
+
+The Location header of the response points to the new query job (see
+/queryjob). At most QueryJobWorkers jobs run at the same time - requests are
+answered with 503 (Service Unavailable) if QueryJobMaxQueued jobs are already
+waiting.
+
 The return data is a result object:
 
 	{
@@ -176,23 +366,251 @@ The return data is a result object:
 	                       (e.g. 1:n:name - Name of starting nodes,
 	                             3:e:key  - Key of edge traversed in the second traversal)
 	        primary_kind : The primary kind of the search result.
+	        ordering     : The applied ordering of the result in order of priority.
+	                       (e.g. descending 2:n:ranking)
 	    }
 	    rows    : [ [ <col1>, <col2>, ... ] ]
 	    sources : [ [ <src col1>, <src col2>, ... ] ]
 	}
+
+/subscribe
+
+Endpoint which upgrades to a WebSocket and sends a JSON message for every
+committed change of a node or edge. The subscription can be filtered by
+partitions, kinds and operations (create, update and delete). The initial
+filter can be given with repeated query parameters - clients can send a new
+filter at any time:
+
+/subscribe?partition=<partition>&kind=<kind>&operation=<operation>
+
+	{
+	    partitions : List of partitions (all partitions if empty)
+	    kinds      : List of kinds (all kinds if empty)
+	    operations : List of operations (all operations if empty)
+	}
+
+Each filter is confirmed with a subscribed message. Changes are sent as event
+messages:
+
+	{
+	    type      : event
+	    operation : create, update or delete
+	    partition : Partition of the changed item
+	    kind      : Kind of the changed item
+	    key       : Key of the changed item
+	    edge      : Flag if the changed item is an edge
+	    data      : Data of the changed item
+	    old       : Old data of an updated item
+	}
+
+Subscribers are pinged regularly. Subscribers which fall behind are
+disconnected. The connection is closed with status 1001 (going away) when the
+server shuts down. The Subscribe function provides a client for Go programs.
+
+/events
+
+Endpoint which returns the change events of /subscribe as a stream of
+server-sent events (text/event-stream) for clients which cannot use
+WebSockets. The stream can be filtered by repeated part and kind query
+parameters:
+
+/events?part=<partition>&kind=<kind>
+
+Each event has an incrementing ID. Clients which reconnect with a
+Last-Event-ID header get the events they missed as long as they are still in
+the buffer of recent events (see EventsBufferSize) - otherwise a reset event
+is sent. Heartbeat comments are sent while there are no changes. A shutdown
+event is sent before the stream ends when the server shuts down.
+
+/import
+
+Endpoint which imports newline-delimited JSON (one node or edge per line)
+into a partition. The request body is read and stored in batches (see
+ImportBatchSize) so it can be arbitrarily large and can be compressed with
+gzip. A line can declare its type with a type attribute of value node or edge
+- otherwise lines with edge ends are edges:
+
+/import/<partition>?abort=<true|false>
+
+By default errors of single lines are collected and all other lines are
+stored. If abort is true the import stops at the first error (already
+committed batches are kept). The response has the following format:
+
+	{
+	    nodes       : Number of stored nodes
+	    edges       : Number of stored edges
+	    error_count : Number of errors
+	    errors      : List of errors: { line : <line number>, error : <message> }
+	    aborted     : Flag if the import was aborted
+	}
+
+/export
+
+Endpoint which returns all nodes and edges of a partition in the format of
+/import. The data can be restricted to certain node and edge kinds with
+repeated kind query parameters:
+
+/export/<partition>?kind=<kind>
+
+The response is written while the partition is iterated and has a
+Content-Disposition header with a timestamped filename. All nodes are
+written before all edges. The export does not block writers - items which are
+removed during the export are skipped, items which are added or changed
+during the export may or may not be part of it. An error which occurs after
+the first line was written is sent as X-Query-Error trailer.
+
+/batch
+
+Endpoint which applies a list of operations to a partition. Each operation is
+a node or edge with an additional op attribute:
+
+/batch/<partition>?atomic=<true|false>
+
+	[ { op : <storeNode, updateNode, removeNode, storeEdge or removeEdge>,
+	    <attr> : <value>, ... }, ... ]
+
+Remove operations only need the key and kind attributes. By default all
+operations are applied in a single transaction - either all operations
+succeed or none is applied. If atomic is false each operation is applied on
+its own and failed operations are skipped. The response contains the results
+of all operations in order (the status is 400 if an atomic batch contains an
+invalid operation):
+
+	{
+	    atomic      : Flag if the batch was applied atomically
+	    error_count : Number of failed operations
+	    error       : Error if an atomic batch failed
+	    results     : List of results: { index : <index of the operation>,
+	                  op : <op>, key : <key>, kind : <kind>,
+	                  status : <ok, error or skipped>, error : <message> }
+	}
+
+/traverse
+
+Endpoint which traverses from a node to its neighbours. The traversal spec
+has the form <role>:<edge kind>:<role>:<node kind> - empty components match
+everything and all edges are followed if the spec is omitted:
+
+/traverse/<partition>/<node kind>/<node key>/[traversal spec]?limit=<limit>&fields=<attrs>
+
+The response contains two parallel lists (the n-th edge leads to the n-th
+node) sorted by node key. The limit parameter restricts the number of
+returned items - the total number is returned in the X-Total-Count header.
+The fields parameter is a comma separated list of node attributes which
+should be returned (key and kind are always returned). The status is 404 if
+the start node does not exist. Responses have a weak ETag (see /graph).
+
+	{
+	    nodes : [ <traversed nodes> ]
+	    edges : [ <traversed edges> ]
+	}
+
+/queryjob
+
+Endpoint which returns the status and result of a query job (see /query). Jobs
+can only be requested by the client which submitted them:
+
+/queryjob/<id>
+
+	limit  - How many result rows to return (default QueryJobPageSize)
+	offset - Offset in the result rows
+
+The status of a job is queued, running, done or failed. The progress of a job
+is the number of produced result rows. Done jobs contain a page of their
+result - the next page is requested with the next offset:
+
+	{
+	    id        : <job id>,
+	    partition : <partition>,
+	    query     : <query>,
+	    status    : <queued, running, done or failed>,
+	    created   : <time of submission>,
+	    started   : <time when the query was started>,
+	    finished  : <time when the job was finished>,
+	    expires   : <time when the job and its result are removed>,
+	    progress  : { rows : <produced rows>, elapsed_ms : <run time> },
+	    error     : <error of a failed job>,
+	    result    : {
+	        header      : <header of the result (see /query)>,
+	        rows        : [ <rows of the page> ],
+	        sources     : [ <sources of the rows> ],
+	        offset      : <offset of the page>,
+	        next_offset : <offset of the next page>,
+	        total_count : <number of all rows>,
+	        has_more    : <true or false>,
+	        stats       : <execution statistics of the query>
+	    }
+	}
+
+Results with more than QueryJobSpillRows rows are written to a temporary file
+instead of being kept in memory. Finished jobs and their results are removed
+after QueryJobTTL seconds.
+
+A DELETE request cancels a queued or running job - the job fails once its
+query has stopped. Finished jobs are removed with their result.
+
+/backup
+
+Endpoint which returns a consistent copy of the datastore as tar archive. The
+datastore is first copied to a temporary directory (see BackupTempDir) while
+all other operations wait - the archive is then streamed from the copy. The
+first file of the archive is a manifest:
+
+	{
+	    format_version  : <version of the archive format>,
+	    storage_version : <version of the storage files>,
+	    graph_version   : <version of the graph data>,
+	    version         : <version of EliasDB>,
+	    created         : <time of the backup>,
+	    files           : [ { name : <file name>, size : <size in bytes>,
+	                          sha256 : <checksum> }, ... ]
+	}
+
+An error which occurs after the archive was started is sent as X-Query-Error
+trailer. Backups need an authenticated client with the admin role.
+
+/restore
+
+Endpoint which replaces the datastore with an archive of /backup (POST). The
+archive is streamed into a temporary directory - its versions and the sizes
+and checksums of all files are verified before the datastore is changed. A
+datastore which is not empty is only replaced if the force parameter is true:
+
+/restore?force=<true|false>
+
+	{
+	    files   : <number of restored files>,
+	    bytes   : <number of restored bytes>,
+	    version : <version of EliasDB which made the backup>,
+	    created : <time of the backup>
+	}
+
+Restores need an authenticated client with the admin role.
+
+/spec
+
+Endpoint which returns an OpenAPI 3 description of the REST API. The
+description is assembled from all registered endpoints (including endpoints
+which were added by an embedding application) when it is requested. Endpoints
+describe their paths, parameters and responses with a Describe method (see
+api.EndpointDescriber) - all other endpoints are listed under their URL with
+the methods they support.
 */
 package v1
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"sort"
 	"strconv"
 
+	"devt.de/common/stringutil"
 	"devt.de/eliasdb/api"
 	"devt.de/eliasdb/graph"
 	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/util"
 )
 
 /*
@@ -221,12 +639,18 @@ func (ge *graphEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resou
 
 	// Check parameters
 
-	if !checkResources(w, resources, 3, 5, "Need a partition, entity type (n or e) and a kind; optional key and traversal spec") {
+	if !checkResources(w, r, resources, 3, 5, "Need a partition, entity type (n or e) and a kind; optional key and traversal spec") {
 		return
 	}
 
 	if resources[1] != "n" && resources[1] != "e" {
-		http.Error(w, "Entity type must be n (nodes) or e (edges)", http.StatusBadRequest)
+		api.WriteError(w, r, "Entity type must be n (nodes) or e (edges)", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the client may access the partition
+
+	if !api.Authorize(w, r, resources[0], resources[2]) {
 		return
 	}
 
@@ -250,12 +674,19 @@ func (ge *graphEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resou
 				return
 			}
 
-			it, err := api.GM.NodeKeyIterator(resources[0], resources[2])
+			// Get sorted parameter; false if not set
+
+			sorted, ok := queryParamBool(w, r, "sorted")
+			if !ok {
+				return
+			}
+
+			hasNext, next, err := nodeKeyIterator(resources[0], resources[2], sorted)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				api.WriteError(w, r, err.Error(), graphErrorStatus(err))
 				return
-			} else if it == nil {
-				http.Error(w, "Unknown partition or node kind", http.StatusBadRequest)
+			} else if hasNext == nil {
+				api.WriteError(w, r, "Unknown partition or node kind", http.StatusBadRequest)
 				return
 			}
 
@@ -264,13 +695,13 @@ func (ge *graphEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resou
 			if offset != -1 {
 
 				for i = 0; i < offset; i++ {
-					if !it.HasNext() {
-						http.Error(w, "Offset exceeds available nodes", http.StatusInternalServerError)
+					if !hasNext() {
+						api.WriteError(w, r, "Offset exceeds available nodes", http.StatusInternalServerError)
 						return
 					}
 
-					if it.Next(); it.LastError != nil {
-						http.Error(w, it.LastError.Error(), http.StatusInternalServerError)
+					if _, err := next(); err != nil {
+						api.WriteError(w, r, err.Error(), graphErrorStatus(err))
 						return
 					}
 				}
@@ -288,7 +719,7 @@ func (ge *graphEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resou
 				data = make([]interface{}, 0, limit)
 			}
 
-			for i = offset; it.HasNext(); i++ {
+			for i = offset; hasNext(); i++ {
 
 				// Break out if the limit was reached
 
@@ -296,36 +727,35 @@ func (ge *graphEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resou
 					break
 				}
 
-				key := it.Next()
+				key, err := next()
 
-				if it.LastError != nil {
-					http.Error(w, it.LastError.Error(), http.StatusInternalServerError)
+				if err != nil {
+					api.WriteError(w, r, err.Error(), graphErrorStatus(err))
 					return
 				}
 
 				node, err := api.GM.FetchNode(resources[0], key, resources[2])
 
 				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
+					api.WriteError(w, r, err.Error(), graphErrorStatus(err))
 					return
 				}
 
-				data = append(data, node.Data())
+				data = append(data, node)
 			}
 
 			// Set total count header
 
-			w.Header().Add(HTTPHeaderTotalCount, strconv.FormatUint(api.GM.NodeCount(resources[2]), 10))
+			totalCount := strconv.FormatUint(api.GM.NodeCount(resources[2]), 10)
 
-			// Write data
+			w.Header().Add(HTTPHeaderTotalCount, totalCount)
 
-			w.Header().Set("content-type", "application/json; charset=utf-8")
+			// Write data with a weak entity tag over the list and the total count
 
-			ret := json.NewEncoder(w)
-			ret.Encode(data)
+			writeJSONWithETag(w, r, data, true, totalCount)
 
 		} else {
-			http.Error(w, "Entity type must be n (nodes) when requesting all items", http.StatusBadRequest)
+			api.WriteError(w, r, "Entity type must be n (nodes) when requesting all items", http.StatusBadRequest)
 			return
 		}
 
@@ -333,43 +763,40 @@ func (ge *graphEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resou
 
 		// Fetch a specific node or relationship
 
-		var data map[string]interface{}
+		var obj data.Node
 
 		if resources[1] == "n" {
 
 			node, err := api.GM.FetchNode(resources[0], resources[3], resources[2])
 
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				api.WriteError(w, r, err.Error(), graphErrorStatus(err))
 				return
 			} else if node == nil {
-				http.Error(w, "Unknown partition or node kind", http.StatusBadRequest)
+				api.WriteError(w, r, "Unknown partition or node kind", http.StatusBadRequest)
 				return
 			}
 
-			data = node.Data()
+			obj = node
 
 		} else {
 
 			edge, err := api.GM.FetchEdge(resources[0], resources[3], resources[2])
 
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				api.WriteError(w, r, err.Error(), graphErrorStatus(err))
 				return
 			} else if edge == nil {
-				http.Error(w, "Unknown partition or edge kind", http.StatusBadRequest)
+				api.WriteError(w, r, "Unknown partition or edge kind", http.StatusBadRequest)
 				return
 			}
 
-			data = edge.Data()
+			obj = edge
 		}
 
-		// Write data
+		// Write data with a strong entity tag
 
-		w.Header().Set("content-type", "application/json; charset=utf-8")
-
-		ret := json.NewEncoder(w)
-		ret.Encode(data)
+		writeJSONWithETag(w, r, obj, false)
 
 	} else {
 
@@ -378,10 +805,10 @@ func (ge *graphEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resou
 			node, err := api.GM.FetchNodePart(resources[0], resources[3], resources[2], []string{"key", "kind"})
 
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				api.WriteError(w, r, err.Error(), graphErrorStatus(err))
 				return
 			} else if node == nil {
-				http.Error(w, "Unknown partition or node kind", http.StatusBadRequest)
+				api.WriteError(w, r, "Unknown partition or node kind", http.StatusBadRequest)
 				return
 			}
 
@@ -389,45 +816,72 @@ func (ge *graphEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resou
 				resources[2], resources[4], true)
 
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				api.WriteError(w, r, err.Error(), graphErrorStatus(err))
 				return
 			}
 
-			data := make([][]map[string]interface{}, 2)
+			res := make([][]data.Node, 2)
 
-			dataNodes := make([]map[string]interface{}, 0, len(nodes))
-			dataEdges := make([]map[string]interface{}, 0, len(edges))
+			dataNodes := make([]data.Node, 0, len(nodes))
+			dataEdges := make([]data.Node, 0, len(edges))
 
 			if nodes != nil && edges != nil {
 				for i, n := range nodes {
 					e := edges[i]
 
-					dataNodes = append(dataNodes, n.Data())
-					dataEdges = append(dataEdges, e.Data())
+					dataNodes = append(dataNodes, n)
+					dataEdges = append(dataEdges, e)
 				}
 			}
 
-			data[0] = dataNodes
-			data[1] = dataEdges
+			res[0] = dataNodes
+			res[1] = dataEdges
 
 			// Sort the result
 
-			sort.Stable(&traversalResultComparator{data})
-
-			// Write data
+			sort.Stable(&traversalResultComparator{res})
 
-			w.Header().Set("content-type", "application/json; charset=utf-8")
+			// Write data with a weak entity tag
 
-			ret := json.NewEncoder(w)
-			ret.Encode(data)
+			writeJSONWithETag(w, r, res, true)
 
 		} else {
-			http.Error(w, "Entity type must be n (nodes) when requesting traversal results", http.StatusBadRequest)
+			api.WriteError(w, r, "Entity type must be n (nodes) when requesting traversal results", http.StatusBadRequest)
 			return
 		}
 	}
 }
 
+/*
+nodeKeyIterator creates functions to iterate the node keys of a given kind
+either in hash order or in lexicographic order. Returns nil functions if the
+partition or node kind is unknown.
+*/
+func nodeKeyIterator(part string, kind string, sorted bool) (func() bool, func() (string, error), error) {
+
+	if sorted {
+		it, err := api.GM.SortedNodeKeyIterator(part, kind)
+		if err != nil || it == nil {
+			return nil, nil, err
+		}
+
+		return it.HasNext, func() (string, error) {
+			key := it.Next()
+			return key, it.LastError
+		}, nil
+	}
+
+	it, err := api.GM.NodeKeyIterator(part, kind)
+	if err != nil || it == nil {
+		return nil, nil, err
+	}
+
+	return it.HasNext, func() (string, error) {
+		key := it.Next()
+		return key, it.LastError
+	}, nil
+}
+
 /*
 HandlePUT handles a REST call to insert new elements into the graph or update
 existing elements. Nodes are updated if they already exist. Edges are replaced
@@ -470,6 +924,114 @@ func (ge *graphEndpoint) HandleDELETE(w http.ResponseWriter, r *http.Request, re
 		})
 }
 
+/*
+PatchMaxRetries is the number of times a PATCH request is retried if the node
+was changed by someone else while the patch was applied.
+*/
+var PatchMaxRetries = 10
+
+/*
+HandlePATCH handles a REST call to apply a JSON merge patch (RFC 7386) to a
+node. Attributes with a null value are removed, all other given attributes
+are set. Returns the patched node.
+*/
+func (ge *graphEndpoint) HandlePATCH(w http.ResponseWriter, r *http.Request, resources []string) {
+	var patch map[string]interface{}
+
+	// Check parameters
+
+	if !checkResources(w, r, resources, 4, 4, "Need a partition, entity type (n), a kind and a key") {
+		return
+	}
+
+	if resources[1] != "n" {
+		api.WriteError(w, r, "Entity type must be n (nodes) when patching", http.StatusBadRequest)
+		return
+	}
+
+	part, kind, key := resources[0], resources[2], resources[3]
+
+	// Check if the client may change the partition
+
+	if !api.Authorize(w, r, part, kind) {
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		api.WriteBodyError(w, r, "Could not decode request body as object", err)
+		return
+	} else if patch == nil {
+		api.WriteError(w, r, "Could not decode request body as object", http.StatusBadRequest)
+		return
+	}
+
+	for _, attr := range []string{data.NodeKey, data.NodeKind, data.JSONReservedAttrs} {
+		if _, ok := patch[attr]; ok {
+			api.WriteError(w, r, "Cannot patch reserved attribute "+attr, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Apply the patch in a transaction with conflict detection - the
+	// transaction fails if the node is changed between reading and writing
+	// it and the patch is applied again to the new state
+
+	for i := 0; ; i++ {
+		trans := graph.NewGraphTrans(api.GM)
+		trans.SetConflictDetection(true)
+
+		node, err := trans.FetchNode(part, key, kind)
+		if err != nil {
+			api.WriteError(w, r, err.Error(), graphErrorStatus(err))
+			return
+		} else if node == nil {
+			api.WriteError(w, r, "Unknown node", http.StatusNotFound)
+			return
+		}
+
+		if ok, err := checkWritePrecondition(r, node); err != nil || !ok {
+			if err == nil {
+				api.WriteError(w, r, fmt.Sprintf("Precondition failed for node %v (%v)", key, kind),
+					http.StatusPreconditionFailed)
+			} else {
+				api.WriteError(w, r, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		node = data.NodeMergePatch(node, patch)
+
+		if err := trans.StoreNode(part, node); err != nil {
+			api.WriteError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := trans.Commit(); err != nil {
+			if errors.Is(err, util.ErrTransConflict) && i < PatchMaxRetries {
+				continue
+			}
+
+			api.WriteError(w, r, err.Error(), graphErrorStatus(err))
+			return
+		}
+
+		// Return the patched node and its new entity tag
+
+		res, etag, err := jsonETag(node, false)
+		if err != nil {
+			api.WriteError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("content-type", "application/json; charset=utf-8")
+
+		w.Write(res)
+
+		return
+	}
+}
+
 /*
 handleGraphRequest handles a graph query REST call.
 */
@@ -482,7 +1044,13 @@ func (ge *graphEndpoint) handleGraphRequest(w http.ResponseWriter, r *http.Reque
 
 	// Check parameters
 
-	if !checkResources(w, resources, 1, 2, "Need a partition; optional entity type (n or e)") {
+	if !checkResources(w, r, resources, 1, 2, "Need a partition; optional entity type (n or e)") {
+		return
+	}
+
+	// Check if the client may change the partition
+
+	if !api.Authorize(w, r, resources[0], "") {
 		return
 	}
 
@@ -495,7 +1063,7 @@ func (ge *graphEndpoint) handleGraphRequest(w http.ResponseWriter, r *http.Reque
 		gdata := make(map[string][]map[string]interface{})
 
 		if err := dec.Decode(&gdata); err != nil {
-			http.Error(w, "Could not decode request body as object with list of nodes and/or edges: "+err.Error(), http.StatusBadRequest)
+			api.WriteBodyError(w, r, "Could not decode request body as object with list of nodes and/or edges", err)
 			return
 		}
 
@@ -507,7 +1075,7 @@ func (ge *graphEndpoint) handleGraphRequest(w http.ResponseWriter, r *http.Reque
 		nDataList = make([]map[string]interface{}, 1)
 
 		if err := dec.Decode(&nDataList); err != nil {
-			http.Error(w, "Could not decode request body as list of nodes: "+err.Error(), http.StatusBadRequest)
+			api.WriteBodyError(w, r, "Could not decode request body as list of nodes", err)
 			return
 		}
 	} else if resources[1] == "e" {
@@ -515,7 +1083,7 @@ func (ge *graphEndpoint) handleGraphRequest(w http.ResponseWriter, r *http.Reque
 		eDataList = make([]map[string]interface{}, 1)
 
 		if err := dec.Decode(&eDataList); err != nil {
-			http.Error(w, "Could not decode request body as list of edges: "+err.Error(), http.StatusBadRequest)
+			api.WriteBodyError(w, r, "Could not decode request body as list of edges", err)
 			return
 		}
 	}
@@ -524,15 +1092,62 @@ func (ge *graphEndpoint) handleGraphRequest(w http.ResponseWriter, r *http.Reque
 
 	trans := graph.NewGraphTrans(api.GM)
 
+	// Conditional requests compare the current state of each item with the
+	// given entity tags - conflict detection ensures that nothing was changed
+	// between the comparison and the commit
+
+	ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	conditional := ifMatch != "" || ifNoneMatch != ""
+
+	if conditional {
+
+		if ((ifMatch != "" && ifMatch != "*") || (ifNoneMatch != "" && ifNoneMatch != "*")) &&
+			len(nDataList)+len(eDataList) != 1 {
+			api.WriteError(w, r, "Entity tags in If-Match or If-None-Match require a single node or edge", http.StatusBadRequest)
+			return
+		}
+
+		trans.SetConflictDetection(true)
+	}
+
+	checkPrecondition := func(name string, key string, kind string, current data.Node, err error) bool {
+
+		if err == nil {
+			var ok bool
+
+			if ok, err = checkWritePrecondition(r, current); err == nil && !ok {
+				api.WriteError(w, r, fmt.Sprintf("Precondition failed for %v %v (%v)", name, key, kind),
+					http.StatusPreconditionFailed)
+				return false
+			}
+		}
+
+		if err != nil {
+			api.WriteError(w, r, err.Error(), http.StatusBadRequest)
+			return false
+		}
+
+		return true
+	}
+
 	if nDataList != nil {
 
 		// Store nodes in transaction
 
-		for _, ndata := range nDataList {
-			node := data.NewGraphNodeFromMap(ndata)
+		for i, ndata := range nDataList {
+			node := data.NewGraphNodeFromJSONMap(ndata)
+
+			if conditional {
+				current, err := trans.FetchNode(resources[0], node.Key(), node.Kind())
+
+				if !checkPrecondition("node", node.Key(), node.Kind(), current, err) {
+					return
+				}
+			}
 
 			if err := transFuncNode(trans, resources[0], node); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				api.WriteErrorDetails(w, r, err.Error(), http.StatusBadRequest,
+					validationDetails(fmt.Sprintf("nodes[%v]", i), node, false, err))
 				return
 			}
 		}
@@ -542,24 +1157,163 @@ func (ge *graphEndpoint) handleGraphRequest(w http.ResponseWriter, r *http.Reque
 
 		// Store edges in transaction
 
-		for _, edata := range eDataList {
-			edge := data.NewGraphEdgeFromNode(data.NewGraphNodeFromMap(edata))
+		for i, edata := range eDataList {
+			edge := data.NewGraphEdgeFromNode(data.NewGraphNodeFromJSONMap(edata))
+
+			if conditional {
+				current, err := trans.FetchEdge(resources[0], edge.Key(), edge.Kind())
+
+				if !checkPrecondition("edge", edge.Key(), edge.Kind(), current, err) {
+					return
+				}
+			}
 
 			if err := transFuncEdge(trans, resources[0], edge); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				api.WriteErrorDetails(w, r, err.Error(), http.StatusBadRequest,
+					validationDetails(fmt.Sprintf("edges[%v]", i), edge, true, err))
 				return
 			}
 		}
 	}
 
-	// Commit transaction
+	// Commit transaction - a conflict means that an item of a conditional
+	// request was changed after its precondition was checked
 
 	if err := trans.Commit(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		status := graphErrorStatus(err)
+
+		if conditional && errors.Is(err, util.ErrTransConflict) {
+			status = http.StatusPreconditionFailed
+		}
+
+		api.WriteError(w, r, err.Error(), status)
 		return
 	}
 }
 
+/*
+validationDetails returns the field-level details of an error which was
+caused by invalid node or edge data. Returns nil for all other errors.
+*/
+func validationDetails(field string, item data.Node, isEdge bool, err error) []*api.ErrorDetail {
+	var details []*api.ErrorDetail
+
+	if !errors.Is(err, util.ErrInvalidData) {
+		return nil
+	}
+
+	checkValue := func(attr string, what string, name bool) {
+		val, _ := item.Attr(attr).(string)
+
+		if val == "" {
+			details = append(details, &api.ErrorDetail{Field: field + "." + attr, Message: "Missing " + what})
+		} else if name && !stringutil.IsAlphaNumeric(val) {
+			details = append(details, &api.ErrorDetail{Field: field + "." + attr,
+				Message: "Value can only contain [a-zA-Z0-9_]"})
+		}
+	}
+
+	checkValue(data.NodeKey, "key value", false)
+	checkValue(data.NodeKind, "kind value", true)
+
+	if isEdge {
+		for _, end := range [][]string{
+			{data.EdgeEnd1Key, data.EdgeEnd1Kind, data.EdgeEnd1Role, data.EdgeEnd1Cascading},
+			{data.EdgeEnd2Key, data.EdgeEnd2Kind, data.EdgeEnd2Role, data.EdgeEnd2Cascading},
+		} {
+			checkValue(end[0], "key value", false)
+			checkValue(end[1], "kind value", false)
+			checkValue(end[2], "role value", true)
+
+			if _, ok := item.Attr(end[3]).(bool); !ok {
+				details = append(details, &api.ErrorDetail{Field: field + "." + end[3],
+					Message: "Missing cascading value (must be a boolean)"})
+			}
+		}
+	}
+
+	// Report the error itself if it concerns none of the checked fields
+	// (e.g. invalid attribute names)
+
+	if details == nil {
+		details = append(details, &api.ErrorDetail{Field: field, Message: err.Error()})
+	}
+
+	return details
+}
+
+/*
+Describe describes the endpoint in the API description.
+*/
+func (ge *graphEndpoint) Describe() []*api.EndpointDescription {
+	base := EndpointGraph + "{partition}"
+
+	entityType := &api.ParameterDescription{Name: "entity_type", In: "path",
+		Description: "Datastore entity type - either n for nodes or e for edges."}
+
+	itemSchema := map[string]interface{}{"type": "object"}
+	listSchema := map[string]interface{}{"type": "array", "items": itemSchema}
+
+	writeResponses := []*api.ResponseDescription{
+		{Status: 200, Description: "The data was written."},
+		{Status: 412, Description: "An If-Match or If-None-Match precondition failed."},
+		{Status: 413, Description: "The request body is too large."},
+	}
+
+	return []*api.EndpointDescription{
+		{
+			Path:        base,
+			Methods:     []string{"POST", "PUT", "DELETE"},
+			Summary:     "Store, update or delete a graph of nodes and edges.",
+			Description: "The request body is an object with a list of nodes and a list of edges.",
+			Responses:   writeResponses,
+		},
+		{
+			Path:        base + "/{entity_type}",
+			Methods:     []string{"POST", "PUT", "DELETE"},
+			Summary:     "Store, update or delete a list of nodes or edges.",
+			Description: "The request body is a list of nodes or edges.",
+			Parameters:  []*api.ParameterDescription{entityType},
+			Responses:   writeResponses,
+		},
+		{
+			Path:    base + "/{entity_type}/{kind}",
+			Methods: []string{"GET"},
+			Summary: "Return a list of nodes or edges of a kind.",
+			Description: "The total number of entries is returned in the X-Total-Count header. " +
+				"Lists of edges are not supported.",
+			Parameters: []*api.ParameterDescription{
+				entityType,
+				{Name: "limit", In: "query", Description: "How many list items to return.", Type: "integer"},
+				{Name: "offset", In: "query", Description: "Offset in the dataset.", Type: "integer"},
+				{Name: "sorted", In: "query", Description: "Return nodes in key order.", Type: "boolean"},
+			},
+			Responses: []*api.ResponseDescription{{Status: 200, Description: "A list of nodes.",
+				ContentType: "application/json", Schema: listSchema}},
+		},
+		{
+			Path:       base + "/{entity_type}/{kind}/{key}",
+			Methods:    []string{"GET", "PATCH"},
+			Summary:    "Return or patch a single node or edge.",
+			Parameters: []*api.ParameterDescription{entityType},
+			Responses: []*api.ResponseDescription{
+				{Status: 200, Description: "A node or edge.", ContentType: "application/json",
+					Schema: itemSchema},
+				{Status: 304, Description: "The ETag of the item matches the If-None-Match header."},
+			},
+		},
+		{
+			Path:        base + "/{entity_type}/{kind}/{key}/{traversal_spec}",
+			Methods:     []string{"GET"},
+			Summary:     "Traverse from a node to its neighbours.",
+			Description: "Returns a list of traversed nodes and a list of traversed edges.",
+			Parameters:  []*api.ParameterDescription{entityType},
+			Responses: []*api.ResponseDescription{{Status: 200, Description: "Traversed nodes and edges.",
+				ContentType: "application/json", Schema: map[string]interface{}{"type": "array", "items": listSchema}}},
+		},
+	}
+}
+
 /*
 SwaggerDefs is used to describe the endpoint in swagger.
 */
@@ -617,6 +1371,17 @@ func (ge *graphEndpoint) SwaggerDefs(s map[string]interface{}) {
 		},
 	}
 
+	sortedParam := []map[string]interface{}{
+		map[string]interface{}{
+			"name": "sorted",
+			"in":   "query",
+			"description": "Return nodes in lexicographic key order which is stable " +
+				"between requests. Sorting is considerably slower than the default order.",
+			"required": false,
+			"type":     "boolean",
+		},
+	}
+
 	keyParam := []map[string]interface{}{
 		map[string]interface{}{
 			"name":        "key",
@@ -690,6 +1455,14 @@ func (ge *graphEndpoint) SwaggerDefs(s map[string]interface{}) {
 		},
 	}
 
+	notModified := map[string]interface{}{
+		"description": "The ETag of the data matches the If-None-Match header - no data is returned.",
+	}
+
+	preconditionFailed := map[string]interface{}{
+		"description": "The If-Match or If-None-Match header does not match the current data - nothing was written.",
+	}
+
 	// Add endpoint to insert a graph with nodes and edges
 
 	s["paths"].(map[string]interface{})["/v1/graph/{partition}"] = map[string]interface{}{
@@ -709,6 +1482,7 @@ func (ge *graphEndpoint) SwaggerDefs(s map[string]interface{}) {
 				"200": map[string]interface{}{
 					"description": "No data is returned when data is created.",
 				},
+				"412":     preconditionFailed,
 				"default": defaultError,
 			},
 		},
@@ -733,6 +1507,7 @@ func (ge *graphEndpoint) SwaggerDefs(s map[string]interface{}) {
 				"200": map[string]interface{}{
 					"description": "No data is returned when data is created.",
 				},
+				"412":     preconditionFailed,
 				"default": defaultError,
 			},
 		},
@@ -749,7 +1524,7 @@ func (ge *graphEndpoint) SwaggerDefs(s map[string]interface{}) {
 				"text/plain",
 				"application/json",
 			},
-			"parameters": append(defaultParams, optionalQueryParams...),
+			"parameters": append(append(defaultParams, optionalQueryParams...), sortedParam...),
 			"responses": map[string]interface{}{
 				"200": map[string]interface{}{
 					"description": "The return data is a list of objects",
@@ -760,6 +1535,7 @@ func (ge *graphEndpoint) SwaggerDefs(s map[string]interface{}) {
 						},
 					},
 				},
+				"304":     notModified,
 				"default": defaultError,
 			},
 		},
@@ -783,6 +1559,39 @@ func (ge *graphEndpoint) SwaggerDefs(s map[string]interface{}) {
 						"type": "object",
 					},
 				},
+				"304":     notModified,
+				"default": defaultError,
+			},
+		},
+		"patch": map[string]interface{}{
+			"summary": "Single nodes can be changed by using PATCH requests.",
+			"description": "The request body is a JSON merge patch (RFC 7386). Attributes with a null " +
+				"value are removed, all other given attributes are set. Reserved attributes cannot be patched.",
+			"consumes": []string{
+				"application/merge-patch+json",
+				"application/json",
+			},
+			"produces": []string{
+				"text/plain",
+				"application/json",
+			},
+			"parameters": append(append(defaultParams, keyParam...), map[string]interface{}{
+				"name":        "patch",
+				"in":          "body",
+				"description": "Attributes to set or remove (null).",
+				"required":    true,
+				"schema": map[string]interface{}{
+					"type": "object",
+				},
+			}),
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "The return data is the patched node",
+					"schema": map[string]interface{}{
+						"type": "object",
+					},
+				},
+				"412":     preconditionFailed,
 				"default": defaultError,
 			},
 		},
@@ -814,6 +1623,7 @@ func (ge *graphEndpoint) SwaggerDefs(s map[string]interface{}) {
 						},
 					},
 				},
+				"304":     notModified,
 				"default": defaultError,
 			},
 		},
@@ -823,7 +1633,7 @@ func (ge *graphEndpoint) SwaggerDefs(s map[string]interface{}) {
 // Comparator object to sort traversal results
 
 type traversalResultComparator struct {
-	Data [][]map[string]interface{} // Data to sort
+	Data [][]data.Node // Data to sort
 }
 
 func (c traversalResultComparator) Len() int {
@@ -834,7 +1644,22 @@ func (c traversalResultComparator) Less(i, j int) bool {
 	c1 := c.Data[0][i]
 	c2 := c.Data[0][j]
 
-	return fmt.Sprintf("%v", c1[data.NodeKey]) < fmt.Sprintf("%v", c2[data.NodeKey])
+	if c1.Key() != c2.Key() {
+		return c1.Key() < c2.Key()
+	} else if c1.Kind() != c2.Kind() {
+		return c1.Kind() < c2.Kind()
+	}
+
+	// Order edges to the same node so the result is always the same
+
+	e1 := c.Data[1][i]
+	e2 := c.Data[1][j]
+
+	if e1.Kind() != e2.Kind() {
+		return e1.Kind() < e2.Kind()
+	}
+
+	return e1.Key() < e2.Key()
 }
 
 func (c traversalResultComparator) Swap(i, j int) {
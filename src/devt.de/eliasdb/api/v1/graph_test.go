@@ -11,7 +11,14 @@
 package v1
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
 	"testing"
 
 	"devt.de/eliasdb/api"
@@ -189,6 +196,60 @@ func TestGraphQuery(t *testing.T) {
 		return
 	}
 
+	// Test sorted iteration
+
+	st, _, res = sendTestRequest(queryURL+"/main/n/Song?offset=3&limit=2&sorted=true", "GET", nil)
+	if st != "200 OK" || res != `
+[
+  {
+    "key": "Aria4",
+    "kind": "Song",
+    "name": "Aria4",
+    "ranking": 18
+  },
+  {
+    "key": "DeadSong2",
+    "kind": "Song",
+    "name": "DeadSong2",
+    "ranking": 6
+  }
+]`[1:] {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"/main/n/Song?offset=8&sorted=true", "GET", nil)
+	if st != "200 OK" || res != `
+[
+  {
+    "key": "StrangeSong1",
+    "kind": "Song",
+    "name": "StrangeSong1",
+    "ranking": 5
+  }
+]`[1:] {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"/main/n/Song?offset=700&sorted=true", "GET", nil)
+	if st != "500 Internal Server Error" || res != "Offset exceeds available nodes" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"/main/n/Song?sorted=p", "GET", nil)
+	if st != "400 Bad Request" || res != "Invalid parameter value: sorted should be a boolean" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"/main/n/SSong?sorted=true", "GET", nil)
+	if st != "400 Bad Request" || res != "Unknown partition or node kind" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
 	// Test error cases
 
 	msm := gmMSM.StorageManager("main"+"Song"+graph.StorageSuffixNodes,
@@ -536,6 +597,34 @@ func TestGraphOperation(t *testing.T) {
 	node.SetAttr("kind", "graphtest")
 	node2.SetAttr("kind", "graphtest")
 
+	// Test attribute validation errors
+
+	api.GM.SetAttrValidator(func(attr string) error {
+		if strings.HasPrefix(attr, "_") {
+			return errors.New("Attribute names must not start with an underscore")
+		}
+		return nil
+	})
+
+	node2.SetAttr("_secret", "foo")
+
+	jsonString, err = json.Marshal([]map[string]interface{}{node.Data(), node2.Data()})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main/n", "POST", []byte(jsonString))
+
+	api.GM.SetAttrValidator(nil)
+	delete(node2.Data(), "_secret")
+
+	if st != "400 Bad Request" || res != `GraphError: Invalid data (Node attribute "_secret" is invalid: `+
+		`Attribute names must not start with an underscore)` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
 	jsonString, err = json.Marshal([]map[string]interface{}{node.Data(), node2.Data()})
 	if err != nil {
 		t.Error(err)
@@ -613,7 +702,7 @@ func TestGraphOperation(t *testing.T) {
 
 	st, _, res = sendTestRequest(queryURL+"main/e", "POST", []byte(jsonString))
 
-	if st != "500 Internal Server Error" ||
+	if st != "404 Not Found" ||
 		res != "GraphError: Invalid data (Can't find edge endpoint: foo (graphtest))" {
 		t.Error("Unexpected response:", st, res)
 		return
@@ -773,3 +862,219 @@ func TestGraphOperation(t *testing.T) {
 		return
 	}
 }
+
+func TestGraphErrors(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointGraph
+
+	send := func(body string) (string, string) {
+		req, _ := http.NewRequest("POST", queryURL+"errortest", bytes.NewBufferString(body))
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err.Error(), ""
+		}
+		defer resp.Body.Close()
+
+		res, _ := ioutil.ReadAll(resp.Body)
+
+		return resp.Status, strings.TrimSpace(string(res))
+	}
+
+	// Invalid items are reported with field details
+
+	st, res := send(`{"nodes":[{"key":"a","kind":"Person"},{"name":"b"}]}`)
+
+	if st != "400 Bad Request" || res != `{"code":400,"message":"GraphError: Invalid data (Node is missing a key value)",`+
+		`"details":[{"field":"nodes[1].key","message":"Missing key value"},{"field":"nodes[1].kind","message":"Missing kind value"}]}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, res = send(`{"edges":[{"key":"ab","kind":"Knows","end1key":"a","end1kind":"Person","end1role":"my role",
+  "end1cascading":false,"_reserved":{"end2key":"b","end2kind":"Person","end2role":"friend"}}]}`)
+
+	if st != "400 Bad Request" || res != `{"code":400,"message":"GraphError: Invalid data (Edge role my role is not alphanumeric - can only contain [a-zA-Z0-9_])",`+
+		`"details":[{"field":"edges[0].end1role","message":"Value can only contain [a-zA-Z0-9_]"},`+
+		`{"field":"edges[0].end2cascading","message":"Missing cascading value (must be a boolean)"}]}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Decoding errors have no details
+
+	st, res = send(`[]`)
+
+	if st != "400 Bad Request" || !strings.HasPrefix(res, `{"code":400,"message":"Could not decode request body as object with list of nodes and/or edges: `) {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Large request bodies are rejected
+
+	oldMaxRequestBodySize := api.MaxRequestBodySize
+	api.MaxRequestBodySize = 100
+	defer func() {
+		api.MaxRequestBodySize = oldMaxRequestBodySize
+	}()
+
+	st, res = send(`{"nodes":[{"key":"a","kind":"Person","name":"` + strings.Repeat("a", 100) + `"}]}`)
+
+	if st != "413 Request Entity Too Large" || res != `{"code":413,"message":"Request body is larger than the maximum of 100 bytes"}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+}
+
+func TestGraphPatch(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointGraph
+
+	st, _, res := sendTestRequest(queryURL+"patchtest/n", "POST",
+		[]byte(`[{"key":"1","kind":"Doc","name":"foo","count":1,"meta":{"a":1,"b":2}}]`))
+	if st != "200 OK" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, header, res := sendTestRequest(queryURL+"patchtest/n/Doc/1", "PATCH",
+		[]byte(`{"name":null,"count":2,"meta":{"a":null,"c":3},"tags":["x"]}`))
+
+	if st != "200 OK" || res != `{
+  "count": 2,
+  "key": "1",
+  "kind": "Doc",
+  "meta": {
+    "b": 2,
+    "c": 3
+  },
+  "tags": [
+    "x"
+  ]
+}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// The returned entity tag is the tag of the stored node
+
+	if _, getHeader, res2 := sendTestRequest(queryURL+"patchtest/n/Doc/1", "GET", nil); res2 != res ||
+		header.Get("ETag") == "" || getHeader.Get("ETag") != header.Get("ETag") {
+		t.Error("Unexpected response:", header, getHeader, res2)
+		return
+	}
+
+	// Conditional patches
+
+	req, _ := http.NewRequest("PATCH", queryURL+"patchtest/n/Doc/1", strings.NewReader(`{"count":3}`))
+	req.Header.Set("If-Match", `"foo"`)
+
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusPreconditionFailed {
+		t.Error("Unexpected response:", err, resp.Status)
+		return
+	}
+
+	req, _ = http.NewRequest("PATCH", queryURL+"patchtest/n/Doc/1", strings.NewReader(`{"count":3}`))
+	req.Header.Set("If-Match", header.Get("ETag"))
+
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Error("Unexpected response:", err, resp.Status)
+		return
+	}
+
+	// Concurrent patches of different attributes are all applied
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			if st, _, res := sendTestRequest(queryURL+"patchtest/n/Doc/1", "PATCH",
+				[]byte(fmt.Sprintf(`{"attr%v":%v}`, i, i))); st != "200 OK" {
+				t.Error("Unexpected response:", st, res)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	node, err := api.GM.FetchNode("patchtest", "1", "Doc")
+	if err != nil || len(node.Data()) != 15 || node.Attr("count") != 3.0 {
+		t.Error("Unexpected result:", err, node)
+		return
+	}
+
+	// Test error cases
+
+	for _, tc := range [][]string{
+		{"patchtest/n/Doc/1", `{"key":"2"}`, "400 Bad Request", "Cannot patch reserved attribute key"},
+		{"patchtest/n/Doc/1", `{"_reserved":{"kind":"Foo"}}`, "400 Bad Request", "Cannot patch reserved attribute _reserved"},
+		{"patchtest/n/Doc/1", `[1]`, "400 Bad Request",
+			"Could not decode request body as object: json: cannot unmarshal array into Go value of type map[string]interface {}"},
+		{"patchtest/n/Doc/1", `null`, "400 Bad Request", "Could not decode request body as object"},
+		{"patchtest/n/Doc/2", `{"a":1}`, "404 Not Found", "Unknown node"},
+		{"patchtest/e/Doc/1", `{"a":1}`, "400 Bad Request", "Entity type must be n (nodes) when patching"},
+		{"patchtest/n/Doc", `{"a":1}`, "400 Bad Request", "Need a partition, entity type (n), a kind and a key"},
+	} {
+		if st, _, res := sendTestRequest(queryURL+tc[0], "PATCH", []byte(tc[1])); st != tc[2] || res != tc[3] {
+			t.Error("Unexpected response:", tc, st, res)
+			return
+		}
+	}
+}
+
+func TestGraphHeadOptions(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointGraph
+
+	// HEAD requests return the headers of GET requests
+
+	resp, err := http.Get(queryURL + "main/n/Author/000")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	resp.Body.Close()
+
+	req, _ := http.NewRequest("HEAD", queryURL+"main/n/Author/000", nil)
+
+	head, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	head.Body.Close()
+
+	if head.StatusCode != http.StatusOK || head.Header.Get("ETag") != resp.Header.Get("ETag") ||
+		head.ContentLength != resp.ContentLength || head.ContentLength <= 0 {
+		t.Error("Unexpected response:", head.Status, head.Header, resp.Header)
+		return
+	}
+
+	// Existence checks of unknown nodes
+
+	req, _ = http.NewRequest("HEAD", queryURL+"main/n/Author/xxx", nil)
+
+	if head, err = http.DefaultClient.Do(req); err != nil || head.StatusCode != http.StatusBadRequest {
+		t.Error("Unexpected response:", err, head.Status)
+		return
+	}
+
+	// OPTIONS requests return the supported methods
+
+	req, _ = http.NewRequest("OPTIONS", queryURL+"main/n/Author/000", nil)
+
+	if resp, err = http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNoContent ||
+		resp.Header.Get("Allow") != "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS" {
+		t.Error("Unexpected response:", err, resp.Status, resp.Header)
+		return
+	}
+
+	req, _ = http.NewRequest("OPTIONS", "http://localhost"+TESTPORT+EndpointExport, nil)
+
+	if resp, err = http.DefaultClient.Do(req); err != nil || resp.Header.Get("Allow") != "GET, HEAD, OPTIONS" {
+		t.Error("Unexpected response:", err, resp.Status, resp.Header)
+		return
+	}
+}
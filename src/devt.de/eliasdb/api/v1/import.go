@@ -0,0 +1,316 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"devt.de/eliasdb/api"
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
+)
+
+/*
+EndpointImport is the bulk import endpoint URL (rooted). Handles import/
+*/
+const EndpointImport = api.APIRoot + APIv1 + "/import/"
+
+/*
+ImportBatchSize is the number of nodes and edges which are committed in a
+single transaction during an import.
+*/
+var ImportBatchSize = 1000
+
+/*
+ImportMaxLineSize is the maximum size of a single line of an import.
+*/
+var ImportMaxLineSize = 1024 * 1024
+
+/*
+ImportMaxErrors is the maximum number of line errors which are reported. All
+further errors are only counted.
+*/
+var ImportMaxErrors = 1000
+
+/*
+ImportEndpointInst creates a new endpoint handler.
+*/
+func ImportEndpointInst() api.RestEndpointHandler {
+	return &importEndpoint{}
+}
+
+/*
+Handler object for bulk imports.
+*/
+type importEndpoint struct {
+	*api.DefaultEndpointHandler
+}
+
+/*
+importLineError is the error of a single line of an import.
+*/
+type importLineError struct {
+	Line  int    `json:"line"`  // Number of the line (starting with 1)
+	Error string `json:"error"` // Error message
+}
+
+/*
+importResult is the result of an import.
+*/
+type importResult struct {
+	Nodes      int                `json:"nodes"`       // Number of stored nodes
+	Edges      int                `json:"edges"`       // Number of stored edges
+	ErrorCount int                `json:"error_count"` // Number of errors
+	Errors     []*importLineError `json:"errors"`      // Line errors (up to ImportMaxErrors)
+	Aborted    bool               `json:"aborted"`     // Flag if the import was aborted
+}
+
+/*
+addError records an error of a given line.
+*/
+func (ir *importResult) addError(line int, msg string) {
+	ir.ErrorCount++
+
+	if len(ir.Errors) < ImportMaxErrors {
+		ir.Errors = append(ir.Errors, &importLineError{line, msg})
+	}
+}
+
+/*
+HandlePOST imports nodes and edges from a newline-delimited JSON body. The
+body is read and committed in batches while it streams in.
+*/
+func (ie *importEndpoint) HandlePOST(w http.ResponseWriter, r *http.Request, resources []string) {
+
+	if !checkResources(w, r, resources, 1, 1, "Need a partition") {
+		return
+	}
+
+	part := resources[0]
+
+	if !api.Authorize(w, r, part, "") {
+		return
+	}
+
+	abort, ok := queryParamBool(w, r, "abort")
+	if !ok {
+		return
+	}
+
+	res := &importResult{Errors: []*importLineError{}}
+
+	trans := graph.NewGraphTrans(api.GM)
+	batchStart, batchNodes, batchEdges := 1, 0, 0
+
+	// commit commits the current batch - all lines of a failed batch are
+	// counted as failed
+
+	commit := func(line int) bool {
+		if err := trans.Commit(); err != nil {
+			res.addError(line, fmt.Sprintf("Could not store lines %v-%v: %v", batchStart, line, err))
+			batchNodes, batchEdges = 0, 0
+			return false
+		}
+
+		res.Nodes += batchNodes
+		res.Edges += batchEdges
+		batchStart, batchNodes, batchEdges = line+1, 0, 0
+
+		return true
+	}
+
+	br := bufio.NewReaderSize(r.Body, 64*1024)
+	line := 0
+
+	for {
+		var err error
+		var ldata []byte
+
+		ldata, err = readImportLine(br)
+		if len(ldata) > 0 || err != io.EOF {
+			line++
+		}
+
+		if err != nil && err != io.EOF {
+
+			if err != errImportLineTooLong {
+				res.addError(line, "Could not read request body: "+err.Error())
+				res.Aborted = true
+				break
+			}
+
+			res.addError(line, err.Error())
+
+		} else if ldata = bytes.TrimSpace(ldata); len(ldata) > 0 {
+
+			if lerr := importLine(trans, part, ldata, &batchNodes, &batchEdges); lerr != nil {
+				res.addError(line, lerr.Error())
+			}
+		}
+
+		if abort && res.ErrorCount > 0 {
+			res.Aborted = true
+			break
+		}
+
+		if batchNodes+batchEdges >= ImportBatchSize || (err == io.EOF && batchNodes+batchEdges > 0) {
+			if !commit(line) && abort {
+				res.Aborted = true
+				break
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+
+	if res.Aborted {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	json.NewEncoder(w).Encode(res)
+}
+
+/*
+errImportLineTooLong is returned for lines which are longer than
+ImportMaxLineSize.
+*/
+var errImportLineTooLong = fmt.Errorf("Line is too long")
+
+/*
+readImportLine reads a single line. Lines which are too long are skipped.
+*/
+func readImportLine(br *bufio.Reader) ([]byte, error) {
+	var ret []byte
+
+	for {
+		part, err := br.ReadSlice('\n')
+
+		if len(ret)+len(part) > ImportMaxLineSize {
+
+			// Skip the rest of the line
+
+			for err == bufio.ErrBufferFull {
+				_, err = br.ReadSlice('\n')
+			}
+
+			if err == nil || err == io.EOF {
+				err = errImportLineTooLong
+			}
+
+			return nil, err
+		}
+
+		ret = append(ret, part...)
+
+		if err != bufio.ErrBufferFull {
+			return ret, err
+		}
+	}
+}
+
+/*
+importLine adds the node or edge of a single line to a transaction. Lines can
+have a type attribute with the value node or edge - otherwise objects with
+edge ends are edges.
+*/
+func importLine(trans *graph.Trans, part string, ldata []byte, nodes *int, edges *int) error {
+	var obj map[string]interface{}
+
+	if err := json.Unmarshal(ldata, &obj); err != nil {
+		return fmt.Errorf("Could not decode line as object: %v", err)
+	} else if obj == nil {
+		return fmt.Errorf("Could not decode line as object: %s", ldata)
+	}
+
+	t, _ := obj["type"].(string)
+
+	if t == "node" || t == "edge" {
+		delete(obj, "type")
+	}
+
+	node := data.NewGraphNodeFromJSONMap(obj)
+
+	if t != "node" && (t == "edge" || node.Attr(data.EdgeEnd1Key) != nil || node.Attr(data.EdgeEnd2Key) != nil) {
+
+		if err := trans.StoreEdge(part, data.NewGraphEdgeFromNode(node)); err != nil {
+			return err
+		}
+
+		*edges++
+
+		return nil
+	}
+
+	if err := trans.StoreNode(part, node); err != nil {
+		return err
+	}
+
+	*nodes++
+
+	return nil
+}
+
+/*
+SwaggerDefs is used to describe the endpoint in swagger.
+*/
+func (ie *importEndpoint) SwaggerDefs(s map[string]interface{}) {
+
+	s["paths"].(map[string]interface{})["/v1/import/{partition}"] = map[string]interface{}{
+		"post": map[string]interface{}{
+			"summary": "Import nodes and edges.",
+			"description": "Imports newline-delimited JSON with one node or edge per line. The lines are " +
+				"stored in batches while the request body is read. Request bodies can be compressed with gzip.",
+			"consumes": []string{
+				"application/x-ndjson",
+			},
+			"produces": []string{
+				"text/plain",
+				"application/json",
+			},
+			"parameters": []map[string]interface{}{
+				{
+					"name":        "partition",
+					"in":          "path",
+					"description": "Partition to import into.",
+					"required":    true,
+					"type":        "string",
+				},
+				{
+					"name":        "abort",
+					"in":          "query",
+					"description": "Abort the import on the first error (otherwise all errors are collected).",
+					"required":    false,
+					"type":        "boolean",
+				},
+			},
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "Counts of stored nodes and edges and a list of line errors.",
+				},
+				"default": map[string]interface{}{
+					"description": "Error response",
+					"schema": map[string]interface{}{
+						"$ref": "#/definitions/Error",
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,205 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"devt.de/eliasdb/api"
+)
+
+func TestImport(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointImport
+
+	oldBatchSize := ImportBatchSize
+	ImportBatchSize = 2
+	defer func() {
+		ImportBatchSize = oldBatchSize
+	}()
+
+	lines := `{"key":"1","kind":"Person","name":"Alice"}
+{"type":"node","key":"2","kind":"Person","name":"Bob","end1key":"x"}
+
+{"key":"1","kind":"Knows","end1key":"1","end1kind":"Person","end1role":"Friend","end1cascading":false,"end2key":"2","end2kind":"Person","end2role":"Friend","end2cascading":false}
+{"type":"edge","key":"2","kind":"Knows","end1key":"2","end1kind":"Person","end1role":"Friend","end1cascading":false,"end2key":"1","end2kind":"Person","end2role":"Friend","end2cascading":false}
+{"key":"3","kind":"Person"}
+`
+
+	st, _, res := sendTestRequest(queryURL+"import", "POST", []byte(lines))
+
+	if st != "200 OK" || res != `{
+  "nodes": 3,
+  "edges": 2,
+  "error_count": 0,
+  "errors": [],
+  "aborted": false
+}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	if n, _ := api.GM.FetchNode("import", "2", "Person"); n == nil || n.Attr("end1key") != "x" {
+		t.Error("Unexpected result:", n)
+		return
+	}
+
+	if e, _ := api.GM.FetchEdge("import", "2", "Knows"); e == nil || e.Attr("end1key") != "2" {
+		t.Error("Unexpected result:", e)
+		return
+	}
+
+	// Errors of single lines are collected
+
+	lines = `{"key":"4","kind":"Person"}
+foo
+{"kind":"Person"}
+[1,2]
+{"key":"5","kind":"Person"}`
+
+	st, _, res = sendTestRequest(queryURL+"import", "POST", []byte(lines))
+
+	if st != "200 OK" || res != `{
+  "nodes": 2,
+  "edges": 0,
+  "error_count": 3,
+  "errors": [
+    {
+      "line": 2,
+      "error": "Could not decode line as object: invalid character 'o' in literal false (expecting 'a')"
+    },
+    {
+      "line": 3,
+      "error": "GraphError: Invalid data (Node is missing a key value)"
+    },
+    {
+      "line": 4,
+      "error": "Could not decode line as object: json: cannot unmarshal array into Go value of type map[string]interface {}"
+    }
+  ],
+  "aborted": false
+}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Imports can be aborted on the first error
+
+	st, _, res = sendTestRequest(queryURL+"import?abort=true", "POST", []byte(
+		"{\"key\":\"6\",\"kind\":\"Person\"}\n{\"key\":\"7\",\"kind\":\"Person\"}\n{\"key\":\"8\",\"kind\":\"Person\"}\nfoo\n{\"key\":\"9\",\"kind\":\"Person\"}"))
+
+	if st != "400 Bad Request" || res != `{
+  "nodes": 2,
+  "edges": 0,
+  "error_count": 1,
+  "errors": [
+    {
+      "line": 4,
+      "error": "Could not decode line as object: invalid character 'o' in literal false (expecting 'a')"
+    }
+  ],
+  "aborted": true
+}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	if n, _ := api.GM.FetchNode("import", "9", "Person"); n != nil {
+		t.Error("Unexpected result:", n)
+		return
+	}
+
+	// Long lines are skipped
+
+	oldMaxLineSize := ImportMaxLineSize
+	ImportMaxLineSize = 50
+	defer func() {
+		ImportMaxLineSize = oldMaxLineSize
+	}()
+
+	st, _, res = sendTestRequest(queryURL+"import", "POST", []byte(
+		fmt.Sprintf("{\"key\":\"10\",\"kind\":\"Person\",\"name\":\"%v\"}\n{\"key\":\"11\",\"kind\":\"Person\"}", strings.Repeat("a", 100))))
+
+	if st != "200 OK" || res != `{
+  "nodes": 1,
+  "edges": 0,
+  "error_count": 1,
+  "errors": [
+    {
+      "line": 1,
+      "error": "Line is too long"
+    }
+  ],
+  "aborted": false
+}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Request bodies can be compressed
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	for i := 20; i < 25; i++ {
+		fmt.Fprintf(gz, "{\"key\":\"%v\",\"kind\":\"Person\"}\n", i)
+	}
+	gz.Close()
+
+	req, _ := http.NewRequest("POST", queryURL+"import", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || string(body) != `{"nodes":5,"edges":0,"error_count":0,"errors":[],"aborted":false}`+"\n" {
+		t.Error("Unexpected response:", resp.Status, string(body))
+		return
+	}
+
+	if n, _ := api.GM.FetchNode("import", "24", "Person"); n == nil {
+		t.Error("Unexpected result:", n)
+		return
+	}
+
+	// Test error cases
+
+	st, _, res = sendTestRequest(queryURL, "POST", []byte(lines))
+
+	if st != "400 Bad Request" || res != "Need a partition" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"import?abort=foo", "POST", []byte(lines))
+
+	if st != "400 Bad Request" || res != "Invalid parameter value: abort should be a boolean" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"import/foo", "POST", []byte(lines))
+
+	if st != "400 Bad Request" || res != "Invalid resource specification: foo" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+}
@@ -13,9 +13,12 @@ package v1
 import (
 	"encoding/json"
 	"net/http"
+	"sort"
+	"strconv"
 
 	"devt.de/eliasdb/api"
 	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/util"
 )
 
 /*
@@ -46,26 +49,97 @@ func (ie *indexEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resou
 
 	// Check parameters
 
-	if !checkResources(w, resources, 3, 3, "Need a partition, entity type (n or e) and a kind") {
+	if !checkResources(w, r, resources, 3, 3, "Need a partition, entity type (n or e) and a kind") {
 		return
 	}
 
 	if resources[1] != "n" && resources[1] != "e" {
-		http.Error(w, "Entity type must be n (nodes) or e (edges)", http.StatusBadRequest)
+		api.WriteError(w, r, "Entity type must be n (nodes) or e (edges)", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the client may access the partition
+
+	if !api.Authorize(w, r, resources[0], resources[2]) {
 		return
 	}
 
 	// Check what is queried
 
-	attr := r.URL.Query().Get("attr")
-	if attr == "" {
-		http.Error(w, "Query string for attr (attribute) is required", http.StatusBadRequest)
+	attrs := r.URL.Query()["attr"]
+	if len(attrs) == 0 || attrs[0] == "" {
+		api.WriteError(w, r, "Query string for attr (attribute) is required", http.StatusBadRequest)
 		return
 	}
 
 	phrase := r.URL.Query().Get("phrase")
 	word := r.URL.Query().Get("word")
 	value := r.URL.Query().Get("value")
+	fuzzy := ""
+
+	// A query mode selects the lookup for the query string
+
+	if mode := r.URL.Query().Get("mode"); mode != "" {
+		query := r.URL.Query().Get("query")
+
+		if query == "" {
+			api.WriteError(w, r, "Query string for query is required if a mode is given", http.StatusBadRequest)
+			return
+		}
+
+		phrase, word, value, fuzzy = "", "", "", ""
+
+		switch mode {
+		case "phrase":
+			phrase = query
+		case "word":
+			word = query
+		case "value":
+			value = query
+		case "fuzzy":
+			fuzzy = query
+		default:
+			api.WriteError(w, r, "Mode must be phrase, word, value or fuzzy", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Maximum distance for fuzzy queries - the index caps the distance
+	// (maxdist is an older name of the parameter)
+
+	distParam := "distance"
+	if r.URL.Query().Get(distParam) == "" && r.URL.Query().Get("maxdist") != "" {
+		distParam = "maxdist"
+	}
+
+	maxDist, ok := queryParamPosNum(w, r, distParam)
+	if !ok {
+		return
+	}
+
+	// Flag if phrase queries should return the attribute of each match
+
+	matches, ok := queryParamBool(w, r, "matches")
+	if !ok {
+		return
+	}
+
+	// Check combinations of parameters
+
+	if maxDist != -1 && (fuzzy == "" || phrase != "" || word != "" || value != "") {
+		api.WriteError(w, r, "Parameter "+distParam+" can only be used with fuzzy queries", http.StatusBadRequest)
+		return
+	} else if matches && phrase == "" {
+		api.WriteError(w, r, "Parameter matches can only be used with phrase queries", http.StatusBadRequest)
+		return
+	} else if len(attrs) > 1 && phrase == "" && (fuzzy == "" || word != "" || value != "") {
+		api.WriteError(w, r, "Multiple attributes can only be searched with phrase or fuzzy queries", http.StatusBadRequest)
+		return
+	}
+
+	if maxDist == -1 {
+		maxDist = 1
+	}
 
 	// Get the index query object
 
@@ -78,10 +152,10 @@ func (ie *indexEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resou
 	}
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		api.WriteError(w, r, err.Error(), graphErrorStatus(err))
 		return
 	} else if iq == nil {
-		http.Error(w, "Unknown partition or node kind", http.StatusBadRequest)
+		api.WriteError(w, r, "Unknown partition or node kind", http.StatusBadRequest)
 		return
 	}
 
@@ -91,29 +165,28 @@ func (ie *indexEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resou
 
 	switch {
 	case phrase != "":
-		data, err = iq.LookupPhrase(attr, phrase)
-		if len(data.([]string)) == 0 {
-			data = []string{}
-		}
+		data, err = lookupPhrase(iq, attrs, phrase, matches)
 	case word != "":
-		data, err = iq.LookupWord(attr, word)
+		data, err = iq.LookupWord(attrs[0], word)
 		if len(data.(map[string][]uint64)) == 0 {
 			data = map[string][]uint64{}
 		}
 	case value != "":
-		data, err = iq.LookupValue(attr, value)
+		data, err = iq.LookupValue(attrs[0], value)
 		if len(data.([]string)) == 0 {
 			data = []string{}
 		}
+	case fuzzy != "":
+		data, err = lookupFuzzy(iq, attrs, fuzzy, maxDist)
 	default:
-		http.Error(w, "Query string for either phrase, word or value is required", http.StatusBadRequest)
+		api.WriteError(w, r, "Query string for either phrase, word or value is required", http.StatusBadRequest)
 		return
 	}
 
 	// Check if there was an error
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		api.WriteError(w, r, err.Error(), graphErrorStatus(err))
 		return
 	}
 
@@ -125,6 +198,107 @@ func (ie *indexEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resou
 	ret.Encode(data)
 }
 
+/*
+lookupPhrase finds all nodes where one of the given attributes contains a
+phrase. Returns a sorted list of node keys or, if matches is set, a list of
+matches with the attribute which contains the phrase.
+*/
+func lookupPhrase(iq graph.IndexQuery, attrs []string, phrase string, matches bool) (interface{}, error) {
+	keys := make([]string, 0)
+	res := make([]map[string]interface{}, 0)
+	seen := make(map[string]bool)
+
+	for _, attr := range attrs {
+		attrKeys, err := iq.LookupPhrase(attr, phrase)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range attrKeys {
+			res = append(res, map[string]interface{}{
+				"key":    key,
+				"attr":   attr,
+				"phrase": phrase,
+			})
+
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	if !matches {
+		if len(attrs) > 1 {
+			sort.Strings(keys)
+		}
+		return keys, nil
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i]["key"].(string) < res[j]["key"].(string)
+	})
+
+	return res, nil
+}
+
+/*
+lookupFuzzy finds all words of the given attributes which are within a given
+Levenshtein distance of a word. Returns a list of matches which is sorted by
+distance and word.
+*/
+func lookupFuzzy(iq graph.IndexQuery, attrs []string, word string, maxDist int) (interface{}, error) {
+	res := make([]map[string]interface{}, 0)
+
+	for _, attr := range attrs {
+		matches, err := iq.LookupWordFuzzy(attr, word, maxDist)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range matches {
+			res = append(res, map[string]interface{}{
+				"word":     match.Word,
+				"distance": match.Distance,
+				"keys":     match.Keys,
+				"attr":     attr,
+			})
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i]["distance"] != res[j]["distance"] {
+			return res[i]["distance"].(int) < res[j]["distance"].(int)
+		}
+		return res[i]["word"].(string) < res[j]["word"].(string)
+	})
+
+	return res, nil
+}
+
+/*
+Describe describes the endpoint in the API description.
+*/
+func (ie *indexEndpoint) Describe() []*api.EndpointDescription {
+	return []*api.EndpointDescription{{
+		Path:    EndpointIndexQuery + "{partition}/{entity_type}/{kind}",
+		Summary: "Run an index search.",
+		Parameters: []*api.ParameterDescription{
+			{Name: "entity_type", In: "path", Description: "Either n for nodes or e for edges."},
+			{Name: "attr", In: "query", Description: "Attribute to search (can be repeated).", Required: true},
+			{Name: "mode", In: "query", Description: "Search mode (word, phrase, value or fuzzy)."},
+			{Name: "query", In: "query", Description: "Word, phrase or value to search."},
+			{Name: "word", In: "query", Description: "Word to search."},
+			{Name: "phrase", In: "query", Description: "Phrase to search."},
+			{Name: "value", In: "query", Description: "Attribute value to search."},
+			{Name: "distance", In: "query", Description: "Maximum edit distance of fuzzy searches.", Type: "integer"},
+			{Name: "matches", In: "query", Description: "Return the matches of phrase searches.", Type: "boolean"},
+		},
+		Responses: []*api.ResponseDescription{{Status: 200, Description: "The search result.",
+			ContentType: "application/json"}},
+	}}
+}
+
 /*
 SwaggerDefs is used to describe the endpoint in swagger.
 */
@@ -162,12 +336,51 @@ func (ie *indexEndpoint) SwaggerDefs(s map[string]interface{}) {
 					"type":        "string",
 				},
 				map[string]interface{}{
-					"name":        "attr",
+					"name": "attr",
+					"in":   "query",
+					"description": "Attribute which should contain the word, phrase or value. Phrase and " +
+						"fuzzy queries can search multiple attributes with repeated attr parameters.",
+					"required": true,
+					"type":     "string",
+				},
+				map[string]interface{}{
+					"name": "mode",
+					"in":   "query",
+					"description": "Query mode which is used for the query string. " +
+						"Either phrase, word, value or fuzzy.",
+					"required": false,
+					"type":     "string",
+				},
+				map[string]interface{}{
+					"name":        "query",
 					"in":          "query",
-					"description": "Attribute which should contain the word, phrase or value.",
-					"required":    true,
+					"description": "Word, phrase or value to search for if a query mode is given.",
+					"required":    false,
 					"type":        "string",
 				},
+				map[string]interface{}{
+					"name": "distance",
+					"in":   "query",
+					"description": "Maximum Levenshtein distance for fuzzy queries (default 1). " +
+						"The distance is capped at " + strconv.Itoa(util.MaxFuzzyDistance) + ".",
+					"required": false,
+					"type":     "integer",
+				},
+				map[string]interface{}{
+					"name":        "maxdist",
+					"in":          "query",
+					"description": "Older name of the distance parameter.",
+					"required":    false,
+					"type":        "integer",
+				},
+				map[string]interface{}{
+					"name": "matches",
+					"in":   "query",
+					"description": "Flag if phrase queries should return a list of matches with the " +
+						"attribute which contains the phrase instead of a list of keys.",
+					"required": false,
+					"type":     "boolean",
+				},
 				map[string]interface{}{
 					"name":        "word",
 					"in":          "query",
@@ -192,7 +405,8 @@ func (ie *indexEndpoint) SwaggerDefs(s map[string]interface{}) {
 			},
 			"responses": map[string]interface{}{
 				"200": map[string]interface{}{
-					"description": "A list of keys or when doing a word search a map with node/edge key to word positions.",
+					"description": "A list of keys or when doing a word search a map with node/edge key to word positions. " +
+						"A fuzzy search returns a list of matched words with their distance, their attribute and a map with node/edge key to word positions.",
 				},
 				"default": map[string]interface{}{
 					"description": "Error response",
@@ -14,7 +14,9 @@ import (
 	"strings"
 	"testing"
 
+	"devt.de/eliasdb/api"
 	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
 	"devt.de/eliasdb/storage"
 )
 
@@ -87,6 +89,77 @@ func TestIndexQuery(t *testing.T) {
 		return
 	}
 
+	_, _, res = sendTestRequest(queryURL+"//main/n/Song?attr=name&mode=phrase&query=ARIA1", "GET", nil)
+	if res != `
+[
+  "Aria1"
+]`[1:] {
+		t.Error("Unexpected response:", res)
+		return
+	}
+
+	_, _, res = sendTestRequest(queryURL+"//main/n/Song?attr=name&mode=value&query=Aria1&phrase=Aria2", "GET", nil)
+	if res != `
+[
+  "Aria1"
+]`[1:] {
+		t.Error("Unexpected response:", res)
+		return
+	}
+
+	_, _, res = sendTestRequest(queryURL+"//main/n/Song?attr=name&mode=word&query=Aria1", "GET", nil)
+	if res != `
+{
+  "Aria1": [
+    1
+  ]
+}`[1:] {
+		t.Error("Unexpected response:", res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"//main/n/Song?attr=name&mode=phrase", "GET", nil)
+	if st != "400 Bad Request" || res != "Query string for query is required if a mode is given" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"//main/n/Song?attr=name&mode=foo&query=Aria1", "GET", nil)
+	if st != "400 Bad Request" || res != "Mode must be phrase, word, value or fuzzy" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	_, _, res = sendTestRequest(queryURL+"//main/n/Song?attr=name&mode=fuzzy&query=Aira1&maxdist=2", "GET", nil)
+	if res != `
+[
+  {
+    "attr": "name",
+    "distance": 2,
+    "keys": {
+      "Aria1": [
+        1
+      ]
+    },
+    "word": "aria1"
+  }
+]`[1:] {
+		t.Error("Unexpected response:", res)
+		return
+	}
+
+	_, _, res = sendTestRequest(queryURL+"//main/n/Song?attr=name&mode=fuzzy&query=Aira1", "GET", nil)
+	if res != "[]" {
+		t.Error("Unexpected response:", res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"//main/n/Song?attr=name&mode=fuzzy&query=Aira1&maxdist=x", "GET", nil)
+	if st != "400 Bad Request" || res != "Invalid parameter value: maxdist should be a positive integer number" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
 	_, _, res = sendTestRequest(queryURL+"//main/n/Song?attr=name&word=Aria1", "GET", nil)
 	if res != `
 {
@@ -144,3 +217,118 @@ func TestIndexQuery(t *testing.T) {
 	delete(msm.AccessMap, 1)
 
 }
+
+func TestIndexQueryModes(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointIndexQuery
+
+	for _, doc := range [][]string{
+		{"a", "red fox jumps", "the quick brown fox"},
+		{"b", "lazy dog", "red fox jumps high"},
+		{"c", "brown fox", "nothing"},
+	} {
+		node := data.NewGraphNode()
+		node.SetAttr("key", doc[0])
+		node.SetAttr("kind", "Doc")
+		node.SetAttr("title", doc[1])
+		node.SetAttr("text", doc[2])
+
+		if err := api.GM.StoreNode("indextest", node); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	st, _, res := sendTestRequest(queryURL+"indextest/n/Doc?attr=title&attr=text&mode=phrase&query=red+fox", "GET", nil)
+	if st != "200 OK" || res != `
+[
+  "a",
+  "b"
+]`[1:] {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"indextest/n/Doc?attr=title&attr=text&mode=phrase&query=red+fox&matches=true", "GET", nil)
+	if st != "200 OK" || res != `
+[
+  {
+    "attr": "title",
+    "key": "a",
+    "phrase": "red fox"
+  },
+  {
+    "attr": "text",
+    "key": "b",
+    "phrase": "red fox"
+  }
+]`[1:] {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"indextest/n/Doc?attr=title&attr=text&mode=fuzzy&query=fax&distance=1", "GET", nil)
+	if st != "200 OK" || res != `
+[
+  {
+    "attr": "title",
+    "distance": 1,
+    "keys": {
+      "a": [
+        2
+      ],
+      "c": [
+        2
+      ]
+    },
+    "word": "fox"
+  },
+  {
+    "attr": "text",
+    "distance": 1,
+    "keys": {
+      "a": [
+        4
+      ],
+      "b": [
+        2
+      ]
+    },
+    "word": "fox"
+  }
+]`[1:] {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Test invalid combinations of parameters
+
+	st, _, res = sendTestRequest(queryURL+"indextest/n/Doc?attr=title&mode=phrase&query=red+fox&distance=1", "GET", nil)
+	if st != "400 Bad Request" || res != "Parameter distance can only be used with fuzzy queries" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"indextest/n/Doc?attr=title&word=fox&maxdist=1", "GET", nil)
+	if st != "400 Bad Request" || res != "Parameter maxdist can only be used with fuzzy queries" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"indextest/n/Doc?attr=title&mode=fuzzy&query=fox&matches=true", "GET", nil)
+	if st != "400 Bad Request" || res != "Parameter matches can only be used with phrase queries" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"indextest/n/Doc?attr=title&attr=text&mode=value&query=brown+fox", "GET", nil)
+	if st != "400 Bad Request" || res != "Multiple attributes can only be searched with phrase or fuzzy queries" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"indextest/n/Doc?attr=title&mode=phrase&query=fox&matches=x", "GET", nil)
+	if st != "400 Bad Request" || res != "Invalid parameter value: matches should be a boolean" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+}
@@ -13,6 +13,7 @@ package v1
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 
 	"devt.de/eliasdb/api"
 )
@@ -41,6 +42,15 @@ HandleGET handles a search query REST call.
 */
 func (ie *infoEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
 
+	if len(resources) > 0 {
+		if resources[0] == "partitions" {
+			ie.handlePartitions(w, r, resources)
+		} else {
+			ie.handleStatistics(w, r, resources)
+		}
+		return
+	}
+
 	data := make(map[string]interface{})
 
 	// Get information
@@ -67,6 +77,86 @@ func (ie *infoEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resour
 
 	data["edge_counts"] = ecs
 
+	kms := make(map[string]interface{})
+	for _, kind := range api.GM.KindMetaKinds() {
+		if meta := api.GM.KindMeta(kind); meta != nil {
+			kms[kind] = map[string]interface{}{
+				"label":       meta.Label,
+				"description": meta.Description,
+				"attr_labels": meta.AttrLabels,
+			}
+		}
+	}
+
+	data["kind_meta"] = kms
+
+	// Write data
+
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+
+	ret := json.NewEncoder(w)
+	ret.Encode(data)
+}
+
+/*
+handleStatistics handles a statistics query REST call.
+*/
+func (ie *infoEndpoint) handleStatistics(w http.ResponseWriter, r *http.Request, resources []string) {
+
+	// Check parameters
+
+	if resources[0] != "statistics" {
+		api.WriteError(w, r, "Invalid resource specification: "+strings.Join(resources, "/"), http.StatusBadRequest)
+		return
+	}
+
+	if !checkResources(w, r, resources, 2, 2, "Need a partition") {
+		return
+	}
+
+	if !api.Authorize(w, r, resources[1], "") {
+		return
+	}
+
+	stats, err := api.GM.Statistics(resources[1])
+	if err != nil {
+		api.WriteError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Convert the statistics into a key-value map
+
+	nks := make(map[string]interface{})
+	for kind, nk := range stats.NodeKinds {
+
+		attrs := make(map[string]interface{})
+		for attr, as := range nk.Attrs {
+			attrs[attr] = map[string]interface{}{
+				"distinct": as.Distinct,
+				"null":     as.Null,
+			}
+		}
+
+		nks[kind] = map[string]interface{}{
+			"count": nk.Count,
+			"attrs": attrs,
+		}
+	}
+
+	eks := make(map[string]interface{})
+	for kind, ek := range stats.EdgeKinds {
+		eks[kind] = map[string]interface{}{
+			"count":     ek.Count,
+			"end_kinds": ek.EndKinds,
+		}
+	}
+
+	data := map[string]interface{}{
+		"partition":  stats.Partition,
+		"node_kinds": nks,
+		"edge_kinds": eks,
+	}
+
 	// Write data
 
 	w.Header().Set("content-type", "application/json; charset=utf-8")
@@ -75,6 +165,157 @@ func (ie *infoEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resour
 	ret.Encode(data)
 }
 
+/*
+handlePartitions handles a partition listing REST call. Only partitions which
+the client may read are listed.
+*/
+func (ie *infoEndpoint) handlePartitions(w http.ResponseWriter, r *http.Request, resources []string) {
+	var data interface{}
+
+	if !checkResources(w, r, resources, 1, 2, "Need a partition") {
+		return
+	}
+
+	if len(resources) == 2 {
+
+		if !api.Authorize(w, r, resources[1], "") {
+			return
+		}
+
+		if !partitionExists(resources[1]) {
+			api.WriteError(w, r, "Unknown partition: "+resources[1], http.StatusNotFound)
+			return
+		}
+
+		data = partitionData(resources[1])
+
+	} else {
+		p := api.PrincipalFromContext(r.Context())
+		parts := make([]interface{}, 0)
+
+		for _, part := range api.GM.Partitions() {
+			if authz := api.Authz; authz == nil || authz.Authorize(p, "GET", part, "") {
+				parts = append(parts, partitionData(part))
+			}
+		}
+
+		data = map[string]interface{}{
+			"partitions": parts,
+		}
+	}
+
+	// Write data
+
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+
+	ret := json.NewEncoder(w)
+	ret.Encode(data)
+}
+
+/*
+partitionExists checks if a partition is known to the datastore.
+*/
+func partitionExists(part string) bool {
+	for _, p := range api.GM.Partitions() {
+		if p == part {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+partitionData returns the kinds of a partition with their counts. Counts are
+read from maintained counters - a count is nil if no counter is available.
+Kinds without data in the partition are not listed.
+*/
+func partitionData(part string) map[string]interface{} {
+	var nodeCount, edgeCount interface{} = uint64(0), uint64(0)
+
+	kindData := func(kinds []string, count func(string, string) (uint64, bool),
+		attrs func(string) []string, total *interface{}) map[string]interface{} {
+
+		ret := make(map[string]interface{})
+
+		for _, kind := range kinds {
+			var kindCount interface{}
+
+			cnt, ok := count(part, kind)
+
+			if ok && cnt == 0 {
+				continue
+			} else if ok {
+				kindCount = cnt
+			}
+
+			// The total is unknown if the count of a kind is unknown
+
+			if *total != nil && ok {
+				*total = (*total).(uint64) + cnt
+			} else {
+				*total = nil
+			}
+
+			ret[kind] = map[string]interface{}{
+				"count":    kindCount,
+				"attrs":    attrs(kind),
+				"indexing": api.GM.IndexingEnabled(part, kind),
+			}
+		}
+
+		return ret
+	}
+
+	return map[string]interface{}{
+		"name":       part,
+		"node_kinds": kindData(api.GM.NodeKinds(), api.GM.PartitionNodeCount, api.GM.NodeAttrs, &nodeCount),
+		"edge_kinds": kindData(api.GM.EdgeKinds(), api.GM.PartitionEdgeCount, api.GM.EdgeAttrs, &edgeCount),
+		"node_count": nodeCount,
+		"edge_count": edgeCount,
+	}
+}
+
+/*
+Describe describes the endpoint in the API description.
+*/
+func (ie *infoEndpoint) Describe() []*api.EndpointDescription {
+	return []*api.EndpointDescription{
+		{
+			Path:    strings.TrimSuffix(EndpointInfoQuery, "/"),
+			Summary: "Return general datastore information.",
+			Responses: []*api.ResponseDescription{
+				{Status: 200, Description: "Partitions and kinds of the datastore.", ContentType: "application/json",
+					Schema: map[string]interface{}{"type": "object"}},
+			},
+		},
+		{
+			Path:    EndpointInfoQuery + "partitions",
+			Summary: "Return all partitions with the kinds and counts of their data.",
+			Responses: []*api.ResponseDescription{
+				{Status: 200, Description: "Partitions of the datastore.", ContentType: "application/json",
+					Schema: map[string]interface{}{"type": "object"}},
+			},
+		},
+		{
+			Path:    EndpointInfoQuery + "partitions/{partition}",
+			Summary: "Return the kinds and counts of the data in a partition.",
+			Responses: []*api.ResponseDescription{
+				{Status: 200, Description: "Kinds of the partition.", ContentType: "application/json",
+					Schema: map[string]interface{}{"type": "object"}},
+				{Status: 404, Description: "The partition does not exist."},
+			},
+		},
+		{
+			Path:    EndpointInfoQuery + "statistics/{partition}",
+			Summary: "Return statistics about the data in a partition.",
+			Responses: []*api.ResponseDescription{
+				{Status: 200, Description: "Statistics of the partition.", ContentType: "application/json",
+					Schema: map[string]interface{}{"type": "object"}},
+			},
+		},
+	}
+}
+
 /*
 SwaggerDefs is used to describe the endpoint in swagger.
 */
@@ -83,7 +324,29 @@ func (ie *infoEndpoint) SwaggerDefs(s map[string]interface{}) {
 	s["paths"].(map[string]interface{})["/v1/info"] = map[string]interface{}{
 		"get": map[string]interface{}{
 			"summary":     "Return general datastore information.",
-			"description": "The info endpoint returns general database information such as known node kinds, known attributes, etc .",
+			"description": "The info endpoint returns general database information such as known node kinds, known attributes, etc . Display labels and descriptions of kinds are returned under kind_meta.",
+			"produces": []string{
+				"text/plain",
+				"application/json",
+			},
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "A key-value map.",
+				},
+				"default": map[string]interface{}{
+					"description": "Error response",
+					"schema": map[string]interface{}{
+						"$ref": "#/definitions/Error",
+					},
+				},
+			},
+		},
+	}
+
+	s["paths"].(map[string]interface{})["/v1/info/partitions"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary":     "Return all partitions with the kinds and counts of their data.",
+			"description": "The partitions endpoint returns all partitions which the client may read. The node and edge kinds of each partition are returned with their counts, known attributes and if they are indexed. Counts are null if they are not available.",
 			"produces": []string{
 				"text/plain",
 				"application/json",
@@ -102,6 +365,68 @@ func (ie *infoEndpoint) SwaggerDefs(s map[string]interface{}) {
 		},
 	}
 
+	s["paths"].(map[string]interface{})["/v1/info/partitions/{partition}"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary":     "Return the kinds and counts of the data in a partition.",
+			"description": "The node and edge kinds of the partition are returned with their counts, known attributes and if they are indexed. Counts are null if they are not available.",
+			"produces": []string{
+				"text/plain",
+				"application/json",
+			},
+			"parameters": []map[string]interface{}{
+				map[string]interface{}{
+					"name":        "partition",
+					"in":          "path",
+					"description": "Partition to select.",
+					"required":    true,
+					"type":        "string",
+				},
+			},
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "A key-value map.",
+				},
+				"default": map[string]interface{}{
+					"description": "Error response",
+					"schema": map[string]interface{}{
+						"$ref": "#/definitions/Error",
+					},
+				},
+			},
+		},
+	}
+
+	s["paths"].(map[string]interface{})["/v1/info/statistics/{partition}"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary":     "Return statistics about the data in a partition.",
+			"description": "The statistics endpoint returns node and edge counts per kind, approximate distinct value and null counts per node attribute and the end kinds of edges.",
+			"produces": []string{
+				"text/plain",
+				"application/json",
+			},
+			"parameters": []map[string]interface{}{
+				map[string]interface{}{
+					"name":        "partition",
+					"in":          "path",
+					"description": "Partition to select.",
+					"required":    true,
+					"type":        "string",
+				},
+			},
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "A key-value map.",
+				},
+				"default": map[string]interface{}{
+					"description": "Error response",
+					"schema": map[string]interface{}{
+						"$ref": "#/definitions/Error",
+					},
+				},
+			},
+		},
+	}
+
 	// Add generic error object to definition
 
 	s["definitions"].(map[string]interface{})["Error"] = map[string]interface{}{
@@ -10,7 +10,16 @@
 
 package v1
 
-import "testing"
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"devt.de/eliasdb/api"
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
+)
 
 func TestInfoQuery(t *testing.T) {
 	queryURL := "http://localhost" + TESTPORT + EndpointInfoQuery
@@ -23,4 +32,153 @@ func TestInfoQuery(t *testing.T) {
 		t.Error("Unexpected response:", st, res)
 		return
 	}
+
+	// Kind metadata is exposed
+
+	api.GM.SetKindMeta("usr", &graph.KindMeta{Label: "User account", Description: "Account of a user",
+		AttrLabels: map[string]string{"lastlogin": "Last login"}})
+	defer api.GM.SetKindMeta("usr", nil)
+
+	st, _, res = sendTestRequest(queryURL, "GET", nil)
+	if st != "200 OK" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	var info map[string]interface{}
+	json.Unmarshal([]byte(res), &info)
+
+	if km := fmt.Sprint(info["kind_meta"]); km != "map[usr:map[attr_labels:map[lastlogin:Last login] "+
+		"description:Account of a user label:User account]]" {
+		t.Error("Unexpected response:", km)
+		return
+	}
+}
+
+func TestInfoStatisticsQuery(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointInfoQuery
+
+	st, _, res := sendTestRequest(queryURL+"statistics/main", "GET", nil)
+	if st != "200 OK" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	var stats map[string]interface{}
+	json.Unmarshal([]byte(res), &stats)
+
+	if spam := fmt.Sprint(stats["node_kinds"].(map[string]interface{})["Spam"]); spam != "map[attrs:map[name:map[distinct:21 null:0]] count:21]" {
+		t.Error("Unexpected response:", spam)
+		return
+	}
+
+	if wrote := fmt.Sprint(stats["edge_kinds"].(map[string]interface{})["Wrote"]); wrote != "map[count:9 end_kinds:map[Author:Song:9]]" {
+		t.Error("Unexpected response:", wrote)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"statistics/xxx", "GET", nil)
+	if st != "200 OK" || res != `{
+  "edge_kinds": {},
+  "node_kinds": {},
+  "partition": "xxx"
+}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"statistics/my main", "GET", nil)
+	if st != "400 Bad Request" || res != "GraphError: Invalid data (Partition name my main is not alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"statistics", "GET", nil)
+	if st != "400 Bad Request" || res != "Need a partition" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"foo/main", "GET", nil)
+	if st != "400 Bad Request" || res != "Invalid resource specification: foo/main" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+}
+
+func TestInfoPartitionsQuery(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointInfoQuery
+
+	for i := 0; i < 3; i++ {
+		node := data.NewGraphNode()
+		node.SetAttr("key", fmt.Sprint(i))
+		node.SetAttr("kind", "InfoNode")
+		node.SetAttr("name", fmt.Sprint("node", i))
+		api.GM.StoreNode("infotest", node)
+	}
+
+	api.GM.SetIndexingEnabled("infotest", "InfoNode", false)
+
+	st, _, res := sendTestRequest(queryURL+"partitions/infotest", "GET", nil)
+	if st != "200 OK" || res != `{
+  "edge_count": 0,
+  "edge_kinds": {},
+  "name": "infotest",
+  "node_count": 3,
+  "node_kinds": {
+    "InfoNode": {
+      "attrs": [
+        "key",
+        "kind",
+        "name"
+      ],
+      "count": 3,
+      "indexing": false
+    }
+  }
+}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// All partitions are listed
+
+	st, _, res = sendTestRequest(queryURL+"partitions", "GET", nil)
+
+	var parts map[string]interface{}
+	json.Unmarshal([]byte(res), &parts)
+
+	found := false
+	for _, p := range parts["partitions"].([]interface{}) {
+		if p.(map[string]interface{})["name"] == "infotest" {
+			found = true
+		}
+	}
+
+	if st != "200 OK" || !found {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Counts which are not maintained are null
+
+	delete(gmMSM.MainDB(), graph.MainDBPartNodeCount+"infotest/InfoNode")
+
+	st, _, res = sendTestRequest(queryURL+"partitions/infotest", "GET", nil)
+	if st != "200 OK" || !strings.Contains(res, `"node_count": null`) || !strings.Contains(res, `"count": null`) {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"partitions/infotestxxx", "GET", nil)
+	if st != "404 Not Found" || res != "Unknown partition: infotestxxx" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"partitions/infotest/foo", "GET", nil)
+	if st != "400 Bad Request" || res != "Invalid resource specification: infotest/foo" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
 }
@@ -11,10 +11,15 @@
 package v1
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"devt.de/common/datautil"
 	"devt.de/common/stringutil"
@@ -32,171 +37,1047 @@ ResultCacheMaxAge is the maximum age a result cache entry can have in seconds
 */
 var ResultCacheMaxAge int64
 
+/*
+QueryTimeout is the default time in seconds a query may run (0 means no
+timeout). Queries are also stopped if the client closes the connection.
+*/
+var QueryTimeout int64
+
+/*
+QueryMaxNodes is the maximum number of nodes a query may visit - this includes
+the nodes of scans and traversals (0 means no limit).
+*/
+var QueryMaxNodes int
+
+/*
+QueryMaxRows is the maximum number of result rows a query may produce (0 means
+no limit).
+*/
+var QueryMaxRows int
+
 /*
 ResultCache is a cache for result sets (by default no expiry and no limit)
 */
 var ResultCache *datautil.MapCache
 
 /*
-idCount is an ID counter for results
+cachedResult is a result set in the result cache. A cached result can only be
+requested for the partition it was queried on.
+*/
+type cachedResult struct {
+	eql.SearchResult        // Cached result
+	part             string // Queried partition
+	total            int    // Number of all rows of the result
+}
+
+/*
+QueryCacheMaxSize is the maximum number of parsed queries which are kept in the
+query cache (0 disables the query cache)
+*/
+var QueryCacheMaxSize uint64 = 100
+
+/*
+QueryCache is a cache for parsed queries keyed by partition and query text. The
+least recently used query is removed if the cache is full (nil if the query
+cache is disabled).
+*/
+var QueryCache *datautil.LRUCache
+
+/*
+idCount is an ID counter for results
+*/
+var idCount = time.Now().Unix()
+
+/*
+EndpointQuery is the query endpoint URL (rooted). Handles everything under query/...
+*/
+const EndpointQuery = api.APIRoot + APIv1 + "/query/"
+
+/*
+QueryEndpointInst creates a new endpoint handler.
+*/
+func QueryEndpointInst() api.RestEndpointHandler {
+
+	// Init the result cache if necessary
+
+	if ResultCache == nil {
+		ResultCache = datautil.NewMapCache(ResultCacheMaxSize, ResultCacheMaxAge)
+	}
+
+	// Init the cursor cache if necessary
+
+	if CursorCache == nil {
+		CursorCache = datautil.NewMapCache(QueryCursorMaxCount, QueryCursorTTL)
+	}
+
+	// Init the query cache if necessary
+
+	if QueryCache == nil && QueryCacheMaxSize > 0 {
+		QueryCache = datautil.NewLRUCache(QueryCacheMaxSize)
+	}
+
+	return &queryEndpoint{}
+}
+
+/*
+Handler object for search queries.
+*/
+type queryEndpoint struct {
+	*api.DefaultEndpointHandler
+}
+
+/*
+HandleGET handles a search query REST call.
+*/
+func (eq *queryEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
+
+	// Check parameters
+
+	if !checkResources(w, r, resources, 1, 1, "Need a partition") {
+		return
+	}
+
+	// Check if the client may query the partition - queries, cached results
+	// and cursors are always scoped to the partition of the request
+
+	if !api.Authorize(w, r, resources[0], "") {
+		return
+	}
+
+	// Get limit parameter; -1 if not set
+
+	limit, ok := queryParamPosNum(w, r, "limit")
+	if !ok {
+		return
+	}
+
+	// Get offset parameter; -1 if not set
+
+	offset, ok := queryParamPosNum(w, r, "offset")
+	if !ok {
+		return
+	}
+
+	// Check if the result should be written as CSV
+
+	csvOpts, isCSV, ok := csvParams(w, r)
+	if !ok {
+		return
+	}
+
+	// Get highlight parameter; false if not set
+
+	highlight, ok := queryParamBool(w, r, "highlight")
+	if !ok {
+		return
+	} else if highlight && isCSV {
+		api.WriteError(w, r, "Highlight parameter cannot be combined with CSV or TSV format", http.StatusBadRequest)
+		return
+	}
+
+	// Get stats parameter; false if not set
+
+	stats, ok := queryParamBool(w, r, "stats")
+	if !ok {
+		return
+	} else if stats && isCSV {
+		api.WriteError(w, r, "Stats parameter cannot be combined with CSV or TSV format", http.StatusBadRequest)
+		return
+	}
+
+	// See if a result id was given
+
+	resID := r.URL.Query().Get("rid")
+	if resID != "" {
+
+		cres, ok := ResultCache.Get(resID)
+		if !ok || cres.(*cachedResult).part != resources[0] {
+			api.WriteError(w, r, "Unknown result id (rid parameter)", http.StatusBadRequest)
+			return
+		}
+
+		res := cres.(*cachedResult)
+
+		if isCSV {
+			eq.writeResultCSV(w, res, csvFilename(r, resources[0]), csvOpts, offset, limit, res.total)
+			return
+		}
+
+		// The total of a paged cached result is the number of all its rows
+
+		total := -1
+		if offset != -1 || limit != -1 {
+			total = res.total
+		}
+
+		eq.writeResultData(w, res, resID, offset, limit, total, highlight, stats)
+		return
+	}
+
+	// See if the next page of a server-side cursor is requested
+
+	if cursorID := r.URL.Query().Get("cursor_id"); cursorID != "" {
+
+		if isCSV {
+			api.WriteError(w, r, "Cursor id parameter cannot be combined with CSV or TSV format", http.StatusBadRequest)
+			return
+		}
+
+		eq.writeCursorPage(w, r, resources[0], cursorID, limit, stats)
+		return
+	}
+
+	// Run the query
+
+	query := r.URL.Query().Get("q")
+	part := resources[0]
+
+	if query == "" {
+		api.WriteError(w, r, "Missing query (q parameter)", http.StatusBadRequest)
+		return
+	}
+
+	// Get validate parameter; false if not set - the query is only validated
+	// and the validation result is returned instead of data
+
+	validate, ok := queryParamBool(w, r, "validate")
+	if !ok {
+		return
+	} else if validate {
+		eq.writeValidationResult(w, r, query)
+		return
+	}
+
+	// Statements which change the graph cannot be run with a GET request
+
+	if eql.IsMutation(query) {
+		api.WriteError(w, r, "Delete and update statements are not supported by the query endpoint", http.StatusBadRequest)
+		return
+	}
+
+	// Get sorted parameter; false if not set
+
+	sorted, ok := queryParamBool(w, r, "sorted")
+	if !ok {
+		return
+	}
+
+	// Get sample parameter; -1 if not set
+
+	sample, ok := queryParamPosNum(w, r, "sample")
+	if !ok {
+		return
+	} else if sample == 0 {
+		api.WriteError(w, r, "Invalid parameter value: sample should be greater than 0", http.StatusBadRequest)
+		return
+	}
+
+	// A cursor continues after the last row of a previous result of the
+	// same query - start nodes are always visited in key order
+
+	cursor := r.URL.Query().Get("cursor")
+
+	// A server-side cursor keeps the result of the query so it can be
+	// returned page by page - the limit parameter is the size of a page
+
+	serverCursor := cursor == "true"
+	if serverCursor {
+		if isCSV {
+			api.WriteError(w, r, "Cursor mode cannot be combined with CSV or TSV format", http.StatusBadRequest)
+			return
+		}
+		cursor = ""
+
+	} else if cursor != "" {
+		if offset != -1 || sample > 0 {
+			api.WriteError(w, r, "Cursor parameter cannot be combined with offset or sample parameter", http.StatusBadRequest)
+			return
+		}
+		sorted = true
+	}
+
+	// Paging parameters select a page of the rows which are selected by the
+	// limit and offset clauses of the query
+
+	var page *eql.Page
+
+	if (limit != -1 && !serverCursor) || offset != -1 {
+		page = &eql.Page{Offset: 0, Limit: -1}
+
+		if limit != -1 && !serverCursor {
+			page.Limit = limit
+		}
+
+		if offset != -1 {
+			page.Offset = offset
+		}
+	}
+
+	// The query is cancelled if the client disconnects or the timeout expires
+
+	ctx := r.Context()
+
+	if QueryTimeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(QueryTimeout)*time.Second)
+		defer cancel()
+	}
+
+	// All rows of a paged query are counted so the total can be returned -
+	// results with a cursor stop once the limit is reached
+
+	paged := (limit != -1 || offset != -1) && cursor == "" && !serverCursor
+
+	opts := eql.RunOptions{Sorted: sorted, Sample: sample, Cursor: cursor, Highlight: highlight,
+		MaxNodes: QueryMaxNodes, MaxRows: QueryMaxRows, CountTotal: paged, Page: page}
+
+	if serverCursor && QueryCursorMaxRows > 0 && (opts.MaxRows == 0 || QueryCursorMaxRows < opts.MaxRows) {
+		opts.MaxRows = QueryCursorMaxRows
+	}
+
+	// CSV results are always streamed
+
+	if isCSV {
+		eq.streamResultCSV(ctx, w, r, part, query, opts, csvOpts)
+		return
+	}
+
+	// Get stream parameter; false if not set
+
+	stream, ok := queryParamBool(w, r, "stream")
+	if !ok {
+		return
+	} else if stream && highlight {
+		api.WriteError(w, r, "Highlight parameter cannot be combined with stream parameter", http.StatusBadRequest)
+		return
+	} else if stream && serverCursor {
+		api.WriteError(w, r, "Cursor mode cannot be combined with stream parameter", http.StatusBadRequest)
+		return
+	} else if stream {
+		eq.streamResultData(ctx, w, r, part, query, opts, stats)
+		return
+	}
+
+	// The whole result of a query with an offset is kept in the cache so
+	// further pages can be requested with the result id - the page is taken
+	// from the cached result. A query with only a limit is continued with its
+	// cursor and is not cached.
+
+	cached := !paged || offset != -1
+
+	if paged && cached {
+		opts.Page = &eql.Page{Offset: 0, Limit: -1}
+	}
+
+	res, err := runQuery(ctx, part, query, nil, opts)
+
+	if err != nil {
+		writeQueryError(w, r, err)
+		return
+	}
+
+	if serverCursor {
+		eq.openCursor(w, r, part, res, limit, highlight, stats)
+		return
+	}
+
+	if !cached {
+		eq.writeResultData(w, res, "", -1, -1, res.TotalCount(), highlight, stats)
+		return
+	}
+
+	// Store the result in the cache
+
+	resID = genID()
+
+	total := res.RowCount()
+	if paged {
+		total = res.TotalCount()
+	}
+
+	ResultCache.Put(resID, &cachedResult{res, part, total})
+
+	if !paged {
+		eq.writeResultData(w, res, resID, -1, -1, -1, highlight, stats)
+		return
+	}
+
+	eq.writeResultData(w, res, resID, offset, limit, total, highlight, stats)
+}
+
+/*
+writeValidationResult validates a query without running it and writes the
+validation result for the client.
+*/
+func (eq *queryEndpoint) writeValidationResult(w http.ResponseWriter, r *http.Request, query string) {
+
+	res, err := eql.ValidateQuery(query, api.GM)
+	if err != nil {
+		api.WriteError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+
+	json.NewEncoder(w).Encode(res)
+}
+
+/*
+writeResultData writes result data for the client. The execution statistics of
+the query are added if requested. The total number of rows and if more rows
+exist are added for paged results (total is -1 if the result is not paged).
+*/
+func (eq *queryEndpoint) writeResultData(w http.ResponseWriter, res eql.SearchResult,
+	resID string, offset int, limit int, total int, highlight bool, stats bool) {
+
+	data := eq.resultData(w, res, resID, offset, limit, total, highlight, stats)
+
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+resultData produces the result data for the client and sets the response
+header values (see writeResultData).
+*/
+func (eq *queryEndpoint) resultData(w http.ResponseWriter, res eql.SearchResult,
+	resID string, offset int, limit int, total int, highlight bool, stats bool) map[string]interface{} {
+
+	header := res.Header()
+
+	data := make(map[string]interface{})
+
+	rows := res.Rows()
+	srcs := res.RowSources()
+
+	var hls [][]*eql.Highlight
+	if highlight {
+		hls = res.RowHighlights()
+	}
+
+	hasMore := res.HasMore()
+
+	// An offset beyond the available rows results in an empty page
+
+	if offset > 0 {
+
+		if offset > len(rows) {
+			offset = len(rows)
+		}
+
+		rows = rows[offset:]
+		srcs = srcs[offset:]
+		if hls != nil {
+			hls = hls[offset:]
+		}
+	}
+
+	if limit != -1 && limit < len(rows) {
+		rows = rows[:limit]
+		srcs = srcs[:limit]
+		if hls != nil {
+			hls = hls[:limit]
+		}
+		hasMore = true
+	}
+
+	data["rows"] = rows
+	data["sources"] = srcs
+
+	if total != -1 {
+		data["total_count"] = total
+		data["has_more"] = hasMore
+	}
+
+	if highlight {
+		data["highlights"] = highlightData(hls)
+	}
+
+	if stats {
+		data["stats"] = res.Stats()
+	}
+
+	// Write out result header
+
+	dataHeader := make(map[string]interface{})
+
+	data["header"] = dataHeader
+
+	dataHeader["labels"] = header.Labels()
+	dataHeader["format"] = header.Format()
+	dataHeader["data"] = header.Data()
+	dataHeader["primary_kind"] = header.PrimaryKind()
+	dataHeader["ordering"] = res.Ordering()
+
+	// Set response header values
+
+	if total == -1 {
+		total = res.RowCount()
+	}
+
+	w.Header().Add(HTTPHeaderTotalCount, fmt.Sprint(total))
+	w.Header().Add(HTTPHeaderHasMore, fmt.Sprint(hasMore))
+
+	if resID != "" {
+		w.Header().Add(HTTPHeaderCacheID, resID)
+	}
+
+	// The cursor of the result can only be used if the whole result is
+	// returned
+
+	if cursor := res.Cursor(); cursor != "" && limit == -1 && offset == -1 {
+		data["cursor"] = cursor
+		w.Header().Add(HTTPHeaderCursor, cursor)
+	}
+
+	return data
+}
+
+/*
+highlightData converts the highlights of result rows into JSON data. Every
+match is written as a list of start and end offset (in characters).
+*/
+func highlightData(hls [][]*eql.Highlight) []interface{} {
+	ret := make([]interface{}, 0, len(hls))
+
+	for _, hl := range hls {
+		row := make([]interface{}, 0, len(hl))
+
+		for _, h := range hl {
+			matches := make([][]int, 0, len(h.Matches))
+
+			for _, m := range h.Matches {
+				matches = append(matches, []int{m.Start, m.End})
+			}
+
+			row = append(row, map[string]interface{}{
+				"kind":    h.Kind,
+				"key":     h.Key,
+				"attr":    h.Attr,
+				"matches": matches,
+			})
+		}
+
+		ret = append(ret, row)
+	}
+
+	return ret
+}
+
+/*
+streamResultData runs a query and writes its rows for the client as soon as
+they are available. Streamed results are not stored in the cache and have no
+sources. The total count, the has more flag and the cursor are only known at
+the end and are sent as HTTP trailers. The execution statistics of the query
+are written after the rows if requested.
+*/
+func (eq *queryEndpoint) streamResultData(ctx context.Context, w http.ResponseWriter, r *http.Request,
+	part string, query string, opts eql.RunOptions, stats bool) {
+
+	qs := &queryResultStream{w: w}
+
+	res, err := runQuery(ctx, part, query, qs, opts)
+
+	if err != nil && qs.count == 0 {
+		writeQueryError(w, r, err)
+		return
+	}
+
+	if qs.count == 0 {
+		qs.writeStart()
+	}
+
+	// Write out result header once all rows have been written
+
+	w.Write([]byte("],"))
+
+	if err != nil {
+
+		// The response status was already sent - report the error in the result
+
+		errorJSON, _ := json.Marshal(err.Error())
+
+		w.Write([]byte(`"error":`))
+		w.Write(errorJSON)
+
+	} else {
+		header := res.Header()
+
+		headerJSON, _ := json.Marshal(map[string]interface{}{
+			"labels":       header.Labels(),
+			"format":       header.Format(),
+			"data":         header.Data(),
+			"primary_kind": header.PrimaryKind(),
+			"ordering":     res.Ordering(),
+		})
+
+		w.Write([]byte(`"header":`))
+		w.Write(headerJSON)
+
+		if cursor := res.Cursor(); cursor != "" {
+			cursorJSON, _ := json.Marshal(cursor)
+
+			w.Write([]byte(`,"cursor":`))
+			w.Write(cursorJSON)
+
+			w.Header().Set(HTTPHeaderCursor, cursor)
+		}
+
+		if stats {
+			statsJSON, _ := json.Marshal(res.Stats())
+
+			w.Write([]byte(`,"stats":`))
+			w.Write(statsJSON)
+		}
+
+		w.Header().Set(HTTPHeaderHasMore, fmt.Sprint(res.HasMore()))
+	}
+
+	w.Write([]byte("}\n"))
+
+	// The total of a paged result is the number of all rows - not only the
+	// rows of this page
+
+	total := qs.count
+
+	if err == nil && opts.CountTotal {
+		total = res.TotalCount()
+	}
+
+	w.Header().Set(HTTPHeaderTotalCount, fmt.Sprint(total))
+}
+
+/*
+runQuery runs a query on a given partition. All rows are passed to the given
+stream if it is not nil. Parsed queries are kept in the query cache.
+*/
+func runQuery(ctx context.Context, part string, query string, stream eql.ResultStream,
+	opts eql.RunOptions) (eql.SearchResult, error) {
+	var pq *eql.PreparedQuery
+
+	name := stringutil.CreateDisplayString(part) + " query"
+	key := name + "\x00" + query
+
+	if QueryCache != nil {
+		if cpq, ok := QueryCache.Get(key); ok {
+			pq = cpq.(*eql.PreparedQuery)
+		}
+	}
+
+	if pq == nil {
+		var err error
+
+		if pq, err = eql.Prepare(name, query); err != nil {
+			return nil, err
+		}
+
+		if QueryCache != nil {
+			QueryCache.Put(key, pq)
+		}
+	}
+
+	if stream != nil {
+		return pq.Stream(ctx, part, api.GM, stream, opts)
+	}
+
+	return pq.Run(ctx, part, api.GM, opts)
+}
+
+/*
+queryResultStream writes the rows of a query result as a JSON array.
+*/
+type queryResultStream struct {
+	w     http.ResponseWriter // Response writer
+	count int                 // Number of written rows
+}
+
+/*
+Start is called once before any row is streamed.
+*/
+func (qs *queryResultStream) Start(header eql.SearchResultHeader, incremental bool) error {
+	return nil
+}
+
+/*
+Row writes a single row of the result.
+*/
+func (qs *queryResultStream) Row(row []interface{}, source []string) error {
+
+	rowJSON, err := json.Marshal(row)
+
+	if err == nil {
+		if qs.count == 0 {
+			qs.writeStart()
+		} else {
+			qs.w.Write([]byte(","))
+		}
+
+		qs.count++
+
+		_, err = qs.w.Write(rowJSON)
+	}
+
+	return err
+}
+
+/*
+writeStart writes the response header and the start of the result.
 */
-var idCount = time.Now().Unix()
+func (qs *queryResultStream) writeStart() {
+	qs.w.Header().Set("Trailer", HTTPHeaderTotalCount+", "+HTTPHeaderHasMore+", "+HTTPHeaderCursor)
+	qs.w.Header().Set("content-type", "application/json; charset=utf-8")
+	qs.w.Write([]byte(`{"rows":[`))
+}
 
 /*
-EndpointQuery is the query endpoint URL (rooted). Handles everything under query/...
+acceptFormats maps media types of an Accept header to result formats.
 */
-const EndpointQuery = api.APIRoot + APIv1 + "/query/"
+var acceptFormats = map[string]string{
+	"application/json":          "json",
+	"text/csv":                  "csv",
+	"text/tab-separated-values": "tsv",
+}
 
 /*
-QueryEndpointInst creates a new endpoint handler.
+acceptedFormat returns the result format which is preferred by an Accept
+header. Media ranges are weighted by their q parameter - media ranges with
+a weight of 0 are not acceptable. An empty string is returned if no known
+format is acceptable.
 */
-func QueryEndpointInst() api.RestEndpointHandler {
+func acceptedFormat(accept string) string {
+	var format string
 
-	// Init the result cache if necessary
+	best := 0.0
 
-	if ResultCache == nil {
-		ResultCache = datautil.NewMapCache(ResultCacheMaxSize, ResultCacheMaxAge)
+	for _, mr := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mr))
+		if err != nil {
+			continue
+		}
+
+		f, ok := acceptFormats[mediaType]
+		if !ok {
+			continue
+		}
+
+		q := 1.0
+
+		if qs, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qs, 64); err != nil {
+				continue
+			}
+		}
+
+		if q > best {
+			format, best = f, q
+		}
 	}
 
-	return &queryEndpoint{}
+	return format
 }
 
 /*
-Handler object for search queries.
+csvParams determines if a result should be written as CSV (format parameter
+or Accept header) and the options for writing it.
 */
-type queryEndpoint struct {
-	*api.DefaultEndpointHandler
-}
+func csvParams(w http.ResponseWriter, r *http.Request) (eql.CSVOptions, bool, bool) {
+	var opts eql.CSVOptions
 
-/*
-HandleGET handles a search query REST call.
-*/
-func (eq *queryEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
+	format := r.URL.Query().Get("format")
 
-	// Check parameters
+	if format == "" {
+		format = acceptedFormat(r.Header.Get("Accept"))
+	}
 
-	if !checkResources(w, resources, 1, 1, "Need a partition") {
-		return
+	if format == "" || format == "json" {
+		return opts, false, true
+	} else if format == "tsv" {
+		opts.Delimiter = '\t'
+	} else if format != "csv" {
+		api.WriteError(w, r, "Invalid parameter value: format should be json, csv or tsv", http.StatusBadRequest)
+		return opts, false, false
 	}
 
-	// Get limit parameter; -1 if not set
+	// Get header parameter; true if not set
 
-	limit, ok := queryParamPosNum(w, r, "limit")
-	if !ok {
-		return
+	if r.URL.Query().Get("header") != "" {
+		header, ok := queryParamBool(w, r, "header")
+		if !ok {
+			return opts, false, false
+		}
+
+		opts.OmitHeader = !header
 	}
 
-	// Get offset parameter; -1 if not set
+	// Get raw parameter; false if not set
 
-	offset, ok := queryParamPosNum(w, r, "offset")
+	raw, ok := queryParamBool(w, r, "raw")
 	if !ok {
-		return
+		return opts, false, false
 	}
 
-	// See if a result id was given
+	opts.RawValues = raw
 
-	resID := r.URL.Query().Get("rid")
-	if resID != "" {
+	return opts, true, true
+}
 
-		res, ok := ResultCache.Get(resID)
-		if !ok {
-			http.Error(w, "Unknown result id (rid parameter)", http.StatusBadRequest)
-			return
+/*
+csvFilename returns the file name (without extension) of a CSV result. The
+name is taken from the name parameter of the request or is the name of the
+queried partition if no name was given.
+*/
+func csvFilename(r *http.Request, part string) string {
+	for _, name := range []string{r.URL.Query().Get("name"), part} {
+		if name = sanitizeFilename(name); name != "" {
+			return name
 		}
-
-		eq.writeResultData(w, res.(eql.SearchResult), resID, offset, limit)
-		return
 	}
 
-	// Run the query
+	return "result"
+}
 
-	query := r.URL.Query().Get("q")
-	part := resources[0]
+/*
+maxFilenameLength is the maximum number of characters of a file name (without
+extension) of a CSV result.
+*/
+const maxFilenameLength = 100
 
-	if query == "" {
-		http.Error(w, "Missing query (q parameter)", http.StatusBadRequest)
-		return
+/*
+sanitizeFilename removes all characters from a name which should not be used
+in a file name. ASCII letters and digits, dashes, underscores and dots are
+kept - all other characters are replaced by an underscore. Leading and trailing dots,
+dashes and underscores are removed and long names are cut.
+*/
+func sanitizeFilename(name string) string {
+	var buf strings.Builder
+
+	for _, c := range name {
+		if c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c) || c == '-' || c == '_' || c == '.') {
+			buf.WriteRune(c)
+		} else {
+			buf.WriteRune('_')
+		}
 	}
 
-	res, err := eql.RunQuery(stringutil.CreateDisplayString(part)+" query",
-		part, query, api.GM)
+	runes := []rune(strings.Trim(buf.String(), "._-"))
 
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if len(runes) > maxFilenameLength {
+		runes = []rune(strings.Trim(string(runes[:maxFilenameLength]), "._-"))
 	}
 
-	// Store the result in the cache
+	return string(runes)
+}
 
-	resID = genID()
+/*
+setCSVHeader sets the content type and the file name of a CSV result.
+*/
+func setCSVHeader(w http.ResponseWriter, filename string, opts eql.CSVOptions) {
+	contentType, ext := "text/csv", ".csv"
 
-	ResultCache.Put(resID, res)
+	if opts.Delimiter == '\t' {
+		contentType, ext = "text/tab-separated-values", ".tsv"
+	}
 
-	eq.writeResultData(w, res, resID, offset, limit)
+	w.Header().Set("content-type", contentType+"; charset=utf-8")
+	w.Header().Set("content-disposition", fmt.Sprintf(`attachment; filename="%v%v"`, filename, ext))
 }
 
 /*
-writeResultData writes result data for the client.
+writeResultCSV writes a cached result as CSV for the client. The total is the
+number of all rows of the cached result.
 */
-func (eq *queryEndpoint) writeResultData(w http.ResponseWriter, res eql.SearchResult,
-	resID string, offset int, limit int) {
+func (eq *queryEndpoint) writeResultCSV(w http.ResponseWriter, res eql.SearchResult,
+	filename string, opts eql.CSVOptions, offset int, limit int, total int) {
 
-	// Write out the data
+	rows := res.Rows()
+	srcs := res.RowSources()
 
-	header := res.Header()
+	if offset > 0 {
 
-	ret := json.NewEncoder(w)
+		if offset > len(rows) {
+			offset = len(rows)
+		}
 
-	data := make(map[string]interface{})
+		rows = rows[offset:]
+		srcs = srcs[offset:]
+	}
 
-	if limit == -1 && offset == -1 {
-		data["rows"] = res.Rows()
-		data["sources"] = res.RowSources()
+	hasMore := res.HasMore()
 
-	} else {
+	if limit != -1 && limit < len(rows) {
+		rows = rows[:limit]
+		srcs = srcs[:limit]
+		hasMore = true
+	}
 
-		rows := res.Rows()
-		srcs := res.RowSources()
+	setCSVHeader(w, filename, opts)
 
-		if offset > 0 {
+	w.Header().Add(HTTPHeaderTotalCount, fmt.Sprint(total))
+	w.Header().Add(HTTPHeaderHasMore, fmt.Sprint(hasMore))
 
-			if offset >= len(rows) {
-				http.Error(w, "Offset exceeds available rows", http.StatusInternalServerError)
-				return
-			}
+	cs := eql.NewCSVStream(w, opts)
 
-			rows = rows[offset:]
-			srcs = srcs[offset:]
-		}
+	if err := cs.Start(res.Header(), true); err != nil {
+		return
+	}
 
-		if limit != -1 && limit < len(rows) {
-			rows = rows[:limit]
-			srcs = srcs[:limit]
+	for i, row := range rows {
+		if err := cs.Row(row, srcs[i]); err != nil {
+			return
 		}
+	}
+}
+
+/*
+streamResultCSV runs a query and writes its rows as CSV for the client as
+soon as they are available. The total count, the has more flag and the
+cursor are sent as HTTP trailers - an error which occurs after the first row
+was written is sent as a trailer as well.
+*/
+func (eq *queryEndpoint) streamResultCSV(ctx context.Context, w http.ResponseWriter, r *http.Request,
+	part string, query string, opts eql.RunOptions, csvOpts eql.CSVOptions) {
 
-		data["rows"] = rows
-		data["sources"] = srcs
+	cs := &csvResultStream{eql.NewCSVStream(w, csvOpts), w, csvFilename(r, part), csvOpts, false, 0}
+
+	res, err := runQuery(ctx, part, query, cs, opts)
+
+	if err != nil && !cs.written {
+
+		// Nothing was sent yet - report the error with the response status
+
+		w.Header().Del("content-disposition")
+		w.Header().Del("Trailer")
+
+		writeQueryError(w, r, err)
+		return
 	}
 
-	// Write out result header
+	// The total of a paged result is the number of all rows - not only the
+	// rows of this page
 
-	dataHeader := make(map[string]interface{})
+	total := cs.count
 
-	data["header"] = dataHeader
+	if err != nil {
+		w.Header().Set(HTTPHeaderQueryError, err.Error())
+	} else {
+		w.Header().Set(HTTPHeaderHasMore, fmt.Sprint(res.HasMore()))
+		w.Header().Set(HTTPHeaderCursor, res.Cursor())
 
-	dataHeader["labels"] = header.Labels()
-	dataHeader["format"] = header.Format()
-	dataHeader["data"] = header.Data()
-	dataHeader["primary_kind"] = header.PrimaryKind()
+		if opts.CountTotal {
+			total = res.TotalCount()
+		}
+	}
 
-	// Set response header values
+	w.Header().Set(HTTPHeaderTotalCount, fmt.Sprint(total))
+}
 
-	w.Header().Add(HTTPHeaderTotalCount, fmt.Sprint(res.RowCount()))
-	w.Header().Add(HTTPHeaderCacheID, resID)
+/*
+csvResultStream writes the rows of a query result as CSV. The response header
+is set once the result starts.
+*/
+type csvResultStream struct {
+	eql.ResultStream                     // CSV stream
+	w                http.ResponseWriter // Response writer
+	filename         string              // File name of the result
+	opts             eql.CSVOptions      // CSV options
+	written          bool                // Flag if the response was started
+	count            int                 // Number of written rows
+}
 
-	w.Header().Set("content-type", "application/json; charset=utf-8")
+/*
+Start is called once before any row is streamed.
+*/
+func (cs *csvResultStream) Start(header eql.SearchResultHeader, incremental bool) error {
+	setCSVHeader(cs.w, cs.filename, cs.opts)
+
+	cs.w.Header().Set("Trailer", HTTPHeaderTotalCount+", "+HTTPHeaderHasMore+", "+HTTPHeaderCursor+", "+HTTPHeaderQueryError)
+	cs.written = !cs.opts.OmitHeader
+
+	return cs.ResultStream.Start(header, incremental)
+}
+
+/*
+Row writes a single row of the result.
+*/
+func (cs *csvResultStream) Row(row []interface{}, source []string) error {
+	cs.count++
+	cs.written = true
+	return cs.ResultStream.Row(row, source)
+}
 
-	ret.Encode(data)
+/*
+Describe describes the endpoint in the API description.
+*/
+func (eq *queryEndpoint) Describe() []*api.EndpointDescription {
+	path := EndpointQuery + "{partition}"
+
+	return []*api.EndpointDescription{
+		{
+			Path:    path,
+			Methods: []string{"GET"},
+			Summary: "Run an EQL query.",
+			Description: "Runs a new query or returns a cached result or the next page of a " +
+				"server-side cursor. Results can be returned as JSON, CSV or TSV.",
+			Parameters: []*api.ParameterDescription{
+				{Name: "q", In: "query", Description: "URL encoded query to execute."},
+				{Name: "rid", In: "query", Description: "Result ID of a cached result."},
+				{Name: "limit", In: "query", Description: "How many result rows to return.", Type: "integer"},
+				{Name: "offset", In: "query", Description: "Offset in the result.", Type: "integer"},
+				{Name: "sorted", In: "query", Description: "Visit start nodes in key order.", Type: "boolean"},
+				{Name: "sample", In: "query", Description: "Number of start nodes to sample.", Type: "integer"},
+				{Name: "stream", In: "query", Description: "Stream the result rows.", Type: "boolean"},
+				{Name: "format", In: "query", Description: "Format of the result (json, csv or tsv)."},
+				{Name: "header", In: "query", Description: "Write a CSV header row.", Type: "boolean"},
+				{Name: "raw", In: "query", Description: "Write raw CSV values.", Type: "boolean"},
+				{Name: "name", In: "query", Description: "File name of a CSV result (default is the partition)."},
+				{Name: "highlight", In: "query", Description: "Highlight matches of the query.", Type: "boolean"},
+				{Name: "stats", In: "query", Description: "Return execution statistics.", Type: "boolean"},
+				{Name: "validate", In: "query", Description: "Only validate the query.", Type: "boolean"},
+				{Name: "cursor", In: "query", Description: "Continue after a cursor or open a server-side cursor."},
+				{Name: "cursor_id", In: "query", Description: "ID of a server-side cursor."},
+			},
+			Responses: []*api.ResponseDescription{
+				{Status: 200, Description: "A query result.", ContentType: "application/json",
+					Schema: map[string]interface{}{"type": "object"}},
+				{Status: 410, Description: "The server-side cursor is exhausted, has expired or is unknown."},
+			},
+		},
+		{
+			Path:    path,
+			Methods: []string{"DELETE"},
+			Summary: "Delete all start nodes of an EQL query result.",
+			Parameters: []*api.ParameterDescription{
+				{Name: "q", In: "query", Description: "Query which selects the nodes.", Required: true},
+				{Name: "dryRun", In: "query", Description: "Only count the matched nodes.", Type: "boolean"},
+				{Name: "confirm", In: "query", Description: "Number of nodes which should be deleted.", Type: "integer"},
+			},
+			Responses: []*api.ResponseDescription{
+				{Status: 200, Description: "The number of matched and deleted nodes.", ContentType: "application/json",
+					Schema: map[string]interface{}{"type": "object"}},
+				{Status: 409, Description: "The confirmed number of nodes does not match the query result."},
+			},
+		},
+		{
+			Path:    path,
+			Methods: []string{"POST"},
+			Summary: "Submit an EQL query which runs in the background.",
+			Description: "Returns the ID of a query job immediately - its status and result are " +
+				"returned by the queryjob endpoint.",
+			Parameters: []*api.ParameterDescription{
+				{Name: "async", In: "query", Description: "Must be true.", Required: true, Type: "boolean"},
+				{Name: "q", In: "query", Description: "Query to execute (the request body is used if not given)."},
+				{Name: "sorted", In: "query", Description: "Visit start nodes in key order.", Type: "boolean"},
+				{Name: "sample", In: "query", Description: "Number of start nodes to sample.", Type: "integer"},
+			},
+			Responses: []*api.ResponseDescription{
+				{Status: 202, Description: "The query job was submitted.", ContentType: "application/json",
+					Schema: map[string]interface{}{"type": "object"}},
+				{Status: 503, Description: "Too many query jobs are queued."},
+			},
+		},
+	}
 }
 
 /*
@@ -209,10 +1090,12 @@ func (eq *queryEndpoint) SwaggerDefs(s map[string]interface{}) {
 	s["paths"].(map[string]interface{})["/v1/query/{partition}"] = map[string]interface{}{
 		"get": map[string]interface{}{
 			"summary":     "Run EQL queries to query the EliasDB datastore.",
-			"description": "The query endpoint should be used to run EQL search queries against partitions. The return value is always a list (even if there is only a single entry). A query result gets an ID and is stored in a cache. The id is returned in the X-Cache-Id header. Subsequent requests for the same result can use the id instead of a query.",
+			"description": "The query endpoint should be used to run EQL search queries against partitions. The return value is always a list (even if there is only a single entry). A query result gets an ID and is stored in a cache. The id is returned in the X-Cache-Id header. Subsequent requests for the same result can use the id instead of a query. Results of queries with a limit but no offset parameter are continued with their cursor and are not cached. The X-Has-More header is set to true if the query has more rows beyond the given limit. Results of queries with the stream parameter are written as they are produced - they are not cached, have no sources and the X-Total-Count and X-Has-More values are sent as trailers. Sorted results or results of queries with a cursor contain a cursor for the next page in the cursor field and the X-Cursor header if the query can continue after the last row.",
 			"produces": []string{
 				"text/plain",
 				"application/json",
+				"text/csv",
+				"text/tab-separated-values",
 			},
 			"parameters": []map[string]interface{}{
 				map[string]interface{}{
@@ -229,6 +1112,92 @@ func (eq *queryEndpoint) SwaggerDefs(s map[string]interface{}) {
 					"required":    false,
 					"type":        "string",
 				},
+				map[string]interface{}{
+					"name": "sorted",
+					"in":   "query",
+					"description": "Visit the start nodes of GET queries in lexicographic key " +
+						"order which gives a stable row order for queries without ordering. " +
+						"Sorting is considerably slower than the default order.",
+					"required": false,
+					"type":     "boolean",
+				},
+				map[string]interface{}{
+					"name": "sample",
+					"in":   "query",
+					"description": "Only visit the given number of uniformly random start " +
+						"nodes of GET queries (visited in lexicographic key order). " +
+						"Useful for ad-hoc spot checks on large node kinds.",
+					"required": false,
+					"type":     "number",
+					"format":   "integer",
+				},
+				map[string]interface{}{
+					"name": "stream",
+					"in":   "query",
+					"description": "Write the rows of the result as they are produced instead " +
+						"of keeping the whole result in memory. Results with ordering or " +
+						"aggregation are still buffered by the query engine.",
+					"required": false,
+					"type":     "boolean",
+				},
+				map[string]interface{}{
+					"name": "format",
+					"in":   "query",
+					"description": "Format of the result: json (default), csv or tsv. CSV and " +
+						"TSV can also be requested with the Accept header. Results of queries " +
+						"are streamed and not cached if they are written as CSV or TSV.",
+					"required": false,
+					"type":     "string",
+				},
+				map[string]interface{}{
+					"name":        "header",
+					"in":          "query",
+					"description": "Write a header row with the column labels in a CSV or TSV result (default true).",
+					"required":    false,
+					"type":        "boolean",
+				},
+				map[string]interface{}{
+					"name":        "raw",
+					"in":          "query",
+					"description": "Write values as JSON instead of display strings in a CSV or TSV result.",
+					"required":    false,
+					"type":        "boolean",
+				},
+				map[string]interface{}{
+					"name": "name",
+					"in":   "query",
+					"description": "Name of the query which is used as file name of a CSV or TSV " +
+						"result. The name of the partition is used if no name is given.",
+					"required": false,
+					"type":     "string",
+				},
+				map[string]interface{}{
+					"name": "highlight",
+					"in":   "query",
+					"description": "Add the matches of @phrase conditions to the result (highlights " +
+						"field). Cannot be combined with the stream parameter or CSV and TSV.",
+					"required": false,
+					"type":     "boolean",
+				},
+				map[string]interface{}{
+					"name": "stats",
+					"in":   "query",
+					"description": "Add the execution statistics of the query to the result (stats field " +
+						"with a version, the duration in nanoseconds and counters for scanned start nodes, " +
+						"visited nodes, traversals, storage fetches and index lookups). Cannot be combined with CSV and TSV.",
+					"required": false,
+					"type":     "boolean",
+				},
+				map[string]interface{}{
+					"name": "validate",
+					"in":   "query",
+					"description": "Only validate the query without running it and return a ValidationResult " +
+						"instead of data. Syntax errors, errors which would stop the query and unknown node kinds " +
+						"are errors - unknown attributes, traversal specs which match no known relationship and " +
+						"comparisons which always have the same result are warnings. All other parameters are ignored.",
+					"required": false,
+					"type":     "boolean",
+				},
 				map[string]interface{}{
 					"name":        "rid",
 					"in":          "query",
@@ -240,7 +1209,7 @@ func (eq *queryEndpoint) SwaggerDefs(s map[string]interface{}) {
 				map[string]interface{}{
 					"name":        "limit",
 					"in":          "query",
-					"description": "How many list items to return.",
+					"description": "How many list items to return. Applied as limit clause if a query is given. The result contains the total number of rows and if more rows exist.",
 					"required":    false,
 					"type":        "number",
 					"format":      "integer",
@@ -248,19 +1217,51 @@ func (eq *queryEndpoint) SwaggerDefs(s map[string]interface{}) {
 				map[string]interface{}{
 					"name":        "offset",
 					"in":          "query",
-					"description": "Offset in the dataset.",
+					"description": "Offset in the dataset. Applied as offset clause if a query is given. An offset beyond the available rows returns no rows. The result contains the total number of rows and if more rows exist.",
 					"required":    false,
 					"type":        "number",
 					"format":      "integer",
 				},
+				map[string]interface{}{
+					"name":        "cursor",
+					"in":          "query",
+					"description": "Cursor of a previous result of the same query and limit. The query continues after the last row of the previous result. Start nodes are visited in key order. Cannot be combined with offset or sample. The value true opens a server-side cursor instead which keeps the result of the query - the limit parameter is then the page size and the id of the cursor is returned in the cursor_id field and the X-Cursor-Id header.",
+					"required":    false,
+					"type":        "string",
+				},
+				map[string]interface{}{
+					"name":        "cursor_id",
+					"in":          "query",
+					"description": "Id of a server-side cursor. Returns the next page of the cursor (the limit parameter can change the page size). The cursor is closed once its last page was returned.",
+					"required":    false,
+					"type":        "string",
+				},
 			},
 			"responses": map[string]interface{}{
 				"200": map[string]interface{}{
-					"description": "A query result",
+					"description": "A query result (a ValidationResult if the validate parameter was given)",
 					"schema": map[string]interface{}{
 						"$ref": "#/definitions/QueryResult",
 					},
 				},
+				"400": map[string]interface{}{
+					"description": "The query could not be parsed (other invalid requests return an Error)",
+					"schema": map[string]interface{}{
+						"$ref": "#/definitions/QueryParseError",
+					},
+				},
+				"410": map[string]interface{}{
+					"description": "The server-side cursor is exhausted, has expired or is unknown",
+					"schema": map[string]interface{}{
+						"$ref": "#/definitions/Error",
+					},
+				},
+				"422": map[string]interface{}{
+					"description": "The query visited more nodes or produced more rows than allowed",
+					"schema": map[string]interface{}{
+						"$ref": "#/definitions/Error",
+					},
+				},
 				"default": map[string]interface{}{
 					"description": "Error response",
 					"schema": map[string]interface{}{
@@ -271,6 +1272,68 @@ func (eq *queryEndpoint) SwaggerDefs(s map[string]interface{}) {
 		},
 	}
 
+	// Add ValidationResult to definitions
+
+	s["definitions"].(map[string]interface{})["ValidationResult"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"valid": map[string]interface{}{
+				"description": "Flag if the query has no errors.",
+				"type":        "boolean",
+			},
+			"errors": map[string]interface{}{
+				"description": "Problems which prevent the query from running.",
+				"type":        "array",
+				"items": map[string]interface{}{
+					"$ref": "#/definitions/ValidationMessage",
+				},
+			},
+			"warnings": map[string]interface{}{
+				"description": "Problems which are likely mistakes.",
+				"type":        "array",
+				"items": map[string]interface{}{
+					"$ref": "#/definitions/ValidationMessage",
+				},
+			},
+		},
+	}
+
+	s["definitions"].(map[string]interface{})["ValidationMessage"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"type": map[string]interface{}{
+				"description": "Type of the problem (syntax, invalid, unknown_kind, unknown_attribute, unknown_traversal or suspicious_comparison).",
+				"type":        "string",
+			},
+			"detail": map[string]interface{}{
+				"description": "Description of the problem.",
+				"type":        "string",
+			},
+			"line": map[string]interface{}{
+				"description": "Line of the problem in the query.",
+				"type":        "integer",
+			},
+			"pos": map[string]interface{}{
+				"description": "Position of the problem in its line.",
+				"type":        "integer",
+			},
+			"expected": map[string]interface{}{
+				"description": "Terms which would have been valid instead (only syntax errors).",
+				"type":        "array",
+				"items": map[string]interface{}{
+					"type": "string",
+				},
+			},
+			"suggestions": map[string]interface{}{
+				"description": "Keywords which were likely meant instead (only syntax errors).",
+				"type":        "array",
+				"items": map[string]interface{}{
+					"type": "string",
+				},
+			},
+		},
+	}
+
 	// Add QueryResult to definitions
 
 	s["definitions"].(map[string]interface{})["QueryResult"] = map[string]interface{}{
@@ -306,6 +1369,22 @@ func (eq *queryEndpoint) SwaggerDefs(s map[string]interface{}) {
 					},
 				},
 			},
+			"cursor": map[string]interface{}{
+				"description": "Cursor which continues after the last row of the query result (only set if more rows exist and the query can be resumed).",
+				"type":        "string",
+			},
+			"cursor_id": map[string]interface{}{
+				"description": "Id of the server-side cursor which returns the next page (only set if the cursor has more rows).",
+				"type":        "string",
+			},
+			"total_count": map[string]interface{}{
+				"description": "Number of all rows of the query without offset and limit (only set if an offset or limit parameter was given and no cursor was used). Also returned in the X-Total-Count header.",
+				"type":        "integer",
+			},
+			"has_more": map[string]interface{}{
+				"description": "Flag if more rows exist beyond the returned rows (only set if an offset or limit parameter was given and no cursor was used). Also returned in the X-Has-More header.",
+				"type":        "boolean",
+			},
 			"rows": map[string]interface{}{
 				"description": "Rows of the query result.",
 				"type":        "array",
@@ -321,6 +1400,42 @@ func (eq *queryEndpoint) SwaggerDefs(s map[string]interface{}) {
 					},
 				},
 			},
+			"highlights": map[string]interface{}{
+				"description": "Matches of @phrase conditions for each row (only set if the highlight parameter was given).",
+				"type":        "array",
+				"items": map[string]interface{}{
+					"description": "Matches in the nodes of a row.",
+					"type":        "array",
+					"items": map[string]interface{}{
+						"description": "Matches in an attribute of a node.",
+						"type":        "object",
+						"properties": map[string]interface{}{
+							"kind": map[string]interface{}{
+								"description": "Kind of the node.",
+								"type":        "string",
+							},
+							"key": map[string]interface{}{
+								"description": "Key of the node.",
+								"type":        "string",
+							},
+							"attr": map[string]interface{}{
+								"description": "Attribute which contains the matches.",
+								"type":        "string",
+							},
+							"matches": map[string]interface{}{
+								"description": "Start and end offset (in characters) of each match.",
+								"type":        "array",
+								"items": map[string]interface{}{
+									"type": "array",
+									"items": map[string]interface{}{
+										"type": "integer",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
 			"sources": map[string]interface{}{
 				"description": "Data sources of the query result.",
 				"type":        "array",
@@ -339,6 +1454,68 @@ func (eq *queryEndpoint) SwaggerDefs(s map[string]interface{}) {
 		},
 	}
 
+	// Add QueryParseError to definitions
+
+	s["definitions"].(map[string]interface{})["QueryParseError"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"error": map[string]interface{}{
+				"description": "A human readable error message.",
+				"type":        "string",
+			},
+			"type": map[string]interface{}{
+				"description": "Type of the error (e.g. Unexpected term).",
+				"type":        "string",
+			},
+			"detail": map[string]interface{}{
+				"description": "Details of the error.",
+				"type":        "string",
+			},
+			"offset": map[string]interface{}{
+				"description": "Offset of the error in the query (in bytes).",
+				"type":        "integer",
+			},
+			"line": map[string]interface{}{
+				"description": "Line of the error in the query.",
+				"type":        "integer",
+			},
+			"pos": map[string]interface{}{
+				"description": "Position of the error in its line.",
+				"type":        "integer",
+			},
+			"token": map[string]interface{}{
+				"description": "Term of the query which caused the error.",
+				"type":        "string",
+			},
+			"expected": map[string]interface{}{
+				"description": "Terms which would have been valid instead.",
+				"type":        "array",
+				"items": map[string]interface{}{
+					"type": "string",
+				},
+			},
+			"suggestions": map[string]interface{}{
+				"description": "Keywords which were likely meant instead of the term.",
+				"type":        "array",
+				"items": map[string]interface{}{
+					"type": "string",
+				},
+			},
+			"hint": map[string]interface{}{
+				"description": "A human readable summary of expected terms and suggestions.",
+				"type":        "string",
+			},
+		},
+	}
+
+	// Add delete by query
+
+	eq.swaggerDeleteDefs(s["paths"].(map[string]interface{})["/v1/query/{partition}"].(map[string]interface{}))
+
+	// Add asynchronous queries
+
+	eq.swaggerPostDefs(s["paths"].(map[string]interface{})["/v1/query/{partition}"].(map[string]interface{}))
+
 	// Add generic error object to definition
 
 	s["definitions"].(map[string]interface{})["Error"] = map[string]interface{}{
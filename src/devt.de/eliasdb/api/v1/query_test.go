@@ -10,27 +10,39 @@
 
 package v1
 
-import "testing"
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"devt.de/eliasdb/eql"
+)
 
 func TestQueryPagination(t *testing.T) {
 	queryURL := "http://localhost" + TESTPORT + EndpointQuery
 
-	st, _, res := sendTestRequest(queryURL+"//main?q=get+Song+with+ordering(ascending+key);offset=p&limit=2", "GET", nil)
+	st, _, res := sendTestRequest(queryURL+"//main?q=get+Song+with+ordering(ascending+key)&offset=p&limit=2", "GET", nil)
 	if st != "400 Bad Request" || res != "Invalid parameter value: offset should be a positive integer number" {
 		t.Error("Unexpected response:", st, res)
 		return
 	}
 
-	st, _, res = sendTestRequest(queryURL+"//main?q=get+Song+with+ordering(ascending+key);offset=2&limit=p", "GET", nil)
+	st, _, res = sendTestRequest(queryURL+"//main?q=get+Song+with+ordering(ascending+key)&offset=2&limit=p", "GET", nil)
 	if st != "400 Bad Request" || res != "Invalid parameter value: limit should be a positive integer number" {
 		t.Error("Unexpected response:", st, res)
 		return
 	}
 
-	st, h, res := sendTestRequest(queryURL+"//main?q=get+Song+with+ordering(ascending+key);offset=2;limit=3", "GET", nil)
+	st, h, res := sendTestRequest(queryURL+"//main?q=get+Song+with+ordering(ascending+key)&offset=2&limit=3", "GET", nil)
 
 	if st != "200 OK" || res != `
 {
+  "has_more": true,
   "header": {
     "data": [
       "1:n:key",
@@ -47,6 +59,9 @@ func TestQueryPagination(t *testing.T) {
       "Song Name",
       "Ranking"
     ],
+    "ordering": [
+      "ascending 1:n:key"
+    ],
     "primary_kind": "Song"
   },
   "rows": [
@@ -68,21 +83,22 @@ func TestQueryPagination(t *testing.T) {
   ],
   "sources": [
     [
-      "n:Song:DeadSong2",
-      "n:Song:DeadSong2",
-      "n:Song:DeadSong2"
+      "n:Song:Aria3",
+      "n:Song:Aria3",
+      "n:Song:Aria3"
     ],
     [
-      "n:Song:LoveSong3",
-      "n:Song:LoveSong3",
-      "n:Song:LoveSong3"
+      "n:Song:Aria4",
+      "n:Song:Aria4",
+      "n:Song:Aria4"
     ],
     [
-      "n:Song:MyOnlySong3",
-      "n:Song:MyOnlySong3",
-      "n:Song:MyOnlySong3"
+      "n:Song:DeadSong2",
+      "n:Song:DeadSong2",
+      "n:Song:DeadSong2"
     ]
-  ]
+  ],
+  "total_count": 9
 }`[1:] {
 		t.Error("Unexpected response:", st, res)
 		return
@@ -90,7 +106,7 @@ func TestQueryPagination(t *testing.T) {
 
 	// Check header values
 
-	if tc := h.Get(HTTPHeaderTotalCount); tc != "9" {
+	if tc := h.Get(HTTPHeaderTotalCount); tc != "9" || h.Get(HTTPHeaderHasMore) != "true" {
 		t.Error("Unexpected total count:", tc)
 		return
 	}
@@ -102,9 +118,10 @@ func TestQueryPagination(t *testing.T) {
 		return
 	}
 
-	st, _, res = sendTestRequest(queryURL+"//main?rid="+rid+";offset=5;limit=0", "GET", nil)
+	st, _, res = sendTestRequest(queryURL+"//main?rid="+rid+"&offset=5&limit=0", "GET", nil)
 	if st != "200 OK" || res != `
 {
+  "has_more": true,
   "header": {
     "data": [
       "1:n:key",
@@ -121,18 +138,23 @@ func TestQueryPagination(t *testing.T) {
       "Song Name",
       "Ranking"
     ],
+    "ordering": [
+      "ascending 1:n:key"
+    ],
     "primary_kind": "Song"
   },
   "rows": [],
-  "sources": []
+  "sources": [],
+  "total_count": 9
 }`[1:] {
 		t.Error("Unexpected response:", st, res)
 		return
 	}
 
-	st, _, res = sendTestRequest(queryURL+"//main?rid="+rid+";offset=5;limit=1", "GET", nil)
+	st, _, res = sendTestRequest(queryURL+"//main?rid="+rid+"&offset=5&limit=1", "GET", nil)
 	if st != "200 OK" || res != `
 {
+  "has_more": true,
   "header": {
     "data": [
       "1:n:key",
@@ -149,6 +171,9 @@ func TestQueryPagination(t *testing.T) {
       "Song Name",
       "Ranking"
     ],
+    "ordering": [
+      "ascending 1:n:key"
+    ],
     "primary_kind": "Song"
   },
   "rows": [
@@ -160,24 +185,106 @@ func TestQueryPagination(t *testing.T) {
   ],
   "sources": [
     [
-      "n:Song:Aria1",
-      "n:Song:Aria1",
-      "n:Song:Aria1"
+      "n:Song:FightSong4",
+      "n:Song:FightSong4",
+      "n:Song:FightSong4"
     ]
-  ]
+  ],
+  "total_count": 9
 }`[1:] {
 		t.Error("Unexpected response:", st, res)
 		return
 	}
 
-	_, _, res = sendTestRequest(queryURL+"//main?rid="+rid+";offset=500;limit=1", "GET", nil)
+	// Offsets beyond the available rows return an empty page
 
-	if res != "Offset exceeds available rows" {
-		t.Error("Unexpected response:", res)
+	st, h, res = sendTestRequest(queryURL+"//main?rid="+rid+"&offset=500&limit=1", "GET", nil)
+
+	if st != "200 OK" || !strings.Contains(res, `"rows": [],`) || !strings.Contains(res, `"has_more": false,`) ||
+		h.Get(HTTPHeaderTotalCount) != "9" || h.Get(HTTPHeaderHasMore) != "false" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, h, res = sendTestRequest(queryURL+"//main?q=get+Song&offset=500", "GET", nil)
+
+	if st != "200 OK" || !strings.Contains(res, `"rows": [],`) || !strings.Contains(res, `"total_count": 9`) ||
+		h.Get(HTTPHeaderTotalCount) != "9" || h.Get(HTTPHeaderHasMore) != "false" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Queries without paging parameters return the same result as before
+
+	st, h, res = sendTestRequest(queryURL+"//main?q=get+Song+limit+2", "GET", nil)
+
+	if st != "200 OK" || strings.Contains(res, "total_count") || strings.Contains(res, "has_more") ||
+		h.Get(HTTPHeaderTotalCount) != "2" || h.Get(HTTPHeaderHasMore) != "true" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Paging without ordering counts all rows
+
+	st, h, res = sendTestRequest(queryURL+"//main?q=get+Song&limit=2", "GET", nil)
+
+	if st != "200 OK" || !strings.Contains(res, `"total_count": 9`) ||
+		h.Get(HTTPHeaderTotalCount) != "9" || h.Get(HTTPHeaderHasMore) != "true" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Paging parameters are not affected by a trailing comment
+
+	st, h, res = sendTestRequest(queryURL+"//main?q=get+Song+show+key+%23+all+songs&sorted=true&limit=2&offset=1", "GET", nil)
+
+	if st != "200 OK" || !strings.Contains(res, `"total_count": 9`) || !strings.Contains(res, `"Aria2"`) ||
+		strings.Contains(res, `"Aria4"`) || h.Get(HTTPHeaderHasMore) != "true" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Paging parameters select a page of the rows which are selected by the
+	// limit and offset clauses of the query
+
+	st, h, res = sendTestRequest(queryURL+"//main?q=get+Song+show+key+offset+2+limit+5&sorted=true&limit=2&offset=1", "GET", nil)
+
+	if st != "200 OK" || !strings.Contains(res, `"total_count": 5`) || !strings.Contains(res, `"Aria4"`) ||
+		!strings.Contains(res, `"DeadSong2"`) || strings.Contains(res, `"FightSong4"`) || h.Get(HTTPHeaderHasMore) != "true" {
+		t.Error("Unexpected response:", st, res)
 		return
 	}
 
-	_, _, res = sendTestRequest(queryURL+"//main?rid=abc;offset=5;limit=1", "GET", nil)
+	// Pages of the cached result have the total of the whole result
+
+	rid = h.Get(HTTPHeaderCacheID)
+
+	st, h, res = sendTestRequest(queryURL+"//main?rid="+rid+"&offset=3&limit=2", "GET", nil)
+
+	if st != "200 OK" || !strings.Contains(res, `"total_count": 5`) || !strings.Contains(res, `"FightSong4"`) ||
+		!strings.Contains(res, `"LoveSong3"`) || strings.Contains(res, `"DeadSong2"`) ||
+		h.Get(HTTPHeaderTotalCount) != "5" || h.Get(HTTPHeaderHasMore) != "false" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, h, res = sendTestRequest(queryURL+"//main?rid="+rid+"&format=csv&header=false&offset=4", "GET", nil)
+
+	if st != "200 OK" || res != "LoveSong3" ||
+		h.Get(HTTPHeaderTotalCount) != "5" || h.Get(HTTPHeaderHasMore) != "false" {
+		t.Error("Unexpected response:", st, res, h)
+		return
+	}
+
+	st, h, res = sendTestRequest(queryURL+"//main?q=get+Song+show+key+limit+5&sorted=true&limit=4&offset=3", "GET", nil)
+
+	if st != "200 OK" || !strings.Contains(res, `"total_count": 5`) || !strings.Contains(res, `"DeadSong2"`) ||
+		strings.Contains(res, `"FightSong4"`) || h.Get(HTTPHeaderHasMore) != "false" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	_, _, res = sendTestRequest(queryURL+"//main?rid=abc&offset=5&limit=1", "GET", nil)
 
 	if res != "Unknown result id (rid parameter)" {
 		t.Error("Unexpected response:", res)
@@ -188,16 +295,73 @@ func TestQueryPagination(t *testing.T) {
 func TestQuery(t *testing.T) {
 	queryURL := "http://localhost" + TESTPORT + EndpointQuery
 
-	// POST requests should not be allowed
+	// POST requests submit query jobs and need a partition and the async parameter
 
-	_, _, res := sendTestRequest(queryURL, "POST",
+	st, _, res := sendTestRequest(queryURL, "POST",
 		[]byte(`{"msg":"Hello!"}`))
 
-	if res != "Method Not Allowed" {
-		t.Error("Unexpected response:", res)
+	if st != "400 Bad Request" || res != "Need a partition" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main", "POST", []byte("get Song"))
+
+	if st != "400 Bad Request" || res != "POST requests need the async parameter" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Submit a job, poll it until it is done and page through its result
+
+	st, h, res := sendTestRequest(queryURL+"main?async=true&sorted=true&q=get+Song+show+key", "POST", nil)
+
+	if st != "202 Accepted" || !strings.Contains(res, `"status": "`) {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	jobURL := "http://localhost" + TESTPORT + h.Get("Location")
+
+	for i := 0; i < 100; i++ {
+		if _, _, res = sendTestRequest(jobURL, "GET", nil); strings.Contains(res, `"status": "done"`) {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var page struct {
+		Status string
+		Result struct {
+			Rows       [][]interface{}
+			TotalCount int  `json:"total_count"`
+			HasMore    bool `json:"has_more"`
+			NextOffset int  `json:"next_offset"`
+		}
+	}
+
+	_, _, res = sendTestRequest(jobURL+"?offset=2&limit=3", "GET", nil)
+
+	if err := json.Unmarshal([]byte(res), &page); err != nil || page.Status != "done" ||
+		fmt.Sprint(page.Result.Rows) != "[[Aria3] [Aria4] [DeadSong2]]" || page.Result.TotalCount != 9 ||
+		!page.Result.HasMore || page.Result.NextOffset != 5 {
+		t.Error("Unexpected response:", err, res)
+		return
+	}
+
+	_, _, res = sendTestRequest(jobURL+"?offset=8&limit=3", "GET", nil)
+
+	page.Result.NextOffset = 0
+
+	if err := json.Unmarshal([]byte(res), &page); err != nil ||
+		fmt.Sprint(page.Result.Rows) != "[[StrangeSong1]]" || page.Result.HasMore || page.Result.NextOffset != 0 {
+		t.Error("Unexpected response:", err, res)
 		return
 	}
 
+	sendTestRequest(jobURL, "DELETE", nil)
+
 	// Test error message
 
 	_, _, res = sendTestRequest(queryURL+"main", "GET", nil)
@@ -230,10 +394,9 @@ func TestQuery(t *testing.T) {
 
 	// Test first real query
 
-	st, _, res := sendTestRequest(queryURL+"//main?q=get+Song+with+ordering(ascending+key)", "GET", nil)
-	st, _, res2 := sendTestRequest(queryURL+"//main?q=get+Song+with+ordering(ascending+key);offset=0;limit=9", "GET", nil)
+	st, _, res = sendTestRequest(queryURL+"//main?q=get+Song+with+ordering(ascending+key)", "GET", nil)
 
-	if st != "200 OK" || res2 != res || res != `
+	if st != "200 OK" || res != `
 {
   "header": {
     "data": [
@@ -251,6 +414,9 @@ func TestQuery(t *testing.T) {
       "Song Name",
       "Ranking"
     ],
+    "ordering": [
+      "ascending 1:n:key"
+    ],
     "primary_kind": "Song"
   },
   "rows": [
@@ -302,20 +468,35 @@ func TestQuery(t *testing.T) {
   ],
   "sources": [
     [
-      "n:Song:StrangeSong1",
-      "n:Song:StrangeSong1",
-      "n:Song:StrangeSong1"
+      "n:Song:Aria1",
+      "n:Song:Aria1",
+      "n:Song:Aria1"
     ],
     [
-      "n:Song:FightSong4",
-      "n:Song:FightSong4",
-      "n:Song:FightSong4"
+      "n:Song:Aria2",
+      "n:Song:Aria2",
+      "n:Song:Aria2"
+    ],
+    [
+      "n:Song:Aria3",
+      "n:Song:Aria3",
+      "n:Song:Aria3"
+    ],
+    [
+      "n:Song:Aria4",
+      "n:Song:Aria4",
+      "n:Song:Aria4"
     ],
     [
       "n:Song:DeadSong2",
       "n:Song:DeadSong2",
       "n:Song:DeadSong2"
     ],
+    [
+      "n:Song:FightSong4",
+      "n:Song:FightSong4",
+      "n:Song:FightSong4"
+    ],
     [
       "n:Song:LoveSong3",
       "n:Song:LoveSong3",
@@ -327,27 +508,853 @@ func TestQuery(t *testing.T) {
       "n:Song:MyOnlySong3"
     ],
     [
-      "n:Song:Aria1",
-      "n:Song:Aria1",
+      "n:Song:StrangeSong1",
+      "n:Song:StrangeSong1",
+      "n:Song:StrangeSong1"
+    ]
+  ]
+}`[1:] {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// A page which covers all rows has the same rows and counts all rows
+
+	st, _, res2 := sendTestRequest(queryURL+"//main?q=get+Song+with+ordering(ascending+key)&offset=0&limit=9", "GET", nil)
+
+	var all, paged map[string]interface{}
+
+	json.Unmarshal([]byte(res), &all)
+	json.Unmarshal([]byte(res2), &paged)
+
+	if st != "200 OK" || fmt.Sprint(paged["rows"]) != fmt.Sprint(all["rows"]) ||
+		fmt.Sprint(paged["total_count"]) != "9" || paged["has_more"] != false {
+		t.Error("Unexpected response:", st, res2)
+		return
+	}
+}
+
+func TestSortedQuery(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointQuery
+
+	st, h, res := sendTestRequest(queryURL+"main?q=get+Song+show+key&sorted=true&limit=3", "GET", nil)
+
+	if st != "200 OK" || h.Get(HTTPHeaderHasMore) != "true" || h.Get(HTTPHeaderCursor) == "" || res != `
+{
+  "cursor": "`[1:]+h.Get(HTTPHeaderCursor)+`",
+  "has_more": true,
+  "header": {
+    "data": [
+      "1:n:key"
+    ],
+    "format": [
+      "auto"
+    ],
+    "labels": [
+      "Song Key"
+    ],
+    "ordering": [],
+    "primary_kind": "Song"
+  },
+  "rows": [
+    [
+      "Aria1"
+    ],
+    [
+      "Aria2"
+    ],
+    [
+      "Aria3"
+    ]
+  ],
+  "sources": [
+    [
       "n:Song:Aria1"
     ],
     [
-      "n:Song:Aria2",
-      "n:Song:Aria2",
       "n:Song:Aria2"
     ],
     [
-      "n:Song:Aria3",
-      "n:Song:Aria3",
       "n:Song:Aria3"
-    ],
-    [
-      "n:Song:Aria4",
-      "n:Song:Aria4",
-      "n:Song:Aria4"
     ]
-  ]
-}`[1:] {
+  ],
+  "total_count": 9
+}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song&sorted=p", "GET", nil)
+
+	if st != "400 Bad Request" || res != "Invalid parameter value: sorted should be a boolean" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+}
+
+func TestSampledQuery(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointQuery
+
+	st, header, res := sendTestRequest(queryURL+"main?q=get+Song+show+key&sample=3", "GET", nil)
+
+	if st != "200 OK" || header.Get(HTTPHeaderTotalCount) != "3" {
+		t.Error("Unexpected response:", st, header, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song&sample=0", "GET", nil)
+
+	if st != "400 Bad Request" || res != "Invalid parameter value: sample should be greater than 0" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song&sample=p", "GET", nil)
+
+	if st != "400 Bad Request" || res != "Invalid parameter value: sample should be a positive integer number" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointQuery
+
+	eql.MaxQueryTime = time.Nanosecond
+	defer func() {
+		eql.MaxQueryTime = 0
+	}()
+
+	st, _, res := sendTestRequest(queryURL+"main?q=get+Song", "GET", nil)
+
+	if st != "504 Gateway Timeout" || res != "EQL error in Main query: Query timed out (0 rows were produced)" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song&stream=true", "GET", nil)
+
+	if st != "504 Gateway Timeout" || res != "EQL error in Main query: Query timed out (0 rows were produced)" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+}
+
+func TestQueryLimits(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointQuery
+
+	QueryMaxNodes = 2
+	defer func() {
+		QueryMaxNodes = 0
+	}()
+
+	st, _, res := sendTestRequest(queryURL+"main?q=get+Song", "GET", nil)
+
+	if st != "422 Unprocessable Entity" || !strings.HasPrefix(res,
+		"EQL error in Main query: Query limit exceeded (more than 2 nodes - 3 nodes were visited") {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	QueryMaxNodes = 0
+	QueryMaxRows = 1
+	defer func() {
+		QueryMaxRows = 0
+	}()
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song", "GET", nil)
+
+	if st != "422 Unprocessable Entity" || !strings.HasPrefix(res,
+		"EQL error in Main query: Query limit exceeded (more than 1 rows - 2 nodes were visited and 1 rows were produced)") {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song&limit=1", "GET", nil)
+
+	if st != "200 OK" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+}
+
+func TestQueryMutation(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointQuery
+
+	st, _, res := sendTestRequest(queryURL+"main?q=delete+from+Song+where+true", "GET", nil)
+
+	if st != "400 Bad Request" || res != "Delete and update statements are not supported by the query endpoint" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+}
+
+func TestStreamedQuery(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointQuery
+
+	st, h, res := sendTestRequest(queryURL+"main?q=get+Song+show+key+with+ordering(descending+key)&stream=true&limit=2", "GET", nil)
+
+	if st != "200 OK" || h.Get(HTTPHeaderCacheID) != "" || res != `
+{
+  "rows": [
+    [
+      "StrangeSong1"
+    ],
+    [
+      "MyOnlySong3"
+    ]
+  ],
+  "header": {
+    "data": [
+      "1:n:key"
+    ],
+    "format": [
+      "auto"
+    ],
+    "labels": [
+      "Song Key"
+    ],
+    "ordering": [
+      "descending 1:n:key"
+    ],
+    "primary_kind": "Song"
+  }
+}`[1:] {
+		t.Error("Unexpected response:", st, h, res)
+		return
+	}
+
+	// Total count and has more flag are sent as trailers - the total count
+	// of a page is the number of all rows
+
+	resp, err := http.Get(queryURL + "main?q=get+Song+show+key&stream=true&sorted=true&offset=1&limit=3")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != `{"rows":[["Aria2"],["Aria3"],["Aria4"]],"header":{"data":["1:n:key"],"format":["auto"],"labels":["Song Key"],"ordering":[],"primary_kind":"Song"},"cursor":"`+
+		resp.Trailer.Get(HTTPHeaderCursor)+`"}`+"\n" || resp.Trailer.Get(HTTPHeaderCursor) == "" ||
+		resp.Trailer.Get(HTTPHeaderTotalCount) != "9" || resp.Trailer.Get(HTTPHeaderHasMore) != "true" {
+		t.Error("Unexpected response:", string(body), resp.Trailer)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song&stream=p", "GET", nil)
+
+	if st != "400 Bad Request" || res != "Invalid parameter value: stream should be a boolean" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+BLA&stream=true", "GET", nil)
+
+	if st != "500 Internal Server Error" || res != "EQL error in Main query: Unknown node kind (BLA) (Line:1 Pos:5)" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+}
+
+func TestCSVQuery(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointQuery
+
+	resp, err := http.Get(queryURL + "main?q=get+Song+where+ranking+<+4+show+key,+ranking+as+'Rank,+no'&sorted=true&format=csv")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.Status != "200 OK" || string(body) != `
+Song Key,"Rank, no"
+Aria2,2
+FightSong4,3
+LoveSong3,1
+`[1:] || resp.Header.Get("Content-Type") != "text/csv; charset=utf-8" ||
+		resp.Header.Get("Content-Disposition") != `attachment; filename="main.csv"` ||
+		resp.Trailer.Get(HTTPHeaderTotalCount) != "3" || resp.Trailer.Get(HTTPHeaderHasMore) != "false" {
+		t.Error("Unexpected response:", resp.Status, string(body), resp.Header, resp.Trailer)
+		return
+	}
+
+	// TSV is selected with the Accept header
+
+	req, _ := http.NewRequest("GET", queryURL+"main?q=get+Song+where+ranking+<+4+show+key&sorted=true&header=false&raw=true", nil)
+	req.Header.Set("Accept", "text/tab-separated-values")
+
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.Status != "200 OK" || string(body) != `
+"""Aria2"""
+"""FightSong4"""
+"""LoveSong3"""
+`[1:] || resp.Header.Get("Content-Type") != "text/tab-separated-values; charset=utf-8" ||
+		resp.Header.Get("Content-Disposition") != `attachment; filename="main.tsv"` {
+		t.Error("Unexpected response:", resp.Status, string(body), resp.Header)
+		return
+	}
+
+	// Media ranges with a weight of 0 are not acceptable
+
+	req, _ = http.NewRequest("GET", queryURL+"main?q=get+Song+where+ranking+<+4+show+key", nil)
+	req.Header.Set("Accept", "text/csv;q=0, application/json;q=0.5")
+
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	resp.Body.Close()
+
+	if resp.Status != "200 OK" || resp.Header.Get("Content-Type") != "application/json; charset=utf-8" ||
+		resp.Header.Get("Content-Disposition") != "" {
+		t.Error("Unexpected response:", resp.Status, resp.Header)
+		return
+	}
+
+	for accept, format := range map[string]string{
+		"":                                 "",
+		"text/csv":                         "csv",
+		"text/csv;q=0":                     "",
+		"text/csv; q=0.0, */*":             "",
+		"application/json, text/csv":       "json",
+		"application/json;q=0.5, text/csv": "csv",
+		"text/csv;q=0.4, text/tab-separated-values;q=0.8": "tsv",
+		"text/csv;q=x, text/html":                         "",
+		"text/csv;;, TEXT/CSV":                            "csv",
+	} {
+		if res := acceptedFormat(accept); res != format {
+			t.Error("Unexpected format for", accept, ":", res, "expected:", format)
+			return
+		}
+	}
+
+	// The total count of a paged CSV result is the number of all rows
+
+	resp, err = http.Get(queryURL + "main?q=get+Song+show+key&sorted=true&format=csv&header=false&offset=2&limit=3")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.Status != "200 OK" || string(body) != "Aria3\nAria4\nDeadSong2\n" ||
+		resp.Trailer.Get(HTTPHeaderTotalCount) != "9" || resp.Trailer.Get(HTTPHeaderHasMore) != "true" {
+		t.Error("Unexpected response:", resp.Status, string(body), resp.Trailer)
+		return
+	}
+
+	// Cached results can be written as CSV
+
+	_, h, _ := sendTestRequest(queryURL+"main?q=get+Song+show+key+with+ordering(ascending+key)", "GET", nil)
+
+	rid := h.Get(HTTPHeaderCacheID)
+
+	st, h, res := sendTestRequest(queryURL+"main?rid="+rid+"&format=csv&offset=1&limit=2", "GET", nil)
+
+	if st != "200 OK" || res != "Song Key\nAria2\nAria3" || h.Get(HTTPHeaderTotalCount) != "9" {
+		t.Error("Unexpected response:", st, res, h)
+		return
+	}
+
+	// The file name is taken from the name parameter
+
+	st, h, _ = sendTestRequest(queryURL+"main?rid="+rid+"&format=csv&name=Top+Songs", "GET", nil)
+
+	if st != "200 OK" || h.Get("Content-Disposition") != `attachment; filename="Top_Songs.csv"` {
+		t.Error("Unexpected response:", st, h)
+		return
+	}
+
+	st, h, _ = sendTestRequest(queryURL+"main?q=get+Song&format=tsv&name="+url.QueryEscape(`../Top Songs "2026"`), "GET", nil)
+
+	if st != "200 OK" || h.Get("Content-Disposition") != `attachment; filename="Top_Songs__2026.tsv"` {
+		t.Error("Unexpected response:", st, h)
+		return
+	}
+
+	// Names without usable characters fall back to the partition
+
+	st, h, _ = sendTestRequest(queryURL+"main?q=get+Song&format=csv&name="+url.QueryEscape(`/.."`), "GET", nil)
+
+	if st != "200 OK" || h.Get("Content-Disposition") != `attachment; filename="main.csv"` {
+		t.Error("Unexpected response:", st, h)
+		return
+	}
+
+	if res := sanitizeFilename(strings.Repeat("a", 99) + "-bbb"); res != strings.Repeat("a", 99) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := sanitizeFilename("Grüße, 日本語!"); res != "Gr__e" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Errors
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song&format=xml", "GET", nil)
+
+	if st != "400 Bad Request" || res != "Invalid parameter value: format should be json, csv or tsv" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song&format=csv&header=x", "GET", nil)
+
+	if st != "400 Bad Request" || res != "Invalid parameter value: header should be a boolean" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, h, res = sendTestRequest(queryURL+"main?q=get+BLA&format=csv", "GET", nil)
+
+	if st != "500 Internal Server Error" || res != "EQL error in Main query: Unknown node kind (BLA) (Line:1 Pos:5)" ||
+		h.Get("Content-Disposition") != "" {
+		t.Error("Unexpected response:", st, res, h)
+		return
+	}
+}
+
+func TestCursorQuery(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointQuery
+
+	// Follow the cursors of a query until all rows were returned
+
+	var keys []interface{}
+
+	st, h, res := sendTestRequest(queryURL+"main?q=get+Song+show+key&limit=4&sorted=true", "GET", nil)
+
+	// A result with only a limit is continued with its cursor and not cached
+
+	if h.Get(HTTPHeaderCacheID) != "" {
+		t.Error("Unexpected response:", res, h)
+		return
+	}
+
+	for i := 0; st == "200 OK"; i++ {
+		var data map[string]interface{}
+
+		json.Unmarshal([]byte(res), &data)
+
+		for _, row := range data["rows"].([]interface{}) {
+			keys = append(keys, row.([]interface{})[0])
+		}
+
+		cursor := h.Get(HTTPHeaderCursor)
+
+		if cursor == "" || i > 3 {
+			break
+		} else if data["cursor"] != cursor {
+			t.Error("Unexpected response:", res, h)
+			return
+		}
+
+		st, h, res = sendTestRequest(queryURL+"main?q=get+Song+show+key&limit=4&cursor="+cursor, "GET", nil)
+	}
+
+	if st != "200 OK" || h.Get(HTTPHeaderHasMore) != "false" || fmt.Sprint(keys) !=
+		"[Aria1 Aria2 Aria3 Aria4 DeadSong2 FightSong4 LoveSong3 MyOnlySong3 StrangeSong1]" {
+		t.Error("Unexpected response:", st, res, keys)
+		return
+	}
+
+	// Streamed and CSV results send the cursor as trailer
+
+	resp, err := http.Get(queryURL + "main?q=get+Song+show+key&stream=true&sorted=true&limit=4")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	cursor := resp.Trailer.Get(HTTPHeaderCursor)
+
+	resp, err = http.Get(queryURL + "main?q=get+Song+show+key&format=csv&header=false&limit=4&cursor=" + cursor)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.Status != "200 OK" || string(body) != "DeadSong2\nFightSong4\nLoveSong3\nMyOnlySong3\n" ||
+		resp.Trailer.Get(HTTPHeaderHasMore) != "true" || resp.Trailer.Get(HTTPHeaderCursor) == "" {
+		t.Error("Unexpected response:", resp.Status, string(body), resp.Trailer)
+		return
+	}
+
+	// Cursors are only valid for the query they were created for
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song+show+key&limit=5&cursor="+cursor, "GET", nil)
+
+	if st != "400 Bad Request" || res != "EQL error in Main query: Invalid cursor (Cursor was created for a different query)" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song+show+key&limit=4&stream=true&cursor=x", "GET", nil)
+
+	if st != "400 Bad Request" || res != "EQL error in Main query: Invalid cursor (Malformed cursor)" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song+show+key&limit=4&offset=1&cursor="+cursor, "GET", nil)
+
+	if st != "400 Bad Request" || res != "Cursor parameter cannot be combined with offset or sample parameter" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+}
+
+func TestQueryCache(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointQuery
+
+	sendTestRequest(queryURL+"main?q=get+Song", "GET", nil)
+
+	size := QueryCache.Size()
+
+	// Queries are parsed once and then taken from the cache
+
+	for i := 0; i < 3; i++ {
+		st, h, _ := sendTestRequest(queryURL+"main?q=get+Song+where+ranking+>+7+show+key", "GET", nil)
+
+		if st != "200 OK" || h.Get(HTTPHeaderTotalCount) != "3" || QueryCache.Size() != size+1 {
+			t.Error("Unexpected response:", st, h, QueryCache.Size())
+			return
+		}
+	}
+
+	pq, ok := QueryCache.Get("Main query\x00get Song where ranking > 7 show key")
+	if !ok || pq.(*eql.PreparedQuery).Query() != "get Song where ranking > 7 show key" {
+		t.Error("Unexpected cache content:", QueryCache)
+		return
+	}
+
+	// Paging parameters are not part of the query text - pages of a query
+	// use the same prepared query
+
+	st, h, _ := sendTestRequest(queryURL+"main?q=get+Song+where+ranking+>+7+show+key&limit=1", "GET", nil)
+
+	if st != "200 OK" || h.Get(HTTPHeaderTotalCount) != "3" || QueryCache.Size() != size+1 {
+		t.Error("Unexpected response:", st, h, QueryCache.Size())
+		return
+	}
+
+	// Queries with parse errors are not cached
+
+	st, _, res := sendTestRequest(queryURL+"main?q=get+Song+where", "GET", nil)
+
+	if st != "400 Bad Request" || !strings.Contains(res, `"error": "Parse error in Main query: Unexpected end (Line:1 Pos:15)"`) ||
+		QueryCache.Size() != size+1 {
+		t.Error("Unexpected response:", st, res, QueryCache.Size())
+		return
+	}
+}
+
+func TestQueryParseError(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointQuery
+
+	// Parse errors are returned as JSON object with the location of the error
+
+	st, h, res := sendTestRequest(queryURL+"main?q=get+Song+whree+name+%3D+x", "GET", nil)
+
+	if st != "400 Bad Request" || h.Get("Content-Type") != "application/json; charset=utf-8" || res != `
+{
+  "detail": "whree",
+  "error": "Parse error in Main query: Unexpected term (whree) (Line:1 Pos:10)",
+  "expected": [
+    "where",
+    "traverse",
+    "show",
+    "with",
+    "from",
+    "primary",
+    "limit",
+    "offset"
+  ],
+  "hint": "expected 'where', 'traverse', 'show', 'with', 'from', 'primary', 'limit', 'offset' - did you mean 'where'?",
+  "line": 1,
+  "offset": 9,
+  "pos": 10,
+  "suggestions": [
+    "where"
+  ],
+  "token": "whree",
+  "type": "Unexpected term"
+}`[1:] {
+		t.Error("Unexpected response:", st, h, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song+where", "GET", nil)
+
+	if st != "400 Bad Request" || !strings.Contains(res, `"expected": [],`) ||
+		!strings.Contains(res, `"offset": 14,`) || !strings.Contains(res, `"suggestions": [],`) {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Errors which occur after parsing are returned as text
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Bla", "GET", nil)
+
+	if st != "500 Internal Server Error" || res != "EQL error in Main query: Unknown node kind (Bla) (Line:1 Pos:5)" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Requests which accept JSON get the location of the error as details
+
+	req, _ := http.NewRequest("GET", queryURL+"main?q=get+Song+where", nil)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusBadRequest || !strings.HasPrefix(string(body),
+		`{"code":400,"message":"Parse error in Main query: Unexpected end (Line:1 Pos:15)","details":{"detail":"",`) ||
+		!strings.Contains(string(body), `"offset":14,`) {
+		t.Error("Unexpected response:", resp.Status, string(body))
+		return
+	}
+}
+
+func TestHighlightQuery(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointQuery
+
+	st, h, res := sendTestRequest(queryURL+"main?q=get+Song+where+@phrase(name,+'aria1')+or+key+=+Aria2+show+key"+
+		"&sorted=true&highlight=true", "GET", nil)
+
+	if st != "200 OK" || res != `
+{
+  "header": {
+    "data": [
+      "1:n:key"
+    ],
+    "format": [
+      "auto"
+    ],
+    "labels": [
+      "Song Key"
+    ],
+    "ordering": [],
+    "primary_kind": "Song"
+  },
+  "highlights": [
+    [
+      {
+        "attr": "name",
+        "key": "Aria1",
+        "kind": "Song",
+        "matches": [
+          [
+            0,
+            5
+          ]
+        ]
+      }
+    ],
+    []
+  ],
+  "rows": [
+    [
+      "Aria1"
+    ],
+    [
+      "Aria2"
+    ]
+  ],
+  "sources": [
+    [
+      "n:Song:Aria1"
+    ],
+    [
+      "n:Song:Aria2"
+    ]
+  ]
+}`[1:] {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Highlights of cached results are sliced like the rows
+
+	rid := h.Get(HTTPHeaderCacheID)
+
+	st, _, res = sendTestRequest(queryURL+"main?rid="+rid+"&offset=1&highlight=true", "GET", nil)
+
+	if st != "200 OK" || !strings.Contains(res, `"highlights": [
+    []
+  ],`) {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?rid="+rid, "GET", nil)
+
+	if st != "200 OK" || strings.Contains(res, "highlights") {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song&highlight=true&stream=true", "GET", nil)
+
+	if st != "400 Bad Request" || res != "Highlight parameter cannot be combined with stream parameter" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song&highlight=true&format=csv", "GET", nil)
+
+	if st != "400 Bad Request" || res != "Highlight parameter cannot be combined with CSV or TSV format" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+}
+
+func TestStatsQuery(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointQuery
+
+	stats := func(res string) string {
+		var data map[string]map[string]interface{}
+		json.Unmarshal([]byte(res), &data)
+
+		s := data["stats"]
+		if s == nil {
+			return "<no stats>"
+		}
+
+		return fmt.Sprint(s["version"], s["start_nodes"], s["nodes"], s["node_fetches"], s["duration_ns"].(float64) > 0)
+	}
+
+	st, h, res := sendTestRequest(queryURL+"main?q=get+Song+where+ranking+>+5&stats=true", "GET", nil)
+
+	if st != "200 OK" || stats(res) != "1 9 9 9 true" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Cached results keep their statistics
+
+	rid := h.Get(HTTPHeaderCacheID)
+
+	st, _, res = sendTestRequest(queryURL+"main?rid="+rid+"&stats=true", "GET", nil)
+
+	if st != "200 OK" || stats(res) != "1 9 9 9 true" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?rid="+rid, "GET", nil)
+
+	if st != "200 OK" || stats(res) != "<no stats>" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Statistics of streamed results are written after the rows
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Author&stats=true&stream=true", "GET", nil)
+
+	if st != "200 OK" || stats(res) != "1 3 3 3 true" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song&stats=true&format=csv", "GET", nil)
+
+	if st != "400 Bad Request" || res != "Stats parameter cannot be combined with CSV or TSV format" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song&stats=x", "GET", nil)
+
+	if st != "400 Bad Request" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+}
+
+func TestValidateQuery(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointQuery
+
+	// The validation result is returned instead of data
+
+	st, h, res := sendTestRequest(queryURL+"main?q=get+Song+where+nmae+%3D+x&validate=true", "GET", nil)
+
+	if st != "200 OK" || h.Get("Content-Type") != "application/json; charset=utf-8" ||
+		h.Get(HTTPHeaderCacheID) != "" || res != `
+{
+  "valid": true,
+  "errors": [],
+  "warnings": [
+    {
+      "type": "unknown_attribute",
+      "detail": "Attribute 'nmae' is not known for node kind 'Song' - the name is compared as a literal value",
+      "line": 1,
+      "pos": 16
+    }
+  ]
+}`[1:] {
+		t.Error("Unexpected response:", st, h, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song+whree+name+%3D+x&validate=true", "GET", nil)
+
+	if st != "200 OK" || !strings.Contains(res, `"valid": false`) ||
+		!strings.Contains(res, `"detail": "Unexpected term (whree)"`) || !strings.Contains(res, `"type": "syntax"`) {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Statements which change the graph are only validated
+
+	st, _, res = sendTestRequest(queryURL+"main?q=delete+from+Song+where+key+%3D+Aria1&validate=true", "GET", nil)
+
+	if st != "200 OK" || !strings.Contains(res, `"valid": true`) {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?q=lookup+Song+%27Aria1%27", "GET", nil)
+
+	if st != "200 OK" || !strings.Contains(res, `"Aria1"`) {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song&validate=x", "GET", nil)
+
+	if st != "400 Bad Request" {
 		t.Error("Unexpected response:", st, res)
 		return
 	}
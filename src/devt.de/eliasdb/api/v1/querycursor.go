@@ -0,0 +1,150 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"devt.de/common/datautil"
+	"devt.de/eliasdb/api"
+	"devt.de/eliasdb/eql"
+)
+
+/*
+QueryCursorMaxCount is the maximum number of open server-side cursors. The
+oldest cursor is closed if a new cursor is opened and the maximum has been
+reached (0 means no limit).
+*/
+var QueryCursorMaxCount uint64 = 100
+
+/*
+QueryCursorMaxRows is the maximum number of result rows a server-side cursor
+can hold. Queries which produce more rows fail (0 means no limit).
+*/
+var QueryCursorMaxRows = 10000
+
+/*
+QueryCursorTTL is the time in seconds a server-side cursor is kept after its
+last page was requested (0 means no expiry).
+*/
+var QueryCursorTTL int64 = 300
+
+/*
+QueryCursorPageSize is the number of rows of a page of a server-side cursor
+if no limit parameter was given.
+*/
+var QueryCursorPageSize = 100
+
+/*
+CursorCache holds all open server-side cursors.
+*/
+var CursorCache *datautil.MapCache
+
+/*
+queryCursor is a server-side cursor which holds the result of a query. The
+result reflects the state of the graph at the time the query was run.
+*/
+type queryCursor struct {
+	res       eql.SearchResult // Result of the query
+	part      string           // Queried partition
+	pos       int              // Position of the next page
+	pageSize  int              // Number of rows of a page
+	highlight bool             // Flag if the matches of @phrase conditions are returned
+	closed    bool             // Flag if all pages have been returned
+	lock      *sync.Mutex      // Lock for the position of the cursor
+}
+
+/*
+CloseCursors closes all open server-side cursors (e.g. when the server shuts
+down). Requests for pages of closed cursors are answered with 410 (Gone).
+*/
+func CloseCursors() {
+	if CursorCache != nil {
+		CursorCache = datautil.NewMapCache(QueryCursorMaxCount, QueryCursorTTL)
+	}
+}
+
+/*
+openCursor stores the result of a query in a new server-side cursor and writes
+its first page for the client.
+*/
+func (eq *queryEndpoint) openCursor(w http.ResponseWriter, r *http.Request, part string,
+	res eql.SearchResult, pageSize int, highlight bool, stats bool) {
+
+	if pageSize == -1 {
+		pageSize = QueryCursorPageSize
+	}
+
+	cur := &queryCursor{res, part, 0, pageSize, highlight, false, &sync.Mutex{}}
+
+	eq.writeCursorPageData(w, r, genID(), cur, -1, stats)
+}
+
+/*
+writeCursorPage writes the next page of a server-side cursor of a given
+partition for the client. The page size of the cursor is used if no limit is
+given.
+*/
+func (eq *queryEndpoint) writeCursorPage(w http.ResponseWriter, r *http.Request, part string,
+	cursorID string, limit int, stats bool) {
+
+	cur, ok := CursorCache.Get(cursorID)
+	if !ok || cur.(*queryCursor).part != part {
+		api.WriteError(w, r, "Cursor is exhausted, has expired or is unknown", http.StatusGone)
+		return
+	}
+
+	eq.writeCursorPageData(w, r, cursorID, cur.(*queryCursor), limit, stats)
+}
+
+/*
+writeCursorPageData writes the next page of a given server-side cursor. The
+cursor is kept as long as more rows exist.
+*/
+func (eq *queryEndpoint) writeCursorPageData(w http.ResponseWriter, r *http.Request, cursorID string,
+	cur *queryCursor, limit int, stats bool) {
+
+	cur.lock.Lock()
+	defer cur.lock.Unlock()
+
+	// A concurrent request might have returned the last page
+
+	if cur.closed {
+		api.WriteError(w, r, "Cursor is exhausted, has expired or is unknown", http.StatusGone)
+		return
+	}
+
+	if limit == -1 {
+		limit = cur.pageSize
+	}
+
+	data := eq.resultData(w, cur.res, "", cur.pos, limit, cur.res.RowCount(), cur.highlight, stats)
+
+	cur.pos += limit
+
+	// Keep the cursor (and reset its expiry) if more rows exist
+
+	if cur.pos < cur.res.RowCount() {
+		data["cursor_id"] = cursorID
+		w.Header().Add(HTTPHeaderCursorID, cursorID)
+		CursorCache.Put(cursorID, cur)
+
+	} else {
+		cur.closed = true
+		CursorCache.Remove(cursorID)
+	}
+
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,136 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestServerCursor(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointQuery
+
+	keys := func(res string) string {
+		var data map[string]interface{}
+		var ret []interface{}
+
+		json.Unmarshal([]byte(res), &data)
+
+		for _, row := range data["rows"].([]interface{}) {
+			ret = append(ret, row.([]interface{})[0])
+		}
+
+		return fmt.Sprint(ret, " ", data["total_count"], " ", data["has_more"], " ", data["cursor_id"] != nil)
+	}
+
+	// The first page is returned with the query
+
+	st, h, res := sendTestRequest(queryURL+"main?q=get+Song+show+key+with+ordering(ascending+key)&cursor=true&limit=4", "GET", nil)
+
+	cursorID := h.Get(HTTPHeaderCursorID)
+
+	if st != "200 OK" || cursorID == "" || h.Get(HTTPHeaderTotalCount) != "9" || h.Get(HTTPHeaderCacheID) != "" ||
+		keys(res) != "[Aria1 Aria2 Aria3 Aria4] 9 true true" {
+		t.Error("Unexpected response:", st, res, h)
+		return
+	}
+
+	// Following pages are returned with the cursor id
+
+	st, h, res = sendTestRequest(queryURL+"main?cursor_id="+cursorID, "GET", nil)
+
+	if st != "200 OK" || h.Get(HTTPHeaderCursorID) != cursorID ||
+		keys(res) != "[DeadSong2 FightSong4 LoveSong3 MyOnlySong3] 9 true true" {
+		t.Error("Unexpected response:", st, res, h)
+		return
+	}
+
+	st, h, res = sendTestRequest(queryURL+"main?cursor_id="+cursorID+"&limit=10", "GET", nil)
+
+	if st != "200 OK" || h.Get(HTTPHeaderCursorID) != "" || h.Get(HTTPHeaderHasMore) != "false" ||
+		keys(res) != "[StrangeSong1] 9 false false" {
+		t.Error("Unexpected response:", st, res, h)
+		return
+	}
+
+	// The cursor is closed once all rows were returned
+
+	st, _, res = sendTestRequest(queryURL+"main?cursor_id="+cursorID, "GET", nil)
+
+	if st != "410 Gone" || res != "Cursor is exhausted, has expired or is unknown" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Offsets are applied to the query and the default page size is used
+	// if no limit is given
+
+	QueryCursorPageSize = 3
+	defer func() {
+		QueryCursorPageSize = 100
+	}()
+
+	st, h, res = sendTestRequest(queryURL+"main?q=get+Song+show+key+with+ordering(ascending+key)&cursor=true&offset=2", "GET", nil)
+
+	if st != "200 OK" || keys(res) != "[Aria3 Aria4 DeadSong2] 7 true true" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Cursors are closed when the server shuts down
+
+	CloseCursors()
+
+	st, _, res = sendTestRequest(queryURL+"main?cursor_id="+h.Get(HTTPHeaderCursorID), "GET", nil)
+
+	if st != "410 Gone" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// The number of rows of a cursor is limited
+
+	QueryCursorMaxRows = 5
+	defer func() {
+		QueryCursorMaxRows = 10000
+	}()
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song&cursor=true", "GET", nil)
+
+	if st != "422 Unprocessable Entity" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Test error cases
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song&cursor=true&format=csv", "GET", nil)
+
+	if st != "400 Bad Request" || res != "Cursor mode cannot be combined with CSV or TSV format" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?q=get+Song&cursor=true&stream=true", "GET", nil)
+
+	if st != "400 Bad Request" || res != "Cursor mode cannot be combined with stream parameter" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?cursor_id=1&format=csv", "GET", nil)
+
+	if st != "400 Bad Request" || res != "Cursor id parameter cannot be combined with CSV or TSV format" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+}
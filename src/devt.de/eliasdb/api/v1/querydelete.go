@@ -0,0 +1,276 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"devt.de/eliasdb/api"
+	"devt.de/eliasdb/eql"
+	"devt.de/eliasdb/graph"
+)
+
+/*
+QueryDeleteMaxNodes is the maximum number of nodes which can be deleted with
+a single request unless the request confirms the number of nodes (0 means no
+limit).
+*/
+var QueryDeleteMaxNodes = 1000
+
+/*
+QueryDeleteBatchSize is the number of nodes which are deleted in a single
+graph transaction.
+*/
+var QueryDeleteBatchSize = 100
+
+/*
+queryDeleteResult is the result of a delete-by-query request.
+*/
+type queryDeleteResult struct {
+	Matched int  `json:"matched"` // Number of start nodes in the query result
+	Deleted int  `json:"deleted"` // Number of deleted nodes
+	DryRun  bool `json:"dry_run"` // Flag if nothing was deleted
+}
+
+/*
+HandleDELETE runs a query and deletes all start nodes of its result. Nodes
+are deleted in batches - edges of deleted nodes are removed and cascading
+deletions are applied as for any other node deletion.
+*/
+func (eq *queryEndpoint) HandleDELETE(w http.ResponseWriter, r *http.Request, resources []string) {
+
+	if !checkResources(w, r, resources, 1, 1, "Need a partition") {
+		return
+	}
+
+	part := resources[0]
+
+	// A DELETE request requires write access to the partition
+
+	if !api.Authorize(w, r, part, "") {
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+
+	if query == "" {
+		api.WriteError(w, r, "Missing query (q parameter)", http.StatusBadRequest)
+		return
+	} else if eql.IsMutation(query) {
+		api.WriteError(w, r, "Delete and update statements are not supported by the query endpoint", http.StatusBadRequest)
+		return
+	}
+
+	// Get dryRun parameter; false if not set
+
+	dryRun, ok := queryParamBool(w, r, "dryRun")
+	if !ok {
+		return
+	}
+
+	// Get confirm parameter; -1 if not set - the number of nodes which
+	// should be deleted must match the query result
+
+	confirm, ok := queryParamPosNum(w, r, "confirm")
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	if QueryTimeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(QueryTimeout)*time.Second)
+		defer cancel()
+	}
+
+	res, err := runQuery(ctx, part, query, nil, eql.RunOptions{Sorted: true,
+		MaxNodes: QueryMaxNodes, MaxRows: QueryMaxRows})
+
+	if err != nil {
+		writeQueryError(w, r, err)
+		return
+	}
+
+	keys, kinds, err := queryStartNodes(res)
+	if err != nil {
+		api.WriteError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ret := &queryDeleteResult{len(keys), 0, dryRun}
+
+	if !dryRun {
+
+		if confirm != -1 && confirm != len(keys) {
+			api.WriteError(w, r, fmt.Sprintf("Query matches %v nodes but %v nodes were confirmed",
+				len(keys), confirm), http.StatusConflict)
+			return
+
+		} else if confirm == -1 && QueryDeleteMaxNodes > 0 && len(keys) > QueryDeleteMaxNodes {
+			api.WriteError(w, r, fmt.Sprintf("Query matches %v nodes which is more than the maximum of %v "+
+				"- the number of nodes must be confirmed with the confirm parameter",
+				len(keys), QueryDeleteMaxNodes), http.StatusBadRequest)
+			return
+		}
+
+		for i := 0; i < len(keys); i += QueryDeleteBatchSize {
+			trans := graph.NewGraphTrans(api.GM)
+
+			end := i + QueryDeleteBatchSize
+			if end > len(keys) {
+				end = len(keys)
+			}
+
+			for j := i; j < end; j++ {
+				if err = trans.RemoveNode(part, keys[j], kinds[j]); err != nil {
+					break
+				}
+			}
+
+			if err == nil {
+				err = trans.Commit()
+			}
+
+			if err != nil {
+				api.WriteError(w, r, fmt.Sprintf("%v (%v nodes were deleted)", err, ret.Deleted), graphErrorStatus(err))
+				return
+			}
+
+			ret.Deleted = end
+		}
+	}
+
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+
+	json.NewEncoder(w).Encode(ret)
+}
+
+/*
+queryStartNodes collects the keys and kinds of all start nodes of a query
+result. The result must show at least one attribute of its start nodes.
+*/
+func queryStartNodes(res eql.SearchResult) ([]string, []string, error) {
+	col := -1
+
+	for i, d := range res.Header().Data() {
+		if strings.HasPrefix(d, "1:n:") {
+			col = i
+			break
+		}
+	}
+
+	if col == -1 {
+		return nil, nil, fmt.Errorf("Query result must show an attribute of its start nodes")
+	}
+
+	var keys, kinds []string
+
+	seen := make(map[string]bool)
+
+	for _, src := range res.RowSources() {
+		s := strings.SplitN(src[col], ":", 3)
+
+		if len(s) != 3 || seen[src[col]] {
+			continue
+		}
+
+		seen[src[col]] = true
+		kinds = append(kinds, s[1])
+		keys = append(keys, s[2])
+	}
+
+	return keys, kinds, nil
+}
+
+/*
+swaggerDeleteDefs describes the delete operation of the query endpoint in
+swagger.
+*/
+func (eq *queryEndpoint) swaggerDeleteDefs(path map[string]interface{}) {
+
+	path["delete"] = map[string]interface{}{
+		"summary": "Delete all start nodes of an EQL query result.",
+		"description": "Runs an EQL query and deletes all start nodes of its result in batches. " +
+			"Edges of deleted nodes are removed and cascading deletions are applied. The number " +
+			"of deleted nodes is limited unless the request confirms the number of nodes.",
+		"produces": []string{
+			"text/plain",
+			"application/json",
+		},
+		"parameters": []map[string]interface{}{
+			{
+				"name":        "partition",
+				"in":          "path",
+				"description": "Partition to delete from.",
+				"required":    true,
+				"type":        "string",
+			},
+			{
+				"name":        "q",
+				"in":          "query",
+				"description": "Query which selects the nodes - the result must show an attribute of its start nodes.",
+				"required":    true,
+				"type":        "string",
+			},
+			{
+				"name":        "dryRun",
+				"in":          "query",
+				"description": "Flag if only the number of matched nodes should be returned.",
+				"required":    false,
+				"type":        "boolean",
+			},
+			{
+				"name": "confirm",
+				"in":   "query",
+				"description": "Number of nodes which should be deleted - must match the number of start " +
+					"nodes in the query result. Required if more than " + fmt.Sprint(QueryDeleteMaxNodes) +
+					" nodes should be deleted.",
+				"required": false,
+				"type":     "integer",
+			},
+		},
+		"responses": map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "The number of matched and deleted nodes.",
+				"schema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"matched": map[string]interface{}{
+							"type": "integer",
+						},
+						"deleted": map[string]interface{}{
+							"type": "integer",
+						},
+						"dry_run": map[string]interface{}{
+							"type": "boolean",
+						},
+					},
+				},
+			},
+			"409": map[string]interface{}{
+				"description": "The confirmed number of nodes does not match the query result.",
+			},
+			"default": map[string]interface{}{
+				"description": "Error response",
+				"schema": map[string]interface{}{
+					"$ref": "#/definitions/Error",
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,134 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"testing"
+
+	"devt.de/eliasdb/api"
+)
+
+func TestQueryDelete(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointQuery
+
+	st, _, res := sendTestRequest("http://localhost"+TESTPORT+EndpointBatch+"deletetest", "POST", []byte(`[
+  {"op":"storeNode","key":"d1","kind":"Doc","tag":"old"},
+  {"op":"storeNode","key":"d2","kind":"Doc","tag":"old"},
+  {"op":"storeNode","key":"d3","kind":"Doc","tag":"old"},
+  {"op":"storeNode","key":"d4","kind":"Doc","tag":"new"},
+  {"op":"storeNode","key":"p1","kind":"Page"},
+  {"op":"storeNode","key":"p2","kind":"Page"},
+  {"op":"storeEdge","key":"d1p1","kind":"Has","end1key":"d1","end1kind":"Doc","end1role":"doc","end1cascading":true,
+   "end2key":"p1","end2kind":"Page","end2role":"page","end2cascading":false},
+  {"op":"storeEdge","key":"d2p2","kind":"Has","end1key":"d2","end1kind":"Doc","end1role":"doc","end1cascading":false,
+   "end2key":"p2","end2kind":"Page","end2role":"page","end2cascading":false}
+]`))
+	if st != "200 OK" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// A dry run only counts the nodes
+
+	st, _, res = sendTestRequest(queryURL+"deletetest?q=get+Doc+where+tag+%3D+old&dryRun=true", "DELETE", nil)
+	if st != "200 OK" || res != `{
+  "matched": 3,
+  "deleted": 0,
+  "dry_run": true
+}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Large deletions must be confirmed
+
+	oldMaxNodes := QueryDeleteMaxNodes
+	oldBatchSize := QueryDeleteBatchSize
+	QueryDeleteMaxNodes = 2
+	QueryDeleteBatchSize = 2
+	defer func() {
+		QueryDeleteMaxNodes = oldMaxNodes
+		QueryDeleteBatchSize = oldBatchSize
+	}()
+
+	st, _, res = sendTestRequest(queryURL+"deletetest?q=get+Doc+where+tag+%3D+old", "DELETE", nil)
+	if st != "400 Bad Request" || res != "Query matches 3 nodes which is more than the maximum of 2 "+
+		"- the number of nodes must be confirmed with the confirm parameter" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"deletetest?q=get+Doc+where+tag+%3D+old&confirm=4", "DELETE", nil)
+	if st != "409 Conflict" || res != "Query matches 3 nodes but 4 nodes were confirmed" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"deletetest?q=get+Doc+where+tag+%3D+old&confirm=3", "DELETE", nil)
+	if st != "200 OK" || res != `{
+  "matched": 3,
+  "deleted": 3,
+  "dry_run": false
+}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	for _, key := range []string{"d1", "d2", "d3", "d4"} {
+		if n, err := api.GM.FetchNode("deletetest", key, "Doc"); err != nil || (n == nil) != (key != "d4") {
+			t.Error("Unexpected result:", key, n, err)
+			return
+		}
+	}
+
+	// Cascading deletions are applied and edges of deleted nodes are removed
+
+	if n, err := api.GM.FetchNode("deletetest", "p1", "Page"); err != nil || n != nil {
+		t.Error("Unexpected result:", n, err)
+		return
+	}
+
+	if n, err := api.GM.FetchNode("deletetest", "p2", "Page"); err != nil || n == nil {
+		t.Error("Unexpected result:", n, err)
+		return
+	}
+
+	if e, err := api.GM.FetchEdge("deletetest", "d2p2", "Has"); err != nil || e != nil {
+		t.Error("Unexpected result:", e, err)
+		return
+	}
+
+	// Test error cases
+
+	st, _, res = sendTestRequest(queryURL+"deletetest", "DELETE", nil)
+	if st != "400 Bad Request" || res != "Missing query (q parameter)" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"deletetest?q=delete+from+Doc+where+true", "DELETE", nil)
+	if st != "400 Bad Request" || res != "Delete and update statements are not supported by the query endpoint" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"deletetest?q=get+Doc&dryRun=x", "DELETE", nil)
+	if st != "400 Bad Request" || res != "Invalid parameter value: dryRun should be a boolean" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"deletetest?q=get+Page+traverse+:::+end+show+2:n:key", "DELETE", nil)
+	if st != "400 Bad Request" || res != "Query result must show an attribute of its start nodes" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+}
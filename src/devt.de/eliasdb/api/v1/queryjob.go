@@ -0,0 +1,1017 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"devt.de/eliasdb/api"
+	"devt.de/eliasdb/eql"
+)
+
+/*
+EndpointQueryJob is the query job endpoint URL (rooted). Handles everything
+under queryjob/...
+*/
+const EndpointQueryJob = api.APIRoot + APIv1 + "/queryjob/"
+
+/*
+QueryJobWorkers is the number of query jobs which are run concurrently.
+*/
+var QueryJobWorkers = 4
+
+/*
+QueryJobMaxQueued is the maximum number of query jobs which wait for a free
+worker. New jobs are rejected if the queue is full (0 means jobs are only
+accepted if a worker is idle).
+*/
+var QueryJobMaxQueued = 100
+
+/*
+QueryJobTTL is the time in seconds a finished query job and its result are
+kept (0 means no expiry).
+*/
+var QueryJobTTL int64 = 3600
+
+/*
+QueryJobSpillRows is the number of result rows a query job keeps in memory.
+Larger results are written to a temporary file (0 means results are always
+kept in memory).
+*/
+var QueryJobSpillRows = 10000
+
+/*
+QueryJobTempDir is the directory for temporary result files of query jobs
+(empty means the default directory for temporary files).
+*/
+var QueryJobTempDir = ""
+
+/*
+QueryJobPageSize is the number of result rows which are returned for a
+finished query job if no limit parameter was given.
+*/
+var QueryJobPageSize = 100
+
+/*
+States of a query job
+*/
+const (
+	queryJobQueued  = "queued"
+	queryJobRunning = "running"
+	queryJobDone    = "done"
+	queryJobFailed  = "failed"
+)
+
+/*
+queryJobIndexInterval is the number of rows between two indexed positions of
+a result file.
+*/
+const queryJobIndexInterval = 1000
+
+/*
+queryJobs holds all known query jobs.
+*/
+var queryJobs = make(map[string]*queryJob)
+
+/*
+queryJobQueue is the queue of the workers which run query jobs (nil if no
+worker has been started yet).
+*/
+var queryJobQueue chan *queryJob
+
+/*
+queryJobsLock is the lock for the query job registry and queue.
+*/
+var queryJobsLock = &sync.Mutex{}
+
+/*
+queryJob is a query which is run in the background. Its result is kept until
+the job expires.
+*/
+type queryJob struct {
+	id        string             // ID of the job
+	part      string             // Queried partition
+	query     string             // Query which is run
+	principal string             // Client which submitted the job
+	opts      eql.RunOptions     // Options of the query run
+	ctx       context.Context    // Context of the query run
+	cancel    context.CancelFunc // Function to cancel the query run
+	cancelled bool               // Flag if the job was cancelled by the client
+	status    string             // Status of the job
+	err       string             // Error of a failed job
+	created   time.Time          // Time when the job was submitted
+	started   time.Time          // Time when the job was started
+	finished  time.Time          // Time when the job was finished
+	result    *queryJobResult    // Rows of the result
+	res       eql.SearchResult   // Result without rows (available once done)
+	expiry    *time.Timer        // Timer which removes the job once it expires
+	lock      *sync.Mutex        // Lock for the job state
+}
+
+/*
+CloseQueryJobs cancels all query jobs and removes their results (e.g. when
+the server shuts down).
+*/
+func CloseQueryJobs() {
+	queryJobsLock.Lock()
+	jobs := queryJobs
+	queryJobs = make(map[string]*queryJob)
+	queryJobsLock.Unlock()
+
+	for _, job := range jobs {
+		job.close()
+	}
+}
+
+/*
+submitQueryJob submits a new query job. Returns false if no more jobs can be
+queued.
+*/
+func submitQueryJob(job *queryJob) bool {
+	queryJobsLock.Lock()
+	defer queryJobsLock.Unlock()
+
+	// Start the workers with the first job
+
+	if queryJobQueue == nil {
+		queryJobQueue = make(chan *queryJob, QueryJobMaxQueued)
+
+		for i := 0; i < QueryJobWorkers; i++ {
+			go runQueryJobs(queryJobQueue)
+		}
+	}
+
+	select {
+	case queryJobQueue <- job:
+		queryJobs[job.id] = job
+		return true
+	default:
+		return false
+	}
+}
+
+/*
+runQueryJobs runs the query jobs of a queue one after the other.
+*/
+func runQueryJobs(queue chan *queryJob) {
+	for job := range queue {
+		job.run()
+	}
+}
+
+/*
+getQueryJob returns a known query job.
+*/
+func getQueryJob(id string) (*queryJob, bool) {
+	queryJobsLock.Lock()
+	defer queryJobsLock.Unlock()
+
+	job, ok := queryJobs[id]
+
+	return job, ok
+}
+
+/*
+removeQueryJob removes a query job and its result.
+*/
+func removeQueryJob(id string) {
+	queryJobsLock.Lock()
+	job, ok := queryJobs[id]
+	delete(queryJobs, id)
+	queryJobsLock.Unlock()
+
+	if ok {
+		job.close()
+	}
+}
+
+/*
+newQueryJob creates a new query job.
+*/
+func newQueryJob(part string, query string, principal string, opts eql.RunOptions) *queryJob {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &queryJob{genID(), part, query, principal, opts, ctx, cancel, false,
+		queryJobQueued, "", time.Now(), time.Time{}, time.Time{}, &queryJobResult{},
+		nil, nil, &sync.Mutex{}}
+}
+
+/*
+run runs the query of the job and stores its result. Cancelled jobs are not
+run.
+*/
+func (job *queryJob) run() {
+
+	job.lock.Lock()
+
+	if job.status != queryJobQueued {
+		job.lock.Unlock()
+		return
+	}
+
+	job.status = queryJobRunning
+	job.started = time.Now()
+
+	job.lock.Unlock()
+
+	res, err := runQuery(job.ctx, job.part, job.query, job, job.opts)
+
+	job.lock.Lock()
+	defer job.lock.Unlock()
+
+	if err == nil {
+		err = job.result.finish()
+	}
+
+	job.cancel()
+
+	job.finished = time.Now()
+
+	if job.cancelled {
+		job.status = queryJobFailed
+		job.err = "Query job was cancelled"
+		job.result.close()
+
+	} else if err != nil {
+		job.status = queryJobFailed
+		job.err = err.Error()
+		job.result.close()
+
+	} else {
+		job.status = queryJobDone
+		job.res = res
+	}
+
+	job.expire()
+}
+
+/*
+Start is called once before any row of the result is produced.
+*/
+func (job *queryJob) Start(header eql.SearchResultHeader, incremental bool) error {
+	return nil
+}
+
+/*
+Row stores a single row of the result.
+*/
+func (job *queryJob) Row(row []interface{}, source []string) error {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+
+	return job.result.add(row, source)
+}
+
+/*
+cancelRun cancels a queued or running job. The job is kept with the status
+failed until it expires. Returns false if the job was already finished.
+*/
+func (job *queryJob) cancelRun() bool {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+
+	if job.status == queryJobRunning {
+
+		// The running query stops and the worker finishes the job
+
+		job.cancelled = true
+		job.cancel()
+
+		return true
+
+	} else if job.status == queryJobQueued {
+
+		// The worker skips the job once it is taken from the queue
+
+		job.cancelled = true
+		job.cancel()
+
+		job.status = queryJobFailed
+		job.err = "Query job was cancelled"
+		job.finished = time.Now()
+		job.expire()
+
+		return true
+	}
+
+	return false
+}
+
+/*
+expire removes the job once its time to live has passed.
+*/
+func (job *queryJob) expire() {
+	if QueryJobTTL > 0 {
+		id := job.id
+
+		job.expiry = time.AfterFunc(time.Duration(QueryJobTTL)*time.Second, func() {
+			removeQueryJob(id)
+		})
+	}
+}
+
+/*
+close cancels the job and removes its result.
+*/
+func (job *queryJob) close() {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+
+	if job.expiry != nil {
+		job.expiry.Stop()
+	}
+
+	if job.status == queryJobQueued || job.status == queryJobRunning {
+		job.cancelled = true
+		job.cancel()
+	}
+
+	job.result.close()
+}
+
+/*
+statusData returns the status of the job and, once it is done, a page of its
+result.
+*/
+func (job *queryJob) statusData(offset int, limit int) (map[string]interface{}, error) {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+
+	data := map[string]interface{}{
+		"id":        job.id,
+		"partition": job.part,
+		"query":     job.query,
+		"status":    job.status,
+		"created":   job.created.UTC().Format(time.RFC3339),
+		"progress": map[string]interface{}{
+			"rows": job.result.count,
+		},
+	}
+
+	elapsed := time.Duration(0)
+
+	if !job.started.IsZero() {
+		data["started"] = job.started.UTC().Format(time.RFC3339)
+
+		if job.finished.IsZero() {
+			elapsed = time.Since(job.started)
+		} else {
+			elapsed = job.finished.Sub(job.started)
+		}
+	}
+
+	data["progress"].(map[string]interface{})["elapsed_ms"] = int64(elapsed / time.Millisecond)
+
+	if !job.finished.IsZero() {
+		data["finished"] = job.finished.UTC().Format(time.RFC3339)
+
+		if QueryJobTTL > 0 {
+			data["expires"] = job.finished.Add(time.Duration(QueryJobTTL) *
+				time.Second).UTC().Format(time.RFC3339)
+		}
+	}
+
+	if job.err != "" {
+		data["error"] = job.err
+	}
+
+	if job.status != queryJobDone {
+		return data, nil
+	}
+
+	// Add the requested page of the result
+
+	if offset == -1 {
+		offset = 0
+	}
+
+	if limit == -1 {
+		limit = QueryJobPageSize
+	}
+
+	rows, srcs, err := job.result.page(offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	header := job.res.Header()
+
+	resData := map[string]interface{}{
+		"rows":        rows,
+		"sources":     srcs,
+		"offset":      offset,
+		"total_count": job.result.count,
+		"has_more":    offset+len(rows) < job.result.count || job.res.HasMore(),
+		"header": map[string]interface{}{
+			"labels":       header.Labels(),
+			"format":       header.Format(),
+			"data":         header.Data(),
+			"primary_kind": header.PrimaryKind(),
+			"ordering":     job.res.Ordering(),
+		},
+		"stats": job.res.Stats(),
+	}
+
+	// The next page starts after the returned rows
+
+	if offset+len(rows) < job.result.count {
+		resData["next_offset"] = offset + len(rows)
+	}
+
+	if cursor := job.res.Cursor(); cursor != "" {
+		resData["cursor"] = cursor
+	}
+
+	data["result"] = resData
+
+	return data, nil
+}
+
+/*
+queryJobRow is a result row of a query job in a result file.
+*/
+type queryJobRow struct {
+	Row    []interface{} `json:"r"`
+	Source []string      `json:"s"`
+}
+
+/*
+queryJobResult holds the rows of a query job result. Rows are kept in memory
+until the result grows beyond QueryJobSpillRows - all rows are then written
+to a temporary file.
+*/
+type queryJobResult struct {
+	rows  [][]interface{} // Rows which are kept in memory
+	srcs  [][]string      // Sources of the rows which are kept in memory
+	count int             // Number of rows
+	file  *os.File        // Result file (nil if the rows are kept in memory)
+	out   *bufio.Writer   // Buffered writer of the result file
+	size  int64           // Number of bytes written to the result file
+	index []int64         // File positions of every queryJobIndexInterval-th row
+}
+
+/*
+add adds a row to the result.
+*/
+func (jr *queryJobResult) add(row []interface{}, source []string) error {
+
+	if jr.file == nil && QueryJobSpillRows > 0 && jr.count >= QueryJobSpillRows {
+		if err := jr.spill(); err != nil {
+			return err
+		}
+	}
+
+	if jr.file == nil {
+		jr.rows = append(jr.rows, row)
+		jr.srcs = append(jr.srcs, source)
+		jr.count++
+
+		return nil
+	}
+
+	if err := jr.write(row, source); err != nil {
+		return err
+	}
+
+	jr.count++
+
+	return nil
+}
+
+/*
+spill moves all rows which are kept in memory to a temporary file.
+*/
+func (jr *queryJobResult) spill() error {
+	file, err := ioutil.TempFile(QueryJobTempDir, "eliasdb-queryjob-")
+	if err != nil {
+		return fmt.Errorf("Could not create result file: %v", err)
+	}
+
+	jr.file = file
+	jr.out = bufio.NewWriter(file)
+
+	for i, row := range jr.rows {
+		jr.count = i
+
+		if err = jr.write(row, jr.srcs[i]); err != nil {
+			return err
+		}
+	}
+
+	jr.count = len(jr.rows)
+	jr.rows = nil
+	jr.srcs = nil
+
+	return nil
+}
+
+/*
+write writes a row at the end of the result file. The position of the row is
+indexed if necessary (the count of the result is the number of the row).
+*/
+func (jr *queryJobResult) write(row []interface{}, source []string) error {
+	line, err := json.Marshal(&queryJobRow{row, source})
+
+	if err == nil {
+		if jr.count%queryJobIndexInterval == 0 {
+			jr.index = append(jr.index, jr.size)
+		}
+
+		line = append(line, '\n')
+
+		_, err = jr.out.Write(line)
+		jr.size += int64(len(line))
+	}
+
+	if err != nil {
+		return fmt.Errorf("Could not write result file: %v", err)
+	}
+
+	return nil
+}
+
+/*
+finish is called once all rows have been added.
+*/
+func (jr *queryJobResult) finish() error {
+	if jr.out != nil {
+		if err := jr.out.Flush(); err != nil {
+			return fmt.Errorf("Could not write result file: %v", err)
+		}
+	}
+
+	return nil
+}
+
+/*
+page returns a page of rows of the result.
+*/
+func (jr *queryJobResult) page(offset int, limit int) ([][]interface{}, [][]string, error) {
+
+	if offset > jr.count {
+		offset = jr.count
+	}
+
+	if offset+limit > jr.count {
+		limit = jr.count - offset
+	}
+
+	if jr.file == nil {
+		return jr.rows[offset : offset+limit], jr.srcs[offset : offset+limit], nil
+	}
+
+	rows := make([][]interface{}, 0, limit)
+	srcs := make([][]string, 0, limit)
+
+	if limit == 0 {
+		return rows, srcs, nil
+	}
+
+	// Start reading at the closest indexed row before the offset
+
+	pos := offset / queryJobIndexInterval
+	start := jr.index[pos]
+
+	in := bufio.NewReader(io.NewSectionReader(jr.file, start, jr.size-start))
+
+	for i := pos * queryJobIndexInterval; i < offset; i++ {
+		if _, err := in.ReadBytes('\n'); err != nil {
+			return nil, nil, fmt.Errorf("Could not read result file: %v", err)
+		}
+	}
+
+	dec := json.NewDecoder(in)
+	dec.UseNumber()
+
+	for len(rows) < limit {
+		var jrow queryJobRow
+
+		if err := dec.Decode(&jrow); err != nil {
+			return nil, nil, fmt.Errorf("Could not read result file: %v", err)
+		}
+
+		rows = append(rows, jrow.Row)
+		srcs = append(srcs, jrow.Source)
+	}
+
+	return rows, srcs, nil
+}
+
+/*
+close removes all rows of the result.
+*/
+func (jr *queryJobResult) close() {
+	if jr.file != nil {
+		jr.file.Close()
+		os.Remove(jr.file.Name())
+	}
+
+	jr.rows = nil
+	jr.srcs = nil
+	jr.count = 0
+	jr.file = nil
+	jr.out = nil
+	jr.size = 0
+	jr.index = nil
+}
+
+/*
+HandlePOST submits a query job which runs the query in the background. The
+query is given as q parameter or as request body. The response points to the
+job which reports the status and result of the query (see queryJobEndpoint).
+*/
+func (eq *queryEndpoint) HandlePOST(w http.ResponseWriter, r *http.Request, resources []string) {
+
+	if !checkResources(w, r, resources, 1, 1, "Need a partition") {
+		return
+	}
+
+	part := resources[0]
+
+	// Submitting a query only requires read access to the partition
+
+	if !api.Authorize(w, r, part, "") {
+		return
+	}
+
+	// Get async parameter; only asynchronous queries can be submitted
+
+	async, ok := queryParamBool(w, r, "async")
+	if !ok {
+		return
+	} else if !async {
+		api.WriteError(w, r, "POST requests need the async parameter", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+
+	if query == "" {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			api.WriteBodyError(w, r, "Could not read query", err)
+			return
+		}
+
+		query = strings.TrimSpace(string(body))
+	}
+
+	if query == "" {
+		api.WriteError(w, r, "Missing query (q parameter or request body)", http.StatusBadRequest)
+		return
+	} else if eql.IsMutation(query) {
+		api.WriteError(w, r, "Delete and update statements are not supported by the query endpoint", http.StatusBadRequest)
+		return
+	}
+
+	// Get sorted parameter; false if not set
+
+	sorted, ok := queryParamBool(w, r, "sorted")
+	if !ok {
+		return
+	}
+
+	// Get sample parameter; -1 if not set
+
+	sample, ok := queryParamPosNum(w, r, "sample")
+	if !ok {
+		return
+	} else if sample == 0 {
+		api.WriteError(w, r, "Invalid parameter value: sample should be greater than 0", http.StatusBadRequest)
+		return
+	}
+
+	principal := ""
+	if p := api.PrincipalFromContext(r.Context()); p != nil {
+		principal = p.Name
+	}
+
+	job := newQueryJob(part, query, principal, eql.RunOptions{Sorted: sorted, Sample: sample,
+		MaxNodes: QueryMaxNodes, MaxRows: QueryMaxRows})
+
+	if !submitQueryJob(job) {
+		job.cancel()
+		api.WriteError(w, r, "Too many query jobs - try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	data, _ := job.statusData(-1, 0)
+
+	w.Header().Set("Location", EndpointQueryJob+job.id)
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+swaggerPostDefs describes the asynchronous query operation of the query
+endpoint in swagger.
+*/
+func (eq *queryEndpoint) swaggerPostDefs(path map[string]interface{}) {
+
+	path["post"] = map[string]interface{}{
+		"summary": "Submit an EQL query which runs in the background.",
+		"description": "Submits a query job and returns its ID immediately. The status and " +
+			"result of the job can be requested from the queryjob endpoint.",
+		"consumes": []string{
+			"text/plain",
+		},
+		"produces": []string{
+			"text/plain",
+			"application/json",
+		},
+		"parameters": []map[string]interface{}{
+			{
+				"name":        "partition",
+				"in":          "path",
+				"description": "Partition to query.",
+				"required":    true,
+				"type":        "string",
+			},
+			{
+				"name":        "async",
+				"in":          "query",
+				"description": "Must be true - queries are always run in the background.",
+				"required":    true,
+				"type":        "boolean",
+			},
+			{
+				"name":        "q",
+				"in":          "query",
+				"description": "URL encoded query to execute (the request body is used if not given).",
+				"required":    false,
+				"type":        "string",
+			},
+			{
+				"name":        "sorted",
+				"in":          "query",
+				"description": "Flag if start nodes should be visited in key order.",
+				"required":    false,
+				"type":        "boolean",
+			},
+			{
+				"name":        "sample",
+				"in":          "query",
+				"description": "Number of start nodes to sample.",
+				"required":    false,
+				"type":        "integer",
+			},
+		},
+		"responses": map[string]interface{}{
+			"202": map[string]interface{}{
+				"description": "The query job was submitted - the Location header points to the job.",
+			},
+			"503": map[string]interface{}{
+				"description": "Too many query jobs are queued.",
+			},
+			"default": map[string]interface{}{
+				"description": "Error response",
+				"schema": map[string]interface{}{
+					"$ref": "#/definitions/Error",
+				},
+			},
+		},
+	}
+}
+
+/*
+QueryJobEndpointInst creates a new endpoint handler.
+*/
+func QueryJobEndpointInst() api.RestEndpointHandler {
+	return &queryJobEndpoint{}
+}
+
+/*
+Handler object for query jobs.
+*/
+type queryJobEndpoint struct {
+	*api.DefaultEndpointHandler
+}
+
+/*
+HandleGET handles a query job status REST call.
+*/
+func (qj *queryJobEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
+
+	job, ok := qj.job(w, r, resources)
+	if !ok {
+		return
+	}
+
+	// Get limit parameter; -1 if not set
+
+	limit, ok := queryParamPosNum(w, r, "limit")
+	if !ok {
+		return
+	}
+
+	// Get offset parameter; -1 if not set
+
+	offset, ok := queryParamPosNum(w, r, "offset")
+	if !ok {
+		return
+	}
+
+	data, err := job.statusData(offset, limit)
+	if err != nil {
+		api.WriteError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if res, ok := data["result"]; ok {
+		w.Header().Add(HTTPHeaderTotalCount, fmt.Sprint(res.(map[string]interface{})["total_count"]))
+		w.Header().Add(HTTPHeaderHasMore, fmt.Sprint(res.(map[string]interface{})["has_more"]))
+	}
+
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+HandleDELETE handles a query job cancellation REST call. Queued or running
+jobs are cancelled, finished jobs are removed with their result.
+*/
+func (qj *queryJobEndpoint) HandleDELETE(w http.ResponseWriter, r *http.Request, resources []string) {
+
+	job, ok := qj.job(w, r, resources)
+	if !ok {
+		return
+	}
+
+	cancelled := job.cancelRun()
+
+	data, err := job.statusData(-1, 0)
+	if err != nil {
+		api.WriteError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	delete(data, "result")
+
+	if !cancelled {
+		removeQueryJob(job.id)
+	}
+
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+job returns the query job of a request. Jobs can only be accessed by the
+client which submitted them.
+*/
+func (qj *queryJobEndpoint) job(w http.ResponseWriter, r *http.Request, resources []string) (*queryJob, bool) {
+
+	if !checkResources(w, r, resources, 1, 1, "Need a job id") {
+		return nil, false
+	}
+
+	principal := ""
+	if p := api.PrincipalFromContext(r.Context()); p != nil {
+		principal = p.Name
+	}
+
+	job, ok := getQueryJob(resources[0])
+	if !ok || job.principal != principal {
+		api.WriteError(w, r, "Unknown query job: "+resources[0], http.StatusNotFound)
+		return nil, false
+	}
+
+	if !api.Authorize(w, r, job.part, "") {
+		return nil, false
+	}
+
+	return job, true
+}
+
+/*
+Describe describes the endpoint in the API description.
+*/
+func (qj *queryJobEndpoint) Describe() []*api.EndpointDescription {
+	return []*api.EndpointDescription{
+		{
+			Path:    EndpointQueryJob + "{id}",
+			Methods: []string{"GET"},
+			Summary: "Return the status and result of a query job.",
+			Description: "The status is one of queued, running, done or failed. The result of a " +
+				"finished job is returned page by page.",
+			Parameters: []*api.ParameterDescription{
+				{Name: "id", In: "path", Description: "ID of the query job.", Required: true},
+				{Name: "limit", In: "query", Description: "How many result rows to return.", Type: "integer"},
+				{Name: "offset", In: "query", Description: "Offset in the result rows.", Type: "integer"},
+			},
+			Responses: []*api.ResponseDescription{
+				{Status: 200, Description: "Status of the query job.", ContentType: "application/json",
+					Schema: map[string]interface{}{"type": "object"}},
+			},
+		},
+		{
+			Path:        EndpointQueryJob + "{id}",
+			Methods:     []string{"DELETE"},
+			Summary:     "Cancel a query job.",
+			Description: "Queued or running jobs are cancelled, finished jobs are removed with their result.",
+			Parameters: []*api.ParameterDescription{
+				{Name: "id", In: "path", Description: "ID of the query job.", Required: true},
+			},
+			Responses: []*api.ResponseDescription{
+				{Status: 200, Description: "Status of the query job.", ContentType: "application/json",
+					Schema: map[string]interface{}{"type": "object"}},
+			},
+		},
+	}
+}
+
+/*
+SwaggerDefs is used to describe the endpoint in swagger.
+*/
+func (qj *queryJobEndpoint) SwaggerDefs(s map[string]interface{}) {
+
+	idParam := map[string]interface{}{
+		"name":        "id",
+		"in":          "path",
+		"description": "ID of the query job.",
+		"required":    true,
+		"type":        "string",
+	}
+
+	responses := map[string]interface{}{
+		"200": map[string]interface{}{
+			"description": "Status of the query job.",
+		},
+		"default": map[string]interface{}{
+			"description": "Error response",
+			"schema": map[string]interface{}{
+				"$ref": "#/definitions/Error",
+			},
+		},
+	}
+
+	s["paths"].(map[string]interface{})["/v1/queryjob/{id}"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary":     "Return the status and result of a query job.",
+			"description": "The status is one of queued, running, done or failed. The result of a finished job is returned page by page.",
+			"produces": []string{
+				"text/plain",
+				"application/json",
+			},
+			"parameters": []map[string]interface{}{
+				idParam,
+				map[string]interface{}{
+					"name":        "limit",
+					"in":          "query",
+					"description": "How many result rows to return.",
+					"required":    false,
+					"type":        "integer",
+				},
+				map[string]interface{}{
+					"name":        "offset",
+					"in":          "query",
+					"description": "Offset in the result rows.",
+					"required":    false,
+					"type":        "integer",
+				},
+			},
+			"responses": responses,
+		},
+		"delete": map[string]interface{}{
+			"summary":     "Cancel a query job.",
+			"description": "Queued or running jobs are cancelled, finished jobs are removed with their result.",
+			"produces": []string{
+				"text/plain",
+				"application/json",
+			},
+			"parameters": []map[string]interface{}{
+				idParam,
+			},
+			"responses": responses,
+		},
+	}
+
+	// Add generic error object to definition
+
+	s["definitions"].(map[string]interface{})["Error"] = map[string]interface{}{
+		"description": "A human readable error mesage.",
+		"type":        "string",
+	}
+}
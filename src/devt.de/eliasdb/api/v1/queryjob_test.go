@@ -0,0 +1,319 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"devt.de/eliasdb/eql"
+)
+
+func TestQueryJob(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointQuery
+	jobURL := "http://localhost" + TESTPORT + EndpointQueryJob
+
+	oldSpillRows := QueryJobSpillRows
+	QueryJobSpillRows = 3
+	defer func() {
+		QueryJobSpillRows = oldSpillRows
+	}()
+
+	st, _, res := sendTestRequest(queryURL+"main?q=get+Song", "POST", nil)
+
+	if st != "400 Bad Request" || res != "POST requests need the async parameter" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?async=true", "POST", nil)
+
+	if st != "400 Bad Request" || res != "Missing query (q parameter or request body)" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(queryURL+"main?async=true&q=delete+Song", "POST", nil)
+
+	if st != "400 Bad Request" || res != "Delete and update statements are not supported by the query endpoint" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Submit a job with the query as request body
+
+	st, h, res := sendTestRequest(queryURL+"main?async=true&sorted=true", "POST", []byte("get Song"))
+
+	if st != "202 Accepted" || !strings.HasPrefix(h.Get("Location"), EndpointQueryJob) {
+		t.Error("Unexpected response:", st, h, res)
+		return
+	}
+
+	id := strings.TrimPrefix(h.Get("Location"), EndpointQueryJob)
+
+	var status map[string]interface{}
+
+	for i := 0; i < 100; i++ {
+		_, _, res = sendTestRequest(jobURL+id+"?limit=2&offset=1", "GET", nil)
+
+		status = nil
+		json.Unmarshal([]byte(res), &status)
+
+		if status["status"] != queryJobQueued && status["status"] != queryJobRunning {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if status["status"] != queryJobDone || status["id"] != id || status["query"] != "get Song" {
+		t.Error("Unexpected response:", res)
+		return
+	}
+
+	// The result spilled to a file
+
+	job, _ := getQueryJob(id)
+	filename := job.result.file.Name()
+
+	if _, err := os.Stat(filename); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Compare the page with the result of a normal query
+
+	_, _, res = sendTestRequest(queryURL+"main?q=get+Song&sorted=true", "GET", nil)
+
+	var expected map[string]interface{}
+	json.Unmarshal([]byte(res), &expected)
+
+	rows := expected["rows"].([]interface{})
+	result := status["result"].(map[string]interface{})
+
+	if fmt.Sprint(result["rows"]) != fmt.Sprint(rows[1:3]) ||
+		fmt.Sprint(result["total_count"]) != fmt.Sprint(len(rows)) ||
+		fmt.Sprint(result["next_offset"]) != "3" || result["has_more"] != true ||
+		fmt.Sprint(status["progress"].(map[string]interface{})["rows"]) != fmt.Sprint(len(rows)) {
+		t.Error("Unexpected result:", result, rows)
+		return
+	}
+
+	// Request the last page
+
+	_, _, res = sendTestRequest(jobURL+id+fmt.Sprintf("?offset=%v", len(rows)-1), "GET", nil)
+
+	status = nil
+	json.Unmarshal([]byte(res), &status)
+	result = status["result"].(map[string]interface{})
+
+	if fmt.Sprint(result["rows"]) != fmt.Sprint(rows[len(rows)-1:]) ||
+		result["next_offset"] != nil || result["has_more"] != false {
+		t.Error("Unexpected result:", result)
+		return
+	}
+
+	// Remove the finished job
+
+	st, _, res = sendTestRequest(jobURL+id, "DELETE", nil)
+
+	if st != "200 OK" || !strings.Contains(res, `"status": "done"`) {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Error("Result file was not removed:", err)
+		return
+	}
+
+	st, _, res = sendTestRequest(jobURL+id, "GET", nil)
+
+	if st != "404 Not Found" || res != "Unknown query job: "+id {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(jobURL, "GET", nil)
+
+	if st != "400 Bad Request" || res != "Need a job id" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Failed queries are reported with their error
+
+	_, h, _ = sendTestRequest(queryURL+"main?async=true&q=get+Song+whree+x", "POST", nil)
+
+	id = strings.TrimPrefix(h.Get("Location"), EndpointQueryJob)
+
+	for i := 0; i < 100; i++ {
+		_, _, res = sendTestRequest(jobURL+id, "GET", nil)
+
+		if strings.Contains(res, `"status": "failed"`) {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !strings.Contains(res, `"error": "Parse error in Main query`) || strings.Contains(res, `"result"`) {
+		t.Error("Unexpected response:", res)
+		return
+	}
+
+	removeQueryJob(id)
+}
+
+func TestQueryJobCancel(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointQuery
+	jobURL := "http://localhost" + TESTPORT + EndpointQueryJob
+
+	// Make sure the workers have been started
+
+	if !submitQueryJob(newQueryJob("main", "get Song", "", eql.RunOptions{})) {
+		t.Error("Could not submit job")
+		return
+	}
+
+	// Jobs are rejected if no worker is free and the queue is full
+
+	queryJobsLock.Lock()
+	oldQueue := queryJobQueue
+	queryJobQueue = make(chan *queryJob)
+	queryJobsLock.Unlock()
+
+	st, _, res := sendTestRequest(queryURL+"main?async=true&q=get+Song", "POST", nil)
+
+	if st != "503 Service Unavailable" || res != "Too many query jobs - try again later" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Queued jobs are cancelled before they run
+
+	queryJobsLock.Lock()
+	queryJobQueue = make(chan *queryJob, 1)
+	queryJobsLock.Unlock()
+
+	_, h, _ := sendTestRequest(queryURL+"main?async=true&q=get+Song", "POST", nil)
+
+	id := strings.TrimPrefix(h.Get("Location"), EndpointQueryJob)
+
+	st, _, res = sendTestRequest(jobURL+id, "DELETE", nil)
+
+	if st != "200 OK" || !strings.Contains(res, `"status": "failed"`) ||
+		!strings.Contains(res, `"error": "Query job was cancelled"`) {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	job, _ := getQueryJob(id)
+	job.run()
+
+	if job.status != queryJobFailed || !job.started.IsZero() {
+		t.Error("Cancelled job was run:", job.status)
+		return
+	}
+
+	queryJobsLock.Lock()
+	queryJobQueue = oldQueue
+	queryJobsLock.Unlock()
+
+	// Running jobs are cancelled through their context
+
+	job = newQueryJob("main", "get Song", "", eql.RunOptions{})
+	job.status = queryJobRunning
+
+	if !job.cancelRun() || job.ctx.Err() == nil {
+		t.Error("Running job was not cancelled")
+		return
+	}
+
+	// Closing all jobs removes them
+
+	CloseQueryJobs()
+
+	if st, _, _ = sendTestRequest(jobURL+id, "GET", nil); st != "404 Not Found" {
+		t.Error("Unexpected response:", st)
+		return
+	}
+}
+
+func TestQueryJobResult(t *testing.T) {
+
+	oldSpillRows := QueryJobSpillRows
+	QueryJobSpillRows = 10
+	defer func() {
+		QueryJobSpillRows = oldSpillRows
+	}()
+
+	jr := &queryJobResult{}
+
+	for i := 0; i < 2500; i++ {
+		if err := jr.add([]interface{}{i, fmt.Sprint("row", i)}, []string{"n:test:" + fmt.Sprint(i)}); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	if err := jr.finish(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if jr.file == nil || jr.rows != nil || len(jr.index) != 3 {
+		t.Error("Unexpected result:", jr.file, len(jr.index))
+		return
+	}
+
+	rows, srcs, err := jr.page(1998, 3)
+
+	if err != nil || fmt.Sprint(rows) != "[[1998 row1998] [1999 row1999] [2000 row2000]]" ||
+		fmt.Sprint(srcs) != "[[n:test:1998] [n:test:1999] [n:test:2000]]" {
+		t.Error("Unexpected result:", rows, srcs, err)
+		return
+	}
+
+	rows, _, err = jr.page(5, 2)
+
+	if err != nil || fmt.Sprint(rows) != "[[5 row5] [6 row6]]" {
+		t.Error("Unexpected result:", rows, err)
+		return
+	}
+
+	rows, _, err = jr.page(2499, 10)
+
+	if err != nil || fmt.Sprint(rows) != "[[2499 row2499]]" {
+		t.Error("Unexpected result:", rows, err)
+		return
+	}
+
+	rows, _, err = jr.page(3000, 10)
+
+	if err != nil || len(rows) != 0 {
+		t.Error("Unexpected result:", rows, err)
+		return
+	}
+
+	filename := jr.file.Name()
+
+	jr.close()
+
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Error("Result file was not removed:", err)
+		return
+	}
+}
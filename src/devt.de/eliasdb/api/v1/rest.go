@@ -11,11 +11,15 @@
 package v1
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"devt.de/eliasdb/api"
+	"devt.de/eliasdb/eql"
+	"devt.de/eliasdb/graph/util"
 )
 
 /*
@@ -28,11 +32,35 @@ HTTPHeaderTotalCount is a special header value containing the total count of obj
 */
 const HTTPHeaderTotalCount = "X-Total-Count"
 
+/*
+HTTPHeaderHasMore is a special header value which is set if more objects exist beyond
+the returned ones.
+*/
+const HTTPHeaderHasMore = "X-Has-More"
+
 /*
 HTTPHeaderCacheID is a special header value containing a cache ID for a quick follow up query.
 */
 const HTTPHeaderCacheID = "X-Cache-Id"
 
+/*
+HTTPHeaderCursor is a special header value containing a cursor which continues after
+the returned objects.
+*/
+const HTTPHeaderCursor = "X-Cursor"
+
+/*
+HTTPHeaderCursorID is a special header value containing the id of a server-side
+cursor which returns the next page of a query result.
+*/
+const HTTPHeaderCursorID = "X-Cursor-Id"
+
+/*
+HTTPHeaderQueryError is a special trailer value containing the error of a query which
+failed after its first rows were written.
+*/
+const HTTPHeaderQueryError = "X-Query-Error"
+
 /*
 V1EndpointMap is a map of urls to endpoints for version 1 of the API
 */
@@ -41,6 +69,48 @@ var V1EndpointMap = map[string]api.RestEndpointInst{
 	EndpointQuery:      QueryEndpointInst,
 	EndpointGraph:      GraphEndpointInst,
 	EndpointInfoQuery:  InfoEndpointInst,
+	EndpointSubscribe:  SubscribeEndpointInst,
+	EndpointEvents:     EventsEndpointInst,
+	EndpointImport:     ImportEndpointInst,
+	EndpointExport:     ExportEndpointInst,
+	EndpointBatch:      BatchEndpointInst,
+	EndpointTraverse:   TraverseEndpointInst,
+	EndpointSpec:       SpecEndpointInst,
+	EndpointQueryJob:   QueryJobEndpointInst,
+	EndpointBackup:     BackupEndpointInst,
+	EndpointRestore:    RestoreEndpointInst,
+}
+
+func init() {
+
+	// Queries are rate limited separately from other reads
+
+	api.RateClassEndpoints[EndpointQuery] = api.RateClassQuery
+
+	// Features which are provided by endpoints are listed by /about
+
+	api.EndpointFeatures[EndpointSubscribe] = "websocket"
+	api.EndpointFeatures[EndpointEvents] = "events"
+	api.EndpointFeatures[EndpointImport] = "import"
+	api.EndpointFeatures[EndpointExport] = "export"
+	api.EndpointFeatures[EndpointBatch] = "batch"
+	api.EndpointFeatures[EndpointTraverse] = "traverse"
+	api.EndpointFeatures[EndpointQueryJob] = "queryjobs"
+	api.EndpointFeatures[EndpointBackup] = "backup"
+
+	// Submitting and cancelling query jobs only reads data
+
+	api.ReadRequests[EndpointQuery] = map[string]bool{"POST": true}
+	api.ReadRequests[EndpointQueryJob] = map[string]bool{"DELETE": true}
+
+	// Backups copy the whole datastore and need write access
+
+	api.WriteRequests[EndpointBackup] = map[string]bool{"GET": true}
+
+	// Imports and restores are streamed and can be larger than other request bodies
+
+	api.BodyLimitExempt[EndpointImport] = true
+	api.BodyLimitExempt[EndpointRestore] = true
 }
 
 // Helper functions
@@ -49,17 +119,112 @@ var V1EndpointMap = map[string]api.RestEndpointInst{
 /*
 checkResources check given resources for a GET request.
 */
-func checkResources(w http.ResponseWriter, resources []string, requiredMin int, requiredMax int, errorMsg string) bool {
+func checkResources(w http.ResponseWriter, r *http.Request, resources []string, requiredMin int, requiredMax int, errorMsg string) bool {
 	if len(resources) < requiredMin {
-		http.Error(w, errorMsg, http.StatusBadRequest)
+		api.WriteError(w, r, errorMsg, http.StatusBadRequest)
 		return false
 	} else if len(resources) > requiredMax {
-		http.Error(w, "Invalid resource specification: "+strings.Join(resources[1:], "/"), http.StatusBadRequest)
+		api.WriteError(w, r, "Invalid resource specification: "+strings.Join(resources[1:], "/"), http.StatusBadRequest)
 		return false
 	}
 	return true
 }
 
+/*
+graphErrorStatus returns the HTTP status code for a given graph or query
+error.
+*/
+func graphErrorStatus(err error) int {
+
+	if errors.Is(err, util.ErrNotFound) {
+		return http.StatusNotFound
+	} else if errors.Is(err, util.ErrTransConflict) || errors.Is(err, util.ErrConcurrentModification) {
+		return http.StatusConflict
+	} else if errors.Is(err, eql.ErrQueryTimeout) {
+		return http.StatusGatewayTimeout
+	} else if errors.Is(err, eql.ErrInvalidCursor) {
+		return http.StatusBadRequest
+	} else if errors.Is(err, eql.ErrQueryLimitExceeded) {
+		return http.StatusUnprocessableEntity
+	}
+
+	return http.StatusInternalServerError
+}
+
+/*
+writeQueryError writes the error of a query. Parse errors are written as a
+JSON object which contains the location of the error (offset in bytes, line
+and position in the line), the offending term, the terms which would have been
+valid instead and suggestions for misspelled keywords. If the request wants
+JSON errors then these are the details of the error response.
+*/
+func writeQueryError(w http.ResponseWriter, r *http.Request, err error) {
+	var pe *eql.ParseError
+
+	if !errors.As(err, &pe) {
+		api.WriteError(w, r, err.Error(), graphErrorStatus(err))
+		return
+	}
+
+	expected, suggestions := pe.Expected, pe.Suggestions
+
+	if expected == nil {
+		expected = []string{}
+	}
+
+	if suggestions == nil {
+		suggestions = []string{}
+	}
+
+	details := map[string]interface{}{
+		"type":        pe.Type.Error(),
+		"detail":      pe.Detail,
+		"offset":      pe.Offset,
+		"line":        pe.Line,
+		"pos":         pe.Pos,
+		"token":       pe.Token,
+		"expected":    expected,
+		"suggestions": suggestions,
+		"hint":        pe.Hint(),
+	}
+
+	// JSON error responses contain the location of the error as details
+
+	if api.WantsJSONErrors(r) {
+		api.WriteErrorDetails(w, r, pe.Error(), http.StatusBadRequest, details)
+		return
+	}
+
+	details["error"] = pe.Error()
+
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusBadRequest)
+
+	json.NewEncoder(w).Encode(details)
+}
+
+/*
+Extract a boolean from a query parameter. Returns false and true if the
+parameter was not given.
+*/
+func queryParamBool(w http.ResponseWriter, r *http.Request, param string) (bool, bool) {
+
+	val := r.URL.Query().Get(param)
+
+	if val == "" {
+		return false, true
+	}
+
+	b, err := strconv.ParseBool(val)
+
+	if err != nil {
+		api.WriteError(w, r, "Invalid parameter value: "+param+" should be a boolean", http.StatusBadRequest)
+		return false, false
+	}
+
+	return b, true
+}
+
 /*
 Extract a positive number from a query parameter. Returns -1 and true
 if the parameter was not given.
@@ -75,7 +240,7 @@ func queryParamPosNum(w http.ResponseWriter, r *http.Request, param string) (int
 	num, err := strconv.Atoi(val)
 
 	if err != nil || num < 0 {
-		http.Error(w, "Invalid parameter value: "+param+" should be a positive integer number", http.StatusBadRequest)
+		api.WriteError(w, r, "Invalid parameter value: "+param+" should be a positive integer number", http.StatusBadRequest)
 		return -1, false
 	}
 
@@ -77,6 +77,99 @@ func TestSwaggerDefs(t *testing.T) {
 	}
 }
 
+func TestPartitionAuthorization(t *testing.T) {
+	queryURL := "http://localhost" + TESTPORT + EndpointQuery
+	graphURL := "http://localhost" + TESTPORT + EndpointGraph
+	indexURL := "http://localhost" + TESTPORT + EndpointIndexQuery
+	infoURL := "http://localhost" + TESTPORT + EndpointInfoQuery
+
+	api.Auth, _ = api.NewAPIKeyAuthenticator([]*api.APIKey{
+		{Name: "team1", Key: "key1", Scope: api.ScopeReadWrite},
+		{Name: "team2", Key: "key2", Scope: api.ScopeReadWrite},
+	})
+	api.Authz, _ = api.NewRulesAuthorizer([]*api.AuthzRule{
+		{Principal: "team1", Partitions: []string{"main"}, Access: api.ScopeRead},
+		{Principal: "team2", Partitions: []string{"team2*"}, Access: api.ScopeReadWrite},
+	})
+	defer func() {
+		api.Auth = nil
+		api.Authz = nil
+	}()
+
+	send := func(url string, method string, key string) (string, http.Header, string) {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(`{}`))
+		req.Header.Set("X-Api-Key", key)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			panic(err)
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		return resp.Status, resp.Header, strings.TrimSpace(string(body))
+	}
+
+	// Allowed requests
+
+	if st, _, _ := send(graphURL+"main/n/Song", "GET", "key1"); st != "200 OK" {
+		t.Error("Unexpected response:", st)
+		return
+	}
+
+	if st, _, _ := send(indexURL+"main/n/Song?word=Aria1&attr=name", "GET", "key1"); st != "200 OK" {
+		t.Error("Unexpected response:", st)
+		return
+	}
+
+	st, h, _ := send(queryURL+"main?q=get+Song", "GET", "key1")
+	rid := h.Get(HTTPHeaderCacheID)
+
+	if st != "200 OK" || rid == "" {
+		t.Error("Unexpected response:", st, h)
+		return
+	}
+
+	// Denied requests name the partition
+
+	for _, req := range [][]string{
+		{graphURL + "main", "POST", "key1", `{"error":"Client team1 is not allowed to write partition main"}`},
+		{graphURL + "main/n/Song", "GET", "key2", `{"error":"Client team2 is not allowed to read partition main"}`},
+		{indexURL + "main/n/Song?word=Aria1&attr=name", "GET", "key2", `{"error":"Client team2 is not allowed to read partition main"}`},
+		{queryURL + "main?q=get+Song", "GET", "key2", `{"error":"Client team2 is not allowed to read partition main"}`},
+		{queryURL + "team1?rid=" + rid, "GET", "key1", `{"error":"Client team1 is not allowed to read partition team1"}`},
+		{infoURL + "statistics/main", "GET", "key2", `{"error":"Client team2 is not allowed to read partition main"}`},
+	} {
+		if st, _, res := send(req[0], req[1], req[2]); st != "403 Forbidden" || res != req[3] {
+			t.Error("Unexpected response:", req, st, res)
+			return
+		}
+	}
+
+	// Cached results are scoped to the partition of the query
+
+	if st, _, res := send(queryURL+"team2?rid="+rid, "GET", "key2"); st != "400 Bad Request" ||
+		res != "Unknown result id (rid parameter)" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, h, _ = send(queryURL+"main?q=get+Song&cursor=true&limit=1", "GET", "key1")
+	cursorID := h.Get(HTTPHeaderCursorID)
+
+	if st != "200 OK" || cursorID == "" {
+		t.Error("Unexpected response:", st, h)
+		return
+	}
+
+	if st, _, res := send(queryURL+"team2?cursor_id="+cursorID, "GET", "key2"); st != "410 Gone" ||
+		res != "Cursor is exhausted, has expired or is unknown" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+}
+
 /*
 Send a request to a HTTP test server
 */
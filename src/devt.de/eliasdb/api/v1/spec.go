@@ -0,0 +1,94 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"devt.de/eliasdb/api"
+)
+
+/*
+EndpointSpec is the API description endpoint URL (rooted). Handles spec/
+*/
+const EndpointSpec = api.APIRoot + APIv1 + "/spec/"
+
+/*
+SpecEndpointInst creates a new endpoint handler.
+*/
+func SpecEndpointInst() api.RestEndpointHandler {
+	return &specEndpoint{}
+}
+
+/*
+Handler object for API descriptions.
+*/
+type specEndpoint struct {
+	*api.DefaultEndpointHandler
+}
+
+/*
+HandleGET returns an OpenAPI description of all registered endpoints.
+*/
+func (se *specEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
+
+	if !checkResources(w, r, resources, 0, 0, "") {
+		return
+	}
+
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+
+	json.NewEncoder(w).Encode(api.OpenAPISpec())
+}
+
+/*
+Describe describes the endpoint in the API description.
+*/
+func (se *specEndpoint) Describe() []*api.EndpointDescription {
+	return []*api.EndpointDescription{{
+		Path:    strings.TrimSuffix(EndpointSpec, "/"),
+		Summary: "Return an OpenAPI description of the REST API.",
+		Description: "The description is assembled from all registered endpoints - endpoints " +
+			"which do not describe themselves are listed with the methods they support.",
+		Responses: []*api.ResponseDescription{{Status: 200, Description: "OpenAPI document.",
+			ContentType: "application/json", Schema: map[string]interface{}{"type": "object"}}},
+	}}
+}
+
+/*
+SwaggerDefs is used to describe the endpoint in swagger.
+*/
+func (se *specEndpoint) SwaggerDefs(s map[string]interface{}) {
+
+	s["paths"].(map[string]interface{})["/v1/spec"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary": "Return an OpenAPI description of the REST API.",
+			"description": "The description is assembled from all registered endpoints - endpoints " +
+				"which do not describe themselves are listed with the methods they support.",
+			"produces": []string{
+				"application/json",
+			},
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "OpenAPI document.",
+				},
+				"default": map[string]interface{}{
+					"description": "Error response",
+					"schema": map[string]interface{}{
+						"$ref": "#/definitions/Error",
+					},
+				},
+			},
+		},
+	}
+}
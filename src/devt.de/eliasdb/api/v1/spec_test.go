@@ -0,0 +1,509 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"devt.de/eliasdb/api"
+)
+
+/*
+openAPISchema is an abridged version of the JSON schema of OpenAPI 3.0
+documents (https://spec.openapis.org/oas/3.0/schema/2021-09-28) which covers
+all objects used by the API description.
+*/
+const openAPISchema = `{
+  "type": "object",
+  "required": ["openapi", "info", "paths"],
+  "properties": {
+    "openapi": {"type": "string", "pattern": "^3\\.0\\.\\d(-.+)?$"},
+    "info": {"$ref": "#/definitions/Info"},
+    "servers": {"type": "array"},
+    "security": {"type": "array"},
+    "tags": {"type": "array"},
+    "externalDocs": {"type": "object"},
+    "paths": {"$ref": "#/definitions/Paths"},
+    "components": {"$ref": "#/definitions/Components"}
+  },
+  "patternProperties": {"^x-": {}},
+  "additionalProperties": false,
+  "definitions": {
+    "Reference": {
+      "type": "object",
+      "required": ["$ref"],
+      "patternProperties": {"^\\$ref$": {"type": "string"}}
+    },
+    "Info": {
+      "type": "object",
+      "required": ["title", "version"],
+      "properties": {
+        "title": {"type": "string"},
+        "description": {"type": "string"},
+        "termsOfService": {"type": "string"},
+        "contact": {"type": "object"},
+        "license": {"type": "object"},
+        "version": {"type": "string"}
+      },
+      "patternProperties": {"^x-": {}},
+      "additionalProperties": false
+    },
+    "Schema": {
+      "type": "object",
+      "properties": {
+        "title": {"type": "string"},
+        "required": {"type": "array", "items": {"type": "string"}, "minItems": 1},
+        "enum": {"type": "array", "minItems": 1},
+        "type": {"type": "string", "enum": ["array", "boolean", "integer", "number", "object", "string"]},
+        "items": {"oneOf": [{"$ref": "#/definitions/Schema"}, {"$ref": "#/definitions/Reference"}]},
+        "properties": {
+          "type": "object",
+          "additionalProperties": {"oneOf": [{"$ref": "#/definitions/Schema"}, {"$ref": "#/definitions/Reference"}]}
+        },
+        "additionalProperties": {"oneOf": [{"$ref": "#/definitions/Schema"}, {"$ref": "#/definitions/Reference"}, {"type": "boolean"}]},
+        "description": {"type": "string"},
+        "format": {"type": "string"},
+        "default": {},
+        "nullable": {"type": "boolean"},
+        "readOnly": {"type": "boolean"},
+        "writeOnly": {"type": "boolean"},
+        "example": {},
+        "deprecated": {"type": "boolean"}
+      },
+      "patternProperties": {"^x-": {}},
+      "additionalProperties": false
+    },
+    "Components": {
+      "type": "object",
+      "properties": {
+        "schemas": {
+          "type": "object",
+          "patternProperties": {
+            "^[a-zA-Z0-9\\.\\-_]+$": {"oneOf": [{"$ref": "#/definitions/Schema"}, {"$ref": "#/definitions/Reference"}]}
+          }
+        }
+      },
+      "patternProperties": {"^x-": {}},
+      "additionalProperties": false
+    },
+    "Paths": {
+      "type": "object",
+      "patternProperties": {
+        "^\\/": {"$ref": "#/definitions/PathItem"},
+        "^x-": {}
+      },
+      "additionalProperties": false
+    },
+    "PathItem": {
+      "type": "object",
+      "properties": {
+        "$ref": {"type": "string"},
+        "summary": {"type": "string"},
+        "description": {"type": "string"},
+        "servers": {"type": "array"},
+        "parameters": {
+          "type": "array",
+          "items": {"oneOf": [{"$ref": "#/definitions/Parameter"}, {"$ref": "#/definitions/Reference"}]}
+        }
+      },
+      "patternProperties": {
+        "^(get|put|post|delete|options|head|patch|trace)$": {"$ref": "#/definitions/Operation"},
+        "^x-": {}
+      },
+      "additionalProperties": false
+    },
+    "Operation": {
+      "type": "object",
+      "required": ["responses"],
+      "properties": {
+        "tags": {"type": "array", "items": {"type": "string"}},
+        "summary": {"type": "string"},
+        "description": {"type": "string"},
+        "externalDocs": {"type": "object"},
+        "operationId": {"type": "string"},
+        "parameters": {
+          "type": "array",
+          "items": {"oneOf": [{"$ref": "#/definitions/Parameter"}, {"$ref": "#/definitions/Reference"}]}
+        },
+        "requestBody": {"type": "object"},
+        "responses": {"$ref": "#/definitions/Responses"},
+        "callbacks": {"type": "object"},
+        "deprecated": {"type": "boolean"},
+        "security": {"type": "array"},
+        "servers": {"type": "array"}
+      },
+      "patternProperties": {"^x-": {}},
+      "additionalProperties": false
+    },
+    "Responses": {
+      "type": "object",
+      "properties": {
+        "default": {"oneOf": [{"$ref": "#/definitions/Response"}, {"$ref": "#/definitions/Reference"}]}
+      },
+      "patternProperties": {
+        "^[1-5](?:\\d{2}|XX)$": {"oneOf": [{"$ref": "#/definitions/Response"}, {"$ref": "#/definitions/Reference"}]},
+        "^x-": {}
+      },
+      "minProperties": 1,
+      "additionalProperties": false
+    },
+    "Response": {
+      "type": "object",
+      "required": ["description"],
+      "properties": {
+        "description": {"type": "string"},
+        "headers": {"type": "object"},
+        "content": {"type": "object", "additionalProperties": {"$ref": "#/definitions/MediaType"}},
+        "links": {"type": "object"}
+      },
+      "patternProperties": {"^x-": {}},
+      "additionalProperties": false
+    },
+    "MediaType": {
+      "type": "object",
+      "properties": {
+        "schema": {"oneOf": [{"$ref": "#/definitions/Schema"}, {"$ref": "#/definitions/Reference"}]},
+        "example": {},
+        "examples": {"type": "object"},
+        "encoding": {"type": "object"}
+      },
+      "patternProperties": {"^x-": {}},
+      "additionalProperties": false
+    },
+    "Parameter": {
+      "type": "object",
+      "required": ["name", "in"],
+      "properties": {
+        "name": {"type": "string"},
+        "in": {"type": "string"},
+        "description": {"type": "string"},
+        "required": {"type": "boolean"},
+        "deprecated": {"type": "boolean"},
+        "allowEmptyValue": {"type": "boolean"},
+        "style": {"type": "string"},
+        "explode": {"type": "boolean"},
+        "allowReserved": {"type": "boolean"},
+        "schema": {"oneOf": [{"$ref": "#/definitions/Schema"}, {"$ref": "#/definitions/Reference"}]},
+        "content": {"type": "object"},
+        "example": {},
+        "examples": {"type": "object"}
+      },
+      "patternProperties": {"^x-": {}},
+      "additionalProperties": false,
+      "oneOf": [
+        {"required": ["in", "required"], "properties": {"in": {"enum": ["path"]}, "required": {"enum": [true]}}},
+        {"properties": {"in": {"enum": ["query"]}}},
+        {"properties": {"in": {"enum": ["header"]}}},
+        {"properties": {"in": {"enum": ["cookie"]}}}
+      ]
+    }
+  }
+}`
+
+/*
+validateJSONSchema validates a JSON value against a JSON schema. Only the
+keywords which are used by openAPISchema are supported.
+*/
+func validateJSONSchema(root map[string]interface{}, schema map[string]interface{},
+	val interface{}, loc string) error {
+
+	if ref, ok := schema["$ref"].(string); ok {
+		def := root["definitions"].(map[string]interface{})[strings.TrimPrefix(ref, "#/definitions/")]
+		return validateJSONSchema(root, def.(map[string]interface{}), val, loc)
+	}
+
+	if typ, ok := schema["type"].(string); ok {
+		var valid bool
+
+		switch v := val.(type) {
+		case map[string]interface{}:
+			valid = typ == "object"
+		case []interface{}:
+			valid = typ == "array"
+		case string:
+			valid = typ == "string"
+		case bool:
+			valid = typ == "boolean"
+		case float64:
+			valid = typ == "number" || (typ == "integer" && v == float64(int64(v)))
+		}
+
+		if !valid {
+			return fmt.Errorf("%v: value %v is not of type %v", loc, val, typ)
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		var found bool
+
+		for _, e := range enum {
+			found = found || e == val
+		}
+
+		if !found {
+			return fmt.Errorf("%v: value %v is not one of %v", loc, val, enum)
+		}
+	}
+
+	if pattern, ok := schema["pattern"].(string); ok {
+		if s, ok := val.(string); ok && !regexp.MustCompile(pattern).MatchString(s) {
+			return fmt.Errorf("%v: value %v does not match %v", loc, s, pattern)
+		}
+	}
+
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		var matched []int
+
+		for i, s := range oneOf {
+			if validateJSONSchema(root, s.(map[string]interface{}), val, loc) == nil {
+				matched = append(matched, i)
+			}
+		}
+
+		if len(matched) != 1 {
+			return fmt.Errorf("%v: value must match exactly one schema (matches %v)", loc, matched)
+		}
+	}
+
+	if arr, ok := val.([]interface{}); ok {
+		if min, ok := schema["minItems"].(float64); ok && len(arr) < int(min) {
+			return fmt.Errorf("%v: array has less than %v items", loc, min)
+		}
+
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range arr {
+				if err := validateJSONSchema(root, items, item, fmt.Sprintf("%v[%v]", loc, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	obj, ok := val.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	if min, ok := schema["minProperties"].(float64); ok && len(obj) < int(min) {
+		return fmt.Errorf("%v: object has less than %v properties", loc, min)
+	}
+
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			if _, ok := obj[r.(string)]; !ok {
+				return fmt.Errorf("%v: missing required property %v", loc, r)
+			}
+		}
+	}
+
+	var keys []string
+
+	for k := range obj {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	props, _ := schema["properties"].(map[string]interface{})
+	patternProps, _ := schema["patternProperties"].(map[string]interface{})
+
+	for _, k := range keys {
+		var schemas []interface{}
+
+		if s, ok := props[k]; ok {
+			schemas = append(schemas, s)
+		}
+
+		for pattern, s := range patternProps {
+			if regexp.MustCompile(pattern).MatchString(k) {
+				schemas = append(schemas, s)
+			}
+		}
+
+		if len(schemas) == 0 {
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					return fmt.Errorf("%v: unexpected property %v", loc, k)
+				}
+			case map[string]interface{}:
+				schemas = append(schemas, additional)
+			}
+		}
+
+		for _, s := range schemas {
+			if err := validateJSONSchema(root, s.(map[string]interface{}), obj[k], loc+"/"+k); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+validateOpenAPI validates an OpenAPI document against the OpenAPI schema and
+checks that all parameters of path templates are described.
+*/
+func validateOpenAPI(doc map[string]interface{}) error {
+	var schema map[string]interface{}
+
+	if err := json.Unmarshal([]byte(openAPISchema), &schema); err != nil {
+		return err
+	}
+
+	if err := validateJSONSchema(schema, schema, doc, "#"); err != nil {
+		return err
+	}
+
+	for path, item := range doc["paths"].(map[string]interface{}) {
+		for method, op := range item.(map[string]interface{}) {
+			params := make(map[string]bool)
+
+			opParams, _ := op.(map[string]interface{})["parameters"].([]interface{})
+
+			for _, p := range opParams {
+				if p.(map[string]interface{})["in"] == "path" {
+					params[p.(map[string]interface{})["name"].(string)] = true
+				}
+			}
+
+			for _, m := range regexp.MustCompile(`{([^}]+)}`).FindAllStringSubmatch(path, -1) {
+				if !params[m[1]] {
+					return fmt.Errorf("Path parameter %v of %v %v is not described", m[1], method, path)
+				}
+				delete(params, m[1])
+			}
+
+			if len(params) > 0 {
+				return fmt.Errorf("Path parameters %v of %v %v are not in the path", params, method, path)
+			}
+		}
+	}
+
+	return nil
+}
+
+type specTestEndpoint struct {
+	*api.DefaultEndpointHandler
+}
+
+func (te *specTestEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
+}
+
+func (te *specTestEndpoint) HandlePUT(w http.ResponseWriter, r *http.Request, resources []string) {
+}
+
+func (te *specTestEndpoint) SwaggerDefs(s map[string]interface{}) {
+}
+
+func TestSpec(t *testing.T) {
+	specURL := "http://localhost" + TESTPORT + EndpointSpec
+
+	// Endpoints which are added by an embedding application appear in the
+	// description as well
+
+	api.RegisterRestEndpoints(map[string]api.RestEndpointInst{
+		api.APIRoot + "/spectest/": func() api.RestEndpointHandler {
+			return &specTestEndpoint{}
+		},
+	})
+
+	resp, err := http.Get(specURL)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var doc map[string]interface{}
+
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil || resp.StatusCode != http.StatusOK {
+		t.Error("Unexpected response:", resp.Status, err)
+		return
+	}
+
+	if err := validateOpenAPI(doc); err != nil {
+		t.Error("Invalid OpenAPI document:", err)
+		return
+	}
+
+	paths := doc["paths"].(map[string]interface{})
+
+	// Described endpoints have their own path patterns and operations
+
+	var graphPaths []string
+
+	for path, item := range paths {
+		if strings.HasPrefix(path, EndpointGraph) {
+			var methods []string
+
+			for m := range item.(map[string]interface{}) {
+				methods = append(methods, m)
+			}
+
+			sort.Strings(methods)
+			graphPaths = append(graphPaths, path+" "+strings.Join(methods, ","))
+		}
+	}
+
+	sort.Strings(graphPaths)
+
+	if res := strings.Join(graphPaths, "\n"); res != `
+/db/v1/graph/{partition} delete,post,put
+/db/v1/graph/{partition}/{entity_type} delete,post,put
+/db/v1/graph/{partition}/{entity_type}/{kind} get
+/db/v1/graph/{partition}/{entity_type}/{kind}/{key} get,patch
+/db/v1/graph/{partition}/{entity_type}/{kind}/{key}/{traversal_spec} get`[1:] {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if op, _ := json.Marshal(paths["/db/v1/query/{partition}"].(map[string]interface{})["delete"]); !strings.Contains(string(op),
+		`{"description":"Query which selects the nodes.","in":"query","name":"q","required":true,"schema":{"type":"string"}}`) {
+		t.Error("Unexpected result:", string(op))
+		return
+	}
+
+	// Endpoints without a description are listed with the methods they support
+
+	if res, _ := json.Marshal(paths["/db/spectest"]); string(res) != `{"get":{"responses":{"200":{"description":"Successful response"},`+
+		`"default":{"content":{"application/json":{"schema":{"$ref":"#/components/schemas/Error"}},"text/plain":{"schema":{"type":"string"}}},`+
+		`"description":"Error response (a JSON object if the request accepts application/json)"}}},`+
+		`"put":{"responses":{"200":{"description":"Successful response"},`+
+		`"default":{"content":{"application/json":{"schema":{"$ref":"#/components/schemas/Error"}},"text/plain":{"schema":{"type":"string"}}},`+
+		`"description":"Error response (a JSON object if the request accepts application/json)"}}}}` {
+		t.Error("Unexpected result:", string(res))
+		return
+	}
+
+	if _, ok := paths["/db/v1/subscribe"].(map[string]interface{})["get"]; !ok {
+		t.Error("Unexpected result:", paths["/db/v1/subscribe"])
+		return
+	}
+
+	// The validation detects invalid documents
+
+	paths["/db/v1/spec"].(map[string]interface{})["get"].(map[string]interface{})["parameters"] = []interface{}{
+		map[string]interface{}{"name": "foo", "in": "path", "required": false},
+	}
+
+	if err := validateOpenAPI(doc); err == nil || err.Error() != "#/paths//db/v1/spec/get/parameters[0]: value must match exactly one schema (matches [])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
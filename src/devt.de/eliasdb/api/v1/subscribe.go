@@ -0,0 +1,519 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"devt.de/common/httputil"
+	"devt.de/eliasdb/api"
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
+)
+
+/*
+EndpointSubscribe is the change feed endpoint URL (rooted). Handles subscribe/
+*/
+const EndpointSubscribe = api.APIRoot + APIv1 + "/subscribe/"
+
+/*
+SubscribePingInterval is the interval in which subscribers get a ping. A
+subscriber which does not answer within two intervals is disconnected.
+*/
+var SubscribePingInterval = 30 * time.Second
+
+/*
+SubscribeQueueSize is the number of events which can be queued for a
+subscriber. Subscribers which fall further behind are disconnected.
+*/
+var SubscribeQueueSize = 256
+
+/*
+SubscribeWriteTimeout is the time after which writing a message to a
+subscriber fails.
+*/
+var SubscribeWriteTimeout = 10 * time.Second
+
+/*
+Operations of change events
+*/
+const (
+	SubscribeOpCreate = "create"
+	SubscribeOpUpdate = "update"
+	SubscribeOpDelete = "delete"
+)
+
+/*
+Types of subscription messages
+*/
+const (
+	SubscribeMsgEvent      = "event"
+	SubscribeMsgSubscribed = "subscribed"
+	SubscribeMsgError      = "error"
+)
+
+/*
+SubscriptionFilter selects the change events which are sent to a subscriber.
+Empty lists select everything.
+*/
+type SubscriptionFilter struct {
+	Partitions []string `json:"partitions"` // Partitions of the changed items
+	Kinds      []string `json:"kinds"`      // Kinds of the changed items
+	Operations []string `json:"operations"` // Operations (create, update or delete)
+}
+
+/*
+SubscriptionMessage is a message which is sent to a subscriber.
+*/
+type SubscriptionMessage struct {
+	Type      string                 `json:"type"`                // Type of the message
+	Operation string                 `json:"operation,omitempty"` // Operation of a change event
+	Partition string                 `json:"partition,omitempty"` // Partition of the changed item
+	Kind      string                 `json:"kind,omitempty"`      // Kind of the changed item
+	Key       string                 `json:"key,omitempty"`       // Key of the changed item
+	Edge      bool                   `json:"edge,omitempty"`      // Flag if the changed item is an edge
+	Data      map[string]interface{} `json:"data,omitempty"`      // Data of the changed item
+	Old       map[string]interface{} `json:"old,omitempty"`       // Old data of an updated item
+	Filter    *SubscriptionFilter    `json:"filter,omitempty"`    // Active filter of a subscribed message
+	Error     string                 `json:"error,omitempty"`     // Error of an error message
+}
+
+/*
+SubscribeEndpointInst creates a new endpoint handler.
+*/
+func SubscribeEndpointInst() api.RestEndpointHandler {
+	return &subscribeEndpoint{}
+}
+
+/*
+Handler object for change feed subscriptions.
+*/
+type subscribeEndpoint struct {
+	*api.DefaultEndpointHandler
+}
+
+/*
+subscription is the state of a single subscriber.
+*/
+type subscription struct {
+	conn     *httputil.WebSocketConn // Connection of the subscriber
+	p        *api.Principal          // Principal of the subscriber
+	filter   atomic.Value            // Active filter (*SubscriptionFilter)
+	queue    chan []byte             // Queue of messages which should be sent
+	overflow chan bool               // Channel which is closed if the queue overflowed
+	once     *sync.Once              // Guard for closing the overflow channel
+}
+
+/*
+HandleGET upgrades the request to a WebSocket and sends change events to the
+client. The initial filter can be given with partition, kind and operation
+query parameters - access to the given partitions is checked before the
+connection is upgraded.
+*/
+func (se *subscribeEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
+
+	if !checkResources(w, r, resources, 0, 0, "") {
+		return
+	}
+
+	if !httputil.IsWebSocketUpgrade(r) {
+		api.WriteError(w, r, "Subscriptions need a WebSocket connection", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+
+	filter := &SubscriptionFilter{query["partition"], query["kind"], query["operation"]}
+
+	if err := checkSubscriptionFilter(filter); err != nil {
+		api.WriteError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, part := range filter.Partitions {
+		if !api.Authorize(w, r, part, "") {
+			return
+		}
+	}
+
+	conn, err := httputil.UpgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+
+	s := &subscription{conn: conn, p: api.PrincipalFromContext(r.Context()),
+		queue: make(chan []byte, SubscribeQueueSize), overflow: make(chan bool),
+		once: &sync.Once{}}
+
+	s.filter.Store(filter)
+
+	id := api.GM.SubscribeChanges(s.handleChange)
+	defer api.GM.UnsubscribeChanges(id)
+
+	s.send(&SubscriptionMessage{Type: SubscribeMsgSubscribed, Filter: filter})
+
+	done := make(chan bool)
+	go s.readFilters(done)
+
+	s.writeMessages(done)
+}
+
+/*
+readFilters reads filter messages of the subscriber until the connection is
+closed.
+*/
+func (s *subscription) readFilters(done chan bool) {
+	defer close(done)
+
+	s.conn.SetReadDeadline(time.Now().Add(2 * SubscribePingInterval))
+
+	s.conn.PongHandler = func([]byte) {
+		s.conn.SetReadDeadline(time.Now().Add(2 * SubscribePingInterval))
+	}
+
+	for {
+		_, msg, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		s.conn.SetReadDeadline(time.Now().Add(2 * SubscribePingInterval))
+
+		filter := &SubscriptionFilter{}
+
+		if err := json.Unmarshal(msg, filter); err != nil {
+			s.send(&SubscriptionMessage{Type: SubscribeMsgError,
+				Error: "Could not decode filter: " + err.Error()})
+			continue
+		}
+
+		if err := checkSubscriptionFilter(filter); err != nil {
+			s.send(&SubscriptionMessage{Type: SubscribeMsgError, Error: err.Error()})
+			continue
+		}
+
+		if part, ok := s.authorizeFilter(filter); !ok {
+			s.send(&SubscriptionMessage{Type: SubscribeMsgError,
+				Error: fmt.Sprintf("Client %v is not allowed to read partition %v", principalName(s.p), part)})
+			continue
+		}
+
+		s.filter.Store(filter)
+
+		s.send(&SubscriptionMessage{Type: SubscribeMsgSubscribed, Filter: filter})
+	}
+}
+
+/*
+writeMessages writes queued messages and pings to the subscriber until the
+connection is closed, the subscriber falls behind or the server shuts down.
+*/
+func (s *subscription) writeMessages(done chan bool) {
+
+	ticker := time.NewTicker(SubscribePingInterval)
+	defer ticker.Stop()
+
+	shutdown := api.ShutdownNotify()
+
+	for {
+		var err error
+
+		select {
+		case msg := <-s.queue:
+			s.conn.SetWriteDeadline(time.Now().Add(SubscribeWriteTimeout))
+			err = s.conn.WriteMessage(httputil.WebSocketText, msg)
+
+		case <-ticker.C:
+			s.conn.SetWriteDeadline(time.Now().Add(SubscribeWriteTimeout))
+			err = s.conn.WriteMessage(httputil.WebSocketPing, nil)
+
+		case <-s.overflow:
+			s.conn.CloseWithStatus(httputil.WebSocketClosePolicy, "Subscriber is too slow")
+			<-done
+			return
+
+		case <-shutdown:
+			s.conn.CloseWithStatus(httputil.WebSocketCloseGoingAway, "Server is shutting down")
+			<-done
+			return
+
+		case <-done:
+			s.conn.Close()
+			return
+		}
+
+		if err != nil {
+			s.conn.Close()
+			<-done
+			return
+		}
+	}
+}
+
+/*
+handleChange queues a change event if it matches the filter of the subscriber.
+*/
+func (s *subscription) handleChange(e *graph.ChangeEvent) {
+
+	filter := s.filter.Load().(*SubscriptionFilter)
+
+	msg := newChangeMessage(e)
+
+	if !matchFilter(filter.Partitions, e.Part) || !matchFilter(filter.Kinds, msg.Kind) ||
+		!matchFilter(filter.Operations, msg.Operation) {
+		return
+	}
+
+	if authz := api.Authz; authz != nil && !authz.Authorize(s.p, "GET", e.Part, msg.Kind) {
+		return
+	}
+
+	s.send(msg)
+}
+
+/*
+send queues a message for the subscriber. The subscriber is disconnected if
+its queue is full.
+*/
+func (s *subscription) send(msg *SubscriptionMessage) {
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		data, _ = json.Marshal(&SubscriptionMessage{Type: SubscribeMsgError, Error: err.Error()})
+	}
+
+	select {
+	case s.queue <- data:
+	default:
+		s.once.Do(func() {
+			close(s.overflow)
+		})
+	}
+}
+
+/*
+authorizeFilter checks if the subscriber may read all partitions of a given
+filter. Returns the first partition which may not be read.
+*/
+func (s *subscription) authorizeFilter(filter *SubscriptionFilter) (string, bool) {
+
+	if authz := api.Authz; authz != nil {
+		for _, part := range filter.Partitions {
+			if !authz.Authorize(s.p, "GET", part, "") {
+				return part, false
+			}
+		}
+	}
+
+	return "", true
+}
+
+/*
+checkSubscriptionFilter checks the operations of a given filter.
+*/
+func checkSubscriptionFilter(filter *SubscriptionFilter) error {
+
+	for _, op := range filter.Operations {
+		if op != SubscribeOpCreate && op != SubscribeOpUpdate && op != SubscribeOpDelete {
+			return fmt.Errorf("Invalid operation: %v", op)
+		}
+	}
+
+	return nil
+}
+
+/*
+matchFilter checks if a value is selected by a list of filter values.
+*/
+func matchFilter(values []string, val string) bool {
+
+	if len(values) == 0 {
+		return true
+	}
+
+	for _, v := range values {
+		if v == val {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+newChangeMessage creates an event message for a given change event.
+*/
+func newChangeMessage(e *graph.ChangeEvent) *SubscriptionMessage {
+
+	op := SubscribeOpCreate
+	switch e.Event {
+	case graph.EventNodeUpdated, graph.EventEdgeUpdated:
+		op = SubscribeOpUpdate
+	case graph.EventNodeDeleted, graph.EventEdgeDeleted:
+		op = SubscribeOpDelete
+	}
+
+	msg := &SubscriptionMessage{Type: SubscribeMsgEvent, Operation: op, Partition: e.Part,
+		Kind: e.Node.Kind(), Key: e.Node.Key(), Edge: e.IsEdge(), Data: changeData(e.Node)}
+
+	if e.Old != nil {
+		msg.Old = changeData(e.Old)
+	}
+
+	return msg
+}
+
+/*
+changeData returns a copy of the data of a changed node or edge.
+*/
+func changeData(node data.Node) map[string]interface{} {
+	ret := make(map[string]interface{}, len(node.Data()))
+
+	for k, v := range node.Data() {
+		ret[k] = v
+	}
+
+	return ret
+}
+
+/*
+principalName returns the name of a principal or - if there is none.
+*/
+func principalName(p *api.Principal) string {
+	if p == nil {
+		return "-"
+	}
+	return p.Name
+}
+
+/*
+SwaggerDefs is used to describe the endpoint in swagger.
+*/
+func (se *subscribeEndpoint) SwaggerDefs(s map[string]interface{}) {
+
+	s["paths"].(map[string]interface{})["/v1/subscribe"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary": "Subscribe to changes of nodes and edges.",
+			"description": "Upgrades the connection to a WebSocket which receives a JSON message for every " +
+				"committed change. Clients can change their filter by sending a JSON object with " +
+				"partitions, kinds and operations lists.",
+			"produces": []string{
+				"text/plain",
+				"application/json",
+			},
+			"parameters": []map[string]interface{}{
+				{
+					"name":        "partition",
+					"in":          "query",
+					"description": "Partition of changed items (can be repeated).",
+					"required":    false,
+					"type":        "string",
+				},
+				{
+					"name":        "kind",
+					"in":          "query",
+					"description": "Kind of changed items (can be repeated).",
+					"required":    false,
+					"type":        "string",
+				},
+				{
+					"name":        "operation",
+					"in":          "query",
+					"description": "Operation of changes: create, update or delete (can be repeated).",
+					"required":    false,
+					"type":        "string",
+				},
+			},
+			"responses": map[string]interface{}{
+				"101": map[string]interface{}{
+					"description": "The connection was upgraded to a WebSocket.",
+				},
+				"default": map[string]interface{}{
+					"description": "Error response",
+					"schema": map[string]interface{}{
+						"$ref": "#/definitions/Error",
+					},
+				},
+			},
+		},
+	}
+}
+
+// Client helper
+// =============
+
+/*
+Subscription is a client side subscription to the change feed of an EliasDB
+server.
+*/
+type Subscription struct {
+	conn *httputil.WebSocketConn // Connection to the server
+}
+
+/*
+Subscribe subscribes to the change feed at a given ws:// or wss:// URL (e.g.
+wss://localhost:9090/db/v1/subscribe/). Headers can contain the credentials of
+the client. The server confirms the initial filter with a subscribed message.
+*/
+func Subscribe(wsURL string, header http.Header, tlsConfig *tls.Config) (*Subscription, error) {
+
+	conn, resp, err := httputil.DialWebSocket(wsURL, header, tlsConfig)
+	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, err
+	}
+
+	return &Subscription{conn}, nil
+}
+
+/*
+SetFilter changes the filter of the subscription. The server confirms the
+filter with a subscribed message or rejects it with an error message.
+*/
+func (s *Subscription) SetFilter(filter *SubscriptionFilter) error {
+
+	data, err := json.Marshal(filter)
+	if err != nil {
+		return err
+	}
+
+	return s.conn.WriteMessage(httputil.WebSocketText, data)
+}
+
+/*
+Next waits for the next message of the server.
+*/
+func (s *Subscription) Next() (*SubscriptionMessage, error) {
+
+	_, data, err := s.conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &SubscriptionMessage{}
+
+	return msg, json.Unmarshal(data, msg)
+}
+
+/*
+Close closes the subscription.
+*/
+func (s *Subscription) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,249 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"devt.de/common/httputil"
+	"devt.de/eliasdb/api"
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
+)
+
+func TestSubscribe(t *testing.T) {
+	subscribeURL := "http://localhost" + TESTPORT + EndpointSubscribe
+	wsURL := "ws://localhost" + TESTPORT + EndpointSubscribe
+
+	storeNode := func(part string, kind string, key string, name string) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", kind)
+		node.SetAttr("name", name)
+
+		if err := api.GM.StoreNode(part, node); err != nil {
+			t.Error(err)
+		}
+	}
+
+	next := func(s *Subscription) string {
+		msg, err := s.Next()
+		if err != nil {
+			return err.Error()
+		}
+		res, _ := json.Marshal(msg)
+		return string(res)
+	}
+
+	// Normal requests are rejected
+
+	resp, _ := http.Get(subscribeURL)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Error("Unexpected response:", resp.Status)
+		return
+	}
+
+	if _, err := Subscribe(wsURL+"?operation=foo", nil, nil); err == nil ||
+		err.Error() != "WebSocket handshake failed: 400 Bad Request" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Subscribers get all committed changes
+
+	s, err := Subscribe(wsURL, nil, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := next(s); res != `{"type":"subscribed","filter":{"partitions":null,"kinds":null,"operations":null}}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	storeNode("subscribe", "Sub", "1", "foo")
+	storeNode("subscribe", "Sub", "1", "bar")
+	api.GM.RemoveNode("subscribe", "1", "Sub")
+
+	for _, expected := range []string{
+		`{"type":"event","operation":"create","partition":"subscribe","kind":"Sub","key":"1","data":{"key":"1","kind":"Sub","name":"foo"}}`,
+		`{"type":"event","operation":"update","partition":"subscribe","kind":"Sub","key":"1","data":{"key":"1","kind":"Sub","name":"bar"},"old":{"key":"1","kind":"Sub","name":"foo"}}`,
+		`{"type":"event","operation":"delete","partition":"subscribe","kind":"Sub","key":"1","data":{"key":"1","kind":"Sub","name":"bar"}}`,
+	} {
+		if res := next(s); res != expected {
+			t.Error("Unexpected result:", res)
+			return
+		}
+	}
+
+	// Filters can be changed
+
+	s.SetFilter(&SubscriptionFilter{Operations: []string{"foo"}})
+
+	if res := next(s); res != `{"type":"error","error":"Invalid operation: foo"}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	s.SetFilter(&SubscriptionFilter{Kinds: []string{"Sub2"}, Operations: []string{SubscribeOpCreate}})
+
+	if res := next(s); res != `{"type":"subscribed","filter":{"partitions":null,"kinds":["Sub2"],"operations":["create"]}}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	storeNode("subscribe", "Sub", "2", "foo")
+	storeNode("subscribe", "Sub2", "2", "foo")
+	storeNode("subscribe", "Sub2", "2", "bar")
+	storeNode("subscribe", "Sub2", "3", "foo")
+
+	for _, expected := range []string{
+		`{"type":"event","operation":"create","partition":"subscribe","kind":"Sub2","key":"2","data":{"key":"2","kind":"Sub2","name":"foo"}}`,
+		`{"type":"event","operation":"create","partition":"subscribe","kind":"Sub2","key":"3","data":{"key":"3","kind":"Sub2","name":"foo"}}`,
+	} {
+		if res := next(s); res != expected {
+			t.Error("Unexpected result:", res)
+			return
+		}
+	}
+
+	s.Close()
+
+	// Subscribers are pinged and stay connected while they answer
+
+	oldPingInterval := SubscribePingInterval
+	SubscribePingInterval = 50 * time.Millisecond
+	defer func() {
+		SubscribePingInterval = oldPingInterval
+	}()
+
+	s, _ = Subscribe(wsURL+"?kind=Sub3", nil, nil)
+	next(s)
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		storeNode("subscribe", "Sub3", "1", "foo")
+	}()
+
+	if res := next(s); res != `{"type":"event","operation":"create","partition":"subscribe","kind":"Sub3","key":"1","data":{"key":"1","kind":"Sub3","name":"foo"}}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	s.Close()
+
+	SubscribePingInterval = oldPingInterval
+
+	// Slow subscribers are disconnected
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _ := httputil.UpgradeWebSocket(w, r)
+
+		s := &subscription{conn: conn, queue: make(chan []byte, 1),
+			overflow: make(chan bool), once: &sync.Once{}}
+		s.filter.Store(&SubscriptionFilter{})
+
+		for i := 0; i < 3; i++ {
+			s.handleChange(&graph.ChangeEvent{Event: graph.EventNodeCreated, Part: "main",
+				Node: data.NewGraphNode()})
+		}
+
+		done := make(chan bool)
+		go s.readFilters(done)
+
+		s.writeMessages(done)
+	}))
+	defer srv.Close()
+
+	s, _ = Subscribe("ws"+strings.TrimPrefix(srv.URL, "http"), nil, nil)
+
+	for err == nil {
+		_, err = s.Next()
+	}
+
+	if err.Error() != "WebSocket closed: 1008 Subscriber is too slow" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Subscribers are disconnected when the server shuts down
+
+	s, _ = Subscribe(wsURL, nil, nil)
+	next(s)
+
+	api.BeginShutdown()
+
+	if res := next(s); res != "WebSocket closed: 1001 Server is shutting down" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Authentication and authorization apply when subscribing
+
+	api.Auth, _ = api.NewAPIKeyAuthenticator([]*api.APIKey{
+		{Name: "team1", Key: "key1", Scope: api.ScopeRead},
+	})
+	api.Authz, _ = api.NewRulesAuthorizer([]*api.AuthzRule{
+		{Principal: "team1", Partitions: []string{"subscribe"}, Access: api.ScopeRead},
+	})
+	defer func() {
+		api.Auth = nil
+		api.Authz = nil
+	}()
+
+	if _, err := Subscribe(wsURL, nil, nil); err == nil ||
+		err.Error() != "WebSocket handshake failed: 401 Unauthorized" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	header := http.Header{}
+	header.Set("X-Api-Key", "key1")
+
+	if _, err := Subscribe(wsURL+"?partition=main", header, nil); err == nil ||
+		err.Error() != "WebSocket handshake failed: 403 Forbidden" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	s, err = Subscribe(wsURL+"?kind=Sub5", header, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer s.Close()
+
+	next(s)
+
+	s.SetFilter(&SubscriptionFilter{Partitions: []string{"main"}})
+
+	if res := next(s); res != `{"type":"error","error":"Client team1 is not allowed to read partition main"}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Changes of partitions which cannot be read are not sent
+
+	storeNode("main", "Sub5", "1", "foo")
+	storeNode("subscribe", "Sub5", "1", "foo")
+
+	if res := next(s); res != `{"type":"event","operation":"create","partition":"subscribe","kind":"Sub5","key":"1","data":{"key":"1","kind":"Sub5","name":"foo"}}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
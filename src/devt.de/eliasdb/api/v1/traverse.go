@@ -0,0 +1,259 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"devt.de/eliasdb/api"
+	"devt.de/eliasdb/graph/data"
+)
+
+/*
+EndpointTraverse is the traversal endpoint URL (rooted). Handles traverse/
+*/
+const EndpointTraverse = api.APIRoot + APIv1 + "/traverse/"
+
+/*
+TraverseEndpointInst creates a new endpoint handler.
+*/
+func TraverseEndpointInst() api.RestEndpointHandler {
+	return &traverseEndpoint{}
+}
+
+/*
+Handler object for traversals.
+*/
+type traverseEndpoint struct {
+	*api.DefaultEndpointHandler
+}
+
+/*
+traverseResult is the result of a traversal - the lists are parallel (the
+n-th edge leads to the n-th node).
+*/
+type traverseResult struct {
+	Nodes []data.Node `json:"nodes"` // Traversed nodes
+	Edges []data.Node `json:"edges"` // Traversed edges
+}
+
+/*
+HandleGET traverses from a node to its neighbours following a (partial) edge
+spec. Returns the traversed edges and nodes sorted by node key.
+*/
+func (te *traverseEndpoint) HandleGET(w http.ResponseWriter, r *http.Request, resources []string) {
+
+	if !checkResources(w, r, resources, 3, 4, "Need a partition, a node kind and a node key; optional traversal spec") {
+		return
+	}
+
+	part, kind, key, spec := resources[0], resources[1], resources[2], ":::"
+
+	if len(resources) == 4 {
+		spec = resources[3]
+	}
+
+	if !api.Authorize(w, r, part, kind) {
+		return
+	}
+
+	limit, ok := queryParamPosNum(w, r, "limit")
+	if !ok {
+		return
+	}
+
+	var fields []string
+
+	if f := r.URL.Query().Get("fields"); f != "" {
+		fields = append(strings.Split(f, ","), data.NodeKey, data.NodeKind)
+	}
+
+	// Check that the start node exists
+
+	node, err := api.GM.FetchNodePart(part, key, kind, []string{data.NodeKey, data.NodeKind})
+	if err != nil {
+		api.WriteError(w, r, err.Error(), graphErrorStatus(err))
+		return
+	} else if node == nil {
+		api.WriteError(w, r, "Unknown node", http.StatusNotFound)
+		return
+	}
+
+	nodes, edges, err := api.GM.TraverseMulti(part, key, kind, spec, true)
+	if err != nil {
+		api.WriteError(w, r, err.Error(), graphErrorStatus(err))
+		return
+	}
+
+	res := &traverseResult{make([]data.Node, 0, len(nodes)), make([]data.Node, 0, len(edges))}
+
+	for i, n := range nodes {
+		if fields != nil {
+			n = data.NodeClone(n)
+
+			for attr := range n.Data() {
+				if !containsString(fields, attr) {
+					n.SetAttr(attr, nil)
+				}
+			}
+		}
+
+		res.Nodes = append(res.Nodes, n)
+		res.Edges = append(res.Edges, edges[i])
+	}
+
+	sort.Stable(&traversalResultComparator{[][]data.Node{res.Nodes, res.Edges}})
+
+	totalCount := strconv.Itoa(len(res.Nodes))
+
+	if limit != -1 && limit < len(res.Nodes) {
+		res.Nodes, res.Edges = res.Nodes[:limit], res.Edges[:limit]
+	}
+
+	w.Header().Add(HTTPHeaderTotalCount, totalCount)
+
+	writeJSONWithETag(w, r, res, true, totalCount)
+}
+
+/*
+containsString checks if a list of strings contains a given string.
+*/
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Describe describes the endpoint in the API description.
+*/
+func (te *traverseEndpoint) Describe() []*api.EndpointDescription {
+	return []*api.EndpointDescription{{
+		Path:        EndpointTraverse + "{partition}/{kind}/{key}/{spec}",
+		Summary:     "Traverse from a node to its neighbours.",
+		Description: "Returns the traversed edges and nodes sorted by node key.",
+		Parameters: []*api.ParameterDescription{
+			{Name: "limit", In: "query", Description: "How many traversed nodes and edges to return.", Type: "integer"},
+			{Name: "fields", In: "query", Description: "Comma separated list of node attributes to return."},
+		},
+		Responses: []*api.ResponseDescription{
+			{Status: 200, Description: "Two parallel lists of traversed nodes and edges.",
+				ContentType: "application/json", Schema: map[string]interface{}{"type": "object"}},
+			{Status: 404, Description: "The start node does not exist."},
+		},
+	}}
+}
+
+/*
+SwaggerDefs is used to describe the endpoint in swagger.
+*/
+func (te *traverseEndpoint) SwaggerDefs(s map[string]interface{}) {
+
+	params := []map[string]interface{}{
+		{
+			"name":        "partition",
+			"in":          "path",
+			"description": "Partition of the start node.",
+			"required":    true,
+			"type":        "string",
+		},
+		{
+			"name":        "kind",
+			"in":          "path",
+			"description": "Kind of the start node.",
+			"required":    true,
+			"type":        "string",
+		},
+		{
+			"name":        "key",
+			"in":          "path",
+			"description": "Key of the start node.",
+			"required":    true,
+			"type":        "string",
+		},
+		{
+			"name": "spec",
+			"in":   "path",
+			"description": "Traversal spec (<role>:<edge kind>:<role>:<node kind>) - empty components " +
+				"match everything.",
+			"required": true,
+			"type":     "string",
+		},
+		{
+			"name":        "limit",
+			"in":          "query",
+			"description": "How many traversed nodes and edges to return.",
+			"required":    false,
+			"type":        "number",
+			"format":      "integer",
+		},
+		{
+			"name":        "fields",
+			"in":          "query",
+			"description": "Comma separated list of node attributes to return (key and kind are always returned).",
+			"required":    false,
+			"type":        "string",
+		},
+	}
+
+	s["paths"].(map[string]interface{})["/v1/traverse/{partition}/{kind}/{key}/{spec}"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary": "Traverse from a node to its neighbours.",
+			"description": "Returns the traversed edges and nodes sorted by node key. " +
+				"The X-Total-Count header contains the total number of traversed nodes.",
+			"produces": []string{
+				"text/plain",
+				"application/json",
+			},
+			"parameters": params,
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "Two parallel lists of traversed nodes and edges - the n-th edge leads to the n-th node.",
+					"schema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"nodes": map[string]interface{}{
+								"type": "array",
+								"items": map[string]interface{}{
+									"type": "object",
+								},
+							},
+							"edges": map[string]interface{}{
+								"type": "array",
+								"items": map[string]interface{}{
+									"type": "object",
+								},
+							},
+						},
+					},
+				},
+				"304": map[string]interface{}{
+					"description": "The ETag of the data matches the If-None-Match header - no data is returned.",
+				},
+				"404": map[string]interface{}{
+					"description": "The start node does not exist.",
+				},
+				"default": map[string]interface{}{
+					"description": "Error response",
+					"schema": map[string]interface{}{
+						"$ref": "#/definitions/Error",
+					},
+				},
+			},
+		},
+	}
+}
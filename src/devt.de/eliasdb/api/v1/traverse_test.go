@@ -0,0 +1,196 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTraverse(t *testing.T) {
+	traverseURL := "http://localhost" + TESTPORT + EndpointTraverse
+
+	st, _, res := sendTestRequest("http://localhost"+TESTPORT+EndpointBatch+"traversetest", "POST", []byte(`[
+  {"op":"storeNode","key":"a","kind":"Person","name":"Anna","email":"anna@example.com"},
+  {"op":"storeNode","key":"c","kind":"Person","name":"Carl","email":"carl@example.com"},
+  {"op":"storeNode","key":"b","kind":"Person","name":"Bert","email":"bert@example.com"},
+  {"op":"storeNode","key":"x","kind":"Group","name":"Group X"},
+  {"op":"storeNode","key":"y","kind":"Person","name":"Yann"},
+  {"op":"storeEdge","key":"ac","kind":"Knows","end1key":"a","end1kind":"Person","end1role":"friend","end1cascading":false,
+   "end2key":"c","end2kind":"Person","end2role":"friend","end2cascading":false},
+  {"op":"storeEdge","key":"ab","kind":"Knows","end1key":"a","end1kind":"Person","end1role":"friend","end1cascading":false,
+   "end2key":"b","end2kind":"Person","end2role":"friend","end2cascading":false},
+  {"op":"storeEdge","key":"ax","kind":"Member","end1key":"a","end1kind":"Person","end1role":"member","end1cascading":false,
+   "end2key":"x","end2kind":"Group","end2role":"group","end2cascading":false}
+]`))
+	if st != "200 OK" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, header, res := sendTestRequest(traverseURL+"traversetest/Person/a/:Knows::?fields=name", "GET", nil)
+
+	if st != "200 OK" || header.Get(HTTPHeaderTotalCount) != "2" || res != `{
+  "nodes": [
+    {
+      "key": "b",
+      "kind": "Person",
+      "name": "Bert"
+    },
+    {
+      "key": "c",
+      "kind": "Person",
+      "name": "Carl"
+    }
+  ],
+  "edges": [
+    {
+      "end1cascading": false,
+      "end1key": "a",
+      "end1kind": "Person",
+      "end1role": "friend",
+      "end2cascading": false,
+      "end2key": "b",
+      "end2kind": "Person",
+      "end2role": "friend",
+      "key": "ab",
+      "kind": "Knows"
+    },
+    {
+      "end1cascading": false,
+      "end1key": "a",
+      "end1kind": "Person",
+      "end1role": "friend",
+      "end2cascading": false,
+      "end2key": "c",
+      "end2kind": "Person",
+      "end2role": "friend",
+      "key": "ac",
+      "kind": "Knows"
+    }
+  ]
+}` {
+		t.Error("Unexpected response:", st, header, res)
+		return
+	}
+
+	// Responses have a weak entity tag
+
+	req, _ := http.NewRequest("GET", traverseURL+"traversetest/Person/a/:Knows::?fields=name", nil)
+	req.Header.Set("If-None-Match", header.Get("ETag"))
+
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNotModified {
+		t.Error("Unexpected response:", err, resp.Status)
+		return
+	}
+
+	// All edges are followed without a spec
+
+	st, header, res = sendTestRequest(traverseURL+"traversetest/Person/a?limit=1&fields=email", "GET", nil)
+
+	if st != "200 OK" || header.Get(HTTPHeaderTotalCount) != "3" || res != `{
+  "nodes": [
+    {
+      "email": "bert@example.com",
+      "key": "b",
+      "kind": "Person"
+    }
+  ],
+  "edges": [
+    {
+      "end1cascading": false,
+      "end1key": "a",
+      "end1kind": "Person",
+      "end1role": "friend",
+      "end2cascading": false,
+      "end2key": "b",
+      "end2kind": "Person",
+      "end2role": "friend",
+      "key": "ab",
+      "kind": "Knows"
+    }
+  ]
+}` {
+		t.Error("Unexpected response:", st, header, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(traverseURL+"traversetest/Person/a/member:::Group", "GET", nil)
+
+	if st != "200 OK" || res != `{
+  "nodes": [
+    {
+      "key": "x",
+      "kind": "Group",
+      "name": "Group X"
+    }
+  ],
+  "edges": [
+    {
+      "end1cascading": false,
+      "end1key": "a",
+      "end1kind": "Person",
+      "end1role": "member",
+      "end2cascading": false,
+      "end2key": "x",
+      "end2kind": "Group",
+      "end2role": "group",
+      "key": "ax",
+      "kind": "Member"
+    }
+  ]
+}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Nodes without matching edges
+
+	st, _, res = sendTestRequest(traverseURL+"traversetest/Person/y/:Knows::", "GET", nil)
+
+	if st != "200 OK" || res != `{
+  "nodes": [],
+  "edges": []
+}` {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	// Test error cases
+
+	st, _, res = sendTestRequest(traverseURL+"traversetest/Person/z/:Knows::", "GET", nil)
+
+	if st != "404 Not Found" || res != "Unknown node" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(traverseURL+"traversetest/Person", "GET", nil)
+
+	if st != "400 Bad Request" || res != "Need a partition, a node kind and a node key; optional traversal spec" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(traverseURL+"traversetest/Person/a/:Knows:", "GET", nil)
+
+	if st != "500 Internal Server Error" || res != "GraphError: Invalid data (Invalid spec: :Knows:)" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+
+	st, _, res = sendTestRequest(traverseURL+"traversetest/Person/a?limit=-1", "GET", nil)
+
+	if st != "400 Bad Request" || res != "Invalid parameter value: limit should be a positive integer number" {
+		t.Error("Unexpected response:", st, res)
+		return
+	}
+}
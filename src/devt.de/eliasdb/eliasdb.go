@@ -41,10 +41,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"path"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -54,6 +56,7 @@ import (
 	"devt.de/common/lockutil"
 	"devt.de/eliasdb/api"
 	"devt.de/eliasdb/api/v1"
+	"devt.de/eliasdb/eql"
 	"devt.de/eliasdb/graph"
 	"devt.de/eliasdb/graph/graphstorage"
 	"devt.de/eliasdb/version"
@@ -81,10 +84,57 @@ const (
 	HTTPSHost                = "HTTPSHost"
 	HTTPSPort                = "HTTPSPort"
 	EnableReadOnly           = "EnableReadOnly"
+	EnableRequestLog         = "EnableRequestLog"
 	EnableWebFolder          = "EnableWebFolder"
 	EnableWebTerminal        = "EnableWebTerminal"
+	EnableJSONErrors         = "EnableJSONErrors"
 	ResultCacheMaxSize       = "ResultCacheMaxSize"
 	ResultCacheMaxAgeSeconds = "ResultCacheMaxAgeSeconds"
+	QueryCacheMaxSize        = "QueryCacheMaxSize"
+	QueryTimeoutSeconds      = "QueryTimeoutSeconds"
+	QueryMaxNodes            = "QueryMaxNodes"
+	QueryMaxRows             = "QueryMaxRows"
+	QueryCursorMaxCount      = "QueryCursorMaxCount"
+	QueryCursorMaxRows       = "QueryCursorMaxRows"
+	QueryCursorTTLSeconds    = "QueryCursorTTLSeconds"
+	QueryCursorPageSize      = "QueryCursorPageSize"
+	QueryJobWorkers          = "QueryJobWorkers"
+	QueryJobMaxQueued        = "QueryJobMaxQueued"
+	QueryJobTTLSeconds       = "QueryJobTTLSeconds"
+	QueryJobSpillRows        = "QueryJobSpillRows"
+	QueryJobTempDir          = "QueryJobTempDir"
+	BackupTempDir            = "BackupTempDir"
+	MaxQueryTimeSeconds      = "MaxQueryTimeSeconds"
+	APIKeyFile               = "APIKeyFile"
+	UserFile                 = "UserFile"
+	AuthRealm                = "AuthRealm"
+	JWTKeyFile               = "JWTKeyFile"
+	JWTJWKSURL               = "JWTJWKSURL"
+	JWTIssuer                = "JWTIssuer"
+	JWTAudience              = "JWTAudience"
+	JWTClockSkewSeconds      = "JWTClockSkewSeconds"
+	JWTSubjectClaim          = "JWTSubjectClaim"
+	JWTRolesClaims           = "JWTRolesClaims"
+	JWTWriteScope            = "JWTWriteScope"
+	AuthExemptAbout          = "AuthExemptAbout"
+	AuthExemptHealth         = "AuthExemptHealth"
+	AboutShowDataLocation    = "AboutShowDataLocation"
+	AuthzRuleFile            = "AuthzRuleFile"
+	CORSAllowedOrigins       = "CORSAllowedOrigins"
+	CORSAllowedMethods       = "CORSAllowedMethods"
+	CORSAllowedHeaders       = "CORSAllowedHeaders"
+	CORSAllowCredentials     = "CORSAllowCredentials"
+	CORSMaxAgeSeconds        = "CORSMaxAgeSeconds"
+	CompressionMinSize       = "CompressionMinSize"
+	RateLimitReadPerSecond   = "RateLimitReadPerSecond"
+	RateLimitReadBurst       = "RateLimitReadBurst"
+	RateLimitWritePerSecond  = "RateLimitWritePerSecond"
+	RateLimitWriteBurst      = "RateLimitWriteBurst"
+	RateLimitQueryPerSecond  = "RateLimitQueryPerSecond"
+	RateLimitQueryBurst      = "RateLimitQueryBurst"
+	HealthMinFreeDiskMB      = "HealthMinFreeDiskMB"
+	ShutdownGraceSeconds     = "ShutdownGraceSeconds"
+	MaxRequestBodySizeKB     = "MaxRequestBodySizeKB"
 )
 
 /*
@@ -93,8 +143,10 @@ DefaultConfig is the defaut configuration
 var DefaultConfig = map[string]interface{}{
 	MemoryOnlyStorage:        false,
 	EnableReadOnly:           false,
+	EnableRequestLog:         true,
 	EnableWebFolder:          true,
 	EnableWebTerminal:        true,
+	EnableJSONErrors:         false,
 	LocationDatastore:        "db",
 	LocationHTTPS:            "ssl",
 	LocationWebFolder:        "web",
@@ -105,6 +157,51 @@ var DefaultConfig = map[string]interface{}{
 	LockFile:                 "eliasdb.lck",
 	ResultCacheMaxSize:       "",
 	ResultCacheMaxAgeSeconds: "",
+	QueryCacheMaxSize:        "100",
+	QueryTimeoutSeconds:      "",
+	QueryMaxNodes:            "",
+	QueryMaxRows:             "",
+	QueryCursorMaxCount:      "100",
+	QueryCursorMaxRows:       "10000",
+	QueryCursorTTLSeconds:    "300",
+	QueryCursorPageSize:      "100",
+	QueryJobWorkers:          "4",
+	QueryJobMaxQueued:        "100",
+	QueryJobTTLSeconds:       "3600",
+	QueryJobSpillRows:        "10000",
+	QueryJobTempDir:          "",
+	BackupTempDir:            "",
+	MaxQueryTimeSeconds:      "",
+	APIKeyFile:               "",
+	UserFile:                 "",
+	AuthRealm:                "EliasDB",
+	JWTKeyFile:               "",
+	JWTJWKSURL:               "",
+	JWTIssuer:                "",
+	JWTAudience:              "",
+	JWTClockSkewSeconds:      "30",
+	JWTSubjectClaim:          "sub",
+	JWTRolesClaims:           "roles,scope",
+	JWTWriteScope:            "",
+	AuthExemptAbout:          false,
+	AuthExemptHealth:         true,
+	AboutShowDataLocation:    true,
+	AuthzRuleFile:            "",
+	CORSAllowedOrigins:       "",
+	CORSAllowedMethods:       "GET,POST,PUT,DELETE",
+	CORSAllowedHeaders:       "Accept,Authorization,Content-Type,X-Api-Key",
+	CORSAllowCredentials:     false,
+	CORSMaxAgeSeconds:        "600",
+	CompressionMinSize:       "1024",
+	RateLimitReadPerSecond:   "",
+	RateLimitReadBurst:       "",
+	RateLimitWritePerSecond:  "",
+	RateLimitWriteBurst:      "",
+	RateLimitQueryPerSecond:  "",
+	RateLimitQueryBurst:      "",
+	HealthMinFreeDiskMB:      "64",
+	ShutdownGraceSeconds:     "30",
+	MaxRequestBodySizeKB:     "32768",
 }
 
 /*
@@ -177,6 +274,10 @@ func main() {
 			fatal(err)
 			return
 		}
+
+		if Config[AboutShowDataLocation].(bool) {
+			api.DataLocation = loc
+		}
 	}
 
 	// Create GraphManager
@@ -188,7 +289,7 @@ func main() {
 
 		print("Closing datastore")
 
-		if err := gs.Close(); err != nil {
+		if err := api.GM.Close(); err != nil {
 			fatal(err)
 			return
 		}
@@ -207,6 +308,200 @@ func main() {
 	api.APIHost = config(HTTPSHost) + ":" + config(HTTPSPort)
 	v1.ResultCacheMaxSize, _ = strconv.ParseUint(config(ResultCacheMaxSize), 10, 0)
 	v1.ResultCacheMaxAge, _ = strconv.ParseInt(config(ResultCacheMaxAgeSeconds), 10, 0)
+	v1.QueryCacheMaxSize, _ = strconv.ParseUint(config(QueryCacheMaxSize), 10, 0)
+	v1.QueryTimeout, _ = strconv.ParseInt(config(QueryTimeoutSeconds), 10, 0)
+	v1.QueryMaxNodes, _ = strconv.Atoi(config(QueryMaxNodes))
+	v1.QueryMaxRows, _ = strconv.Atoi(config(QueryMaxRows))
+	v1.QueryCursorMaxCount, _ = strconv.ParseUint(config(QueryCursorMaxCount), 10, 0)
+	v1.QueryCursorMaxRows, _ = strconv.Atoi(config(QueryCursorMaxRows))
+	v1.QueryCursorTTL, _ = strconv.ParseInt(config(QueryCursorTTLSeconds), 10, 0)
+	v1.QueryCursorPageSize, _ = strconv.Atoi(config(QueryCursorPageSize))
+	v1.QueryJobWorkers, _ = strconv.Atoi(config(QueryJobWorkers))
+	v1.QueryJobMaxQueued, _ = strconv.Atoi(config(QueryJobMaxQueued))
+	v1.QueryJobTTL, _ = strconv.ParseInt(config(QueryJobTTLSeconds), 10, 0)
+	v1.QueryJobSpillRows, _ = strconv.Atoi(config(QueryJobSpillRows))
+	v1.QueryJobTempDir = config(QueryJobTempDir)
+	v1.BackupTempDir = config(BackupTempDir)
+
+	api.GzipMinSize, _ = strconv.Atoi(config(CompressionMinSize))
+
+	if !Config[EnableRequestLog].(bool) {
+		api.RequestLog = nil
+	}
+
+	// Limit the size of request bodies and write all errors as JSON objects
+	// if requested (otherwise only requests accepting JSON get JSON errors)
+
+	maxBodySize, _ := strconv.ParseInt(config(MaxRequestBodySizeKB), 10, 64)
+	api.MaxRequestBodySize = maxBodySize * 1024
+
+	api.JSONErrors = Config[EnableJSONErrors].(bool)
+
+	maxQueryTime, _ := strconv.ParseInt(config(MaxQueryTimeSeconds), 10, 0)
+	eql.MaxQueryTime = time.Duration(maxQueryTime) * time.Second
+
+	// Enable authentication of REST requests if API keys, users or JWT keys
+	// are configured
+
+	keyFile, userFile := config(APIKeyFile), config(UserFile)
+	jwtKeyFile, jwksURL := config(JWTKeyFile), config(JWTJWKSURL)
+
+	authCount := 0
+	for _, s := range []string{keyFile, userFile, jwtKeyFile + jwksURL} {
+		if s != "" {
+			authCount++
+		}
+	}
+
+	if authCount > 1 {
+
+		fatal("Only one of ", APIKeyFile, ", ", UserFile, " and ", JWTKeyFile, "/", JWTJWKSURL, " can be set")
+		return
+
+	} else if jwtKeyFile != "" && jwksURL != "" {
+
+		fatal("Only one of ", JWTKeyFile, " and ", JWTJWKSURL, " can be set")
+		return
+
+	} else if keyFile != "" {
+
+		print("Enabling API key authentication with keys from: ", keyFile)
+
+		auth, err := api.LoadAPIKeyAuthenticator(basepath + keyFile)
+		if err != nil {
+			fatal(err)
+			return
+		}
+
+		api.Auth = auth
+
+	} else if userFile != "" {
+
+		print("Enabling basic authentication with users from: ", userFile)
+
+		store, err := api.LoadFileUserStore(basepath + userFile)
+		if err != nil {
+			fatal(err)
+			return
+		}
+
+		api.Auth = api.NewBasicAuthenticator(store, config(AuthRealm))
+
+	} else if jwtKeyFile != "" || jwksURL != "" {
+		var err error
+
+		clockSkew, _ := strconv.ParseInt(config(JWTClockSkewSeconds), 10, 0)
+
+		jwtConfig := api.JWTConfig{
+			Issuer:    config(JWTIssuer),
+			Audience:  config(JWTAudience),
+			ClockSkew: time.Duration(clockSkew) * time.Second,
+			Subject:   config(JWTSubjectClaim),
+			Roles:     strings.Split(config(JWTRolesClaims), ","),
+			Write:     config(JWTWriteScope),
+		}
+
+		if jwtKeyFile != "" {
+			print("Enabling JWT authentication with key from: ", jwtKeyFile)
+
+			jwtConfig.HMACKey, jwtConfig.RSAKey, err = api.LoadJWTKey(basepath + jwtKeyFile)
+
+		} else {
+			print("Enabling JWT authentication with keys from: ", jwksURL)
+
+			jwtConfig.FetchJWKS = api.HTTPJWKSFetcher(jwksURL)
+		}
+
+		var auth *api.JWTAuthenticator
+
+		if err == nil {
+			auth, err = api.NewJWTAuthenticator(jwtConfig)
+		}
+
+		if err != nil {
+			fatal(err)
+			return
+		}
+
+		api.Auth = auth
+	}
+
+	if api.Auth != nil && Config[AuthExemptAbout].(bool) {
+		api.AuthExempt[api.EndpointAbout] = true
+	}
+
+	if api.Auth != nil && Config[AuthExemptHealth].(bool) {
+		api.AuthExempt[api.EndpointHealth] = true
+	}
+
+	// Restrict the access of authenticated clients to partitions if rules
+	// are configured
+
+	if rulesFile := config(AuthzRuleFile); rulesFile != "" {
+
+		if api.Auth == nil {
+			fatal(AuthzRuleFile, " needs one of ", APIKeyFile, ", ", UserFile, " and ", JWTKeyFile, "/", JWTJWKSURL)
+			return
+		}
+
+		print("Enabling partition authorization with rules from: ", rulesFile)
+
+		authz, err := api.LoadRulesAuthorizer(basepath + rulesFile)
+		if err != nil {
+			fatal(err)
+			return
+		}
+
+		api.Authz = authz
+	}
+
+	// Limit the rate of requests per client - rates can be changed at
+	// runtime with the rate limits admin endpoint
+
+	rates := make(map[string]api.Rate)
+
+	for class, opts := range map[string][]string{
+		api.RateClassRead:  {RateLimitReadPerSecond, RateLimitReadBurst},
+		api.RateClassWrite: {RateLimitWritePerSecond, RateLimitWriteBurst},
+		api.RateClassQuery: {RateLimitQueryPerSecond, RateLimitQueryBurst},
+	} {
+		perSecond, _ := strconv.ParseFloat(config(opts[0]), 64)
+		burst, _ := strconv.Atoi(config(opts[1]))
+
+		if perSecond > 0 && burst < 1 {
+			burst = int(math.Ceil(perSecond))
+		}
+
+		rates[class] = api.Rate{PerSecond: perSecond, Burst: burst}
+	}
+
+	api.Limiter = api.NewRateLimiter(nil)
+
+	if err := api.Limiter.SetRates(rates); err != nil {
+		fatal(err)
+		return
+	}
+
+	// Allow cross-origin requests if origins are configured
+
+	if origins := config(CORSAllowedOrigins); origins != "" {
+		maxAge, _ := strconv.Atoi(config(CORSMaxAgeSeconds))
+
+		api.CORS = &api.CORSConfig{
+			AllowedOrigins: strings.Split(origins, ","),
+			AllowedMethods: strings.Split(config(CORSAllowedMethods), ","),
+			AllowedHeaders: strings.Split(config(CORSAllowedHeaders), ","),
+			ExposedHeaders: []string{v1.HTTPHeaderTotalCount, v1.HTTPHeaderHasMore,
+				v1.HTTPHeaderCacheID, v1.HTTPHeaderCursor, v1.HTTPHeaderCursorID},
+			AllowCredentials: Config[CORSAllowCredentials].(bool),
+			MaxAge:           maxAge,
+		}
+	}
+
+	// Fail the health check if the disk of the datastore is almost full
+
+	minFreeDisk, _ := strconv.ParseUint(config(HealthMinFreeDiskMB), 10, 64)
+	api.HealthMinFreeDisk = minFreeDisk * 1024 * 1024
 
 	// Check if HTTPS key and certificate are in place
 
@@ -240,6 +535,7 @@ func main() {
 
 	api.RegisterRestEndpoints(v1.V1EndpointMap)
 	api.RegisterRestEndpoints(api.GeneralEndpointMap)
+	api.RegisterRestEndpoints(api.AdminEndpointMap)
 
 	// Register normal web server
 
@@ -274,6 +570,17 @@ func main() {
 
 	hs := &httputil.HTTPServer{}
 
+	// On shutdown (SIGINT, SIGTERM or a modified lockfile) in-flight requests
+	// get a grace period to finish - event streams are closed right away
+
+	graceSeconds, _ := strconv.ParseInt(config(ShutdownGraceSeconds), 10, 0)
+	hs.GracePeriod = time.Duration(graceSeconds) * time.Second
+
+	hs.RegisterOnShutdown(func() {
+		api.SetReady(false)
+		api.BeginShutdown()
+	})
+
 	var wg sync.WaitGroup
 	wg.Add(1)
 
@@ -295,6 +602,10 @@ func main() {
 		return
 	}
 
+	// The server can serve requests - the readiness check passes from now on
+
+	api.SetReady(true)
+
 	// Read server certificate and write a fingerprint file
 
 	fpfile := basepath + config(LocationWebFolder) + "/fingerprint.json"
@@ -333,6 +644,12 @@ func main() {
 			time.Sleep(time.Duration(1) * time.Second)
 		}
 
+		// Nothing to do if the server was shut down by a signal
+
+		if !hs.Running {
+			return
+		}
+
 		print("Lockfile was modified")
 
 		hs.Shutdown()
@@ -346,4 +663,13 @@ func main() {
 	wg.Wait()
 
 	print("Shutting down")
+
+	lf.Finish()
+
+	// All requests have finished - open server-side cursors and query jobs
+	// are not valid beyond the lifetime of the server and the datastore is
+	// closed once main returns
+
+	v1.CloseCursors()
+	v1.CloseQueryJobs()
 }
@@ -12,15 +12,18 @@ package main
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -244,7 +247,7 @@ Nothing to dump from a memory only datastore
 
 	delete(msm.AccessMap, 6)
 
-	msm.AccessMap[5] = storage.AccessCacheAndFetchSeriousError
+	msm.AccessMap[7] = storage.AccessCacheAndFetchSeriousError
 
 	err = handleJSONExport(gm, "main", "test_export.json")
 	if !strings.HasPrefix(err.Error(), "GraphError: Could not read graph information") {
@@ -252,7 +255,7 @@ Nothing to dump from a memory only datastore
 		return
 	}
 
-	delete(msm.AccessMap, 5)
+	delete(msm.AccessMap, 7)
 
 	gm.StoreEdge("main", data.NewGraphEdgeFromNode(data.NewGraphNodeFromMap(map[string]interface{}{
 		"end1cascading": false,
@@ -614,6 +617,133 @@ Closing datastore`[1:] {
 
 }
 
+func TestMainGracefulShutdown(t *testing.T) {
+
+	// Make sure to reset the DefaultServeMux and the configuration
+
+	defer func() { http.DefaultServeMux = http.NewServeMux() }()
+
+	oldHandleFunc := api.HandleFunc
+	api.HandleFunc = http.HandleFunc
+
+	defer func() {
+		api.HandleFunc = oldHandleFunc
+		Config = nil
+	}()
+
+	// Make sure to remove any files
+
+	defer func() {
+		if err := os.RemoveAll(testdb); err != nil {
+			fmt.Print("Could not remove test directory:", err.Error())
+		}
+		time.Sleep(time.Duration(100) * time.Millisecond)
+		ensurePath(testdb)
+	}()
+
+	// Setup config and logs
+
+	Config = make(map[string]interface{})
+	for k, v := range DefaultConfig {
+		Config[k] = v
+	}
+
+	Config[HTTPSPort] = "9093"
+	Config[EnableWebFolder] = false
+
+	printLog = []string{}
+	errorLog = []string{}
+
+	errorChan := make(chan error)
+
+	go func() {
+		_, err := execMain(nil)
+		errorChan <- err
+	}()
+
+	time.Sleep(time.Duration(2) * time.Second)
+
+	// Start a request which is still sending data during the shutdown
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+
+	pr, pw := io.Pipe()
+
+	respChan := make(chan string)
+
+	go func() {
+		resp, err := client.Post("https://localhost:9093/db/v1/graph/main/n", "application/json", pr)
+		if err != nil {
+			respChan <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		respChan <- resp.Status + " " + string(body)
+	}()
+
+	pw.Write([]byte(`[{"key":"a","kind":"Test",`))
+
+	time.Sleep(time.Duration(200) * time.Millisecond)
+
+	// Send SIGTERM - the server stops accepting connections and waits for
+	// the request
+
+	p, _ := os.FindProcess(os.Getpid())
+	if err := p.Signal(syscall.SIGTERM); err != nil {
+		t.Error(err)
+		return
+	}
+
+	time.Sleep(time.Duration(200) * time.Millisecond)
+
+	if api.IsReady() {
+		t.Error("Server should not be ready during shutdown")
+		return
+	}
+
+	pw.Write([]byte(`"name":"durable"}]`))
+	pw.Close()
+
+	if res := <-respChan; res != "200 OK " {
+		t.Error("Unexpected response:", res)
+		return
+	}
+
+	// Wait for the main function to end
+
+	if err := <-errorChan; err != nil || len(errorLog) != 0 {
+		t.Error("Unexpected ending of main thread:", err, errorLog)
+		return
+	}
+
+	if logString := strings.Join(printLog, "\n"); !strings.HasSuffix(logString, `
+Waiting for shutdown
+Shutting down
+Closing datastore`) {
+		t.Error("Unexpected log:", logString)
+		return
+	}
+
+	// The write is durable after a restart
+
+	gs, err := graphstorage.NewDiskGraphStorage(testdb+"/db", true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer gs.Close()
+
+	if n, err := graph.NewGraphManager(gs).FetchNode("main", "a", "Test"); err != nil ||
+		n == nil || n.Attr("name") != "durable" {
+		t.Error("Unexpected result:", n, err)
+		return
+	}
+}
+
 func TestMainErrorCases(t *testing.T) {
 
 	// Make sure to reset the DefaultServeMux
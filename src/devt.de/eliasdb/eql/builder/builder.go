@@ -0,0 +1,547 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+/*
+Package builder contains a programmatic API to compose EQL queries.
+
+A query is started with Get, Lookup, Delete or Update and its clauses are
+added with methods which can be chained:
+
+	q := builder.Get("User").
+		Where(builder.Eq("active", true), builder.Gt("age", 30)).
+		Traverse(":::Order").
+		Show("name", "Order:total").
+		OrderBy("name", builder.Asc).
+		Limit(50)
+
+The query text is produced by String or Build - Build also parses the query.
+Prepare returns a parsed query which can be run directly.
+
+Values given to the builder are always literals - they are quoted and cannot
+change the structure of the query. Strings which are the left operand of a
+condition are attribute names (use Val for a literal) and strings which are
+the right operand are literals (use Attr for an attribute).
+*/
+package builder
+
+import (
+	"fmt"
+	"strings"
+
+	"devt.de/common/stringutil"
+	"devt.de/eliasdb/eql"
+	"devt.de/eliasdb/eql/parser"
+)
+
+/*
+Direction is the direction of an ordering.
+*/
+type Direction int
+
+/*
+Available ordering directions
+*/
+const (
+	Asc Direction = iota
+	Desc
+)
+
+/*
+Query is an EQL query which is composed by calling its methods. Errors of
+the composition are returned by Build and Prepare.
+*/
+type Query struct {
+	stmt       string       // Statement of the query (get, lookup, delete or update)
+	kind       string       // Node kind of the query
+	keys       []string     // Node keys of a lookup query
+	group      string       // Group of the query (from group)
+	primary    string       // Primary node kind
+	where      []Expr       // Conditions of the where clause
+	traversals []*Traversal // Traversals of the query
+	show       []*Column    // Columns of the show clause
+	set        []string     // Assignments of an update statement
+	ordering   []string     // Ordering terms
+	filtering  []string     // Filtering terms
+	flags      []string     // Further operations of the with clause
+	limit      int          // Limit of the result (-1 for no limit)
+	offset     int          // Offset of the result (-1 for no offset)
+	err        error        // First error of the composition
+}
+
+/*
+Get starts a get query on a node kind.
+*/
+func Get(kind string) *Query {
+	return newQuery(parser.NodeGET, kind)
+}
+
+/*
+Lookup starts a lookup query for nodes of a kind with given keys.
+*/
+func Lookup(kind string, keys ...string) *Query {
+	q := newQuery(parser.NodeLOOKUP, kind)
+
+	if len(keys) == 0 {
+		q.fail("Lookup query needs at least one key")
+	}
+
+	q.keys = keys
+
+	return q
+}
+
+/*
+Delete starts a delete statement on a node kind. The statement needs a where
+clause.
+*/
+func Delete(kind string) *Query {
+	return newQuery(parser.NodeDELETE, kind)
+}
+
+/*
+Update starts an update statement on a node kind. The statement needs a set
+clause (see Set) and a where clause.
+*/
+func Update(kind string) *Query {
+	return newQuery(parser.NodeUPDATE, kind)
+}
+
+/*
+newQuery creates a new query.
+*/
+func newQuery(stmt string, kind string) *Query {
+	q := &Query{stmt: stmt, kind: kind, limit: -1, offset: -1}
+
+	if !stringutil.IsAlphaNumeric(kind) {
+		q.fail(fmt.Sprintf("Invalid node kind '%v' - can only contain [a-zA-Z0-9_]", kind))
+	}
+
+	return q
+}
+
+/*
+fail records an error of the composition. Only the first error is kept.
+*/
+func (q *Query) fail(msg string) {
+	if q.err == nil {
+		q.err = fmt.Errorf("Invalid %v query: %v", q.stmt, msg)
+	}
+}
+
+/*
+FromGroup restricts the start nodes to the members of a group.
+*/
+func (q *Query) FromGroup(group string) *Query {
+	q.group = group
+	return q
+}
+
+/*
+Primary sets the primary node kind of the query.
+*/
+func (q *Query) Primary(kind string) *Query {
+	q.primary = kind
+	return q
+}
+
+/*
+Where adds conditions to the where clause. All conditions of the where
+clause must be true.
+*/
+func (q *Query) Where(conds ...Expr) *Query {
+	q.where = append(q.where, conds...)
+	return q
+}
+
+/*
+Traverse adds a traversal with a given traversal spec and optional
+conditions for the traversed nodes.
+*/
+func (q *Query) Traverse(spec string, conds ...Expr) *Query {
+	return q.Traversals(T(spec).Where(conds...))
+}
+
+/*
+Traversals adds traversals which can contain further traversals (see T).
+*/
+func (q *Query) Traversals(ts ...*Traversal) *Query {
+	q.traversals = append(q.traversals, ts...)
+	return q
+}
+
+/*
+Show adds columns to the show clause. A column can be a string with a column
+definition (e.g. name or 2:n:name), a *Column or an expression (a function or
+an arithmetic expression).
+*/
+func (q *Query) Show(cols ...interface{}) *Query {
+	for _, col := range cols {
+		switch col := col.(type) {
+		case string:
+			q.show = append(q.show, Col(col))
+		case Expr:
+			q.show = append(q.show, Col(col))
+		case *Column:
+			q.show = append(q.show, col)
+		default:
+			q.fail(fmt.Sprintf("Invalid column of type %T", col))
+		}
+	}
+	return q
+}
+
+/*
+Set adds an assignment to an update statement. The value is a literal unless
+it is an expression (e.g. Add("ranking", 1)).
+*/
+func (q *Query) Set(attr string, val interface{}) *Query {
+	q.set = append(q.set, fmt.Sprintf("%v = %v", quote(attr), value(val).render(clauseWhere)))
+	return q
+}
+
+/*
+OrderBy adds a column to the ordering of the result. Columns are ordered in
+the order in which they were added.
+*/
+func (q *Query) OrderBy(col string, dir Direction) *Query {
+	if dir == Desc {
+		q.ordering = append(q.ordering, "descending "+quote(col))
+	} else {
+		q.ordering = append(q.ordering, "ascending "+quote(col))
+	}
+	return q
+}
+
+/*
+Unique removes rows with duplicate values in a given column.
+*/
+func (q *Query) Unique(col string) *Query {
+	q.filtering = append(q.filtering, "unique "+quote(col))
+	return q
+}
+
+/*
+UniqueCount removes rows with duplicate values in a given column and shows
+how often each value was encountered.
+*/
+func (q *Query) UniqueCount(col string) *Query {
+	q.filtering = append(q.filtering, "uniquecount "+quote(col))
+	return q
+}
+
+/*
+NotNull removes rows without a value in a given column.
+*/
+func (q *Query) NotNull(col string) *Query {
+	q.filtering = append(q.filtering, "isnotnull "+quote(col))
+	return q
+}
+
+/*
+NullTraversal sets if rows with partial traversals are included.
+*/
+func (q *Query) NullTraversal(allow bool) *Query {
+	q.flags = append(q.flags, fmt.Sprintf("nulltraversal(%v)", allow))
+	return q
+}
+
+/*
+Distinct removes duplicate rows from the result.
+*/
+func (q *Query) Distinct() *Query {
+	return q.flag(parser.NodeDISTINCT)
+}
+
+/*
+NoCase compares strings in the where clause case-insensitively.
+*/
+func (q *Query) NoCase() *Query {
+	return q.flag(parser.NodeNOCASE)
+}
+
+/*
+Strict compares values in the where clause and the ordering without type
+coercion.
+*/
+func (q *Query) Strict() *Query {
+	return q.flag(parser.NodeSTRICT)
+}
+
+/*
+NullsFirst orders missing values before all other values.
+*/
+func (q *Query) NullsFirst() *Query {
+	return q.flag(parser.NodeNULLSFIRST)
+}
+
+/*
+NullsLast orders missing values after all other values.
+*/
+func (q *Query) NullsLast() *Query {
+	return q.flag(parser.NodeNULLSLAST)
+}
+
+/*
+DryRun only counts the nodes which a delete or update statement would change.
+*/
+func (q *Query) DryRun() *Query {
+	return q.flag(parser.NodeDRYRUN)
+}
+
+/*
+flag adds an operation to the with clause.
+*/
+func (q *Query) flag(flag string) *Query {
+	q.flags = append(q.flags, flag)
+	return q
+}
+
+/*
+Limit sets the maximum number of rows of the result.
+*/
+func (q *Query) Limit(n int) *Query {
+	if n < 0 {
+		q.fail(fmt.Sprintf("Limit must not be negative: %v", n))
+	}
+	q.limit = n
+	return q
+}
+
+/*
+Offset sets the number of rows which are skipped.
+*/
+func (q *Query) Offset(n int) *Query {
+	if n < 0 {
+		q.fail(fmt.Sprintf("Offset must not be negative: %v", n))
+	}
+	q.offset = n
+	return q
+}
+
+/*
+String returns the text of the query.
+*/
+func (q *Query) String() string {
+	var buf strings.Builder
+
+	if q.stmt == parser.NodeDELETE {
+		buf.WriteString("delete from " + q.kind)
+	} else {
+		buf.WriteString(q.stmt + " " + q.kind)
+	}
+
+	if len(q.keys) > 0 {
+		keys := make([]string, len(q.keys))
+		for i, key := range q.keys {
+			keys[i] = quote(key)
+		}
+		buf.WriteString(" " + strings.Join(keys, ", "))
+	}
+
+	if len(q.set) > 0 {
+		buf.WriteString(" set " + strings.Join(q.set, ", "))
+	}
+
+	if q.group != "" {
+		buf.WriteString(" from group " + quote(q.group))
+	}
+
+	if q.primary != "" {
+		buf.WriteString(" primary " + quote(q.primary))
+	}
+
+	if len(q.where) > 0 {
+		buf.WriteString(" where " + And(q.where...).render(clauseWhere))
+	}
+
+	for _, t := range q.traversals {
+		t.write(&buf)
+	}
+
+	if len(q.show) > 0 {
+		cols := make([]string, len(q.show))
+		for i, col := range q.show {
+			cols[i] = col.String()
+		}
+		buf.WriteString(" show " + strings.Join(cols, ", "))
+	}
+
+	var with []string
+
+	if len(q.ordering) > 0 {
+		with = append(with, "ordering("+strings.Join(q.ordering, ", ")+")")
+	}
+
+	if len(q.filtering) > 0 {
+		with = append(with, "filtering("+strings.Join(q.filtering, ", ")+")")
+	}
+
+	with = append(with, q.flags...)
+
+	if len(with) > 0 {
+		buf.WriteString(" with " + strings.Join(with, ", "))
+	}
+
+	if q.limit != -1 {
+		buf.WriteString(fmt.Sprint(" limit ", q.limit))
+	}
+
+	if q.offset != -1 {
+		buf.WriteString(fmt.Sprint(" offset ", q.offset))
+	}
+
+	return buf.String()
+}
+
+/*
+Build returns the text of the query. The query is parsed to make sure it is
+valid.
+*/
+func (q *Query) Build() (string, error) {
+	if q.err != nil {
+		return "", q.err
+	}
+
+	query := q.String()
+
+	if _, err := parser.Parse(q.stmt, query); err != nil {
+		return "", err
+	}
+
+	return query, nil
+}
+
+/*
+Prepare parses the query so it can be run repeatedly (see eql.Prepare). The
+given name is used to identify the query in errors.
+*/
+func (q *Query) Prepare(name string) (*eql.PreparedQuery, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+
+	return eql.Prepare(name, q.String())
+}
+
+/*
+Traversal is a traversal of a query which can have conditions and further
+traversals.
+*/
+type Traversal struct {
+	spec       string       // Traversal spec
+	where      []Expr       // Conditions of the where clause
+	traversals []*Traversal // Further traversals
+}
+
+/*
+T creates a traversal with a given traversal spec (e.g. :::Order).
+*/
+func T(spec string) *Traversal {
+	return &Traversal{spec: spec}
+}
+
+/*
+Where adds conditions to the where clause of the traversal.
+*/
+func (t *Traversal) Where(conds ...Expr) *Traversal {
+	t.where = append(t.where, conds...)
+	return t
+}
+
+/*
+Traverse adds a further traversal with a given traversal spec and optional
+conditions.
+*/
+func (t *Traversal) Traverse(spec string, conds ...Expr) *Traversal {
+	return t.Traversals(T(spec).Where(conds...))
+}
+
+/*
+Traversals adds further traversals.
+*/
+func (t *Traversal) Traversals(ts ...*Traversal) *Traversal {
+	t.traversals = append(t.traversals, ts...)
+	return t
+}
+
+/*
+write writes the text of the traversal to a given buffer.
+*/
+func (t *Traversal) write(buf *strings.Builder) {
+	buf.WriteString(" traverse " + quote(t.spec))
+
+	if len(t.where) > 0 {
+		buf.WriteString(" where " + And(t.where...).render(clauseWhere))
+	}
+
+	for _, child := range t.traversals {
+		child.write(buf)
+	}
+
+	buf.WriteString(" end")
+}
+
+/*
+Column is a column of a show clause.
+*/
+type Column struct {
+	data   string // Column definition
+	expr   Expr   // Expression of the column (if it is not a column definition)
+	alias  string // Alias of the column
+	format string // Display format of the column
+}
+
+/*
+Col creates a column from a column definition (e.g. name, Person:name or
+2:n:name) or from an expression (a function or an arithmetic expression).
+*/
+func Col(col interface{}) *Column {
+	if expr, ok := col.(Expr); ok {
+		return &Column{expr: expr}
+	}
+	return &Column{data: fmt.Sprint(col)}
+}
+
+/*
+As sets the alias of the column.
+*/
+func (c *Column) As(alias string) *Column {
+	c.alias = alias
+	return c
+}
+
+/*
+Format sets the display format of the column.
+*/
+func (c *Column) Format(format string) *Column {
+	c.format = format
+	return c
+}
+
+/*
+String returns the text of the column.
+*/
+func (c *Column) String() string {
+	ret := quote(c.data)
+
+	if c.expr != nil {
+		ret = c.expr.render(clauseShow)
+	}
+
+	if c.alias != "" {
+		ret += " as " + quote(c.alias)
+	}
+
+	if c.format != "" {
+		ret += " format " + quote(c.format)
+	}
+
+	return ret
+}
@@ -0,0 +1,222 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package builder
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"devt.de/eliasdb/eql"
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+func testGraph() *graph.Manager {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := graph.NewGraphManager(mgs)
+
+	storeUser := func(key string, name string, age int, active bool, tags []string) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "User")
+		node.SetAttr("name", name)
+		node.SetAttr("age", age)
+		node.SetAttr("active", active)
+		node.SetAttr("tags", tags)
+		gm.StoreNode("main", node)
+	}
+
+	storeUser("u1", "Alice", 42, true, []string{"admin"})
+	storeUser("u2", "Bob", 25, true, nil)
+	storeUser("u3", "Carol's", 35, false, []string{"admin", "dev"})
+	storeUser("u4", "name", 51, true, []string{"dev"})
+
+	for i, user := range []string{"u1", "u1", "u3", "u4"} {
+		order := data.NewGraphNode()
+		order.SetAttr("key", fmt.Sprint("o", i))
+		order.SetAttr("kind", "Order")
+		order.SetAttr("total", (i+1)*10)
+		gm.StoreNode("main", order)
+
+		edge := data.NewGraphEdge()
+		edge.SetAttr("key", fmt.Sprint("e", i))
+		edge.SetAttr("kind", "Placed")
+		edge.SetAttr(data.EdgeEnd1Key, user)
+		edge.SetAttr(data.EdgeEnd1Kind, "User")
+		edge.SetAttr(data.EdgeEnd1Role, "customer")
+		edge.SetAttr(data.EdgeEnd1Cascading, false)
+		edge.SetAttr(data.EdgeEnd2Key, order.Key())
+		edge.SetAttr(data.EdgeEnd2Kind, "Order")
+		edge.SetAttr(data.EdgeEnd2Role, "order")
+		edge.SetAttr(data.EdgeEnd2Cascading, false)
+		gm.StoreEdge("main", edge)
+	}
+
+	return gm
+}
+
+func TestQueryText(t *testing.T) {
+
+	q := Get("User").
+		Where(Eq("active", true), Gt("age", 30)).
+		Traverse(":::Order", Geq("total", -1.5)).
+		Show("name", Col("Order:total").As("Total").Format("text")).
+		OrderBy("name", Asc).
+		OrderBy("Total", Desc).
+		Limit(50).
+		Offset(10)
+
+	if res, err := q.Build(); err != nil || res != "get User where (('attr:active' = true) and ('attr:age' > val:30)) "+
+		"traverse ':::Order' where ('attr:total' >= -val:1.5) end show 'name', 'Order:total' as 'Total' format 'text' "+
+		"with ordering(ascending 'name', descending 'Total') limit 50 offset 10" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	q = Lookup("User", "u1", "u'2").
+		Traversals(T(":::Order").Traverse("::order:", Has(EAttr("since")))).
+		Show(Func("count", "1:n:Order"), Col(Mul("price", Neg(2))).As("x")).
+		Unique("name").UniqueCount("age").NotNull("name").
+		NullTraversal(true).Distinct().NoCase().Strict().NullsFirst()
+
+	if res, err := q.Build(); err != nil || res != `lookup User 'u1', 'u\x272' traverse ':::Order' `+
+		`traverse '::order:' where (has 'eattr:since') end end show @'count'('1:n:Order'), ('price' * (- 2)) as 'x' `+
+		`with filtering(unique 'name', uniquecount 'age', isnotnull 'name'), nulltraversal(true), distinct, nocase, strict, nullsfirst` {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	q = Update("User").Set("age", Add("age", 1)).Set("note", "it's").Where(Eq("key", "u1")).DryRun()
+
+	if res, err := q.Build(); err != nil || res != `update User set 'age' = ('attr:age' + val:1), 'note' = 'val:it\x27s' `+
+		`where ('attr:key' = 'val:u1') with dryrun` {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	q = Delete("User").Where(Or(Not(Has("name")), InQuery("key", Get("Order").Show("key"))))
+
+	if res, err := q.Build(); err != nil || res != `delete from User where ((not (has 'attr:name')) or `+
+		`('attr:key' in (get Order show 'key')))` {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Errors of the composition are reported
+
+	if _, err := Get("User; drop").Build(); err == nil || err.Error() !=
+		"Invalid get query: Invalid node kind 'User; drop' - can only contain [a-zA-Z0-9_]" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := Lookup("User").Limit(-1).Prepare("test"); err == nil || err.Error() !=
+		"Invalid lookup query: Lookup query needs at least one key" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := Get("User").Show(1).Build(); err == nil || err.Error() !=
+		"Invalid get query: Invalid column of type int" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := Delete("User").Build(); err == nil || err.Error() !=
+		"Parse error in delete: Missing where clause (delete) (Line:1 Pos:1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestQueryRun(t *testing.T) {
+	gm := testGraph()
+
+	run := func(q *Query) string {
+		pq, err := q.Prepare("test")
+		if err != nil {
+			return err.Error()
+		}
+
+		res, err := pq.Run(context.Background(), "main", gm, eql.RunOptions{Sorted: true})
+		if err != nil {
+			return err.Error()
+		}
+
+		return fmt.Sprint(res.Rows())
+	}
+
+	if res := run(Get("User").
+		Where(Eq("active", true), Gt("age", 30)).
+		Traverse(":::Order").
+		Show("name", "Order:total").
+		OrderBy("Order:total", Desc).
+		Limit(2)); res != "[[name 40] [Alice 20]]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Values cannot be mistaken for attributes, keywords or the end of a
+	// quoted value
+
+	for val, expected := range map[string]string{
+		"name":             "[[u4]]",
+		"Carol's":          "[[u3]]",
+		`x' or 'a' = 'a`:   "[]",
+		`\' or true or '`:  "[]",
+		`" or true or "`:   "[]",
+		"null":             "[]",
+		"Alice') or (true": "[]",
+		"Bob\n' or true #": "[]",
+	} {
+		if res := run(Get("User").Where(Eq("name", val)).Show("key")); res != expected {
+			t.Error("Unexpected result:", val, res, "expected:", expected)
+			return
+		}
+	}
+
+	if res := run(Get("User").Where(Eq(Val("name"), "name")).Show("key")); res != "[[u1] [u2] [u3] [u4]]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := run(Get("User").Where(Eq("name", Attr("name")), In("age", 42, -1, "25")).Show("key")); res != "[[u1] [u2]]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := run(Get("User").Where(Eq(Any("tags"), "dev"), InList("admin", "tags")).Show("key")); res != "[[u3]]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := run(Get("User").Where(Lt(Sub("age", 10), 30), Not(Like("name", "B*"))).Show("key")); res != "[[u3]]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := run(Get("User").Where(Eq("age", "35")).Strict().Show("key")); res != "[]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := run(Update("User").Set("age", Add("age", 1)).Where(Eq("key", "u2"))); res != "[[1]]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := run(Get("User").Where(Eq("key", "u2")).Show("age")); res != "[[26]]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
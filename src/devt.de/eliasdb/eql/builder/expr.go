@@ -0,0 +1,550 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package builder
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+/*
+Clauses in which an expression can be rendered
+*/
+const (
+	clauseWhere = iota // Where and set clauses - literals are prefixed with val:
+	clauseShow         // Show clauses - attributes are plain column values
+)
+
+/*
+Expr is an expression of a where clause, a set clause or a show clause.
+Expressions are created with the functions of this package - conditions
+(e.g. Eq or And), operands (Attr, Val, Any, All or Func) and arithmetic
+expressions (e.g. Mul).
+*/
+type Expr interface {
+
+	/*
+	   render returns the text of this expression in a given clause.
+	*/
+	render(clause int) string
+}
+
+// Operands
+// ========
+
+/*
+attrExpr is the name of a node or edge attribute.
+*/
+type attrExpr struct {
+	name string // Name of the attribute
+	edge bool   // Flag if this is an edge attribute
+}
+
+/*
+Attr returns the name of a node attribute. Names which are qualified with a
+kind of a traversal spec (e.g. Wrote:number) are resolved by the interpreter.
+*/
+func Attr(name string) Expr {
+	return &attrExpr{name, false}
+}
+
+/*
+EAttr returns the name of an edge attribute.
+*/
+func EAttr(name string) Expr {
+	return &attrExpr{name, true}
+}
+
+/*
+render returns the text of this expression in a given clause.
+*/
+func (e *attrExpr) render(clause int) string {
+
+	if clause == clauseShow || (!e.edge && strings.Contains(e.name, ":")) {
+		return quote(e.name)
+	} else if e.edge {
+		return quote("eattr:" + e.name)
+	}
+
+	return quote("attr:" + e.name)
+}
+
+/*
+valExpr is a literal value.
+*/
+type valExpr struct {
+	val interface{} // Value of the literal
+}
+
+/*
+Val returns a literal value. Strings are always literals - they are never
+interpreted as attribute names or keywords. Numbers are numbers, booleans are
+the constants true and false and nil is the constant null. Slices and arrays
+are lists of values. All other values are represented by their string
+representation.
+*/
+func Val(val interface{}) Expr {
+	return &valExpr{val}
+}
+
+/*
+render returns the text of this expression in a given clause.
+*/
+func (e *valExpr) render(clause int) string {
+	prefix := ""
+
+	if clause == clauseWhere {
+		prefix = "val:"
+	}
+
+	switch val := e.val.(type) {
+
+	case nil:
+		return "null"
+
+	case bool:
+		return strconv.FormatBool(val)
+
+	case string:
+		return quote(prefix + val)
+
+	case Expr:
+		return val.render(clause)
+	}
+
+	rv := reflect.ValueOf(e.val)
+
+	switch rv.Kind() {
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return number(prefix, float64(rv.Int()), strconv.FormatInt(rv.Int(), 10))
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return prefix + strconv.FormatUint(rv.Uint(), 10)
+
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return quote(prefix + fmt.Sprint(f))
+		}
+
+		return number(prefix, f, strconv.FormatFloat(f, 'f', -1, 64))
+
+	case reflect.Slice, reflect.Array:
+		items := make([]string, rv.Len())
+
+		for i := range items {
+			items[i] = (&valExpr{rv.Index(i).Interface()}).render(clause)
+		}
+
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+
+	return quote(prefix + fmt.Sprint(e.val))
+}
+
+/*
+number returns the text of a number. Negative numbers are written with a
+unary minus since the prefix of a literal cannot contain a minus sign.
+*/
+func number(prefix string, f float64, s string) string {
+	if f < 0 {
+		return "-" + prefix + strings.TrimPrefix(s, "-")
+	}
+	return prefix + s
+}
+
+/*
+quantifierExpr is a quantified attribute (any or all).
+*/
+type quantifierExpr struct {
+	op   string // Name of the quantifier
+	attr Expr   // Quantified value
+}
+
+/*
+Any quantifies the left operand of a comparison - the comparison is true if
+it is true for any item of the list value.
+*/
+func Any(attr interface{}) Expr {
+	return &quantifierExpr{"any", operand(attr)}
+}
+
+/*
+All quantifies the left operand of a comparison - the comparison is true if
+it is true for all items of the list value.
+*/
+func All(attr interface{}) Expr {
+	return &quantifierExpr{"all", operand(attr)}
+}
+
+/*
+render returns the text of this expression in a given clause.
+*/
+func (e *quantifierExpr) render(clause int) string {
+	return fmt.Sprintf("%v(%v)", e.op, e.attr.render(clause))
+}
+
+/*
+funcExpr is a function call.
+*/
+type funcExpr struct {
+	name string   // Name of the function
+	args []string // Arguments of the function
+}
+
+/*
+Func returns a function call (e.g. Func("count", "1:e::Order")). Functions
+interpret their arguments themselves - they are passed as they are.
+*/
+func Func(name string, args ...string) Expr {
+	return &funcExpr{name, args}
+}
+
+/*
+render returns the text of this expression in a given clause.
+*/
+func (e *funcExpr) render(clause int) string {
+	args := make([]string, len(e.args))
+
+	for i, arg := range e.args {
+		args[i] = quote(arg)
+	}
+
+	return fmt.Sprintf("@%v(%v)", quote(e.name), strings.Join(args, ", "))
+}
+
+// Conditions and arithmetic expressions
+// =====================================
+
+/*
+opExpr is an operation on one or more expressions.
+*/
+type opExpr struct {
+	op       string // Operator
+	operands []Expr // Operands of the operation
+}
+
+/*
+render returns the text of this expression in a given clause.
+*/
+func (e *opExpr) render(clause int) string {
+	operands := make([]string, len(e.operands))
+
+	for i, o := range e.operands {
+		operands[i] = o.render(clause)
+	}
+
+	if len(operands) == 1 {
+		return fmt.Sprintf("(%v %v)", e.op, operands[0])
+	}
+
+	return "(" + strings.Join(operands, " "+e.op+" ") + ")"
+}
+
+/*
+comparison returns a comparison. The left operand is an attribute if it is a
+string - the right operand is a literal if it is not an expression.
+*/
+func comparison(op string, left interface{}, right interface{}) Expr {
+	return &opExpr{op, []Expr{operand(left), value(right)}}
+}
+
+/*
+Eq checks if two values are equal (e.g. Eq("name", "Alice")).
+*/
+func Eq(left interface{}, right interface{}) Expr {
+	return comparison("=", left, right)
+}
+
+/*
+Neq checks if two values are not equal.
+*/
+func Neq(left interface{}, right interface{}) Expr {
+	return comparison("!=", left, right)
+}
+
+/*
+Lt checks if the left value is smaller than the right value.
+*/
+func Lt(left interface{}, right interface{}) Expr {
+	return comparison("<", left, right)
+}
+
+/*
+Leq checks if the left value is smaller than or equal to the right value.
+*/
+func Leq(left interface{}, right interface{}) Expr {
+	return comparison("<=", left, right)
+}
+
+/*
+Gt checks if the left value is greater than the right value.
+*/
+func Gt(left interface{}, right interface{}) Expr {
+	return comparison(">", left, right)
+}
+
+/*
+Geq checks if the left value is greater than or equal to the right value.
+*/
+func Geq(left interface{}, right interface{}) Expr {
+	return comparison(">=", left, right)
+}
+
+/*
+Like checks if the left value matches a glob pattern.
+*/
+func Like(left interface{}, pattern interface{}) Expr {
+	return comparison("like", left, pattern)
+}
+
+/*
+ILike checks if the left value matches a glob pattern ignoring case.
+*/
+func ILike(left interface{}, pattern interface{}) Expr {
+	return comparison("ilike", left, pattern)
+}
+
+/*
+Matches checks if the left value contains a match of a regular expression.
+*/
+func Matches(left interface{}, pattern interface{}) Expr {
+	return comparison("matches", left, pattern)
+}
+
+/*
+IMatches checks if the left value contains a match of a regular expression
+ignoring case.
+*/
+func IMatches(left interface{}, pattern interface{}) Expr {
+	return comparison("imatches", left, pattern)
+}
+
+/*
+Contains checks if the left value contains the right value.
+*/
+func Contains(left interface{}, right interface{}) Expr {
+	return comparison("contains", left, right)
+}
+
+/*
+ContainsNot checks if the left value does not contain the right value.
+*/
+func ContainsNot(left interface{}, right interface{}) Expr {
+	return comparison("containsnot", left, right)
+}
+
+/*
+BeginsWith checks if the left value begins with the right value.
+*/
+func BeginsWith(left interface{}, right interface{}) Expr {
+	return comparison("beginswith", left, right)
+}
+
+/*
+EndsWith checks if the left value ends with the right value.
+*/
+func EndsWith(left interface{}, right interface{}) Expr {
+	return comparison("endswith", left, right)
+}
+
+/*
+In checks if the left value is equal to one of the given values.
+*/
+func In(left interface{}, values ...interface{}) Expr {
+	return &opExpr{"in", []Expr{operand(left), Val(values)}}
+}
+
+/*
+NotIn checks if the left value is not equal to any of the given values.
+*/
+func NotIn(left interface{}, values ...interface{}) Expr {
+	return &opExpr{"notin", []Expr{operand(left), Val(values)}}
+}
+
+/*
+InList checks if the left value is an item of the right value (e.g.
+InList("urgent", "tags") checks if the list attribute tags contains urgent).
+The left operand is a literal and the right operand is an attribute if they
+are strings.
+*/
+func InList(left interface{}, right interface{}) Expr {
+	return &opExpr{"in", []Expr{value(left), operand(right)}}
+}
+
+/*
+subqueryExpr is a subquery.
+*/
+type subqueryExpr struct {
+	query *Query // Subquery
+}
+
+/*
+render returns the text of this expression in a given clause.
+*/
+func (e *subqueryExpr) render(clause int) string {
+	return "(" + e.query.String() + ")"
+}
+
+/*
+InQuery checks if the left value is equal to a value of the only column of a
+subquery.
+*/
+func InQuery(left interface{}, query *Query) Expr {
+	return &opExpr{"in", []Expr{operand(left), &subqueryExpr{query}}}
+}
+
+/*
+NotInQuery checks if the left value is not equal to any value of the only
+column of a subquery.
+*/
+func NotInQuery(left interface{}, query *Query) Expr {
+	return &opExpr{"notin", []Expr{operand(left), &subqueryExpr{query}}}
+}
+
+/*
+Has checks if an attribute is set.
+*/
+func Has(attr interface{}) Expr {
+	return &opExpr{"has", []Expr{operand(attr)}}
+}
+
+/*
+And checks if all given conditions are true.
+*/
+func And(conds ...Expr) Expr {
+	return logical("and", conds)
+}
+
+/*
+Or checks if one of the given conditions is true.
+*/
+func Or(conds ...Expr) Expr {
+	return logical("or", conds)
+}
+
+/*
+logical combines several conditions. No conditions are always true.
+*/
+func logical(op string, conds []Expr) Expr {
+	if len(conds) == 0 {
+		return Val(true)
+	} else if len(conds) == 1 {
+		return conds[0]
+	}
+	return &opExpr{op, conds}
+}
+
+/*
+Not negates a condition.
+*/
+func Not(cond Expr) Expr {
+	return &opExpr{"not", []Expr{cond}}
+}
+
+/*
+arithmetic returns an arithmetic expression. Operands which are strings are
+attributes.
+*/
+func arithmetic(op string, left interface{}, right interface{}) Expr {
+	return &opExpr{op, []Expr{operand(left), operand(right)}}
+}
+
+/*
+Add adds two values (e.g. Add("price", 1)).
+*/
+func Add(left interface{}, right interface{}) Expr {
+	return arithmetic("+", left, right)
+}
+
+/*
+Sub subtracts the right value from the left value.
+*/
+func Sub(left interface{}, right interface{}) Expr {
+	return arithmetic("-", left, right)
+}
+
+/*
+Mul multiplies two values.
+*/
+func Mul(left interface{}, right interface{}) Expr {
+	return arithmetic("*", left, right)
+}
+
+/*
+Div divides the left value by the right value.
+*/
+func Div(left interface{}, right interface{}) Expr {
+	return arithmetic("/", left, right)
+}
+
+/*
+DivInt divides the left value by the right value and returns the integer
+part of the result.
+*/
+func DivInt(left interface{}, right interface{}) Expr {
+	return arithmetic("//", left, right)
+}
+
+/*
+Mod returns the remainder of the integer division of the left value by the
+right value.
+*/
+func Mod(left interface{}, right interface{}) Expr {
+	return arithmetic("%", left, right)
+}
+
+/*
+Neg negates a value.
+*/
+func Neg(val interface{}) Expr {
+	return &opExpr{"-", []Expr{operand(val)}}
+}
+
+// Helper functions
+// ================
+
+/*
+operand converts a value into an expression. Strings are attributes.
+*/
+func operand(v interface{}) Expr {
+	if e, ok := v.(Expr); ok {
+		return e
+	} else if s, ok := v.(string); ok {
+		return Attr(s)
+	}
+	return Val(v)
+}
+
+/*
+value converts a value into an expression. Strings are literals.
+*/
+func value(v interface{}) Expr {
+	if e, ok := v.(Expr); ok {
+		return e
+	}
+	return Val(v)
+}
+
+/*
+quote returns a quoted value of a query. Quotes, backslashes and control
+characters are written as escape sequences so the value cannot end the quoted
+text.
+*/
+func quote(s string) string {
+	q := strconv.Quote(s)
+	return "'" + strings.Replace(q[1:len(q)-1], "'", `\x27`, -1) + "'"
+}
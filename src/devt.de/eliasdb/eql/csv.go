@@ -0,0 +1,120 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package eql
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+/*
+CSVOptions controls how a search result is written as CSV.
+*/
+type CSVOptions struct {
+	Delimiter  rune // Field delimiter (a comma if not set - use '\t' for TSV)
+	OmitHeader bool // Flag if the header row with the column labels is omitted
+	RawValues  bool // Flag if values are written as JSON instead of display strings
+	UseCRLF    bool // Flag if rows end with \r\n instead of \n
+}
+
+/*
+NewCSVStream returns a ResultStream which writes all rows of a result as CSV
+to a given writer. Each row is written as soon as it is received. Values
+which contain the delimiter, quotes or line breaks are quoted as described
+in RFC 4180. Display strings of missing values are empty.
+*/
+func NewCSVStream(w io.Writer, opts CSVOptions) ResultStream {
+	cw := csv.NewWriter(w)
+
+	if opts.Delimiter != 0 {
+		cw.Comma = opts.Delimiter
+	}
+
+	cw.UseCRLF = opts.UseCRLF
+
+	return &csvStream{cw, opts}
+}
+
+/*
+csvStream writes the rows of a result as CSV.
+*/
+type csvStream struct {
+	cw   *csv.Writer // CSV writer
+	opts CSVOptions  // CSV options
+}
+
+/*
+Start is called once before any row is streamed. Writes the header row.
+*/
+func (cs *csvStream) Start(header SearchResultHeader, incremental bool) error {
+	if cs.opts.OmitHeader {
+		return nil
+	}
+
+	return cs.write(header.Labels())
+}
+
+/*
+Row writes a single row of the result.
+*/
+func (cs *csvStream) Row(row []interface{}, source []string) error {
+	record := make([]string, len(row))
+
+	for i, val := range row {
+
+		if cs.opts.RawValues {
+			raw, err := json.Marshal(val)
+			if err != nil {
+				return err
+			}
+			record[i] = string(raw)
+
+		} else if val != nil {
+			record[i] = fmt.Sprint(val)
+		}
+	}
+
+	return cs.write(record)
+}
+
+/*
+write writes a record and flushes it to the underlying writer.
+*/
+func (cs *csvStream) write(record []string) error {
+	if err := cs.cw.Write(record); err != nil {
+		return err
+	}
+
+	cs.cw.Flush()
+
+	return cs.cw.Error()
+}
+
+/*
+WriteCSV writes the result row by row as CSV to a given writer.
+*/
+func (qr *queryResult) WriteCSV(w io.Writer, opts CSVOptions) error {
+	cs := NewCSVStream(w, opts)
+
+	if err := cs.Start(qr.Header(), true); err != nil {
+		return err
+	}
+
+	for i, row := range qr.Rows() {
+		if err := cs.Row(row, qr.RowSource(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
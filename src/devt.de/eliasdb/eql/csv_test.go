@@ -0,0 +1,109 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package eql
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+func TestCSV(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := graph.NewGraphManager(mgs)
+
+	for key, text := range map[string]interface{}{"1": "plain", "2": "a,b", "3": `say "hi"`,
+		"4": "two\nlines", "5": "tab\there", "6": nil, "7": 1.5} {
+
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "Note")
+		node.SetAttr("text", text)
+		gm.StoreNode("main", node)
+	}
+
+	res, err := Run(context.Background(), "test", "main", "get Note show key, text as 'The, text'", gm, RunOptions{Sorted: true})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Values are quoted if necessary
+
+	var buf bytes.Buffer
+
+	if err := res.WriteCSV(&buf, CSVOptions{}); err != nil || buf.String() != `
+Note Key,"The, text"
+1,plain
+2,"a,b"
+3,"say ""hi"""
+4,"two
+lines"
+5,tab	here
+6,
+7,1.5
+`[1:] {
+		t.Error("Unexpected result:", buf.String(), err)
+		return
+	}
+
+	// TSV without header
+
+	buf.Reset()
+
+	if err := res.WriteCSV(&buf, CSVOptions{Delimiter: '\t', OmitHeader: true, UseCRLF: true}); err != nil || buf.String() !=
+		"1\tplain\r\n2\ta,b\r\n3\t\"say \"\"hi\"\"\"\r\n4\t\"two\r\nlines\"\r\n5\t\"tab\there\"\r\n6\t\r\n7\t1.5\r\n" {
+		t.Errorf("Unexpected result: %q %v", buf.String(), err)
+		return
+	}
+
+	// Raw values are written as JSON
+
+	buf.Reset()
+
+	if err := res.WriteCSV(&buf, CSVOptions{RawValues: true, OmitHeader: true}); err != nil || buf.String() != `
+"""1""","""plain"""
+"""2""","""a,b"""
+"""3""","""say \""hi\"""""
+"""4""","""two\nlines"""
+"""5""","""tab\there"""
+"""6""",null
+"""7""",1.5
+`[1:] {
+		t.Error("Unexpected result:", buf.String(), err)
+		return
+	}
+
+	// Rows can be streamed while the query runs
+
+	buf.Reset()
+
+	if _, err := Stream(context.Background(), "test", "main", "get Note where key < 3 show text", gm,
+		NewCSVStream(&buf, CSVOptions{}), RunOptions{Sorted: true}); err != nil || buf.String() != `
+Text
+plain
+"a,b"
+`[1:] {
+		t.Error("Unexpected result:", buf.String(), err)
+		return
+	}
+
+	// Invalid delimiters are reported
+
+	if err := res.WriteCSV(&buf, CSVOptions{Delimiter: '"'}); err == nil || err.Error() != "csv: invalid field or comment delimiter" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
@@ -0,0 +1,138 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package eql
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"devt.de/eliasdb/eql/interpreter"
+)
+
+/*
+CursorTTL is the time a cursor stays valid after it was created. A value of 0
+means that cursors never expire.
+*/
+var CursorTTL = time.Hour
+
+/*
+CursorSecret is the key which is used to sign cursors. The default is a random
+key - cursors are then only valid for the running process. Set a fixed key to
+accept cursors which were created by other processes.
+*/
+var CursorSecret = randomCursorSecret()
+
+/*
+randomCursorSecret creates a random key for signing cursors.
+*/
+func randomCursorSecret() []byte {
+	secret := make([]byte, 32)
+
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+
+	return secret
+}
+
+/*
+cursorPosition is the position of the last row of a result which is encoded
+in a cursor.
+*/
+type cursorPosition struct {
+	Query   string `json:"q"` // Hash of the partition and the query text
+	Key     string `json:"k"` // Start key of the last row
+	Rows    int    `json:"n"` // Number of rows of the start key up to the last row
+	Expires int64  `json:"e"` // Expiry time as unix timestamp (0 if the cursor does not expire)
+}
+
+/*
+newCursor creates a signed cursor for a given query and position.
+*/
+func newCursor(part string, query string, key string, rows int) string {
+	pos := &cursorPosition{queryHash(part, query), key, rows, 0}
+
+	if CursorTTL != 0 {
+		pos.Expires = time.Now().Add(CursorTTL).Unix()
+	}
+
+	payload, _ := json.Marshal(pos)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(signCursor(payload))
+}
+
+/*
+parseCursor verifies a cursor for a given query and returns the encoded
+position.
+*/
+func parseCursor(name string, part string, query string, cursor string) (*cursorPosition, error) {
+	var pos cursorPosition
+
+	newCursorError := func(detail string) error {
+		return &interpreter.RuntimeError{
+			Source: name,
+			Type:   interpreter.ErrInvalidCursor,
+			Detail: detail,
+			Node:   nil,
+			Line:   0,
+			Pos:    0,
+		}
+	}
+
+	scursor := strings.Split(cursor, ".")
+	if len(scursor) != 2 {
+		return nil, newCursorError("Malformed cursor")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(scursor[0])
+	if err != nil {
+		return nil, newCursorError("Malformed cursor")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(scursor[1])
+	if err != nil || !hmac.Equal(signature, signCursor(payload)) {
+		return nil, newCursorError("Invalid cursor signature")
+	}
+
+	if err := json.Unmarshal(payload, &pos); err != nil || pos.Key == "" || pos.Rows < 1 {
+		return nil, newCursorError("Malformed cursor")
+	} else if pos.Query != queryHash(part, query) {
+		return nil, newCursorError("Cursor was created for a different query")
+	} else if pos.Expires != 0 && time.Now().Unix() > pos.Expires {
+		return nil, newCursorError("Cursor has expired")
+	}
+
+	return &pos, nil
+}
+
+/*
+signCursor calculates the signature of a cursor payload.
+*/
+func signCursor(payload []byte) []byte {
+	mac := hmac.New(sha256.New, CursorSecret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+/*
+queryHash calculates the hash of a partition and a query text.
+*/
+func queryHash(part string, query string) string {
+	hash := sha256.Sum256([]byte(part + "\x00" + query))
+	return hex.EncodeToString(hash[:])
+}
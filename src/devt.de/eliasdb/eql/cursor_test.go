@@ -0,0 +1,184 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package eql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	gm, _ := songGraph()
+
+	ctx := context.Background()
+
+	// Collect all pages of a query by following the cursors
+
+	pages := func(query string, first string) ([]string, error) {
+		var pages []string
+
+		cursor := first
+
+		for {
+			res, err := Run(ctx, "test", "main", query, gm, RunOptions{Sorted: true, Cursor: cursor})
+			if err != nil {
+				return pages, err
+			}
+
+			pages = append(pages, fmt.Sprint(res.Rows()))
+
+			if cursor = res.Cursor(); cursor == "" {
+				if res.HasMore() {
+					return pages, errors.New("Missing cursor")
+				}
+				return pages, nil
+			}
+		}
+	}
+
+	query := "get Author traverse :::Song end show key, Song:key"
+
+	all, err := Run(ctx, "test", "main", query, gm, RunOptions{Sorted: true})
+	if err != nil || all.Cursor() != "" {
+		t.Error("Unexpected result:", all.Cursor(), err)
+		return
+	}
+
+	// Pages end in the middle of the rows of a start node
+
+	for _, limit := range []int{1, 2, 3, 4, 100} {
+		res, err := pages(fmt.Sprintf("%v limit %v", query, limit), "")
+
+		if err != nil || strings.Replace(strings.Join(res, ""), "][", " ", -1) != fmt.Sprint(all.Rows()) {
+			t.Error("Unexpected result:", limit, res, err)
+			return
+		}
+	}
+
+	// The cursor of a sorted query can be used to continue - the offset
+	// only applies to the first result
+
+	first, err := Run(ctx, "test", "main", query+" limit 3 offset 2", gm, RunOptions{Sorted: true})
+	if err != nil || first.Cursor() == "" {
+		t.Error("Unexpected result:", first, err)
+		return
+	}
+
+	res, err := pages(query+" limit 3 offset 2", first.Cursor())
+	res = append([]string{fmt.Sprint(first.Rows())}, res...)
+
+	if err != nil || strings.Replace(strings.Join(res, ""), "][", " ", -1) != fmt.Sprint(all.Rows()[2:]) {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Filtered start nodes and index lookups can be resumed
+
+	for _, query := range []string{
+		"get Song where ranking > 1 show key limit 2",
+		"get Song where name like 'Aria*' show key limit 1",
+	} {
+		all, _ := Run(ctx, "test", "main", strings.Split(query, " limit")[0], gm, RunOptions{Sorted: true})
+
+		res, err := pages(query, "")
+		if err != nil || strings.Replace(strings.Join(res, ""), "][", " ", -1) != fmt.Sprint(all.Rows()) {
+			t.Error("Unexpected result:", query, res, err)
+			return
+		}
+	}
+
+	// Unsorted and unlimited results have no cursor
+
+	if res, err := RunQuery("test", "main", query+" limit 2", gm); err != nil || !res.HasMore() || res.Cursor() != "" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Queries which need to see all rows cannot be resumed
+
+	cursor := first.Cursor()
+
+	for _, q := range []string{
+		query + " limit 3 offset 2 with ordering(ascending key)",
+		query + " limit 3 offset 2 with distinct",
+		query + " limit 3 offset 2 with filtering(isnotnull Song:key)",
+		"get Song show name, @count() limit 1",
+	} {
+		if res, err := Run(ctx, "test", "main", q, gm, RunOptions{Sorted: true}); err != nil || !res.HasMore() || res.Cursor() != "" {
+			t.Error("Unexpected result:", q, res, err)
+			return
+		}
+	}
+
+	if _, err := Run(ctx, "test", "main", "get Author limit 1 with ordering(ascending key)", gm, RunOptions{
+		Cursor: newCursor("main", "get Author limit 1 with ordering(ascending key)", "000", 1)}); err == nil ||
+		err.Error() != "EQL error in test: Invalid cursor (Query cannot be resumed from a cursor: results with an ordering are not supported) (Line:1 Pos:1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := Run(ctx, "test", "main", "lookup Author '000'", gm, RunOptions{Cursor: cursor}); err == nil ||
+		err.Error() != "EQL error in test: Invalid cursor (Cursors are only supported for get queries) (Line:1 Pos:1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Cursors are only valid for the query they were created for
+
+	if _, err := Run(ctx, "test", "main", query+" limit 4 offset 2", gm, RunOptions{Cursor: cursor}); err == nil ||
+		err.Error() != "EQL error in test: Invalid cursor (Cursor was created for a different query)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := Run(ctx, "test", "other", query+" limit 3 offset 2", gm, RunOptions{Cursor: cursor}); err == nil ||
+		err.Error() != "EQL error in test: Invalid cursor (Cursor was created for a different query)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Modified cursors are rejected
+
+	for _, c := range []string{"foo", "foo.bar", "#." + strings.Split(cursor, ".")[1],
+		"e30." + strings.Split(cursor, ".")[1], strings.Split(cursor, ".")[0] + ".e30"} {
+
+		if _, err := Run(ctx, "test", "main", query+" limit 3 offset 2", gm, RunOptions{Cursor: c}); err == nil ||
+			!errors.Is(err, ErrInvalidCursor) {
+			t.Error("Unexpected result:", c, err)
+			return
+		}
+	}
+
+	// Cursors expire
+
+	defer func(ttl time.Duration) {
+		CursorTTL = ttl
+	}(CursorTTL)
+
+	CursorTTL = -time.Second
+
+	if _, err := Run(ctx, "test", "main", query+" limit 1", gm, RunOptions{Cursor: newCursor("main", query+" limit 1", "000", 1)}); err == nil ||
+		err.Error() != "EQL error in test: Invalid cursor (Cursor has expired)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	CursorTTL = 0
+
+	if _, err := Run(ctx, "test", "main", query+" limit 1", gm, RunOptions{Cursor: newCursor("main", query+" limit 1", "000", 1)}); err != nil {
+		t.Error(err)
+		return
+	}
+}
@@ -0,0 +1,291 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package eql
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"devt.de/eliasdb/graph/data"
+)
+
+/*
+DecodeTag is the struct tag which maps struct fields to the columns of a
+search result. The tag has the form:
+
+	`eql:"<column>"`
+
+A column is matched by its label (e.g. the alias given with AS), by its data
+identifier (e.g. 2:n:name) or by its attribute (e.g. name) - in this order.
+If a tag matches several columns then the first column is used. Fields
+without tag are matched by their field name against labels and attributes
+ignoring case. Fields with the name "-" are ignored. Fields of embedded
+structs are matched like fields of the struct itself.
+*/
+const DecodeTag = "eql"
+
+/*
+FieldError is the error of a single value of a result which could not be
+converted to the type of its struct field.
+*/
+type FieldError struct {
+	Row    int    // Row of the value
+	Column string // Data identifier of the column of the value
+	Field  string // Name of the struct field
+	Err    error  // Conversion error
+}
+
+/*
+Error returns a human-readable string representation of this error.
+*/
+func (fe *FieldError) Error() string {
+	return fmt.Sprintf("Row %v column %v (field %v): %v", fe.Row, fe.Column, fe.Field, fe.Err)
+}
+
+/*
+Unwrap returns the conversion error of this error.
+*/
+func (fe *FieldError) Unwrap() error {
+	return fe.Err
+}
+
+/*
+DecodeError is returned if values of a result could not be decoded. It
+contains the errors of all values which could not be converted - all other
+values are decoded.
+*/
+type DecodeError struct {
+	Fields []*FieldError // Errors of all values which could not be converted
+}
+
+/*
+Error returns a human-readable string representation of this error.
+*/
+func (de *DecodeError) Error() string {
+	errs := make([]string, len(de.Fields))
+
+	for i, fe := range de.Fields {
+		errs[i] = fe.Error()
+	}
+
+	return fmt.Sprintf("Could not decode %v values: %v", len(de.Fields), strings.Join(errs, "; "))
+}
+
+/*
+Decode writes all rows of the result into a given pointer to a slice. The
+elements of the slice can be structs, pointers to structs or maps of type
+map[string]interface{}. Columns are mapped to struct fields with struct tags
+(see DecodeTag) and their values are converted to the type of the field in
+the same way as by the typed attribute accessors of nodes. Maps contain the
+values of all columns keyed by their label. The slice is replaced with a
+slice which has an element for every row.
+*/
+func (qr *queryResult) Decode(dest interface{}) error {
+
+	rv := reflect.ValueOf(dest)
+
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("Value of type %T is not a pointer to a slice", dest)
+	}
+
+	sv := rv.Elem()
+	et := sv.Type().Elem()
+	isPtr := et.Kind() == reflect.Ptr
+
+	if isPtr {
+		et = et.Elem()
+	}
+
+	d, err := qr.newDecoder(et)
+	if err != nil {
+		return fmt.Errorf("Value of type %T cannot be decoded: %v", dest, err)
+	}
+
+	rows := qr.Rows()
+	res := reflect.MakeSlice(sv.Type(), len(rows), len(rows))
+
+	for i, row := range rows {
+		ev := res.Index(i)
+
+		if isPtr {
+			ev.Set(reflect.New(et))
+			ev = ev.Elem()
+		}
+
+		d.decode(i, row, ev)
+	}
+
+	sv.Set(res)
+
+	return d.err()
+}
+
+/*
+DecodeRow writes a row of the result into a given pointer to a struct or to
+a map of type map[string]interface{} (see Decode). Fields of columns without
+value are not changed.
+*/
+func (qr *queryResult) DecodeRow(line int, dest interface{}) error {
+
+	rv := reflect.ValueOf(dest)
+
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("Value of type %T is not a pointer", dest)
+	}
+
+	d, err := qr.newDecoder(rv.Elem().Type())
+	if err != nil {
+		return fmt.Errorf("Value of type %T cannot be decoded: %v", dest, err)
+	}
+
+	d.decode(line, qr.Row(line), rv.Elem())
+
+	return d.err()
+}
+
+/*
+mapType is the reflection type of maps which can hold a row.
+*/
+var mapType = reflect.TypeOf(map[string]interface{}{})
+
+/*
+decoder writes rows of a result into structs or maps.
+*/
+type decoder struct {
+	labels []string      // Labels of all columns
+	data   []string      // Data identifiers of all columns
+	fields []decodeField // Struct fields which are mapped to columns (nil for maps)
+	errors []*FieldError // Errors of values which could not be converted
+}
+
+/*
+decodeField is a struct field which is mapped to a column.
+*/
+type decodeField struct {
+	index []int  // Index sequence of the field
+	name  string // Name of the field
+	col   int    // Column of the field
+}
+
+/*
+newDecoder creates a decoder for a given struct or map type.
+*/
+func (qr *queryResult) newDecoder(t reflect.Type) (*decoder, error) {
+
+	header := qr.Header()
+
+	d := &decoder{header.Labels(), header.Data(), nil, nil}
+
+	if t == mapType {
+		return d, nil
+	} else if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%v is not a struct or map[string]interface{}", t)
+	}
+
+	d.mapFields(t, nil)
+
+	return d, nil
+}
+
+/*
+mapFields maps all fields of a given struct type to columns.
+*/
+func (d *decoder) mapFields(t reflect.Type, index []int) {
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fIndex := append(append([]int(nil), index...), i)
+		tag := f.Tag.Get(DecodeTag)
+
+		if tag == "" && f.Anonymous && f.Type.Kind() == reflect.Struct {
+			d.mapFields(f.Type, fIndex)
+			continue
+		} else if f.PkgPath != "" || tag == "-" {
+			continue // Unexported or ignored field
+		}
+
+		if col := d.column(tag, f.Name); col != -1 {
+			d.fields = append(d.fields, decodeField{fIndex, f.Name, col})
+		}
+	}
+}
+
+/*
+column returns the column for a given struct tag or field name. Returns -1 if
+no column matches.
+*/
+func (d *decoder) column(tag string, name string) int {
+
+	attr := func(col int) string {
+		spec := strings.SplitN(d.data[col], ":", 3)
+		return spec[len(spec)-1]
+	}
+
+	if tag != "" {
+		for _, match := range []func(int) bool{
+			func(col int) bool { return d.labels[col] == tag },
+			func(col int) bool { return d.data[col] == tag },
+			func(col int) bool { return attr(col) == tag },
+		} {
+			for col := range d.data {
+				if match(col) {
+					return col
+				}
+			}
+		}
+
+		return -1
+	}
+
+	for col := range d.data {
+		if strings.EqualFold(d.labels[col], name) || strings.EqualFold(attr(col), name) {
+			return col
+		}
+	}
+
+	return -1
+}
+
+/*
+decode writes a given row into a given struct or map value.
+*/
+func (d *decoder) decode(line int, row []interface{}, v reflect.Value) {
+
+	if v.Type() == mapType {
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(mapType))
+		}
+
+		for col, val := range row {
+			v.SetMapIndex(reflect.ValueOf(d.labels[col]), reflect.ValueOf(&val).Elem())
+		}
+
+		return
+	}
+
+	for _, f := range d.fields {
+		if err := data.AssignValue(v.FieldByIndex(f.index), row[f.col]); err != nil {
+			d.errors = append(d.errors, &FieldError{line, d.data[f.col], f.name, err})
+		}
+	}
+}
+
+/*
+err returns the errors of all values which could not be converted.
+*/
+func (d *decoder) err() error {
+	if len(d.errors) == 0 {
+		return nil
+	}
+
+	return &DecodeError{d.errors}
+}
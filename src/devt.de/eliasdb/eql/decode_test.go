@@ -0,0 +1,144 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package eql
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+type decodeBase struct {
+	Key string `eql:"1:n:key"`
+}
+
+type decodeSong struct {
+	decodeBase
+	Title   string `eql:"Song Title"`
+	Ranking int
+	Rating  *float64 `eql:"rating"`
+	Ignored string   `eql:"-"`
+}
+
+func TestDecode(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := graph.NewGraphManager(mgs)
+
+	for i, ranking := range []interface{}{"3", 1.0, "high"} {
+		node := data.NewGraphNode()
+		node.SetAttr("key", fmt.Sprint(i+1))
+		node.SetAttr("kind", "Song")
+		node.SetAttr("name", fmt.Sprint("Song", i+1))
+		node.SetAttr("ranking", ranking)
+		if i != 1 {
+			node.SetAttr("rating", 0.5*float64(i+1))
+		}
+		gm.StoreNode("main", node)
+	}
+
+	res, err := Run(context.Background(), "test", "main",
+		"get Song show key, name as 'Song Title', ranking, rating", gm, RunOptions{Sorted: true})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Values are converted to the types of the fields and conversion errors
+	// are collected
+
+	var songs []decodeSong
+
+	err = res.Decode(&songs)
+
+	if len(songs) != 3 {
+		t.Error("Unexpected result:", songs)
+		return
+	}
+
+	if songs[0].Key != "1" || songs[0].Title != "Song1" || songs[0].Ranking != 3 || *songs[0].Rating != 0.5 ||
+		songs[1].Key != "2" || songs[1].Ranking != 1 || songs[1].Rating != nil ||
+		songs[2].Title != "Song3" || songs[2].Ranking != 0 || *songs[2].Rating != 1.5 {
+		t.Error("Unexpected result:", songs)
+		return
+	}
+
+	if err == nil || err.Error() != `Could not decode 1 values: Row 2 column 1:n:ranking (field Ranking): `+
+		`Value high is not an integer` {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if de := err.(*DecodeError); de.Fields[0].Row != 2 || de.Fields[0].Unwrap() == nil {
+		t.Error("Unexpected result:", de.Fields[0])
+		return
+	}
+
+	// Pointers to structs and maps are supported
+
+	var psongs []*decodeSong
+
+	if err := res.Decode(&psongs); err == nil || len(psongs) != 3 || psongs[1].Title != "Song2" {
+		t.Error("Unexpected result:", psongs, err)
+		return
+	}
+
+	var rows []map[string]interface{}
+
+	if err := res.Decode(&rows); err != nil || len(rows) != 3 ||
+		fmt.Sprint(rows[2]) != "map[Ranking:high Rating:1.5 Song Key:3 Song Title:Song3]" {
+		t.Error("Unexpected result:", rows, err)
+		return
+	}
+
+	// Single rows can be decoded - fields of columns without value are
+	// not changed
+
+	song := decodeSong{Ignored: "x"}
+	song.Rating = new(float64)
+
+	if err := res.DecodeRow(1, &song); err != nil || song.Key != "2" || song.Ranking != 1 ||
+		song.Rating == nil || song.Ignored != "x" {
+		t.Error("Unexpected result:", song, err)
+		return
+	}
+
+	row := map[string]interface{}{"foo": "bar"}
+
+	if err := res.DecodeRow(0, &row); err != nil || fmt.Sprint(row) !=
+		"map[Ranking:3 Rating:0.5 Song Key:1 Song Title:Song1 foo:bar]" {
+		t.Error("Unexpected result:", row, err)
+		return
+	}
+
+	// Invalid destinations are reported
+
+	if err := res.Decode(songs); err == nil || err.Error() != "Value of type []eql.decodeSong is not a pointer to a slice" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	var ints []int
+
+	if err := res.Decode(&ints); err == nil || err.Error() !=
+		"Value of type *[]int cannot be decoded: int is not a struct or map[string]interface{}" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := res.DecodeRow(0, song); err == nil || err.Error() != "Value of type eql.decodeSong is not a pointer" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
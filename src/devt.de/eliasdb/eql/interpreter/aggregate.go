@@ -0,0 +1,456 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"devt.de/eliasdb/eql/parser"
+	"devt.de/eliasdb/graph/data"
+)
+
+// Aggregation functions
+// =====================
+
+/*
+showAggregateInst creates a new showAggregate object. Aggregation functions
+take the aggregated attribute as parameter - count takes no parameter and
+percentile takes the percentile (0-100) as second parameter. The attribute
+can be given in the same way as a show column (e.g. name, Song:name or 2:n:name).
+*/
+func showAggregateInst(astNode *parser.ASTNode, rtp *eqlRuntimeProvider) (FuncShow, string, string, error) {
+	fname := astNode.Children[0].Token.Val
+
+	params := make([]string, 0, len(astNode.Children)-1)
+	for _, c := range astNode.Children[1:] {
+		params = append(params, c.Token.Val)
+	}
+
+	label := fmt.Sprintf("@%v(%v)", fname, strings.Join(params, ", "))
+
+	if fname == "count" {
+
+		// Count all rows - the first traversal step is always present
+
+		return &showAggregate{fname, true, data.NodeKey, true, 0}, "1:n:" + data.NodeKey, label, nil
+
+	} else if fname == "percentile" {
+
+		if len(params) != 2 {
+			return nil, "", "", errors.New("Percentile function requires 2 parameters: attribute, percentile")
+		}
+
+		p, err := strconv.ParseFloat(params[1], 64)
+		if err != nil || p < 0 || p > 100 {
+			return nil, "", "", fmt.Errorf("Percentile must be a number between 0 and 100: %v", params[1])
+		}
+
+		return &showAggregate{fname, false, "", true, p / 100}, params[0], label, nil
+
+	} else if len(params) != 1 {
+		return nil, "", "", fmt.Errorf("%v%v function requires 1 parameter: attribute",
+			strings.ToUpper(fname[:1]), fname[1:])
+	}
+
+	return &showAggregate{fname, false, "", true, 0.5}, params[0], label, nil
+}
+
+/*
+showAggregate is an aggregation function which combines the values of a
+column over all rows of a result. The function itself only extracts the
+value of each row - the values are combined by the search result.
+*/
+type showAggregate struct {
+	fname  string  // Name of the aggregation function
+	rows   bool    // Flag if rows should be counted instead of attribute values
+	attr   string  // Aggregated attribute
+	isNode bool    // Flag if the attribute is a node attribute
+	q      float64 // Quantile of the percentile and median functions
+}
+
+/*
+name returns the name of the function.
+*/
+func (sa *showAggregate) name() string {
+	return sa.fname
+}
+
+/*
+setAttr sets the aggregated attribute.
+*/
+func (sa *showAggregate) setAttr(attr string, isNode bool) {
+	sa.attr = attr
+	sa.isNode = isNode
+}
+
+/*
+eval returns the value which should be aggregated for a row.
+*/
+func (sa *showAggregate) eval(node data.Node, edge data.Edge) (interface{}, string, error) {
+
+	if sa.rows {
+		return true, "", nil
+	} else if sa.isNode && node != nil {
+		return node.Attr(sa.attr), "", nil
+	} else if !sa.isNode && edge != nil {
+		return edge.Attr(sa.attr), "", nil
+	}
+
+	return nil, "", nil
+}
+
+/*
+newAggregation creates a new aggregation state for this function.
+*/
+func (sa *showAggregate) newAggregation() aggregation {
+	switch sa.fname {
+	case "sum":
+		return &aggregationSum{}
+	case "avg":
+		return &aggregationAvg{}
+	case "min":
+		return &aggregationMinMax{nil, true}
+	case "max":
+		return &aggregationMinMax{nil, false}
+	case "percentile", "median":
+		return &aggregationPercentile{newQuantileDigest(), sa.q, 0}
+	case "stddev":
+		return &aggregationStddev{}
+	}
+	return &aggregationCount{}
+}
+
+/*
+aggregation is the state of an aggregation function for a group of rows.
+Null values are always skipped.
+*/
+type aggregation interface {
+
+	/*
+	   add adds a row value to the aggregation.
+	*/
+	add(val interface{}) error
+
+	/*
+	   result returns the result of the aggregation.
+	*/
+	result() interface{}
+}
+
+/*
+skippingAggregation is an aggregation which skips values it cannot aggregate
+instead of failing.
+*/
+type skippingAggregation interface {
+
+	/*
+	   skipped returns the number of skipped rows.
+	*/
+	skipped() int
+}
+
+/*
+aggregationCount counts all rows.
+*/
+type aggregationCount struct {
+	count int
+}
+
+func (a *aggregationCount) add(val interface{}) error {
+	if val != nil {
+		a.count++
+	}
+	return nil
+}
+
+func (a *aggregationCount) result() interface{} {
+	return a.count
+}
+
+/*
+aggregationSum sums up all values. All values must be numbers.
+*/
+type aggregationSum struct {
+	sum float64
+}
+
+func (a *aggregationSum) add(val interface{}) error {
+	if val == nil {
+		return nil
+	}
+
+	num, err := data.ToFloat64(val)
+	if err == nil {
+		a.sum += num
+	}
+
+	return err
+}
+
+func (a *aggregationSum) result() interface{} {
+	return a.sum
+}
+
+/*
+aggregationAvg calculates the average of all values. All values must be
+numbers. The average of no values is null.
+*/
+type aggregationAvg struct {
+	aggregationSum
+	count int
+}
+
+func (a *aggregationAvg) add(val interface{}) error {
+	if val == nil {
+		return nil
+	}
+
+	err := a.aggregationSum.add(val)
+	if err == nil {
+		a.count++
+	}
+
+	return err
+}
+
+func (a *aggregationAvg) result() interface{} {
+	if a.count == 0 {
+		return nil
+	}
+	return a.sum / float64(a.count)
+}
+
+/*
+aggregationMinMax finds the smallest or largest value. Values are compared
+in the same way as in the ordering of a result. The minimum or maximum of no
+values is null.
+*/
+type aggregationMinMax struct {
+	val interface{}
+	min bool
+}
+
+func (a *aggregationMinMax) add(val interface{}) error {
+	if val == nil {
+		return nil
+	}
+
+	if a.val == nil || (a.min && compareValues(val, a.val) < 0) || (!a.min && compareValues(val, a.val) > 0) {
+		a.val = val
+	}
+	return nil
+}
+
+func (a *aggregationMinMax) result() interface{} {
+	return a.val
+}
+
+/*
+aggregationPercentile estimates a percentile of all values with a quantile
+digest. Values which are not numbers and null values are skipped. The
+percentile of no values is null.
+*/
+type aggregationPercentile struct {
+	digest *quantileDigest
+	q      float64
+	skips  int
+}
+
+func (a *aggregationPercentile) add(val interface{}) error {
+	num, err := data.ToFloat64(val)
+
+	if val == nil || err != nil || math.IsNaN(num) {
+		a.skips++
+	} else {
+		a.digest.add(num)
+	}
+
+	return nil
+}
+
+func (a *aggregationPercentile) result() interface{} {
+	if a.digest.count == 0 {
+		return nil
+	}
+	return a.digest.quantile(a.q)
+}
+
+func (a *aggregationPercentile) skipped() int {
+	return a.skips
+}
+
+/*
+aggregationStddev calculates the sample standard deviation of all values
+in a single pass (Welford's algorithm). Values which are not numbers and
+null values are skipped. The standard deviation of less than two values
+is null.
+*/
+type aggregationStddev struct {
+	count int
+	mean  float64
+	m2    float64 // Sum of squared differences from the mean
+	skips int
+}
+
+func (a *aggregationStddev) add(val interface{}) error {
+	num, err := data.ToFloat64(val)
+
+	if val == nil || err != nil || math.IsNaN(num) {
+		a.skips++
+		return nil
+	}
+
+	a.count++
+	delta := num - a.mean
+	a.mean += delta / float64(a.count)
+	a.m2 += delta * (num - a.mean)
+
+	return nil
+}
+
+func (a *aggregationStddev) result() interface{} {
+	if a.count < 2 {
+		return nil
+	}
+	return math.Sqrt(a.m2 / float64(a.count-1))
+}
+
+func (a *aggregationStddev) skipped() int {
+	return a.skips
+}
+
+// Aggregation of search results
+// =============================
+
+/*
+aggregateGroup holds the aggregation state for a group of rows. A group
+consists of all rows which have the same values in all columns which are not
+aggregated.
+*/
+type aggregateGroup struct {
+	row  []interface{} // Row of the group (aggregated columns are filled in at the end)
+	src  []string      // Sources of the group row
+	aggs []aggregation // Aggregation states (nil for columns which are not aggregated)
+}
+
+/*
+aggregated checks if this search result aggregates its rows.
+*/
+func (sr *SearchResult) aggregated() bool {
+	for _, cf := range sr.colFunc {
+		if _, ok := cf.(*showAggregate); ok {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+addAggregateRow adds a row to its group of this search result.
+*/
+func (sr *SearchResult) addAggregateRow(row []interface{}, src []string) error {
+	var key strings.Builder
+
+	for i, cf := range sr.colFunc {
+		if _, ok := cf.(*showAggregate); !ok {
+			key.WriteString(strconv.Quote(fmt.Sprint(row[i])))
+			key.WriteString(",")
+		}
+	}
+
+	group, ok := sr.groups[key.String()]
+	if !ok {
+		group = sr.newAggregateGroup(row, src)
+		sr.groups[key.String()] = group
+		sr.groupKeys = append(sr.groupKeys, key.String())
+	}
+
+	for i, agg := range group.aggs {
+		if agg != nil {
+			if err := agg.add(row[i]); err != nil {
+				return &ResultError{sr.name, ErrNotANumber,
+					fmt.Sprintf("Cannot aggregate %v value: %v", sr.ColLabels[i], row[i])}
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+newAggregateGroup creates a new group for a given row.
+*/
+func (sr *SearchResult) newAggregateGroup(row []interface{}, src []string) *aggregateGroup {
+	group := &aggregateGroup{row, src, make([]aggregation, len(sr.colFunc))}
+
+	for i, cf := range sr.colFunc {
+		if sa, ok := cf.(*showAggregate); ok {
+			group.aggs[i] = sa.newAggregation()
+		}
+	}
+
+	return group
+}
+
+/*
+finishAggregation produces one row for each group. A result without any
+columns which are not aggregated always has exactly one row. A warning is
+added for each column which skipped rows.
+*/
+func (sr *SearchResult) finishAggregation() {
+
+	if len(sr.groupKeys) == 0 {
+		grouped := false
+
+		for _, cf := range sr.colFunc {
+			if _, ok := cf.(*showAggregate); !ok {
+				grouped = true
+			}
+		}
+
+		if !grouped {
+			sr.groups[""] = sr.newAggregateGroup(make([]interface{}, len(sr.colFunc)),
+				make([]string, len(sr.colFunc)))
+			sr.groupKeys = append(sr.groupKeys, "")
+		}
+	}
+
+	skipped := make([]int, len(sr.colFunc))
+
+	for _, key := range sr.groupKeys {
+		group := sr.groups[key]
+
+		for i, agg := range group.aggs {
+			if agg != nil {
+				group.row[i] = agg.result()
+				group.src[i] = ""
+
+				if sa, ok := agg.(skippingAggregation); ok {
+					skipped[i] += sa.skipped()
+				}
+			}
+		}
+
+		sr.Data = append(sr.Data, group.row)
+		sr.Source = append(sr.Source, group.src)
+	}
+
+	for i, count := range skipped {
+		if count > 0 {
+			sr.warnings = append(sr.warnings, fmt.Sprintf(
+				"Skipped %v rows without a numeric value in %v", count, sr.ColLabels[i]))
+		}
+	}
+}
@@ -0,0 +1,250 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"fmt"
+
+	"devt.de/eliasdb/eql/parser"
+	"devt.de/eliasdb/graph/data"
+)
+
+// Arithmetic expressions
+// ======================
+
+/*
+Node names of arithmetic operators
+*/
+var arithmeticOps = map[string]bool{
+	parser.NodePLUS:   true,
+	parser.NodeMINUS:  true,
+	parser.NodeTIMES:  true,
+	parser.NodeDIV:    true,
+	parser.NodeMODINT: true,
+	parser.NodeDIVINT: true,
+}
+
+/*
+arithmetic runs an arithmetic operation on one (unary operator) or two
+numbers. Returns nil if the operation has no result (division by zero).
+*/
+func arithmetic(op string, nums []float64) interface{} {
+	var num1, num2 float64
+
+	if len(nums) == 1 {
+		num2 = nums[0]
+	} else {
+		num1, num2 = nums[0], nums[1]
+	}
+
+	switch op {
+	case parser.NodePLUS:
+		return num1 + num2
+	case parser.NodeMINUS:
+		return num1 - num2
+	case parser.NodeTIMES:
+		return num1 * num2
+	case parser.NodeDIV:
+		if num2 == 0 {
+			return nil
+		}
+		return num1 / num2
+	case parser.NodeMODINT:
+		if int(num2) == 0 {
+			return nil
+		}
+		return int(num1) % int(num2)
+	case parser.NodeDIVINT:
+		if int(num2) == 0 {
+			return nil
+		}
+		return int(num1) / int(num2)
+	}
+
+	return nil
+}
+
+/*
+opErrorDetail returns the error detail for an operand which has an invalid value.
+*/
+func opErrorDetail(tokenVal string, opVal string) string {
+	if tokenVal == opVal {
+		return opVal
+	}
+
+	return tokenVal + "=" + opVal
+}
+
+/*
+showExpressionInst creates a new showExpression object. The first attribute
+in the expression determines the node or edge on which the expression is
+evaluated. It can be given in the same way as a show column (e.g. price,
+Song:price or 2:n:price). Returns which column data should be queried.
+*/
+func showExpressionInst(expr *parser.ASTNode, text string, rtp *eqlRuntimeProvider) (FuncShow, string) {
+
+	var findColVal func(n *parser.ASTNode) string
+
+	findColVal = func(n *parser.ASTNode) string {
+		if n.Name == parser.NodeVALUE {
+			if _, err := data.ToFloat64(n.Token.Val); err != nil {
+				return n.Token.Val
+			}
+		} else if arithmeticOps[n.Name] {
+			for _, c := range n.Children {
+				if val := findColVal(c); val != "" {
+					return val
+				}
+			}
+		}
+		return ""
+	}
+
+	se := &showExpression{rtp, expr, text, findColVal(expr), "", true}
+
+	colData := se.colVal
+	if colData == "" {
+
+		// The expression does not contain any attributes - evaluate it on
+		// the root node
+
+		colData = "key"
+	}
+
+	return se, colData
+}
+
+/*
+showExpression shows the result of an arithmetic expression. Attribute
+values which are strings are converted to numbers. The result is null if
+an attribute is not set or if there is a division by zero.
+*/
+type showExpression struct {
+	rtp    *eqlRuntimeProvider
+	expr   *parser.ASTNode // Expression which should be evaluated
+	text   string          // Text of the expression
+	colVal string          // Operand which provides the column attribute
+	attr   string          // Attribute of the column
+	isNode bool            // Flag if the attribute is a node attribute
+}
+
+/*
+name returns the name of the function.
+*/
+func (se *showExpression) name() string {
+	return "expr"
+}
+
+/*
+setAttr sets the resolved attribute of the column.
+*/
+func (se *showExpression) setAttr(attr string, isNode bool) {
+	se.attr = attr
+	se.isNode = isNode
+}
+
+/*
+paramAttrs returns the node and edge attributes which are read by the
+expression.
+*/
+func (se *showExpression) paramAttrs() ([]string, []string) {
+	var params []*parser.ASTNode
+	var collect func(n *parser.ASTNode)
+
+	collect = func(n *parser.ASTNode) {
+		if n.Name == parser.NodeFUNC {
+			params = append(params, n.Children[1:]...)
+		} else if n.Name == parser.NodeVALUE && n.Token.Val != se.colVal {
+			params = append(params, n)
+		}
+		for _, c := range n.Children {
+			if arithmeticOps[n.Name] {
+				collect(c)
+			}
+		}
+	}
+
+	collect(se.expr)
+
+	return funcParamAttrs(se.rtp, params)
+}
+
+/*
+eval evaluates the expression on a row.
+*/
+func (se *showExpression) eval(node data.Node, edge data.Edge) (interface{}, string, error) {
+	var src string
+
+	if se.isNode && node != nil {
+		src = "n:" + node.Kind() + ":" + node.Key()
+	} else if !se.isNode && edge != nil {
+		src = "e:" + edge.Kind() + ":" + edge.Key()
+	}
+
+	res, err := se.evalNode(se.expr, node, edge)
+
+	return res, src, err
+}
+
+/*
+evalNode evaluates a part of the expression.
+*/
+func (se *showExpression) evalNode(n *parser.ASTNode, node data.Node, edge data.Edge) (interface{}, error) {
+
+	if n.Name == parser.NodeFUNC {
+		funcName := n.Children[0].Token.Val
+
+		funcInst, ok := lookupWhereFunc(funcName)
+		if !ok {
+			return nil, se.rtp.newRuntimeError(ErrInvalidConstruct,
+				"Unknown function: "+funcName, n)
+		}
+
+		res, err := funcInst(n, se.rtp, node, edge)
+		if res == invalid {
+			res = nil
+		}
+
+		return res, err
+
+	} else if !arithmeticOps[n.Name] {
+
+		if n.Token.Val == se.colVal {
+			if se.isNode && node != nil {
+				return node.Attr(se.attr), nil
+			} else if !se.isNode && edge != nil {
+				return edge.Attr(se.attr), nil
+			}
+			return nil, nil
+		}
+
+		return funcParam(se.rtp, n, node, edge), nil
+	}
+
+	nums := make([]float64, 0, 2)
+
+	for _, c := range n.Children {
+		res, err := se.evalNode(c, node, edge)
+		if err != nil || res == nil {
+			return nil, err
+		}
+
+		num, err := data.ToFloat64(res)
+		if err != nil {
+			return nil, se.rtp.newRuntimeError(ErrNotANumber,
+				opErrorDetail(c.Token.Val, fmt.Sprint(res)), c)
+		}
+
+		nums = append(nums, num)
+	}
+
+	return arithmetic(n.Name, nums), nil
+}
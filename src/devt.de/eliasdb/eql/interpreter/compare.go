@@ -0,0 +1,186 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"devt.de/eliasdb/graph/data"
+)
+
+/*
+Value classes - values of different classes are never equal. The order of the
+classes is the order of values of different classes in an ordered result.
+*/
+const (
+	classNumber = iota
+	classString
+	classBool
+	classOther
+)
+
+/*
+valueComparator compares values with the coercion rules of a query. All
+comparison operators and the ordering of results use the same rules:
+
+Numbers are compared numerically regardless of their Go type (e.g. int 5
+equals float64 5 which is stored if a node was created from JSON).
+
+Strings which are numbers are compared numerically with numbers and other
+number strings (e.g. "5" equals 5.0). Numbers are smaller than all values
+which are not numbers.
+
+All other values are compared by their string representation.
+
+In strict mode strings are never converted into numbers. Values of different
+classes (numbers, strings, booleans and other values) cannot be compared - all
+comparisons of such values are false and they are ordered by class.
+*/
+type valueComparator struct {
+	strict bool // Flag if values are not converted
+	fold   bool // Flag if strings are compared case-insensitively
+}
+
+/*
+comparator returns the value comparator of the query.
+*/
+func (p *eqlRuntimeProvider) comparator() valueComparator {
+	return valueComparator{p.withFlags.strict, p.withFlags.nocase}
+}
+
+/*
+toNumber converts a value into a number if it should be compared
+numerically.
+*/
+func (vc valueComparator) toNumber(val interface{}) (float64, bool) {
+
+	if vc.strict && valueClass(val) != classNumber {
+		return 0, false
+	}
+
+	num, err := data.ToFloat64(val)
+
+	return num, err == nil
+}
+
+/*
+compare compares two values. Returns a negative number if the first value is
+smaller, a positive number if the first value is larger and 0 if both values
+are equal. The second return value is false if the values cannot be compared.
+*/
+func (vc valueComparator) compare(v1 interface{}, v2 interface{}) (int, bool) {
+
+	num1, ok1 := vc.toNumber(v1)
+	num2, ok2 := vc.toNumber(v2)
+
+	if ok1 && ok2 {
+		if num1 < num2 {
+			return -1, true
+		} else if num1 > num2 {
+			return 1, true
+		}
+		return 0, true
+	}
+
+	if vc.strict {
+		c1, c2 := valueClass(v1), valueClass(v2)
+
+		if c1 != c2 {
+			return c1 - c2, false
+
+		} else if c1 == classBool {
+			b1, b2 := v1.(bool), v2.(bool)
+
+			if b1 == b2 {
+				return 0, true
+			} else if b2 {
+				return -1, true
+			}
+			return 1, true
+		}
+
+	} else if ok1 {
+		return -1, true
+
+	} else if ok2 {
+		return 1, true
+	}
+
+	if vc.fold {
+		return strings.Compare(foldString(fmt.Sprint(v1)), foldString(fmt.Sprint(v2))), true
+	}
+
+	return strings.Compare(fmt.Sprint(v1), fmt.Sprint(v2)), true
+}
+
+/*
+equals checks if two values are equal.
+*/
+func (vc valueComparator) equals(v1 interface{}, v2 interface{}) bool {
+	res, ok := vc.compare(v1, v2)
+	return ok && res == 0
+}
+
+/*
+order compares two values for ordering. Values which cannot be compared are
+ordered by their class.
+*/
+func (vc valueComparator) order(v1 interface{}, v2 interface{}) int {
+	res, _ := vc.compare(v1, v2)
+	return res
+}
+
+/*
+valueClass returns the class of a value.
+*/
+func valueClass(val interface{}) int {
+
+	switch val.(type) {
+
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64,
+		float32, float64, json.Number:
+		return classNumber
+
+	case string:
+		return classString
+
+	case bool:
+		return classBool
+	}
+
+	return classOther
+}
+
+/*
+literalValue returns the value of a literal of the query. In strict mode
+literals which are not quoted are numbers if they can be parsed as a number.
+*/
+func (vc valueComparator) literalValue(val string, quoted bool) interface{} {
+
+	if vc.strict && !quoted {
+		if num, err := strconv.ParseFloat(val, 64); err == nil {
+			return num
+		}
+	}
+
+	return val
+}
+
+/*
+compareValues compares two values with the default coercion rules (see
+valueComparator).
+*/
+func compareValues(c1 interface{}, c2 interface{}) int {
+	return valueComparator{}.order(c1, c2)
+}
@@ -0,0 +1,268 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+
+	"devt.de/eliasdb/eql/parser"
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+type stringer string
+
+func (s stringer) String() string {
+	return string(s)
+}
+
+func TestValueComparator(t *testing.T) {
+
+	// Expected results are given as result of compare - x means the values
+	// cannot be compared
+
+	tests := []struct {
+		v1      interface{}
+		v2      interface{}
+		lenient string
+		strict  string
+	}{
+
+		// Numbers of all Go types
+
+		{5, 5, "0", "0"},
+		{int8(5), int64(5), "0", "0"},
+		{int16(5), uint(5), "0", "0"},
+		{int32(5), uint8(5), "0", "0"},
+		{uint16(5), uint32(5), "0", "0"},
+		{uint64(5), float32(5), "0", "0"},
+		{5, 5.0, "0", "0"},
+		{5, 5.5, "-1", "-1"},
+		{float32(5.5), 5, "1", "1"},
+		{-1, uint(0), "-1", "-1"},
+		{json.Number("5"), 5, "0", "0"},
+		{json.Number("12"), 9.0, "1", "1"},
+
+		// Number strings
+
+		{"5", 5, "0", "x"},
+		{5.0, "5", "0", "x"},
+		{"5.0", "5", "0", "1"},
+		{"10", "9", "1", "-1"},
+		{"-1e3", -1000, "0", "x"},
+		{"0x10", 16, "1", "x"},
+		{stringer("5"), 5, "0", "x"},
+
+		// Numbers are smaller than other values
+
+		{5, "abc", "-1", "x"},
+		{"abc", 5, "1", "x"},
+		{100, "1a", "-1", "x"},
+		{" 5", 5, "1", "x"},
+		{"5", "5a", "-1", "-1"},
+
+		// Strings
+
+		{"abc", "abc", "0", "0"},
+		{"abc", "abd", "-1", "-1"},
+		{"abc", "ABC", "1", "1"},
+		{"", "a", "-1", "-1"},
+
+		// Booleans
+
+		{true, true, "0", "0"},
+		{false, true, "-1", "-1"},
+		{true, false, "1", "1"},
+		{true, "true", "0", "x"},
+		{true, 1, "1", "x"},
+		{false, "abc", "1", "x"},
+
+		// Other values
+
+		{[]string{"a"}, "[a]", "0", "x"},
+		{[]string{"a"}, []string{"b"}, "-1", "-1"},
+		{stringer("abc"), "abc", "0", "x"},
+		{stringer("abc"), stringer("abc"), "0", "0"},
+		{map[string]int{"a": 1}, true, "-1", "x"},
+	}
+
+	for _, test := range tests {
+		for _, strict := range []bool{false, true} {
+			expected := test.lenient
+			if strict {
+				expected = test.strict
+			}
+
+			vc := valueComparator{strict, false}
+
+			res, ok := vc.compare(test.v1, test.v2)
+			resStr := "x"
+			if ok {
+				resStr = fmt.Sprint(res)
+			}
+
+			if resStr != expected {
+				t.Errorf("Unexpected result for %#v and %#v (strict: %v): %v expected: %v",
+					test.v1, test.v2, strict, resStr, expected)
+				continue
+			}
+
+			// Swapped values give the opposite result
+
+			if res2, ok2 := vc.compare(test.v2, test.v1); ok2 != ok || (ok && res2 != -res) {
+				t.Errorf("Unexpected swapped result for %#v and %#v (strict: %v): %v %v",
+					test.v1, test.v2, strict, res2, ok2)
+			}
+
+			// Equality and ordering use the same rules
+
+			if vc.equals(test.v1, test.v2) != (resStr == "0") {
+				t.Errorf("Unexpected equality for %#v and %#v (strict: %v)", test.v1, test.v2, strict)
+			}
+
+			if order := vc.order(test.v1, test.v2); ok && order != res || !ok && order == 0 {
+				t.Errorf("Unexpected order for %#v and %#v (strict: %v): %v", test.v1, test.v2, strict, order)
+			}
+		}
+	}
+
+	// Case-insensitive comparison
+
+	vc := valueComparator{false, true}
+
+	if res, ok := vc.compare("abc", "ABC"); !ok || res != 0 {
+		t.Error("Unexpected result:", res, ok)
+		return
+	}
+
+	if res, ok := vc.compare("Straße", "STRASSE"); !ok || res != 0 {
+		t.Error("Unexpected result:", res, ok)
+		return
+	}
+
+	// Values of different classes are ordered by class in strict mode
+
+	vals := []interface{}{"b", true, 2, []int{1}, "10", false, 1.5}
+
+	vc = valueComparator{true, false}
+	sort.SliceStable(vals, func(i, j int) bool { return vc.order(vals[i], vals[j]) < 0 })
+
+	if res := fmt.Sprint(vals); res != "[1.5 2 10 b false true [1]]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	vc = valueComparator{false, false}
+	sort.SliceStable(vals, func(i, j int) bool { return vc.order(vals[i], vals[j]) < 0 })
+
+	if res := fmt.Sprint(vals); res != "[1.5 2 10 [1] b false true]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Literals are only typed in strict mode
+
+	if res := fmt.Sprintf("%#v", vc.literalValue("5", false)); res != `"5"` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	vc = valueComparator{true, false}
+
+	if res := fmt.Sprintf("%#v %#v %#v", vc.literalValue("5", false), vc.literalValue("5", true),
+		vc.literalValue("a", false)); res != `5 "5" "a"` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestStrictComparison(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := graph.NewGraphManager(mgs)
+
+	// Values of the same attribute are stored with different types (e.g.
+	// JSON data is stored as float64)
+
+	for i, val := range []interface{}{5, 5.0, "5", "05", "five", 7, "7", true} {
+		node := data.NewGraphNode()
+		node.SetAttr("key", fmt.Sprint(i))
+		node.SetAttr("kind", "Item")
+		node.SetAttr("val", val)
+		gm.StoreNode("main", node)
+	}
+
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+
+	rt.SortedStartKeys = true
+
+	keys := func(query string) string {
+		ast, err := parser.ParseWithRuntime("test", query, rt)
+		if err != nil {
+			return err.Error()
+		}
+
+		res, err := ast.Runtime.Eval()
+		if err != nil {
+			return err.Error()
+		}
+
+		ret := []string{}
+		for _, row := range res.(*SearchResult).Data {
+			ret = append(ret, fmt.Sprint(row[0]))
+		}
+
+		return fmt.Sprint(ret)
+	}
+
+	for _, test := range []struct {
+		query    string
+		expected string
+	}{
+
+		// Numbers and number strings compare numerically
+
+		{"get Item where val = 5 show key", "[0 1 2 3]"},
+		{"get Item where val = '5' show key", "[0 1 2 3]"},
+		{"get Item where val != 5 show key", "[4 5 6 7]"},
+		{"get Item where val > 5 show key", "[4 5 6 7]"},
+		{"get Item where val in [5, 7] show key", "[0 1 2 3 5 6]"},
+		{"get Item where val in [5.0, 'seven'] show key", "[0 1 2 3]"},
+
+		// Strict comparisons are false for values of different types -
+		// unquoted numbers are numbers and quoted values are strings
+
+		{"get Item where val = 5 show key with strict", "[0 1]"},
+		{"get Item where val = '5' show key with strict", "[2]"},
+		{"get Item where val != 5 show key with strict", "[5]"},
+		{"get Item where val > 5 show key with strict", "[5]"},
+		{"get Item where val >= '5' show key with strict", "[2 4 6]"},
+		{"get Item where val < 'five' show key with strict", "[2 3 6]"},
+		{"get Item where val in [5, '7'] show key with strict", "[0 1 6]"},
+		{"get Item where val notin [5, '7'] show key with strict", "[2 3 4 5 7]"},
+		{"get Item where val = true show key with strict", "[7]"},
+		{"get Item where val = 'true' show key with strict", "[]"},
+		{"get Item where val = 'true' show key", "[7]"},
+		{"get Item where val = '05' show key with strict, nocase", "[3]"},
+
+		// Ordering uses the same rules as filtering
+
+		{"get Item show key, val with ordering(ascending val)", "[0 1 2 3 5 6 4 7]"},
+		{"get Item show key, val with ordering(ascending val), strict", "[0 1 5 3 2 6 4 7]"},
+	} {
+		if res := keys(test.query); res != test.expected {
+			t.Errorf("Unexpected result for %v: %v expected: %v", test.query, res, test.expected)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"devt.de/eliasdb/eql/parser"
+	"devt.de/eliasdb/graph/data"
+)
+
+// Custom functions
+// ================
+
+/*
+FuncArgType is the type of an argument of a custom function.
+*/
+type FuncArgType int
+
+/*
+Argument types of custom functions
+*/
+const (
+	ArgAny    FuncArgType = iota // Value is passed as it is
+	ArgNumber                    // Value is converted to a float64
+	ArgString                    // Value is converted to its display representation
+)
+
+/*
+FuncProvider is a custom function which can be used in EQL queries.
+*/
+type FuncProvider interface {
+
+	/*
+	   ArgTypes returns the types of all arguments of the function.
+	*/
+	ArgTypes() []FuncArgType
+
+	/*
+	   Where returns if the function can be used in where clauses.
+	*/
+	Where() bool
+
+	/*
+	   Show returns if the function can be used in show clauses.
+	*/
+	Show() bool
+
+	/*
+	   Eval evaluates the function with resolved argument values. Values of
+	   attributes which are not set are passed as nil. The node and edge are
+	   the current node and edge of the where clause or show column (the edge
+	   is nil for start nodes).
+	*/
+	Eval(args []interface{}, node data.Node, edge data.Edge) (interface{}, error)
+}
+
+/*
+Registry for custom functions
+*/
+var customFuncs = make(map[string]FuncProvider)
+var customFuncsLock = &sync.RWMutex{}
+
+/*
+RegisterFunction registers a custom function. The name of a custom function
+must not be the name of a built-in function or of another registered function.
+*/
+func RegisterFunction(name string, f FuncProvider) error {
+	customFuncsLock.Lock()
+	defer customFuncsLock.Unlock()
+
+	if _, ok := whereFunc[name]; ok {
+		return fmt.Errorf("Cannot register function %v: Name of a built-in function", name)
+	} else if _, ok := showFunc[name]; ok {
+		return fmt.Errorf("Cannot register function %v: Name of a built-in function", name)
+	} else if _, ok := customFuncs[name]; ok {
+		return fmt.Errorf("Cannot register function %v: Function is already registered", name)
+	}
+
+	customFuncs[name] = f
+
+	return nil
+}
+
+/*
+UnregisterFunction removes a registered custom function.
+*/
+func UnregisterFunction(name string) {
+	customFuncsLock.Lock()
+	defer customFuncsLock.Unlock()
+
+	delete(customFuncs, name)
+}
+
+/*
+customFunc looks up a registered custom function.
+*/
+func customFunc(name string) (FuncProvider, bool) {
+	customFuncsLock.RLock()
+	defer customFuncsLock.RUnlock()
+
+	f, ok := customFuncs[name]
+
+	return f, ok
+}
+
+/*
+lookupWhereFunc looks up a function which can be used in a where clause.
+*/
+func lookupWhereFunc(name string) (FuncWhere, bool) {
+	if f, ok := whereFunc[name]; ok {
+		return f, true
+	} else if f, ok := customFunc(name); ok && f.Where() {
+		return whereCustomFunc, true
+	}
+	return nil, false
+}
+
+/*
+lookupShowFunc looks up a function which can be used in a show clause.
+*/
+func lookupShowFunc(name string) (FuncShowInst, bool) {
+	if f, ok := showFunc[name]; ok {
+		return f, true
+	} else if f, ok := customFunc(name); ok && f.Show() {
+		return showCustomInst, true
+	}
+	return nil, false
+}
+
+/*
+customFuncArgs converts the argument values of a custom function to the
+declared argument types.
+*/
+func customFuncArgs(rtp *eqlRuntimeProvider, fname string, f FuncProvider,
+	args []interface{}, astNode *parser.ASTNode) ([]interface{}, error) {
+
+	for i, t := range f.ArgTypes() {
+		if args[i] == nil {
+			continue
+		}
+
+		if t == ArgNumber {
+			num, err := data.ToFloat64(args[i])
+			if err != nil {
+				return nil, rtp.newRuntimeError(ErrNotANumber, fmt.Sprintf(
+					"Argument %v of @%v: %v", i+1, fname, args[i]), astNode)
+			}
+			args[i] = num
+
+		} else if t == ArgString {
+			args[i] = fmt.Sprint(args[i])
+		}
+	}
+
+	return args, nil
+}
+
+/*
+checkCustomFuncArgs checks the number of arguments which are given to a
+custom function.
+*/
+func checkCustomFuncArgs(fname string, f FuncProvider, count int) error {
+	if l := len(f.ArgTypes()); count != l {
+		return fmt.Errorf("%v function requires %v parameters",
+			strings.ToUpper(fname[:1])+fname[1:], l)
+	}
+	return nil
+}
+
+/*
+whereCustomFunc runs a custom function in a where clause. A null result is an
+invalid value.
+*/
+func whereCustomFunc(astNode *parser.ASTNode, rtp *eqlRuntimeProvider,
+	node data.Node, edge data.Edge) (interface{}, error) {
+
+	fname := astNode.Children[0].Token.Val
+	f, _ := customFunc(fname)
+
+	if f == nil {
+		return nil, rtp.newRuntimeError(ErrInvalidConstruct,
+			"Unknown function: "+fname, astNode)
+	}
+
+	// Check parameters
+
+	if err := checkCustomFuncArgs(fname, f, len(astNode.Children)-1); err != nil {
+		return nil, rtp.newRuntimeError(ErrInvalidConstruct, err.Error(), astNode)
+	}
+
+	args := make([]interface{}, 0, len(astNode.Children)-1)
+	for _, c := range astNode.Children[1:] {
+		args = append(args, funcParam(rtp, c, node, edge))
+	}
+
+	args, err := customFuncArgs(rtp, fname, f, args, astNode)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := f.Eval(args, node, edge)
+
+	if res == nil && err == nil {
+
+		// A null result fails all comparisons
+
+		res = invalid
+	}
+
+	return res, err
+}
+
+/*
+showCustomInst creates a new showCustom object. The first argument of a
+custom function in a show clause is the attribute of the column. It can be
+given in the same way as a show column (e.g. name, Song:name or 2:n:name).
+*/
+func showCustomInst(astNode *parser.ASTNode, rtp *eqlRuntimeProvider) (FuncShow, string, string, error) {
+	fname := astNode.Children[0].Token.Val
+	f, _ := customFunc(fname)
+
+	params := make([]string, 0, len(astNode.Children)-1)
+	for _, c := range astNode.Children[1:] {
+		params = append(params, c.Token.Val)
+	}
+
+	if err := checkCustomFuncArgs(fname, f, len(params)); err != nil {
+		return nil, "", "", err
+	}
+
+	colData := "key"
+	if len(params) > 0 {
+		colData = params[0]
+	}
+
+	return &showCustom{rtp, astNode, fname, f, "", true, len(params) > 0}, colData,
+		fmt.Sprintf("@%v(%v)", fname, strings.Join(params, ", ")), nil
+}
+
+/*
+showCustom shows the result of a custom function.
+*/
+type showCustom struct {
+	rtp     *eqlRuntimeProvider
+	astNode *parser.ASTNode
+	fname   string       // Name of the function
+	f       FuncProvider // Custom function
+	attr    string       // Attribute of the column
+	isNode  bool         // Flag if the attribute is a node attribute
+	hasAttr bool         // Flag if the first argument is the column attribute
+}
+
+/*
+name returns the name of the function.
+*/
+func (sc *showCustom) name() string {
+	return sc.fname
+}
+
+/*
+setAttr sets the attribute of the column.
+*/
+func (sc *showCustom) setAttr(attr string, isNode bool) {
+	sc.attr = attr
+	sc.isNode = isNode
+}
+
+/*
+paramAttrs returns the node and edge attributes which are read by the
+function parameters.
+*/
+func (sc *showCustom) paramAttrs() ([]string, []string) {
+	if !sc.hasAttr {
+		return nil, nil
+	}
+	return funcParamAttrs(sc.rtp, sc.astNode.Children[2:])
+}
+
+/*
+eval runs the custom function on a row.
+*/
+func (sc *showCustom) eval(node data.Node, edge data.Edge) (interface{}, string, error) {
+	var val interface{}
+	var src string
+
+	if sc.isNode && node != nil {
+		val = node.Attr(sc.attr)
+		src = "n:" + node.Kind() + ":" + node.Key()
+	} else if !sc.isNode && edge != nil {
+		val = edge.Attr(sc.attr)
+		src = "e:" + edge.Kind() + ":" + edge.Key()
+	}
+
+	var args []interface{}
+
+	if sc.hasAttr {
+		args = append(args, val)
+		for _, c := range sc.astNode.Children[2:] {
+			args = append(args, funcParam(sc.rtp, c, node, edge))
+		}
+	}
+
+	args, err := customFuncArgs(sc.rtp, sc.fname, sc.f, args, sc.astNode)
+	if err != nil {
+		return nil, "", err
+	}
+
+	res, err := sc.f.Eval(args, node, edge)
+
+	return res, src, err
+}
@@ -0,0 +1,272 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"devt.de/eliasdb/eql/parser"
+	"devt.de/eliasdb/graph/data"
+)
+
+// Date and time functions
+// =======================
+
+/*
+Units which can be used for date differences
+*/
+var dateUnits = map[string]float64{
+	"seconds": 1,
+	"minutes": 60,
+	"hours":   60 * 60,
+	"days":    24 * 60 * 60,
+}
+
+/*
+toTime converts a value into a point in time. Strings are parsed with a given
+layout (RFC3339 if no layout is given). Numbers (including strings which
+contain a number if no layout is given) are interpreted as Unix timestamps
+in seconds.
+*/
+func toTime(val interface{}, layout string) (time.Time, bool) {
+
+	if s, ok := val.(string); ok && layout != "" {
+		t, err := time.Parse(layout, s)
+		return t, err == nil
+	}
+
+	if num, err := data.ToFloat64(val); err == nil {
+		if math.IsNaN(num) || math.IsInf(num, 0) {
+			return time.Time{}, false
+		}
+
+		sec, frac := math.Modf(num)
+
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), true
+	}
+
+	if s, ok := val.(string); ok {
+		t, err := time.Parse(time.RFC3339, s)
+		return t, err == nil
+	}
+
+	return time.Time{}, false
+}
+
+/*
+toUnix converts a point in time into a Unix timestamp in seconds. Timestamps
+without fractional seconds are integers.
+*/
+func toUnix(t time.Time) interface{} {
+	if t.Nanosecond() == 0 {
+		return t.Unix()
+	}
+	return float64(t.Unix()) + float64(t.Nanosecond())/1e9
+}
+
+/*
+dateFuncTime converts the value of a date function parameter into a point in
+time. A warning is added to the query if a value which is set cannot be
+converted.
+*/
+func dateFuncTime(rtp *eqlRuntimeProvider, fname string, val interface{},
+	layout string, node data.Node) (time.Time, bool) {
+
+	t, ok := toTime(val, layout)
+
+	if !ok && val != nil {
+		src := ""
+		if node != nil {
+			src = fmt.Sprintf(" of %v:%v", node.Kind(), node.Key())
+		}
+		rtp.addWarning(fmt.Sprintf("Invalid date in @%v%v: %v", fname, src, val))
+	}
+
+	return t, ok
+}
+
+/*
+whereParseDate parses a date into a Unix timestamp. Returns an invalid value
+if the date cannot be parsed.
+*/
+func whereParseDate(astNode *parser.ASTNode, rtp *eqlRuntimeProvider,
+	node data.Node, edge data.Edge) (interface{}, error) {
+
+	// Check parameters
+
+	if len(astNode.Children) != 2 && len(astNode.Children) != 3 {
+		return nil, rtp.newRuntimeError(ErrInvalidConstruct,
+			"ParseDate function requires 1 or 2 parameters: value, layout (optional)", astNode)
+	}
+
+	layout := ""
+	if len(astNode.Children) == 3 {
+		layout = astNode.Children[2].Token.Val
+	}
+
+	t, ok := dateFuncTime(rtp, "parseDate",
+		funcParam(rtp, astNode.Children[1], node, edge), layout, node)
+
+	if !ok {
+		return invalid, nil
+	}
+
+	return toUnix(t), nil
+}
+
+/*
+whereNow returns the current time as a Unix timestamp in seconds.
+*/
+func whereNow(astNode *parser.ASTNode, rtp *eqlRuntimeProvider,
+	node data.Node, edge data.Edge) (interface{}, error) {
+
+	// Check parameters
+
+	if len(astNode.Children) != 1 {
+		return nil, rtp.newRuntimeError(ErrInvalidConstruct,
+			"Now function requires no parameters", astNode)
+	}
+
+	return time.Now().Unix(), nil
+}
+
+/*
+whereDateDiff calculates the difference between two dates (first minus
+second) in a given unit (seconds, minutes, hours or days). Returns an invalid
+value if one of the dates cannot be parsed.
+*/
+func whereDateDiff(astNode *parser.ASTNode, rtp *eqlRuntimeProvider,
+	node data.Node, edge data.Edge) (interface{}, error) {
+
+	// Check parameters
+
+	if len(astNode.Children) != 3 && len(astNode.Children) != 4 {
+		return nil, rtp.newRuntimeError(ErrInvalidConstruct,
+			"DateDiff function requires 2 or 3 parameters: date, date, unit (optional)", astNode)
+	}
+
+	unit := 1.0
+
+	if len(astNode.Children) == 4 {
+		var ok bool
+
+		if unit, ok = dateUnits[strings.ToLower(astNode.Children[3].Token.Val)]; !ok {
+			return nil, rtp.newRuntimeError(ErrInvalidConstruct,
+				"Unknown date unit: "+astNode.Children[3].Token.Val+
+					" (use seconds, minutes, hours or days)", astNode)
+		}
+	}
+
+	t1, ok1 := dateFuncTime(rtp, "dateDiff",
+		funcParam(rtp, astNode.Children[1], node, edge), "", node)
+	t2, ok2 := dateFuncTime(rtp, "dateDiff",
+		funcParam(rtp, astNode.Children[2], node, edge), "", node)
+
+	if !ok1 || !ok2 {
+		return invalid, nil
+	}
+
+	return t1.Sub(t2).Seconds() / unit, nil
+}
+
+/*
+showDateInst creates a new showDate object. Date functions take the attribute
+which contains the date as first parameter. The attribute can be given in the
+same way as a show column (e.g. created, Song:created or 2:n:created).
+*/
+func showDateInst(astNode *parser.ASTNode, rtp *eqlRuntimeProvider) (FuncShow, string, string, error) {
+	fname := astNode.Children[0].Token.Val
+
+	params := make([]string, 0, len(astNode.Children)-1)
+	for _, c := range astNode.Children[1:] {
+		params = append(params, c.Token.Val)
+	}
+
+	if fname == "parseDate" && len(params) != 1 && len(params) != 2 {
+		return nil, "", "", fmt.Errorf("ParseDate function requires 1 or 2 parameters: attribute, layout (optional)")
+	} else if fname == "formatDate" && (len(params) < 1 || len(params) > 3) {
+		return nil, "", "", fmt.Errorf("FormatDate function requires 1 to 3 parameters: " +
+			"attribute, layout (optional), parse layout (optional)")
+	}
+
+	sd := &showDate{rtp, fname, "", true, "", time.RFC3339}
+
+	if fname == "parseDate" && len(params) == 2 {
+		sd.parseLayout = params[1]
+	} else if fname == "formatDate" {
+		if len(params) > 1 {
+			sd.layout = params[1]
+		}
+		if len(params) > 2 {
+			sd.parseLayout = params[2]
+		}
+	}
+
+	return sd, params[0], fmt.Sprintf("@%v(%v)", fname, strings.Join(params, ", ")), nil
+}
+
+/*
+showDate shows the date of an attribute either as Unix timestamp (parseDate)
+or as formatted string in UTC (formatDate). Dates which cannot be parsed are
+shown as null.
+*/
+type showDate struct {
+	rtp         *eqlRuntimeProvider
+	fname       string // Name of the function
+	attr        string // Attribute which contains the date
+	isNode      bool   // Flag if the attribute is a node attribute
+	parseLayout string // Layout to parse the date
+	layout      string // Layout to format the date
+}
+
+/*
+name returns the name of the function.
+*/
+func (sd *showDate) name() string {
+	return sd.fname
+}
+
+/*
+setAttr sets the attribute of the column which contains the date.
+*/
+func (sd *showDate) setAttr(attr string, isNode bool) {
+	sd.attr = attr
+	sd.isNode = isNode
+}
+
+/*
+eval parses and optionally formats the date of a row.
+*/
+func (sd *showDate) eval(node data.Node, edge data.Edge) (interface{}, string, error) {
+	var val interface{}
+	var src string
+
+	if sd.isNode && node != nil {
+		val = node.Attr(sd.attr)
+		src = "n:" + node.Kind() + ":" + node.Key()
+	} else if !sd.isNode && edge != nil {
+		val = edge.Attr(sd.attr)
+		src = "e:" + edge.Kind() + ":" + edge.Key()
+	}
+
+	t, ok := dateFuncTime(sd.rtp, sd.fname, val, sd.parseLayout, node)
+
+	if !ok {
+		return nil, src, nil
+	} else if sd.fname == "formatDate" {
+		return t.UTC().Format(sd.layout), src, nil
+	}
+
+	return toUnix(t), src, nil
+}
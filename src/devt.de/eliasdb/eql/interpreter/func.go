@@ -16,7 +16,9 @@ package interpreter
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 
 	"devt.de/eliasdb/eql/parser"
 	"devt.de/eliasdb/graph/data"
@@ -35,7 +37,71 @@ type FuncWhere func(astNode *parser.ASTNode, rtp *eqlRuntimeProvider,
 Runtime map for where related functions
 */
 var whereFunc = map[string]FuncWhere{
-	"count": whereCount,
+	"count":     whereCount,
+	"phrase":    wherePhrase,
+	"parseDate": whereParseDate,
+	"now":       whereNow,
+	"dateDiff":  whereDateDiff,
+
+	"lower":  whereString,
+	"upper":  whereString,
+	"trim":   whereString,
+	"substr": whereString,
+	"concat": whereString,
+	"length": whereString,
+}
+
+/*
+funcParam returns the value of a function parameter. A parameter is an
+attribute of the current node if it is a known attribute (the prefixes attr:,
+eattr: and val: can be used in the same way as in where clauses).
+*/
+func funcParam(rtp *eqlRuntimeProvider, param *parser.ASTNode,
+	node data.Node, edge data.Edge) interface{} {
+
+	val := param.Token.Val
+	lcval := strings.ToLower(val)
+
+	if strings.HasPrefix(lcval, "val:") {
+		return val[4:]
+	} else if strings.HasPrefix(lcval, "attr:") {
+		if node == nil {
+			return nil
+		}
+		return node.Attr(val[5:])
+	} else if strings.HasPrefix(lcval, "eattr:") {
+		if edge == nil {
+			return nil
+		}
+		return edge.Attr(val[6:])
+	} else if node != nil && rtp.ni.IsValidAttr(val) {
+		return node.Attr(val)
+	}
+
+	return val
+}
+
+/*
+funcParamAttrs returns the node and edge attributes which are read by given
+function parameters.
+*/
+func funcParamAttrs(rtp *eqlRuntimeProvider, params []*parser.ASTNode) ([]string, []string) {
+	var nodeAttrs, edgeAttrs []string
+
+	for _, param := range params {
+		val := param.Token.Val
+		lcval := strings.ToLower(val)
+
+		if strings.HasPrefix(lcval, "attr:") {
+			nodeAttrs = append(nodeAttrs, val[5:])
+		} else if strings.HasPrefix(lcval, "eattr:") {
+			edgeAttrs = append(edgeAttrs, val[6:])
+		} else if !strings.HasPrefix(lcval, "val:") && rtp.ni.IsValidAttr(val) {
+			nodeAttrs = append(nodeAttrs, val)
+		}
+	}
+
+	return nodeAttrs, edgeAttrs
 }
 
 /*
@@ -54,8 +120,53 @@ func whereCount(astNode *parser.ASTNode, rtp *eqlRuntimeProvider,
 	spec := astNode.Children[1].Token.Val
 
 	nodes, _, err := rtp.gm.TraverseMulti(rtp.part, node.Key(), node.Kind(), spec, false)
+	if err != nil {
+		return nil, err
+	}
+
+	rtp.stats.Traversals++
+
+	return len(nodes), rtp.visitNodes(len(nodes))
+}
+
+/*
+wherePhrase checks if an attribute of a node contains a given phrase. The
+words of the phrase must appear consecutively and in order. The check uses
+the full text index of the node kind.
+*/
+func wherePhrase(astNode *parser.ASTNode, rtp *eqlRuntimeProvider,
+	node data.Node, edge data.Edge) (interface{}, error) {
+
+	// Check parameters
+
+	if len(astNode.Children) != 3 {
+		return nil, rtp.newRuntimeError(ErrInvalidConstruct,
+			"Phrase function requires 2 parameters: attribute, phrase", astNode)
+	}
+
+	attr := astNode.Children[1].Token.Val
+	phrase := astNode.Children[2].Token.Val
+
+	keys, err := rtp.gm.LookupPhrase(rtp.part, node.Kind(), attr, phrase)
+	if err != nil {
+		return nil, err
+	}
+
+	rtp.stats.IndexLookups++
+
+	i := sort.SearchStrings(keys, node.Key())
+	found := i < len(keys) && keys[i] == node.Key()
+
+	// Record where the phrase occurs in the attribute value
 
-	return len(nodes), err
+	if found && rtp.highlights != nil {
+		if val := node.Attr(attr); val != nil {
+			rtp.highlights.addPending(node, attr,
+				phraseMatches(rtp.gm.IndexAnalyzer(node.Kind(), attr), fmt.Sprint(val), phrase))
+		}
+	}
+
+	return found, nil
 }
 
 // Show related functions
@@ -66,6 +177,24 @@ Runtime map for show related functions
 */
 var showFunc = map[string]FuncShowInst{
 	"count": showCountInst,
+	"sum":   showAggregateInst,
+	"avg":   showAggregateInst,
+	"min":   showAggregateInst,
+	"max":   showAggregateInst,
+
+	"percentile": showAggregateInst,
+	"median":     showAggregateInst,
+	"stddev":     showAggregateInst,
+
+	"parseDate":  showDateInst,
+	"formatDate": showDateInst,
+
+	"lower":  showStringInst,
+	"upper":  showStringInst,
+	"trim":   showStringInst,
+	"substr": showStringInst,
+	"concat": showStringInst,
+	"length": showStringInst,
 }
 
 /*
@@ -89,6 +218,30 @@ type FuncShow interface {
 	eval(node data.Node, edge data.Edge) (interface{}, string, error)
 }
 
+/*
+attrFunc is a show function which operates on the attribute of its column.
+*/
+type attrFunc interface {
+
+	/*
+	   setAttr sets the resolved attribute of the column.
+	*/
+	setAttr(attr string, isNode bool)
+}
+
+/*
+paramAttrFunc is a show function which reads further attributes for its
+parameters.
+*/
+type paramAttrFunc interface {
+
+	/*
+	   paramAttrs returns the node and edge attributes which are read by the
+	   function parameters.
+	*/
+	paramAttrs() ([]string, []string)
+}
+
 /*
 FuncShowInst creates a function object. Returns which column data should be queried and
 how the colummn should be named.
@@ -103,6 +256,12 @@ showCountInst creates a new showCount object.
 */
 func showCountInst(astNode *parser.ASTNode, rtp *eqlRuntimeProvider) (FuncShow, string, string, error) {
 
+	// Without parameters count is an aggregation function
+
+	if len(astNode.Children) == 1 {
+		return showAggregateInst(astNode, rtp)
+	}
+
 	// Check parameters
 
 	if len(astNode.Children) != 3 {
@@ -136,6 +295,10 @@ showCount counts reachable nodes via a given traversal.
 func (sc *showCount) eval(node data.Node, edge data.Edge) (interface{}, string, error) {
 
 	nodes, _, err := sc.rtp.gm.TraverseMulti(sc.rtp.part, node.Key(), node.Kind(), sc.spec, false)
+	if err == nil {
+		sc.rtp.stats.Traversals++
+		err = sc.rtp.visitNodes(len(nodes))
+	}
 	if err != nil {
 		return nil, "", err
 	}
@@ -10,7 +10,14 @@
 
 package interpreter
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+)
 
 func TestFunctions(t *testing.T) {
 	gm, _ := songGraphGroups()
@@ -98,3 +105,291 @@ Mike, 4
 		return
 	}
 }
+
+func TestPhraseFunction(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := graph.NewGraphManager(mgs)
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+
+	storeLog := func(key string, msg string) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "Log")
+		node.SetAttr("msg", msg)
+		gm.StoreNode("main", node)
+	}
+
+	storeLog("1", "Out of memory")
+	storeLog("2", "Memory usage went out of bounds")
+	storeLog("3", "Process ran out of memory!")
+	storeLog("4", "Disk is full")
+
+	if _, err := getResult(`get Log where @phrase(msg, "out of MEMORY") show msg`, `
+Labels: Msg
+Format: auto
+Data: 1:n:msg
+Out of memory
+Process ran out of memory!
+`[1:], rt, true); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult(`get Log where not @phrase(msg, "out of memory") show msg`, `
+Labels: Msg
+Format: auto
+Data: 1:n:msg
+Disk is full
+Memory usage went out of bounds
+`[1:], rt, true); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Log where @phrase(msg) show msg", "", rt, true); err.Error() !=
+		"EQL error in test: Invalid construct (Phrase function requires 2 parameters: attribute, phrase) (Line:1 Pos:15)" {
+		t.Error(err)
+		return
+	}
+}
+
+func TestDateFunctions(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := graph.NewGraphManager(mgs)
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+	rt.SortedStartKeys = true
+
+	storeEvent := func(key string, created interface{}, day string) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "Event")
+		node.SetAttr("day", day)
+		if created != nil {
+			node.SetAttr("created", created)
+		}
+		gm.StoreNode("main", node)
+	}
+
+	storeEvent("e1", "2020-01-01T10:00:00Z", "2020-01-01")
+	storeEvent("e2", 1578182400, "2020-01-05")
+	storeEvent("e3", "2020-01-03T00:00:00+02:00", "2020-01-02")
+	storeEvent("e4", "yesterday", "someday")
+	storeEvent("e5", nil, "2020-01-06")
+
+	// Dates can be compared in where clauses - invalid dates fail all
+	// comparisons and produce a warning
+
+	res, err := getResult("get Event where @parseDate(created) > @parseDate('2020-01-02T00:00:00Z') show key", `
+Labels: Event Key
+Format: auto
+Data: 1:n:key
+e2
+e3
+`[1:], rt, false)
+
+	if err != nil || fmt.Sprint(res.Warnings()) != "[Invalid date in @parseDate of Event:e4: yesterday]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := getResult("get Event where @dateDiff(created, '2020-01-01T00:00:00Z', days) >= 1.9 show key", `
+Labels: Event Key
+Format: auto
+Data: 1:n:key
+e2
+e3
+`[1:], rt, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Event where @now() > @parseDate(created) and @parseDate(day, '2006-01-02') < @parseDate(1578096000) show key", `
+Labels: Event Key
+Format: auto
+Data: 1:n:key
+e1
+e3
+`[1:], rt, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Dates can be shown as Unix timestamps and formatted strings and can
+	// be ordered
+
+	res, err = getResult("get Event show key, @parseDate(created), @formatDate(created, '2006-01-02 15:04'), "+
+		"@formatDate(day, '02.01.2006', '2006-01-02') with ordering(ascending created)", `
+Labels: Event Key, @parseDate(created), @formatDate(created, 2006-01-02 15:04), @formatDate(day, 02.01.2006, 2006-01-02)
+Format: auto, auto, auto, auto
+Data: 1:n:key, 1:func:parseDate(), 1:func:formatDate(), 1:func:formatDate()
+e1, 1577872800, 2020-01-01 10:00, 01.01.2020
+e3, 1578002400, 2020-01-02 22:00, 02.01.2020
+e2, 1578182400, 2020-01-05 00:00, 05.01.2020
+e4, <not set>, <not set>, <not set>
+e5, <not set>, <not set>, 06.01.2020
+`[1:], rt, false)
+
+	if err != nil || fmt.Sprint(res.Warnings()) != "[Invalid date in @parseDate of Event:e4: yesterday "+
+		"Invalid date in @formatDate of Event:e4: yesterday Invalid date in @formatDate of Event:e4: someday]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Test error cases
+
+	if _, err := getResult("get Event where @dateDiff(created, created, weeks) > 1", "", rt, false); err == nil || err.Error() !=
+		"EQL error in test: Invalid construct (Unknown date unit: weeks (use seconds, minutes, hours or days)) (Line:1 Pos:17)" {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Event where @parseDate() > 1", "", rt, false); err == nil || err.Error() !=
+		"EQL error in test: Invalid construct (ParseDate function requires 1 or 2 parameters: value, layout (optional)) (Line:1 Pos:17)" {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Event where @now(1) > 1", "", rt, false); err == nil || err.Error() !=
+		"EQL error in test: Invalid construct (Now function requires no parameters) (Line:1 Pos:17)" {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Event show @dateDiff(created, created)", "", rt, false); err == nil || err.Error() !=
+		"EQL error in test: Invalid construct (Unknown function: dateDiff) (Line:1 Pos:16)" {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Event show @formatDate()", "", rt, false); err == nil || err.Error() !=
+		"EQL error in test: Invalid construct (FormatDate function requires 1 to 3 parameters: attribute, layout (optional), parse layout (optional)) (Line:1 Pos:16)" {
+		t.Error(err)
+		return
+	}
+
+	// Only a limited number of warnings is kept
+
+	for i := 0; i < maxWarnings+10; i++ {
+		rt.addWarning("test")
+	}
+
+	if len(rt.warnings) != maxWarnings+1 || rt.warnings[maxWarnings] != "Further warnings were omitted" {
+		t.Error("Unexpected warnings:", len(rt.warnings))
+		return
+	}
+}
+
+func TestStringFunctions(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := graph.NewGraphManager(mgs)
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+	rt.SortedStartKeys = true
+
+	storeWord := func(key string, name interface{}, lang string) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "Word")
+		node.SetAttr("lang", lang)
+		if name != nil {
+			node.SetAttr("name", name)
+		}
+		gm.StoreNode("main", node)
+	}
+
+	storeWord("w1", "  Grüße ", "de")
+	storeWord("w2", "日本語テキスト", "ja")
+	storeWord("w3", 4242, "num")
+	storeWord("w4", nil, "none")
+
+	// String functions can be used in where clauses
+
+	if _, err := getResult("get Word where @lower(@trim(name)) = grüße show key", "", rt, false); err == nil {
+		t.Error("Nested functions should not be parsed")
+		return
+	}
+
+	if _, err := getResult("get Word where @upper(name) contains GRÜSSE or @upper(name) contains GRÜßE show key", `
+Labels: Word Key
+Format: auto
+Data: 1:n:key
+w1
+`[1:], rt, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Word where @length(name) = 7 show key", `
+Labels: Word Key
+Format: auto
+Data: 1:n:key
+w2
+`[1:], rt, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Word where @substr(name, 0, 2) = 42 or @concat(lang, name) = 'ja日本語テキスト' show key", `
+Labels: Word Key
+Format: auto
+Data: 1:n:key
+w2
+w3
+`[1:], rt, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// String functions can be used in show clauses - negative start positions
+	// are counted from the end and out of range positions are clamped
+
+	if _, err := getResult("get Word show key, @trim(name), @lower(name), @length(name), @substr(name, 2, 3), "+
+		"@substr(name, -5, 100), @concat(name, '-', lang)", `
+Labels: Word Key, @trim(name), @lower(name), @length(name), @substr(name, 2, 3), @substr(name, -5, 100), @concat(name, -, lang)
+Format: auto, auto, auto, auto, auto, auto, auto
+Data: 1:n:key, 1:func:trim(), 1:func:lower(), 1:func:length(), 1:func:substr(), 1:func:substr(), 1:func:concat()
+w1, Grüße,   grüße , 8, Grü, rüße ,   Grüße -de
+w2, 日本語テキスト, 日本語テキスト, 7, 語テキ, 語テキスト, 日本語テキスト-ja
+w3, 4242, 4242, 4, 42, 4242, 4242-num
+w4, <not set>, <not set>, 0, <not set>, <not set>, -none
+`[1:], rt, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Word where @substr(name, -3, 2) = 24 or @substr(name, '-1') = 'ト' show key, @substr(name, -3, 2)", `
+Labels: Word Key, @substr(name, -3, 2)
+Format: auto, auto
+Data: 1:n:key, 1:func:substr()
+w2, キス
+w3, 24
+`[1:], rt, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Test error cases
+
+	if _, err := getResult("get Word where @substr(name, lang) = 1", "", rt, false); err == nil || err.Error() !=
+		"EQL error in test: Value of operand is not a number (Substr position must be a number: de) (Line:1 Pos:16)" {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Word show @substr(name, 1, x)", "", rt, false); err == nil || err.Error() !=
+		"EQL error in test: Value of operand is not a number (Substr position must be a number: x) (Line:1 Pos:15)" {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Word where @lower() = 1", "", rt, false); err == nil || err.Error() !=
+		"EQL error in test: Invalid construct (Lower function requires 1 parameter: value) (Line:1 Pos:16)" {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Word show @concat(name)", "", rt, false); err == nil || err.Error() !=
+		"EQL error in test: Invalid construct (Concat function requires at least 2 parameters: value, value, ...) (Line:1 Pos:15)" {
+		t.Error(err)
+		return
+	}
+}
@@ -11,6 +11,9 @@
 package interpreter
 
 import (
+	"sort"
+	"time"
+
 	"devt.de/eliasdb/eql/parser"
 	"devt.de/eliasdb/graph"
 )
@@ -27,7 +30,9 @@ type getInst func(*GetRuntimeProvider, *parser.ASTNode) parser.Runtime
 Runtime map for GET query specific components
 */
 var getProviderMap = map[string]getInst{
-	parser.NodeGET: getRuntimeInst,
+	parser.NodeGET:    getRuntimeInst,
+	parser.NodeDELETE: mutationRuntimeInst,
+	parser.NodeUPDATE: mutationRuntimeInst,
 }
 
 /*
@@ -35,6 +40,10 @@ GetRuntimeProvider data structure
 */
 type GetRuntimeProvider struct {
 	*eqlRuntimeProvider
+	SortedStartKeys bool   // Flag if start nodes are iterated in lexicographic key order
+	SampleStartKeys int    // Number of random start nodes which are visited (0 visits all nodes)
+	ResumeKey       string // Start key from which a previous result is resumed (see SearchResult.ResumePosition)
+	ResumeRows      int    // Number of rows of the resume key which are part of the previous result
 }
 
 /*
@@ -42,8 +51,8 @@ NewGetRuntimeProvider creates a new GetRuntimeProvider object. This provider
 can interpret GET queries.
 */
 func NewGetRuntimeProvider(name string, part string, gm *graph.Manager, ni NodeInfo) *GetRuntimeProvider {
-	return &GetRuntimeProvider{&eqlRuntimeProvider{name, part, gm, ni, "", false, nil, "",
-		nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil}}
+	return &GetRuntimeProvider{&eqlRuntimeProvider{name, part, gm, ni, nil, nil, false, 0, 0, 0, false, nil, "", false, false, nil, -1, 0, nil, nil, 0, nil, nil, false, "",
+		nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil}, false, 0, "", 0}
 }
 
 /*
@@ -80,26 +89,132 @@ func (rt *getRuntime) Validate() error {
 
 	startKind := rt.node.Children[0].Token.Val
 
+	// Traversal results are visited in a stable order if the start keys are
+	// sorted so the rows of a start node are always in the same order
+
+	rt.rtp.sortedTraversals = rt.rtp.SortedStartKeys
+
 	initErr := rt.rtp.init(startKind, rt.node.Children[1:])
 
+	if initErr == nil && rt.rtp.ResumeKey != "" {
+		if reason := rt.rtp.resumable(); reason != "" {
+			return rt.rtp.newRuntimeError(ErrInvalidCursor,
+				"Query cannot be resumed from a cursor: "+reason, rt.node)
+		}
+	}
+
+	// A query which is only validated does not read any data
+
+	if rt.rtp.validateOnly {
+		return initErr
+	}
+
 	if rt.rtp.groupScope == "" {
+		var candidates []string
+		var useCandidates bool
 
-		// Start keys can be provided by a simple node key iterator
+		// Patterns in the where clause might limit the start keys to the
+		// candidates of an index lookup
 
-		startKeyIterator, err := rt.rtp.gm.NodeKeyIterator(rt.rtp.part, startKind)
+		if initErr == nil && rt.rtp.SampleStartKeys <= 0 {
+			var err error
 
-		if err != nil {
-			return err
-		} else if startKeyIterator == nil {
-			return rt.rtp.newRuntimeError(ErrUnknownNodeKind, startKind, rt.node.Children[0])
+			if candidates, useCandidates, err = rt.rtp.patternCandidates(startKind); err != nil {
+				return err
+			}
 		}
 
-		rt.rtp.nextStartKey = func() (string, error) {
-			nextKey := startKeyIterator.Next()
-			if startKeyIterator.LastError != nil {
-				return "", startKeyIterator.LastError
+		// Start keys can be provided by a simple node key iterator - a sorted
+		// iterator is much slower but gives a stable order
+
+		if rt.rtp.SampleStartKeys > 0 {
+
+			// A random sample of start keys is visited in key order
+
+			startKeys, err := rt.rtp.gm.SampleNodeKeys(rt.rtp.part, startKind, rt.rtp.SampleStartKeys)
+
+			if err != nil {
+				return err
+			} else if startKeys == nil {
+				return rt.rtp.newRuntimeError(ErrUnknownNodeKind, startKind, rt.node.Children[0])
+			}
+
+			sort.Strings(startKeys)
+
+			rt.rtp.nextStartKey = func() (string, error) {
+				if len(startKeys) == 0 {
+					return "", nil
+				}
+
+				nextKey := startKeys[0]
+				startKeys = startKeys[1:]
+
+				return nextKey, nil
+			}
+
+		} else if useCandidates {
+
+			// Candidates are visited in key order
+
+			rt.rtp.stats.IndexUsed = true
+
+			if rt.rtp.ResumeKey != "" {
+				candidates = candidates[sort.SearchStrings(candidates, rt.rtp.ResumeKey):]
+			}
+
+			rt.rtp.nextStartKey = func() (string, error) {
+				if len(candidates) == 0 {
+					return "", nil
+				}
+
+				nextKey := candidates[0]
+				candidates = candidates[1:]
+
+				return nextKey, nil
+			}
+
+		} else if rt.rtp.SortedStartKeys {
+
+			startKeyIterator, err := rt.rtp.gm.SortedNodeKeyIterator(rt.rtp.part, startKind)
+
+			if err != nil {
+				return err
+			} else if startKeyIterator == nil {
+				return rt.rtp.newRuntimeError(ErrUnknownNodeKind, startKind, rt.node.Children[0])
+			}
+
+			// A resumed query continues with the start key of the last row
+			// of the previous result
+
+			if rt.rtp.ResumeKey != "" {
+				startKeyIterator.Seek(rt.rtp.ResumeKey)
+			}
+
+			rt.rtp.nextStartKey = func() (string, error) {
+				nextKey := startKeyIterator.Next()
+				if startKeyIterator.LastError != nil {
+					return "", startKeyIterator.LastError
+				}
+				return nextKey, nil
+			}
+
+		} else {
+
+			startKeyIterator, err := rt.rtp.gm.NodeKeyIterator(rt.rtp.part, startKind)
+
+			if err != nil {
+				return err
+			} else if startKeyIterator == nil {
+				return rt.rtp.newRuntimeError(ErrUnknownNodeKind, startKind, rt.node.Children[0])
+			}
+
+			rt.rtp.nextStartKey = func() (string, error) {
+				nextKey := startKeyIterator.Next()
+				if startKeyIterator.LastError != nil {
+					return "", startKeyIterator.LastError
+				}
+				return nextKey, nil
 			}
-			return nextKey, nil
 		}
 
 	} else {
@@ -113,6 +228,8 @@ func (rt *getRuntime) Validate() error {
 			return err
 		}
 
+		rt.rtp.stats.Traversals++
+
 		nodePtr := len(nodes)
 
 		// Iterate over all traversed nodes
@@ -139,30 +256,107 @@ func (rt *getRuntime) Eval() (interface{}, error) {
 
 	// First validate the query and reset the runtime provider datastructures
 
+	start := time.Now()
+
 	if rt.rtp.specs == nil || !allowMultiEval {
 		if err := rt.Validate(); err != nil {
 			return nil, err
 		}
 	}
 
-	return rt.gaterResult()
+	res, err := rt.gaterResult()
+
+	rt.rtp.finishStats(start)
+
+	return res, err
 }
 
 func (rt *getRuntime) gaterResult() (interface{}, error) {
 
+	// The offset of a resumed query only applies to the first result - the
+	// limit clause is the size of every page
+
+	if rt.rtp.ResumeKey != "" {
+		rt.rtp.offset = 0
+
+		if w := rt.rtp.window; w != nil {
+			rt.rtp.limit = rt.rtp.Page.Limit
+
+			if w.limit != -1 && (rt.rtp.limit == -1 || w.limit < rt.rtp.limit) {
+				rt.rtp.limit = w.limit
+			}
+
+			rt.rtp.window = nil
+		}
+	}
+
 	// Create result object
 
 	res := newSearchResult(rt.rtp.eqlRuntimeProvider)
 
-	// Go through all rows
+	if err := res.startStream(); err != nil {
+		return nil, err
+	}
+
+	// Go through all rows - stop early if the limit and offset can be
+	// applied without seeing all rows
+
+	fullPass := rt.rtp.fullPass()
+
+	// Keep track of the position of the last row if the result can be
+	// resumed
+
+	resumable := rt.rtp.resumable() == ""
+
+	var rowKey string  // Start key of the current row
+	var rowKeyRows int // Number of rows of the current start key
 
 	more, err := rt.rtp.next()
 	for more && err == nil {
 
+		if !fullPass && !res.countOnly && res.produced == rt.rtp.offset+rt.rtp.limit {
+
+			// There is at least one more row beyond the limit
+
+			res.hasMore = true
+
+			if resumable {
+				res.resumeKey = rowKey
+				res.resumeRows = rowKeyRows
+			}
+
+			// Further rows are only counted if the total number of rows
+			// was requested - counted rows are not streamed
+
+			if !rt.rtp.CountTotal {
+				break
+			}
+
+			res.countOnly = true
+		}
+
+		if resumable {
+
+			if key := rt.rtp.rowNode[0].Key(); key != rowKey {
+				rowKey = key
+				rowKeyRows = 0
+			}
+
+			rowKeyRows++
+
+			// Skip the rows of the resume key which are part of the
+			// previous result
+
+			if rowKey == rt.rtp.ResumeKey && rowKeyRows <= rt.rtp.ResumeRows {
+				more, err = rt.rtp.next()
+				continue
+			}
+		}
+
 		// Add row to the result
 
 		if err := res.addRow(rt.rtp.rowNode, rt.rtp.rowEdge); err != nil {
-			return nil, err
+			return nil, rt.rtp.cancelError(err, res.produced)
 		}
 
 		// More on to the next row
@@ -170,9 +364,46 @@ func (rt *getRuntime) gaterResult() (interface{}, error) {
 		more, err = rt.rtp.next()
 	}
 
+	if err != nil {
+		return nil, rt.rtp.cancelError(err, res.produced)
+	}
+
 	// Finish the result
 
+	res.warnings = rt.rtp.warnings
+
 	res.finish()
 
+	if err == nil {
+		err = res.flushStream()
+	}
+
 	return res, err
 }
+
+/*
+resumable checks if a result of the query can be resumed from the position of
+its last row. This requires start nodes which are visited in key order and
+rows which can be returned as soon as they are produced. Returns the reason
+if the result cannot be resumed.
+*/
+func (rtp *GetRuntimeProvider) resumable() string {
+
+	if !rtp.SortedStartKeys || rtp.SampleStartKeys > 0 {
+		return "start nodes are not visited in key order"
+	} else if rtp.groupScope != "" {
+		return "queries with a group scope are not supported"
+	} else if len(rtp.withFlags.ordering) > 0 {
+		return "results with an ordering are not supported"
+	} else if len(rtp.withFlags.notnullCol) > 0 || len(rtp.withFlags.uniqueCol) > 0 || rtp.withFlags.distinct {
+		return "results with filtering are not supported"
+	}
+
+	for _, cf := range rtp.colFunc {
+		if _, ok := cf.(*showAggregate); ok {
+			return "results with aggregation functions are not supported"
+		}
+	}
+
+	return ""
+}
@@ -66,13 +66,14 @@ type valueRuntime struct {
 	isNodeAttrValue bool
 	isEdgeAttrValue bool
 	condVal         string
+	step            int // Spec index of an enclosing step whose attribute is referenced (-1 for the current step)
 }
 
 /*
 valueRuntimeInst returns a new runtime component instance.
 */
 func valueRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Runtime {
-	return &valueRuntime{rtp, node, false, false, ""}
+	return &valueRuntime{rtp, node, false, false, "", -1}
 }
 
 /*
@@ -102,7 +103,7 @@ func (rt *valueRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, e
 
 		funcName := rt.node.Children[0].Token.Val
 
-		funcInst, ok := whereFunc[funcName]
+		funcInst, ok := lookupWhereFunc(funcName)
 		if !ok {
 			return nil, rt.rtp.newRuntimeError(ErrInvalidConstruct,
 				"Unknown function: "+funcName, rt.node)
@@ -137,6 +138,17 @@ func (rt *valueRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, e
 
 	// Check if this is describing a node or edge value
 
+	if rt.step >= 0 && (rt.isNodeAttrValue || rt.isEdgeAttrValue) {
+
+		// Attributes of enclosing steps are taken from the current row
+
+		node, edge = rt.rtp.rowNode[rt.step], rt.rtp.rowEdge[rt.step]
+
+		if node == nil {
+			return nil, nil
+		}
+	}
+
 	if rt.isNodeAttrValue {
 		return node.Attr(rt.condVal), nil
 	} else if rt.isEdgeAttrValue {
@@ -149,5 +161,5 @@ func (rt *valueRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, e
 
 	// Must be a constant value
 
-	return rt.condVal, nil
+	return rt.rtp.comparator().literalValue(rt.condVal, rt.node.Token.Quoted), nil
 }
@@ -0,0 +1,198 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"sort"
+	"strings"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/util"
+)
+
+/*
+Match is the character range of a matched phrase in an attribute value. The
+offsets are counted in runes - Start is the first character of the match and
+End the character after the match.
+*/
+type Match struct {
+	Start int // Offset of the first character
+	End   int // Offset after the last character
+}
+
+/*
+Highlight contains the matches of full text conditions in an attribute of a
+node.
+*/
+type Highlight struct {
+	Kind    string  // Kind of the node
+	Key     string  // Key of the node
+	Attr    string  // Attribute which contains the matches
+	Matches []Match // Matched ranges - ordered and not overlapping
+}
+
+/*
+highlights collects the matches of full text conditions. Matches of a where
+clause are pending until the whole clause was evaluated - they are only kept
+if the node passed the clause.
+*/
+type highlights struct {
+	pending []*Highlight                  // Matches of the current where clause
+	nodes   map[string]map[string][]Match // Matches of nodes which passed a where clause
+	rows    map[string][]*Highlight       // Cached highlights of nodes by source (n:<kind>:<key>)
+}
+
+/*
+newHighlights creates a new highlights object.
+*/
+func newHighlights() *highlights {
+	return &highlights{nil, make(map[string]map[string][]Match), make(map[string][]*Highlight)}
+}
+
+/*
+addPending adds matches of a phrase in an attribute of a node.
+*/
+func (h *highlights) addPending(node data.Node, attr string, matches []Match) {
+	if len(matches) > 0 {
+		h.pending = append(h.pending, &Highlight{node.Kind(), node.Key(), attr, matches})
+	}
+}
+
+/*
+commit keeps or discards all pending matches depending on the result of a
+where clause.
+*/
+func (h *highlights) commit(passed bool) {
+
+	if passed {
+		for _, p := range h.pending {
+			src := "n:" + p.Kind + ":" + p.Key
+
+			attrs, ok := h.nodes[src]
+			if !ok {
+				attrs = make(map[string][]Match)
+				h.nodes[src] = attrs
+			}
+
+			attrs[p.Attr] = mergeMatches(append(attrs[p.Attr], p.Matches...))
+
+			delete(h.rows, src)
+		}
+	}
+
+	h.pending = h.pending[:0]
+}
+
+/*
+forSource returns the highlights of a node with a given source (n:<kind>:<key>)
+ordered by attribute.
+*/
+func (h *highlights) forSource(src string) []*Highlight {
+
+	if ret, ok := h.rows[src]; ok {
+		return ret
+	}
+
+	attrs, ok := h.nodes[src]
+	if !ok {
+		return nil
+	}
+
+	names := make([]string, 0, len(attrs))
+	for attr := range attrs {
+		names = append(names, attr)
+	}
+
+	sort.Strings(names)
+
+	ret := make([]*Highlight, 0, len(names))
+
+	// Node kinds cannot contain a colon
+
+	srcSpec := strings.SplitN(src, ":", 3)
+
+	for _, attr := range names {
+		ret = append(ret, &Highlight{srcSpec[1], srcSpec[2], attr, attrs[attr]})
+	}
+
+	h.rows[src] = ret
+
+	return ret
+}
+
+/*
+phraseMatches finds all occurrences of a phrase in a value. Words are compared
+in the same way as by phrase lookups of the full text index.
+*/
+func phraseMatches(analyzer util.Analyzer, value string, phrase string) []Match {
+	var ret []Match
+
+	words := analyzer.Tokenize(phrase)
+	tokens := analyzer.Tokenize(value)
+
+	if len(words) == 0 {
+		return nil
+	}
+
+	for i := 0; i+len(words) <= len(tokens); i++ {
+		found := true
+
+		for j, word := range words {
+			token := tokens[i+j]
+
+			if token.Word != word.Word || token.Pos != tokens[i].Pos+uint64(j) {
+				found = false
+				break
+			}
+		}
+
+		// Matches can only be highlighted if the analyzer reports offsets
+
+		if last := tokens[i+len(words)-1]; found && last.End > 0 {
+			ret = append(ret, Match{tokens[i].Start, last.End})
+		}
+	}
+
+	return mergeMatches(ret)
+}
+
+/*
+mergeMatches orders a list of matches and merges overlapping matches.
+*/
+func mergeMatches(matches []Match) []Match {
+
+	if len(matches) < 2 {
+		return matches
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Start != matches[j].Start {
+			return matches[i].Start < matches[j].Start
+		}
+		return matches[i].End < matches[j].End
+	})
+
+	ret := matches[:1]
+
+	for _, m := range matches[1:] {
+		last := &ret[len(ret)-1]
+
+		if m.Start < last.End {
+			if m.End > last.End {
+				last.End = m.End
+			}
+		} else {
+			ret = append(ret, m)
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,238 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"fmt"
+	"testing"
+
+	"devt.de/eliasdb/eql/parser"
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+	"devt.de/eliasdb/graph/util"
+)
+
+func TestHighlight(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := graph.NewGraphManager(mgs)
+
+	storeNode := func(kind string, key string, attrs ...string) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", kind)
+		for i := 0; i < len(attrs); i += 2 {
+			node.SetAttr(attrs[i], attrs[i+1])
+		}
+		gm.StoreNode("main", node)
+	}
+
+	storeEdge := func(key string, host string, log string) {
+		edge := data.NewGraphEdge()
+		edge.SetAttr("key", key)
+		edge.SetAttr("kind", "Wrote")
+		edge.SetAttr(data.EdgeEnd1Key, host)
+		edge.SetAttr(data.EdgeEnd1Kind, "Host")
+		edge.SetAttr(data.EdgeEnd1Role, "Host")
+		edge.SetAttr(data.EdgeEnd1Cascading, false)
+		edge.SetAttr(data.EdgeEnd2Key, log)
+		edge.SetAttr(data.EdgeEnd2Kind, "Log")
+		edge.SetAttr(data.EdgeEnd2Role, "Log")
+		edge.SetAttr(data.EdgeEnd2Cascading, false)
+		gm.StoreEdge("main", edge)
+	}
+
+	storeNode("Log", "1", "msg", "Out of memory - still out of Memory", "title", "Memory")
+	storeNode("Log", "2", "msg", "Größe: out out out of memory", "title", "Disk")
+	storeNode("Log", "3", "msg", "Disk is full", "title", "Disk")
+	storeNode("Host", "a", "name", "alpha")
+	storeNode("Host", "b", "name", "beta")
+	storeEdge("e1", "a", "1")
+	storeEdge("e2", "b", "3")
+
+	run := func(query string, highlight bool) (*SearchResult, error) {
+		rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+		rt.SortedStartKeys = true
+		rt.Highlight = highlight
+
+		ast, err := parser.ParseWithRuntime("test", query, rt)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := ast.Runtime.Eval()
+		if err != nil {
+			return nil, err
+		}
+
+		return res.(*SearchResult), nil
+	}
+
+	highlightString := func(res *SearchResult) string {
+		var ret string
+
+		for i, hl := range res.RowHighlights() {
+			ret += fmt.Sprint(i, ":")
+			for _, h := range hl {
+				ret += fmt.Sprintf(" %v:%v:%v%v", h.Kind, h.Key, h.Attr, h.Matches)
+			}
+			ret += "\n"
+		}
+
+		return ret
+	}
+
+	// All occurrences of a phrase are recorded - offsets are counted in runes
+	// and overlapping matches are merged
+
+	res, err := run(`get Log where @phrase(msg, "out of memory") show key`, true)
+	if err != nil || highlightString(res) != `
+0: Log:1:msg[{0 13} {22 35}]
+1: Log:2:msg[{15 28}]
+`[1:] {
+		t.Error("Unexpected result:", highlightString(res), err)
+		return
+	}
+
+	if res, err = run(`get Log where @phrase(msg, "out out") show key`, true); err != nil ||
+		highlightString(res) != `
+0: Log:2:msg[{7 18}]
+`[1:] {
+		t.Error("Unexpected result:", highlightString(res), err)
+		return
+	}
+
+	// Several conditions can match in several attributes of a node
+
+	if res, err = run(`get Log where @phrase(msg, "memory") and @phrase(title, "memory") `+
+		`and @phrase(msg, "still out") show key`, true); err != nil || highlightString(res) != `
+0: Log:1:msg[{7 13} {16 25} {29 35}] Log:1:title[{0 6}]
+`[1:] {
+		t.Error("Unexpected result:", highlightString(res), err)
+		return
+	}
+
+	// Matches are kept if the node passed the where clause
+
+	if res, err = run(`get Log where @phrase(title, "disk") and @phrase(msg, "memory") or key = 3 show key`,
+		true); err != nil || highlightString(res) != `
+0: Log:2:msg[{22 28}] Log:2:title[{0 4}]
+1: Log:3:title[{0 4}]
+`[1:] {
+		t.Error("Unexpected result:", highlightString(res), err)
+		return
+	}
+
+	// Conditions of traversals are recorded for the traversed nodes
+
+	if res, err = run(`get Host traverse :::Log where @phrase(msg, "full") end show name, Log:msg`,
+		true); err != nil || highlightString(res) != `
+0: Log:3:msg[{8 12}]
+`[1:] || fmt.Sprint(res.RowSource(0)) != "[n:Host:b n:Log:3]" {
+		t.Error("Unexpected result:", highlightString(res), res, err)
+		return
+	}
+
+	// Nothing is recorded without the highlight flag
+
+	if res, err = run(`get Log where @phrase(msg, "out of memory") show key`, false); err != nil ||
+		highlightString(res) != "0:\n1:\n" || len(res.RowHighlight(0)) != 0 {
+		t.Error("Unexpected result:", highlightString(res), err)
+		return
+	}
+}
+
+func TestPhraseMatches(t *testing.T) {
+
+	da := &util.DefaultAnalyzer{}
+
+	if res := phraseMatches(da, "The end. THE END!", "the end"); fmt.Sprint(res) != "[{0 7} {9 16}]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := phraseMatches(da, "The end", ""); res != nil {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := phraseMatches(da, "The", "the end"); res != nil {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// N-grams of a phrase overlap
+
+	if res := phraseMatches(util.NewNGramAnalyzer(3), "Ariaria", "aria"); fmt.Sprint(res) != "[{0 7}]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Matches can only be highlighted if the analyzer reports offsets
+
+	if res := phraseMatches(&noOffsetAnalyzer{da}, "The end", "the end"); res != nil {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := mergeMatches([]Match{{5, 8}, {0, 2}, {1, 3}, {3, 4}, {6, 7}}); fmt.Sprint(res) != "[{0 3} {3 4} {5 8}]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Pending matches are discarded if the node failed the where clause
+
+	h := newHighlights()
+	node := data.NewGraphNode()
+	node.SetAttr("key", "a:b")
+	node.SetAttr("kind", "Log")
+
+	h.addPending(node, "msg", []Match{{0, 2}})
+	h.addPending(node, "msg", nil)
+	h.commit(false)
+
+	if res := h.forSource("n:Log:a:b"); res != nil {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	h.addPending(node, "msg", []Match{{0, 2}})
+	h.commit(true)
+
+	if res := h.forSource("n:Log:a:b"); len(res) != 1 || res[0].Key != "a:b" ||
+		fmt.Sprint(res[0].Matches) != "[{0 2}]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	h.addPending(node, "msg", []Match{{1, 4}})
+	h.commit(true)
+
+	if res := h.forSource("n:Log:a:b"); len(res) != 1 || fmt.Sprint(res[0].Matches) != "[{0 4}]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+/*
+noOffsetAnalyzer is an analyzer which does not report the offsets of words.
+*/
+type noOffsetAnalyzer struct {
+	*util.DefaultAnalyzer
+}
+
+func (na *noOffsetAnalyzer) Tokenize(s string) []util.Token {
+	ret := na.DefaultAnalyzer.Tokenize(s)
+	for i := range ret {
+		ret[i].Start, ret[i].End = 0, 0
+	}
+	return ret
+}
@@ -11,6 +11,8 @@
 package interpreter
 
 import (
+	"time"
+
 	"devt.de/eliasdb/eql/parser"
 	"devt.de/eliasdb/graph"
 )
@@ -42,8 +44,8 @@ NewLookupRuntimeProvider creates a new LookupRuntimeProvider object. This provid
 can interpret LOOKUP queries.
 */
 func NewLookupRuntimeProvider(name string, part string, gm *graph.Manager, ni NodeInfo) *LookupRuntimeProvider {
-	return &LookupRuntimeProvider{&eqlRuntimeProvider{name, part, gm, ni, "", false, nil, "",
-		nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil}}
+	return &LookupRuntimeProvider{&eqlRuntimeProvider{name, part, gm, ni, nil, nil, false, 0, 0, 0, false, nil, "", false, false, nil, -1, 0, nil, nil, 0, nil, nil, false, "",
+		nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil}}
 }
 
 /*
@@ -68,7 +70,7 @@ type lookupRuntime struct {
 }
 
 func lookupRuntimeInst(rtp *LookupRuntimeProvider, node *parser.ASTNode) parser.Runtime {
-	return &lookupRuntime{&getRuntime{&GetRuntimeProvider{rtp.eqlRuntimeProvider}, node}, rtp, node}
+	return &lookupRuntime{&getRuntime{&GetRuntimeProvider{rtp.eqlRuntimeProvider, false, 0, "", 0}, node}, rtp, node}
 }
 
 /*
@@ -109,6 +111,12 @@ func (rt *lookupRuntime) Validate() error {
 
 	initErr := rt.rtp.init(startKind, rt.node.Children[initIndex+1:])
 
+	// A query which is only validated does not read any data
+
+	if rt.rtp.validateOnly {
+		return initErr
+	}
+
 	if rt.rtp.groupScope == "" {
 
 		nodePtr := len(keys)
@@ -146,6 +154,8 @@ func (rt *lookupRuntime) Validate() error {
 			return err
 		}
 
+		rt.rtp.stats.Traversals++
+
 		nodePtr := len(nodes)
 
 		// Iterate over all traversed nodes
@@ -175,9 +185,15 @@ Eval evaluate this runtime component.
 */
 func (rt *lookupRuntime) Eval() (interface{}, error) {
 
+	start := time.Now()
+
 	if err := rt.Validate(); err != nil {
 		return nil, err
 	}
 
-	return rt.getRuntime.gaterResult()
+	res, err := rt.getRuntime.gaterResult()
+
+	rt.rtp.finishStats(start)
+
+	return res, err
 }
@@ -0,0 +1,267 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"time"
+
+	"devt.de/eliasdb/eql/parser"
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
+)
+
+// Mutation Runtime
+// ================
+
+/*
+mutationBatchSize is the number of nodes which are changed in a single
+graph transaction.
+*/
+var mutationBatchSize = 1000
+
+/*
+mutationRuntime runs delete and update statements. The nodes which should be
+changed are selected in the same way as the start nodes of a GET query.
+*/
+type mutationRuntime struct {
+	rtp    *GetRuntimeProvider
+	node   *parser.ASTNode
+	where  *parser.ASTNode // Where clause which selects the nodes
+	set    *parser.ASTNode // Assignments of an update statement
+	dryRun bool            // Flag if the changes should not be applied
+}
+
+/*
+mutationRuntimeInst returns a new runtime component instance.
+*/
+func mutationRuntimeInst(rtp *GetRuntimeProvider, node *parser.ASTNode) parser.Runtime {
+	return &mutationRuntime{rtp, node, nil, nil, false}
+}
+
+/*
+Validate and reset this runtime component and all its child components.
+*/
+func (rt *mutationRuntime) Validate() error {
+
+	// First child is always the node kind which should be changed
+
+	kind := rt.node.Children[0]
+
+	rt.where = nil
+	rt.set = nil
+	rt.dryRun = false
+
+	if rt.rtp.SampleStartKeys > 0 {
+		return rt.rtp.newRuntimeError(ErrInvalidConstruct,
+			"Statements which change the graph cannot be sampled", rt.node)
+	}
+
+	var whereFlags []*parser.ASTNode
+
+	for _, child := range rt.node.Children[1:] {
+
+		if child.Name == parser.NodeWHERE {
+			rt.where = child
+
+		} else if child.Name == parser.NodeSET {
+			rt.set = child
+
+		} else if child.Name == parser.NodeWITH {
+
+			// The only flags of a delete or update statement are dryrun
+			// and the flags of the where clause (nocase and strict)
+
+			for _, flag := range child.Children {
+				if flag.Name == parser.NodeNOCASE || flag.Name == parser.NodeSTRICT {
+					whereFlags = append(whereFlags, flag)
+				} else if flag.Name == parser.NodeDRYRUN {
+					rt.dryRun = true
+				} else {
+					return rt.rtp.newRuntimeError(ErrInvalidConstruct, flag.Token.Val, flag)
+				}
+			}
+
+		} else {
+
+			return rt.rtp.newRuntimeError(ErrInvalidConstruct, child.Name, child)
+		}
+	}
+
+	// Select the nodes with a GET query on the node kind
+
+	get := &parser.ASTNode{Name: parser.NodeGET, Token: rt.node.Token,
+		Children: []*parser.ASTNode{kind, rt.where}}
+
+	if len(whereFlags) > 0 {
+		get.Children = append(get.Children, &parser.ASTNode{Name: parser.NodeWITH,
+			Token: whereFlags[0].Token, Children: whereFlags})
+	}
+
+	if err := (&getRuntime{rt.rtp, get}).Validate(); err != nil {
+		return err
+	}
+
+	if rt.set != nil {
+
+		// Reserved attributes cannot be changed
+
+		for _, assign := range rt.set.Children {
+			attr := assign.Children[0].Token.Val
+
+			if attr == data.NodeKey || attr == data.NodeKind {
+				return rt.rtp.newRuntimeError(ErrReservedAttr, attr, assign.Children[0])
+			}
+		}
+
+		// Values of the assignments are resolved in the same way as values
+		// in a where clause
+
+		if err := whereRuntimeInst(rt.rtp.eqlRuntimeProvider, rt.set).Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+Eval evaluate this runtime component. Returns a result with the number of
+nodes which were changed.
+*/
+func (rt *mutationRuntime) Eval() (interface{}, error) {
+
+	start := time.Now()
+
+	if err := rt.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Collect the keys of all matching nodes before changing anything
+
+	var keys []string
+
+	more, err := rt.rtp.next()
+	for more && err == nil {
+		keys = append(keys, rt.rtp.rowNode[0].Key())
+		more, err = rt.rtp.next()
+	}
+
+	if err != nil {
+		return nil, rt.rtp.cancelError(err, 0)
+	}
+
+	label := "Updated"
+	if rt.node.Name == parser.NodeDELETE {
+		label = "Deleted"
+	}
+
+	if rt.dryRun {
+		rt.rtp.addWarning("Dry run - no nodes were changed")
+
+	} else {
+
+		// Apply the changes in batches
+
+		for i := 0; i < len(keys); i += mutationBatchSize {
+
+			if err := rt.rtp.checkCancelled(); err != nil {
+				return nil, rt.rtp.cancelError(err, i)
+			}
+
+			end := i + mutationBatchSize
+			if end > len(keys) {
+				end = len(keys)
+			}
+
+			if err := rt.applyBatch(keys[i:end]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	rt.rtp.finishStats(start)
+
+	return newMutationResult(rt.rtp.eqlRuntimeProvider, label, len(keys))
+}
+
+/*
+applyBatch changes a batch of nodes in a single transaction. Deleted nodes
+are removed according to the cascading rules of their edges and updated
+nodes are reindexed.
+*/
+func (rt *mutationRuntime) applyBatch(keys []string) error {
+	kind := rt.node.Children[0].Token.Val
+
+	trans := graph.NewGraphTrans(rt.rtp.gm)
+
+	for _, key := range keys {
+
+		if rt.set == nil {
+
+			if err := trans.RemoveNode(rt.rtp.part, key, kind); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		node, err := rt.rtp.gm.FetchNode(rt.rtp.part, key, kind)
+		rt.rtp.stats.NodeFetches++
+
+		if err != nil {
+			return err
+		} else if node == nil {
+			continue
+		}
+
+		// All values are calculated from the old node - a null value
+		// removes an attribute
+
+		newNode := data.NewGraphNode()
+		for attr, val := range node.Data() {
+			newNode.SetAttr(attr, val)
+		}
+
+		for _, assign := range rt.set.Children {
+			val, err := assign.Children[1].Runtime.(CondRuntime).CondEval(node, nil)
+			if err != nil {
+				return err
+			} else if val == invalid {
+				val = nil
+			}
+
+			newNode.SetAttr(assign.Children[0].Token.Val, val)
+		}
+
+		if err := trans.StoreNode(rt.rtp.part, newNode); err != nil {
+			return err
+		}
+	}
+
+	return trans.Commit()
+}
+
+/*
+newMutationResult creates a result which contains the number of changed nodes.
+*/
+func newMutationResult(rtp *eqlRuntimeProvider, label string, count int) (*SearchResult, error) {
+
+	sr := &SearchResult{rtp.name, &withFlags{}, -1, 0, nil, false, 1, 1, false, 0, "", 0, rtp.Stream, false,
+		SearchHeader{rtp.primaryKind, []string{label}, []string{"auto"}, []string{"1:func:count()"}},
+		[]FuncShow{nil}, [][]string{{""}}, [][]interface{}{{count}},
+		nil, nil, nil, rtp.warnings, nil, rtp.stats}
+
+	if err := sr.startStream(); err != nil {
+		return nil, err
+	}
+
+	return sr, sr.flushStream()
+}
@@ -0,0 +1,176 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"fmt"
+	"testing"
+
+	"devt.de/eliasdb/eql/parser"
+)
+
+func TestMutations(t *testing.T) {
+	gm, _ := songGraph()
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+
+	runMutation := func(query string) (*SearchResult, error) {
+		ast, err := parser.ParseWithRuntime("test", query, rt)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := ast.Runtime.Eval()
+		if err != nil {
+			return nil, err
+		}
+
+		return res.(*SearchResult), nil
+	}
+
+	// A where clause is required
+
+	if _, err := runMutation("delete from Song"); err == nil || err.Error() !=
+		"Parse error in test: Missing where clause (delete) (Line:1 Pos:1)" {
+		t.Error(err)
+		return
+	}
+
+	if _, err := runMutation("update Song set ranking = 1"); err == nil || err.Error() !=
+		"Parse error in test: Missing where clause (update) (Line:1 Pos:1)" {
+		t.Error(err)
+		return
+	}
+
+	// A dry run only counts the nodes
+
+	res, err := runMutation("delete from Song where ranking < 5 with dryrun")
+
+	if err != nil || res.String() != `
+Labels: Deleted
+Format: auto
+Data: 1:func:count()
+4
+`[1:] || fmt.Sprint(res.Warnings()) != "[Dry run - no nodes were changed]" || gm.NodeCount("Song") != 9 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Nodes are deleted in batches
+
+	mutationBatchSize = 3
+	defer func() {
+		mutationBatchSize = 1000
+	}()
+
+	res, err = runMutation("delete from Song where ranking < 5")
+
+	if err != nil || fmt.Sprint(res.Rows()) != "[[4]]" || len(res.Warnings()) != 0 || gm.NodeCount("Song") != 5 {
+		t.Error("Unexpected result:", res, err, gm.NodeCount("Song"))
+		return
+	}
+
+	// Cascading rules are respected
+
+	res, err = runMutation("delete from Author where name = Hans")
+
+	if err != nil || fmt.Sprint(res.Rows()) != "[[1]]" || gm.NodeCount("Author") != 2 || gm.NodeCount("Song") != 4 {
+		t.Error("Unexpected result:", res, err, gm.NodeCount("Song"))
+		return
+	}
+
+	// Values of an update are calculated from the old node
+
+	res, err = runMutation("update Song set ranking = ranking * 10, genre = Opera where key beginswith Aria")
+
+	if err != nil || fmt.Sprint(res.Rows()) != "[[2]]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if err := runSearch("get Song where genre = Opera show key, ranking, genre", `
+Labels: Song Key, Ranking, Genre
+Format: auto, auto, auto
+Data: 1:n:key, 1:n:ranking, 1:n:genre
+Aria1, 80, Opera
+Aria4, 180, Opera
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// The index is updated
+
+	iq, _ := gm.NodeIndexQuery("main", "Song")
+
+	if keys, err := iq.LookupValue("genre", "Opera"); err != nil || fmt.Sprint(keys) != "[Aria1 Aria4]" {
+		t.Error("Unexpected result:", keys, err)
+		return
+	}
+
+	// A null value removes an attribute
+
+	res, err = runMutation("update Song set genre = null where key = Aria1")
+
+	if err != nil || fmt.Sprint(res.Rows()) != "[[1]]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if node, _ := gm.FetchNode("main", "Aria1", "Song"); node.Attr("genre") != nil || fmt.Sprint(node.Attr("ranking")) != "80" {
+		t.Error("Unexpected result:", node)
+		return
+	}
+
+	// Reserved attributes cannot be changed
+
+	if _, err := runMutation("update Song set key = 1 where true"); err == nil || err.Error() !=
+		"EQL error in test: Reserved attribute cannot be changed (key) (Line:1 Pos:17)" {
+		t.Error(err)
+		return
+	}
+
+	// Only where and with dryrun clauses are allowed
+
+	if _, err := runMutation("delete from Song where true show key"); err == nil || err.Error() !=
+		"EQL error in test: Invalid construct (show) (Line:1 Pos:29)" {
+		t.Error(err)
+		return
+	}
+
+	if _, err := runMutation("delete from Song where true with distinct"); err == nil || err.Error() !=
+		"EQL error in test: Invalid construct (distinct) (Line:1 Pos:34)" {
+		t.Error(err)
+		return
+	}
+
+	if _, err := runMutation("delete from Unknown where true"); err == nil || err.Error() !=
+		"EQL error in test: Unknown node kind (Unknown) (Line:1 Pos:13)" {
+		t.Error(err)
+		return
+	}
+
+	// Dry run flags are only allowed for statements which change the graph
+
+	if err := runSearch("get Song with dryrun", "", rt); err == nil || err.Error() !=
+		"EQL error in test: Invalid construct (dryrun) (Line:1 Pos:15)" {
+		t.Error(err)
+		return
+	}
+
+	// All nodes of a kind are changed with an explicit where true
+
+	res, err = runMutation("delete from Song where true")
+
+	if err != nil || fmt.Sprint(res.Rows()) != "[[4]]" || gm.NodeCount("Song") != 0 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+}
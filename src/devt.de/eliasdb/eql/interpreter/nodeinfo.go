@@ -12,6 +12,7 @@ package interpreter
 
 import (
 	"sort"
+	"sync"
 
 	"devt.de/common/stringutil"
 	"devt.de/eliasdb/graph"
@@ -40,6 +41,50 @@ type NodeInfo interface {
 	IsValidAttr(attr string) bool
 }
 
+/*
+Registry for NodeInfo objects of specific node kinds
+*/
+var kindNodeInfos = make(map[string]NodeInfo)
+var kindNodeInfosLock = &sync.RWMutex{}
+
+/*
+RegisterNodeInfo registers a NodeInfo object for a specific node kind. The
+interpreter uses a registered NodeInfo object for column labels and for the
+columns of queries without a show clause. The SummaryAttributes of the
+registered object fully control which columns are shown and in which order.
+*/
+func RegisterNodeInfo(kind string, ni NodeInfo) {
+	kindNodeInfosLock.Lock()
+	defer kindNodeInfosLock.Unlock()
+
+	kindNodeInfos[kind] = ni
+}
+
+/*
+UnregisterNodeInfo removes a registered NodeInfo object for a node kind.
+*/
+func UnregisterNodeInfo(kind string) {
+	kindNodeInfosLock.Lock()
+	defer kindNodeInfosLock.Unlock()
+
+	delete(kindNodeInfos, kind)
+}
+
+/*
+kindNodeInfo returns the registered NodeInfo object for a node kind. Falls
+back to a given NodeInfo object if no object was registered for the kind.
+*/
+func kindNodeInfo(ni NodeInfo, kind string) NodeInfo {
+	kindNodeInfosLock.RLock()
+	defer kindNodeInfosLock.RUnlock()
+
+	if kni, ok := kindNodeInfos[kind]; ok {
+		return kni
+	}
+
+	return ni
+}
+
 /*
 defaultNodeInfo data structure
 */
@@ -87,12 +132,30 @@ func (ni *defaultNodeInfo) SummaryAttributes(kind string) []string {
 }
 
 /*
-Return the display string for a given attribute.
+Return the display string for a given attribute. Labels from the kind
+metadata are preferred over generated display strings.
 */
 func (ni *defaultNodeInfo) AttributeDisplayString(kind string, attr string) string {
+	var meta *graph.KindMeta
+
+	if kind != "" {
+		meta = ni.gm.KindMeta(kind)
+	}
+
+	if meta != nil {
+		if label, ok := meta.AttrLabels[attr]; ok && label != "" {
+			return label
+		}
+	}
+
 	if (attr == data.NodeKey || attr == data.NodeKind || attr == data.NodeName) && kind != "" {
-		return stringutil.CreateDisplayString(kind) + " " +
-			stringutil.CreateDisplayString(attr)
+		kindLabel := stringutil.CreateDisplayString(kind)
+
+		if meta != nil && meta.Label != "" {
+			kindLabel = meta.Label
+		}
+
+		return kindLabel + " " + stringutil.CreateDisplayString(attr)
 	}
 
 	return stringutil.CreateDisplayString(attr)
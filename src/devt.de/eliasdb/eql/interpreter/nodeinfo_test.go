@@ -0,0 +1,175 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"testing"
+
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+func TestNodeInfoKindMeta(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := graph.NewGraphManager(mgs)
+	ni := NewDefaultNodeInfo(gm)
+
+	if res := ni.AttributeDisplayString("usr", "key"); res != "Usr Key" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := ni.AttributeDisplayString("usr", "lastlogin"); res != "Lastlogin" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	gm.SetKindMeta("usr", &graph.KindMeta{
+		Label:       "User account",
+		Description: "Account of a user",
+		AttrLabels:  map[string]string{"lastlogin": "Last login", "name": "Full name"},
+	})
+
+	if res := ni.AttributeDisplayString("usr", "key"); res != "User account Key" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := ni.AttributeDisplayString("usr", "name"); res != "Full name" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := ni.AttributeDisplayString("usr", "lastlogin"); res != "Last login" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := ni.AttributeDisplayString("usr", "email"); res != "Email" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := ni.AttributeDisplayString("", "lastlogin"); res != "Lastlogin" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+/*
+userNodeInfo is a NodeInfo object for user nodes
+*/
+type userNodeInfo struct {
+	NodeInfo
+}
+
+func (ni *userNodeInfo) SummaryAttributes(kind string) []string {
+	return []string{"email", "last_login", "key"}
+}
+
+func (ni *userNodeInfo) AttributeDisplayString(kind string, attr string) string {
+	if attr == "last_login" {
+		return "Last seen"
+	}
+	return ni.NodeInfo.AttributeDisplayString(kind, attr)
+}
+
+func TestRegisterNodeInfo(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := graph.NewGraphManager(mgs)
+
+	group := data.NewGraphNode()
+	group.SetAttr("key", "g1")
+	group.SetAttr("kind", "Group")
+	group.SetAttr("name", "Admins")
+	gm.StoreNode("main", group)
+
+	for _, user := range [][]string{{"u1", "a@b.c", "2020-01-01"}, {"u2", "d@e.f", "2020-02-01"}} {
+		node := data.NewGraphNode()
+		node.SetAttr("key", user[0])
+		node.SetAttr("kind", "User")
+		node.SetAttr("email", user[1])
+		node.SetAttr("last_login", user[2])
+		node.SetAttr("password", "secret")
+		gm.StoreNode("main", node)
+
+		edge := data.NewGraphEdge()
+		edge.SetAttr("key", user[0])
+		edge.SetAttr("kind", "Member")
+		edge.SetAttr(data.EdgeEnd1Key, "g1")
+		edge.SetAttr(data.EdgeEnd1Kind, "Group")
+		edge.SetAttr(data.EdgeEnd1Role, "group")
+		edge.SetAttr(data.EdgeEnd1Cascading, false)
+		edge.SetAttr(data.EdgeEnd2Key, user[0])
+		edge.SetAttr(data.EdgeEnd2Kind, "User")
+		edge.SetAttr(data.EdgeEnd2Role, "member")
+		edge.SetAttr(data.EdgeEnd2Cascading, false)
+		gm.StoreEdge("main", edge)
+	}
+
+	ni := NewDefaultNodeInfo(gm)
+	rt := NewGetRuntimeProvider("test", "main", gm, ni)
+	rt.SortedStartKeys = true
+
+	RegisterNodeInfo("User", &userNodeInfo{ni})
+	defer UnregisterNodeInfo("User")
+
+	// The registered NodeInfo controls the columns of the User kind
+
+	if _, err := getResult("get User", `
+Labels: Email, Last seen, User Key
+Format: auto, auto, auto
+Data: 1:n:email, 1:n:last_login, 1:n:key
+a@b.c, 2020-01-01, u1
+d@e.f, 2020-02-01, u2
+`[1:], rt, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Other kinds still use the default NodeInfo
+
+	if _, err := getResult("get Group traverse :::User end", `
+Labels: Group Key, Group Name, Email, Last seen, User Key
+Format: auto, auto, auto, auto, auto
+Data: 1:n:key, 1:n:name, 2:n:email, 2:n:last_login, 2:n:key
+g1, Admins, a@b.c, 2020-01-01, u1
+g1, Admins, d@e.f, 2020-02-01, u2
+`[1:], rt, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get User show key, User:last_login, password", `
+Labels: User Key, Last seen, Password
+Format: auto, auto, auto
+Data: 1:n:key, 1:n:last_login, 1:n:password
+u1, 2020-01-01, secret
+u2, 2020-02-01, secret
+`[1:], rt, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	UnregisterNodeInfo("User")
+
+	if _, err := getResult("get User show key, User:last_login", `
+Labels: User Key, Last Login
+Format: auto, auto
+Data: 1:n:key, 1:n:last_login
+u1, 2020-01-01
+u2, 2020-02-01
+`[1:], rt, false); err != nil {
+		t.Error(err)
+		return
+	}
+}
@@ -0,0 +1,207 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"devt.de/eliasdb/graph/data"
+)
+
+/*
+fetchWindow is the number of start nodes and traversal source nodes per
+worker which are fetched ahead of the evaluation
+*/
+const fetchWindow = 2
+
+/*
+fetchPool fetches start nodes and traversals of a query on a bounded number
+of workers. The pool only does the storage access - conditions are evaluated
+and rows are produced by the query itself which takes the fetched data in
+the same order as a sequential run. The rows of a query are therefore the
+same for any number of workers.
+
+The pool is only used by the goroutine which runs the query - the fetches
+which run on the workers get copies of all query state they need.
+*/
+type fetchPool struct {
+	workers chan struct{}             // Semaphore which bounds the number of running fetches
+	window  int                       // Number of items which are fetched ahead
+	pending map[fetchKey]*fetchFuture // Fetches which have not been taken yet
+	roots   []string                  // Start keys which are fetched ahead
+}
+
+/*
+fetchKey identifies a fetch. The traversal runtime is nil for start nodes.
+*/
+type fetchKey struct {
+	trav *traversalRuntime
+	key  string
+	kind string
+}
+
+/*
+fetchFuture is the result of a fetch which becomes available once the done
+channel is closed.
+*/
+type fetchFuture struct {
+	done  chan struct{}
+	node  data.Node   // Fetched start node
+	nodes []data.Node // Fetched traversal nodes
+	edges []data.Edge // Fetched traversal edges
+	err   error       // Error of the fetch
+}
+
+/*
+newFetchPool creates a new fetch pool with a given number of workers.
+*/
+func newFetchPool(workers int) *fetchPool {
+	return &fetchPool{make(chan struct{}, workers), workers * fetchWindow,
+		make(map[fetchKey]*fetchFuture), nil}
+}
+
+/*
+run schedules a fetch if it is not already pending.
+*/
+func (fp *fetchPool) run(key fetchKey, fetch func(ff *fetchFuture)) {
+
+	if _, ok := fp.pending[key]; ok {
+		return
+	}
+
+	ff := &fetchFuture{done: make(chan struct{})}
+
+	fp.pending[key] = ff
+
+	go func() {
+		fp.workers <- struct{}{}
+		defer func() {
+			<-fp.workers
+			close(ff.done)
+		}()
+
+		fetch(ff)
+	}()
+}
+
+/*
+take waits for a pending fetch and removes it from the pool. Returns nil if
+the fetch was not scheduled.
+*/
+func (fp *fetchPool) take(key fetchKey) *fetchFuture {
+
+	ff, ok := fp.pending[key]
+
+	if ok {
+		delete(fp.pending, key)
+		<-ff.done
+	}
+
+	return ff
+}
+
+/*
+discard removes a pending fetch whose result is not needed anymore.
+*/
+func (fp *fetchPool) discard(key fetchKey) {
+	delete(fp.pending, key)
+}
+
+/*
+nextStartKey returns the next start key of the query. Start nodes and the
+top level traversals of the following start keys are fetched ahead.
+*/
+func (fp *fetchPool) nextStartKey(p *eqlRuntimeProvider) (string, error) {
+
+	for len(fp.roots) < fp.window {
+		startKey, err := p.nextStartKey()
+
+		if err != nil {
+			return "", err
+		} else if startKey == "" {
+			break
+		}
+
+		fp.roots = append(fp.roots, startKey)
+
+		fp.fetchStartNode(p, startKey)
+
+		for _, child := range p.traversals {
+			fp.fetchTraversal(child.Runtime.(*traversalRuntime), startKey, p.specs[0])
+		}
+	}
+
+	if len(fp.roots) == 0 {
+		return "", nil
+	}
+
+	startKey := fp.roots[0]
+	fp.roots = fp.roots[1:]
+
+	return startKey, nil
+}
+
+/*
+fetchStartNode schedules the fetch of a start node.
+*/
+func (fp *fetchPool) fetchStartNode(p *eqlRuntimeProvider, key string) {
+	kind := p.specs[0]
+	attrs := append(append([]string(nil), p._attrsNodesFetch[0]...), "key")
+
+	fp.run(fetchKey{nil, key, kind}, func(ff *fetchFuture) {
+		if ff.err = p.checkCancelled(); ff.err == nil {
+			ff.node, ff.err = p.gm.FetchNodePart(p.part, key, kind, attrs)
+		}
+	})
+}
+
+/*
+fetchTraversal schedules the fetch of a traversal from a given source node.
+*/
+func (fp *fetchPool) fetchTraversal(rt *traversalRuntime, key string, kind string) {
+	spec := rt.spec
+	nodeAttrs := rt.rtp._attrsNodesFetch[rt.specIndex]
+	edgeAttrs := rt.rtp._attrsEdgesFetch[rt.specIndex]
+
+	fp.run(fetchKey{rt, key, kind}, func(ff *fetchFuture) {
+		ff.nodes, ff.edges, ff.err = fetchTraversal(rt.rtp, spec, nodeAttrs, edgeAttrs, key, kind)
+	})
+}
+
+/*
+fetchChildren schedules the fetch of the deeper traversals of the nodes of a
+traversal result which will be visited next.
+*/
+func (fp *fetchPool) fetchChildren(rt *traversalRuntime) {
+
+	for ; rt.fetched < len(rt.nodes) && rt.fetched < rt.curptr+fp.window; rt.fetched++ {
+		node := rt.nodes[rt.fetched]
+
+		for _, child := range rt.node.Children[1:] {
+			if childRuntime, ok := child.Runtime.(*traversalRuntime); ok {
+				fp.fetchTraversal(childRuntime, node.Key(), node.Kind())
+			}
+		}
+	}
+}
+
+/*
+discardChildren removes the pending fetches of the deeper traversals of a
+traversal result which were not visited.
+*/
+func (fp *fetchPool) discardChildren(rt *traversalRuntime) {
+
+	for _, node := range rt.nodes[:rt.fetched] {
+		for _, child := range rt.node.Children[1:] {
+			if childRuntime, ok := child.Runtime.(*traversalRuntime); ok {
+				fp.discard(fetchKey{childRuntime, node.Key(), node.Kind()})
+			}
+		}
+	}
+}
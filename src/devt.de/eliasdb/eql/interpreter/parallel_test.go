@@ -0,0 +1,195 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"devt.de/eliasdb/eql/parser"
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+	"devt.de/eliasdb/storage"
+)
+
+func TestParallelFetch(t *testing.T) {
+	gm, _ := reviewGraph()
+	sgm, _ := songGraph()
+
+	rows := func(gm *graph.Manager, query string, workers int, maxNodes int) string {
+		rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+		rt.SortedStartKeys = true
+		rt.Workers = workers
+		rt.MaxNodes = maxNodes
+
+		ast, err := parser.ParseWithRuntime("test", query, rt)
+		if err != nil {
+			return err.Error()
+		}
+
+		res, err := ast.Runtime.Eval()
+		if err != nil {
+			return err.Error()
+		}
+
+		return fmt.Sprint(res.(*SearchResult).Rows())
+	}
+
+	// The rows of a query are the same for any number of workers (traversal
+	// results are only visited in a stable order if the start keys are sorted)
+
+	for _, test := range []struct {
+		gm       *graph.Manager
+		query    string
+		maxNodes int
+	}{
+		{gm, "get Author traverse :::Book traverse :::Review where rating > 4 end end show 1:n:key, 2:n:key, 3:n:key", 0},
+		{gm, "get Author traverse :::Book traverse :::Review where rating < 3 end end show 1:n:key, 2:n:key, 3:n:key", 0},
+		{gm, "get Person traverse :Knows::Person end traverse :::Review end show 1:n:key, 2:n:key", 0},
+		{gm, "get Person where age < 25 traverse :Knows::Person traverse :Knows::Person where key != p3 end end show 1:n:key, 3:n:key", 0},
+		{gm, "get Author where key = a1 traverse :::Book traverse :::Review end end show 1:n:key, 2:n:key, 3:n:key with nulltraversal(true)", 0},
+		{sgm, "get Author traverse :::Song end show name, Song:name, Song:ranking", 0},
+		{sgm, "get Author where name != Hans traverse :::Song where ranking > 2 end show name, Song:name", 0},
+		{sgm, "get Author traverse :::Song end traverse :::Song end show 1:n:key, 2:n:key, 3:n:key limit 5", 0},
+		{sgm, "get Author show name, @count(1, :::Song)", 0},
+		{sgm, "lookup Author '000', '123', '999', '456' traverse :::Song end show name, Song:name", 0},
+		{sgm, "get Author traverse :::Song end show key, Song:key", 7},
+	} {
+		expected := rows(test.gm, test.query, 1, test.maxNodes)
+
+		for _, workers := range []int{2, 4, 16} {
+			if res := rows(test.gm, test.query, workers, test.maxNodes); res != expected {
+				t.Error("Unexpected result:", test.query, workers, res, "expected:", expected)
+			}
+		}
+	}
+}
+
+/*
+latencyGraphStorage is a memory graph storage whose storage managers wait
+for a given time on each read to simulate a slow storage.
+*/
+type latencyGraphStorage struct {
+	graphstorage.GraphStorage
+	latency time.Duration
+	sms     map[string]storage.Manager
+	lock    sync.Mutex
+}
+
+func (lgs *latencyGraphStorage) StorageManager(smname string, create bool) storage.Manager {
+	lgs.lock.Lock()
+	defer lgs.lock.Unlock()
+
+	if sm, ok := lgs.sms[smname]; ok {
+		return sm
+	}
+
+	sm := lgs.GraphStorage.StorageManager(smname, create)
+	if sm == nil {
+		return nil
+	}
+
+	lsm := &latencyStorageManager{sm, lgs}
+	lgs.sms[smname] = lsm
+
+	return lsm
+}
+
+type latencyStorageManager struct {
+	storage.Manager
+	lgs *latencyGraphStorage
+}
+
+func (lsm *latencyStorageManager) Fetch(loc uint64, o interface{}) error {
+	time.Sleep(lsm.lgs.latency)
+	return lsm.Manager.Fetch(loc, o)
+}
+
+func (lsm *latencyStorageManager) FetchCached(loc uint64) (interface{}, error) {
+	time.Sleep(lsm.lgs.latency)
+	return lsm.Manager.FetchCached(loc)
+}
+
+func BenchmarkParallelFetch(b *testing.B) {
+	lgs := &latencyGraphStorage{graphstorage.NewMemoryGraphStorage("mystorage"), 0,
+		make(map[string]storage.Manager), sync.Mutex{}}
+	gm := graph.NewGraphManager(lgs)
+
+	storeNode := func(key string, kind string) data.Node {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", kind)
+		node.SetAttr("name", "Node "+key)
+		gm.StoreNode("main", node)
+		return node
+	}
+
+	storeEdge := func(node1 data.Node, node2 data.Node) {
+		edge := data.NewGraphEdge()
+		edge.SetAttr("key", node1.Key()+"-"+node2.Key())
+		edge.SetAttr("kind", "Link")
+		edge.SetAttr(data.EdgeEnd1Key, node1.Key())
+		edge.SetAttr(data.EdgeEnd1Kind, node1.Kind())
+		edge.SetAttr(data.EdgeEnd1Role, "Parent")
+		edge.SetAttr(data.EdgeEnd1Cascading, false)
+		edge.SetAttr(data.EdgeEnd2Key, node2.Key())
+		edge.SetAttr(data.EdgeEnd2Kind, node2.Kind())
+		edge.SetAttr(data.EdgeEnd2Role, "Child")
+		edge.SetAttr(data.EdgeEnd2Cascading, false)
+		gm.StoreEdge("main", edge)
+	}
+
+	// Each start node fans out to 8 nodes which fan out to 4 nodes each
+
+	for i := 0; i < 4; i++ {
+		root := storeNode(fmt.Sprint("r", i), "Root")
+
+		for j := 0; j < 8; j++ {
+			mid := storeNode(fmt.Sprint("m", i, "-", j), "Mid")
+			storeEdge(root, mid)
+
+			for k := 0; k < 4; k++ {
+				storeEdge(mid, storeNode(fmt.Sprint("l", i, "-", j, "-", k), "Leaf"))
+			}
+		}
+	}
+
+	// Every read of the storage takes some time
+
+	lgs.latency = 20 * time.Microsecond
+
+	query := "get Root traverse :Link:Child:Mid traverse :Link:Child:Leaf end end " +
+		"show name, Mid:name, Leaf:name"
+
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprint("Workers", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+				rt.SortedStartKeys = true
+				rt.Workers = workers
+
+				ast, err := parser.ParseWithRuntime("test", query, rt)
+				if err != nil {
+					b.Error(err)
+					return
+				}
+
+				if res, err := ast.Runtime.Eval(); err != nil || len(res.(*SearchResult).Data) != 128 {
+					b.Error("Unexpected result:", err)
+					return
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"math"
+	"sort"
+)
+
+/*
+quantileCompression is the compression of a quantile digest. A digest holds
+at most quantileCompression + 1 centroids.
+*/
+const quantileCompression = 100
+
+/*
+quantileBufferSize is the number of values which are buffered before they are
+merged into the centroids of a quantile digest. Quantiles of up to this number
+of values are exact.
+*/
+const quantileBufferSize = 5 * quantileCompression
+
+/*
+centroid is a group of adjacent values of a quantile digest.
+*/
+type centroid struct {
+	mean   float64 // Mean of all values of the centroid
+	weight float64 // Number of values of the centroid
+}
+
+/*
+quantileDigest estimates quantiles of a stream of values with bounded memory
+(merging t-digest). Values are buffered and merged in batches into sorted
+centroids. The size of a centroid is limited by the scale function
+k(q) = compression / 2pi * asin(2q - 1) - a centroid may only cover the
+quantile range in which k grows by 1. Centroids at the tails are therefore
+small and the estimates of extreme quantiles are more accurate than those of
+quantiles near the median.
+
+A digest holds at most quantileBufferSize values and quantileCompression + 1
+centroids regardless of the number of added values. As long as no more than
+quantileBufferSize values were added the digest holds all values and its
+quantiles are exact. Otherwise a centroid covers at most the quantile range
+2pi * sqrt(q(1 - q)) / compression around the quantile q - the rank of an
+estimated quantile differs from the requested rank by no more than this
+fraction of all values (about 3.1% at the median and 1.4% at the 95th
+percentile). If values are repeated an estimate may also lie between two
+adjacent distinct values. The smallest and largest values are always exact.
+*/
+type quantileDigest struct {
+	centroids []centroid // Centroids ordered by their mean
+	buffer    []float64  // Values which are not yet merged into the centroids
+	count     float64    // Number of all added values
+	min       float64    // Smallest added value
+	max       float64    // Largest added value
+}
+
+/*
+newQuantileDigest creates a new empty quantile digest.
+*/
+func newQuantileDigest() *quantileDigest {
+	return &quantileDigest{nil, make([]float64, 0, quantileBufferSize), 0, 0, 0}
+}
+
+/*
+add adds a value to the digest.
+*/
+func (d *quantileDigest) add(val float64) {
+
+	if d.count == 0 || val < d.min {
+		d.min = val
+	}
+	if d.count == 0 || val > d.max {
+		d.max = val
+	}
+
+	if len(d.buffer) == quantileBufferSize {
+		d.compress()
+	}
+
+	d.count++
+	d.buffer = append(d.buffer, val)
+}
+
+/*
+compress merges all buffered values into the centroids.
+*/
+func (d *quantileDigest) compress() {
+
+	if len(d.buffer) == 0 {
+		return
+	}
+
+	sort.Float64s(d.buffer)
+
+	// Merge the buffered values with the existing centroids
+
+	merged := make([]centroid, 0, len(d.centroids)+len(d.buffer))
+
+	i, j := 0, 0
+	for i < len(d.centroids) || j < len(d.buffer) {
+		if j == len(d.buffer) || (i < len(d.centroids) && d.centroids[i].mean <= d.buffer[j]) {
+			merged = append(merged, d.centroids[i])
+			i++
+		} else {
+			merged = append(merged, centroid{d.buffer[j], 1})
+			j++
+		}
+	}
+
+	d.buffer = d.buffer[:0]
+
+	// Combine adjacent centroids as long as they stay within the size limit
+
+	centroids := make([]centroid, 0, quantileCompression)
+	current := merged[0]
+	weight := 0.0
+	kLeft := quantileScale(0)
+
+	for _, c := range merged[1:] {
+
+		if quantileScale((weight+current.weight+c.weight)/d.count)-kLeft <= 1 {
+			current.weight += c.weight
+			current.mean += (c.mean - current.mean) * c.weight / current.weight
+			continue
+		}
+
+		centroids = append(centroids, current)
+		weight += current.weight
+		kLeft = quantileScale(weight / d.count)
+		current = c
+	}
+
+	d.centroids = append(centroids, current)
+}
+
+/*
+quantileScale is the scale function which limits the size of centroids.
+*/
+func quantileScale(q float64) float64 {
+	return quantileCompression / (2 * math.Pi) * math.Asin(2*math.Min(q, 1)-1)
+}
+
+/*
+quantile returns the (estimated) q-quantile (0 <= q <= 1) of all values. The
+quantile is interpolated linearly between the closest ranks - the exact
+quantile of the values x(0) <= ... <= x(n-1) is x(h) with h = q(n - 1) where
+x(h) is interpolated between x(floor(h)) and x(ceil(h)). The centroids of the
+digest are placed at the center of the ranks of their values. Returns NaN
+if no values were added.
+*/
+func (d *quantileDigest) quantile(q float64) float64 {
+
+	if d.count == 0 {
+		return math.NaN()
+	}
+
+	h := q * (d.count - 1)
+
+	if d.centroids == nil {
+
+		// All values are still available - compute the exact quantile
+
+		sort.Float64s(d.buffer)
+
+		low := int(math.Floor(h))
+		if low >= len(d.buffer)-1 {
+			return d.buffer[len(d.buffer)-1]
+		}
+
+		return d.buffer[low] + (h-float64(low))*(d.buffer[low+1]-d.buffer[low])
+	}
+
+	d.compress()
+
+	// The smallest and largest values are known exactly (the values of
+	// centroids may overlap so they are not necessarily part of the first
+	// or last centroid)
+
+	if q <= 0 {
+		return d.min
+	} else if q >= 1 {
+		return d.max
+	}
+
+	// Interpolate between the centers of the centroids
+
+	prevRank, prevMean := 0.0, d.min
+	weight := 0.0
+
+	for _, c := range d.centroids {
+		rank := weight + (c.weight-1)/2
+
+		if h <= rank {
+			return prevMean + (h-prevRank)/(rank-prevRank)*(c.mean-prevMean)
+		}
+
+		prevRank, prevMean = rank, c.mean
+		weight += c.weight
+	}
+
+	if lastRank := d.count - 1; lastRank > prevRank {
+		return prevMean + (h-prevRank)/(lastRank-prevRank)*(d.max-prevMean)
+	}
+
+	return d.max
+}
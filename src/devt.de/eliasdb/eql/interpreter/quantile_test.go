@@ -0,0 +1,146 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+/*
+exactQuantile calculates the exact quantile of a sorted list of values.
+*/
+func exactQuantile(sorted []float64, q float64) float64 {
+	h := q * float64(len(sorted)-1)
+	low := int(math.Floor(h))
+
+	if low == len(sorted)-1 {
+		return sorted[low]
+	}
+
+	return sorted[low] + (h-float64(low))*(sorted[low+1]-sorted[low])
+}
+
+func TestQuantileDigestExact(t *testing.T) {
+	d := newQuantileDigest()
+
+	if res := d.quantile(0.5); !math.IsNaN(res) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	d.add(4)
+
+	if res := d.quantile(0); res != 4 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	for _, v := range []float64{1, 3, 2} {
+		d.add(v)
+	}
+
+	for q, expected := range map[float64]float64{0: 1, 0.25: 1.75, 0.5: 2.5, 0.9: 3.7, 1: 4} {
+		if res := d.quantile(q); math.Abs(res-expected) > 1e-9 {
+			t.Error("Unexpected result:", q, res, expected)
+			return
+		}
+	}
+
+	// Digests of up to quantileBufferSize values are exact
+
+	r := rand.New(rand.NewSource(1))
+
+	for _, n := range []int{2, 7, 100, quantileBufferSize} {
+		d := newQuantileDigest()
+		values := make([]float64, n)
+
+		for i := range values {
+			values[i] = math.Floor(r.NormFloat64()*1000) / 10
+			d.add(values[i])
+		}
+
+		sort.Float64s(values)
+
+		for _, q := range []float64{0, 0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 1} {
+			if res, expected := d.quantile(q), exactQuantile(values, q); math.Abs(res-expected) > 1e-9 {
+				t.Error("Unexpected result:", n, q, res, expected)
+				return
+			}
+		}
+
+		if len(d.centroids) != 0 {
+			t.Error("Unexpected centroids:", len(d.centroids))
+			return
+		}
+	}
+}
+
+func TestQuantileDigestApproximation(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	distributions := map[string]func(i int) float64{
+		"sequence":    func(i int) float64 { return float64(i) },
+		"uniform":     func(i int) float64 { return r.Float64() },
+		"normal":      func(i int) float64 { return r.NormFloat64() },
+		"exponential": func(i int) float64 { return r.ExpFloat64() },
+		"discrete":    func(i int) float64 { return float64(r.Intn(10)) },
+	}
+
+	// Estimates may be interpolated between repeated values
+
+	tolerance := map[string]float64{"discrete": 1}
+
+	for name, dist := range distributions {
+		for _, n := range []int{quantileBufferSize + 1, 10000, 100000} {
+			d := newQuantileDigest()
+			values := make([]float64, n)
+
+			for i := range values {
+				values[i] = dist(i)
+			}
+
+			r.Shuffle(len(values), func(i, j int) { values[i], values[j] = values[j], values[i] })
+
+			for _, v := range values {
+				d.add(v)
+			}
+
+			sort.Float64s(values)
+
+			// The memory of the digest is bounded
+
+			if len(d.centroids) > quantileCompression+1 || len(d.buffer) > quantileBufferSize {
+				t.Error("Unexpected digest size:", name, n, len(d.centroids), len(d.buffer))
+				return
+			}
+
+			for _, q := range []float64{0, 0.001, 0.01, 0.05, 0.25, 0.5, 0.75, 0.95, 0.99, 0.999, 1} {
+				res := d.quantile(q)
+
+				// The estimate must lie between the exact quantiles of the
+				// documented rank error
+
+				maxErr := 2 * math.Pi * math.Sqrt(q*(1-q)) / quantileCompression
+
+				low := exactQuantile(values, math.Max(q-maxErr, 0))
+				high := exactQuantile(values, math.Min(q+maxErr, 1))
+
+				if res < low-tolerance[name] || res > high+tolerance[name] {
+					t.Error("Unexpected result:", name, n, q, res, "expected between", low, high)
+					return
+				}
+			}
+		}
+	}
+}
@@ -11,9 +11,11 @@
 package interpreter
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"devt.de/eliasdb/eql/parser"
 	"devt.de/eliasdb/graph"
@@ -34,6 +36,10 @@ type withFlags struct {
 	notnullCol   []int  // Columns which must not be null
 	uniqueCol    []int  // Columns which will only contain unique values
 	uniqueColCnt []bool // Flag if unique values should be counted
+	distinct     bool   // Flag if duplicate rows should be removed
+	nocase       bool   // Flag if string comparisons are case-insensitive
+	nullsFirst   bool   // Flag if missing values are ordered first
+	strict       bool   // Flag if values are compared without type coercion
 }
 
 const (
@@ -46,22 +52,65 @@ GroupNodeKind is a special group node kind
 */
 const GroupNodeKind = "group"
 
+/*
+maxWarnings is the maximum number of warnings which are collected for a query
+*/
+const maxWarnings = 100
+
 // General runtime provider
 // ========================
 
+/*
+Page selects a part of the rows which are selected by a query. The page is
+applied within the limit and offset clauses of the query.
+*/
+type Page struct {
+	Offset int // Number of rows which are skipped
+	Limit  int // Maximum number of rows (-1 for no limit)
+}
+
+/*
+window describes the rows which are selected by the limit and offset clauses
+of a paged query.
+*/
+type window struct {
+	offset int  // Offset clause of the query
+	limit  int  // Limit clause of the query (-1 for no limit)
+	end    bool // Flag if the page ends with the last row which is selected by the limit clause
+}
+
 /*
 eqlRuntimeProvider defines the main interpreter
 datastructure and all functions for general evaluation.
 */
 type eqlRuntimeProvider struct {
-	name       string         // Name to identify the input
-	part       string         // Graph partition to query
-	gm         *graph.Manager // GraphManager to operate on
-	ni         NodeInfo       // NodeInfo to use for formatting
-	groupScope string         // Group scope for query
+	name       string          // Name to identify the input
+	part       string          // Graph partition to query
+	gm         *graph.Manager  // GraphManager to operate on
+	ni         NodeInfo        // NodeInfo to use for formatting
+	Stream     ResultStream    // Optional stream which receives the rows of the result
+	Context    context.Context // Optional context which can cancel the query
+	Highlight  bool            // Flag if matches of @phrase conditions are recorded for each row
+	MaxNodes   int             // Maximum number of nodes which are visited (0 for no limit)
+	MaxRows    int             // Maximum number of result rows which are produced (0 for no limit)
+	Workers    int             // Number of workers which fetch start nodes and traversals (1 or less for no workers)
+	CountTotal bool            // Flag if rows beyond the limit are counted (see SearchResult.TotalCount)
+	Page       *Page           // Optional page of the rows which are selected by the query
+	groupScope string          // Group scope for query
 
 	allowNilTraversal bool       // Flag if empty traversals should be included in the result
+	sortedTraversals  bool       // Flag if traversal results are visited in key order
 	withFlags         *withFlags // Special flags which can be set by with statements
+	limit             int        // Maximum number of result rows (-1 for no limit)
+	offset            int        // Number of result rows which are skipped
+	window            *window    // Rows which are selected by the limit and offset clauses of a paged query
+
+	parent  *eqlRuntimeProvider // Provider of the outer query if this is a subquery
+	visited int                 // Number of nodes which have been visited
+	pool    *fetchPool          // Pool which fetches start nodes and traversals ahead (nil if not used)
+	stats   *QueryStats         // Execution statistics (shared with the outer query for subqueries)
+
+	validateOnly bool // Flag if the query is only validated without reading any data (see ValidateQuery)
 
 	primaryKind  string                 // Primary node kind
 	nextStartKey func() (string, error) // Function to get the next start key
@@ -81,6 +130,9 @@ type eqlRuntimeProvider struct {
 	colData   []string   // Data for columns
 	colFunc   []FuncShow // Function to transform column value
 
+	warnings   []string    // Warnings which were collected while running the query
+	highlights *highlights // Matches of @phrase conditions (nil if not recorded)
+
 	_attrsNodesFetch [][]string // Internal copy of attrsNodes better suited for fetchPart calls
 	_attrsEdgesFetch [][]string // Internal copy of attrsEdges better suited for fetchPart calls
 }
@@ -98,7 +150,40 @@ func (p *eqlRuntimeProvider) init(startKind string,
 	// Clear any with flags
 
 	p.withFlags = &withFlags{make([]byte, 0), make([]int, 0), make([]int, 0),
-		make([]int, 0), make([]bool, 0)}
+		make([]int, 0), make([]bool, 0), false, false, false, false}
+
+	// Clear paging
+
+	p.limit = -1
+	p.offset = 0
+
+	// Clear the number of visited nodes and the statistics - subqueries
+	// count their work in the statistics of the outer query
+
+	p.visited = 0
+
+	if p.parent != nil {
+		p.stats = p.parent.stats
+	} else {
+		p.stats = newQueryStats()
+	}
+
+	// Create a new fetch pool if workers are used
+
+	p.pool = nil
+
+	if p.Workers > 1 {
+		p.pool = newFetchPool(p.Workers)
+	}
+
+	// Clear warnings and matches
+
+	p.warnings = nil
+	p.highlights = nil
+
+	if p.Highlight {
+		p.highlights = newHighlights()
+	}
 
 	// Reinitialise datastructures
 
@@ -126,10 +211,23 @@ func (p *eqlRuntimeProvider) init(startKind string,
 	p.attrsNodes = append(p.attrsNodes, make(map[string]string))
 	p.attrsEdges = append(p.attrsEdges, make(map[string]string))
 
-	// With clause is interpreted straight after finishing the columns
+	// With clause is interpreted straight after finishing the columns - the
+	// nocase and strict flags are needed before the where clause is validated
 
 	var withChild *parser.ASTNode
 
+	for _, child := range rootChildren {
+		if child.Name == parser.NodeWITH {
+			for _, flag := range child.Children {
+				if flag.Name == parser.NodeNOCASE {
+					p.withFlags.nocase = true
+				} else if flag.Name == parser.NodeSTRICT {
+					p.withFlags.strict = true
+				}
+			}
+		}
+	}
+
 	// Go through the children, check if they are valid and initialise them
 
 	for _, child := range rootChildren {
@@ -196,12 +294,23 @@ func (p *eqlRuntimeProvider) init(startKind string,
 
 			withChild = child
 
+		} else if child.Name == parser.NodeLIMIT || child.Name == parser.NodeOFFSET {
+
+			if err := p.initPaging(child); err != nil {
+				return err
+			}
+
 		} else {
 
 			return p.newRuntimeError(ErrInvalidConstruct, child.Name, child)
 		}
 	}
 
+	// Apply the page within the rows which are selected by the limit and
+	// offset clauses
+
+	p.initPage()
+
 	// Populate column related attributes
 
 	nodeKindPos, edgeKindPos, err := p.initCols()
@@ -224,6 +333,98 @@ func (p *eqlRuntimeProvider) init(startKind string,
 	return nil
 }
 
+/*
+initPaging sets the limit or offset of the result from a given limit or offset
+clause.
+*/
+func (p *eqlRuntimeProvider) initPaging(child *parser.ASTNode) error {
+
+	val, err := strconv.Atoi(child.Children[0].Token.Val)
+	if err != nil || val < 0 {
+		return p.newRuntimeError(ErrInvalidConstruct,
+			fmt.Sprintf("Value of %v clause must be a positive integer number: %v",
+				child.Name, child.Children[0].Token.Val), child)
+	}
+
+	if child.Name == parser.NodeLIMIT {
+		if p.limit != -1 {
+			return p.newRuntimeError(ErrInvalidConstruct, "Multiple limit clauses", child)
+		}
+		p.limit = val
+	} else {
+		if p.offset != 0 {
+			return p.newRuntimeError(ErrInvalidConstruct, "Multiple offset clauses", child)
+		}
+		p.offset = val
+	}
+
+	return nil
+}
+
+/*
+initPage applies the page of the query to its limit and offset. The page is
+taken from the rows which are selected by the limit and offset clauses -
+e.g. a query with limit 10 and a page with offset 8 and limit 5 returns the
+rows 9 and 10.
+*/
+func (p *eqlRuntimeProvider) initPage() {
+
+	p.window = nil
+
+	if p.Page == nil {
+		return
+	}
+
+	p.window = &window{p.offset, p.limit, false}
+
+	p.offset += p.Page.Offset
+
+	limit := p.Page.Limit
+
+	if p.window.limit != -1 {
+		rest := p.window.limit - p.Page.Offset
+		if rest < 0 {
+			rest = 0
+		}
+
+		if limit == -1 || limit >= rest {
+			limit = rest
+			p.window.end = true
+		}
+	}
+
+	p.limit = limit
+}
+
+/*
+addWarning adds a warning to the query. Only the first maxWarnings warnings
+are kept.
+*/
+func (p *eqlRuntimeProvider) addWarning(warning string) {
+
+	if len(p.warnings) < maxWarnings {
+		p.warnings = append(p.warnings, warning)
+	} else if len(p.warnings) == maxWarnings {
+		p.warnings = append(p.warnings, "Further warnings were omitted")
+	}
+}
+
+/*
+fullPass checks if all rows of the result need to be produced before the
+limit and offset can be applied (e.g. for ordering, filtering and aggregation).
+*/
+func (p *eqlRuntimeProvider) fullPass() bool {
+
+	for _, cf := range p.colFunc {
+		if _, ok := cf.(*showAggregate); ok {
+			return true
+		}
+	}
+
+	return p.limit == -1 || len(p.withFlags.ordering) > 0 ||
+		len(p.withFlags.notnullCol) > 0 || len(p.withFlags.uniqueCol) > 0
+}
+
 /*
 initWithFlags populates the withFlags datastructure. It is assumed that the
 columns have been populated before calling this function.
@@ -236,16 +437,35 @@ func (p *eqlRuntimeProvider) initWithFlags(withNode *parser.ASTNode,
 	findColumn := func(colData string, node *parser.ASTNode) (int, error) {
 
 		col := -1
+
+		// Check if a column alias is referenced
+
+		if p.show != nil {
+			for i, st := range p.show.Children {
+				for _, c := range st.Children {
+					if c.Name == parser.NodeAS && c.Children[0].Token.Val == colData {
+						return i, nil
+					}
+				}
+			}
+		}
+
 		colDataSplit := strings.SplitN(colData, ":", 3)
 
 		switch len(colDataSplit) {
 		case 1:
 
-			// Find the first column which displays the given attribute
+			// Find the column which displays the given attribute of the root
+			// node - otherwise the first column which displays the attribute
 
 			for i, cd := range p.colData {
 				cds := strings.SplitN(cd, ":", 3)
-				if cds[2] == colDataSplit[0] {
+				if cds[2] != colDataSplit[0] {
+					continue
+				} else if cds[0] == "1" && cds[1] == "n" {
+					col = i
+					break
+				} else if col == -1 {
 					col = i
 				}
 			}
@@ -305,6 +525,18 @@ func (p *eqlRuntimeProvider) initWithFlags(withNode *parser.ASTNode,
 
 			p.allowNilTraversal = true
 
+		} else if child.Name == parser.NodeDISTINCT {
+
+			p.withFlags.distinct = true
+
+		} else if child.Name == parser.NodeNOCASE || child.Name == parser.NodeSTRICT {
+
+			// Flag was already set before the where clause was validated
+
+		} else if child.Name == parser.NodeNULLSFIRST || child.Name == parser.NodeNULLSLAST {
+
+			p.withFlags.nullsFirst = child.Name == parser.NodeNULLSFIRST
+
 		} else if child.Name == parser.NodeFILTERING {
 
 			for _, child := range child.Children {
@@ -332,9 +564,22 @@ func (p *eqlRuntimeProvider) initWithFlags(withNode *parser.ASTNode,
 
 		} else if child.Name == parser.NodeORDERING {
 
+			// Ordering terms are given in order of their priority - a term
+			// without direction is ordered ascending
+
 			for _, child := range child.Children {
 
-				if child.Name == parser.NodeASCENDING || child.Name == parser.NodeDESCENDING {
+				if child.Name == parser.NodeVALUE {
+
+					c, err := findColumn(child.Token.Val, child)
+					if err != nil {
+						return err
+					}
+
+					p.withFlags.ordering = append(p.withFlags.ordering, withOrderingAscending)
+					p.withFlags.orderingCol = append(p.withFlags.orderingCol, c)
+
+				} else if child.Name == parser.NodeASCENDING || child.Name == parser.NodeDESCENDING {
 
 					c, err := findColumn(child.Children[0].Token.Val, child)
 					if err != nil {
@@ -415,7 +660,7 @@ func (p *eqlRuntimeProvider) initCols() (map[string][]int, map[string][]int, err
 			sspec := strings.Split(spec, ":")
 			kind := sspec[len(sspec)-1]
 
-			for _, attr := range p.ni.SummaryAttributes(kind) {
+			for _, attr := range kindNodeInfo(p.ni, kind).SummaryAttributes(kind) {
 
 				// Make sure the attribute is in attrsNodes
 
@@ -423,7 +668,7 @@ func (p *eqlRuntimeProvider) initCols() (map[string][]int, map[string][]int, err
 
 				// Fill col attributes (we only show nodes)
 
-				p.colLabels = append(p.colLabels, p.ni.AttributeDisplayString(kind, attr))
+				p.colLabels = append(p.colLabels, kindNodeInfo(p.ni, kind).AttributeDisplayString(kind, attr))
 				p.colFormat = append(p.colFormat, "auto")
 				p.colData = append(p.colData, fmt.Sprintf("%v:n:%s", i+1, attr))
 				p.colFunc = append(p.colFunc, nil)
@@ -453,13 +698,21 @@ func (p *eqlRuntimeProvider) initCols() (map[string][]int, map[string][]int, err
 
 			// Create the correct colData value
 
-			if col.Token.ID == parser.TokenAT {
+			if len(col.Children) > 0 && arithmeticOps[col.Children[0].Name] {
+
+				// We have an arithmetic expression - the label is the text
+				// of the expression
+
+				colFunc, colData = showExpressionInst(col.Children[0], col.Token.Val, p)
+				label = col.Token.Val
+
+			} else if col.Token.ID == parser.TokenAT {
 
 				// We have a function get the attribute which it operates on
 
 				funcName := col.Children[0].Children[0].Token.Val
 
-				funcInst, ok := showFunc[funcName]
+				funcInst, ok := lookupShowFunc(funcName)
 				if !ok {
 					return nil, nil, p.newRuntimeError(ErrInvalidConstruct,
 						"Unknown function: "+funcName, col)
@@ -486,7 +739,7 @@ func (p *eqlRuntimeProvider) initCols() (map[string][]int, map[string][]int, err
 				isNode = true
 				colData = "1:n:" + attr
 				if label == "" {
-					label = p.ni.AttributeDisplayString(p.specs[0], attr)
+					label = kindNodeInfo(p.ni, p.specs[0]).AttributeDisplayString(p.specs[0], attr)
 				}
 
 			case 2:
@@ -513,7 +766,7 @@ func (p *eqlRuntimeProvider) initCols() (map[string][]int, map[string][]int, err
 				}
 
 				if label == "" {
-					label = p.ni.AttributeDisplayString(kind, attr)
+					label = kindNodeInfo(p.ni, kind).AttributeDisplayString(kind, attr)
 				}
 
 			case 3:
@@ -541,7 +794,16 @@ func (p *eqlRuntimeProvider) initCols() (map[string][]int, map[string][]int, err
 				}
 
 				if label == "" {
-					label = p.ni.AttributeDisplayString("", attr)
+					kind := ""
+
+					// Edge attributes are labelled with the edge kind of the
+					// traversal spec
+
+					if !isNode && pos > 0 && pos < len(p.specs) {
+						kind = strings.Split(p.specs[pos], ":")[1]
+					}
+
+					label = kindNodeInfo(p.ni, kind).AttributeDisplayString(kind, attr)
 				}
 			}
 
@@ -561,7 +823,7 @@ func (p *eqlRuntimeProvider) initCols() (map[string][]int, map[string][]int, err
 					colLabel = t.Children[0].Token.Val
 				} else if t.Name == parser.NodeFORMAT {
 					colFormat = t.Children[0].Token.Val
-				} else if t.Name != parser.NodeFUNC {
+				} else if t.Name != parser.NodeFUNC && !arithmeticOps[t.Name] {
 					return nil, nil, p.newRuntimeError(ErrInvalidConstruct, t.Name, t)
 				}
 			}
@@ -573,6 +835,24 @@ func (p *eqlRuntimeProvider) initCols() (map[string][]int, map[string][]int, err
 			p.colData = append(p.colData, colData)
 			p.colFunc = append(p.colFunc, colFunc)
 
+			// Aggregation and date functions read the resolved attribute
+
+			if af, ok := colFunc.(attrFunc); ok {
+				af.setAttr(attr, isNode)
+			}
+
+			// Functions may need further attributes for their parameters
+
+			if pf, ok := colFunc.(paramAttrFunc); ok {
+				nodeAttrs, edgeAttrs := pf.paramAttrs()
+				for _, a := range nodeAttrs {
+					p.attrsNodes[pos][a] = ""
+				}
+				for _, a := range edgeAttrs {
+					p.attrsEdges[pos][a] = ""
+				}
+			}
+
 			// Populate attrsNodes and attrsEdges
 
 			if isNode {
@@ -586,12 +866,98 @@ func (p *eqlRuntimeProvider) initCols() (map[string][]int, map[string][]int, err
 	return nodeKindPos, edgeKindPos, nil
 }
 
+/*
+checkCancelled returns the error of the context of the query if the query
+was cancelled.
+*/
+func (p *eqlRuntimeProvider) checkCancelled() error {
+	if p.Context != nil {
+		return p.Context.Err()
+	}
+	return nil
+}
+
+/*
+cancelError converts the error of a cancelled query into a CancelError. The
+progress of the outer query is recorded in a LimitError. Other errors are returned
+unchanged.
+*/
+func (p *eqlRuntimeProvider) cancelError(err error, rows int) error {
+	if err == context.DeadlineExceeded {
+		return &CancelError{p.name, ErrQueryTimeout, rows}
+	} else if err == context.Canceled {
+		return &CancelError{p.name, ErrQueryCancelled, rows}
+	} else if le, ok := err.(*LimitError); ok && p.parent == nil {
+		le.Nodes, le.Rows = p.visited, rows
+	}
+	return err
+}
+
+/*
+visitNodes counts visited nodes. Returns a LimitError if more nodes were
+visited than allowed. Nodes which are visited by a subquery are counted by
+the outer query.
+*/
+func (p *eqlRuntimeProvider) visitNodes(n int) error {
+	if p.parent != nil {
+		return p.parent.visitNodes(n)
+	}
+
+	p.visited += n
+	p.stats.Nodes += n
+
+	if p.MaxNodes > 0 && p.visited > p.MaxNodes {
+		return &LimitError{p.name, ErrQueryLimitExceeded, LimitNodes, p.MaxNodes, p.visited, 0}
+	}
+
+	return nil
+}
+
+/*
+finishStats records the duration of the query in its statistics. The
+duration of a subquery is part of the duration of the outer query.
+*/
+func (p *eqlRuntimeProvider) finishStats(start time.Time) {
+	if p.parent == nil && p.stats != nil {
+		p.stats.Duration = time.Since(start)
+	}
+}
+
+/*
+takeStartNode takes a start node which was fetched ahead. Returns nil if the
+start node was not fetched ahead.
+*/
+func (p *eqlRuntimeProvider) takeStartNode(key string) *fetchFuture {
+	if p.pool == nil {
+		return nil
+	}
+	return p.pool.take(fetchKey{nil, key, p.specs[0]})
+}
+
+/*
+discardTraversals removes the top level traversals of a start node which were
+fetched ahead but are not needed.
+*/
+func (p *eqlRuntimeProvider) discardTraversals(node data.Node) {
+	if p.pool != nil {
+		for _, child := range p.traversals {
+			p.pool.discard(fetchKey{child.Runtime.(*traversalRuntime), node.Key(), node.Kind()})
+		}
+	}
+}
+
 /*
 next advances to the next query row. Returns false if no more rows are available.
 It is assumed that all traversal specs and query attrs have been filled.
 */
 func (p *eqlRuntimeProvider) next() (bool, error) {
 
+	// Stop if the query was cancelled
+
+	if err := p.checkCancelled(); err != nil {
+		return false, err
+	}
+
 	// Create fetch lists if it is the first next() call
 
 	if p._attrsNodesFetch == nil {
@@ -643,13 +1009,30 @@ func (p *eqlRuntimeProvider) next() (bool, error) {
 		childRuntime := child.Runtime.(*traversalRuntime)
 		if childRuntime.hasMoreNodes() {
 			_, err := childRuntime.Eval()
+
+			if err == ErrEmptyTraversal {
+
+				// All remaining branches were pruned - continue with the
+				// next start node
+
+				break
+			}
+
 			return err == nil, err
 		}
 	}
 
 	// Get next root node
 
-	startKey, err := p.nextStartKey()
+	var startKey string
+	var err error
+
+	if p.pool != nil {
+		startKey, err = p.pool.nextStartKey(p)
+	} else {
+		startKey, err = p.nextStartKey()
+	}
+
 	if err != nil || startKey == "" {
 		return false, err
 	}
@@ -657,13 +1040,27 @@ func (p *eqlRuntimeProvider) next() (bool, error) {
 	// Fetch node - always require the key attribute
 	// to make sure we get a node back if it exists
 
-	node, err := p.gm.FetchNodePart(p.part, startKey, p.specs[0],
-		append(p._attrsNodesFetch[0], "key"))
+	var node data.Node
+
+	if ff := p.takeStartNode(startKey); ff != nil {
+		node, err = ff.node, ff.err
+	} else {
+		node, err = p.gm.FetchNodePart(p.part, startKey, p.specs[0],
+			append(p._attrsNodesFetch[0], "key"))
+	}
+
+	p.stats.NodeFetches++
 
 	if err != nil || node == nil {
 		return false, err
 	}
 
+	p.stats.StartNodes++
+
+	if err := p.visitNodes(1); err != nil {
+		return false, err
+	}
+
 	// Decide if this node should be added
 
 	addNode := true
@@ -712,6 +1109,9 @@ func (p *eqlRuntimeProvider) next() (bool, error) {
 				p.rowNode[0] = nil
 				p.rowEdge[0] = nil
 
+				skipTraversals(p.traversals)
+				p.discardTraversals(node)
+
 				return p.next()
 
 			} else if err != nil {
@@ -721,6 +1121,8 @@ func (p *eqlRuntimeProvider) next() (bool, error) {
 
 	} else {
 
+		p.discardTraversals(node)
+
 		// Recursively call next until there is a condition-matching node or
 		// there are no more start keys available
 
@@ -762,6 +1164,7 @@ var generalProviderMap = map[string]generalInst{
 	parser.NodeNOT: notRuntimeInst,
 	parser.NodeAND: andRuntimeInst,
 	parser.NodeOR:  orRuntimeInst,
+	parser.NodeHAS: hasRuntimeInst,
 
 	// Simple arithmetic expressions
 
@@ -776,10 +1179,15 @@ var generalProviderMap = map[string]generalInst{
 
 	parser.NodeIN:    inRuntimeInst,
 	parser.NodeNOTIN: notInRuntimeInst,
+	parser.NodeANY:   anyRuntimeInst,
+	parser.NodeALL:   allRuntimeInst,
 
 	// String operations
 
 	parser.NodeLIKE:        likeRuntimeInst,
+	parser.NodeILIKE:       iLikeRuntimeInst,
+	parser.NodeMATCHES:     matchesRuntimeInst,
+	parser.NodeIMATCHES:    iMatchesRuntimeInst,
 	parser.NodeCONTAINS:    containsRuntimeInst,
 	parser.NodeCONTAINSNOT: containsNotRuntimeInst,
 	parser.NodeBEGINSWITH:  beginsWithRuntimeInst,
@@ -102,7 +102,7 @@ Data: 1:n:key, 1:n:Name, 1:n:Type, 2:n:key, 2:n:kind, 2:n:name
 	// Test simple traversal and access the edge
 
 	if err := runSearch("get mynode0 traverse :myedge:: end show mynode0:key, 2:n:key, 2:e:key, myedge:name", `
-Labels: Mynode0 Key, Key, Key, Myedge Name
+Labels: Mynode0 Key, Key, Myedge Key, Myedge Name
 Format: auto, auto, auto, auto
 Data: 1:n:key, 2:n:key, 2:e:key, 2:e:name
 000, 123, abc1, edge:abc1
@@ -144,6 +144,55 @@ Data: 1:n:key, 2:n:key, 2:e:key, 2:e:name
 	}
 }
 
+func TestUndirectedTraversal(t *testing.T) {
+	gm := graph.NewGraphManager(graphstorage.NewMemoryGraphStorage("mystorage"))
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+
+	for _, key := range []string{"p1", "p2"} {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "Person")
+		gm.StoreNode("main", node)
+	}
+
+	edge := data.NewGraphEdge()
+	edge.SetAttr("key", "e1")
+	edge.SetAttr("kind", "Related")
+	edge.SetAttr(data.EdgeEnd1Key, "p1")
+	edge.SetAttr(data.EdgeEnd1Kind, "Person")
+	edge.SetAttr(data.EdgeEnd1Role, "a")
+	edge.SetAttr(data.EdgeEnd1Cascading, false)
+	edge.SetAttr(data.EdgeEnd2Key, "p2")
+	edge.SetAttr(data.EdgeEnd2Kind, "Person")
+	edge.SetAttr(data.EdgeEnd2Role, "b")
+	edge.SetAttr(data.EdgeEnd2Cascading, false)
+	edge.SetAttr(data.EdgeUndirected, true)
+
+	if err := gm.StoreEdge("main", edge); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// The undirected edge matches in either direction
+
+	for _, query := range []string{
+		"get Person traverse a:Related:b:Person end show 1:n:key, 2:n:key",
+		"get Person traverse b:Related:a:Person end show 1:n:key, 2:n:key",
+		"get Person traverse :Related:: end show 1:n:key, 2:n:key",
+	} {
+		if err := runSearch(query, `
+Labels: Key, Key
+Format: auto, auto
+Data: 1:n:key, 2:n:key
+p1, p2
+p2, p1
+`[1:], rt); err != nil {
+			t.Error(query, err)
+			return
+		}
+	}
+}
+
 func TestErrors(t *testing.T) {
 	gm, mgs := simpleGraph()
 	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
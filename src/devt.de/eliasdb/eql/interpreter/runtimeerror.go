@@ -49,19 +49,31 @@ func (re *RuntimeError) Error() string {
 	return ret
 }
 
+/*
+Unwrap returns the error type of this error.
+*/
+func (re *RuntimeError) Unwrap() error {
+	return re.Type
+}
+
 /*
 Runtime related error types
 */
 var (
-	ErrNotARegex        = errors.New("Value of operand is not a valid regex")
-	ErrNotANumber       = errors.New("Value of operand is not a number")
-	ErrNotAList         = errors.New("Value of operand is not a list")
-	ErrInvalidConstruct = errors.New("Invalid construct")
-	ErrUnknownNodeKind  = errors.New("Unknown node kind")
-	ErrInvalidSpec      = errors.New("Invalid traversal spec")
-	ErrInvalidWhere     = errors.New("Invalid where clause")
-	ErrInvalidColData   = errors.New("Invalid column data spec")
-	ErrEmptyTraversal   = errors.New("Empty traversal")
+	ErrNotARegex          = errors.New("Value of operand is not a valid regex")
+	ErrNotANumber         = errors.New("Value of operand is not a number")
+	ErrNotAList           = errors.New("Value of operand is not a list")
+	ErrInvalidConstruct   = errors.New("Invalid construct")
+	ErrUnknownNodeKind    = errors.New("Unknown node kind")
+	ErrInvalidSpec        = errors.New("Invalid traversal spec")
+	ErrInvalidWhere       = errors.New("Invalid where clause")
+	ErrInvalidColData     = errors.New("Invalid column data spec")
+	ErrEmptyTraversal     = errors.New("Empty traversal")
+	ErrReservedAttr       = errors.New("Reserved attribute cannot be changed")
+	ErrQueryCancelled     = errors.New("Query was cancelled")
+	ErrQueryTimeout       = errors.New("Query timed out")
+	ErrInvalidCursor      = errors.New("Invalid cursor")
+	ErrQueryLimitExceeded = errors.New("Query limit exceeded")
 )
 
 /*
@@ -79,3 +91,63 @@ Error returns a human-readable string representation of this error.
 func (re *ResultError) Error() string {
 	return fmt.Sprintf("EQL result error in %s: %v (%v)", re.Source, re.Type, re.Detail)
 }
+
+/*
+CancelError is returned if a query was cancelled or timed out before it
+finished.
+*/
+type CancelError struct {
+	Source string // Name of the source which was given to the parser
+	Type   error  // Error type (ErrQueryCancelled or ErrQueryTimeout)
+	Rows   int    // Number of rows which had been produced
+}
+
+/*
+Error returns a human-readable string representation of this error.
+*/
+func (ce *CancelError) Error() string {
+	return fmt.Sprintf("EQL error in %s: %v (%v rows were produced)", ce.Source, ce.Type, ce.Rows)
+}
+
+/*
+Unwrap returns the error type of this error.
+*/
+func (ce *CancelError) Unwrap() error {
+	return ce.Type
+}
+
+/*
+Limits of a query which can be exceeded (see LimitError)
+*/
+const (
+	LimitNodes = "nodes" // Maximum number of visited nodes
+	LimitRows  = "rows"  // Maximum number of result rows
+)
+
+/*
+LimitError is returned if a query was stopped because it exceeded one of its
+limits. It contains the progress of the query when it was stopped.
+*/
+type LimitError struct {
+	Source string // Name of the source which was given to the parser
+	Type   error  // Error type (ErrQueryLimitExceeded)
+	Limit  string // Limit which was exceeded (LimitNodes or LimitRows)
+	Max    int    // Value of the exceeded limit
+	Nodes  int    // Number of nodes which had been visited
+	Rows   int    // Number of rows which had been produced
+}
+
+/*
+Error returns a human-readable string representation of this error.
+*/
+func (le *LimitError) Error() string {
+	return fmt.Sprintf("EQL error in %s: %v (more than %v %s - %v nodes were visited and %v rows were produced)",
+		le.Source, le.Type, le.Max, le.Limit, le.Nodes, le.Rows)
+}
+
+/*
+Unwrap returns the error type of this error.
+*/
+func (le *LimitError) Unwrap() error {
+	return le.Type
+}
@@ -12,6 +12,7 @@ package interpreter
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"sort"
 	"strconv"
@@ -66,12 +67,37 @@ SearchResult data structure. A search result represents the result of an EQL que
 type SearchResult struct {
 	name      string     // Name to identify the result
 	withFlags *withFlags // With flags which should be applied to the result
+	limit     int        // Maximum number of rows (-1 for no limit)
+	offset    int        // Number of rows which are skipped
+	window    *window    // Rows which are selected by the limit and offset clauses of a paged result
+	hasMore   bool       // Flag if more rows exist beyond the limit
+	produced  int        // Number of rows which have been produced
+	total     int        // Number of all rows without offset and limit (-1 if not known)
+	countOnly bool       // Flag if further rows are only counted since the limit was reached
+	maxRows   int        // Maximum number of rows which can be produced (0 for no limit)
+
+	resumeKey  string // Start key of the last row if the result can be resumed
+	resumeRows int    // Number of rows of the resume key up to the last row
+
+	stream      ResultStream // Stream which receives the rows of the result
+	incremental bool         // Flag if rows are streamed as soon as they are produced
 
 	SearchHeader            // Embedded search header
 	colFunc      []FuncShow // Function which transforms the data
 
 	Source [][]string      // Special string holding the data source (node / edge) for each column
 	Data   [][]interface{} // Data which is held by this search result
+
+	groups    map[string]*aggregateGroup // Groups of an aggregated result
+	groupKeys []string                   // Group keys in order of their first row
+
+	distinctRows map[[sha256.Size]byte]bool // Hashes of all distinct rows
+
+	warnings []string // Warnings which were collected while running the query
+
+	highlights *highlights // Matches of @phrase conditions (nil if not recorded)
+
+	stats *QueryStats // Execution statistics of the query
 }
 
 /*
@@ -89,8 +115,17 @@ func newSearchResult(rtp *eqlRuntimeProvider) *SearchResult {
 		}
 	}
 
-	return &SearchResult{rtp.name, rtp.withFlags, SearchHeader{rtp.primaryKind, rtp.colLabels, rtp.colFormat,
-		cdl}, rtp.colFunc, make([][]string, 0), make([][]interface{}, 0)}
+	sr := &SearchResult{rtp.name, rtp.withFlags, rtp.limit, rtp.offset, rtp.window, false, 0, -1, false, rtp.MaxRows, "", 0, rtp.Stream, false, SearchHeader{rtp.primaryKind, rtp.colLabels, rtp.colFormat,
+		cdl}, rtp.colFunc, make([][]string, 0), make([][]interface{}, 0),
+		make(map[string]*aggregateGroup), make([]string, 0), make(map[[sha256.Size]byte]bool), nil, rtp.highlights, rtp.stats}
+
+	// Rows can only be streamed as soon as they are produced if they don't
+	// need to be filtered, ordered or aggregated
+
+	sr.incremental = len(sr.withFlags.ordering) == 0 && len(sr.withFlags.notnullCol) == 0 &&
+		len(sr.withFlags.uniqueCol) == 0 && !sr.aggregated()
+
+	return sr
 }
 
 /*
@@ -189,17 +224,132 @@ func (sr *SearchResult) addRow(rowNodes []data.Node, rowEdges []data.Edge) error
 		}
 	}
 
+	// Rows of an aggregated result are only added to their group
+
+	if sr.aggregated() {
+		return sr.addAggregateRow(row, src)
+	}
+
+	// Duplicate rows are removed as soon as they are produced
+
+	if sr.withFlags.distinct && sr.duplicateRow(row) {
+		return nil
+	}
+
+	if sr.countOnly {
+		sr.produced++
+		return nil
+	}
+
+	if sr.maxRows > 0 && sr.produced == sr.maxRows {
+		return &LimitError{sr.name, ErrQueryLimitExceeded, LimitRows, sr.maxRows, 0, sr.produced}
+	}
+
+	sr.produced++
+
+	// Streamed rows are not kept in the result
+
+	if sr.stream != nil && sr.incremental {
+		if sr.produced <= sr.offset {
+			return nil
+		}
+		return sr.stream.Row(row, src)
+	}
+
 	sr.Source = append(sr.Source, src)
 	sr.Data = append(sr.Data, row)
 
 	return nil
 }
 
+/*
+duplicateRow checks if an equal row has been produced before. Rows are
+compared by the type and value of each column (e.g. the number 1 and the
+string "1" are different). Only a SHA-256 hash of each distinct row is kept so
+the additional memory is bounded by 32 bytes (plus map overhead) per distinct
+row regardless of the size of the row.
+*/
+func (sr *SearchResult) duplicateRow(row []interface{}) bool {
+	h := sha256.New()
+
+	for _, v := range row {
+		fmt.Fprintf(h, "%T:%v,", v, strconv.Quote(fmt.Sprint(v)))
+	}
+
+	var key [sha256.Size]byte
+	copy(key[:], h.Sum(nil))
+
+	if sr.distinctRows[key] {
+		return true
+	}
+
+	sr.distinctRows[key] = true
+
+	return false
+}
+
+/*
+ResultStream receives the rows of a search result as they are produced. Rows
+which need to be filtered, ordered or aggregated are buffered until all rows
+are known.
+*/
+type ResultStream interface {
+
+	/*
+	   Start is called once before any row with the header of the result and a
+	   flag if rows are streamed as soon as they are produced.
+	*/
+	Start(header *SearchHeader, incremental bool) error
+
+	/*
+	   Row is called for every row of the result with the sources of the row.
+	*/
+	Row(row []interface{}, source []string) error
+}
+
+/*
+startStream starts streaming the result if a stream was given.
+*/
+func (sr *SearchResult) startStream() error {
+	if sr.stream == nil {
+		return nil
+	}
+	return sr.stream.Start(&sr.SearchHeader, sr.incremental)
+}
+
+/*
+flushStream streams all buffered rows once the result is finished. The
+buffered rows are not kept in the result.
+*/
+func (sr *SearchResult) flushStream() error {
+
+	if sr.stream == nil || sr.incremental {
+		return nil
+	}
+
+	for i, row := range sr.Data {
+		if err := sr.stream.Row(row, sr.Source[i]); err != nil {
+			return err
+		}
+	}
+
+	sr.Data = sr.Data[:0]
+	sr.Source = sr.Source[:0]
+
+	return nil
+}
+
 /*
 finish is called once all rows have been added.
 */
 func (sr *SearchResult) finish() {
 
+	// Produce the rows of an aggregated result
+
+	if sr.aggregated() {
+		sr.finishAggregation()
+	}
+
 	// Apply filtering
 
 	if len(sr.withFlags.notnullCol) > 0 || len(sr.withFlags.uniqueCol) > 0 {
@@ -256,12 +406,66 @@ func (sr *SearchResult) finish() {
 
 	// Apply ordering
 
-	for i, ordering := range sr.withFlags.ordering {
+	if len(sr.withFlags.ordering) > 0 {
+		ascending := make([]bool, len(sr.withFlags.ordering))
+		for i, ordering := range sr.withFlags.ordering {
+			ascending[i] = ordering == withOrderingAscending
+		}
 
-		sort.Stable(&SearchResultRowComparator{ordering == withOrderingAscending,
-			sr.withFlags.orderingCol[i], sr.Data})
+		sort.Stable(&SearchResultRowComparator{ascending, sr.withFlags.orderingCol,
+			sr.Data, sr.Source, sr.withFlags.nullsFirst, sr.withFlags.strict})
 	}
 
+	// The number of all rows is known if the query did not stop early
+
+	if sr.countOnly {
+		sr.total = sr.produced
+	} else if !sr.hasMore {
+		if sr.stream != nil && sr.incremental {
+			sr.total = sr.produced
+		} else {
+			sr.total = len(sr.Data)
+		}
+	}
+
+	// Apply offset and limit
+
+	if sr.offset > 0 {
+		if sr.offset >= len(sr.Data) {
+			sr.Data = sr.Data[:0]
+			sr.Source = sr.Source[:0]
+		} else {
+			sr.Data = sr.Data[sr.offset:]
+			sr.Source = sr.Source[sr.offset:]
+		}
+	}
+
+	if sr.limit != -1 && sr.limit < len(sr.Data) {
+		sr.Data = sr.Data[:sr.limit]
+		sr.Source = sr.Source[:sr.limit]
+		sr.hasMore = true
+	}
+
+	// The rows of a paged result are the rows which are selected by the
+	// limit and offset clauses
+
+	if sr.window != nil {
+		if sr.total != -1 {
+			sr.total -= sr.window.offset
+
+			if sr.total < 0 {
+				sr.total = 0
+			} else if sr.window.limit != -1 && sr.total > sr.window.limit {
+				sr.total = sr.window.limit
+			}
+		}
+
+		if sr.window.end {
+			sr.hasMore = false
+			sr.resumeKey = ""
+			sr.resumeRows = 0
+		}
+	}
 }
 
 /*
@@ -278,6 +482,77 @@ func (sr *SearchResult) RowCount() int {
 	return len(sr.Data)
 }
 
+/*
+Ordering returns the applied ordering of the result. Each entry consists of
+a direction and the data of the ordered column (e.g. descending 2:n:ranking).
+The entries are given in order of their priority.
+*/
+func (sr *SearchResult) Ordering() []string {
+	ret := make([]string, 0, len(sr.withFlags.ordering))
+
+	for i, ordering := range sr.withFlags.ordering {
+		direction := "ascending"
+		if ordering == withOrderingDescending {
+			direction = "descending"
+		}
+		ret = append(ret, direction+" "+sr.ColData[sr.withFlags.orderingCol[i]])
+	}
+
+	return ret
+}
+
+/*
+Distinct returns if duplicate rows have been removed from the result.
+*/
+func (sr *SearchResult) Distinct() bool {
+	return sr.withFlags.distinct
+}
+
+/*
+Stats returns the execution statistics of the query.
+*/
+func (sr *SearchResult) Stats() QueryStats {
+	if sr.stats == nil {
+		return *newQueryStats()
+	}
+	return *sr.stats
+}
+
+/*
+Warnings returns all warnings which were collected while running the query
+(e.g. for dates which could not be parsed).
+*/
+func (sr *SearchResult) Warnings() []string {
+	return sr.warnings
+}
+
+/*
+HasMore returns if more rows exist beyond the limit of the result.
+*/
+func (sr *SearchResult) HasMore() bool {
+	return sr.hasMore
+}
+
+/*
+TotalCount returns the number of all rows of the result without its offset
+and limit. Returns -1 if the number is not known because the query stopped
+once the limit was reached (see CountTotal of the runtime provider).
+*/
+func (sr *SearchResult) TotalCount() int {
+	return sr.total
+}
+
+/*
+ResumePosition returns the position of the last row if more rows exist beyond
+the limit and the query can continue after this row. The position consists
+of the start key of the last row and the number of rows of this start key up
+to and including the last row. Returns an empty key if the result cannot be
+resumed.
+*/
+func (sr *SearchResult) ResumePosition() (string, int) {
+	return sr.resumeKey, sr.resumeRows
+}
+
 /*
 Row returns a row of the result.
 */
@@ -307,6 +582,45 @@ func (sr *SearchResult) RowSources() [][]string {
 	return sr.Source
 }
 
+/*
+RowHighlight returns the matches of @phrase conditions in the nodes of a
+result row. Matches are only recorded if the Highlight flag of the runtime
+provider was set. The highlights of the row are ordered by column and
+attribute - a node which appears in several columns is only listed once.
+*/
+func (sr *SearchResult) RowHighlight(line int) []*Highlight {
+	ret := make([]*Highlight, 0)
+
+	if sr.highlights == nil {
+		return ret
+	}
+
+	seen := make(map[string]bool)
+
+	for _, src := range sr.Source[line] {
+		if strings.HasPrefix(src, "n:") && !seen[src] {
+			seen[src] = true
+			ret = append(ret, sr.highlights.forSource(src)...)
+		}
+	}
+
+	return ret
+}
+
+/*
+RowHighlights returns the matches of @phrase conditions for all rows of the
+result (see RowHighlight).
+*/
+func (sr *SearchResult) RowHighlights() [][]*Highlight {
+	ret := make([][]*Highlight, len(sr.Source))
+
+	for i := range sr.Source {
+		ret[i] = sr.RowHighlight(i)
+	}
+
+	return ret
+}
+
 /*
 String returns a string representation of this search result.
 */
@@ -349,12 +663,17 @@ func (sr *SearchResult) String() string {
 // ==============
 
 /*
-SearchResultRowComparator is a comparator object used for sorting the result
+SearchResultRowComparator is a comparator object used for sorting the result.
+Rows are compared column by column in the given order. Missing values are
+sorted last (or first if NullsFirst is set) regardless of the direction.
 */
 type SearchResultRowComparator struct {
-	Ascening bool            // Sort should be ascending
-	Column   int             // Column to sort
-	Data     [][]interface{} // Data to sort
+	Ascening   []bool          // Sort should be ascending (for each column)
+	Columns    []int           // Columns to sort (in order of their priority)
+	Data       [][]interface{} // Data to sort
+	Source     [][]string      // Sources of the data to sort
+	NullsFirst bool            // Missing values should be sorted first
+	Strict     bool            // Values are compared without type coercion
 }
 
 func (c SearchResultRowComparator) Len() int {
@@ -362,29 +681,38 @@ func (c SearchResultRowComparator) Len() int {
 }
 
 func (c SearchResultRowComparator) Less(i, j int) bool {
-	c1 := c.Data[i][c.Column]
-	c2 := c.Data[j][c.Column]
-
-	num1, err := strconv.ParseFloat(fmt.Sprint(c1), 64)
-	if err == nil {
-		num2, err := strconv.ParseFloat(fmt.Sprint(c2), 64)
-		if err == nil {
-			if c.Ascening {
-				return num1 < num2
+
+	for k, col := range c.Columns {
+		c1 := c.Data[i][col]
+		c2 := c.Data[j][col]
+
+		if c1 == nil || c2 == nil {
+			if c1 != nil || c2 != nil {
+				if c.NullsFirst {
+					return c1 == nil
+				}
+				return c2 == nil
 			}
-			return num1 > num2
+			continue
 		}
-	}
 
-	if c.Ascening {
-		return fmt.Sprintf("%v", c1) < fmt.Sprintf("%v", c2)
+		res := valueComparator{c.Strict, false}.order(c1, c2)
+
+		if !c.Ascening[k] {
+			res = -res
+		}
+
+		if res != 0 {
+			return res < 0
+		}
 	}
 
-	return fmt.Sprintf("%v", c1) > fmt.Sprintf("%v", c2)
+	return false
 }
 
 func (c SearchResultRowComparator) Swap(i, j int) {
 	c.Data[i], c.Data[j] = c.Data[j], c.Data[i]
+	c.Source[i], c.Source[j] = c.Source[j], c.Source[i]
 }
 
 // Testing functions
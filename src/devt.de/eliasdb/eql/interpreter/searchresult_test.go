@@ -263,7 +263,7 @@ Data: 1:n:key, 1:n:name, 2:n:key, 2:n:name, 2:n:ranking
 		return
 	}
 
-	if _, err := getResult("get Author traverse :Wrote::Song end show 1:n:name, 2:n:name, 2:e:number with ordering(descending Song:name, ascending Wrote:number)", `
+	if _, err := getResult("get Author traverse :Wrote::Song end show 1:n:name, 2:n:name, 2:e:number with ordering(ascending Wrote:number, descending Song:name)", `
 Labels: Name, Name, Number
 Format: auto, auto, auto
 Data: 1:n:name, 2:n:name, 2:e:number
@@ -341,6 +341,494 @@ John (4)
 	}
 }
 
+func TestMultiColumnOrdering(t *testing.T) {
+	gm, _ := songGraph()
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+
+	// The first ordering term has the highest priority - directions can
+	// follow the ordered column
+
+	res, err := getResult("get Author traverse :Wrote::Song end show 1:n:name, 2:n:name, 2:e:number with ordering(1:n:name descending, Wrote:number, descending Song:name) limit 5", `
+Labels: Name, Name, Number
+Format: auto, auto, auto
+Data: 1:n:name, 2:n:name, 2:e:number
+Mike, StrangeSong1, 1
+Mike, DeadSong2, 2
+Mike, LoveSong3, 3
+Mike, FightSong4, 4
+John, Aria1, 1
+`[1:], rt, false)
+
+	if err != nil || fmt.Sprint(res.Ordering()) != "[descending 1:n:name ascending 2:e:number descending 2:n:name]" ||
+		fmt.Sprint(res.RowSource(4)) != "[n:Author:000 n:Song:Aria1 e:Wrote:Aria1]" {
+		t.Error("Unexpected result:", res, res.Ordering(), err)
+		return
+	}
+
+	// Column aliases can be used to reference columns - the header keeps
+	// the data of the aliased columns
+
+	res, err = getResult("get Author traverse :Wrote::Song end show 1:n:name as \"Author Name\", 2:n:name as song, "+
+		"2:e:number * 10 as nr with ordering(descending \"Author Name\", nr) limit 3", `
+Labels: Author Name, song, nr
+Format: auto, auto, auto
+Data: 1:n:name, 2:n:name, 2:func:expr()
+Mike, StrangeSong1, 10
+Mike, DeadSong2, 20
+Mike, LoveSong3, 30
+`[1:], rt, false)
+
+	if err != nil || fmt.Sprint(res.Ordering()) != "[descending 1:n:name ascending 2:func:expr()]" {
+		t.Error("Unexpected result:", res, res.Ordering(), err)
+		return
+	}
+
+	// Root and traversal columns can be mixed - every row is ordered by its
+	// own values (numbers are not ordered by their displayed strings)
+
+	res, err = getResult("get Author traverse :::Song end show name, Song:name, Song:ranking as rank "+
+		"with ordering(ascending name, descending rank)", `
+Labels: Author Name, Song Name, rank
+Format: auto, auto, auto
+Data: 1:n:name, 2:n:name, 2:n:ranking
+Hans, MyOnlySong3, 19
+John, Aria4, 18
+John, Aria1, 8
+John, Aria3, 4
+John, Aria2, 2
+Mike, DeadSong2, 6
+Mike, StrangeSong1, 5
+Mike, FightSong4, 3
+Mike, LoveSong3, 1
+`[1:], rt, false)
+
+	if err != nil || fmt.Sprint(res.Ordering()) != "[ascending 1:n:name descending 2:n:ranking]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// An attribute without kind references the column of the root node
+
+	res, err = getResult("get Author traverse :::Song end show Song:name, name with ordering(descending name, Song:name) limit 5", `
+Labels: Song Name, Author Name
+Format: auto, auto
+Data: 2:n:name, 1:n:name
+DeadSong2, Mike
+FightSong4, Mike
+LoveSong3, Mike
+StrangeSong1, Mike
+Aria1, John
+`[1:], rt, false)
+
+	if err != nil || fmt.Sprint(res.Ordering()) != "[descending 1:n:name ascending 2:n:name]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Numbers are smaller than other values and missing values are always last
+
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm = graph.NewGraphManager(mgs)
+
+	for i, val := range []interface{}{"b", 10, nil, "9", 2.5, "a"} {
+		node := data.NewGraphNode()
+		node.SetAttr("key", fmt.Sprint(i))
+		node.SetAttr("kind", "Item")
+		if val != nil {
+			node.SetAttr("val", val)
+		}
+		gm.StoreNode("main", node)
+	}
+
+	rt = NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+
+	if _, err := getResult("get Item show key, val with ordering(val)", `
+Labels: Item Key, Val
+Format: auto, auto
+Data: 1:n:key, 1:n:val
+4, 2.5
+3, 9
+1, 10
+5, a
+0, b
+2, <not set>
+`[1:], rt, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res, err := getResult("get Item show key, val with ordering(val descending)", `
+Labels: Item Key, Val
+Format: auto, auto
+Data: 1:n:key, 1:n:val
+0, b
+5, a
+1, 10
+3, 9
+4, 2.5
+2, <not set>
+`[1:], rt, false); err != nil || fmt.Sprint(res.Ordering()) != "[descending 1:n:val]" {
+		t.Error(res, err)
+		return
+	}
+}
+
+func TestLimitOffset(t *testing.T) {
+	gm, _ := songGraph()
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+	rt.SortedStartKeys = true
+
+	// Paging is applied after ordering
+
+	res, err := getResult("get Author traverse :::Song end with ordering(ascending Song:ranking) limit 3 offset 2", `
+Labels: Author Key, Author Name, Song Key, Song Name, Ranking
+Format: auto, auto, auto, auto, auto
+Data: 1:n:key, 1:n:name, 2:n:key, 2:n:name, 2:n:ranking
+123, Mike, FightSong4, FightSong4, 3
+000, John, Aria3, Aria3, 4
+123, Mike, StrangeSong1, StrangeSong1, 5
+`[1:], rt, false)
+
+	if err != nil || !res.HasMore() || len(res.RowSources()) != 3 || res.TotalCount() != 9 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Paging without ordering stops producing rows early
+
+	res, err = getResult("get Song show key offset 7 limit 1", `
+Labels: Song Key
+Format: auto
+Data: 1:n:key
+MyOnlySong3
+`[1:], rt, false)
+
+	if err != nil || !res.HasMore() || res.RowSource(0)[0] != "n:Song:MyOnlySong3" || res.TotalCount() != -1 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// All rows are counted if requested
+
+	rt.CountTotal = true
+
+	res, err = getResult("get Song show key offset 7 limit 1", `
+Labels: Song Key
+Format: auto
+Data: 1:n:key
+MyOnlySong3
+`[1:], rt, false)
+
+	if err != nil || !res.HasMore() || res.TotalCount() != 9 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = getResult("get Song show key offset 12 limit 1", `
+Labels: Song Key
+Format: auto
+Data: 1:n:key
+`[1:], rt, false)
+
+	if err != nil || res.HasMore() || res.TotalCount() != 9 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	rt.CountTotal = false
+
+	res, err = getResult("get Song show key offset 7 limit 5", `
+Labels: Song Key
+Format: auto
+Data: 1:n:key
+MyOnlySong3
+StrangeSong1
+`[1:], rt, false)
+
+	if err != nil || res.HasMore() || res.TotalCount() != 9 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Paging is applied after filtering
+
+	if res, err = getResult("get Author traverse :::Song end show name with filtering(unique name) limit 2", `
+Labels: Author Name
+Format: auto
+Data: 1:n:name
+John
+Mike
+`[1:], rt, false); err != nil || !res.HasMore() {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err = getResult("get Author limit 0", `
+Labels: Author Key, Author Name
+Format: auto, auto
+Data: 1:n:key, 1:n:name
+`[1:], rt, false); err != nil || !res.HasMore() {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err = getResult("get Author offset 5", `
+Labels: Author Key, Author Name
+Format: auto, auto
+Data: 1:n:key, 1:n:name
+`[1:], rt, false); err != nil || res.HasMore() {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	rt2 := NewLookupRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+
+	if res, err = getResult("lookup Author '000', '123', '456' show name with ordering(descending name) limit 1", `
+Labels: Author Name
+Format: auto
+Data: 1:n:name
+Mike
+`[1:], rt2, false); err != nil || !res.HasMore() {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Test error cases
+
+	if _, err := getResult("get Author limit '-1'", "", rt, false); err == nil || err.Error() !=
+		"EQL error in test: Invalid construct (Value of limit clause must be a positive integer number: -1) (Line:1 Pos:12)" {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Author offset x", "", rt, false); err == nil || err.Error() !=
+		"EQL error in test: Invalid construct (Value of offset clause must be a positive integer number: x) (Line:1 Pos:12)" {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Author limit 1 limit 2", "", rt, false); err == nil || err.Error() !=
+		"EQL error in test: Invalid construct (Multiple limit clauses) (Line:1 Pos:20)" {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Author offset 1 offset 2", "", rt, false); err == nil || err.Error() !=
+		"EQL error in test: Invalid construct (Multiple offset clauses) (Line:1 Pos:21)" {
+		t.Error(err)
+		return
+	}
+}
+
+func TestAggregation(t *testing.T) {
+	gm, _ := songGraph()
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+	rt.SortedStartKeys = true
+
+	// Without other columns the result collapses to a single row
+
+	res, err := getResult("get Song show @count(), @sum(ranking), @avg(Song:ranking), @min(1:n:ranking), @max(ranking) as Best", `
+Labels: @count(), @sum(ranking), @avg(Song:ranking), @min(1:n:ranking), Best
+Format: auto, auto, auto, auto, auto
+Data: 1:func:count(), 1:func:sum(), 1:func:avg(), 1:func:min(), 1:func:max()
+9, 66, 7.333333333333333, 1, 19
+`[1:], rt, false)
+
+	if err != nil || fmt.Sprint(res.RowSource(0)) != "[    ]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Columns which are not aggregated group the rows
+
+	if _, err := getResult("get Author traverse :::Song end show name, @count(), @sum(Song:ranking), @max(2:n:name)", `
+Labels: Author Name, @count(), @sum(Song:ranking), @max(2:n:name)
+Format: auto, auto, auto, auto
+Data: 1:n:name, 1:func:count(), 2:func:sum(), 2:func:max()
+John, 4, 32, Aria4
+Mike, 4, 15, StrangeSong1
+Hans, 1, 19, MyOnlySong3
+`[1:], rt, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// With clauses are applied to the aggregated rows
+
+	if _, err := getResult("get Author traverse :::Song end show name, @sum(Song:ranking) with ordering(ascending Song:ranking) limit 2", `
+Labels: Author Name, @sum(Song:ranking)
+Format: auto, auto
+Data: 1:n:name, 2:func:sum()
+Mike, 15
+Hans, 19
+`[1:], rt, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Null values are skipped and aggregations of no values are well defined
+
+	if _, err := getResult("get Song where ranking > 100 show @count(), @sum(ranking), @avg(ranking), @min(ranking) limit 1", `
+Labels: @count(), @sum(ranking), @avg(ranking), @min(ranking)
+Format: auto, auto, auto, auto
+Data: 1:func:count(), 1:func:sum(), 1:func:avg(), 1:func:min()
+0, 0, <not set>, <not set>
+`[1:], rt, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Song show @sum(foo), @avg(foo)", `
+Labels: @sum(foo), @avg(foo)
+Format: auto, auto
+Data: 1:func:sum(), 1:func:avg()
+0, <not set>
+`[1:], rt, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Statistical aggregations with and without groups
+
+	if _, err := getResult("get Song show @median(ranking), @percentile(ranking, 90), @percentile(ranking, 0), @stddev(ranking)", `
+Labels: @median(ranking), @percentile(ranking, 90), @percentile(ranking, 0), @stddev(ranking)
+Format: auto, auto, auto, auto
+Data: 1:func:median(), 1:func:percentile(), 1:func:percentile(), 1:func:stddev()
+5, 18.2, 1, 6.670832032063166
+`[1:], rt, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Author traverse :::Song end show name, @median(Song:ranking), @percentile(2:n:ranking, 75), @stddev(Song:ranking)", `
+Labels: Author Name, @median(Song:ranking), @percentile(2:n:ranking, 75), @stddev(Song:ranking)
+Format: auto, auto, auto, auto
+Data: 1:n:name, 2:func:median(), 2:func:percentile(), 2:func:stddev()
+John, 6, 10.5, 7.118052168020873
+Mike, 4, 5.25, 2.217355782608345
+Hans, 19, 19, <not set>
+`[1:], rt, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Values which are not numbers are skipped and reported as warnings
+
+	res, err = getResult("get Song show @median(name), @stddev(foo), @median(ranking)", `
+Labels: @median(name), @stddev(foo), @median(ranking)
+Format: auto, auto, auto
+Data: 1:func:median(), 1:func:stddev(), 1:func:median()
+<not set>, <not set>, 5
+`[1:], rt, false)
+
+	if err != nil || fmt.Sprint(res.Warnings()) != "[Skipped 9 rows without a numeric value in @median(name) "+
+		"Skipped 9 rows without a numeric value in @stddev(foo)]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Test error cases
+
+	if _, err := getResult("get Song show @percentile(ranking)", "", rt, false); err == nil || err.Error() !=
+		"EQL error in test: Invalid construct (Percentile function requires 2 parameters: attribute, percentile) (Line:1 Pos:15)" {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Song show @percentile(ranking, 101)", "", rt, false); err == nil || err.Error() !=
+		"EQL error in test: Invalid construct (Percentile must be a number between 0 and 100: 101) (Line:1 Pos:15)" {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Song show @sum(name)", "", rt, false); err == nil || err.Error() !=
+		"EQL result error in test: Value of operand is not a number (Cannot aggregate @sum(name) value: Aria1)" {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Song show @avg(name, key)", "", rt, false); err == nil || err.Error() !=
+		"EQL error in test: Invalid construct (Avg function requires 1 parameter: attribute) (Line:1 Pos:15)" {
+		t.Error(err)
+		return
+	}
+}
+
+func TestDistinct(t *testing.T) {
+	gm, _ := songGraph()
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+	rt.SortedStartKeys = true
+
+	res, err := getResult("get Author traverse :::Song end show name with distinct", `
+Labels: Author Name
+Format: auto
+Data: 1:n:name
+John
+Mike
+Hans
+`[1:], rt, false)
+
+	if err != nil || !res.Distinct() {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Duplicates are removed before ordering, limit and offset are applied
+
+	if _, err := getResult("get Author traverse :::Song end show name with distinct, ordering(descending name) offset 1 limit 1", `
+Labels: Author Name
+Format: auto
+Data: 1:n:name
+John
+`[1:], rt, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	res, err = getResult("get Author traverse :::Song end show name with distinct limit 2", `
+Labels: Author Name
+Format: auto
+Data: 1:n:name
+John
+Mike
+`[1:], rt, false)
+
+	if err != nil || !res.HasMore() {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Rows are only duplicates if all values are equal
+
+	for query, count := range map[string]int{
+		"get Author traverse :::Song end show name, 2:n:key with distinct": 9,
+		"get Author traverse :::Song end show name":                        9,
+	} {
+		ast, err := parser.ParseWithRuntime("test", query, rt)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		res, err := ast.Runtime.Eval()
+		if err != nil || res.(*SearchResult).RowCount() != count {
+			t.Error("Unexpected result:", res, err)
+			return
+		}
+	}
+
+	// Values are compared by their type and not by their string representation
+
+	sr := newSearchResult(rt.eqlRuntimeProvider)
+
+	if sr.duplicateRow([]interface{}{1, "a"}) || sr.duplicateRow([]interface{}{"1", "a"}) ||
+		sr.duplicateRow([]interface{}{nil, "a"}) || sr.duplicateRow([]interface{}{"<nil>", "a"}) ||
+		!sr.duplicateRow([]interface{}{1, "a"}) {
+		t.Error("Unexpected duplicate detection")
+		return
+	}
+}
+
 func TestWithFlagsErrors(t *testing.T) {
 	gm, _ := songGraph()
 	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
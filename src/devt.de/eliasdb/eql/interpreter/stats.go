@@ -0,0 +1,50 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"time"
+)
+
+/*
+StatsVersion is the version of the query statistics. New counters can be
+added without changing the version - the version is only increased if the
+meaning of an existing counter changes.
+*/
+const StatsVersion = 1
+
+/*
+QueryStats are execution statistics of a query which are collected while the
+query runs. Work of subqueries is counted by the outer query. Start nodes and
+traversals which were fetched ahead by workers but were not needed are not
+counted.
+
+Consumers should ignore counters (and JSON keys) which they do not know -
+new counters are added in later versions.
+*/
+type QueryStats struct {
+	Version      int           `json:"version"`       // Version of the statistics (see StatsVersion)
+	Duration     time.Duration `json:"duration_ns"`   // Time it took to run the query
+	StartNodes   int           `json:"start_nodes"`   // Number of start nodes which were scanned
+	Nodes        int           `json:"nodes"`         // Number of visited nodes (start nodes and traversed nodes)
+	Traversals   int           `json:"traversals"`    // Number of traversals from a node
+	NodeFetches  int           `json:"node_fetches"`  // Number of nodes which were fetched from storage
+	EdgeFetches  int           `json:"edge_fetches"`  // Number of edges which were fetched from storage
+	IndexLookups int           `json:"index_lookups"` // Number of index lookups
+	IndexUsed    bool          `json:"index_used"`    // Flag if the start nodes were found with an index lookup
+}
+
+/*
+newQueryStats creates a new empty statistics object.
+*/
+func newQueryStats() *QueryStats {
+	return &QueryStats{Version: StatsVersion}
+}
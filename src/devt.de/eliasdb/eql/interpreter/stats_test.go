@@ -0,0 +1,121 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"devt.de/eliasdb/eql/parser"
+)
+
+func TestStats(t *testing.T) {
+	gm, _ := songGraph()
+
+	stats := func(query string, workers int) (QueryStats, error) {
+		rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+		rt.SortedStartKeys = true
+		rt.Workers = workers
+
+		ast, err := parser.ParseWithRuntime("test", query, rt)
+		if err != nil {
+			return QueryStats{}, err
+		}
+
+		res, err := ast.Runtime.Eval()
+		if err != nil {
+			return QueryStats{}, err
+		}
+
+		return res.(*SearchResult).Stats(), nil
+	}
+
+	counters := func(s QueryStats) string {
+		return fmt.Sprint(s.Version, s.StartNodes, s.Nodes, s.Traversals,
+			s.NodeFetches, s.EdgeFetches, s.IndexLookups, s.IndexUsed)
+	}
+
+	// Counters are the same for any number of workers
+
+	for _, workers := range []int{0, 4} {
+
+		// All start nodes are scanned and fetched
+
+		if s, err := stats("get Song where ranking > 5", workers); err != nil ||
+			counters(s) != "1 9 9 0 9 0 0 false" || s.Duration <= 0 {
+			t.Error("Unexpected result:", s, err)
+			return
+		}
+
+		// Traversed nodes are only fetched if their attributes are needed
+
+		if s, err := stats("get Author traverse :::Song end show name, Song:name", workers); err != nil ||
+			counters(s) != "1 3 12 3 12 0 0 false" {
+			t.Error("Unexpected result:", s, err)
+			return
+		}
+
+		if s, err := stats("get Author traverse :Wrote::Song end show name, Wrote:number", workers); err != nil ||
+			counters(s) != "1 3 12 3 3 9 0 false" {
+			t.Error("Unexpected result:", s, err)
+			return
+		}
+
+		// Start nodes of an index lookup are counted
+
+		if s, err := stats("get Song where name like 'Aria1 *'", workers); err != nil ||
+			counters(s) != "1 1 1 0 1 0 1 true" {
+			t.Error("Unexpected result:", s, err)
+			return
+		}
+
+		// Work of subqueries and functions is counted by the outer query
+
+		if s, err := stats("get Author where @count(:::Song) > 1 and key notin (get Song where ranking > 10 show key) show name, @count(1, :::Song)", workers); err != nil ||
+			counters(s) != "1 12 29 5 12 0 0 false" {
+			t.Error("Unexpected result:", s, err)
+			return
+		}
+	}
+
+	// Statistics are versioned (a limit needs one more start node to know
+	// if more rows exist)
+
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+	rt.SortedStartKeys = true
+
+	res, err := getResult("get Author limit 1", `
+Labels: Author Key, Author Name
+Format: auto, auto
+Data: 1:n:key, 1:n:name
+000, John
+`[1:], rt, false)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	s := res.Stats()
+	s.Duration = 0
+
+	if out, err := json.Marshal(s); err != nil || string(out) != `{"version":1,"duration_ns":0,"start_nodes":2,`+
+		`"nodes":2,"traversals":0,"node_fetches":2,"edge_fetches":0,"index_lookups":0,"index_used":false}` {
+		t.Error("Unexpected result:", string(out), err)
+		return
+	}
+
+	if s := (&SearchResult{}).Stats(); s.Version != StatsVersion {
+		t.Error("Unexpected result:", s)
+		return
+	}
+}
@@ -0,0 +1,256 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"devt.de/eliasdb/eql/parser"
+	"devt.de/eliasdb/graph/data"
+)
+
+// String functions
+// ================
+
+/*
+stringFunc is a string manipulation function which can be used in where and
+show clauses. The first parameter is always the value which is manipulated.
+*/
+type stringFunc struct {
+	minParams int                                             // Minimum number of parameters
+	maxParams int                                             // Maximum number of parameters (-1 for no limit)
+	desc      string                                          // Description of the parameters
+	fn        func(params []interface{}) (interface{}, error) // Function implementation
+}
+
+/*
+Runtime map for string functions
+*/
+var stringFuncs = map[string]*stringFunc{
+	"lower": {1, 1, "1 parameter: value", func(params []interface{}) (interface{}, error) {
+		return stringFuncApply(params[0], strings.ToLower), nil
+	}},
+	"upper": {1, 1, "1 parameter: value", func(params []interface{}) (interface{}, error) {
+		return stringFuncApply(params[0], strings.ToUpper), nil
+	}},
+	"trim": {1, 1, "1 parameter: value", func(params []interface{}) (interface{}, error) {
+		return stringFuncApply(params[0], strings.TrimSpace), nil
+	}},
+	"length": {1, 1, "1 parameter: value", func(params []interface{}) (interface{}, error) {
+		if params[0] == nil {
+			return 0, nil
+		}
+		return utf8.RuneCountInString(fmt.Sprint(params[0])), nil
+	}},
+	"substr": {2, 3, "2 or 3 parameters: value, from, length (optional)", stringSubstr},
+	"concat": {2, -1, "at least 2 parameters: value, value, ...", func(params []interface{}) (interface{}, error) {
+		var buf strings.Builder
+		for _, p := range params {
+			if p != nil {
+				buf.WriteString(fmt.Sprint(p))
+			}
+		}
+		return buf.String(), nil
+	}},
+}
+
+/*
+stringFuncApply applies a given string transformation to a value. Values
+which are not strings are converted to their display representation. Values
+which are not set stay unset.
+*/
+func stringFuncApply(val interface{}, f func(string) string) interface{} {
+	if val == nil {
+		return nil
+	}
+	return f(fmt.Sprint(val))
+}
+
+/*
+stringSubstr returns a part of a value. Positions are counted in characters
+(not bytes) starting at 0 - a negative start position is counted from the end
+of the value (e.g. -2 is the second last character). Positions and lengths
+which are out of range are clamped.
+*/
+func stringSubstr(params []interface{}) (interface{}, error) {
+	if params[0] == nil {
+		return nil, nil
+	}
+
+	runes := []rune(fmt.Sprint(params[0]))
+	l := len(runes)
+
+	toPos := func(val interface{}, fromEnd bool) (int, error) {
+		num, err := data.ToFloat64(val)
+		if err != nil || math.IsNaN(num) {
+			return 0, fmt.Errorf("Substr position must be a number: %v", val)
+		}
+		if fromEnd && num < 0 {
+			num += float64(l)
+		}
+		if num < 0 {
+			return 0, nil
+		} else if num > float64(l) {
+			return l, nil
+		}
+		return int(num), nil
+	}
+
+	from, err := toPos(params[1], true)
+	if err != nil {
+		return nil, err
+	}
+
+	to := l
+
+	if len(params) > 2 {
+		length, err := toPos(params[2], false)
+		if err != nil {
+			return nil, err
+		}
+		if from+length < l {
+			to = from + length
+		}
+	}
+
+	return string(runes[from:to]), nil
+}
+
+/*
+checkParams checks the number of parameters which are given to a string
+function.
+*/
+func (sf *stringFunc) checkParams(fname string, count int) error {
+	if count < sf.minParams || (sf.maxParams != -1 && count > sf.maxParams) {
+		return fmt.Errorf("%v function requires %v",
+			strings.ToUpper(fname[:1])+fname[1:], sf.desc)
+	}
+	return nil
+}
+
+/*
+whereString runs a string function in a where clause. All parameters are
+resolved in the same way as other function parameters.
+*/
+func whereString(astNode *parser.ASTNode, rtp *eqlRuntimeProvider,
+	node data.Node, edge data.Edge) (interface{}, error) {
+
+	fname := astNode.Children[0].Token.Val
+	sf := stringFuncs[fname]
+
+	// Check parameters
+
+	if err := sf.checkParams(fname, len(astNode.Children)-1); err != nil {
+		return nil, rtp.newRuntimeError(ErrInvalidConstruct, err.Error(), astNode)
+	}
+
+	params := make([]interface{}, 0, len(astNode.Children)-1)
+	for _, c := range astNode.Children[1:] {
+		params = append(params, funcParam(rtp, c, node, edge))
+	}
+
+	res, err := sf.fn(params)
+	if err != nil {
+		return nil, rtp.newRuntimeError(ErrNotANumber, err.Error(), astNode)
+	}
+
+	return res, nil
+}
+
+/*
+showStringInst creates a new showString object. String functions take the
+attribute which contains the value as first parameter. The attribute can be
+given in the same way as a show column (e.g. name, Song:name or 2:n:name).
+*/
+func showStringInst(astNode *parser.ASTNode, rtp *eqlRuntimeProvider) (FuncShow, string, string, error) {
+	fname := astNode.Children[0].Token.Val
+	sf := stringFuncs[fname]
+
+	params := make([]string, 0, len(astNode.Children)-1)
+	for _, c := range astNode.Children[1:] {
+		params = append(params, c.Token.Val)
+	}
+
+	if err := sf.checkParams(fname, len(params)); err != nil {
+		return nil, "", "", err
+	}
+
+	ss := &showString{rtp, astNode, fname, sf, "", true}
+
+	return ss, params[0], fmt.Sprintf("@%v(%v)", fname, strings.Join(params, ", ")), nil
+}
+
+/*
+showString shows the result of a string function on an attribute. Further
+parameters are resolved against the node or edge of the column.
+*/
+type showString struct {
+	rtp     *eqlRuntimeProvider
+	astNode *parser.ASTNode
+	fname   string      // Name of the function
+	sf      *stringFunc // String function which should be run
+	attr    string      // Attribute which contains the value
+	isNode  bool        // Flag if the attribute is a node attribute
+}
+
+/*
+name returns the name of the function.
+*/
+func (ss *showString) name() string {
+	return ss.fname
+}
+
+/*
+setAttr sets the attribute of the column which contains the value.
+*/
+func (ss *showString) setAttr(attr string, isNode bool) {
+	ss.attr = attr
+	ss.isNode = isNode
+}
+
+/*
+paramAttrs returns the node and edge attributes which are read by the
+function parameters.
+*/
+func (ss *showString) paramAttrs() ([]string, []string) {
+	return funcParamAttrs(ss.rtp, ss.astNode.Children[2:])
+}
+
+/*
+eval runs the string function on the value of a row.
+*/
+func (ss *showString) eval(node data.Node, edge data.Edge) (interface{}, string, error) {
+	var val interface{}
+	var src string
+
+	if ss.isNode && node != nil {
+		val = node.Attr(ss.attr)
+		src = "n:" + node.Kind() + ":" + node.Key()
+	} else if !ss.isNode && edge != nil {
+		val = edge.Attr(ss.attr)
+		src = "e:" + edge.Kind() + ":" + edge.Key()
+	}
+
+	params := []interface{}{val}
+	for _, c := range ss.astNode.Children[2:] {
+		params = append(params, funcParam(ss.rtp, c, node, edge))
+	}
+
+	res, err := ss.sf.fn(params)
+	if err != nil {
+		return nil, "", ss.rtp.newRuntimeError(ErrNotANumber, err.Error(), ss.astNode)
+	}
+
+	return res, src, nil
+}
@@ -11,6 +11,7 @@
 package interpreter
 
 import (
+	"sort"
 	"strings"
 
 	"devt.de/eliasdb/eql/parser"
@@ -29,16 +30,18 @@ type traversalRuntime struct {
 	sourceNode data.Node   // Source node for traversal - should be injected by the parent
 	spec       string      // Spec for this traversal
 	specIndex  int         // Index of this traversal in the traversals array
+	ancestors  []int       // Spec indices of all enclosing steps (nearest first)
 	nodes      []data.Node // Nodes of the last traversal result
 	edges      []data.Edge // Edges of the last traversal result
 	curptr     int         // Pointer to the next node in the last traversal result
+	fetched    int         // Number of nodes whose deeper traversals are fetched ahead
 }
 
 /*
 traversalRuntimeInst returns a new runtime component instance.
 */
 func traversalRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Runtime {
-	return &traversalRuntime{rtp, node, nil, nil, "", -1, nil, nil, 0}
+	return &traversalRuntime{rtp, node, nil, nil, "", -1, []int{0}, nil, nil, 0, 0}
 }
 
 /*
@@ -69,6 +72,8 @@ func (rt *traversalRuntime) Validate() error {
 
 		if child.Name == parser.NodeTRAVERSE {
 
+			child.Runtime.(*traversalRuntime).ancestors = append([]int{rt.specIndex}, rt.ancestors...)
+
 			if err := child.Runtime.Validate(); err != nil {
 				return err
 			}
@@ -78,6 +83,7 @@ func (rt *traversalRuntime) Validate() error {
 			whereRuntime := child.Runtime.(*whereRuntime)
 
 			whereRuntime.specIndex = rt.specIndex
+			whereRuntime.ancestors = rt.ancestors
 
 			// Reset state of where and store it
 
@@ -111,6 +117,84 @@ func (rt *traversalRuntime) hasMoreNodes() bool {
 	return rt.curptr < len(rt.nodes)
 }
 
+/*
+fetch traverses from a given source node and fetches all attributes of the
+traversed nodes and edges which are required by the query.
+*/
+func (rt *traversalRuntime) fetch(key string, kind string) ([]data.Node, []data.Edge, error) {
+	return fetchTraversal(rt.rtp, rt.spec, rt.rtp._attrsNodesFetch[rt.specIndex],
+		rt.rtp._attrsEdgesFetch[rt.specIndex], key, kind)
+}
+
+/*
+fetchTraversal traverses from a given source node with a given traversal spec
+and fetches the given attributes of the traversed nodes and edges.
+*/
+func fetchTraversal(rtp *eqlRuntimeProvider, spec string, nodeAttrs []string,
+	edgeAttrs []string, key string, kind string) ([]data.Node, []data.Edge, error) {
+
+	// Do a simple traversal without getting any node data first
+
+	nodes, edges, err := rtp.gm.TraverseMulti(rtp.part, key, kind, spec, false)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Now get the attributes which are required
+
+	for _, node := range nodes {
+
+		if err := rtp.checkCancelled(); err != nil {
+			return nil, nil, err
+		}
+
+		if len(nodeAttrs) > 0 {
+			n, err := rtp.gm.FetchNodePart(rtp.part, node.Key(), node.Kind(), nodeAttrs)
+
+			if err != nil {
+				return nil, nil, err
+			} else if n != nil {
+				for _, attr := range nodeAttrs {
+					node.SetAttr(attr, n.Attr(attr))
+				}
+			}
+		}
+	}
+	for _, edge := range edges {
+
+		if len(edgeAttrs) > 0 {
+			e, err := rtp.gm.FetchEdgePart(rtp.part, edge.Key(), edge.Kind(), edgeAttrs)
+
+			if err != nil {
+				return nil, nil, err
+			} else if e != nil {
+				for _, attr := range edgeAttrs {
+					edge.SetAttr(attr, e.Attr(attr))
+				}
+			}
+		}
+	}
+
+	return nodes, edges, nil
+}
+
+/*
+countTraversal records a traversal and the fetches of its nodes and edges
+(see fetchTraversal) in the statistics of the query. The traversal might have
+been fetched ahead by a worker - it is only counted once it is used.
+*/
+func (p *eqlRuntimeProvider) countTraversal(specIndex int, nodes []data.Node, edges []data.Edge) {
+	p.stats.Traversals++
+
+	if len(p._attrsNodesFetch[specIndex]) > 0 {
+		p.stats.NodeFetches += len(nodes)
+	}
+	if len(p._attrsEdgesFetch[specIndex]) > 0 {
+		p.stats.EdgeFetches += len(edges)
+	}
+}
+
 /*
 newSource assigns a new source node to this traversal component and
 traverses it.
@@ -121,54 +205,57 @@ func (rt *traversalRuntime) newSource(node data.Node) error {
 
 	rt.sourceNode = node
 
+	// Fetches of deeper traversals of the previous source are not needed
+	// anymore
+
+	pool := rt.rtp.pool
+
+	if pool != nil {
+		pool.discardChildren(rt)
+		rt.fetched = 0
+	}
+
 	// Do the actual traversal if we got a node
 
 	if node != nil {
 		var err error
 
-		// Do a simple traversal without getting any node data first
+		// Take the traversal if it was fetched ahead
+
+		var ff *fetchFuture
 
-		nodes, edges, err = rt.rtp.gm.TraverseMulti(rt.rtp.part, rt.sourceNode.Key(),
-			rt.sourceNode.Kind(), rt.spec, false)
+		if pool != nil {
+			ff = pool.take(fetchKey{rt, node.Key(), node.Kind()})
+		}
+
+		if ff != nil {
+			nodes, edges, err = ff.nodes, ff.edges, ff.err
+		} else {
+			nodes, edges, err = rt.fetch(node.Key(), node.Kind())
+		}
 
 		if err != nil {
 			return err
 		}
 
-		// Now get the attributes which are required
-
-		for _, node := range nodes {
-			attrs := rt.rtp._attrsNodesFetch[rt.specIndex]
+		rt.rtp.countTraversal(rt.specIndex, nodes, edges)
 
-			if len(attrs) > 0 {
-				n, err := rt.rtp.gm.FetchNodePart(rt.rtp.part, node.Key(), node.Kind(), attrs)
+		// Count the traversed nodes
 
-				if err != nil {
-					return err
-				} else if n != nil {
-					for _, attr := range attrs {
-						node.SetAttr(attr, n.Attr(attr))
-					}
-				}
-			}
-		}
-		for _, edge := range edges {
-			attrs := rt.rtp._attrsEdgesFetch[rt.specIndex]
-
-			if len(attrs) > 0 {
-				e, err := rt.rtp.gm.FetchEdgePart(rt.rtp.part, edge.Key(), edge.Kind(), attrs)
-
-				if err != nil {
-					return err
-				} else if e != nil {
-					for _, attr := range attrs {
-						edge.SetAttr(attr, e.Attr(attr))
-					}
-				}
+		for range nodes {
+			if err := rt.rtp.visitNodes(1); err != nil {
+				return err
 			}
 		}
 	}
 
+	// Order the traversal result by node and edge keys if a stable order
+	// is required
+
+	if rt.rtp.sortedTraversals {
+		sort.Sort(&traversalResult{nodes, edges})
+	}
+
 	// Apply where clause
 
 	if rt.where != nil {
@@ -198,6 +285,10 @@ func (rt *traversalRuntime) newSource(node data.Node) error {
 	rt.edges = edges
 	rt.curptr = 0
 
+	if pool != nil {
+		pool.fetchChildren(rt)
+	}
+
 	// Check if there are no nodes to display and return an error if
 	// empty traversals are not allowed
 
@@ -213,7 +304,9 @@ func (rt *traversalRuntime) newSource(node data.Node) error {
 }
 
 /*
-Eval evaluate this runtime component.
+Eval evaluate this runtime component. Nodes whose deeper traversals produce
+no nodes are skipped - ErrEmptyTraversal is only returned once all nodes of
+this traversal have been tried.
 */
 func (rt *traversalRuntime) Eval() (interface{}, error) {
 
@@ -223,45 +316,134 @@ func (rt *traversalRuntime) Eval() (interface{}, error) {
 		if child.Name == parser.NodeTRAVERSE {
 			childRuntime := child.Runtime.(*traversalRuntime)
 			if childRuntime.hasMoreNodes() {
-				return childRuntime.Eval()
+				if _, err := childRuntime.Eval(); err != ErrEmptyTraversal {
+					return nil, err
+				}
+
+				// All remaining branches of the child were pruned - continue
+				// with the next node of this traversal
+
+				if rt.curptr >= len(rt.nodes) {
+					return nil, ErrEmptyTraversal
+				}
+
+				break
 			}
 		}
 	}
 
-	// Get the next node and fill the row entry in the provider
+	for {
 
-	var rowNode data.Node
-	var rowEdge data.Edge
+		// Get the next node and fill the row entry in the provider
 
-	if rt.curptr < len(rt.nodes) {
+		var rowNode data.Node
+		var rowEdge data.Edge
 
-		// Get a new node from our node list if possible
+		if rt.curptr < len(rt.nodes) {
 
-		rowNode = rt.nodes[rt.curptr]
-		rowEdge = rt.edges[rt.curptr]
-		rt.curptr++
+			// Get a new node from our node list if possible
 
-	}
+			rowNode = rt.nodes[rt.curptr]
+			rowEdge = rt.edges[rt.curptr]
+			rt.curptr++
 
-	if len(rt.rtp.rowNode) == rt.specIndex {
-		rt.rtp.rowNode = append(rt.rtp.rowNode, rowNode)
-		rt.rtp.rowEdge = append(rt.rtp.rowEdge, rowEdge)
-	} else {
-		rt.rtp.rowNode[rt.specIndex] = rowNode
-		rt.rtp.rowEdge[rt.specIndex] = rowEdge
-	}
+			if rt.rtp.pool != nil {
+				rt.rtp.pool.fetchChildren(rt)
+			}
 
-	// Give the new source to the children and let them evaluate
+		}
 
+		if len(rt.rtp.rowNode) == rt.specIndex {
+			rt.rtp.rowNode = append(rt.rtp.rowNode, rowNode)
+			rt.rtp.rowEdge = append(rt.rtp.rowEdge, rowEdge)
+		} else {
+			rt.rtp.rowNode[rt.specIndex] = rowNode
+			rt.rtp.rowEdge[rt.specIndex] = rowEdge
+		}
+
+		// Give the new source to the children and let them evaluate
+
+		err := rt.evalChildren()
+
+		if err == ErrEmptyTraversal && rt.curptr < len(rt.nodes) {
+
+			// Prune the branch of this node and try the next node
+
+			continue
+		}
+
+		return nil, err
+	}
+}
+
+/*
+evalChildren gives the current node of this traversal as new source to all
+deeper traversals. If a deeper traversal is empty then the remaining nodes of
+all deeper traversals are discarded.
+*/
+func (rt *traversalRuntime) evalChildren() error {
 	for _, child := range rt.node.Children[1:] {
 		if child.Name == parser.NodeTRAVERSE {
 			childRuntime := child.Runtime.(*traversalRuntime)
 
 			if err := childRuntime.newSource(rt.rtp.rowNode[rt.specIndex]); err != nil {
-				return nil, err
+				if err == ErrEmptyTraversal {
+					skipTraversals(rt.node.Children[1:])
+				}
+				return err
 			}
 		}
 	}
 
-	return nil, nil
+	return nil
+}
+
+/*
+skipTraversals discards the remaining nodes of the given traversals and all
+their deeper traversals.
+*/
+func skipTraversals(traversals []*parser.ASTNode) {
+	for _, child := range traversals {
+		if child.Name == parser.NodeTRAVERSE {
+			childRuntime := child.Runtime.(*traversalRuntime)
+			childRuntime.curptr = len(childRuntime.nodes)
+			skipTraversals(childRuntime.node.Children[1:])
+		}
+	}
+}
+
+/*
+traversalResult orders the nodes and edges of a traversal result by node kind,
+node key, edge kind and edge key.
+*/
+type traversalResult struct {
+	nodes []data.Node
+	edges []data.Edge
+}
+
+func (tr *traversalResult) Len() int {
+	return len(tr.nodes)
+}
+
+func (tr *traversalResult) Less(i, j int) bool {
+	ni, nj := tr.nodes[i], tr.nodes[j]
+
+	if ni.Kind() != nj.Kind() {
+		return ni.Kind() < nj.Kind()
+	} else if ni.Key() != nj.Key() {
+		return ni.Key() < nj.Key()
+	}
+
+	ei, ej := tr.edges[i], tr.edges[j]
+
+	if ei.Kind() != ej.Kind() {
+		return ei.Kind() < ej.Kind()
+	}
+
+	return ei.Key() < ej.Key()
+}
+
+func (tr *traversalResult) Swap(i, j int) {
+	tr.nodes[i], tr.nodes[j] = tr.nodes[j], tr.nodes[i]
+	tr.edges[i], tr.edges[j] = tr.edges[j], tr.edges[i]
 }
@@ -0,0 +1,156 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"fmt"
+	"testing"
+
+	"devt.de/eliasdb/eql/parser"
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+func TestNestedTraversalWhere(t *testing.T) {
+	gm, _ := reviewGraph()
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+	rt.SortedStartKeys = true
+
+	rows := func(query string) string {
+		ast, err := parser.ParseWithRuntime("test", query, rt)
+		if err != nil {
+			return err.Error()
+		}
+
+		res, err := ast.Runtime.Eval()
+		if err != nil {
+			return err.Error()
+		}
+
+		return fmt.Sprint(res.(*SearchResult).Rows())
+	}
+
+	for query, expected := range map[string]string{
+
+		// A condition on the second traversal step only prunes the branches
+		// of the book which has no matching review
+
+		"get Author traverse :::Book traverse :::Review where rating > 4 end end show 1:n:key, 2:n:key, 3:n:key": "[[a1 b2 r2] [a2 b4 r5]]",
+
+		// The last branch of a start node is pruned as well
+
+		"get Author traverse :::Book traverse :::Review where rating < 3 end end show 1:n:key, 2:n:key, 3:n:key": "[[a2 b3 r3]]",
+
+		"get Author traverse :::Book where title != Unknown traverse :::Review where rating >= 4 end end show key, Book:title, Review:rating with ordering(Book:title)": "[[a1 Go 5] [a2 Rust 4] [a2 Zig 5]]",
+
+		"get Author traverse :::Book traverse :::Review where rating > 5 end end show 1:n:key": "[]",
+
+		// A start node is skipped if one of several traversals is empty
+
+		"get Person traverse :Knows::Person end traverse :::Review end show 1:n:key, 2:n:key": "[]",
+
+		// Pruned branches still produce rows with nulltraversal
+
+		"get Author where key = a1 traverse :::Book traverse :::Review where rating > 4 end end show 1:n:key, 2:n:key, 3:n:key with nulltraversal(true), ordering(2:n:key)": "[[a1 b1 <nil>] [a1 b2 r2]]",
+	} {
+		if res := rows(query); res != expected {
+			t.Error("Unexpected result:", query, res, "expected:", expected)
+		}
+	}
+
+	// Conditions bind to the node of their own traversal step if the same
+	// kind appears at several depths
+
+	for query, expected := range map[string]string{
+		"get Person where age = 30 traverse :Knows::Person where age > 35 traverse :Knows::Person where age < 25 end end show 1:n:key, 2:n:key, 3:n:key": "[[p1 p2 p3]]",
+		"get Person where age = 30 traverse :Knows::Person where age > 35 traverse :Knows::Person where age > 25 end end show 1:n:key, 2:n:key, 3:n:age": "[[p1 p2 30]]",
+		"get Person traverse :Knows::Person where age > 35 traverse :Knows::Person where age < 25 end end show Person:key, Person:age, 2:n:age, 3:n:age": "[[p1 30 40 20] [p3 20 40 20]]",
+		"get Person where age < 25 traverse :Knows::Person traverse :Knows::Person where key != p3 end end show 1:n:key, 3:n:key":                        "[[p3 p1]]",
+		"get Person traverse :Knows::Person where age > 35 end show 1:n:key, 2:n:key with ordering(descending 1:n:key)":                                  "[[p3 p2] [p1 p2]]",
+		"get Person traverse :Knows::Person where has age traverse :Knows::Person where age = 30 end end show 1:n:key, 2:n:key, 3:n:key with distinct":   "[[p1 p2 p1] [p3 p2 p1]]",
+	} {
+		if res := rows(query); res != expected {
+			t.Error("Unexpected result:", query, res, "expected:", expected)
+		}
+	}
+}
+
+func reviewGraph() (*graph.Manager, *graphstorage.MemoryGraphStorage) {
+
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := graph.NewGraphManager(mgs)
+
+	storeNode := func(key string, kind string, attrs map[string]interface{}) data.Node {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", kind)
+
+		for attr, val := range attrs {
+			node.SetAttr(attr, val)
+		}
+
+		gm.StoreNode("main", node)
+
+		return node
+	}
+
+	storeEdge := func(kind string, node1 data.Node, node2 data.Node) {
+		edge := data.NewGraphEdge()
+
+		edge.SetAttr("key", node1.Key()+"-"+node2.Key())
+		edge.SetAttr("kind", kind)
+
+		edge.SetAttr(data.EdgeEnd1Key, node1.Key())
+		edge.SetAttr(data.EdgeEnd1Kind, node1.Kind())
+		edge.SetAttr(data.EdgeEnd1Role, "Source")
+		edge.SetAttr(data.EdgeEnd1Cascading, false)
+
+		edge.SetAttr(data.EdgeEnd2Key, node2.Key())
+		edge.SetAttr(data.EdgeEnd2Kind, node2.Kind())
+		edge.SetAttr(data.EdgeEnd2Role, "Target")
+		edge.SetAttr(data.EdgeEnd2Cascading, false)
+
+		gm.StoreEdge("main", edge)
+	}
+
+	// Authors with books and reviews
+
+	a1 := storeNode("a1", "Author", nil)
+	a2 := storeNode("a2", "Author", nil)
+
+	b1 := storeNode("b1", "Book", map[string]interface{}{"title": "C"})
+	b2 := storeNode("b2", "Book", map[string]interface{}{"title": "Go"})
+	b3 := storeNode("b3", "Book", map[string]interface{}{"title": "Rust"})
+	b4 := storeNode("b4", "Book", map[string]interface{}{"title": "Zig"})
+
+	storeEdge("Wrote", a1, b1)
+	storeEdge("Wrote", a1, b2)
+	storeEdge("Wrote", a2, b3)
+	storeEdge("Wrote", a2, b4)
+
+	storeEdge("Has", b1, storeNode("r1", "Review", map[string]interface{}{"rating": 3}))
+	storeEdge("Has", b2, storeNode("r2", "Review", map[string]interface{}{"rating": 5}))
+	storeEdge("Has", b3, storeNode("r3", "Review", map[string]interface{}{"rating": 2}))
+	storeEdge("Has", b3, storeNode("r4", "Review", map[string]interface{}{"rating": 4}))
+	storeEdge("Has", b4, storeNode("r5", "Review", map[string]interface{}{"rating": 5}))
+
+	// A chain of persons which know each other
+
+	p1 := storeNode("p1", "Person", map[string]interface{}{"age": 30})
+	p2 := storeNode("p2", "Person", map[string]interface{}{"age": 40})
+	p3 := storeNode("p3", "Person", map[string]interface{}{"age": 20})
+
+	storeEdge("Knows", p1, p2)
+	storeEdge("Knows", p2, p3)
+
+	return gm, mgs.(*graphstorage.MemoryGraphStorage)
+}
@@ -0,0 +1,464 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"devt.de/eliasdb/eql/parser"
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/graph/data"
+)
+
+/*
+Types of the problems which are found by ValidateQuery
+*/
+const (
+	ValidationSyntax           = "syntax"                // The query cannot be parsed
+	ValidationInvalid          = "invalid"               // The query cannot be run (e.g. an invalid show clause)
+	ValidationUnknownKind      = "unknown_kind"          // A node kind is not known
+	ValidationUnknownAttribute = "unknown_attribute"     // An attribute is not known for a node or edge kind
+	ValidationUnknownTraversal = "unknown_traversal"     // A traversal spec does not match any known relationship
+	ValidationSuspicious       = "suspicious_comparison" // A comparison always has the same result
+)
+
+/*
+ValidationMessage describes a problem of a validated query.
+*/
+type ValidationMessage struct {
+	Type        string   `json:"type"`                  // Type of the problem (e.g. unknown_attribute)
+	Detail      string   `json:"detail"`                // Description of the problem
+	Line        int      `json:"line"`                  // Line of the problem in the query
+	Pos         int      `json:"pos"`                   // Position of the problem in its line
+	Expected    []string `json:"expected,omitempty"`    // Terms which would have been valid instead (only syntax errors)
+	Suggestions []string `json:"suggestions,omitempty"` // Keywords which were likely meant instead (only syntax errors)
+}
+
+/*
+ValidationResult is the result of a query validation. Errors are problems
+which prevent the query from running. Warnings are problems which likely
+make the query return different rows than intended.
+*/
+type ValidationResult struct {
+	Valid    bool                 `json:"valid"`    // Flag if the query has no errors
+	Errors   []*ValidationMessage `json:"errors"`   // Problems which prevent the query from running
+	Warnings []*ValidationMessage `json:"warnings"` // Problems which are likely mistakes
+}
+
+/*
+identifierRegex matches values which look like (optionally qualified)
+attribute names.
+*/
+var identifierRegex = regexp.MustCompile("^([a-zA-Z_][a-zA-Z0-9_]*:)?[a-zA-Z_][a-zA-Z0-9_]*$")
+
+/*
+ValidateQuery checks a query without running it. The query is parsed and
+validated by the same runtime components which run it but no data is read -
+neither the start nodes nor the results of subqueries. Only the first syntax
+error or the first error of the validation is reported. Queries which pass
+the validation are checked for likely mistakes against the node and edge
+kinds, attributes and relationships which are known to the graph manager:
+
+- Attributes which are not known for the node or edge kind of their traversal
+step (unknown names which are used as attributes are compared as literals).
+- Traversal specs which do not match any relationship of the source kind.
+- Comparisons which always have the same result (e.g. comparisons of two
+literals or of an attribute with itself).
+
+Queries on unknown node kinds are errors. An error is only returned if the
+query could not be validated.
+*/
+func ValidateQuery(name string, query string, gm *graph.Manager, ni NodeInfo) (*ValidationResult, error) {
+	res := &ValidationResult{true, []*ValidationMessage{}, []*ValidationMessage{}}
+
+	ast, err := parser.Parse(name, query)
+	if err != nil {
+		var pe *parser.ParseError
+
+		if !errors.As(err, &pe) {
+			return nil, err
+		}
+
+		detail := pe.Type.Error()
+		if pe.Detail != "" {
+			detail = fmt.Sprintf("%v (%v)", pe.Type, pe.Detail)
+		}
+
+		res.Valid = false
+		res.Errors = append(res.Errors, &ValidationMessage{ValidationSyntax,
+			detail, pe.Line, pe.Pos, pe.Expected, pe.Suggestions})
+
+		return res, nil
+	}
+
+	var rtp parser.RuntimeProvider
+
+	if ast.Name == parser.NodeLOOKUP {
+		lrtp := NewLookupRuntimeProvider(name, "", gm, ni)
+		lrtp.validateOnly = true
+		rtp = lrtp
+	} else {
+		grtp := NewGetRuntimeProvider(name, "", gm, ni)
+		grtp.validateOnly = true
+		rtp = grtp
+	}
+
+	ast = ast.CopyWithRuntime(rtp)
+
+	v := &validator{gm, res}
+
+	v.checkKind(ast)
+
+	if err := ast.Runtime.Validate(); err != nil {
+		var re *RuntimeError
+
+		if !errors.As(err, &re) {
+			return nil, err
+		}
+
+		res.Valid = false
+		res.Errors = append(res.Errors, &ValidationMessage{ValidationInvalid,
+			fmt.Sprintf("%v (%v)", re.Type, re.Detail), re.Line, re.Pos, nil, nil})
+
+		return res, nil
+	}
+
+	v.checkQuery(ast)
+
+	return res, nil
+}
+
+/*
+validator checks validated queries for likely mistakes.
+*/
+type validator struct {
+	gm  *graph.Manager    // GraphManager which knows the kinds and attributes
+	res *ValidationResult // Result which receives the problems
+}
+
+/*
+addError adds an error to the validation result.
+*/
+func (v *validator) addError(t string, detail string, node *parser.ASTNode) {
+	v.res.Valid = false
+	v.res.Errors = append(v.res.Errors, &ValidationMessage{t, detail,
+		node.Token.Lline, node.Token.Lpos, nil, nil})
+}
+
+/*
+addWarning adds a warning to the validation result.
+*/
+func (v *validator) addWarning(t string, detail string, node *parser.ASTNode) {
+	v.res.Warnings = append(v.res.Warnings, &ValidationMessage{t, detail,
+		node.Token.Lline, node.Token.Lpos, nil, nil})
+}
+
+/*
+hasString checks if a sorted list of the graph manager contains a given string.
+*/
+func hasString(list []string, s string) bool {
+	i := sort.SearchStrings(list, s)
+	return i < len(list) && list[i] == s
+}
+
+/*
+checkKind checks that the node kind of a query is known.
+*/
+func (v *validator) checkKind(query *parser.ASTNode) {
+	kind := query.Children[0]
+
+	if !hasString(v.gm.NodeKinds(), kind.Token.Val) {
+		v.addError(ValidationUnknownKind,
+			fmt.Sprintf("Node kind '%v' is not known", kind.Token.Val), kind)
+	}
+}
+
+/*
+checkQuery checks the traversals, conditions and columns of a validated query.
+*/
+func (v *validator) checkQuery(query *parser.ASTNode) {
+	var p *eqlRuntimeProvider
+
+	switch rt := query.Runtime.(type) {
+	case *lookupRuntime:
+		p = rt.rtp.eqlRuntimeProvider
+	case *getRuntime:
+		p = rt.rtp.eqlRuntimeProvider
+	case *mutationRuntime:
+		p = rt.rtp.eqlRuntimeProvider
+
+		if rt.set != nil {
+			for _, assign := range rt.set.Children {
+				v.checkCondition(p, 0, assign.Children[1])
+			}
+		}
+	default:
+		return
+	}
+
+	if p.where != nil {
+		v.checkCondition(p, 0, p.where)
+	}
+
+	var checkTraversals func(traversals []*parser.ASTNode)
+
+	checkTraversals = func(traversals []*parser.ASTNode) {
+		for _, traversal := range traversals {
+			trt, ok := traversal.Runtime.(*traversalRuntime)
+			if !ok {
+				continue
+			}
+
+			v.checkTraversal(p, trt)
+
+			if trt.where != nil {
+				v.checkCondition(p, trt.specIndex, trt.where)
+			}
+
+			checkTraversals(traversal.Children[1:])
+		}
+	}
+
+	checkTraversals(p.traversals)
+
+	v.checkColumns(p)
+}
+
+/*
+stepKinds returns the node kind and the edge kind of a traversal step. Kinds
+which are not given or not known are returned as empty strings - problems
+with unknown kinds are reported where the kinds are used.
+*/
+func (v *validator) stepKinds(p *eqlRuntimeProvider, specIndex int) (string, string) {
+	var nodeKind, edgeKind string
+
+	if specIndex == 0 {
+		nodeKind = p.specs[0]
+	} else {
+		sspec := strings.Split(p.specs[specIndex], ":")
+		nodeKind, edgeKind = sspec[3], sspec[1]
+	}
+
+	if !hasString(v.gm.NodeKinds(), nodeKind) {
+		nodeKind = ""
+	}
+	if !hasString(v.gm.EdgeKinds(), edgeKind) {
+		edgeKind = ""
+	}
+
+	return nodeKind, edgeKind
+}
+
+/*
+checkTraversal checks that the spec of a traversal matches a known
+relationship of the node kind of its source step.
+*/
+func (v *validator) checkTraversal(p *eqlRuntimeProvider, trt *traversalRuntime) {
+	specNode := trt.node.Children[0]
+	sspec := strings.Split(trt.spec, ":")
+
+	if sspec[3] != "" && !hasString(v.gm.NodeKinds(), sspec[3]) {
+		v.addWarning(ValidationUnknownTraversal,
+			fmt.Sprintf("Node kind '%v' of traversal spec '%v' is not known", sspec[3], trt.spec), specNode)
+		return
+	}
+
+	if sspec[1] != "" && !hasString(v.gm.EdgeKinds(), sspec[1]) {
+		v.addWarning(ValidationUnknownTraversal,
+			fmt.Sprintf("Edge kind '%v' of traversal spec '%v' is not known", sspec[1], trt.spec), specNode)
+		return
+	}
+
+	sourceKind, _ := v.stepKinds(p, trt.ancestors[0])
+
+	if sourceKind == "" {
+		return
+	}
+
+	for _, relSpec := range v.gm.NodeEdges(sourceKind) {
+		relSSpec := strings.Split(relSpec, ":")
+		matches := true
+
+		for i, part := range sspec {
+			if part != "" && part != relSSpec[i] {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			return
+		}
+	}
+
+	v.addWarning(ValidationUnknownTraversal,
+		fmt.Sprintf("Traversal spec '%v' does not match any relationship of node kind '%v'",
+			trt.spec, sourceKind), specNode)
+}
+
+/*
+checkAttr checks that an attribute is known for the node or edge kind of a
+traversal step.
+*/
+func (v *validator) checkAttr(p *eqlRuntimeProvider, specIndex int, attr string,
+	isNode bool, node *parser.ASTNode) {
+
+	nodeKind, edgeKind := v.stepKinds(p, specIndex)
+
+	if isNode {
+		if nodeKind != "" && attr != data.NodeKey && attr != data.NodeKind &&
+			!hasString(v.gm.NodeAttrs(nodeKind), attr) {
+
+			v.addWarning(ValidationUnknownAttribute,
+				fmt.Sprintf("Attribute '%v' is not known for node kind '%v'", attr, nodeKind), node)
+		}
+
+	} else if edgeKind != "" && attr != data.NodeKey && attr != data.NodeKind &&
+		!strings.HasPrefix(attr, "end1") && !strings.HasPrefix(attr, "end2") &&
+		!hasString(v.gm.EdgeAttrs(edgeKind), attr) {
+
+		v.addWarning(ValidationUnknownAttribute,
+			fmt.Sprintf("Attribute '%v' is not known for edge kind '%v'", attr, edgeKind), node)
+	}
+}
+
+/*
+checkCondition checks the attributes and comparisons of a condition of a
+traversal step.
+*/
+func (v *validator) checkCondition(p *eqlRuntimeProvider, specIndex int, cond *parser.ASTNode) {
+
+	// Subqueries are checked like queries - arguments of functions are
+	// checked by the functions
+
+	if cond.Name == parser.NodeGET || cond.Name == parser.NodeLOOKUP {
+		v.checkKind(cond)
+		v.checkQuery(cond)
+		return
+	} else if cond.Name == parser.NodeFUNC || cond.Token.ID == parser.TokenAT {
+		return
+	}
+
+	if valRT, ok := cond.Runtime.(*valueRuntime); ok && cond.Name == parser.NodeVALUE &&
+		(valRT.isNodeAttrValue || valRT.isEdgeAttrValue) {
+
+		step := specIndex
+		if valRT.step >= 0 {
+			step = valRT.step
+		}
+
+		v.checkAttr(p, step, valRT.condVal, valRT.isNodeAttrValue, cond)
+	}
+
+	switch cond.Name {
+	case parser.NodeEQ, parser.NodeNEQ, parser.NodeLT, parser.NodeLEQ, parser.NodeGT, parser.NodeGEQ:
+		v.checkComparison(p, specIndex, cond)
+	}
+
+	for _, child := range cond.Children {
+		v.checkCondition(p, specIndex, child)
+	}
+}
+
+/*
+checkComparison checks if a comparison always has the same result. An
+unknown name which is compared with a literal was most likely meant to be an
+attribute.
+*/
+func (v *validator) checkComparison(p *eqlRuntimeProvider, specIndex int, cond *parser.ASTNode) {
+	left, right := cond.Children[0], cond.Children[1]
+
+	leftRT, ok1 := left.Runtime.(*valueRuntime)
+	rightRT, ok2 := right.Runtime.(*valueRuntime)
+
+	if !ok1 || !ok2 || left.Token.ID == parser.TokenAT || right.Token.ID == parser.TokenAT ||
+		left.Name == parser.NodeLIST || right.Name == parser.NodeLIST {
+		return
+	}
+
+	isAttr := func(rt *valueRuntime) bool {
+		return rt.node.Name == parser.NodeVALUE && (rt.isNodeAttrValue || rt.isEdgeAttrValue)
+	}
+
+	if isAttr(leftRT) && isAttr(rightRT) {
+
+		if leftRT.condVal == rightRT.condVal && leftRT.isNodeAttrValue == rightRT.isNodeAttrValue &&
+			leftRT.step == rightRT.step {
+
+			v.addWarning(ValidationSuspicious,
+				fmt.Sprintf("Attribute '%v' is compared with itself", leftRT.condVal), cond)
+		}
+
+		return
+
+	} else if isAttr(leftRT) || isAttr(rightRT) {
+		return
+	}
+
+	// Both operands are literals
+
+	looksLikeAttr := func(node *parser.ASTNode) bool {
+		return node.Name == parser.NodeVALUE && !node.Token.Quoted &&
+			!strings.HasPrefix(strings.ToLower(node.Token.Val), "val:") &&
+			identifierRegex.MatchString(node.Token.Val)
+	}
+
+	nodeKind, _ := v.stepKinds(p, specIndex)
+
+	for _, operand := range []*parser.ASTNode{left, right} {
+		if looksLikeAttr(operand) {
+			detail := fmt.Sprintf("Attribute '%v' is not known", operand.Token.Val)
+
+			if nodeKind != "" {
+				detail = fmt.Sprintf("Attribute '%v' is not known for node kind '%v'", operand.Token.Val, nodeKind)
+			}
+
+			v.addWarning(ValidationUnknownAttribute, detail+" - the name is compared as a literal value", operand)
+			return
+		}
+	}
+
+	v.addWarning(ValidationSuspicious, "Comparison of two literal values always has the same result", cond)
+}
+
+/*
+checkColumns checks the attributes of the show clause.
+*/
+func (v *validator) checkColumns(p *eqlRuntimeProvider) {
+
+	if p.show == nil {
+		return
+	}
+
+	for i, col := range p.show.Children {
+
+		// Columns of functions and expressions are not checked
+
+		if i >= len(p.colData) || p.colFunc[i] != nil {
+			continue
+		}
+
+		colDataSplit := strings.SplitN(p.colData[i], ":", 3)
+
+		if len(colDataSplit) != 3 {
+			continue
+		}
+
+		var pos int
+		fmt.Sscan(colDataSplit[0], &pos)
+
+		v.checkAttr(p, pos-1, colDataSplit[2], colDataSplit[1] == "n", col)
+	}
+}
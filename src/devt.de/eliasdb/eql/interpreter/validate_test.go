@@ -0,0 +1,158 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package interpreter
+
+import (
+	"fmt"
+	"testing"
+
+	"devt.de/eliasdb/graph"
+	"devt.de/eliasdb/storage"
+)
+
+func TestValidateQuery(t *testing.T) {
+	gm, mgs := songGraph()
+
+	validate := func(query string) string {
+		res, err := ValidateQuery("test", query, gm, NewDefaultNodeInfo(gm))
+		if err != nil {
+			return err.Error()
+		}
+
+		ret := fmt.Sprint(res.Valid)
+
+		for _, msgs := range [][]*ValidationMessage{res.Errors, res.Warnings} {
+			for _, msg := range msgs {
+				ret += fmt.Sprintf("\n%v %v:%v %v", msg.Type, msg.Line, msg.Pos, msg.Detail)
+				if len(msg.Suggestions) > 0 {
+					ret += fmt.Sprint(" ", msg.Suggestions)
+				}
+			}
+		}
+
+		return ret
+	}
+
+	// Valid queries
+
+	for _, query := range []string{
+		"get Author where name = John traverse :Wrote::Song where ranking > 2 and Wrote:number < Author:key end show name, Song:name, 2:e:number",
+		"get Song where key in (get Song where ranking > 5 show key) and @count(:::Author) > 0",
+		"lookup Author '000', 'bla' traverse ::: end show 2:n:name",
+		"update Song set ranking = ranking + 1 where name = Aria1",
+		"delete from Song where name like 'Aria*'",
+	} {
+		if res := validate(query); res != "true" {
+			t.Error("Unexpected result:", query, res)
+			return
+		}
+	}
+
+	// Errors are reported with their position
+
+	if res := validate("get Song whree name = x"); res != `
+false
+syntax 1:10 Unexpected term (whree) [where]`[1:] {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := validate("get Songs where name = x"); res != `
+false
+unknown_kind 1:5 Node kind 'Songs' is not known`[1:] {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := validate("get Song where name = x show Bla:name"); res != `
+false
+invalid 1:30 Invalid construct (Cannot determine data position for kind: Bla)`[1:] {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := validate("get Song where key in (get Author show key, name)"); res != `
+false
+invalid 1:24 Invalid construct (Subquery must show exactly one column (has 2))`[1:] {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := validate("update Song set key = 1 where name = Aria1"); res != `
+false
+invalid 1:17 Reserved attribute cannot be changed (key)`[1:] {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Unknown attributes are reported for the kind of their step
+
+	if res := validate("get Author where nmae = 'John' or has ranking traverse :Wrote::Song where number > 1 and eattr:name = 1 and Author:ranking = 1 end show nmae, Wrote:rank"); res != `
+true
+unknown_attribute 1:18 Attribute 'nmae' is not known for node kind 'Author' - the name is compared as a literal value
+unknown_attribute 1:39 Attribute 'ranking' is not known for node kind 'Author'
+unknown_attribute 1:90 Attribute 'name' is not known for edge kind 'Wrote'
+unknown_attribute 1:109 Attribute 'ranking' is not known for node kind 'Author'
+unknown_attribute 1:137 Attribute 'nmae' is not known for node kind 'Author'
+unknown_attribute 1:143 Attribute 'rank' is not known for edge kind 'Wrote'`[1:] {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Traversal specs must match a known relationship
+
+	if res := validate("get Author traverse :Wrote::Song traverse :Wrote:Author:Author end traverse :Wrote:Song:Author end traverse :Wrote::Songs end traverse :Write:: end end"); res != `
+true
+unknown_traversal 1:77 Traversal spec ':Wrote:Song:Author' does not match any relationship of node kind 'Song'
+unknown_traversal 1:109 Node kind 'Songs' of traversal spec ':Wrote::Songs' is not known
+unknown_traversal 1:136 Edge kind 'Write' of traversal spec ':Write::' is not known`[1:] {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Comparisons which always have the same result
+
+	if res := validate("get Song where 1 = 1 or name != name or 'a' < val:b or ranking = Song:ranking or name = key"); res != `
+true
+suspicious_comparison 1:18 Comparison of two literal values always has the same result
+suspicious_comparison 1:30 Attribute 'name' is compared with itself
+suspicious_comparison 1:45 Comparison of two literal values always has the same result
+suspicious_comparison 1:64 Attribute 'ranking' is compared with itself`[1:] {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Subqueries are checked like queries
+
+	if res := validate("get Author where key in (get Song where nmae = 1 show key) or key in (lookup Bla '1' show key)"); res != `
+false
+unknown_kind 1:78 Node kind 'Bla' is not known
+unknown_attribute 1:41 Attribute 'nmae' is not known for node kind 'Song' - the name is compared as a literal value`[1:] {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// No data is read
+
+	msm := mgs.StorageManager("main"+"Song"+graph.StorageSuffixNodes, false).(*storage.MemoryStorageManager)
+	msm.AccessMap[1] = storage.AccessCacheAndFetchError
+	defer delete(msm.AccessMap, 1)
+
+	if _, err := getResult("get Author where key in (get Song show key)", "", NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm)), false); err == nil {
+		t.Error("Storage error expected")
+		return
+	}
+
+	if res := validate("get Author where key in (get Song show key)"); res != "true" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
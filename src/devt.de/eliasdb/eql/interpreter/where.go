@@ -11,13 +11,20 @@
 package interpreter
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
+	"regexp/syntax"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"devt.de/eliasdb/eql/parser"
 	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/util"
 )
 
 /*
@@ -54,22 +61,48 @@ func (rt *whereItemRuntime) Eval() (interface{}, error) {
 	return nil, rt.rtp.newRuntimeError(ErrInvalidConstruct, rt.astNode.Name, rt.astNode)
 }
 
+/*
+invalidValue is the value of a where function which could not be evaluated
+for a node (e.g. a date which cannot be parsed). All operations on an invalid
+value produce an invalid value and an invalid value is always false.
+*/
+type invalidValue struct {
+}
+
+/*
+String returns a string representation of an invalid value.
+*/
+func (iv *invalidValue) String() string {
+	return "<invalid>"
+}
+
+/*
+invalid is the singleton invalid value.
+*/
+var invalid = &invalidValue{}
+
+/*
+isNull checks if a value is not set. A value is not set if it is a missing
+attribute, the null constant or an invalid value. All comparisons which
+involve a value which is not set are false.
+*/
+func isNull(res interface{}) bool {
+	return res == nil || res == invalid
+}
+
 /*
 valOp executes an operation on two abstract values.
 */
 func (rt *whereItemRuntime) valOp(node data.Node, edge data.Edge, op func(interface{}, interface{}) interface{}) (interface{}, error) {
 
-	res1, err := rt.astNode.Children[0].Runtime.(CondRuntime).CondEval(node, edge)
-	if err != nil {
-		return nil, err
-	}
+	return rt.operands(node, edge, func(res1 interface{}, res2 interface{}) interface{} {
 
-	res2, err := rt.astNode.Children[1].Runtime.(CondRuntime).CondEval(node, edge)
-	if err != nil {
-		return nil, err
-	}
+		if isNull(res1) || isNull(res2) {
+			return invalid
+		}
 
-	return op(res1, res2), nil
+		return op(res1, res2)
+	})
 }
 
 /*
@@ -77,118 +110,166 @@ stringOp executes an operation on two strings.
 */
 func (rt *whereItemRuntime) stringOp(node data.Node, edge data.Edge, op func(string, string) interface{}) (interface{}, error) {
 
-	res1, err := rt.astNode.Children[0].Runtime.(CondRuntime).CondEval(node, edge)
-	if err != nil {
-		return nil, err
-	}
+	return rt.operands(node, edge, func(res1 interface{}, res2 interface{}) interface{} {
 
-	res2, err := rt.astNode.Children[1].Runtime.(CondRuntime).CondEval(node, edge)
-	if err != nil {
-		return nil, err
-	}
+		if isNull(res1) || isNull(res2) {
+			return invalid
+		}
 
-	return op(fmt.Sprint(res1), fmt.Sprint(res2)), nil
+		if rt.rtp.withFlags.nocase {
+			return op(foldString(fmt.Sprint(res1)), foldString(fmt.Sprint(res2)))
+		}
+
+		return op(fmt.Sprint(res1), fmt.Sprint(res2))
+	})
 }
 
 /*
-regexOp executes an operation on a string and a regex.
+compareOp compares two values with the coercion rules of the query (see
+valueComparator). The result is false if the values cannot be compared.
 */
-func (rt *whereItemRuntime) regexOp(node data.Node, edge data.Edge, op func(string, *regexp.Regexp) interface{}) (interface{}, error) {
+func (rt *whereItemRuntime) compareOp(node data.Node, edge data.Edge, op func(int) bool) (interface{}, error) {
+	vc := rt.rtp.comparator()
 
-	res1, err := rt.astNode.Children[0].Runtime.(CondRuntime).CondEval(node, edge)
-	if err != nil {
-		return nil, err
-	}
+	return rt.valOp(node, edge, func(res1 interface{}, res2 interface{}) interface{} {
+		res, ok := vc.compare(res1, res2)
+		return ok && op(res)
+	})
+}
 
-	res2, err := rt.astNode.Children[1].Runtime.(CondRuntime).CondEval(node, edge)
-	if err != nil {
-		return nil, err
-	}
+/*
+arithOp executes an arithmetic operation on one or two number values. The
+result is an invalid value if a value is not set or if the operation has no
+result (division by zero).
+*/
+func (rt *whereItemRuntime) arithOp(node data.Node, edge data.Edge) (interface{}, error) {
+	nums := make([]float64, 0, 2)
 
-	// Try to compile the regex
+	for _, c := range rt.astNode.Children {
+		res, err := c.Runtime.(CondRuntime).CondEval(node, edge)
+		if err != nil {
+			return nil, err
+		}
 
-	res2String := fmt.Sprint(res2)
+		if isNull(res) {
+			return invalid, nil
+		}
 
-	regexp, err := regexp.Compile(res2String)
-	if err != nil {
-		return nil, rt.rtp.newRuntimeError(ErrNotARegex,
-			fmt.Sprintf("%#v - %s", res2String, err.Error()), rt.astNode.Children[1])
+		num, err := data.ToFloat64(res)
+		if err != nil {
+			return nil, rt.rtp.newRuntimeError(ErrNotANumber, opErrorDetail(c.Token.Val, fmt.Sprint(res)), c)
+		}
+
+		nums = append(nums, num)
+	}
+
+	if res := arithmetic(rt.astNode.Name, nums); res != nil {
+		return res, nil
 	}
 
-	return op(fmt.Sprint(res1), regexp), nil
+	return invalid, nil
 }
 
 /*
-numOp executes an operation on two number values.
+operands evaluates both operands of a binary operation and executes the
+operation on their values. The right operand is evaluated once (see leftOp).
 */
-func (rt *whereItemRuntime) numOp(node data.Node, edge data.Edge, op func(float64, float64) interface{}) (interface{}, error) {
+func (rt *whereItemRuntime) operands(node data.Node, edge data.Edge, op func(interface{}, interface{}) interface{}) (interface{}, error) {
+	var res2 interface{}
+	var evaluated bool
 
-	res1, err := rt.astNode.Children[0].Runtime.(CondRuntime).CondEval(node, edge)
-	if err != nil {
-		return nil, err
-	}
+	return rt.leftOp(node, edge, func(res1 interface{}) (interface{}, error) {
 
-	res2, err := rt.astNode.Children[1].Runtime.(CondRuntime).CondEval(node, edge)
-	if err != nil {
-		return nil, err
-	}
+		if !evaluated {
+			var err error
+
+			if res2, err = rt.astNode.Children[1].Runtime.(CondRuntime).CondEval(node, edge); err != nil {
+				return nil, err
+			}
 
-	errDetail := func(tokenVal string, opVal string) string {
-		if tokenVal == opVal {
-			return opVal
+			evaluated = true
 		}
 
-		return tokenVal + "=" + opVal
-	}
+		return op(res1, res2), nil
+	})
+}
 
-	// Parse the values to numbers
+/*
+leftOp evaluates the left operand of an operation and executes the operation
+on its value. If the left operand is quantified with any or all then the
+operation is executed for every item of the list and the results are combined
+(see quantifierRuntime).
+*/
+func (rt *whereItemRuntime) leftOp(node data.Node, edge data.Edge, op func(interface{}) (interface{}, error)) (interface{}, error) {
 
-	res1Str := fmt.Sprint(res1)
-	res1Num, err := strconv.ParseFloat(res1Str, 64)
-	if err != nil {
-		return nil, rt.rtp.newRuntimeError(ErrNotANumber, errDetail(rt.astNode.Children[0].Token.Val, res1Str), rt.astNode.Children[0])
+	left := rt.astNode.Children[0]
+
+	qrt, ok := left.Runtime.(*quantifierRuntime)
+	if !ok {
+		res1, err := left.Runtime.(CondRuntime).CondEval(node, edge)
+		if err != nil {
+			return nil, err
+		}
+
+		return op(res1)
 	}
 
-	res2Str := fmt.Sprint(res2)
-	res2Num, err := strconv.ParseFloat(res2Str, 64)
-	if err != nil {
-		return nil, rt.rtp.newRuntimeError(ErrNotANumber, errDetail(rt.astNode.Children[1].Token.Val, res2Str), rt.astNode.Children[1])
+	items, err := qrt.items(node, edge)
+	if err != nil || items == nil {
+		return false, err
 	}
 
-	return op(res1Num, res2Num), nil
+	// Stop at the first item which decides the result
+
+	for _, item := range items {
+		res, err := op(item)
+		if err != nil {
+			return nil, err
+		}
+
+		if toBool(res) != qrt.all {
+			return !qrt.all, nil
+		}
+	}
+
+	return qrt.all, nil
 }
 
 /*
 listOp executes a list operation on a single value and a list.
 */
 func (rt *whereItemRuntime) listOp(node data.Node, edge data.Edge, op func(interface{}, []interface{}) interface{}) (interface{}, error) {
+	var listErr error
 
-	res1, err := rt.astNode.Children[0].Runtime.(CondRuntime).CondEval(node, edge)
-	if err != nil {
-		return nil, err
-	}
+	right := rt.astNode.Children[1]
 
-	res2, err := rt.astNode.Children[1].Runtime.(CondRuntime).CondEval(node, edge)
-	if err != nil {
-		return nil, err
-	}
+	res, err := rt.operands(node, edge, func(res1 interface{}, res2 interface{}) interface{} {
 
-	errDetail := func(tokenVal string, opVal string) string {
-		if tokenVal == opVal {
-			return opVal
+		if isNull(res1) || isNull(res2) {
+			return invalid
 		}
 
-		return tokenVal + "=" + opVal
-	}
+		// Parse right value to a list - the value of an attribute is a list
+		// with a single item if it is not a list
+
+		res2List, ok := toList(res2)
+		if !ok && isAttrValue(right) {
+			res2List, ok = []interface{}{res2}, true
+		}
 
-	// Parse right value to a list
+		if !ok {
+			listErr = rt.rtp.newRuntimeError(ErrNotAList, opErrorDetail(right.Token.Val, fmt.Sprint(res2)), right)
+			return invalid
+		}
 
-	res2List, ok := res2.([]interface{})
-	if !ok {
-		return nil, rt.rtp.newRuntimeError(ErrNotAList, errDetail(rt.astNode.Children[1].Token.Val, fmt.Sprint(res2)), rt.astNode.Children[1])
+		return op(res1, res2List)
+	})
+
+	if listErr != nil {
+		return nil, listErr
 	}
 
-	return op(res1, res2List), nil
+	return res, err
 }
 
 /*
@@ -238,6 +319,9 @@ func toBool(res interface{}) bool {
 	default:
 		return res != nil
 
+	case *invalidValue:
+		return false
+
 	case bool:
 		return res
 
@@ -257,19 +341,87 @@ func toBool(res interface{}) bool {
 	}
 }
 
-func equals(res1 interface{}, res2 interface{}) bool {
+/*
+equalsOp returns the equality function of the query.
+*/
+func (rt *whereItemRuntime) equalsOp() func(interface{}, interface{}) bool {
+	return rt.rtp.comparator().equals
+}
 
-	// Try to convert the string into a number
+// Case folding
+// ============
 
-	num1, err := strconv.ParseFloat(fmt.Sprint(res1), 64)
-	if err == nil {
-		num2, err := strconv.ParseFloat(fmt.Sprint(res2), 64)
-		if err == nil {
-			return num1 == num2
+/*
+Case foldings which map a single character to several characters. All other
+characters use the simple case folding of Unicode.
+*/
+var fullCaseFolding = map[rune]string{
+	'\u00df': "ss", // Latin small letter sharp s
+	'\u1e9e': "ss", // Latin capital letter sharp s
+}
+
+/*
+foldRune returns the canonical form of a character under simple case folding.
+All characters which are equal under case folding have the same canonical
+form (the smallest character of their case folding orbit).
+*/
+func foldRune(r rune) rune {
+	min := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	return min
+}
+
+/*
+foldString returns the canonical form of a string for case-insensitive
+comparisons. The canonical form is not meant to be displayed. Locale specific
+foldings (e.g. the Turkish dotless i) are not supported.
+*/
+func foldString(s string) string {
+	var buf strings.Builder
+
+	for _, r := range s {
+		if full, ok := fullCaseFolding[r]; ok {
+			for _, fr := range full {
+				buf.WriteRune(foldRune(fr))
+			}
+		} else {
+			buf.WriteRune(foldRune(r))
 		}
 	}
 
-	return fmt.Sprintf("%v", res1) == fmt.Sprintf("%v", res2)
+	return buf.String()
+}
+
+/*
+foldIndexSafe checks if a word can be looked up in an index for a
+case-insensitive comparison. This is the case if all case variants of the word
+have the same normalized form in the index. Words which contain characters
+with a full case folding (or the result of one) are never safe.
+*/
+func foldIndexSafe(analyzer util.Analyzer, word string) bool {
+
+	folded := foldString(word)
+
+	for r, full := range fullCaseFolding {
+		if strings.ContainsRune(word, r) || strings.Contains(folded, foldString(full)) {
+			return false
+		}
+	}
+
+	for _, r := range word {
+		norm := analyzer.Normalize(string(r))
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if analyzer.Normalize(string(f)) != norm {
+				return false
+			}
+		}
+	}
+
+	return true
 }
 
 // Where runtime
@@ -282,14 +434,15 @@ type whereRuntime struct {
 	rtp     *eqlRuntimeProvider
 	astNode *parser.ASTNode
 
-	specIndex int // Index of this traversal in the traversals array
+	specIndex int   // Index of this traversal in the traversals array
+	ancestors []int // Spec indices of all enclosing steps (nearest first)
 }
 
 /*
 whereRuntimeInst returns a new runtime component instance.
 */
 func whereRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Runtime {
-	return &whereRuntime{rtp, node, 0}
+	return &whereRuntime{rtp, node, 0, nil}
 }
 
 /*
@@ -300,6 +453,12 @@ func (rt *whereRuntime) Validate() error {
 
 	visitChildren = func(astNode *parser.ASTNode) error {
 
+		// Subqueries are validated by their own runtime provider when they run
+
+		if astNode.Name == parser.NodeGET || astNode.Name == parser.NodeLOOKUP {
+			return nil
+		}
+
 		// Determine which values should be interpreted as node attributes
 
 		if astNode.Name == parser.NodeVALUE {
@@ -311,6 +470,8 @@ func (rt *whereRuntime) Validate() error {
 				return astNode.Runtime.Validate()
 			}
 
+			valRuntime.step = -1
+
 			if strings.HasPrefix(lcval, "eattr:") {
 				valRuntime.condVal = val[6:]
 				valRuntime.isNodeAttrValue = false
@@ -327,17 +488,25 @@ func (rt *whereRuntime) Validate() error {
 				valRuntime.isEdgeAttrValue = false
 
 			} else {
-				valRuntime.condVal = val
-				valRuntime.isNodeAttrValue = rt.rtp.ni.IsValidAttr(val)
-				valRuntime.isEdgeAttrValue = false
+
+				// An empty value is always a literal
+
+				valRuntime.condVal, valRuntime.isNodeAttrValue,
+					valRuntime.isEdgeAttrValue, valRuntime.step = rt.resolveAttr(val)
 			}
 
-			// Make sure attributes are queried
+			// Make sure attributes are queried (attributes of enclosing
+			// steps are fetched with the nodes and edges of these steps)
+
+			specIndex := rt.specIndex
+			if valRuntime.step >= 0 {
+				specIndex = valRuntime.step
+			}
 
 			if valRuntime.isNodeAttrValue {
-				rt.rtp.attrsNodes[rt.specIndex][valRuntime.condVal] = ""
+				rt.rtp.attrsNodes[specIndex][valRuntime.condVal] = ""
 			} else if valRuntime.isEdgeAttrValue {
-				rt.rtp.attrsEdges[rt.specIndex][valRuntime.condVal] = ""
+				rt.rtp.attrsEdges[specIndex][valRuntime.condVal] = ""
 			}
 		}
 
@@ -347,12 +516,97 @@ func (rt *whereRuntime) Validate() error {
 			}
 		}
 
+		if err := validateQuantifiers(rt.rtp, astNode); err != nil {
+			return err
+		}
+
+		// Operands of has are always attribute names
+
+		if hasRT, ok := astNode.Runtime.(*hasRuntime); ok {
+			return hasRT.validate(rt.specIndex)
+		}
+
+		// Constant patterns are compiled once per query
+
+		if patternRT, ok := astNode.Runtime.(*patternRuntime); ok {
+			return patternRT.compile()
+		}
+
+		// Constant lists and subqueries are materialized once per query
+
+		if inRT, ok := astNode.Runtime.(*inRuntime); ok {
+			return inRT.compile()
+		}
+
 		return nil
 	}
 
 	return visitChildren(rt.astNode)
 }
 
+/*
+resolveAttr determines if a value of the where clause is the name of a node
+attribute, the name of an edge attribute or a literal. Attributes of a
+traversal can be qualified with the node or edge kind of the traversal spec
+(e.g. Wrote:number). A qualified name may also refer to an attribute of an
+enclosing step of the query (e.g. Author:name in the where clause of a
+traversal from Author nodes) - the closest step with a matching kind is used.
+In this case the spec index of the step is returned (otherwise -1).
+Unqualified names are node attributes unless only the edge kind of the
+traversal has an attribute of that name.
+*/
+func (rt *whereRuntime) resolveAttr(val string) (string, bool, bool, int) {
+
+	kinds := func(specIndex int) (string, string) {
+		if specIndex > 0 {
+			sspec := strings.Split(rt.rtp.specs[specIndex], ":")
+			return sspec[1], sspec[3]
+		}
+		return "", rt.rtp.specs[0]
+	}
+
+	edgeKind, nodeKind := kinds(rt.specIndex)
+
+	if i := strings.Index(val, ":"); i > 0 && rt.rtp.ni.IsValidAttr(val[i+1:]) {
+		kind, attr := val[:i], val[i+1:]
+
+		if kind == edgeKind {
+			return attr, false, true, -1
+		} else if kind == nodeKind {
+			return attr, true, false, -1
+		}
+
+		for _, step := range rt.ancestors {
+			stepEdgeKind, stepNodeKind := kinds(step)
+
+			if kind == stepEdgeKind {
+				return attr, false, true, step
+			} else if kind == stepNodeKind {
+				return attr, true, false, step
+			}
+		}
+	}
+
+	if val == "" || !rt.rtp.ni.IsValidAttr(val) {
+		return val, false, false, -1
+	}
+
+	// Attribute lists of the graph manager are sorted
+
+	hasAttr := func(attrs []string) bool {
+		i := sort.SearchStrings(attrs, val)
+		return i < len(attrs) && attrs[i] == val
+	}
+
+	if edgeKind != "" && nodeKind != "" && !hasAttr(rt.rtp.gm.NodeAttrs(nodeKind)) &&
+		hasAttr(rt.rtp.gm.EdgeAttrs(edgeKind)) {
+
+		return val, false, true, -1
+	}
+
+	return val, true, false, -1
+}
+
 /*
 Eval evaluates the where clause a
 */
@@ -365,6 +619,14 @@ CondEval evaluates this condition runtime element.
 */
 func (rt *whereRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
 	res, err := rt.astNode.Children[0].Runtime.(CondRuntime).CondEval(node, edge)
+
+	// Matches of @phrase conditions are only kept if the node passed the
+	// where clause
+
+	if rt.rtp.highlights != nil {
+		rt.rtp.highlights.commit(err == nil && toBool(res))
+	}
+
 	return toBool(res), err
 }
 
@@ -389,7 +651,7 @@ func equalRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Runt
 Evaluate this condition runtime element.
 */
 func (rt *equalRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
-	return rt.valOp(node, edge, func(res1 interface{}, res2 interface{}) interface{} { return equals(res1, res2) })
+	return rt.compareOp(node, edge, func(res int) bool { return res == 0 })
 }
 
 /*
@@ -410,7 +672,7 @@ func notEqualRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.R
 CondEval evaluates this condition runtime element.
 */
 func (rt *notEqualRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
-	return rt.valOp(node, edge, func(res1 interface{}, res2 interface{}) interface{} { return !equals(res1, res2) })
+	return rt.compareOp(node, edge, func(res int) bool { return res != 0 })
 }
 
 /*
@@ -431,7 +693,7 @@ func lessThanRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.R
 CondEval evaluates this condition runtime element.
 */
 func (rt *lessThanRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
-	return rt.numOp(node, edge, func(res1 float64, res2 float64) interface{} { return res1 < res2 })
+	return rt.compareOp(node, edge, func(res int) bool { return res < 0 })
 }
 
 /*
@@ -452,7 +714,7 @@ func lessThanEqualsRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) pa
 CondEval evaluates this condition runtime element.
 */
 func (rt *lessThanEqualsRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
-	return rt.numOp(node, edge, func(res1 float64, res2 float64) interface{} { return res1 <= res2 })
+	return rt.compareOp(node, edge, func(res int) bool { return res <= 0 })
 }
 
 /*
@@ -473,7 +735,7 @@ func greaterThanRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parse
 CondEval evaluates this condition runtime element.
 */
 func (rt *greaterThanRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
-	return rt.numOp(node, edge, func(res1 float64, res2 float64) interface{} { return res1 > res2 })
+	return rt.compareOp(node, edge, func(res int) bool { return res > 0 })
 }
 
 /*
@@ -494,7 +756,7 @@ func greaterThanEqualsRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode)
 CondEval evaluates this condition runtime element.
 */
 func (rt *greaterThanEqualsRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
-	return rt.numOp(node, edge, func(res1 float64, res2 float64) interface{} { return res1 >= res2 })
+	return rt.compareOp(node, edge, func(res int) bool { return res >= 0 })
 }
 
 /*
@@ -572,6 +834,179 @@ func (rt *notRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, err
 	return rt.boolOp(node, edge, func(res1 bool, res2 bool) interface{} { return !res1 }, nil)
 }
 
+/*
+Has runtime
+*/
+type hasRuntime struct {
+	*whereItemRuntime
+}
+
+/*
+hasRuntimeInst returns a new runtime component instance.
+*/
+func hasRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Runtime {
+	return &hasRuntime{&whereItemRuntime{rtp, node}}
+}
+
+/*
+validate makes sure that the operand is an attribute name. The operand is
+always a node attribute unless it is prefixed with 'eattr:'.
+*/
+func (rt *hasRuntime) validate(specIndex int) error {
+	child := rt.astNode.Children[0]
+
+	valRuntime, ok := child.Runtime.(*valueRuntime)
+
+	if !ok || child.Name != parser.NodeVALUE ||
+		strings.HasPrefix(strings.ToLower(child.Token.Val), "val:") {
+
+		return rt.rtp.newRuntimeError(ErrInvalidWhere,
+			"Operand of has must be an attribute name", child)
+	}
+
+	if !valRuntime.isEdgeAttrValue && valRuntime.step < 0 {
+		valRuntime.isNodeAttrValue = true
+		rt.rtp.attrsNodes[specIndex][valRuntime.condVal] = ""
+	}
+
+	return nil
+}
+
+/*
+CondEval evaluates this condition runtime element.
+*/
+func (rt *hasRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
+	res, err := rt.astNode.Children[0].Runtime.(CondRuntime).CondEval(node, edge)
+	if err != nil {
+		return nil, err
+	}
+
+	return res != nil, nil
+}
+
+/*
+Quantifier runtime for any and all. A quantifier can only be the left operand
+of a comparison (see quantifiableOps). The comparison is evaluated for every
+item of the list value of its operand - with any it is true if it is true for
+one item and with all it is true if it is true for every item. A value which
+is not a list is a list with a single item. A missing value is false for both
+quantifiers and an empty list is false for any and true for all.
+*/
+type quantifierRuntime struct {
+	all bool // Flag if the comparison must be true for all items
+	*whereItemRuntime
+}
+
+/*
+anyRuntimeInst returns a new runtime component instance.
+*/
+func anyRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Runtime {
+	return &quantifierRuntime{false, &whereItemRuntime{rtp, node}}
+}
+
+/*
+allRuntimeInst returns a new runtime component instance.
+*/
+func allRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Runtime {
+	return &quantifierRuntime{true, &whereItemRuntime{rtp, node}}
+}
+
+/*
+Operators which support a quantified left operand
+*/
+var quantifiableOps = map[string]bool{
+	parser.NodeEQ:          true,
+	parser.NodeNEQ:         true,
+	parser.NodeLT:          true,
+	parser.NodeLEQ:         true,
+	parser.NodeGT:          true,
+	parser.NodeGEQ:         true,
+	parser.NodeIN:          true,
+	parser.NodeNOTIN:       true,
+	parser.NodeLIKE:        true,
+	parser.NodeILIKE:       true,
+	parser.NodeMATCHES:     true,
+	parser.NodeIMATCHES:    true,
+	parser.NodeCONTAINS:    true,
+	parser.NodeCONTAINSNOT: true,
+	parser.NodeBEGINSWITH:  true,
+	parser.NodeENDSWITH:    true,
+}
+
+/*
+validateQuantifiers makes sure that quantifiers are only used as the left
+operand of a comparison.
+*/
+func validateQuantifiers(rtp *eqlRuntimeProvider, astNode *parser.ASTNode) error {
+	for i, child := range astNode.Children {
+		if _, ok := child.Runtime.(*quantifierRuntime); ok && (i > 0 || !quantifiableOps[astNode.Name]) {
+			return rtp.newRuntimeError(ErrInvalidWhere,
+				fmt.Sprintf("Operand of %v must be the left operand of a comparison", child.Name), child)
+		}
+	}
+
+	return nil
+}
+
+/*
+items returns the items of the list value of the operand. Returns nil if the
+value is not set.
+*/
+func (rt *quantifierRuntime) items(node data.Node, edge data.Edge) ([]interface{}, error) {
+	res, err := rt.astNode.Children[0].Runtime.(CondRuntime).CondEval(node, edge)
+	if err != nil || isNull(res) {
+		return nil, err
+	}
+
+	if list, ok := toList(res); ok {
+		return list, nil
+	}
+
+	return []interface{}{res}, nil
+}
+
+/*
+CondEval evaluates this condition runtime element.
+*/
+func (rt *quantifierRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
+	return nil, rt.rtp.newRuntimeError(ErrInvalidWhere,
+		fmt.Sprintf("Operand of %v must be the left operand of a comparison", rt.astNode.Name), rt.astNode)
+}
+
+/*
+toList converts a list value (e.g. a string slice attribute) into a list of
+values. Strings are not lists.
+*/
+func toList(val interface{}) ([]interface{}, bool) {
+
+	if list, ok := val.([]interface{}); ok {
+		return list, true
+	}
+
+	rv := reflect.ValueOf(val)
+
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	list := make([]interface{}, rv.Len())
+
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+
+	return list, true
+}
+
+/*
+isAttrValue checks if a given node of the where clause is the name of a node
+or edge attribute.
+*/
+func isAttrValue(astNode *parser.ASTNode) bool {
+	valRT, ok := astNode.Runtime.(*valueRuntime)
+	return ok && astNode.Name == parser.NodeVALUE && (valRT.isNodeAttrValue || valRT.isEdgeAttrValue)
+}
+
 /*
 Plus runtime
 */
@@ -590,7 +1025,7 @@ func plusRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Runti
 CondEval evaluates this condition runtime element.
 */
 func (rt *plusRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
-	return rt.numOp(node, edge, func(res1 float64, res2 float64) interface{} { return res1 + res2 })
+	return rt.arithOp(node, edge)
 }
 
 /*
@@ -611,7 +1046,7 @@ func minusRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Runt
 CondEval evaluates this condition runtime element.
 */
 func (rt *minusRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
-	return rt.numOp(node, edge, func(res1 float64, res2 float64) interface{} { return res1 - res2 })
+	return rt.arithOp(node, edge)
 }
 
 /*
@@ -632,7 +1067,7 @@ func timesRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Runt
 CondEval evaluates this condition runtime element.
 */
 func (rt *timesRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
-	return rt.numOp(node, edge, func(res1 float64, res2 float64) interface{} { return res1 * res2 })
+	return rt.arithOp(node, edge)
 }
 
 /*
@@ -653,7 +1088,7 @@ func divRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Runtim
 CondEval evaluates this condition runtime element.
 */
 func (rt *divRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
-	return rt.numOp(node, edge, func(res1 float64, res2 float64) interface{} { return res1 / res2 })
+	return rt.arithOp(node, edge)
 }
 
 /*
@@ -674,7 +1109,7 @@ func modIntRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Run
 CondEval evaluates this condition runtime element.
 */
 func (rt *modIntRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
-	return rt.numOp(node, edge, func(res1 float64, res2 float64) interface{} { return int(int(res1) % int(res2)) })
+	return rt.arithOp(node, edge)
 }
 
 /*
@@ -695,13 +1130,15 @@ func divIntRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Run
 CondEval evaluates this condition runtime element.
 */
 func (rt *divIntRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
-	return rt.numOp(node, edge, func(res1 float64, res2 float64) interface{} { return int(int(res1) / int(res2)) })
+	return rt.arithOp(node, edge)
 }
 
 /*
-In runtime
+In runtime for the in and notin operators
 */
 type inRuntime struct {
+	not bool      // Flag if the operator is negated (notin)
+	set *valueSet // Materialized set of a constant list or a subquery
 	*whereItemRuntime
 }
 
@@ -709,60 +1146,240 @@ type inRuntime struct {
 inRuntimeInst returns a new runtime component instance.
 */
 func inRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Runtime {
-	return &inRuntime{&whereItemRuntime{rtp, node}}
+	return &inRuntime{false, nil, &whereItemRuntime{rtp, node}}
 }
 
 /*
-CondEval evaluates this condition runtime element.
+notInRuntimeInst returns a new runtime component instance.
 */
-func (rt *inRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
-	return rt.listOp(node, edge, func(res1 interface{}, res2 []interface{}) interface{} {
+func notInRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Runtime {
+	return &inRuntime{true, nil, &whereItemRuntime{rtp, node}}
+}
 
-		for _, item := range res2 {
-			if equals(res1, item) {
-				return true
+/*
+compile materializes the right side of the operator into a set if it is a
+list of constant values or a subquery. Subqueries are run once per query
+and must show exactly one column.
+*/
+func (rt *inRuntime) compile() error {
+	rt.set = nil
+
+	right := rt.astNode.Children[1]
+
+	if right.Name == parser.NodeGET || right.Name == parser.NodeLOOKUP {
+
+		if rt.rtp.validateOnly {
+			return rt.validateSubquery(right)
+		}
+
+		res, err := rt.runSubquery(right)
+		if err != nil {
+			return err
+		}
+
+		rt.set = newValueSet(rt.rtp.comparator())
+
+		for _, row := range res.Data {
+			rt.set.add(row[0])
+		}
+
+	} else if right.Name == parser.NodeLIST {
+
+		for _, item := range right.Children {
+			valRT, ok := item.Runtime.(*valueRuntime)
+			if !ok || item.Name == parser.NodeLIST || item.Token.ID == parser.TokenAT ||
+				valRT.isNodeAttrValue || valRT.isEdgeAttrValue {
+				return nil
 			}
 		}
 
-		return false
-	})
+		list, err := right.Runtime.(CondRuntime).CondEval(nil, nil)
+		if err != nil {
+			return err
+		}
+
+		rt.set = newValueSet(rt.rtp.comparator())
+
+		for _, item := range list.([]interface{}) {
+			rt.set.add(item)
+		}
+	}
+
+	return nil
 }
 
 /*
-Not in runtime
+newSubquery creates a runtime provider for a subquery and replaces the runtime
+components of the subquery which were created by the provider of the outer
+query.
 */
-type notInRuntime struct {
-	*whereItemRuntime
+func (rt *inRuntime) newSubquery(query *parser.ASTNode) *eqlRuntimeProvider {
+	var rtp parser.RuntimeProvider
+	var erp *eqlRuntimeProvider
+
+	if query.Name == parser.NodeGET {
+		grtp := NewGetRuntimeProvider(rt.rtp.name, rt.rtp.part, rt.rtp.gm, rt.rtp.ni)
+		rtp, erp = grtp, grtp.eqlRuntimeProvider
+	} else {
+		lrtp := NewLookupRuntimeProvider(rt.rtp.name, rt.rtp.part, rt.rtp.gm, rt.rtp.ni)
+		rtp, erp = lrtp, lrtp.eqlRuntimeProvider
+	}
+
+	erp.Context = rt.rtp.Context
+	erp.Workers = rt.rtp.Workers
+	erp.parent = rt.rtp
+	erp.validateOnly = rt.rtp.validateOnly
+
+	var decorate func(node *parser.ASTNode)
+
+	decorate = func(node *parser.ASTNode) {
+		node.Runtime = rtp.Runtime(node)
+		for _, child := range node.Children {
+			decorate(child)
+		}
+	}
+
+	decorate(query)
+
+	return erp
 }
 
 /*
-notInRuntimeInst returns a new runtime component instance.
+runSubquery runs a subquery with its own runtime provider.
 */
-func notInRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Runtime {
-	return &notInRuntime{&whereItemRuntime{rtp, node}}
+func (rt *inRuntime) runSubquery(query *parser.ASTNode) (*SearchResult, error) {
+
+	rt.newSubquery(query)
+
+	res, err := query.Runtime.Eval()
+	if err != nil {
+		return nil, err
+	}
+
+	sr := res.(*SearchResult)
+
+	if len(sr.ColData) != 1 {
+		return nil, rt.rtp.newRuntimeError(ErrInvalidConstruct,
+			fmt.Sprintf("Subquery must show exactly one column (has %v)", len(sr.ColData)), query)
+	}
+
+	return sr, nil
+}
+
+/*
+validateSubquery validates a subquery without running it.
+*/
+func (rt *inRuntime) validateSubquery(query *parser.ASTNode) error {
+
+	rtp := rt.newSubquery(query)
+
+	if err := query.Runtime.Validate(); err != nil {
+		return err
+	}
+
+	if len(rtp.colData) != 1 {
+		return rt.rtp.newRuntimeError(ErrInvalidConstruct,
+			fmt.Sprintf("Subquery must show exactly one column (has %v)", len(rtp.colData)), query)
+	}
+
+	return nil
 }
 
 /*
 CondEval evaluates this condition runtime element.
 */
-func (rt *notInRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
+func (rt *inRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
+
+	if rt.set != nil {
+		return rt.leftOp(node, edge, func(res1 interface{}) (interface{}, error) {
+
+			if isNull(res1) {
+				return invalid, nil
+			}
+
+			return rt.set.contains(res1) != rt.not, nil
+		})
+	}
+
+	eq := rt.equalsOp()
+
 	return rt.listOp(node, edge, func(res1 interface{}, res2 []interface{}) interface{} {
 
 		for _, item := range res2 {
-			if equals(res1, item) {
-				return false
+			if eq(res1, item) {
+				return !rt.not
 			}
 		}
 
-		return true
+		return rt.not
 	})
 }
 
 /*
-Like runtime
+valueSet is a set of values. Values are compared with the same rules as in
+comparisons (see valueComparator) - numbers by their numeric value and
+everything else by its string representation.
+*/
+type valueSet struct {
+	nums map[float64]bool // Numeric values
+	strs map[string]bool  // String representations of all other values
+	vc   valueComparator  // Comparison rules of the query
+}
+
+/*
+newValueSet creates a new empty value set.
+*/
+func newValueSet(vc valueComparator) *valueSet {
+	return &valueSet{make(map[float64]bool), make(map[string]bool), vc}
+}
+
+/*
+str returns the string representation of a value in the set. Values of
+different classes have different representations in strict mode.
+*/
+func (vs *valueSet) str(val interface{}) string {
+	ret := fmt.Sprint(val)
+
+	if vs.vc.fold {
+		ret = foldString(ret)
+	}
+
+	if vs.vc.strict {
+		ret = fmt.Sprint(valueClass(val), ":", ret)
+	}
+
+	return ret
+}
+
+/*
+add adds a value to the set.
+*/
+func (vs *valueSet) add(val interface{}) {
+	if num, ok := vs.vc.toNumber(val); ok {
+		vs.nums[num] = true
+	} else {
+		vs.strs[vs.str(val)] = true
+	}
+}
+
+/*
+contains checks if a value is equal to a value in the set.
 */
-type likeRuntime struct {
-	compiledRegex *regexp.Regexp // Quick lookup of the compiled regex if it is a constant
+func (vs *valueSet) contains(val interface{}) bool {
+	if num, ok := vs.vc.toNumber(val); ok {
+		return vs.nums[num]
+	}
+	return vs.strs[vs.str(val)]
+}
+
+/*
+Pattern runtime for glob (like, ilike) and regex (matches, imatches) operators
+*/
+type patternRuntime struct {
+	glob            bool           // Flag if the pattern is a glob pattern
+	caseInsensitive bool           // Flag if the pattern is case-insensitive
+	compiledRegex   *regexp.Regexp // Compiled pattern if it is a constant
+	prefix          string         // Literal prefix of all matching values of a constant pattern
 	*whereItemRuntime
 }
 
@@ -770,38 +1387,272 @@ type likeRuntime struct {
 likeRuntimeInst returns a new runtime component instance.
 */
 func likeRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Runtime {
-	return &likeRuntime{nil, &whereItemRuntime{rtp, node}}
+	return &patternRuntime{true, false, nil, "", &whereItemRuntime{rtp, node}}
 }
 
 /*
-CondEval evaluates this condition runtime element.
+iLikeRuntimeInst returns a new runtime component instance.
+*/
+func iLikeRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Runtime {
+	return &patternRuntime{true, true, nil, "", &whereItemRuntime{rtp, node}}
+}
+
+/*
+matchesRuntimeInst returns a new runtime component instance.
+*/
+func matchesRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Runtime {
+	return &patternRuntime{false, false, nil, "", &whereItemRuntime{rtp, node}}
+}
+
+/*
+iMatchesRuntimeInst returns a new runtime component instance.
+*/
+func iMatchesRuntimeInst(rtp *eqlRuntimeProvider, node *parser.ASTNode) parser.Runtime {
+	return &patternRuntime{false, true, nil, "", &whereItemRuntime{rtp, node}}
+}
+
+/*
+compile compiles the pattern of this runtime once if it is a constant. This
+function is called when the where clause is validated so invalid constant
+patterns are reported before any data is read.
+*/
+func (rt *patternRuntime) compile() error {
+	rt.compiledRegex = nil
+	rt.prefix = ""
+
+	valRT, ok := rt.astNode.Children[1].Runtime.(*valueRuntime)
+	if !ok || valRT.node.Name != parser.NodeVALUE || valRT.isNodeAttrValue || valRT.isEdgeAttrValue {
+		return nil
+	}
+
+	val, _ := valRT.CondEval(nil, nil)
+
+	regex, err := rt.regex(fmt.Sprint(val))
+	if err != nil {
+		return err
+	}
+
+	rt.compiledRegex = regex
+
+	// Determine the literal prefix of all matching values (the case-sensitive
+	// expression is used for case-insensitive patterns)
+
+	expr := fmt.Sprint(val)
+	if rt.glob {
+		expr = globToRegex(expr)
+	}
+
+	if re, err := syntax.Parse(expr, syntax.Perl); err == nil {
+		re = re.Simplify()
+
+		if re.Op == syntax.OpConcat && len(re.Sub) > 1 && re.Sub[0].Op == syntax.OpBeginText &&
+			re.Sub[1].Op == syntax.OpLiteral && re.Sub[1].Flags&syntax.FoldCase == 0 {
+
+			rt.prefix = string(re.Sub[1].Rune)
+		}
+	}
+
+	return nil
+}
+
+/*
+regex compiles a given pattern.
 */
-func (rt *likeRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
+func (rt *patternRuntime) regex(pattern string) (*regexp.Regexp, error) {
+	expr := pattern
+
+	if rt.glob && rt.rtp.withFlags.nocase {
+
+		// Glob patterns and values are compared in their case folded form
 
-	// Check for constant regexp
+		expr = globToRegex(foldString(pattern))
 
-	if valRT, ok := rt.astNode.Children[1].Runtime.(*valueRuntime); ok {
-		if !valRT.isNodeAttrValue && !valRT.isEdgeAttrValue {
+	} else if rt.glob {
+		expr = globToRegex(pattern)
+	}
+
+	if rt.caseInsensitive || rt.rtp.withFlags.nocase {
+		expr = "(?i)" + expr
+	}
+
+	regex, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, rt.rtp.newRuntimeError(ErrNotARegex,
+			fmt.Sprintf("%#v - %s", pattern, err.Error()), rt.astNode.Children[1])
+	}
 
-			// Given regex is a constant and only needs to be compiled once
+	return regex, nil
+}
+
+/*
+CondEval evaluates this condition runtime element.
+*/
+func (rt *patternRuntime) CondEval(node data.Node, edge data.Edge) (interface{}, error) {
+	regex := rt.compiledRegex
+
+	return rt.leftOp(node, edge, func(res1 interface{}) (interface{}, error) {
+
+		if isNull(res1) {
+			return invalid, nil
+		}
 
-			val, _ := valRT.CondEval(node, edge)
-			valStr := fmt.Sprint(val)
-			regexp, err := regexp.Compile(valStr)
+		if regex == nil {
+			res2, err := rt.astNode.Children[1].Runtime.(CondRuntime).CondEval(node, edge)
 			if err != nil {
-				return nil, rt.rtp.newRuntimeError(ErrNotARegex,
-					fmt.Sprintf("%#v - %s", valStr, err.Error()), rt.astNode.Children[1])
+				return nil, err
+			} else if isNull(res2) {
+				return invalid, nil
 			}
 
-			rt.compiledRegex = regexp
+			if regex, err = rt.regex(fmt.Sprint(res2)); err != nil {
+				return nil, err
+			}
+		}
+
+		if rt.glob && rt.rtp.withFlags.nocase {
+			return regex.MatchString(foldString(fmt.Sprint(res1))), nil
+		}
+
+		return regex.MatchString(fmt.Sprint(res1)), nil
+	})
+}
+
+/*
+globToRegex converts a glob pattern into an anchored regular expression. A *
+matches any sequence of characters and a ? matches a single character. Both
+can be escaped with a backslash.
+*/
+func globToRegex(pattern string) string {
+	var buf bytes.Buffer
+
+	buf.WriteString("^")
+
+	escaped := false
+
+	for _, r := range pattern {
+
+		if escaped {
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+
+		} else if r == '\\' {
+			escaped = true
+
+		} else if r == '*' {
+			buf.WriteString("(?s:.*)")
+
+		} else if r == '?' {
+			buf.WriteString("(?s:.)")
+
+		} else {
+			buf.WriteString(regexp.QuoteMeta(string(r)))
 		}
 	}
 
-	if rt.compiledRegex == nil {
-		return rt.regexOp(node, edge, func(res1 string, res2 *regexp.Regexp) interface{} { return res2.MatchString(res1) })
+	if escaped {
+		buf.WriteString(regexp.QuoteMeta("\\"))
+	}
+
+	buf.WriteString("$")
+
+	return buf.String()
+}
+
+/*
+patternCandidates determines the keys of all start nodes which can match the
+constant patterns of a where clause by using the full text index. A pattern
+which has a literal prefix is used if it is part of the top level conjunction
+of the where clause and operates on an indexed node attribute. The first
+complete word of the prefix must be in the index entry of every matching
+node. Returns false if no pattern could be used.
+*/
+func (p *eqlRuntimeProvider) patternCandidates(kind string) ([]string, bool, error) {
+
+	if p.where == nil {
+		return nil, false, nil
+	}
+
+	// Collect all conditions of the top level conjunction
+
+	var conds []*parser.ASTNode
+	var collect func(astNode *parser.ASTNode)
+
+	collect = func(astNode *parser.ASTNode) {
+		if astNode.Name == parser.NodeAND {
+			collect(astNode.Children[0])
+			collect(astNode.Children[1])
+		} else {
+			conds = append(conds, astNode)
+		}
+	}
+
+	collect(p.where.Children[0])
+
+	for _, cond := range conds {
+
+		pr, ok := cond.Runtime.(*patternRuntime)
+		if !ok || pr.compiledRegex == nil || pr.prefix == "" {
+			continue
+		}
+
+		valRT, ok := cond.Children[0].Runtime.(*valueRuntime)
+		if !ok || !valRT.isNodeAttrValue {
+			continue
+		}
+
+		attr := fmt.Sprint(valRT.condVal)
+
+		if attr == data.NodeKey || attr == data.NodeKind {
+			continue
+		}
+
+		analyzer := p.gm.IndexAnalyzer(kind, attr)
+
+		if pr.caseInsensitive && analyzer.Normalize(strings.ToUpper(pr.prefix)) !=
+			analyzer.Normalize(strings.ToLower(pr.prefix)) {
+			continue
+		}
+
+		// The index must find all case variants of the prefix
+
+		if p.withFlags.nocase && !foldIndexSafe(analyzer, pr.prefix) {
+			continue
+		}
+
+		// The prefix is tokenized with an arbitrary continuation - only tokens
+		// which are followed by another token are complete in every matching
+		// value
+
+		tokens := analyzer.Tokenize(pr.prefix + "0")
+		if len(tokens) < 2 {
+			continue
+		}
+
+		iq, err := p.gm.NodeIndexQuery(p.part, kind)
+		if err != nil || iq == nil {
+			return nil, false, err
+		}
+
+		p.stats.IndexLookups++
+
+		res, err := iq.LookupWord(attr, tokens[0].Word)
+		if errors.Is(err, util.ErrIndexStale) {
+			continue
+		} else if err != nil {
+			return nil, false, err
+		}
+
+		keys := make([]string, 0, len(res))
+		for key := range res {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		return keys, true, nil
 	}
 
-	return rt.stringOp(node, edge, func(res1 string, res2 string) interface{} { return rt.compiledRegex.MatchString(res1) })
+	return nil, false, nil
 }
 
 /*
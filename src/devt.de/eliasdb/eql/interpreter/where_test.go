@@ -191,14 +191,37 @@ Data: 1:n:key, 1:n:name, 1:n:ranking
 		t.Error(err)
 	}
 
-	if err := runSearch("get mynode where ranking <  x", "", rt); err.Error() !=
-		"EQL error in test: Value of operand is not a number (x) (Line:1 Pos:29)" {
+	// Numbers are smaller than values which are not numbers
+
+	if err := runSearch("get mynode where ranking <  x", `
+Labels: Mynode Key, Mynode Name, Ranking
+Format: auto, auto, auto
+Data: 1:n:key, 1:n:name, 1:n:ranking
+000, Node0, 1
+123, Node1, 2.1
+456, Node1, 3.5
+`[1:], rt); err != nil {
 		t.Error(err)
 		return
 	}
 
-	if err := runSearch("get mynode where name < ranking", "", rt); err.Error() !=
-		"EQL error in test: Value of operand is not a number (name=Node1) (Line:1 Pos:18)" {
+	if err := runSearch("get mynode where name < ranking", `
+Labels: Mynode Key, Mynode Name, Ranking
+Format: auto, auto, auto
+Data: 1:n:key, 1:n:name, 1:n:ranking
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Other values are compared by their string representation
+
+	if err := runSearch("get mynode where name <= Node0", `
+Labels: Mynode Key, Mynode Name, Ranking
+Format: auto, auto, auto
+Data: 1:n:key, 1:n:name, 1:n:ranking
+000, Node0, 1
+`[1:], rt); err != nil {
 		t.Error(err)
 		return
 	}
@@ -349,8 +372,23 @@ Data: 1:n:key, 1:n:name, 1:n:ranking
 		t.Error(err)
 	}
 
-	if err := runSearch("get mynode where [1,2] in ranking", "", rt); err.Error() !=
-		"EQL error in test: Value of operand is not a list (ranking=2.1) (Line:1 Pos:27)" {
+	// An attribute which is not a list is a list with a single item
+
+	if err := runSearch("get mynode where [1,2] in ranking", `
+Labels: Mynode Key, Mynode Name, Ranking
+Format: auto, auto, auto
+Data: 1:n:key, 1:n:name, 1:n:ranking
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := runSearch("get mynode where 2.1 in ranking", `
+Labels: Mynode Key, Mynode Name, Ranking
+Format: auto, auto, auto
+Data: 1:n:key, 1:n:name, 1:n:ranking
+123, Node1, 2.1
+`[1:], rt); err != nil {
 		t.Error(err)
 		return
 	}
@@ -430,7 +468,7 @@ Data: 1:n:key, 1:n:name, 1:n:ranking
 		t.Error(err)
 	}
 
-	// Test regex
+	// Test glob patterns
 
 	if err := runSearch("get mynode where name like 'Node?'", `
 Labels: Mynode Key, Mynode Name, Ranking
@@ -444,12 +482,64 @@ Data: 1:n:key, 1:n:name, 1:n:ranking
 		return
 	}
 
+	if err := runSearch("get mynode where name like 'node*' or name like 'Node'", `
+Labels: Mynode Key, Mynode Name, Ranking
+Format: auto, auto, auto
+Data: 1:n:key, 1:n:name, 1:n:ranking
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := runSearch("get mynode where name ilike 'n*1' and ranking > 3", `
+Labels: Mynode Key, Mynode Name, Ranking
+Format: auto, auto, auto
+Data: 1:n:key, 1:n:name, 1:n:ranking
+456, Node1, 3.5
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := runSearch("get mynode where name imatches '^node0$'", `
+Labels: Mynode Key, Mynode Name, Ranking
+Format: auto, auto, auto
+Data: 1:n:key, 1:n:name, 1:n:ranking
+000, Node0, 1
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+
 	if err := testSimpleOperationErrors("get mynode where 0 like 2", rt); err != nil {
 		t.Error(err)
 	}
 
-	if err := runSearch("get mynode where name like '[1'", "", rt); err.Error() !=
-		"EQL error in test: Value of operand is not a valid regex (\"[1\" - error parsing regexp: missing closing ]: `[1`) (Line:1 Pos:28)" {
+	if res := globToRegex(`a\*b?c*.\`); res != `^a\*b(?s:.)c(?s:.*)\.\\$` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Test regex
+
+	if err := runSearch("get mynode where name matches 'Node?'", `
+Labels: Mynode Key, Mynode Name, Ranking
+Format: auto, auto, auto
+Data: 1:n:key, 1:n:name, 1:n:ranking
+000, Node0, 1
+123, Node1, 2.1
+456, Node1, 3.5
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := testSimpleOperationErrors("get mynode where 0 matches 2", rt); err != nil {
+		t.Error(err)
+	}
+
+	if err := runSearch("get mynode where name matches '[1'", "", rt); err.Error() !=
+		"EQL error in test: Value of operand is not a valid regex (\"[1\" - error parsing regexp: missing closing ]: `[1`) (Line:1 Pos:31)" {
 		t.Error(err)
 		return
 	}
@@ -457,13 +547,13 @@ Data: 1:n:key, 1:n:name, 1:n:ranking
 	gm, _ = regexList()
 	rt = NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
 
-	if err := runSearch("get mynode where name like regex", "", rt); err.Error() !=
-		"EQL error in test: Value of operand is not a valid regex (\"[1\" - error parsing regexp: missing closing ]: `[1`) (Line:1 Pos:28)" {
+	if err := runSearch("get mynode where name matches regex", "", rt); err.Error() !=
+		"EQL error in test: Value of operand is not a valid regex (\"[1\" - error parsing regexp: missing closing ]: `[1`) (Line:1 Pos:31)" {
 		t.Error(err)
 		return
 	}
 
-	if err := runSearch("get mynode where name = node0 and name like regex", `
+	if err := runSearch("get mynode where name = node0 and name matches regex", `
 Labels: Mynode Key, Mynode Name, Ranking, Regex
 Format: auto, auto, auto, auto
 Data: 1:n:key, 1:n:name, 1:n:ranking, 1:n:regex
@@ -473,8 +563,828 @@ Data: 1:n:key, 1:n:name, 1:n:ranking, 1:n:regex
 		return
 	}
 
-	if err := testSimpleOperationErrors("get mynode where name like regex", rt); err != nil {
+	if err := testSimpleOperationErrors("get mynode where name matches regex", rt); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEdgeAttributes(t *testing.T) {
+	gm, _ := songGraph()
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+
+	// Attributes which only exist on the traversed edge kind are edge attributes
+
+	if _, err := getResult("get Author where name = Mike traverse :Wrote::Song where number > 2 end show name, 2:n:name, 2:e:number", `
+Labels: Author Name, Name, Number
+Format: auto, auto, auto
+Data: 1:n:name, 2:n:name, 2:e:number
+Mike, FightSong4, 4
+Mike, LoveSong3, 3
+`[1:], rt, true); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Attributes can be qualified with the kinds of the traversal spec
+
+	if _, err := getResult("get Author where name = Mike traverse :Wrote::Song where Wrote:key = Song:name and Wrote:number < 2 end show name, Song:name, Wrote:number", `
+Labels: Author Name, Song Name, Number
+Format: auto, auto, auto
+Data: 1:n:name, 2:n:name, 2:e:number
+Mike, StrangeSong1, 1
+`[1:], rt, true); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := getResult("get Author where name = Mike traverse :Wrote::Song where has Wrote:number and not has Song:number end show 2:e:key", `
+Labels: Wrote Key
+Format: auto
+Data: 2:e:key
+DeadSong2
+FightSong4
+LoveSong3
+StrangeSong1
+`[1:], rt, true); err != nil {
 		t.Error(err)
+		return
+	}
+
+	// Node attributes take precedence and unknown kinds are literals
+
+	if _, err := getResult("get Author traverse :Wrote::Song where name = Aria1 or Bla:name = 1 end show 2:n:name", `
+Labels: Name
+Format: auto
+Data: 2:n:name
+Aria1
+`[1:], rt, true); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Without an edge kind in the spec attributes are node attributes
+
+	if _, err := getResult("get Author traverse :::Song where number > 2 end show 2:n:name", `
+Labels: Name
+Format: auto
+Data: 2:n:name
+`[1:], rt, true); err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestAttributeComparisons(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := graph.NewGraphManager(mgs)
+
+	storeNode := func(key string, kind string, attrs map[string]interface{}) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", kind)
+		for k, v := range attrs {
+			node.SetAttr(k, v)
+		}
+		gm.StoreNode("main", node)
+	}
+
+	storeEdge := func(key string, kind string, end1 string, end1Kind string,
+		end2 string, end2Kind string, attrs map[string]interface{}) {
+
+		edge := data.NewGraphEdge()
+		edge.SetAttr("key", key)
+		edge.SetAttr("kind", kind)
+		edge.SetAttr(data.EdgeEnd1Key, end1)
+		edge.SetAttr(data.EdgeEnd1Kind, end1Kind)
+		edge.SetAttr(data.EdgeEnd1Role, "source")
+		edge.SetAttr(data.EdgeEnd1Cascading, false)
+		edge.SetAttr(data.EdgeEnd2Key, end2)
+		edge.SetAttr(data.EdgeEnd2Kind, end2Kind)
+		edge.SetAttr(data.EdgeEnd2Role, "target")
+		edge.SetAttr(data.EdgeEnd2Cascading, false)
+		for k, v := range attrs {
+			edge.SetAttr(k, v)
+		}
+		gm.StoreEdge("main", edge)
+	}
+
+	storeNode("c1", "Customer", map[string]interface{}{"credit_limit": 100})
+	storeNode("c2", "Customer", map[string]interface{}{"credit_limit": "50"})
+	storeNode("c3", "Customer", nil)
+
+	storeNode("o1", "Order", map[string]interface{}{"total": 150})
+	storeNode("o2", "Order", map[string]interface{}{"total": 80})
+	storeNode("o3", "Order", map[string]interface{}{"total": "60"})
+	storeNode("o4", "Order", map[string]interface{}{"total": 40})
+	storeNode("o5", "Order", map[string]interface{}{"total": 10})
+
+	storeEdge("e1", "Placed", "c1", "Customer", "o1", "Order", map[string]interface{}{"max_items": 2})
+	storeEdge("e2", "Placed", "c1", "Customer", "o2", "Order", map[string]interface{}{"max_items": 5})
+	storeEdge("e3", "Placed", "c2", "Customer", "o3", "Order", nil)
+	storeEdge("e4", "Placed", "c2", "Customer", "o4", "Order", map[string]interface{}{"max_items": 1})
+	storeEdge("e5", "Placed", "c3", "Customer", "o5", "Order", map[string]interface{}{"max_items": 1})
+
+	storeNode("p1", "Product", map[string]interface{}{"stock": 5, "reorder_level": 10})
+	storeNode("p2", "Product", map[string]interface{}{"stock": 20, "reorder_level": 10})
+	storeNode("p3", "Product", map[string]interface{}{"stock": "3", "reorder_level": 4})
+	storeNode("p4", "Product", map[string]interface{}{"stock": 1})
+
+	storeEdge("i1", "Contains", "o1", "Order", "p1", "Product", map[string]interface{}{"quantity": 3})
+	storeEdge("i2", "Contains", "o1", "Order", "p2", "Product", map[string]interface{}{"quantity": 1})
+	storeEdge("i3", "Contains", "o2", "Order", "p3", "Product", map[string]interface{}{"quantity": 6})
+	storeEdge("i4", "Contains", "o3", "Order", "p4", "Product", map[string]interface{}{"quantity": 2})
+	storeEdge("i5", "Contains", "o4", "Order", "p2", "Product", map[string]interface{}{"quantity": 2})
+
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+	rt.SortedStartKeys = true
+
+	rows := func(query string) string {
+		ast, err := parser.ParseWithRuntime("test", query, rt)
+		if err != nil {
+			return err.Error()
+		}
+
+		res, err := ast.Runtime.Eval()
+		if err != nil {
+			return err.Error()
+		}
+
+		return fmt.Sprint(res.(*SearchResult).Rows())
+	}
+
+	for _, workers := range []int{0, 4} {
+		rt.Workers = workers
+
+		// Attributes of the same node (missing attributes make the
+		// comparison false and values are coerced)
+
+		if res := rows("get Product where stock < reorder_level show key"); res != "[[p1] [p3]]" {
+			t.Error("Unexpected result:", res)
+			return
+		}
+
+		if res := rows("get Product where attr:reorder_level <= attr:stock show key"); res != "[[p2]]" {
+			t.Error("Unexpected result:", res)
+			return
+		}
+
+		// Attributes of an enclosing step
+
+		if res := rows("get Customer traverse :Placed::Order where Order:total > Customer:credit_limit end show key, Order:key"); res != "[[c1 o1] [c2 o3]]" {
+			t.Error("Unexpected result:", res)
+			return
+		}
+
+		if res := rows("get Customer traverse :Placed::Order traverse :Contains::Product where quantity > Placed:max_items or Customer:credit_limit = stock * 10 end end show key, Order:key, Product:key"); res != "[[c1 o1 p1] [c1 o2 p3] [c2 o4 p2]]" {
+			t.Error("Unexpected result:", res)
+			return
+		}
+
+		if res := rows("get Customer traverse :Placed::Order traverse :Contains::Product where has Order:total and not has Customer:credit_limit end end show key"); res != "[]" {
+			t.Error("Unexpected result:", res)
+			return
+		}
+
+		// Literals and attributes can be mixed on both sides
+
+		if res := rows("get Customer traverse :Placed::Order where total > Customer:credit_limit / 2 and 100 > total end show Order:key"); res != "[[o2] [o3] [o4]]" {
+			t.Error("Unexpected result:", res)
+			return
+		}
+
+		if res := rows("get Customer traverse :Placed::Order where Customer:credit_limit - total >= 10 end show Order:key"); res != "[[o2] [o4]]" {
+			t.Error("Unexpected result:", res)
+			return
+		}
+
+		// Names of steps which are not enclosing steps are literals
+
+		if res := rows("get Customer traverse :Placed::Order where Product:stock = 'Product:stock' end show Order:key"); res != "[[o1] [o2] [o3] [o4] [o5]]" {
+			t.Error("Unexpected result:", res)
+			return
+		}
+	}
+}
+
+func TestPatternCandidates(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := graph.NewGraphManager(mgs)
+
+	for key, number := range map[string]string{"1": "INV-000123", "2": "INV-000124",
+		"3": "inv-999999", "4": "CRD-000001", "5": "INV-12"} {
+
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "Invoice")
+		node.SetAttr("number", number)
+		gm.StoreNode("main", node)
+	}
+
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+
+	candidates := func(query string) string {
+		ast, err := parser.ParseWithRuntime("test", query, rt)
+		if err != nil {
+			return err.Error()
+		} else if err := ast.Runtime.Validate(); err != nil {
+			return err.Error()
+		}
+
+		keys, ok, err := rt.patternCandidates("Invoice")
+		return fmt.Sprint(keys, ok, err)
+	}
+
+	// Anchored patterns with a complete word in their literal prefix can use the index
+
+	if res := candidates("get Invoice where number matches '^INV-[0-9]{6}$'"); res != "[1 2 3 5] true <nil>" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := candidates("get Invoice where true and (number ilike 'inv-*' and key != 5)"); res != "[1 2 3 5] true <nil>" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	for _, query := range []string{
+		"get Invoice where number matches 'INV-'",
+		"get Invoice where number matches '(?i)^INV-'",
+		"get Invoice where number like 'INV*'",
+		"get Invoice where number like 'INV-*' or true",
+		"get Invoice where key like '1-*'",
+		"get Invoice where number like number",
+		"get Invoice",
+	} {
+		if res := candidates(query); res != "[] false <nil>" {
+			t.Error("Unexpected result:", query, res)
+			return
+		}
+	}
+
+	if res := candidates("get Invoice where number matches '^INV-[0-9'"); res !=
+		"EQL error in test: Value of operand is not a valid regex (\"^INV-[0-9\" - error parsing regexp: missing closing ]: `[0-9`) (Line:1 Pos:34)" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// The query result is the same as without the index
+
+	rt.SortedStartKeys = true
+
+	if err := runSearch("get Invoice where number matches '^INV-[0-9]{6}$'", `
+Labels: Invoice Key, Number
+Format: auto, auto
+Data: 1:n:key, 1:n:number
+1, INV-000123
+2, INV-000124
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := runSearch("get Invoice where number ilike 'inv-??????'", `
+Labels: Invoice Key, Number
+Format: auto, auto
+Data: 1:n:key, 1:n:number
+1, INV-000123
+2, INV-000124
+3, inv-999999
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestNoCase(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := graph.NewGraphManager(mgs)
+
+	for key, name := range map[string]string{"1": "Straße", "2": "STRASSE", "3": "strasse",
+		"4": "ΣΟΦΟΣ", "5": "σοφος", "6": "ISTANBUL", "7": "ıstanbul", "8": "10",
+		"9": "Ölweg 1", "A": "ÖLWEG 2"} {
+
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "Street")
+		node.SetAttr("name", name)
+		gm.StoreNode("main", node)
+	}
+
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+	rt.SortedStartKeys = true
+
+	keysWith := func(query string, rtp parser.RuntimeProvider) string {
+		ast, err := parser.ParseWithRuntime("test", query, rtp)
+		if err != nil {
+			return err.Error()
+		}
+
+		res, err := ast.Runtime.Eval()
+		if err != nil {
+			return err.Error()
+		}
+
+		var ret []string
+		for _, row := range res.(*SearchResult).Rows() {
+			ret = append(ret, fmt.Sprint(row[0]))
+		}
+
+		return fmt.Sprint(ret)
+	}
+
+	keys := func(query string) string {
+		return keysWith(query, rt)
+	}
+
+	for query, expected := range map[string]string{
+
+		// Without nocase all comparisons are case-sensitive
+
+		"get Street where name = strasse":           "[3]",
+		"get Street where name in [strasse, σοφος]": "[3 5]",
+		"get Street where name like 'STRA*'":        "[2]",
+
+		// Unicode case folding handles full foldings and final sigma
+
+		"get Street where name = strasse with nocase":              "[1 2 3]",
+		"get Street where name != STRASSE with nocase":             "[4 5 6 7 8 9 A]",
+		"get Street where name = 'σοφοσ' with nocase":              "[4 5]",
+		"get Street where name in [STRASSE, σοφος] with nocase":    "[1 2 3 4 5]",
+		"get Street where name notin [strasse, ΣΟΦΟΣ] with nocase": "[6 7 8 9 A]",
+		"get Street where name like 'stra*' with nocase":           "[1 2 3]",
+		"get Street where name like 'STRA?E' with nocase":          "[]",
+		"get Street where name like 'STRA??E' with nocase":         "[1 2 3]",
+		"get Street where name matches '^stra' with nocase":        "[1 2 3]",
+		"get Street where name beginswith STR with nocase":         "[1 2 3]",
+		"get Street where name endswith SS with nocase":            "[]",
+		"get Street where name endswith SSE with nocase":           "[1 2 3]",
+		"get Street where name contains ΦΟ with nocase":            "[4 5]",
+		"get Street where name containsnot ΦΟ with nocase":         "[1 2 3 6 7 8 9 A]",
+
+		// Numbers are still compared by their value
+
+		"get Street where name = 10.0 with nocase":        "[8]",
+		"get Street where name in [10.0, 11] with nocase": "[8]",
+
+		// Locale specific foldings are not supported - the Turkish dotless i
+		// is not equal to i
+
+		"get Street where name = istanbul with nocase": "[6]",
+	} {
+		if res := keys(query); res != expected {
+			t.Error("Unexpected result:", query, res, "expected:", expected)
+		}
+	}
+
+	// The index is only used if it finds all case variants of a word - this
+	// is not the case for words with characters like s (long s ſ) or ß
+
+	candidates := func(query string) string {
+		ast, err := parser.ParseWithRuntime("test", query, rt)
+		if err != nil {
+			return err.Error()
+		} else if err := ast.Runtime.Validate(); err != nil {
+			return err.Error()
+		}
+
+		keys, ok, err := rt.patternCandidates("Street")
+		return fmt.Sprint(keys, ok, err)
+	}
+
+	if res := candidates("get Street where name like 'istanbul' with nocase"); res != "[] false <nil>" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := candidates("get Street where name like 'strasse' with nocase"); res != "[] false <nil>" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := candidates("get Street where name like 'ölweg *' with nocase"); res != "[9 A] true <nil>" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := keys("get Street where name like 'ölweg *' with nocase"); res != "[9 A]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// The flag works with all statements
+
+	lrt := NewLookupRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+
+	if res := keysWith("lookup Street '1', '4' where name = STRASSE with nocase", lrt); res != "[1]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	ast, err := parser.ParseWithRuntime("test", "delete from Street where name = STRASSE with nocase, dryrun", rt)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res, err := ast.Runtime.Eval(); err != nil || fmt.Sprint(res.(*SearchResult).Rows()) != "[[3]]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+}
+
+func TestNullSemantics(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := graph.NewGraphManager(mgs)
+
+	storeContact := func(key string, email interface{}, score interface{}) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "Contact")
+		node.SetAttr("email", email)
+		node.SetAttr("score", score)
+		gm.StoreNode("main", node)
+	}
+
+	storeContact("c1", "a@x", 5)
+	storeContact("c2", "", 0)
+	storeContact("c3", nil, nil)
+	storeContact("c4", "b@x", 10)
+
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+	rt.SortedStartKeys = true
+
+	keys := func(query string) string {
+		ast, err := parser.ParseWithRuntime("test", query, rt)
+		if err != nil {
+			return err.Error()
+		}
+
+		res, err := ast.Runtime.Eval()
+		if err != nil {
+			return err.Error()
+		}
+
+		var ret []string
+		for _, row := range res.(*SearchResult).Rows() {
+			ret = append(ret, fmt.Sprint(row[0]))
+		}
+
+		return fmt.Sprint(ret)
+	}
+
+	for query, expected := range map[string]string{
+
+		// Has checks if an attribute is set - an empty string is set
+
+		"get Contact where has email":                    "[c1 c2 c4]",
+		"get Contact where not has email":                "[c3]",
+		"get Contact where has attr:email and score > 1": "[c1 c4]",
+		"get Contact where has phone":                    "[]",
+		"get Contact where not has phone":                "[c1 c2 c3 c4]",
+
+		// Comparisons with a missing attribute are always false
+
+		"get Contact where email = 'a@x'":          "[c1]",
+		"get Contact where email != 'a@x'":         "[c2 c4]",
+		"get Contact where email = ''":             "[c2]",
+		"get Contact where email = null":           "[]",
+		"get Contact where email != null":          "[]",
+		"get Contact where score < 6":              "[c1 c2]",
+		"get Contact where score >= 0":             "[c1 c2 c4]",
+		"get Contact where email in ['a@x', '']":   "[c1 c2]",
+		"get Contact where email notin ['a@x']":    "[c2 c4]",
+		"get Contact where email in [email, null]": "[c1 c2 c4]",
+		"get Contact where email like '*'":         "[c1 c2 c4]",
+		"get Contact where email notin [null]":     "[c1 c2 c4]",
+		"get Contact where email like email":       "[c1 c2 c4]",
+		"get Contact where email contains ''":      "[c1 c2 c4]",
+		"get Contact where email containsnot 'a'":  "[c2 c4]",
+		"get Contact where score * 2 = null":       "[]",
+
+		// A negated comparison matches missing attributes
+
+		"get Contact where not email = 'a@x'": "[c2 c3 c4]",
+	} {
+		if res := keys(query); res != expected {
+			t.Error("Unexpected result:", query, res, "expected:", expected)
+		}
+	}
+
+	if res := keys("get Contact where has 'val:email'"); res !=
+		"EQL error in test: Invalid where clause (Operand of has must be an attribute name) (Line:1 Pos:23)" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := keys("get Contact where has (score + 1)"); res !=
+		"EQL error in test: Invalid where clause (Operand of has must be an attribute name) (Line:1 Pos:30)" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Missing values are ordered last unless nullsfirst is given
+
+	for query, expected := range map[string]string{
+		"get Contact with ordering(ascending score)":                         "[c2 c1 c4 c3]",
+		"get Contact with ordering(descending score)":                        "[c4 c1 c2 c3]",
+		"get Contact with ordering(descending score), nullslast":             "[c4 c1 c2 c3]",
+		"get Contact with ordering(ascending score), nullsfirst":             "[c3 c2 c1 c4]",
+		"get Contact with nullsfirst, ordering(descending score)":            "[c3 c4 c1 c2]",
+		"get Contact with ordering(descending score), nullsfirst, nullslast": "[c4 c1 c2 c3]",
+	} {
+		if res := keys(query); res != expected {
+			t.Error("Unexpected result:", query, res, "expected:", expected)
+		}
+	}
+}
+
+func TestListPredicates(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := graph.NewGraphManager(mgs)
+
+	storeTask := func(key string, tags interface{}, scores interface{}) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "Task")
+		node.SetAttr("tags", tags)
+		node.SetAttr("scores", scores)
+		gm.StoreNode("main", node)
+	}
+
+	storeTask("t1", []string{"urgent", "home"}, []float64{4, 5})
+	storeTask("t2", []string{"work"}, []int{2, 8})
+	storeTask("t3", []string{}, []interface{}{})
+	storeTask("t4", "urgent", "7")
+	storeTask("t5", nil, nil)
+
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+	rt.SortedStartKeys = true
+
+	keys := func(query string) string {
+		ast, err := parser.ParseWithRuntime("test", query, rt)
+		if err != nil {
+			return err.Error()
+		}
+
+		res, err := ast.Runtime.Eval()
+		if err != nil {
+			return err.Error()
+		}
+
+		var ret []string
+		for _, row := range res.(*SearchResult).Rows() {
+			ret = append(ret, fmt.Sprint(row[0]))
+		}
+
+		return fmt.Sprint(ret)
+	}
+
+	for query, expected := range map[string]string{
+
+		// Slices of strings - scalars are lists with a single item
+
+		"get Task where any(tags) = 'urgent'":          "[t1 t4]",
+		"get Task where any(tags) != 'urgent'":         "[t1 t2]",
+		"get Task where all(tags) != 'urgent'":         "[t2 t3]",
+		"get Task where any(tags) beginswith 'wo'":     "[t2]",
+		"get Task where any(tags) like 'h*'":           "[t1]",
+		"get Task where any(tags) in ['work', 'home']": "[t1 t2]",
+		"get Task where any(tags) in ('work', 'home')": "[t1 t2]",
+		"get Task where 'urgent' in tags":              "[t1 t4]",
+		"get Task where 'urgent' notin tags":           "[t2 t3]",
+
+		// Slices of numbers use the standard coercion rules
+
+		"get Task where all(scores) > 3":                       "[t1 t3 t4]",
+		"get Task where any(scores) > 6":                       "[t2 t4]",
+		"get Task where any(scores) = '8'":                     "[t2]",
+		"get Task where any(scores) = 5 with strict":           "[t1]",
+		"get Task where 4 in scores":                           "[t1]",
+		"get Task where any(scores) >= 2 and any(tags) = work": "[t2]",
+
+		// Empty lists are false for any and true for all - missing
+		// values are always false
+
+		"get Task where any(tags) = ''":     "[]",
+		"get Task where all(tags) = 'work'": "[t2 t3]",
+		"get Task where all(scores) < 0":    "[t3]",
+
+		// Quantified comparisons can be negated
+
+		"get Task where not any(tags) = 'urgent'":                 "[t2 t3 t5]",
+		"get Task where not all(scores) > 3":                      "[t2 t5]",
+		"get Task where not (any(tags) = home or 'work' in tags)": "[t3 t4 t5]",
+	} {
+		if res := keys(query); res != expected {
+			t.Error("Unexpected result:", query, res, "expected:", expected)
+		}
+	}
+
+	// Quantifiers must be the left operand of a comparison
+
+	if res := keys("get Task where any(tags)"); res !=
+		"EQL error in test: Invalid where clause (Operand of any must be the left operand of a comparison) (Line:1 Pos:16)" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := keys("get Task where 'urgent' = all(tags)"); res !=
+		"EQL error in test: Invalid where clause (Operand of all must be the left operand of a comparison) (Line:1 Pos:27)" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := keys("get Task where any(tags) + 1 > 2"); res !=
+		"EQL error in test: Invalid where clause (Operand of any must be the left operand of a comparison) (Line:1 Pos:16)" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestInListsAndSubqueries(t *testing.T) {
+	gm, _ := songGraph()
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+
+	// Set members are compared with the same rules as equality
+
+	if err := runSearch("get Song where ranking in ('8', 2.0, Aria3) show key, ranking", `
+Labels: Song Key, Ranking
+Format: auto, auto
+Data: 1:n:key, 1:n:ranking
+Aria1, 8
+Aria2, 2
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := runSearch("get Author where key notin ('000', 123) show name", `
+Labels: Author Name
+Format: auto
+Data: 1:n:name
+Hans
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Lists which contain attributes are evaluated for each row
+
+	if err := runSearch("get Song where 1 in (name, ranking) show key", `
+Labels: Song Key
+Format: auto
+Data: 1:n:key
+LoveSong3
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Subqueries are run once before the outer query
+
+	if err := runSearch("get Song where key in (lookup Author '000' traverse :::Song end show 2:n:key) and ranking > 3 show key", `
+Labels: Song Key
+Format: auto
+Data: 1:n:key
+Aria1
+Aria3
+Aria4
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := runSearch("get Author where name notin (get Author where key in (000, 456) show name) show name", `
+Labels: Author Name
+Format: auto
+Data: 1:n:name
+Mike
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := runSearch("get Author where name in (get Song where ranking > 100 show name)", `
+Labels: Author Key, Author Name
+Format: auto, auto
+Data: 1:n:key, 1:n:name
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Test error cases
+
+	if err := runSearch("get Author where name in (get Author)", "", rt); err == nil ||
+		err.Error() != "EQL error in test: Invalid construct (Subquery must show exactly one column (has 2)) (Line:1 Pos:27)" {
+		t.Error(err)
+		return
+	}
+
+	if err := runSearch("get Author where name in (get Foo show name)", "", rt); err == nil ||
+		err.Error() != "EQL error in test: Unknown node kind (Foo) (Line:1 Pos:31)" {
+		t.Error(err)
+		return
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := graph.NewGraphManager(mgs)
+	rt := NewGetRuntimeProvider("test", "main", gm, NewDefaultNodeInfo(gm))
+
+	storeOrder := func(key string, price, quantity, score, attempts interface{}) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "Order")
+		for attr, val := range map[string]interface{}{"price": price,
+			"quantity": quantity, "score": score, "attempts": attempts} {
+			if val != nil {
+				node.SetAttr(attr, val)
+			}
+		}
+		gm.StoreNode("main", node)
+	}
+
+	storeOrder("o1", 2.5, 4, 9, 10)
+	storeOrder("o2", "3", "2", 5, 10)
+	storeOrder("o3", 10, nil, 4, 0)
+	storeOrder("o4", 1, 3, 8, 12)
+
+	// Arithmetic can be used in the show clause - missing attributes and
+	// division by zero produce null
+
+	if err := runSearch("get Order show key, price * quantity as total, score / attempts, -(price + 1) * 2 format x", `
+Labels: Order Key, total, score / attempts, -(price + 1) * 2
+Format: auto, auto, auto, x
+Data: 1:n:key, 1:func:expr(), 1:func:expr(), 1:func:expr()
+o1, 10, 0.9, -7
+o2, 6, 0.5, -8
+o3, <not set>, <not set>, -22
+o4, 3, 0.6666666666666666, -4
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Operator precedence is standard
+
+	if err := runSearch("get Order where key = o1 show 1 + 2 * 3, (1 + 2) * 3, 10 - 4 - 3, 10 - (4 - 3), 7 // 2, 7 % 2, @length(key) * 2", `
+Labels: 1 + 2 * 3, (1 + 2) * 3, 10 - 4 - 3, 10 - (4 - 3), 7 // 2, 7 % 2, @length(key) * 2
+Format: auto, auto, auto, auto, auto, auto, auto
+Data: 1:func:expr(), 1:func:expr(), 1:func:expr(), 1:func:expr(), 1:func:expr(), 1:func:expr(), 1:func:expr()
+7, 9, 3, 9, 3, 1, 4
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Arithmetic in conditions - rows with null results are not matched
+
+	if err := runSearch("get Order where score / attempts > 0.8 or price * quantity = 6 show key", `
+Labels: Order Key
+Format: auto
+Data: 1:n:key
+o1
+o2
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := runSearch("get Order where -score + 10 >= 2 and attempts % 0 = null or quantity // 0 = 1 show key", `
+Labels: Order Key
+Format: auto
+Data: 1:n:key
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := runSearch("get Order where -score + 10 >= 2 show key", `
+Labels: Order Key
+Format: auto
+Data: 1:n:key
+o2
+o3
+o4
+`[1:], rt); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Values which are not numbers are errors
+
+	if err := runSearch("get Order show price * key", "", rt); err == nil || err.Error() !=
+		"EQL error in test: Value of operand is not a number (key=o1) (Line:1 Pos:24)" {
+		t.Error(err)
+		return
+	}
+
+	if err := runSearch("get Order where price * key > 1", "", rt); err == nil || err.Error() !=
+		"EQL error in test: Value of operand is not a number (key=o1) (Line:1 Pos:25)" {
+		t.Error(err)
+		return
 	}
 }
 
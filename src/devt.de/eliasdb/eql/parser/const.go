@@ -107,6 +107,23 @@ const (
 	TokenISNOTNULL
 	TokenASCENDING
 	TokenDESCENDING
+	TokenLIMIT
+	TokenOFFSET
+	TokenILIKE
+	TokenMATCHES
+	TokenIMATCHES
+	TokenDISTINCT
+	TokenDELETE
+	TokenUPDATE
+	TokenSET
+	TokenDRYRUN
+	TokenNOCASE
+	TokenNULLSFIRST
+	TokenNULLSLAST
+	TokenHAS
+	TokenSTRICT
+	TokenANY
+	TokenALL
 )
 
 /*
@@ -123,6 +140,12 @@ const (
 	NodeORDERING      = "ordering"
 	NodeFILTERING     = "filtering"
 	NodeNULLTRAVERSAL = "nulltraversal"
+	NodeDISTINCT      = "distinct"
+	NodeDRYRUN        = "dryrun"
+	NodeNOCASE        = "nocase"
+	NodeNULLSFIRST    = "nullsfirst"
+	NodeNULLSLAST     = "nullslast"
+	NodeSTRICT        = "strict"
 
 	// Special tokens - always handled in a denotation function
 
@@ -138,6 +161,9 @@ const (
 	NodeLOOKUP = "lookup"
 	NodeFROM   = "from"
 	NodeWHERE  = "where"
+	NodeDELETE = "delete"
+	NodeUPDATE = "update"
+	NodeSET    = "set"
 
 	NodeUNIQUE      = "unique"
 	NodeUNIQUECOUNT = "uniquecount"
@@ -151,12 +177,15 @@ const (
 	NodeSHOWTERM = "showterm"
 	NodeWITH     = "with"
 	NodeLIST     = "list"
+	NodeLIMIT    = "limit"
+	NodeOFFSET   = "offset"
 
 	// Boolean operations
 
 	NodeOR  = "or"
 	NodeAND = "and"
 	NodeNOT = "not"
+	NodeHAS = "has"
 
 	NodeGEQ = ">="
 	NodeLEQ = "<="
@@ -169,10 +198,15 @@ const (
 
 	NodeIN    = "in"
 	NodeNOTIN = "notin"
+	NodeANY   = "any"
+	NodeALL   = "all"
 
 	// String operations
 
 	NodeLIKE        = "like"
+	NodeILIKE       = "ilike"
+	NodeMATCHES     = "matches"
+	NodeIMATCHES    = "imatches"
 	NodeCONTAINS    = "contains"
 	NodeBEGINSWITH  = "beginswith"
 	NodeENDSWITH    = "endswith"
@@ -29,6 +29,8 @@ type LexToken struct {
 	Val   string     // Token value
 	Lline int        // Line in the input this token appears
 	Lpos  int        // Position in the input line this token appears
+
+	Quoted bool // Flag if the value was given in quotes
 }
 
 /*
@@ -79,6 +81,7 @@ var keywordMap = map[string]LexTokenID{
 	"filtering":     TokenFILTERING,
 	"ordering":      TokenORDERING,
 	"nulltraversal": TokenNULLTRAVERSAL,
+	"distinct":      TokenDISTINCT,
 	"where":         TokenWHERE,
 	"traverse":      TokenTRAVERSE,
 	"end":           TokenEND,
@@ -89,6 +92,9 @@ var keywordMap = map[string]LexTokenID{
 	"and":           TokenAND,
 	"or":            TokenOR,
 	"like":          TokenLIKE,
+	"ilike":         TokenILIKE,
+	"matches":       TokenMATCHES,
+	"imatches":      TokenIMATCHES,
 	"in":            TokenIN,
 	"contains":      TokenCONTAINS,
 	"beginswith":    TokenBEGINSWITH,
@@ -104,6 +110,19 @@ var keywordMap = map[string]LexTokenID{
 	"isnotnull":     TokenISNOTNULL,
 	"ascending":     TokenASCENDING,
 	"descending":    TokenDESCENDING,
+	"limit":         TokenLIMIT,
+	"offset":        TokenOFFSET,
+	"delete":        TokenDELETE,
+	"update":        TokenUPDATE,
+	"set":           TokenSET,
+	"dryrun":        TokenDRYRUN,
+	"nocase":        TokenNOCASE,
+	"nullsfirst":    TokenNULLSFIRST,
+	"nullslast":     TokenNULLSLAST,
+	"has":           TokenHAS,
+	"strict":        TokenSTRICT,
+	"any":           TokenANY,
+	"all":           TokenALL,
 }
 
 /*
@@ -130,6 +149,36 @@ var symbolMap = map[string]LexTokenID{
 	"%":  TokenMODINT,
 }
 
+/*
+Names of tokens which are not keywords or symbols - names of keywords and
+symbols are added on initialisation
+*/
+var tokenNames = map[LexTokenID]string{
+	TokenEOF:      "end of query",
+	TokenVALUE:    "value",
+	TokenNODEKIND: "node kind",
+}
+
+func init() {
+	for name, id := range keywordMap {
+		tokenNames[id] = name
+	}
+	for name, id := range symbolMap {
+		tokenNames[id] = name
+	}
+}
+
+/*
+TokenName returns the name of a token as it is used in error messages (e.g.
+where, = or value).
+*/
+func TokenName(id LexTokenID) string {
+	if name, ok := tokenNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("id:%v", id)
+}
+
 // Lexer
 // =====
 
@@ -263,13 +312,17 @@ emitToken passes a token back to the client.
 */
 func (l *lexer) emitToken(t LexTokenID) {
 	if t == TokenEOF {
+
+		// The end of the input is located after the last character
+
+		l.start = len(l.input)
 		l.emitTokenAndValue(t, "")
 		return
 	}
 
 	if l.tokens != nil {
 		l.tokens <- LexToken{t, l.start, l.input[l.start:l.pos],
-			l.line + 1, l.start - l.lastnl + 1}
+			l.line + 1, l.start - l.lastnl + 1, false}
 	}
 }
 
@@ -278,7 +331,16 @@ emitTokenAndValue passes a token with a given value back to the client.
 */
 func (l *lexer) emitTokenAndValue(t LexTokenID, val string) {
 	if l.tokens != nil {
-		l.tokens <- LexToken{t, l.start, val, l.line + 1, l.start - l.lastnl + 1}
+		l.tokens <- LexToken{t, l.start, val, l.line + 1, l.start - l.lastnl + 1, false}
+	}
+}
+
+/*
+emitQuotedValue passes a value token which was given in quotes back to the client.
+*/
+func (l *lexer) emitQuotedValue(val string) {
+	if l.tokens != nil {
+		l.tokens <- LexToken{TokenVALUE, l.start, val, l.line + 1, l.start - l.lastnl + 1, true}
 	}
 }
 
@@ -287,7 +349,7 @@ emitError passes an error token back to the client.
 */
 func (l *lexer) emitError(msg string) {
 	if l.tokens != nil {
-		l.tokens <- LexToken{TokenError, l.start, msg, l.line + 1, l.start - l.lastnl + 1}
+		l.tokens <- LexToken{TokenError, l.start, msg, l.line + 1, l.start - l.lastnl + 1, false}
 	}
 }
 
@@ -341,6 +403,18 @@ func lexToken(l *lexer) lexFunc {
 		case TokenLOOKUP:
 			l.scope = token
 			return lexNodeKind
+		case TokenUPDATE:
+			l.scope = token
+			return lexNodeKind
+		case TokenDELETE:
+			l.scope = token
+		case TokenFROM:
+
+			// The node kind of a delete statement follows the from keyword
+
+			if l.scope == TokenDELETE {
+				return lexNodeKind
+			}
 		}
 
 	} else {
@@ -378,6 +452,12 @@ func lexNodeKind(l *lexer) lexFunc {
 	l.startNew()
 	lexTextBlock(l, false)
 
+	// A node kind can be directly followed by the closing bracket of a subquery
+
+	for l.pos > l.start && l.input[l.pos-1] == ')' {
+		l.pos--
+	}
+
 	nodeKindCandidate := strings.ToLower(l.input[l.start:l.pos])
 	if !stringutil.IsAlphaNumeric(nodeKindCandidate) {
 		l.emitError("Invalid node kind " + fmt.Sprintf("'%v'", nodeKindCandidate) +
@@ -387,13 +467,13 @@ func lexNodeKind(l *lexer) lexFunc {
 
 	l.emitToken(TokenNODEKIND)
 
-	if l.scope == TokenGET {
-		return lexToken
-	}
-
 	// In a lookup scope more values are following
 
-	return lexValue
+	if l.scope == TokenLOOKUP {
+		return lexValue
+	}
+
+	return lexToken
 }
 
 /*
@@ -457,10 +537,10 @@ func lexValue(l *lexer) lexFunc {
 			return nil
 		}
 
-		l.emitTokenAndValue(TokenVALUE, s)
+		l.emitQuotedValue(s)
 
 	} else {
-		l.emitTokenAndValue(TokenVALUE, l.input[l.start+2:l.pos-1])
+		l.emitQuotedValue(l.input[l.start+2 : l.pos-1])
 
 	}
 
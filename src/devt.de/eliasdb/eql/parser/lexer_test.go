@@ -170,6 +170,14 @@ func TestValueParsing(t *testing.T) {
 		return
 	}
 
+	// Quoted values are marked
+
+	if res := LexToList("mytest", `5 "5" r'5'`); len(res) != 4 || res[0].Quoted ||
+		!res[1].Quoted || !res[2].Quoted || res[3].Quoted {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
 	// Test normal quoted case
 
 	input := `WHERE "name"`
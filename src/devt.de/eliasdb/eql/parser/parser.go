@@ -13,6 +13,8 @@ package parser
 import (
 	"bytes"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"devt.de/common/stringutil"
 )
@@ -45,6 +47,25 @@ func (n *ASTNode) instance(p *parser, t *LexToken) *ASTNode {
 	return ret
 }
 
+/*
+CopyWithRuntime returns a copy of this AST which is decorated with new runtime
+components from a given runtime provider. The lexer tokens are shared with the
+original AST. An AST which was parsed without runtime components can be copied
+concurrently - this avoids parsing the same input several times.
+*/
+func (n *ASTNode) CopyWithRuntime(rp RuntimeProvider) *ASTNode {
+	ret := &ASTNode{n.Name, n.Token, make([]*ASTNode, 0, len(n.Children)), nil, n.binding, n.nullDenotation, n.leftDenotation}
+	if rp != nil {
+		ret.Runtime = rp.Runtime(ret)
+	}
+
+	for _, child := range n.Children {
+		ret.Children = append(ret.Children, child.CopyWithRuntime(rp))
+	}
+
+	return ret
+}
+
 /*
 String returns a string representation of this token.
 */
@@ -101,6 +122,12 @@ func init() {
 		TokenORDERING:      &ASTNode{NodeORDERING, nil, nil, nil, 0, ndWithFunc, nil},
 		TokenFILTERING:     &ASTNode{NodeFILTERING, nil, nil, nil, 0, ndWithFunc, nil},
 		TokenNULLTRAVERSAL: &ASTNode{NodeNULLTRAVERSAL, nil, nil, nil, 0, ndWithFunc, nil},
+		TokenDISTINCT:      &ASTNode{NodeDISTINCT, nil, nil, nil, 0, ndTerm, nil},
+		TokenDRYRUN:        &ASTNode{NodeDRYRUN, nil, nil, nil, 0, ndTerm, nil},
+		TokenNOCASE:        &ASTNode{NodeNOCASE, nil, nil, nil, 0, ndTerm, nil},
+		TokenNULLSFIRST:    &ASTNode{NodeNULLSFIRST, nil, nil, nil, 0, ndTerm, nil},
+		TokenNULLSLAST:     &ASTNode{NodeNULLSLAST, nil, nil, nil, 0, ndTerm, nil},
+		TokenSTRICT:        &ASTNode{NodeSTRICT, nil, nil, nil, 0, ndTerm, nil},
 
 		// Special tokens - always handled in a denotation function
 
@@ -109,6 +136,7 @@ func init() {
 		TokenEND:    &ASTNode{NodeEND, nil, nil, nil, 0, nil, nil},
 		TokenAS:     &ASTNode{NodeAS, nil, nil, nil, 0, nil, nil},
 		TokenFORMAT: &ASTNode{NodeFORMAT, nil, nil, nil, 0, nil, nil},
+		TokenSET:    &ASTNode{NodeSET, nil, nil, nil, 0, nil, nil},
 
 		// Keywords
 
@@ -116,12 +144,14 @@ func init() {
 		TokenLOOKUP: &ASTNode{NodeLOOKUP, nil, nil, nil, 0, ndLookup, nil},
 		TokenFROM:   &ASTNode{NodeFROM, nil, nil, nil, 0, ndFrom, nil},
 		TokenWHERE:  &ASTNode{NodeWHERE, nil, nil, nil, 0, ndPrefix, nil},
+		TokenDELETE: &ASTNode{NodeDELETE, nil, nil, nil, 0, ndDelete, nil},
+		TokenUPDATE: &ASTNode{NodeUPDATE, nil, nil, nil, 0, ndUpdate, nil},
 
 		TokenUNIQUE:      &ASTNode{NodeUNIQUE, nil, nil, nil, 0, ndPrefix, nil},
 		TokenUNIQUECOUNT: &ASTNode{NodeUNIQUECOUNT, nil, nil, nil, 0, ndPrefix, nil},
 		TokenISNOTNULL:   &ASTNode{NodeISNOTNULL, nil, nil, nil, 0, ndPrefix, nil},
-		TokenASCENDING:   &ASTNode{NodeASCENDING, nil, nil, nil, 0, ndPrefix, nil},
-		TokenDESCENDING:  &ASTNode{NodeDESCENDING, nil, nil, nil, 0, ndPrefix, nil},
+		TokenASCENDING:   &ASTNode{NodeASCENDING, nil, nil, nil, 10, ndPrefix, ldPostfix},
+		TokenDESCENDING:  &ASTNode{NodeDESCENDING, nil, nil, nil, 10, ndPrefix, ldPostfix},
 
 		TokenTRAVERSE: &ASTNode{NodeTRAVERSE, nil, nil, nil, 0, ndTraverse, nil},
 		TokenPRIMARY:  &ASTNode{NodePRIMARY, nil, nil, nil, 0, ndPrefix, nil},
@@ -129,10 +159,13 @@ func init() {
 		TokenSHOWTERM: &ASTNode{NodeSHOWTERM, nil, nil, nil, 0, ndShow, nil},
 		TokenWITH:     &ASTNode{NodeWITH, nil, nil, nil, 0, ndWith, nil},
 		TokenLIST:     &ASTNode{NodeLIST, nil, nil, nil, 0, nil, nil},
+		TokenLIMIT:    &ASTNode{NodeLIMIT, nil, nil, nil, 0, ndValueClause, nil},
+		TokenOFFSET:   &ASTNode{NodeOFFSET, nil, nil, nil, 0, ndValueClause, nil},
 
 		// Boolean operations
 
 		TokenNOT: &ASTNode{NodeNOT, nil, nil, nil, 20, ndPrefix, nil},
+		TokenHAS: &ASTNode{NodeHAS, nil, nil, nil, 130, ndPrefix, nil},
 		TokenOR:  &ASTNode{NodeOR, nil, nil, nil, 30, nil, ldInfix},
 		TokenAND: &ASTNode{NodeAND, nil, nil, nil, 40, nil, ldInfix},
 
@@ -144,12 +177,17 @@ func init() {
 		TokenLT:  &ASTNode{NodeLT, nil, nil, nil, 60, nil, ldInfix},
 
 		TokenLIKE:        &ASTNode{NodeLIKE, nil, nil, nil, 60, nil, ldInfix},
-		TokenIN:          &ASTNode{NodeIN, nil, nil, nil, 60, nil, ldInfix},
+		TokenILIKE:       &ASTNode{NodeILIKE, nil, nil, nil, 60, nil, ldInfix},
+		TokenMATCHES:     &ASTNode{NodeMATCHES, nil, nil, nil, 60, nil, ldInfix},
+		TokenIMATCHES:    &ASTNode{NodeIMATCHES, nil, nil, nil, 60, nil, ldInfix},
+		TokenIN:          &ASTNode{NodeIN, nil, nil, nil, 60, nil, ldIn},
 		TokenCONTAINS:    &ASTNode{NodeCONTAINS, nil, nil, nil, 60, nil, ldInfix},
 		TokenBEGINSWITH:  &ASTNode{NodeBEGINSWITH, nil, nil, nil, 60, nil, ldInfix},
 		TokenENDSWITH:    &ASTNode{NodeENDSWITH, nil, nil, nil, 60, nil, ldInfix},
 		TokenCONTAINSNOT: &ASTNode{NodeCONTAINSNOT, nil, nil, nil, 60, nil, ldInfix},
-		TokenNOTIN:       &ASTNode{NodeNOTIN, nil, nil, nil, 60, nil, ldInfix},
+		TokenNOTIN:       &ASTNode{NodeNOTIN, nil, nil, nil, 60, nil, ldIn},
+		TokenANY:         &ASTNode{NodeANY, nil, nil, nil, 130, ndPrefix, nil},
+		TokenALL:         &ASTNode{NodeALL, nil, nil, nil, 130, ndPrefix, nil},
 
 		// Simple arithmetic expressions
 
@@ -180,6 +218,7 @@ type parser struct {
 	node   *ASTNode        // Current ast node
 	tokens chan LexToken   // Channel which contains lex tokens
 	rp     RuntimeProvider // Runtime provider which creates runtime components
+	last   LexToken        // Last token which was read from the channel
 }
 
 /*
@@ -194,7 +233,7 @@ ParseWithRuntime parses a given input string and returns an AST decorated with
 runtime components.
 */
 func ParseWithRuntime(name string, input string, rp RuntimeProvider) (*ASTNode, error) {
-	p := &parser{name, nil, Lex(name, input), rp}
+	p := &parser{name, nil, Lex(name, input), rp, LexToken{}}
 
 	node, err := p.next()
 
@@ -204,7 +243,18 @@ func ParseWithRuntime(name string, input string, rp RuntimeProvider) (*ASTNode,
 
 	p.node = node
 
-	return p.run(0)
+	ast, err := p.run(0)
+	if err != nil {
+		return nil, err
+	}
+
+	// The whole input must have been parsed
+
+	if p.node.Token.ID != TokenEOF {
+		return nil, p.newParserError(ErrUnexpectedToken, p.node.Token.Val, *p.node.Token, TokenEOF)
+	}
+
+	return ast, nil
 }
 
 /*
@@ -274,11 +324,15 @@ func (p *parser) next() (*ASTNode, error) {
 
 	if !more {
 
-		// Unexpected end of input - the associated token is an empty error token
+		// Unexpected end of input - the error is reported at the position
+		// of the last token (the end of the input)
+
+		return nil, p.newParserError(ErrUnexpectedEnd, "", p.last)
+	}
 
-		return nil, p.newParserError(ErrUnexpectedEnd, "", token)
+	p.last = token
 
-	} else if token.ID == TokenError {
+	if token.ID == TokenError {
 
 		// There was a lexer error wrap it in a parser error
 
@@ -353,13 +407,10 @@ func ndGet(p *parser, self *ASTNode) (*ASTNode, error) {
 
 	// Parse the rest and add it as children
 
-	for p.node.Token.ID != TokenEOF {
-		exp, err := p.run(0)
-		if err != nil {
+	for !isQueryEnd(p) {
+		if err := acceptClause(p, self, statementClauses...); err != nil {
 			return nil, err
 		}
-
-		self.Children = append(self.Children, exp)
 	}
 
 	return self, nil
@@ -392,13 +443,100 @@ func ndLookup(p *parser, self *ASTNode) (*ASTNode, error) {
 
 	// Parse the rest and add it as children
 
-	for p.node.Token.ID != TokenEOF {
+	for !isQueryEnd(p) {
+		if err := acceptClause(p, self, statementClauses...); err != nil {
+			return nil, err
+		}
+	}
+
+	return self, nil
+}
+
+/*
+ndDelete is used to parse delete statements.
+*/
+func ndDelete(p *parser, self *ASTNode) (*ASTNode, error) {
+
+	// Must be followed by from and a node kind
+
+	if err := skipToken(p, TokenFROM); err != nil {
+		return nil, err
+	}
+
+	if err := acceptChild(p, self, TokenNODEKIND); err != nil {
+		return nil, err
+	}
+
+	return ndMutation(p, self)
+}
+
+/*
+ndUpdate is used to parse update statements.
+*/
+func ndUpdate(p *parser, self *ASTNode) (*ASTNode, error) {
+
+	// Must specify a node kind
+
+	if err := acceptChild(p, self, TokenNODEKIND); err != nil {
+		return nil, err
+	}
+
+	// Must have a set clause with at least one assignment
+
+	set := p.node
+
+	if err := acceptChild(p, self, TokenSET); err != nil {
+		return nil, err
+	}
+
+	acceptAssignment := func() error {
+		token := *p.node.Token
+
 		exp, err := p.run(0)
 		if err != nil {
+			return err
+		}
+
+		if exp.Name != NodeEQ || exp.Children[0].Name != NodeVALUE {
+			return p.newParserError(ErrUnexpectedToken, token.Val, token)
+		}
+
+		set.Children = append(set.Children, exp)
+
+		return nil
+	}
+
+	if err := acceptAssignment(); err != nil {
+		return nil, err
+	}
+
+	for skipToken(p, TokenCOMMA) == nil {
+		if err := acceptAssignment(); err != nil {
 			return nil, err
 		}
+	}
 
-		self.Children = append(self.Children, exp)
+	return ndMutation(p, self)
+}
+
+/*
+ndMutation parses the remaining clauses of a delete or update statement.
+Statements which modify the graph must have a where clause - all nodes of a
+kind can be changed with "where true".
+*/
+func ndMutation(p *parser, self *ASTNode) (*ASTNode, error) {
+	hasWhere := false
+
+	for !isQueryEnd(p) {
+		if err := acceptClause(p, self, statementClauses...); err != nil {
+			return nil, err
+		}
+
+		hasWhere = hasWhere || self.Children[len(self.Children)-1].Name == NodeWHERE
+	}
+
+	if !hasWhere {
+		return nil, p.newParserError(ErrMissingWhere, self.Token.Val, *self.Token)
 	}
 
 	return self, nil
@@ -432,15 +570,13 @@ func ndTraverse(p *parser, self *ASTNode) (*ASTNode, error) {
 	}
 
 	// Parse the rest and add it as children - must end with "end" if
-	// further clauses are given
+	// further clauses are given (limit and offset clauses also end the
+	// traversal)
 
-	for p.node.Token.ID != TokenEOF && p.node.Token.ID != TokenEND {
-		exp, err := p.run(0)
-		if err != nil {
+	for !isQueryEnd(p) && p.node.Token.ID != TokenEND && !isPagingToken(p) {
+		if err := acceptClause(p, self, traversalClauses...); err != nil {
 			return nil, err
 		}
-
-		self.Children = append(self.Children, exp)
 	}
 
 	if p.node.Token.ID == TokenEND {
@@ -469,16 +605,18 @@ func ndFunc(p *parser, self *ASTNode) (*ASTNode, error) {
 
 	// Read in the first attribute
 
-	if p.node.Token.ID == TokenVALUE {
+	if p.node.Token.ID == TokenVALUE || p.node.Token.ID == TokenMINUS {
 
-		// Next call cannot fail since we just checked for it. Value is optional.
+		// Value is optional.
 
-		acceptChild(p, self, TokenVALUE)
+		if err := acceptParam(p, self); err != nil {
+			return nil, err
+		}
 
 		// Read all commas and accept further values as parameters until the end
 
 		for skipToken(p, TokenCOMMA) == nil {
-			if err := acceptChild(p, self, TokenVALUE); err != nil {
+			if err := acceptParam(p, self); err != nil {
 				return nil, err
 			}
 		}
@@ -494,19 +632,34 @@ ndShow is used to parse a show clauses.
 */
 func ndShow(p *parser, self *ASTNode) (*ASTNode, error) {
 
+	// Aliases of columns must be unique
+
+	aliases := make(map[string]bool)
+
 	acceptShowTerm := func() error {
-		st := astNodeMap[TokenSHOWTERM].instance(p, p.node.Token)
 
-		if p.node.Token.ID == TokenAT {
+		// The show term gets its own copy of the token since the token value
+		// is replaced by the text of an expression
+
+		token := *p.node.Token
+		st := astNodeMap[TokenSHOWTERM].instance(p, &token)
 
-			// Parse a function
+		if isShowTermStart(p) {
+
+			// Parse a value, function or arithmetic expression
 
 			exp, err := p.run(0)
 			if err != nil {
 				return err
 			}
 
-			st.Children = append(st.Children, exp)
+			if exp.Name == NodeFUNC {
+				st.Children = append(st.Children, exp)
+			} else if exp.Name != NodeVALUE {
+				token.ID = TokenVALUE
+				token.Val = exprString(exp)
+				st.Children = append(st.Children, exp)
+			}
 
 		} else {
 
@@ -522,9 +675,17 @@ func ndShow(p *parser, self *ASTNode) (*ASTNode, error) {
 			current := p.node
 			acceptChild(p, st, TokenAS)
 
+			alias := p.node.Token
+
 			if err := acceptChild(p, current, TokenVALUE); err != nil {
 				return err
 			}
+
+			if aliases[alias.Val] {
+				return p.newParserError(ErrDuplicateAlias, alias.Val, *alias)
+			}
+
+			aliases[alias.Val] = true
 		}
 
 		// Parse a "format" definition if given
@@ -546,7 +707,7 @@ func ndShow(p *parser, self *ASTNode) (*ASTNode, error) {
 
 	// Read in the first node attribute
 
-	if p.node.Token.ID == TokenVALUE || p.node.Token.ID == TokenAT {
+	if isShowTermStart(p) {
 		if err := acceptShowTerm(); err != nil {
 			return nil, err
 		}
@@ -568,9 +729,10 @@ ndWith is used to parse a with clauses.
 */
 func ndWith(p *parser, self *ASTNode) (*ASTNode, error) {
 
-	// Parse the rest and add it as children
+	// Parse the rest and add it as children - limit and offset clauses
+	// end the with clause
 
-	for p.node.Token.ID != TokenEOF {
+	for !isQueryEnd(p) && !isPagingToken(p) {
 		exp, err := p.run(0)
 		if err != nil {
 			return nil, err
@@ -586,6 +748,17 @@ func ndWith(p *parser, self *ASTNode) (*ASTNode, error) {
 	return self, nil
 }
 
+/*
+ndValueClause is used to parse clauses which have a single value (e.g. limit
+and offset clauses).
+*/
+func ndValueClause(p *parser, self *ASTNode) (*ASTNode, error) {
+
+	// Must have a value
+
+	return self, acceptChild(p, self, TokenVALUE)
+}
+
 /*
 ndWithFunc is used to parse directives in with clauses.
 */
@@ -597,7 +770,7 @@ func ndWithFunc(p *parser, self *ASTNode) (*ASTNode, error) {
 		return nil, err
 	}
 
-	for p.node.Token.ID != TokenRPAREN {
+	for p.node.Token.ID != TokenRPAREN && p.node.Token.ID != TokenEOF {
 
 		// Parse all the expressions inside the directives
 
@@ -669,6 +842,74 @@ func ldInfix(p *parser, self *ASTNode, left *ASTNode) (*ASTNode, error) {
 	return self, nil
 }
 
+/*
+ldIn is used for the in and notin operators. The right side can be a list of
+values or a subquery (get or lookup) in round brackets. List values are
+collected in a loop so long lists do not increase the parser's recursion
+depth.
+*/
+func ldIn(p *parser, self *ASTNode, left *ASTNode) (*ASTNode, error) {
+	var right *ASTNode
+	var err error
+
+	if p.node.Token.ID != TokenLPAREN {
+		return ldInfix(p, self, left)
+	}
+
+	lparen := p.node
+
+	if err := skipToken(p, TokenLPAREN); err != nil {
+		return nil, err
+	}
+
+	if p.node.Token.ID == TokenGET || p.node.Token.ID == TokenLOOKUP {
+
+		// Parse a subquery
+
+		if right, err = p.run(0); err != nil {
+			return nil, err
+		}
+
+	} else {
+
+		// Collect the values of a list
+
+		right = astNodeMap[TokenLIST].instance(p, lparen.Token)
+
+		for p.node.Token.ID != TokenRPAREN {
+
+			exp, err := p.run(0)
+			if err != nil {
+				return nil, err
+			}
+
+			right.Children = append(right.Children, exp)
+
+			if p.node.Token.ID == TokenCOMMA {
+				skipToken(p, TokenCOMMA)
+			}
+		}
+	}
+
+	self.Children = append(self.Children, left)
+	self.Children = append(self.Children, right)
+
+	// Must have a closing bracket
+
+	return self, skipToken(p, TokenRPAREN)
+}
+
+/*
+ldPostfix is used for postfix operators (e.g. ordering directions which
+follow their expression).
+*/
+func ldPostfix(p *parser, self *ASTNode, left *ASTNode) (*ASTNode, error) {
+
+	self.Children = append(self.Children, left)
+
+	return self, nil
+}
+
 // Helper functions
 // ================
 
@@ -678,20 +919,11 @@ skipToken skips over a given token.
 func skipToken(p *parser, ids ...LexTokenID) error {
 	var err error
 
-	canSkip := func(id LexTokenID) bool {
-		for _, i := range ids {
-			if i == id {
-				return true
-			}
-		}
-		return false
-	}
-
-	if !canSkip(p.node.Token.ID) {
+	if !hasTokenID(ids, p.node.Token.ID) {
 		if p.node.Token.ID == TokenEOF {
-			return p.newParserError(ErrUnexpectedEnd, "", *p.node.Token)
+			return p.newParserError(ErrUnexpectedEnd, "", *p.node.Token, ids...)
 		}
-		return p.newParserError(ErrUnexpectedToken, p.node.Token.Val, *p.node.Token)
+		return p.newParserError(ErrUnexpectedToken, p.node.Token.Val, *p.node.Token, ids...)
 	}
 
 	// This should never return an error unless we skip over EOF or complex tokens
@@ -702,6 +934,21 @@ func skipToken(p *parser, ids ...LexTokenID) error {
 	return err
 }
 
+/*
+isQueryEnd checks if the current token ends a query. A subquery is ended by
+its closing bracket.
+*/
+func isQueryEnd(p *parser) bool {
+	return p.node.Token.ID == TokenEOF || p.node.Token.ID == TokenRPAREN
+}
+
+/*
+isPagingToken checks if the current token starts a limit or offset clause.
+*/
+func isPagingToken(p *parser) bool {
+	return p.node.Token.ID == TokenLIMIT || p.node.Token.ID == TokenOFFSET
+}
+
 /*
 acceptChild accepts the current token as a child.
 */
@@ -720,5 +967,146 @@ func acceptChild(p *parser, self *ASTNode, id LexTokenID) error {
 		return nil
 	}
 
-	return p.newParserError(ErrUnexpectedToken, current.Token.Val, *current.Token)
+	return p.newParserError(ErrUnexpectedToken, current.Token.Val, *current.Token, id)
+}
+
+/*
+acceptParam accepts the current token as a function parameter. A parameter
+is a value or a negative number (e.g. @substr(name, -5, 2)) - the sign is
+merged into the value of the number.
+*/
+func acceptParam(p *parser, self *ASTNode) error {
+
+	if p.node.Token.ID != TokenMINUS {
+		return acceptChild(p, self, TokenVALUE)
+	}
+
+	minus := p.node
+
+	if err := skipToken(p, TokenMINUS); err != nil {
+		return err
+	}
+
+	current := p.node
+
+	if err := acceptChild(p, self, TokenVALUE); err != nil {
+		return err
+	}
+
+	if _, err := strconv.ParseFloat(current.Token.Val, 64); err != nil || current.Token.Quoted {
+		return p.newParserError(ErrUnexpectedToken, current.Token.Val, *current.Token)
+	}
+
+	// Merge the sign into the number token
+
+	token := *current.Token
+	token.Val = "-" + token.Val
+	token.Pos, token.Lline, token.Lpos = minus.Token.Pos, minus.Token.Lline, minus.Token.Lpos
+	current.Token = &token
+
+	return nil
+}
+
+/*
+Tokens which can start a clause of a statement
+*/
+var statementClauses = []LexTokenID{TokenWHERE, TokenTRAVERSE, TokenSHOW, TokenWITH,
+	TokenFROM, TokenPRIMARY, TokenLIMIT, TokenOFFSET}
+
+/*
+Tokens which can start a clause of a traversal
+*/
+var traversalClauses = []LexTokenID{TokenWHERE, TokenTRAVERSE, TokenEND}
+
+/*
+acceptClause parses the next clause and adds it as a child. The clause must
+start with one of the given tokens.
+*/
+func acceptClause(p *parser, self *ASTNode, ids ...LexTokenID) error {
+
+	if !hasTokenID(ids, p.node.Token.ID) {
+		return p.newParserError(ErrUnexpectedToken, p.node.Token.Val, *p.node.Token, ids...)
+	}
+
+	exp, err := p.run(0)
+	if err != nil {
+		return err
+	}
+
+	self.Children = append(self.Children, exp)
+
+	return nil
+}
+
+/*
+hasTokenID checks if a given token ID is in a list of token IDs.
+*/
+func hasTokenID(ids []LexTokenID, id LexTokenID) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+isShowTermStart checks if the current token starts a show term. A show term
+can be a value, a function or an arithmetic expression.
+*/
+func isShowTermStart(p *parser) bool {
+	switch p.node.Token.ID {
+	case TokenVALUE, TokenAT, TokenLPAREN, TokenMINUS, TokenPLUS:
+		return true
+	}
+	return false
+}
+
+/*
+Symbols of arithmetic operators
+*/
+var exprSymbols = map[string]string{
+	NodePLUS:   "+",
+	NodeMINUS:  "-",
+	NodeTIMES:  "*",
+	NodeDIV:    "/",
+	NodeDIVINT: "//",
+	NodeMODINT: "%",
+}
+
+/*
+exprString returns the text of an arithmetic expression. Brackets are only
+added where they are needed.
+*/
+func exprString(n *ASTNode) string {
+
+	if n.Name == NodeFUNC {
+		params := make([]string, 0, len(n.Children)-1)
+		for _, c := range n.Children[1:] {
+			params = append(params, c.Token.Val)
+		}
+		return fmt.Sprintf("@%v(%v)", n.Children[0].Token.Val, strings.Join(params, ", "))
+	}
+
+	sym, ok := exprSymbols[n.Name]
+
+	if !ok {
+		return n.Token.Val
+	}
+
+	operand := func(c *ASTNode, needsBrackets bool) string {
+		if _, ok := exprSymbols[c.Name]; ok && len(c.Children) == 2 && needsBrackets {
+			return "(" + exprString(c) + ")"
+		}
+		return exprString(c)
+	}
+
+	if len(n.Children) == 1 {
+		return sym + operand(n.Children[0], true)
+	}
+
+	left, right := n.Children[0], n.Children[1]
+
+	return fmt.Sprintf("%v %v %v", operand(left, left.binding < n.binding),
+		sym, operand(right, right.binding <= n.binding))
 }
@@ -11,7 +11,9 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -63,7 +65,7 @@ func TestSimpleExpressionParsing(t *testing.T) {
 
 	input = `a *`
 	if _, err := Parse("mytest", input); err.Error() !=
-		"Parse error in mytest: Unexpected end" {
+		"Parse error in mytest: Unexpected end (Line:1 Pos:4)" {
 		t.Error(err)
 		return
 	}
@@ -102,6 +104,18 @@ plus
 		return
 	}
 
+	// Test copying an AST with new runtime components
+
+	if res, err := Parse("mytest", input); err != nil || res.Runtime != nil {
+		t.Error("Unexpected parser output:\n", res, "Error:", err)
+		return
+	} else if c := res.CopyWithRuntime(&TestRuntimeProvider{}); fmt.Sprint(c) != expectedOutput ||
+		c == res || c.Runtime == nil || c.Children[1].Children[0].Runtime == nil ||
+		c.Children[1].Children[0].Token != res.Children[1].Children[0].Token {
+		t.Error("Unexpected copy:\n", c)
+		return
+	}
+
 	// Test brackets
 
 	input = "a + 1 * (5 + 6)"
@@ -254,6 +268,34 @@ get
 		return
 	}
 
+	input = `
+get bla where a like 'INV-*' and b ILike "x?" or c matches '^[0-9]+$' and d imatches e`
+	expectedOutput = `
+get
+  value: "bla"
+  where
+    or
+      and
+        like
+          value: "a"
+          value: "INV-*"
+        ilike
+          value: "b"
+          value: "x?"
+      and
+        matches
+          value: "c"
+          value: "^[0-9]+$"
+        imatches
+          value: "d"
+          value: "e"
+`[1:]
+
+	if res, err := Parse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
 	// Test traverse clause
 
 	input = `
@@ -314,6 +356,338 @@ get
 		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
 		return
 	}
+
+	// Test limit and offset clauses - they end open traversals and with clauses
+
+	input = `
+get Song traverse ::: traverse ::: limit 10 offset 5`
+	expectedOutput = `
+get
+  value: "Song"
+  traverse
+    value: ":::"
+    traverse
+      value: ":::"
+  limit
+    value: "10"
+  offset
+    value: "5"
+`[1:]
+
+	if res, err := Parse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = `
+get Song with ordering(ranking descending, 2:n:name ascending, descending key, name)`
+	expectedOutput = `
+get
+  value: "Song"
+  with
+    ordering
+      desc
+        value: "ranking"
+      asc
+        value: "2:n:name"
+      desc
+        value: "key"
+      value: "name"
+`[1:]
+
+	if res, err := Parse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = `
+get Song with ordering(ascending key) offset 5 limit 10`
+	expectedOutput = `
+get
+  value: "Song"
+  with
+    ordering
+      asc
+        value: "key"
+  offset
+    value: "5"
+  limit
+    value: "10"
+`[1:]
+
+	if res, err := Parse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = `
+get Song traverse ::: end show name with distinct, ordering(ascending name) limit 2`
+	expectedOutput = `
+get
+  value: "Song"
+  traverse
+    value: ":::"
+  show
+    showterm: "name"
+  with
+    distinct
+    ordering
+      asc
+        value: "name"
+  limit
+    value: "2"
+`[1:]
+
+	if res, err := Parse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = `
+get Song where name = 'Ölweg' with nocase, distinct`
+	expectedOutput = `
+get
+  value: "Song"
+  where
+    =
+      value: "name"
+      value: "Ölweg"
+  with
+    nocase
+    distinct
+`[1:]
+
+	if res, err := Parse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = `
+get Song where not has email and has attr:name or ranking > 1 with ordering(ranking), nullsfirst`
+	expectedOutput = `
+get
+  value: "Song"
+  where
+    or
+      and
+        not
+          has
+            value: "email"
+        has
+          value: "attr:name"
+      >
+        value: "ranking"
+        value: "1"
+  with
+    ordering
+      value: "ranking"
+    nullsfirst
+`[1:]
+
+	if res, err := Parse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = `
+get Song where not any(tags) = urgent and all(scores) > 3`
+	expectedOutput = `
+get
+  value: "Song"
+  where
+    and
+      not
+        =
+          any
+            value: "tags"
+          value: "urgent"
+      >
+        all
+          value: "scores"
+        value: "3"
+`[1:]
+
+	if res, err := Parse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = `get Song limit`
+	if _, err := Parse("mytest", input); err == nil || err.Error() != "Parse error in mytest: Unexpected end (Line:1 Pos:15)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestInParsing(t *testing.T) {
+
+	// Test lists and subqueries in round brackets
+
+	input := `
+get Song where key in (1, 'a', 3) and name notin (get Author where name in ['x'] show name) show key`
+	expectedOutput := `
+get
+  value: "Song"
+  where
+    and
+      in
+        value: "key"
+        list
+          value: "1"
+          value: "a"
+          value: "3"
+      notin
+        value: "name"
+        get
+          value: "Author"
+          where
+            in
+              value: "name"
+              list
+                value: "x"
+          show
+            showterm: "name"
+  show
+    showterm: "key"
+`[1:]
+
+	if res, err := Parse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = `
+lookup Song 'a' where key in (lookup Song 'b', 'c' traverse ::: end show key) show key`
+	expectedOutput = `
+lookup
+  value: "Song"
+  value: "a"
+  where
+    in
+      value: "key"
+      lookup
+        value: "Song"
+        value: "b"
+        value: "c"
+        traverse
+          value: ":::"
+        show
+          showterm: "key"
+  show
+    showterm: "key"
+`[1:]
+
+	if res, err := Parse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	// Long lists are parsed iteratively
+
+	vals := make([]string, 10000)
+	for i := range vals {
+		vals[i] = fmt.Sprintf("'k%v'", i)
+	}
+
+	res, err := Parse("mytest", "get Song where key in ("+strings.Join(vals, ", ")+")")
+	if err != nil || len(res.Children[1].Children[0].Children[1].Children) != 10000 {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Test error cases
+
+	if _, err := Parse("mytest", "get Song where key in (1, 2"); err == nil || err.Error() != "Parse error in mytest: Unexpected end (Line:1 Pos:28)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := Parse("mytest", "get Song where key in (get Author))"); err == nil ||
+		err.Error() != "Parse error in mytest: Unexpected term ()) (Line:1 Pos:35)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := Parse("mytest", "get Song )"); err == nil ||
+		err.Error() != "Parse error in mytest: Unexpected term ()) (Line:1 Pos:10)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestMutationParsing(t *testing.T) {
+
+	input := `
+delete from Session where expired = true with dryrun`
+	expectedOutput := `
+delete
+  value: "Session"
+  where
+    =
+      value: "expired"
+      true
+  with
+    dryrun
+`[1:]
+
+	if res, err := Parse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = `
+update Song set ranking = ranking + 1, genre = 'Pop Music' where key in (get Author show key)`
+	expectedOutput = `
+update
+  value: "Song"
+  set
+    =
+      value: "ranking"
+      plus
+        value: "ranking"
+        value: "1"
+    =
+      value: "genre"
+      value: "Pop Music"
+  where
+    in
+      value: "key"
+      get
+        value: "Author"
+        show
+          showterm: "key"
+`[1:]
+
+	if res, err := Parse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	// Test error cases
+
+	if _, err := Parse("mytest", "delete Song where true"); err == nil ||
+		err.Error() != "Parse error in mytest: Unexpected term (Song) (Line:1 Pos:8)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := Parse("mytest", "update Song set ranking where true"); err == nil ||
+		err.Error() != "Parse error in mytest: Unexpected term (ranking) (Line:1 Pos:17)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := Parse("mytest", "update Song where true"); err == nil ||
+		err.Error() != "Parse error in mytest: Unexpected term (where) (Line:1 Pos:13)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := Parse("mytest", "delete from Song with dryrun"); err == nil ||
+		err.Error() != "Parse error in mytest: Missing where clause (delete) (Line:1 Pos:1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
 }
 
 func TestShowParsing(t *testing.T) {
@@ -392,6 +766,137 @@ get
 		return
 	}
 
+	input = `
+get song where @lower(name) = "grüße" show @substr(name, 1, '-2'), @concat(name, "日本語")`
+	expectedOutput = `
+get
+  value: "song"
+  where
+    =
+      func
+        value: "lower"
+        value: "name"
+      value: "grüße"
+  show
+    showterm
+      func
+        value: "substr"
+        value: "name"
+        value: "1"
+        value: "-2"
+    showterm
+      func
+        value: "concat"
+        value: "name"
+        value: "日本語"
+`[1:]
+
+	if res, err := Parse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = `
+get song where @substr(name, -5, 2) = "ab" show @substr(name, -1.5), @f(- 3)`
+	expectedOutput = `
+get
+  value: "song"
+  where
+    =
+      func
+        value: "substr"
+        value: "name"
+        value: "-5"
+        value: "2"
+      value: "ab"
+  show
+    showterm
+      func
+        value: "substr"
+        value: "name"
+        value: "-1.5"
+    showterm
+      func
+        value: "f"
+        value: "-3"
+`[1:]
+
+	if res, err := Parse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	if res, err := Parse("mytest", "get song show @substr(name, -5, 2)"); err != nil ||
+		res.Children[1].Children[0].Children[0].Children[2].Token.PosString() != "Line 1, Pos 29" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	input = `
+get song where score / attempts > 0.8 show price * quantity as total, -(a + b) * 2, 1 + 2 * 3 - x, a - (b - c), @len(x) // 2`
+	expectedOutput = `
+get
+  value: "song"
+  where
+    >
+      div
+        value: "score"
+        value: "attempts"
+      value: "0.8"
+  show
+    showterm: "price * qu"...
+      times
+        value: "price"
+        value: "quantity"
+      as
+        value: "total"
+    showterm: "-(a + b) *"...
+      times
+        minus
+          plus
+            value: "a"
+            value: "b"
+        value: "2"
+    showterm: "1 + 2 * 3 "...
+      minus
+        plus
+          value: "1"
+          times
+            value: "2"
+            value: "3"
+        value: "x"
+    showterm: "a - (b - c"...
+      minus
+        value: "a"
+        minus
+          value: "b"
+          value: "c"
+    showterm: "@len(x) //"...
+      divint
+        func
+          value: "len"
+          value: "x"
+        value: "2"
+`[1:]
+
+	res, err := Parse("mytest", input)
+	if err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	// The text of an expression only contains necessary brackets
+
+	var labels []string
+	for _, st := range res.Children[2].Children {
+		labels = append(labels, st.Token.Val)
+	}
+
+	if fmt.Sprint(labels) != "[price * quantity -(a + b) * 2 1 + 2 * 3 - x a - (b - c) @len(x) // 2]" {
+		t.Error("Unexpected labels:", labels)
+		return
+	}
+
 	input = `
 get song where true primary 1:song show 
 Song:title AS r'Title (mytitle)',
@@ -458,7 +963,7 @@ get
 func TestParserErrorCases(t *testing.T) {
 
 	if res, err := ParseWithRuntime("mytest", "", &TestRuntimeProvider{}); err.Error() !=
-		"Parse error in mytest: Unexpected end" {
+		"Parse error in mytest: Unexpected end (Line:1 Pos:1)" {
 		t.Error("Unexpected result", res, err)
 		return
 	}
@@ -490,9 +995,9 @@ func TestParserErrorCases(t *testing.T) {
 	// Test "Get" parsing with invalid lexer output
 
 	res, err := testParserRun([]LexToken{
-		LexToken{TokenGET, 1, "", 1, 1},
-		LexToken{TokenGET, 1, "", 1, 1},
-		LexToken{TokenEOF, 1, "", 1, 1},
+		LexToken{TokenGET, 1, "", 1, 1, false},
+		LexToken{TokenGET, 1, "", 1, 1, false},
+		LexToken{TokenEOF, 1, "", 1, 1, false},
 	})
 	if err.Error() != "Parse error in special test: Unexpected term (Line:1 Pos:1)" {
 		t.Error("Unexpected result", res, err)
@@ -500,9 +1005,9 @@ func TestParserErrorCases(t *testing.T) {
 	}
 
 	res, err = testParserRun([]LexToken{
-		LexToken{TokenLOOKUP, 1, "", 1, 1},
-		LexToken{TokenGET, 1, "", 1, 1},
-		LexToken{TokenEOF, 1, "", 1, 1},
+		LexToken{TokenLOOKUP, 1, "", 1, 1, false},
+		LexToken{TokenGET, 1, "", 1, 1, false},
+		LexToken{TokenEOF, 1, "", 1, 1, false},
 	})
 	if err.Error() != "Parse error in special test: Unexpected term (Line:1 Pos:1)" {
 		t.Error("Unexpected result", res, err)
@@ -510,7 +1015,7 @@ func TestParserErrorCases(t *testing.T) {
 	}
 
 	if res, err := ParseWithRuntime("mytest", "lookup x", &TestRuntimeProvider{}); err.Error() !=
-		"Parse error in mytest: Unexpected end" {
+		"Parse error in mytest: Unexpected end (Line:1 Pos:9)" {
 		t.Error("Unexpected result", res, err)
 		return
 	}
@@ -522,7 +1027,7 @@ func TestParserErrorCases(t *testing.T) {
 	}
 
 	if res, err := ParseWithRuntime("mytest", "lookup x '123' GET", &TestRuntimeProvider{}); err.Error() !=
-		"Parse error in mytest: Unexpected end" {
+		"Parse error in mytest: Unexpected term (GET) (Line:1 Pos:16)" {
 		t.Error("Unexpected result", res, err)
 		return
 	}
@@ -540,7 +1045,7 @@ func TestParserErrorCases(t *testing.T) {
 	}
 
 	if res, err := ParseWithRuntime("mytest", "GET x traverse ::: GeT", &TestRuntimeProvider{}); err.Error() !=
-		"Parse error in mytest: Unexpected end" {
+		"Parse error in mytest: Unexpected term (GeT) (Line:1 Pos:20)" {
 		t.Error("Unexpected result", res, err)
 		return
 	}
@@ -558,13 +1063,13 @@ func TestParserErrorCases(t *testing.T) {
 	}
 
 	if res, err := ParseWithRuntime("mytest", "GET x where @xxx(12", &TestRuntimeProvider{}); err.Error() !=
-		"Parse error in mytest: Unexpected end (Line:1 Pos:18)" {
+		"Parse error in mytest: Unexpected end (Line:1 Pos:20)" {
 		t.Error("Unexpected result", res, err)
 		return
 	}
 
 	if res, err := ParseWithRuntime("mytest", "GET x where @xxx(abc,", &TestRuntimeProvider{}); err.Error() !=
-		"Parse error in mytest: Unexpected end" {
+		"Parse error in mytest: Unexpected end (Line:1 Pos:22)" {
 		t.Error("Unexpected result", res, err)
 		return
 	}
@@ -581,8 +1086,32 @@ func TestParserErrorCases(t *testing.T) {
 		return
 	}
 
+	if res, err := ParseWithRuntime("mytest", "GET x show @bla(1, -abc)", &TestRuntimeProvider{}); err.Error() !=
+		"Parse error in mytest: Unexpected term (abc) (Line:1 Pos:21)" {
+		t.Error("Unexpected result", res, err)
+		return
+	}
+
+	if res, err := ParseWithRuntime("mytest", "GET x show @bla(1, -'5')", &TestRuntimeProvider{}); err.Error() !=
+		"Parse error in mytest: Unexpected term (5) (Line:1 Pos:21)" {
+		t.Error("Unexpected result", res, err)
+		return
+	}
+
+	if res, err := ParseWithRuntime("mytest", "GET x show @bla(1, -)", &TestRuntimeProvider{}); err.Error() !=
+		"Parse error in mytest: Unexpected term ()) (Line:1 Pos:21)" {
+		t.Error("Unexpected result", res, err)
+		return
+	}
+
 	if res, err := ParseWithRuntime("mytest", "GET x show @bla(1,", &TestRuntimeProvider{}); err.Error() !=
-		"Parse error in mytest: Unexpected end" {
+		"Parse error in mytest: Unexpected end (Line:1 Pos:19)" {
+		t.Error("Unexpected result", res, err)
+		return
+	}
+
+	if res, err := ParseWithRuntime("mytest", "get a show name as 'Customer Name', @count(1:e::Song) as total, key AS \"Customer Name\"", &TestRuntimeProvider{}); err.Error() !=
+		"Parse error in mytest: Duplicate column alias (Customer Name) (Line:1 Pos:72)" {
 		t.Error("Unexpected result", res, err)
 		return
 	}
@@ -600,7 +1129,7 @@ func TestParserErrorCases(t *testing.T) {
 	}
 
 	if res, err := ParseWithRuntime("mytest", "get a where [1,2", &TestRuntimeProvider{}); err.Error() !=
-		"Parse error in mytest: Unexpected end" {
+		"Parse error in mytest: Unexpected end (Line:1 Pos:17)" {
 		t.Error("Unexpected result", res, err)
 		return
 	}
@@ -608,8 +1137,8 @@ func TestParserErrorCases(t *testing.T) {
 	var TokenUnknown LexTokenID = -5
 
 	res, err = testParserRun([]LexToken{
-		LexToken{TokenUnknown, 1, "", 1, 1},
-		LexToken{TokenEOF, 1, "", 1, 1},
+		LexToken{TokenUnknown, 1, "", 1, 1, false},
+		LexToken{TokenEOF, 1, "", 1, 1, false},
 	})
 	if err.Error() != "Parse error in special test: Unknown term (id:-5 (\"\")) (Line:1 Pos:1)" {
 		t.Error("Unexpected result", res, err)
@@ -617,10 +1146,10 @@ func TestParserErrorCases(t *testing.T) {
 	}
 
 	res, err = testParserRun([]LexToken{
-		LexToken{TokenVALUE, 1, "", 1, 1},
-		LexToken{TokenMINUS, 1, "", 1, 1},
-		LexToken{TokenUnknown, 1, "", 1, 1},
-		LexToken{TokenEOF, 1, "", 1, 1},
+		LexToken{TokenVALUE, 1, "", 1, 1, false},
+		LexToken{TokenMINUS, 1, "", 1, 1, false},
+		LexToken{TokenUnknown, 1, "", 1, 1, false},
+		LexToken{TokenEOF, 1, "", 1, 1, false},
 	})
 	if err.Error() != "Parse error in special test: Unknown term (id:-5 (\"\")) (Line:1 Pos:1)" {
 		t.Error("Unexpected result", res, err)
@@ -631,6 +1160,81 @@ func TestParserErrorCases(t *testing.T) {
 /*
 Special function to test lexer runs which might be prevented by the actual lexer.
 */
+func TestParseErrorDetails(t *testing.T) {
+
+	parseError := func(input string) *ParseError {
+		_, err := Parse("mytest", input)
+		pe, _ := err.(*ParseError)
+		return pe
+	}
+
+	// Clauses must start with a keyword - misspelled keywords are suggested
+
+	pe := parseError("get Song where name = x\n  and ranking > 2 shwo name")
+
+	if pe == nil || pe.Error() != "Parse error in mytest: Unexpected term (shwo) (Line:2 Pos:19)" ||
+		pe.Offset != 42 || pe.Token != "shwo" || !errors.Is(pe, ErrUnexpectedToken) ||
+		fmt.Sprint(pe.Expected) != "[where traverse show with from primary limit offset]" ||
+		fmt.Sprint(pe.Suggestions) != "[show]" {
+		t.Error("Unexpected result:", pe)
+		return
+	}
+
+	if pe.Hint() != "expected 'where', 'traverse', 'show', 'with', 'from', "+
+		"'primary', 'limit', 'offset' - did you mean 'show'?" {
+		t.Error("Unexpected result:", pe.Hint())
+		return
+	}
+
+	// Suggestions are ordered by their distance to the term and by name
+
+	if pe = parseError("lookup Song 'a' wire nocase"); pe == nil ||
+		fmt.Sprint(pe.Suggestions) != "[where with]" ||
+		!strings.HasSuffix(pe.Hint(), "did you mean 'where' or 'with'?") {
+		t.Error("Unexpected result:", pe)
+		return
+	}
+
+	// Traversals can only contain conditions and further traversals
+
+	if pe = parseError("get Song traverse ::: shw name"); pe == nil ||
+		pe.Error() != "Parse error in mytest: Unexpected term (shw) (Line:1 Pos:23)" ||
+		fmt.Sprint(pe.Expected) != "[where traverse end]" || fmt.Sprint(pe.Suggestions) != "[]" {
+		t.Error("Unexpected result:", pe)
+		return
+	}
+
+	// Terms which are not values get no suggestions
+
+	if pe = parseError("get Song where name = x )"); pe == nil ||
+		pe.Offset != 24 || fmt.Sprint(pe.Expected) != "[end of query]" ||
+		pe.Suggestions != nil || pe.Hint() != "expected 'end of query'" {
+		t.Error("Unexpected result:", pe)
+		return
+	}
+
+	if pe = parseError("get Song with ordering(ascending name"); pe == nil ||
+		pe.Error() != "Parse error in mytest: Unexpected end (Line:1 Pos:38)" ||
+		pe.Offset != 37 || fmt.Sprint(pe.Expected) != "[)]" {
+		t.Error("Unexpected result:", pe)
+		return
+	}
+
+	if pe = parseError("get Song where a = 1 and = 2"); pe == nil ||
+		pe.Expected != nil || pe.Hint() != "" {
+		t.Error("Unexpected result:", pe)
+		return
+	}
+
+	// Token names are used in error messages
+
+	if TokenName(TokenWHERE) != "where" || TokenName(TokenGEQ) != ">=" ||
+		TokenName(TokenNODEKIND) != "node kind" || TokenName(LexTokenID(-5)) != "id:-5" {
+		t.Error("Unexpected result")
+		return
+	}
+}
+
 func testParserRun(tokens []LexToken) (*ASTNode, error) {
 
 	// Create channel which is filled with the given lex tokens
@@ -645,7 +1249,7 @@ func testParserRun(tokens []LexToken) (*ASTNode, error) {
 
 	// Create parser which processes the given tokens
 
-	p := &parser{"special test", nil, tokenChan, nil}
+	p := &parser{"special test", nil, tokenChan, nil, LexToken{}}
 
 	node, err := p.next()
 
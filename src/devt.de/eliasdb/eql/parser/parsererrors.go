@@ -13,30 +13,55 @@ package parser
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+
+	"devt.de/common/stringutil"
 )
 
 /*
-newParserError creates a new ParserError object.
+MaxSuggestionDistance is the maximum Levenshtein distance between an
+unexpected term and a keyword which is suggested instead.
 */
-func (p *parser) newParserError(t error, d string, token LexToken) error {
-	return &Error{p.name, t, d, token.Lline, token.Lpos}
+const MaxSuggestionDistance = 2
+
+/*
+newParserError creates a new ParseError object. The expected tokens are the
+tokens which would have been valid instead of the given token.
+*/
+func (p *parser) newParserError(t error, d string, token LexToken, expected ...LexTokenID) error {
+	pe := &ParseError{p.name, t, d, token.Lline, token.Lpos, token.Pos, token.Val, nil, nil}
+
+	for _, id := range expected {
+		pe.Expected = append(pe.Expected, TokenName(id))
+	}
+
+	if token.ID == TokenVALUE || token.ID == TokenNODEKIND {
+		pe.Suggestions = suggestKeywords(token.Val, expected)
+	}
+
+	return pe
 }
 
 /*
-Error models a parser related error
+ParseError models a parser related error
 */
-type Error struct {
-	Source string // Name of the source which was given to the parser
-	Type   error  // Error type (to be used for equal checks)
-	Detail string // Details of this error
-	Line   int    // Line of the error
-	Pos    int    // Position of the error
+type ParseError struct {
+	Source      string   // Name of the source which was given to the parser
+	Type        error    // Error type (to be used for equal checks)
+	Detail      string   // Details of this error
+	Line        int      // Line of the error
+	Pos         int      // Position of the error in its line
+	Offset      int      // Offset of the error in the input (in bytes)
+	Token       string   // Term which caused the error
+	Expected    []string // Terms which would have been valid instead
+	Suggestions []string // Keywords which were likely meant instead of the term
 }
 
 /*
 Error returns a human-readable string representation of this error.
 */
-func (pe *Error) Error() string {
+func (pe *ParseError) Error() string {
 	var ret string
 
 	if pe.Detail != "" {
@@ -52,6 +77,70 @@ func (pe *Error) Error() string {
 	return ret
 }
 
+/*
+Unwrap returns the type of this error.
+*/
+func (pe *ParseError) Unwrap() error {
+	return pe.Type
+}
+
+/*
+Hint returns a human-readable string of the expected terms and suggestions
+of this error (e.g. expected 'where', 'traverse' - did you mean 'where'?).
+*/
+func (pe *ParseError) Hint() string {
+	var buf strings.Builder
+
+	quote := func(terms []string, sep string) string {
+		return "'" + strings.Join(terms, "'"+sep+"'") + "'"
+	}
+
+	if len(pe.Expected) > 0 {
+		buf.WriteString("expected ")
+		buf.WriteString(quote(pe.Expected, ", "))
+	}
+
+	if len(pe.Suggestions) > 0 {
+		if buf.Len() > 0 {
+			buf.WriteString(" - ")
+		}
+		buf.WriteString("did you mean ")
+		buf.WriteString(quote(pe.Suggestions, " or "))
+		buf.WriteString("?")
+	}
+
+	return buf.String()
+}
+
+/*
+suggestKeywords returns all expected keywords which are close to a given term.
+The closest keywords come first.
+*/
+func suggestKeywords(term string, expected []LexTokenID) []string {
+	var ret []string
+
+	term = strings.ToLower(term)
+	distances := make(map[string]int)
+
+	for _, id := range expected {
+		if kw, ok := tokenNames[id]; ok && keywordMap[kw] == id {
+			if d := stringutil.LevenshteinDistance(term, kw); d <= MaxSuggestionDistance && d < len(kw) {
+				distances[kw] = d
+				ret = append(ret, kw)
+			}
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		if distances[ret[i]] != distances[ret[j]] {
+			return distances[ret[i]] < distances[ret[j]]
+		}
+		return ret[i] < ret[j]
+	})
+
+	return ret
+}
+
 /*
 Parser related error types
 */
@@ -62,4 +151,6 @@ var (
 	ErrImpossibleNullDenotation = errors.New("Term cannot start an expression")
 	ErrImpossibleLeftDenotation = errors.New("Term can only start an expression")
 	ErrUnexpectedToken          = errors.New("Unexpected term")
+	ErrDuplicateAlias           = errors.New("Duplicate column alias")
+	ErrMissingWhere             = errors.New("Missing where clause")
 )
@@ -0,0 +1,112 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package eql
+
+import (
+	"context"
+
+	"devt.de/eliasdb/eql/interpreter"
+	"devt.de/eliasdb/eql/parser"
+	"devt.de/eliasdb/graph"
+)
+
+/*
+PreparedQuery is a parsed EQL query which can be run repeatedly without
+parsing the query text again. A PreparedQuery is not changed by running it
+and can be run concurrently.
+*/
+type PreparedQuery struct {
+	name  string          // Name to identify the query
+	query string          // Query text
+	ast   *parser.ASTNode // AST of the query without runtime components
+}
+
+/*
+RunOptions controls how a query is run (see Run, Stream and PreparedQuery).
+
+Sorted visits the start nodes of GET queries in lexicographic key order.
+Without an explicit ordering the rows of the result are therefore in the same
+order every time the query runs - e.g. for offset based pagination. Visiting
+the start nodes in key order is considerably more expensive than visiting
+them in storage order (see graph.SortedNodeKeyIterator).
+
+Sample lets GET queries only visit up to n uniformly random start nodes (see
+graph.Manager.SampleNodeKeys) which are visited in lexicographic key order.
+This is useful for ad-hoc spot checks on large node kinds. LOOKUP queries are
+not affected.
+
+Cursor continues a GET query after the last row of a previous result of the
+same query (see SearchResult.Cursor) - an empty cursor returns the first rows.
+The start nodes are always visited in key order. Instead of visiting all rows
+before the offset again the query resumes with the start node of the last
+row. The offset clause of the query only applies to the first result. Cursors
+are only supported for queries whose rows can be returned as soon as they are
+produced - queries with ordering, filtering (notnull, unique or distinct),
+aggregation functions or a group scope need to see all rows and must use
+offset based pagination. A cursor is only valid for the exact query text and
+partition it was created for (this includes the limit clause) and expires
+after CursorTTL.
+*/
+type RunOptions struct {
+	Sorted bool   // Flag if start nodes are visited in key order
+	Sample int    // Number of random start nodes which are visited (0 to visit all)
+	Cursor string // Optional cursor of a previous result
+
+	Highlight bool // Flag if matches of @phrase conditions are recorded (see SearchResult.RowHighlights)
+
+	MaxNodes int // Maximum number of nodes which are visited - scans and traversals (0 for no limit)
+	MaxRows  int // Maximum number of result rows (0 for no limit)
+
+	Workers int // Number of workers which fetch start nodes and traversals concurrently (default is 1)
+
+	CountTotal bool // Flag if all rows are counted if the query has a limit (see SearchResult.TotalCount)
+
+	Page *Page // Optional page of the rows which are selected by the query (see Page)
+}
+
+/*
+Prepare parses a query so it can be run repeatedly. The given name is used to
+identify the query in errors.
+*/
+func Prepare(name string, query string) (*PreparedQuery, error) {
+	ast, err := parser.Parse(name, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PreparedQuery{name, query, ast}, nil
+}
+
+/*
+Query returns the query text of the prepared query.
+*/
+func (pq *PreparedQuery) Query() string {
+	return pq.query
+}
+
+/*
+Run runs the prepared query against a given graph database (see Run).
+*/
+func (pq *PreparedQuery) Run(ctx context.Context, part string, gm *graph.Manager,
+	opts RunOptions) (SearchResult, error) {
+
+	return runQuery(ctx, pq.name, part, pq.query, pq.ast, gm, interpreter.NewDefaultNodeInfo(gm), nil, opts)
+}
+
+/*
+Stream runs the prepared query against a given graph database and passes all
+rows of the result to a given ResultStream (see Stream).
+*/
+func (pq *PreparedQuery) Stream(ctx context.Context, part string, gm *graph.Manager,
+	stream ResultStream, opts RunOptions) (SearchResult, error) {
+
+	return runQuery(ctx, pq.name, part, pq.query, pq.ast, gm, interpreter.NewDefaultNodeInfo(gm), stream, opts)
+}
@@ -0,0 +1,177 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package eql
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestPreparedQuery(t *testing.T) {
+	gm, _ := songGraph()
+
+	ctx := context.Background()
+
+	query := "get Author where name != Hans traverse :::Song where ranking > 2 end show name, Song:name, Song:ranking with ordering(ascending 2:n:name)"
+
+	pq, err := Prepare("test", query)
+	if err != nil || pq.Query() != query {
+		t.Error("Unexpected result:", pq, err)
+		return
+	}
+
+	expected, _ := RunQuery("test", "main", query, gm)
+
+	// The prepared query can be run several times
+
+	for i := 0; i < 3; i++ {
+		if res, err := pq.Run(ctx, "main", gm, RunOptions{}); err != nil || res.String() != expected.String() {
+			t.Error("Unexpected result:", res, err)
+			return
+		}
+	}
+
+	// The prepared query can be run concurrently
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if res, err := pq.Run(ctx, "main", gm, RunOptions{}); err != nil || res.String() != expected.String() {
+				t.Error("Unexpected result:", res, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// Run options correspond to the different query functions
+
+	pq, _ = Prepare("test", "get Song show key limit 3")
+
+	res, err := pq.Run(ctx, "main", gm, RunOptions{Sorted: true})
+	if err != nil || res.Cursor() == "" || res.String() != `
+Labels: Song Key
+Format: auto
+Data: 1:n:key
+Aria1
+Aria2
+Aria3
+`[1:] {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	var buf bytes.Buffer
+
+	if _, err := pq.Stream(ctx, "main", gm, NewCSVStream(&buf, CSVOptions{}),
+		RunOptions{Cursor: res.Cursor()}); err != nil || buf.String() != `
+Song Key
+Aria4
+DeadSong2
+FightSong4
+`[1:] {
+		t.Error("Unexpected result:", buf.String(), err)
+		return
+	}
+
+	if res, err := pq.Run(ctx, "main", gm, RunOptions{Sample: 2}); err != nil || res.RowCount() != 2 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	pq, _ = Prepare("test", "get Song where @phrase(name, 'aria2') or key = Aria1")
+
+	if res, err := pq.Run(ctx, "main", gm, RunOptions{Sorted: true, Highlight: true}); err != nil ||
+		len(res.RowHighlights()[0]) != 0 || len(res.RowHighlights()[1]) != 1 ||
+		fmt.Sprint(*res.RowHighlights()[1][0]) != "{Song Aria2 name [{0 5}]}" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := pq.Run(ctx, "main", gm, RunOptions{Sorted: true}); err != nil ||
+		fmt.Sprint(res.RowHighlights()) != "[[] []]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Errors are reported with the name of the prepared query
+
+	if _, err := Prepare("test", "get Song where"); err == nil ||
+		err.Error() != "Parse error in test: Unexpected end (Line:1 Pos:15)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	pq, _ = Prepare("test", "get Bla")
+
+	if _, err := pq.Run(ctx, "main", gm, RunOptions{}); err == nil ||
+		err.Error() != "EQL error in test: Unknown node kind (Bla) (Line:1 Pos:5)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func BenchmarkPreparedQuery(b *testing.B) {
+	gm, _ := songGraph()
+
+	ctx := context.Background()
+
+	query := "get Author where name != Hans and (name = John or name beginswith M) " +
+		"traverse :::Song where ranking > 2 and name != DeadSong2 end " +
+		"show name, Song:name as Title format text, Song:ranking with ordering(ascending 2:n:name) limit 2"
+
+	// Parsing the query for every run
+
+	b.Run("RunQuery", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := Run(ctx, "test", "main", query, gm, RunOptions{}); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+
+	// Parsing the query once
+
+	pq, err := Prepare("test", query)
+	if err != nil {
+		b.Error(err)
+		return
+	}
+
+	b.Run("Prepared", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := pq.Run(ctx, "main", gm, RunOptions{}); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+
+	// Parsing only
+
+	b.Run("Parse", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := Prepare("test", query); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
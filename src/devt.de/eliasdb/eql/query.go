@@ -14,7 +14,10 @@ Package eql contains the main API for EQL.
 package eql
 
 import (
+	"context"
+	"fmt"
 	"strings"
+	"time"
 
 	"devt.de/eliasdb/eql/interpreter"
 	"devt.de/eliasdb/eql/parser"
@@ -26,6 +29,102 @@ GroupNodeKind is a special node kind representing groups
 */
 const GroupNodeKind = interpreter.GroupNodeKind
 
+/*
+Errors of queries which were stopped before they finished. The returned error
+is an *interpreter.CancelError which also contains the number of rows which
+had been produced (use errors.Is to check for these errors).
+*/
+var (
+	ErrQueryCancelled = interpreter.ErrQueryCancelled
+	ErrQueryTimeout   = interpreter.ErrQueryTimeout
+)
+
+/*
+ErrInvalidCursor is the error type of cursors which are malformed, expired,
+were created for a different query or are given for a query which cannot be
+resumed (use errors.Is to check for it).
+*/
+var ErrInvalidCursor = interpreter.ErrInvalidCursor
+
+/*
+ErrQueryLimitExceeded is the error type of queries which were stopped because
+they visited more nodes or produced more rows than allowed (see RunOptions).
+The returned error is a *LimitError which contains the exceeded limit and the
+progress of the query (use errors.Is to check for it).
+*/
+var ErrQueryLimitExceeded = interpreter.ErrQueryLimitExceeded
+
+/*
+LimitError is the error of a query which exceeded one of its limits (use
+errors.As to get it).
+*/
+type LimitError = interpreter.LimitError
+
+/*
+ParseError is the error type of queries which cannot be parsed. It contains
+the location of the error, the terms which would have been valid instead and
+suggestions for misspelled keywords (use errors.As to get it).
+*/
+type ParseError = parser.ParseError
+
+/*
+Highlight contains the matches of @phrase conditions in an attribute of a
+node (see SearchResult.RowHighlights). A Match is the character range of a
+single match.
+*/
+type (
+	Highlight = interpreter.Highlight
+	Match     = interpreter.Match
+)
+
+/*
+Page selects a part of the rows of a query (see RunOptions.Page). The page is
+taken from the rows which are selected by the limit and offset clauses of the
+query: the offset of the page is added to the offset clause and the page ends
+at the limit clause at the latest. The total count of a paged result (see
+SearchResult.TotalCount) is the number of rows which are selected by the
+clauses. A result has no more rows once its page reaches the limit clause.
+*/
+type Page = interpreter.Page
+
+/*
+QueryStats are the execution statistics of a query (see SearchResult.Stats).
+*/
+type QueryStats = interpreter.QueryStats
+
+/*
+ValidationResult is the result of a query validation (see ValidateQuery). A
+ValidationMessage describes a single error or warning and its position in
+the query.
+*/
+type (
+	ValidationResult  = interpreter.ValidationResult
+	ValidationMessage = interpreter.ValidationMessage
+)
+
+/*
+MaxQueryTime is the maximum time a query may run. It applies to all queries
+even if they were started without a deadline. A value of 0 means no limit.
+*/
+var MaxQueryTime time.Duration
+
+/*
+RegisterFunction registers a custom function which can be used in EQL
+queries (e.g. @geoDistance(lat, lon, 52.5, 13.4)). The function declares its
+arguments and if it can be used in where and / or show clauses. Names of
+built-in functions and of already registered functions are rejected.
+*/
+func RegisterFunction(name string, f interpreter.FuncProvider) error {
+	return interpreter.RegisterFunction(name, f)
+}
+
+/*
+UnregisterFunction removes a registered custom function.
+*/
+func UnregisterFunction(name string) {
+	interpreter.UnregisterFunction(name)
+}
+
 /*
 RunQuery runs a search query against a given graph database.
 */
@@ -38,14 +137,140 @@ RunQueryWithNodeInfo runs a search query against a given graph database. Using
 a given NodeInfo object to retrieve rendering information.
 */
 func RunQueryWithNodeInfo(name string, part string, query string, gm *graph.Manager, ni interpreter.NodeInfo) (SearchResult, error) {
+	return runQuery(context.Background(), name, part, query, nil, gm, ni, nil, RunOptions{})
+}
+
+/*
+Run runs a search query against a given graph database. The query stops with
+an error if the given context is cancelled or its deadline is exceeded. The
+given options control how the query is run (see RunOptions).
+*/
+func Run(ctx context.Context, name string, part string, query string, gm *graph.Manager,
+	opts RunOptions) (SearchResult, error) {
+
+	return runQuery(ctx, name, part, query, nil, gm, interpreter.NewDefaultNodeInfo(gm), nil, opts)
+}
+
+/*
+Stream runs a search query against a given graph database and passes all
+rows of the result to a given ResultStream instead of keeping them in memory.
+The returned search result has no rows but contains the header and if more
+rows exist beyond the limit. Rows are passed on as soon as they are produced
+unless the result has an ordering, notnull or unique flags or aggregation
+functions - these results need to see all rows first and are buffered (see
+ResultStream.Start). Graph storage locks are only held for each individual
+graph operation and are released between rows. Stopping early by returning an
+error from the stream will return this error.
+*/
+func Stream(ctx context.Context, name string, part string, query string, gm *graph.Manager,
+	stream ResultStream, opts RunOptions) (SearchResult, error) {
+
+	return runQuery(ctx, name, part, query, nil, gm, interpreter.NewDefaultNodeInfo(gm), stream, opts)
+}
+
+/*
+RunQueryStream runs a search query against a given graph database and calls
+a given callback with every row of the result (see Stream). Returns if the
+rows were streamed incrementally - i.e. as soon as they were produced.
+Stopping early by returning an error from the callback will return this
+error.
+*/
+func RunQueryStream(name string, part string, query string, gm *graph.Manager,
+	cb func(row []interface{}) error) (bool, error) {
+
+	stream := &callbackStream{cb: cb}
+
+	_, err := Stream(context.Background(), name, part, query, gm, stream, RunOptions{})
+
+	return stream.incremental, err
+}
+
+/*
+runQuery runs a search query against a given graph database. The query is
+parsed unless its AST is given. All rows are passed to the given stream if
+it is not nil.
+*/
+func runQuery(ctx context.Context, name string, part string, query string, queryAST *parser.ASTNode,
+	gm *graph.Manager, ni interpreter.NodeInfo, rs ResultStream, opts RunOptions) (SearchResult, error) {
+
 	var rtp parser.RuntimeProvider
+	var grtp *interpreter.GetRuntimeProvider
+	var stream interpreter.ResultStream
+
+	cursor := opts.Cursor
+
+	if rs != nil {
+		stream = &streamAdapter{rs}
+	}
+
+	// Apply the hard limit for the query time
+
+	if MaxQueryTime > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, MaxQueryTime)
+		defer cancel()
+	}
 
 	word := strings.ToLower(parser.FirstWord(query))
 
-	if word == "get" {
-		rtp = interpreter.NewGetRuntimeProvider(name, part, gm, ni)
+	if cursor != "" && word != "get" {
+		return nil, &interpreter.RuntimeError{
+			Source: name,
+			Type:   interpreter.ErrInvalidCursor,
+			Detail: "Cursors are only supported for get queries",
+			Node:   nil,
+			Line:   1,
+			Pos:    1,
+		}
+	}
+
+	if opts.Page != nil && (opts.Page.Offset < 0 || opts.Page.Limit < -1) {
+		return nil, &interpreter.RuntimeError{
+			Source: name,
+			Type:   interpreter.ErrInvalidConstruct,
+			Detail: fmt.Sprintf("Invalid page: offset %v, limit %v", opts.Page.Offset, opts.Page.Limit),
+			Node:   nil,
+			Line:   1,
+			Pos:    1,
+		}
+	}
+
+	if word == "get" || IsMutation(query) {
+		grtp = interpreter.NewGetRuntimeProvider(name, part, gm, ni)
+		grtp.SortedStartKeys = opts.Sorted || cursor != "" // A cursor requires start nodes in key order
+		grtp.SampleStartKeys = opts.Sample
+		grtp.Stream = stream
+		grtp.Context = ctx
+		grtp.Highlight = opts.Highlight
+		grtp.MaxNodes = opts.MaxNodes
+		grtp.MaxRows = opts.MaxRows
+		grtp.Workers = opts.Workers
+		grtp.CountTotal = opts.CountTotal
+		grtp.Page = opts.Page
+		rtp = grtp
+
+		if cursor != "" {
+			pos, err := parseCursor(name, part, cursorQuery(query, opts.Page), cursor)
+			if err != nil {
+				return nil, err
+			}
+
+			grtp.ResumeKey = pos.Key
+			grtp.ResumeRows = pos.Rows
+		}
+
 	} else if word == "lookup" {
-		rtp = interpreter.NewLookupRuntimeProvider(name, part, gm, ni)
+		lrtp := interpreter.NewLookupRuntimeProvider(name, part, gm, ni)
+		lrtp.Stream = stream
+		lrtp.Context = ctx
+		lrtp.Highlight = opts.Highlight
+		lrtp.MaxNodes = opts.MaxNodes
+		lrtp.MaxRows = opts.MaxRows
+		lrtp.Workers = opts.Workers
+		lrtp.CountTotal = opts.CountTotal
+		lrtp.Page = opts.Page
+		rtp = lrtp
 	} else {
 		return nil, &interpreter.RuntimeError{
 			Source: name,
@@ -57,9 +282,16 @@ func RunQueryWithNodeInfo(name string, part string, query string, gm *graph.Mana
 		}
 	}
 
-	ast, err := parser.ParseWithRuntime(name, query, rtp)
-	if err != nil {
-		return nil, err
+	var ast *parser.ASTNode
+
+	if queryAST != nil {
+		ast = queryAST.CopyWithRuntime(rtp)
+	} else {
+		var err error
+
+		if ast, err = parser.ParseWithRuntime(name, query, rtp); err != nil {
+			return nil, err
+		}
 	}
 
 	res, err := ast.Runtime.Eval()
@@ -67,7 +299,38 @@ func RunQueryWithNodeInfo(name string, part string, query string, gm *graph.Mana
 		return nil, err
 	}
 
-	return &queryResult{res.(*interpreter.SearchResult)}, nil
+	sres := res.(*interpreter.SearchResult)
+	qres := &queryResult{sres, ""}
+
+	// Create a cursor if the query can continue after the last row
+
+	if grtp != nil && !IsMutation(query) {
+		if key, rows := sres.ResumePosition(); key != "" {
+			qres.cursor = newCursor(part, cursorQuery(query, opts.Page), key, rows)
+		}
+	}
+
+	return qres, nil
+}
+
+/*
+cursorQuery returns the text which identifies a query for its cursors. A cursor
+is only valid for the page it was created with.
+*/
+func cursorQuery(query string, page *Page) string {
+	if page == nil {
+		return query
+	}
+	return fmt.Sprintf("%v\x00%v:%v", query, page.Offset, page.Limit)
+}
+
+/*
+IsMutation checks if a given query is a statement which changes the graph
+(delete or update).
+*/
+func IsMutation(query string) bool {
+	word := strings.ToLower(parser.FirstWord(query))
+	return word == parser.NodeDELETE || word == parser.NodeUPDATE
 }
 
 /*
@@ -82,11 +345,26 @@ func ParseQuery(name string, query string) (*parser.ASTNode, error) {
 	return ast, nil
 }
 
+/*
+ValidateQuery checks a query without running it - e.g. to validate a query
+while it is typed. Syntax errors, errors which would stop the query from
+running and unknown node kinds are reported as errors. Attributes which are
+not known for their node or edge kind, traversal specs which do not match a
+known relationship and comparisons which always have the same result are
+reported as warnings. No data is read - only the kinds, attributes and
+relationships which are known to the graph manager are used. An error is
+only returned if the query could not be validated.
+*/
+func ValidateQuery(query string, gm *graph.Manager) (*ValidationResult, error) {
+	return interpreter.ValidateQuery("validation", query, gm, interpreter.NewDefaultNodeInfo(gm))
+}
+
 /*
 queryResult datastructure to hide implementation details.
 */
 type queryResult struct {
 	*interpreter.SearchResult
+	cursor string // Cursor to continue after the last row
 }
 
 /*
@@ -95,3 +373,48 @@ Header returns a data structure describing the result header.
 func (qr *queryResult) Header() SearchResultHeader {
 	return qr.SearchResult.Header()
 }
+
+/*
+Cursor returns a cursor to continue after the last row of the result.
+*/
+func (qr *queryResult) Cursor() string {
+	return qr.cursor
+}
+
+/*
+streamAdapter passes the rows of an interpreter result stream on to a
+ResultStream.
+*/
+type streamAdapter struct {
+	ResultStream
+}
+
+/*
+Start is called once before any row is streamed.
+*/
+func (sa *streamAdapter) Start(header *interpreter.SearchHeader, incremental bool) error {
+	return sa.ResultStream.Start(header, incremental)
+}
+
+/*
+callbackStream is a ResultStream which calls a callback for every row.
+*/
+type callbackStream struct {
+	cb          func(row []interface{}) error
+	incremental bool
+}
+
+/*
+Start is called once before any row is streamed.
+*/
+func (cs *callbackStream) Start(header SearchResultHeader, incremental bool) error {
+	cs.incremental = incremental
+	return nil
+}
+
+/*
+Row is called for every row of the result.
+*/
+func (cs *callbackStream) Row(row []interface{}, source []string) error {
+	return cs.cb(row)
+}
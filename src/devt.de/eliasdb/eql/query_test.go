@@ -11,7 +11,12 @@
 package eql
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
 	"testing"
+	"time"
 
 	"devt.de/eliasdb/eql/interpreter"
 	"devt.de/eliasdb/graph"
@@ -82,6 +87,11 @@ Data: 1:n:key, 1:n:name
 		return
 	}
 
+	if s := res.Stats(); s.Version != interpreter.StatsVersion || s.StartNodes != 1 || s.Duration <= 0 {
+		t.Error("Unexpected result: ", s)
+		return
+	}
+
 	// Test error cases
 
 	_, err := RunQuery("test", "main", "boo Author", gm)
@@ -91,7 +101,7 @@ Data: 1:n:key, 1:n:name
 	}
 
 	_, err = RunQuery("test", "main", "get Author where", gm)
-	if err.Error() != "Parse error in test: Unexpected end" {
+	if err.Error() != "Parse error in test: Unexpected end (Line:1 Pos:17)" {
 		t.Error(err)
 		return
 	}
@@ -140,6 +150,535 @@ Data: 1:n:key, 1:n:name
 		t.Error("Unexpected result: ", res)
 		return
 	}
+
+	res, _ = Run(context.Background(), "test", "main", "get test", gm, RunOptions{Sorted: true})
+	if res.String() != `
+Labels: Test Key, Test Name
+Format: auto, auto
+Data: 1:n:key, 1:n:name
+1, <not set>
+123, <not set>
+2, <not set>
+3, <not set>
+4, bla
+`[1:] {
+		t.Error("Unexpected result: ", res)
+		return
+	}
+
+	if _, err := Run(context.Background(), "test", "main", "get unknown", gm, RunOptions{Sorted: true}); err == nil ||
+		err.Error() != "EQL error in test: Unknown node kind (unknown) (Line:1 Pos:5)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	res, _ = Run(context.Background(), "test", "main", "get test", gm, RunOptions{Sample: 10})
+	if res.String() != `
+Labels: Test Key, Test Name
+Format: auto, auto
+Data: 1:n:key, 1:n:name
+1, <not set>
+123, <not set>
+2, <not set>
+3, <not set>
+4, bla
+`[1:] {
+		t.Error("Unexpected result: ", res)
+		return
+	}
+
+	if res, err := Run(context.Background(), "test", "main", "get test", gm, RunOptions{Sample: 2}); err != nil || res.RowCount() != 2 {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	if _, err := Run(context.Background(), "test", "main", "get unknown", gm, RunOptions{Sample: 2}); err == nil ||
+		err.Error() != "EQL error in test: Unknown node kind (unknown) (Line:1 Pos:5)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+}
+
+type testStream struct {
+	header      SearchResultHeader
+	incremental bool
+	rows        []string
+}
+
+func (ts *testStream) Start(header SearchResultHeader, incremental bool) error {
+	ts.header = header
+	ts.incremental = incremental
+	return nil
+}
+
+func (ts *testStream) Row(row []interface{}, source []string) error {
+	ts.rows = append(ts.rows, fmt.Sprint(row, source))
+	return nil
+}
+
+type stopStream struct {
+	testStream
+	stop int
+}
+
+func (ss *stopStream) Row(row []interface{}, source []string) error {
+	ss.testStream.Row(row, source)
+	if len(ss.rows) == ss.stop {
+		return errors.New("Stop")
+	}
+	return nil
+}
+
+func TestQueryStream(t *testing.T) {
+	gm, _ := songGraph()
+
+	ctx := context.Background()
+
+	ts := &testStream{}
+
+	_, err := Stream(ctx, "test", "main", "get Author", gm, ts, RunOptions{})
+
+	if err != nil || !ts.incremental || len(ts.rows) != 3 {
+		t.Error("Unexpected result: ", ts, err)
+		return
+	}
+
+	// Ordered results are buffered
+
+	ts = &testStream{}
+
+	_, err = Stream(ctx, "test", "main", "get Author show key with ordering(descending key)", gm, ts, RunOptions{})
+
+	if err != nil || ts.incremental ||
+		fmt.Sprint(ts.rows) != "[[456] [n:Author:456] [123] [n:Author:123] [000] [n:Author:000]]" {
+		t.Error("Unexpected result: ", ts, err)
+		return
+	}
+
+	// Limit and offset are applied to streamed rows
+
+	ts = &testStream{}
+
+	res, err := Stream(ctx, "test", "main", "get Author show key offset 1 limit 1", gm, ts, RunOptions{Sorted: true})
+
+	if err != nil || !ts.incremental || !res.HasMore() || res.RowCount() != 0 ||
+		fmt.Sprint(ts.header.Data()) != "[1:n:key]" || fmt.Sprint(ts.rows) != "[[123] [n:Author:123]]" {
+		t.Error("Unexpected result: ", ts, res, err)
+		return
+	}
+
+	ts = &testStream{}
+
+	res, err = Stream(ctx, "test", "main", "lookup Author '000', '123' show key with ordering(descending key)", gm, ts, RunOptions{})
+
+	if err != nil || ts.incremental || res.HasMore() || fmt.Sprint(ts.rows) != "[[123] [n:Author:123] [000] [n:Author:000]]" {
+		t.Error("Unexpected result: ", ts, res, err)
+		return
+	}
+
+	// Errors of the stream stop the query
+
+	ss := &stopStream{stop: 2}
+
+	_, err = Stream(ctx, "test", "main", "get Song", gm, ss, RunOptions{})
+
+	if err == nil || err.Error() != "Stop" || len(ss.rows) != 2 {
+		t.Error("Unexpected result: ", ss.rows, err)
+		return
+	}
+
+	// Prepared queries can be streamed as well
+
+	pq, _ := Prepare("test", "get Author show key offset 1 limit 1")
+	ts = &testStream{}
+
+	if _, err = pq.Stream(ctx, "main", gm, ts, RunOptions{Sorted: true}); err != nil ||
+		fmt.Sprint(ts.rows) != "[[123] [n:Author:123]]" {
+		t.Error("Unexpected result: ", ts, err)
+		return
+	}
+
+	if _, err := Stream(ctx, "test", "main", "get unknown", gm, &testStream{}, RunOptions{}); err == nil ||
+		err.Error() != "EQL error in test: Unknown node kind (unknown) (Line:1 Pos:5)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+}
+
+func TestRunQueryStream(t *testing.T) {
+	gm, _ := songGraph()
+
+	var rows []string
+
+	incremental, err := RunQueryStream("test", "main", "get Author", gm, func(row []interface{}) error {
+		rows = append(rows, fmt.Sprint(row))
+		return nil
+	})
+
+	if err != nil || !incremental || len(rows) != 3 {
+		t.Error("Unexpected result: ", incremental, rows, err)
+		return
+	}
+
+	// Ordered results are buffered
+
+	rows = nil
+
+	incremental, err = RunQueryStream("test", "main", "get Author with ordering(descending key)", gm, func(row []interface{}) error {
+		rows = append(rows, fmt.Sprint(row))
+		return nil
+	})
+
+	if err != nil || incremental || fmt.Sprint(rows) != "[[456 Hans] [123 Mike] [000 John]]" {
+		t.Error("Unexpected result: ", incremental, rows, err)
+		return
+	}
+
+	// Errors of the callback stop the query
+
+	rows = nil
+
+	_, err = RunQueryStream("test", "main", "get Song", gm, func(row []interface{}) error {
+		rows = append(rows, fmt.Sprint(row))
+		if len(rows) == 2 {
+			return errors.New("Stop")
+		}
+		return nil
+	})
+
+	if err == nil || err.Error() != "Stop" || len(rows) != 2 {
+		t.Error("Unexpected result: ", rows, err)
+		return
+	}
+
+	if _, err := RunQueryStream("test", "main", "get unknown", gm, nil); err == nil ||
+		err.Error() != "EQL error in test: Unknown node kind (unknown) (Line:1 Pos:5)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+}
+
+func TestQueryPage(t *testing.T) {
+	gm, _ := songGraph()
+
+	ctx := context.Background()
+
+	page := func(query string, page *Page) (SearchResult, error) {
+		return Run(ctx, "test", "main", query, gm, RunOptions{Sorted: true, CountTotal: true, Page: page})
+	}
+
+	// A page is not affected by a trailing comment
+
+	res, err := page("get Song show key # all songs", &Page{Offset: 1, Limit: 2})
+
+	if err != nil || fmt.Sprint(res.Rows()) != "[[Aria2] [Aria3]]" || !res.HasMore() ||
+		res.TotalCount() != 9 || res.Cursor() == "" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// A page is taken from the rows which are selected by the limit and
+	// offset clauses
+
+	res, err = page("get Song show key offset 2 limit 5", &Page{Offset: 1, Limit: 2})
+
+	if err != nil || fmt.Sprint(res.Rows()) != "[[Aria4] [DeadSong2]]" || !res.HasMore() || res.TotalCount() != 5 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = page("get Song show key limit 5", &Page{Offset: 3, Limit: 4})
+
+	if err != nil || fmt.Sprint(res.Rows()) != "[[Aria4] [DeadSong2]]" || res.HasMore() ||
+		res.TotalCount() != 5 || res.Cursor() != "" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = page("get Song show key limit 5", &Page{Offset: 10, Limit: -1})
+
+	if err != nil || res.RowCount() != 0 || res.HasMore() || res.TotalCount() != 5 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = page("get Song show key limit 3 with ordering(descending key)", &Page{Offset: 1, Limit: 5})
+
+	if err != nil || fmt.Sprint(res.Rows()) != "[[MyOnlySong3] [LoveSong3]]" || res.HasMore() || res.TotalCount() != 3 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	ts := &testStream{}
+
+	if _, err = Stream(ctx, "test", "main", "lookup Song 'Aria1', 'Aria2', 'Aria3' show key limit 2", gm, ts,
+		RunOptions{Page: &Page{Offset: 1, Limit: 2}}); err != nil || fmt.Sprint(ts.rows) != "[[Aria2] [n:Song:Aria2]]" {
+		t.Error("Unexpected result:", ts, err)
+		return
+	}
+
+	// A cursor is only valid for the page it was created with
+
+	res, _ = page("get Song show key", &Page{Offset: 0, Limit: 4})
+
+	if res, err = Run(ctx, "test", "main", "get Song show key", gm, RunOptions{Cursor: res.Cursor(),
+		Page: &Page{Offset: 0, Limit: 4}}); err != nil || fmt.Sprint(res.Rows()) != "[[DeadSong2] [FightSong4] [LoveSong3] [MyOnlySong3]]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err = Run(ctx, "test", "main", "get Song show key", gm, RunOptions{Cursor: res.Cursor(),
+		Page: &Page{Offset: 0, Limit: 5}}); err == nil ||
+		err.Error() != "EQL error in test: Invalid cursor (Cursor was created for a different query)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = page("get Song", &Page{Offset: -1, Limit: 2}); err == nil ||
+		err.Error() != "EQL error in test: Invalid construct (Invalid page: offset -1, limit 2) (Line:1 Pos:1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+type cancelStream struct {
+	testStream
+	cancel func()
+}
+
+func (cs *cancelStream) Row(row []interface{}, source []string) error {
+	cs.testStream.Row(row, source)
+	if len(cs.rows) == 2 {
+		cs.cancel()
+	}
+	return nil
+}
+
+func TestQueryCancel(t *testing.T) {
+	gm, _ := songGraph()
+
+	res, err := Run(context.Background(), "test", "main", "get Author", gm, RunOptions{})
+
+	if err != nil || res.RowCount() != 3 {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	// Cancel a query after 2 rows were produced
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cs := &cancelStream{cancel: cancel}
+
+	_, err = Stream(ctx, "test", "main", "get Song", gm, cs, RunOptions{Sorted: true})
+
+	if !errors.Is(err, ErrQueryCancelled) || err.(*interpreter.CancelError).Rows != 2 ||
+		err.Error() != "EQL error in test: Query was cancelled (2 rows were produced)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	_, err = Run(ctx, "test", "main", "get Author", gm, RunOptions{Sorted: true})
+
+	if !errors.Is(err, ErrQueryCancelled) {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	// Queries time out if their deadline is exceeded
+
+	ctx, cancel = context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	_, err = Run(ctx, "test", "main", "get Song", gm, RunOptions{Sample: 2})
+
+	if !errors.Is(err, ErrQueryTimeout) ||
+		err.Error() != "EQL error in test: Query timed out (0 rows were produced)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	// The hard limit applies also to queries without deadline
+
+	MaxQueryTime = time.Nanosecond
+	defer func() {
+		MaxQueryTime = 0
+	}()
+
+	time.Sleep(time.Millisecond)
+
+	if _, err = RunQuery("test", "main", "lookup Author '000'", gm); !errors.Is(err, ErrQueryTimeout) {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+}
+
+/*
+geoDistance is an example custom function which calculates the distance
+between two coordinates in kilometers.
+*/
+type geoDistance struct {
+}
+
+func (gd *geoDistance) ArgTypes() []interpreter.FuncArgType {
+	return []interpreter.FuncArgType{interpreter.ArgNumber, interpreter.ArgNumber,
+		interpreter.ArgNumber, interpreter.ArgNumber}
+}
+
+func (gd *geoDistance) Where() bool {
+	return true
+}
+
+func (gd *geoDistance) Show() bool {
+	return true
+}
+
+func (gd *geoDistance) Eval(args []interface{}, node data.Node, edge data.Edge) (interface{}, error) {
+	for _, arg := range args {
+		if arg == nil {
+			return nil, nil
+		}
+	}
+
+	rad := func(arg interface{}) float64 {
+		return arg.(float64) * math.Pi / 180
+	}
+
+	lat1, lon1, lat2, lon2 := rad(args[0]), rad(args[1]), rad(args[2]), rad(args[3])
+
+	a := math.Pow(math.Sin((lat2-lat1)/2), 2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin((lon2-lon1)/2), 2)
+
+	return math.Round(6371 * 2 * math.Asin(math.Sqrt(a))), nil
+}
+
+func TestCustomFunctions(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := graph.NewGraphManager(mgs)
+
+	for _, city := range [][]interface{}{{"Berlin", 52.52, 13.405},
+		{"Hamburg", "53.5511", "9.9937"}, {"Munich", 48.1351, 11.582}, {"Nowhere", nil, nil}} {
+
+		node := data.NewGraphNode()
+		node.SetAttr("key", city[0])
+		node.SetAttr("kind", "City")
+		if city[1] != nil {
+			node.SetAttr("lat", city[1])
+			node.SetAttr("lon", city[2])
+		}
+		gm.StoreNode("main", node)
+	}
+
+	if err := RegisterFunction("geoDistance", &geoDistance{}); err != nil {
+		t.Error(err)
+		return
+	}
+	defer UnregisterFunction("geoDistance")
+
+	// Names of built-in and registered functions cannot be used
+
+	if err := RegisterFunction("count", &geoDistance{}); err == nil || err.Error() !=
+		"Cannot register function count: Name of a built-in function" {
+		t.Error(err)
+		return
+	}
+
+	if err := RegisterFunction("geoDistance", &geoDistance{}); err == nil || err.Error() !=
+		"Cannot register function geoDistance: Function is already registered" {
+		t.Error(err)
+		return
+	}
+
+	// The custom function can be used in where and show clauses
+
+	res, err := Run(context.Background(), "test", "main", "get City where @geoDistance(lat, lon, 52.52, 13.405) < 300 "+
+		"show key, @geoDistance(lat, lon, 52.52, 13.405) as distance", gm, RunOptions{Sorted: true})
+
+	if err != nil || res.String() != `
+Labels: City Key, distance
+Format: auto, auto
+Data: 1:n:key, 1:func:geoDistance()
+Berlin, 0
+Hamburg, 255
+`[1:] {
+		t.Error("Unexpected result: ", err, res)
+		return
+	}
+
+	res, err = Run(context.Background(), "test", "main", "get City show key, @geoDistance(lat, lon, 48.1351, 11.582) "+
+		"with ordering(descending key)", gm, RunOptions{Sorted: true})
+
+	if err != nil || res.String() != `
+Labels: City Key, @geoDistance(lat, lon, 48.1351, 11.582)
+Format: auto, auto
+Data: 1:n:key, 1:func:geoDistance()
+Nowhere, <not set>
+Munich, 0
+Hamburg, 612
+Berlin, 504
+`[1:] {
+		t.Error("Unexpected result: ", err, res)
+		return
+	}
+
+	// Arguments are checked
+
+	if _, err := RunQuery("test", "main", "get City where @geoDistance(lat, lon) < 300", gm); err == nil || err.Error() !=
+		"EQL error in test: Invalid construct (GeoDistance function requires 4 parameters) (Line:1 Pos:16)" {
+		t.Error(err)
+		return
+	}
+
+	if _, err := Run(context.Background(), "test", "main", "get City show @geoDistance(lat, lon, key, 1)", gm, RunOptions{Sorted: true}); err == nil || err.Error() !=
+		"EQL error in test: Value of operand is not a number (Argument 3 of @geoDistance: Berlin) (Line:1 Pos:15)" {
+		t.Error(err)
+		return
+	}
+
+	// Unregistered functions are unknown
+
+	UnregisterFunction("geoDistance")
+
+	if _, err := RunQuery("test", "main", "get City where @geoDistance(lat, lon, 1, 1) < 300", gm); err == nil || err.Error() !=
+		"EQL error in test: Invalid construct (Unknown function: geoDistance) (Line:1 Pos:16)" {
+		t.Error(err)
+		return
+	}
+}
+
+func TestMutationQuery(t *testing.T) {
+	gm, _ := songGraph()
+
+	if !IsMutation(" Delete from Song where true") || !IsMutation("update Song set a = 1 where true") || IsMutation("get Song") {
+		t.Error("Unexpected result")
+		return
+	}
+
+	res, err := RunQuery("test", "main", "update Song set ranking = 0 where ranking > 10", gm)
+
+	if err != nil || fmt.Sprint(res.Header().Labels(), res.Rows()) != "[Updated] [[2]]" {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	// All songs are scanned and the updated songs are fetched again
+
+	if s := res.Stats(); s.StartNodes != 9 || s.NodeFetches != 11 {
+		t.Error("Unexpected result: ", s)
+		return
+	}
+
+	res, err = RunQuery("test", "main", "get Song where ranking = 0 show key", gm)
+
+	if err != nil || res.RowCount() != 2 {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	if _, err := Run(context.Background(), "test", "main", "delete from Song where true", gm, RunOptions{Sample: 2}); err == nil ||
+		err.Error() != "EQL error in test: Invalid construct (Statements which change the graph cannot be sampled) (Line:1 Pos:1)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
 }
 
 func TestParseQuery(t *testing.T) {
@@ -159,13 +698,31 @@ get
 	// Test error case
 
 	_, err := ParseQuery("test", "get Author where")
-	if err.Error() != "Parse error in test: Unexpected end" {
+	if err.Error() != "Parse error in test: Unexpected end (Line:1 Pos:17)" {
 		t.Error(err)
 		return
 	}
 
 }
 
+func TestValidateQuery(t *testing.T) {
+	gm, _ := songGraph()
+
+	res, err := ValidateQuery("get Author where nmae = John show name", gm)
+	if err != nil || !res.Valid || len(res.Errors) != 0 || len(res.Warnings) != 1 ||
+		res.Warnings[0].Detail != "Attribute 'nmae' is not known for node kind 'Author' - the name is compared as a literal value" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = ValidateQuery("get Author where", gm)
+	if err != nil || res.Valid || len(res.Errors) != 1 || res.Errors[0].Type != interpreter.ValidationSyntax ||
+		res.Errors[0].Line != 1 || res.Errors[0].Pos != 17 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+}
+
 func songGraph() (*graph.Manager, *graphstorage.MemoryGraphStorage) {
 
 	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
@@ -269,3 +826,64 @@ func songGraphGroups() (*graph.Manager, *graphstorage.MemoryGraphStorage) {
 
 	return gm, mgs
 }
+
+func TestQueryLimits(t *testing.T) {
+	gm, _ := songGraph()
+
+	run := func(query string, maxNodes int, maxRows int) (SearchResult, error) {
+		pq, err := Prepare("test", query)
+		if err != nil {
+			return nil, err
+		}
+		return pq.Run(context.Background(), "main", gm, RunOptions{Sorted: true, MaxNodes: maxNodes, MaxRows: maxRows})
+	}
+
+	// Queries within their limits are not affected
+
+	if res, err := run("get Author traverse :::Song end", 12, 9); err != nil || res.RowCount() != 9 {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	// Nodes of traversals are counted
+
+	_, err := run("get Author traverse :::Song end", 11, 0)
+
+	var le *LimitError
+
+	if !errors.Is(err, ErrQueryLimitExceeded) || !errors.As(err, &le) ||
+		le.Limit != interpreter.LimitNodes || le.Max != 11 || le.Nodes != 12 || le.Rows != 8 ||
+		err.Error() != "EQL error in test: Query limit exceeded (more than 11 nodes - 12 nodes were visited and 8 rows were produced)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	// Nodes of @count and subqueries are counted
+
+	if _, err = run("get Author show @count(1, :::Song)", 11, 0); !errors.As(err, &le) || le.Nodes != 12 || le.Rows != 2 {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	if _, err = run("get Author where key in (get Song show key)", 5, 0); !errors.As(err, &le) || le.Nodes != 6 || le.Rows != 0 {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	// Rows are counted
+
+	_, err = run("get Author traverse :::Song end", 0, 3)
+
+	if !errors.As(err, &le) || le.Limit != interpreter.LimitRows || le.Max != 3 || le.Nodes != 5 || le.Rows != 3 ||
+		err.Error() != "EQL error in test: Query limit exceeded (more than 3 rows - 5 nodes were visited and 3 rows were produced)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	// Rows beyond the limit clause of a query are not produced
+
+	if res, err := run("get Author traverse :::Song end limit 3", 0, 3); err != nil || res.RowCount() != 3 {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+}
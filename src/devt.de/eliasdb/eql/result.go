@@ -10,6 +10,8 @@
 
 package eql
 
+import "io"
+
 /*
 SearchResultHeader models the header of an EQL search result.
 */
@@ -63,6 +65,49 @@ type SearchResult interface {
 	*/
 	Rows() [][]interface{}
 
+	/*
+	   Distinct returns if duplicate rows have been removed from the result.
+	*/
+	Distinct() bool
+
+	/*
+	   Warnings returns all warnings which were collected while running the
+	   query (e.g. for dates which could not be parsed).
+	*/
+	Warnings() []string
+
+	/*
+	   Stats returns the execution statistics of the query (e.g. the
+	   duration, the number of scanned start nodes and storage fetches).
+	   New counters might be added in later versions.
+	*/
+	Stats() QueryStats
+
+	/*
+	   HasMore returns if more rows exist beyond the limit of the result.
+	*/
+	HasMore() bool
+
+	/*
+	   TotalCount returns the number of all rows of the result without its
+	   offset and limit. Returns -1 if the number is not known because the
+	   query stopped once the limit was reached (see RunOptions.CountTotal).
+	*/
+	TotalCount() int
+
+	/*
+	   Cursor returns a cursor which can be used to continue after the last
+	   row of the result (see RunOptions.Cursor). The cursor is empty if
+	   there are no more rows or if the query cannot be resumed.
+	*/
+	Cursor() string
+
+	/*
+	   Ordering returns the applied ordering of the result in order of
+	   priority (e.g. descending 2:n:ranking).
+	*/
+	Ordering() []string
+
 	/*
 	   RowSource returns the sources of a result row.
 	   Format is either: <n/e>:<kind>:<key> or q:<query>
@@ -74,8 +119,53 @@ type SearchResult interface {
 	*/
 	RowSources() [][]string
 
+	/*
+	   RowHighlights returns for every row where @phrase conditions matched
+	   in the attribute values of the row's nodes. Matches are only recorded
+	   if the query was run with the Highlight option (see RunOptions).
+	*/
+	RowHighlights() [][]*Highlight
+
+	/*
+	   WriteCSV writes the result row by row as CSV to a given writer.
+	*/
+	WriteCSV(w io.Writer, opts CSVOptions) error
+
+	/*
+	   Decode writes all rows of the result into a given pointer to a slice of
+	   structs, pointers to structs or maps of type map[string]interface{}
+	   (see DecodeTag). Returns a *DecodeError if values could not be
+	   converted.
+	*/
+	Decode(dest interface{}) error
+
+	/*
+	   DecodeRow writes a row of the result into a given pointer to a struct
+	   or map of type map[string]interface{} (see Decode).
+	*/
+	DecodeRow(line int, dest interface{}) error
+
 	/*
 		String returns a string representation of this search result.
 	*/
 	String() string
 }
+
+/*
+ResultStream receives the rows of an EQL search result one by one.
+*/
+type ResultStream interface {
+
+	/*
+	   Start is called once before any row with the header of the result and
+	   a flag if rows are streamed as soon as they are produced. Results which
+	   need to be ordered, filtered or aggregated are buffered first.
+	*/
+	Start(header SearchResultHeader, incremental bool) error
+
+	/*
+	   Row is called for every row of the result with the sources of the row.
+	   Format of the sources is either: <n/e>:<kind>:<key> or q:<query>
+	*/
+	Row(row []interface{}, source []string) error
+}
@@ -0,0 +1,293 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+/*
+AttrError is returned by the typed attribute accessors of nodes and edges.
+*/
+type AttrError struct {
+	Type   error  // Error type (to be used for equal checks)
+	Attr   string // Name of the attribute
+	Detail string // Details of this error
+}
+
+/*
+Error returns a human-readable string representation of this error.
+*/
+func (ae *AttrError) Error() string {
+	if ae.Detail != "" {
+		return fmt.Sprintf("%v: %v (%v)", ae.Type, ae.Attr, ae.Detail)
+	}
+
+	return fmt.Sprintf("%v: %v", ae.Type, ae.Attr)
+}
+
+/*
+Attribute related error types
+*/
+var (
+	ErrAttrMissing    = errors.New("Missing attribute")
+	ErrAttrConversion = errors.New("Could not convert attribute value")
+)
+
+/*
+ToString converts a value to a string. Strings and byte slices are returned
+as they are, values which implement fmt.Stringer are converted with their
+String() function. Numbers and booleans are formatted with their default
+format.
+*/
+func ToString(val interface{}) (string, error) {
+
+	switch v := val.(type) {
+
+	case string:
+		return v, nil
+
+	case []byte:
+		return string(v), nil
+
+	case fmt.Stringer:
+		return v.String(), nil
+
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32,
+		uint64, float32, float64:
+		return fmt.Sprint(v), nil
+	}
+
+	return "", fmt.Errorf("Value %v of type %T is not a string", val, val)
+}
+
+/*
+ToInt64 converts a value to an int64. All integer types are converted as
+long as they fit into an int64. Floating point numbers are only converted if
+they have no fractional part. Strings, JSON numbers and values which implement
+fmt.Stringer are parsed as integer or floating point numbers.
+*/
+func ToInt64(val interface{}) (int64, error) {
+
+	switch v := val.(type) {
+
+	case int:
+		return int64(v), nil
+
+	case int8:
+		return int64(v), nil
+
+	case int16:
+		return int64(v), nil
+
+	case int32:
+		return int64(v), nil
+
+	case int64:
+		return v, nil
+
+	case uint:
+		return uintToInt64(uint64(v))
+
+	case uint8:
+		return int64(v), nil
+
+	case uint16:
+		return int64(v), nil
+
+	case uint32:
+		return int64(v), nil
+
+	case uint64:
+		return uintToInt64(v)
+
+	case float32:
+		return floatToInt64(float64(v))
+
+	case float64:
+		return floatToInt64(v)
+	}
+
+	s, err := numberString(val)
+	if err != nil {
+		return 0, err
+	}
+
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Value %v is not an integer", s)
+	}
+
+	return floatToInt64(f)
+}
+
+/*
+uintToInt64 converts an unsigned integer to an int64.
+*/
+func uintToInt64(v uint64) (int64, error) {
+	if v > math.MaxInt64 {
+		return 0, fmt.Errorf("Value %v is out of range", v)
+	}
+	return int64(v), nil
+}
+
+/*
+floatToInt64 converts a floating point number without a fractional part to
+an int64.
+*/
+func floatToInt64(v float64) (int64, error) {
+	if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+		return 0, fmt.Errorf("Value %v is not an integer", v)
+	}
+	return int64(v), nil
+}
+
+/*
+ToFloat64 converts a value to a float64. All number types are converted.
+Strings, JSON numbers and values which implement fmt.Stringer are parsed as
+floating point numbers.
+*/
+func ToFloat64(val interface{}) (float64, error) {
+
+	switch v := val.(type) {
+
+	case int:
+		return float64(v), nil
+
+	case int8:
+		return float64(v), nil
+
+	case int16:
+		return float64(v), nil
+
+	case int32:
+		return float64(v), nil
+
+	case int64:
+		return float64(v), nil
+
+	case uint:
+		return float64(v), nil
+
+	case uint8:
+		return float64(v), nil
+
+	case uint16:
+		return float64(v), nil
+
+	case uint32:
+		return float64(v), nil
+
+	case uint64:
+		return float64(v), nil
+
+	case float32:
+		return float64(v), nil
+
+	case float64:
+		return v, nil
+	}
+
+	s, err := numberString(val)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Value %v is not a number", s)
+	}
+
+	return f, nil
+}
+
+/*
+numberString returns the string representation of a value which should be
+parsed as a number.
+*/
+func numberString(val interface{}) (string, error) {
+
+	switch v := val.(type) {
+
+	case json.Number:
+		return string(v), nil
+
+	case string:
+		return v, nil
+
+	case fmt.Stringer:
+		return v.String(), nil
+	}
+
+	return "", fmt.Errorf("Value %v of type %T is not a number", val, val)
+}
+
+/*
+ToBool converts a value to a bool. Strings are parsed with strconv.ParseBool
+(e.g. true, false, 1 or 0). Numbers are true if they are not zero.
+*/
+func ToBool(val interface{}) (bool, error) {
+
+	switch v := val.(type) {
+
+	case bool:
+		return v, nil
+
+	case string:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, fmt.Errorf("Value %v is not a boolean", v)
+		}
+		return b, nil
+	}
+
+	if f, err := ToFloat64(val); err == nil {
+		return f != 0, nil
+	}
+
+	return false, fmt.Errorf("Value %v of type %T is not a boolean", val, val)
+}
+
+/*
+ToTime converts a value to a time.Time. Strings are parsed as RFC3339
+timestamps (fractional seconds are optional).
+*/
+func ToTime(val interface{}) (time.Time, error) {
+
+	switch v := val.(type) {
+
+	case time.Time:
+		return v, nil
+
+	case *time.Time:
+		if v != nil {
+			return *v, nil
+		}
+
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Value %v is not a RFC3339 timestamp", v)
+		}
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("Value %v of type %T is not a time", val, val)
+}
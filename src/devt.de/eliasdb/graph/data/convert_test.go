@@ -0,0 +1,160 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestToString(t *testing.T) {
+
+	for _, v := range []interface{}{"123", []byte("123"), json.Number("123"), 123, uint8(123), 123.0} {
+		if res, err := ToString(v); err != nil || res != "123" {
+			t.Error("Unexpected result:", v, res, err)
+			return
+		}
+	}
+
+	if res, err := ToString(true); err != nil || res != "true" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := ToString([]string{"a"}); err == nil || err.Error() != "Value [a] of type []string is not a string" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+}
+
+func TestToInt64(t *testing.T) {
+
+	for _, v := range []interface{}{int(42), int8(42), int16(42), int32(42), int64(42),
+		uint(42), uint8(42), uint16(42), uint32(42), uint64(42), float32(42), float64(42),
+		"42", "42.0", "4.2e1", json.Number("42"), json.Number("42.0")} {
+
+		if res, err := ToInt64(v); err != nil || res != 42 {
+			t.Error("Unexpected result:", v, res, err)
+			return
+		}
+	}
+
+	if res, err := ToInt64("9007199254740993"); err != nil || res != 9007199254740993 {
+		t.Error("Large integers should not lose precision:", res, err)
+		return
+	}
+
+	for v, msg := range map[interface{}]string{
+		42.5:                     "Value 42.5 is not an integer",
+		"42.5":                   "Value 42.5 is not an integer",
+		"abc":                    "Value abc is not an integer",
+		uint64(math.MaxUint64):   "Value 18446744073709551615 is out of range",
+		math.Inf(1):              "Value +Inf is not an integer",
+		true:                     "Value true of type bool is not a number",
+		fmt.Sprint(math.MaxInt8): "",
+	} {
+		res, err := ToInt64(v)
+
+		if msg == "" {
+			if err != nil || res != math.MaxInt8 {
+				t.Error("Unexpected result:", v, res, err)
+				return
+			}
+		} else if err == nil || err.Error() != msg {
+			t.Error("Unexpected result:", v, res, err)
+			return
+		}
+	}
+}
+
+func TestToFloat64(t *testing.T) {
+
+	for _, v := range []interface{}{int(2), int8(2), int16(2), int32(2), int64(2),
+		uint(2), uint8(2), uint16(2), uint32(2), uint64(2), float32(2), float64(2),
+		"2", "2.0", json.Number("2")} {
+
+		if res, err := ToFloat64(v); err != nil || res != 2 {
+			t.Error("Unexpected result:", v, res, err)
+			return
+		}
+	}
+
+	if res, err := ToFloat64("1.5"); err != nil || res != 1.5 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := ToFloat64("abc"); err == nil || err.Error() != "Value abc is not a number" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := ToFloat64(nil); err == nil || err.Error() != "Value <nil> of type <nil> is not a number" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+}
+
+func TestToBool(t *testing.T) {
+
+	for v, expected := range map[interface{}]bool{
+		true: true, false: false, "true": true, "false": false, "1": true,
+		"0": false, 1: true, 0: false, 0.5: true, json.Number("0"): false,
+	} {
+		if res, err := ToBool(v); err != nil || res != expected {
+			t.Error("Unexpected result:", v, res, err)
+			return
+		}
+	}
+
+	if res, err := ToBool("yes"); err == nil || err.Error() != "Value yes is not a boolean" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := ToBool([]int{1}); err == nil || err.Error() != "Value [1] of type []int is not a boolean" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+}
+
+func TestToTime(t *testing.T) {
+	expected := time.Date(2016, 3, 4, 10, 20, 30, 0, time.UTC)
+
+	for _, v := range []interface{}{expected, &expected, "2016-03-04T10:20:30Z",
+		"2016-03-04T12:20:30+02:00", "2016-03-04T10:20:30.000Z"} {
+
+		if res, err := ToTime(v); err != nil || !res.Equal(expected) {
+			t.Error("Unexpected result:", v, res, err)
+			return
+		}
+	}
+
+	if res, err := ToTime("2016-03-04"); err == nil || err.Error() != "Value 2016-03-04 is not a RFC3339 timestamp" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	var nilTime *time.Time
+
+	if res, err := ToTime(nilTime); err == nil || err.Error() != "Value <nil> of type *time.Time is not a time" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := ToTime(1457086830); err == nil || err.Error() != "Value 1457086830 of type int is not a time" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+}
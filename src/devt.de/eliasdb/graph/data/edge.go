@@ -77,6 +77,12 @@ type Edge interface {
 	*/
 	End2IsCascading() bool
 
+	/*
+		IsUndirected returns if this edge is undirected. An undirected edge can
+		be traversed with its roles in either order from both ends.
+	*/
+	IsUndirected() bool
+
 	/*
 		Spec returns the spec for this edge from the view of a specified endpoint.
 		A spec is always of the form: <End Role>:<Kind>:<End Role>:<Other node kind>
@@ -136,6 +142,11 @@ EdgeEnd2Cascading is the flag to cascade delete operations from the second end
 */
 const EdgeEnd2Cascading = "end2cascading"
 
+/*
+EdgeUndirected is the optional flag to mark an edge as undirected
+*/
+const EdgeUndirected = "undirected"
+
 /*
 graphEdge data structure.
 */
@@ -218,6 +229,15 @@ func (ge *graphEdge) End2IsCascading() bool {
 	return ge.Attr(EdgeEnd2Cascading).(bool)
 }
 
+/*
+IsUndirected returns if this edge is undirected. An undirected edge can be
+traversed with its roles in either order from both ends.
+*/
+func (ge *graphEdge) IsUndirected() bool {
+	undirected, _ := ge.Attr(EdgeUndirected).(bool)
+	return undirected
+}
+
 /*
 Spec returns the spec for this edge from the view of a specified endpoint.
 A spec is always of the form: <End Role>:<Kind>:<End Role>:<Other node kind>
@@ -266,7 +286,7 @@ func (ge *graphEdge) IndexMap() map[string]string {
 		return attr == NodeKey || attr == NodeKind || attr == EdgeEnd1Key ||
 			attr == EdgeEnd1Kind || attr == EdgeEnd1Role || attr == EdgeEnd1Cascading ||
 			attr == EdgeEnd2Key || attr == EdgeEnd2Kind || attr == EdgeEnd2Role ||
-			attr == EdgeEnd2Cascading
+			attr == EdgeEnd2Cascading || attr == EdgeUndirected
 	})
 }
 
@@ -111,6 +111,20 @@ func TestGraphEdge(t *testing.T) {
 		return
 	}
 
+	if ge.IsUndirected() {
+		t.Error("Unexpected result")
+		return
+	}
+
+	ge.SetAttr(EdgeUndirected, true)
+
+	if !ge.IsUndirected() || fmt.Sprint(ge.IndexMap()) != "map[name:test]" {
+		t.Error("Unexpected result")
+		return
+	}
+
+	ge.SetAttr(EdgeUndirected, nil)
+
 	gn := NewGraphNode()
 	gn.(*graphNode).data = ge.Data()
 
@@ -0,0 +1,219 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+)
+
+/*
+JSONReservedAttrs is the attribute which holds the reserved attributes of a
+node or edge in the nested JSON representation.
+*/
+const JSONReservedAttrs = "_reserved"
+
+/*
+JSONOptions controls the JSON representation of nodes and edges.
+*/
+type JSONOptions struct {
+	TimeFormat     string // Layout of time values - time values are always written in UTC
+	OmitEmpty      bool   // Flag if empty attributes (nil, empty strings, lists and maps) are omitted
+	NestedReserved bool   // Flag if reserved attributes (key, kind and edge ends) are nested
+}
+
+/*
+DefaultJSONOptions are the options which are used when nodes or edges are
+marshalled with the encoding/json package.
+*/
+var DefaultJSONOptions = &JSONOptions{time.RFC3339Nano, false, false}
+
+/*
+MarshalNodeJSON returns the JSON representation of a node or an edge using
+given options. Attributes are always written in sorted order so identical
+data produces identical output. DefaultJSONOptions are used if no options
+are given.
+*/
+func MarshalNodeJSON(node Node, opts *JSONOptions) ([]byte, error) {
+
+	if opts == nil {
+		opts = DefaultJSONOptions
+	}
+
+	var attrs, reserved []string
+
+	for attr, val := range node.Data() {
+		if opts.OmitEmpty && isEmptyJSONValue(val) {
+			continue
+		} else if opts.NestedReserved && isReservedAttr(attr) {
+			reserved = append(reserved, attr)
+		} else {
+			attrs = append(attrs, attr)
+		}
+	}
+
+	sort.Strings(attrs)
+	sort.Strings(reserved)
+
+	var buf bytes.Buffer
+
+	writeAttr := func(attr string, val interface{}) error {
+
+		if buf.Len() > 1 && buf.Bytes()[buf.Len()-1] != '{' {
+			buf.WriteByte(',')
+		}
+
+		jattr, err := json.Marshal(attr)
+		if err == nil {
+			var jval []byte
+
+			if jval, err = json.Marshal(jsonValue(val, opts)); err == nil {
+				buf.Write(jattr)
+				buf.WriteByte(':')
+				buf.Write(jval)
+			}
+		}
+
+		return err
+	}
+
+	buf.WriteByte('{')
+
+	if len(reserved) > 0 {
+
+		buf.WriteString(`"` + JSONReservedAttrs + `":{`)
+
+		for _, attr := range reserved {
+			if err := writeAttr(attr, node.Attr(attr)); err != nil {
+				return nil, err
+			}
+		}
+
+		buf.WriteByte('}')
+	}
+
+	for _, attr := range attrs {
+		if err := writeAttr(attr, node.Attr(attr)); err != nil {
+			return nil, err
+		}
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+/*
+MarshalJSON returns the JSON representation of this node using
+DefaultJSONOptions.
+*/
+func (gn *graphNode) MarshalJSON() ([]byte, error) {
+	return MarshalNodeJSON(gn, DefaultJSONOptions)
+}
+
+/*
+UnmarshalJSON reads the JSON representation of a node. Reserved attributes
+can either be top-level or nested.
+*/
+func (gn *graphNode) UnmarshalJSON(b []byte) error {
+	var data map[string]interface{}
+
+	if err := json.Unmarshal(b, &data); err != nil {
+		return err
+	}
+
+	gn.data = NewGraphNodeFromJSONMap(data).Data()
+
+	return nil
+}
+
+/*
+NewGraphNodeFromJSONMap creates a new Node instance from a decoded JSON object.
+Reserved attributes can either be top-level or nested.
+*/
+func NewGraphNodeFromJSONMap(data map[string]interface{}) Node {
+
+	if reserved, ok := data[JSONReservedAttrs].(map[string]interface{}); ok {
+		delete(data, JSONReservedAttrs)
+
+		for attr, val := range reserved {
+			data[attr] = val
+		}
+	}
+
+	return NewGraphNodeFromMap(data)
+}
+
+/*
+jsonValue converts an attribute value for the JSON representation.
+*/
+func jsonValue(val interface{}, opts *JSONOptions) interface{} {
+
+	switch v := val.(type) {
+
+	case time.Time:
+		return v.UTC().Format(opts.TimeFormat)
+
+	case *time.Time:
+		if v != nil {
+			return v.UTC().Format(opts.TimeFormat)
+		}
+
+	case []interface{}:
+		ret := make([]interface{}, len(v))
+		for i, e := range v {
+			ret[i] = jsonValue(e, opts)
+		}
+		return ret
+
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			ret[k] = jsonValue(e, opts)
+		}
+		return ret
+	}
+
+	return val
+}
+
+/*
+isEmptyJSONValue checks if a given attribute value is empty.
+*/
+func isEmptyJSONValue(val interface{}) bool {
+
+	if val == nil {
+		return true
+	}
+
+	switch v := reflect.ValueOf(val); v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	case reflect.Ptr:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+/*
+isReservedAttr checks if a given attribute is a reserved attribute of nodes
+or edges.
+*/
+func isReservedAttr(attr string) bool {
+	return attr == NodeKey || attr == NodeKind || attr == EdgeEnd1Key ||
+		attr == EdgeEnd1Kind || attr == EdgeEnd1Role || attr == EdgeEnd1Cascading ||
+		attr == EdgeEnd2Key || attr == EdgeEnd2Kind || attr == EdgeEnd2Role ||
+		attr == EdgeEnd2Cascading || attr == EdgeUndirected
+}
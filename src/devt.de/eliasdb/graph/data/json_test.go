@@ -0,0 +1,116 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package data
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestMarshalNodeJSON(t *testing.T) {
+
+	loc := time.FixedZone("test", 3600)
+	ts := time.Date(2016, 1, 2, 3, 4, 5, 0, loc)
+
+	node := NewGraphNode()
+	node.SetAttr("name", "test")
+	node.SetAttr("kind", "Song")
+	node.SetAttr("key", "123")
+	node.SetAttr("empty", "")
+	node.SetAttr("created", ts)
+	node.SetAttr("list", []interface{}{ts, 1})
+	node.SetAttr("nothing", []interface{}{})
+
+	res, err := json.Marshal(node)
+	if err != nil || string(res) != `{"created":"2016-01-02T02:04:05Z","empty":"","key":"123",`+
+		`"kind":"Song","list":["2016-01-02T02:04:05Z",1],"name":"test","nothing":[]}` {
+		t.Error("Unexpected result:", string(res), err)
+		return
+	}
+
+	res, err = MarshalNodeJSON(node, &JSONOptions{"2006-01-02", true, true})
+	if err != nil || string(res) != `{"_reserved":{"key":"123","kind":"Song"},`+
+		`"created":"2016-01-02","list":["2016-01-02",1],"name":"test"}` {
+		t.Error("Unexpected result:", string(res), err)
+		return
+	}
+
+	// Both shapes can be read back
+
+	for _, shape := range []string{`{"key":"123","kind":"Song","name":"test"}`,
+		`{"_reserved":{"key":"123","kind":"Song"},"name":"test"}`} {
+
+		node2 := NewGraphNode()
+
+		if err := json.Unmarshal([]byte(shape), node2); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if node2.Key() != "123" || node2.Kind() != "Song" || node2.Attr("name") != "test" ||
+			node2.Attr(JSONReservedAttrs) != nil {
+			t.Error("Unexpected result:", node2)
+			return
+		}
+	}
+
+	if err := json.Unmarshal([]byte("{"), NewGraphNode()); err == nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Edges put their ends into the reserved attributes
+
+	edge := NewGraphEdge()
+	edge.SetAttr("key", "abc")
+	edge.SetAttr("kind", "Link")
+	edge.SetAttr(EdgeEnd1Key, "123")
+	edge.SetAttr(EdgeEnd1Kind, "Song")
+	edge.SetAttr(EdgeEnd1Role, "Song")
+	edge.SetAttr(EdgeEnd1Cascading, true)
+	edge.SetAttr(EdgeEnd2Key, "456")
+	edge.SetAttr(EdgeEnd2Kind, "Author")
+	edge.SetAttr(EdgeEnd2Role, "Author")
+	edge.SetAttr(EdgeEnd2Cascading, false)
+	edge.SetAttr("weight", 5)
+
+	res, err = MarshalNodeJSON(edge, &JSONOptions{time.RFC3339, false, true})
+	if err != nil || string(res) != `{"_reserved":{"end1cascading":true,"end1key":"123",`+
+		`"end1kind":"Song","end1role":"Song","end2cascading":false,"end2key":"456",`+
+		`"end2kind":"Author","end2role":"Author","key":"abc","kind":"Link"},"weight":5}` {
+		t.Error("Unexpected result:", string(res), err)
+		return
+	}
+
+	var m map[string]interface{}
+	json.Unmarshal(res, &m)
+
+	edge2 := NewGraphEdgeFromNode(NewGraphNodeFromJSONMap(m))
+
+	if edge2.End1Key() != "123" || edge2.End2Kind() != "Author" || !edge2.End1IsCascading() {
+		t.Error("Unexpected result:", edge2)
+		return
+	}
+
+	// Default options are used if no options are given
+
+	if res, err := MarshalNodeJSON(NewGraphNode(), nil); err != nil || string(res) != "{}" {
+		t.Error("Unexpected result:", string(res), err)
+		return
+	}
+
+	if _, err := MarshalNodeJSON(NewGraphNodeFromMap(map[string]interface{}{
+		"foo": make(chan int)}), nil); err == nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
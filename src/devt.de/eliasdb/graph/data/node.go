@@ -15,6 +15,7 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"time"
 )
 
 /*
@@ -47,6 +48,31 @@ type Node interface {
 	*/
 	Attr(attr string) interface{}
 
+	/*
+		StringAttr returns an attribute of this node as a string (see ToString).
+	*/
+	StringAttr(attr string) (string, error)
+
+	/*
+		Int64Attr returns an attribute of this node as an int64 (see ToInt64).
+	*/
+	Int64Attr(attr string) (int64, error)
+
+	/*
+		Float64Attr returns an attribute of this node as a float64 (see ToFloat64).
+	*/
+	Float64Attr(attr string) (float64, error)
+
+	/*
+		BoolAttr returns an attribute of this node as a bool (see ToBool).
+	*/
+	BoolAttr(attr string) (bool, error)
+
+	/*
+		TimeAttr returns an attribute of this node as a time.Time (see ToTime).
+	*/
+	TimeAttr(attr string) (time.Time, error)
+
 	/*
 		SetAttr sets an attribute of this node. Setting a nil
 		value removes the attribute.
@@ -137,6 +163,102 @@ func (gn *graphNode) Attr(attr string) interface{} {
 	return val
 }
 
+/*
+StringAttr returns an attribute of this node as a string. Returns an
+AttrError of type ErrAttrMissing if the attribute does not exist or of type
+ErrAttrConversion if the value cannot be converted.
+*/
+func (gn *graphNode) StringAttr(attr string) (string, error) {
+	var ret string
+
+	err := gn.convertAttr(attr, func(val interface{}) (err error) {
+		ret, err = ToString(val)
+		return
+	})
+
+	return ret, err
+}
+
+/*
+Int64Attr returns an attribute of this node as an int64. Returns an
+AttrError of type ErrAttrMissing if the attribute does not exist or of type
+ErrAttrConversion if the value cannot be converted.
+*/
+func (gn *graphNode) Int64Attr(attr string) (int64, error) {
+	var ret int64
+
+	err := gn.convertAttr(attr, func(val interface{}) (err error) {
+		ret, err = ToInt64(val)
+		return
+	})
+
+	return ret, err
+}
+
+/*
+Float64Attr returns an attribute of this node as a float64. Returns an
+AttrError of type ErrAttrMissing if the attribute does not exist or of type
+ErrAttrConversion if the value cannot be converted.
+*/
+func (gn *graphNode) Float64Attr(attr string) (float64, error) {
+	var ret float64
+
+	err := gn.convertAttr(attr, func(val interface{}) (err error) {
+		ret, err = ToFloat64(val)
+		return
+	})
+
+	return ret, err
+}
+
+/*
+BoolAttr returns an attribute of this node as a bool. Returns an AttrError
+of type ErrAttrMissing if the attribute does not exist or of type
+ErrAttrConversion if the value cannot be converted.
+*/
+func (gn *graphNode) BoolAttr(attr string) (bool, error) {
+	var ret bool
+
+	err := gn.convertAttr(attr, func(val interface{}) (err error) {
+		ret, err = ToBool(val)
+		return
+	})
+
+	return ret, err
+}
+
+/*
+TimeAttr returns an attribute of this node as a time.Time. Returns an
+AttrError of type ErrAttrMissing if the attribute does not exist or of type
+ErrAttrConversion if the value cannot be converted.
+*/
+func (gn *graphNode) TimeAttr(attr string) (time.Time, error) {
+	var ret time.Time
+
+	err := gn.convertAttr(attr, func(val interface{}) (err error) {
+		ret, err = ToTime(val)
+		return
+	})
+
+	return ret, err
+}
+
+/*
+convertAttr calls a given conversion function with the value of an attribute.
+*/
+func (gn *graphNode) convertAttr(attr string, convert func(val interface{}) error) error {
+	val, ok := gn.data[attr]
+	if !ok {
+		return &AttrError{ErrAttrMissing, attr, ""}
+	}
+
+	if err := convert(val); err != nil {
+		return &AttrError{ErrAttrConversion, attr, err.Error()}
+	}
+
+	return nil
+}
+
 /*
 SetAttr sets an attribute of this node. Setting a nil
 value removes the attribute.
@@ -115,3 +115,72 @@ func TestGraphNode(t *testing.T) {
 		return
 	}
 }
+
+func TestGraphNodeTypedAttrs(t *testing.T) {
+	gn := NewGraphNodeFromMap(map[string]interface{}{
+		"key":     "123",
+		"count":   float64(42),
+		"price":   "1.5",
+		"active":  "true",
+		"created": "2016-03-04T10:20:30Z",
+		"name":    []byte("foo"),
+	})
+
+	if res, err := gn.Int64Attr("count"); err != nil || res != 42 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gn.Int64Attr("key"); err != nil || res != 123 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gn.Float64Attr("price"); err != nil || res != 1.5 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gn.BoolAttr("active"); err != nil || !res {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gn.TimeAttr("created"); err != nil || res.Year() != 2016 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gn.StringAttr("name"); err != nil || res != "foo" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Conversion errors can be distinguished from missing attributes
+
+	if res, err := gn.Int64Attr("price"); err == nil || err.(*AttrError).Type != ErrAttrConversion ||
+		err.Error() != "Could not convert attribute value: price (Value 1.5 is not an integer)" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gn.Int64Attr("foo"); err == nil || err.(*AttrError).Type != ErrAttrMissing ||
+		err.Error() != "Missing attribute: foo" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Edges have the same accessors
+
+	ge := NewGraphEdgeFromNode(gn)
+
+	if res, err := ge.Int64Attr("count"); err != nil || res != 42 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := ge.TimeAttr("name"); err == nil || err.(*AttrError).Type != ErrAttrConversion {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
@@ -0,0 +1,409 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/*
+StructTag is the struct tag which controls the mapping between struct fields
+and node attributes. The tag has the form:
+
+	`eliasdb:"<attr name>,<option>,..."`
+
+If no attribute name is given then the field name is used. Fields with the
+name "-" are ignored. Supported options are:
+
+	omitempty - The attribute is not set if the field has its zero value.
+	flatten   - The fields of a nested struct are stored as separate attributes.
+	            The attribute name of the field is used as prefix.
+	key, kind - The field holds the key or kind of the node.
+	end1key, end1kind, end1role, end1cascading,
+	end2key, end2kind, end2role, end2cascading - The field holds an edge end.
+	undirected - The field holds the flag if the edge is undirected.
+
+Nested structs which are not flattened are stored as JSON encoded strings.
+Embedded structs are always flattened without a prefix.
+*/
+const StructTag = "eliasdb"
+
+/*
+reservedTagOptions maps tag options to reserved attributes.
+*/
+var reservedTagOptions = map[string]string{
+	"key":           NodeKey,
+	"kind":          NodeKind,
+	"end1key":       EdgeEnd1Key,
+	"end1kind":      EdgeEnd1Kind,
+	"end1role":      EdgeEnd1Role,
+	"end1cascading": EdgeEnd1Cascading,
+	"end2key":       EdgeEnd2Key,
+	"end2kind":      EdgeEnd2Kind,
+	"end2role":      EdgeEnd2Role,
+	"end2cascading": EdgeEnd2Cascading,
+	"undirected":    EdgeUndirected,
+}
+
+/*
+timeType is the reflection type of time.Time.
+*/
+var timeType = reflect.TypeOf(time.Time{})
+
+/*
+structField models a mapped struct field.
+*/
+type structField struct {
+	index     int    // Index of the field in the struct
+	attr      string // Attribute name (or prefix for flattened structs)
+	omitEmpty bool   // Flag if the attribute is omitted for zero values
+	flatten   bool   // Flag if a nested struct is flattened
+}
+
+/*
+structFields returns all mapped fields of a given struct type.
+*/
+func structFields(t reflect.Type) []*structField {
+	var ret []*structField
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if f.PkgPath != "" && !(f.Anonymous && f.Type.Kind() == reflect.Struct) {
+			continue // Unexported field
+		}
+
+		tag := strings.Split(f.Tag.Get(StructTag), ",")
+		sf := &structField{i, tag[0], false, false}
+
+		if sf.attr == "-" {
+			continue
+		} else if sf.attr == "" && f.Anonymous && f.Type.Kind() == reflect.Struct {
+			sf.flatten = true
+		} else if sf.attr == "" {
+			sf.attr = f.Name
+		}
+
+		for _, opt := range tag[1:] {
+			if attr, ok := reservedTagOptions[opt]; ok {
+				sf.attr = attr
+			} else if opt == "omitempty" {
+				sf.omitEmpty = true
+			} else if opt == "flatten" {
+				sf.flatten = true
+			}
+		}
+
+		ret = append(ret, sf)
+	}
+
+	return ret
+}
+
+/*
+NodeFromStruct creates a new node from a given struct or pointer to a struct.
+The mapping between struct fields and node attributes is controlled by struct
+tags (see StructTag).
+*/
+func NodeFromStruct(v interface{}) (Node, error) {
+
+	rv := reflect.Indirect(reflect.ValueOf(v))
+
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("Value of type %T is not a struct", v)
+	}
+
+	node := NewGraphNode()
+
+	if err := structToAttrs(rv, "", node); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
+
+/*
+EdgeFromStruct creates a new edge from a given struct or pointer to a struct.
+The mapping between struct fields and edge attributes is controlled by struct
+tags (see StructTag).
+*/
+func EdgeFromStruct(v interface{}) (Edge, error) {
+
+	node, err := NodeFromStruct(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewGraphEdgeFromNode(node), nil
+}
+
+/*
+structToAttrs writes all mapped fields of a given struct value as attributes
+into a given node.
+*/
+func structToAttrs(rv reflect.Value, prefix string, node Node) error {
+
+	for _, sf := range structFields(rv.Type()) {
+		fv := rv.Field(sf.index)
+		attr := prefix + sf.attr
+
+		if sf.omitEmpty && fv.IsZero() {
+			continue
+		}
+
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+
+		if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+
+			if sf.flatten {
+				if err := structToAttrs(fv, attr, node); err != nil {
+					return err
+				}
+				continue
+			}
+
+			res, err := json.Marshal(fv.Interface())
+			if err != nil {
+				return &AttrError{ErrAttrConversion, attr, err.Error()}
+			}
+
+			node.SetAttr(attr, string(res))
+
+			continue
+		}
+
+		node.SetAttr(attr, fv.Interface())
+	}
+
+	return nil
+}
+
+/*
+NodeToStruct writes the attributes of a given node into a given pointer to a
+struct. The mapping between node attributes and struct fields is controlled
+by struct tags (see StructTag). Fields of missing attributes are not changed.
+*/
+func NodeToStruct(n Node, v interface{}) error {
+
+	rv := reflect.ValueOf(v)
+
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Value of type %T is not a pointer to a struct", v)
+	}
+
+	_, err := attrsToStruct(n, "", rv.Elem())
+
+	return err
+}
+
+/*
+EdgeToStruct writes the attributes of a given edge into a given pointer to a
+struct. The mapping between edge attributes and struct fields is controlled
+by struct tags (see StructTag).
+*/
+func EdgeToStruct(e Edge, v interface{}) error {
+	return NodeToStruct(e, v)
+}
+
+/*
+attrsToStruct writes the attributes of a given node into all mapped fields of
+a given struct value. Returns if any field was set.
+*/
+func attrsToStruct(n Node, prefix string, rv reflect.Value) (bool, error) {
+	var set bool
+
+	for _, sf := range structFields(rv.Type()) {
+		fv := rv.Field(sf.index)
+		attr := prefix + sf.attr
+
+		if sf.flatten {
+
+			if fv.Kind() != reflect.Ptr {
+				fset, err := attrsToStruct(n, attr, fv)
+				if err != nil {
+					return false, err
+				}
+				set = set || fset
+				continue
+			}
+
+			// Only allocate nested structs if an attribute was found
+
+			pv := fv
+			if pv.IsNil() {
+				pv = reflect.New(fv.Type().Elem())
+			}
+
+			fset, err := attrsToStruct(n, attr, pv.Elem())
+			if err != nil {
+				return false, err
+			} else if fset {
+				fv.Set(pv)
+				set = true
+			}
+
+			continue
+		}
+
+		val := n.Attr(attr)
+
+		if val == nil {
+			continue
+		}
+
+		if err := setFieldValue(fv, val); err != nil {
+			return false, &AttrError{ErrAttrConversion, attr, err.Error()}
+		}
+
+		set = true
+	}
+
+	return set, nil
+}
+
+/*
+AssignValue converts a given attribute value to the type of a given settable
+value and assigns it. The conversions are the same as for the typed attribute
+accessors of nodes (e.g. Int64Attr). A nil value is not assigned.
+*/
+func AssignValue(v reflect.Value, val interface{}) error {
+	return setFieldValue(v, val)
+}
+
+/*
+setFieldValue sets a given attribute value to a given struct field. The value
+is converted to the type of the field.
+*/
+func setFieldValue(fv reflect.Value, val interface{}) error {
+
+	if val == nil {
+		return nil
+	}
+
+	switch fv.Kind() {
+
+	case reflect.Ptr:
+		pv := reflect.New(fv.Type().Elem())
+		if err := setFieldValue(pv.Elem(), val); err != nil {
+			return err
+		}
+		fv.Set(pv)
+
+	case reflect.String:
+		s, err := ToString(val)
+		if err != nil {
+			return err
+		}
+		fv.SetString(s)
+
+	case reflect.Bool:
+		b, err := ToBool(val)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := ToInt64(val)
+		if err != nil {
+			return err
+		} else if fv.OverflowInt(i) {
+			return fmt.Errorf("Value %v is out of range", i)
+		}
+		fv.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if u, ok := val.(uint64); ok {
+			fv.SetUint(u)
+			break
+		}
+		i, err := ToInt64(val)
+		if err != nil {
+			return err
+		} else if i < 0 || fv.OverflowUint(uint64(i)) {
+			return fmt.Errorf("Value %v is out of range", i)
+		}
+		fv.SetUint(uint64(i))
+
+	case reflect.Float32, reflect.Float64:
+		f, err := ToFloat64(val)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+
+	case reflect.Slice:
+		return setSliceValue(fv, val)
+
+	case reflect.Struct:
+		if fv.Type() == timeType {
+			t, err := ToTime(val)
+			if err != nil {
+				return err
+			}
+			fv.Set(reflect.ValueOf(t))
+			break
+		}
+
+		s, ok := val.(string)
+		if !ok {
+			return fmt.Errorf("Value of type %T is not a JSON string", val)
+		}
+		return json.Unmarshal([]byte(s), fv.Addr().Interface())
+
+	default:
+		vv := reflect.ValueOf(val)
+		if !vv.Type().AssignableTo(fv.Type()) {
+			return fmt.Errorf("Value of type %T cannot be assigned to %v", val, fv.Type())
+		}
+		fv.Set(vv)
+	}
+
+	return nil
+}
+
+/*
+setSliceValue sets a given list attribute value to a given slice field. All
+elements are converted to the element type of the slice.
+*/
+func setSliceValue(fv reflect.Value, val interface{}) error {
+
+	if s, ok := val.(string); ok && fv.Type().Elem().Kind() == reflect.Uint8 {
+		val = []byte(s)
+	}
+
+	vv := reflect.ValueOf(val)
+
+	if vv.Kind() != reflect.Slice && vv.Kind() != reflect.Array {
+		return fmt.Errorf("Value of type %T is not a list", val)
+	}
+
+	sv := reflect.MakeSlice(fv.Type(), vv.Len(), vv.Len())
+
+	for i := 0; i < vv.Len(); i++ {
+		if err := setFieldValue(sv.Index(i), vv.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+
+	fv.Set(sv)
+
+	return nil
+}
@@ -0,0 +1,268 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testAddress struct {
+	Street string `json:"street"`
+	City   string `eliasdb:"city" json:"city"`
+}
+
+type testBase struct {
+	Created time.Time `eliasdb:"created"`
+}
+
+type testSong struct {
+	testBase
+	ID       string       `eliasdb:",key"`
+	Kind     string       `eliasdb:",kind"`
+	Name     string       `eliasdb:"name"`
+	Track    int          `eliasdb:"track"`
+	Small    int8         `eliasdb:"small"`
+	Big      int64        `eliasdb:"big"`
+	Count    uint16       `eliasdb:"count"`
+	Huge     uint64       `eliasdb:"huge"`
+	Ratio    float32      `eliasdb:"ratio"`
+	Score    float64      `eliasdb:"score"`
+	Active   bool         `eliasdb:"active"`
+	Tags     []string     `eliasdb:"tags"`
+	Ranks    []int        `eliasdb:"ranks"`
+	Plays    []time.Time  `eliasdb:"plays"`
+	Raw      []byte       `eliasdb:"raw"`
+	Comment  string       `eliasdb:"comment,omitempty"`
+	Rating   *float64     `eliasdb:"rating"`
+	Address  testAddress  `eliasdb:"address"`
+	Location testAddress  `eliasdb:"loc_,flatten"`
+	Previous *testAddress `eliasdb:"prev_,flatten"`
+	Ignored  string       `eliasdb:"-"`
+	Untagged string
+	private  string
+}
+
+type testLink struct {
+	Key         string `eliasdb:",key"`
+	Kind        string `eliasdb:",kind"`
+	From        string `eliasdb:",end1key"`
+	FromKind    string `eliasdb:",end1kind"`
+	FromRole    string `eliasdb:",end1role"`
+	FromCascade bool   `eliasdb:",end1cascading"`
+	To          string `eliasdb:",end2key"`
+	ToKind      string `eliasdb:",end2kind"`
+	ToRole      string `eliasdb:",end2role"`
+	ToCascade   bool   `eliasdb:",end2cascading"`
+	Weight      int    `eliasdb:"weight"`
+}
+
+func TestNodeStructMapping(t *testing.T) {
+
+	rating := 4.5
+	ts := time.Date(2016, 1, 2, 3, 4, 5, 6, time.UTC)
+
+	song := &testSong{
+		testBase: testBase{ts},
+		ID:       "123",
+		Kind:     "Song",
+		Name:     "Aria",
+		Track:    -3,
+		Small:    -8,
+		Big:      1 << 40,
+		Count:    65535,
+		Huge:     1<<64 - 1,
+		Ratio:    0.5,
+		Score:    1.25,
+		Active:   true,
+		Tags:     []string{"a", "b"},
+		Ranks:    []int{1, 2, 3},
+		Plays:    []time.Time{ts, ts.Add(time.Hour)},
+		Raw:      []byte("raw"),
+		Rating:   &rating,
+		Address:  testAddress{"Main St", "Springfield"},
+		Location: testAddress{"Elm St", "Shelbyville"},
+		Ignored:  "ignored",
+		Untagged: "untagged",
+		private:  "private",
+	}
+
+	node, err := NodeFromStruct(song)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if node.Key() != "123" || node.Kind() != "Song" {
+		t.Error("Unexpected result:", node)
+		return
+	}
+
+	if res := fmt.Sprint(node.Attr("address")); res != `{"street":"Main St","city":"Springfield"}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if node.Attr("loc_Street") != "Elm St" || node.Attr("loc_city") != "Shelbyville" ||
+		node.Attr("created") != ts || node.Attr("Untagged") != "untagged" || node.Attr("rating") != 4.5 {
+		t.Error("Unexpected result:", node)
+		return
+	}
+
+	for _, attr := range []string{"comment", "Ignored", "-", "private", "prev_Street", "testBase"} {
+		if _, ok := node.Data()[attr]; ok {
+			t.Error("Unexpected attribute:", attr)
+			return
+		}
+	}
+
+	// Round trip directly and through JSON
+
+	var song2 testSong
+
+	if err := NodeToStruct(node, &song2); err != nil {
+		t.Error(err)
+		return
+	}
+
+	song.Ignored = ""
+	song.private = ""
+
+	if !reflect.DeepEqual(song, &song2) {
+		t.Error("Unexpected result:", song2)
+		return
+	}
+
+	// Large numbers are decoded as float64 by JSON
+
+	song.Huge = 1 << 53
+	node.SetAttr("huge", song.Huge)
+
+	res, _ := json.Marshal(node)
+	node3 := NewGraphNode()
+	json.Unmarshal(res, node3)
+
+	var song3 testSong
+
+	if err := NodeToStruct(node3, &song3); err != nil {
+		t.Error(err)
+		return
+	}
+
+	song.Raw = nil // Byte slices are written as base64 strings by JSON
+	song3.Raw = nil
+
+	if !reflect.DeepEqual(song, &song3) {
+		t.Errorf("Unexpected result:\n%#v\n%#v", song, song3)
+		return
+	}
+
+	// Missing attributes do not change fields
+
+	song4 := testSong{Name: "foo"}
+
+	if err := NodeToStruct(NewGraphNode(), &song4); err != nil || song4.Name != "foo" ||
+		song4.Previous != nil {
+		t.Error("Unexpected result:", song4, err)
+		return
+	}
+
+	// Test error cases
+
+	if _, err := NodeFromStruct("foo"); err == nil || err.Error() != "Value of type string is not a struct" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := NodeToStruct(node, song2); err == nil ||
+		err.Error() != "Value of type data.testSong is not a pointer to a struct" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	for attr, val := range map[string]interface{}{
+		"track":   "foo",
+		"small":   1000,
+		"count":   -1,
+		"name":    []int{1},
+		"active":  "maybe",
+		"ratio":   "x",
+		"created": "yesterday",
+		"tags":    5,
+		"ranks":   []interface{}{"a"},
+		"address": 5,
+	} {
+		errNode := NewGraphNode()
+		errNode.SetAttr(attr, val)
+
+		err := NodeToStruct(errNode, &song2)
+		if ae, ok := err.(*AttrError); !ok || ae.Type != ErrAttrConversion || ae.Attr != attr {
+			t.Error("Unexpected result:", attr, err)
+			return
+		}
+	}
+
+	type testMap struct {
+		Data map[string]int `eliasdb:"data"`
+		Func func()         `eliasdb:"func"`
+	}
+
+	errNode := NewGraphNode()
+	errNode.SetAttr("data", "foo")
+
+	if err := NodeToStruct(errNode, &testMap{}); err == nil || err.Error() !=
+		"Could not convert attribute value: data (Value of type string cannot be assigned to map[string]int)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	type testChan struct {
+		Nested struct{ C chan int } `eliasdb:"nested"`
+	}
+
+	if _, err := NodeFromStruct(testChan{}); err == nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestEdgeStructMapping(t *testing.T) {
+
+	link := &testLink{"e1", "Link", "123", "Song", "song", true, "456", "Author", "author", false, 3}
+
+	edge, err := EdgeFromStruct(link)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if edge.End1Key() != "123" || edge.End1Kind() != "Song" || edge.End1Role() != "song" ||
+		!edge.End1IsCascading() || edge.End2Key() != "456" || edge.End2Kind() != "Author" ||
+		edge.End2Role() != "author" || edge.End2IsCascading() || edge.Attr("weight") != 3 {
+		t.Error("Unexpected result:", edge)
+		return
+	}
+
+	var link2 testLink
+
+	if err := EdgeToStruct(edge, &link2); err != nil || !reflect.DeepEqual(link, &link2) {
+		t.Error("Unexpected result:", link2, err)
+		return
+	}
+
+	if _, err := EdgeFromStruct(5); err == nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
@@ -10,7 +10,19 @@
 
 package data
 
-import "devt.de/common/datautil"
+import (
+	"reflect"
+	"sort"
+
+	"devt.de/common/datautil"
+)
+
+/*
+CompareNumbersByValue controls if NodeCompareDetailed and EdgeCompareDetailed
+consider numbers of different types with the same value as equal (e.g. int 5
+and float64 5). Numbers of different types are different by default.
+*/
+var CompareNumbersByValue = false
 
 /*
 NodeCompare compares node attributes.
@@ -38,6 +50,129 @@ func NodeCompare(node1 Node, node2 Node, attrs []string) bool {
 	return true
 }
 
+/*
+NodeCompareDetailed compares all attributes of two nodes except the
+attributes in a given ignore list. Attribute values are compared with deep
+equality - slices and maps are compared element by element. Returns if the
+nodes are equal and the sorted names of all differing attributes. An
+attribute which only exists in one node is differing.
+*/
+func NodeCompareDetailed(node1 Node, node2 Node, ignore []string) (bool, []string) {
+	var differing []string
+
+	ignored := make(map[string]bool, len(ignore))
+	for _, attr := range ignore {
+		ignored[attr] = true
+	}
+
+	data1, data2 := node1.Data(), node2.Data()
+
+	for attr, val1 := range data1 {
+		if ignored[attr] {
+			continue
+		}
+
+		if val2, ok := data2[attr]; !ok || !valuesEqual(val1, val2) {
+			differing = append(differing, attr)
+		}
+	}
+
+	for attr := range data2 {
+		if _, ok := data1[attr]; !ok && !ignored[attr] {
+			differing = append(differing, attr)
+		}
+	}
+
+	sort.Strings(differing)
+
+	return len(differing) == 0, differing
+}
+
+/*
+EdgeCompareDetailed compares all attributes of two edges except the
+attributes in a given ignore list (see NodeCompareDetailed). The end
+attributes of the edges are compared like all other attributes.
+*/
+func EdgeCompareDetailed(edge1 Edge, edge2 Edge, ignore []string) (bool, []string) {
+	return NodeCompareDetailed(edge1, edge2, ignore)
+}
+
+/*
+valuesEqual compares two attribute values with deep equality.
+*/
+func valuesEqual(val1 interface{}, val2 interface{}) bool {
+
+	if !CompareNumbersByValue {
+		return reflect.DeepEqual(val1, val2)
+	}
+
+	if isNumber(val1) && isNumber(val2) {
+
+		// Compare integers exactly if possible
+
+		if i1, err := ToInt64(val1); err == nil {
+			if i2, err := ToInt64(val2); err == nil {
+				return i1 == i2
+			}
+		}
+
+		f1, _ := ToFloat64(val1)
+		f2, _ := ToFloat64(val2)
+
+		return f1 == f2
+	}
+
+	// Compare the elements of slices and maps
+
+	v1, v2 := reflect.ValueOf(val1), reflect.ValueOf(val2)
+
+	if v1.Kind() == reflect.Slice && v2.Kind() == reflect.Slice {
+
+		if v1.Len() != v2.Len() {
+			return false
+		}
+
+		for i := 0; i < v1.Len(); i++ {
+			if !valuesEqual(v1.Index(i).Interface(), v2.Index(i).Interface()) {
+				return false
+			}
+		}
+
+		return true
+
+	} else if v1.Kind() == reflect.Map && v2.Kind() == reflect.Map {
+
+		if v1.Len() != v2.Len() || v1.Type().Key() != v2.Type().Key() {
+			return false
+		}
+
+		for _, k := range v1.MapKeys() {
+			e2 := v2.MapIndex(k)
+
+			if !e2.IsValid() || !valuesEqual(v1.MapIndex(k).Interface(), e2.Interface()) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return reflect.DeepEqual(val1, val2)
+}
+
+/*
+isNumber checks if a given value is of a number type.
+*/
+func isNumber(val interface{}) bool {
+
+	switch val.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return true
+	}
+
+	return false
+}
+
 /*
 NodeClone clones a node.
 */
@@ -61,3 +196,40 @@ func NodeMerge(node1 Node, node2 Node) Node {
 	}
 	return &graphNode{data}
 }
+
+/*
+NodeMergePatch applies a JSON merge patch (RFC 7386) to a node and returns the
+result in a new node. Attributes with a nil value are removed, object values
+are patched recursively and all other values replace existing values. The
+values of the given node are copied by reference.
+*/
+func NodeMergePatch(node Node, patch map[string]interface{}) Node {
+	return &graphNode{mergePatch(node.Data(), patch)}
+}
+
+/*
+mergePatch applies a JSON merge patch to an object.
+*/
+func mergePatch(target map[string]interface{}, patch map[string]interface{}) map[string]interface{} {
+	data := make(map[string]interface{}, len(target))
+
+	for k, v := range target {
+		data[k] = v
+	}
+
+	for k, v := range patch {
+
+		if v == nil {
+			delete(data, k)
+
+		} else if vpatch, ok := v.(map[string]interface{}); ok {
+			vtarget, _ := data[k].(map[string]interface{})
+			data[k] = mergePatch(vtarget, vpatch)
+
+		} else {
+			data[k] = v
+		}
+	}
+
+	return data
+}
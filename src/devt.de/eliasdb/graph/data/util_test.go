@@ -10,7 +10,10 @@
 
 package data
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+)
 
 func TestNodeCompare(t *testing.T) {
 	gn1 := NewGraphNode()
@@ -84,3 +87,127 @@ func TestNodeMerge(t *testing.T) {
 		return
 	}
 }
+
+func TestNodeCompareDetailed(t *testing.T) {
+	gn1 := NewGraphNodeFromMap(map[string]interface{}{
+		"key":   "123",
+		"kind":  "mykind",
+		"list":  []interface{}{1, "a", map[string]interface{}{"b": 2}},
+		"count": 5,
+		"name":  "foo",
+	})
+
+	gn2 := NewGraphNodeFromMap(map[string]interface{}{
+		"key":   "123",
+		"kind":  "mykind",
+		"list":  []interface{}{1, "a", map[string]interface{}{"b": 2}},
+		"count": 5,
+		"name":  "foo",
+	})
+
+	if equal, res := NodeCompareDetailed(gn1, gn2, nil); !equal || res != nil {
+		t.Error("Unexpected result:", equal, res)
+		return
+	}
+
+	gn2.SetAttr("list", []interface{}{1, "a", map[string]interface{}{"b": 3}})
+	gn2.SetAttr("name", nil)
+	gn2.SetAttr("extra", true)
+
+	if equal, res := NodeCompareDetailed(gn1, gn2, nil); equal || fmt.Sprint(res) != "[extra list name]" {
+		t.Error("Unexpected result:", equal, res)
+		return
+	}
+
+	if equal, res := NodeCompareDetailed(gn1, gn2, []string{"list", "extra"}); equal || fmt.Sprint(res) != "[name]" {
+		t.Error("Unexpected result:", equal, res)
+		return
+	}
+
+	if equal, res := NodeCompareDetailed(gn1, gn2, []string{"list", "extra", "name"}); !equal || res != nil {
+		t.Error("Unexpected result:", equal, res)
+		return
+	}
+
+	// Numbers of different types
+
+	gn1 = NewGraphNodeFromMap(map[string]interface{}{
+		"count": 5,
+		"price": float32(1.5),
+		"list":  []interface{}{1, 2},
+		"map":   map[string]interface{}{"a": int64(1)},
+		"big":   uint64(1) << 62,
+	})
+
+	gn2 = NewGraphNodeFromMap(map[string]interface{}{
+		"count": float64(5),
+		"price": 1.5,
+		"list":  []interface{}{1.0, int8(2)},
+		"map":   map[string]interface{}{"a": 1.0},
+		"big":   int64(1)<<62 + 1,
+	})
+
+	if equal, res := NodeCompareDetailed(gn1, gn2, nil); equal || fmt.Sprint(res) != "[big count list map price]" {
+		t.Error("Unexpected result:", equal, res)
+		return
+	}
+
+	CompareNumbersByValue = true
+	defer func() {
+		CompareNumbersByValue = false
+	}()
+
+	if equal, res := NodeCompareDetailed(gn1, gn2, nil); equal || fmt.Sprint(res) != "[big]" {
+		t.Error("Unexpected result:", equal, res)
+		return
+	}
+
+	// Numeric strings are not numbers
+
+	gn2.SetAttr("count", "5")
+	gn2.SetAttr("map", map[interface{}]interface{}{"a": 1})
+
+	if equal, res := NodeCompareDetailed(gn1, gn2, []string{"big"}); equal || fmt.Sprint(res) != "[count map]" {
+		t.Error("Unexpected result:", equal, res)
+		return
+	}
+
+	// Edges are compared in the same way
+
+	ge1 := NewGraphEdgeFromNode(gn1)
+	ge2 := NewGraphEdgeFromNode(gn1)
+
+	if equal, res := EdgeCompareDetailed(ge1, ge2, nil); !equal || res != nil {
+		t.Error("Unexpected result:", equal, res)
+		return
+	}
+}
+
+func TestNodeMergePatch(t *testing.T) {
+	gn := NewGraphNode()
+	gn.SetAttr("key", "123")
+	gn.SetAttr("kind", "mykind")
+	gn.SetAttr("name", "foo")
+	gn.SetAttr("count", 5)
+	gn.SetAttr("meta", map[string]interface{}{"a": 1, "b": 2})
+
+	res := NodeMergePatch(gn, map[string]interface{}{
+		"name":  nil,
+		"count": 6,
+		"meta":  map[string]interface{}{"a": nil, "c": 3},
+		"new":   map[string]interface{}{"x": nil, "y": 1},
+		"foo":   nil,
+	})
+
+	if out := fmt.Sprint(res.Data()); out != "map[count:6 key:123 kind:mykind meta:map[b:2 c:3] new:map[y:1]]" {
+		t.Error("Unexpected result:", out)
+		return
+	}
+
+	// The original node is not changed
+
+	if out := fmt.Sprint(gn.Data()); out != "map[count:5 key:123 kind:mykind meta:map[a:1 b:2] name:foo]" {
+		t.Error("Unexpected result:", out)
+		return
+	}
+}
@@ -19,11 +19,21 @@ nodes and edges through store, fetch and remove functions. It also provides
 the basic traversal functionality which allos the traversal from one node to
 other nodes.
 
+A manager should be closed with Close() when it is no longer needed. Closing
+writes all pending changes to the storage files and closes the underlying
+graph storage so no recovery is needed on the next start. A closed manager
+returns ErrClosed errors. To reopen the graph a new graph storage and a new
+manager need to be created.
+
 Node iterator
 
 All available node keys in a partition of a given kind can be iterated by using
 a NodeKeyIterator. The manager can produce these with the NodeKeyIterator()
-function.
+function. Keys are returned in hash order which may change whenever the
+underlying tree is modified - the iterator reports an error if nodes of the
+iterated kind are inserted or removed during the iteration. The SortedNodeKeyIterator() function produces an
+iterator which returns keys in lexicographic order at the cost of one scan of
+all keys for every SortedIterationChunkSize returned keys.
 
 Fulltext search
 
@@ -31,6 +41,16 @@ All nodes and edges in the datastore are indexed. The index can be queried
 using a IndexQuery object. The manager can produce these with the NodeIndexQuery()
 or EdgeIndexQuery function.
 
+Locking
+
+Every partition has its own reader / writer lock. Operations on different
+partitions do not block each other - e.g. a writer in partition "tenantA"
+does not block readers of partition "tenantB". Operations which touch global
+structures (e.g. edge cardinality constraints or graph rules) take a global
+lock which excludes all partition operations. Shared bookkeeping in the main
+database (known kinds, attributes, counts and names) is protected by a
+separate lock which is only held for the duration of a single lookup or update.
+
 Transactions
 
 A transaction is used to build up multiple store and delete tasks for the
@@ -38,6 +58,23 @@ graph database. Nothing is written to the database before calling commit().
 A transaction commit does an automatic rollback if an error occurs
 (except fatal disk write errors which might cause a panic).
 
+Savepoints can be set within a transaction with Savepoint(). RollbackTo()
+discards all operations which were added after a savepoint while keeping
+earlier operations for the commit.
+
+The read functions of a transaction (FetchNode, FetchEdge and TraverseMulti)
+overlay the pending operations of the transaction on the committed state of
+the graph. Stored nodes and edges are visible while removed nodes and edges
+are hidden. There is no isolation from other transactions - changes which are
+committed by others become visible immediately. Effects of graph rules (e.g.
+removing the edges of a removed node) are only applied during the commit.
+
+Every node and edge has a version which changes with every write. A
+transaction with enabled conflict detection (SetConflictDetection()) records
+the versions of all items it reads or changes. The commit fails with an
+ErrTransConflict error if any of these items was changed by someone else in
+the meantime. The transaction should then be built up again and retried.
+
 A trans object can be created with the NewGraphTrans() function.
 
 Rules
@@ -75,13 +112,43 @@ Each node kind database stores:
 	(a list of attributes of a certain node)
 
 	PrefixNSAttr + node key + attr num -> value
-	(attribute value of a certain node)
+	(attribute value of a certain node - possibly compressed)
 
 	PrefixNSSpecs + node key -> map[spec]<empty string>
 	(a lookup for available specs for a certain node)
 
 	PrefixNSEdge + node key + spec -> map[edge key]edgeinfo{other node key, other node kind}]
-	(connection from one node to another via a spec)
+	(connection from one node to another via a spec - undirected edges with
+	different roles are stored with both role orders)
+
+	PrefixNSVersion + node key -> version
+	(version of a certain node - stored in the second tree)
+
+	PrefixNSHistory + node key -> nodeHistory{write time, [ previous versions ]}
+	(history of a certain node if enabled for the kind - stored in the second tree)
+
+Node history
+
+The history of nodes can be recorded per kind (SetNodeHistory()). Every write
+of a node then keeps the previous attributes of the node together with the
+time span in which they were valid. Removed nodes can optionally keep their
+history as a tombstone. The number and the age of previous versions are
+limited - old versions are pruned whenever a node is written or by an explicit
+PruneNodeHistory() call.
+
+Attribute compression
+
+Large string attribute values can be stored compressed (SetAttributeCompression()).
+A compressed value is stored together with the name of its compressor and is
+decompressed whenever it is read - indexing and rules always see the original
+value. Values which were stored before the compression was enabled can be
+compressed with CompressNodeAttributes().
+
+Kind metadata
+
+Display labels and descriptions of kinds and their attributes can be stored
+with SetKindMeta(). The metadata is independent of the stored data and can be
+set before any data of a kind exists.
 
 Edges database
 
@@ -93,10 +160,30 @@ Each edge kind database stores:
 	PrefixNSAttr + edge key + attr num -> value
 	(attribute value of a certain edge)
 
+	PrefixNSVersion + edge key -> version
+	(version of a certain edge)
+
 Index database
 
 The text index managed by util/indexmanager.go. IndexQuery provides access to
-the full text search index.
+the full text search index. Attribute values are split into words by an
+analyzer which can be set per kind and attribute. The names of the analyzers
+which were used to build the index are stored in the main database. An index
+whose analyzer differs from the configured analyzer is stale and cannot be
+queried until it has been rebuilt.
+
+An index can be rebuilt while the database is in use. The new index is built
+in a second tree of the index storage which replaces the old tree once it is
+complete. All changes to the index are applied to both trees in the meantime.
+
+Indexing can be disabled for a kind in a partition. The index of the kind is
+then not maintained and cannot be queried. Once indexing is enabled again the
+index is rebuilt.
+
+Bulk loads (BeginBulkLoad()) defer the indexing of written nodes of a kind
+until EndBulkLoad() is called. The keys of the written nodes are only kept in
+memory - an interrupted bulk load is recorded in the main database and
+EndBulkLoad() rebuilds the whole index of the kind.
 */
 package graph
 
@@ -148,6 +235,11 @@ MainDBNodeCount is the MainDB entry key for a node count
 */
 const MainDBNodeCount = MainDBEntryPrefix + "ncnt"
 
+/*
+MainDBPartNodeCount is the MainDB entry key for a node count in a partition
+*/
+const MainDBPartNodeCount = MainDBEntryPrefix + "pncnt"
+
 /*
 MainDBEdgeAttrs is the MainDB entry key for a list of edge attributes
 */
@@ -158,6 +250,65 @@ MainDBEdgeCount is the MainDB entry key for an edge count
 */
 const MainDBEdgeCount = MainDBEntryPrefix + "ecnt"
 
+/*
+MainDBPartEdgeCount is the MainDB entry key for an edge count in a partition
+*/
+const MainDBPartEdgeCount = MainDBEntryPrefix + "pecnt"
+
+/*
+MainDBItemVersion is the MainDB entry key for the last assigned node or edge version
+*/
+const MainDBItemVersion = MainDBEntryPrefix + "iver"
+
+/*
+MainDBEdgeCardinality is the MainDB entry key for edge cardinality constraints
+*/
+const MainDBEdgeCardinality = MainDBEntryPrefix + "ecard"
+
+/*
+MainDBIndexAnalyzers is the MainDB entry key for the analyzers which were used
+to build the full text index of a kind
+*/
+const MainDBIndexAnalyzers = MainDBEntryPrefix + "ianalyzer"
+
+/*
+MainDBIndexState is the MainDB entry key for the state of the full text index
+of a kind in all partitions
+*/
+const MainDBIndexState = MainDBEntryPrefix + "istate"
+
+/*
+MainDBNodeHistory is the MainDB entry key for the history settings of a node kind
+*/
+const MainDBNodeHistory = MainDBEntryPrefix + "nhistory"
+
+/*
+MainDBAttrCompression is the MainDB entry key for the attribute compression
+settings of a kind
+*/
+const MainDBAttrCompression = MainDBEntryPrefix + "acomp"
+
+/*
+MainDBCompressionSaved is the MainDB entry key for the number of bytes saved by
+attribute compression of a kind
+*/
+const MainDBCompressionSaved = MainDBEntryPrefix + "acsaved"
+
+/*
+MainDBKindMeta is the MainDB entry key for the metadata of a kind
+*/
+const MainDBKindMeta = MainDBEntryPrefix + "kmeta"
+
+/*
+MainDBKindMetaKinds is the MainDB entry key for the list of kinds with metadata
+*/
+const MainDBKindMetaKinds = MainDBEntryPrefix + "kmlist"
+
+/*
+MainDBBulkLoads is the MainDB entry key for the list of running bulk loads
+*/
+const MainDBBulkLoads = MainDBEntryPrefix + "blist"
+
 // Root IDs for StorageManagers
 // ============================
 
@@ -171,6 +322,12 @@ RootIDNodeHTreeSecond is the root ID for the HTree holding secondary information
 */
 const RootIDNodeHTreeSecond = 3
 
+/*
+RootIDIndexRebuild is the root ID for the HTree holding an index which is
+currently rebuilt
+*/
+const RootIDIndexRebuild = 4
+
 // Suffixes for StorageManagers
 // ============================
 
@@ -221,6 +378,16 @@ PrefixNSEdge is the prefix for storing a link from a node (and a spec) to an edg
 */
 const PrefixNSEdge = string(0x04)
 
+/*
+PrefixNSVersion is the prefix for storing the version of a node or edge
+*/
+const PrefixNSVersion = "\x05"
+
+/*
+PrefixNSHistory is the prefix for storing the history of a node
+*/
+const PrefixNSHistory = "\x06"
+
 // Graph events
 //=============
 
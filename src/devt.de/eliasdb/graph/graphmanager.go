@@ -16,7 +16,6 @@ import (
 	"strconv"
 	"sync"
 
-	"devt.de/eliasdb/graph/data"
 	"devt.de/eliasdb/graph/graphstorage"
 	"devt.de/eliasdb/graph/util"
 )
@@ -29,7 +28,15 @@ type Manager struct {
 	gr       *graphRulesManager           // Manager for graph rules
 	nm       *util.NamesManager           // Manager object which manages name encodings
 	mapCache map[string]map[string]string // Cache which caches maps stored in the main database
-	mutex    *sync.RWMutex                // Mutex to protect atomic graph operations
+	stats    *statisticsCache             // Cache for partition statistics
+	mainLock *sync.RWMutex                // Lock to protect the main database and the map cache
+	plocks   *partitionLocks              // Locks to protect atomic operations in partitions
+	ia       *indexAnalyzers              // Analyzers of the full text index
+	av       *attrValidator               // Validator for attribute names
+	mc       *modCounters                 // Modification counters of node kinds
+	closed   *bool                        // Flag if the manager was closed
+	bl       *bulkLoads                   // Touched node keys of running bulk loads
+	mutex    *sync.RWMutex                // Global lock to protect atomic graph operations
 }
 
 /*
@@ -75,14 +82,58 @@ func createGraphManager(gs graphstorage.GraphStorage) *Manager {
 	}
 
 	gm := &Manager{gs, &graphRulesManager{nil, make(map[string]Rule),
-		make(map[int]map[string]Rule)}, util.NewNamesManager(mdb),
-		make(map[string]map[string]string), &sync.RWMutex{}}
+		make(map[int]map[string]Rule), newChangeFeed()}, util.NewNamesManager(mdb),
+		make(map[string]map[string]string), newStatisticsCache(), &sync.RWMutex{},
+		newPartitionLocks(), newIndexAnalyzers(), newAttrValidator(), newModCounters(),
+		new(bool), newBulkLoads(), &sync.RWMutex{}}
 
 	gm.gr.gm = gm
 
 	return gm
 }
 
+/*
+Close flushes all changes and closes the graph storage of this graph manager.
+All transaction logs are written to the storage files so no recovery is
+necessary when the storage is opened again. The manager cannot be used
+afterwards - all operations which access the storage return an ErrClosed
+error. To reopen the graph a new graph storage with the same name needs to
+be created (e.g. graphstorage.NewDiskGraphStorage) together with a new manager.
+*/
+func (gm *Manager) Close() error {
+
+	// Take global writer lock - this waits for all running operations
+
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	if err := gm.checkOpen(); err != nil {
+		return err
+	}
+
+	err := gm.flushMain()
+
+	// The storage is closed even if the main database could not be flushed
+
+	if cerr := gm.gs.Close(); cerr != nil {
+		err = cerr
+	}
+
+	*gm.closed = true
+
+	return err
+}
+
+/*
+checkOpen checks that this graph manager was not closed.
+*/
+func (gm *Manager) checkOpen() error {
+	if *gm.closed {
+		return &util.GraphError{Type: util.ErrClosed, Detail: gm.Name()}
+	}
+	return nil
+}
+
 /*
 Name returns the name of this graph manager.
 */
@@ -94,6 +145,12 @@ func (gm *Manager) Name() string {
 SetGraphRule sets a GraphRule.
 */
 func (gm *Manager) SetGraphRule(rule Rule) {
+
+	// Take global writer lock
+
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
 	gm.gr.SetGraphRule(rule)
 }
 
@@ -101,6 +158,12 @@ func (gm *Manager) SetGraphRule(rule Rule) {
 GraphRules returns a list of all available graph rules.
 */
 func (gm *Manager) GraphRules() []string {
+
+	// Take global reader lock
+
+	gm.mutex.RLock()
+	defer gm.mutex.RUnlock()
+
 	return gm.gr.GraphRules()
 }
 
@@ -108,24 +171,62 @@ func (gm *Manager) GraphRules() []string {
 NodeIndexQuery returns an object to query the full text search index for nodes.
 */
 func (gm *Manager) NodeIndexQuery(part string, kind string) (IndexQuery, error) {
-	iht, err := gm.getNodeIndexHTree(part, kind, false)
-	if err != nil || iht == nil {
+	if err := gm.checkIndexState(part, kind); err != nil {
+		return nil, err
+	}
+
+	im, err := gm.getNodeIndexManager(part, kind, false)
+	if err != nil || im == nil {
 		return nil, err
 	}
 
-	return util.NewIndexManager(iht), nil
+	return im, nil
 }
 
 /*
 EdgeIndexQuery returns an object to query the full text search index for edges.
 */
 func (gm *Manager) EdgeIndexQuery(part string, kind string) (IndexQuery, error) {
-	iht, err := gm.getEdgeIndexHTree(part, kind, false)
-	if err != nil || iht == nil {
+	if err := gm.checkIndexState(part, kind); err != nil {
+		return nil, err
+	}
+
+	im, err := gm.getEdgeIndexManager(part, kind, false)
+	if err != nil || im == nil {
+		return nil, err
+	}
+
+	return im, nil
+}
+
+/*
+LookupPhrase finds all nodes of a given kind where an attribute contains a
+certain phrase. The words of the phrase must appear consecutively and in order.
+Returns a sorted list of node keys.
+*/
+func (gm *Manager) LookupPhrase(part string, kind string, attr string, phrase string) ([]string, error) {
+	iq, err := gm.NodeIndexQuery(part, kind)
+	if err != nil || iq == nil {
+		return nil, err
+	}
+
+	return iq.LookupPhrase(attr, phrase)
+}
+
+/*
+LookupWordFuzzy finds all words of a node attribute which are within a given
+Levenshtein distance of a given word. The distance is capped at
+util.MaxFuzzyDistance. Returns a list of matches sorted by distance and word.
+*/
+func (gm *Manager) LookupWordFuzzy(part string, kind string, attr string, word string,
+	maxDist int) ([]*util.FuzzyMatch, error) {
+
+	iq, err := gm.NodeIndexQuery(part, kind)
+	if err != nil || iq == nil {
 		return nil, err
 	}
 
-	return util.NewIndexManager(iht), nil
+	return iq.LookupWordFuzzy(attr, word, maxDist)
 }
 
 /*
@@ -190,13 +291,10 @@ func (gm *Manager) mainStringList(name string) []string {
 }
 
 /*
-IsValidAttr checks if a given string can be a valid node attribute.t
+IsValidAttr checks if a given string can be a valid node attribute. The
+attribute must be known and accepted by the attribute validator.
 */
 func (gm *Manager) IsValidAttr(attr string) bool {
-	return gm.nm.Encode32(attr, false) != "" ||
-		attr == data.NodeKey || attr == data.NodeKind ||
-		attr == data.EdgeEnd1Key || attr == data.EdgeEnd1Kind ||
-		attr == data.EdgeEnd1Role || attr == data.EdgeEnd1Cascading ||
-		attr == data.EdgeEnd2Key || attr == data.EdgeEnd2Kind ||
-		attr == data.EdgeEnd2Role || attr == data.EdgeEnd2Cascading
+	return isSystemAttr(attr) ||
+		(gm.encode32(attr, false) != "" && gm.validateAttr(attr) == nil)
 }
@@ -0,0 +1,214 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"sync"
+
+	"devt.de/common/stringutil"
+	"devt.de/eliasdb/graph/util"
+	"devt.de/eliasdb/hash"
+)
+
+/*
+DefaultAnalyzerName is the name of the analyzer which is used for attributes
+without a configured analyzer.
+*/
+var DefaultAnalyzerName = (&util.DefaultAnalyzer{}).Name()
+
+/*
+indexAnalyzers data structure which holds the configured analyzers of all
+kinds and attributes.
+*/
+type indexAnalyzers struct {
+	analyzers map[string]map[string]util.Analyzer // Map of kind to attribute analyzers
+	mutex     *sync.RWMutex                       // Mutex to protect the map of analyzers
+}
+
+/*
+newIndexAnalyzers creates a new indexAnalyzers instance.
+*/
+func newIndexAnalyzers() *indexAnalyzers {
+	return &indexAnalyzers{make(map[string]map[string]util.Analyzer), &sync.RWMutex{}}
+}
+
+/*
+get returns the configured analyzer of a given kind and attribute. Returns
+nil if the default analyzer should be used.
+*/
+func (ia *indexAnalyzers) get(kind string, attr string) util.Analyzer {
+	ia.mutex.RLock()
+	defer ia.mutex.RUnlock()
+
+	return ia.analyzers[kind][attr]
+}
+
+/*
+set configures the analyzer of a given kind and attribute. A nil analyzer
+resets the attribute to the default analyzer.
+*/
+func (ia *indexAnalyzers) set(kind string, attr string, analyzer util.Analyzer) {
+	ia.mutex.Lock()
+	defer ia.mutex.Unlock()
+
+	if analyzer == nil {
+		delete(ia.analyzers[kind], attr)
+		return
+	}
+
+	if _, ok := ia.analyzers[kind]; !ok {
+		ia.analyzers[kind] = make(map[string]util.Analyzer)
+	}
+
+	ia.analyzers[kind][attr] = analyzer
+}
+
+/*
+names returns the analyzer names of all configured attributes of a given kind.
+*/
+func (ia *indexAnalyzers) names(kind string) map[string]string {
+	ia.mutex.RLock()
+	defer ia.mutex.RUnlock()
+
+	ret := make(map[string]string, len(ia.analyzers[kind]))
+
+	for attr, analyzer := range ia.analyzers[kind] {
+		ret[attr] = analyzer.Name()
+	}
+
+	return ret
+}
+
+/*
+SetIndexAnalyzer sets the analyzer which is used to index a given attribute of
+nodes and edges of a given kind. A nil analyzer resets the attribute to the
+default analyzer. Analyzers are not persisted and must be set every time a
+graph manager is created - only the analyzer names are stored in the main
+database. If the analyzer name differs from the name of the analyzer which
+was used to build the existing index then all index entries of the given kind
+are rebuilt in all partitions.
+*/
+func (gm *Manager) SetIndexAnalyzer(kind string, attr string, analyzer util.Analyzer) error {
+
+	if !stringutil.IsAlphaNumeric(kind) {
+		return &util.GraphError{
+			Type:   util.ErrInvalidData,
+			Detail: fmt.Sprintf("Kind %v is not alphanumeric - can only contain [a-zA-Z0-9_]", kind),
+		}
+	}
+
+	// Take global writer lock
+
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	gm.ia.set(kind, attr, analyzer)
+
+	name := DefaultAnalyzerName
+	if analyzer != nil {
+		name = analyzer.Name()
+	}
+
+	if gm.indexAnalyzerName(kind, attr) == name {
+		return nil
+	}
+
+	// The global writer lock is already held - no further locking is required
+
+	nolock := func() func() {
+		return func() {}
+	}
+
+	for _, part := range gm.Partitions() {
+		if err := gm.rebuildIndex(part, kind, true, nolock, nil); err != nil {
+			return err
+		}
+	}
+
+	// All attributes of the kind have now been indexed with the configured analyzers
+
+	names := gm.ia.names(kind)
+
+	gm.updateMainDBMap(MainDBIndexAnalyzers+kind, func(map[string]string) map[string]string {
+		return names
+	})
+
+	return gm.flushMain()
+}
+
+/*
+IndexAnalyzer returns the analyzer which is used to index a given attribute
+of nodes and edges of a given kind.
+*/
+func (gm *Manager) IndexAnalyzer(kind string, attr string) util.Analyzer {
+	if analyzer := gm.ia.get(kind, attr); analyzer != nil {
+		return analyzer
+	}
+
+	return &util.DefaultAnalyzer{}
+}
+
+/*
+indexAnalyzerName returns the name of the analyzer which was used to build
+the index of a given attribute of a given kind.
+*/
+func (gm *Manager) indexAnalyzerName(kind string, attr string) string {
+	if name, ok := gm.getMainDBMap(MainDBIndexAnalyzers + kind)[attr]; ok {
+		return name
+	}
+
+	return DefaultAnalyzerName
+}
+
+/*
+newIndexManager creates a new index manager for an index tree of a given kind.
+The index manager uses the configured analyzers. Attributes whose index was
+built with a different analyzer are marked as stale.
+*/
+func (gm *Manager) newIndexManager(kind string, iht *hash.HTree) *util.IndexManager {
+	im := util.NewIndexManager(iht)
+
+	configured := gm.ia.names(kind)
+	built := gm.getMainDBMap(MainDBIndexAnalyzers + kind)
+
+	for attr := range configured {
+		im.SetAnalyzer(attr, gm.ia.get(kind, attr))
+	}
+
+	checkStale := func(attr string) {
+		builtName, configuredName := DefaultAnalyzerName, DefaultAnalyzerName
+
+		if name, ok := built[attr]; ok {
+			builtName = name
+		}
+		if name, ok := configured[attr]; ok {
+			configuredName = name
+		}
+
+		if builtName != configuredName {
+			im.SetStale(attr, fmt.Sprintf("Index of attribute %v of kind %v was built "+
+				"with analyzer %v - configured analyzer is %v", attr, kind, builtName, configuredName))
+		}
+	}
+
+	for attr := range configured {
+		checkStale(attr)
+	}
+
+	for attr := range built {
+		if _, ok := configured[attr]; !ok {
+			checkStale(attr)
+		}
+	}
+
+	return im
+}
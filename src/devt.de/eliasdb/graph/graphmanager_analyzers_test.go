@@ -0,0 +1,193 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"testing"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+	"devt.de/eliasdb/graph/util"
+)
+
+func TestIndexAnalyzer(t *testing.T) {
+
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	constructNode := func(part string, key string, code string) data.Node {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "Product")
+		node.SetAttr("code", code)
+		node.SetAttr("name", "Product "+key)
+
+		if err := gm.StoreNode(part, node); err != nil {
+			t.Error(err)
+		}
+
+		return node
+	}
+
+	p1 := constructNode("main", "p1", "AB-1234/X")
+	p2 := constructNode("main", "p2", "CD-1234/Y")
+	constructNode("other", "p3", "AB-9999/X")
+
+	edge := data.NewGraphEdge()
+
+	edge.SetAttr("key", "e1")
+	edge.SetAttr("kind", "Product")
+	edge.SetAttr("code", "XY-5678")
+
+	edge.SetAttr(data.EdgeEnd1Key, p1.Key())
+	edge.SetAttr(data.EdgeEnd1Kind, p1.Kind())
+	edge.SetAttr(data.EdgeEnd1Role, "variant")
+	edge.SetAttr(data.EdgeEnd1Cascading, false)
+
+	edge.SetAttr(data.EdgeEnd2Key, p2.Key())
+	edge.SetAttr(data.EdgeEnd2Kind, p2.Kind())
+	edge.SetAttr(data.EdgeEnd2Role, "variant")
+	edge.SetAttr(data.EdgeEnd2Cascading, false)
+
+	if err := gm.StoreEdge("main", edge); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// The default analyzer splits the product codes into words
+
+	if res, err := gm.LookupPhrase("main", "Product", "code", "1234"); fmt.Sprint(res) != "[p1 p2]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gm.LookupPhrase("main", "Product", "code", "234"); fmt.Sprint(res) != "[]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res := gm.IndexAnalyzer("Product", "code").Name(); res != "default" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if err := gm.SetIndexAnalyzer("Pro-duct", "code", util.NewNGramAnalyzer(3)); err == nil ||
+		err.Error() != "GraphError: Invalid data (Kind Pro-duct is not alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Changing the analyzer rebuilds the index in all partitions
+
+	if err := gm.SetIndexAnalyzer("Product", "code", util.NewNGramAnalyzer(3)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := gm.IndexAnalyzer("Product", "code").Name(); res != "ngram3" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res, err := gm.LookupPhrase("main", "Product", "code", "234"); fmt.Sprint(res) != "[p1 p2]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gm.LookupPhrase("main", "Product", "code", "b-1"); fmt.Sprint(res) != "[p1]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gm.LookupPhrase("other", "Product", "code", "b-9"); fmt.Sprint(res) != "[p3]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	iq, _ := gm.EdgeIndexQuery("main", "Product")
+
+	if res, err := iq.LookupPhrase("code", "y-56"); fmt.Sprint(res) != "[e1]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Other attributes still use the default analyzer
+
+	if res, err := gm.LookupPhrase("main", "Product", "name", "product p1"); fmt.Sprint(res) != "[p1]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// New items are indexed with the configured analyzer
+
+	constructNode("main", "p4", "ZZ-2345")
+
+	if res, err := gm.LookupPhrase("main", "Product", "code", "234"); fmt.Sprint(res) != "[p1 p2 p4]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// A new graph manager which does not configure the analyzer reports a stale index
+
+	gm = NewGraphManager(mgs)
+
+	if _, err := gm.LookupPhrase("main", "Product", "code", "234"); err == nil ||
+		err.Error() != "GraphError: Index is stale (Index of attribute code of kind Product "+
+			"was built with analyzer ngram3 - configured analyzer is default)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err := gm.LookupPhrase("main", "Product", "name", "product p1"); fmt.Sprint(res) != "[p1]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Setting the same analyzer again does not require a rebuild
+
+	if err := gm.SetIndexAnalyzer("Product", "code", util.NewNGramAnalyzer(3)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res, err := gm.LookupPhrase("main", "Product", "code", "234"); fmt.Sprint(res) != "[p1 p2 p4]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Resetting the analyzer rebuilds the index with the default analyzer
+
+	if err := gm.SetIndexAnalyzer("Product", "code", nil); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res, err := gm.LookupPhrase("main", "Product", "code", "234"); fmt.Sprint(res) != "[]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gm.LookupPhrase("main", "Product", "code", "1234 x"); fmt.Sprint(res) != "[p1]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res := mgs.MainDB()[MainDBIndexAnalyzers+"Product"]; res == "" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := gm.getMainDBMap(MainDBIndexAnalyzers + "Product"); len(res) != 0 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
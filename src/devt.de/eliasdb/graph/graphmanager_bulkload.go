@@ -0,0 +1,320 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"devt.de/common/stringutil"
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/util"
+)
+
+/*
+bulkLoads data structure which holds the keys of all nodes which were
+written during a bulk load for every partition and kind. The keys are only
+kept in memory.
+*/
+type bulkLoads struct {
+	keys  map[string]map[string]bool // Map of partition and kind to touched node keys
+	mutex *sync.Mutex                // Mutex to protect the map of keys
+}
+
+/*
+newBulkLoads creates a new bulkLoads instance.
+*/
+func newBulkLoads() *bulkLoads {
+	return &bulkLoads{make(map[string]map[string]bool), &sync.Mutex{}}
+}
+
+/*
+start starts recording the touched keys of a given partition and kind.
+*/
+func (bl *bulkLoads) start(part string, kind string) {
+	bl.mutex.Lock()
+	defer bl.mutex.Unlock()
+
+	bl.keys[part+"#"+kind] = make(map[string]bool)
+}
+
+/*
+touch records a touched key. Returns if the key was already recorded and if
+a bulk load of the given partition and kind is running.
+*/
+func (bl *bulkLoads) touch(part string, kind string, key string) (bool, bool) {
+	bl.mutex.Lock()
+	defer bl.mutex.Unlock()
+
+	keys, ok := bl.keys[part+"#"+kind]
+	if !ok {
+		return false, false
+	}
+
+	touched := keys[key]
+	keys[key] = true
+
+	return touched, true
+}
+
+/*
+take removes up to a given number of recorded keys of a given partition and
+kind. Returns false as second value if no bulk load is running.
+*/
+func (bl *bulkLoads) take(part string, kind string, n int) ([]string, bool) {
+	bl.mutex.Lock()
+	defer bl.mutex.Unlock()
+
+	keys, ok := bl.keys[part+"#"+kind]
+	if !ok {
+		return nil, false
+	}
+
+	var ret []string
+
+	for key := range keys {
+		if len(ret) == n {
+			break
+		}
+
+		ret = append(ret, key)
+		delete(keys, key)
+	}
+
+	return ret, true
+}
+
+/*
+stop stops recording the touched keys of a given partition and kind.
+*/
+func (bl *bulkLoads) stop(part string, kind string) {
+	bl.mutex.Lock()
+	defer bl.mutex.Unlock()
+
+	delete(bl.keys, part+"#"+kind)
+}
+
+/*
+clear removes the recorded keys of all bulk loads. The indices of running
+bulk loads are rebuilt once the bulk loads end.
+*/
+func (bl *bulkLoads) clear() {
+	bl.mutex.Lock()
+	defer bl.mutex.Unlock()
+
+	bl.keys = make(map[string]map[string]bool)
+}
+
+/*
+BeginBulkLoad starts a bulk load of nodes of a given kind in a given
+partition. Index updates for stored nodes are deferred until EndBulkLoad is
+called - the keys of all written nodes are recorded and only the final state
+of the nodes is indexed. Old values of updated or removed nodes which were
+stored before the bulk load are still removed from the index right away.
+
+The index of the kind is marked as stale for the duration of the bulk load -
+all index queries fail with an ErrIndexStale error. The bulk load is recorded
+in the main database. If the bulk load is interrupted (e.g. by a crash) then
+EndBulkLoad rebuilds the index of the kind completely.
+*/
+func (gm *Manager) BeginBulkLoad(part string, kind string) error {
+
+	if err := gm.checkPartitionName(part); err != nil {
+		return err
+	} else if !stringutil.IsAlphaNumeric(kind) {
+		return &util.GraphError{
+			Type:   util.ErrInvalidData,
+			Detail: fmt.Sprintf("Kind %v is not alphanumeric - can only contain [a-zA-Z0-9_]", kind),
+		}
+	}
+
+	// Take writer lock
+
+	defer gm.writeLock(part)()
+
+	if err := gm.checkIndexState(part, kind); err != nil {
+		return err
+	}
+
+	gm.updateMainDBMap(MainDBBulkLoads, func(loads map[string]string) map[string]string {
+		if loads == nil {
+			loads = make(map[string]string)
+		}
+
+		loads[part+"#"+kind] = ""
+
+		return loads
+	})
+
+	if err := gm.setIndexState(part, kind, indexStateBulkLoad); err != nil {
+		return err
+	}
+
+	gm.bl.start(part, kind)
+
+	return nil
+}
+
+/*
+EndBulkLoad ends all running bulk loads and indexes all nodes which were
+written during the bulk loads. Nodes are indexed in batches of
+IndexRebuildBatchSize and the writer lock of the partition is only held while
+a batch is processed. Bulk loads which were interrupted are finished by
+rebuilding the index of the kind - EndBulkLoad should be called after a
+restart if a bulk load was running (see BulkLoads).
+*/
+func (gm *Manager) EndBulkLoad() error {
+
+	for _, load := range gm.BulkLoads() {
+		partAndKind := strings.Split(load, "#")
+
+		if err := gm.endBulkLoad(partAndKind[0], partAndKind[1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+BulkLoads returns all running or interrupted bulk loads as partition and kind
+pairs (e.g. main#Song).
+*/
+func (gm *Manager) BulkLoads() []string {
+	var ret []string
+
+	for load := range gm.getMainDBMap(MainDBBulkLoads) {
+		ret = append(ret, load)
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
+
+/*
+endBulkLoad ends the bulk load of a given partition and kind.
+*/
+func (gm *Manager) endBulkLoad(part string, kind string) error {
+	var err error
+
+	lock := func() func() {
+		return gm.writeLock(part)
+	}
+
+	// Index all recorded keys in batches - keys which are touched while
+	// the batches are processed are recorded again
+
+	for {
+		unlock := lock()
+
+		keys, ok := gm.bl.take(part, kind, IndexRebuildBatchSize)
+
+		if !ok {
+			unlock()
+
+			// The recorded keys were lost - rebuild the whole index
+
+			if err = gm.rebuildIndex(part, kind, true, lock, nil); err != nil {
+				return err
+			}
+
+			break
+
+		} else if len(keys) == 0 {
+			gm.bl.stop(part, kind)
+			unlock()
+			break
+		}
+
+		err = gm.indexBulkLoadBatch(part, kind, keys)
+		unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// The index is complete now
+
+	defer lock()()
+
+	gm.updateMainDBMap(MainDBBulkLoads, func(loads map[string]string) map[string]string {
+		delete(loads, part+"#"+kind)
+		return loads
+	})
+
+	if gm.indexState(part, kind) != indexStateBulkLoad {
+		return gm.flushMain()
+	}
+
+	return gm.setIndexState(part, kind, "")
+}
+
+/*
+indexBulkLoadBatch indexes a batch of nodes which were written during a bulk
+load. It is assumed that the caller holds the writer lock of the partition.
+*/
+func (gm *Manager) indexBulkLoadBatch(part string, kind string, keys []string) error {
+
+	im, err := gm.getNodeIndexManager(part, kind, true)
+	if err != nil || im == nil {
+		return err
+	}
+
+	attTree, valTree, err := gm.getNodeStorageHTree(part, kind, false)
+	if err != nil || attTree == nil || valTree == nil {
+		return err
+	}
+
+	for _, key := range keys {
+
+		node, err := gm.readNode(key, kind, nil, attTree, valTree)
+		if err != nil {
+			return err
+		} else if node == nil {
+
+			// Node was removed during the bulk load
+
+			continue
+		}
+
+		if err := im.Index(key, node.IndexMap()); err != nil {
+			return err
+		}
+	}
+
+	return gm.flushNodeIndex(part, kind)
+}
+
+/*
+deferNodeIndex checks if the index update for a written or removed node should
+be deferred because of a running bulk load. Old values of a node which was
+not yet touched during the bulk load are removed from the index right away.
+It is assumed that the caller holds the writer lock of the partition.
+*/
+func (gm *Manager) deferNodeIndex(im *util.IndexManager, part string, kind string,
+	key string, oldnode data.Node) (bool, error) {
+
+	if im == nil {
+		return false, nil
+	}
+
+	touched, ok := gm.bl.touch(part, kind, key)
+
+	if ok && !touched && oldnode != nil {
+		return true, im.Deindex(key, oldnode.IndexMap())
+	}
+
+	return ok, nil
+}
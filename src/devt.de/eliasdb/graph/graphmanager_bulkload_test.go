@@ -0,0 +1,236 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+	"devt.de/eliasdb/graph/util"
+)
+
+func TestBulkLoad(t *testing.T) {
+
+	oldBatchSize := IndexRebuildBatchSize
+	IndexRebuildBatchSize = 3
+	defer func() {
+		IndexRebuildBatchSize = oldBatchSize
+	}()
+
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	newNode := func(key string, name string) data.Node {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "Song")
+		node.SetAttr("name", name)
+		return node
+	}
+
+	storeNode := func(key string, name string) {
+		if err := gm.StoreNode("main", newNode(key, name)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	lookup := func(gm *Manager, word string) string {
+		iq, err := gm.NodeIndexQuery("main", "Song")
+		if err != nil {
+			return err.Error()
+		}
+
+		res, err := iq.LookupWord("name", word)
+		if err != nil {
+			return err.Error()
+		}
+
+		var keys []string
+		for key := range res {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		return fmt.Sprint(keys)
+	}
+
+	storeNode("s1", "old")
+	storeNode("s2", "old")
+
+	// Test error cases
+
+	if err := gm.BeginBulkLoad("main ", "Song"); err == nil ||
+		err.Error() != "GraphError: Invalid data (Partition name main  is not alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.BeginBulkLoad("main", "So ng"); err == nil ||
+		err.Error() != "GraphError: Invalid data (Kind So ng is not alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Start a bulk load
+
+	if err := gm.BeginBulkLoad("main", "Song"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := gm.BeginBulkLoad("main", "Song"); err == nil || err.(*util.GraphError).Type != util.ErrIndexStale {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res := fmt.Sprint(gm.BulkLoads()); res != "[main#Song]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	for i := 3; i < 10; i++ {
+		storeNode(fmt.Sprintf("s%v", i), "new")
+	}
+
+	storeNode("s1", "new")
+	storeNode("s9", "newer")
+
+	if _, err := gm.RemoveNode("main", "s2", "Song"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := gm.RemoveNode("main", "s8", "Song"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	trans := NewGraphTrans(gm)
+	trans.StoreNode("main", newNode("s10", "new"))
+	trans.RemoveNode("main", "s7", "Song")
+
+	if err := trans.Commit(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// The index cannot be queried during the bulk load
+
+	if res := lookup(gm, "new"); res != "GraphError: Index is stale (Bulk load of kind Song "+
+		"in partition main is in progress - the bulk load must be ended)" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Only the old values of nodes which existed before have been removed
+
+	im, _ := gm.getNodeIndexManager("main", "Song", false)
+
+	if res, _ := im.LookupWord("name", "old"); len(res) != 0 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res, _ := im.LookupWord("name", "new"); len(res) != 0 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// End the bulk load
+
+	if err := gm.EndBulkLoad(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := fmt.Sprint(gm.BulkLoads()); res != "[]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := lookup(gm, "new"); res != "[s1 s10 s3 s4 s5 s6]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := lookup(gm, "newer"); res != "[s9]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := lookup(gm, "old"); res != "[]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Writes after the bulk load are indexed right away
+
+	storeNode("s11", "new")
+
+	if res := lookup(gm, "new"); res != "[s1 s10 s11 s3 s4 s5 s6]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Simulate an interrupted bulk load - a new graph manager has lost the
+	// recorded keys
+
+	if err := gm.BeginBulkLoad("main", "Song"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	storeNode("s12", "new")
+	storeNode("s3", "newer")
+
+	gm2 := NewGraphManager(mgs)
+
+	if res := fmt.Sprint(gm2.BulkLoads()); res != "[main#Song]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := lookup(gm2, "new"); res != "GraphError: Index is stale (Bulk load of kind Song "+
+		"in partition main is in progress - the bulk load must be ended)" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if err := gm2.EndBulkLoad(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := lookup(gm2, "new"); res != "[s1 s10 s11 s12 s4 s5 s6]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := lookup(gm2, "newer"); res != "[s3 s9]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// A bulk load cannot be started if indexing is disabled
+
+	if err := gm.SetIndexingEnabled("main", "Song", false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := gm.BeginBulkLoad("main", "Song"); err == nil || err.(*util.GraphError).Type != util.ErrKindNotIndexed {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
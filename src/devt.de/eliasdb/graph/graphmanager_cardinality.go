@@ -0,0 +1,306 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"devt.de/common/stringutil"
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/util"
+	"devt.de/eliasdb/hash"
+)
+
+/*
+EdgeCardinality models a constraint on the number of edges of a certain kind
+which a node can have in a certain role.
+*/
+type EdgeCardinality struct {
+	Kind      string // Edge kind
+	Role      string // Role of the node in the edge
+	Min       int    // Minimum number of edges
+	Max       int    // Maximum number of edges (-1 for no upper limit)
+	StrictMin bool   // Flag if removals which violate the minimum should fail
+}
+
+/*
+String returns a string representation of this constraint.
+*/
+func (ec *EdgeCardinality) String() string {
+	return fmt.Sprintf("%v:%v [%v..%v]", ec.Role, ec.Kind, ec.Min, ec.Max)
+}
+
+/*
+SetEdgeCardinality sets a cardinality constraint for edges of a given kind
+where a node has a given role. The constraint is persisted in the main
+database. The maximum is enforced when edges are stored. The minimum cannot
+be enforced when edges are stored (the first edge of a node would always
+violate it) - it is only checked when edges are removed. If strictMin is set
+then a removal which violates the minimum fails, otherwise the violation can
+be reported with CheckEdgeCardinality. A max value of -1 means there is no
+upper limit.
+*/
+func (gm *Manager) SetEdgeCardinality(kind string, role string, min int, max int, strictMin bool) error {
+
+	if !stringutil.IsAlphaNumeric(kind) || !stringutil.IsAlphaNumeric(role) {
+		return &util.GraphError{
+			Type:   util.ErrInvalidData,
+			Detail: fmt.Sprintf("Edge kind %v and role %v must be alphanumeric - can only contain [a-zA-Z0-9_]", kind, role),
+		}
+	} else if min < 0 || max < -1 || (max != -1 && max < min) {
+		return &util.GraphError{
+			Type:   util.ErrInvalidData,
+			Detail: fmt.Sprintf("Invalid cardinality range: %v..%v", min, max),
+		}
+	}
+
+	// Take global writer lock
+
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	gm.updateMainDBMap(MainDBEdgeCardinality, func(cards map[string]string) map[string]string {
+		if cards == nil {
+			cards = make(map[string]string)
+		}
+
+		cards[role+":"+kind] = fmt.Sprintf("%v:%v:%v", min, max, strictMin)
+
+		return cards
+	})
+
+	return gm.flushMain()
+}
+
+/*
+RemoveEdgeCardinality removes a cardinality constraint.
+*/
+func (gm *Manager) RemoveEdgeCardinality(kind string, role string) error {
+
+	// Take global writer lock
+
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	if _, ok := gm.getMainDBMap(MainDBEdgeCardinality)[role+":"+kind]; !ok {
+		return nil
+	}
+
+	gm.updateMainDBMap(MainDBEdgeCardinality, func(cards map[string]string) map[string]string {
+		delete(cards, role+":"+kind)
+		return cards
+	})
+
+	return gm.flushMain()
+}
+
+/*
+EdgeCardinalities returns all cardinality constraints.
+*/
+func (gm *Manager) EdgeCardinalities() []*EdgeCardinality {
+
+	// Take global reader lock
+
+	gm.mutex.RLock()
+	defer gm.mutex.RUnlock()
+
+	cards := gm.getMainDBMap(MainDBEdgeCardinality)
+	rolekinds := make([]string, 0, len(cards))
+
+	for rolekind := range cards {
+		rolekinds = append(rolekinds, rolekind)
+	}
+
+	sort.StringSlice(rolekinds).Sort()
+
+	ret := make([]*EdgeCardinality, 0, len(cards))
+
+	for _, rolekind := range rolekinds {
+		rk := strings.Split(rolekind, ":")
+		ret = append(ret, gm.edgeCardinality(rk[1], rk[0]))
+	}
+
+	return ret
+}
+
+/*
+CheckEdgeCardinality returns all cardinality constraints which a given node
+currently violates.
+*/
+func (gm *Manager) CheckEdgeCardinality(part string, key string, kind string) ([]*EdgeCardinality, error) {
+	var ret []*EdgeCardinality
+
+	degrees, err := gm.NodeDegrees(part, key, kind)
+	if err != nil || degrees == nil {
+		return nil, err
+	}
+
+	for _, card := range gm.EdgeCardinalities() {
+		count := countSpecs(degrees, card.Role, card.Kind)
+
+		if count < card.Min || (card.Max != -1 && count > card.Max) {
+			ret = append(ret, card)
+		}
+	}
+
+	return ret, nil
+}
+
+/*
+edgeCardinality returns the cardinality constraint for a given edge kind and
+role or nil if no constraint was set.
+*/
+func (gm *Manager) edgeCardinality(kind string, role string) *EdgeCardinality {
+	cards := gm.getMainDBMap(MainDBEdgeCardinality)
+
+	val, ok := cards[role+":"+kind]
+	if !ok {
+		return nil
+	}
+
+	sval := strings.Split(val, ":")
+	min, _ := strconv.Atoi(sval[0])
+	max, _ := strconv.Atoi(sval[1])
+
+	return &EdgeCardinality{kind, role, min, max, sval[2] == "true"}
+}
+
+/*
+checkEdgeCardinalityMax checks that storing a given edge does not exceed the
+maximum number of edges of its endpoints. It is assumed that the caller holds
+the writer lock.
+*/
+func (gm *Manager) checkEdgeCardinalityMax(edge data.Edge, edgeTree *hash.HTree,
+	end1Tree *hash.HTree, end2Tree *hash.HTree) error {
+
+	if len(gm.getMainDBMap(MainDBEdgeCardinality)) == 0 {
+		return nil
+	}
+
+	// Updates cannot change the endpoints of an edge - only new edges
+	// need to be checked
+
+	if obj, err := edgeTree.Get([]byte(PrefixNSAttrs + edge.Key())); err != nil {
+		return &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
+	} else if obj != nil {
+		return nil
+	}
+
+	checkEnd := func(key string, kind string, role string, tree *hash.HTree) error {
+		card := gm.edgeCardinality(edge.Kind(), role)
+
+		if card == nil || card.Max == -1 {
+			return nil
+		}
+
+		degrees, err := gm.readNodeDegrees(key, tree)
+		if err != nil {
+			return err
+		}
+
+		if countSpecs(degrees, role, edge.Kind())+1 > card.Max {
+			return &util.GraphError{
+				Type: util.ErrCardinality,
+				Detail: fmt.Sprintf("Cannot store edge %v - node %v (%v) can have at most %v %v edges as %v",
+					edge.Key(), key, kind, card.Max, edge.Kind(), role),
+			}
+		}
+
+		return nil
+	}
+
+	if err := checkEnd(edge.End1Key(), edge.End1Kind(), edge.End1Role(), end1Tree); err != nil {
+		return err
+	}
+
+	return checkEnd(edge.End2Key(), edge.End2Kind(), edge.End2Role(), end2Tree)
+}
+
+/*
+checkEdgeCardinalityMin checks that removing a given edge does not violate a
+strict minimum number of edges of its endpoints. Endpoints which no longer
+exist are not checked. It is assumed that the caller holds the writer lock.
+*/
+func (gm *Manager) checkEdgeCardinalityMin(part string, key string, kind string,
+	edgeTree *hash.HTree) error {
+
+	if len(gm.getMainDBMap(MainDBEdgeCardinality)) == 0 {
+		return nil
+	}
+
+	// Read the edge which should be removed
+
+	node, err := gm.readNode(key, kind, nil, edgeTree, edgeTree)
+	if err != nil || node == nil {
+		return err
+	}
+
+	edge := data.NewGraphEdgeFromNode(node)
+
+	checkEnd := func(key string, kind string, role string) error {
+		card := gm.edgeCardinality(edge.Kind(), role)
+
+		if card == nil || !card.StrictMin || card.Min == 0 {
+			return nil
+		}
+
+		attTree, tree, err := gm.getNodeStorageHTree(part, kind, false)
+		if err != nil || tree == nil {
+			return err
+		}
+
+		if obj, err := attTree.Get([]byte(PrefixNSAttrs + key)); err != nil {
+			return &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
+		} else if obj == nil {
+			return nil
+		}
+
+		degrees, err := gm.readNodeDegrees(key, tree)
+		if err != nil {
+			return err
+		}
+
+		if countSpecs(degrees, role, edge.Kind())-1 < card.Min {
+			return &util.GraphError{
+				Type: util.ErrCardinality,
+				Detail: fmt.Sprintf("Cannot remove edge %v - node %v (%v) must have at least %v %v edges as %v",
+					edge.Key(), key, kind, card.Min, edge.Kind(), role),
+			}
+		}
+
+		return nil
+	}
+
+	if err := checkEnd(edge.End1Key(), edge.End1Kind(), edge.End1Role()); err != nil {
+		return err
+	}
+
+	return checkEnd(edge.End2Key(), edge.End2Kind(), edge.End2Role())
+}
+
+/*
+countSpecs counts all edges of a given kind and role in a map of spec counts.
+*/
+func countSpecs(degrees map[string]int, role string, kind string) int {
+	ret := 0
+	sspec := []string{role, kind, "", ""}
+
+	for spec, count := range degrees {
+		if matchSpec(sspec, spec) {
+			ret += count
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,226 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"testing"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+	"devt.de/eliasdb/graph/util"
+)
+
+func TestEdgeCardinality(t *testing.T) {
+
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	constructNode := func(key string, kind string) data.Node {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", kind)
+
+		if err := gm.StoreNode("main", node); err != nil {
+			t.Error(err)
+		}
+
+		return node
+	}
+
+	constructEdge := func(key string, node1 data.Node, node2 data.Node) data.Edge {
+		edge := data.NewGraphEdge()
+
+		edge.SetAttr("key", key)
+		edge.SetAttr("kind", "publishedby")
+
+		edge.SetAttr(data.EdgeEnd1Key, node1.Key())
+		edge.SetAttr(data.EdgeEnd1Kind, node1.Kind())
+		edge.SetAttr(data.EdgeEnd1Role, "book")
+		edge.SetAttr(data.EdgeEnd1Cascading, false)
+
+		edge.SetAttr(data.EdgeEnd2Key, node2.Key())
+		edge.SetAttr(data.EdgeEnd2Kind, node2.Kind())
+		edge.SetAttr(data.EdgeEnd2Role, "publisher")
+		edge.SetAttr(data.EdgeEnd2Cascading, false)
+
+		return edge
+	}
+
+	book1 := constructNode("b1", "Book")
+	book2 := constructNode("b2", "Book")
+	pub1 := constructNode("p1", "Publisher")
+	pub2 := constructNode("p2", "Publisher")
+
+	// Test error cases
+
+	if err := gm.SetEdgeCardinality("published-by", "book", 1, 1, true); err == nil ||
+		err.Error() != "GraphError: Invalid data (Edge kind published-by and role book must be alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.SetEdgeCardinality("publishedby", "book", 2, 1, true); err == nil ||
+		err.Error() != "GraphError: Invalid data (Invalid cardinality range: 2..1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.SetEdgeCardinality("publishedby", "book", 1, 1, true); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := gm.SetEdgeCardinality("publishedby", "publisher", 0, 2, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := fmt.Sprint(gm.EdgeCardinalities()); res != "[book:publishedby [1..1] publisher:publishedby [0..2]]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Constraints should be persisted
+
+	if res := fmt.Sprint(NewGraphManager(mgs).EdgeCardinalities()); res != "[book:publishedby [1..1] publisher:publishedby [0..2]]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Newly created nodes violate the minimum
+
+	if res, err := gm.CheckEdgeCardinality("main", book1.Key(), book1.Kind()); fmt.Sprint(res) != "[book:publishedby [1..1]]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if err := gm.StoreEdge("main", constructEdge("e1", book1, pub1)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res, err := gm.CheckEdgeCardinality("main", book1.Key(), book1.Kind()); len(res) != 0 || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Updating an existing edge is fine
+
+	if err := gm.StoreEdge("main", constructEdge("e1", book1, pub1)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// A book cannot be published twice
+
+	err := gm.StoreEdge("main", constructEdge("e2", book1, pub2))
+	if err == nil || err.(*util.GraphError).Type != util.ErrCardinality ||
+		err.Error() != "GraphError: Edge cardinality constraint violated (Cannot store edge e2 - node b1 (Book) can have at most 1 publishedby edges as book)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Same check for transactions
+
+	trans := NewGraphTrans(gm)
+	trans.StoreEdge("main", constructEdge("e2", book1, pub2))
+
+	if err := trans.Commit(); err == nil || err.(*util.GraphError).Type != util.ErrCardinality {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if cnt := gm.EdgeCount("publishedby"); cnt != 1 {
+		t.Error("Unexpected edge count:", cnt)
+		return
+	}
+
+	if err := gm.StoreEdge("main", constructEdge("e2", book2, pub1)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	book3 := constructNode("b3", "Book")
+
+	err = gm.StoreEdge("main", constructEdge("e3", book3, pub1))
+	if err == nil || err.Error() != "GraphError: Edge cardinality constraint violated (Cannot store edge e3 - node p1 (Publisher) can have at most 2 publishedby edges as publisher)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Removing the edge would violate the strict minimum of the book
+
+	if _, err := gm.RemoveEdge("main", "e1", "publishedby"); err == nil ||
+		err.Error() != "GraphError: Edge cardinality constraint violated (Cannot remove edge e1 - node b1 (Book) must have at least 1 publishedby edges as book)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Removing the publisher would also violate the strict minimum of the books
+
+	trans = NewGraphTrans(gm)
+	trans.RemoveNode("main", pub1.Key(), pub1.Kind())
+
+	if err := trans.Commit(); err == nil || err.(*util.GraphError).Type != util.ErrCardinality {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Removing a book is fine since it takes the edge with it
+
+	if _, err := gm.RemoveNode("main", book2.Key(), book2.Kind()); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if cnt := gm.EdgeCount("publishedby"); cnt != 1 {
+		t.Error("Unexpected edge count:", cnt)
+		return
+	}
+
+	// With a non-strict minimum removals are only reported
+
+	if err := gm.SetEdgeCardinality("publishedby", "book", 1, 1, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := gm.RemoveEdge("main", "e1", "publishedby"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res, err := gm.CheckEdgeCardinality("main", book1.Key(), book1.Kind()); fmt.Sprint(res) != "[book:publishedby [1..1]]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if err := gm.RemoveEdgeCardinality("publishedby", "book"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := gm.RemoveEdgeCardinality("publishedby", "book"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := fmt.Sprint(gm.EdgeCardinalities()); res != "[publisher:publishedby [0..2]]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res, err := gm.CheckEdgeCardinality("main", book1.Key(), book1.Kind()); len(res) != 0 || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+}
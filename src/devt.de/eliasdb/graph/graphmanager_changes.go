@@ -0,0 +1,134 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"sync"
+
+	"devt.de/eliasdb/graph/data"
+)
+
+/*
+ChangeEvent describes a committed change of a node or edge.
+*/
+type ChangeEvent struct {
+	Event int       // Graph event of the change (e.g. EventNodeCreated)
+	Part  string    // Partition of the node or edge
+	Node  data.Node // Changed node or edge (the removed item for delete events)
+	Old   data.Node // Old node or edge of update events (nil otherwise)
+}
+
+/*
+IsEdge returns if the change event is about an edge.
+*/
+func (ce *ChangeEvent) IsEdge() bool {
+	return ce.Event == EventEdgeCreated || ce.Event == EventEdgeUpdated ||
+		ce.Event == EventEdgeDeleted
+}
+
+/*
+ChangeHandler is called for every committed change of a node or edge. Handlers
+are called synchronously while the changed partitions are still locked - they
+must return quickly, must not modify the given nodes and must not use the
+graph manager.
+*/
+type ChangeHandler func(e *ChangeEvent)
+
+/*
+changeFeed data structure which holds all change handlers of a graph manager.
+*/
+type changeFeed struct {
+	handlers map[int]ChangeHandler // Map of subscription IDs to handlers
+	nextID   int                   // Next subscription ID
+	lock     *sync.RWMutex         // Lock to protect the handlers
+}
+
+/*
+newChangeFeed creates a new changeFeed instance.
+*/
+func newChangeFeed() *changeFeed {
+	return &changeFeed{make(map[int]ChangeHandler), 1, &sync.RWMutex{}}
+}
+
+/*
+SubscribeChanges registers a handler which is called for every change of a
+node or edge once it was committed. Changes which are rolled back are never
+published. Returns an ID which can be used to remove the handler.
+*/
+func (gm *Manager) SubscribeChanges(handler ChangeHandler) int {
+	cf := gm.gr.feed
+
+	cf.lock.Lock()
+	defer cf.lock.Unlock()
+
+	id := cf.nextID
+	cf.nextID++
+
+	cf.handlers[id] = handler
+
+	return id
+}
+
+/*
+UnsubscribeChanges removes a change handler with a given subscription ID.
+*/
+func (gm *Manager) UnsubscribeChanges(id int) {
+	cf := gm.gr.feed
+
+	cf.lock.Lock()
+	defer cf.lock.Unlock()
+
+	delete(cf.handlers, id)
+}
+
+/*
+record records a graph event in a transaction if there are any change
+handlers. Recorded events are published once the transaction was committed.
+*/
+func (cf *changeFeed) record(trans *Trans, event int, ed ...interface{}) {
+
+	cf.lock.RLock()
+	active := len(cf.handlers) > 0
+	cf.lock.RUnlock()
+
+	if !active {
+		return
+	}
+
+	e := &ChangeEvent{event, ed[0].(string), ed[1].(data.Node), nil}
+
+	if len(ed) > 2 {
+		if old, ok := ed[2].(data.Node); ok {
+			e.Old = old
+		}
+	}
+
+	trans.changes = append(trans.changes, e)
+}
+
+/*
+publish calls all change handlers with given change events.
+*/
+func (cf *changeFeed) publish(changes []*ChangeEvent) {
+
+	if len(changes) == 0 {
+		return
+	}
+
+	cf.lock.RLock()
+	defer cf.lock.RUnlock()
+
+	for _, e := range changes {
+		for _, handler := range cf.handlers {
+			handler(e)
+		}
+	}
+}
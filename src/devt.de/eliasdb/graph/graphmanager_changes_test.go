@@ -0,0 +1,133 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+func TestChangeFeed(t *testing.T) {
+
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	var changes []string
+
+	id := gm.SubscribeChanges(func(e *ChangeEvent) {
+		old := ""
+		if e.Old != nil {
+			old = fmt.Sprint(" ", e.Old.Attr("name"))
+		}
+		changes = append(changes, fmt.Sprint(e.Event, " ", e.Part, " ", e.Node.Kind(), " ",
+			e.Node.Key(), " ", e.IsEdge(), old))
+	})
+
+	newNode := func(key string, name string) data.Node {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "Song")
+		node.SetAttr("name", name)
+		return node
+	}
+
+	newEdge := func(key string) data.Edge {
+		edge := data.NewGraphEdge()
+		edge.SetAttr("key", key)
+		edge.SetAttr("kind", "Link")
+		edge.SetAttr(data.EdgeEnd1Key, "1")
+		edge.SetAttr(data.EdgeEnd1Kind, "Song")
+		edge.SetAttr(data.EdgeEnd1Role, "prev")
+		edge.SetAttr(data.EdgeEnd1Cascading, false)
+		edge.SetAttr(data.EdgeEnd2Key, "2")
+		edge.SetAttr(data.EdgeEnd2Kind, "Song")
+		edge.SetAttr(data.EdgeEnd2Role, "next")
+		edge.SetAttr(data.EdgeEnd2Cascading, false)
+		return edge
+	}
+
+	checkChanges := func(expected ...string) bool {
+		res := strings.Join(changes, "\n")
+		changes = nil
+		if res != strings.Join(expected, "\n") {
+			t.Error("Unexpected result:", res)
+			return false
+		}
+		return true
+	}
+
+	// Changes of single operations are published
+
+	gm.StoreNode("main", newNode("1", "foo"))
+	gm.StoreNode("main", newNode("2", "bar"))
+	gm.StoreNode("main", newNode("1", "foo2"))
+	gm.StoreEdge("main", newEdge("e1"))
+
+	if !checkChanges("1 main Song 1 false", "1 main Song 2 false",
+		"2 main Song 1 false foo", "4 main Link e1 true") {
+		return
+	}
+
+	// Changes caused by rules are published as well
+
+	gm.RemoveNode("main", "2", "Song")
+
+	if !checkChanges("3 main Song 2 false", "6 main Link e1 true") {
+		return
+	}
+
+	// Changes of transactions are published after the commit
+
+	trans := NewGraphTrans(gm)
+	trans.StoreNode("other", newNode("3", "baz"))
+
+	if !checkChanges() {
+		return
+	}
+
+	if err := trans.Commit(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !checkChanges("1 other Song 3 false") {
+		return
+	}
+
+	// Changes of failed transactions are not published
+
+	trans = NewGraphTrans(gm)
+	trans.StoreNode("other", newNode("4", "baz"))
+	trans.StoreEdge("other", newEdge("e2"))
+
+	if err := trans.Commit(); err == nil {
+		t.Error("Commit should fail")
+		return
+	}
+
+	if !checkChanges() {
+		return
+	}
+
+	// Removed handlers are not called
+
+	gm.UnsubscribeChanges(id)
+
+	gm.StoreNode("main", newNode("5", "foo"))
+
+	if !checkChanges() {
+		return
+	}
+}
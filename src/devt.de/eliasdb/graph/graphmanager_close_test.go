@@ -0,0 +1,165 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+	"devt.de/eliasdb/graph/util"
+	"devt.de/eliasdb/storage/file"
+)
+
+func TestClose(t *testing.T) {
+	if !RunDiskStorageTests {
+		return
+	}
+
+	dgs, err := graphstorage.NewDiskGraphStorage(GraphManagerTestDBDir8, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	gm := NewGraphManager(dgs)
+
+	for _, key := range []string{"a", "b", "c"} {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "mynode")
+		node.SetAttr("name", "Node "+key)
+
+		if err := gm.StoreNode("main", node); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	edge := data.NewGraphEdge()
+	edge.SetAttr("key", "e1")
+	edge.SetAttr("kind", "myedge")
+	edge.SetAttr(data.EdgeEnd1Key, "a")
+	edge.SetAttr(data.EdgeEnd1Kind, "mynode")
+	edge.SetAttr(data.EdgeEnd1Role, "src")
+	edge.SetAttr(data.EdgeEnd1Cascading, false)
+	edge.SetAttr(data.EdgeEnd2Key, "b")
+	edge.SetAttr(data.EdgeEnd2Kind, "mynode")
+	edge.SetAttr(data.EdgeEnd2Role, "dst")
+	edge.SetAttr(data.EdgeEnd2Cascading, false)
+
+	if err := gm.StoreEdge("main", edge); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Use a transaction which is still open when the manager is closed
+
+	trans := NewGraphTrans(gm)
+
+	node := data.NewGraphNode()
+	node.SetAttr("key", "d")
+	node.SetAttr("kind", "mynode")
+
+	if err := trans.StoreNode("main", node); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := gm.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// All transaction logs should be empty after closing
+
+	logs, _ := filepath.Glob(filepath.Join(GraphManagerTestDBDir8, "*."+file.LogFileSuffix))
+
+	if len(logs) == 0 {
+		t.Error("No transaction logs found")
+		return
+	}
+
+	for _, log := range logs {
+		if info, err := os.Stat(log); err != nil || info.Size() != int64(len(file.TransactionLogHeader)) {
+			t.Error("Unexpected transaction log:", log, info.Size(), err)
+			return
+		}
+	}
+
+	// The manager cannot be used anymore
+
+	if err := gm.Close(); err == nil || err.(*util.GraphError).Type != util.ErrClosed {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := gm.FetchNode("main", "a", "mynode"); err == nil ||
+		err.Error() != "GraphError: Graph manager was closed (Graph "+GraphManagerTestDBDir8+")" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.StoreNode("main", node); err == nil || err.(*util.GraphError).Type != util.ErrClosed {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := trans.Commit(); err == nil || err.(*util.GraphError).Type != util.ErrClosed {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Reopen the graph storage
+
+	dgs, err = graphstorage.NewDiskGraphStorage(GraphManagerTestDBDir8, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	gm = NewGraphManager(dgs)
+	defer gm.Close()
+
+	if res := gm.NodeCount("mynode"); res != 3 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := gm.EdgeCount("myedge"); res != 1 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if node, err := gm.FetchNode("main", "c", "mynode"); err != nil || node.Attr("name") != "Node c" {
+		t.Error("Unexpected result:", node, err)
+		return
+	}
+
+	if node, err := gm.FetchNode("main", "d", "mynode"); err != nil || node != nil {
+		t.Error("Unexpected result:", node, err)
+		return
+	}
+
+	if nodes, _, err := gm.TraverseMulti("main", "a", "mynode", ":::", false); err != nil || len(nodes) != 1 {
+		t.Error("Unexpected result:", nodes, err)
+		return
+	}
+
+	iq, _ := gm.NodeIndexQuery("main", "mynode")
+
+	if res, err := iq.LookupValue("name", "Node b"); err != nil || len(res) != 1 || res[0] != "b" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+}
@@ -0,0 +1,310 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"encoding/gob"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"devt.de/common/stringutil"
+	"devt.de/eliasdb/graph/util"
+)
+
+/*
+compressedValue is an internal structure which marks a compressed attribute
+value in the datastore.
+*/
+type compressedValue struct {
+	Compressor string // Name of the compressor which compressed the value
+	Size       int    // Size of the uncompressed value
+	Data       []byte // Compressed value
+}
+
+func init() {
+
+	// Make sure we can use the relevant types in a gob operation
+
+	gob.Register(&compressedValue{})
+}
+
+/*
+compressors holds all known compressors.
+*/
+var compressors = map[string]util.Compressor{
+	"zlib": &util.ZlibCompressor{},
+}
+
+/*
+compressorsLock protects the map of known compressors.
+*/
+var compressorsLock = &sync.RWMutex{}
+
+/*
+CompressionBatchSize is the number of nodes which are processed while holding
+the writer lock by CompressNodeAttributes.
+*/
+var CompressionBatchSize = 1000
+
+/*
+RegisterCompressor registers a compressor which can then be used for
+attribute compression. A compressor must be registered before any value
+which was compressed by it can be read.
+*/
+func RegisterCompressor(compressor util.Compressor) {
+	compressorsLock.Lock()
+	defer compressorsLock.Unlock()
+
+	compressors[compressor.Name()] = compressor
+}
+
+/*
+lookupCompressor returns a registered compressor. Returns nil if the
+compressor is not known.
+*/
+func lookupCompressor(name string) util.Compressor {
+	compressorsLock.RLock()
+	defer compressorsLock.RUnlock()
+
+	return compressors[name]
+}
+
+/*
+SetAttributeCompression sets the size threshold above which string attribute
+values of nodes and edges of a given kind are stored compressed. A threshold
+of 0 disables the compression. Compressed values are transparently
+decompressed when they are read - only the attributes which are actually
+fetched are decompressed. Already stored values are not changed (see
+CompressNodeAttributes). The settings are persisted in the main database.
+*/
+func (gm *Manager) SetAttributeCompression(kind string, threshold int, compressor string) error {
+
+	if !stringutil.IsAlphaNumeric(kind) {
+		return &util.GraphError{
+			Type:   util.ErrInvalidData,
+			Detail: fmt.Sprintf("Kind %v is not alphanumeric - can only contain [a-zA-Z0-9_]", kind),
+		}
+	} else if threshold < 0 {
+		return &util.GraphError{
+			Type:   util.ErrInvalidData,
+			Detail: fmt.Sprintf("Invalid compression threshold: %v", threshold),
+		}
+	} else if threshold > 0 && lookupCompressor(compressor) == nil {
+		return &util.GraphError{
+			Type:   util.ErrInvalidData,
+			Detail: fmt.Sprintf("Unknown compressor: %v", compressor),
+			Cause:  util.ErrNotFound,
+		}
+	}
+
+	// Take global writer lock
+
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	gm.updateMainDBMap(MainDBAttrCompression+kind, func(map[string]string) map[string]string {
+		if threshold == 0 {
+			return map[string]string{}
+		}
+
+		return map[string]string{
+			"threshold":  fmt.Sprint(threshold),
+			"compressor": compressor,
+		}
+	})
+
+	return gm.flushMain()
+}
+
+/*
+AttributeCompression returns the compression threshold and the name of the
+compressor of a given kind. Returns a threshold of 0 if the compression is
+disabled.
+*/
+func (gm *Manager) AttributeCompression(kind string) (int, string) {
+	settings := gm.getMainDBMap(MainDBAttrCompression + kind)
+
+	if len(settings) == 0 {
+		return 0, ""
+	}
+
+	threshold, _ := strconv.Atoi(settings["threshold"])
+
+	return threshold, settings["compressor"]
+}
+
+/*
+CompressionSavings returns the number of bytes which are currently saved by
+compressing attribute values of a given kind.
+*/
+func (gm *Manager) CompressionSavings(kind string) uint64 {
+	return gm.readCount(MainDBCompressionSaved + kind)
+}
+
+/*
+CompressNodeAttributes compresses all existing attribute values of nodes of a
+given kind in a given partition which exceed the configured compression
+threshold. The node storage is processed in batches - the writer lock of the
+partition is only held for a single batch. Returns the number of values which
+were compressed.
+*/
+func (gm *Manager) CompressNodeAttributes(part string, kind string) (int, error) {
+
+	if err := gm.checkPartitionName(part); err != nil {
+		return 0, err
+	} else if threshold, _ := gm.AttributeCompression(kind); threshold == 0 {
+		return 0, &util.GraphError{
+			Type:   util.ErrInvalidData,
+			Detail: fmt.Sprintf("Attribute compression is not enabled for kind %v", kind),
+		}
+	}
+
+	lock := func() func() {
+		return gm.writeLock(part)
+	}
+
+	unlock := lock()
+	attTree, valTree, err := gm.getNodeStorageHTree(part, kind, false)
+	unlock()
+
+	if err != nil || attTree == nil || valTree == nil {
+		return 0, err
+	}
+
+	count := 0
+
+	// Values are only replaced in the second tree - the attribute lists in
+	// the first tree can be safely iterated
+
+	err = iterateKeyBatchesWithLock(attTree, PrefixNSAttrs, CompressionBatchSize, lock,
+		func(batch []string) error {
+
+			for _, k := range batch {
+				key := k[len(PrefixNSAttrs):]
+
+				attrList, err := attTree.Get([]byte(k))
+				if err != nil {
+					return &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
+				} else if attrList == nil {
+					continue
+				}
+
+				for _, encattr := range attrList.([]string) {
+					valKey := []byte(PrefixNSAttr + key + encattr)
+
+					val, err := valTree.Get(valKey)
+					if err != nil {
+						return &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
+					}
+
+					if _, ok := val.(string); !ok {
+						continue
+					}
+
+					cval, err := gm.compressAttrValue(kind, val)
+					if err != nil {
+						return err
+					} else if _, ok := cval.(*compressedValue); !ok {
+						continue
+					}
+
+					if _, err := valTree.Put(valKey, cval); err != nil {
+						return &util.GraphError{Type: util.ErrWriting, Detail: err.Error(), Cause: err}
+					}
+
+					count++
+				}
+			}
+
+			gm.flushMain()
+
+			return gm.flushNodeStorage(part, kind)
+		})
+
+	return count, err
+}
+
+/*
+compressAttrValue returns the value which should be stored for a given
+attribute value of a given kind. String values above the compression
+threshold are compressed and the savings are added to the compression
+statistics.
+*/
+func (gm *Manager) compressAttrValue(kind string, val interface{}) (interface{}, error) {
+
+	s, ok := val.(string)
+	if !ok {
+		return val, nil
+	}
+
+	threshold, name := gm.AttributeCompression(kind)
+	if threshold == 0 || len(s) <= threshold {
+		return val, nil
+	}
+
+	compressor := lookupCompressor(name)
+	if compressor == nil {
+		return nil, &util.GraphError{
+			Type:   util.ErrWriting,
+			Detail: fmt.Sprintf("Unknown compressor: %v", name),
+			Cause:  util.ErrNotFound,
+		}
+	}
+
+	data, err := compressor.Compress([]byte(s))
+	if err != nil {
+		return nil, &util.GraphError{Type: util.ErrWriting, Detail: err.Error(), Cause: err}
+	}
+
+	// Only store the compressed value if it is actually smaller
+
+	if len(data) >= len(s) {
+		return val, nil
+	}
+
+	gm.addCount(MainDBCompressionSaved+kind, len(s)-len(data), false)
+
+	return &compressedValue{name, len(s), data}, nil
+}
+
+/*
+decompressAttrValue returns the original attribute value of a stored value
+of a given kind. The savings of the stored value are subtracted from the
+compression statistics if the value was removed from the datastore.
+*/
+func (gm *Manager) decompressAttrValue(kind string, val interface{}, removed bool) (interface{}, error) {
+
+	cval, ok := val.(*compressedValue)
+	if !ok {
+		return val, nil
+	}
+
+	if removed {
+		gm.addCount(MainDBCompressionSaved+kind, len(cval.Data)-cval.Size, false)
+	}
+
+	compressor := lookupCompressor(cval.Compressor)
+	if compressor == nil {
+		return nil, &util.GraphError{
+			Type:   util.ErrReading,
+			Detail: fmt.Sprintf("Unknown compressor: %v", cval.Compressor),
+			Cause:  util.ErrNotFound,
+		}
+	}
+
+	data, err := compressor.Decompress(cval.Data)
+	if err != nil {
+		return nil, &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,288 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+func TestAttributeCompression(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	text := strings.Repeat("All work and no play makes Jack a dull boy. ", 50)
+
+	storeNode := func(key string, attrs map[string]interface{}) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "Book")
+
+		for k, v := range attrs {
+			node.SetAttr(k, v)
+		}
+
+		if err := gm.StoreNode("main", node); err != nil {
+			t.Error(err)
+		}
+	}
+
+	storedValue := func(key string, attr string) interface{} {
+		_, valTree, _ := gm.getNodeStorageHTree("main", "Book", false)
+		val, _ := valTree.Get([]byte(PrefixNSAttr + key + gm.encode32(attr, false)))
+		return val
+	}
+
+	isCompressed := func(key string, attr string) bool {
+		_, ok := storedValue(key, attr).(*compressedValue)
+		return ok
+	}
+
+	storeNode("b0", map[string]interface{}{"text": text})
+
+	// Test error cases
+
+	if err := gm.SetAttributeCompression("Bo-ok", 100, "zlib"); err == nil ||
+		err.Error() != "GraphError: Invalid data (Kind Bo-ok is not alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.SetAttributeCompression("Book", -1, "zlib"); err == nil ||
+		err.Error() != "GraphError: Invalid data (Invalid compression threshold: -1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.SetAttributeCompression("Book", 100, "foo"); err == nil ||
+		err.Error() != "GraphError: Invalid data (Unknown compressor: foo)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := gm.CompressNodeAttributes("main", "Book"); err == nil ||
+		err.Error() != "GraphError: Invalid data (Attribute compression is not enabled for kind Book)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Enable compression
+
+	if err := gm.SetAttributeCompression("Book", 100, "zlib"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if threshold, name := gm.AttributeCompression("Book"); threshold != 100 || name != "zlib" {
+		t.Error("Unexpected result:", threshold, name)
+		return
+	}
+
+	// Only large string values are compressed
+
+	storeNode("b1", map[string]interface{}{"text": text, "title": "The Shining", "pages": 447})
+
+	if !isCompressed("b1", "text") || isCompressed("b1", "title") || isCompressed("b1", "pages") {
+		t.Error("Unexpected storage:", storedValue("b1", "text"), storedValue("b1", "title"))
+		return
+	}
+
+	saved := gm.CompressionSavings("Book")
+
+	if cval := storedValue("b1", "text").(*compressedValue); saved == 0 ||
+		saved != uint64(len(text)-len(cval.Data)) || cval.Size != len(text) {
+		t.Error("Unexpected result:", saved, cval)
+		return
+	}
+
+	// Values are transparently decompressed
+
+	if node, err := gm.FetchNode("main", "b1", "Book"); err != nil || node.Attr("text") != text ||
+		node.Attr("title") != "The Shining" || node.Attr("pages") != 447 {
+		t.Error("Unexpected result:", node, err)
+		return
+	}
+
+	if node, err := gm.FetchNodePart("main", "b1", "Book", []string{"title"}); err != nil ||
+		fmt.Sprint(node.Data()) != "map[key:b1 kind:Book title:The Shining]" {
+		t.Error("Unexpected result:", node, err)
+		return
+	}
+
+	// The index contains the uncompressed text
+
+	iq, _ := gm.NodeIndexQuery("main", "Book")
+
+	if res, err := iq.LookupWord("text", "jack"); err != nil || len(res["b1"]) != 50 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Updated values are reported uncompressed and the savings are adjusted
+
+	update := data.NewGraphNode()
+	update.SetAttr("key", "b1")
+	update.SetAttr("kind", "Book")
+	update.SetAttr("text", "short")
+
+	if err := gm.UpdateNode("main", update); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := gm.CompressionSavings("Book"); res != 0 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res, _ := iq.LookupWord("text", "jack"); res["b1"] != nil {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	storeNode("b1", map[string]interface{}{"text": text})
+
+	if res := gm.CompressionSavings("Book"); res != saved {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Removed nodes are returned uncompressed
+
+	if node, err := gm.RemoveNode("main", "b1", "Book"); err != nil || node.Attr("text") != text {
+		t.Error("Unexpected result:", node, err)
+		return
+	}
+
+	if res := gm.CompressionSavings("Book"); res != 0 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Compress existing values
+
+	if isCompressed("b0", "text") {
+		t.Error("Value should not be compressed")
+		return
+	}
+
+	if res, err := gm.CompressNodeAttributes("main", "Book"); res != 1 || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gm.CompressNodeAttributes("main", "Book"); res != 0 || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if !isCompressed("b0", "text") || gm.CompressionSavings("Book") != saved {
+		t.Error("Unexpected result:", storedValue("b0", "text"), gm.CompressionSavings("Book"))
+		return
+	}
+
+	if node, err := gm.FetchNode("main", "b0", "Book"); err != nil || node.Attr("text") != text {
+		t.Error("Unexpected result:", node, err)
+		return
+	}
+
+	// Disabling the compression keeps existing values readable
+
+	if err := gm.SetAttributeCompression("Book", 0, ""); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if threshold, _ := gm.AttributeCompression("Book"); threshold != 0 {
+		t.Error("Unexpected result:", threshold)
+		return
+	}
+
+	storeNode("b2", map[string]interface{}{"text": text})
+
+	if isCompressed("b2", "text") {
+		t.Error("Value should not be compressed")
+		return
+	}
+
+	if node, err := gm.FetchNode("main", "b0", "Book"); err != nil || node.Attr("text") != text {
+		t.Error("Unexpected result:", node, err)
+		return
+	}
+
+	// Values of an unknown compressor cannot be read
+
+	storedValue("b0", "text").(*compressedValue).Compressor = "foo"
+
+	if _, err := gm.FetchNode("main", "b0", "Book"); err == nil ||
+		err.Error() != "GraphError: Could not read graph information (Unknown compressor: foo)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestAttributeCompressionDiskStorage(t *testing.T) {
+	if !RunDiskStorageTests {
+		return
+	}
+
+	text := strings.Repeat("All work and no play makes Jack a dull boy. ", 50)
+
+	dgs, err := graphstorage.NewDiskGraphStorage(GraphManagerTestDBDir7, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	gm := NewGraphManager(dgs)
+
+	if err := gm.SetAttributeCompression("Book", 100, "zlib"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	node := data.NewGraphNode()
+	node.SetAttr("key", "b1")
+	node.SetAttr("kind", "Book")
+	node.SetAttr("text", text)
+
+	if err := gm.StoreNode("main", node); err != nil {
+		t.Error(err)
+		return
+	}
+
+	saved := gm.CompressionSavings("Book")
+
+	dgs.Close()
+
+	dgs, err = graphstorage.NewDiskGraphStorage(GraphManagerTestDBDir7, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer dgs.Close()
+
+	gm = NewGraphManager(dgs)
+
+	if res := gm.CompressionSavings("Book"); res == 0 || res != saved {
+		t.Error("Unexpected result:", res, saved)
+		return
+	}
+
+	if node, err := gm.FetchNode("main", "b1", "Book"); err != nil || node.Attr("text") != text {
+		t.Error("Unexpected result:", node, err)
+		return
+	}
+}
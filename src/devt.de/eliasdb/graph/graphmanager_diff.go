@@ -0,0 +1,233 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import "devt.de/eliasdb/graph/data"
+
+/*
+Types of differences between two partitions
+*/
+const (
+	DiffOnlyInA = "onlyA"   // Item only exists in the first partition
+	DiffOnlyInB = "onlyB"   // Item only exists in the second partition
+	DiffChanged = "changed" // Item exists in both partitions with different attributes
+)
+
+/*
+DiffEntry describes a difference of a single node or edge between two
+partitions.
+*/
+type DiffEntry struct {
+	Type   string   // Type of the difference
+	Kind   string   // Kind of the node or edge
+	Key    string   // Key of the node or edge
+	IsEdge bool     // Flag if the entry describes an edge
+	Attrs  []string // Sorted names of the differing attributes (only for DiffChanged)
+}
+
+/*
+DiffFunc is called for every difference which is found by Diff. Returning an
+error stops the comparison.
+*/
+type DiffFunc func(entry *DiffEntry) error
+
+/*
+Diff compares the nodes and edges of the given kinds in two partitions and
+calls a given function for every difference. Every given kind is compared as
+node kind and as edge kind - all known node and edge kinds are compared if no
+kinds are given. Kinds are compared one after another - the keys of both
+partitions are visited in lexicographic order with a merge-style comparison
+so neither partition is loaded into memory. Attributes are compared with
+data.NodeCompareDetailed. Items are fetched individually, changes which
+happen during the comparison may or may not be reported.
+*/
+func (gm *Manager) Diff(partA string, partB string, kinds []string, f DiffFunc) error {
+
+	if err := gm.checkPartitionName(partA); err != nil {
+		return err
+	} else if err := gm.checkPartitionName(partB); err != nil {
+		return err
+	}
+
+	nodeKinds, edgeKinds := kinds, kinds
+
+	if len(kinds) == 0 {
+		nodeKinds = gm.NodeKinds()
+		edgeKinds = gm.EdgeKinds()
+	}
+
+	for _, kind := range nodeKinds {
+		if err := gm.diffKind(partA, partB, kind, false, f); err != nil {
+			return err
+		}
+	}
+
+	for _, kind := range edgeKinds {
+		if err := gm.diffKind(partA, partB, kind, true, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+diffKind compares the nodes or edges of a single kind in two partitions.
+*/
+func (gm *Manager) diffKind(partA string, partB string, kind string, isEdge bool, f DiffFunc) error {
+
+	itA, err := gm.sortedKeyIterator(partA, kind, isEdge)
+	if err != nil {
+		return err
+	}
+
+	itB, err := gm.sortedKeyIterator(partB, kind, isEdge)
+	if err != nil {
+		return err
+	}
+
+	// Get the next key of an iterator - a missing iterator has no keys
+
+	next := func(it *SortedNodeKeyIterator) (string, bool, error) {
+		if it == nil {
+			return "", false, nil
+		} else if !it.HasNext() {
+			return "", false, it.LastError
+		}
+		return it.Next(), true, nil
+	}
+
+	keyA, okA, err := next(itA)
+	if err != nil {
+		return err
+	}
+
+	keyB, okB, err := next(itB)
+	if err != nil {
+		return err
+	}
+
+	for err == nil && (okA || okB) {
+		var entry *DiffEntry
+
+		if okA && (!okB || keyA < keyB) {
+
+			entry = &DiffEntry{DiffOnlyInA, kind, keyA, isEdge, nil}
+			keyA, okA, err = next(itA)
+
+		} else if okB && (!okA || keyB < keyA) {
+
+			entry = &DiffEntry{DiffOnlyInB, kind, keyB, isEdge, nil}
+			keyB, okB, err = next(itB)
+
+		} else {
+
+			if entry, err = gm.diffItem(partA, partB, keyA, kind, isEdge); err == nil {
+				if keyA, okA, err = next(itA); err == nil {
+					keyB, okB, err = next(itB)
+				}
+			}
+		}
+
+		if err == nil && entry != nil {
+			err = f(entry)
+		}
+	}
+
+	return err
+}
+
+/*
+diffItem compares a single node or edge which exists in both partitions.
+Returns nil if there is no difference.
+*/
+func (gm *Manager) diffItem(partA string, partB string, key string, kind string,
+	isEdge bool) (*DiffEntry, error) {
+
+	itemA, err := gm.readDiffItem(partA, key, kind, isEdge)
+	if err != nil {
+		return nil, err
+	}
+
+	itemB, err := gm.readDiffItem(partB, key, kind, isEdge)
+	if err != nil {
+		return nil, err
+	}
+
+	// Items might have been removed since their keys were read
+
+	if itemA == nil && itemB == nil {
+		return nil, nil
+	} else if itemB == nil {
+		return &DiffEntry{DiffOnlyInA, kind, key, isEdge, nil}, nil
+	} else if itemA == nil {
+		return &DiffEntry{DiffOnlyInB, kind, key, isEdge, nil}, nil
+	}
+
+	equal, attrs := data.NodeCompareDetailed(itemA, itemB, nil)
+
+	if equal {
+		return nil, nil
+	}
+
+	return &DiffEntry{DiffChanged, kind, key, isEdge, attrs}, nil
+}
+
+/*
+readDiffItem reads a node or an edge with all its attributes. Returns nil if
+the item does not exist.
+*/
+func (gm *Manager) readDiffItem(part string, key string, kind string, isEdge bool) (data.Node, error) {
+
+	// Take reader lock
+
+	defer gm.readLock(part)()
+
+	if isEdge {
+		tree, err := gm.getEdgeStorageHTree(part, kind, false)
+		if err != nil || tree == nil {
+			return nil, err
+		}
+
+		return gm.readNode(key, kind, nil, tree, tree)
+	}
+
+	attTree, valTree, err := gm.getNodeStorageHTree(part, kind, false)
+	if err != nil || attTree == nil || valTree == nil {
+		return nil, err
+	}
+
+	return gm.readNode(key, kind, nil, attTree, valTree)
+}
+
+/*
+sortedKeyIterator returns a sorted iterator over the node or edge keys of a
+given kind. Returns nil if the kind does not exist in the partition.
+*/
+func (gm *Manager) sortedKeyIterator(part string, kind string, isEdge bool) (*SortedNodeKeyIterator, error) {
+
+	if !isEdge {
+		return gm.SortedNodeKeyIterator(part, kind)
+	}
+
+	// Take reader lock
+
+	defer gm.readLock(part)()
+
+	// Edges are stored like nodes but in a single HTree
+
+	tree, err := gm.getEdgeStorageHTree(part, kind, false)
+	if err != nil || tree == nil {
+		return nil, err
+	}
+
+	return &SortedNodeKeyIterator{gm, part, tree, nil, "", "", false, false, nil}, nil
+}
@@ -0,0 +1,162 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+func TestDiff(t *testing.T) {
+
+	oldChunkSize := SortedIterationChunkSize
+	SortedIterationChunkSize = 2
+	defer func() {
+		SortedIterationChunkSize = oldChunkSize
+	}()
+
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	storeNode := func(part string, key string, attrs map[string]interface{}) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "Song")
+
+		for k, v := range attrs {
+			node.SetAttr(k, v)
+		}
+
+		if err := gm.StoreNode(part, node); err != nil {
+			t.Error(err)
+		}
+	}
+
+	storeEdge := func(part string, key string, end1 string, end2 string, weight int) {
+		edge := data.NewGraphEdge()
+		edge.SetAttr("key", key)
+		edge.SetAttr("kind", "Link")
+		edge.SetAttr(data.EdgeEnd1Key, end1)
+		edge.SetAttr(data.EdgeEnd1Kind, "Song")
+		edge.SetAttr(data.EdgeEnd1Role, "prev")
+		edge.SetAttr(data.EdgeEnd1Cascading, false)
+		edge.SetAttr(data.EdgeEnd2Key, end2)
+		edge.SetAttr(data.EdgeEnd2Kind, "Song")
+		edge.SetAttr(data.EdgeEnd2Role, "next")
+		edge.SetAttr(data.EdgeEnd2Cascading, false)
+		edge.SetAttr("weight", weight)
+
+		if err := gm.StoreEdge(part, edge); err != nil {
+			t.Error(err)
+		}
+	}
+
+	for _, part := range []string{"main", "staging"} {
+		for i := 0; i < 5; i++ {
+			storeNode(part, fmt.Sprintf("s%v", i), map[string]interface{}{"name": fmt.Sprintf("Song %v", i)})
+		}
+		storeEdge(part, "e1", "s1", "s2", 1)
+		storeEdge(part, "e2", "s2", "s3", 1)
+	}
+
+	diff := func(kinds []string) string {
+		var res []string
+
+		if err := gm.Diff("main", "staging", kinds, func(entry *DiffEntry) error {
+			res = append(res, fmt.Sprint(*entry))
+			return nil
+		}); err != nil {
+			return err.Error()
+		}
+
+		return strings.Join(res, "\n")
+	}
+
+	if res := diff(nil); res != "" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	storeNode("main", "s00", nil)
+	storeNode("staging", "s6", nil)
+	storeNode("staging", "s7", nil)
+	storeNode("staging", "s2", map[string]interface{}{"name": "Song 2"})
+	storeNode("staging", "s3", map[string]interface{}{"name": "Song 3b", "year": 1999})
+	storeNode("staging", "s4", map[string]interface{}{})
+
+	storeEdge("main", "e0", "s0", "s1", 1)
+	storeEdge("staging", "e2", "s2", "s3", 2)
+
+	if res := diff(nil); res != `
+{onlyA Song s00 false []}
+{changed Song s3 false [name year]}
+{changed Song s4 false [name]}
+{onlyB Song s6 false []}
+{onlyB Song s7 false []}
+{onlyA Link e0 true []}
+{changed Link e2 true [weight]}`[1:] {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := diff([]string{"Link", "foo"}); res != `
+{onlyA Link e0 true []}
+{changed Link e2 true [weight]}`[1:] {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Kinds which only exist in one partition
+
+	node := data.NewGraphNode()
+	node.SetAttr("key", "a1")
+	node.SetAttr("kind", "Author")
+
+	if err := gm.StoreNode("staging", node); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := diff([]string{"Author"}); res != "{onlyB Author a1 false []}" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Test error cases
+
+	if err := gm.Diff("main ", "staging", nil, nil); err == nil ||
+		err.Error() != "GraphError: Invalid data (Partition name main  is not alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.Diff("main", "staging ", nil, nil); err == nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	count := 0
+
+	if err := gm.Diff("main", "staging", nil, func(entry *DiffEntry) error {
+		if count++; count == 2 {
+			return errors.New("testerror")
+		}
+		return nil
+	}); err == nil || err.Error() != "testerror" || count != 2 {
+		t.Error("Unexpected result:", err, count)
+		return
+	}
+}
@@ -11,7 +11,6 @@
 package graph
 
 import (
-	"encoding/binary"
 	"encoding/gob"
 	"fmt"
 	"sort"
@@ -30,6 +29,7 @@ type edgeTargetInfo struct {
 	CascadeFromTarget bool   // Flag if delete operations should be cascaded from the target
 	TargetNodeKey     string // Key of the target node
 	TargetNodeKind    string // Kind of the target ndoe
+	Undirected        bool   // Flag if the edge is undirected
 }
 
 func init() {
@@ -41,16 +41,83 @@ func init() {
 	gob.Register(&edgeTargetInfo{})
 }
 
+/*
+EdgeFilter is a filter for edges during a traversal. Returns true if the
+given edge should be followed.
+*/
+type EdgeFilter func(edge data.Edge) bool
+
+/*
+EdgeAttrFilter returns an edge filter which only follows edges that have all
+the given attribute values. Values are compared by their string
+representation.
+*/
+func EdgeAttrFilter(attrs map[string]interface{}) EdgeFilter {
+	return func(edge data.Edge) bool {
+		for attr, val := range attrs {
+			if eval := edge.Attr(attr); eval == nil || fmt.Sprint(eval) != fmt.Sprint(val) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
 /*
 EdgeCount returns the edge count for a given edge kind.
 */
 func (gm *Manager) EdgeCount(kind string) uint64 {
+	return gm.readCount(MainDBEdgeCount + kind)
+}
 
-	if val, ok := gm.gs.MainDB()[MainDBEdgeCount+kind]; ok {
-		return binary.LittleEndian.Uint64([]byte(val))
+/*
+PartitionEdgeCount returns the edge count for a given edge kind in a partition.
+The count is read from a maintained counter - the flag is false if no counter
+exists because the kind was stored in the partition before counters per
+partition were maintained.
+*/
+func (gm *Manager) PartitionEdgeCount(part string, kind string) (uint64, bool) {
+	count, ok := gm.readPartitionCount(partitionCountEntry(MainDBPartEdgeCount, part, kind))
+
+	if !ok && gm.gs.StorageManager(part+kind+StorageSuffixEdges, false) == nil {
+
+		// The kind was never stored in the partition
+
+		return 0, true
 	}
 
-	return 0
+	return count, ok
+}
+
+/*
+EdgeVersion returns the version of an edge. An edge gets a new and higher version
+every time it is stored. Returns 0 if the edge does not exist.
+*/
+func (gm *Manager) EdgeVersion(part string, key string, kind string) (uint64, error) {
+
+	if err := gm.checkPartitionName(part); err != nil {
+		return 0, err
+	}
+
+	// Take reader lock
+
+	defer gm.readLock(part)()
+
+	return gm.readEdgeVersion(part, key, kind)
+}
+
+/*
+readEdgeVersion reads the version of an edge. It is assumed that the caller
+holds a lock.
+*/
+func (gm *Manager) readEdgeVersion(part string, key string, kind string) (uint64, error) {
+
+	edgeTree, err := gm.existingHTree(part + kind + StorageSuffixEdges)
+	if err != nil || edgeTree == nil {
+		return 0, err
+	}
+
+	return gm.readVersion(key, edgeTree)
 }
 
 /*
@@ -58,20 +125,19 @@ FetchNodeEdgeSpecs returns all possible edge specs for a certain node.
 */
 func (gm *Manager) FetchNodeEdgeSpecs(part string, key string, kind string) ([]string, error) {
 
+	// Take reader lock
+
+	defer gm.readLock(part)()
+
 	_, tree, err := gm.getNodeStorageHTree(part, kind, false)
 	if err != nil || tree == nil {
 		return nil, err
 	}
 
-	// Take reader lock
-
-	gm.mutex.RLock()
-	defer gm.mutex.RUnlock()
-
 	specsNodeKey := PrefixNSSpecs + key
 	obj, err := tree.Get([]byte(specsNodeKey))
 	if err != nil {
-		return nil, &util.GraphError{Type: util.ErrReading, Detail: err.Error()}
+		return nil, &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
 	} else if obj == nil {
 		return nil, nil
 	}
@@ -80,13 +146,7 @@ func (gm *Manager) FetchNodeEdgeSpecs(part string, key string, kind string) ([]s
 	specsNode := make([]string, 0, len(specsNodeMap))
 
 	for spec := range specsNodeMap {
-		role1 := gm.nm.Decode16(spec[:2])
-		relKind := gm.nm.Decode16(spec[2:4])
-		role2 := gm.nm.Decode16(spec[4:6])
-		end2Kind := gm.nm.Decode16(spec[6:])
-
-		specsNode = append(specsNode,
-			role1+":"+relKind+":"+role2+":"+end2Kind)
+		specsNode = append(specsNode, gm.decodeSpec(spec))
 	}
 
 	// Ensure the output is deterministic
@@ -96,6 +156,129 @@ func (gm *Manager) FetchNodeEdgeSpecs(part string, key string, kind string) ([]s
 	return specsNode, nil
 }
 
+/*
+NodeDegree returns the number of edges of a given node which match a given
+partial edge spec. The count is taken from the stored traversal information
+of the node - no edge or node data is loaded. Since the edge spec can be
+partial it is possible to count multiple edge kinds. A spec with the value
+":::" would count all relationships. The result is consistent with the
+number of edges TraverseMulti would return for the same spec.
+*/
+func (gm *Manager) NodeDegree(part string, key string, kind string, spec string) (int, error) {
+
+	sspec := strings.Split(spec, ":")
+	if len(sspec) != 4 {
+		return 0, &util.GraphError{Type: util.ErrInvalidData, Detail: "Invalid spec: " + spec}
+	}
+
+	// Take reader lock
+
+	defer gm.readLock(part)()
+
+	_, tree, err := gm.getNodeStorageHTree(part, kind, false)
+	if err != nil || tree == nil {
+		return 0, err
+	}
+
+	return gm.readNodeDegree(key, tree, sspec)
+}
+
+/*
+NodeDegrees returns the number of edges of a given node for every edge spec
+of the node. The counts are taken from the stored traversal information of
+the node - no edge or node data is loaded.
+*/
+func (gm *Manager) NodeDegrees(part string, key string, kind string) (map[string]int, error) {
+
+	// Take reader lock
+
+	defer gm.readLock(part)()
+
+	_, tree, err := gm.getNodeStorageHTree(part, kind, false)
+	if err != nil || tree == nil {
+		return nil, err
+	}
+
+	return gm.readNodeDegrees(key, tree)
+}
+
+/*
+readNodeDegrees reads the edge counts for all specs of a given node. It is
+assumed that the caller holds the reader lock.
+*/
+func (gm *Manager) readNodeDegrees(key string, tree *hash.HTree) (map[string]int, error) {
+
+	obj, err := tree.Get([]byte(PrefixNSSpecs + key))
+	if err != nil {
+		return nil, &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
+	}
+
+	ret := make(map[string]int)
+
+	if obj == nil {
+		return ret, nil
+	}
+
+	for encspec := range obj.(map[string]string) {
+
+		// Lookup the target map which has an entry for every edge
+
+		tobj, err := tree.Get([]byte(PrefixNSEdge + key + encspec))
+		if err != nil {
+			return nil, &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
+		} else if tobj != nil {
+			ret[gm.decodeSpec(encspec)] = len(tobj.(map[string]*edgeTargetInfo))
+		}
+	}
+
+	return ret, nil
+}
+
+/*
+readNodeDegree counts the edges of a given node which match a given (split)
+partial spec. Undirected edges which match with both role orders are only
+counted once. It is assumed that the caller holds the reader lock.
+*/
+func (gm *Manager) readNodeDegree(key string, tree *hash.HTree, sspec []string) (int, error) {
+
+	obj, err := tree.Get([]byte(PrefixNSSpecs + key))
+	if err != nil {
+		return 0, &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
+	} else if obj == nil {
+		return 0, nil
+	}
+
+	ret := 0
+	undirected := make(map[string]bool)
+
+	for encspec := range obj.(map[string]string) {
+
+		if !matchSpec(sspec, gm.decodeSpec(encspec)) {
+			continue
+		}
+
+		tobj, err := tree.Get([]byte(PrefixNSEdge + key + encspec))
+		if err != nil {
+			return 0, &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
+		} else if tobj == nil {
+			continue
+		}
+
+		for edgeKey, info := range tobj.(map[string]*edgeTargetInfo) {
+			if info.Undirected {
+				ukey := encspec[2:4] + edgeKey
+				if undirected[ukey] {
+					continue
+				}
+				undirected[ukey] = true
+			}
+			ret++
+		}
+	}
+
+	return ret, nil
+}
+
 /*
 TraverseMulti traverses from a given node to other nodes following a given
 partial edge spec. Since the edge spec can be partial it is possible to
@@ -107,11 +290,24 @@ the minimal set of attributes will be populated.
 func (gm *Manager) TraverseMulti(part string, key string, kind string,
 	spec string, allData bool) ([]data.Node, []data.Edge, error) {
 
+	return gm.TraverseMultiFiltered(part, key, kind, spec, allData, nil)
+}
+
+/*
+TraverseMultiFiltered traverses from a given node to other nodes following a
+given partial edge spec like TraverseMulti. Only edges which match a given
+filter are followed - the filter is applied before the connected nodes are
+fetched. Undirected edges which match the spec with both role orders are only
+returned once.
+*/
+func (gm *Manager) TraverseMultiFiltered(part string, key string, kind string,
+	spec string, allData bool, filter EdgeFilter) ([]data.Node, []data.Edge, error) {
+
 	sspec := strings.Split(spec, ":")
 	if len(sspec) != 4 {
 		return nil, nil, &util.GraphError{Type: util.ErrInvalidData, Detail: "Invalid spec: " + spec}
 	} else if IsFullSpec(spec) {
-		return gm.Traverse(part, key, kind, spec, allData)
+		return gm.TraverseFiltered(part, key, kind, spec, allData, filter)
 	}
 
 	// Get all specs for the given node
@@ -121,37 +317,33 @@ func (gm *Manager) TraverseMulti(part string, key string, kind string,
 		return nil, nil, err
 	}
 
-	matchSpec := func(spec string) bool {
-		mspec := strings.Split(spec, ":")
-
-		// Check spec components
-
-		if (sspec[0] != "" && mspec[0] != sspec[0]) ||
-			(sspec[1] != "" && mspec[1] != sspec[1]) ||
-			(sspec[2] != "" && mspec[2] != sspec[2]) ||
-			(sspec[3] != "" && mspec[3] != sspec[3]) {
-
-			return false
-		}
-
-		return true
-	}
-
 	// Match specs and collect the results
 
 	var nodes []data.Node
 	var edges []data.Edge
 
+	undirected := make(map[string]bool)
+
 	for _, rspec := range specs {
-		if spec == ":::" || matchSpec(rspec) {
+		if spec == ":::" || matchSpec(sspec, rspec) {
 
-			sn, se, err := gm.Traverse(part, key, kind, rspec, allData)
+			sn, se, err := gm.TraverseFiltered(part, key, kind, rspec, allData, filter)
 			if err != nil {
 				return nil, nil, err
 			}
 
-			nodes = append(nodes, sn...)
-			edges = append(edges, se...)
+			for i, edge := range se {
+				if edge.IsUndirected() {
+					ukey := edge.Kind() + "#" + edge.Key()
+					if undirected[ukey] {
+						continue
+					}
+					undirected[ukey] = true
+				}
+
+				nodes = append(nodes, sn[i])
+				edges = append(edges, edge)
+			}
 		}
 	}
 
@@ -167,16 +359,28 @@ attributes will be populated.
 func (gm *Manager) Traverse(part string, key string, kind string,
 	spec string, allData bool) ([]data.Node, []data.Edge, error) {
 
+	return gm.TraverseFiltered(part, key, kind, spec, allData, nil)
+}
+
+/*
+TraverseFiltered traverses from a given node to other nodes following a given
+edge spec like Traverse. Only edges which match a given filter are followed.
+The filter gets the edge with all its attributes - end1 of the edge is always
+the start node of the traversal. Edges which do not match the filter cost only
+the edge lookup - the connected node is not fetched.
+*/
+func (gm *Manager) TraverseFiltered(part string, key string, kind string,
+	spec string, allData bool, filter EdgeFilter) ([]data.Node, []data.Edge, error) {
+
+	// Take reader lock
+
+	defer gm.readLock(part)()
+
 	_, tree, err := gm.getNodeStorageHTree(part, kind, false)
 	if err != nil || tree == nil {
 		return nil, nil, err
 	}
 
-	// Take reader lock
-
-	gm.mutex.RLock()
-	defer gm.mutex.RUnlock()
-
 	sspec := strings.Split(spec, ":")
 	if len(sspec) != 4 {
 		return nil, nil, &util.GraphError{Type: util.ErrInvalidData, Detail: "Invalid spec: " + spec}
@@ -185,8 +389,8 @@ func (gm *Manager) Traverse(part string, key string, kind string,
 			" - spec needs to be fully specified for direct traversal"}
 	}
 
-	encspec := gm.nm.Encode16(sspec[0], false) + gm.nm.Encode16(sspec[1], false) +
-		gm.nm.Encode16(sspec[2], false) + gm.nm.Encode16(sspec[3], false)
+	encspec := gm.encode16(sspec[0], false) + gm.encode16(sspec[1], false) +
+		gm.encode16(sspec[2], false) + gm.encode16(sspec[3], false)
 
 	edgeInfoKey := PrefixNSEdge + key + encspec
 
@@ -202,7 +406,7 @@ func (gm *Manager) Traverse(part string, key string, kind string,
 	nodes := make([]data.Node, 0, len(targetMap))
 	edges := make([]data.Edge, 0, len(targetMap))
 
-	if !allData {
+	if !allData && filter == nil {
 
 		// Populate nodes and edges with the minimal set of attributes
 		// no further lookups required
@@ -224,6 +428,10 @@ func (gm *Manager) Traverse(part string, key string, kind string,
 			edge.SetAttr(data.EdgeEnd2Role, sspec[2])
 			edge.SetAttr(data.EdgeEnd2Cascading, v.CascadeFromTarget)
 
+			if v.Undirected {
+				edge.SetAttr(data.EdgeUndirected, true)
+			}
+
 			edges = append(edges, edge)
 
 			node := data.NewGraphNode()
@@ -268,8 +476,25 @@ func (gm *Manager) Traverse(part string, key string, kind string,
 				swap(data.EdgeEnd1Cascading, data.EdgeEnd2Cascading)
 			}
 
+			// Skip edges which do not match the filter
+
+			if filter != nil && !filter(edge) {
+				continue
+			}
+
 			edges = append(edges, edge)
 
+			if !allData {
+				node := data.NewGraphNode()
+
+				node.SetAttr(data.NodeKey, v.TargetNodeKey)
+				node.SetAttr(data.NodeKind, v.TargetNodeKind)
+
+				nodes = append(nodes, node)
+
+				continue
+			}
+
 			// Get the HTrees which stores the node
 
 			attht, valht, err := gm.getNodeStorageHTree(part, v.TargetNodeKind, false)
@@ -302,6 +527,10 @@ FetchEdgePart fetches part of a single edge from a partition of the graph.
 func (gm *Manager) FetchEdgePart(part string, key string, kind string,
 	attrs []string) (data.Edge, error) {
 
+	// Take reader lock
+
+	defer gm.readLock(part)()
+
 	// Get the HTrees which stores the edge
 
 	edgeht, err := gm.getEdgeStorageHTree(part, kind, true)
@@ -309,11 +538,6 @@ func (gm *Manager) FetchEdgePart(part string, key string, kind string,
 		return nil, err
 	}
 
-	// Take reader lock
-
-	gm.mutex.RLock()
-	defer gm.mutex.RUnlock()
-
 	// Read the edge from the datastore
 
 	node, err := gm.readNode(key, kind, attrs, edgeht, edgeht)
@@ -333,9 +557,13 @@ func (gm *Manager) StoreEdge(part string, edge data.Edge) error {
 		return err
 	}
 
+	// Take writer lock
+
+	defer gm.writeLock(part)()
+
 	// Get the HTrees which stores the edges and the edge index
 
-	iht, err := gm.getEdgeIndexHTree(part, edge.Kind(), true)
+	im, err := gm.getEdgeIndexManager(part, edge.Kind(), true)
 	if err != nil {
 		return err
 	}
@@ -356,11 +584,16 @@ func (gm *Manager) StoreEdge(part string, edge data.Edge) error {
 		return &util.GraphError{
 			Type:   util.ErrInvalidData,
 			Detail: "Can't store edge to non-existend node kind: " + edge.End1Kind(),
+			Cause:  util.ErrNotFound,
 		}
 	} else if end1, err := end1nodeht.Get([]byte(PrefixNSAttrs + edge.End1Key())); err != nil || end1 == nil {
+		if err == nil {
+			err = util.ErrNotFound
+		}
 		return &util.GraphError{
 			Type:   util.ErrInvalidData,
 			Detail: fmt.Sprintf("Can't find edge endpoint: %s (%s)", edge.End1Key(), edge.End1Kind()),
+			Cause:  err,
 		}
 	}
 
@@ -372,18 +605,24 @@ func (gm *Manager) StoreEdge(part string, edge data.Edge) error {
 		return &util.GraphError{
 			Type:   util.ErrInvalidData,
 			Detail: "Can't store edge to non-existend node kind: " + edge.End2Kind(),
+			Cause:  util.ErrNotFound,
 		}
 	} else if end2, err := end2nodeht.Get([]byte(PrefixNSAttrs + edge.End2Key())); err != nil || end2 == nil {
+		if err == nil {
+			err = util.ErrNotFound
+		}
 		return &util.GraphError{
 			Type:   util.ErrInvalidData,
 			Detail: fmt.Sprintf("Can't find edge endpoint: %s (%s)", edge.End2Key(), edge.End2Kind()),
+			Cause:  err,
 		}
 	}
 
-	// Take writer lock
+	// Check cardinality constraints
 
-	gm.mutex.Lock()
-	defer gm.mutex.Unlock()
+	if err := gm.checkEdgeCardinalityMax(edge, edgeht, end1ht, end2ht); err != nil {
+		return err
+	}
 
 	// Write edge to the datastore
 
@@ -399,16 +638,15 @@ func (gm *Manager) StoreEdge(part string, edge data.Edge) error {
 
 		// Increase edge count
 
-		currentCount := gm.EdgeCount(edge.Kind())
-		if err := gm.writeEdgeCount(edge.Kind(), currentCount+1, true); err != nil {
+		if err := gm.addEdgeCount(part, edge.Kind(), 1, true); err != nil {
 			return err
 		}
 
 		// Write edge data to the index
 
-		if iht != nil {
+		if im != nil {
 
-			if err := util.NewIndexManager(iht).Index(edge.Key(), edge.IndexMap()); err != nil {
+			if err := im.Index(edge.Key(), edge.IndexMap()); err != nil {
 
 				// The edge was written at this point and the model is
 				// consistent only the index is missing entries
@@ -417,9 +655,9 @@ func (gm *Manager) StoreEdge(part string, edge data.Edge) error {
 			}
 		}
 
-	} else if iht != nil {
+	} else if im != nil {
 
-		err := util.NewIndexManager(iht).Reindex(edge.Key(), edge.IndexMap(),
+		err := im.Reindex(edge.Key(), edge.IndexMap(),
 			oldedge.IndexMap())
 
 		if err != nil {
@@ -451,7 +689,7 @@ func (gm *Manager) StoreEdge(part string, edge data.Edge) error {
 
 	// Flush changes - errors only reported on the actual node storage flush
 
-	gm.gs.FlushMain()
+	gm.flushMain()
 
 	gm.flushEdgeIndex(part, edge.Kind())
 
@@ -474,17 +712,8 @@ func (gm *Manager) writeEdge(edge data.Edge, edgeTree *hash.HTree,
 
 	// Create lookup keys
 
-	spec1 := gm.nm.Encode16(edge.End1Role(), true) + gm.nm.Encode16(edge.Kind(), true) +
-		gm.nm.Encode16(edge.End2Role(), true) + gm.nm.Encode16(edge.End2Kind(), true)
-
-	spec2 := gm.nm.Encode16(edge.End2Role(), true) + gm.nm.Encode16(edge.Kind(), true) +
-		gm.nm.Encode16(edge.End1Role(), true) + gm.nm.Encode16(edge.End1Kind(), true)
-
 	specsNode1Key := PrefixNSSpecs + edge.End1Key()
-	edgeInfo1Key := PrefixNSEdge + edge.End1Key() + spec1
-
 	specsNode2Key := PrefixNSSpecs + edge.End2Key()
-	edgeInfo2Key := PrefixNSEdge + edge.End2Key() + spec2
 
 	// Function to insert a new spec into a specs map
 
@@ -530,7 +759,7 @@ func (gm *Manager) writeEdge(edge data.Edge, edgeTree *hash.HTree,
 		// Update the target info
 
 		targetMap[edge.Key()] = &edgeTargetInfo{cascadeToTarget,
-			cascadeFromTarget, endkey, endkind}
+			cascadeFromTarget, endkey, endkind, edge.IsUndirected()}
 
 		if _, err = tree.Put([]byte(key), targetMap); err != nil {
 			return err
@@ -554,7 +783,7 @@ func (gm *Manager) writeEdge(edge data.Edge, edgeTree *hash.HTree,
 
 		if !data.NodeCompare(oldedge, edge, []string{data.EdgeEnd1Key,
 			data.EdgeEnd1Kind, data.EdgeEnd1Role, data.EdgeEnd2Key,
-			data.EdgeEnd2Kind, data.EdgeEnd2Role}) {
+			data.EdgeEnd2Kind, data.EdgeEnd2Role}) || oldedge.IsUndirected() != edge.IsUndirected() {
 
 			// If the check fails then write back the old data and return
 			// no error checking when writing back
@@ -570,25 +799,32 @@ func (gm *Manager) writeEdge(edge data.Edge, edgeTree *hash.HTree,
 		return oldedge, nil
 	}
 
-	// Create / update specs map on the nodes
+	// Create / update specs map and edgeInfo entries on the nodes
 
-	if err := updateSpecMap(specsNode1Key, spec1, end1Tree); err != nil {
-		return nil, err
-	}
-	if err := updateSpecMap(specsNode2Key, spec2, end2Tree); err != nil {
-		return nil, err
-	}
+	for _, spec1 := range edgeEndSpecs(edge, true) {
+		encspec := gm.encodeSpec(spec1, true)
 
-	// Create / update the edgeInfo entries
+		if err := updateSpecMap(specsNode1Key, encspec, end1Tree); err != nil {
+			return nil, err
+		}
 
-	if err := updateTargetInfo(edgeInfo1Key, edge.End2Key(), edge.End2Kind(),
-		edge.End1IsCascading(), edge.End2IsCascading(), end1Tree); err != nil {
-		return nil, err
+		if err := updateTargetInfo(PrefixNSEdge+edge.End1Key()+encspec, edge.End2Key(),
+			edge.End2Kind(), edge.End1IsCascading(), edge.End2IsCascading(), end1Tree); err != nil {
+			return nil, err
+		}
 	}
 
-	if err := updateTargetInfo(edgeInfo2Key, edge.End1Key(), edge.End1Kind(),
-		edge.End2IsCascading(), edge.End1IsCascading(), end2Tree); err != nil {
-		return nil, err
+	for _, spec2 := range edgeEndSpecs(edge, false) {
+		encspec := gm.encodeSpec(spec2, true)
+
+		if err := updateSpecMap(specsNode2Key, encspec, end2Tree); err != nil {
+			return nil, err
+		}
+
+		if err := updateTargetInfo(PrefixNSEdge+edge.End2Key()+encspec, edge.End1Key(),
+			edge.End1Kind(), edge.End2IsCascading(), edge.End1IsCascading(), end2Tree); err != nil {
+			return nil, err
+		}
 	}
 
 	return nil, nil
@@ -599,9 +835,13 @@ RemoveEdge removes a single edge from a partition of the graph.
 */
 func (gm *Manager) RemoveEdge(part string, key string, kind string) (data.Edge, error) {
 
+	// Take writer lock
+
+	defer gm.writeLock(part)()
+
 	// Get the HTrees which stores the edges and the edge index
 
-	iht, err := gm.getEdgeIndexHTree(part, kind, true)
+	im, err := gm.getEdgeIndexManager(part, kind, true)
 	if err != nil {
 		return nil, err
 	}
@@ -611,10 +851,11 @@ func (gm *Manager) RemoveEdge(part string, key string, kind string) (data.Edge,
 		return nil, err
 	}
 
-	// Take writer lock
+	// Check cardinality constraints
 
-	gm.mutex.Lock()
-	defer gm.mutex.Unlock()
+	if err := gm.checkEdgeCardinalityMin(part, key, kind, edgeht); err != nil {
+		return nil, err
+	}
 
 	// Delete the node from the datastore
 
@@ -644,8 +885,8 @@ func (gm *Manager) RemoveEdge(part string, key string, kind string) (data.Edge,
 			return edge, err
 		}
 
-		if iht != nil {
-			err := util.NewIndexManager(iht).Deindex(key, edge.IndexMap())
+		if im != nil {
+			err := im.Deindex(key, edge.IndexMap())
 			if err != nil {
 				return edge, err
 			}
@@ -653,8 +894,7 @@ func (gm *Manager) RemoveEdge(part string, key string, kind string) (data.Edge,
 
 		// Decrease edge count
 
-		currentCount := gm.EdgeCount(edge.Kind())
-		if err := gm.writeEdgeCount(edge.Kind(), currentCount-1, true); err != nil {
+		if err := gm.addEdgeCount(part, edge.Kind(), -1, true); err != nil {
 			return edge, err
 		}
 
@@ -671,7 +911,7 @@ func (gm *Manager) RemoveEdge(part string, key string, kind string) (data.Edge,
 
 		// Flush changes - errors only reported on the actual node storage flush
 
-		gm.gs.FlushMain()
+		gm.flushMain()
 
 		gm.flushEdgeIndex(part, edge.Kind())
 
@@ -690,20 +930,6 @@ Delete edge information from a given node storage
 */
 func (gm *Manager) deleteEdge(edge data.Edge, end1Tree *hash.HTree, end2Tree *hash.HTree) error {
 
-	// Create lookup keys
-
-	spec1 := gm.nm.Encode16(edge.End1Role(), true) + gm.nm.Encode16(edge.Kind(), true) +
-		gm.nm.Encode16(edge.End2Role(), true) + gm.nm.Encode16(edge.End2Kind(), true)
-
-	spec2 := gm.nm.Encode16(edge.End2Role(), true) + gm.nm.Encode16(edge.Kind(), true) +
-		gm.nm.Encode16(edge.End1Role(), true) + gm.nm.Encode16(edge.End1Kind(), true)
-
-	specsNode1Key := PrefixNSSpecs + edge.End1Key()
-	edgeInfo1Key := PrefixNSEdge + edge.End1Key() + spec1
-
-	specsNode2Key := PrefixNSSpecs + edge.End2Key()
-	edgeInfo2Key := PrefixNSEdge + edge.End2Key() + spec2
-
 	// Function to delete a spec from a specs map
 
 	updateSpecMap := func(key string, spec string, tree *hash.HTree) error {
@@ -712,7 +938,7 @@ func (gm *Manager) deleteEdge(edge data.Edge, end1Tree *hash.HTree, end2Tree *ha
 		obj, err := tree.Get([]byte(key))
 
 		if err != nil {
-			return &util.GraphError{Type: util.ErrReading, Detail: err.Error()}
+			return &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
 		} else if obj == nil {
 			return &util.GraphError{
 				Type:   util.ErrInvalidData,
@@ -746,7 +972,7 @@ func (gm *Manager) deleteEdge(edge data.Edge, end1Tree *hash.HTree, end2Tree *ha
 		obj, err := tree.Get([]byte(key))
 
 		if err != nil {
-			return false, &util.GraphError{Type: util.ErrReading, Detail: err.Error()}
+			return false, &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
 		} else if obj == nil {
 			return false, &util.GraphError{
 				Type:   util.ErrInvalidData,
@@ -773,33 +999,55 @@ func (gm *Manager) deleteEdge(edge data.Edge, end1Tree *hash.HTree, end2Tree *ha
 		return false, nil
 	}
 
-	// Remove the edgeInfo entries
+	// Function to remove the edgeInfo entries of one end and its specs map
+	// entries if the target info structure was removed
 
-	end1TargetInfoRemoved, err := updateTargetInfo(edgeInfo1Key, end1Tree)
-	if err != nil {
-		return err
+	removeFromEnd := func(key string, end1 bool, tree *hash.HTree) error {
+
+		for _, spec := range edgeEndSpecs(edge, end1) {
+			encspec := gm.encodeSpec(spec, true)
+
+			targetInfoRemoved, err := updateTargetInfo(PrefixNSEdge+key+encspec, tree)
+			if err != nil {
+				return err
+			}
+
+			if targetInfoRemoved {
+				if err := updateSpecMap(PrefixNSSpecs+key, encspec, tree); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
 	}
 
-	end2TargetInfoRemoved, err := updateTargetInfo(edgeInfo2Key, end2Tree)
-	if err != nil {
+	if err := removeFromEnd(edge.End1Key(), true, end1Tree); err != nil {
 		return err
 	}
 
-	// Remove specs map on the nodes if the target info structure was removed
+	return removeFromEnd(edge.End2Key(), false, end2Tree)
+}
 
-	if end1TargetInfoRemoved {
-		if err := updateSpecMap(specsNode1Key, spec1, end1Tree); err != nil {
-			return err
-		}
+/*
+edgeEndSpecs returns the specs of an edge from the view of its first or second
+end. Undirected edges with different roles have a second spec with the roles
+exchanged.
+*/
+func edgeEndSpecs(edge data.Edge, end1 bool) []string {
+	role, otherRole, otherKind := edge.End1Role(), edge.End2Role(), edge.End2Kind()
+
+	if !end1 {
+		role, otherRole, otherKind = edge.End2Role(), edge.End1Role(), edge.End1Kind()
 	}
 
-	if end2TargetInfoRemoved {
-		if err := updateSpecMap(specsNode2Key, spec2, end2Tree); err != nil {
-			return err
-		}
+	ret := []string{role + ":" + edge.Kind() + ":" + otherRole + ":" + otherKind}
+
+	if edge.IsUndirected() && role != otherRole {
+		ret = append(ret, otherRole+":"+edge.Kind()+":"+role+":"+otherKind)
 	}
 
-	return nil
+	return ret
 }
 
 /*
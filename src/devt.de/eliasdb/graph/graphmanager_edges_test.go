@@ -13,6 +13,7 @@ package graph
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"testing"
 
@@ -528,7 +529,8 @@ func TestSimpleGraphStorageErrorCases(t *testing.T) {
 	edge.SetAttr(data.EdgeEnd1Kind, node1.Kind())
 	edge.SetAttr(data.EdgeEnd1Key, "xxx")
 
-	if err := gm.StoreEdge("main", edge); err.Error() != "GraphError: Invalid data (Can't find edge endpoint: xxx (mykind))" {
+	if err := gm.StoreEdge("main", edge); err.Error() != "GraphError: Invalid data (Can't find edge endpoint: xxx (mykind))" ||
+		!errors.Is(err, util.ErrNotFound) || !errors.Is(err, util.ErrInvalidData) {
 		t.Error("Unexpected store result:", err)
 		return
 	}
@@ -548,8 +550,9 @@ func TestSimpleGraphStorageErrorCases(t *testing.T) {
 	sm := gm.gs.StorageManager("main"+"myedge"+StorageSuffixEdgesIndex, false)
 	sm.(*storage.MemoryStorageManager).AccessMap[1] = storage.AccessCacheAndFetchError
 
-	if err := gm.StoreEdge("main", edge); err == nil {
-		t.Error("Unexpected store result:", err)
+	if err := gm.StoreEdge("main", edge); err == nil || errors.Is(err, util.ErrNotFound) ||
+		!errors.Is(err, util.ErrAccessComponent) || errors.Unwrap(err) == nil {
+		t.Error("Unexpected store result:", err, errors.Unwrap(err))
 		return
 	}
 	if _, err := gm.RemoveEdge("main", edge.Key(), edge.Kind()); err == nil {
@@ -650,7 +653,8 @@ func TestSimpleGraphStorageErrorCases(t *testing.T) {
 	delete(sm.(*storage.MemoryStorageManager).AccessMap, 1)
 
 	sm = gm.gs.StorageManager("main"+"myedge"+StorageSuffixEdgesIndex, false)
-	sm.(*storage.MemoryStorageManager).AccessMap[5] = storage.AccessInsertError
+	locCount := sm.(*storage.MemoryStorageManager).LocCount
+	sm.(*storage.MemoryStorageManager).AccessMap[locCount] = storage.AccessInsertError
 
 	edge.SetAttr("name", "New edge name")
 
@@ -659,7 +663,7 @@ func TestSimpleGraphStorageErrorCases(t *testing.T) {
 		return
 	}
 
-	delete(sm.(*storage.MemoryStorageManager).AccessMap, 5)
+	delete(sm.(*storage.MemoryStorageManager).AccessMap, locCount)
 
 	resetStorage := func() {
 		mgs = graphstorage.NewMemoryGraphStorage("mystorage")
@@ -1302,3 +1306,515 @@ func TestEdgeOperations(t *testing.T) {
 		return
 	}
 }
+
+func TestNodeDegree(t *testing.T) {
+
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := newGraphManagerNoRules(mgs)
+
+	constructNode := func(key string, kind string) data.Node {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", kind)
+
+		if err := gm.StoreNode("main", node); err != nil {
+			t.Error(err)
+		}
+
+		return node
+	}
+
+	constructEdge := func(key string, kind string, node1 data.Node, node2 data.Node) {
+		edge := data.NewGraphEdge()
+
+		edge.SetAttr("key", key)
+		edge.SetAttr("kind", kind)
+
+		edge.SetAttr(data.EdgeEnd1Key, node1.Key())
+		edge.SetAttr(data.EdgeEnd1Kind, node1.Kind())
+		edge.SetAttr(data.EdgeEnd1Role, "node1")
+		edge.SetAttr(data.EdgeEnd1Cascading, false)
+
+		edge.SetAttr(data.EdgeEnd2Key, node2.Key())
+		edge.SetAttr(data.EdgeEnd2Kind, node2.Kind())
+		edge.SetAttr(data.EdgeEnd2Role, "node2")
+		edge.SetAttr(data.EdgeEnd2Cascading, false)
+
+		if err := gm.StoreEdge("main", edge); err != nil {
+			t.Error(err)
+		}
+	}
+
+	node1 := constructNode("123", "mykind")
+	node2 := constructNode("456", "mykind")
+	node3 := constructNode("789", "myotherkind")
+	node4 := constructNode("000", "mykind")
+
+	constructEdge("abc1", "myedge", node1, node2)
+	constructEdge("abc2", "myedge", node1, node3)
+	constructEdge("abc3", "myedge", node1, node4)
+	constructEdge("abc4", "myotheredge", node1, node3)
+
+	degrees, err := gm.NodeDegrees("main", node1.Key(), node1.Kind())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := fmt.Sprint(degrees); res != "map[node1:myedge:node2:mykind:2 "+
+		"node1:myedge:node2:myotherkind:1 node1:myotheredge:node2:myotherkind:1]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Counts should be consistent with TraverseMulti
+
+	for _, spec := range []string{":::", "node1:myedge::", "::node2:myotherkind",
+		"node1:myedge:node2:mykind", "node2:::", "node1:unknown::"} {
+
+		_, edges, err := gm.TraverseMulti("main", node1.Key(), node1.Kind(), spec, false)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		degree, err := gm.NodeDegree("main", node1.Key(), node1.Kind(), spec)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if degree != len(edges) {
+			t.Error("Unexpected degree for spec", spec, ":", degree, "expected:", len(edges))
+			return
+		}
+	}
+
+	if degree, err := gm.NodeDegree("main", node2.Key(), node2.Kind(), ":::"); degree != 1 || err != nil {
+		t.Error("Unexpected result:", degree, err)
+		return
+	}
+
+	// Removing an edge should be reflected in the count
+
+	if _, err := gm.RemoveEdge("main", "abc3", "myedge"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if degree, err := gm.NodeDegree("main", node1.Key(), node1.Kind(), "node1:myedge::"); degree != 2 || err != nil {
+		t.Error("Unexpected result:", degree, err)
+		return
+	}
+
+	if degree, err := gm.NodeDegree("main", node4.Key(), node4.Kind(), ":::"); degree != 0 || err != nil {
+		t.Error("Unexpected result:", degree, err)
+		return
+	}
+
+	// Test error cases
+
+	if _, err := gm.NodeDegree("main", node1.Key(), node1.Kind(), "::"); err == nil ||
+		err.Error() != "GraphError: Invalid data (Invalid spec: ::)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := gm.NodeDegree("m-ain", node1.Key(), node1.Kind(), ":::"); err == nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if degrees, err := gm.NodeDegrees("main", node1.Key(), "unknownkind"); degrees != nil || err != nil {
+		t.Error("Unexpected result:", degrees, err)
+		return
+	}
+
+	sm := gm.gs.StorageManager("main"+node1.Kind()+StorageSuffixNodes, false)
+	sm.(*storage.MemoryStorageManager).AccessMap[1] = storage.AccessCacheAndFetchError
+
+	_, err = gm.NodeDegree("main", node1.Key(), node1.Kind(), ":::")
+	if err.Error() != "GraphError: Failed to access graph storage component (Slot not found (mystorage/mainmykind.nodes - Location:1))" {
+		t.Error("Unexpected error:", err)
+		return
+	}
+
+	delete(sm.(*storage.MemoryStorageManager).AccessMap, 1)
+}
+
+func BenchmarkNodeDegree(b *testing.B) {
+
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := newGraphManagerNoRules(mgs)
+
+	node1 := data.NewGraphNode()
+	node1.SetAttr("key", "123")
+	node1.SetAttr("kind", "mykind")
+	gm.StoreNode("main", node1)
+
+	trans := NewGraphTrans(gm)
+
+	for i := 0; i < 100000; i++ {
+		node := data.NewGraphNode()
+		node.SetAttr("key", fmt.Sprint("n", i))
+		node.SetAttr("kind", "mykind")
+		trans.StoreNode("main", node)
+
+		edge := data.NewGraphEdge()
+
+		edge.SetAttr("key", fmt.Sprint("e", i))
+		edge.SetAttr("kind", "myedge")
+		edge.SetAttr(data.NodeName, fmt.Sprint("Edge ", i))
+
+		edge.SetAttr(data.EdgeEnd1Key, node1.Key())
+		edge.SetAttr(data.EdgeEnd1Kind, node1.Kind())
+		edge.SetAttr(data.EdgeEnd1Role, "node1")
+		edge.SetAttr(data.EdgeEnd1Cascading, false)
+
+		edge.SetAttr(data.EdgeEnd2Key, node.Key())
+		edge.SetAttr(data.EdgeEnd2Kind, node.Kind())
+		edge.SetAttr(data.EdgeEnd2Role, "node2")
+		edge.SetAttr(data.EdgeEnd2Cascading, false)
+
+		trans.StoreEdge("main", edge)
+	}
+
+	if err := trans.Commit(); err != nil {
+		b.Error(err)
+		return
+	}
+
+	b.Run("NodeDegree", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if degree, err := gm.NodeDegree("main", node1.Key(), node1.Kind(), "node1:myedge::"); degree != 100000 || err != nil {
+				b.Error("Unexpected result:", degree, err)
+				return
+			}
+		}
+	})
+
+	b.Run("TraverseMulti", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, edges, err := gm.TraverseMulti("main", node1.Key(), node1.Kind(), "node1:myedge::", true); len(edges) != 100000 || err != nil {
+				b.Error("Unexpected result:", len(edges), err)
+				return
+			}
+		}
+	})
+}
+
+func TestTraverseFiltered(t *testing.T) {
+
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := newGraphManagerNoRules(mgs)
+
+	constructNode := func(key string, kind string) data.Node {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", kind)
+		node.SetAttr("name", "Node "+key)
+
+		if err := gm.StoreNode("main", node); err != nil {
+			t.Error(err)
+		}
+
+		return node
+	}
+
+	constructEdge := func(key string, node1 data.Node, node2 data.Node, role string, since int) {
+		edge := data.NewGraphEdge()
+
+		edge.SetAttr("key", key)
+		edge.SetAttr("kind", "memberof")
+		edge.SetAttr("role", role)
+		edge.SetAttr("since", since)
+
+		edge.SetAttr(data.EdgeEnd1Key, node1.Key())
+		edge.SetAttr(data.EdgeEnd1Kind, node1.Kind())
+		edge.SetAttr(data.EdgeEnd1Role, "member")
+		edge.SetAttr(data.EdgeEnd1Cascading, false)
+
+		edge.SetAttr(data.EdgeEnd2Key, node2.Key())
+		edge.SetAttr(data.EdgeEnd2Kind, node2.Kind())
+		edge.SetAttr(data.EdgeEnd2Role, "group")
+		edge.SetAttr(data.EdgeEnd2Cascading, false)
+
+		if err := gm.StoreEdge("main", edge); err != nil {
+			t.Error(err)
+		}
+	}
+
+	user := constructNode("u1", "user")
+	group1 := constructNode("g1", "group")
+	group2 := constructNode("g2", "group")
+	group3 := constructNode("g3", "team")
+
+	constructEdge("e1", user, group1, "admin", 2015)
+	constructEdge("e2", user, group2, "guest", 2015)
+	constructEdge("e3", user, group3, "admin", 2017)
+
+	traverse := func(spec string, allData bool, filter EdgeFilter) string {
+		var res []string
+
+		nodes, edges, err := gm.TraverseMultiFiltered("main", user.Key(), user.Kind(), spec, allData, filter)
+		if err != nil {
+			t.Error(err)
+		}
+
+		for i, node := range nodes {
+			res = append(res, fmt.Sprint(edges[i].Key(), ":", node.Key(), ":", node.Attr("name")))
+		}
+
+		sort.Strings(res)
+
+		return fmt.Sprint(res)
+	}
+
+	if res := traverse(":::", false, nil); res != "[e1:g1:<nil> e2:g2:<nil> e3:g3:<nil>]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Nodes which are only reachable through filtered edges are not returned
+
+	admin := EdgeAttrFilter(map[string]interface{}{"role": "admin"})
+
+	if res := traverse(":::", false, admin); res != "[e1:g1:<nil> e3:g3:<nil>]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := traverse(":::", true, admin); res != "[e1:g1:Node g1 e3:g3:Node g3]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := traverse("member:memberof:group:group", true, admin); res != "[e1:g1:Node g1]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := traverse(":::", false, EdgeAttrFilter(map[string]interface{}{"role": "admin", "since": 2015})); res != "[e1:g1:<nil>]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := traverse(":::", false, EdgeAttrFilter(map[string]interface{}{"foo": "bar"})); res != "[]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// The filter sees the traversal start as end1 and gets all edge attributes
+
+	if res := traverse(":::", false, func(edge data.Edge) bool {
+		return edge.End1Key() == "u1" && edge.Attr("since") == 2017
+	}); res != "[e3:g3:<nil>]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	nodes, edges, err := gm.TraverseFiltered("main", group1.Key(), group1.Kind(),
+		"group:memberof:member:user", false, func(edge data.Edge) bool {
+			return edge.End1Key() == "g1" && edge.End2Key() == "u1"
+		})
+
+	if err != nil || len(nodes) != 1 || nodes[0].Key() != "u1" || edges[0].Attr("role") != "admin" {
+		t.Error("Unexpected result:", nodes, edges, err)
+		return
+	}
+}
+
+func TestUndirectedEdges(t *testing.T) {
+
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	for _, key := range []string{"p1", "p2", "p3"} {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "Person")
+
+		if err := gm.StoreNode("main", node); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	newEdge := func(key string, end1 string, end2 string, undirected interface{}) data.Edge {
+		edge := data.NewGraphEdge()
+
+		edge.SetAttr("key", key)
+		edge.SetAttr("kind", "Related")
+
+		edge.SetAttr(data.EdgeEnd1Key, end1)
+		edge.SetAttr(data.EdgeEnd1Kind, "Person")
+		edge.SetAttr(data.EdgeEnd1Role, "a")
+		edge.SetAttr(data.EdgeEnd1Cascading, false)
+
+		edge.SetAttr(data.EdgeEnd2Key, end2)
+		edge.SetAttr(data.EdgeEnd2Kind, "Person")
+		edge.SetAttr(data.EdgeEnd2Role, "b")
+		edge.SetAttr(data.EdgeEnd2Cascading, false)
+
+		edge.SetAttr(data.EdgeUndirected, undirected)
+
+		return edge
+	}
+
+	traverse := func(key string, spec string, allData bool) string {
+		nodes, edges, err := gm.TraverseMulti("main", key, "Person", spec, allData)
+		if err != nil {
+			return err.Error()
+		}
+
+		var res []string
+		for i, node := range nodes {
+			res = append(res, fmt.Sprintf("%v-%v(%v)", edges[i].Key(), node.Key(), edges[i].IsUndirected()))
+		}
+		sort.Strings(res)
+
+		return fmt.Sprint(res)
+	}
+
+	if err := gm.StoreEdge("main", newEdge("e1", "p1", "p2", true)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := gm.StoreEdge("main", newEdge("e2", "p1", "p3", nil)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// The undirected edge can be traversed with both role orders from both ends
+
+	for _, test := range [][]string{
+		{"p1", "a:Related:b:Person", "[e1-p2(true) e2-p3(false)]"},
+		{"p1", "b:Related:a:Person", "[e1-p2(true)]"},
+		{"p2", "a:Related:b:Person", "[e1-p1(true)]"},
+		{"p2", "b:Related:a:Person", "[e1-p1(true)]"},
+		{"p3", "a:Related:b:Person", "[]"},
+		{"p3", "b:Related:a:Person", "[e2-p1(false)]"},
+		{"p1", ":::", "[e1-p2(true) e2-p3(false)]"},
+		{"p2", ":Related::", "[e1-p1(true)]"},
+	} {
+		for _, allData := range []bool{false, true} {
+			if res := traverse(test[0], test[1], allData); res != test[2] {
+				t.Error("Unexpected result:", test, allData, res)
+				return
+			}
+		}
+	}
+
+	if res, err := gm.FetchNodeEdgeSpecs("main", "p2", "Person"); err != nil ||
+		fmt.Sprint(res) != "[a:Related:b:Person b:Related:a:Person]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res := gm.NodeEdges("Person"); fmt.Sprint(res) != "[a:Related:b:Person b:Related:a:Person]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	for spec, count := range map[string]int{":::": 2, "a:Related::": 2, "b:Related::": 1} {
+		if res, err := gm.NodeDegree("main", "p1", "Person", spec); err != nil || res != count {
+			t.Error("Unexpected result:", spec, res, err)
+			return
+		}
+	}
+
+	// The undirected flag of an existing edge cannot be changed
+
+	if err := gm.StoreEdge("main", newEdge("e1", "p1", "p2", nil)); err == nil ||
+		err.Error() != "GraphError: Invalid data (Cannot update endpoints or spec of existing edge: e1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.StoreEdge("main", newEdge("e3", "p2", "p3", "yes")); err == nil ||
+		err.Error() != "GraphError: Invalid data (Edge has an invalid undirected value)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Transactions see pending undirected edges with both role orders
+
+	trans := NewGraphTrans(gm)
+
+	if err := trans.StoreEdge("main", newEdge("e3", "p2", "p3", true)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, edges, err := trans.TraverseMulti("main", "p3", "Person", "a:Related:b:Person", false); err != nil ||
+		len(edges) != 1 || edges[0].Key() != "e3" || !edges[0].IsUndirected() {
+		t.Error("Unexpected result:", edges, err)
+		return
+	}
+
+	if err := trans.Commit(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Removing the edge removes all traversal entries
+
+	if _, err := gm.RemoveEdge("main", "e1", "Related"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res, err := gm.FetchNodeEdgeSpecs("main", "p1", "Person"); err != nil ||
+		fmt.Sprint(res) != "[a:Related:b:Person]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res := traverse("p2", ":::", false); res != "[e3-p3(true)]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Removing a node removes an undirected edge once
+
+	if _, err := gm.RemoveNode("main", "p3", "Person"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := gm.EdgeCount("Related"); res != 0 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res, err := gm.FetchNodeEdgeSpecs("main", "p2", "Person"); err != nil || res != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Delete operations are cascaded once
+
+	edge := newEdge("e4", "p1", "p2", true)
+	edge.SetAttr(data.EdgeEnd1Cascading, true)
+
+	if err := gm.StoreEdge("main", edge); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := gm.RemoveNode("main", "p1", "Person"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res, err := gm.FetchNode("main", "p2", "Person"); err != nil || res != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res := gm.EdgeCount("Related"); res != 0 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
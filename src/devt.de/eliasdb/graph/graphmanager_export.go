@@ -0,0 +1,108 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"io"
+
+	"devt.de/eliasdb/graph/data"
+)
+
+/*
+ExportTypeAttr is the attribute which declares nodes as nodes in the export
+format if they would otherwise be mistaken for edges.
+*/
+const ExportTypeAttr = "type"
+
+/*
+Export writes the nodes and edges of the given kinds in a partition as
+newline-delimited JSON (one object per line) to a given writer. Every given
+kind is exported as node kind and as edge kind - all known node and edge kinds
+are exported if no kinds are given. All nodes are written before all edges so
+the output can be imported in order. Nodes which have edge end attributes get
+a type attribute with the value node unless they have a type attribute already.
+
+The export is best-effort consistent: keys are visited in lexicographic order
+and items are fetched individually so the export does not block writers.
+Items which are removed during the export are skipped, items which are added
+or changed during the export may or may not be part of the output.
+*/
+func (gm *Manager) Export(part string, kinds []string, w io.Writer) error {
+
+	if err := gm.checkPartitionName(part); err != nil {
+		return err
+	}
+
+	nodeKinds, edgeKinds := kinds, kinds
+
+	if len(kinds) == 0 {
+		nodeKinds = gm.NodeKinds()
+		edgeKinds = gm.EdgeKinds()
+	}
+
+	for _, kind := range nodeKinds {
+		if err := gm.exportKind(part, kind, false, w); err != nil {
+			return err
+		}
+	}
+
+	for _, kind := range edgeKinds {
+		if err := gm.exportKind(part, kind, true, w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+exportKind writes the nodes or edges of a single kind.
+*/
+func (gm *Manager) exportKind(part string, kind string, isEdge bool, w io.Writer) error {
+
+	it, err := gm.sortedKeyIterator(part, kind, isEdge)
+	if err != nil || it == nil {
+		return err
+	}
+
+	for it.HasNext() {
+		key := it.Next()
+
+		item, err := gm.readDiffItem(part, key, kind, isEdge)
+		if err != nil {
+			return err
+		} else if item == nil {
+			continue
+		}
+
+		if !isEdge && item.Attr(ExportTypeAttr) == nil &&
+			(item.Attr(data.EdgeEnd1Key) != nil || item.Attr(data.EdgeEnd2Key) != nil) {
+
+			attrs := map[string]interface{}{ExportTypeAttr: "node"}
+			for attr, val := range item.Data() {
+				attrs[attr] = val
+			}
+
+			item = data.NewGraphNodeFromMap(attrs)
+		}
+
+		line, err := data.MarshalNodeJSON(item, nil)
+		if err != nil {
+			return err
+		}
+
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return it.LastError
+}
@@ -0,0 +1,131 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+type exportErrorWriter struct {
+}
+
+func (ew *exportErrorWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("testerror")
+}
+
+func TestExport(t *testing.T) {
+
+	oldChunkSize := SortedIterationChunkSize
+	SortedIterationChunkSize = 2
+	defer func() {
+		SortedIterationChunkSize = oldChunkSize
+	}()
+
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	storeNode := func(part string, key string, kind string, attrs map[string]interface{}) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", kind)
+
+		for k, v := range attrs {
+			node.SetAttr(k, v)
+		}
+
+		if err := gm.StoreNode(part, node); err != nil {
+			t.Error(err)
+		}
+	}
+
+	storeNode("main", "3", "Song", map[string]interface{}{"name": "c"})
+	storeNode("main", "1", "Song", map[string]interface{}{"name": "a"})
+	storeNode("main", "2", "Song", map[string]interface{}{"name": "b", data.EdgeEnd1Key: "x"})
+	storeNode("main", "1", "Author", nil)
+	storeNode("other", "4", "Song", nil)
+
+	edge := data.NewGraphEdge()
+	edge.SetAttr("key", "1")
+	edge.SetAttr("kind", "Wrote")
+	edge.SetAttr(data.EdgeEnd1Key, "1")
+	edge.SetAttr(data.EdgeEnd1Kind, "Author")
+	edge.SetAttr(data.EdgeEnd1Role, "author")
+	edge.SetAttr(data.EdgeEnd1Cascading, false)
+	edge.SetAttr(data.EdgeEnd2Key, "1")
+	edge.SetAttr(data.EdgeEnd2Kind, "Song")
+	edge.SetAttr(data.EdgeEnd2Role, "song")
+	edge.SetAttr(data.EdgeEnd2Cascading, false)
+
+	if err := gm.StoreEdge("main", edge); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var buf bytes.Buffer
+
+	if err := gm.Export("main", nil, &buf); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := buf.String(); res != `{"key":"1","kind":"Author"}
+{"key":"1","kind":"Song","name":"a"}
+{"end1key":"x","key":"2","kind":"Song","name":"b","type":"node"}
+{"key":"3","kind":"Song","name":"c"}
+{"end1cascading":false,"end1key":"1","end1kind":"Author","end1role":"author","end2cascading":false,"end2key":"1","end2kind":"Song","end2role":"song","key":"1","kind":"Wrote"}
+` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Export only certain kinds
+
+	buf.Reset()
+
+	if err := gm.Export("main", []string{"Author", "Wrote"}, &buf); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := buf.String(); res != `{"key":"1","kind":"Author"}
+{"end1cascading":false,"end1key":"1","end1kind":"Author","end1role":"author","end2cascading":false,"end2key":"1","end2kind":"Song","end2role":"song","key":"1","kind":"Wrote"}
+` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Unknown kinds and partitions produce no output
+
+	buf.Reset()
+
+	if err := gm.Export("foo", []string{"Song"}, &buf); err != nil || buf.Len() != 0 {
+		t.Error("Unexpected result:", err, buf.String())
+		return
+	}
+
+	// Test error cases
+
+	if err := gm.Export("main ", nil, &buf); err == nil ||
+		err.Error() != "GraphError: Invalid data (Partition name main  is not alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.Export("main", nil, &exportErrorWriter{}); err == nil || err.Error() != "testerror" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
@@ -0,0 +1,53 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"os"
+
+	"devt.de/eliasdb/graph/graphstorage"
+	"devt.de/eliasdb/graph/util"
+)
+
+/*
+CheckStorage checks with a cheap read that the graph storage of this manager
+is usable. Returns the diagnostics of the graph storage (nil if the storage
+cannot report diagnostics) and an error if the storage is not usable - e.g. if
+the manager was closed or the storage directory cannot be accessed.
+*/
+func (gm *Manager) CheckStorage() (*graphstorage.Diagnostics, error) {
+	var diag *graphstorage.Diagnostics
+
+	// Take global reader lock
+
+	gm.mutex.RLock()
+	defer gm.mutex.RUnlock()
+
+	if err := gm.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	if ds, ok := gm.gs.(graphstorage.DiagnosticStorage); ok {
+		diag = ds.Diagnostics()
+	}
+
+	if _, ok := gm.gs.MainDB()[MainDBVersion]; !ok {
+		return diag, &util.GraphError{Type: util.ErrReading, Detail: "Main database has no version"}
+	}
+
+	if diag != nil && diag.Location != "" {
+		if _, err := os.Stat(diag.Location); err != nil {
+			return diag, &util.GraphError{Type: util.ErrAccessComponent, Detail: err.Error(), Cause: err}
+		}
+	}
+
+	return diag, nil
+}
@@ -0,0 +1,92 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+	"devt.de/eliasdb/graph/util"
+)
+
+func TestCheckStorage(t *testing.T) {
+
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	if diag, err := gm.CheckStorage(); err != nil || diag == nil || diag.Location != "" {
+		t.Error("Unexpected result:", diag, err)
+		return
+	}
+
+	delete(mgs.MainDB(), MainDBVersion)
+
+	if _, err := gm.CheckStorage(); err == nil ||
+		err.Error() != "GraphError: Could not read graph information (Main database has no version)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if !RunDiskStorageTests {
+		return
+	}
+
+	dgs, err := graphstorage.NewDiskGraphStorage(GraphManagerTestDBDir9, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	gm = NewGraphManager(dgs)
+
+	node := data.NewGraphNode()
+	node.SetAttr("key", "a")
+	node.SetAttr("kind", "mynode")
+
+	if err := gm.StoreNode("main", node); err != nil {
+		t.Error(err)
+		return
+	}
+
+	diag, err := gm.CheckStorage()
+
+	if err != nil || diag.Location != GraphManagerTestDBDir9 || diag.PendingTransactions != 1 ||
+		diag.LastFlush.IsZero() || diag.LastError != nil {
+		t.Error("Unexpected result:", diag, err)
+		return
+	}
+
+	// Storage directories which disappear are detected
+
+	os.Rename(GraphManagerTestDBDir9, GraphManagerTestDBDir9+"_moved")
+
+	_, err = gm.CheckStorage()
+
+	os.Rename(GraphManagerTestDBDir9+"_moved", GraphManagerTestDBDir9)
+
+	if !errors.Is(err, util.ErrAccessComponent) {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := gm.CheckStorage(); !errors.Is(err, util.ErrClosed) {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
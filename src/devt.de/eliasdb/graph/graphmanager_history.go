@@ -0,0 +1,536 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"encoding/gob"
+	"fmt"
+	"strconv"
+	"time"
+
+	"devt.de/common/stringutil"
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/util"
+	"devt.de/eliasdb/hash"
+)
+
+/*
+HistoryConfig holds the history settings of a node kind.
+*/
+type HistoryConfig struct {
+	MaxVersions int           // Maximum number of previous versions of a node (0 for no limit)
+	MaxAge      time.Duration // Maximum age of previous versions (0 for no limit)
+	Tombstones  bool          // Flag if the history of a removed node is kept
+}
+
+/*
+VersionInfo describes a version of a node.
+*/
+type VersionInfo struct {
+	Version uint64    // Version of the node
+	From    time.Time // Time when the version was written (zero if unknown)
+	Until   time.Time // Time when the version was replaced (zero for the current version)
+	Removed bool      // Flag if the version ended because the node was removed
+}
+
+/*
+nodeHistory is an internal structure which stores the history of a node.
+*/
+type nodeHistory struct {
+	Written  int64          // Write time of the current version (0 if unknown or removed)
+	Versions []*nodeVersion // Previous versions of the node - oldest first
+}
+
+/*
+nodeVersion is an internal structure which stores a previous version of a node.
+*/
+type nodeVersion struct {
+	Version uint64                 // Version of the node
+	From    int64                  // Time when the version was written (0 if unknown)
+	Until   int64                  // Time when the version was replaced or removed
+	Removed bool                   // Flag if the node was removed
+	Attrs   map[string]interface{} // Attributes of the node
+}
+
+func init() {
+
+	// Make sure we can use the relevant types in a gob operation
+
+	gob.Register(&nodeHistory{})
+	gob.Register(&nodeVersion{})
+}
+
+/*
+NodeHistoryPruneBatchSize is the number of nodes which are pruned while
+holding the writer lock by PruneNodeHistory.
+*/
+var NodeHistoryPruneBatchSize = 1000
+
+/*
+SetNodeHistory enables or disables the recording of the history of nodes of a
+given kind. A nil config disables the history and removes all recorded
+history of the kind in all partitions. The settings are persisted in the main
+database. The history of a node starts with the first write after the history
+was enabled - versions which were written before have no known write time.
+*/
+func (gm *Manager) SetNodeHistory(kind string, config *HistoryConfig) error {
+
+	if !stringutil.IsAlphaNumeric(kind) {
+		return &util.GraphError{
+			Type:   util.ErrInvalidData,
+			Detail: fmt.Sprintf("Kind %v is not alphanumeric - can only contain [a-zA-Z0-9_]", kind),
+		}
+	} else if config != nil && (config.MaxVersions < 0 || config.MaxAge < 0) {
+		return &util.GraphError{
+			Type:   util.ErrInvalidData,
+			Detail: fmt.Sprintf("Invalid history limits: %v versions and %v age", config.MaxVersions, config.MaxAge),
+		}
+	}
+
+	// Take global writer lock
+
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	if config == nil {
+
+		if gm.NodeHistoryConfig(kind) == nil {
+			return nil
+		}
+
+		gm.updateMainDBMap(MainDBNodeHistory+kind, func(map[string]string) map[string]string {
+			return map[string]string{}
+		})
+
+		// The global writer lock is already held - no further locking is required
+
+		nolock := func() func() {
+			return func() {}
+		}
+
+		for _, part := range gm.Partitions() {
+			if _, err := gm.pruneNodeHistory(part, kind, nolock); err != nil {
+				return err
+			}
+		}
+
+		return gm.flushMain()
+	}
+
+	gm.updateMainDBMap(MainDBNodeHistory+kind, func(map[string]string) map[string]string {
+		return map[string]string{
+			"maxversions": fmt.Sprint(config.MaxVersions),
+			"maxage":      fmt.Sprint(int64(config.MaxAge)),
+			"tombstones":  fmt.Sprint(config.Tombstones),
+		}
+	})
+
+	return gm.flushMain()
+}
+
+/*
+NodeHistoryConfig returns the history settings of a given node kind. Returns
+nil if the history of the kind is not recorded.
+*/
+func (gm *Manager) NodeHistoryConfig(kind string) *HistoryConfig {
+	settings := gm.getMainDBMap(MainDBNodeHistory + kind)
+
+	if len(settings) == 0 {
+		return nil
+	}
+
+	maxVersions, _ := strconv.Atoi(settings["maxversions"])
+	maxAge, _ := strconv.ParseInt(settings["maxage"], 10, 64)
+	tombstones, _ := strconv.ParseBool(settings["tombstones"])
+
+	return &HistoryConfig{maxVersions, time.Duration(maxAge), tombstones}
+}
+
+/*
+FetchNodeVersion fetches a node as it was at a given point in time. Returns
+nil if the node did not exist at the given time or if the version was
+already pruned.
+*/
+func (gm *Manager) FetchNodeVersion(part string, key string, kind string, asOf time.Time) (data.Node, error) {
+
+	if err := gm.checkNodeHistory(part, kind); err != nil {
+		return nil, err
+	}
+
+	// Take reader lock
+
+	defer gm.readLock(part)()
+
+	attTree, valTree, err := gm.getNodeStorageHTree(part, kind, false)
+	if err != nil || attTree == nil || valTree == nil {
+		return nil, err
+	}
+
+	history, err := gm.readNodeHistory(key, valTree)
+	if err != nil {
+		return nil, err
+	}
+
+	t := asOf.UnixNano()
+
+	// Check the current version first
+
+	if history.Written <= t {
+		if node, err := gm.readNode(key, kind, nil, attTree, valTree); err != nil || node != nil {
+			return node, err
+		}
+	}
+
+	for i := len(history.Versions) - 1; i >= 0; i-- {
+		if v := history.Versions[i]; v.From <= t && t < v.Until {
+			return data.NewGraphNodeFromMap(v.Attrs), nil
+		}
+	}
+
+	return nil, nil
+}
+
+/*
+NodeHistory returns all known versions of a node - oldest first. The current
+version of an existing node is the last entry.
+*/
+func (gm *Manager) NodeHistory(part string, key string, kind string) ([]VersionInfo, error) {
+
+	if err := gm.checkNodeHistory(part, kind); err != nil {
+		return nil, err
+	}
+
+	// Take reader lock
+
+	defer gm.readLock(part)()
+
+	_, valTree, err := gm.getNodeStorageHTree(part, kind, false)
+	if err != nil || valTree == nil {
+		return nil, err
+	}
+
+	history, err := gm.readNodeHistory(key, valTree)
+	if err != nil {
+		return nil, err
+	}
+
+	toTime := func(t int64) time.Time {
+		if t == 0 {
+			return time.Time{}
+		}
+		return time.Unix(0, t)
+	}
+
+	var ret []VersionInfo
+
+	for _, v := range history.Versions {
+		ret = append(ret, VersionInfo{v.Version, toTime(v.From), toTime(v.Until), v.Removed})
+	}
+
+	if version, err := gm.readVersion(key, valTree); err != nil {
+		return nil, err
+	} else if version != 0 {
+		ret = append(ret, VersionInfo{version, toTime(history.Written), time.Time{}, false})
+	}
+
+	return ret, nil
+}
+
+/*
+PruneNodeHistory applies the history limits of a given node kind to all nodes
+of the kind in a given partition. History is only pruned when a node is
+written - this function should be called regularly to remove old versions of
+nodes which are rarely written. Returns the number of removed versions.
+*/
+func (gm *Manager) PruneNodeHistory(part string, kind string) (int, error) {
+
+	if err := gm.checkNodeHistory(part, kind); err != nil {
+		return 0, err
+	}
+
+	return gm.pruneNodeHistory(part, kind, func() func() {
+		return gm.writeLock(part)
+	})
+}
+
+/*
+checkNodeHistory checks that the history of a given node kind is recorded.
+*/
+func (gm *Manager) checkNodeHistory(part string, kind string) error {
+
+	if err := gm.checkPartitionName(part); err != nil {
+		return err
+	} else if gm.NodeHistoryConfig(kind) == nil {
+		return &util.GraphError{
+			Type:   util.ErrInvalidData,
+			Detail: fmt.Sprintf("History is not recorded for node kind %v", kind),
+		}
+	}
+
+	return nil
+}
+
+/*
+pruneNodeHistory applies the history limits of a given node kind to all nodes
+of the kind in a given partition. All history is removed if the history of
+the kind is not recorded. The given lock function is called for every batch
+of nodes and returns a function which releases the lock.
+*/
+func (gm *Manager) pruneNodeHistory(part string, kind string, lock func() func()) (int, error) {
+
+	unlock := lock()
+	attTree, valTree, err := gm.getNodeStorageHTree(part, kind, false)
+	unlock()
+
+	if err != nil || attTree == nil || valTree == nil {
+		return 0, err
+	}
+
+	// Collect all keys first - changing the tree while iterating it could
+	// skip entries
+
+	var keys []string
+
+	err = iterateKeyBatchesWithLock(valTree, PrefixNSHistory, NodeHistoryPruneBatchSize, lock,
+		func(batch []string) error {
+			for _, k := range batch {
+				keys = append(keys, k[len(PrefixNSHistory):])
+			}
+			return nil
+		})
+
+	if err != nil {
+		return 0, err
+	}
+
+	pruneBatch := func(batch []string) (int, error) {
+		defer lock()()
+
+		config := gm.NodeHistoryConfig(kind)
+		now := time.Now().UnixNano()
+		count := 0
+
+		for _, key := range batch {
+
+			history, err := gm.readNodeHistory(key, valTree)
+			if err != nil {
+				return count, err
+			}
+
+			if config == nil {
+				count += len(history.Versions)
+
+				if _, err := valTree.Remove([]byte(PrefixNSHistory + key)); err != nil {
+					return count, &util.GraphError{Type: util.ErrWriting, Detail: err.Error(), Cause: err}
+				}
+
+				continue
+			}
+
+			count += history.prune(config, now)
+
+			if err := gm.writeNodeHistory(key, history, attTree, valTree); err != nil {
+				return count, err
+			}
+		}
+
+		if err := gm.flushNodeStorage(part, kind); err != nil {
+			return count, err
+		}
+
+		return count, nil
+	}
+
+	count := 0
+
+	for len(keys) > 0 {
+		batch := keys
+		if len(batch) > NodeHistoryPruneBatchSize {
+			batch = batch[:NodeHistoryPruneBatchSize]
+		}
+		keys = keys[len(batch):]
+
+		pruned, err := pruneBatch(batch)
+		count += pruned
+
+		if err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+/*
+writeNodeWithHistory writes a given node and records the previous version of
+the node if the history of the node kind is recorded. It is assumed that the
+caller holds the writer lock before calling the functions and that, after the
+function returns, the changes are flushed to the storage. Returns the old node
+if an update occurred.
+*/
+func (gm *Manager) writeNodeWithHistory(node data.Node, onlyUpdate bool, attrTree *hash.HTree,
+	valTree *hash.HTree) (data.Node, error) {
+
+	config := gm.NodeHistoryConfig(node.Kind())
+
+	if config == nil {
+		return gm.writeNode(node, onlyUpdate, attrTree, valTree, nodeAttributeFilter)
+	}
+
+	// Read the complete previous version - the old node returned by writeNode
+	// contains only the changed attributes of an update
+
+	version, err := gm.readVersion(node.Key(), valTree)
+	if err != nil {
+		return nil, err
+	}
+
+	prev, err := gm.readNode(node.Key(), node.Kind(), nil, attrTree, valTree)
+	if err != nil {
+		return nil, err
+	}
+
+	oldnode, err := gm.writeNode(node, onlyUpdate, attrTree, valTree, nodeAttributeFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	return oldnode, gm.addNodeHistory(node.Key(), prev, version, false, config, attrTree, valTree)
+}
+
+/*
+deleteNodeWithHistory deletes a given node and keeps its history as a
+tombstone if this is configured for the node kind. Otherwise the history of
+the node is removed. It is assumed that the caller holds the writer lock
+before calling the functions and that, after the function returns, the
+changes are flushed to the storage. Returns the deleted node.
+*/
+func (gm *Manager) deleteNodeWithHistory(key string, kind string, attrTree *hash.HTree,
+	valTree *hash.HTree) (data.Node, error) {
+
+	version, err := gm.readVersion(key, valTree)
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := gm.deleteNode(key, kind, attrTree, valTree)
+	if err != nil || node == nil {
+		return node, err
+	}
+
+	if config := gm.NodeHistoryConfig(kind); config != nil && config.Tombstones {
+		return node, gm.addNodeHistory(key, node, version, true, config, attrTree, valTree)
+	}
+
+	if _, err := valTree.Remove([]byte(PrefixNSHistory + key)); err != nil {
+		return node, &util.GraphError{Type: util.ErrWriting, Detail: err.Error(), Cause: err}
+	}
+
+	return node, nil
+}
+
+/*
+addNodeHistory adds a previous version to the history of a node. The
+previous version is nil if the node was created.
+*/
+func (gm *Manager) addNodeHistory(key string, prev data.Node, version uint64, removed bool,
+	config *HistoryConfig, attrTree *hash.HTree, valTree *hash.HTree) error {
+
+	history, err := gm.readNodeHistory(key, valTree)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UnixNano()
+
+	if prev != nil {
+		history.Versions = append(history.Versions,
+			&nodeVersion{version, history.Written, now, removed, prev.Data()})
+	}
+
+	if removed {
+		history.Written = 0
+	} else {
+		history.Written = now
+	}
+
+	history.prune(config, now)
+
+	return gm.writeNodeHistory(key, history, attrTree, valTree)
+}
+
+/*
+readNodeHistory reads the history of a node. Returns an empty history if no
+history was recorded.
+*/
+func (gm *Manager) readNodeHistory(key string, valTree *hash.HTree) (*nodeHistory, error) {
+
+	obj, err := valTree.Get([]byte(PrefixNSHistory + key))
+	if err != nil {
+		return nil, &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
+	} else if obj == nil {
+		return &nodeHistory{}, nil
+	}
+
+	return obj.(*nodeHistory), nil
+}
+
+/*
+writeNodeHistory writes the history of a node. The history is removed if there
+are no previous versions and the node does not exist.
+*/
+func (gm *Manager) writeNodeHistory(key string, history *nodeHistory, attrTree *hash.HTree,
+	valTree *hash.HTree) error {
+
+	if len(history.Versions) == 0 {
+		exists, err := attrTree.Exists([]byte(PrefixNSAttrs + key))
+		if err != nil {
+			return &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
+		}
+
+		if !exists {
+			if _, err := valTree.Remove([]byte(PrefixNSHistory + key)); err != nil {
+				return &util.GraphError{Type: util.ErrWriting, Detail: err.Error(), Cause: err}
+			}
+			return nil
+		}
+	}
+
+	if _, err := valTree.Put([]byte(PrefixNSHistory+key), history); err != nil {
+		return &util.GraphError{Type: util.ErrWriting, Detail: err.Error(), Cause: err}
+	}
+
+	return nil
+}
+
+/*
+prune removes all previous versions which exceed the given limits. Returns
+the number of removed versions.
+*/
+func (h *nodeHistory) prune(config *HistoryConfig, now int64) int {
+	start := 0
+
+	if config.MaxAge > 0 {
+		for start < len(h.Versions) && h.Versions[start].Until < now-int64(config.MaxAge) {
+			start++
+		}
+	}
+
+	if config.MaxVersions > 0 && len(h.Versions)-start > config.MaxVersions {
+		start = len(h.Versions) - config.MaxVersions
+	}
+
+	if start > 0 {
+		h.Versions = append([]*nodeVersion(nil), h.Versions[start:]...)
+	}
+
+	return start
+}
@@ -0,0 +1,398 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+func TestNodeHistory(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	storeNode := func(key string, name string) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "Song")
+		node.SetAttr("name", name)
+
+		if err := gm.StoreNode("main", node); err != nil {
+			t.Error(err)
+		}
+
+		// Make sure every version has a distinct time span
+
+		time.Sleep(time.Millisecond)
+	}
+
+	fetchName := func(key string, asOf time.Time) interface{} {
+		node, err := gm.FetchNodeVersion("main", key, "Song", asOf)
+		if err != nil {
+			t.Error(err)
+		} else if node == nil {
+			return nil
+		}
+		return node.Attr("name")
+	}
+
+	history := func(key string) []VersionInfo {
+		res, err := gm.NodeHistory("main", key, "Song")
+		if err != nil {
+			t.Error(err)
+		}
+		return res
+	}
+
+	storeNode("s0", "Song0")
+
+	// Test error cases
+
+	if err := gm.SetNodeHistory("So-ng", &HistoryConfig{}); err == nil ||
+		err.Error() != "GraphError: Invalid data (Kind So-ng is not alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.SetNodeHistory("Song", &HistoryConfig{MaxVersions: -1}); err == nil ||
+		err.Error() != "GraphError: Invalid data (Invalid history limits: -1 versions and 0s age)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := gm.FetchNodeVersion("main", "s0", "Song", time.Now()); err == nil ||
+		err.Error() != "GraphError: Invalid data (History is not recorded for node kind Song)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := gm.NodeHistory("ma-in", "s0", "Song"); err == nil ||
+		err.Error() != "GraphError: Invalid data (Partition name ma-in is not alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := gm.PruneNodeHistory("main", "Song"); err == nil ||
+		err.Error() != "GraphError: Invalid data (History is not recorded for node kind Song)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Enable the history
+
+	if err := gm.SetNodeHistory("Song", &HistoryConfig{MaxVersions: 3, Tombstones: true}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := gm.NodeHistoryConfig("Song"); fmt.Sprint(res) != "&{3 0s true}" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := gm.NodeHistoryConfig("Author"); res != nil {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Nodes which were written before the history was enabled have no
+	// known write time
+
+	before := time.Now().Add(-time.Hour)
+
+	if res := history("s0"); len(res) != 1 || !res[0].From.IsZero() || !res[0].Until.IsZero() {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := fetchName("s0", before); res != "Song0" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Record some versions
+
+	storeNode("s1", "Song1")
+	storeNode("s1", "Song1a")
+
+	update := data.NewGraphNode()
+	update.SetAttr("key", "s1")
+	update.SetAttr("kind", "Song")
+	update.SetAttr("rating", 5)
+
+	if err := gm.UpdateNode("main", update); err != nil {
+		t.Error(err)
+		return
+	}
+
+	time.Sleep(time.Millisecond)
+
+	vers := history("s1")
+
+	if len(vers) != 3 || !vers[2].Until.IsZero() || vers[0].Until != vers[1].From ||
+		vers[1].Until != vers[2].From || vers[0].Version >= vers[1].Version {
+		t.Error("Unexpected result:", vers)
+		return
+	}
+
+	if res := fetchName("s1", before); res != nil {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := fetchName("s1", vers[0].From); res != "Song1" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := fetchName("s1", vers[1].Until.Add(-1)); res != "Song1a" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Updates keep all attributes of the previous version
+
+	if node, _ := gm.FetchNodeVersion("main", "s1", "Song", vers[1].From); node.Attr("rating") != nil ||
+		node.Attr("key") != "s1" || node.Attr("kind") != "Song" {
+		t.Error("Unexpected result:", node)
+		return
+	}
+
+	if node, _ := gm.FetchNodeVersion("main", "s1", "Song", time.Now()); node.Attr("rating") != 5 ||
+		node.Attr("name") != "Song1a" {
+		t.Error("Unexpected result:", node)
+		return
+	}
+
+	// Removed nodes keep their history as a tombstone
+
+	if _, err := gm.RemoveNode("main", "s1", "Song"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	time.Sleep(time.Millisecond)
+
+	if res := fetchName("s1", time.Now()); res != nil {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := fetchName("s1", vers[0].From); res != "Song1" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	vers = history("s1")
+
+	if len(vers) != 3 || !vers[2].Removed || vers[2].Until.IsZero() {
+		t.Error("Unexpected result:", vers)
+		return
+	}
+
+	// A re-created node continues its history - the number of previous
+	// versions is limited
+
+	removed := vers[2].Until
+
+	storeNode("s1", "Song1b")
+	storeNode("s1", "Song1c")
+
+	vers = history("s1")
+
+	if len(vers) != 4 || vers[1].Until != removed || !vers[1].Removed || vers[2].From.Before(removed) {
+		t.Error("Unexpected result:", vers)
+		return
+	}
+
+	if res := fetchName("s1", removed); res != nil {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := fetchName("s1", vers[2].From); res != "Song1b" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := fetchName("s1", vers[0].From); res != "Song1a" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Transactions record the history as well
+
+	trans := NewGraphTrans(gm)
+
+	node := data.NewGraphNode()
+	node.SetAttr("key", "s1")
+	node.SetAttr("kind", "Song")
+	node.SetAttr("name", "Song1d")
+
+	trans.StoreNode("main", node)
+	trans.RemoveNode("main", "s0", "Song")
+
+	if err := trans.Commit(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if vers = history("s1"); len(vers) != 4 || fetchName("s1", vers[2].From) != "Song1c" {
+		t.Error("Unexpected result:", vers)
+		return
+	}
+
+	if vers = history("s0"); len(vers) != 1 || !vers[0].Removed || !vers[0].From.IsZero() {
+		t.Error("Unexpected result:", vers)
+		return
+	}
+
+	// Old versions can be pruned by age
+
+	if err := gm.SetNodeHistory("Song", &HistoryConfig{MaxAge: time.Hour, Tombstones: true}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res, err := gm.PruneNodeHistory("main", "Song"); res != 0 || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if err := gm.SetNodeHistory("Song", &HistoryConfig{MaxAge: time.Nanosecond, Tombstones: true}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res, err := gm.PruneNodeHistory("main", "Song"); res != 4 || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if vers = history("s1"); len(vers) != 1 || vers[0].From.IsZero() {
+		t.Error("Unexpected result:", vers)
+		return
+	}
+
+	// The tombstone of a node without versions is removed
+
+	if vers = history("s0"); len(vers) != 0 {
+		t.Error("Unexpected result:", vers)
+		return
+	}
+
+	// Without tombstones the history is removed together with the node
+
+	if err := gm.SetNodeHistory("Song", &HistoryConfig{}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	storeNode("s1", "Song1e")
+
+	if vers = history("s1"); len(vers) != 2 {
+		t.Error("Unexpected result:", vers)
+		return
+	}
+
+	gm.RemoveNode("main", "s1", "Song")
+	storeNode("s1", "Song1f")
+
+	if vers = history("s1"); len(vers) != 1 {
+		t.Error("Unexpected result:", vers)
+		return
+	}
+
+	// Disabling the history removes all history
+
+	storeNode("s1", "Song1g")
+
+	if err := gm.SetNodeHistory("Song", nil); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := gm.SetNodeHistory("Song", nil); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := gm.SetNodeHistory("Song", &HistoryConfig{}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if vers = history("s1"); len(vers) != 1 || !vers[0].From.IsZero() {
+		t.Error("Unexpected result:", vers)
+		return
+	}
+}
+
+func TestNodeHistoryDiskStorage(t *testing.T) {
+	if !RunDiskStorageTests {
+		return
+	}
+
+	dgs, err := graphstorage.NewDiskGraphStorage(GraphManagerTestDBDir6, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	gm := NewGraphManager(dgs)
+
+	if err := gm.SetNodeHistory("Song", &HistoryConfig{MaxVersions: 10}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	for i := 0; i < 3; i++ {
+		node := data.NewGraphNode()
+		node.SetAttr("key", "s1")
+		node.SetAttr("kind", "Song")
+		node.SetAttr("name", fmt.Sprint("Song", i))
+		node.SetAttr("tags", []string{"a", "b"})
+
+		if err := gm.StoreNode("main", node); err != nil {
+			t.Error(err)
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	dgs.Close()
+
+	dgs, err = graphstorage.NewDiskGraphStorage(GraphManagerTestDBDir6, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer dgs.Close()
+
+	gm = NewGraphManager(dgs)
+
+	vers, err := gm.NodeHistory("main", "s1", "Song")
+	if err != nil || len(vers) != 3 {
+		t.Error("Unexpected result:", vers, err)
+		return
+	}
+
+	node, err := gm.FetchNodeVersion("main", "s1", "Song", vers[1].From)
+	if err != nil || node.Attr("name") != "Song1" || fmt.Sprint(node.Attr("tags")) != "[a b]" {
+		t.Error("Unexpected result:", node, err)
+		return
+	}
+}
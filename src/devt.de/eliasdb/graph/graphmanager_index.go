@@ -0,0 +1,504 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+
+	"devt.de/common/stringutil"
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/util"
+	"devt.de/eliasdb/hash"
+	"devt.de/eliasdb/storage"
+)
+
+/*
+IndexRebuildBatchSize is the number of items which are indexed while holding
+the writer lock of a partition during an index rebuild.
+*/
+var IndexRebuildBatchSize = 1000
+
+/*
+States of the full text index of a kind in a partition
+*/
+const (
+	indexStateDisabled   = "disabled"   // Index is not maintained
+	indexStateIncomplete = "incomplete" // Index is maintained but needs a rebuild
+	indexStateBulkLoad   = "bulkload"   // Index updates are deferred by a bulk load
+)
+
+/*
+indexRebuild data structure which holds the state of the rebuild of a single
+index tree.
+*/
+type indexRebuild struct {
+	kind     string          // Kind of the indexed items
+	isEdge   bool            // Flag if the indexed items are edges
+	sm       storage.Manager // Storage manager of the index
+	newTree  *hash.HTree     // New index tree
+	attrTree *hash.HTree     // Tree which stores the attribute lists of the items
+	valTree  *hash.HTree     // Tree which stores the attribute values of the items
+	keys     []string        // Keys of all items which should be indexed
+}
+
+/*
+RebuildIndex rebuilds the full text index of all nodes and edges of a given
+kind in a given partition. The optional progress function is called after
+every batch with the number of indexed items and the total number of items.
+
+The new index is built next to the old index which stays in place until the
+new index is complete - queries keep working during the rebuild. Items are
+indexed in batches of IndexRebuildBatchSize and the writer lock of the
+partition is only held while a batch is processed. Writes to the partition
+are not blocked between batches - all changes to the index are also applied
+to the new index. Once all items have been indexed the new index replaces the
+old index.
+
+A rebuild is restartable. If a rebuild was interrupted (e.g. by a crash) then
+writes are still applied to the partially built index and calling
+RebuildIndex again continues with it.
+*/
+func (gm *Manager) RebuildIndex(part string, kind string, progress func(done, total int)) error {
+
+	// Check if the partition name is valid
+
+	if err := gm.checkPartitionName(part); err != nil {
+		return err
+	}
+
+	// Check if the kind is valid
+
+	if !stringutil.IsAlphaNumeric(kind) {
+		return &util.GraphError{
+			Type:   util.ErrInvalidData,
+			Detail: fmt.Sprintf("Kind %v is not alphanumeric - can only contain [a-zA-Z0-9_]", kind),
+		}
+	}
+
+	return gm.rebuildPartitionIndex(part, kind, false, progress)
+}
+
+/*
+rebuildPartitionIndex rebuilds the index of a kind in a partition while
+holding partition locks. An incomplete index is marked as complete once the
+rebuild has finished.
+*/
+func (gm *Manager) rebuildPartitionIndex(part string, kind string, discard bool,
+	progress func(done, total int)) error {
+
+	lock := func() func() {
+		return gm.writeLock(part)
+	}
+
+	if err := gm.rebuildIndex(part, kind, discard, lock, progress); err != nil {
+		return err
+	}
+
+	// The index is complete now
+
+	defer lock()()
+
+	if gm.indexState(part, kind) != indexStateIncomplete {
+		return nil
+	}
+
+	return gm.setIndexState(part, kind, "")
+}
+
+/*
+SetIndexingEnabled enables or disables the full text index of a kind in a
+partition. The setting is stored in the main database. If indexing is disabled
+then storing or removing nodes and edges of the kind does not update the index
+and all index queries for the kind fail with an ErrKindNotIndexed error. If
+indexing is enabled again then the index is rebuilt. Should the rebuild fail
+then the index is marked as incomplete and index queries fail with an
+ErrIndexStale error until RebuildIndex has been called successfully.
+*/
+func (gm *Manager) SetIndexingEnabled(part string, kind string, enabled bool) error {
+
+	if err := gm.checkPartitionName(part); err != nil {
+		return err
+	}
+
+	if !stringutil.IsAlphaNumeric(kind) {
+		return &util.GraphError{
+			Type:   util.ErrInvalidData,
+			Detail: fmt.Sprintf("Kind %v is not alphanumeric - can only contain [a-zA-Z0-9_]", kind),
+		}
+	}
+
+	unlock := gm.writeLock(part)
+
+	state := gm.indexState(part, kind)
+
+	if !enabled {
+		defer unlock()
+
+		if state == indexStateDisabled {
+			return nil
+		}
+
+		return gm.setIndexState(part, kind, indexStateDisabled)
+
+	} else if state != indexStateDisabled {
+		unlock()
+		return nil
+	}
+
+	// Index is maintained from now on but needs to be rebuilt - a partially
+	// built index of a previous rebuild has missed changes and is discarded
+
+	err := gm.setIndexState(part, kind, indexStateIncomplete)
+	unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return gm.rebuildPartitionIndex(part, kind, true, nil)
+}
+
+/*
+IndexingEnabled returns if the full text index of a kind in a partition is
+maintained.
+*/
+func (gm *Manager) IndexingEnabled(part string, kind string) bool {
+	return gm.indexState(part, kind) != indexStateDisabled
+}
+
+/*
+indexState returns the state of the full text index of a kind in a partition.
+Returns an empty string if the index is complete.
+*/
+func (gm *Manager) indexState(part string, kind string) string {
+	return gm.getMainDBMap(MainDBIndexState + kind)[part]
+}
+
+/*
+setIndexState sets the state of the full text index of a kind in a partition.
+An empty state marks the index as complete.
+*/
+func (gm *Manager) setIndexState(part string, kind string, state string) error {
+
+	gm.updateMainDBMap(MainDBIndexState+kind, func(states map[string]string) map[string]string {
+		if states == nil {
+			states = make(map[string]string)
+		}
+
+		if state == "" {
+			delete(states, part)
+		} else {
+			states[part] = state
+		}
+
+		return states
+	})
+
+	return gm.flushMain()
+}
+
+/*
+checkIndexState checks that the full text index of a kind in a partition can
+be queried.
+*/
+func (gm *Manager) checkIndexState(part string, kind string) error {
+
+	switch gm.indexState(part, kind) {
+
+	case indexStateDisabled:
+		return &util.GraphError{
+			Type:   util.ErrKindNotIndexed,
+			Detail: fmt.Sprintf("Indexing of kind %v is disabled in partition %v", kind, part),
+		}
+
+	case indexStateIncomplete:
+		return &util.GraphError{
+			Type:   util.ErrIndexStale,
+			Detail: fmt.Sprintf("Index of kind %v in partition %v is incomplete - the index must be rebuilt", kind, part),
+		}
+
+	case indexStateBulkLoad:
+		return &util.GraphError{
+			Type:   util.ErrIndexStale,
+			Detail: fmt.Sprintf("Bulk load of kind %v in partition %v is in progress - the bulk load must be ended", kind, part),
+		}
+	}
+
+	return nil
+}
+
+/*
+rebuildIndex rebuilds the node and edge index of a given kind in a given
+partition. The given lock function is called to protect every step of the
+rebuild. If the discard flag is set then a partially built index of a
+previous rebuild is discarded.
+*/
+func (gm *Manager) rebuildIndex(part string, kind string, discard bool,
+	lock func() func(), progress func(done, total int)) error {
+
+	var rebuilds []*indexRebuild
+
+	// Prepare the new index trees and collect the keys of all items
+
+	total := 0
+
+	for _, isEdge := range []bool{false, true} {
+
+		unlock := lock()
+		rebuild, err := gm.prepareIndexRebuild(part, kind, isEdge, discard)
+		unlock()
+
+		if err != nil {
+			return err
+		} else if rebuild == nil {
+			continue
+		}
+
+		err = iterateKeyBatchesWithLock(rebuild.attrTree, PrefixNSAttrs, IndexRebuildBatchSize,
+			lock, func(keys []string) error {
+
+				for _, k := range keys {
+					rebuild.keys = append(rebuild.keys, k[len(PrefixNSAttrs):])
+				}
+
+				return nil
+			})
+
+		if err != nil {
+			return err
+		}
+
+		total += len(rebuild.keys)
+		rebuilds = append(rebuilds, rebuild)
+	}
+
+	// Index all items in batches
+
+	done := 0
+
+	for _, rebuild := range rebuilds {
+
+		for i := 0; i < len(rebuild.keys); i += IndexRebuildBatchSize {
+
+			end := i + IndexRebuildBatchSize
+			if end > len(rebuild.keys) {
+				end = len(rebuild.keys)
+			}
+
+			unlock := lock()
+			err := gm.indexRebuildBatch(rebuild, rebuild.keys[i:end])
+			unlock()
+
+			if err != nil {
+				return err
+			}
+
+			done += end - i
+
+			if progress != nil {
+				progress(done, total)
+			}
+		}
+	}
+
+	// Replace the old indices
+
+	for _, rebuild := range rebuilds {
+
+		unlock := lock()
+		oldTree, err := gm.finishIndexRebuild(rebuild)
+		unlock()
+
+		if err == nil && oldTree != nil {
+			err = gm.removeIndexTree(rebuild.sm, oldTree, lock)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+prepareIndexRebuild creates or loads the new index tree for the rebuild of an
+index. Returns nil if there are no items to index.
+*/
+func (gm *Manager) prepareIndexRebuild(part string, kind string, isEdge bool,
+	discard bool) (*indexRebuild, error) {
+
+	storageSuffix, indexSuffix := StorageSuffixNodes, StorageSuffixNodesIndex
+	if isEdge {
+		storageSuffix, indexSuffix = StorageSuffixEdges, StorageSuffixEdgesIndex
+	}
+
+	attrTree, err := gm.existingHTree(part + kind + storageSuffix)
+	if err != nil || attrTree == nil {
+		return nil, err
+	}
+
+	// Node attribute values are stored in a second tree
+
+	valTree := attrTree
+
+	if !isEdge {
+		valTree, err = gm.getHTree(gm.gs.StorageManager(part+kind+storageSuffix, false),
+			RootIDNodeHTreeSecond)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Make sure the index exists
+
+	sm := gm.gs.StorageManager(part+kind+indexSuffix, true)
+
+	if _, err := gm.getHTree(sm, RootIDNodeHTree); err != nil {
+		return nil, err
+	}
+
+	// Discard a partially built index if requested
+
+	if discard && sm.Root(RootIDIndexRebuild) != 0 {
+
+		oldTree, err := gm.getHTree(sm, RootIDIndexRebuild)
+		if err != nil {
+			return nil, err
+		}
+
+		sm.SetRoot(RootIDIndexRebuild, 0)
+
+		nolock := func() func() {
+			return func() {}
+		}
+
+		if err := gm.removeIndexTree(sm, oldTree, nolock); err != nil {
+			return nil, err
+		}
+	}
+
+	// Create the new index tree or continue with an existing one - the tree
+	// location is stored so all writes are applied to the new tree as well
+
+	newTree, err := gm.getHTree(sm, RootIDIndexRebuild)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sm.Flush(); err != nil {
+		return nil, &util.GraphError{Type: util.ErrFlushing, Detail: err.Error(), Cause: err}
+	}
+
+	return &indexRebuild{kind, isEdge, sm, newTree, attrTree, valTree, nil}, nil
+}
+
+/*
+indexRebuildBatch indexes a batch of items into the new index tree.
+*/
+func (gm *Manager) indexRebuildBatch(rebuild *indexRebuild, keys []string) error {
+
+	im := gm.newIndexManager(rebuild.kind, rebuild.newTree)
+
+	for _, key := range keys {
+
+		node, err := gm.readNode(key, rebuild.kind, nil, rebuild.attrTree, rebuild.valTree)
+		if err != nil {
+			return err
+		} else if node == nil {
+
+			// Item was removed since the keys were collected
+
+			continue
+		}
+
+		indexMap := node.IndexMap()
+		if rebuild.isEdge {
+			indexMap = data.NewGraphEdgeFromNode(node).IndexMap()
+		}
+
+		if err := im.Index(key, indexMap); err != nil {
+			return err
+		}
+	}
+
+	if err := rebuild.sm.Flush(); err != nil {
+		return &util.GraphError{Type: util.ErrFlushing, Detail: err.Error(), Cause: err}
+	}
+
+	return nil
+}
+
+/*
+finishIndexRebuild replaces the old index tree with the new index tree.
+Returns the old index tree or nil if the rebuild was already finished by
+somebody else.
+*/
+func (gm *Manager) finishIndexRebuild(rebuild *indexRebuild) (*hash.HTree, error) {
+
+	if rebuild.sm.Root(RootIDIndexRebuild) != rebuild.newTree.Location() {
+		return nil, nil
+	}
+
+	oldTree, err := gm.getHTree(rebuild.sm, RootIDNodeHTree)
+	if err != nil {
+		return nil, err
+	}
+
+	rebuild.sm.SetRoot(RootIDNodeHTree, rebuild.newTree.Location())
+	rebuild.sm.SetRoot(RootIDIndexRebuild, 0)
+
+	if err := rebuild.sm.Flush(); err != nil {
+		return nil, &util.GraphError{Type: util.ErrFlushing, Detail: err.Error(), Cause: err}
+	}
+
+	return oldTree, nil
+}
+
+/*
+removeIndexTree removes all entries of an index tree which is no longer used.
+*/
+func (gm *Manager) removeIndexTree(sm storage.Manager, tree *hash.HTree, lock func() func()) error {
+	var keys []string
+
+	err := iterateKeyBatchesWithLock(tree, "", IndexRebuildBatchSize, lock, func(batch []string) error {
+		keys = append(keys, batch...)
+		return nil
+	})
+
+	for i := 0; err == nil && i < len(keys); i += IndexRebuildBatchSize {
+
+		end := i + IndexRebuildBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		unlock := lock()
+
+		for _, k := range keys[i:end] {
+			if _, err = tree.Remove([]byte(k)); err != nil {
+				err = &util.GraphError{Type: util.ErrIndexError, Detail: err.Error(), Cause: err}
+				break
+			}
+		}
+
+		if err == nil {
+			if ferr := sm.Flush(); ferr != nil {
+				err = &util.GraphError{Type: util.ErrFlushing, Detail: ferr.Error(), Cause: ferr}
+			}
+		}
+
+		unlock()
+	}
+
+	return err
+}
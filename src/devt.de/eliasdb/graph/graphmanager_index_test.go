@@ -0,0 +1,391 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"testing"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+	"devt.de/eliasdb/graph/util"
+)
+
+func TestRebuildIndex(t *testing.T) {
+
+	oldBatchSize := IndexRebuildBatchSize
+	IndexRebuildBatchSize = 10
+	defer func() {
+		IndexRebuildBatchSize = oldBatchSize
+	}()
+
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	storeNode := func(key string, name string) data.Node {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "Song")
+		node.SetAttr("name", name)
+
+		if err := gm.StoreNode("main", node); err != nil {
+			t.Error(err)
+		}
+
+		return node
+	}
+
+	for i := 0; i < 25; i++ {
+		storeNode(fmt.Sprint("s", i), fmt.Sprint("Song number ", i))
+	}
+
+	edge := data.NewGraphEdge()
+
+	edge.SetAttr("key", "e1")
+	edge.SetAttr("kind", "Song")
+	edge.SetAttr("name", "Song edge")
+
+	edge.SetAttr(data.EdgeEnd1Key, "s1")
+	edge.SetAttr(data.EdgeEnd1Kind, "Song")
+	edge.SetAttr(data.EdgeEnd1Role, "cover")
+	edge.SetAttr(data.EdgeEnd1Cascading, false)
+
+	edge.SetAttr(data.EdgeEnd2Key, "s2")
+	edge.SetAttr(data.EdgeEnd2Kind, "Song")
+	edge.SetAttr(data.EdgeEnd2Role, "original")
+	edge.SetAttr(data.EdgeEnd2Cascading, false)
+
+	if err := gm.StoreEdge("main", edge); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Test error cases
+
+	if err := gm.RebuildIndex("ma-in", "Song", nil); err == nil ||
+		err.Error() != "GraphError: Invalid data (Partition name ma-in is not alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.RebuildIndex("main", "So-ng", nil); err == nil ||
+		err.Error() != "GraphError: Invalid data (Kind So-ng is not alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Rebuilding the index of an unknown kind does nothing
+
+	if err := gm.RebuildIndex("main", "Album", nil); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Corrupt the index
+
+	im, _ := gm.getNodeIndexManager("main", "Song", false)
+	im.Deindex("s3", map[string]string{"name": "Song number 3"})
+	im.Index("s99", map[string]string{"name": "Song number 99"})
+
+	if res, err := gm.LookupPhrase("main", "Song", "name", "number 3"); fmt.Sprint(res) != "[]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Rebuild the index - do some writes and queries while the index is rebuilt
+
+	var progress []string
+
+	err := gm.RebuildIndex("main", "Song", func(done, total int) {
+		progress = append(progress, fmt.Sprintf("%v/%v", done, total))
+
+		if done == 10 {
+
+			// The old index is still in use
+
+			if res, err := gm.LookupPhrase("main", "Song", "name", "number 99"); fmt.Sprint(res) != "[s99]" || err != nil {
+				t.Error("Unexpected result:", res, err)
+			}
+
+			storeNode("s100", "Song number 100")
+			storeNode("s20", "Song title 20")
+
+			if _, err := gm.RemoveNode("main", "s5", "Song"); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := fmt.Sprint(progress); res != "[10/26 20/26 25/26 26/26]" {
+		t.Error("Unexpected progress:", res)
+		return
+	}
+
+	if res, err := gm.LookupPhrase("main", "Song", "name", "number 3"); fmt.Sprint(res) != "[s3]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gm.LookupPhrase("main", "Song", "name", "number 99"); fmt.Sprint(res) != "[]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gm.LookupPhrase("main", "Song", "name", "number 100"); fmt.Sprint(res) != "[s100]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gm.LookupPhrase("main", "Song", "name", "number 20"); fmt.Sprint(res) != "[]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gm.LookupPhrase("main", "Song", "name", "title 20"); fmt.Sprint(res) != "[s20]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gm.LookupPhrase("main", "Song", "name", "number 5"); fmt.Sprint(res) != "[]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gm.LookupPhrase("main", "Song", "name", "song"); len(res) != 25 || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	eq, _ := gm.EdgeIndexQuery("main", "Song")
+
+	if res, err := eq.LookupPhrase("name", "song edge"); fmt.Sprint(res) != "[e1]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	sm := mgs.StorageManager("mainSong"+StorageSuffixNodesIndex, false)
+
+	if res := sm.Root(RootIDIndexRebuild); res != 0 {
+		t.Error("Unexpected rebuild root:", res)
+		return
+	}
+
+	// Simulate an interrupted rebuild
+
+	unlock := gm.writeLock("main")
+	rebuild, err := gm.prepareIndexRebuild("main", "Song", false, false)
+	unlock()
+
+	if err != nil || rebuild == nil {
+		t.Error("Unexpected result:", rebuild, err)
+		return
+	}
+
+	gm.indexRebuildBatch(rebuild, []string{"s1", "s2"})
+
+	// Writes are applied to the partially built index - even after a restart
+
+	gm = NewGraphManager(mgs)
+
+	storeNode("s101", "Song number 101")
+
+	if res, err := gm.newIndexManager("Song", rebuild.newTree).LookupPhrase("name", "song number"); fmt.Sprint(res) != "[s1 s101 s2]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// The old index is still used for queries
+
+	if res, err := gm.LookupPhrase("main", "Song", "name", "number"); len(res) != 25 || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Continue the rebuild
+
+	if err := gm.RebuildIndex("main", "Song", nil); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := sm.Root(RootIDNodeHTree); res != rebuild.newTree.Location() {
+		t.Error("Unexpected index root:", res, rebuild.newTree.Location())
+		return
+	}
+
+	if res, err := gm.LookupPhrase("main", "Song", "name", "number"); len(res) != 25 || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gm.LookupPhrase("main", "Song", "name", "number 101"); fmt.Sprint(res) != "[s101]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res := sm.Root(RootIDIndexRebuild); res != 0 {
+		t.Error("Unexpected rebuild root:", res)
+		return
+	}
+}
+
+func TestIndexingEnabled(t *testing.T) {
+
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	storeNode := func(key string, name string) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "Metric")
+		node.SetAttr("name", name)
+
+		if err := gm.StoreNode("main", node); err != nil {
+			t.Error(err)
+		}
+	}
+
+	storeNode("m1", "cpu load")
+	storeNode("m2", "memory usage")
+
+	// Test error cases
+
+	if err := gm.SetIndexingEnabled("ma-in", "Metric", false); err == nil ||
+		err.Error() != "GraphError: Invalid data (Partition name ma-in is not alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.SetIndexingEnabled("main", "Met-ric", false); err == nil ||
+		err.Error() != "GraphError: Invalid data (Kind Met-ric is not alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Enabling an enabled index does nothing
+
+	if err := gm.SetIndexingEnabled("main", "Metric", true); err != nil || !gm.IndexingEnabled("main", "Metric") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Disable indexing
+
+	if err := gm.SetIndexingEnabled("main", "Metric", false); err != nil || gm.IndexingEnabled("main", "Metric") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.SetIndexingEnabled("main", "Metric", false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Other partitions are not affected
+
+	if !gm.IndexingEnabled("other", "Metric") {
+		t.Error("Unexpected result")
+		return
+	}
+
+	// Writes do not update the index
+
+	storeNode("m3", "disk usage")
+	storeNode("m1", "cpu temperature")
+
+	if _, err := gm.RemoveNode("main", "m2", "Metric"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	iht, _ := gm.getNodeIndexHTree("main", "Metric", false)
+
+	if res, err := gm.newIndexManager("Metric", iht).LookupPhrase("name", "usage"); fmt.Sprint(res) != "[m2]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Index queries fail
+
+	if _, err := gm.LookupPhrase("main", "Metric", "name", "usage"); err == nil ||
+		err.Error() != "GraphError: Kind is not indexed (Indexing of kind Metric is disabled in partition main)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := gm.EdgeIndexQuery("main", "Metric"); err.(*util.GraphError).Type != util.ErrKindNotIndexed {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// The setting is persisted
+
+	gm = NewGraphManager(mgs)
+
+	if gm.IndexingEnabled("main", "Metric") {
+		t.Error("Unexpected result")
+		return
+	}
+
+	// The index of a disabled kind is not checked
+
+	if ir, err := gm.CheckIntegrity("main", false); err != nil || len(ir.DanglingIndexEntries) != 0 {
+		t.Error("Unexpected result:", ir, err)
+		return
+	}
+
+	// Enabling indexing rebuilds the index
+
+	if err := gm.SetIndexingEnabled("main", "Metric", true); err != nil || !gm.IndexingEnabled("main", "Metric") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err := gm.LookupPhrase("main", "Metric", "name", "usage"); fmt.Sprint(res) != "[m3]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gm.LookupPhrase("main", "Metric", "name", "cpu temperature"); fmt.Sprint(res) != "[m1]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res := gm.getMainDBMap(MainDBIndexState + "Metric"); len(res) != 0 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// An incomplete index cannot be queried until it was rebuilt
+
+	gm.setIndexState("main", "Metric", indexStateIncomplete)
+
+	if _, err := gm.LookupPhrase("main", "Metric", "name", "usage"); err == nil ||
+		err.Error() != "GraphError: Index is stale (Index of kind Metric in partition main is incomplete - the index must be rebuilt)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.RebuildIndex("main", "Metric", nil); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res, err := gm.LookupPhrase("main", "Metric", "name", "usage"); fmt.Sprint(res) != "[m3]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+}
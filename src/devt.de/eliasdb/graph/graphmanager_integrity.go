@@ -0,0 +1,653 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/util"
+	"devt.de/eliasdb/hash"
+)
+
+/*
+IntegrityCheckBatchSize is the number of items which are checked while holding
+a lock during an integrity check.
+*/
+var IntegrityCheckBatchSize = 1000
+
+/*
+IntegrityReport is the result of an integrity check.
+*/
+type IntegrityReport struct {
+	Partition            string   // Partition which was checked
+	DanglingEdges        []string // Edges with a missing endpoint
+	DanglingTraversals   []string // Traversal entries which point to a missing edge or node
+	DanglingIndexEntries []string // Full text index entries which point to a missing edge or node
+	MissingBookkeeping   []string // Partitions, kinds or attributes missing from the main database
+	Repaired             bool     // Flag if the found problems were repaired
+
+	found map[string]bool // Lookup for already reported problems
+}
+
+/*
+IsConsistent returns if no problems were found.
+*/
+func (ir *IntegrityReport) IsConsistent() bool {
+	return len(ir.DanglingEdges) == 0 && len(ir.DanglingTraversals) == 0 &&
+		len(ir.DanglingIndexEntries) == 0 && len(ir.MissingBookkeeping) == 0
+}
+
+/*
+add adds a problem to a given list of the report. Problems are only reported once.
+*/
+func (ir *IntegrityReport) add(list *[]string, problem string) {
+	if !ir.found[problem] {
+		ir.found[problem] = true
+		*list = append(*list, problem)
+	}
+}
+
+/*
+String returns a string representation of this report.
+*/
+func (ir *IntegrityReport) String() string {
+	var buf bytes.Buffer
+
+	buf.WriteString(fmt.Sprintf("IntegrityReport for partition %v (repaired: %v)\n",
+		ir.Partition, ir.Repaired))
+
+	writeList := func(name string, list []string) {
+		buf.WriteString(fmt.Sprintf("%v: %v\n", name, len(list)))
+		for _, item := range list {
+			buf.WriteString("    " + item + "\n")
+		}
+	}
+
+	writeList("Dangling edges", ir.DanglingEdges)
+	writeList("Dangling traversal entries", ir.DanglingTraversals)
+	writeList("Dangling index entries", ir.DanglingIndexEntries)
+	writeList("Missing bookkeeping", ir.MissingBookkeeping)
+
+	return buf.String()
+}
+
+/*
+CheckIntegrity checks the integrity of a partition. The check verifies that
+the endpoints of all edges exist, that all traversal entries of nodes point
+to existing edges, that all full text index entries point to existing nodes
+or edges and that all kinds and attributes are known in the main database.
+If the repair flag is set then dangling edges and entries are removed and
+missing bookkeeping information is added. Items are processed in batches of
+IntegrityCheckBatchSize - locks are only held while a batch is processed so
+the check can run on a live database.
+*/
+func (gm *Manager) CheckIntegrity(part string, repair bool) (*IntegrityReport, error) {
+
+	if err := gm.checkPartitionName(part); err != nil {
+		return nil, err
+	}
+
+	ir := &IntegrityReport{part, []string{}, []string{}, []string{}, []string{},
+		repair, make(map[string]bool)}
+
+	// Collect all kinds which might have data in the partition
+
+	nodeKinds := make(map[string]bool)
+	edgeKinds := make(map[string]bool)
+
+	unlock := gm.readLock(part)
+
+	for _, kind := range gm.mainStringList(MainDBNodeKinds) {
+		nodeKinds[kind] = true
+
+		for _, spec := range gm.mainStringList(MainDBNodeEdges + kind) {
+			sspec := strings.Split(spec, ":")
+			edgeKinds[sspec[1]] = true
+			nodeKinds[sspec[3]] = true
+		}
+	}
+
+	for _, kind := range gm.mainStringList(MainDBEdgeKinds) {
+		edgeKinds[kind] = true
+	}
+
+	unlock()
+
+	// Check edges first - missing endpoints reveal further node kinds
+
+	for _, kind := range sortedKeys(edgeKinds) {
+		if err := gm.checkEdgeKindIntegrity(part, kind, nodeKinds, ir); err != nil {
+			return ir, err
+		}
+	}
+
+	for _, kind := range sortedKeys(nodeKinds) {
+		if err := gm.checkNodeKindIntegrity(part, kind, ir); err != nil {
+			return ir, err
+		}
+	}
+
+	// Ensure the output is deterministic
+
+	sort.StringSlice(ir.DanglingEdges).Sort()
+	sort.StringSlice(ir.DanglingTraversals).Sort()
+	sort.StringSlice(ir.DanglingIndexEntries).Sort()
+	sort.StringSlice(ir.MissingBookkeeping).Sort()
+
+	// Repairs bypass the graph events
+
+	if repair {
+		gm.stats.invalidate(part)
+	}
+
+	return ir, nil
+}
+
+/*
+checkEdgeKindIntegrity checks all edges of a given kind in a partition.
+*/
+func (gm *Manager) checkEdgeKindIntegrity(part string, kind string,
+	nodeKinds map[string]bool, ir *IntegrityReport) error {
+
+	edgeTree, err := gm.existingHTree(part + kind + StorageSuffixEdges)
+	if err != nil || edgeTree == nil {
+		return err
+	}
+
+	err = gm.iterateKeyBatches(part, edgeTree, PrefixNSAttrs, ir.Repaired, func(keys []string) error {
+
+		for _, k := range keys {
+			key := k[len(PrefixNSAttrs):]
+
+			node, err := gm.readNode(key, kind, nil, edgeTree, edgeTree)
+			if err != nil {
+				return err
+			} else if node == nil {
+				continue
+			}
+
+			edge := data.NewGraphEdgeFromNode(node)
+
+			nodeKinds[edge.End1Kind()] = true
+			nodeKinds[edge.End2Kind()] = true
+
+			// Check the endpoints
+
+			end1Exists, err := gm.itemExists(part+edge.End1Kind()+StorageSuffixNodes, edge.End1Key())
+			if err != nil {
+				return err
+			}
+
+			end2Exists, err := gm.itemExists(part+edge.End2Kind()+StorageSuffixNodes, edge.End2Key())
+			if err != nil {
+				return err
+			}
+
+			if !end1Exists || !end2Exists {
+				var missing []string
+
+				if !end1Exists {
+					missing = append(missing, fmt.Sprintf("%v (%v)", edge.End1Key(), edge.End1Kind()))
+				}
+				if !end2Exists {
+					missing = append(missing, fmt.Sprintf("%v (%v)", edge.End2Key(), edge.End2Kind()))
+				}
+
+				ir.DanglingEdges = append(ir.DanglingEdges, fmt.Sprintf("Edge %v (%v) has missing endpoint: %v",
+					key, kind, strings.Join(missing, ", ")))
+
+				if ir.Repaired {
+					if err := gm.removeDanglingEdge(part, edge, edgeTree, end1Exists, end2Exists); err != nil {
+						return err
+					}
+				}
+
+				continue
+			}
+
+			gm.checkBookkeeping(part, kind, MainDBEdgeKinds, MainDBEdgeAttrs+kind, edge, ir)
+		}
+
+		return gm.flushIntegrityRepair(part, kind, ir.Repaired, gm.flushEdgeStorage)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// Check the full text index
+
+	return gm.checkIndexIntegrity(part+kind+StorageSuffixEdgesIndex, part+kind+StorageSuffixEdges,
+		"Edge", kind, ir)
+}
+
+/*
+checkNodeKindIntegrity checks all nodes of a given kind in a partition.
+*/
+func (gm *Manager) checkNodeKindIntegrity(part string, kind string, ir *IntegrityReport) error {
+
+	attrTree, err := gm.existingHTree(part + kind + StorageSuffixNodes)
+	if err != nil || attrTree == nil {
+		return err
+	}
+
+	sm := gm.gs.StorageManager(part+kind+StorageSuffixNodes, false)
+
+	valTree, err := gm.getHTree(sm, RootIDNodeHTreeSecond)
+	if err != nil {
+		return err
+	}
+
+	// Check the bookkeeping of all nodes
+
+	err = gm.iterateKeyBatches(part, attrTree, PrefixNSAttrs, ir.Repaired, func(keys []string) error {
+
+		for _, k := range keys {
+			node, err := gm.readNode(k[len(PrefixNSAttrs):], kind, nil, attrTree, valTree)
+			if err != nil {
+				return err
+			} else if node != nil {
+				gm.checkBookkeeping(part, kind, MainDBNodeKinds, MainDBNodeAttrs+kind, node, ir)
+			}
+		}
+
+		return gm.flushIntegrityRepair(part, kind, ir.Repaired, gm.flushNodeStorage)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// Check the traversal entries of all nodes
+
+	err = gm.iterateKeyBatches(part, valTree, PrefixNSEdge, ir.Repaired, func(keys []string) error {
+
+		for _, k := range keys {
+			nodeKey := k[len(PrefixNSEdge) : len(k)-8]
+			encspec := k[len(k)-8:]
+			edgeKind := gm.decode16(encspec[2:4])
+
+			obj, err := valTree.Get([]byte(k))
+			if err != nil {
+				return &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
+			} else if obj == nil {
+				continue
+			}
+
+			nodeExists, err := gm.itemExists(part+kind+StorageSuffixNodes, nodeKey)
+			if err != nil {
+				return err
+			}
+
+			for edgeKey := range obj.(map[string]*edgeTargetInfo) {
+
+				edgeExists, err := gm.itemExists(part+edgeKind+StorageSuffixEdges, edgeKey)
+				if err != nil {
+					return err
+				}
+
+				if nodeExists && edgeExists {
+					continue
+				}
+
+				missing := "node"
+				if nodeExists {
+					missing = fmt.Sprintf("edge %v (%v)", edgeKey, edgeKind)
+				}
+
+				ir.DanglingTraversals = append(ir.DanglingTraversals,
+					fmt.Sprintf("Traversal entry %v of node %v (%v) points to missing %v",
+						gm.decodeSpec(encspec), nodeKey, kind, missing))
+
+				if ir.Repaired {
+					if err := gm.removeTraversalEntry(nodeKey, encspec, edgeKey, valTree); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		return gm.flushIntegrityRepair(part, kind, ir.Repaired, gm.flushNodeStorage)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// Check the full text index
+
+	return gm.checkIndexIntegrity(part+kind+StorageSuffixNodesIndex, part+kind+StorageSuffixNodes,
+		"Node", kind, ir)
+}
+
+/*
+checkIndexIntegrity checks that all entries of a full text index point to
+existing items.
+*/
+func (gm *Manager) checkIndexIntegrity(indexName string, storageName string,
+	name string, kind string, ir *IntegrityReport) error {
+
+	// The index of a kind with disabled indexing is not maintained
+
+	if gm.indexState(ir.Partition, kind) == indexStateDisabled {
+		return nil
+	}
+
+	indexTree, err := gm.existingHTree(indexName)
+	if err != nil || indexTree == nil {
+		return err
+	}
+
+	im := util.NewIndexManager(indexTree)
+
+	exists := func(key string) (bool, error) {
+		return gm.itemExists(storageName, key)
+	}
+
+	err = gm.iterateKeyBatches(ir.Partition, indexTree, "", ir.Repaired, func(keys []string) error {
+
+		missing, err := im.CheckEntries(keys, exists, ir.Repaired)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range missing {
+			ir.add(&ir.DanglingIndexEntries, fmt.Sprintf("%v index entry points to missing %v (%v)",
+				name, key, kind))
+		}
+
+		if ir.Repaired {
+			if sm := gm.gs.StorageManager(indexName, false); sm != nil {
+				if err := sm.Flush(); err != nil {
+					return &util.GraphError{Type: util.ErrFlushing, Detail: err.Error(), Cause: err}
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+/*
+checkBookkeeping checks that the partition, kind and all attributes of a
+given item are known in the main database.
+*/
+func (gm *Manager) checkBookkeeping(part string, kind string, kindsEntry string,
+	attrsEntry string, item data.Node, ir *IntegrityReport) {
+
+	check := func(entry string, val string, desc string) {
+		if _, ok := gm.getMainDBMap(entry)[val]; !ok {
+			ir.add(&ir.MissingBookkeeping, desc)
+
+			if ir.Repaired {
+				gm.updateMainDBMap(entry, func(vals map[string]string) map[string]string {
+					if vals == nil {
+						vals = make(map[string]string)
+					}
+					vals[val] = ""
+					return vals
+				})
+			}
+		}
+	}
+
+	check(MainDBParts, part, "Partition "+part+" is not registered")
+	check(kindsEntry, kind, "Kind "+kind+" is not registered")
+
+	for attr := range item.Data() {
+		check(attrsEntry, attr, fmt.Sprintf("Attribute %v of kind %v is not registered", attr, kind))
+	}
+}
+
+/*
+removeDanglingEdge removes an edge which has a missing endpoint. It is assumed
+that the caller holds the writer lock.
+*/
+func (gm *Manager) removeDanglingEdge(part string, edge data.Edge, edgeTree *hash.HTree,
+	end1Exists bool, end2Exists bool) error {
+
+	if _, err := gm.deleteNode(edge.Key(), edge.Kind(), edgeTree, edgeTree); err != nil {
+		return err
+	}
+
+	// Remove the traversal information from the existing endpoints
+
+	removeFromEnd := func(key string, kind string, end1 bool) error {
+		sm := gm.gs.StorageManager(part+kind+StorageSuffixNodes, false)
+
+		tree, err := gm.getHTree(sm, RootIDNodeHTreeSecond)
+		if err != nil {
+			return err
+		}
+
+		for _, spec := range edgeEndSpecs(edge, end1) {
+			if err := gm.removeTraversalEntry(key, gm.encodeSpec(spec, true), edge.Key(), tree); err != nil {
+				return err
+			}
+		}
+
+		return gm.flushNodeStorage(part, kind)
+	}
+
+	if end1Exists {
+		if err := removeFromEnd(edge.End1Key(), edge.End1Kind(), true); err != nil {
+			return err
+		}
+	}
+
+	if end2Exists {
+		if err := removeFromEnd(edge.End2Key(), edge.End2Kind(), false); err != nil {
+			return err
+		}
+	}
+
+	// Remove the edge from the index
+
+	im, err := gm.getEdgeIndexManager(part, edge.Kind(), false)
+	if err != nil {
+		return err
+	} else if im != nil {
+		if err := im.Deindex(edge.Key(), edge.IndexMap()); err != nil {
+			return err
+		}
+		gm.flushEdgeIndex(part, edge.Kind())
+	}
+
+	// Decrease edge count
+
+	return gm.addEdgeCount(part, edge.Kind(), -1, true)
+}
+
+/*
+removeTraversalEntry removes an edge from the traversal information of a node.
+Missing entries are ignored.
+*/
+func (gm *Manager) removeTraversalEntry(nodeKey string, encspec string, edgeKey string,
+	tree *hash.HTree) error {
+
+	edgeInfoKey := []byte(PrefixNSEdge + nodeKey + encspec)
+
+	obj, err := tree.Get(edgeInfoKey)
+	if err != nil {
+		return &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
+	} else if obj == nil {
+		return nil
+	}
+
+	targetMap := obj.(map[string]*edgeTargetInfo)
+	delete(targetMap, edgeKey)
+
+	if len(targetMap) > 0 {
+		if _, err := tree.Put(edgeInfoKey, targetMap); err != nil {
+			return &util.GraphError{Type: util.ErrWriting, Detail: err.Error(), Cause: err}
+		}
+		return nil
+	}
+
+	if _, err := tree.Remove(edgeInfoKey); err != nil {
+		return &util.GraphError{Type: util.ErrWriting, Detail: err.Error(), Cause: err}
+	}
+
+	// Remove the spec from the specs map of the node
+
+	specsNodeKey := []byte(PrefixNSSpecs + nodeKey)
+
+	obj, err = tree.Get(specsNodeKey)
+	if err != nil {
+		return &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
+	} else if obj == nil {
+		return nil
+	}
+
+	specsNode := obj.(map[string]string)
+	delete(specsNode, encspec)
+
+	if len(specsNode) > 0 {
+		_, err = tree.Put(specsNodeKey, specsNode)
+	} else {
+		_, err = tree.Remove(specsNodeKey)
+	}
+
+	if err != nil {
+		return &util.GraphError{Type: util.ErrWriting, Detail: err.Error(), Cause: err}
+	}
+
+	return nil
+}
+
+/*
+flushIntegrityRepair flushes the changes of a repair batch.
+*/
+func (gm *Manager) flushIntegrityRepair(part string, kind string, repair bool,
+	flush func(string, string) error) error {
+
+	if !repair {
+		return nil
+	}
+
+	if err := gm.flushMain(); err != nil {
+		return &util.GraphError{Type: util.ErrFlushing, Detail: err.Error(), Cause: err}
+	}
+
+	return flush(part, kind)
+}
+
+/*
+iterateKeyBatches iterates over all keys of a given HTree which start with a
+given prefix. The keys are handed to a given function in batches of
+IntegrityCheckBatchSize. A lock on the given partition is only held while a
+batch is collected and processed. The writer lock is taken if the batch
+function modifies data.
+*/
+func (gm *Manager) iterateKeyBatches(part string, tree *hash.HTree, prefix string, write bool,
+	f func(keys []string) error) error {
+
+	return iterateKeyBatchesWithLock(tree, prefix, IntegrityCheckBatchSize, func() func() {
+		if write {
+			return gm.writeLock(part)
+		}
+		return gm.readLock(part)
+	}, f)
+}
+
+/*
+iterateKeyBatchesWithLock iterates over all keys of a given HTree which start
+with a given prefix. The keys are handed to a given function in batches of a
+given size. The given lock function is called for every batch and returns a
+function which releases the lock.
+*/
+func iterateKeyBatchesWithLock(tree *hash.HTree, prefix string, batchSize int,
+	lock func() func(), f func(keys []string) error) error {
+
+	unlock := lock()
+	it := hash.NewHTreeIterator(tree)
+	unlock()
+
+	for {
+		var err error
+
+		batch := make([]string, 0, batchSize)
+
+		unlock = lock()
+
+		for it.HasNext() && len(batch) < batchSize {
+			if k, _ := it.Next(); strings.HasPrefix(string(k), prefix) {
+				batch = append(batch, string(k))
+			}
+		}
+
+		if it.LastError != nil {
+			err = &util.GraphError{Type: util.ErrReading, Detail: it.LastError.Error(), Cause: it.LastError}
+		} else if len(batch) > 0 {
+			err = f(batch)
+		}
+
+		hasNext := it.HasNext()
+
+		unlock()
+
+		if err != nil || !hasNext {
+			return err
+		}
+	}
+}
+
+/*
+existingHTree returns the main HTree of an existing storage manager. Returns
+nil if the storage manager does not exist.
+*/
+func (gm *Manager) existingHTree(smname string) (*hash.HTree, error) {
+	sm := gm.gs.StorageManager(smname, false)
+	if sm == nil {
+		return nil, nil
+	}
+
+	return gm.getHTree(sm, RootIDNodeHTree)
+}
+
+/*
+itemExists checks if a node or edge with a given key exists in a given
+storage manager.
+*/
+func (gm *Manager) itemExists(smname string, key string) (bool, error) {
+	tree, err := gm.existingHTree(smname)
+	if err != nil || tree == nil {
+		return false, err
+	}
+
+	obj, err := tree.Get([]byte(PrefixNSAttrs + key))
+	if err != nil {
+		return false, &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
+	}
+
+	return obj != nil, nil
+}
+
+/*
+sortedKeys returns the sorted keys of a map.
+*/
+func sortedKeys(m map[string]bool) []string {
+	ret := make([]string, 0, len(m))
+
+	for k := range m {
+		ret = append(ret, k)
+	}
+
+	sort.StringSlice(ret).Sort()
+
+	return ret
+}
@@ -0,0 +1,171 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"testing"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	constructNode := func(key string) data.Node {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "mykind")
+		node.SetAttr("Name", "Node "+key)
+
+		if err := gm.StoreNode("main", node); err != nil {
+			t.Error(err)
+		}
+
+		return node
+	}
+
+	constructEdge := func(key string, node1 data.Node, node2 data.Node) {
+		edge := data.NewGraphEdge()
+
+		edge.SetAttr("key", key)
+		edge.SetAttr("kind", "myedge")
+		edge.SetAttr("Name", "Edge "+key)
+
+		edge.SetAttr(data.EdgeEnd1Key, node1.Key())
+		edge.SetAttr(data.EdgeEnd1Kind, node1.Kind())
+		edge.SetAttr(data.EdgeEnd1Role, "node1")
+		edge.SetAttr(data.EdgeEnd1Cascading, false)
+
+		edge.SetAttr(data.EdgeEnd2Key, node2.Key())
+		edge.SetAttr(data.EdgeEnd2Kind, node2.Kind())
+		edge.SetAttr(data.EdgeEnd2Role, "node2")
+		edge.SetAttr(data.EdgeEnd2Cascading, false)
+
+		if err := gm.StoreEdge("main", edge); err != nil {
+			t.Error(err)
+		}
+	}
+
+	n1 := constructNode("n1")
+	n2 := constructNode("n2")
+	n3 := constructNode("n3")
+	n4 := constructNode("n4")
+
+	constructEdge("e1", n1, n2)
+	constructEdge("e2", n1, n3)
+	constructEdge("e3", n1, n4)
+
+	// Use a small batch size to test the batch processing
+
+	oldBatchSize := IntegrityCheckBatchSize
+	IntegrityCheckBatchSize = 2
+	defer func() {
+		IntegrityCheckBatchSize = oldBatchSize
+	}()
+
+	ir, err := gm.CheckIntegrity("main", false)
+	if err != nil || !ir.IsConsistent() {
+		t.Error("Unexpected result:", ir, err)
+		return
+	}
+
+	// Remove a node without removing its edges
+
+	attTree, valTree, _ := gm.getNodeStorageHTree("main", "mykind", false)
+	gm.deleteNode("n2", "mykind", attTree, valTree)
+
+	// Remove an edge without removing its traversal information
+
+	edgeTree, _ := gm.getEdgeStorageHTree("main", "myedge", false)
+	gm.deleteNode("e2", "myedge", edgeTree, edgeTree)
+	gm.writeEdgeCount("myedge", 2, false)
+
+	// Remove bookkeeping information
+
+	attrs := gm.getMainDBMap(MainDBNodeAttrs + "mykind")
+	delete(attrs, "Name")
+	gm.storeMainDBMap(MainDBNodeAttrs+"mykind", attrs)
+
+	ir, err = gm.CheckIntegrity("main", false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if ir.IsConsistent() || ir.String() != `
+IntegrityReport for partition main (repaired: false)
+Dangling edges: 1
+    Edge e1 (myedge) has missing endpoint: n2 (mykind)
+Dangling traversal entries: 3
+    Traversal entry node1:myedge:node2:mykind of node n1 (mykind) points to missing edge e2 (myedge)
+    Traversal entry node2:myedge:node1:mykind of node n2 (mykind) points to missing node
+    Traversal entry node2:myedge:node1:mykind of node n3 (mykind) points to missing edge e2 (myedge)
+Dangling index entries: 2
+    Edge index entry points to missing e2 (myedge)
+    Node index entry points to missing n2 (mykind)
+Missing bookkeeping: 1
+    Attribute Name of kind mykind is not registered
+`[1:] {
+		t.Error("Unexpected result:", ir)
+		return
+	}
+
+	// Run a repair
+
+	ir, err = gm.CheckIntegrity("main", true)
+	if err != nil || ir.IsConsistent() || !ir.Repaired {
+		t.Error("Unexpected result:", ir, err)
+		return
+	}
+
+	ir, err = gm.CheckIntegrity("main", false)
+	if err != nil || !ir.IsConsistent() {
+		t.Error("Unexpected result:", ir, err)
+		return
+	}
+
+	// Check the graph is usable after the repair
+
+	if cnt := gm.EdgeCount("myedge"); cnt != 1 {
+		t.Error("Unexpected edge count:", cnt)
+		return
+	}
+
+	if degrees, err := gm.NodeDegrees("main", "n1", "mykind"); len(degrees) != 1 ||
+		degrees["node1:myedge:node2:mykind"] != 1 || err != nil {
+		t.Error("Unexpected result:", degrees, err)
+		return
+	}
+
+	if _, err := gm.RemoveNode("main", "n1", "mykind"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if cnt := gm.EdgeCount("myedge"); cnt != 0 {
+		t.Error("Unexpected edge count:", cnt)
+		return
+	}
+
+	ir, err = gm.CheckIntegrity("main", false)
+	if err != nil || !ir.IsConsistent() {
+		t.Error("Unexpected result:", ir, err)
+		return
+	}
+
+	if _, err := gm.CheckIntegrity("m-ain", false); err == nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
@@ -0,0 +1,161 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"sort"
+	"sync"
+)
+
+/*
+partitionLocks data structure which holds a reader / writer lock for every
+partition.
+*/
+type partitionLocks struct {
+	locks map[string]*sync.RWMutex // Map of partition locks
+	mutex *sync.Mutex              // Mutex to protect the map of locks
+}
+
+/*
+newPartitionLocks creates a new partitionLocks instance.
+*/
+func newPartitionLocks() *partitionLocks {
+	return &partitionLocks{make(map[string]*sync.RWMutex), &sync.Mutex{}}
+}
+
+/*
+get returns the lock of a given partition. The lock is created if it does
+not exist yet.
+*/
+func (pl *partitionLocks) get(part string) *sync.RWMutex {
+	pl.mutex.Lock()
+	defer pl.mutex.Unlock()
+
+	lock, ok := pl.locks[part]
+	if !ok {
+		lock = &sync.RWMutex{}
+		pl.locks[part] = lock
+	}
+
+	return lock
+}
+
+/*
+modCounters data structure which holds a modification counter for the nodes
+of every partition and kind. The counters are only kept in memory.
+*/
+type modCounters struct {
+	counters map[string]uint64 // Map of partition and kind to counter
+	base     uint64            // Base value of all counters
+	mutex    *sync.Mutex       // Mutex to protect the map of counters
+}
+
+/*
+newModCounters creates a new modCounters instance.
+*/
+func newModCounters() *modCounters {
+	return &modCounters{make(map[string]uint64), 0, &sync.Mutex{}}
+}
+
+/*
+get returns the modification counter of a given partition and kind.
+*/
+func (mc *modCounters) get(part string, kind string) uint64 {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	return mc.base + mc.counters[part+"#"+kind]
+}
+
+/*
+reset resets all counters. The new value of every counter differs from all
+values which were returned before so all running iterations are ended.
+*/
+func (mc *modCounters) reset() {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	max := uint64(0)
+	for _, c := range mc.counters {
+		if c > max {
+			max = c
+		}
+	}
+
+	mc.base += max + 1
+	mc.counters = make(map[string]uint64)
+}
+
+/*
+inc increases the modification counter of a given partition and kind.
+*/
+func (mc *modCounters) inc(part string, kind string) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	mc.counters[part+"#"+kind]++
+}
+
+/*
+readLock takes the reader lock of a given partition. Returns a function which
+releases the lock.
+*/
+func (gm *Manager) readLock(part string) func() {
+	gm.mutex.RLock()
+
+	lock := gm.plocks.get(part)
+	lock.RLock()
+
+	return func() {
+		lock.RUnlock()
+		gm.mutex.RUnlock()
+	}
+}
+
+/*
+writeLock takes the writer locks of the given partitions. Returns a function
+which releases the locks.
+
+Locks are always taken in the same order to avoid deadlocks: first the global
+lock (as reader), then the partition locks sorted by partition name. Operations
+which modify global structures take the global lock as writer and therefore
+exclude all partition operations.
+*/
+func (gm *Manager) writeLock(parts ...string) func() {
+	var locks []*sync.RWMutex
+
+	sortedParts := make([]string, 0, len(parts))
+	seen := make(map[string]bool)
+
+	for _, part := range parts {
+		if !seen[part] {
+			seen[part] = true
+			sortedParts = append(sortedParts, part)
+		}
+	}
+
+	sort.Strings(sortedParts)
+
+	gm.mutex.RLock()
+
+	for _, part := range sortedParts {
+		lock := gm.plocks.get(part)
+		lock.Lock()
+		locks = append(locks, lock)
+	}
+
+	return func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+		}
+		gm.mutex.RUnlock()
+	}
+}
@@ -0,0 +1,215 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+func TestPartitionLocks(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	constructNode := func(key string) data.Node {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "mykind")
+		node.SetAttr("name", "Node "+key)
+		return node
+	}
+
+	gm.StoreNode("tenantA", constructNode("a"))
+	gm.StoreNode("tenantB", constructNode("b"))
+
+	fetch := func(part string, key string) chan data.Node {
+		res := make(chan data.Node, 1)
+		go func() {
+			node, _ := gm.FetchNode(part, key, "mykind")
+			res <- node
+		}()
+		return res
+	}
+
+	// A writer in one partition does not block readers of another partition
+
+	unlock := gm.writeLock("tenantA")
+
+	select {
+	case node := <-fetch("tenantB", "b"):
+		if node.Key() != "b" {
+			t.Error("Unexpected result:", node)
+			return
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Reader of tenantB was blocked by writer of tenantA")
+		return
+	}
+
+	// Readers of the same partition are blocked
+
+	resA := fetch("tenantA", "a")
+
+	select {
+	case node := <-resA:
+		t.Error("Reader of tenantA should have been blocked:", node)
+		return
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+
+	if node := <-resA; node.Key() != "a" {
+		t.Error("Unexpected result:", node)
+		return
+	}
+
+	// Locks of multiple partitions can be taken in any order
+
+	unlock = gm.writeLock("tenantB", "tenantA", "tenantB")
+	unlock()
+
+	// Concurrent writers and readers in different partitions
+
+	var wg sync.WaitGroup
+
+	for _, part := range []string{"tenantA", "tenantB"} {
+		wg.Add(2)
+
+		go func(part string) {
+			defer wg.Done()
+
+			for i := 0; i < 50; i++ {
+				if err := gm.StoreNode(part, constructNode(fmt.Sprint("n", i))); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+
+			trans := NewGraphTrans(gm)
+			for i := 0; i < 50; i++ {
+				trans.RemoveNode(part, fmt.Sprint("n", i), "mykind")
+			}
+			if err := trans.Commit(); err != nil {
+				t.Error(err)
+			}
+		}(part)
+
+		go func(part string) {
+			defer wg.Done()
+
+			for i := 0; i < 50; i++ {
+				if _, err := gm.FetchNode(part, fmt.Sprint("n", i), "mykind"); err != nil {
+					t.Error(err)
+					return
+				}
+				gm.NodeKinds()
+				gm.NodeAttrs("mykind")
+			}
+		}(part)
+	}
+
+	// Transactions can span multiple partitions
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 10; i++ {
+			trans := NewGraphTrans(gm)
+			trans.StoreNode("tenantA", constructNode(fmt.Sprint("t", i)))
+			trans.StoreNode("tenantB", constructNode(fmt.Sprint("t", i)))
+			if err := trans.Commit(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+
+	if res := gm.NodeCount("mykind"); res != 22 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := fmt.Sprint(gm.Partitions(), gm.NodeAttrs("mykind")); res != "[tenantA tenantB] [key kind name]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func BenchmarkPartitionLocks(b *testing.B) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := newGraphManagerNoRules(mgs)
+
+	constructNode := func(key string) data.Node {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "mykind")
+		node.SetAttr("name", "Node "+key)
+		return node
+	}
+
+	for i := 0; i < 1000; i++ {
+		gm.StoreNode("tenantA", constructNode(fmt.Sprint("n", i)))
+		gm.StoreNode("tenantB", constructNode(fmt.Sprint("n", i)))
+	}
+
+	// Readers run in parallel while a writer continuously updates nodes of
+	// tenantA - readers of tenantB should not be slowed down by the writer
+
+	benchmarkReads := func(b *testing.B, part string) {
+		stop := make(chan bool)
+		done := make(chan bool)
+
+		go func() {
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					close(done)
+					return
+				default:
+					gm.StoreNode("tenantA", constructNode(fmt.Sprint("n", i%1000)))
+				}
+			}
+		}()
+
+		b.ResetTimer()
+
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				if node, err := gm.FetchNode(part, fmt.Sprint("n", i%1000), "mykind"); node == nil || err != nil {
+					b.Error("Unexpected result:", node, err)
+					return
+				}
+			}
+		})
+
+		b.StopTimer()
+
+		close(stop)
+		<-done
+	}
+
+	b.Run("SamePartition", func(b *testing.B) {
+		benchmarkReads(b, "tenantA")
+	})
+
+	b.Run("OtherPartition", func(b *testing.B) {
+		benchmarkReads(b, "tenantB")
+	})
+}
@@ -0,0 +1,260 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"devt.de/common/stringutil"
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/util"
+)
+
+/*
+MergePolicy decides the merged value of an attribute when two nodes are
+merged. A missing attribute value is given as nil. If the policy returns nil
+then the attribute is not present in the merged node.
+*/
+type MergePolicy func(attr string, survivorVal interface{}, victimVal interface{}) interface{}
+
+/*
+MergeSurvivorWins is a merge policy which prefers the attribute values of the
+surviving node. Victim values are only used for attributes which the survivor
+does not have.
+*/
+func MergeSurvivorWins(attr string, survivorVal interface{}, victimVal interface{}) interface{} {
+	if survivorVal != nil {
+		return survivorVal
+	}
+	return victimVal
+}
+
+/*
+MergeVictimWins is a merge policy which prefers the attribute values of the
+removed node. Survivor values are only used for attributes which the victim
+does not have.
+*/
+func MergeVictimWins(attr string, survivorVal interface{}, victimVal interface{}) interface{} {
+	if victimVal != nil {
+		return victimVal
+	}
+	return survivorVal
+}
+
+/*
+MergeNodes merges a victim node into a survivor node of the same kind. The
+attributes of both nodes are combined according to the given merge policy
+(MergeSurvivorWins is used if no policy is given), every edge of the victim
+is re-pointed to the survivor and finally the victim is removed. Edges which
+would become identical to an existing edge of the survivor are removed as
+well as edges between the two nodes since they would become self references.
+The whole operation holds the writer lock of the partition and is either
+written completely or rolled back - concurrent readers never see a partially
+merged state.
+*/
+func (gm *Manager) MergeNodes(part string, survivorKey string, victimKey string,
+	kind string, attrPolicy MergePolicy) error {
+
+	if !stringutil.IsAlphaNumeric(part) {
+		return &util.GraphError{
+			Type:   util.ErrInvalidData,
+			Detail: fmt.Sprintf("Partition name %v is not alphanumeric - can only contain [a-zA-Z0-9_]", part),
+		}
+	} else if !stringutil.IsAlphaNumeric(kind) {
+		return &util.GraphError{
+			Type:   util.ErrInvalidData,
+			Detail: fmt.Sprintf("Kind %v is not alphanumeric - can only contain [a-zA-Z0-9_]", kind),
+		}
+	} else if survivorKey == victimKey {
+		return &util.GraphError{
+			Type:   util.ErrInvalidData,
+			Detail: fmt.Sprintf("Cannot merge node %v with itself", survivorKey),
+		}
+	}
+
+	if attrPolicy == nil {
+		attrPolicy = MergeSurvivorWins
+	}
+
+	// Take writer lock for the whole operation
+
+	defer gm.writeLock(part)()
+
+	// Use a graph manager with separate locks to read the current state -
+	// the partition is already locked
+
+	rgm := gm.gr.cloneGraphManager()
+
+	fetchNode := func(key string) (data.Node, error) {
+		node, err := rgm.FetchNode(part, key, kind)
+		if err == nil && node == nil {
+			err = &util.GraphError{
+				Type:   util.ErrInvalidData,
+				Detail: fmt.Sprintf("Node %v of kind %v does not exist in partition %v", key, kind, part),
+				Cause:  util.ErrNotFound,
+			}
+		}
+		return node, err
+	}
+
+	survivor, err := fetchNode(survivorKey)
+	if err != nil {
+		return err
+	}
+
+	victim, err := fetchNode(victimKey)
+	if err != nil {
+		return err
+	}
+
+	// Collect the edges of both nodes
+
+	nodeEdges := func(key string) ([]data.Edge, error) {
+		var ret []data.Edge
+
+		_, tedges, err := rgm.TraverseMulti(part, key, kind, ":::", false)
+		seen := make(map[string]bool)
+
+		for _, tedge := range tedges {
+			if err != nil || seen[tedge.Kind()+"#"+tedge.Key()] {
+				continue
+			}
+			seen[tedge.Kind()+"#"+tedge.Key()] = true
+
+			var edge data.Node
+			if edge, err = rgm.FetchEdge(part, tedge.Key(), tedge.Kind()); err == nil {
+				ret = append(ret, data.NewGraphEdgeFromNode(edge))
+			}
+		}
+
+		return ret, err
+	}
+
+	survivorEdges, err := nodeEdges(survivorKey)
+	if err != nil {
+		return err
+	}
+
+	victimEdges, err := nodeEdges(victimKey)
+	if err != nil {
+		return err
+	}
+
+	// Build the merged survivor
+
+	merged := data.NewGraphNode()
+	merged.SetAttr(data.NodeKey, survivorKey)
+	merged.SetAttr(data.NodeKind, kind)
+
+	mergeAttr := func(attr string) {
+		if attr == data.NodeKey || attr == data.NodeKind || merged.Attr(attr) != nil {
+			return
+		}
+		if val := attrPolicy(attr, survivor.Attr(attr), victim.Attr(attr)); val != nil {
+			merged.SetAttr(attr, val)
+		}
+	}
+
+	for attr := range survivor.Data() {
+		mergeAttr(attr)
+	}
+	for attr := range victim.Data() {
+		mergeAttr(attr)
+	}
+
+	// Re-point the victim edges - edges are identified by their kind and
+	// the set of their ends
+
+	edgeID := func(edge data.Edge) string {
+		ends := []string{
+			fmt.Sprint(edge.End1Key(), "#", edge.End1Kind(), "#", edge.End1Role()),
+			fmt.Sprint(edge.End2Key(), "#", edge.End2Kind(), "#", edge.End2Role()),
+		}
+		sort.Strings(ends)
+		return edge.Kind() + "#" + strings.Join(ends, "#")
+	}
+
+	edgeIDs := make(map[string]bool)
+	for _, edge := range survivorEdges {
+		edgeIDs[edgeID(edge)] = true
+	}
+
+	var repointed []data.Edge
+
+	for _, edge := range victimEdges {
+		isVictim1 := edge.End1Key() == victimKey && edge.End1Kind() == kind
+		isVictim2 := edge.End2Key() == victimKey && edge.End2Kind() == kind
+
+		if (isVictim1 && edge.End2Key() == survivorKey && edge.End2Kind() == kind) ||
+			(isVictim2 && edge.End1Key() == survivorKey && edge.End1Kind() == kind) {
+			continue
+		}
+
+		redge := data.NewGraphEdgeFromNode(data.NodeClone(edge))
+		if isVictim1 {
+			redge.SetAttr(data.EdgeEnd1Key, survivorKey)
+		}
+		if isVictim2 {
+			redge.SetAttr(data.EdgeEnd2Key, survivorKey)
+		}
+
+		if id := edgeID(redge); !edgeIDs[id] {
+			edgeIDs[id] = true
+			repointed = append(repointed, redge)
+		}
+	}
+
+	// Edges cannot change their ends - all victim edges are removed together
+	// with updating the survivor before the re-pointed edges are stored and
+	// the victim is removed. Changes are only flushed once everything has
+	// been written.
+
+	nodePartsAndKinds := make(map[string]string)
+	edgePartsAndKinds := make(map[string]string)
+
+	trans := NewGraphTrans(rgm)
+	trans.subtrans = true
+
+	if err := trans.StoreNode(part, merged); err != nil {
+		return err
+	}
+	for _, edge := range victimEdges {
+		if err := trans.RemoveEdge(part, edge.Key(), edge.Kind()); err != nil {
+			return err
+		}
+	}
+
+	if err := trans.write(nodePartsAndKinds, edgePartsAndKinds); err != nil {
+		return err
+	}
+
+	for _, edge := range repointed {
+		if err := trans.StoreEdge(part, edge); err != nil {
+			trans.rollback(nodePartsAndKinds, edgePartsAndKinds)
+			return err
+		}
+	}
+
+	if err := trans.RemoveNode(part, victimKey, kind); err != nil {
+		trans.rollback(nodePartsAndKinds, edgePartsAndKinds)
+		return err
+	}
+
+	if err := trans.write(nodePartsAndKinds, edgePartsAndKinds); err != nil {
+		return err
+	}
+
+	trans.flush(nodePartsAndKinds, edgePartsAndKinds)
+
+	return nil
+}
@@ -0,0 +1,244 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+func TestMergeNodes(t *testing.T) {
+	if !RunDiskStorageTests {
+		return
+	}
+
+	dgs, err := graphstorage.NewDiskGraphStorage(GraphManagerTestDBDir5, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer dgs.Close()
+
+	gm := NewGraphManager(dgs)
+
+	storeNode := func(key string, kind string, attrs map[string]interface{}) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", kind)
+
+		for k, v := range attrs {
+			node.SetAttr(k, v)
+		}
+
+		if err := gm.StoreNode("main", node); err != nil {
+			t.Error(err)
+		}
+	}
+
+	storeEdge := func(key string, kind string, end1 string, end1kind string, role1 string,
+		end2 string, end2kind string, role2 string) {
+
+		edge := data.NewGraphEdge()
+
+		edge.SetAttr("key", key)
+		edge.SetAttr("kind", kind)
+		edge.SetAttr("name", "Edge "+key)
+
+		edge.SetAttr(data.EdgeEnd1Key, end1)
+		edge.SetAttr(data.EdgeEnd1Kind, end1kind)
+		edge.SetAttr(data.EdgeEnd1Role, role1)
+		edge.SetAttr(data.EdgeEnd1Cascading, false)
+
+		edge.SetAttr(data.EdgeEnd2Key, end2)
+		edge.SetAttr(data.EdgeEnd2Kind, end2kind)
+		edge.SetAttr(data.EdgeEnd2Role, role2)
+		edge.SetAttr(data.EdgeEnd2Cascading, false)
+
+		if err := gm.StoreEdge("main", edge); err != nil {
+			t.Error(err)
+		}
+	}
+
+	edges := func(key string) string {
+		var ret []string
+
+		_, tedges, err := gm.TraverseMulti("main", key, "Person", ":::", true)
+		if err != nil {
+			t.Error(err)
+		}
+
+		for _, e := range tedges {
+			ret = append(ret, fmt.Sprint(e.Key(), ":", e.End1Key(), "->", e.End2Key()))
+		}
+
+		sort.Strings(ret)
+
+		return fmt.Sprint(ret)
+	}
+
+	storeNode("a", "Person", map[string]interface{}{"name": "Alice", "age": 30})
+	storeNode("b", "Person", map[string]interface{}{"name": "Bob", "city": "Berlin"})
+	storeNode("c", "Person", map[string]interface{}{"name": "Carol"})
+	storeNode("s1", "Song", map[string]interface{}{"name": "Song1"})
+	storeNode("s2", "Song", map[string]interface{}{"name": "Song2"})
+
+	storeEdge("e1", "Wrote", "a", "Person", "author", "s1", "Song", "song")
+	storeEdge("e2", "Wrote", "b", "Person", "author", "s1", "Song", "song")
+	storeEdge("e3", "Wrote", "b", "Person", "author", "s2", "Song", "song")
+	storeEdge("e4", "Knows", "a", "Person", "friend", "b", "Person", "friend")
+	storeEdge("e5", "Knows", "c", "Person", "friend", "b", "Person", "friend")
+
+	// Test error cases
+
+	if err := gm.MergeNodes("ma-in", "a", "b", "Person", nil); err == nil ||
+		err.Error() != "GraphError: Invalid data (Partition name ma-in is not alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.MergeNodes("main", "a", "b", "Per-son", nil); err == nil ||
+		err.Error() != "GraphError: Invalid data (Kind Per-son is not alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.MergeNodes("main", "a", "a", "Person", nil); err == nil ||
+		err.Error() != "GraphError: Invalid data (Cannot merge node a with itself)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.MergeNodes("main", "a", "s1", "Person", nil); err == nil ||
+		err.Error() != "GraphError: Invalid data (Node s1 of kind Person does not exist in partition main)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// A failing merge leaves both nodes untouched
+
+	if err := gm.SetEdgeCardinality("Wrote", "author", 0, 1, false); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := gm.MergeNodes("main", "a", "b", "Person", nil); err == nil ||
+		err.Error() != "GraphError: Edge cardinality constraint violated (Cannot store edge e3 - node a (Person) can have at most 1 Wrote edges as author)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res := edges("a"); res != "[e1:a->s1 e4:a->b]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := edges("b"); res != "[e2:b->s1 e3:b->s2 e4:b->a e5:b->c]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if n, _ := gm.FetchNode("main", "a", "Person"); n.Attr("city") != nil {
+		t.Error("Unexpected result:", n)
+		return
+	}
+
+	if err := gm.RemoveEdgeCardinality("Wrote", "author"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Merge the nodes
+
+	if err := gm.MergeNodes("main", "a", "b", "Person", nil); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if n, err := gm.FetchNode("main", "b", "Person"); n != nil || err != nil {
+		t.Error("Unexpected result:", n, err)
+		return
+	}
+
+	n, _ := gm.FetchNode("main", "a", "Person")
+	if res := fmt.Sprint([]interface{}{n.Attr("name"), n.Attr("age"), n.Attr("city")}); res != "[Alice 30 Berlin]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Duplicate edges and edges between the nodes are removed
+
+	if res := edges("a"); res != "[e1:a->s1 e3:a->s2 e5:a->c]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if e, err := gm.FetchEdge("main", "e2", "Wrote"); e != nil || err != nil {
+		t.Error("Unexpected result:", e, err)
+		return
+	}
+
+	// Re-pointed edges keep their orientation
+
+	if e, _ := gm.FetchEdge("main", "e5", "Knows"); e.Attr(data.EdgeEnd1Key) != "c" ||
+		e.Attr(data.EdgeEnd2Key) != "a" || e.Attr("name") != "Edge e5" {
+		t.Error("Unexpected result:", e)
+		return
+	}
+
+	// Indexes are updated
+
+	iq, _ := gm.NodeIndexQuery("main", "Person")
+
+	if res, _ := iq.LookupValue("city", "Berlin"); fmt.Sprint(res) != "[a]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res, _ := iq.LookupValue("name", "Bob"); len(res) != 0 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	eiq, _ := gm.EdgeIndexQuery("main", "Knows")
+
+	if res, _ := eiq.LookupWord("name", "e4"); len(res) != 0 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Test a custom merge policy
+
+	storeNode("d", "Person", map[string]interface{}{"name": "Dave", "age": 40})
+
+	err = gm.MergeNodes("main", "a", "d", "Person",
+		func(attr string, survivorVal interface{}, victimVal interface{}) interface{} {
+			if attr == "name" {
+				return fmt.Sprint(survivorVal, "/", victimVal)
+			} else if attr == "city" {
+				return nil
+			}
+			return MergeVictimWins(attr, survivorVal, victimVal)
+		})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	n, _ = gm.FetchNode("main", "a", "Person")
+	if res := fmt.Sprint([]interface{}{n.Attr("name"), n.Attr("age"), n.Attr("city")}); res != "[Alice/Dave 40 <nil>]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
@@ -0,0 +1,125 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"devt.de/common/stringutil"
+	"devt.de/eliasdb/graph/util"
+)
+
+/*
+KindMeta holds human readable metadata of a node or edge kind.
+*/
+type KindMeta struct {
+	Label       string            // Display label of the kind
+	Description string            // Description of the kind
+	AttrLabels  map[string]string // Display labels of attributes
+}
+
+/*
+kindMetaAttrPrefix is the prefix for attribute labels in a stored metadata map.
+*/
+const kindMetaAttrPrefix = "attr:"
+
+/*
+SetKindMeta sets the metadata of a given kind. A nil value removes the
+metadata. Metadata can be stored for kinds which do not have any data yet.
+The metadata is persisted in the main database.
+*/
+func (gm *Manager) SetKindMeta(kind string, meta *KindMeta) error {
+
+	if !stringutil.IsAlphaNumeric(kind) {
+		return &util.GraphError{
+			Type:   util.ErrInvalidData,
+			Detail: fmt.Sprintf("Kind %v is not alphanumeric - can only contain [a-zA-Z0-9_]", kind),
+		}
+	}
+
+	// Take global writer lock
+
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	gm.updateMainDBMap(MainDBKindMeta+kind, func(map[string]string) map[string]string {
+		if meta == nil {
+			return map[string]string{}
+		}
+
+		ret := map[string]string{
+			"label":       meta.Label,
+			"description": meta.Description,
+		}
+
+		for attr, label := range meta.AttrLabels {
+			ret[kindMetaAttrPrefix+attr] = label
+		}
+
+		return ret
+	})
+
+	gm.updateMainDBMap(MainDBKindMetaKinds, func(kinds map[string]string) map[string]string {
+		if kinds == nil {
+			kinds = make(map[string]string)
+		}
+
+		if meta == nil {
+			delete(kinds, kind)
+		} else {
+			kinds[kind] = ""
+		}
+
+		return kinds
+	})
+
+	return gm.flushMain()
+}
+
+/*
+KindMeta returns the metadata of a given kind. Returns nil if no metadata was
+stored for the kind.
+*/
+func (gm *Manager) KindMeta(kind string) *KindMeta {
+	stored := gm.getMainDBMap(MainDBKindMeta + kind)
+
+	if len(stored) == 0 {
+		return nil
+	}
+
+	meta := &KindMeta{stored["label"], stored["description"], make(map[string]string)}
+
+	for k, v := range stored {
+		if strings.HasPrefix(k, kindMetaAttrPrefix) {
+			meta.AttrLabels[k[len(kindMetaAttrPrefix):]] = v
+		}
+	}
+
+	return meta
+}
+
+/*
+KindMetaKinds returns all kinds which have metadata.
+*/
+func (gm *Manager) KindMetaKinds() []string {
+	kinds := gm.getMainDBMap(MainDBKindMetaKinds)
+
+	ret := make([]string, 0, len(kinds))
+	for kind := range kinds {
+		ret = append(ret, kind)
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
@@ -0,0 +1,83 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"testing"
+
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+func TestKindMeta(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	if err := gm.SetKindMeta("us-r", &KindMeta{}); err == nil ||
+		err.Error() != "GraphError: Invalid data (Kind us-r is not alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res := gm.KindMeta("usr"); res != nil {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Metadata can be stored for kinds without data
+
+	if err := gm.SetKindMeta("usr", &KindMeta{"User account", "Account of a user",
+		map[string]string{"lastlogin": "Last login", "attr:x": "X"}}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := gm.SetKindMeta("grp", &KindMeta{Label: "Group"}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := fmt.Sprint(gm.KindMeta("usr")); res != "&{User account Account of a user map[attr:x:X lastlogin:Last login]}" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := fmt.Sprint(gm.KindMeta("grp")); res != "&{Group  map[]}" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := fmt.Sprint(gm.KindMetaKinds(), gm.NodeKinds()); res != "[grp usr] []" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Metadata is persisted
+
+	gm2 := NewGraphManager(mgs)
+
+	if res := fmt.Sprint(gm2.KindMeta("usr").Label, gm2.KindMetaKinds()); res != "User account[grp usr]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Remove metadata
+
+	if err := gm.SetKindMeta("grp", nil); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := fmt.Sprint(gm.KindMeta("grp"), gm.KindMetaKinds()); res != "<nil> [usr]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
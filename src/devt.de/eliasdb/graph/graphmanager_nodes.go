@@ -11,7 +11,9 @@
 package graph
 
 import (
-	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"strings"
 
 	"devt.de/eliasdb/graph/data"
 	"devt.de/eliasdb/graph/util"
@@ -22,18 +24,73 @@ import (
 NodeCount returns the node count for a given node kind.
 */
 func (gm *Manager) NodeCount(kind string) uint64 {
+	return gm.readCount(MainDBNodeCount + kind)
+}
+
+/*
+PartitionNodeCount returns the node count for a given node kind in a partition.
+The count is read from a maintained counter - the flag is false if no counter
+exists because the kind was stored in the partition before counters per
+partition were maintained.
+*/
+func (gm *Manager) PartitionNodeCount(part string, kind string) (uint64, bool) {
+	count, ok := gm.readPartitionCount(partitionCountEntry(MainDBPartNodeCount, part, kind))
+
+	if !ok && gm.gs.StorageManager(part+kind+StorageSuffixNodes, false) == nil {
+
+		// The kind was never stored in the partition
+
+		return 0, true
+	}
+
+	return count, ok
+}
+
+/*
+NodeVersion returns the version of a node. A node gets a new and higher version
+every time it is stored or updated. Returns 0 if the node does not exist.
+*/
+func (gm *Manager) NodeVersion(part string, key string, kind string) (uint64, error) {
+
+	if err := gm.checkPartitionName(part); err != nil {
+		return 0, err
+	}
+
+	// Take reader lock
+
+	defer gm.readLock(part)()
+
+	return gm.readNodeVersion(part, key, kind)
+}
+
+/*
+readNodeVersion reads the version of a node. It is assumed that the caller
+holds a lock.
+*/
+func (gm *Manager) readNodeVersion(part string, key string, kind string) (uint64, error) {
+
+	sm := gm.gs.StorageManager(part+kind+StorageSuffixNodes, false)
+	if sm == nil {
+		return 0, nil
+	}
 
-	if val, ok := gm.gs.MainDB()[MainDBNodeCount+kind]; ok {
-		return binary.LittleEndian.Uint64([]byte(val))
+	valTree, err := gm.getHTree(sm, RootIDNodeHTreeSecond)
+	if err != nil {
+		return 0, err
 	}
 
-	return 0
+	return gm.readVersion(key, valTree)
 }
 
 /*
-NodeKeyIterator iterates node keys of a certain kind.
+NodeKeyIterator iterates node keys of a certain kind. The iterator reports an
+error if nodes of the kind are inserted or removed during the iteration.
 */
 func (gm *Manager) NodeKeyIterator(part string, kind string) (*NodeKeyIterator, error) {
+	// Take reader lock
+
+	defer gm.readLock(part)()
+
 	// Get the HTrees which stores the node
 
 	tree, _, err := gm.getNodeStorageHTree(part, kind, false)
@@ -46,10 +103,206 @@ func (gm *Manager) NodeKeyIterator(part string, kind string) (*NodeKeyIterator,
 		return nil, &util.GraphError{
 			Type:   util.ErrReading,
 			Detail: it.LastError.Error(),
+			Cause:  it.LastError,
+		}
+	}
+
+	return &NodeKeyIterator{gm, part, kind, gm.mc.get(part, kind), it, false, nil}, nil
+}
+
+/*
+SortedNodeKeyIterator iterates node keys of a certain kind in lexicographic
+order. The sorted iteration is considerably more expensive than the iteration
+in hash order of NodeKeyIterator - see SortedNodeKeyIterator for details.
+*/
+func (gm *Manager) SortedNodeKeyIterator(part string, kind string) (*SortedNodeKeyIterator, error) {
+
+	// Take reader lock
+
+	defer gm.readLock(part)()
+
+	// Get the HTree which stores the node
+
+	tree, _, err := gm.getNodeStorageHTree(part, kind, false)
+	if err != nil || tree == nil {
+		return nil, err
+	}
+
+	return &SortedNodeKeyIterator{gm, part, tree, nil, "", "", false, false, nil}, nil
+}
+
+/*
+SampleNodeKeys returns up to n uniformly random node keys of a certain kind.
+A sample never contains duplicates - all keys are returned if the kind has
+no more than n nodes. The sample is drawn with reservoir sampling over a
+NodeKeyIterator so all keys of the kind are visited once. Returns nil if
+the kind does not exist in the partition.
+*/
+func (gm *Manager) SampleNodeKeys(part string, kind string, n int) ([]string, error) {
+
+	if n < 1 {
+		return nil, &util.GraphError{
+			Type:   util.ErrInvalidData,
+			Detail: fmt.Sprintf("Invalid sample size: %v", n),
+		}
+	}
+
+	it, err := gm.NodeKeyIterator(part, kind)
+	if err != nil || it == nil {
+		return nil, err
+	}
+
+	sample := make([]string, 0, n)
+
+	for i := 0; it.HasNext(); i++ {
+		key := it.Next()
+
+		if it.LastError != nil {
+			return nil, it.LastError
+		}
+
+		// Fill the reservoir first - afterwards the i-th key replaces a
+		// random entry with probability n / (i + 1)
+
+		if i < n {
+			sample = append(sample, key)
+		} else if j := rand.Intn(i + 1); j < n {
+			sample[j] = key
 		}
 	}
 
-	return &NodeKeyIterator{gm, it, nil}, nil
+	return sample, nil
+}
+
+/*
+OrphanNodeIterator iterates the nodes of the given kinds which have no edges.
+All node kinds are iterated if no kinds are given. See NodeDegreeIterator
+for the consistency guarantees.
+*/
+func (gm *Manager) OrphanNodeIterator(part string, kinds []string) (*NodeDegreeIterator, error) {
+	return gm.LowDegreeNodeIterator(part, kinds, ":::", 1)
+}
+
+/*
+LowDegreeNodeIterator iterates the nodes of the given kinds which have fewer
+edges matching a given partial edge spec than a given limit. All node kinds
+are iterated if no kinds are given. See NodeDegreeIterator for the
+consistency guarantees.
+*/
+func (gm *Manager) LowDegreeNodeIterator(part string, kinds []string, spec string,
+	limit int) (*NodeDegreeIterator, error) {
+
+	if err := gm.checkPartitionName(part); err != nil {
+		return nil, err
+	}
+
+	sspec := strings.Split(spec, ":")
+	if len(sspec) != 4 {
+		return nil, &util.GraphError{Type: util.ErrInvalidData, Detail: "Invalid spec: " + spec}
+	}
+
+	if len(kinds) == 0 {
+		kinds = gm.NodeKinds()
+	}
+
+	return &NodeDegreeIterator{gm, part, append([]string(nil), kinds...), sspec, limit,
+		"", nil, nil, nil, "", "", nil}, nil
+}
+
+/*
+OrphanRemovalBatchSize is the number of nodes which are removed with a single
+transaction by RemoveOrphans.
+*/
+var OrphanRemovalBatchSize = 1000
+
+/*
+RemoveOrphans removes all nodes of the given kinds which have no edges. All
+node kinds are considered if no kinds are given. The keys of all orphaned
+nodes are collected first, the nodes are then removed in batches. Every node
+is checked again before it is removed - a node which gained an edge in the
+meantime is kept. Returns the number of removed nodes.
+*/
+func (gm *Manager) RemoveOrphans(part string, kinds []string) (int, error) {
+
+	it, err := gm.OrphanNodeIterator(part, kinds)
+	if err != nil {
+		return 0, err
+	}
+
+	// Removing nodes while iterating would modify the iterated trees
+
+	var orphans [][2]string
+
+	for it.HasNext() {
+		if key, kind := it.Next(); key != "" {
+			orphans = append(orphans, [2]string{key, kind})
+		}
+	}
+
+	if it.LastError != nil {
+		return 0, it.LastError
+	}
+
+	count := 0
+
+	for len(orphans) > 0 {
+		batch := orphans
+		if len(batch) > OrphanRemovalBatchSize {
+			batch = batch[:OrphanRemovalBatchSize]
+		}
+		orphans = orphans[len(batch):]
+
+		removed, err := gm.removeOrphanBatch(part, batch, it)
+		count += removed
+
+		if err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+/*
+removeOrphanBatch removes a batch of nodes which still have no edges.
+*/
+func (gm *Manager) removeOrphanBatch(part string, batch [][2]string, it *NodeDegreeIterator) (int, error) {
+
+	// Take writer lock
+
+	defer gm.writeLock(part)()
+
+	// The partition is already locked - the transaction is committed
+	// without locking
+
+	trans := NewGraphTrans(gm.gr.cloneGraphManager())
+	trans.subtrans = true
+
+	for _, item := range batch {
+
+		attTree, tree, err := gm.getNodeStorageHTree(part, item[1], false)
+		if err != nil {
+			return 0, err
+		} else if attTree == nil || tree == nil {
+			continue
+		}
+
+		if ok, err := it.matches(item[0], attTree, tree); err != nil {
+			return 0, err
+		} else if ok {
+			if err := trans.RemoveNode(part, item[0], item[1]); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	count := len(trans.removeNodes)
+
+	if err := trans.Commit(); err != nil {
+		return 0, err
+	}
+
+	return count, nil
 }
 
 /*
@@ -65,6 +318,10 @@ FetchNodePart fetches part of a single node from a partition of the graph.
 func (gm *Manager) FetchNodePart(part string, key string, kind string,
 	attrs []string) (data.Node, error) {
 
+	// Take reader lock
+
+	defer gm.readLock(part)()
+
 	// Get the HTrees which stores the node
 
 	attht, valht, err := gm.getNodeStorageHTree(part, kind, false)
@@ -72,11 +329,6 @@ func (gm *Manager) FetchNodePart(part string, key string, kind string,
 		return nil, err
 	}
 
-	// Take reader lock
-
-	gm.mutex.RLock()
-	defer gm.mutex.RUnlock()
-
 	// Read the node from the datastore
 
 	return gm.readNode(key, kind, attrs, attht, valht)
@@ -95,7 +347,7 @@ func (gm *Manager) readNode(key string, kind string, attrs []string,
 
 	attrList, err := attrTree.Get([]byte(keyAttrs))
 	if err != nil {
-		return nil, &util.GraphError{Type: util.ErrReading, Detail: err.Error()}
+		return nil, &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
 	} else if attrList == nil {
 		return nil, nil
 	}
@@ -108,7 +360,9 @@ func (gm *Manager) readNode(key string, kind string, attrs []string,
 
 		val, err := valTree.Get([]byte(keyAttrPrefix + encattr))
 		if err != nil {
-			return &util.GraphError{Type: util.ErrReading, Detail: err.Error()}
+			return &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
+		} else if val, err = gm.decompressAttrValue(kind, val, false); err != nil {
+			return err
 		}
 
 		if val != nil {
@@ -130,7 +384,7 @@ func (gm *Manager) readNode(key string, kind string, attrs []string,
 		// Lookup all attributes
 
 		for _, encattr := range attrList.([]string) {
-			attr := gm.nm.Decode32(encattr)
+			attr := gm.decode32(encattr)
 			if err := tryPopulateNode(encattr, attr); err != nil {
 				return nil, err
 			}
@@ -153,7 +407,7 @@ func (gm *Manager) readNode(key string, kind string, attrs []string,
 
 			// Only try to populate the attribute if it can be decoded
 
-			if encattr := gm.nm.Encode32(attr, false); encattr != "" {
+			if encattr := gm.encode32(attr, false); encattr != "" {
 				if err := tryPopulateNode(encattr, attr); err != nil {
 					return nil, err
 				}
@@ -198,9 +452,13 @@ func (gm *Manager) storeOrUpdateNode(part string, node data.Node, onlyUpdate boo
 		return err
 	}
 
+	// Take writer lock
+
+	defer gm.writeLock(part)()
+
 	// Get the HTrees which stores the node index and node
 
-	iht, err := gm.getNodeIndexHTree(part, node.Kind(), true)
+	im, err := gm.getNodeIndexManager(part, node.Kind(), true)
 	if err != nil {
 		return err
 	}
@@ -210,29 +468,33 @@ func (gm *Manager) storeOrUpdateNode(part string, node data.Node, onlyUpdate boo
 		return err
 	}
 
-	// Take writer lock
-
-	gm.mutex.Lock()
-	defer gm.mutex.Unlock()
-
 	// Write the node to the datastore
 
-	oldnode, err := gm.writeNode(node, onlyUpdate, attht, valht, nodeAttributeFilter)
+	oldnode, err := gm.writeNodeWithHistory(node, onlyUpdate, attht, valht)
 	if err != nil {
 		return err
 	}
 
+	// Index updates are deferred during a bulk load
+
+	if deferred, err := gm.deferNodeIndex(im, part, node.Kind(), node.Key(), oldnode); err != nil {
+		return err
+	} else if deferred {
+		im = nil
+	}
+
 	// Increase node count if the node was inserted and write the changes
 	// to the index.
 
 	if oldnode == nil {
-		currentCount := gm.NodeCount(node.Kind())
-		if err := gm.writeNodeCount(node.Kind(), currentCount+1, true); err != nil {
+		gm.mc.inc(part, node.Kind())
+
+		if err := gm.addNodeCount(part, node.Kind(), 1, true); err != nil {
 			return err
 		}
 
-		if iht != nil {
-			err := util.NewIndexManager(iht).Index(node.Key(), node.IndexMap())
+		if im != nil {
+			err := im.Index(node.Key(), node.IndexMap())
 			if err != nil {
 
 				// The node was written at this point and the model is
@@ -242,9 +504,9 @@ func (gm *Manager) storeOrUpdateNode(part string, node data.Node, onlyUpdate boo
 			}
 		}
 
-	} else if iht != nil {
+	} else if im != nil {
 
-		err := util.NewIndexManager(iht).Reindex(node.Key(), node.IndexMap(),
+		err := im.Reindex(node.Key(), node.IndexMap(),
 			oldnode.IndexMap())
 
 		if err != nil {
@@ -276,7 +538,7 @@ func (gm *Manager) storeOrUpdateNode(part string, node data.Node, onlyUpdate boo
 
 	// Flush changes - errors only reported on the actual node storage flush
 
-	gm.gs.FlushMain()
+	gm.flushMain()
 
 	gm.flushNodeIndex(part, node.Kind())
 
@@ -313,7 +575,7 @@ func (gm *Manager) writeNode(node data.Node, onlyUpdate bool, attrTree *hash.HTr
 			continue
 		}
 
-		encattr := gm.nm.Encode32(attr, true)
+		encattr := gm.encode32(attr, true)
 
 		// Build up a lookup map to identify which attribute exist
 
@@ -323,11 +585,18 @@ func (gm *Manager) writeNode(node data.Node, onlyUpdate bool, attrTree *hash.HTr
 
 		attrList = append(attrList, encattr)
 
-		// Store the value in the datastore
+		// Store the value in the datastore - large values might be compressed
 
-		oldval, err := valTree.Put([]byte(keyAttrPrefix+encattr), val)
+		sval, err := gm.compressAttrValue(node.Kind(), val)
 		if err != nil {
-			return nil, &util.GraphError{Type: util.ErrWriting, Detail: err.Error()}
+			return nil, err
+		}
+
+		oldval, err := valTree.Put([]byte(keyAttrPrefix+encattr), sval)
+		if err != nil {
+			return nil, &util.GraphError{Type: util.ErrWriting, Detail: err.Error(), Cause: err}
+		} else if oldval, err = gm.decompressAttrValue(node.Kind(), oldval, true); err != nil {
+			return nil, err
 		}
 
 		// Build up old node
@@ -347,7 +616,7 @@ func (gm *Manager) writeNode(node data.Node, onlyUpdate bool, attrTree *hash.HTr
 
 		attrListOld, err = attrTree.Get([]byte(keyAttrs))
 		if err != nil {
-			return nil, &util.GraphError{Type: util.ErrReading, Detail: err.Error()}
+			return nil, &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
 		}
 
 		if attrListOld != nil {
@@ -391,7 +660,11 @@ func (gm *Manager) writeNode(node data.Node, onlyUpdate bool, attrTree *hash.HTr
 		// Do not try cleanup in case we updated a node - we would do more
 		// harm than good.
 
-		return nil, &util.GraphError{Type: util.ErrWriting, Detail: err.Error()}
+		return nil, &util.GraphError{Type: util.ErrWriting, Detail: err.Error(), Cause: err}
+	}
+
+	if err := gm.writeVersion(node.Key(), valTree); err != nil {
+		return nil, err
 	}
 
 	// Remove deleted keys
@@ -413,10 +686,12 @@ func (gm *Manager) writeNode(node data.Node, onlyUpdate bool, attrTree *hash.HTr
 
 				oldval, err := valTree.Remove([]byte(keyAttrPrefix + encattrold))
 				if err != nil {
-					return nil, &util.GraphError{Type: util.ErrWriting, Detail: err.Error()}
+					return nil, &util.GraphError{Type: util.ErrWriting, Detail: err.Error(), Cause: err}
+				} else if oldval, err = gm.decompressAttrValue(node.Kind(), oldval, true); err != nil {
+					return nil, err
 				}
 
-				oldnode.SetAttr(gm.nm.Decode32(encattrold), oldval)
+				oldnode.SetAttr(gm.decode32(encattrold), oldval)
 			}
 		}
 
@@ -431,9 +706,13 @@ RemoveNode removes a single node from a partition of the graph.
 */
 func (gm *Manager) RemoveNode(part string, key string, kind string) (data.Node, error) {
 
+	// Take writer lock
+
+	defer gm.writeLock(part)()
+
 	// Get the HTree which stores the node index and node kind
 
-	iht, err := gm.getNodeIndexHTree(part, kind, false)
+	im, err := gm.getNodeIndexManager(part, kind, false)
 	if err != nil {
 		return nil, err
 	}
@@ -443,14 +722,9 @@ func (gm *Manager) RemoveNode(part string, key string, kind string) (data.Node,
 		return nil, err
 	}
 
-	// Take writer lock
-
-	gm.mutex.Lock()
-	defer gm.mutex.Unlock()
-
 	// Delete the node from the datastore
 
-	node, err := gm.deleteNode(key, kind, attTree, valTree)
+	node, err := gm.deleteNodeWithHistory(key, kind, attTree, valTree)
 	if err != nil {
 		return node, err
 	}
@@ -459,8 +733,16 @@ func (gm *Manager) RemoveNode(part string, key string, kind string) (data.Node,
 
 	if node != nil {
 
-		if iht != nil {
-			err := util.NewIndexManager(iht).Deindex(key, node.IndexMap())
+		gm.mc.inc(part, kind)
+
+		if deferred, err := gm.deferNodeIndex(im, part, kind, key, node); err != nil {
+			return node, err
+		} else if deferred {
+			im = nil
+		}
+
+		if im != nil {
+			err := im.Deindex(key, node.IndexMap())
 			if err != nil {
 				return node, err
 			}
@@ -468,8 +750,7 @@ func (gm *Manager) RemoveNode(part string, key string, kind string) (data.Node,
 
 		// Decrease the node count
 
-		currentCount := gm.NodeCount(kind)
-		if err := gm.writeNodeCount(kind, currentCount-1, true); err != nil {
+		if err := gm.addNodeCount(part, kind, -1, true); err != nil {
 			return node, err
 		}
 
@@ -486,7 +767,7 @@ func (gm *Manager) RemoveNode(part string, key string, kind string) (data.Node,
 
 		// Flush changes - errors only reported on the actual node storage flush
 
-		gm.gs.FlushMain()
+		gm.flushMain()
 
 		gm.flushNodeIndex(part, kind)
 
@@ -511,11 +792,15 @@ func (gm *Manager) deleteNode(key string, kind string, attrTree *hash.HTree,
 
 	attrList, err := attrTree.Remove([]byte(keyAttrs))
 	if err != nil {
-		return nil, &util.GraphError{Type: util.ErrWriting, Detail: err.Error()}
+		return nil, &util.GraphError{Type: util.ErrWriting, Detail: err.Error(), Cause: err}
 	} else if attrList == nil {
 		return nil, nil
 	}
 
+	if _, err := valTree.Remove([]byte(PrefixNSVersion + key)); err != nil {
+		return nil, &util.GraphError{Type: util.ErrWriting, Detail: err.Error(), Cause: err}
+	}
+
 	// Create the node object which is returned
 
 	node := data.NewGraphNode()
@@ -526,13 +811,15 @@ func (gm *Manager) deleteNode(key string, kind string, attrTree *hash.HTree,
 	// Remove node attributes
 
 	for _, encattr := range attrList.([]string) {
-		attr := gm.nm.Decode32(encattr)
+		attr := gm.decode32(encattr)
 
 		// Try to remove the attribute
 
 		val, err := valTree.Remove([]byte(keyAttrPrefix + encattr))
 		if err != nil {
-			return node, &util.GraphError{Type: util.ErrWriting, Detail: err.Error()}
+			return node, &util.GraphError{Type: util.ErrWriting, Detail: err.Error(), Cause: err}
+		} else if val, err = gm.decompressAttrValue(kind, val, true); err != nil {
+			return node, err
 		}
 
 		node.SetAttr(attr, val)
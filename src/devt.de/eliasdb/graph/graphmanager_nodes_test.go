@@ -211,6 +211,22 @@ func TestSimpleNodeStorage(t *testing.T) {
 		return
 	}
 
+	if res, err := gm2.LookupPhrase("main", "mykind", "Data", "WORD5 word6"); fmt.Sprint(res) != "[123]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gm2.LookupPhrase("main", "mykind", "Data", "word6 word5"); len(res) != 0 || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gm2.LookupWordFuzzy("main", "mykind", "Data", "wrod5", 2); len(res) != 1 ||
+		fmt.Sprintf("%v %v %v", res[0].Word, res[0].Distance, res[0].Keys) != "word5 2 map[123:[2]]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
 	// Delete the nodes
 
 	fnode4, err := gm2.RemoveNode("main", "123", "mykind")
@@ -403,6 +419,21 @@ func TestSimpleNodeStorageErrorCases(t *testing.T) {
 		return
 	}
 
+	if res, err := gm.LookupPhrase("testpart", "testkind", "Data", "word"); res != nil || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := gm.LookupPhrase("in valid", "testkind", "Data", "word"); err == nil {
+		t.Error("Invalid partition name should cause an error")
+		return
+	}
+
+	if res, err := gm.LookupWordFuzzy("testpart", "testkind", "Data", "word", 1); res != nil || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
 	attTree, valTree, _ := gm.getNodeStorageHTree("testpart", "testkind", true)
 
 	if res, err := gm.readNode("123", "testkind", nil, attTree, valTree); res != nil || err != nil {
@@ -539,7 +570,7 @@ func TestSimpleNodeStorageErrorCases(t *testing.T) {
 
 	delete(sm.AccessMap, 1)
 
-	msm.AccessMap[5] = storage.AccessInsertError
+	msm.AccessMap[6] = storage.AccessInsertError
 
 	if err := gm.StoreNode("testpart", node2); err.Error() !=
 		"GraphError: Could not write graph information (Record is already in-use (? - ))" {
@@ -548,9 +579,9 @@ func TestSimpleNodeStorageErrorCases(t *testing.T) {
 		return
 	}
 
-	delete(msm.AccessMap, 5)
+	delete(msm.AccessMap, 6)
 
-	msm.AccessMap[5] = storage.AccessInsertError
+	msm.AccessMap[6] = storage.AccessInsertError
 
 	if err := gm.StoreNode("testpart", node2); err.Error() !=
 		"GraphError: Could not write graph information (Record is already in-use (? - ))" {
@@ -559,7 +590,7 @@ func TestSimpleNodeStorageErrorCases(t *testing.T) {
 		return
 	}
 
-	delete(msm.AccessMap, 5)
+	delete(msm.AccessMap, 6)
 
 	node2.SetAttr("key", "123")
 	node2.SetAttr("Name", nil)
@@ -592,9 +623,7 @@ func TestSimpleNodeStorageErrorCases(t *testing.T) {
 	is := gm.gs.StorageManager("testpart"+"testkind"+StorageSuffixNodesIndex,
 		false).(*storage.MemoryStorageManager)
 
-	for i := 0; i < 10; i++ {
-		is.AccessMap[uint64(i)] = storage.AccessInsertError
-	}
+	is.AccessMap[is.LocCount] = storage.AccessInsertError
 
 	node2.SetAttr("key", "789")
 
@@ -614,8 +643,10 @@ func TestSimpleNodeStorageErrorCases(t *testing.T) {
 		return
 	}
 
-	for i := 0; i < 10; i++ {
-		is.AccessMap[uint64(i)] = storage.AccessUpdateError
+	delete(is.AccessMap, is.LocCount)
+
+	for i := uint64(0); i < is.LocCount; i++ {
+		is.AccessMap[i] = storage.AccessUpdateError
 	}
 
 	if res, err := gm.RemoveNode("testpart", "789", "testkind"); !strings.Contains(err.Error(),
@@ -625,11 +656,11 @@ func TestSimpleNodeStorageErrorCases(t *testing.T) {
 		return
 	}
 
-	for i := 0; i < 10; i++ {
-		delete(is.AccessMap, uint64(i))
+	for i := uint64(0); i < is.LocCount; i++ {
+		delete(is.AccessMap, i)
 	}
 
-	msm.AccessMap[9] = storage.AccessCacheAndFetchError
+	msm.AccessMap[12] = storage.AccessCacheAndFetchError
 
 	// This call does delete the node by blowing
 	// away the attribute list - the node is removed though its attribute
@@ -637,12 +668,12 @@ func TestSimpleNodeStorageErrorCases(t *testing.T) {
 
 	if res, err := gm.deleteNode("123", "testkind", attTree, valTree); err.Error() !=
 		"GraphError: Could not write graph information "+
-			"(Slot not found (mystorage/testparttestkind.nodes - Location:9))" {
+			"(Slot not found (mystorage/testparttestkind.nodes - Location:12))" {
 
 		t.Error("Unexpected result:", res, err)
 		return
 	}
-	delete(msm.AccessMap, 9)
+	delete(msm.AccessMap, 12)
 
 	if res, err := gm.FetchNodePart("testpart", "123", "testkind", nil); res != nil || err != nil {
 		t.Error("Unexpected result:", res, err)
@@ -663,6 +694,174 @@ func TestSimpleNodeStorageErrorCases(t *testing.T) {
 	graphstorage.MgsRetFlushMain = nil
 }
 
+func TestRemoveOrphans(t *testing.T) {
+
+	oldBatchSize := OrphanRemovalBatchSize
+	OrphanRemovalBatchSize = 3
+	defer func() {
+		OrphanRemovalBatchSize = oldBatchSize
+	}()
+
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	for i := 0; i < 10; i++ {
+		node := data.NewGraphNode()
+		node.SetAttr("key", strconv.Itoa(i))
+		node.SetAttr("kind", "mykind")
+		gm.StoreNode("main", node)
+	}
+
+	node := data.NewGraphNode()
+	node.SetAttr("key", "x")
+	node.SetAttr("kind", "mykind2")
+	gm.StoreNode("main", node)
+
+	edge := data.NewGraphEdge()
+
+	edge.SetAttr("key", "abc")
+	edge.SetAttr("kind", "myedge")
+
+	edge.SetAttr(data.EdgeEnd1Key, "1")
+	edge.SetAttr(data.EdgeEnd1Kind, "mykind")
+	edge.SetAttr(data.EdgeEnd1Role, "node1")
+	edge.SetAttr(data.EdgeEnd1Cascading, false)
+
+	edge.SetAttr(data.EdgeEnd2Key, "2")
+	edge.SetAttr(data.EdgeEnd2Kind, "mykind")
+	edge.SetAttr(data.EdgeEnd2Role, "node2")
+	edge.SetAttr(data.EdgeEnd2Cascading, false)
+
+	gm.StoreEdge("main", edge)
+
+	if _, err := gm.RemoveOrphans("ma-in", nil); err == nil ||
+		err.Error() != "GraphError: Invalid data (Partition name ma-in is not alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if count, err := gm.RemoveOrphans("main", []string{"mykind"}); count != 8 || err != nil {
+		t.Error("Unexpected result:", count, err)
+		return
+	}
+
+	if res := gm.NodeCount("mykind"); res != 2 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if n, _ := gm.FetchNode("main", "x", "mykind2"); n == nil {
+		t.Error("Node should still exist")
+		return
+	}
+
+	if count, err := gm.RemoveOrphans("main", nil); count != 1 || err != nil {
+		t.Error("Unexpected result:", count, err)
+		return
+	}
+
+	if count, err := gm.RemoveOrphans("main", nil); count != 0 || err != nil {
+		t.Error("Unexpected result:", count, err)
+		return
+	}
+
+	// Test error case
+
+	node = data.NewGraphNode()
+	node.SetAttr("key", "y")
+	node.SetAttr("kind", "mykind2")
+	gm.StoreNode("main", node)
+
+	msm := mgs.StorageManager("main"+"mykind2"+StorageSuffixNodes, false)
+	msm.(*storage.MemoryStorageManager).AccessMap[1] = storage.AccessCacheAndFetchError
+
+	if _, err := gm.RemoveOrphans("main", []string{"mykind2"}); err == nil {
+		t.Error("Expected an error to occur")
+		return
+	}
+
+	delete(msm.(*storage.MemoryStorageManager).AccessMap, 1)
+}
+
+func TestSampleNodeKeys(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := newGraphManagerNoRules(mgs)
+
+	keys := make(map[string]bool)
+
+	for i := 0; i < 25; i++ {
+		node := data.NewGraphNode()
+		node.SetAttr("key", fmt.Sprintf("k%02d", i))
+		node.SetAttr("kind", "mynode")
+
+		if err := gm.StoreNode("main", node); err != nil {
+			t.Error(err)
+			return
+		}
+
+		keys[node.Key()] = true
+	}
+
+	if res, err := gm.SampleNodeKeys("main", "mynode", 0); res != nil || err == nil ||
+		err.Error() != "GraphError: Invalid data (Invalid sample size: 0)" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gm.SampleNodeKeys("main", "unknown", 5); res != nil || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gm.SampleNodeKeys("main ", "mynode", 5); res != nil || err == nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Asking for more keys than nodes returns all keys
+
+	if res, err := gm.SampleNodeKeys("main", "mynode", 30); err != nil || len(res) != 25 {
+		t.Error("Unexpected result:", res, err)
+		return
+	} else {
+		for _, key := range res {
+			if !keys[key] {
+				t.Error("Unexpected key:", key)
+				return
+			}
+		}
+	}
+
+	// Samples contain no duplicates and eventually cover all keys
+
+	seen := make(map[string]bool)
+
+	for i := 0; i < 200; i++ {
+		res, err := gm.SampleNodeKeys("main", "mynode", 5)
+		if err != nil || len(res) != 5 {
+			t.Error("Unexpected result:", res, err)
+			return
+		}
+
+		sample := make(map[string]bool)
+
+		for _, key := range res {
+			if !keys[key] || sample[key] {
+				t.Error("Unexpected sample:", res)
+				return
+			}
+
+			sample[key] = true
+			seen[key] = true
+		}
+	}
+
+	if len(seen) != len(keys) {
+		t.Error("Unexpected coverage:", len(seen))
+		return
+	}
+}
+
 func TestGraphManagerDiskStorage(t *testing.T) {
 	if !RunDiskStorageTests {
 		return
@@ -774,3 +973,111 @@ func testVersionPanic(t *testing.T, gs graphstorage.GraphStorage) {
 
 	newGraphManagerNoRules(gs)
 }
+
+func TestPartitionCounts(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	for i, part := range []string{"main", "main", "main", "other"} {
+		node := data.NewGraphNode()
+		node.SetAttr("key", fmt.Sprint("k", i))
+		node.SetAttr("kind", "mynode")
+
+		if err := gm.StoreNode(part, node); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	// Nodes stored in a transaction are counted
+
+	trans := NewGraphTrans(gm)
+
+	node := data.NewGraphNode()
+	node.SetAttr("key", "k9")
+	node.SetAttr("kind", "mynode")
+	trans.StoreNode("other", node)
+
+	edge := data.NewGraphEdge()
+	edge.SetAttr("key", "e1")
+	edge.SetAttr("kind", "myedge")
+	edge.SetAttr(data.EdgeEnd1Key, "k0")
+	edge.SetAttr(data.EdgeEnd1Kind, "mynode")
+	edge.SetAttr(data.EdgeEnd1Role, "node1")
+	edge.SetAttr(data.EdgeEnd1Cascading, true)
+	edge.SetAttr(data.EdgeEnd2Key, "k1")
+	edge.SetAttr(data.EdgeEnd2Kind, "mynode")
+	edge.SetAttr(data.EdgeEnd2Role, "node2")
+	edge.SetAttr(data.EdgeEnd2Cascading, false)
+	trans.StoreEdge("main", edge)
+
+	if err := trans.Commit(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := gm.RemoveNode("main", "k2", "mynode"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, test := range []struct {
+		part  string
+		kind  string
+		edge  bool
+		count uint64
+		ok    bool
+	}{
+		{"main", "mynode", false, 2, true},
+		{"other", "mynode", false, 2, true},
+		{"main", "myedge", true, 1, true},
+		{"other", "myedge", true, 0, true},
+		{"other", "unknown", false, 0, true},
+	} {
+		count, ok := gm.PartitionNodeCount(test.part, test.kind)
+		if test.edge {
+			count, ok = gm.PartitionEdgeCount(test.part, test.kind)
+		}
+
+		if count != test.count || ok != test.ok {
+			t.Error("Unexpected result:", test.part, test.kind, count, ok)
+			return
+		}
+	}
+
+	if gm.NodeCount("mynode") != 4 {
+		t.Error("Unexpected result:", gm.NodeCount("mynode"))
+		return
+	}
+
+	// Removing the node removed its edge (cascading)
+
+	if _, err := gm.RemoveNode("main", "k0", "mynode"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if count, ok := gm.PartitionEdgeCount("main", "myedge"); count != 0 || !ok {
+		t.Error("Unexpected result:", count, ok)
+		return
+	}
+
+	// Counts of kinds which were stored before counters per partition were
+	// maintained are unknown
+
+	delete(mgs.MainDB(), MainDBPartNodeCount+"other/mynode")
+
+	node = data.NewGraphNode()
+	node.SetAttr("key", "k10")
+	node.SetAttr("kind", "mynode")
+
+	if err := gm.StoreNode("other", node); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if count, ok := gm.PartitionNodeCount("other", "mynode"); count != 0 || ok {
+		t.Error("Unexpected result:", count, ok)
+		return
+	}
+}
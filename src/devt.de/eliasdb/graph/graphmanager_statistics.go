@@ -0,0 +1,324 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sync"
+
+	"devt.de/eliasdb/graph/data"
+)
+
+/*
+Statistics contains statistics about the data in a partition.
+*/
+type Statistics struct {
+	Partition string                         // Partition of the statistics
+	NodeKinds map[string]*NodeKindStatistics // Statistics for each node kind
+	EdgeKinds map[string]*EdgeKindStatistics // Statistics for each edge kind
+}
+
+/*
+NodeKindStatistics contains statistics about the nodes of a kind.
+*/
+type NodeKindStatistics struct {
+	Count uint64                     // Number of nodes
+	Attrs map[string]*AttrStatistics // Statistics for each attribute (without key and kind)
+}
+
+/*
+AttrStatistics contains statistics about the values of an attribute.
+*/
+type AttrStatistics struct {
+	Distinct uint64 // Approximate number of distinct values
+	Null     uint64 // Number of nodes which have no value for the attribute
+}
+
+/*
+EdgeKindStatistics contains statistics about the edges of a kind.
+*/
+type EdgeKindStatistics struct {
+	Count    uint64            // Number of edges
+	EndKinds map[string]uint64 // Number of edges for each <end1 kind>:<end2 kind> pair
+}
+
+/*
+statisticsCache caches computed statistics for partitions.
+*/
+type statisticsCache struct {
+	stats map[string]*Statistics // Cached statistics for each partition
+	gen   uint64                 // Generation counter which changes on every invalidation
+	mutex *sync.Mutex            // Mutex to protect the cache
+}
+
+/*
+newStatisticsCache creates a new statistics cache.
+*/
+func newStatisticsCache() *statisticsCache {
+	return &statisticsCache{make(map[string]*Statistics), 0, &sync.Mutex{}}
+}
+
+/*
+invalidate removes the cached statistics of a partition.
+*/
+func (sc *statisticsCache) invalidate(part string) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	delete(sc.stats, part)
+	sc.gen++
+}
+
+/*
+clear removes the cached statistics of all partitions.
+*/
+func (sc *statisticsCache) clear() {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	sc.stats = make(map[string]*Statistics)
+	sc.gen++
+}
+
+/*
+Statistics returns statistics about the data in a partition. Node and edge
+counts are exact. The number of distinct values of an attribute is estimated
+using a HyperLogLog sketch - the typical error is around 3%. Statistics are
+computed on demand in batches of IntegrityCheckBatchSize items and cached
+until the next change in the partition. The returned object is shared and
+should not be modified.
+*/
+func (gm *Manager) Statistics(part string) (*Statistics, error) {
+
+	if err := gm.checkPartitionName(part); err != nil {
+		return nil, err
+	}
+
+	gm.stats.mutex.Lock()
+	stats, ok := gm.stats.stats[part]
+	gen := gm.stats.gen
+	gm.stats.mutex.Unlock()
+
+	if ok {
+		return stats, nil
+	}
+
+	stats = &Statistics{part, make(map[string]*NodeKindStatistics),
+		make(map[string]*EdgeKindStatistics)}
+
+	for _, kind := range gm.NodeKinds() {
+		nks, err := gm.nodeKindStatistics(part, kind)
+		if err != nil {
+			return nil, err
+		} else if nks != nil {
+			stats.NodeKinds[kind] = nks
+		}
+	}
+
+	for _, kind := range gm.EdgeKinds() {
+		eks, err := gm.edgeKindStatistics(part, kind)
+		if err != nil {
+			return nil, err
+		} else if eks != nil {
+			stats.EdgeKinds[kind] = eks
+		}
+	}
+
+	// Only cache the result if there were no changes during the computation
+
+	gm.stats.mutex.Lock()
+	if gm.stats.gen == gen {
+		gm.stats.stats[part] = stats
+	}
+	gm.stats.mutex.Unlock()
+
+	return stats, nil
+}
+
+/*
+nodeKindStatistics computes the statistics of a node kind in a partition.
+Returns nil if there are no nodes of the kind in the partition.
+*/
+func (gm *Manager) nodeKindStatistics(part string, kind string) (*NodeKindStatistics, error) {
+
+	attrTree, err := gm.existingHTree(part + kind + StorageSuffixNodes)
+	if err != nil || attrTree == nil {
+		return nil, err
+	}
+
+	sm := gm.gs.StorageManager(part+kind+StorageSuffixNodes, false)
+
+	valTree, err := gm.getHTree(sm, RootIDNodeHTreeSecond)
+	if err != nil {
+		return nil, err
+	}
+
+	var count uint64
+
+	present := make(map[string]uint64)
+	sketches := make(map[string]*hyperLogLog)
+
+	for _, attr := range gm.NodeAttrs(kind) {
+		sketches[attr] = newHyperLogLog()
+	}
+
+	err = gm.iterateKeyBatches(part, attrTree, PrefixNSAttrs, false, func(keys []string) error {
+
+		for _, k := range keys {
+			node, err := gm.readNode(k[len(PrefixNSAttrs):], kind, nil, attrTree, valTree)
+			if err != nil {
+				return err
+			} else if node == nil {
+				continue
+			}
+
+			count++
+
+			for attr, val := range node.Data() {
+				if _, ok := sketches[attr]; !ok {
+					sketches[attr] = newHyperLogLog()
+				}
+
+				present[attr]++
+				sketches[attr].add(fmt.Sprint(val))
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil || count == 0 {
+		return nil, err
+	}
+
+	nks := &NodeKindStatistics{count, make(map[string]*AttrStatistics)}
+
+	for attr, sketch := range sketches {
+		if attr != data.NodeKey && attr != data.NodeKind {
+			nks.Attrs[attr] = &AttrStatistics{sketch.estimate(), count - present[attr]}
+		}
+	}
+
+	return nks, nil
+}
+
+/*
+edgeKindStatistics computes the statistics of an edge kind in a partition.
+Returns nil if there are no edges of the kind in the partition.
+*/
+func (gm *Manager) edgeKindStatistics(part string, kind string) (*EdgeKindStatistics, error) {
+
+	edgeTree, err := gm.existingHTree(part + kind + StorageSuffixEdges)
+	if err != nil || edgeTree == nil {
+		return nil, err
+	}
+
+	eks := &EdgeKindStatistics{0, make(map[string]uint64)}
+
+	err = gm.iterateKeyBatches(part, edgeTree, PrefixNSAttrs, false, func(keys []string) error {
+
+		for _, k := range keys {
+			node, err := gm.readNode(k[len(PrefixNSAttrs):], kind, nil, edgeTree, edgeTree)
+			if err != nil {
+				return err
+			} else if node == nil {
+				continue
+			}
+
+			edge := data.NewGraphEdgeFromNode(node)
+
+			eks.Count++
+			eks.EndKinds[edge.End1Kind()+":"+edge.End2Kind()]++
+		}
+
+		return nil
+	})
+
+	if err != nil || eks.Count == 0 {
+		return nil, err
+	}
+
+	return eks, nil
+}
+
+/*
+hllPrecision is the number of hash bits which are used to select a register
+of a HyperLogLog sketch.
+*/
+const hllPrecision = 10
+
+/*
+hyperLogLog is a HyperLogLog sketch which estimates the number of distinct
+values in a set.
+*/
+type hyperLogLog struct {
+	registers []uint8 // Maximum observed rank for each register
+}
+
+/*
+newHyperLogLog creates a new empty HyperLogLog sketch.
+*/
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{make([]uint8, 1<<hllPrecision)}
+}
+
+/*
+add adds a value to the sketch.
+*/
+func (h *hyperLogLog) add(val string) {
+	hf := fnv.New64a()
+	hf.Write([]byte(val))
+
+	// Mix the bits of the hash (FNV has a weak avalanche for short values)
+
+	x := hf.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+
+	idx := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+/*
+estimate returns the estimated number of distinct values in the sketch.
+*/
+func (h *hyperLogLog) estimate() uint64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	est := 0.7213 / (1 + 1.079/m) * m * m / sum
+
+	// Use linear counting for small cardinalities
+
+	if est <= 2.5*m && zeros > 0 {
+		est = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(est + 0.5)
+}
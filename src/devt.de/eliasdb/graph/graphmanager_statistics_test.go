@@ -0,0 +1,170 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"testing"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+func TestStatistics(t *testing.T) {
+
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	constructNode := func(part string, key string, kind string, attrs map[string]interface{}) data.Node {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", kind)
+
+		for k, v := range attrs {
+			node.SetAttr(k, v)
+		}
+
+		if err := gm.StoreNode(part, node); err != nil {
+			t.Error(err)
+		}
+
+		return node
+	}
+
+	constructEdge := func(key string, node1 data.Node, node2 data.Node) {
+		edge := data.NewGraphEdge()
+
+		edge.SetAttr("key", key)
+		edge.SetAttr("kind", "wrote")
+
+		edge.SetAttr(data.EdgeEnd1Key, node1.Key())
+		edge.SetAttr(data.EdgeEnd1Kind, node1.Kind())
+		edge.SetAttr(data.EdgeEnd1Role, "author")
+		edge.SetAttr(data.EdgeEnd1Cascading, false)
+
+		edge.SetAttr(data.EdgeEnd2Key, node2.Key())
+		edge.SetAttr(data.EdgeEnd2Kind, node2.Kind())
+		edge.SetAttr(data.EdgeEnd2Role, "work")
+		edge.SetAttr(data.EdgeEnd2Cascading, false)
+
+		if err := gm.StoreEdge("main", edge); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err := gm.Statistics("my main"); err == nil {
+		t.Error("Invalid partition name should cause an error")
+		return
+	}
+
+	a1 := constructNode("main", "a1", "Author", map[string]interface{}{"Name": "John", "Country": "UK"})
+	a2 := constructNode("main", "a2", "Author", map[string]interface{}{"Name": "Mike", "Country": "UK"})
+	constructNode("main", "a3", "Author", map[string]interface{}{"Name": "John"})
+	s1 := constructNode("main", "s1", "Song", map[string]interface{}{"Title": "Aria1"})
+	b1 := constructNode("main", "b1", "Book", map[string]interface{}{"Title": "Story1"})
+	constructNode("other", "s2", "Song", map[string]interface{}{"Title": "Aria2"})
+
+	constructEdge("e1", a1, s1)
+	constructEdge("e2", a2, s1)
+	constructEdge("e3", a1, b1)
+
+	formatAttrs := func(attrs map[string]*AttrStatistics) string {
+		res := make(map[string]string)
+		for attr, as := range attrs {
+			res[attr] = fmt.Sprintf("%v/%v", as.Distinct, as.Null)
+		}
+		return fmt.Sprint(res)
+	}
+
+	formatStats := func(stats *Statistics) string {
+		res := fmt.Sprintf("%v: ", stats.Partition)
+		for _, kind := range []string{"Author", "Book", "Song"} {
+			if nks, ok := stats.NodeKinds[kind]; ok {
+				res += fmt.Sprintf("%v %v %v; ", kind, nks.Count, formatAttrs(nks.Attrs))
+			}
+		}
+		if eks, ok := stats.EdgeKinds["wrote"]; ok {
+			res += fmt.Sprintf("wrote %v %v", eks.Count, eks.EndKinds)
+		}
+		return res
+	}
+
+	stats, err := gm.Statistics("main")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := formatStats(stats); res != "main: Author 3 map[Country:1/1 Name:2/0]; "+
+		"Book 1 map[Title:1/0]; Song 1 map[Title:1/0]; wrote 3 map[Author:Book:1 Author:Song:2]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	stats, err = gm.Statistics("other")
+	if res := formatStats(stats); err != nil || res != "other: Song 1 map[Title:1/0]; " {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Statistics are cached until the partition changes
+
+	if stats2, _ := gm.Statistics("other"); stats2 != stats {
+		t.Error("Statistics should have been cached")
+		return
+	}
+
+	constructNode("main", "a4", "Author", map[string]interface{}{"Name": "Hans"})
+
+	if stats2, _ := gm.Statistics("other"); stats2 != stats {
+		t.Error("Statistics should have been cached")
+		return
+	}
+
+	stats, err = gm.Statistics("main")
+	if err != nil || stats.NodeKinds["Author"].Count != 4 ||
+		formatAttrs(stats.NodeKinds["Author"].Attrs) != "map[Country:1/2 Name:3/0]" {
+		t.Error("Unexpected result:", formatAttrs(stats.NodeKinds["Author"].Attrs), err)
+		return
+	}
+
+	if _, err := gm.RemoveEdge("main", "e3", "wrote"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	stats, err = gm.Statistics("main")
+	if err != nil || fmt.Sprint(stats.EdgeKinds["wrote"]) != "&{2 map[Author:Song:2]}" {
+		t.Error("Unexpected result:", stats.EdgeKinds["wrote"], err)
+		return
+	}
+}
+
+func TestHyperLogLog(t *testing.T) {
+
+	hll := newHyperLogLog()
+
+	if res := hll.estimate(); res != 0 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	for i := 0; i < 100000; i++ {
+		hll.add(fmt.Sprint(i % 20000))
+	}
+
+	// The estimate should be within 10% of the real value
+
+	if res := hll.estimate(); res < 18000 || res > 22000 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
@@ -0,0 +1,161 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"devt.de/eliasdb/graph/graphstorage"
+	"devt.de/eliasdb/graph/util"
+	"devt.de/eliasdb/storage"
+)
+
+/*
+SyncLogs writes the transaction logs of all storage files to the storage
+files and starts new empty transaction logs. If the flush flag is set then
+the main database and all pending changes of the storage managers are written
+first. Returns the result for each storage file - the list is empty if the
+storage keeps no transaction logs.
+*/
+func (gm *Manager) SyncLogs(flush bool) ([]*storage.SyncResult, error) {
+
+	// Take global writer lock - this waits for all running operations
+	// so no transaction is written while the logs are synced
+
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	if err := gm.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	if flush {
+		if err := gm.flushMain(); err != nil {
+			return nil, err
+		}
+	}
+
+	ret := []*storage.SyncResult{}
+
+	if ls, ok := gm.gs.(graphstorage.LogStorage); ok {
+		ret = append(ret, ls.SyncLogs(flush)...)
+	}
+
+	return ret, nil
+}
+
+/*
+Rollback discards all changes of the storage managers which have not yet been
+written to a transaction log and reloads the main database from disk. All
+cached information about the discarded changes is discarded as well. Returns
+the result for each storage manager - the list is empty if the storage keeps
+no transaction logs.
+*/
+func (gm *Manager) Rollback() ([]*storage.SyncResult, error) {
+
+	// Take global writer lock
+
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	if err := gm.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	ret := []*storage.SyncResult{}
+
+	if ls, ok := gm.gs.(graphstorage.LogStorage); ok {
+		ret = append(ret, ls.Rollback()...)
+	}
+
+	err := gm.rollbackMain()
+
+	gm.resetCaches()
+
+	return ret, err
+}
+
+/*
+Backup copies all files of the graph storage to a given directory. The main
+database is written first. The global writer lock is held while the files are
+copied so the copy contains a consistent state of the graph. Returns the names
+of the copied files.
+*/
+func (gm *Manager) Backup(dir string) ([]string, error) {
+
+	// Take global writer lock - this waits for all running operations
+
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	if err := gm.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	if err := gm.flushMain(); err != nil {
+		return nil, err
+	}
+
+	bs, ok := gm.gs.(graphstorage.BackupStorage)
+	if !ok {
+		return nil, &util.GraphError{Type: util.ErrAccessComponent, Detail: "Graph storage does not support backups"}
+	}
+
+	return bs.Backup(dir)
+}
+
+/*
+Restore replaces all files of the graph storage with the files of a given
+directory (e.g. a copy which was made by Backup). All cached information
+about the previous graph is discarded.
+*/
+func (gm *Manager) Restore(dir string) error {
+
+	// Take global writer lock - this waits for all running operations
+
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	if err := gm.checkOpen(); err != nil {
+		return err
+	}
+
+	bs, ok := gm.gs.(graphstorage.BackupStorage)
+	if !ok {
+		return &util.GraphError{Type: util.ErrAccessComponent, Detail: "Graph storage does not support backups"}
+	}
+
+	if err := bs.Restore(dir); err != nil {
+		return err
+	}
+
+	gm.resetCaches()
+
+	return nil
+}
+
+/*
+resetCaches discards all information which is kept in memory about the stored
+graph. This includes the name encodings, the cached maps of the main database
+(e.g. partition lists and the configuration of kinds), the cached statistics,
+the modification counters and the keys of running bulk loads. It is assumed
+that the caller holds the global writer lock.
+*/
+func (gm *Manager) resetCaches() {
+	gm.mainLock.Lock()
+
+	gm.nm = util.NewNamesManager(gm.gs.MainDB())
+	gm.mapCache = make(map[string]map[string]string)
+
+	gm.mainLock.Unlock()
+
+	gm.stats.clear()
+	gm.mc.reset()
+	gm.bl.clear()
+}
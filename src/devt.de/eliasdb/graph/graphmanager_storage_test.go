@@ -0,0 +1,294 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+	"devt.de/eliasdb/graph/util"
+	"devt.de/eliasdb/storage/file"
+)
+
+func TestSyncLogs(t *testing.T) {
+
+	gm := NewGraphManager(graphstorage.NewMemoryGraphStorage("mystorage"))
+
+	if res, err := gm.SyncLogs(true); err != nil || len(res) != 0 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := gm.Rollback(); err != nil || len(res) != 0 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if !RunDiskStorageTests {
+		return
+	}
+
+	dgs, err := graphstorage.NewDiskGraphStorage(GraphManagerTestDBDir10, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	gm = NewGraphManager(dgs)
+
+	node := data.NewGraphNode()
+	node.SetAttr("key", "a")
+	node.SetAttr("kind", "mynode")
+
+	if err := gm.StoreNode("main", node); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Write the transaction logs to the storage files
+
+	res, err := gm.SyncLogs(false)
+	if err != nil || len(res) == 0 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	var written, logBytes int64
+
+	for _, r := range res {
+		if r.Error != nil {
+			t.Error("Unexpected result:", r)
+			return
+		}
+		written += r.BytesWritten
+		logBytes += r.LogBytes
+	}
+
+	if written == 0 || logBytes == 0 {
+		t.Error("Unexpected result:", written, logBytes)
+		return
+	}
+
+	logs, _ := filepath.Glob(filepath.Join(GraphManagerTestDBDir10, "*."+file.LogFileSuffix))
+
+	for _, log := range logs {
+		if info, err := os.Stat(log); err != nil || info.Size() != int64(len(file.TransactionLogHeader)) {
+			t.Error("Unexpected transaction log:", log, info.Size(), err)
+			return
+		}
+	}
+
+	// Changes of the main database are written when flushing
+
+	dgs.MainDB()["test1"] = "value1"
+
+	if _, err := gm.SyncLogs(true); err != nil {
+		t.Error(err)
+		return
+	}
+
+	dgs.MainDB()["test2"] = "value2"
+
+	if res, err = gm.Rollback(); err != nil || len(res) == 0 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	for _, r := range res {
+		if r.Error != nil {
+			t.Error("Unexpected result:", r)
+			return
+		}
+	}
+
+	if mdb := dgs.MainDB(); mdb["test1"] != "value1" || mdb["test2"] != "" {
+		t.Error("Unexpected main database:", mdb["test1"], mdb["test2"])
+		return
+	}
+
+	if n, err := gm.FetchNode("main", "a", "mynode"); err != nil || n == nil {
+		t.Error("Unexpected result:", n, err)
+		return
+	}
+
+	// Cached information about rolled back changes is discarded
+
+	if stats, err := gm.Statistics("main"); err != nil || stats.NodeKinds["mynode"].Count != 1 {
+		t.Error("Unexpected result:", stats, err)
+		return
+	}
+
+	gm.storeMainDBMap(MainDBNodeKinds, map[string]string{"mynode": "", "othernode": ""})
+
+	if kinds := gm.NodeKinds(); fmt.Sprint(kinds) != "[mynode othernode]" {
+		t.Error("Unexpected result:", kinds)
+		return
+	}
+
+	if _, err = gm.Rollback(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if kinds := gm.NodeKinds(); fmt.Sprint(kinds) != "[mynode]" {
+		t.Error("Unexpected result:", kinds)
+		return
+	}
+
+	if len(gm.stats.stats) != 0 {
+		t.Error("Unexpected cached statistics:", gm.stats.stats)
+		return
+	}
+
+	if stats, err := gm.Statistics("main"); err != nil || stats.NodeKinds["mynode"].Count != 1 ||
+		stats.NodeKinds["othernode"] != nil {
+		t.Error("Unexpected result:", stats, err)
+		return
+	}
+
+	if err := gm.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := gm.SyncLogs(true); err == nil || err.(*util.GraphError).Type != util.ErrClosed {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := gm.Rollback(); err == nil || err.(*util.GraphError).Type != util.ErrClosed {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestBackup(t *testing.T) {
+
+	gm := NewGraphManager(graphstorage.NewMemoryGraphStorage("mystorage"))
+
+	if _, err := gm.Backup(GraphManagerTestDBDir12); err == nil ||
+		err.Error() != "GraphError: Failed to access graph storage component (Graph storage does not support backups)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.Restore(GraphManagerTestDBDir12); err == nil || err.(*util.GraphError).Type != util.ErrAccessComponent {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if !RunDiskStorageTests {
+		return
+	}
+
+	dgs, err := graphstorage.NewDiskGraphStorage(GraphManagerTestDBDir11, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	gm = NewGraphManager(dgs)
+
+	for _, key := range []string{"a", "b"} {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "mynode")
+
+		if err := gm.StoreNode("main", node); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	os.Mkdir(GraphManagerTestDBDir12, 0770)
+
+	if files, err := gm.Backup(GraphManagerTestDBDir12); err != nil || len(files) == 0 {
+		t.Error("Unexpected result:", files, err)
+		return
+	}
+
+	gm.Close()
+
+	// Restore the copy into another graph
+
+	dgs, err = graphstorage.NewDiskGraphStorage(GraphManagerTestDBDir13, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	gm = NewGraphManager(dgs)
+
+	node := data.NewGraphNode()
+	node.SetAttr("key", "x")
+	node.SetAttr("kind", "othernode")
+
+	if err := gm.StoreNode("other", node); err != nil {
+		t.Error(err)
+		return
+	}
+
+	it, err := gm.NodeKeyIterator("other", "othernode")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	gm.bl.start("other", "othernode")
+
+	if err := gm.Restore(GraphManagerTestDBDir12); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Iterations and bulk loads of the previous graph are ended
+
+	if res := it.Next(); res != "" || it.LastError.(*util.GraphError).Type != util.ErrConcurrentModification {
+		t.Error("Unexpected result:", res, it.LastError)
+		return
+	}
+
+	if _, ok := gm.bl.take("other", "othernode", 1); ok {
+		t.Error("Bulk load keys should have been discarded")
+		return
+	}
+
+	if res := gm.NodeCount("mynode"); res != 2 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if n, err := gm.FetchNode("main", "b", "mynode"); err != nil || n == nil {
+		t.Error("Unexpected result:", n, err)
+		return
+	}
+
+	if res := fmt.Sprint(gm.Partitions(), gm.NodeKinds()); res != "[main] [mynode]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	gm.Close()
+
+	if _, err := gm.Backup(GraphManagerTestDBDir12); err == nil || err.(*util.GraphError).Type != util.ErrClosed {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.Restore(GraphManagerTestDBDir12); err == nil || err.(*util.GraphError).Type != util.ErrClosed {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
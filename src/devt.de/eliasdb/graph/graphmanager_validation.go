@@ -0,0 +1,104 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"sync"
+
+	"devt.de/eliasdb/graph/data"
+)
+
+/*
+AttrValidator validates the name of a node or edge attribute. Returns an
+error if the name is not allowed.
+*/
+type AttrValidator func(attr string) error
+
+/*
+DefaultAttrValidator is the default attribute validator which allows all
+attribute names. Empty attribute names are never allowed regardless of the
+configured validator.
+*/
+func DefaultAttrValidator(attr string) error {
+	return nil
+}
+
+/*
+attrValidator data structure which holds the configured attribute validator.
+*/
+type attrValidator struct {
+	validator AttrValidator // Configured validator
+	mutex     *sync.RWMutex // Mutex to protect the validator
+}
+
+/*
+newAttrValidator creates a new attrValidator instance.
+*/
+func newAttrValidator() *attrValidator {
+	return &attrValidator{DefaultAttrValidator, &sync.RWMutex{}}
+}
+
+/*
+get returns the configured validator.
+*/
+func (av *attrValidator) get() AttrValidator {
+	av.mutex.RLock()
+	defer av.mutex.RUnlock()
+
+	return av.validator
+}
+
+/*
+set configures the validator. A nil validator resets to the default validator.
+*/
+func (av *attrValidator) set(validator AttrValidator) {
+	av.mutex.Lock()
+	defer av.mutex.Unlock()
+
+	if validator == nil {
+		validator = DefaultAttrValidator
+	}
+
+	av.validator = validator
+}
+
+/*
+SetAttrValidator sets the validator for attribute names of nodes and edges. A
+nil validator resets to DefaultAttrValidator. The validator is not consulted
+for the system attributes (key, kind and the edge end attributes). Already
+stored attributes are not checked.
+*/
+func (gm *Manager) SetAttrValidator(validator AttrValidator) {
+	gm.av.set(validator)
+}
+
+/*
+validateAttr checks a given attribute name with the configured validator.
+*/
+func (gm *Manager) validateAttr(attr string) error {
+	if isSystemAttr(attr) {
+		return nil
+	}
+
+	return gm.av.get()(attr)
+}
+
+/*
+isSystemAttr checks if a given attribute is a system attribute of nodes or
+edges.
+*/
+func isSystemAttr(attr string) bool {
+	return attr == data.NodeKey || attr == data.NodeKind ||
+		attr == data.EdgeEnd1Key || attr == data.EdgeEnd1Kind ||
+		attr == data.EdgeEnd1Role || attr == data.EdgeEnd1Cascading ||
+		attr == data.EdgeEnd2Key || attr == data.EdgeEnd2Kind ||
+		attr == data.EdgeEnd2Role || attr == data.EdgeEnd2Cascading
+}
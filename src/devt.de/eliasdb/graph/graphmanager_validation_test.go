@@ -0,0 +1,144 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+func TestAttrValidator(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	newNode := func(key string, attr string) data.Node {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "mykind")
+		node.SetAttr(attr, "foo")
+		return node
+	}
+
+	// The default validator allows any name
+
+	if err := gm.StoreNode("main", newNode("1", "_hidden")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !gm.IsValidAttr("_hidden") {
+		t.Error("_hidden should be a valid attribute")
+		return
+	}
+
+	gm.SetAttrValidator(func(attr string) error {
+		if strings.HasPrefix(attr, "_") {
+			return errors.New("Attribute names must not start with an underscore")
+		}
+		return nil
+	})
+
+	// Dotted names are allowed
+
+	if err := gm.StoreNode("main", newNode("2", "ext.vendor.field")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !gm.IsValidAttr("ext.vendor.field") || !gm.IsValidAttr(data.NodeKey) {
+		t.Error("Attributes should be valid")
+		return
+	}
+
+	// Forbidden names are rejected when storing and are no longer valid
+	// attributes for queries
+
+	if gm.IsValidAttr("_hidden") {
+		t.Error("_hidden should not be a valid attribute")
+		return
+	}
+
+	if err := gm.StoreNode("main", newNode("3", "_secret")); err == nil ||
+		err.Error() != `GraphError: Invalid data (Node attribute "_secret" is invalid: `+
+			`Attribute names must not start with an underscore)` {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := gm.UpdateNode("main", newNode("1", "_hidden")); err == nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	trans := NewGraphTrans(gm)
+
+	if err := trans.StoreNode("main", newNode("3", "_secret")); err == nil ||
+		err.Error() != `GraphError: Invalid data (Node attribute "_secret" is invalid: `+
+			`Attribute names must not start with an underscore)` {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	edge := data.NewGraphEdge()
+
+	edge.SetAttr(data.NodeKey, "abc")
+	edge.SetAttr(data.NodeKind, "myedge")
+	edge.SetAttr("_weight", 5)
+
+	edge.SetAttr(data.EdgeEnd1Key, "1")
+	edge.SetAttr(data.EdgeEnd1Kind, "mykind")
+	edge.SetAttr(data.EdgeEnd1Role, "node1")
+	edge.SetAttr(data.EdgeEnd1Cascading, false)
+
+	edge.SetAttr(data.EdgeEnd2Key, "2")
+	edge.SetAttr(data.EdgeEnd2Kind, "mykind")
+	edge.SetAttr(data.EdgeEnd2Role, "node2")
+	edge.SetAttr(data.EdgeEnd2Cascading, false)
+
+	if err := gm.StoreEdge("main", edge); err == nil ||
+		err.Error() != `GraphError: Invalid data (Edge attribute "_weight" is invalid: `+
+			`Attribute names must not start with an underscore)` {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	delete(edge.Data(), "_weight")
+
+	if err := gm.StoreEdge("main", edge); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Empty names are never allowed
+
+	gm.SetAttrValidator(func(attr string) error {
+		return nil
+	})
+
+	if err := gm.StoreNode("main", newNode("4", "")); err == nil ||
+		err.Error() != "GraphError: Invalid data (Node contains empty string attribute name)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Reset the validator
+
+	gm.SetAttrValidator(nil)
+
+	if err := gm.StoreNode("main", newNode("3", "_secret")); err != nil || !gm.IsValidAttr("_secret") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
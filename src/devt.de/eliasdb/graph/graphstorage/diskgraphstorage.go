@@ -18,8 +18,13 @@ package graphstorage
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"devt.de/common/datautil"
 	"devt.de/common/fileutil"
@@ -40,6 +45,9 @@ type DiskGraphStorage struct {
 	readonly        bool                       // Flag for readonly mode
 	mainDB          *datautil.PersistentMap    // Database storing names
 	storagemanagers map[string]storage.Manager // Map of StorageManagers
+	mutex           *sync.Mutex                // Mutex to protect the map of StorageManagers
+	diag            *Diagnostics               // Diagnostics of the storage
+	diagMutex       *sync.Mutex                // Mutex to protect the diagnostics
 }
 
 /*
@@ -47,20 +55,21 @@ NewDiskGraphStorage creates a new DiskGraphStorage instance.
 */
 func NewDiskGraphStorage(name string, readonly bool) (GraphStorage, error) {
 
-	dgs := &DiskGraphStorage{name, readonly, nil, make(map[string]storage.Manager)}
+	dgs := &DiskGraphStorage{name, readonly, nil, make(map[string]storage.Manager), &sync.Mutex{},
+		&Diagnostics{Location: name}, &sync.Mutex{}}
 
 	// Load the graph storage if the storage directory already exists if not try to create it
 
 	if res, _ := fileutil.PathExists(name); !res {
 		if err := os.Mkdir(name, 0770); err != nil {
-			return nil, &util.GraphError{Type: util.ErrOpening, Detail: err.Error()}
+			return nil, &util.GraphError{Type: util.ErrOpening, Detail: err.Error(), Cause: err}
 		}
 
 		// Create the graph storage files
 
 		mainDB, err := datautil.NewPersistentMap(name + "/" + FilenameNameDB)
 		if err != nil {
-			return nil, &util.GraphError{Type: util.ErrOpening, Detail: err.Error()}
+			return nil, &util.GraphError{Type: util.ErrOpening, Detail: err.Error(), Cause: err}
 		}
 
 		dgs.mainDB = mainDB
@@ -71,7 +80,7 @@ func NewDiskGraphStorage(name string, readonly bool) (GraphStorage, error) {
 
 		mainDB, err := datautil.LoadPersistentMap(name + "/" + FilenameNameDB)
 		if err != nil {
-			return nil, &util.GraphError{Type: util.ErrOpening, Detail: err.Error()}
+			return nil, &util.GraphError{Type: util.ErrOpening, Detail: err.Error(), Cause: err}
 		}
 
 		dgs.mainDB = mainDB
@@ -107,7 +116,7 @@ func (dgs *DiskGraphStorage) RollbackMain() error {
 
 	mainDB, err := datautil.LoadPersistentMap(dgs.name + "/" + FilenameNameDB)
 	if err != nil {
-		return &util.GraphError{Type: util.ErrOpening, Detail: err.Error()}
+		return &util.GraphError{Type: util.ErrOpening, Detail: err.Error(), Cause: err}
 	}
 
 	dgs.mainDB = mainDB
@@ -126,8 +135,8 @@ func (dgs *DiskGraphStorage) FlushMain() error {
 		return &util.GraphError{Type: util.ErrReadOnly, Detail: "Cannot flush main db"}
 	}
 
-	if err := dgs.mainDB.Flush(); err != nil {
-		return &util.GraphError{Type: util.ErrFlushing, Detail: err.Error()}
+	if err := dgs.report(dgs.mainDB.Flush(), true); err != nil {
+		return &util.GraphError{Type: util.ErrFlushing, Detail: err.Error(), Cause: err}
 	}
 	return nil
 }
@@ -137,6 +146,8 @@ StorageManager gets a storage manager with a certain name. A non-existing
 StorageManager is created automatically if the create flag is set to true.
 */
 func (dgs *DiskGraphStorage) StorageManager(smname string, create bool) storage.Manager {
+	dgs.mutex.Lock()
+	defer dgs.mutex.Unlock()
 
 	sm, ok := dgs.storagemanagers[smname]
 
@@ -147,7 +158,7 @@ func (dgs *DiskGraphStorage) StorageManager(smname string, create bool) storage.
 
 	if !ok && (create || storage.DataFileExist(filename)) {
 		dsm := storage.NewDiskStorageManager(dgs.name+"/"+smname, dgs.readonly, false, false, false)
-		sm = storage.NewCachedDiskStorageManager(dsm, 100000)
+		sm = &diagStorageManager{storage.NewCachedDiskStorageManager(dsm, 100000), dgs}
 		dgs.storagemanagers[smname] = sm
 	}
 
@@ -181,3 +192,310 @@ func (dgs *DiskGraphStorage) Close() error {
 
 	return nil
 }
+
+/*
+Diagnostics returns information about the state of the storage.
+*/
+func (dgs *DiskGraphStorage) Diagnostics() *Diagnostics {
+	var pending int
+
+	dgs.mutex.Lock()
+
+	for _, sm := range dgs.storagemanagers {
+		if psm, ok := sm.(interface {
+			PendingTransactions() int
+		}); ok && psm.PendingTransactions() > pending {
+			pending = psm.PendingTransactions()
+		}
+	}
+
+	dgs.mutex.Unlock()
+
+	dgs.diagMutex.Lock()
+	defer dgs.diagMutex.Unlock()
+
+	diag := *dgs.diag
+	diag.PendingTransactions = pending
+
+	return &diag
+}
+
+/*
+SyncLogs writes the transaction logs of all storage files to the storage
+files and starts new empty transaction logs. Pending changes of all storage
+managers are flushed first if the flush flag is set.
+*/
+func (dgs *DiskGraphStorage) SyncLogs(flush bool) []*storage.SyncResult {
+	var ret []*storage.SyncResult
+
+	dgs.mutex.Lock()
+	defer dgs.mutex.Unlock()
+
+	for _, smname := range dgs.storageManagerNames() {
+		sm := dgs.storagemanagers[smname]
+
+		if flush {
+			if err := sm.Flush(); err != nil {
+				ret = append(ret, &storage.SyncResult{File: dgs.name + "/" + smname, Error: err})
+				continue
+			}
+		}
+
+		if ssm, ok := sm.(interface {
+			SyncLogs() []*storage.SyncResult
+		}); ok {
+			for _, res := range ssm.SyncLogs() {
+				dgs.report(res.Error, false)
+				ret = append(ret, res)
+			}
+		}
+	}
+
+	return ret
+}
+
+/*
+Rollback cancels the pending changes of all storage managers which have not
+yet been written to a transaction log.
+*/
+func (dgs *DiskGraphStorage) Rollback() []*storage.SyncResult {
+	var ret []*storage.SyncResult
+
+	dgs.mutex.Lock()
+	defer dgs.mutex.Unlock()
+
+	for _, smname := range dgs.storageManagerNames() {
+		ret = append(ret, &storage.SyncResult{File: dgs.name + "/" + smname,
+			Error: dgs.storagemanagers[smname].Rollback()})
+	}
+
+	return ret
+}
+
+/*
+Backup copies all files of the storage to a given directory. Changes which
+were not flushed are not part of the copy.
+*/
+func (dgs *DiskGraphStorage) Backup(dir string) ([]string, error) {
+	var ret []string
+
+	dgs.mutex.Lock()
+	defer dgs.mutex.Unlock()
+
+	copied := make(map[string]bool)
+
+	// Open storage managers copy their own files
+
+	for _, smname := range dgs.storageManagerNames() {
+		if bsm, ok := dgs.storagemanagers[smname].(interface {
+			Backup(dir string) ([]string, error)
+		}); ok {
+			files, err := bsm.Backup(dir)
+			if err != nil {
+				return nil, &util.GraphError{Type: util.ErrAccessComponent, Detail: err.Error(), Cause: err}
+			}
+
+			for _, f := range files {
+				copied[f] = true
+			}
+		}
+	}
+
+	// All other files are not written and can be copied directly
+
+	files, err := ioutil.ReadDir(dgs.name)
+	if err != nil {
+		return nil, &util.GraphError{Type: util.ErrAccessComponent, Detail: err.Error(), Cause: err}
+	}
+
+	for _, fi := range files {
+		name := fi.Name()
+
+		if !copied[name] && fi.Mode().IsRegular() && !strings.HasSuffix(name, "."+storage.FileSiffixLockfile) {
+
+			if _, err := fileutil.CopyFile(filepath.Join(dgs.name, name), filepath.Join(dir, name)); err != nil {
+				return nil, &util.GraphError{Type: util.ErrAccessComponent, Detail: err.Error(), Cause: err}
+			}
+
+			copied[name] = true
+		}
+	}
+
+	for name := range copied {
+		ret = append(ret, name)
+	}
+
+	sort.Strings(ret)
+
+	return ret, nil
+}
+
+/*
+Restore replaces all files of the storage with the files of a given directory.
+All storage managers are closed before the files are replaced. They are opened
+again when they are requested.
+*/
+func (dgs *DiskGraphStorage) Restore(dir string) error {
+
+	// Fail operation when readonly
+
+	if dgs.readonly {
+		return &util.GraphError{Type: util.ErrReadOnly, Detail: "Cannot restore storage"}
+	}
+
+	dgs.mutex.Lock()
+	defer dgs.mutex.Unlock()
+
+	for smname, sm := range dgs.storagemanagers {
+		if err := sm.Close(); err != nil {
+			return &util.GraphError{Type: util.ErrClosing, Detail: err.Error(), Cause: err}
+		}
+		delete(dgs.storagemanagers, smname)
+	}
+
+	if err := replaceFiles(dgs.name, dir); err != nil {
+		return &util.GraphError{Type: util.ErrWriting, Detail: err.Error(), Cause: err}
+	}
+
+	mainDB, err := datautil.LoadPersistentMap(dgs.name + "/" + FilenameNameDB)
+	if err != nil {
+		return &util.GraphError{Type: util.ErrOpening, Detail: err.Error(), Cause: err}
+	}
+
+	dgs.mainDB = mainDB
+
+	return nil
+}
+
+/*
+storageManagerNames returns the sorted names of all open storage managers.
+*/
+func (dgs *DiskGraphStorage) storageManagerNames() []string {
+	var ret []string
+
+	for smname := range dgs.storagemanagers {
+		ret = append(ret, smname)
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
+
+/*
+replaceFiles removes all files of a target directory and copies all files of
+a source directory into it.
+*/
+func replaceFiles(target string, src string) error {
+
+	// Read the source directory first so nothing is removed if it cannot be read
+
+	srcFiles, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	files, err := ioutil.ReadDir(target)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range files {
+		if fi.Mode().IsRegular() {
+			if err := os.Remove(filepath.Join(target, fi.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, fi := range srcFiles {
+		if fi.Mode().IsRegular() {
+			if _, err := fileutil.CopyFile(filepath.Join(src, fi.Name()), filepath.Join(target, fi.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+report records the result of a storage operation in the diagnostics of the
+storage. Returns the given error.
+*/
+func (dgs *DiskGraphStorage) report(err error, flush bool) error {
+
+	if err != nil || flush {
+		dgs.diagMutex.Lock()
+		defer dgs.diagMutex.Unlock()
+
+		if err != nil {
+			dgs.diag.LastError = err
+			dgs.diag.LastErrorTime = time.Now()
+		} else {
+			dgs.diag.LastFlush = time.Now()
+		}
+	}
+
+	return err
+}
+
+/*
+diagStorageManager reports the errors and flushes of a storage manager to the
+diagnostics of its graph storage.
+*/
+type diagStorageManager struct {
+	*storage.CachedDiskStorageManager                   // Wrapped storage manager
+	dgs                               *DiskGraphStorage // Graph storage of the manager
+}
+
+/*
+Insert inserts an object and return its storage location.
+*/
+func (dsm *diagStorageManager) Insert(o interface{}) (uint64, error) {
+	loc, err := dsm.CachedDiskStorageManager.Insert(o)
+	return loc, dsm.dgs.report(err, false)
+}
+
+/*
+Update updates a storage location.
+*/
+func (dsm *diagStorageManager) Update(loc uint64, o interface{}) error {
+	return dsm.dgs.report(dsm.CachedDiskStorageManager.Update(loc, o), false)
+}
+
+/*
+Free frees a storage location.
+*/
+func (dsm *diagStorageManager) Free(loc uint64) error {
+	return dsm.dgs.report(dsm.CachedDiskStorageManager.Free(loc), false)
+}
+
+/*
+Fetch fetches an object from a given storage location and writes it to
+a given data container.
+*/
+func (dsm *diagStorageManager) Fetch(loc uint64, o interface{}) error {
+	return dsm.dgs.report(dsm.CachedDiskStorageManager.Fetch(loc, o), false)
+}
+
+/*
+Flush writes all pending changes to disk.
+*/
+func (dsm *diagStorageManager) Flush() error {
+	return dsm.dgs.report(dsm.CachedDiskStorageManager.Flush(), true)
+}
+
+/*
+Rollback cancels all pending changes which have not yet been written to disk.
+*/
+func (dsm *diagStorageManager) Rollback() error {
+	return dsm.dgs.report(dsm.CachedDiskStorageManager.Rollback(), false)
+}
+
+/*
+Close closes the storage manager and writes all pending changes to disk.
+*/
+func (dsm *diagStorageManager) Close() error {
+	return dsm.dgs.report(dsm.CachedDiskStorageManager.Close(), false)
+}
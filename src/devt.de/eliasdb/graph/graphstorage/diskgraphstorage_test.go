@@ -15,17 +15,24 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 
 	"devt.de/common/datautil"
 	"devt.de/common/fileutil"
+	"devt.de/eliasdb/graph/util"
 	"devt.de/eliasdb/storage"
 )
 
 const diskGraphStorageTestDBDir = "diskgraphstoragetest1"
 const diskGraphStorageTestDBDir2 = "diskgraphstoragetest2"
+const diskGraphStorageTestDBDir3 = "diskgraphstoragetest3"
+const diskGraphStorageTestDBDir4 = "diskgraphstoragetest4"
+const diskGraphStorageTestBackupDir = "diskgraphstoragebackup"
 
-var dbdirs = []string{diskGraphStorageTestDBDir, diskGraphStorageTestDBDir2}
+var dbdirs = []string{diskGraphStorageTestDBDir, diskGraphStorageTestDBDir2,
+	diskGraphStorageTestDBDir3, diskGraphStorageTestDBDir4, diskGraphStorageTestBackupDir}
 
 const invalidFileName = "**" + string(0x0)
 
@@ -109,6 +116,80 @@ func TestDiskGraphStorage(t *testing.T) {
 		return
 	}
 
+	// Check diagnostics
+
+	diag := dgsnew.(DiagnosticStorage).Diagnostics()
+
+	if diag.Location != diskGraphStorageTestDBDir || diag.PendingTransactions != 0 ||
+		!diag.LastFlush.IsZero() || diag.LastError != nil {
+		t.Error("Unexpected result:", diag)
+		return
+	}
+
+	loc, err := sm1.Insert("test")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := sm1.Flush(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if diag = dgsnew.(DiagnosticStorage).Diagnostics(); diag.PendingTransactions != 1 ||
+		diag.LastFlush.IsZero() || diag.LastError != nil {
+		t.Error("Unexpected result:", diag)
+		return
+	}
+
+	var res string
+
+	if err := sm1.Fetch(loc+1000, &res); err == nil {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if diag = dgsnew.(DiagnosticStorage).Diagnostics(); diag.LastError == nil || diag.LastErrorTime.IsZero() {
+		t.Error("Unexpected result:", diag)
+		return
+	}
+
+	// Write the transaction logs to the storage files
+
+	if _, err := sm1.Insert("test2"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	syncRes := dgsnew.(LogStorage).SyncLogs(true)
+
+	if len(syncRes) != 4 || syncRes[0].File != diskGraphStorageTestDBDir+"/store1.nodes.db" {
+		t.Error("Unexpected result:", syncRes)
+		return
+	}
+
+	var written int64
+
+	for _, res := range syncRes {
+		if res.Error != nil {
+			t.Error("Unexpected result:", res)
+			return
+		}
+		written += res.BytesWritten
+	}
+
+	if diag = dgsnew.(DiagnosticStorage).Diagnostics(); written == 0 || diag.PendingTransactions != 0 {
+		t.Error("Unexpected result:", written, diag)
+		return
+	}
+
+	if syncRes = dgsnew.(LogStorage).Rollback(); len(syncRes) != 1 ||
+		syncRes[0].File != diskGraphStorageTestDBDir+"/store1.nodes" || syncRes[0].Error != nil {
+		t.Error("Unexpected result:", syncRes)
+		return
+	}
+
 	m := dgsnew.MainDB()
 	m["test1"] = "test1value"
 	dgsnew.FlushMain()
@@ -178,7 +259,8 @@ func TestDiskGraphStorageErrors(t *testing.T) {
 
 	FilenameNameDB = old
 
-	dgs := &DiskGraphStorage{invalidFileName, false, nil, make(map[string]storage.Manager)}
+	dgs := &DiskGraphStorage{invalidFileName, false, nil, make(map[string]storage.Manager), &sync.Mutex{},
+		&Diagnostics{}, &sync.Mutex{}}
 	pm, _ := datautil.NewPersistentMap(invalidFileName)
 	dgs.mainDB = pm
 
@@ -191,13 +273,157 @@ func TestDiskGraphStorageErrors(t *testing.T) {
 		return
 	}
 
+	storage.MsmRetFlush = errors.New("TestError")
+	storage.MsmRetRollback = errors.New("TestError")
+
+	if res := dgs.SyncLogs(true); len(res) != 1 || res[0].Error != storage.MsmRetFlush {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := dgs.Rollback(); len(res) != 1 || res[0].Error != storage.MsmRetRollback {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	storage.MsmRetFlush = nil
+	storage.MsmRetRollback = nil
+
 	if err := dgs.FlushMain(); err == nil {
 		t.Error("Unexpected flush result")
 		return
 	}
 
+	if diag := dgs.Diagnostics(); diag.LastError == nil || diag.LastErrorTime.IsZero() ||
+		!diag.LastFlush.IsZero() || diag.PendingTransactions != 0 {
+		t.Error("Unexpected result:", diag)
+		return
+	}
+
 	if err := dgs.Close(); err == nil {
 		t.Error("Unexpected close result")
 		return
 	}
 }
+
+func TestDiskGraphStorageBackup(t *testing.T) {
+	dgs, err := NewDiskGraphStorage(diskGraphStorageTestDBDir3, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var locs []uint64
+
+	for _, smname := range []string{"store1", "store2"} {
+		sm := dgs.StorageManager(smname, true)
+
+		loc, err := sm.Insert(smname + " value")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		sm.Flush()
+
+		locs = append(locs, loc)
+	}
+
+	dgs.MainDB()["test1"] = "test1value"
+	dgs.FlushMain()
+
+	dgs.Close()
+
+	// Only one storage manager is open when the backup is made
+
+	dgs, err = NewDiskGraphStorage(diskGraphStorageTestDBDir3, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	sm := dgs.StorageManager("store1", false)
+
+	if err := sm.Update(locs[0], "store1 new value"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	sm.Flush()
+
+	os.Mkdir(diskGraphStorageTestBackupDir, 0770)
+
+	files, err := dgs.(BackupStorage).Backup(diskGraphStorageTestBackupDir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := strings.Join(files, " "); !strings.Contains(res, FilenameNameDB) ||
+		!strings.Contains(res, "store1.db.0") || !strings.Contains(res, "store2.db.0") ||
+		strings.Contains(res, ".lck") {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	dgs.Close()
+
+	// Restore the backup into another storage
+
+	dgs, err = NewDiskGraphStorage(diskGraphStorageTestDBDir4, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	dgs.StorageManager("store3", true).Insert("store3 value")
+
+	if err := dgs.(BackupStorage).Restore(diskGraphStorageTestBackupDir); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := dgs.MainDB()["test1"]; res != "test1value" {
+		t.Error("Unexpected main database value:", res)
+		return
+	}
+
+	for i, expected := range []string{"store1 new value", "store2 value"} {
+		var res string
+
+		if err := dgs.StorageManager(fmt.Sprint("store", i+1), false).Fetch(locs[i], &res); err != nil || res != expected {
+			t.Error("Unexpected result:", res, err)
+			return
+		}
+	}
+
+	if sm := dgs.StorageManager("store3", false); sm != nil {
+		t.Error("Storage manager should have been removed")
+		return
+	}
+
+	// Check error cases
+
+	if _, err := dgs.(BackupStorage).Backup(invalidFileName); err == nil {
+		t.Error("Backup to an invalid directory should fail")
+		return
+	}
+
+	if err := dgs.(BackupStorage).Restore(invalidFileName); err == nil ||
+		err.(*util.GraphError).Type != util.ErrWriting {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	dgs.(*DiskGraphStorage).readonly = true
+
+	if err := dgs.(BackupStorage).Restore(diskGraphStorageTestBackupDir); err == nil ||
+		err.Error() != "GraphError: Failed write to readonly storage (Cannot restore storage)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	dgs.(*DiskGraphStorage).readonly = false
+
+	dgs.Close()
+}
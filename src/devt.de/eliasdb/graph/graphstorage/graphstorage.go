@@ -10,7 +10,11 @@
 
 package graphstorage
 
-import "devt.de/eliasdb/storage"
+import (
+	"time"
+
+	"devt.de/eliasdb/storage"
+)
 
 /*
 GraphStorage interface models the storage backend for a graph manager.
@@ -49,3 +53,69 @@ type GraphStorage interface {
 	*/
 	Close() error
 }
+
+/*
+Diagnostics contains information about the state of a graph storage.
+*/
+type Diagnostics struct {
+	Location            string    // Directory of the storage files (empty for memory-only storages)
+	PendingTransactions int       // Largest number of transactions in a transaction log which are not yet written to disk
+	LastFlush           time.Time // Time of the last successful flush (zero if there was none)
+	LastError           error     // Last error which was reported by a storage manager (nil if there was none)
+	LastErrorTime       time.Time // Time of the last error
+}
+
+/*
+DiagnosticStorage is implemented by graph storages which can report
+diagnostics about their state.
+*/
+type DiagnosticStorage interface {
+
+	/*
+		Diagnostics returns information about the state of the storage.
+	*/
+	Diagnostics() *Diagnostics
+}
+
+/*
+LogStorage is implemented by graph storages which keep transaction logs for
+their storage files.
+*/
+type LogStorage interface {
+
+	/*
+		SyncLogs writes the transaction logs of all storage files to the storage
+		files and starts new empty transaction logs. Pending changes of all
+		storage managers are flushed first if the flush flag is set. Returns the
+		result for each storage file.
+	*/
+	SyncLogs(flush bool) []*storage.SyncResult
+
+	/*
+		Rollback cancels the pending changes of all storage managers which have
+		not yet been written to a transaction log. Returns the result for each
+		storage manager.
+	*/
+	Rollback() []*storage.SyncResult
+}
+
+/*
+BackupStorage is implemented by graph storages which can copy their files to
+a directory and replace them with copied files.
+*/
+type BackupStorage interface {
+
+	/*
+		Backup copies all files of the storage to a given directory. Changes
+		which were not flushed are not part of the copy. Returns the names of
+		the copied files.
+	*/
+	Backup(dir string) ([]string, error)
+
+	/*
+		Restore replaces all files of the storage with the files of a given
+		directory. All storage managers are closed before the files are
+		replaced.
+	*/
+	Restore(dir string) error
+}
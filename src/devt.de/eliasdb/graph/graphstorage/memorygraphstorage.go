@@ -10,7 +10,11 @@
 
 package graphstorage
 
-import "devt.de/eliasdb/storage"
+import (
+	"sync"
+
+	"devt.de/eliasdb/storage"
+)
 
 /*
 MgsRetClose is the return value on successful close
@@ -34,6 +38,7 @@ type MemoryGraphStorage struct {
 	name            string                     // Name of the graph storage
 	mainDB          map[string]string          // Database storing names
 	storagemanagers map[string]storage.Manager // Map of StorageManagers
+	mutex           *sync.Mutex                // Mutex to protect the map of StorageManagers
 }
 
 /*
@@ -41,7 +46,7 @@ NewMemoryGraphStorage creates a new MemoryGraphStorage instance.
 */
 func NewMemoryGraphStorage(name string) GraphStorage {
 	return &MemoryGraphStorage{name, make(map[string]string),
-		make(map[string]storage.Manager)}
+		make(map[string]storage.Manager), &sync.Mutex{}}
 }
 
 /*
@@ -77,6 +82,8 @@ StorageManager gets a storage manager with a certain name. A non-existing
 StorageManager is created automatically if the create flag is set to true.
 */
 func (mgs *MemoryGraphStorage) StorageManager(smname string, create bool) storage.Manager {
+	mgs.mutex.Lock()
+	defer mgs.mutex.Unlock()
 
 	sm, ok := mgs.storagemanagers[smname]
 
@@ -94,3 +101,11 @@ Close closes the storage.
 func (mgs *MemoryGraphStorage) Close() error {
 	return MgsRetClose
 }
+
+/*
+Diagnostics returns information about the state of the storage. Memory-only
+storages have no location and no pending transactions.
+*/
+func (mgs *MemoryGraphStorage) Diagnostics() *Diagnostics {
+	return &Diagnostics{}
+}
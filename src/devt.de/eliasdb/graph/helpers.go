@@ -70,6 +70,12 @@ func (gm *Manager) checkItemGeneral(node data.Node, name string) error {
 	for attr := range node.Data() {
 		if attr == "" {
 			return &util.GraphError{Type: util.ErrInvalidData, Detail: name + " contains empty string attribute name"}
+		} else if err := gm.validateAttr(attr); err != nil {
+			return &util.GraphError{
+				Type:   util.ErrInvalidData,
+				Detail: fmt.Sprintf("%v attribute %q is invalid: %v", name, attr, err),
+				Cause:  err,
+			}
 		}
 	}
 
@@ -126,6 +132,12 @@ func (gm *Manager) checkEdge(edge data.Edge) error {
 		return &util.GraphError{Type: util.ErrInvalidData, Detail: "Edge is missing a cascading value for end2"}
 	}
 
+	if undirected := edge.Attr(data.EdgeUndirected); undirected != nil {
+		if _, ok := undirected.(bool); !ok {
+			return &util.GraphError{Type: util.ErrInvalidData, Detail: "Edge has an invalid undirected value"}
+		}
+	}
+
 	return nil
 }
 
@@ -133,34 +145,258 @@ func (gm *Manager) checkEdge(edge data.Edge) error {
 writeNodeCount writes a new node count for a specific kind to the datastore.
 */
 func (gm *Manager) writeNodeCount(kind string, count uint64, flush bool) error {
+	return gm.writeCount(MainDBNodeCount+kind, count, flush)
+}
+
+/*
+writeEdgeCount writes a new edge count for a specific kind to the datastore.
+*/
+func (gm *Manager) writeEdgeCount(kind string, count uint64, flush bool) error {
+	return gm.writeCount(MainDBEdgeCount+kind, count, flush)
+}
+
+/*
+addNodeCount adds a given value to the node count of a specific kind and to
+the node count of the kind in a partition.
+*/
+func (gm *Manager) addNodeCount(part string, kind string, diff int, flush bool) error {
+	gm.addPartitionCount(partitionCountEntry(MainDBPartNodeCount, part, kind), diff)
+	return gm.addCount(MainDBNodeCount+kind, diff, flush)
+}
+
+/*
+addEdgeCount adds a given value to the edge count of a specific kind and to
+the edge count of the kind in a partition.
+*/
+func (gm *Manager) addEdgeCount(part string, kind string, diff int, flush bool) error {
+	gm.addPartitionCount(partitionCountEntry(MainDBPartEdgeCount, part, kind), diff)
+	return gm.addCount(MainDBEdgeCount+kind, diff, flush)
+}
+
+/*
+partitionCountEntry returns the main database entry of the count of a kind in
+a partition.
+*/
+func partitionCountEntry(prefix string, part string, kind string) string {
+	return prefix + part + "/" + kind
+}
+
+/*
+readCount reads a count from the main database.
+*/
+func (gm *Manager) readCount(entry string) uint64 {
+	count, _ := gm.readPartitionCount(entry)
+	return count
+}
+
+/*
+readPartitionCount reads a count from the main database. Returns false if the
+count does not exist.
+*/
+func (gm *Manager) readPartitionCount(entry string) (uint64, bool) {
+	gm.mainLock.RLock()
+	defer gm.mainLock.RUnlock()
+
+	if val, ok := gm.gs.MainDB()[entry]; ok {
+		return binary.LittleEndian.Uint64([]byte(val)), true
+	}
+
+	return 0, false
+}
+
+/*
+initPartitionCount creates a count of a kind in a partition when the storage
+of the kind is created. Counts of storages which were created before counts
+per partition were maintained do not exist.
+*/
+func (gm *Manager) initPartitionCount(entry string) {
+	gm.mainLock.Lock()
+	defer gm.mainLock.Unlock()
+
+	if _, ok := gm.gs.MainDB()[entry]; !ok {
+		gm.gs.MainDB()[entry] = string(make([]byte, 8, 8))
+	}
+}
+
+/*
+addPartitionCount atomically adds a given value to a count of a kind in a
+partition. Counts which do not exist are not changed.
+*/
+func (gm *Manager) addPartitionCount(entry string, diff int) {
 	numstr := make([]byte, 8)
 
+	gm.mainLock.Lock()
+	defer gm.mainLock.Unlock()
+
+	if val, ok := gm.gs.MainDB()[entry]; ok {
+		binary.LittleEndian.PutUint64(numstr, binary.LittleEndian.Uint64([]byte(val))+uint64(diff))
+		gm.gs.MainDB()[entry] = string(numstr)
+	}
+}
+
+/*
+writeCount writes a count to the main database.
+*/
+func (gm *Manager) writeCount(entry string, count uint64, flush bool) error {
+	numstr := make([]byte, 8)
 	binary.LittleEndian.PutUint64(numstr, count)
-	gm.gs.MainDB()[MainDBNodeCount+kind] = string(numstr)
+
+	gm.mainLock.Lock()
+	gm.gs.MainDB()[entry] = string(numstr)
+	gm.mainLock.Unlock()
 
 	if flush {
-		return gm.gs.FlushMain()
+		return gm.flushMain()
 	}
 
 	return nil
 }
 
 /*
-writeEdgeCount writes a new edge count for a specific kind to the datastore.
+addCount atomically adds a given value to a count in the main database.
 */
-func (gm *Manager) writeEdgeCount(kind string, count uint64, flush bool) error {
+func (gm *Manager) addCount(entry string, diff int, flush bool) error {
+	var count uint64
+
 	numstr := make([]byte, 8)
 
-	binary.LittleEndian.PutUint64(numstr, count)
-	gm.gs.MainDB()[MainDBEdgeCount+kind] = string(numstr)
+	gm.mainLock.Lock()
+
+	if val, ok := gm.gs.MainDB()[entry]; ok {
+		count = binary.LittleEndian.Uint64([]byte(val))
+	}
+
+	binary.LittleEndian.PutUint64(numstr, count+uint64(diff))
+	gm.gs.MainDB()[entry] = string(numstr)
+
+	gm.mainLock.Unlock()
 
 	if flush {
-		return gm.gs.FlushMain()
+		return gm.flushMain()
 	}
 
 	return nil
 }
 
+/*
+flushMain flushes the main database.
+*/
+func (gm *Manager) flushMain() error {
+	if err := gm.checkOpen(); err != nil {
+		return err
+	}
+
+	gm.mainLock.Lock()
+	defer gm.mainLock.Unlock()
+
+	return gm.gs.FlushMain()
+}
+
+/*
+rollbackMain rollbacks the main database.
+*/
+func (gm *Manager) rollbackMain() error {
+	gm.mainLock.Lock()
+	defer gm.mainLock.Unlock()
+
+	return gm.gs.RollbackMain()
+}
+
+/*
+encode32 encodes a given value as a 32 bit string.
+*/
+func (gm *Manager) encode32(val string, create bool) string {
+	unlock := gm.lockNames(create)
+	defer unlock()
+
+	return gm.nm.Encode32(val, create)
+}
+
+/*
+decode32 decodes a given 32 bit string to a value.
+*/
+func (gm *Manager) decode32(val string) string {
+	unlock := gm.lockNames(false)
+	defer unlock()
+
+	return gm.nm.Decode32(val)
+}
+
+/*
+encode16 encodes a given value as a 16 bit string.
+*/
+func (gm *Manager) encode16(val string, create bool) string {
+	unlock := gm.lockNames(create)
+	defer unlock()
+
+	return gm.nm.Encode16(val, create)
+}
+
+/*
+decode16 decodes a given 16 bit string to a value.
+*/
+func (gm *Manager) decode16(val string) string {
+	unlock := gm.lockNames(false)
+	defer unlock()
+
+	return gm.nm.Decode16(val)
+}
+
+/*
+lockNames takes the lock of the main database which stores the names. The
+writer lock is taken if names may be created.
+*/
+func (gm *Manager) lockNames(write bool) func() {
+	if write {
+		gm.mainLock.Lock()
+		return gm.mainLock.Unlock
+	}
+
+	gm.mainLock.RLock()
+	return gm.mainLock.RUnlock
+}
+
+/*
+ensureMainDBEntries makes sure that the given lookup maps and the given count
+exist in the main database.
+*/
+func (gm *Manager) ensureMainDBEntries(count string, maps ...string) {
+	mdb := gm.gs.MainDB()
+
+	missing := func() bool {
+		for _, entry := range maps {
+			if _, ok := gm.mapCache[entry]; !ok {
+				if _, ok := mdb[entry]; !ok {
+					return true
+				}
+			}
+		}
+		_, ok := mdb[count]
+		return !ok
+	}
+
+	gm.mainLock.RLock()
+	isMissing := missing()
+	gm.mainLock.RUnlock()
+
+	if !isMissing {
+		return
+	}
+
+	gm.mainLock.Lock()
+	defer gm.mainLock.Unlock()
+
+	for _, entry := range maps {
+		if gm.mainDBMap(entry) == nil {
+			gm.setMainDBMap(entry, make(map[string]string))
+		}
+	}
+
+	if _, ok := mdb[count]; !ok {
+		mdb[count] = string(make([]byte, 8, 8))
+	}
+}
+
 /*
 getNodeStorageHTree gets two HTree instances which can be used to store nodes.
 This function ensures that depending entries in other datastructures do exist.
@@ -168,9 +404,11 @@ This function ensures that depending entries in other datastructures do exist.
 func (gm *Manager) getNodeStorageHTree(part string, kind string,
 	create bool) (*hash.HTree, *hash.HTree, error) {
 
-	// Check if the partition name is valid
+	// Check if the storage can be accessed and if the partition name is valid
 
-	if err := gm.checkPartitionName(part); err != nil {
+	if err := gm.checkOpen(); err != nil {
+		return nil, nil, err
+	} else if err := gm.checkPartitionName(part); err != nil {
 		return nil, nil, err
 	}
 
@@ -185,29 +423,18 @@ func (gm *Manager) getNodeStorageHTree(part string, kind string,
 
 	// Make sure all required lookup maps are there
 
-	if gm.getMainDBMap(MainDBNodeKinds) == nil {
-		gm.storeMainDBMap(MainDBNodeKinds, make(map[string]string))
-	}
+	gm.ensureMainDBEntries(MainDBNodeCount+kind, MainDBNodeKinds, MainDBParts,
+		MainDBNodeAttrs+kind, MainDBNodeEdges+kind)
 
-	if gm.getMainDBMap(MainDBParts) == nil {
-		gm.storeMainDBMap(MainDBParts, make(map[string]string))
-	}
-
-	if gm.getMainDBMap(MainDBNodeAttrs+kind) == nil {
-		gm.storeMainDBMap(MainDBNodeAttrs+kind, make(map[string]string))
-	}
-
-	if gm.getMainDBMap(MainDBNodeEdges+kind) == nil {
-		gm.storeMainDBMap(MainDBNodeEdges+kind, make(map[string]string))
-	}
+	// Return the actual storage - a new storage starts with a node count
+	// of 0 in the partition
 
-	if _, ok := gm.gs.MainDB()[MainDBNodeCount+kind]; !ok {
-		gm.gs.MainDB()[MainDBNodeCount+kind] = string(make([]byte, 8, 8))
+	gs := gm.gs.StorageManager(part+kind+StorageSuffixNodes, false)
+	if gs == nil && create {
+		gm.initPartitionCount(partitionCountEntry(MainDBPartNodeCount, part, kind))
+		gs = gm.gs.StorageManager(part+kind+StorageSuffixNodes, true)
 	}
 
-	// Return the actual storage
-
-	gs := gm.gs.StorageManager(part+kind+StorageSuffixNodes, create)
 	if gs == nil {
 		return nil, nil, nil
 	}
@@ -231,9 +458,11 @@ entries in other datastructures do exist.
 */
 func (gm *Manager) getEdgeStorageHTree(part string, kind string, create bool) (*hash.HTree, error) {
 
-	// Check if the partition name is valid
+	// Check if the storage can be accessed and if the partition name is valid
 
-	if err := gm.checkPartitionName(part); err != nil {
+	if err := gm.checkOpen(); err != nil {
+		return nil, err
+	} else if err := gm.checkPartitionName(part); err != nil {
 		return nil, err
 	}
 
@@ -248,21 +477,17 @@ func (gm *Manager) getEdgeStorageHTree(part string, kind string, create bool) (*
 
 	// Make sure all required lookup maps are there
 
-	if gm.getMainDBMap(MainDBEdgeKinds) == nil {
-		gm.storeMainDBMap(MainDBEdgeKinds, make(map[string]string))
-	}
+	gm.ensureMainDBEntries(MainDBEdgeCount+kind, MainDBEdgeKinds, MainDBEdgeAttrs+kind)
 
-	if gm.getMainDBMap(MainDBEdgeAttrs+kind) == nil {
-		gm.storeMainDBMap(MainDBEdgeAttrs+kind, make(map[string]string))
-	}
+	// Return the actual storage - a new storage starts with an edge count
+	// of 0 in the partition
 
-	if _, ok := gm.gs.MainDB()[MainDBEdgeCount+kind]; !ok {
-		gm.gs.MainDB()[MainDBEdgeCount+kind] = string(make([]byte, 8, 8))
+	gs := gm.gs.StorageManager(part+kind+StorageSuffixEdges, false)
+	if gs == nil && create {
+		gm.initPartitionCount(partitionCountEntry(MainDBPartEdgeCount, part, kind))
+		gs = gm.gs.StorageManager(part+kind+StorageSuffixEdges, true)
 	}
 
-	// Return the actual storage
-
-	gs := gm.gs.StorageManager(part+kind+StorageSuffixEdges, create)
 	if gs == nil {
 		return nil, nil
 	}
@@ -289,9 +514,11 @@ getIndexHTree gets a HTree which can be used to index items.
 */
 func (gm *Manager) getIndexHTree(part string, kind string, create bool, name string, suffix string) (*hash.HTree, error) {
 
-	// Check if the partition name is valid
+	// Check if the storage can be accessed and if the partition name is valid
 
-	if err := gm.checkPartitionName(part); err != nil {
+	if err := gm.checkOpen(); err != nil {
+		return nil, err
+	} else if err := gm.checkPartitionName(part); err != nil {
 		return nil, err
 	}
 
@@ -312,13 +539,59 @@ func (gm *Manager) getIndexHTree(part string, kind string, create bool, name str
 	return gm.getHTree(gs, RootIDNodeHTree)
 }
 
+/*
+getNodeIndexManager gets an index manager which can be used to index nodes.
+*/
+func (gm *Manager) getNodeIndexManager(part string, kind string, create bool) (*util.IndexManager, error) {
+	return gm.getIndexManager(part, kind, create, "Node", StorageSuffixNodesIndex)
+}
+
+/*
+getEdgeIndexManager gets an index manager which can be used to index edges.
+*/
+func (gm *Manager) getEdgeIndexManager(part string, kind string, create bool) (*util.IndexManager, error) {
+	return gm.getIndexManager(part, kind, create, "Edge", StorageSuffixEdgesIndex)
+}
+
+/*
+getIndexManager gets an index manager which can be used to index items. If
+the index is currently rebuilt then all updates are also applied to the
+new index. Returns nil if indexing is disabled for the kind.
+*/
+func (gm *Manager) getIndexManager(part string, kind string, create bool, name string, suffix string) (*util.IndexManager, error) {
+
+	if gm.indexState(part, kind) == indexStateDisabled {
+		return nil, nil
+	}
+
+	iht, err := gm.getIndexHTree(part, kind, create, name, suffix)
+	if err != nil || iht == nil {
+		return nil, err
+	}
+
+	im := gm.newIndexManager(kind, iht)
+
+	sm := gm.gs.StorageManager(part+kind+suffix, false)
+
+	if sm.Root(RootIDIndexRebuild) != 0 {
+		rht, err := gm.getHTree(sm, RootIDIndexRebuild)
+		if err != nil {
+			return nil, err
+		}
+
+		im.SetMirror(gm.newIndexManager(kind, rht))
+	}
+
+	return im, nil
+}
+
 /*
 flushNodeStorage flushes a node storage.
 */
 func (gm *Manager) flushNodeStorage(part string, kind string) error {
 	if sm := gm.gs.StorageManager(part+kind+StorageSuffixNodes, false); sm != nil {
 		if err := sm.Flush(); err != nil {
-			return &util.GraphError{Type: util.ErrFlushing, Detail: err.Error()}
+			return &util.GraphError{Type: util.ErrFlushing, Detail: err.Error(), Cause: err}
 		}
 	}
 	return nil
@@ -330,7 +603,7 @@ flushNodeIndex flushes a node index.
 func (gm *Manager) flushNodeIndex(part string, kind string) error {
 	if sm := gm.gs.StorageManager(part+kind+StorageSuffixNodesIndex, false); sm != nil {
 		if err := sm.Flush(); err != nil {
-			return &util.GraphError{Type: util.ErrFlushing, Detail: err.Error()}
+			return &util.GraphError{Type: util.ErrFlushing, Detail: err.Error(), Cause: err}
 		}
 	}
 	return nil
@@ -342,7 +615,7 @@ flushEdgeStorage flushes an edge storage.
 func (gm *Manager) flushEdgeStorage(part string, kind string) error {
 	if sm := gm.gs.StorageManager(part+kind+StorageSuffixEdges, false); sm != nil {
 		if err := sm.Flush(); err != nil {
-			return &util.GraphError{Type: util.ErrFlushing, Detail: err.Error()}
+			return &util.GraphError{Type: util.ErrFlushing, Detail: err.Error(), Cause: err}
 		}
 	}
 	return nil
@@ -354,7 +627,7 @@ flushEdgeIndex flushes an edge index.
 func (gm *Manager) flushEdgeIndex(part string, kind string) error {
 	if sm := gm.gs.StorageManager(part+kind+StorageSuffixEdgesIndex, false); sm != nil {
 		if err := sm.Flush(); err != nil {
-			return &util.GraphError{Type: util.ErrFlushing, Detail: err.Error()}
+			return &util.GraphError{Type: util.ErrFlushing, Detail: err.Error(), Cause: err}
 		}
 	}
 	return nil
@@ -366,7 +639,7 @@ rollbackNodeStorage rollbacks a node storage.
 func (gm *Manager) rollbackNodeStorage(part string, kind string) error {
 	if sm := gm.gs.StorageManager(part+kind+StorageSuffixNodes, false); sm != nil {
 		if err := sm.Rollback(); err != nil {
-			return &util.GraphError{Type: util.ErrRollback, Detail: err.Error()}
+			return &util.GraphError{Type: util.ErrRollback, Detail: err.Error(), Cause: err}
 		}
 	}
 	return nil
@@ -378,7 +651,7 @@ rollbackNodeIndex rollbacks a node index.
 func (gm *Manager) rollbackNodeIndex(part string, kind string) error {
 	if sm := gm.gs.StorageManager(part+kind+StorageSuffixNodesIndex, false); sm != nil {
 		if err := sm.Rollback(); err != nil {
-			return &util.GraphError{Type: util.ErrRollback, Detail: err.Error()}
+			return &util.GraphError{Type: util.ErrRollback, Detail: err.Error(), Cause: err}
 		}
 	}
 	return nil
@@ -390,7 +663,7 @@ rollbackEdgeStorage rollbacks an edge storage.
 func (gm *Manager) rollbackEdgeStorage(part string, kind string) error {
 	if sm := gm.gs.StorageManager(part+kind+StorageSuffixEdges, false); sm != nil {
 		if err := sm.Rollback(); err != nil {
-			return &util.GraphError{Type: util.ErrRollback, Detail: err.Error()}
+			return &util.GraphError{Type: util.ErrRollback, Detail: err.Error(), Cause: err}
 		}
 	}
 	return nil
@@ -402,12 +675,34 @@ rollbackEdgeIndex rollbacks an edge index.
 func (gm *Manager) rollbackEdgeIndex(part string, kind string) error {
 	if sm := gm.gs.StorageManager(part+kind+StorageSuffixEdgesIndex, false); sm != nil {
 		if err := sm.Rollback(); err != nil {
-			return &util.GraphError{Type: util.ErrRollback, Detail: err.Error()}
+			return &util.GraphError{Type: util.ErrRollback, Detail: err.Error(), Cause: err}
 		}
 	}
 	return nil
 }
 
+/*
+decodeSpec decodes an encoded edge spec.
+*/
+func (gm *Manager) decodeSpec(encspec string) string {
+	role1 := gm.decode16(encspec[:2])
+	relKind := gm.decode16(encspec[2:4])
+	role2 := gm.decode16(encspec[4:6])
+	end2Kind := gm.decode16(encspec[6:])
+
+	return role1 + ":" + relKind + ":" + role2 + ":" + end2Kind
+}
+
+/*
+encodeSpec encodes an edge spec.
+*/
+func (gm *Manager) encodeSpec(spec string, create bool) string {
+	sspec := strings.Split(spec, ":")
+
+	return gm.encode16(sspec[0], create) + gm.encode16(sspec[1], create) +
+		gm.encode16(sspec[2], create) + gm.encode16(sspec[3], create)
+}
+
 /*
 getHTree creates or loads a HTree from a given StorageManager. HTrees are not cached
 since the creation shouldn't have too much overhead.
@@ -425,7 +720,7 @@ func (gm *Manager) getHTree(sm storage.Manager, slot int) (*hash.HTree, error) {
 		htree, err = hash.NewHTree(sm)
 
 		if err != nil {
-			err = &util.GraphError{Type: util.ErrAccessComponent, Detail: err.Error()}
+			err = &util.GraphError{Type: util.ErrAccessComponent, Detail: err.Error(), Cause: err}
 		} else {
 			sm.SetRoot(slot, htree.Location())
 		}
@@ -436,7 +731,7 @@ func (gm *Manager) getHTree(sm storage.Manager, slot int) (*hash.HTree, error) {
 
 		htree, err = hash.LoadHTree(sm, loc)
 		if err != nil {
-			err = &util.GraphError{Type: util.ErrAccessComponent, Detail: err.Error()}
+			err = &util.GraphError{Type: util.ErrAccessComponent, Detail: err.Error(), Cause: err}
 		}
 	}
 
@@ -444,12 +739,110 @@ func (gm *Manager) getHTree(sm storage.Manager, slot int) (*hash.HTree, error) {
 }
 
 /*
-getMainDBMap gets a map from the main database.
+readVersion reads the version of a node or edge. Returns 0 if the item was
+never written.
+*/
+func (gm *Manager) readVersion(key string, valTree *hash.HTree) (uint64, error) {
+	obj, err := valTree.Get([]byte(PrefixNSVersion + key))
+	if err != nil {
+		return 0, &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
+	} else if obj == nil {
+		return 0, nil
+	}
+
+	return obj.(uint64), nil
+}
+
+/*
+writeVersion assigns a new version to a node or edge. Versions are taken from
+a global sequence so a removed and re-created item never reuses a version.
+*/
+func (gm *Manager) writeVersion(key string, valTree *hash.HTree) error {
+	var version uint64
+
+	gm.mainLock.Lock()
+
+	if val, ok := gm.gs.MainDB()[MainDBItemVersion]; ok {
+		version = binary.LittleEndian.Uint64([]byte(val))
+	}
+
+	version++
+
+	numstr := make([]byte, 8)
+	binary.LittleEndian.PutUint64(numstr, version)
+	gm.gs.MainDB()[MainDBItemVersion] = string(numstr)
+
+	gm.mainLock.Unlock()
+
+	if _, err := valTree.Put([]byte(PrefixNSVersion+key), version); err != nil {
+		return &util.GraphError{Type: util.ErrWriting, Detail: err.Error(), Cause: err}
+	}
+
+	return nil
+}
+
+/*
+getMainDBMap gets a map from the main database. The returned map must not be
+modified - use updateMainDBMap to change a map.
 */
 func (gm *Manager) getMainDBMap(key string) map[string]string {
 
 	// First try to cache
 
+	gm.mainLock.RLock()
+	mapval, ok := gm.mapCache[key]
+	gm.mainLock.RUnlock()
+
+	if ok {
+		return mapval
+	}
+
+	gm.mainLock.Lock()
+	defer gm.mainLock.Unlock()
+
+	return gm.mainDBMap(key)
+}
+
+/*
+storeMainDBMap stores a map in the main database. The map is stored as a gob byte slice.
+Once it has been decoded it is cached for read operations.
+*/
+func (gm *Manager) storeMainDBMap(key string, mapval map[string]string) {
+	gm.mainLock.Lock()
+	defer gm.mainLock.Unlock()
+
+	gm.setMainDBMap(key, mapval)
+}
+
+/*
+updateMainDBMap atomically updates a map in the main database. The given
+function gets a copy of the stored map (nil if the map does not exist) and
+returns the map which should be stored or nil if nothing was changed.
+*/
+func (gm *Manager) updateMainDBMap(key string, update func(map[string]string) map[string]string) {
+	var mapcopy map[string]string
+
+	gm.mainLock.Lock()
+	defer gm.mainLock.Unlock()
+
+	if mapval := gm.mainDBMap(key); mapval != nil {
+		mapcopy = make(map[string]string, len(mapval)+1)
+		for k, v := range mapval {
+			mapcopy[k] = v
+		}
+	}
+
+	if mapval := update(mapcopy); mapval != nil {
+		gm.setMainDBMap(key, mapval)
+	}
+}
+
+/*
+mainDBMap looks up a map in the map cache or decodes it from the main
+database. It is assumed that the caller holds the writer lock of the main
+database.
+*/
+func (gm *Manager) mainDBMap(key string) map[string]string {
 	mapval, ok := gm.mapCache[key]
 	if ok {
 		return mapval
@@ -467,10 +860,10 @@ func (gm *Manager) getMainDBMap(key string) map[string]string {
 }
 
 /*
-storeMainDBMap stores a map in the main database. The map is stored as a gob byte slice.
-Once it has been decoded it is cached for read operations.
+setMainDBMap stores a map in the main database and the map cache. It is
+assumed that the caller holds the writer lock of the main database.
 */
-func (gm *Manager) storeMainDBMap(key string, mapval map[string]string) {
+func (gm *Manager) setMainDBMap(key string, mapval map[string]string) {
 	gm.mapCache[key] = mapval
 	gm.gs.MainDB()[key] = mapToString(mapval)
 }
@@ -492,6 +885,26 @@ func IsFullSpec(spec string) bool {
 	return true
 }
 
+/*
+matchSpec checks if a given full spec matches a given (split) partial spec.
+Empty components of the partial spec match everything.
+*/
+func matchSpec(sspec []string, spec string) bool {
+	mspec := strings.Split(spec, ":")
+
+	// Check spec components
+
+	if (sspec[0] != "" && mspec[0] != sspec[0]) ||
+		(sspec[1] != "" && mspec[1] != sspec[1]) ||
+		(sspec[2] != "" && mspec[2] != sspec[2]) ||
+		(sspec[3] != "" && mspec[3] != sspec[3]) {
+
+		return false
+	}
+
+	return true
+}
+
 /*
 mapToString turns a map of strings into a single string.
 */
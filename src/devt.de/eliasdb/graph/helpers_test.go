@@ -298,11 +298,20 @@ func TestSanityChecks(t *testing.T) {
 		return
 	}
 
-	if cnt := len(gs.MainDB()); cnt != 11 {
+	if cnt := len(gs.MainDB()); cnt != 13 {
 		t.Error("Unexpected number of main db entries:", cnt)
 		return
 	}
 
+	if _, ok := gs.MainDB()[MainDBPartNodeCount+"mypart/mykind"]; !ok {
+		t.Error("Missing main db entry")
+		return
+	}
+	if _, ok := gs.MainDB()[MainDBPartEdgeCount+"mypart/mykind"]; !ok {
+		t.Error("Missing main db entry")
+		return
+	}
+
 	if _, ok := gs.MainDB()[MainDBNodeAttrs+"mykind"]; !ok {
 		t.Error("Missing main db entry")
 		return
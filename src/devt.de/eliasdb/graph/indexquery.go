@@ -10,6 +10,8 @@
 
 package graph
 
+import "devt.de/eliasdb/graph/util"
+
 /*
 IndexQuery models the interface to the full text search index.
 */
@@ -28,6 +30,14 @@ type IndexQuery interface {
 	*/
 	LookupWord(attr, word string) (map[string][]uint64, error)
 
+	/*
+		LookupWordFuzzy finds all words of an attribute which are within a
+		given Levenshtein distance of a given word. The distance is capped at
+		util.MaxFuzzyDistance. This call returns a list of matches which is
+		sorted by distance and word.
+	*/
+	LookupWordFuzzy(attr, word string, maxDist int) ([]*util.FuzzyMatch, error)
+
 	/*
 		LookupValue finds all nodes where an attribute has a certain value.
 		This call returns a list of node keys.
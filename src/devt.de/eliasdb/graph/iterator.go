@@ -11,17 +11,30 @@
 package graph
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	"devt.de/eliasdb/graph/util"
 	"devt.de/eliasdb/hash"
 )
 
 /*
 NodeKeyIterator can be used to iterate node keys of a certain node kind.
+
+Keys may be skipped or returned twice if nodes of the kind are inserted or
+removed while iterating. The iterator detects such modifications and sets
+LastError to an ErrConcurrentModification error instead of returning further
+keys. Setting IgnoreModifications disables the check.
 */
 type NodeKeyIterator struct {
-	gm        *Manager            // GraphManager which created the iterator
-	it        *hash.HTreeIterator // Internal HTree iterator
-	LastError error               // Last encountered error
+	gm                  *Manager            // GraphManager which created the iterator
+	part                string              // Partition which is iterated
+	kind                string              // Kind which is iterated
+	modCount            uint64              // Modification counter when the iterator was created
+	it                  *hash.HTreeIterator // Internal HTree iterator
+	IgnoreModifications bool                // Flag if concurrent modifications should be ignored
+	LastError           error               // Last encountered error
 }
 
 /*
@@ -31,13 +44,21 @@ func (it *NodeKeyIterator) Next() string {
 
 	// Take reader lock
 
-	it.gm.mutex.RLock()
-	defer it.gm.mutex.RUnlock()
+	defer it.gm.readLock(it.part)()
+
+	if !it.IgnoreModifications && it.gm.mc.get(it.part, it.kind) != it.modCount {
+		it.LastError = &util.GraphError{
+			Type: util.ErrConcurrentModification,
+			Detail: fmt.Sprintf("Nodes of kind %v in partition %v were modified during the iteration",
+				it.kind, it.part),
+		}
+		return ""
+	}
 
 	k, _ := it.it.Next()
 
 	if it.it.LastError != nil {
-		it.LastError = &util.GraphError{Type: util.ErrReading, Detail: it.it.LastError.Error()}
+		it.LastError = &util.GraphError{Type: util.ErrReading, Detail: it.it.LastError.Error(), Cause: it.it.LastError}
 		return ""
 	} else if len(k) == 0 {
 		return ""
@@ -52,3 +73,279 @@ HasNext returns if there is a next node key.
 func (it *NodeKeyIterator) HasNext() bool {
 	return it.it.HasNext()
 }
+
+/*
+SortedNodeKeyIterator can be used to iterate node keys of a certain node kind
+in lexicographic order.
+
+Node keys are stored in a hash tree which has no key order. The iterator
+collects the next SortedIterationChunkSize keys with a full scan of the tree
+for every chunk - memory usage is bounded by the chunk size but iterating n
+keys needs about n / SortedIterationChunkSize scans of all keys while a
+NodeKeyIterator needs a single scan. Keys which are added or removed during
+the iteration are only seen if they sort after the last returned key.
+*/
+type SortedNodeKeyIterator struct {
+	gm        *Manager    // GraphManager which created the iterator
+	part      string      // Partition which is iterated
+	tree      *hash.HTree // HTree which stores the nodes
+	chunk     []string    // Current chunk of sorted keys
+	lastKey   string      // Last key which was added to a chunk
+	fromKey   string      // Smallest key which is returned
+	started   bool        // Flag if the first chunk was collected
+	done      bool        // Flag if all keys have been collected
+	LastError error       // Last encountered error
+}
+
+/*
+SortedIterationChunkSize is the number of keys which a SortedNodeKeyIterator
+collects with a single scan.
+*/
+var SortedIterationChunkSize = 1000
+
+/*
+Next returns the next node key. Sets the LastError attribute if an error occurs.
+*/
+func (it *SortedNodeKeyIterator) Next() string {
+
+	if !it.HasNext() {
+		return ""
+	}
+
+	key := it.chunk[0]
+	it.chunk = it.chunk[1:]
+
+	return key
+}
+
+/*
+Seek positions the iterator so that the next returned key is the smallest
+key which is greater or equal to a given key. Keys before the given key are
+skipped while the chunks are collected.
+*/
+func (it *SortedNodeKeyIterator) Seek(key string) {
+	it.chunk = nil
+	it.lastKey = ""
+	it.fromKey = key
+	it.started = false
+	it.done = false
+}
+
+/*
+HasNext returns if there is a next node key.
+*/
+func (it *SortedNodeKeyIterator) HasNext() bool {
+
+	if len(it.chunk) == 0 && !it.done && it.LastError == nil {
+		it.fetchChunk()
+	}
+
+	return len(it.chunk) > 0
+}
+
+/*
+fetchChunk collects the next chunk of keys which sort after the last key of
+the previous chunk.
+*/
+func (it *SortedNodeKeyIterator) fetchChunk() {
+
+	// Take reader lock
+
+	defer it.gm.readLock(it.part)()
+
+	hit := hash.NewHTreeIterator(it.tree)
+
+	var chunk []string
+
+	for hit.LastError == nil && hit.HasNext() {
+		k, _ := hit.Next()
+
+		// Edge trees also contain attribute values and versions
+
+		if len(k) == 0 || !strings.HasPrefix(string(k), PrefixNSAttrs) {
+			continue
+		}
+
+		key := string(k[len(PrefixNSAttrs):])
+
+		if (it.started && key <= it.lastKey) || key < it.fromKey {
+			continue
+		}
+
+		chunk = append(chunk, key)
+
+		// Only keep the smallest keys
+
+		if len(chunk) >= 2*SortedIterationChunkSize {
+			sort.Strings(chunk)
+			chunk = chunk[:SortedIterationChunkSize]
+		}
+	}
+
+	if hit.LastError != nil {
+		it.LastError = &util.GraphError{Type: util.ErrReading, Detail: hit.LastError.Error(), Cause: hit.LastError}
+		return
+	}
+
+	sort.Strings(chunk)
+
+	if len(chunk) > SortedIterationChunkSize {
+		chunk = chunk[:SortedIterationChunkSize]
+	}
+
+	it.done = len(chunk) < SortedIterationChunkSize
+
+	if len(chunk) > 0 {
+		it.lastKey = chunk[len(chunk)-1]
+	}
+
+	it.chunk = chunk
+	it.started = true
+}
+
+/*
+NodeDegreeIterator can be used to iterate nodes which have fewer edges
+matching a partial edge spec than a given limit. The edge counts are taken
+from the stored traversal information of the nodes.
+
+The iterator is best-effort: every node is checked again when it is returned
+but a node may gain edges at any time after Next has returned it.
+*/
+type NodeDegreeIterator struct {
+	gm        *Manager            // GraphManager which created the iterator
+	part      string              // Partition which is iterated
+	kinds     []string            // Node kinds which still need to be iterated
+	sspec     []string            // Partial edge spec which is counted
+	limit     int                 // Exclusive upper limit of the edge count
+	kind      string              // Node kind which is currently iterated
+	attTree   *hash.HTree         // HTree which stores the nodes of the current kind
+	tree      *hash.HTree         // HTree which stores the edges of the current kind
+	it        *hash.HTreeIterator // Internal HTree iterator of the current kind
+	nextKey   string              // Key of the next node
+	nextKind  string              // Kind of the next node
+	LastError error               // Last encountered error
+}
+
+/*
+Next returns the key and the kind of the next node. Sets the LastError
+attribute if an error occurs.
+*/
+func (it *NodeDegreeIterator) Next() (string, string) {
+
+	// Take reader lock
+
+	defer it.gm.readLock(it.part)()
+
+	// A node which was fetched by HasNext must be checked again since it
+	// might have changed in the meantime
+
+	recheck := it.nextKey != ""
+
+	for it.nextKey != "" || it.fetchNext() {
+		key, kind := it.nextKey, it.nextKind
+		it.nextKey = ""
+
+		if !recheck {
+			return key, kind
+		}
+
+		attTree, tree, err := it.gm.getNodeStorageHTree(it.part, kind, false)
+		if err != nil {
+			it.LastError = err
+			return "", ""
+		} else if attTree != nil && tree != nil {
+			if ok, err := it.matches(key, attTree, tree); err != nil {
+				it.LastError = err
+				return "", ""
+			} else if ok {
+				return key, kind
+			}
+		}
+
+		recheck = false
+	}
+
+	return "", ""
+}
+
+/*
+HasNext returns if there is a next node.
+*/
+func (it *NodeDegreeIterator) HasNext() bool {
+
+	// Take reader lock
+
+	defer it.gm.readLock(it.part)()
+
+	return it.nextKey != "" || it.fetchNext()
+}
+
+/*
+fetchNext fetches the next matching node. It is assumed that the caller holds
+the reader lock.
+*/
+func (it *NodeDegreeIterator) fetchNext() bool {
+
+	for it.LastError == nil {
+
+		if it.it == nil || !it.it.HasNext() {
+
+			// Continue with the next kind
+
+			if len(it.kinds) == 0 {
+				return false
+			}
+
+			it.kind, it.kinds, it.it = it.kinds[0], it.kinds[1:], nil
+
+			attTree, tree, err := it.gm.getNodeStorageHTree(it.part, it.kind, false)
+			if err != nil {
+				it.LastError = err
+			} else if attTree != nil && tree != nil {
+				it.attTree, it.tree = attTree, tree
+				if it.it = hash.NewHTreeIterator(attTree); it.it.LastError != nil {
+					it.LastError = &util.GraphError{Type: util.ErrReading, Detail: it.it.LastError.Error(), Cause: it.it.LastError}
+				}
+			}
+
+			continue
+		}
+
+		k, _ := it.it.Next()
+
+		if it.it.LastError != nil {
+			it.LastError = &util.GraphError{Type: util.ErrReading, Detail: it.it.LastError.Error(), Cause: it.it.LastError}
+		} else if len(k) > 0 {
+			key := string(k[len(PrefixNSAttrs):])
+
+			if ok, err := it.matches(key, it.attTree, it.tree); err != nil {
+				it.LastError = err
+			} else if ok {
+				it.nextKey, it.nextKind = key, it.kind
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+/*
+matches checks if a given node exists and has fewer matching edges than the
+limit of this iterator.
+*/
+func (it *NodeDegreeIterator) matches(key string, attTree *hash.HTree, tree *hash.HTree) (bool, error) {
+
+	if ok, err := attTree.Exists([]byte(PrefixNSAttrs + key)); err != nil {
+		return false, &util.GraphError{Type: util.ErrReading, Detail: err.Error(), Cause: err}
+	} else if !ok {
+		return false, nil
+	}
+
+	count, err := it.gm.readNodeDegree(key, tree, it.sspec)
+	if err != nil {
+		return false, err
+	}
+
+	return count < it.limit, nil
+}
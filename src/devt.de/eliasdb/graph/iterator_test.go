@@ -11,10 +11,13 @@
 package graph
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 
 	"devt.de/eliasdb/graph/data"
 	"devt.de/eliasdb/graph/graphstorage"
+	"devt.de/eliasdb/graph/util"
 	"devt.de/eliasdb/storage"
 )
 
@@ -143,3 +146,382 @@ func TestNodeKeyIterator(t *testing.T) {
 		return
 	}
 }
+
+func TestNodeKeyIteratorModification(t *testing.T) {
+
+	mgs := graphstorage.NewMemoryGraphStorage("iterator test")
+	gm := NewGraphManager(mgs)
+
+	storeNode := func(key string, kind string) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", kind)
+
+		if err := gm.StoreNode("main", node); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Modify nodes from another goroutine
+
+	modify := func(f func()) {
+		var wg sync.WaitGroup
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f()
+		}()
+		wg.Wait()
+	}
+
+	for i := 0; i < 5; i++ {
+		storeNode(fmt.Sprint(i), "mykind")
+	}
+
+	ni, err := gm.NodeKeyIterator("main", "mykind")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if ni.Next(); ni.LastError != nil {
+		t.Error(ni.LastError)
+		return
+	}
+
+	// Updates of existing nodes and changes of other kinds are allowed
+
+	modify(func() {
+		storeNode("1", "mykind")
+		storeNode("1", "myotherkind")
+	})
+
+	if ni.Next(); ni.LastError != nil {
+		t.Error(ni.LastError)
+		return
+	}
+
+	// Inserting a node is detected
+
+	modify(func() {
+		storeNode("10", "mykind")
+	})
+
+	if key := ni.Next(); key != "" || ni.LastError == nil || ni.LastError.Error() !=
+		"GraphError: Concurrent modification (Nodes of kind mykind in partition main were modified during the iteration)" {
+		t.Error("Unexpected result:", key, ni.LastError)
+		return
+	}
+
+	if ni.LastError.(*util.GraphError).Type != util.ErrConcurrentModification {
+		t.Error("Unexpected error type:", ni.LastError)
+		return
+	}
+
+	// Removing a node and transactions are detected
+
+	for _, f := range []func(){
+		func() {
+			gm.RemoveNode("main", "10", "mykind")
+		},
+		func() {
+			trans := NewGraphTrans(gm)
+			node := data.NewGraphNode()
+			node.SetAttr("key", "11")
+			node.SetAttr("kind", "mykind")
+			trans.StoreNode("main", node)
+			trans.Commit()
+		},
+	} {
+		ni, _ = gm.NodeKeyIterator("main", "mykind")
+
+		modify(f)
+
+		if ni.Next(); ni.LastError == nil {
+			t.Error("Modification was not detected")
+			return
+		}
+	}
+
+	// The check can be disabled
+
+	ni, _ = gm.NodeKeyIterator("main", "mykind")
+	ni.IgnoreModifications = true
+
+	modify(func() {
+		storeNode("12", "mykind")
+	})
+
+	if key := ni.Next(); key == "" || ni.LastError != nil {
+		t.Error("Unexpected result:", key, ni.LastError)
+		return
+	}
+}
+
+func TestSortedNodeKeyIterator(t *testing.T) {
+
+	oldChunkSize := SortedIterationChunkSize
+	SortedIterationChunkSize = 5
+	defer func() {
+		SortedIterationChunkSize = oldChunkSize
+	}()
+
+	mgs := graphstorage.NewMemoryGraphStorage("iterator test")
+
+	gm := newGraphManagerNoRules(mgs)
+
+	storeNode := func(key string) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "mykind")
+
+		if err := gm.StoreNode("main", node); err != nil {
+			t.Error(err)
+		}
+	}
+
+	var expected []string
+
+	for i := 24; i >= 0; i-- {
+		storeNode(fmt.Sprintf("k%02d", i))
+		expected = append([]string{fmt.Sprintf("k%02d", i)}, expected...)
+	}
+
+	if it, err := gm.SortedNodeKeyIterator("main", "unknown"); it != nil || err != nil {
+		t.Error("Unexpected result:", it, err)
+		return
+	}
+
+	iterate := func(it *SortedNodeKeyIterator, f func(string)) string {
+		var res []string
+
+		for it.HasNext() {
+			key := it.Next()
+			if it.LastError != nil {
+				t.Error(it.LastError)
+			}
+			res = append(res, key)
+
+			if f != nil {
+				f(key)
+			}
+		}
+
+		return fmt.Sprint(res)
+	}
+
+	// The number of keys is a multiple of the chunk size
+
+	it, _ := gm.SortedNodeKeyIterator("main", "mykind")
+
+	if res := iterate(it, nil); res != fmt.Sprint(expected) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if it.Next() != "" || it.LastError != nil {
+		t.Error("Expected iterator to run out of items:", it.LastError)
+		return
+	}
+
+	// Keys which are added during the iteration are only seen if they sort
+	// after the last returned key
+
+	it, _ = gm.SortedNodeKeyIterator("main", "mykind")
+
+	res := iterate(it, func(key string) {
+		if key == "k12" {
+			storeNode("k05a")
+			storeNode("k30")
+		}
+	})
+
+	if res != fmt.Sprint(append(expected, "k30")) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Seeking skips all keys before a given key
+
+	it, _ = gm.SortedNodeKeyIterator("main", "mykind")
+
+	it.Seek("k21")
+
+	if res := iterate(it, nil); res != "[k21 k22 k23 k24 k30]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	it.Seek("k05")
+
+	if res := iterate(it, nil); res != "[k05 k05a k06 k07 k08 k09 k10 k11 k12 k13 k14 k15 k16 k17 k18 k19 k20 k21 k22 k23 k24 k30]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	it.Seek("k24a")
+
+	if res := iterate(it, nil); res != "[k30]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Test error case
+
+	it, _ = gm.SortedNodeKeyIterator("main", "mykind")
+
+	msm := mgs.StorageManager("main"+"mykind"+StorageSuffixNodes, false)
+
+	tree, _, _ := gm.getNodeStorageHTree("main", "mykind", false)
+	_, loc, _ := tree.GetValueAndLocation([]byte(PrefixNSAttrs + "k01"))
+
+	msm.(*storage.MemoryStorageManager).AccessMap[loc] = storage.AccessCacheAndFetchSeriousError
+
+	if it.HasNext() || it.Next() != "" || it.LastError == nil {
+		t.Error("Expected an error to occur")
+		return
+	}
+
+	delete(msm.(*storage.MemoryStorageManager).AccessMap, loc)
+}
+
+func TestNodeDegreeIterator(t *testing.T) {
+
+	mgs := graphstorage.NewMemoryGraphStorage("iterator test")
+
+	gm := NewGraphManager(mgs)
+
+	storeNode := func(key string, kind string) {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", kind)
+
+		if err := gm.StoreNode("main", node); err != nil {
+			t.Error(err)
+		}
+	}
+
+	storeEdge := func(key string, end1 string, end2 string, role2 string) {
+		edge := data.NewGraphEdge()
+
+		edge.SetAttr("key", key)
+		edge.SetAttr("kind", "myedge")
+
+		edge.SetAttr(data.EdgeEnd1Key, end1)
+		edge.SetAttr(data.EdgeEnd1Kind, "mykind")
+		edge.SetAttr(data.EdgeEnd1Role, "node1")
+		edge.SetAttr(data.EdgeEnd1Cascading, false)
+
+		edge.SetAttr(data.EdgeEnd2Key, end2)
+		edge.SetAttr(data.EdgeEnd2Kind, "mykind")
+		edge.SetAttr(data.EdgeEnd2Role, role2)
+		edge.SetAttr(data.EdgeEnd2Cascading, false)
+
+		if err := gm.StoreEdge("main", edge); err != nil {
+			t.Error(err)
+		}
+	}
+
+	iterate := func(it *NodeDegreeIterator) string {
+		var res []string
+
+		for it.HasNext() {
+			if key, kind := it.Next(); key != "" {
+				res = append(res, kind+":"+key)
+			}
+		}
+
+		if it.LastError != nil {
+			t.Error(it.LastError)
+		}
+
+		return fmt.Sprint(res)
+	}
+
+	storeNode("1", "mykind")
+	storeNode("2", "mykind")
+	storeNode("3", "mykind")
+	storeNode("4", "mykind")
+	storeNode("5", "mykind2")
+
+	storeEdge("a", "1", "2", "node2")
+	storeEdge("b", "1", "3", "node2")
+	storeEdge("c", "1", "2", "other")
+
+	if _, err := gm.OrphanNodeIterator("ma-in", nil); err == nil ||
+		err.Error() != "GraphError: Invalid data (Partition name ma-in is not alphanumeric - can only contain [a-zA-Z0-9_])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := gm.LowDegreeNodeIterator("main", nil, "::", 1); err == nil ||
+		err.Error() != "GraphError: Invalid data (Invalid spec: ::)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	it, _ := gm.OrphanNodeIterator("main", nil)
+	if res := iterate(it); res != "[mykind:4 mykind2:5]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	it, _ = gm.OrphanNodeIterator("main", []string{"mykind", "unknown"})
+	if res := iterate(it); res != "[mykind:4]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	it, _ = gm.LowDegreeNodeIterator("main", []string{"mykind"}, ":::", 2)
+	if res := iterate(it); res != "[mykind:3 mykind:4]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	it, _ = gm.LowDegreeNodeIterator("main", []string{"mykind"}, "node1:myedge:node2:mykind", 1)
+	if res := iterate(it); res != "[mykind:2 mykind:3 mykind:4]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	it, _ = gm.LowDegreeNodeIterator("main", []string{"mykind"}, "node2:::", 1)
+	if res := iterate(it); res != "[mykind:1 mykind:4]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Nodes are checked again if they changed after they were fetched
+
+	it, _ = gm.OrphanNodeIterator("main", []string{"mykind"})
+
+	if !it.HasNext() {
+		t.Error("Iterator should have a next item")
+		return
+	}
+
+	storeEdge("d", "3", "4", "node2")
+
+	if key, kind := it.Next(); key != "" || kind != "" || it.HasNext() {
+		t.Error("Unexpected result:", key, kind)
+		return
+	}
+
+	// Test error case
+
+	it, _ = gm.OrphanNodeIterator("main", []string{"mykind2"})
+
+	msm := mgs.StorageManager("main"+"mykind2"+StorageSuffixNodes, false)
+
+	tree, _, _ := gm.getNodeStorageHTree("main", "mykind2", false)
+	_, loc, _ := tree.GetValueAndLocation([]byte(PrefixNSAttrs + "5"))
+
+	msm.(*storage.MemoryStorageManager).AccessMap[loc] = storage.AccessCacheAndFetchSeriousError
+
+	if it.HasNext() || it.LastError == nil {
+		t.Error("Expected an error to occur")
+		return
+	}
+
+	delete(msm.(*storage.MemoryStorageManager).AccessMap, loc)
+}
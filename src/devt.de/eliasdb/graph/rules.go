@@ -26,6 +26,7 @@ type graphRulesManager struct {
 	gm       *Manager                // GraphManager which provides events
 	rules    map[string]Rule         // Map of graph rules
 	eventMap map[int]map[string]Rule // Map of events to graph rules
+	feed     *changeFeed             // Feed of committed changes
 }
 
 /*
@@ -56,6 +57,14 @@ graphEvent main event handler which receives all graph related events.
 func (gr *graphRulesManager) graphEvent(trans *Trans, event int, data ...interface{}) error {
 	var errors []string
 
+	// All events are about changes in a partition
+
+	gr.gm.stats.invalidate(data[0].(string))
+
+	// Record the change for the change feed
+
+	gr.feed.record(trans, event, data...)
+
 	rules, ok := gr.eventMap[event]
 
 	if ok {
@@ -89,10 +98,13 @@ func (gr *graphRulesManager) graphEvent(trans *Trans, event int, data ...interfa
 }
 
 /*
-Clone a given graph manager and insert a new RWMutex.
+Clone a given graph manager and insert new partition and global locks. The
+lock of the main database is shared.
 */
 func (gr *graphRulesManager) cloneGraphManager() *Manager {
-	return &Manager{gr.gm.gs, gr, gr.gm.nm, gr.gm.mapCache, &sync.RWMutex{}}
+	return &Manager{gr.gm.gs, gr, gr.gm.nm, gr.gm.mapCache, gr.gm.stats, gr.gm.mainLock,
+		newPartitionLocks(), gr.gm.ia, gr.gm.av, gr.gm.mc,
+		gr.gm.closed, gr.gm.bl, &sync.RWMutex{}}
 }
 
 /*
@@ -220,22 +232,22 @@ func (r *SystemRuleUpdateNodeStats) Handle(gm *Manager, trans *Trans, event int,
 	if event == EventEdgeCreated {
 		edge := ed[1].(data.Edge)
 
-		updateNodeRels := func(key string, kind string) {
-			spec := edge.Spec(key)
-			specs := gm.getMainDBMap(MainDBNodeEdges + kind)
-
-			if specs != nil {
-				if _, ok := specs[spec]; !ok {
+		updateNodeRels := func(kind string, end1 bool) {
+			for _, spec := range edgeEndSpecs(edge, end1) {
+				gm.updateMainDBMap(MainDBNodeEdges+kind, func(specs map[string]string) map[string]string {
+					if _, ok := specs[spec]; specs == nil || ok {
+						return nil
+					}
 					specs[spec] = ""
-					gm.storeMainDBMap(MainDBNodeEdges+kind, specs)
-				}
+					return specs
+				})
 			}
 		}
 
 		// Update stored relationships for both ends
 
-		updateNodeRels(edge.End1Key(), edge.End1Kind())
-		updateNodeRels(edge.End2Key(), edge.End2Kind())
+		updateNodeRels(edge.End1Kind(), true)
+		updateNodeRels(edge.End2Kind(), false)
 
 		attrMap = MainDBEdgeAttrs
 	}
@@ -249,11 +261,13 @@ func (r *SystemRuleUpdateNodeStats) Handle(gm *Manager, trans *Trans, event int,
 		part := ed[0].(string)
 
 		updateMainDB := func(entry string, val string) {
-			vals := gm.getMainDBMap(entry)
-			if _, ok := vals[val]; !ok {
+			gm.updateMainDBMap(entry, func(vals map[string]string) map[string]string {
+				if _, ok := vals[val]; vals == nil || ok {
+					return nil
+				}
 				vals[val] = ""
-				gm.storeMainDBMap(entry, vals)
-			}
+				return vals
+			})
 		}
 
 		updateMainDB(MainDBParts, part)
@@ -265,11 +279,12 @@ func (r *SystemRuleUpdateNodeStats) Handle(gm *Manager, trans *Trans, event int,
 		}
 	}
 
-	storeAttrs := false
-
-	attrs := gm.getMainDBMap(attrMap + kind)
+	gm.updateMainDBMap(attrMap+kind, func(attrs map[string]string) map[string]string {
+		storeAttrs := false
 
-	if attrs != nil {
+		if attrs == nil {
+			return nil
+		}
 
 		// Update stored node attributes
 
@@ -282,10 +297,12 @@ func (r *SystemRuleUpdateNodeStats) Handle(gm *Manager, trans *Trans, event int,
 
 		// Store attribute map if something was changed
 
-		if storeAttrs {
-			gm.storeMainDBMap(attrMap+kind, attrs)
+		if !storeAttrs {
+			return nil
 		}
-	}
+
+		return attrs
+	})
 
 	return nil
 }
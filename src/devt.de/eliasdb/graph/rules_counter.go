@@ -0,0 +1,309 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/util"
+)
+
+// Counter rule CounterRule
+// ========================
+
+/*
+Counter models a counter attribute which is maintained by a CounterRule. The
+counter holds the number of edges of a certain kind which are connected to a
+node at a certain end.
+*/
+type Counter struct {
+	EdgeKind string // Kind of the counted edges
+	End1     bool   // Flag if the counter is kept on the end1 node (otherwise on the end2 node)
+	Attr     string // Attribute of the target node which holds the counter
+}
+
+/*
+String returns a string representation of this counter.
+*/
+func (c *Counter) String() string {
+	end := "end2"
+	if c.End1 {
+		end = "end1"
+	}
+	return fmt.Sprintf("%v:%v -> %v", c.EdgeKind, end, c.Attr)
+}
+
+/*
+CounterRule is a graph rule which maintains counter attributes on nodes. The
+counter of a node is incremented when a matching edge is created and
+decremented when a matching edge is removed. Updates of existing edges do not
+change any counters since the endpoints of an edge cannot be changed.
+
+The counters are written as node updates. Node events are not handled by this
+rule so the updates cannot trigger the rule again. Counters can drift if nodes
+are overwritten without their counter attribute - Rebuild recomputes all
+counters from the stored edges.
+*/
+type CounterRule struct {
+	name     string     // Name of the rule
+	counters []*Counter // Maintained counters
+}
+
+/*
+NewCounterRule creates a new counter rule with a given name which maintains
+the given counters.
+*/
+func NewCounterRule(name string, counters ...*Counter) *CounterRule {
+	return &CounterRule{name, counters}
+}
+
+/*
+Name returns the name of the rule.
+*/
+func (r *CounterRule) Name() string {
+	return r.name
+}
+
+/*
+Handles returns a list of events which are handled by this rule.
+*/
+func (r *CounterRule) Handles() []int {
+	return []int{EventEdgeCreated, EventEdgeDeleted}
+}
+
+/*
+Handle handles an event.
+*/
+func (r *CounterRule) Handle(gm *Manager, trans *Trans, event int, ed ...interface{}) error {
+	part := ed[0].(string)
+	edge := ed[1].(data.Edge)
+
+	delta := int64(1)
+	if event == EventEdgeDeleted {
+		delta = -1
+	}
+
+	for _, c := range r.counters {
+
+		if c.EdgeKind != edge.Kind() {
+			continue
+		}
+
+		key, kind := edge.End2Key(), edge.End2Kind()
+		if c.End1 {
+			key, kind = edge.End1Key(), edge.End1Kind()
+		}
+
+		if err := r.addToCounter(gm, trans, part, key, kind, c.Attr, delta); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+addToCounter adds a given delta to the counter attribute of a given node. The
+update is written directly to the given transaction - the transaction may be
+in the middle of a commit and its graph manager locks are already held.
+Pending changes of the transaction are taken into account.
+*/
+func (r *CounterRule) addToCounter(gm *Manager, trans *Trans, part string, key string,
+	kind string, attr string, delta int64) error {
+
+	tkey := trans.createKey(part, key, kind)
+
+	node, ok := trans.storeNodes[tkey]
+
+	if _, removed := trans.removeNodes[tkey]; removed {
+		return nil
+	} else if !ok {
+		var err error
+
+		if node, err = gm.FetchNode(part, key, kind); err != nil {
+			return err
+		}
+	}
+
+	if node == nil {
+
+		// The node was removed - there is nothing to count
+
+		return nil
+	}
+
+	var count int64
+
+	if val := node.Attr(attr); val != nil {
+		var err error
+
+		if count, err = data.ToInt64(val); err != nil {
+			return &util.GraphError{
+				Type:   util.ErrInvalidData,
+				Detail: fmt.Sprintf("Counter %v of node %v (%v) is not a number", attr, key, kind),
+				Cause:  err,
+			}
+		}
+	}
+
+	node = data.NodeMerge(node, data.NewGraphNodeFromMap(map[string]interface{}{
+		attr: count + delta,
+	}))
+
+	trans.applyOp(&transOp{transOpStoreNode, tkey, node})
+
+	return nil
+}
+
+/*
+Rebuild recomputes all counters of this rule in a given partition from the
+stored edges and corrects the counter attributes of all nodes which have
+drifted. Returns the number of corrected nodes. The rebuild should not run
+concurrently with changes to the counted edges.
+*/
+func (r *CounterRule) Rebuild(gm *Manager, part string) (int, error) {
+
+	// Count the edges of all counters - counts maps node kind to node key to
+	// counter attribute to count
+
+	counts := make(map[string]map[string]map[string]int64)
+	attrs := make(map[string]bool)
+
+	for _, c := range r.counters {
+		attrs[c.Attr] = true
+
+		if err := r.countEdges(gm, part, c, counts); err != nil {
+			return 0, err
+		}
+	}
+
+	// Compare the counts with the stored counters
+
+	trans := NewGraphTrans(gm)
+	corrected := 0
+
+	checkNode := func(key string, kind string, node data.Node) error {
+		update := data.NewGraphNode()
+
+		for attr := range attrs {
+			count := counts[kind][key][attr]
+			val := node.Attr(attr)
+
+			if val == nil && count == 0 {
+				continue
+			} else if stored, err := data.ToInt64(val); val != nil && err == nil && stored == count {
+				continue
+			}
+
+			update.SetAttr(attr, count)
+		}
+
+		if len(update.Data()) == 0 {
+			return nil
+		}
+
+		update.SetAttr(data.NodeKey, key)
+		update.SetAttr(data.NodeKind, kind)
+
+		corrected++
+
+		return trans.UpdateNode(part, update)
+	}
+
+	// Check all nodes which have a counter attribute or a count
+
+	for _, kind := range gm.NodeKinds() {
+
+		hasAttr := false
+		for _, attr := range gm.NodeAttrs(kind) {
+			hasAttr = hasAttr || attrs[attr]
+		}
+
+		if !hasAttr && len(counts[kind]) == 0 {
+			continue
+		}
+
+		it, err := gm.NodeKeyIterator(part, kind)
+		if err != nil {
+			return 0, err
+		} else if it == nil {
+			continue
+		}
+
+		for it.HasNext() {
+			key := it.Next()
+			if it.LastError != nil {
+				return 0, it.LastError
+			}
+
+			node, err := gm.FetchNode(part, key, kind)
+			if err != nil {
+				return 0, err
+			} else if node == nil {
+				continue
+			}
+
+			if err := checkNode(key, kind, node); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return corrected, trans.Commit()
+}
+
+/*
+countEdges counts the edges of a given counter in a given partition.
+*/
+func (r *CounterRule) countEdges(gm *Manager, part string, c *Counter,
+	counts map[string]map[string]map[string]int64) error {
+
+	if err := gm.checkPartitionName(part); err != nil {
+		return err
+	}
+
+	edgeTree, err := gm.existingHTree(part + c.EdgeKind + StorageSuffixEdges)
+	if err != nil || edgeTree == nil {
+		return err
+	}
+
+	return gm.iterateKeyBatches(part, edgeTree, PrefixNSAttrs, false, func(keys []string) error {
+
+		for _, k := range keys {
+
+			node, err := gm.readNode(k[len(PrefixNSAttrs):], c.EdgeKind, nil, edgeTree, edgeTree)
+			if err != nil {
+				return err
+			} else if node == nil {
+				continue
+			}
+
+			edge := data.NewGraphEdgeFromNode(node)
+
+			key, kind := edge.End2Key(), edge.End2Kind()
+			if c.End1 {
+				key, kind = edge.End1Key(), edge.End1Kind()
+			}
+
+			if _, ok := counts[kind]; !ok {
+				counts[kind] = make(map[string]map[string]int64)
+			}
+			if _, ok := counts[kind][key]; !ok {
+				counts[kind][key] = make(map[string]int64)
+			}
+
+			counts[kind][key][c.Attr]++
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,278 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"errors"
+	"testing"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+	"devt.de/eliasdb/graph/util"
+)
+
+func TestCounterRule(t *testing.T) {
+
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	rule := NewCounterRule("counter", &Counter{"Comments", false, "comments"},
+		&Counter{"Comments", true, "written"})
+
+	gm.SetGraphRule(rule)
+
+	if s := rule.counters[0].String(); s != "Comments:end2 -> comments" {
+		t.Error("Unexpected result:", s)
+		return
+	}
+
+	constructNode := func(key string, kind string) data.Node {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", kind)
+		return node
+	}
+
+	constructEdge := func(key string, comment string, post string) data.Edge {
+		edge := data.NewGraphEdge()
+
+		edge.SetAttr("key", key)
+		edge.SetAttr("kind", "Comments")
+
+		edge.SetAttr(data.EdgeEnd1Key, comment)
+		edge.SetAttr(data.EdgeEnd1Kind, "Comment")
+		edge.SetAttr(data.EdgeEnd1Role, "comment")
+		edge.SetAttr(data.EdgeEnd1Cascading, false)
+
+		edge.SetAttr(data.EdgeEnd2Key, post)
+		edge.SetAttr(data.EdgeEnd2Kind, "Post")
+		edge.SetAttr(data.EdgeEnd2Role, "post")
+		edge.SetAttr(data.EdgeEnd2Cascading, false)
+
+		return edge
+	}
+
+	counter := func(key string, kind string, attr string) interface{} {
+		node, err := gm.FetchNode("main", key, kind)
+		if err != nil || node == nil {
+			t.Error("Unexpected result:", node, err)
+			return nil
+		}
+		return node.Attr(attr)
+	}
+
+	for _, node := range []data.Node{constructNode("p1", "Post"), constructNode("p2", "Post"),
+		constructNode("c1", "Comment"), constructNode("c2", "Comment"), constructNode("c3", "Comment")} {
+
+		if err := gm.StoreNode("main", node); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	// Store edges directly
+
+	if err := gm.StoreEdge("main", constructEdge("e1", "c1", "p1")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := gm.StoreEdge("main", constructEdge("e2", "c2", "p1")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := counter("p1", "Post", "comments"); res != int64(2) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := counter("c1", "Comment", "written"); res != int64(1) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Updating an existing edge does not change the counters
+
+	edge := constructEdge("e2", "c2", "p1")
+	edge.SetAttr("text", "updated")
+
+	if err := gm.StoreEdge("main", edge); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := counter("p1", "Post", "comments"); res != int64(2) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Store edges in a transaction - the target node is also part of the
+	// transaction
+
+	trans := NewGraphTrans(gm)
+
+	p2 := constructNode("p2", "Post")
+	p2.SetAttr("title", "second")
+
+	trans.StoreNode("main", p2)
+	trans.StoreEdge("main", constructEdge("e3", "c1", "p2"))
+	trans.StoreEdge("main", constructEdge("e4", "c2", "p2"))
+	trans.StoreEdge("main", constructEdge("e5", "c3", "p2"))
+	trans.StoreEdge("main", edge)
+
+	if err := trans.Commit(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := counter("p2", "Post", "comments"); res != int64(3) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := counter("p2", "Post", "title"); res != "second" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := counter("c1", "Comment", "written"); res != int64(2) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := counter("p1", "Post", "comments"); res != int64(2) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Remove edges directly and through a removed node
+
+	if _, err := gm.RemoveEdge("main", "e1", "Comments"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := counter("p1", "Post", "comments"); res != int64(1) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if _, err := gm.RemoveNode("main", "c2", "Comment"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := counter("p1", "Post", "comments"); res != int64(0) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := counter("p2", "Post", "comments"); res != int64(2) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Removing a target node removes its edges without errors
+
+	if _, err := gm.RemoveNode("main", "p2", "Post"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := counter("c1", "Comment", "written"); res != int64(0) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Nothing to rebuild if the counters are correct
+
+	if res, err := rule.Rebuild(gm, "main"); res != 0 || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Let the counters drift
+
+	p1 := constructNode("p1", "Post")
+	p1.SetAttr("comments", 10)
+
+	if err := gm.StoreNode("main", p1); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := gm.StoreNode("main", constructNode("c1", "Comment")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := gm.StoreNode("main", constructNode("p3", "Post")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := gm.StoreEdge("main", constructEdge("e6", "c1", "p3")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := gm.StoreNode("main", constructNode("p3", "Post")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res, err := rule.Rebuild(gm, "main"); res != 2 || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res := counter("p1", "Post", "comments"); res != int64(0) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := counter("p3", "Post", "comments"); res != int64(1) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := counter("c1", "Comment", "written"); res != int64(1) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res, err := rule.Rebuild(gm, "main"); res != 0 || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Test error cases
+
+	p1.SetAttr("comments", "many")
+
+	if err := gm.StoreNode("main", p1); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := gm.StoreEdge("main", constructEdge("e7", "c1", "p1")); !errors.Is(err, util.ErrRule) ||
+		err.Error() != "GraphError: Graph rule error (GraphError: Invalid data "+
+			"(Counter comments of node p1 (Post) is not a number))" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := rule.Rebuild(gm, "my main"); err == nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
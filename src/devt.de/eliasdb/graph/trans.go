@@ -12,6 +12,7 @@ package graph
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"devt.de/eliasdb/graph/data"
@@ -29,6 +30,43 @@ type Trans struct {
 	removeNodes map[string]data.Node // Nodes which should be removed
 	storeEdges  map[string]data.Edge // Edges which should be stored
 	removeEdges map[string]data.Edge // Edges which should be removed
+
+	edgeEnds map[string]map[string]bool // Edges which should be stored for each endpoint
+
+	ops        []*transOp        // Ordered log of all buffered operations
+	savepoints []*transSavepoint // Ordered list of savepoints
+
+	detectConflicts bool              // Flag if conflicts should be detected on commit
+	versions        map[string]uint64 // Versions of all nodes and edges which were read or changed
+
+	changes []*ChangeEvent // Changes which are published after the commit
+}
+
+/*
+Operations which can be buffered in a transaction
+*/
+const (
+	transOpStoreNode = iota
+	transOpRemoveNode
+	transOpStoreEdge
+	transOpRemoveEdge
+)
+
+/*
+transOp is a buffered operation in the log of a transaction.
+*/
+type transOp struct {
+	op   int       // Type of operation
+	key  string    // Transaction key of the item
+	node data.Node // Node or edge of the operation
+}
+
+/*
+transSavepoint is a named position in the operation log of a transaction.
+*/
+type transSavepoint struct {
+	name string // Name of the savepoint
+	pos  int    // Length of the operation log when the savepoint was set
 }
 
 /*
@@ -36,7 +74,8 @@ NewGraphTrans creates a new graph transaction.
 */
 func NewGraphTrans(gm *Manager) *Trans {
 	return &Trans{gm, false, make(map[string]data.Node), make(map[string]data.Node),
-		make(map[string]data.Edge), make(map[string]data.Edge)}
+		make(map[string]data.Edge), make(map[string]data.Edge),
+		make(map[string]map[string]bool), nil, nil, false, make(map[string]uint64), nil}
 }
 
 /*
@@ -47,6 +86,36 @@ func (gt *Trans) IsEmpty() bool {
 		len(gt.storeEdges) == 0 && len(gt.removeEdges) == 0
 }
 
+/*
+partitions returns all partitions which are affected by this transaction. This
+includes partitions of items whose versions are checked during the commit.
+*/
+func (gt *Trans) partitions() []string {
+	var parts []string
+
+	addPart := func(tkey string) {
+		parts = append(parts, tkey[:strings.Index(tkey, "#")])
+	}
+
+	for tkey := range gt.storeNodes {
+		addPart(tkey)
+	}
+	for tkey := range gt.removeNodes {
+		addPart(tkey)
+	}
+	for tkey := range gt.storeEdges {
+		addPart(tkey)
+	}
+	for tkey := range gt.removeEdges {
+		addPart(tkey)
+	}
+	for vkey := range gt.versions {
+		addPart(vkey[2:])
+	}
+
+	return parts
+}
+
 /*
 Commit writes the transaction to the graph database. An automatic rollback is done if
 any non-fatal error occurs. Failed transactions cannot be committed again.
@@ -54,51 +123,46 @@ Serious write errors which may corrupt the database will cause a panic.
 */
 func (gt *Trans) Commit() error {
 
-	// Take writer lock if we are not in a subtransaction
+	// Take writer locks of all affected partitions if we are not in a
+	// subtransaction
 
 	if !gt.subtrans {
-		gt.gm.mutex.Lock()
-		defer gt.gm.mutex.Unlock()
+		defer gt.gm.writeLock(gt.partitions()...)()
 	}
 
-	// Return if there is nothing to do
+	// The operation log, all savepoints and all recorded versions are
+	// consumed by the commit
+
+	defer func() {
+		gt.edgeEnds = make(map[string]map[string]bool)
+		gt.ops = nil
+		gt.savepoints = nil
+		gt.versions = make(map[string]uint64)
+		gt.changes = nil
+	}()
+
+	// Return if there is nothing to do - changes of the operation which
+	// created a subtransaction are published now
 
 	if gt.IsEmpty() {
+		gt.gm.gr.feed.publish(gt.changes)
 		return nil
 	}
 
-	doRollback := func(nodePartsAndKinds map[string]string,
-		edgePartsAndKinds map[string]string) {
-
-		// Rollback main database
-
-		gt.gm.gs.RollbackMain()
-
-		// Rollback node storages
+	// Check that the graph manager can still be used
 
-		for kkey := range nodePartsAndKinds {
-			partAndKind := strings.Split(kkey, "#")
+	if err := gt.gm.checkOpen(); err != nil {
+		return err
+	}
 
-			gt.gm.rollbackNodeIndex(partAndKind[0], partAndKind[1])
-			gt.gm.rollbackNodeStorage(partAndKind[0], partAndKind[1])
-		}
+	// Check that nothing which was read or changed has been modified by others
 
+	if err := gt.checkConflicts(); err != nil {
 		gt.storeNodes = make(map[string]data.Node)
 		gt.removeNodes = make(map[string]data.Node)
-
-		// Rollback edge storages
-
-		if edgePartsAndKinds != nil {
-			for kkey := range edgePartsAndKinds {
-				partAndKind := strings.Split(kkey, "#")
-
-				gt.gm.rollbackEdgeIndex(partAndKind[0], partAndKind[1])
-				gt.gm.rollbackEdgeStorage(partAndKind[0], partAndKind[1])
-			}
-		}
-
 		gt.storeEdges = make(map[string]data.Edge)
 		gt.removeEdges = make(map[string]data.Edge)
+		return err
 	}
 
 	// Write nodes and edges until everything has been written
@@ -106,25 +170,85 @@ func (gt *Trans) Commit() error {
 	nodePartsAndKinds := make(map[string]string)
 	edgePartsAndKinds := make(map[string]string)
 
+	if err := gt.write(nodePartsAndKinds, edgePartsAndKinds); err != nil {
+		return err
+	}
+
+	gt.flush(nodePartsAndKinds, edgePartsAndKinds)
+
+	gt.gm.gr.feed.publish(gt.changes)
+
+	return nil
+}
+
+/*
+write writes all nodes and edges of this transaction without flushing the
+changes. All partitions and kinds which were written are recorded in the given
+maps. An automatic rollback of all recorded partitions and kinds is done if
+any error occurs.
+*/
+func (gt *Trans) write(nodePartsAndKinds map[string]string, edgePartsAndKinds map[string]string) error {
+
 	for !gt.IsEmpty() {
 
 		// Write the nodes first
 
 		if err := gt.commitNodes(nodePartsAndKinds, edgePartsAndKinds); err != nil {
-			doRollback(nodePartsAndKinds, nil)
+			gt.rollback(nodePartsAndKinds, edgePartsAndKinds)
 			return err
 		}
 
 		// After the nodes write the edges
 
 		if err := gt.commitEdges(nodePartsAndKinds, edgePartsAndKinds); err != nil {
-			doRollback(nodePartsAndKinds, edgePartsAndKinds)
+			gt.rollback(nodePartsAndKinds, edgePartsAndKinds)
 			return err
 		}
 	}
 
-	// Flush changes - panic instead of error reporting since the database
-	// may be inconsistent
+	return nil
+}
+
+/*
+rollback rolls back all changes to the given partitions and kinds and discards
+all pending operations of this transaction.
+*/
+func (gt *Trans) rollback(nodePartsAndKinds map[string]string, edgePartsAndKinds map[string]string) {
+
+	// Rollback main database
+
+	gt.gm.rollbackMain()
+
+	// Rollback node storages
+
+	for kkey := range nodePartsAndKinds {
+		partAndKind := strings.Split(kkey, "#")
+
+		gt.gm.rollbackNodeIndex(partAndKind[0], partAndKind[1])
+		gt.gm.rollbackNodeStorage(partAndKind[0], partAndKind[1])
+	}
+
+	gt.storeNodes = make(map[string]data.Node)
+	gt.removeNodes = make(map[string]data.Node)
+
+	// Rollback edge storages
+
+	for kkey := range edgePartsAndKinds {
+		partAndKind := strings.Split(kkey, "#")
+
+		gt.gm.rollbackEdgeIndex(partAndKind[0], partAndKind[1])
+		gt.gm.rollbackEdgeStorage(partAndKind[0], partAndKind[1])
+	}
+
+	gt.storeEdges = make(map[string]data.Edge)
+	gt.removeEdges = make(map[string]data.Edge)
+}
+
+/*
+flush flushes all changes to the given partitions and kinds. Causes a panic
+instead of an error since the database may be inconsistent if a flush fails.
+*/
+func (gt *Trans) flush(nodePartsAndKinds map[string]string, edgePartsAndKinds map[string]string) {
 
 	panicIfError := func(err error) {
 		if err != nil {
@@ -132,7 +256,7 @@ func (gt *Trans) Commit() error {
 		}
 	}
 
-	panicIfError(gt.gm.gs.FlushMain())
+	panicIfError(gt.gm.flushMain())
 
 	for kkey := range nodePartsAndKinds {
 
@@ -149,8 +273,6 @@ func (gt *Trans) Commit() error {
 		panicIfError(gt.gm.flushEdgeIndex(partAndKind[0], partAndKind[1]))
 		panicIfError(gt.gm.flushEdgeStorage(partAndKind[0], partAndKind[1]))
 	}
-
-	return nil
 }
 
 /*
@@ -171,7 +293,7 @@ func (gt *Trans) commitNodes(nodePartsAndKinds map[string]string, edgePartsAndKi
 
 		// Get the HTrees which stores the node index and node
 
-		iht, err := gt.gm.getNodeIndexHTree(part, node.Kind(), true)
+		im, err := gt.gm.getNodeIndexManager(part, node.Kind(), true)
 		if err != nil {
 			return err
 		}
@@ -183,21 +305,29 @@ func (gt *Trans) commitNodes(nodePartsAndKinds map[string]string, edgePartsAndKi
 
 		// Write the node to the datastore
 
-		oldnode, err := gt.gm.writeNode(node, false, attht, valht, nodeAttributeFilter)
+		oldnode, err := gt.gm.writeNodeWithHistory(node, false, attht, valht)
 
 		if err != nil {
 			return err
 		}
 
+		// Index updates are deferred during a bulk load
+
+		if deferred, err := gt.gm.deferNodeIndex(im, part, node.Kind(), node.Key(), oldnode); err != nil {
+			return err
+		} else if deferred {
+			im = nil
+		}
+
 		// Increase node count if the node was inserted and write the changes
 		// to the index.
 
 		if oldnode == nil {
-			currentCount := gt.gm.NodeCount(node.Kind())
-			gt.gm.writeNodeCount(node.Kind(), currentCount+1, false)
+			gt.gm.mc.inc(part, node.Kind())
+			gt.gm.addNodeCount(part, node.Kind(), 1, false)
 
-			if iht != nil {
-				err := util.NewIndexManager(iht).Index(node.Key(), node.IndexMap())
+			if im != nil {
+				err := im.Index(node.Key(), node.IndexMap())
 				if err != nil {
 
 					// The node was written at this point and the model is
@@ -207,9 +337,9 @@ func (gt *Trans) commitNodes(nodePartsAndKinds map[string]string, edgePartsAndKi
 				}
 			}
 
-		} else if iht != nil {
+		} else if im != nil {
 
-			err := util.NewIndexManager(iht).Reindex(node.Key(), node.IndexMap(),
+			err := im.Reindex(node.Key(), node.IndexMap(),
 				oldnode.IndexMap())
 
 			if err != nil {
@@ -250,7 +380,7 @@ func (gt *Trans) commitNodes(nodePartsAndKinds map[string]string, edgePartsAndKi
 
 		// Get the HTree which stores the node index and node kind
 
-		iht, err := gt.gm.getNodeIndexHTree(part, node.Kind(), false)
+		im, err := gt.gm.getNodeIndexManager(part, node.Kind(), false)
 		if err != nil {
 			return err
 		}
@@ -262,7 +392,7 @@ func (gt *Trans) commitNodes(nodePartsAndKinds map[string]string, edgePartsAndKi
 
 		// Delete the node from the datastore
 
-		oldnode, err := gt.gm.deleteNode(node.Key(), node.Kind(), attTree, valTree)
+		oldnode, err := gt.gm.deleteNodeWithHistory(node.Key(), node.Kind(), attTree, valTree)
 		if err != nil {
 			return err
 		}
@@ -271,8 +401,16 @@ func (gt *Trans) commitNodes(nodePartsAndKinds map[string]string, edgePartsAndKi
 
 		if oldnode != nil {
 
-			if iht != nil {
-				err := util.NewIndexManager(iht).Deindex(node.Key(), oldnode.IndexMap())
+			gt.gm.mc.inc(part, node.Kind())
+
+			if deferred, err := gt.gm.deferNodeIndex(im, part, node.Kind(), node.Key(), oldnode); err != nil {
+				return err
+			} else if deferred {
+				im = nil
+			}
+
+			if im != nil {
+				err := im.Deindex(node.Key(), oldnode.IndexMap())
 
 				if err != nil {
 					return err
@@ -281,8 +419,7 @@ func (gt *Trans) commitNodes(nodePartsAndKinds map[string]string, edgePartsAndKi
 
 			// Decrease the node count
 
-			currentCount := gt.gm.NodeCount(node.Kind())
-			gt.gm.writeNodeCount(node.Kind(), currentCount-1, false)
+			gt.gm.addNodeCount(part, node.Kind(), -1, false)
 
 			// Execute rules
 
@@ -318,7 +455,7 @@ func (gt *Trans) commitEdges(nodePartsAndKinds map[string]string, edgePartsAndKi
 
 		// Get the HTrees which stores the edges and the edge index
 
-		iht, err := gt.gm.getEdgeIndexHTree(part, edge.Kind(), true)
+		im, err := gt.gm.getEdgeIndexManager(part, edge.Kind(), true)
 		if err != nil {
 			return err
 		}
@@ -339,11 +476,16 @@ func (gt *Trans) commitEdges(nodePartsAndKinds map[string]string, edgePartsAndKi
 			return &util.GraphError{
 				Type:   util.ErrInvalidData,
 				Detail: fmt.Sprintf("Can't store edge to non-existend node kind: %v", edge.End1Kind()),
+				Cause:  util.ErrNotFound,
 			}
 		} else if end1, err := end1nodeht.Get([]byte(PrefixNSAttrs + edge.End1Key())); err != nil || end1 == nil {
+			if err == nil {
+				err = util.ErrNotFound
+			}
 			return &util.GraphError{
 				Type:   util.ErrInvalidData,
 				Detail: fmt.Sprintf("Can't find edge endpoint: %s (%s)", edge.End1Key(), edge.End1Kind()),
+				Cause:  err,
 			}
 		}
 
@@ -354,14 +496,26 @@ func (gt *Trans) commitEdges(nodePartsAndKinds map[string]string, edgePartsAndKi
 		} else if end2ht == nil {
 			return &util.GraphError{
 				Type:   util.ErrInvalidData,
-				Detail: "Can't store edge to non-existend node kind: " + edge.End2Kind()}
+				Detail: "Can't store edge to non-existend node kind: " + edge.End2Kind(),
+				Cause:  util.ErrNotFound,
+			}
 		} else if end2, err := end2nodeht.Get([]byte(PrefixNSAttrs + edge.End2Key())); err != nil || end2 == nil {
+			if err == nil {
+				err = util.ErrNotFound
+			}
 			return &util.GraphError{
 				Type:   util.ErrInvalidData,
 				Detail: fmt.Sprintf("Can't find edge endpoint: %s (%s)", edge.End2Key(), edge.End2Kind()),
+				Cause:  err,
 			}
 		}
 
+		// Check cardinality constraints
+
+		if err := gt.gm.checkEdgeCardinalityMax(edge, edgeht, end1ht, end2ht); err != nil {
+			return err
+		}
+
 		// Write edge to the datastore
 
 		oldedge, err := gt.gm.writeEdge(edge, edgeht, end1ht, end2ht)
@@ -376,14 +530,13 @@ func (gt *Trans) commitEdges(nodePartsAndKinds map[string]string, edgePartsAndKi
 
 			// Increase edge count
 
-			currentCount := gt.gm.EdgeCount(edge.Kind())
-			gt.gm.writeEdgeCount(edge.Kind(), currentCount+1, false)
+			gt.gm.addEdgeCount(part, edge.Kind(), 1, false)
 
 			// Write edge data to the index
 
-			if iht != nil {
+			if im != nil {
 
-				if err := util.NewIndexManager(iht).Index(edge.Key(), edge.IndexMap()); err != nil {
+				if err := im.Index(edge.Key(), edge.IndexMap()); err != nil {
 
 					// The edge was written at this point and the model is
 					// consistent only the index is missing entries
@@ -392,9 +545,9 @@ func (gt *Trans) commitEdges(nodePartsAndKinds map[string]string, edgePartsAndKi
 				}
 			}
 
-		} else if iht != nil {
+		} else if im != nil {
 
-			err := util.NewIndexManager(iht).Reindex(edge.Key(), edge.IndexMap(),
+			err := im.Reindex(edge.Key(), edge.IndexMap(),
 				oldedge.IndexMap())
 
 			if err != nil {
@@ -438,7 +591,7 @@ func (gt *Trans) commitEdges(nodePartsAndKinds map[string]string, edgePartsAndKi
 
 		// Get the HTrees which stores the edges and the edge index
 
-		iht, err := gt.gm.getEdgeIndexHTree(part, edge.Kind(), true)
+		im, err := gt.gm.getEdgeIndexManager(part, edge.Kind(), true)
 		if err != nil {
 			return err
 		}
@@ -448,6 +601,12 @@ func (gt *Trans) commitEdges(nodePartsAndKinds map[string]string, edgePartsAndKi
 			return err
 		}
 
+		// Check cardinality constraints
+
+		if err := gt.gm.checkEdgeCardinalityMin(part, edge.Key(), edge.Kind(), edgeht); err != nil {
+			return err
+		}
+
 		// Delete the node from the datastore
 
 		node, err := gt.gm.deleteNode(edge.Key(), edge.Kind(), edgeht, edgeht)
@@ -476,9 +635,9 @@ func (gt *Trans) commitEdges(nodePartsAndKinds map[string]string, edgePartsAndKi
 				return err
 			}
 
-			if iht != nil {
+			if im != nil {
 
-				err := util.NewIndexManager(iht).Deindex(edge.Key(), oldedge.IndexMap())
+				err := im.Deindex(edge.Key(), oldedge.IndexMap())
 				if err != nil {
 					return err
 				}
@@ -486,8 +645,7 @@ func (gt *Trans) commitEdges(nodePartsAndKinds map[string]string, edgePartsAndKi
 
 			// Decrease edge count
 
-			currentCount := gt.gm.EdgeCount(oldedge.Kind())
-			gt.gm.writeEdgeCount(oldedge.Kind(), currentCount-1, false)
+			gt.gm.addEdgeCount(part, oldedge.Kind(), -1, false)
 
 			// Execute rules
 
@@ -515,11 +673,11 @@ func (gt *Trans) StoreNode(part string, node data.Node) error {
 
 	key := gt.createKey(part, node.Key(), node.Kind())
 
-	if _, ok := gt.removeNodes[key]; ok {
-		delete(gt.removeNodes, key)
+	if err := gt.recordNodeVersion(part, node.Key(), node.Kind()); err != nil {
+		return err
 	}
 
-	gt.storeNodes[key] = node
+	gt.applyOp(&transOp{transOpStoreNode, key, node})
 
 	return nil
 }
@@ -537,11 +695,13 @@ func (gt *Trans) UpdateNode(part string, node data.Node) error {
 
 	key := gt.createKey(part, node.Key(), node.Kind())
 
-	if _, ok := gt.removeNodes[key]; ok {
-		delete(gt.removeNodes, key)
-	} else if storeNode, ok := gt.storeNodes[key]; ok {
+	if err := gt.recordNodeVersion(part, node.Key(), node.Kind()); err != nil {
+		return err
+	}
+
+	if storeNode, ok := gt.storeNodes[key]; ok {
 		node = data.NodeMerge(storeNode, node)
-	} else {
+	} else if _, ok := gt.removeNodes[key]; !ok {
 
 		// Check the actual database if the node exists
 
@@ -553,7 +713,7 @@ func (gt *Trans) UpdateNode(part string, node data.Node) error {
 		}
 	}
 
-	gt.storeNodes[key] = node
+	gt.applyOp(&transOp{transOpStoreNode, key, node})
 
 	return nil
 }
@@ -568,15 +728,15 @@ func (gt *Trans) RemoveNode(part string, nkey string, nkind string) error {
 
 	key := gt.createKey(part, nkey, nkind)
 
-	if _, ok := gt.storeNodes[key]; ok {
-		delete(gt.storeNodes, key)
+	if err := gt.recordNodeVersion(part, nkey, nkind); err != nil {
+		return err
 	}
 
 	node := data.NewGraphNode()
 	node.SetAttr(data.NodeKey, nkey)
 	node.SetAttr(data.NodeKind, nkind)
 
-	gt.removeNodes[key] = node
+	gt.applyOp(&transOp{transOpRemoveNode, key, node})
 
 	return nil
 }
@@ -594,11 +754,11 @@ func (gt *Trans) StoreEdge(part string, edge data.Edge) error {
 
 	key := gt.createKey(part, edge.Key(), edge.Kind())
 
-	if _, ok := gt.removeEdges[key]; ok {
-		delete(gt.removeEdges, key)
+	if err := gt.recordEdgeVersion(part, edge.Key(), edge.Kind()); err != nil {
+		return err
 	}
 
-	gt.storeEdges[key] = edge
+	gt.applyOp(&transOp{transOpStoreEdge, key, edge})
 
 	return nil
 }
@@ -613,19 +773,249 @@ func (gt *Trans) RemoveEdge(part string, ekey string, ekind string) error {
 
 	key := gt.createKey(part, ekey, ekind)
 
-	if _, ok := gt.storeEdges[key]; ok {
-		delete(gt.storeEdges, key)
+	if err := gt.recordEdgeVersion(part, ekey, ekind); err != nil {
+		return err
 	}
 
 	edge := data.NewGraphEdge()
 	edge.SetAttr(data.NodeKey, ekey)
 	edge.SetAttr(data.NodeKind, ekind)
 
-	gt.removeEdges[key] = edge
+	gt.applyOp(&transOp{transOpRemoveEdge, key, edge})
 
 	return nil
 }
 
+/*
+SetConflictDetection enables or disables the detection of conflicts with other
+committers. If enabled the transaction records the version of every node and
+edge which is read or changed through it. Commit fails with an ErrTransConflict
+error if any of these items was changed by someone else in the meantime. All
+operations of the transaction are discarded in this case. The expected pattern
+is to build up a new transaction (reading the current state again) and retry
+the commit.
+*/
+func (gt *Trans) SetConflictDetection(enabled bool) {
+	gt.detectConflicts = enabled
+}
+
+/*
+recordNodeVersion records the current version of a node. Only the first
+version of an item is recorded.
+*/
+func (gt *Trans) recordNodeVersion(part string, key string, kind string) error {
+	return gt.recordVersion("n#"+gt.createKey(part, key, kind), func() (uint64, error) {
+		return gt.gm.NodeVersion(part, key, kind)
+	})
+}
+
+/*
+recordEdgeVersion records the current version of an edge. Only the first
+version of an item is recorded.
+*/
+func (gt *Trans) recordEdgeVersion(part string, key string, kind string) error {
+	return gt.recordVersion("e#"+gt.createKey(part, key, kind), func() (uint64, error) {
+		return gt.gm.EdgeVersion(part, key, kind)
+	})
+}
+
+/*
+recordVersion records the version of an item if conflict detection is enabled.
+*/
+func (gt *Trans) recordVersion(vkey string, version func() (uint64, error)) error {
+
+	if !gt.detectConflicts {
+		return nil
+	} else if _, ok := gt.versions[vkey]; ok {
+		return nil
+	}
+
+	v, err := version()
+	if err == nil {
+		gt.versions[vkey] = v
+	}
+
+	return err
+}
+
+/*
+checkConflicts checks that the recorded versions of all items are still
+current. It is assumed that the caller holds the writer lock.
+*/
+func (gt *Trans) checkConflicts() error {
+	var conflicts []string
+
+	for vkey, version := range gt.versions {
+		var current uint64
+		var err error
+
+		item := strings.SplitN(vkey, "#", 4)
+
+		if item[0] == "n" {
+			current, err = gt.gm.readNodeVersion(item[1], item[3], item[2])
+		} else {
+			current, err = gt.gm.readEdgeVersion(item[1], item[3], item[2])
+		}
+
+		if err != nil {
+			return err
+		} else if current != version {
+			name := "Node"
+			if item[0] == "e" {
+				name = "Edge"
+			}
+			conflicts = append(conflicts, fmt.Sprintf("%v %v (%v) in %v", name, item[3], item[2], item[1]))
+		}
+	}
+
+	if conflicts != nil {
+		sort.StringSlice(conflicts).Sort()
+
+		return &util.GraphError{Type: util.ErrTransConflict, Detail: strings.Join(conflicts, ", ")}
+	}
+
+	return nil
+}
+
+/*
+Savepoint sets a named savepoint in this transaction. All operations which are
+added after the savepoint can be discarded with RollbackTo. Setting an existing
+savepoint again moves it to the current position.
+*/
+func (gt *Trans) Savepoint(name string) {
+	if i := gt.findSavepoint(name); i != -1 {
+		gt.savepoints = append(gt.savepoints[:i], gt.savepoints[i+1:]...)
+	}
+
+	gt.savepoints = append(gt.savepoints, &transSavepoint{name, len(gt.ops)})
+}
+
+/*
+RollbackTo discards all operations which were added after a given savepoint.
+Operations which were added before the savepoint are kept. The savepoint itself
+stays valid while all savepoints which were set after it are released.
+*/
+func (gt *Trans) RollbackTo(name string) error {
+	i := gt.findSavepoint(name)
+	if i == -1 {
+		return &util.GraphError{Type: util.ErrInvalidData, Detail: "Unknown savepoint: " + name, Cause: util.ErrNotFound}
+	}
+
+	gt.ops = gt.ops[:gt.savepoints[i].pos]
+	gt.savepoints = gt.savepoints[:i+1]
+
+	// Rebuild the buffered items from the truncated operation log
+
+	gt.storeNodes = make(map[string]data.Node)
+	gt.removeNodes = make(map[string]data.Node)
+	gt.storeEdges = make(map[string]data.Edge)
+	gt.removeEdges = make(map[string]data.Edge)
+	gt.edgeEnds = make(map[string]map[string]bool)
+
+	ops := gt.ops
+	gt.ops = nil
+
+	for _, op := range ops {
+		gt.applyOp(op)
+	}
+
+	return nil
+}
+
+/*
+ReleaseSavepoint releases a given savepoint and all savepoints which were set
+after it. The operations of the transaction are not changed.
+*/
+func (gt *Trans) ReleaseSavepoint(name string) error {
+	i := gt.findSavepoint(name)
+	if i == -1 {
+		return &util.GraphError{Type: util.ErrInvalidData, Detail: "Unknown savepoint: " + name, Cause: util.ErrNotFound}
+	}
+
+	gt.savepoints = gt.savepoints[:i]
+
+	return nil
+}
+
+/*
+findSavepoint returns the position of a savepoint or -1 if it does not exist.
+*/
+func (gt *Trans) findSavepoint(name string) int {
+	for i, sp := range gt.savepoints {
+		if sp.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+/*
+applyOp applies an operation to the buffered items and adds it to the
+operation log.
+*/
+func (gt *Trans) applyOp(op *transOp) {
+
+	switch op.op {
+	case transOpStoreNode:
+		delete(gt.removeNodes, op.key)
+		gt.storeNodes[op.key] = op.node
+	case transOpRemoveNode:
+		delete(gt.storeNodes, op.key)
+		gt.removeNodes[op.key] = op.node
+	case transOpStoreEdge:
+		gt.unindexEdgeEnds(op.key)
+		delete(gt.removeEdges, op.key)
+		gt.storeEdges[op.key] = op.node.(data.Edge)
+		gt.indexEdgeEnds(op.key)
+	case transOpRemoveEdge:
+		gt.unindexEdgeEnds(op.key)
+		delete(gt.storeEdges, op.key)
+		gt.removeEdges[op.key] = op.node.(data.Edge)
+	}
+
+	gt.ops = append(gt.ops, op)
+}
+
+/*
+indexEdgeEnds adds a stored edge to the lookup of its endpoints.
+*/
+func (gt *Trans) indexEdgeEnds(key string) {
+	edge := gt.storeEdges[key]
+	part := strings.SplitN(key, "#", 2)[0]
+
+	for _, end := range []string{gt.createKey(part, edge.End1Key(), edge.End1Kind()),
+		gt.createKey(part, edge.End2Key(), edge.End2Kind())} {
+
+		if _, ok := gt.edgeEnds[end]; !ok {
+			gt.edgeEnds[end] = make(map[string]bool)
+		}
+
+		gt.edgeEnds[end][key] = true
+	}
+}
+
+/*
+unindexEdgeEnds removes a stored edge from the lookup of its endpoints.
+*/
+func (gt *Trans) unindexEdgeEnds(key string) {
+	edge, ok := gt.storeEdges[key]
+	if !ok {
+		return
+	}
+
+	part := strings.SplitN(key, "#", 2)[0]
+
+	for _, end := range []string{gt.createKey(part, edge.End1Key(), edge.End1Kind()),
+		gt.createKey(part, edge.End2Key(), edge.End2Kind())} {
+
+		delete(gt.edgeEnds[end], key)
+
+		if len(gt.edgeEnds[end]) == 0 {
+			delete(gt.edgeEnds, end)
+		}
+	}
+}
+
 /*
 Create a key for the transaction storage.
 */
@@ -0,0 +1,223 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"strings"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/util"
+)
+
+/*
+FetchNode fetches a single node from a partition of the graph. Pending
+operations of this transaction are taken into account.
+*/
+func (gt *Trans) FetchNode(part string, key string, kind string) (data.Node, error) {
+	if err := gt.gm.checkPartitionName(part); err != nil {
+		return nil, err
+	}
+
+	tkey := gt.createKey(part, key, kind)
+
+	if err := gt.recordNodeVersion(part, key, kind); err != nil {
+		return nil, err
+	}
+
+	if _, ok := gt.removeNodes[tkey]; ok {
+		return nil, nil
+	} else if node, ok := gt.storeNodes[tkey]; ok {
+		return node, nil
+	}
+
+	return gt.gm.FetchNode(part, key, kind)
+}
+
+/*
+FetchEdge fetches a single edge from a partition of the graph. Pending
+operations of this transaction are taken into account.
+*/
+func (gt *Trans) FetchEdge(part string, key string, kind string) (data.Edge, error) {
+	if err := gt.gm.checkPartitionName(part); err != nil {
+		return nil, err
+	}
+
+	tkey := gt.createKey(part, key, kind)
+
+	if err := gt.recordEdgeVersion(part, key, kind); err != nil {
+		return nil, err
+	}
+
+	if _, ok := gt.removeEdges[tkey]; ok {
+		return nil, nil
+	} else if edge, ok := gt.storeEdges[tkey]; ok {
+		return edge, nil
+	}
+
+	return gt.gm.FetchEdgePart(part, key, kind, nil)
+}
+
+/*
+TraverseMulti traverses from a given node to other nodes following a given
+partial edge spec. Pending operations of this transaction are taken into
+account. The last parameter allData specifies if all data should be retrieved
+for the connected nodes and edges. If set to false only the minimal set of
+attributes will be populated.
+*/
+func (gt *Trans) TraverseMulti(part string, key string, kind string,
+	spec string, allData bool) ([]data.Node, []data.Edge, error) {
+
+	sspec := strings.Split(spec, ":")
+	if len(sspec) != 4 {
+		return nil, nil, &util.GraphError{Type: util.ErrInvalidData, Detail: "Invalid spec: " + spec}
+	} else if err := gt.gm.checkPartitionName(part); err != nil {
+		return nil, nil, err
+	}
+
+	if err := gt.recordNodeVersion(part, key, kind); err != nil {
+		return nil, nil, err
+	} else if _, ok := gt.removeNodes[gt.createKey(part, key, kind)]; ok {
+		return nil, nil, nil
+	}
+
+	var nodes []data.Node
+	var edges []data.Edge
+
+	// Filter the committed state
+
+	cnodes, cedges, err := gt.gm.TraverseMulti(part, key, kind, spec, allData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, edge := range cedges {
+		node := cnodes[i]
+
+		ekey := gt.createKey(part, edge.Key(), edge.Kind())
+		nkey := gt.createKey(part, edge.End2Key(), edge.End2Kind())
+
+		if _, ok := gt.removeEdges[ekey]; ok {
+			continue
+		} else if _, ok := gt.storeEdges[ekey]; ok {
+			continue // Edge is added again further below
+		} else if _, ok := gt.removeNodes[nkey]; ok {
+			continue
+		} else if err := gt.recordEdgeVersion(part, edge.Key(), edge.Kind()); err != nil {
+			return nil, nil, err
+		} else if err := gt.recordNodeVersion(part, edge.End2Key(), edge.End2Kind()); err != nil {
+			return nil, nil, err
+		} else if storeNode, ok := gt.storeNodes[nkey]; ok && allData {
+			node = storeNode
+		}
+
+		nodes = append(nodes, node)
+		edges = append(edges, edge)
+	}
+
+	// Add stored edges of this transaction
+
+	for ekey := range gt.edgeEnds[gt.createKey(part, key, kind)] {
+		edge := gt.storeEdges[ekey]
+
+		for _, end := range []int{1, 2} {
+			tedge := transTraversalEdge(edge, key, kind, end)
+
+			if tedge == nil || !matchEdgeSpec(sspec, tedge) {
+				continue
+			}
+
+			node, err := gt.FetchNode(part, tedge.End2Key(), tedge.End2Kind())
+			if err != nil {
+				return nil, nil, err
+			} else if node == nil {
+				continue
+			}
+
+			if !allData {
+
+				// Populate nodes and edges with the minimal set of attributes
+
+				node = transMinimalItem(node, data.NodeKey, data.NodeKind)
+				tedge = data.NewGraphEdgeFromNode(transMinimalItem(tedge, data.NodeKey, data.NodeKind,
+					data.EdgeEnd1Key, data.EdgeEnd1Kind, data.EdgeEnd1Role, data.EdgeEnd1Cascading,
+					data.EdgeEnd2Key, data.EdgeEnd2Kind, data.EdgeEnd2Role, data.EdgeEnd2Cascading,
+					data.EdgeUndirected))
+			}
+
+			nodes = append(nodes, node)
+			edges = append(edges, tedge)
+		}
+	}
+
+	return nodes, edges, nil
+}
+
+/*
+matchEdgeSpec checks if a given (split) partial spec matches an edge from the
+view of its first end.
+*/
+func matchEdgeSpec(sspec []string, edge data.Edge) bool {
+	for _, spec := range edgeEndSpecs(edge, true) {
+		if matchSpec(sspec, spec) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+transTraversalEdge returns a copy of an edge whose first end is the given end
+of the edge. Returns nil if the given end is not the node with the given key
+and kind.
+*/
+func transTraversalEdge(edge data.Edge, key string, kind string, end int) data.Edge {
+
+	if end == 1 {
+		if edge.End1Key() != key || edge.End1Kind() != kind {
+			return nil
+		}
+
+		return data.NewGraphEdgeFromNode(data.NodeClone(edge))
+	}
+
+	if edge.End2Key() != key || edge.End2Kind() != kind {
+		return nil
+	}
+
+	ret := data.NewGraphEdgeFromNode(data.NodeClone(edge))
+
+	swap := func(attr1 string, attr2 string) {
+		tmp := ret.Attr(attr1)
+		ret.SetAttr(attr1, ret.Attr(attr2))
+		ret.SetAttr(attr2, tmp)
+	}
+
+	swap(data.EdgeEnd1Key, data.EdgeEnd2Key)
+	swap(data.EdgeEnd1Kind, data.EdgeEnd2Kind)
+	swap(data.EdgeEnd1Role, data.EdgeEnd2Role)
+	swap(data.EdgeEnd1Cascading, data.EdgeEnd2Cascading)
+
+	return ret
+}
+
+/*
+transMinimalItem returns a copy of a node which only contains the given attributes.
+*/
+func transMinimalItem(node data.Node, attrs ...string) data.Node {
+	ret := data.NewGraphNode()
+
+	for _, attr := range attrs {
+		ret.SetAttr(attr, node.Attr(attr))
+	}
+
+	return ret
+}
@@ -0,0 +1,232 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"devt.de/eliasdb/graph/data"
+	"devt.de/eliasdb/graph/graphstorage"
+)
+
+func TestTransReadYourWrites(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	constructNode := func(key string, kind string, name string) data.Node {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", kind)
+		node.SetAttr("Name", name)
+		return node
+	}
+
+	constructEdge := func(key string, node1 data.Node, node2 data.Node) data.Edge {
+		edge := data.NewGraphEdge()
+
+		edge.SetAttr("key", key)
+		edge.SetAttr("kind", "wrote")
+
+		edge.SetAttr(data.EdgeEnd1Key, node1.Key())
+		edge.SetAttr(data.EdgeEnd1Kind, node1.Kind())
+		edge.SetAttr(data.EdgeEnd1Role, "author")
+		edge.SetAttr(data.EdgeEnd1Cascading, false)
+
+		edge.SetAttr(data.EdgeEnd2Key, node2.Key())
+		edge.SetAttr(data.EdgeEnd2Kind, node2.Kind())
+		edge.SetAttr(data.EdgeEnd2Role, "song")
+		edge.SetAttr(data.EdgeEnd2Cascading, false)
+
+		return edge
+	}
+
+	// Format traversal results in a stable way
+
+	traverse := func(trans *Trans, key string, kind string, spec string, allData bool) string {
+		nodes, edges, err := trans.TraverseMulti("main", key, kind, spec, allData)
+		if err != nil {
+			return err.Error()
+		}
+
+		var res []string
+		for i, node := range nodes {
+			res = append(res, fmt.Sprintf("%v(%v)->%v(%v)", edges[i].Key(), edges[i].End1Key(),
+				node.Key(), node.Attr("Name")))
+		}
+		sort.Strings(res)
+
+		return fmt.Sprint(res)
+	}
+
+	a1 := constructNode("a1", "Author", "John")
+	s1 := constructNode("s1", "Song", "Aria1")
+
+	gm.StoreNode("main", a1)
+	gm.StoreNode("main", s1)
+	gm.StoreEdge("main", constructEdge("e1", a1, s1))
+
+	trans := NewGraphTrans(gm)
+
+	if _, _, err := trans.TraverseMulti("main", "a1", "Author", "::", true); err == nil ||
+		err.Error() != "GraphError: Invalid data (Invalid spec: ::)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := trans.FetchNode("my main", "a1", "Author"); err == nil {
+		t.Error("Invalid partition name should cause an error")
+		return
+	}
+
+	// Committed data is visible
+
+	if res := traverse(trans, "a1", "Author", ":::", true); res != "[e1(a1)->s1(Aria1)]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Stored nodes and edges are visible
+
+	s2 := constructNode("s2", "Song", "Aria2")
+	trans.StoreNode("main", s2)
+	trans.StoreEdge("main", constructEdge("e2", a1, s2))
+
+	if node, err := trans.FetchNode("main", "s2", "Song"); err != nil || node.Attr("Name") != "Aria2" {
+		t.Error("Unexpected result:", node, err)
+		return
+	}
+
+	if node, err := gm.FetchNode("main", "s2", "Song"); err != nil || node != nil {
+		t.Error("Unexpected result:", node, err)
+		return
+	}
+
+	if edge, err := trans.FetchEdge("main", "e2", "wrote"); err != nil || edge.End2Key() != "s2" {
+		t.Error("Unexpected result:", edge, err)
+		return
+	}
+
+	if res := traverse(trans, "a1", "Author", ":::", true); res != "[e1(a1)->s1(Aria1) e2(a1)->s2(Aria2)]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := traverse(trans, "a1", "Author", ":::", false); res != "[e1(a1)->s1(<nil>) e2(a1)->s2(<nil>)]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := traverse(trans, "a1", "Author", "author:wrote:song:Song", true); res != "[e1(a1)->s1(Aria1) e2(a1)->s2(Aria2)]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := traverse(trans, "a1", "Author", "song:::", true); res != "[]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Traversal from a node which only exists in the transaction
+
+	if res := traverse(trans, "s2", "Song", "song:::", true); res != "[e2(s2)->a1(John)]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Updated nodes are visible
+
+	upd := data.NewGraphNode()
+	upd.SetAttr("key", "s1")
+	upd.SetAttr("kind", "Song")
+	upd.SetAttr("Name", "Aria1 (live)")
+	trans.UpdateNode("main", upd)
+
+	if res := traverse(trans, "a1", "Author", ":::", true); res != "[e1(a1)->s1(Aria1 (live)) e2(a1)->s2(Aria2)]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Removed edges and nodes are hidden
+
+	trans.RemoveEdge("main", "e1", "wrote")
+
+	if edge, err := trans.FetchEdge("main", "e1", "wrote"); err != nil || edge != nil {
+		t.Error("Unexpected result:", edge, err)
+		return
+	}
+
+	if res := traverse(trans, "a1", "Author", ":::", true); res != "[e2(a1)->s2(Aria2)]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	trans.Savepoint("sp")
+	trans.RemoveNode("main", "s2", "Song")
+
+	if node, err := trans.FetchNode("main", "s2", "Song"); err != nil || node != nil {
+		t.Error("Unexpected result:", node, err)
+		return
+	}
+
+	if res := traverse(trans, "a1", "Author", ":::", true); res != "[]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	trans.RemoveNode("main", "a1", "Author")
+
+	if res := traverse(trans, "a1", "Author", ":::", true); res != "[]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Rolled back operations are no longer visible
+
+	trans.RollbackTo("sp")
+
+	if res := traverse(trans, "a1", "Author", ":::", true); res != "[e2(a1)->s2(Aria2)]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Replacing a stored edge updates the traversal lookup
+
+	trans.StoreEdge("main", constructEdge("e2", a1, s1))
+
+	if res := traverse(trans, "s2", "Song", ":::", true); res != "[]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := traverse(trans, "a1", "Author", ":::", true); res != "[e2(a1)->s1(Aria1 (live))]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// After the commit the result is the same
+
+	if err := trans.Commit(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := traverse(trans, "a1", "Author", ":::", true); res != "[e2(a1)->s1(Aria1 (live))]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := traverse(NewGraphTrans(gm), "s1", "Song", ":::", true); res != "[e2(s1)->a1(John)]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
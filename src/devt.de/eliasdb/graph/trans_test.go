@@ -14,10 +14,12 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 
 	"devt.de/eliasdb/graph/data"
 	"devt.de/eliasdb/graph/graphstorage"
+	"devt.de/eliasdb/graph/util"
 	"devt.de/eliasdb/storage"
 )
 
@@ -534,6 +536,362 @@ func TestTransBuilding(t *testing.T) {
 	}
 }
 
+func TestTransSavepoints(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	constructNode := func(key string) data.Node {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "mykind")
+		node.SetAttr("Name", "Node "+key)
+		return node
+	}
+
+	trans := NewGraphTrans(gm)
+
+	if err := trans.RollbackTo("doc1"); err == nil || err.Error() != "GraphError: Invalid data (Unknown savepoint: doc1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// First document is fine
+
+	trans.Savepoint("doc1")
+	trans.StoreNode("main", constructNode("1"))
+	trans.StoreNode("main", constructNode("2"))
+
+	// Second document fails validation midway
+
+	trans.Savepoint("doc2")
+	trans.StoreNode("main", constructNode("3"))
+	trans.RemoveNode("main", "1", "mykind")
+
+	trans.Savepoint("doc2part")
+	trans.StoreNode("main", constructNode("4"))
+
+	countMaps(t, trans, 3, 1, 0, 0)
+
+	if err := trans.RollbackTo("doc2"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	countMaps(t, trans, 2, 0, 0, 0)
+	checkMaps(t, trans, "main", "1", "mykind", true, false, false, false)
+	checkMaps(t, trans, "main", "3", "mykind", false, false, false, false)
+
+	// Savepoints after the rollback target are released
+
+	if err := trans.RollbackTo("doc2part"); err == nil || err.Error() != "GraphError: Invalid data (Unknown savepoint: doc2part)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// The savepoint itself can be used again
+
+	upd := data.NewGraphNode()
+	upd.SetAttr("key", "2")
+	upd.SetAttr("kind", "mykind")
+	upd.SetAttr("Extra", "foo")
+	trans.UpdateNode("main", upd)
+
+	if err := trans.RollbackTo("doc2"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := trans.storeNodes[trans.createKey("main", "2", "mykind")].Attr("Extra"); res != nil {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Released savepoints cannot be used
+
+	if err := trans.ReleaseSavepoint("doc1"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := trans.RollbackTo("doc2"); err == nil || err.Error() != "GraphError: Invalid data (Unknown savepoint: doc2)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := trans.ReleaseSavepoint("doc1"); err == nil || err.Error() != "GraphError: Invalid data (Unknown savepoint: doc1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	trans.StoreNode("main", constructNode("5"))
+
+	if err := trans.Commit(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Only nodes which were added before the savepoint or after the release
+	// reach the storage
+
+	for _, key := range []string{"1", "2", "5"} {
+		if n, err := gm.FetchNode("main", key, "mykind"); n == nil || err != nil {
+			t.Error("Node should exist:", key, err)
+			return
+		}
+	}
+
+	for _, key := range []string{"3", "4"} {
+		if n, err := gm.FetchNode("main", key, "mykind"); n != nil || err != nil {
+			t.Error("Node should not exist:", key, err)
+			return
+		}
+	}
+
+	if cnt := gm.NodeCount("mykind"); cnt != 3 {
+		t.Error("Unexpected node count:", cnt)
+		return
+	}
+
+	// Commit consumes all savepoints
+
+	trans.Savepoint("after")
+
+	if err := trans.Commit(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := trans.RollbackTo("after"); err == nil {
+		t.Error("Savepoint should have been released by the commit")
+		return
+	}
+}
+
+func TestTransConflictDetection(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	constructNode := func(key string, counter int) data.Node {
+		node := data.NewGraphNode()
+		node.SetAttr("key", key)
+		node.SetAttr("kind", "mykind")
+		node.SetAttr("Counter", counter)
+		return node
+	}
+
+	// Check node versions
+
+	if _, err := gm.NodeVersion("my main", "1", "mykind"); err == nil {
+		t.Error("Invalid partition name should cause an error")
+		return
+	}
+
+	if v, err := gm.NodeVersion("main", "1", "mykind"); v != 0 || err != nil {
+		t.Error("Unexpected result:", v, err)
+		return
+	}
+
+	gm.StoreNode("main", constructNode("1", 0))
+
+	v1, _ := gm.NodeVersion("main", "1", "mykind")
+	gm.UpdateNode("main", constructNode("1", 0))
+	v2, _ := gm.NodeVersion("main", "1", "mykind")
+
+	if v1 == 0 || v2 <= v1 {
+		t.Error("Unexpected versions:", v1, v2)
+		return
+	}
+
+	gm.RemoveNode("main", "1", "mykind")
+
+	if v, err := gm.NodeVersion("main", "1", "mykind"); v != 0 || err != nil {
+		t.Error("Unexpected result:", v, err)
+		return
+	}
+
+	// A re-created node does not reuse an old version
+
+	gm.StoreNode("main", constructNode("1", 0))
+
+	if v, _ := gm.NodeVersion("main", "1", "mykind"); v <= v2 {
+		t.Error("Unexpected version:", v)
+		return
+	}
+
+	// Two transactions which update the same node
+
+	trans1 := NewGraphTrans(gm)
+	trans1.SetConflictDetection(true)
+	trans2 := NewGraphTrans(gm)
+	trans2.SetConflictDetection(true)
+
+	n1, _ := trans1.FetchNode("main", "1", "mykind")
+	n2, _ := trans2.FetchNode("main", "1", "mykind")
+
+	trans1.StoreNode("main", constructNode("1", n1.Attr("Counter").(int)+1))
+	trans2.StoreNode("main", constructNode("1", n2.Attr("Counter").(int)+1))
+	trans2.StoreNode("main", constructNode("2", 0))
+
+	if err := trans1.Commit(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	err := trans2.Commit()
+	if err == nil || err.(*util.GraphError).Type != util.ErrTransConflict ||
+		err.Error() != "GraphError: Transaction conflict (Node 1 (mykind) in main)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if !trans2.IsEmpty() {
+		t.Error("Failed transaction should be empty")
+		return
+	}
+
+	if n, _ := gm.FetchNode("main", "2", "mykind"); n != nil {
+		t.Error("Unexpected result:", n)
+		return
+	}
+
+	// Creating the same node twice is also a conflict
+
+	trans1.StoreNode("main", constructNode("3", 0))
+	trans2.StoreNode("main", constructNode("3", 1))
+
+	if err := trans1.Commit(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := trans2.Commit(); err == nil || err.Error() != "GraphError: Transaction conflict (Node 3 (mykind) in main)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Without conflict detection the last write wins
+
+	trans1 = NewGraphTrans(gm)
+	trans2 = NewGraphTrans(gm)
+
+	trans1.StoreNode("main", constructNode("1", 10))
+	trans2.StoreNode("main", constructNode("1", 20))
+
+	if err := trans1.Commit(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := trans2.Commit(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if n, _ := gm.FetchNode("main", "1", "mykind"); n.Attr("Counter") != 20 {
+		t.Error("Unexpected result:", n)
+		return
+	}
+
+	// Edges which were traversed are checked as well
+
+	edge := data.NewGraphEdge()
+	edge.SetAttr("key", "e1")
+	edge.SetAttr("kind", "myedge")
+	edge.SetAttr(data.EdgeEnd1Key, "1")
+	edge.SetAttr(data.EdgeEnd1Kind, "mykind")
+	edge.SetAttr(data.EdgeEnd1Role, "node1")
+	edge.SetAttr(data.EdgeEnd1Cascading, false)
+	edge.SetAttr(data.EdgeEnd2Key, "3")
+	edge.SetAttr(data.EdgeEnd2Kind, "mykind")
+	edge.SetAttr(data.EdgeEnd2Role, "node2")
+	edge.SetAttr(data.EdgeEnd2Cascading, false)
+
+	if err := gm.StoreEdge("main", edge); err != nil {
+		t.Error(err)
+		return
+	}
+
+	trans1 = NewGraphTrans(gm)
+	trans1.SetConflictDetection(true)
+
+	if nodes, _, err := trans1.TraverseMulti("main", "1", "mykind", ":::", false); len(nodes) != 1 || err != nil {
+		t.Error("Unexpected result:", nodes, err)
+		return
+	}
+
+	trans1.StoreNode("main", constructNode("4", 0))
+
+	gm.RemoveEdge("main", "e1", "myedge")
+
+	if err := trans1.Commit(); err == nil || err.Error() != "GraphError: Transaction conflict (Edge e1 (myedge) in main)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestTransConflictDetectionConcurrent(t *testing.T) {
+	mgs := graphstorage.NewMemoryGraphStorage("mystorage")
+	gm := NewGraphManager(mgs)
+
+	node := data.NewGraphNode()
+	node.SetAttr("key", "counter")
+	node.SetAttr("kind", "mykind")
+	node.SetAttr("Value", 0)
+	gm.StoreNode("main", node)
+
+	// Increment a counter concurrently - retry each transaction on conflict
+
+	increment := func() error {
+		for {
+			trans := NewGraphTrans(gm)
+			trans.SetConflictDetection(true)
+
+			node, err := trans.FetchNode("main", "counter", "mykind")
+			if err != nil {
+				return err
+			}
+
+			node.SetAttr("Value", node.Attr("Value").(int)+1)
+			trans.StoreNode("main", node)
+
+			err = trans.Commit()
+			if err == nil {
+				return nil
+			} else if err.(*util.GraphError).Type != util.ErrTransConflict {
+				return err
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if err := increment(); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+		return
+	}
+
+	if n, _ := gm.FetchNode("main", "counter", "mykind"); n.Attr("Value") != 100 {
+		t.Error("Unexpected result:", n)
+		return
+	}
+}
+
 func checkMaps(t *testing.T, trans *Trans, part string, ikey string, ikind string,
 	nodeStore bool, nodeRemove bool, edgeStore bool, edgeRemove bool) {
 
@@ -909,12 +1267,16 @@ func TestTransErrors(t *testing.T) {
 	}
 
 	sm = mgs.StorageManager("main"+"myedge"+StorageSuffixEdgesIndex, false).(*storage.MemoryStorageManager)
-	sm.AccessMap[4] = storage.AccessCacheAndFetchError
+	for i := uint64(2); i < sm.LocCount; i++ {
+		sm.AccessMap[i] = storage.AccessCacheAndFetchError
+	}
 	if err := trans.Commit(); !strings.Contains(fmt.Sprint(err), "GraphError: Index error") {
 		t.Error("Unexpected error return:", err)
 		return
 	}
-	delete(sm.AccessMap, 4)
+	for i := uint64(2); i < sm.LocCount; i++ {
+		delete(sm.AccessMap, i)
+	}
 
 	// Test edge deletion errors
 
@@ -1026,12 +1388,12 @@ func TestTransErrors(t *testing.T) {
 	}
 
 	sm = mgs.StorageManager("main"+deleteEdge.End2Kind()+StorageSuffixNodes, false).(*storage.MemoryStorageManager)
-	sm.AccessMap[5] = storage.AccessCacheAndFetchError
+	sm.AccessMap[6] = storage.AccessCacheAndFetchError
 	if err := trans2.Commit(); !strings.Contains(fmt.Sprint(err), "GraphError: Could not read graph information") {
 		t.Error("Unexpected error return:", err)
 		return
 	}
-	delete(sm.AccessMap, 5)
+	delete(sm.AccessMap, 6)
 }
 
 func testTransPanic(t *testing.T) {
@@ -0,0 +1,187 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"devt.de/common/stringutil"
+)
+
+/*
+Token is a single word which was produced by an analyzer.
+*/
+type Token struct {
+	Word  string // Normalized word
+	Pos   uint64 // Position of the word (starting at 1)
+	Start int    // Offset of the first character of the word in the tokenized string (in runes)
+	End   int    // Offset after the last character of the word (0 if offsets are not known)
+}
+
+/*
+Analyzer models the tokenization of attribute values for the full text index.
+*/
+type Analyzer interface {
+
+	/*
+		Name returns a unique name of this analyzer. The name is stored with
+		the index and is used to detect analyzer changes.
+	*/
+	Name() string
+
+	/*
+		Tokenize splits a given string into normalized words with positions.
+		Consecutive words must have consecutive positions for phrase lookups
+		to work. The character offsets of the words are used to highlight
+		matches and are optional.
+	*/
+	Tokenize(s string) []Token
+
+	/*
+		Normalize normalizes a single query term.
+	*/
+	Normalize(s string) string
+}
+
+/*
+DefaultAnalyzer is the default analyzer which splits strings on spaces,
+control characters and punctuation. Words are folded to lower case unless
+CaseSensitiveWordIndex is set.
+*/
+type DefaultAnalyzer struct {
+}
+
+/*
+Name returns the name of this analyzer.
+*/
+func (da *DefaultAnalyzer) Name() string {
+	return "default"
+}
+
+/*
+Tokenize splits a given string into normalized words with positions.
+*/
+func (da *DefaultAnalyzer) Tokenize(s string) []Token {
+	var ret []Token
+	var pos uint64
+
+	text := da.Normalize(s)
+	wstart := -1
+
+	// Offsets are counted in runes - normalization maps every rune to a
+	// single rune so the offsets are also valid for the given string
+
+	var offset, wstartOffset int
+
+	for i, rune := range text {
+
+		if isWordSeparator(rune) {
+
+			if wstart >= 0 {
+				pos++
+				ret = append(ret, Token{text[wstart:i], pos, wstartOffset, offset})
+				wstart = -1
+			}
+
+		} else if wstart == -1 {
+			wstart = i
+			wstartOffset = offset
+		}
+
+		offset++
+	}
+
+	if wstart >= 0 {
+		ret = append(ret, Token{text[wstart:], pos + 1, wstartOffset, offset})
+	}
+
+	return ret
+}
+
+/*
+Normalize normalizes a single query term.
+*/
+func (da *DefaultAnalyzer) Normalize(s string) string {
+	if CaseSensitiveWordIndex {
+		return s
+	}
+
+	return strings.ToLower(s)
+}
+
+/*
+isWordSeparator checks if a given rune separates words.
+*/
+func isWordSeparator(r rune) bool {
+	return !stringutil.IsAlphaNumeric(string(r)) && (unicode.IsSpace(r) || unicode.IsControl(r) || unicode.IsPunct(r))
+}
+
+/*
+NGramAnalyzer is an analyzer which splits strings into overlapping character
+n-grams. A phrase lookup with this analyzer finds all values which contain a
+given substring (the substring must be at least N characters long). Values
+which are shorter than N characters produce a single token.
+*/
+type NGramAnalyzer struct {
+	N int // Number of characters of each n-gram
+}
+
+/*
+NewNGramAnalyzer creates a new n-gram analyzer.
+*/
+func NewNGramAnalyzer(n int) *NGramAnalyzer {
+	if n < 1 {
+		n = 1
+	}
+
+	return &NGramAnalyzer{n}
+}
+
+/*
+Name returns the name of this analyzer.
+*/
+func (na *NGramAnalyzer) Name() string {
+	return fmt.Sprintf("ngram%v", na.N)
+}
+
+/*
+Tokenize splits a given string into n-grams with positions.
+*/
+func (na *NGramAnalyzer) Tokenize(s string) []Token {
+	runes := []rune(na.Normalize(s))
+
+	if len(runes) == 0 {
+		return nil
+	} else if len(runes) <= na.N {
+		return []Token{{string(runes), 1, 0, len(runes)}}
+	}
+
+	ret := make([]Token, 0, len(runes)-na.N+1)
+
+	for i := 0; i+na.N <= len(runes); i++ {
+		ret = append(ret, Token{string(runes[i : i+na.N]), uint64(i + 1), i, i + na.N})
+	}
+
+	return ret
+}
+
+/*
+Normalize normalizes a single query term.
+*/
+func (na *NGramAnalyzer) Normalize(s string) string {
+	if CaseSensitiveWordIndex {
+		return s
+	}
+
+	return strings.ToLower(s)
+}
@@ -0,0 +1,97 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDefaultAnalyzer(t *testing.T) {
+
+	oldsetting := CaseSensitiveWordIndex
+
+	CaseSensitiveWordIndex = false
+
+	da := &DefaultAnalyzer{}
+
+	if res := da.Name(); res != "default" {
+		t.Error("Unexpected name:", res)
+		return
+	}
+
+	if res := fmt.Sprint(da.Tokenize("  The CODE, ab-1234/X  ")); res != "[{the 1 2 5} {code 2 6 10} {ab 3 12 14} {1234 4 15 19} {x 5 20 21}]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := da.Tokenize(" ;, "); res != nil {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := da.Normalize("Über"); res != "über" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	CaseSensitiveWordIndex = true
+
+	if res := fmt.Sprint(da.Tokenize("The CODE")); res != "[{The 1 0 3} {CODE 2 4 8}]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	CaseSensitiveWordIndex = oldsetting
+}
+
+func TestNGramAnalyzer(t *testing.T) {
+
+	oldsetting := CaseSensitiveWordIndex
+
+	CaseSensitiveWordIndex = false
+
+	na := NewNGramAnalyzer(3)
+
+	if res := na.Name(); res != "ngram3" {
+		t.Error("Unexpected name:", res)
+		return
+	}
+
+	if res := fmt.Sprint(na.Tokenize("AB-12")); res != "[{ab- 1 0 3} {b-1 2 1 4} {-12 3 2 5}]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Multi-byte characters are not split
+
+	if res := fmt.Sprint(na.Tokenize("Café")); res != "[{caf 1 0 3} {afé 2 1 4}]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := fmt.Sprint(na.Tokenize("Ab")); res != "[{ab 1 0 2}]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := na.Tokenize(""); res != nil {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := NewNGramAnalyzer(0).Name(); res != "ngram1" {
+		t.Error("Unexpected name:", res)
+		return
+	}
+
+	CaseSensitiveWordIndex = oldsetting
+}
@@ -0,0 +1,86 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io/ioutil"
+)
+
+/*
+Compressor models the compression of large attribute values.
+*/
+type Compressor interface {
+
+	/*
+		Name returns a unique name of this compressor. The name is stored with
+		every compressed value and is used to find the compressor which can
+		decompress the value.
+	*/
+	Name() string
+
+	/*
+		Compress compresses a given byte slice.
+	*/
+	Compress(b []byte) ([]byte, error)
+
+	/*
+		Decompress decompresses a given byte slice which was produced by
+		Compress.
+	*/
+	Decompress(b []byte) ([]byte, error)
+}
+
+/*
+ZlibCompressor is a compressor which uses the zlib format.
+*/
+type ZlibCompressor struct {
+}
+
+/*
+Name returns the name of this compressor.
+*/
+func (zc *ZlibCompressor) Name() string {
+	return "zlib"
+}
+
+/*
+Compress compresses a given byte slice.
+*/
+func (zc *ZlibCompressor) Compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w := zlib.NewWriter(&buf)
+
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+/*
+Decompress decompresses a given byte slice which was produced by Compress.
+*/
+func (zc *ZlibCompressor) Decompress(b []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
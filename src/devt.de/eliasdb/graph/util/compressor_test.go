@@ -0,0 +1,44 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestZlibCompressor(t *testing.T) {
+
+	zc := &ZlibCompressor{}
+
+	if res := zc.Name(); res != "zlib" {
+		t.Error("Unexpected name:", res)
+		return
+	}
+
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 100)
+
+	comp, err := zc.Compress([]byte(text))
+	if err != nil || len(comp) >= len(text) {
+		t.Error("Unexpected result:", len(comp), err)
+		return
+	}
+
+	if res, err := zc.Decompress(comp); err != nil || string(res) != text {
+		t.Error("Unexpected result:", string(res), err)
+		return
+	}
+
+	if res, err := zc.Decompress([]byte("foo")); err == nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+}
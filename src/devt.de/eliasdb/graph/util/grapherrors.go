@@ -14,14 +14,18 @@ Package util contains utility classes for the graph storage.
 GraphError
 
 Models a graph related error. Low-level errors should be wrapped in a GraphError
-before they are returned to a client.
+before they are returned to a client. The error type and the wrapped low-level
+error can be checked with errors.Is:
+
+	errors.Is(err, util.ErrReading)
+	errors.Is(err, util.ErrNotFound)
 
 IndexManager
 
-Manages the full text search index. The index supports simple word searches as
-well as phrase searches.
+Manages the full text search index. The index supports simple word searches,
+fuzzy word searches as well as phrase searches.
 
-The index is a basically a key-value lookup which manages 2 types of entries:
+The index is a basically a key-value lookup which manages 3 types of entries:
 
 Each node attribute value is split up into words. Each word gets an entry:
 
@@ -34,11 +38,23 @@ value lookups very efficient:
 PrefixAttrHash + attr num + hash (md5) -> ids
 (provides exact match lookup)
 
+Each indexed word is also stored under all its variants which can be produced
+by deleting up to MaxFuzzyDistance characters:
+
+PrefixAttrFuzzy + attr num + variant (string) -> words
+(provides fuzzy word lookup within a Levenshtein distance)
+
 NamesManager
 
 Manages names of kinds, roles and attributes. Each stored name gets either a 16
 or 32 bit (little endian) number assigned. The manager provides functions to lookup
 either the names or their numbers.
+
+Request IDs
+
+The REST API assigns an ID to each request and stores it in the request context
+(see WithRequestID). Graph operations which get a context can add the ID to
+their own log lines (see RequestIDFromContext).
 */
 package util
 
@@ -53,6 +69,7 @@ GraphError is a graph related error
 type GraphError struct {
 	Type   error  // Error type (to be used for equal checks)
 	Detail string // Details of this error
+	Cause  error  // Underlying error (may be nil)
 }
 
 /*
@@ -61,11 +78,27 @@ Error returns a human-readable string representation of this error.
 func (ge *GraphError) Error() string {
 	if ge.Detail != "" {
 		return fmt.Sprintf("GraphError: %v (%v)", ge.Type, ge.Detail)
+	} else if ge.Cause != nil {
+		return fmt.Sprintf("GraphError: %v (%v)", ge.Type, ge.Cause)
 	}
 
 	return fmt.Sprintf("GraphError: %v", ge.Type)
 }
 
+/*
+Is checks if this error is of a given error type.
+*/
+func (ge *GraphError) Is(target error) bool {
+	return ge.Type == target
+}
+
+/*
+Unwrap returns the underlying error of this error.
+*/
+func (ge *GraphError) Unwrap() error {
+	return ge.Cause
+}
+
 /*
 Graph storage related error types
 */
@@ -82,9 +115,22 @@ var (
 Graph related error types
 */
 var (
-	ErrInvalidData = errors.New("Invalid data")
-	ErrIndexError  = errors.New("Index error")
-	ErrReading     = errors.New("Could not read graph information")
-	ErrWriting     = errors.New("Could not write graph information")
-	ErrRule        = errors.New("Graph rule error")
+	ErrInvalidData    = errors.New("Invalid data")
+	ErrIndexError     = errors.New("Index error")
+	ErrIndexStale     = errors.New("Index is stale")
+	ErrKindNotIndexed = errors.New("Kind is not indexed")
+	ErrReading        = errors.New("Could not read graph information")
+	ErrWriting        = errors.New("Could not write graph information")
+	ErrRule           = errors.New("Graph rule error")
+	ErrCardinality    = errors.New("Edge cardinality constraint violated")
+	ErrTransConflict  = errors.New("Transaction conflict")
+
+	ErrConcurrentModification = errors.New("Concurrent modification")
+	ErrClosed                 = errors.New("Graph manager was closed")
 )
+
+/*
+ErrNotFound is the underlying error of all errors which are caused by a
+missing node, edge, kind or other named item.
+*/
+var ErrNotFound = errors.New("Not found")
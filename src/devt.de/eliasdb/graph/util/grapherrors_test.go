@@ -12,21 +12,56 @@ package util
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 )
 
 func TestGraphError(t *testing.T) {
-	err := GraphError{errors.New("TestError"), ""}
+	err := GraphError{errors.New("TestError"), "", nil}
 
 	if err.Error() != "GraphError: TestError" {
 		t.Error("Unexpected result", err.Error())
 		return
 	}
 
-	err = GraphError{errors.New("TestError"), "SomeDetail"}
+	err = GraphError{errors.New("TestError"), "SomeDetail", nil}
 
 	if err.Error() != "GraphError: TestError (SomeDetail)" {
 		t.Error("Unexpected result", err.Error())
 		return
 	}
+
+	// Test errors.Is and errors.As support
+
+	cause := errors.New("CauseError")
+
+	var gerr error = &GraphError{ErrReading, "", cause}
+
+	if gerr.Error() != "GraphError: Could not read graph information (CauseError)" {
+		t.Error("Unexpected result", gerr.Error())
+		return
+	}
+
+	wrapped := fmt.Errorf("wrapped: %w", gerr)
+
+	if !errors.Is(wrapped, ErrReading) || !errors.Is(wrapped, cause) ||
+		errors.Is(wrapped, ErrWriting) || errors.Is(wrapped, ErrNotFound) {
+		t.Error("Unexpected result")
+		return
+	}
+
+	var ge *GraphError
+
+	if !errors.As(wrapped, &ge) || ge.Type != ErrReading || ge.Unwrap() != cause {
+		t.Error("Unexpected result", ge)
+		return
+	}
+
+	gerr = &GraphError{ErrInvalidData, "Missing", ErrNotFound}
+
+	if gerr.Error() != "GraphError: Invalid data (Missing)" ||
+		!errors.Is(gerr, ErrNotFound) || !errors.Is(gerr, ErrInvalidData) {
+		t.Error("Unexpected result", gerr.Error())
+		return
+	}
 }
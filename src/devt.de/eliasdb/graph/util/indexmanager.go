@@ -18,7 +18,6 @@ import (
 	"math"
 	"sort"
 	"strings"
-	"unicode"
 
 	"devt.de/common/bitutil"
 	"devt.de/common/sortutil"
@@ -46,11 +45,33 @@ PrefixAttrHash is the prefix used for hashes of attribute values
 */
 const PrefixAttrHash = string(0x02)
 
+/*
+PrefixAttrFuzzy is the prefix used for deletion variants of words
+*/
+const PrefixAttrFuzzy = "\x03"
+
+/*
+MaxFuzzyDistance is the maximum Levenshtein distance for fuzzy word lookups.
+*/
+const MaxFuzzyDistance = 2
+
 /*
 IndexManager data structure
 */
 type IndexManager struct {
-	htree *hash.HTree // Persistent HTree which stores this index
+	htree     *hash.HTree         // Persistent HTree which stores this index
+	analyzers map[string]Analyzer // Analyzers for attributes (default analyzer if not set)
+	stale     map[string]string   // Attributes with a stale index and the reason
+	mirror    *IndexManager       // Index manager which receives all updates (may be nil)
+}
+
+/*
+FuzzyMatch data structure which holds a word found by a fuzzy lookup.
+*/
+type FuzzyMatch struct {
+	Word     string              // Matched word
+	Distance int                 // Levenshtein distance to the searched word
+	Keys     map[string][]uint64 // Node keys to word positions
 }
 
 /*
@@ -71,7 +92,59 @@ func init() {
 NewIndexManager creates a new index manager instance.
 */
 func NewIndexManager(htree *hash.HTree) *IndexManager {
-	return &IndexManager{htree}
+	return &IndexManager{htree, make(map[string]Analyzer), make(map[string]string), nil}
+}
+
+/*
+SetAnalyzer sets the analyzer which is used to tokenize the values of a given
+attribute. A nil analyzer resets the attribute to the default analyzer.
+*/
+func (im *IndexManager) SetAnalyzer(attr string, analyzer Analyzer) {
+	if analyzer == nil {
+		delete(im.analyzers, attr)
+		return
+	}
+
+	im.analyzers[attr] = analyzer
+}
+
+/*
+SetMirror sets an index manager which receives all updates of this index
+manager. This can be used to keep a second index up to date while it is
+being built.
+*/
+func (im *IndexManager) SetMirror(mirror *IndexManager) {
+	im.mirror = mirror
+}
+
+/*
+SetStale marks the index of a given attribute as stale. Lookups on a stale
+attribute return an error with the given detail.
+*/
+func (im *IndexManager) SetStale(attr string, detail string) {
+	im.stale[attr] = detail
+}
+
+/*
+analyzer returns the analyzer of a given attribute.
+*/
+func (im *IndexManager) analyzer(attr string) Analyzer {
+	if analyzer, ok := im.analyzers[attr]; ok {
+		return analyzer
+	}
+
+	return defaultAnalyzer
+}
+
+/*
+checkStale returns an error if the index of a given attribute is stale.
+*/
+func (im *IndexManager) checkStale(attr string) error {
+	if detail, ok := im.stale[attr]; ok {
+		return &GraphError{ErrIndexStale, detail, nil}
+	}
+
+	return nil
 }
 
 /*
@@ -103,11 +176,17 @@ call returns a list of node keys which contain the phrase at least once.
 */
 func (im *IndexManager) LookupPhrase(attr, phrase string) ([]string, error) {
 
+	if err := im.checkStale(attr); err != nil {
+		return nil, err
+	}
+
 	// Chop up the phrase into words
 
-	phraseWords := strings.FieldsFunc(phrase, func(r rune) bool {
-		return !stringutil.IsAlphaNumeric(string(r)) && (unicode.IsSpace(r) || unicode.IsControl(r) || unicode.IsPunct(r))
-	})
+	var phraseWords []string
+
+	for _, token := range im.analyzer(attr).Tokenize(phrase) {
+		phraseWords = append(phraseWords, token.Word)
+	}
 
 	// Lookup every phrase word
 
@@ -115,9 +194,9 @@ func (im *IndexManager) LookupPhrase(attr, phrase string) ([]string, error) {
 
 	for i, phraseWord := range phraseWords {
 
-		res, err := im.LookupWord(attr, phraseWord)
+		res, err := im.lookupWord(attr, phraseWord)
 		if err != nil {
-			return nil, &GraphError{ErrIndexError, err.Error()}
+			return nil, &GraphError{ErrIndexError, err.Error(), err}
 		}
 
 		results[i] = res
@@ -191,10 +270,16 @@ func (im *IndexManager) findPhrasePath(key string, index int, path []uint64,
 
 			}
 
+			// Abort if none of the positions continues the phrase
+
+			if len(path) != index+1 {
+				return len(path)
+			}
+
 			// Do the next iteration if a position was found and
 			// there are more words in the phrase to match
 
-			if len(path) == index+1 && index < len(phraseWords)-1 {
+			if index < len(phraseWords)-1 {
 				return im.findPhrasePath(key, index+1, path, phraseWords, results)
 			}
 
@@ -233,18 +318,23 @@ LookupWord finds all nodes where an attribute contains a certain word. This call
 a map which maps node key to a list of word positions.
 */
 func (im *IndexManager) LookupWord(attr, word string) (map[string][]uint64, error) {
-	var s string
 
-	if CaseSensitiveWordIndex {
-		s = word
-	} else {
-		s = strings.ToLower(word)
+	if err := im.checkStale(attr); err != nil {
+		return nil, err
 	}
 
-	entry, err := im.htree.Get([]byte(PrefixAttrWord + attr + s))
+	return im.lookupWord(attr, im.analyzer(attr).Normalize(word))
+}
+
+/*
+lookupWord finds all nodes where an attribute contains a given normalized word.
+*/
+func (im *IndexManager) lookupWord(attr, word string) (map[string][]uint64, error) {
+
+	entry, err := im.htree.Get([]byte(PrefixAttrWord + attr + word))
 
 	if err != nil {
-		return nil, &GraphError{ErrIndexError, err.Error()}
+		return nil, &GraphError{ErrIndexError, err.Error(), err}
 	} else if entry == nil {
 		return nil, nil
 	}
@@ -258,6 +348,83 @@ func (im *IndexManager) LookupWord(attr, word string) (map[string][]uint64, erro
 	return ret, nil
 }
 
+/*
+LookupWordFuzzy finds all words of an attribute which are within a given
+Levenshtein distance of a given word. The distance is capped at
+MaxFuzzyDistance. This call returns a list of matches which is sorted by
+distance and word.
+*/
+func (im *IndexManager) LookupWordFuzzy(attr, word string, maxDist int) ([]*FuzzyMatch, error) {
+
+	if err := im.checkStale(attr); err != nil {
+		return nil, err
+	}
+
+	s := im.analyzer(attr).Normalize(word)
+
+	if maxDist > MaxFuzzyDistance {
+		maxDist = MaxFuzzyDistance
+	} else if maxDist < 0 {
+		maxDist = 0
+	}
+
+	// Collect candidate words - two words are within a distance d if they
+	// share a variant which can be reached by at most d deletions
+
+	variants := deletionVariants(s, maxDist)
+	variants[s] = true
+
+	candidates := make(map[string]bool)
+
+	for variant := range variants {
+
+		// A variant might be an indexed word itself
+
+		candidates[variant] = true
+
+		entry, err := im.htree.Get([]byte(PrefixAttrFuzzy + attr + variant))
+		if err != nil {
+			return nil, &GraphError{ErrIndexError, err.Error(), err}
+		} else if entry == nil {
+			continue
+		}
+
+		for w := range entry.(*indexEntry).WordPos {
+			candidates[w] = true
+		}
+	}
+
+	// Verify the distance of all candidates
+
+	var ret []*FuzzyMatch
+
+	for candidate := range candidates {
+
+		dist := stringutil.LevenshteinDistance(s, candidate)
+		if dist > maxDist {
+			continue
+		}
+
+		keys, err := im.lookupWord(attr, candidate)
+		if err != nil {
+			return nil, err
+		} else if keys != nil {
+			ret = append(ret, &FuzzyMatch{candidate, dist, keys})
+		}
+	}
+
+	// Guarantee a stable result
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Distance != ret[j].Distance {
+			return ret[i].Distance < ret[j].Distance
+		}
+		return ret[i].Word < ret[j].Word
+	})
+
+	return ret, nil
+}
+
 /*
 LookupValue finds all nodes where an attribute has a certain value. This call
 returns a list of node keys.
@@ -279,7 +446,7 @@ func (im *IndexManager) LookupValue(attr, value string) ([]string, error) {
 	obj, err := im.htree.Get(indexkey)
 
 	if err != nil {
-		return nil, &GraphError{ErrIndexError, err.Error()}
+		return nil, &GraphError{ErrIndexError, err.Error(), err}
 	}
 
 	if obj == nil {
@@ -303,18 +470,17 @@ func (im *IndexManager) LookupValue(attr, value string) ([]string, error) {
 Count returns the number of found nodes for a given word in a given attribute.
 */
 func (im *IndexManager) Count(attr, word string) (int, error) {
-	var s string
 
-	if CaseSensitiveWordIndex {
-		s = word
-	} else {
-		s = strings.ToLower(word)
+	if err := im.checkStale(attr); err != nil {
+		return 0, err
 	}
 
+	s := im.analyzer(attr).Normalize(word)
+
 	entry, err := im.htree.Get([]byte(PrefixAttrWord + attr + s))
 
 	if err != nil {
-		return 0, &GraphError{ErrIndexError, err.Error()}
+		return 0, &GraphError{ErrIndexError, err.Error(), err}
 	} else if entry == nil {
 		return 0, nil
 	}
@@ -322,6 +488,79 @@ func (im *IndexManager) Count(attr, word string) (int, error) {
 	return len(entry.(*indexEntry).WordPos), nil
 }
 
+/*
+CheckEntries checks a list of index entries for references to keys which no
+longer exist. A given function is used to determine if a key exists. If the
+repair flag is set then all references to non-existing keys are removed from
+the index. Returns a sorted list of all non-existing keys which were found.
+*/
+func (im *IndexManager) CheckEntries(indexkeys []string, exists func(key string) (bool, error),
+	repair bool) ([]string, error) {
+
+	var ret []string
+
+	missing := make(map[string]bool)
+
+	for _, indexkey := range indexkeys {
+
+		// Fuzzy lookup entries reference words and not keys
+
+		if strings.HasPrefix(indexkey, PrefixAttrFuzzy) {
+			continue
+		}
+
+		obj, err := im.htree.Get([]byte(indexkey))
+		if err != nil {
+			return nil, &GraphError{ErrIndexError, err.Error(), err}
+		} else if obj == nil {
+			continue
+		}
+
+		entry := obj.(*indexEntry)
+		changed := false
+
+		for key := range entry.WordPos {
+
+			isMissing, ok := missing[key]
+
+			if !ok {
+				ok, err := exists(key)
+				if err != nil {
+					return nil, err
+				}
+
+				isMissing = !ok
+				missing[key] = isMissing
+
+				if isMissing {
+					ret = append(ret, key)
+				}
+			}
+
+			if isMissing && repair {
+				delete(entry.WordPos, key)
+				changed = true
+			}
+		}
+
+		if changed {
+			if len(entry.WordPos) == 0 {
+				_, err = im.htree.Remove([]byte(indexkey))
+			} else {
+				_, err = im.htree.Put([]byte(indexkey), entry)
+			}
+
+			if err != nil {
+				return nil, &GraphError{ErrIndexError, err.Error(), err}
+			}
+		}
+	}
+
+	sort.StringSlice(ret).Sort()
+
+	return ret, nil
+}
+
 /*
 updateIndex updates the index for a specific object. Depending on the
 new and old arguments being set a given object is either indexed/added
@@ -375,7 +614,7 @@ func (im *IndexManager) updateIndex(key string, newObj map[string]string,
 		oldwords = emptyws
 
 		if newok {
-			newwords = extractWords(newval)
+			newwords = im.extractWords(attr, newval)
 		}
 
 		// At this point we have only words to add
@@ -384,7 +623,7 @@ func (im *IndexManager) updateIndex(key string, newObj map[string]string,
 		toremove = emptyws
 
 		if oldok {
-			oldwords = extractWords(oldval)
+			oldwords = im.extractWords(attr, oldval)
 
 			if !oldwords.Empty() && !newwords.Empty() {
 
@@ -408,13 +647,13 @@ func (im *IndexManager) updateIndex(key string, newObj map[string]string,
 
 		for w, p := range toremove.set {
 			if err := im.removeIndexEntry(key, attr, w, p); err != nil {
-				return &GraphError{ErrIndexError, err.Error()}
+				return &GraphError{ErrIndexError, err.Error(), err}
 			}
 		}
 
 		for w, p := range toadd.set {
 			if err := im.addIndexEntry(key, attr, w, p); err != nil {
-				return &GraphError{ErrIndexError, err.Error()}
+				return &GraphError{ErrIndexError, err.Error(), err}
 			}
 		}
 
@@ -425,9 +664,9 @@ func (im *IndexManager) updateIndex(key string, newObj map[string]string,
 			// Update hash entry
 
 			if err := im.removeIndexHashEntry(key, attr, oldval); err != nil {
-				return &GraphError{ErrIndexError, err.Error()}
+				return &GraphError{ErrIndexError, err.Error(), err}
 			} else if err := im.addIndexHashEntry(key, attr, newval); err != nil {
-				return &GraphError{ErrIndexError, err.Error()}
+				return &GraphError{ErrIndexError, err.Error(), err}
 			}
 
 		} else if newok && !oldok {
@@ -435,7 +674,7 @@ func (im *IndexManager) updateIndex(key string, newObj map[string]string,
 			// Insert hash entry
 
 			if err := im.addIndexHashEntry(key, attr, newval); err != nil {
-				return &GraphError{ErrIndexError, err.Error()}
+				return &GraphError{ErrIndexError, err.Error(), err}
 			}
 
 		} else if oldok {
@@ -443,11 +682,15 @@ func (im *IndexManager) updateIndex(key string, newObj map[string]string,
 			// Delete old hash entry
 
 			if err := im.removeIndexHashEntry(key, attr, oldval); err != nil {
-				return &GraphError{ErrIndexError, err.Error()}
+				return &GraphError{ErrIndexError, err.Error(), err}
 			}
 		}
 	}
 
+	if im.mirror != nil {
+		return im.mirror.updateIndex(key, newObj, oldObj)
+	}
+
 	return nil
 }
 
@@ -575,7 +818,9 @@ func (im *IndexManager) removeIndexEntry(key string, attr string, word string, p
 	}
 
 	if len(entry.WordPos) == 0 {
-		_, err = im.htree.Remove(indexkey)
+		if _, err = im.htree.Remove(indexkey); err == nil {
+			err = im.updateFuzzyEntries(attr, word, false)
+		}
 	} else {
 		_, err = im.htree.Put(indexkey, entry)
 	}
@@ -600,6 +845,13 @@ func (im *IndexManager) addIndexEntry(key string, attr string, word string, pos
 
 	if obj == nil {
 		entry = &indexEntry{make(map[string]string)}
+
+		// Add deletion variants for new words
+
+		if err := im.updateFuzzyEntries(attr, word, true); err != nil {
+			return err
+		}
+
 	} else {
 		entry = obj.(*indexEntry)
 	}
@@ -632,6 +884,83 @@ func (im *IndexManager) addIndexEntry(key string, attr string, word string, pos
 	return err
 }
 
+/*
+updateFuzzyEntries adds or removes a word to / from the entries of all its
+deletion variants. A deletion variant is a word with up to MaxFuzzyDistance
+characters removed.
+*/
+func (im *IndexManager) updateFuzzyEntries(attr string, word string, add bool) error {
+	var entry *indexEntry
+
+	for variant := range deletionVariants(word, MaxFuzzyDistance) {
+
+		indexkey := []byte(PrefixAttrFuzzy + attr + variant)
+
+		obj, err := im.htree.Get(indexkey)
+		if err != nil {
+			return err
+		}
+
+		if obj == nil {
+			if !add {
+				continue
+			}
+			entry = &indexEntry{make(map[string]string)}
+		} else {
+			entry = obj.(*indexEntry)
+		}
+
+		if add {
+			entry.WordPos[word] = ""
+		} else {
+			delete(entry.WordPos, word)
+		}
+
+		if len(entry.WordPos) == 0 {
+			_, err = im.htree.Remove(indexkey)
+		} else {
+			_, err = im.htree.Put(indexkey, entry)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+deletionVariants returns all variants of a word which can be produced by
+removing up to a given number of characters. The word itself is not part
+of the result.
+*/
+func deletionVariants(word string, maxDist int) map[string]bool {
+	ret := make(map[string]bool)
+	current := []string{word}
+
+	for i := 0; i < maxDist; i++ {
+		var next []string
+
+		for _, w := range current {
+			runes := []rune(w)
+
+			for j := range runes {
+				variant := string(runes[:j]) + string(runes[j+1:])
+
+				if !ret[variant] {
+					ret[variant] = true
+					next = append(next, variant)
+				}
+			}
+		}
+
+		current = next
+	}
+
+	return ret
+}
+
 /*
 Remove all duplicates from a given sorted list.
 */
@@ -681,46 +1010,43 @@ func (im *IndexManager) String() string {
 }
 
 /*
-extractWords extracts all words from a given string and return a wordSet which contains
-all words and their positions.
+defaultAnalyzer is the analyzer which is used if no analyzer was set for an
+attribute.
 */
-func extractWords(s string) *wordSet {
+var defaultAnalyzer = &DefaultAnalyzer{}
 
-	var text string
+/*
+extractWords extracts all words from a given attribute value using the analyzer
+of the attribute and returns a wordSet which contains all words and their
+positions.
+*/
+func (im *IndexManager) extractWords(attr string, s string) *wordSet {
+	return newWordSetFromTokens(im.analyzer(attr).Tokenize(s), len(s))
+}
 
-	if CaseSensitiveWordIndex {
-		text = s
-	} else {
-		text = strings.ToLower(s)
-	}
+/*
+extractWords extracts all words from a given string using the default analyzer
+and returns a wordSet which contains all words and their positions.
+*/
+func extractWords(s string) *wordSet {
+	return newWordSetFromTokens(defaultAnalyzer.Tokenize(s), len(s))
+}
+
+/*
+newWordSetFromTokens creates a new wordSet from a list of tokens. The length
+of the analyzed string is used to estimate the capacity of position arrays.
+*/
+func newWordSetFromTokens(tokens []Token, length int) *wordSet {
 
-	initArrCap := int(math.Ceil(float64(len(text)) * 0.01))
+	initArrCap := int(math.Ceil(float64(length) * 0.01))
 	if initArrCap < 4 {
 		initArrCap = 4
 	}
 
 	ws := newWordSet(initArrCap)
 
-	var pos uint64
-	wstart := -1
-
-	for i, rune := range text {
-
-		if !stringutil.IsAlphaNumeric(string(rune)) && (unicode.IsSpace(rune) || unicode.IsControl(rune) || unicode.IsPunct(rune)) {
-
-			if wstart >= 0 {
-				ws.Add(text[wstart:i], pos+1)
-				pos++
-				wstart = -1
-			}
-
-		} else if wstart == -1 {
-			wstart = i
-		}
-	}
-
-	if wstart >= 0 {
-		ws.Add(text[wstart:], pos+1)
+	for _, token := range tokens {
+		ws.Add(token.Word, token.Pos)
 	}
 
 	return ws
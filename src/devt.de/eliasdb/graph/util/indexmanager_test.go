@@ -11,7 +11,9 @@
 package util
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"testing"
 
@@ -70,7 +72,7 @@ func TestIndexManager(t *testing.T) {
 		return
 	}
 
-	for i := 0; i < 6; i++ {
+	for i := 0; i < 100; i++ {
 		sm.AccessMap[uint64(i)] = storage.AccessCacheAndFetchError
 	}
 
@@ -89,7 +91,7 @@ func TestIndexManager(t *testing.T) {
 		return
 	}
 
-	for i := 0; i < 6; i++ {
+	for i := 0; i < 100; i++ {
 		delete(sm.AccessMap, uint64(i))
 	}
 
@@ -173,6 +175,30 @@ func TestPhraseSearch(t *testing.T) {
 		t.Error("Unexpected lookup result:", res, err)
 	}
 
+	// Words which appear in a different order do not match
+
+	obj5 := make(map[string]string)
+	obj5["ccc"] = "Memory ran OUT of it"
+
+	im.Index("testkey5", obj5)
+
+	obj6 := make(map[string]string)
+	obj6["ccc"] = "Out of memory error"
+
+	im.Index("testkey6", obj6)
+
+	res, err = im.LookupPhrase("ccc", "out of memory")
+
+	if fmt.Sprint(res) != "[testkey6]" || err != nil {
+		t.Error("Unexpected lookup result:", res, err)
+	}
+
+	res, err = im.LookupPhrase("ccc", "OUT OF, memory!")
+
+	if fmt.Sprint(res) != "[testkey6]" || err != nil {
+		t.Error("Unexpected lookup result:", res, err)
+	}
+
 	res, err = im.LookupPhrase("bbb", "test")
 
 	if fmt.Sprint(res) != "[testkey4]" || err != nil {
@@ -191,7 +217,7 @@ func TestPhraseSearch(t *testing.T) {
 		t.Error("Unexpected result:", res, err)
 	}
 
-	for i := 0; i < 10; i++ {
+	for i := 0; i < 100; i++ {
 		sm.AccessMap[uint64(i)] = storage.AccessCacheAndFetchError
 	}
 
@@ -205,11 +231,273 @@ func TestPhraseSearch(t *testing.T) {
 		return
 	}
 
-	for i := 0; i < 10; i++ {
+	for i := 0; i < 100; i++ {
+		delete(sm.AccessMap, uint64(i))
+	}
+}
+
+func TestFuzzySearch(t *testing.T) {
+
+	sm := storage.NewMemoryStorageManager("testsm")
+	htree, _ := hash.NewHTree(sm)
+
+	im := NewIndexManager(htree)
+
+	im.Index("key1", map[string]string{"aaa": "Receive the message"})
+	im.Index("key2", map[string]string{"aaa": "receiver of receive"})
+	im.Index("key3", map[string]string{"aaa": "deceive", "bbb": "receive"})
+
+	formatMatches := func(matches []*FuzzyMatch) string {
+		var res []string
+		for _, m := range matches {
+			res = append(res, fmt.Sprint(m.Word, ":", m.Distance, ":", m.Keys))
+		}
+		return fmt.Sprint(res)
+	}
+
+	res, err := im.LookupWordFuzzy("aaa", "RECIEVE", 2)
+
+	if res := formatMatches(res); res != "[receive:2:map[key1:[1] key2:[3]]]" || err != nil {
+		t.Error("Unexpected lookup result:", res, err)
+		return
+	}
+
+	res, err = im.LookupWordFuzzy("aaa", "receive", 1)
+
+	if res := formatMatches(res); res != "[receive:0:map[key1:[1] key2:[3]] "+
+		"deceive:1:map[key3:[1]] receiver:1:map[key2:[1]]]" || err != nil {
+		t.Error("Unexpected lookup result:", res, err)
+		return
+	}
+
+	// Distances are capped
+
+	res, err = im.LookupWordFuzzy("aaa", "recv", 99)
+
+	if res := formatMatches(res); res != "[]" || err != nil {
+		t.Error("Unexpected lookup result:", res, err)
+		return
+	}
+
+	res, err = im.LookupWordFuzzy("aaa", "receive", -1)
+
+	if res := formatMatches(res); res != "[receive:0:map[key1:[1] key2:[3]]]" || err != nil {
+		t.Error("Unexpected lookup result:", res, err)
+		return
+	}
+
+	// Removed words are no longer found
+
+	im.Deindex("key2", map[string]string{"aaa": "receiver of receive"})
+
+	res, err = im.LookupWordFuzzy("aaa", "receiver", 1)
+
+	if res := formatMatches(res); res != "[receive:1:map[key1:[1]]]" || err != nil {
+		t.Error("Unexpected lookup result:", res, err)
+		return
+	}
+
+	im.Deindex("key1", map[string]string{"aaa": "Receive the message"})
+	im.Deindex("key3", map[string]string{"aaa": "deceive", "bbb": "receive"})
+
+	// Deletion variants are removed together with their words
+
+	if it := hash.NewHTreeIterator(htree); it.HasNext() {
+		key, _ := it.Next()
+		t.Error("Unexpected index entry:", key)
+		return
+	}
+
+	sm = storage.NewMemoryStorageManager("testsm")
+	htree, _ = hash.NewHTree(sm)
+
+	im = NewIndexManager(htree)
+
+	im.Index("key1", map[string]string{"aaa": "receive"})
+
+	for i := 0; i < 100; i++ {
+		sm.AccessMap[uint64(i)] = storage.AccessCacheAndFetchError
+	}
+
+	if _, err := im.LookupWordFuzzy("aaa", "receive", 1); err == nil ||
+		!strings.Contains(err.Error(), "Slot not found") {
+		t.Error("Unexpected result:", err)
+	}
+
+	for i := 0; i < 100; i++ {
 		delete(sm.AccessMap, uint64(i))
 	}
 }
 
+func TestIndexAnalyzers(t *testing.T) {
+
+	sm := storage.NewMemoryStorageManager("testsm")
+	htree, _ := hash.NewHTree(sm)
+
+	im := NewIndexManager(htree)
+	im.SetAnalyzer("code", NewNGramAnalyzer(3))
+
+	im.Index("testkey1", map[string]string{"code": "AB-1234/X", "name": "Red Box"})
+	im.Index("testkey2", map[string]string{"code": "CD-1234/Y", "name": "Blue Box"})
+	im.Index("testkey3", map[string]string{"code": "AB-9999/X", "name": "AB-12"})
+
+	// N-gram attributes can be searched for substrings
+
+	res, err := im.LookupPhrase("code", "1234")
+	if fmt.Sprint(res) != "[testkey1 testkey2]" || err != nil {
+		t.Error("Unexpected lookup result:", res, err)
+		return
+	}
+
+	res, err = im.LookupPhrase("code", "ab-")
+	if fmt.Sprint(res) != "[testkey1 testkey3]" || err != nil {
+		t.Error("Unexpected lookup result:", res, err)
+		return
+	}
+
+	res, err = im.LookupPhrase("code", "b-1234/x")
+	if fmt.Sprint(res) != "[testkey1]" || err != nil {
+		t.Error("Unexpected lookup result:", res, err)
+		return
+	}
+
+	if res, err := im.LookupWord("code", "/X"); fmt.Sprint(res) != "map[]" || err != nil {
+		t.Error("Unexpected lookup result:", res, err)
+		return
+	}
+
+	if res, err := im.LookupWord("code", "34/"); fmt.Sprint(res) != "map[testkey1:[6] testkey2:[6]]" || err != nil {
+		t.Error("Unexpected lookup result:", res, err)
+		return
+	}
+
+	// Other attributes use the default analyzer
+
+	res, err = im.LookupPhrase("name", "ab 12")
+	if fmt.Sprint(res) != "[testkey3]" || err != nil {
+		t.Error("Unexpected lookup result:", res, err)
+		return
+	}
+
+	if res, err := im.Count("name", "BOX"); res != 2 || err != nil {
+		t.Error("Unexpected count result:", res, err)
+		return
+	}
+
+	// Deindexing uses the analyzer of the attribute
+
+	im.Deindex("testkey1", map[string]string{"code": "AB-1234/X", "name": "Red Box"})
+
+	res, err = im.LookupPhrase("code", "1234")
+	if fmt.Sprint(res) != "[testkey2]" || err != nil {
+		t.Error("Unexpected lookup result:", res, err)
+		return
+	}
+
+	// A nil analyzer resets the attribute to the default analyzer
+
+	im.SetAnalyzer("code", nil)
+
+	if res := im.analyzer("code").Name(); res != "default" {
+		t.Error("Unexpected analyzer:", res)
+		return
+	}
+
+	// Lookups on stale attributes fail
+
+	im.SetStale("code", "Code index is stale")
+
+	if _, err := im.LookupPhrase("code", "1234"); err == nil || err.Error() != "GraphError: Index is stale (Code index is stale)" {
+		t.Error("Unexpected error:", err)
+		return
+	}
+
+	if _, err := im.LookupWord("code", "1234"); err == nil || err.(*GraphError).Type != ErrIndexStale {
+		t.Error("Unexpected error:", err)
+		return
+	}
+
+	if _, err := im.LookupWordFuzzy("code", "1234", 1); err == nil || err.(*GraphError).Type != ErrIndexStale {
+		t.Error("Unexpected error:", err)
+		return
+	}
+
+	if _, err := im.Count("code", "1234"); err == nil || err.(*GraphError).Type != ErrIndexStale {
+		t.Error("Unexpected error:", err)
+		return
+	}
+
+	if res, err := im.Count("name", "box"); res != 1 || err != nil {
+		t.Error("Unexpected count result:", res, err)
+		return
+	}
+}
+
+func TestIndexMirror(t *testing.T) {
+
+	sm := storage.NewMemoryStorageManager("testsm")
+	htree, _ := hash.NewHTree(sm)
+	mtree, _ := hash.NewHTree(sm)
+
+	im := NewIndexManager(htree)
+	mirror := NewIndexManager(mtree)
+
+	im.Index("testkey1", map[string]string{"aaa": "first value"})
+
+	im.SetMirror(mirror)
+
+	im.Index("testkey2", map[string]string{"aaa": "second value"})
+	im.Reindex("testkey2", map[string]string{"aaa": "second test"}, map[string]string{"aaa": "second value"})
+	im.Deindex("testkey1", map[string]string{"aaa": "first value"})
+
+	if res, err := im.LookupWord("aaa", "value"); fmt.Sprint(res) != "map[]" || err != nil {
+		t.Error("Unexpected lookup result:", res, err)
+		return
+	}
+
+	if res, err := mirror.LookupWord("aaa", "value"); fmt.Sprint(res) != "map[]" || err != nil {
+		t.Error("Unexpected lookup result:", res, err)
+		return
+	}
+
+	if res, err := mirror.LookupPhrase("aaa", "second test"); fmt.Sprint(res) != "[testkey2]" || err != nil {
+		t.Error("Unexpected lookup result:", res, err)
+		return
+	}
+}
+
+func TestDeletionVariants(t *testing.T) {
+
+	formatVariants := func(variants map[string]bool) string {
+		var res []string
+		for v := range variants {
+			res = append(res, v)
+		}
+		sort.Strings(res)
+		return fmt.Sprint(res)
+	}
+
+	if res := formatVariants(deletionVariants("abc", 1)); res != "[ab ac bc]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := formatVariants(deletionVariants("abc", 2)); res != "[a ab ac b bc c]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := formatVariants(deletionVariants("über", 1)); res != "[ber übe übr üer]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := formatVariants(deletionVariants("ab", 0)); res != "[]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
 func TestUpdateIndex(t *testing.T) {
 
 	sm := storage.NewMemoryStorageManager("testsm")
@@ -319,8 +607,12 @@ func countChildren(tree *hash.HTree) int {
 	it := hash.NewHTreeIterator(tree)
 
 	for it.HasNext() {
-		it.Next()
-		count++
+
+		// Deletion variants for fuzzy lookups are not counted
+
+		if key, _ := it.Next(); string(key[:1]) != PrefixAttrFuzzy {
+			count++
+		}
 	}
 
 	return count
@@ -457,7 +749,7 @@ func TestAddRemoveIndexEntry(t *testing.T) {
 
 	testAddIndexPanic(t, im)
 
-	sm.AccessMap[2] = storage.AccessCacheAndFetchError
+	sm.AccessMap[16] = storage.AccessCacheAndFetchError
 
 	if res := im.addIndexEntry("mykey2", "myattr", "myword", []uint64{10, 12, 80}); res != storage.ErrSlotNotFound {
 		t.Error("Unexpected result:", res)
@@ -469,7 +761,7 @@ func TestAddRemoveIndexEntry(t *testing.T) {
 		return
 	}
 
-	delete(sm.AccessMap, 2)
+	delete(sm.AccessMap, 16)
 
 	im.removeIndexEntry("mykey", "myattr", "myword", []uint64{1, 5, 7})
 
@@ -555,7 +847,7 @@ func TestIndexManagerHashErrors(t *testing.T) {
 
 	im.Index("testkey", obj1)
 
-	sm.AccessMap[4] = storage.AccessCacheAndFetchError
+	sm.AccessMap[21] = storage.AccessCacheAndFetchError
 	if err := im.Index("testkey", obj1); err == nil {
 		t.Error("Error expected")
 		return
@@ -568,12 +860,12 @@ func TestIndexManagerHashErrors(t *testing.T) {
 		t.Error("Error expected")
 		return
 	}
-	sm.AccessMap[5] = storage.AccessUpdateError
+	sm.AccessMap[4] = storage.AccessUpdateError
 	if err := im.Reindex("testkey", obj1, obj2); err == nil {
 		t.Error("Error expected")
 		return
 	}
-	delete(sm.AccessMap, 4)
+	delete(sm.AccessMap, 21)
 }
 
 func testAddIndexPanic(t *testing.T, in *IndexManager) {
@@ -761,9 +1053,70 @@ func TestIndexManagerString(t *testing.T) {
 	im.Index("testkey", obj1)
 
 	if res := im.String(); res != "IndexManager: 1\n"+
+		"    3\"aaab\" map[bbb:[]]\n"+
 		"    1\"aaabbb\" map[testkey:[1]]\n"+
+		"    3\"aaabb\" map[bbb:[]]\n"+
 		"    2\"aaa\\b\\xf8\\xe0&\\fdA\\x85\\x10\\xce\\xfb+\\x06\\xee\\xe5\\xcd\" map[testkey:[]]\n" {
 		t.Error("Unexpected string output:", res)
 		return
 	}
 }
+
+func TestIndexManagerCheckEntries(t *testing.T) {
+	sm := storage.NewMemoryStorageManager("testsm")
+	htree, _ := hash.NewHTree(sm)
+
+	im := NewIndexManager(htree)
+
+	im.Index("key1", map[string]string{"aaa": "word1 word2"})
+	im.Index("key2", map[string]string{"aaa": "word2 word3"})
+
+	var indexkeys []string
+
+	it := hash.NewHTreeIterator(htree)
+	for it.HasNext() {
+		k, _ := it.Next()
+		indexkeys = append(indexkeys, string(k))
+	}
+
+	exists := func(key string) (bool, error) {
+		return key == "key1", nil
+	}
+
+	if res, err := im.CheckEntries(indexkeys, exists, false); fmt.Sprint(res) != "[key2]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, _ := im.LookupWord("aaa", "word3"); fmt.Sprint(res) != "map[key2:[2]]" {
+		t.Error("Unexpected lookup result:", res)
+		return
+	}
+
+	if res, err := im.CheckEntries(indexkeys, exists, true); fmt.Sprint(res) != "[key2]" || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, _ := im.LookupWord("aaa", "word3"); res != nil {
+		t.Error("Unexpected lookup result:", res)
+		return
+	}
+
+	if res, _ := im.LookupWord("aaa", "word2"); fmt.Sprint(res) != "map[key1:[2]]" {
+		t.Error("Unexpected lookup result:", res)
+		return
+	}
+
+	if res, err := im.CheckEntries(indexkeys, exists, false); len(res) != 0 || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := im.CheckEntries([]string{PrefixAttrWord + "aaa" + "word1"}, func(key string) (bool, error) {
+		return false, errors.New("testerror")
+	}, false); err == nil || err.Error() != "testerror" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
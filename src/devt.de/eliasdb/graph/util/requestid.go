@@ -0,0 +1,34 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util
+
+import "context"
+
+/*
+requestIDKey is the context key of a request ID.
+*/
+type requestIDKey struct{}
+
+/*
+WithRequestID returns a copy of a given context which carries a request ID.
+*/
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+/*
+RequestIDFromContext returns the request ID of a given context. Returns an
+empty string if the context carries no request ID.
+*/
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
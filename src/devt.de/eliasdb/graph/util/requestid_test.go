@@ -0,0 +1,31 @@
+/*
+ * EliasDB
+ *
+ * Copyright 2016 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+
+	ctx := context.Background()
+
+	if id := RequestIDFromContext(ctx); id != "" {
+		t.Error("Unexpected result:", id)
+		return
+	}
+
+	if id := RequestIDFromContext(WithRequestID(ctx, "123")); id != "123" {
+		t.Error("Unexpected result:", id)
+		return
+	}
+}
@@ -92,6 +92,18 @@ type htreeNode struct {
 	BucketSize byte          // Bucket size (only used for buckets)
 }
 
+/*
+setLocation sets the storage location of a node. Nodes which are cached by the
+storage manager are shared by all readers of a tree - the location is only
+written if it has changed so concurrent readers do not write to shared nodes.
+*/
+func (n *htreeNode) setLocation(loc uint64, sm storage.Manager) {
+	if n.loc != loc || n.sm != sm {
+		n.loc = loc
+		n.sm = sm
+	}
+}
+
 /*
 Fetch a HTree node from the storage.
 */
@@ -130,8 +142,7 @@ func NewHTree(sm storage.Manager) (*HTree, error) {
 		return nil, err
 	}
 
-	tree.Root.loc = loc
-	tree.Root.sm = sm
+	tree.Root.setLocation(loc, sm)
 
 	tree.mutex = &sync.Mutex{}
 
@@ -160,8 +171,7 @@ func LoadHTree(sm storage.Manager, loc uint64) (*HTree, error) {
 		tree = &HTree{&htreePage{obj.(*htreeNode)}, nil}
 	}
 
-	tree.Root.loc = loc
-	tree.Root.sm = sm
+	tree.Root.setLocation(loc, sm)
 
 	tree.mutex = &sync.Mutex{}
 
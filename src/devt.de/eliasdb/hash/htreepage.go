@@ -68,8 +68,7 @@ func (p *htreePage) Get(key []byte) (interface{}, *htreeBucket, error) {
 
 			page := &htreePage{node}
 
-			page.loc = loc
-			page.sm = p.sm
+			page.setLocation(loc, p.sm)
 
 			return page.Get(key)
 
@@ -79,8 +78,7 @@ func (p *htreePage) Get(key []byte) (interface{}, *htreeBucket, error) {
 
 		bucket := &htreeBucket{node}
 
-		bucket.loc = loc
-		bucket.sm = p.sm
+		bucket.setLocation(loc, p.sm)
 
 		return bucket.Get(key), bucket, nil
 	}
@@ -107,8 +105,7 @@ func (p *htreePage) Exists(key []byte) (bool, error) {
 
 			page := &htreePage{node}
 
-			page.loc = loc
-			page.sm = p.sm
+			page.setLocation(loc, p.sm)
 
 			return page.Exists(key)
 
@@ -151,8 +148,7 @@ func (p *htreePage) Put(key []byte, value interface{}) (interface{}, error) {
 			return nil, err
 		}
 
-		bucket.loc = loc
-		bucket.sm = p.sm
+		bucket.setLocation(loc, p.sm)
 
 		p.Children[hash] = loc
 
@@ -177,8 +173,7 @@ func (p *htreePage) Put(key []byte, value interface{}) (interface{}, error) {
 
 		page := &htreePage{node}
 
-		page.loc = loc
-		page.sm = p.sm
+		page.setLocation(loc, p.sm)
 
 		return page.Put(key, value)
 
@@ -188,8 +183,7 @@ func (p *htreePage) Put(key []byte, value interface{}) (interface{}, error) {
 
 	bucket := &htreeBucket{node}
 
-	bucket.loc = loc
-	bucket.sm = p.sm
+	bucket.setLocation(loc, p.sm)
 
 	if bucket.HasRoom() {
 
@@ -212,8 +206,7 @@ func (p *htreePage) Put(key []byte, value interface{}) (interface{}, error) {
 		return nil, err
 	}
 
-	page.loc = ploc
-	page.sm = p.sm
+	page.setLocation(ploc, p.sm)
 
 	p.Children[hash] = ploc
 
@@ -272,8 +265,7 @@ func (p *htreePage) Remove(key []byte) (interface{}, error) {
 
 		page := &htreePage{node}
 
-		page.loc = loc
-		page.sm = p.sm
+		page.setLocation(loc, p.sm)
 
 		ret, err := page.Remove(key)
 		if err != nil {
@@ -301,8 +293,7 @@ func (p *htreePage) Remove(key []byte) (interface{}, error) {
 
 	bucket := &htreeBucket{node}
 
-	bucket.loc = loc
-	bucket.sm = p.sm
+	bucket.setLocation(loc, p.sm)
 
 	ret := bucket.Remove(key)
 
@@ -352,8 +343,7 @@ func (p *htreePage) String() string {
 
 				page := &htreePage{node}
 
-				page.loc = child
-				page.sm = p.sm
+				page.setLocation(child, p.sm)
 
 				buf.WriteString(page.String())
 
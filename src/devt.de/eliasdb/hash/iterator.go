@@ -127,8 +127,7 @@ func (it *HTreeIterator) nextItem() error {
 
 		page := &htreePage{node}
 
-		page.loc = loc
-		page.sm = it.tree.Root.sm
+		page.setLocation(loc, it.tree.Root.sm)
 
 		nextChild := it.searchNextChild(page, index)
 
@@ -159,8 +158,7 @@ func (it *HTreeIterator) nextItem() error {
 
 	bucket := &htreeBucket{node}
 
-	bucket.loc = loc
-	bucket.sm = it.tree.Root.sm
+	bucket.setLocation(loc, it.tree.Root.sm)
 
 	nextElement := it.searchNextElement(bucket, index)
 
@@ -236,6 +236,30 @@ func (cdsm *CachedDiskStorageManager) Flush() error {
 	return cdsm.diskstoragemanager.Flush()
 }
 
+/*
+SyncLogs writes the transaction logs of all managed files to the files and
+starts new empty transaction logs.
+*/
+func (cdsm *CachedDiskStorageManager) SyncLogs() []*SyncResult {
+	return cdsm.diskstoragemanager.SyncLogs()
+}
+
+/*
+Backup copies all managed files and their transaction logs to a given
+directory.
+*/
+func (cdsm *CachedDiskStorageManager) Backup(dir string) ([]string, error) {
+	return cdsm.diskstoragemanager.Backup(dir)
+}
+
+/*
+PendingTransactions returns the largest number of transactions in the
+transaction logs which have not yet been written to disk.
+*/
+func (cdsm *CachedDiskStorageManager) PendingTransactions() int {
+	return cdsm.diskstoragemanager.PendingTransactions()
+}
+
 /*
 addToCache adds an entry to the cache.
 */
@@ -80,6 +80,17 @@ ErrReadonly is returned when attempting a write operation on a readonly datastor
 */
 var ErrReadonly = errors.New("Storage is readonly")
 
+/*
+SyncResult is the result of writing the transaction log of a storage file to
+the storage file.
+*/
+type SyncResult struct {
+	File         string // Name of the storage file
+	BytesWritten int64  // Number of bytes which were written to the storage file
+	LogBytes     int64  // Size of the transaction log before it was written
+	Error        error  // Error which occurred while writing the transaction log
+}
+
 /*
 DiskStorageManager data structure
 */
@@ -398,6 +409,91 @@ func (dsm *DiskStorageManager) Free(loc uint64) error {
 	return dsm.logicalSlotManager.Free(loc)
 }
 
+/*
+PendingTransactions returns the largest number of transactions in the
+transaction logs of the managed files which have not yet been written to disk.
+Returns 0 if transactions are disabled or the manager was closed.
+*/
+func (dsm *DiskStorageManager) PendingTransactions() int {
+	var ret int
+
+	dsm.mutex.Lock()
+	defer dsm.mutex.Unlock()
+
+	for _, sf := range []*file.StorageFile{dsm.physicalSlotsSf, dsm.physicalFreeSlotsSf,
+		dsm.logicalSlotsSf, dsm.logicalFreeSlotsSf} {
+
+		if sf != nil && sf.PendingTransactions() > ret {
+			ret = sf.PendingTransactions()
+		}
+	}
+
+	return ret
+}
+
+/*
+SyncLogs writes the transaction logs of all managed files to the files and
+starts new empty transaction logs. Changes which were not flushed are not
+written. Returns the result for each managed file or nil if the manager
+is readonly.
+*/
+func (dsm *DiskStorageManager) SyncLogs() []*SyncResult {
+	var ret []*SyncResult
+
+	dsm.checkFileOpen()
+
+	// When readonly this operation becomes a NOP
+
+	if dsm.readonly {
+		return nil
+	}
+
+	// Continue single threaded from here on
+
+	dsm.mutex.Lock()
+	defer dsm.mutex.Unlock()
+
+	for _, pager := range []*paging.PagedStorageFile{dsm.physicalSlotsPager,
+		dsm.physicalFreeSlotsPager, dsm.logicalSlotsPager, dsm.logicalFreeSlotsPager} {
+
+		written, logSize, err := pager.SyncLog()
+
+		ret = append(ret, &SyncResult{pager.StorageFile().Name(), written, logSize, err})
+	}
+
+	return ret
+}
+
+/*
+Backup copies all managed files and their transaction logs to a given
+directory. Changes which were not flushed are not part of the copy. Returns
+the names of the copied files.
+*/
+func (dsm *DiskStorageManager) Backup(dir string) ([]string, error) {
+	var ret []string
+
+	dsm.checkFileOpen()
+
+	// Continue single threaded from here on
+
+	dsm.mutex.Lock()
+	defer dsm.mutex.Unlock()
+
+	for _, sf := range []*file.StorageFile{dsm.physicalSlotsSf, dsm.physicalFreeSlotsSf,
+		dsm.logicalSlotsSf, dsm.logicalFreeSlotsSf} {
+
+		files, err := sf.Backup(dir)
+
+		ret = append(ret, files...)
+
+		if err != nil {
+			return ret, err
+		}
+	}
+
+	return ret, nil
+}
+
 /*
 Flush writes all pending changes to disk.
 */
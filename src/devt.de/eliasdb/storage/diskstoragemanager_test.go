@@ -571,6 +571,134 @@ func TestDiskStorageManagerRollback(t *testing.T) {
 	}
 }
 
+func TestDiskStorageManagerPendingTransactions(t *testing.T) {
+	dsm := NewDiskStorageManager(DBDIR+"/test5", false, false, false, true)
+	cdsm := NewCachedDiskStorageManager(dsm, 10)
+
+	if res := cdsm.PendingTransactions(); res != 0 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	for i := 1; i <= 3; i++ {
+		if _, err := dsm.Insert("This is a test"); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if err := dsm.Flush(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if res := cdsm.PendingTransactions(); res != i {
+			t.Error("Unexpected result:", res)
+			return
+		}
+	}
+
+	if err := dsm.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := dsm.PendingTransactions(); res != 0 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestDiskStorageManagerSyncLogs(t *testing.T) {
+	dsm := NewDiskStorageManager(DBDIR+"/test6", false, false, false, true)
+	cdsm := NewCachedDiskStorageManager(dsm, 10)
+
+	loc, err := cdsm.Insert("This is a test")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := cdsm.Flush(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	res := cdsm.SyncLogs()
+
+	if len(res) != 4 || res[0].File != DBDIR+"/test6."+FileSuffixPhysicalSlots {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	var written int64
+
+	for _, r := range res {
+		if r.Error != nil || (r.BytesWritten > 0 && r.LogBytes == 0) {
+			t.Error("Unexpected result:", r)
+			return
+		}
+		written += r.BytesWritten
+	}
+
+	if written == 0 || cdsm.PendingTransactions() != 0 {
+		t.Error("Unexpected result:", written, cdsm.PendingTransactions())
+		return
+	}
+
+	// Copy the files of the manager
+
+	os.Mkdir(DBDIR+"/backup", 0770)
+
+	files, err := cdsm.Backup(DBDIR + "/backup")
+
+	if err != nil || len(files) != 8 || files[0] != "test6."+FileSuffixPhysicalSlots+".0" {
+		t.Error("Unexpected result:", files, err)
+		return
+	}
+
+	bdsm := NewDiskStorageManager(DBDIR+"/backup/test6", true, false, false, true)
+
+	var bout string
+
+	if err := bdsm.Fetch(loc, &bout); err != nil || bout != "This is a test" {
+		t.Error("Unexpected result:", bout, err)
+		return
+	}
+
+	bdsm.Close()
+
+	if _, err := cdsm.Backup(DBDIR + "/" + InvalidFileName); err == nil {
+		t.Error("Backup to an invalid directory should fail")
+		return
+	}
+
+	if err := dsm.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Readonly managers do not write anything
+
+	dsm = NewDiskStorageManager(DBDIR+"/test6", true, false, false, true)
+
+	var out string
+
+	if err := dsm.Fetch(loc, &out); err != nil || out != "This is a test" {
+		t.Error("Unexpected result:", out, err)
+		return
+	}
+
+	if res := dsm.SyncLogs(); res != nil {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if err := dsm.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+}
+
 const InvalidFileName = "**" + string(0x0)
 
 func TestDiskStorageManagerInit(t *testing.T) {
@@ -15,7 +15,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
+	"devt.de/common/fileutil"
 	"devt.de/common/sortutil"
 )
 
@@ -364,6 +368,17 @@ func (s *StorageFile) ReleaseInUse(record *Record) {
 	}
 }
 
+/*
+PendingTransactions returns the number of transactions in the transaction log
+which have not yet been written to the storage file.
+*/
+func (s *StorageFile) PendingTransactions() int {
+	if s.tm == nil {
+		return 0
+	}
+	return s.tm.curTrans + 1
+}
+
 /*
 Flush commits the current transaction by flushing all dirty records to the
 transaction log on disk. If transactions are disabled it simply
@@ -431,6 +446,75 @@ func (s *StorageFile) Rollback() error {
 	return nil
 }
 
+/*
+SyncLog writes all committed transactions from the transaction log to the
+storage file and starts a new empty transaction log. Dirty records which were
+not yet flushed are not written. Returns the number of bytes which were written
+to the storage file and the size of the old transaction log in bytes.
+*/
+func (s *StorageFile) SyncLog() (int64, int64, error) {
+
+	if s.transDisabled {
+		s.Sync()
+		return 0, 0, nil
+	}
+
+	if len(s.inUse) > 0 {
+		return 0, 0, ErrInUse.fireError(s, fmt.Sprintf("Records %v", len(s.inUse)))
+	}
+
+	var logSize int64
+
+	if fi, err := os.Stat(s.tm.name); err == nil {
+		logSize = fi.Size()
+	}
+
+	written := int64(s.tm.pendingRecords()) * int64(s.recordSize)
+
+	if err := s.tm.syncLogFromMemory(); err != nil {
+		return 0, logSize, err
+	}
+
+	return written, logSize, nil
+}
+
+/*
+Backup copies all physical files and the transaction log of the storage file
+to a given directory. The copy contains all committed transactions - dirty
+records which were not flushed are not part of the copy. The storage file must
+not be flushed while the copy is made. Returns the names of the copied files.
+*/
+func (s *StorageFile) Backup(dir string) ([]string, error) {
+	var ret []string
+
+	s.Sync()
+
+	files, err := filepath.Glob(s.name + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		suffix := strings.TrimPrefix(f, s.name+".")
+
+		// Only copy data files and the transaction log
+
+		if _, err := strconv.Atoi(suffix); err != nil && (s.transDisabled || suffix != LogFileSuffix) {
+			continue
+		}
+
+		name := filepath.Base(f)
+
+		if _, err := fileutil.CopyFile(f, filepath.Join(dir, name)); err != nil {
+			return ret, err
+		}
+
+		ret = append(ret, name)
+	}
+
+	return ret, nil
+}
+
 /*
 Sync syncs all physical files.
 */
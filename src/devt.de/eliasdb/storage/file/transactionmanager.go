@@ -306,6 +306,22 @@ func (t *TransactionManager) syncLogFromMemory() error {
 	return t.open()
 }
 
+/*
+pendingRecords returns the number of distinct records in the memory
+transaction log.
+*/
+func (t *TransactionManager) pendingRecords() int {
+	ids := make(map[uint64]bool)
+
+	for _, transList := range t.transList {
+		for _, record := range transList {
+			ids[record.ID()] = true
+		}
+	}
+
+	return len(ids)
+}
+
 /*
 syncLogFromDisk syncs the log from disk and clears the memory transaction log.
 This is used for the rollback operation.
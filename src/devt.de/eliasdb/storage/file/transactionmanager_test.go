@@ -608,3 +608,150 @@ func TestRollbackFail(t *testing.T) {
 
 	sf.Close()
 }
+
+func TestSyncLog(t *testing.T) {
+	sf, err := NewDefaultStorageFile(DBDir+"/trans_test7", false)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	for _, id := range []uint64{1, 2, 1} {
+		record, err := sf.Get(id)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		record.WriteSingleByte(5, byte(id))
+		sf.ReleaseInUse(record)
+
+		sf.Flush()
+	}
+
+	// Records which were not flushed are not written
+
+	record, err := sf.Get(3)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	record.WriteSingleByte(5, 0x42)
+
+	if _, _, err := sf.SyncLog(); err != ErrInUse {
+		t.Error("It should not be possible to sync the log while records are still in use")
+		return
+	}
+
+	sf.ReleaseInUse(record)
+
+	written, logSize, err := sf.SyncLog()
+
+	if err != nil || written != 2*int64(sf.RecordSize()) || logSize <= int64(len(TransactionLogHeader)) {
+		t.Error("Unexpected result:", written, logSize, err)
+		return
+	}
+
+	if sf.PendingTransactions() != 0 || len(sf.inTrans) != 0 || len(sf.dirty) != 1 {
+		t.Error("Unexpected storage file state:", sf.PendingTransactions(), len(sf.inTrans), len(sf.dirty))
+		return
+	}
+
+	if res, err := fileutil.PathExists(DBDir + "/trans_test7." + LogFileSuffix); !res || err != nil {
+		t.Error("Transaction log should exist:", err)
+		return
+	}
+
+	if fi, _ := os.Stat(DBDir + "/trans_test7." + LogFileSuffix); fi.Size() != int64(len(TransactionLogHeader)) {
+		t.Error("Transaction log should be empty:", fi.Size())
+		return
+	}
+
+	written, logSize, err = sf.SyncLog()
+
+	if err != nil || written != 0 || logSize != int64(len(TransactionLogHeader)) {
+		t.Error("Unexpected result:", written, logSize, err)
+		return
+	}
+
+	sf.Close()
+
+	// Storage files without transactions only sync their files
+
+	sf, err = NewDefaultStorageFile(DBDir+"/trans_test8", true)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	if written, logSize, err = sf.SyncLog(); err != nil || written != 0 || logSize != 0 {
+		t.Error("Unexpected result:", written, logSize, err)
+		return
+	}
+
+	sf.Close()
+}
+
+func TestBackup(t *testing.T) {
+	sf, err := NewDefaultStorageFile(DBDir+"/trans_test9", false)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	record, err := sf.Get(1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	record.WriteSingleByte(5, 0x42)
+	sf.ReleaseInUse(record)
+
+	sf.Flush()
+
+	// Records which were not flushed are not part of the copy
+
+	record, err = sf.Get(2)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	record.WriteSingleByte(5, 0x42)
+	sf.ReleaseInUse(record)
+
+	os.Mkdir(DBDir+"/backup", 0770)
+
+	files, err := sf.Backup(DBDir + "/backup")
+
+	if err != nil || !reflect.DeepEqual(files, []string{"trans_test9.0", "trans_test9." + LogFileSuffix}) {
+		t.Error("Unexpected result:", files, err)
+		return
+	}
+
+	sf.Close()
+
+	// The copy recovers the committed transactions from the transaction log
+
+	sf, err = NewDefaultStorageFile(DBDir+"/backup/trans_test9", false)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	record, _ = sf.Get(1)
+	record2, _ := sf.Get(2)
+
+	if record.ReadSingleByte(5) != 0x42 || record2.ReadSingleByte(5) != 0 {
+		t.Error("Unexpected data in records:", record, record2)
+		return
+	}
+
+	sf.ReleaseInUse(record)
+	sf.ReleaseInUse(record2)
+
+	sf.Close()
+
+	if _, err = sf.Backup(DBDir + "/" + InvalidFileName); err == nil {
+		t.Error("Backup to an invalid directory should fail")
+		return
+	}
+}
@@ -62,6 +62,11 @@ MsmCallNumRollback counter how often Rollback is called
 */
 var MsmCallNumRollback int
 
+/*
+msmCallNumMutex protects the call counters
+*/
+var msmCallNumMutex = &sync.Mutex{}
+
 /*
 MemoryStorageManager data structure
 */
@@ -197,7 +202,10 @@ func (msm *MemoryStorageManager) FetchCached(loc uint64) (interface{}, error) {
 Flush writes all pending changes to disk.
 */
 func (msm *MemoryStorageManager) Flush() error {
+	msmCallNumMutex.Lock()
 	MsmCallNumFlush++
+	msmCallNumMutex.Unlock()
+
 	return MsmRetFlush
 }
 
@@ -205,7 +213,10 @@ func (msm *MemoryStorageManager) Flush() error {
 Rollback cancels all pending changes which have not yet been written to disk.
 */
 func (msm *MemoryStorageManager) Rollback() error {
+	msmCallNumMutex.Lock()
 	MsmCallNumRollback++
+	msmCallNumMutex.Unlock()
+
 	return MsmRetRollback
 }
 
@@ -213,7 +224,10 @@ func (msm *MemoryStorageManager) Rollback() error {
 Close the StorageManager and write all pending changes to disk.
 */
 func (msm *MemoryStorageManager) Close() error {
+	msmCallNumMutex.Lock()
 	MsmCallNumClose++
+	msmCallNumMutex.Unlock()
+
 	return MsmRetClose
 }
 
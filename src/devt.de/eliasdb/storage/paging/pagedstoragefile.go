@@ -314,6 +314,25 @@ func (psf *PagedStorageFile) Flush() error {
 	return nil
 }
 
+/*
+SyncLog writes all committed transactions from the transaction log to the
+storage file and starts a new empty transaction log. Returns the number of
+bytes which were written to the storage file and the size of the old
+transaction log in bytes.
+*/
+func (psf *PagedStorageFile) SyncLog() (int64, int64, error) {
+	psf.storagefile.ReleaseInUse(psf.header.record)
+
+	written, logSize, err := psf.storagefile.SyncLog()
+
+	// The header record is put back in use in any case
+
+	record, _ := psf.storagefile.Get(0)
+	psf.header = NewPagedStorageFileHeader(record, false)
+
+	return written, logSize, err
+}
+
 /*
 Rollback discards all changes which were done after the last flush.
 The PageStorageFile object should be discarded if something
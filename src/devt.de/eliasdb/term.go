@@ -243,6 +243,18 @@ const TermSRC = `
             }
         };
 
+        // Parse errors of queries are returned as JSON objects
+        //
+        t.queryError = function (r) {
+            "use strict";
+            try {
+                var e = JSON.parse(r);
+                return e.hint !== "" ? e.error + " - " + e.hint : e.error;
+            } catch(ex) {
+                return r;
+            }
+        };
+
         // Global variables
         // ================
 
@@ -671,7 +683,7 @@ const TermSRC = `
                         t.main.addTableOutput(element, r);
                     },
                     function (r) {
-                        t.main.addError(element, r);
+                        t.main.addError(element, t.queryError(r));
                     });
             },
 
@@ -684,7 +696,7 @@ const TermSRC = `
                         t.main.addTableOutput(element, r);
                     },
                     function (r) {
-                        t.main.addError(element, r);
+                        t.main.addError(element, t.queryError(r));
                     });
             },
 